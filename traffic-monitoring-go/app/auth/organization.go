@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/models"
+)
+
+var (
+	// ErrUnknownOrganization is returned for organization slugs and IDs that do not exist
+	ErrUnknownOrganization = errors.New("unknown organization")
+	// ErrOrganizationDisabled is returned for callers of a disabled organization
+	ErrOrganizationDisabled = errors.New("organization is disabled")
+)
+
+// organizationCacheTTL bounds how long a change made on another instance takes to apply here
+const organizationCacheTTL = 10 * time.Second
+
+// organizationCache keeps the organizations in memory, by ID and slug, so
+// resolving the tenant of a request or an index name costs no query
+type organizationCache struct {
+	mutex    sync.RWMutex
+	loaded   bool
+	loadedAt time.Time
+	byID     map[uint]*models.Organization
+	bySlug   map[string]*models.Organization
+}
+
+var defaultOrganizationCache = &organizationCache{}
+
+// InvalidateOrganizations forces the organizations to reload. Call it whenever
+// organizations are created, updated or deleted.
+func InvalidateOrganizations() {
+	cache.Invalidate("organizations")
+}
+
+// invalidate drops the cached organizations of this instance
+func (c *organizationCache) invalidate() {
+	c.mutex.Lock()
+	c.loaded = false
+	c.mutex.Unlock()
+}
+
+func init() {
+	cache.OnInvalidate("organizations", defaultOrganizationCache.invalidate)
+}
+
+func (c *organizationCache) get(db *gorm.DB) (*organizationCache, error) {
+	c.mutex.RLock()
+	if c.loaded && time.Since(c.loadedAt) <= organizationCacheTTL {
+		c.mutex.RUnlock()
+		return c, nil
+	}
+	c.mutex.RUnlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded || time.Since(c.loadedAt) > organizationCacheTTL {
+		var organizations []models.Organization
+		if err := db.Find(&organizations).Error; err != nil {
+			return nil, err
+		}
+		c.byID = make(map[uint]*models.Organization, len(organizations))
+		c.bySlug = make(map[string]*models.Organization, len(organizations))
+		for i := range organizations {
+			c.byID[organizations[i].ID] = &organizations[i]
+			c.bySlug[organizations[i].Slug] = &organizations[i]
+		}
+		c.loaded = true
+		c.loadedAt = time.Now()
+	}
+	return c, nil
+}
+
+// OrganizationBySlug returns the organization named by slug
+func OrganizationBySlug(db *gorm.DB, slug string) (*models.Organization, error) {
+	cache, err := defaultOrganizationCache.get(db)
+	if err != nil {
+		return nil, err
+	}
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+	organization, ok := cache.bySlug[slug]
+	if !ok {
+		return nil, ErrUnknownOrganization
+	}
+	return organization, nil
+}
+
+// OrganizationByID returns the organization with id
+func OrganizationByID(db *gorm.DB, id uint) (*models.Organization, error) {
+	cache, err := defaultOrganizationCache.get(db)
+	if err != nil {
+		return nil, err
+	}
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+	organization, ok := cache.byID[id]
+	if !ok {
+		return nil, ErrUnknownOrganization
+	}
+	return organization, nil
+}
+
+// ResolveOrganization sets the tenant of a caller. Callers bound to an
+// organization may only name their own, and must have it enabled; the shared
+// admin and ingest tokens act for the organization they name, or for every
+// tenant when they name none.
+func ResolveOrganization(db *gorm.DB, claims *Claims, slug string) error {
+	if claims.OrganizationID == nil && slug == "" {
+		return nil
+	}
+
+	var organization *models.Organization
+	var err error
+	if claims.OrganizationID != nil {
+		organization, err = OrganizationByID(db, *claims.OrganizationID)
+	} else {
+		organization, err = OrganizationBySlug(db, slug)
+	}
+	if err != nil {
+		return err
+	}
+	if slug != "" && slug != organization.Slug {
+		return ErrUnknownOrganization
+	}
+	if !organization.Enabled {
+		return ErrOrganizationDisabled
+	}
+
+	id := organization.ID
+	claims.OrganizationID = &id
+	claims.Organization = organization.Slug
+	return nil
+}
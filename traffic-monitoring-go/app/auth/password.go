@@ -0,0 +1,20 @@
+package auth
+
+import "golang.org/x/crypto/bcrypt"
+
+// MinPasswordLength is the shortest password accepted for a user
+const MinPasswordLength = 8
+
+// HashPassword returns the bcrypt hash stored for a password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches the stored hash
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
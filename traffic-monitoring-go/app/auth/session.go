@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+)
+
+// maxSessions is how many sessions a user may hold at once, 0 for no limit.
+// A user's max_sessions overrides it.
+var maxSessions = config.NewInt("MAX_SESSIONS_PER_USER", 0, "Sessions a user may hold at once; 0 for no limit", config.Min(0), config.Reloadable)
+
+// SessionLimit returns the number of concurrent sessions allowed for user, 0 for no limit
+func SessionLimit(user *models.User) int {
+	if user.MaxSessions > 0 {
+		return user.MaxSessions
+	}
+	return maxSessions.Get()
+}
+
+// StartSession issues a token for user and records its session. When the user
+// is at the session limit, the oldest active sessions are revoked to make room.
+func StartSession(db *gorm.DB, user *models.User, clientIP, userAgent string) (string, *models.UserSession, error) {
+	token, claims, err := IssueToken(user)
+	if err != nil {
+		return "", nil, err
+	}
+	session := &models.UserSession{
+		TokenID:   claims.TokenID,
+		UserID:    user.ID,
+		Email:     user.Email,
+		ClientIP:  clientIP,
+		UserAgent: userAgent,
+		IssuedAt:  time.Unix(claims.IssuedAt, 0),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}
+
+	var displaced int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if limit := SessionLimit(user); limit > 0 {
+			// concurrent logins of the same user wait for each other, so both count each other
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, user.ID).Error; err != nil {
+				return err
+			}
+
+			var keep []uint
+			err := tx.Model(&models.UserSession{}).
+				Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+				Order("issued_at DESC, id DESC").
+				Limit(limit-1).
+				Pluck("id", &keep).Error
+			if err != nil {
+				return err
+			}
+
+			query := tx.Where("user_id = ?", user.ID)
+			if len(keep) > 0 {
+				query = query.Where("id NOT IN ?", keep)
+			}
+			displaced, err = revokeWhere(query, "session-limit", fmt.Sprintf("concurrent session limit of %d reached", limit))
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Create(session).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if displaced > 0 {
+		InvalidateRevocations()
+	}
+	return token, session, nil
+}
+
+// revokeWhere revokes the active sessions selected by query and returns how many it revoked
+func revokeWhere(query *gorm.DB, by, reason string) (int64, error) {
+	now := time.Now()
+	result := query.Model(&models.UserSession{}).
+		Where("revoked_at IS NULL AND expires_at > ?", now).
+		Updates(map[string]interface{}{"revoked_at": now, "revoked_by": by, "revoke_reason": reason})
+	return result.RowsAffected, result.Error
+}
+
+// RevokeSession revokes one active session and reports whether it was active
+func RevokeSession(db *gorm.DB, id uint, by, reason string) (bool, error) {
+	revoked, err := revokeWhere(db.Where("id = ?", id), by, reason)
+	if revoked > 0 {
+		InvalidateRevocations()
+	}
+	return revoked > 0, err
+}
+
+// RevokeToken revokes the session of a token ID, as on logout
+func RevokeToken(db *gorm.DB, tokenID, by, reason string) (bool, error) {
+	revoked, err := revokeWhere(db.Where("token_id = ?", tokenID), by, reason)
+	if revoked > 0 {
+		InvalidateRevocations()
+	}
+	return revoked > 0, err
+}
+
+// RevokeUserSessions logs a user out everywhere and returns how many sessions it revoked
+func RevokeUserSessions(db *gorm.DB, userID uint, by, reason string) (int64, error) {
+	revoked, err := revokeWhere(db.Where("user_id = ?", userID), by, reason)
+	if revoked > 0 {
+		InvalidateRevocations()
+	}
+	return revoked, err
+}
+
+// revocationCacheTTL bounds how long a session revoked on another instance stays usable here
+const revocationCacheTTL = 10 * time.Second
+
+// revocationCache keeps the IDs of revoked, unexpired tokens in memory so
+// authenticating a request costs no query
+type revocationCache struct {
+	mutex    sync.RWMutex
+	loaded   bool
+	loadedAt time.Time
+	revoked  map[string]bool
+}
+
+var defaultRevocationCache = &revocationCache{}
+
+// InvalidateRevocations forces the revocation list to reload. Call it whenever sessions are revoked.
+func InvalidateRevocations() {
+	cache.Invalidate("session_revocations")
+}
+
+// invalidate drops the cached revoked tokens of this instance
+func (c *revocationCache) invalidate() {
+	c.mutex.Lock()
+	c.loaded = false
+	c.mutex.Unlock()
+}
+
+func init() {
+	cache.OnInvalidate("session_revocations", defaultRevocationCache.invalidate)
+}
+
+func (c *revocationCache) get(db *gorm.DB) (map[string]bool, error) {
+	c.mutex.RLock()
+	if c.loaded && time.Since(c.loadedAt) <= revocationCacheTTL {
+		revoked := c.revoked
+		c.mutex.RUnlock()
+		return revoked, nil
+	}
+	c.mutex.RUnlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded || time.Since(c.loadedAt) > revocationCacheTTL {
+		var tokenIDs []string
+		err := db.Model(&models.UserSession{}).
+			Where("revoked_at IS NOT NULL AND expires_at > ?", time.Now()).
+			Pluck("token_id", &tokenIDs).Error
+		if err != nil {
+			return nil, err
+		}
+		revoked := make(map[string]bool, len(tokenIDs))
+		for _, id := range tokenIDs {
+			revoked[id] = true
+		}
+		c.revoked = revoked
+		c.loaded = true
+		c.loadedAt = time.Now()
+	}
+	return c.revoked, nil
+}
+
+// CheckSession rejects tokens whose session was revoked, and tokens issued
+// before sessions were tracked, which could not be revoked
+func CheckSession(db *gorm.DB, claims *Claims) error {
+	if claims.TokenID == "" {
+		return ErrInvalidToken
+	}
+	revoked, err := defaultRevocationCache.get(db)
+	if err != nil {
+		return err
+	}
+	if revoked[claims.TokenID] {
+		return ErrTokenRevoked
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+)
+
+var (
+	// ErrInvalidToken is returned for malformed tokens and bad signatures
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned for tokens past their expiry
+	ErrTokenExpired = errors.New("token expired")
+	// ErrTokenRevoked is returned for tokens whose session was revoked
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+var (
+	jwtSecret     = config.NewString("JWT_SECRET", "", "Key signing the access tokens; random per instance when unset", config.Secret)
+	jwtTTLMinutes = config.NewInt("JWT_TTL_MINUTES", 480, "Minutes an access token is valid", config.Min(1), config.Reloadable)
+)
+
+// signingKey signs the access tokens, configured with JWT_SECRET, read at the first use
+var (
+	signingKey     []byte
+	signingKeyOnce sync.Once
+)
+
+// TokenTTL is how long an access token is valid, configured with JWT_TTL_MINUTES (default 480)
+func TokenTTL() time.Duration {
+	return time.Duration(jwtTTLMinutes.Get()) * time.Minute
+}
+
+func loadSigningKey() []byte {
+	if secret := jwtSecret.Get(); secret != "" {
+		return []byte(secret)
+	}
+	// without a configured secret, tokens only verify on this instance until it restarts
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("Failed to generate a token signing key: %v", err)
+	}
+	log.Println("Warning: JWT_SECRET is not set; using a random signing key, tokens will not survive a restart")
+	return key
+}
+
+// Claims are the contents of an access token
+type Claims struct {
+	Subject   string          `json:"sub"`
+	TokenID   string          `json:"jti,omitempty"` // identifies the session; empty for the shared API tokens
+	UserID    uint            `json:"uid"`
+	Email     string          `json:"email"`
+	Role      models.UserRole `json:"role"`
+	IssuedAt  int64           `json:"iat"`
+	ExpiresAt int64           `json:"exp"`
+
+	// OrganizationID is the tenant the caller acts for; nil acts for every tenant
+	OrganizationID *uint  `json:"org,omitempty"`
+	Organization   string `json:"-"` // its slug, set by ResolveOrganization
+
+	// APIKey is the log source key the caller presented, if any
+	APIKey *models.APIKey `json:"-"`
+}
+
+// Actor names the caller in audit fields such as revoked_by
+func (c *Claims) Actor() string {
+	if c.Email != "" {
+		return c.Email
+	}
+	return c.Subject
+}
+
+// tokenHeader is the fixed JOSE header of the HS256 tokens issued here
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func sign(payload string) string {
+	signingKeyOnce.Do(func() { signingKey = loadSigningKey() })
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueToken returns a signed HS256 JWT for the user and its claims. Use
+// StartSession for tokens handed to users, so they can be revoked.
+func IssueToken(user *models.User) (string, *Claims, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	expires := now.Add(TokenTTL())
+	claims := &Claims{
+		Subject:   strconv.FormatUint(uint64(user.ID), 10),
+		TokenID:   hex.EncodeToString(id),
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+
+		OrganizationID: user.OrganizationID,
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + sign(unsigned), claims, nil
+}
+
+// ParseToken verifies a token issued by IssueToken and returns its claims
+func ParseToken(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(sign(parts[0]+"."+parts[1]))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
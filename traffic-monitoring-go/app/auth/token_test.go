@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"traffic-monitoring-go/app/models"
+)
+
+// encodeSegment base64url-encodes a token segment
+func encodeSegment(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// signedToken builds a token of an encoded header and payload, signed with
+// this instance's key
+func signedToken(header, payload string) string {
+	unsigned := header + "." + payload
+	return unsigned + "." + sign(unsigned)
+}
+
+// encodeClaims returns the encoded payload of claims
+func encodeClaims(t *testing.T, claims Claims) string {
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func TestParseToken(t *testing.T) {
+	user := &models.User{ID: 7, Email: "analyst@example.com", Role: models.AnalystRole}
+	issued, issuedClaims, err := IssueToken(user)
+	require.NoError(t, err)
+	parts := strings.Split(issued, ".")
+	require.Len(t, parts, 3)
+
+	now := time.Now().Unix()
+	valid := Claims{Subject: "7", UserID: 7, Role: models.AnalystRole, IssuedAt: now, ExpiresAt: now + 60}
+	admin := *issuedClaims
+	admin.Role = models.AdminRole
+	expired := valid
+	expired.IssuedAt, expired.ExpiresAt = now-120, now-60
+	expiring := valid
+	expiring.ExpiresAt = now
+
+	tests := []struct {
+		name   string
+		token  string
+		claims *Claims
+		err    error
+	}{
+		{name: "issued token", token: issued, claims: issuedClaims},
+		{name: "signed claims", token: signedToken(tokenHeader, encodeClaims(t, valid)), claims: &valid},
+
+		// tampering invalidates the signature
+		{name: "tampered payload", token: parts[0] + "." + encodeClaims(t, admin) + "." + parts[2], err: ErrInvalidToken},
+		{name: "tampered signature", token: parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])), err: ErrInvalidToken},
+		{name: "signature of another token", token: parts[0] + "." + encodeClaims(t, valid) + "." + parts[2], err: ErrInvalidToken},
+		{name: "no signature", token: parts[0] + "." + parts[1] + ".", err: ErrInvalidToken},
+
+		// only the header of the tokens issued here is accepted, even when signed
+		{name: "unsigned algorithm", token: encodeSegment(`{"alg":"none","typ":"JWT"}`) + "." + parts[1] + ".", err: ErrInvalidToken},
+		{name: "other algorithm", token: signedToken(encodeSegment(`{"alg":"HS512","typ":"JWT"}`), parts[1]), err: ErrInvalidToken},
+		{name: "header with other spacing", token: signedToken(encodeSegment(`{"alg": "HS256", "typ": "JWT"}`), parts[1]), err: ErrInvalidToken},
+
+		// malformed tokens
+		{name: "empty", token: "", err: ErrInvalidToken},
+		{name: "two segments", token: parts[0] + "." + parts[1], err: ErrInvalidToken},
+		{name: "four segments", token: issued + ".x", err: ErrInvalidToken},
+		{name: "signed payload not base64", token: signedToken(tokenHeader, "!!!"), err: ErrInvalidToken},
+		{name: "signed payload not JSON", token: signedToken(tokenHeader, encodeSegment("not json")), err: ErrInvalidToken},
+
+		// expiry
+		{name: "expired", token: signedToken(tokenHeader, encodeClaims(t, expired)), err: ErrTokenExpired},
+		{name: "expiring this second", token: signedToken(tokenHeader, encodeClaims(t, expiring)), err: ErrTokenExpired},
+		{name: "without expiry", token: signedToken(tokenHeader, encodeSegment(`{"sub":"7","uid":7}`)), err: ErrTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(tt.token)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Nil(t, claims)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.claims, claims)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Package cache connects the in-memory caches of the SIEM instances. Packages
+// keep their hot lookups, such as the enabled rules or the log sources, in
+// memory and register how to drop each cache with OnInvalidate. Invalidate
+// drops a cache on this instance and, when REDIS_URL is set, on every other
+// instance through a Redis channel, so a rule edited through one instance
+// applies everywhere at once rather than when the others' caches expire.
+//
+// Redis also holds state the instances share, such as the recent messages of
+// each V2X source (see Shared). Every cache keeps working locally while Redis
+// is unreachable.
+package cache
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/metrics"
+)
+
+var (
+	redisURL = config.NewString("REDIS_URL", "", "Redis shared by the instances for cache invalidation and per-vehicle state, e.g. redis://:password@redis:6379/0; empty keeps every cache local",
+		config.Secret, config.Check(func(value string) error {
+			if value == "" {
+				return nil
+			}
+			_, err := NewRedis(value, time.Second)
+			return err
+		}))
+	redisKeyPrefix = config.NewString("REDIS_KEY_PREFIX", "siem:", "Prefix of the keys and channels of the SIEM in Redis, to share a server between deployments")
+	redisTimeoutMS = config.NewInt("REDIS_TIMEOUT_MS", 200, "Milliseconds to wait for Redis before falling back to local state", config.Positive)
+)
+
+var (
+	cacheInvalidations = metrics.NewCounterVec("siem_cache_invalidations_total",
+		"Caches dropped, by cache and whether another instance asked", "cache", "remote")
+	redisFailures = metrics.NewCounterVec("siem_redis_errors_total",
+		"Redis commands that failed, by use; the caches fell back to local state", "use")
+)
+
+// cacheLog is the logger of the cache invalidation
+var cacheLog = logging.New("cache")
+
+var (
+	hooksMutex sync.RWMutex
+	hooks      = make(map[string][]func())
+
+	sharedMutex sync.RWMutex
+	shared      *Redis
+
+	// instanceID tells the invalidations of this instance from the others'
+	instanceID = logging.NewID()
+)
+
+// OnInvalidate registers invalidate to drop the named cache. Packages usually
+// register their caches from init.
+func OnInvalidate(name string, invalidate func()) {
+	hooksMutex.Lock()
+	defer hooksMutex.Unlock()
+	hooks[name] = append(hooks[name], invalidate)
+}
+
+// Names returns the names of the registered caches, sorted
+func Names() []string {
+	hooksMutex.RLock()
+	defer hooksMutex.RUnlock()
+
+	names := make([]string, 0, len(hooks))
+	for name := range hooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Invalidate drops the named cache on this instance and asks the other
+// instances to drop theirs
+func Invalidate(name string) {
+	invalidateLocal(name, false)
+
+	r := Shared()
+	if r == nil {
+		return
+	}
+	if err := r.Publish(Key("invalidate"), instanceID+" "+name); err != nil {
+		redisFailures.Inc("invalidate")
+		cacheLog.Sampled("cache.publish").Warn("failed to send cache invalidation to the other instances",
+			"cache", name, "error", err)
+	}
+}
+
+// invalidateLocal runs the hooks of the named cache
+func invalidateLocal(name string, remote bool) {
+	hooksMutex.RLock()
+	invalidate := hooks[name]
+	hooksMutex.RUnlock()
+
+	for _, hook := range invalidate {
+		hook()
+	}
+	if remote {
+		cacheInvalidations.Inc(name, "true")
+	} else {
+		cacheInvalidations.Inc(name, "false")
+	}
+}
+
+// invalidateAll drops every cache on this instance, after missing what the
+// other instances sent
+func invalidateAll() {
+	for _, name := range Names() {
+		invalidateLocal(name, true)
+	}
+}
+
+// Shared returns the Redis the instances share, or nil when REDIS_URL is unset
+func Shared() *Redis {
+	sharedMutex.RLock()
+	defer sharedMutex.RUnlock()
+	return shared
+}
+
+// Key returns the Redis key of the SIEM made of parts, e.g. Key("v2x", id)
+func Key(parts ...string) string {
+	return redisKeyPrefix.Get() + strings.Join(parts, ":")
+}
+
+// RecordFailure counts a failed Redis command of a use, such as "v2x_history"
+func RecordFailure(use string) {
+	redisFailures.Inc(use)
+}
+
+// Connect shares the caches through REDIS_URL and follows the invalidations of
+// the other instances until ctx is done. It returns nil when REDIS_URL is
+// unset. The caches stay local while the server does not answer.
+func Connect(ctx context.Context) (*Redis, error) {
+	if redisURL.Get() == "" {
+		return nil, nil
+	}
+	r, err := NewRedis(redisURL.Get(), time.Duration(redisTimeoutMS.Get())*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedMutex.Lock()
+	shared = r
+	sharedMutex.Unlock()
+
+	subscribed := false
+	go r.Subscribe(ctx, Key("invalidate"), func(message string) {
+		sender, name, ok := strings.Cut(message, " ")
+		if !ok || sender == instanceID {
+			return
+		}
+		invalidateLocal(name, true)
+	}, func(err error) {
+		if err != nil {
+			redisFailures.Inc("subscribe")
+			cacheLog.Sampled("cache.subscribe").Warn("lost the cache invalidations of the other instances, reconnecting", "error", err)
+			return
+		}
+		// invalidations sent while disconnected were missed
+		if subscribed {
+			invalidateAll()
+		}
+		subscribed = true
+		cacheLog.Info("following the cache invalidations of the other instances", "channel", Key("invalidate"))
+	})
+	return r, nil
+}
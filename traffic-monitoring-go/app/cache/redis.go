@@ -0,0 +1,342 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	redisPoolSize   = 8
+	redisMinBackoff = time.Second
+	redisMaxBackoff = 30 * time.Second
+)
+
+// ErrRedisUnavailable is returned without trying while a server that just
+// failed is given time to recover, so callers fall back to local state at once
+var ErrRedisUnavailable = errors.New("redis: server unavailable, retrying shortly")
+
+// RedisError is an error reply of the Redis server, such as WRONGTYPE
+type RedisError string
+
+func (e RedisError) Error() string { return "redis: " + string(e) }
+
+// Redis is a small client of the Redis protocol (RESP2), enough for the shared
+// caches: commands, pipelines and a subscription. It keeps a few idle
+// connections and is safe for concurrent use.
+type Redis struct {
+	address  string
+	useTLS   bool
+	password string
+	database int
+	timeout  time.Duration
+	idle     chan *redisConn
+
+	mutex   sync.Mutex
+	retryAt time.Time // commands fail fast until then, after a connection failed
+}
+
+// redisConn is one connection to the server
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// NewRedis creates a client of the server of a redis:// or rediss:// (TLS)
+// URL, e.g. redis://:password@redis:6379/0, waiting at most timeout for each
+// command. It connects on first use.
+func NewRedis(rawURL string, timeout time.Duration) (*Redis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %v", err)
+	}
+	r := &Redis{timeout: timeout, idle: make(chan *redisConn, redisPoolSize)}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		r.useTLS = true
+	default:
+		return nil, fmt.Errorf("invalid Redis URL: scheme must be redis or rediss, got %q", u.Scheme)
+	}
+	r.address = u.Host
+	if u.Port() == "" {
+		r.address = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.password, _ = u.User.Password()
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if r.database, err = strconv.Atoi(path); err != nil || r.database < 0 {
+			return nil, fmt.Errorf("invalid Redis URL: database must be a number, got %q", path)
+		}
+	}
+	return r, nil
+}
+
+// Ping checks that the server answers
+func (r *Redis) Ping() error {
+	_, err := r.Do("PING")
+	return err
+}
+
+// dial opens an authenticated connection on the configured database
+func (r *Redis) dial() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: r.timeout}
+	var conn net.Conn
+	var err error
+	if r.useTLS {
+		host, _, _ := net.SplitHostPort(r.address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", r.address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", r.address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: %v", err)
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+
+	var setup [][]string
+	if r.password != "" {
+		setup = append(setup, []string{"AUTH", r.password})
+	}
+	if r.database != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.database)})
+	}
+	if len(setup) > 0 {
+		if _, err := c.pipeline(setup, time.Now().Add(r.timeout)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// get returns an idle connection, or a new one
+func (r *Redis) get() (*redisConn, error) {
+	select {
+	case c := <-r.idle:
+		return c, nil
+	default:
+		return r.dial()
+	}
+}
+
+// put keeps a connection for reuse unless it failed; error replies leave it usable
+func (r *Redis) put(c *redisConn, err error) {
+	var replyErr RedisError
+	if err != nil && !errors.As(err, &replyErr) {
+		c.conn.Close()
+		r.failed()
+		return
+	}
+	select {
+	case r.idle <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+// Do runs a command and returns its reply: a string, an int64, nil, or a
+// []interface{} of those
+func (r *Redis) Do(args ...string) (interface{}, error) {
+	replies, err := r.Pipeline(args)
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// Pipeline sends commands in one round trip and returns their replies in
+// order. The error is that of the connection or the first error reply.
+func (r *Redis) Pipeline(commands ...[]string) ([]interface{}, error) {
+	r.mutex.Lock()
+	retryAt := r.retryAt
+	r.mutex.Unlock()
+	if time.Now().Before(retryAt) {
+		return nil, ErrRedisUnavailable
+	}
+
+	c, err := r.get()
+	if err != nil {
+		r.failed()
+		return nil, err
+	}
+	replies, err := c.pipeline(commands, time.Now().Add(r.timeout))
+	r.put(c, err)
+	return replies, err
+}
+
+// failed makes commands fail fast for a while after a connection failed
+func (r *Redis) failed() {
+	r.mutex.Lock()
+	r.retryAt = time.Now().Add(redisMinBackoff)
+	r.mutex.Unlock()
+}
+
+// Publish sends a message to the subscribers of a channel
+func (r *Redis) Publish(channel, message string) error {
+	_, err := r.Do("PUBLISH", channel, message)
+	return err
+}
+
+// Subscribe calls handle with every message published to channel until ctx is
+// done, reconnecting with backoff whenever the connection drops. connected is
+// called with nil once subscribed and with the error that ended a subscription.
+func (r *Redis) Subscribe(ctx context.Context, channel string, handle func(message string), connected func(err error)) {
+	backoff := redisMinBackoff
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := r.subscribe(ctx, channel, handle, connected)
+		if ctx.Err() != nil {
+			return
+		}
+		connected(err)
+		if time.Since(start) > redisMaxBackoff {
+			backoff = redisMinBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > redisMaxBackoff {
+			backoff = redisMaxBackoff
+		}
+	}
+}
+
+// subscribe holds one subscription until the connection fails or ctx is done
+func (r *Redis) subscribe(ctx context.Context, channel string, handle func(message string), connected func(err error)) error {
+	c, err := r.dial()
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		c.conn.Close()
+	}()
+
+	c.conn.SetDeadline(time.Now().Add(r.timeout))
+	c.write([]string{"SUBSCRIBE", channel})
+	if err := c.writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := c.read(); err != nil {
+		return err
+	}
+	c.conn.SetDeadline(time.Time{})
+	connected(nil)
+
+	for {
+		reply, err := c.read()
+		if err != nil {
+			return err
+		}
+		// ["message", channel, payload]
+		if parts, ok := reply.([]interface{}); ok && len(parts) == 3 && parts[0] == "message" {
+			if message, ok := parts[2].(string); ok {
+				handle(message)
+			}
+		}
+	}
+}
+
+// pipeline writes commands and reads their replies before deadline
+func (c *redisConn) pipeline(commands [][]string, deadline time.Time) ([]interface{}, error) {
+	c.conn.SetDeadline(deadline)
+	for _, args := range commands {
+		c.write(args)
+	}
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(commands))
+	var firstErr error
+	for i := range commands {
+		reply, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if replyErr, ok := reply.(RedisError); ok && firstErr == nil {
+			firstErr = replyErr
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+// write buffers a command, encoded as an array of bulk strings
+func (c *redisConn) write(args []string) {
+	c.writer.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		c.writer.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		c.writer.WriteString(arg)
+		c.writer.WriteString("\r\n")
+	}
+}
+
+// read decodes one reply; error replies are returned as RedisError values
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return RedisError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
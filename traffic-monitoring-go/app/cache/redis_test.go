@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		reply interface{}
+		err   string
+	}{
+		// simple strings, integers and error replies
+		{name: "simple string", raw: "+OK\r\n", reply: "OK"},
+		{name: "empty simple string", raw: "+\r\n", reply: ""},
+		{name: "integer", raw: ":42\r\n", reply: int64(42)},
+		{name: "negative integer", raw: ":-1\r\n", reply: int64(-1)},
+		{name: "error reply", raw: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+			reply: RedisError("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{name: "error reply without message", raw: "-ERR\r\n", reply: RedisError("ERR")},
+
+		// bulk strings, which may hold CRLF
+		{name: "bulk string", raw: "$5\r\nhello\r\n", reply: "hello"},
+		{name: "empty bulk string", raw: "$0\r\n\r\n", reply: ""},
+		{name: "bulk string with CRLF", raw: "$7\r\na\r\nb\r\nc\r\n", reply: "a\r\nb\r\nc"},
+		{name: "nil bulk string", raw: "$-1\r\n", reply: nil},
+
+		// arrays, which may nest and hold any reply
+		{name: "array", raw: "*2\r\n$7\r\nmessage\r\n:1\r\n", reply: []interface{}{"message", int64(1)}},
+		{name: "empty array", raw: "*0\r\n", reply: []interface{}{}},
+		{name: "nil array", raw: "*-1\r\n", reply: nil},
+		{name: "nested arrays", raw: "*3\r\n*2\r\n+a\r\n:1\r\n*0\r\n*1\r\n*1\r\n$1\r\nb\r\n",
+			reply: []interface{}{[]interface{}{"a", int64(1)}, []interface{}{}, []interface{}{[]interface{}{"b"}}}},
+		{name: "array with nil and error items", raw: "*3\r\n$-1\r\n-ERR no such key\r\n$1\r\nx\r\n",
+			reply: []interface{}{nil, RedisError("ERR no such key"), "x"}},
+		{name: "subscription message", raw: "*3\r\n$7\r\nmessage\r\n$5\r\nrules\r\n$10\r\ninvalidate\r\n",
+			reply: []interface{}{"message", "rules", "invalidate"}},
+
+		// malformed lines
+		{name: "line without CR", raw: "+OK\n", err: `redis: malformed reply "+OK\n"`},
+		{name: "line without type", raw: "\r\n", err: `redis: malformed reply "\r\n"`},
+		{name: "unknown type", raw: "%2\r\n", err: `redis: unknown reply type '%'`},
+		{name: "bulk length not a number", raw: "$abc\r\n", err: `redis: malformed reply "$abc\r\n"`},
+		{name: "array length not a number", raw: "*x\r\n", err: `redis: malformed reply "*x\r\n"`},
+		{name: "integer not a number", raw: ":1.5\r\n", err: `strconv.ParseInt: parsing "1.5": invalid syntax`},
+
+		// replies cut short
+		{name: "nothing", raw: "", err: io.EOF.Error()},
+		{name: "line without LF", raw: "+OK\r", err: io.EOF.Error()},
+		{name: "truncated bulk string", raw: "$5\r\nhel", err: io.ErrUnexpectedEOF.Error()},
+		{name: "bulk string without CRLF", raw: "$5\r\nhello", err: io.ErrUnexpectedEOF.Error()},
+		{name: "array missing items", raw: "*2\r\n:1\r\n", err: io.EOF.Error()},
+		{name: "malformed nested item", raw: "*1\r\n*1\r\n?\r\n", err: `redis: unknown reply type '?'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &redisConn{reader: bufio.NewReader(strings.NewReader(tt.raw))}
+			reply, err := c.read()
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.err, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.reply, reply)
+		})
+	}
+}
+
+func TestRedisReadConsecutiveReplies(t *testing.T) {
+	c := &redisConn{reader: bufio.NewReader(strings.NewReader("$3\r\none\r\n$-1\r\n*1\r\n:2\r\n+OK\r\n"))}
+
+	var replies []interface{}
+	for i := 0; i < 4; i++ {
+		reply, err := c.read()
+		require.NoError(t, err)
+		replies = append(replies, reply)
+	}
+	assert.Equal(t, []interface{}{"one", nil, []interface{}{int64(2)}, "OK"}, replies)
+
+	_, err := c.read()
+	assert.Equal(t, io.EOF, err)
+}
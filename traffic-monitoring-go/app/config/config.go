@@ -0,0 +1,388 @@
+// Package config is where the SIEM reads its settings from. A setting is
+// named like the environment variable it has always been read from, e.g.
+// ES_BULK_FLUSH_MS, and takes the first value found in:
+//
+//  1. a -set KEY=VALUE flag
+//  2. the environment
+//  3. the config file named by -config or CONFIG_FILE, in YAML or TOML
+//  4. the default it was registered with
+//
+// The file nests keys by the underscores of their names, so
+//
+//	es:
+//	  bulk:
+//	    flush_ms: 500
+//
+// sets ES_BULK_FLUSH_MS, as does a top-level es_bulk_flush_ms or
+// ES_BULK_FLUSH_MS. Lists are joined with commas.
+//
+// Packages register their settings with NewString, NewInt, NewFloat and
+// NewBool, usually as package variables, and Load checks every registered
+// setting against its type and bounds so a bad value stops the process at
+// startup instead of falling back silently. Reloadable settings are read when
+// used and follow changes of the file picked up by Watch or Reload; the others
+// apply on the next restart.
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Kind is the type of a setting's value
+type Kind string
+
+const (
+	String Kind = "string"
+	Int    Kind = "int"
+	Float  Kind = "float"
+	Bool   Kind = "bool" // true or false
+)
+
+// Source is where the value of a setting came from
+type Source string
+
+const (
+	SourceFlag    Source = "flag"
+	SourceEnv     Source = "env"
+	SourceFile    Source = "file"
+	SourceDefault Source = "default"
+)
+
+// Setting describes a registered setting
+type Setting struct {
+	Key         string
+	Kind        Kind
+	Default     string
+	Description string
+	Secret      bool // its value is never shown, see Entries
+	Reloadable  bool // read when used, so changes of the file apply without a restart
+
+	min, max  *float64
+	exclusive bool // min itself is not allowed
+	choices   []string
+	validate  func(string) error
+}
+
+// Option refines a setting as it is registered
+type Option func(*Setting)
+
+// Min rejects numbers below min
+func Min(min float64) Option {
+	return func(s *Setting) { s.min = &min }
+}
+
+// Max rejects numbers above max
+func Max(max float64) Option {
+	return func(s *Setting) { s.max = &max }
+}
+
+// Positive rejects numbers that are not above 0
+func Positive(s *Setting) {
+	zero := 0.0
+	s.min, s.exclusive = &zero, true
+}
+
+// OneOf rejects values other than choices; an empty value is always allowed
+func OneOf(choices ...string) Option {
+	return func(s *Setting) { s.choices = choices }
+}
+
+// Check rejects values for which validate returns an error, such as lists in a
+// format of their own; it runs after the checks of the kind
+func Check(validate func(value string) error) Option {
+	return func(s *Setting) { s.validate = validate }
+}
+
+// Secret hides the value of the setting
+func Secret(s *Setting) { s.Secret = true }
+
+// Reloadable marks a setting read when used
+func Reloadable(s *Setting) { s.Reloadable = true }
+
+// check returns why value is not valid for the setting
+func (s *Setting) check(value string) error {
+	if err := s.checkKind(value); err != nil {
+		return err
+	}
+	if s.validate != nil {
+		return s.validate(value)
+	}
+	return nil
+}
+
+// checkKind returns why value is not valid for the kind and bounds of the setting
+func (s *Setting) checkKind(value string) error {
+	var number float64
+	switch s.Kind {
+	case Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		number = float64(n)
+	case Float:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		number = n
+	case Bool:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		return nil
+	default:
+		if len(s.choices) > 0 && value != "" {
+			for _, choice := range s.choices {
+				if value == choice {
+					return nil
+				}
+			}
+			return fmt.Errorf("%q is not one of %s", value, strings.Join(s.choices, ", "))
+		}
+		return nil
+	}
+
+	if s.min != nil && (number < *s.min || s.exclusive && number == *s.min) {
+		if s.exclusive {
+			return fmt.Errorf("%s must be above %s", value, formatNumber(*s.min))
+		}
+		return fmt.Errorf("%s must be at least %s", value, formatNumber(*s.min))
+	}
+	if s.max != nil && number > *s.max {
+		return fmt.Errorf("%s must be at most %s", value, formatNumber(*s.max))
+	}
+	return nil
+}
+
+var (
+	mutex    sync.RWMutex
+	registry = make(map[string]*Setting)
+	prefixes = make(map[string]string) // of settings named at run time, with their description
+)
+
+// register adds a setting; registering a key twice with different kinds or defaults panics
+func register(key string, kind Kind, def, description string, options []Option) *Setting {
+	setting := &Setting{Key: key, Kind: kind, Default: def, Description: description}
+	for _, option := range options {
+		option(setting)
+	}
+	if err := setting.check(def); def != "" && err != nil {
+		panic("config: invalid default of " + key + ": " + err.Error())
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if existing, ok := registry[key]; ok {
+		if existing.Kind != kind || existing.Default != def {
+			panic("config: setting registered twice: " + key)
+		}
+		return existing
+	}
+	registry[key] = setting
+	return setting
+}
+
+// RegisterPrefix declares the settings starting with prefix that are named at
+// run time, such as those of each startup dependency, so they are not
+// reported as unknown
+func RegisterPrefix(prefix, description string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	prefixes[prefix] = description
+}
+
+// StringSetting is a registered setting holding text
+type StringSetting struct{ *Setting }
+
+// IntSetting is a registered setting holding a whole number
+type IntSetting struct{ *Setting }
+
+// FloatSetting is a registered setting holding a number
+type FloatSetting struct{ *Setting }
+
+// BoolSetting is a registered setting holding true or false
+type BoolSetting struct{ *Setting }
+
+// NewString registers a text setting
+func NewString(key, def, description string, options ...Option) StringSetting {
+	return StringSetting{register(key, String, def, description, options)}
+}
+
+// NewInt registers a whole-number setting
+func NewInt(key string, def int, description string, options ...Option) IntSetting {
+	return IntSetting{register(key, Int, strconv.Itoa(def), description, options)}
+}
+
+// NewFloat registers a number setting
+func NewFloat(key string, def float64, description string, options ...Option) FloatSetting {
+	return FloatSetting{register(key, Float, formatNumber(def), description, options)}
+}
+
+// NewBool registers a true or false setting
+func NewBool(key string, def bool, description string, options ...Option) BoolSetting {
+	return BoolSetting{register(key, Bool, strconv.FormatBool(def), description, options)}
+}
+
+// value returns the effective value of the setting, or its default when that
+// is not valid, as may happen before Load or when the environment changes
+func (s *Setting) value() string {
+	value, source := lookup(s.Key)
+	if source != SourceDefault && s.check(value) != nil {
+		return s.Default
+	}
+	return value
+}
+
+// Get returns the value of the setting
+func (s StringSetting) Get() string { return s.value() }
+
+// Get returns the value of the setting
+func (s IntSetting) Get() int {
+	n, _ := strconv.Atoi(s.value())
+	return n
+}
+
+// Get returns the value of the setting
+func (s FloatSetting) Get() float64 {
+	n, _ := strconv.ParseFloat(s.value(), 64)
+	return n
+}
+
+// Get returns the value of the setting
+func (s BoolSetting) Get() bool { return s.value() == "true" }
+
+// Get returns the value of any setting, registered or not, or "" when it has
+// none. Settings named at run time are read with it; registered ones are best
+// read through the value NewString and the like return, which is checked.
+func Get(key string) string {
+	value, _ := lookup(key)
+	return value
+}
+
+// lookup finds the value of key and where it came from; an empty variable in
+// the environment counts as unset, as it always has
+func lookup(key string) (string, Source) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return lookupLocked(key)
+}
+
+// lookupLocked is lookup for callers holding mutex
+func lookupLocked(key string) (string, Source) {
+	if value, ok := current.flags[key]; ok {
+		return value, SourceFlag
+	}
+	if value := os.Getenv(key); value != "" {
+		return value, SourceEnv
+	}
+	if value, ok := current.file[key]; ok {
+		return value, SourceFile
+	}
+	if setting, ok := registry[key]; ok {
+		return setting.Default, SourceDefault
+	}
+	return "", SourceDefault
+}
+
+// known reports whether key is registered or starts with a registered prefix;
+// the caller holds mutex
+func known(key string) bool {
+	if _, ok := registry[key]; ok {
+		return true
+	}
+	for prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Entry is a setting as GET /config shows it
+type Entry struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Source      Source `json:"source"`
+	Kind        Kind   `json:"kind,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+	Secret      bool   `json:"secret,omitempty"`
+	Reloadable  bool   `json:"reloadable"`
+	Unknown     bool   `json:"unknown,omitempty"` // set in the file or a flag but not registered
+}
+
+// Redacted replaces the values of secret settings
+const Redacted = "[redacted]"
+
+// Entries lists the registered settings and those set in the file or with
+// flags, by key, with secret values redacted
+func Entries() []Entry {
+	mutex.RLock()
+	keys := make(map[string]bool, len(registry))
+	for key := range registry {
+		keys[key] = true
+	}
+	for key := range current.file {
+		keys[key] = true
+	}
+	for key := range current.flags {
+		keys[key] = true
+	}
+	mutex.RUnlock()
+
+	entries := make([]Entry, 0, len(keys))
+	for key := range keys {
+		value, source := lookup(key)
+		entry := Entry{Key: key, Value: value, Source: source}
+
+		mutex.RLock()
+		if setting, ok := registry[key]; ok {
+			entry.Kind = setting.Kind
+			entry.Default = setting.Default
+			entry.Description = setting.Description
+			entry.Secret = setting.Secret
+			entry.Reloadable = setting.Reloadable
+		} else {
+			entry.Unknown = !known(key)
+			for prefix, description := range prefixes {
+				if strings.HasPrefix(key, prefix) {
+					entry.Description = description
+				}
+			}
+		}
+		mutex.RUnlock()
+
+		if entry.Secret || entry.Kind == "" && looksSecret(key) {
+			entry.Secret = true
+			if entry.Value != "" {
+				entry.Value = Redacted
+			}
+			if entry.Default != "" {
+				entry.Default = Redacted
+			}
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// looksSecret guards unregistered settings whose names suggest credentials
+func looksSecret(key string) bool {
+	for _, word := range []string{"SECRET", "PASSWORD", "TOKEN", "KEY", "DSN"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
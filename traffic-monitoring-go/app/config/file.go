@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// readFile reads a YAML or TOML config file, by its extension, into settings by key
+func readFile(path string) (map[string]string, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var document map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &document)
+	case ".toml":
+		err = toml.Unmarshal(content, &document)
+	default:
+		return nil, time.Time{}, fmt.Errorf("config file %s is neither .yaml, .yml nor .toml", path)
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("config file %s: %v", path, err)
+	}
+
+	settings := make(map[string]string)
+	if err := flatten("", document, settings); err != nil {
+		return nil, time.Time{}, fmt.Errorf("config file %s: %v", path, err)
+	}
+	return settings, info.ModTime(), nil
+}
+
+// flatten adds the values of a nested section to settings, keyed by their
+// path joined with underscores
+func flatten(prefix string, section map[string]interface{}, settings map[string]string) error {
+	for name, value := range section {
+		key := normalizeKey(name)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if err := flatten(key, value, settings); err != nil {
+				return err
+			}
+		case map[interface{}]interface{}:
+			converted := make(map[string]interface{}, len(value))
+			for name, v := range value {
+				converted[fmt.Sprint(name)] = v
+			}
+			if err := flatten(key, converted, settings); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				text, err := scalar(item)
+				if err != nil {
+					return fmt.Errorf("%s: %v", key, err)
+				}
+				items = append(items, text)
+			}
+			settings[key] = strings.Join(items, ",")
+		default:
+			text, err := scalar(value)
+			if err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+			settings[key] = text
+		}
+	}
+	return nil
+}
+
+// scalar formats a value of the file the way it would be written in the environment
+func scalar(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case uint64:
+		return strconv.FormatUint(value, 10), nil
+	case float64:
+		return formatNumber(value), nil
+	case time.Time:
+		return value.Format(time.RFC3339), nil
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return "", fmt.Errorf("lists may only hold plain values")
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// normalizeKey turns a key of the file or a flag into the name of the setting
+func normalizeKey(key string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(strings.TrimSpace(key)))
+}
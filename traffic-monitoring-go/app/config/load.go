@@ -0,0 +1,205 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// state is what Load read from the file and the flags
+type state struct {
+	path    string
+	modTime time.Time
+	file    map[string]string
+	flags   map[string]string
+}
+
+var (
+	current state
+
+	fileFlag  string
+	setFlags  = make(overrides)
+	listeners []func()
+)
+
+// overrides are the -set KEY=VALUE flags
+type overrides map[string]string
+
+func (o overrides) String() string { return "" }
+
+func (o overrides) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q is not KEY=VALUE", value)
+	}
+	o[normalizeKey(value[:i])] = value[i+1:]
+	return nil
+}
+
+// RegisterFlags adds -config and -set to flags; Load reads them once flags are parsed
+func RegisterFlags(flags *flag.FlagSet) {
+	flags.StringVar(&fileFlag, "config", os.Getenv("CONFIG_FILE"), "YAML or TOML `file` of settings (default $CONFIG_FILE)")
+	flags.Var(setFlags, "set", "set a setting, as `KEY=VALUE`, over the environment and the file; repeatable")
+}
+
+// OnLoad calls f after every successful Load and Reload, to apply settings that
+// are not read when used
+func OnLoad(f func()) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	listeners = append(listeners, f)
+}
+
+// Load reads the config file and the -set flags and checks every registered
+// setting. Settings set in the file or with flags but not registered by any
+// package are logged, as they are most likely misspelled.
+func Load() error {
+	next := state{path: fileFlag, flags: make(map[string]string, len(setFlags))}
+	if next.path == "" {
+		next.path = os.Getenv("CONFIG_FILE")
+	}
+	for key, value := range setFlags {
+		next.flags[key] = value
+	}
+	if next.path != "" {
+		var err error
+		if next.file, next.modTime, err = readFile(next.path); err != nil {
+			return err
+		}
+	}
+
+	if _, err := apply(next); err != nil {
+		return err
+	}
+
+	mutex.RLock()
+	var unknown []string
+	for _, keys := range []map[string]string{next.file, next.flags} {
+		for key := range keys {
+			if !known(key) {
+				unknown = append(unknown, key)
+			}
+		}
+	}
+	mutex.RUnlock()
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		log.Printf("Warning: unknown setting %s in the configuration", key)
+	}
+	return nil
+}
+
+// Reload reads the config file again and returns the keys whose values
+// changed. A file that does not parse or holds an invalid value is rejected as
+// a whole and the settings stay as they were.
+func Reload() ([]string, error) {
+	mutex.RLock()
+	next := current
+	mutex.RUnlock()
+	if next.path == "" {
+		return nil, nil
+	}
+
+	var err error
+	if next.file, next.modTime, err = readFile(next.path); err != nil {
+		return nil, err
+	}
+	changed, err := apply(next)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex.RLock()
+	for _, key := range changed {
+		if setting, ok := registry[key]; ok && setting.Reloadable {
+			log.Printf("Setting %s changed", key)
+		} else {
+			log.Printf("Setting %s changed in %s; it applies on the next restart", key, next.path)
+		}
+	}
+	mutex.RUnlock()
+	return changed, nil
+}
+
+// apply checks the registered settings as next would set them, then makes it
+// current and returns the keys of the file whose values changed
+func apply(next state) ([]string, error) {
+	mutex.Lock()
+	previous := current
+	current = next
+	var problems []string
+	for key, setting := range registry {
+		value, source := lookupLocked(key)
+		if source == SourceDefault {
+			continue
+		}
+		if err := setting.check(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (from %s): %v", key, source, err))
+		}
+	}
+	if len(problems) > 0 {
+		current = previous
+		mutex.Unlock()
+		sort.Strings(problems)
+		return nil, fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+
+	var changed []string
+	for key, value := range next.file {
+		if old, ok := previous.file[key]; !ok || old != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range previous.file {
+		if _, ok := next.file[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	callbacks := append([]func(){}, listeners...)
+	mutex.Unlock()
+
+	for _, callback := range callbacks {
+		callback()
+	}
+	return changed, nil
+}
+
+// Watch reloads the config file when it changes on disk, checked every
+// interval, and on SIGHUP. Reloads that fail are logged and change nothing.
+func Watch(interval time.Duration) {
+	mutex.RLock()
+	path, seen := current.path, current.modTime
+	mutex.RUnlock()
+	if path == "" {
+		return
+	}
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	ticker := time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				// a rejected file is not retried until it changes again
+				info, err := os.Stat(path)
+				if err != nil || info.ModTime().Equal(seen) {
+					continue
+				}
+				seen = info.ModTime()
+			case <-hangups:
+			}
+			if _, err := Reload(); err != nil {
+				log.Printf("Error reloading %s, keeping the current settings: %v", path, err)
+			}
+		}
+	}()
+	log.Printf("Watching %s for setting changes", path)
+}
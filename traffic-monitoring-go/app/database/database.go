@@ -1,55 +1,72 @@
 package database
 
 import (
+	"context"
 	"log"
 	"time"
-	"os"
 
-	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/startup"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-func SetupDatabase() *gorm.DB {
-	dsn := os.Getenv("DSN")
+var (
+	databaseDSN = config.NewString("DSN", "host=db-go user=go_user password=go_pass dbname=go_db port=5432 sslmode=disable TimeZone=UTC",
+		"Postgres connection string", config.Secret)
+	autoMigrate = config.NewBool("DB_AUTO_MIGRATE", false, "Apply pending schema migrations at startup instead of refusing to start")
+)
 
-	if dsn == "" {
-		dsn = "host=db-go user=go_user password=go_pass dbname=go_db port=5432 sslmode=disable TimeZone=UTC"
-	}
-	
+// Connect opens the database named by DSN, waiting for it to come up
+func Connect() *gorm.DB {
+	dsn := databaseDSN.Get()
 	var db *gorm.DB
-	var err error
 
-	for i := 0; i < 10; i++ {
-		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-			Logger: logger.Default.LogMode(logger.Info),
-			DisableForeignKeyConstraintWhenMigrating: true,
-		})
-		if err == nil {
-			break
-		}
-		log.Printf("Database connection failed on attempt %d: %v. Retrying in 2 seconds...", i+1, err)
-		time.Sleep(2 * time.Second)
-	}
-	if err != nil {
+	// wait for Postgres (STARTUP_DATABASE_MAX_WAIT_SECONDS, default 60); the SIEM cannot run without it
+	dependency := startup.Dependency{
+		Name:           "database",
+		MaxWait:        60 * time.Second,
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+		Check: func(ctx context.Context) error {
+			var err error
+			db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+				Logger: logger.Default.LogMode(logger.Info),
+				DisableForeignKeyConstraintWhenMigrating: true,
+			})
+			return err
+		},
+	}.FromEnv()
+	dependency.Policy = startup.Required
+	if err := startup.Await(context.Background(), dependency); err != nil {
 		log.Fatalf("failed to connect database: %v", err)
 	}
+	return db
+}
 
-	err = db.AutoMigrate(
-        &models.User{},
-        &models.Station{},
-        &models.Sensor{},
-        &models.TrafficMeasurement{},
-        &models.UserEvent{},
-		&models.LogSource{},
-		&models.SecurityEvent{},
-		&models.Rule{},
-		&models.Alert{},
-    )
-    if err != nil {
-        log.Fatalf("failed to migrate models: %v", err)
-    }
+// SetupDatabase connects to the database and makes sure its schema is up to
+// date: with DB_AUTO_MIGRATE=true the pending migrations are applied,
+// otherwise the SIEM refuses to start until the migrate command applies them.
+func SetupDatabase() *gorm.DB {
+	db := Connect()
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		log.Fatalf("failed to load migrations: %v", err)
+	}
+	if autoMigrate.Get() {
+		applied, err := migrator.Up(0)
+		for _, migration := range applied {
+			log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("failed to migrate the database: %v", err)
+		}
+	}
+	if err := migrator.Check(); err != nil {
+		log.Fatalf("refusing to start: %v", err)
+	}
 
 	// Verify database connection by executing simple query
 	sqlDB, err := db.DB()
@@ -63,6 +80,6 @@ func SetupDatabase() *gorm.DB {
 	}
 	
 
-	log.Println("Database connection successful and migrations complete")
+	log.Println("Database connection successful and schema up to date")
 	return db
 }
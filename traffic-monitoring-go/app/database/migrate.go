@@ -0,0 +1,350 @@
+package database
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/migrations"
+)
+
+// migrationTable records the version of every migration applied to the database
+const migrationTable = "schema_migrations"
+
+// migrationFilePattern matches <version>_<name>.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d{14})_([a-z0-9_]+)\.sql$`)
+
+// Migration is one versioned schema change, see package migrations
+type Migration struct {
+	Version       int64
+	Name          string
+	Up            []string // statements applying it
+	Down          []string // statements rolling it back
+	Reversible    bool     // whether it has a Down section
+	NoTransaction bool
+}
+
+// MigrationStatus is a migration and when it was applied, if it was
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// SchemaOutOfDateError is returned by Migrator.Check while migrations are pending
+type SchemaOutOfDateError struct {
+	Pending []Migration
+}
+
+func (e *SchemaOutOfDateError) Error() string {
+	first := e.Pending[0]
+	return fmt.Sprintf("database schema is out of date: %d pending migrations, starting with %d_%s; run `migrate up` or set DB_AUTO_MIGRATE=true",
+		len(e.Pending), first.Version, first.Name)
+}
+
+// LoadMigrations parses the migrations in fsys, in version order
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var loaded []Migration
+	seen := make(map[int64]string)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s is not named <YYYYMMDDHHMMSS>_<name>.sql", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration := Migration{Version: version, Name: match[2]}
+		if err := parseMigration(string(content), &migration); err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		loaded = append(loaded, migration)
+	}
+
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Version < loaded[j].Version })
+	return loaded, nil
+}
+
+// parseMigration splits the goose-annotated content of a migration into its statements
+func parseMigration(content string, migration *Migration) error {
+	var section *[]string
+	var statement strings.Builder
+	inBlock, hasUp := false, false
+
+	for number, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "-- +goose ") {
+			if statement.Len() > 0 && !inBlock {
+				return fmt.Errorf("line %d: statement before it does not end with a semicolon", number+1)
+			}
+			switch directive := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(trimmed, "-- +goose "))); directive {
+			case "UP":
+				section, hasUp = &migration.Up, true
+			case "DOWN":
+				section, migration.Reversible = &migration.Down, true
+			case "STATEMENTBEGIN":
+				inBlock = true
+			case "STATEMENTEND":
+				if !inBlock {
+					return fmt.Errorf("line %d: StatementEnd without StatementBegin", number+1)
+				}
+				inBlock = false
+				*section = append(*section, strings.TrimSpace(statement.String()))
+				statement.Reset()
+			case "NO TRANSACTION":
+				migration.NoTransaction = true
+			default:
+				return fmt.Errorf("line %d: unknown directive %q", number+1, directive)
+			}
+			continue
+		}
+
+		// comments and blank lines between statements are skipped
+		if statement.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			continue
+		}
+		if section == nil {
+			return fmt.Errorf("line %d: statement before -- +goose Up", number+1)
+		}
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			*section = append(*section, strings.TrimSpace(statement.String()))
+			statement.Reset()
+		}
+	}
+
+	switch {
+	case inBlock:
+		return fmt.Errorf("StatementBegin without StatementEnd")
+	case statement.Len() > 0:
+		return fmt.Errorf("last statement does not end with a semicolon")
+	case !hasUp:
+		return fmt.Errorf("no -- +goose Up section")
+	}
+	return nil
+}
+
+// Migrator applies the migrations to a database. Instances migrating at once
+// take turns on an advisory lock, so each migration runs once.
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration
+}
+
+// NewMigrator creates a Migrator for the migrations embedded in the binary
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	loaded, err := LoadMigrations(migrations.Files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: loaded}, nil
+}
+
+// ensureTable creates the table recording the applied migrations
+func (m *Migrator) ensureTable(db *gorm.DB) error {
+	return db.Exec(`CREATE TABLE IF NOT EXISTS ` + migrationTable + ` (
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`).Error
+}
+
+// applied returns when each applied migration was applied, by version
+func (m *Migrator) applied(db *gorm.DB) (map[int64]time.Time, error) {
+	if err := m.ensureTable(db); err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Version   int64
+		AppliedAt time.Time
+	}
+	if err := db.Table(migrationTable).Select("version, applied_at").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]time.Time, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+	return applied, nil
+}
+
+// Status lists the migrations of the binary and when they were applied,
+// followed by those applied by newer binaries, named "unknown"
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied(m.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if at, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &at
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, version := range sortedVersions(applied) {
+		at := applied[version]
+		statuses = append(statuses, MigrationStatus{Version: version, Name: "unknown", AppliedAt: &at})
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations not applied yet, in version order
+func (m *Migrator) Pending() ([]Migration, error) {
+	applied, err := m.applied(m.DB)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, migration := range m.Migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Check returns a *SchemaOutOfDateError while migrations are pending
+func (m *Migrator) Check() error {
+	pending, err := m.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return &SchemaOutOfDateError{Pending: pending}
+	}
+	return nil
+}
+
+// Up applies the pending migrations up to and including target, or all of
+// them when target is 0, and returns those it applied. It stops at the first
+// that fails, which is rolled back unless it runs outside a transaction.
+func (m *Migrator) Up(target int64) ([]Migration, error) {
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range pending {
+		if target != 0 && migration.Version > target {
+			break
+		}
+		ran, err := m.run(migration, true)
+		if err != nil {
+			return done, fmt.Errorf("applying %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if ran {
+			done = append(done, migration)
+		}
+	}
+	return done, nil
+}
+
+// Down rolls back the latest applied migration and returns it, or nil when none is applied
+func (m *Migrator) Down() (*Migration, error) {
+	applied, err := m.applied(m.DB)
+	if err != nil {
+		return nil, err
+	}
+	versions := sortedVersions(applied)
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	latest := versions[len(versions)-1]
+
+	for i := range m.Migrations {
+		migration := m.Migrations[i]
+		if migration.Version != latest {
+			continue
+		}
+		if !migration.Reversible {
+			return nil, fmt.Errorf("migration %d_%s has no Down section and cannot be rolled back", migration.Version, migration.Name)
+		}
+		if _, err := m.run(migration, false); err != nil {
+			return nil, fmt.Errorf("rolling back %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return &migration, nil
+	}
+	return nil, fmt.Errorf("the latest applied migration %d is unknown to this build", latest)
+}
+
+// run applies (up) or rolls back a migration and records it, holding the
+// migration lock on one connection. It reports false when another instance
+// got there first.
+func (m *Migrator) run(migration Migration, up bool) (bool, error) {
+	statements := migration.Up
+	if !up {
+		statements = migration.Down
+	}
+
+	ran := false
+	err := m.DB.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(hashtext(?))", migrationTable).Error; err != nil {
+			return err
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(hashtext(?))", migrationTable)
+
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if _, ok := applied[migration.Version]; ok == up {
+			return nil
+		}
+
+		apply := func(tx *gorm.DB) error {
+			for _, statement := range statements {
+				if err := tx.Exec(statement).Error; err != nil {
+					return fmt.Errorf("%w\n%s", err, statement)
+				}
+			}
+			if up {
+				return tx.Exec("INSERT INTO "+migrationTable+" (version, name) VALUES (?, ?)", migration.Version, migration.Name).Error
+			}
+			return tx.Exec("DELETE FROM "+migrationTable+" WHERE version = ?", migration.Version).Error
+		}
+		if migration.NoTransaction {
+			err = apply(conn)
+		} else {
+			err = conn.Transaction(apply)
+		}
+		ran = err == nil
+		return err
+	})
+	return ran, err
+}
+
+// sortedVersions returns the versions of applied in ascending order
+func sortedVersions(applied map[int64]time.Time) []int64 {
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
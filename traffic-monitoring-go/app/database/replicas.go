@@ -0,0 +1,208 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"traffic-monitoring-go/app/config"
+)
+
+// replicaHealthInterval is how often replicas are pinged
+const replicaHealthInterval = 15 * time.Second
+
+// Replica is a read-only connection with its last known health
+type Replica struct {
+	Name      string
+	DB        *gorm.DB
+	healthy   int32
+	LastError string
+	CheckedAt time.Time
+}
+
+// ReplicaStatus is the health of a single replica as reported by the API
+type ReplicaStatus struct {
+	Name      string    `json:"name"`
+	Healthy   bool      `json:"healthy"`
+	LastError string    `json:"last_error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ReplicaRouter spreads read queries over healthy replicas and falls back to the primary
+type ReplicaRouter struct {
+	mutex    sync.RWMutex
+	replicas []*Replica
+	next     uint64
+}
+
+var replicaRouter = &ReplicaRouter{}
+
+var replicaDSNs = config.NewString("DB_REPLICA_DSNS", "", "Connection strings of the read replicas, separated by semicolons", config.Secret)
+
+// SetupReplicas connects the read replicas listed in DB_REPLICA_DSNS (separated by ";")
+// and starts their health checks. Without replicas every read goes to the primary.
+func SetupReplicas() {
+	value := replicaDSNs.Get()
+	if value == "" {
+		return
+	}
+
+	var replicas []*Replica
+	for i, dsn := range strings.Split(value, ";") {
+		dsn = strings.TrimSpace(dsn)
+		if dsn == "" {
+			continue
+		}
+
+		name := replicaName(dsn, i)
+		db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+			Logger: logger.Default.LogMode(logger.Warn),
+		})
+		if err != nil {
+			// gorm still returns the pool when the initial ping fails, so keep the
+			// replica and let the health check bring it in once it is reachable
+			log.Printf("Warning: failed to connect read replica %s: %v", name, err)
+		}
+		replicas = append(replicas, &Replica{Name: name, DB: db})
+	}
+
+	replicaRouter.mutex.Lock()
+	replicaRouter.replicas = replicas
+	replicaRouter.mutex.Unlock()
+
+	replicaRouter.checkAll()
+	go replicaRouter.run()
+
+	log.Printf("Configured %d read replica(s)", len(replicas))
+}
+
+// ReadDB returns a healthy read replica, or primary when none is available.
+// Use it for dashboard and list queries; writes and rule evaluation stay on the primary.
+func ReadDB(primary *gorm.DB) *gorm.DB {
+	if replica := replicaRouter.pick(); replica != nil {
+		return replica
+	}
+	return primary
+}
+
+// GetReplicaStatus reports the health of every configured replica
+func GetReplicaStatus() []ReplicaStatus {
+	replicaRouter.mutex.RLock()
+	defer replicaRouter.mutex.RUnlock()
+
+	status := make([]ReplicaStatus, 0, len(replicaRouter.replicas))
+	for _, replica := range replicaRouter.replicas {
+		status = append(status, ReplicaStatus{
+			Name:      replica.Name,
+			Healthy:   atomic.LoadInt32(&replica.healthy) == 1,
+			LastError: replica.LastError,
+			CheckedAt: replica.CheckedAt,
+		})
+	}
+	return status
+}
+
+// pick returns the next healthy replica in round-robin order
+func (r *ReplicaRouter) pick() *gorm.DB {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	count := len(r.replicas)
+	if count == 0 {
+		return nil
+	}
+
+	start := atomic.AddUint64(&r.next, 1)
+	for i := 0; i < count; i++ {
+		replica := r.replicas[(start+uint64(i))%uint64(count)]
+		if atomic.LoadInt32(&replica.healthy) == 1 {
+			return replica.DB
+		}
+	}
+	return nil
+}
+
+// run pings the replicas for the lifetime of the process
+func (r *ReplicaRouter) run() {
+	ticker := time.NewTicker(replicaHealthInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.checkAll()
+	}
+}
+
+// checkAll pings each replica and updates its health.
+// Pings run without the lock so a hanging replica never blocks reads.
+func (r *ReplicaRouter) checkAll() {
+	r.mutex.RLock()
+	replicas := make([]*Replica, len(r.replicas))
+	copy(replicas, r.replicas)
+	r.mutex.RUnlock()
+
+	for _, replica := range replicas {
+		err := pingReplica(replica)
+
+		r.mutex.Lock()
+		replica.CheckedAt = time.Now()
+		if err != nil {
+			replica.LastError = err.Error()
+		} else {
+			replica.LastError = ""
+		}
+		r.mutex.Unlock()
+
+		wasHealthy := atomic.LoadInt32(&replica.healthy) == 1
+		if err != nil {
+			atomic.StoreInt32(&replica.healthy, 0)
+			if wasHealthy {
+				log.Printf("Read replica %s is unhealthy, falling back: %v", replica.Name, err)
+			}
+			continue
+		}
+
+		atomic.StoreInt32(&replica.healthy, 1)
+		if !wasHealthy {
+			log.Printf("Read replica %s is healthy", replica.Name)
+		}
+	}
+}
+
+// pingReplica checks that a replica answers queries
+func pingReplica(replica *Replica) error {
+	if replica.DB == nil {
+		return errors.New("replica not connected")
+	}
+	sqlDB, err := replica.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Ping()
+}
+
+// replicaName derives a log-safe name (host:port) from a DSN
+func replicaName(dsn string, index int) string {
+	var host, port string
+	for _, field := range strings.Fields(dsn) {
+		if strings.HasPrefix(field, "host=") {
+			host = strings.TrimPrefix(field, "host=")
+		}
+		if strings.HasPrefix(field, "port=") {
+			port = strings.TrimPrefix(field, "port=")
+		}
+	}
+	if host == "" {
+		return fmt.Sprintf("replica-%d", index+1)
+	}
+	if port != "" {
+		return host + ":" + port
+	}
+	return host
+}
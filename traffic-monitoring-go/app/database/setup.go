@@ -4,6 +4,8 @@ import (
 	"log"
 
 	"gorm.io/gorm"
+	"traffic-monitoring-go/app/auth"
+	"traffic-monitoring-go/app/config"
 	"traffic-monitoring-go/app/models"
 )
 
@@ -58,6 +60,7 @@ func CreateDefaultRules(db *gorm.DB) error {
 				Severity:    models.SeverityMedium,
 				Category:    models.CategoryAuthentication,
 				Status:      models.RuleStatusEnabled,
+				Techniques:  []string{"T1110"},
 				CreatedBy:   defaultUser.ID,
 			},
 			{
@@ -78,6 +81,45 @@ func CreateDefaultRules(db *gorm.DB) error {
 				Status:      models.RuleStatusEnabled,
 				CreatedBy:   defaultUser.ID,
 			},
+			{
+				Name:        "Revoked Certificate Use",
+				Description: "Alert on V2X messages signed by a certificate on a CRL",
+				Condition:   "category = v2x AND raw_data.details.anomaly_type = revoked_certificate",
+				Severity:    models.SeverityHigh,
+				Category:    models.CategoryV2X,
+				Status:      models.RuleStatusEnabled,
+				V2XThreats:  []string{"V2X-SPOOF"},
+				CreatedBy:   defaultUser.ID,
+			},
+			{
+				Name:        "Sybil Attack Suspected",
+				Description: "Alert when several V2X source IDs appear to come from one transmitter",
+				Condition:   "category = v2x AND raw_data.details.anomaly_type = sybil_suspected",
+				Severity:    models.SeverityHigh,
+				Category:    models.CategoryV2X,
+				Status:      models.RuleStatusEnabled,
+				V2XThreats:  []string{"V2X-SYBIL"},
+				CreatedBy:   defaultUser.ID,
+			},
+			{
+				Name:        "Fake Signal Preemption Suspected",
+				Description: "Alert when a V2X source requests signal priority without broadcasting the BSMs of a vehicle on its way",
+				Condition:   "category = v2x AND raw_data.details.anomaly_type = ghost_priority_request",
+				Severity:    models.SeverityHigh,
+				Category:    models.CategoryV2X,
+				Status:      models.RuleStatusEnabled,
+				V2XThreats:  []string{"V2X-SPOOF"},
+				CreatedBy:   defaultUser.ID,
+			},
+			{
+				Name:        "Parser Failure Surge",
+				Description: "Alert when most messages from a source fail to parse, possibly malformed attack traffic",
+				Condition:   "category = system AND raw_data.details.anomaly_type = parse_failure_surge",
+				Severity:    models.SeverityHigh,
+				Category:    models.CategorySystem,
+				Status:      models.RuleStatusEnabled,
+				CreatedBy:   defaultUser.ID,
+			},
 			{
 				Name:        "Suspicious Network Activity",
 				Description: "Alert on blocked network connections",
@@ -85,6 +127,7 @@ func CreateDefaultRules(db *gorm.DB) error {
 				Severity:    models.SeverityMedium,
 				Category:    models.CategoryNetwork,
 				Status:      models.RuleStatusEnabled, 
+				Techniques:  []string{"T1046"},
 				CreatedBy:   defaultUser.ID,
 			},
 		}
@@ -101,3 +144,87 @@ func CreateDefaultRules(db *gorm.DB) error {
 
 	return nil
 }
+
+// CreateDefaultV2XThreats creates the default V2X threat taxonomy if it is empty
+func CreateDefaultV2XThreats(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&models.V2XThreat{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	threats := []models.V2XThreat{
+		{
+			Code:         "V2X-SPOOF",
+			Name:         "Spoofing",
+			Description:  "Forged identity, position or kinematics in V2X messages, including messages signed with revoked credentials",
+			AnomalyTypes: []string{"cross_radio_inconsistency", "ghost_priority_request", "kinematic_implausible", "position_jump", "revoked_certificate", "speed_jump"},
+		},
+		{
+			Code:         "V2X-JAM",
+			Name:         "Jamming indication",
+			Description:  "Radio interference suggested by sudden message loss or channel busy ratio spikes at RSUs",
+			AnomalyTypes: []string{"channel_busy", "message_loss"},
+		},
+		{
+			Code:         "V2X-REPLAY",
+			Name:         "Replay",
+			Description:  "Previously valid messages re-sent outside their validity time or area",
+			AnomalyTypes: []string{"replay", "stale_message"},
+		},
+		{
+			Code:         "V2X-SYBIL",
+			Name:         "Sybil",
+			Description:  "One transmitter posing as several vehicles with concurrent pseudonyms",
+			AnomalyTypes: []string{"frequency", "sybil", "sybil_suspected"},
+		},
+		{
+			Code:         "V2X-PRIVACY",
+			Name:         "Privacy attack",
+			Description:  "Tracking vehicles by linking their pseudonyms or eavesdropping on their beacons",
+			AnomalyTypes: []string{"pseudonym_linking"},
+		},
+	}
+	if err := db.Create(&threats).Error; err != nil {
+		return err
+	}
+
+	log.Printf("Created %d default V2X threats", len(threats))
+	return nil
+}
+
+var (
+	adminEmail    = config.NewString("ADMIN_EMAIL", "", "Email of the admin user created or reset at startup")
+	adminPassword = config.NewString("ADMIN_PASSWORD", "", "Password of the ADMIN_EMAIL user", config.Secret)
+)
+
+// EnsureAdminUser creates the admin named by ADMIN_EMAIL with ADMIN_PASSWORD,
+// or resets that user's password and role, so a fresh installation can log in
+func EnsureAdminUser(db *gorm.DB) error {
+	email, password := adminEmail.Get(), adminPassword.Get()
+	if email == "" || password == "" {
+		return nil
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	var user models.User
+	err = db.Where("email = ?", email).First(&user).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	user.Email = email
+	user.HashedPassword = hash
+	user.Role = models.AdminRole
+	if err := db.Save(&user).Error; err != nil {
+		return err
+	}
+
+	log.Printf("Admin user %s is ready to log in", email)
+	return nil
+}
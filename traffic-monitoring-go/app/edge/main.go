@@ -0,0 +1,120 @@
+// Command edge runs SIEM collectors on edge hardware (e.g. at intersections) in
+// store-and-forward mode: events are parsed locally, buffered on disk and synced
+// to the central SIEM's /ingest/batch endpoint, surviving long WAN outages.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/siem/collectors"
+	"traffic-monitoring-go/app/siem/forwarder"
+)
+
+var (
+	edgeListeners  = config.NewString("EDGE_LISTENERS", "syslog:udp:514:syslog;snmp:udp:162:snmp", "Listeners of the edge collector, as name:protocol:port:parser separated by semicolons")
+	edgeStatusPort = config.NewString("EDGE_STATUS_PORT", "8081", "Port of the edge status endpoint")
+)
+
+// parseListeners reads EDGE_LISTENERS, a ";"-separated list of name:protocol:port:parser
+func parseListeners(value string) ([]collectors.ListenerConfig, error) {
+	var configs []collectors.ListenerConfig
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid listener %q, expected name:protocol:port:parser", entry)
+		}
+		port, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in listener %q", entry)
+		}
+		listener := collectors.ListenerConfig{Name: parts[0], Protocol: parts[1], Port: port, Parser: parts[3]}
+		if err := listener.Validate(); err != nil {
+			return nil, err
+		}
+		configs = append(configs, listener)
+	}
+	return configs, nil
+}
+
+func main() {
+	logging.RedirectStdLog()
+	config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := config.Load(); err != nil {
+		log.Fatalf("Failed to load the configuration: %v", err)
+	}
+
+	fwd, err := forwarder.NewForwarderFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to start forwarder: %v", err)
+	}
+
+	configs, err := parseListeners(edgeListeners.Get())
+	if err != nil {
+		log.Fatalf("Invalid EDGE_LISTENERS: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var listeners []*collectors.ListenerCollector
+	for _, listenerConfig := range configs {
+		// no database on the edge: parsed events go to the forward queue
+		listener, err := collectors.NewListenerCollector(nil, listenerConfig)
+		if err != nil {
+			log.Fatalf("Failed to create listener %s: %v", listenerConfig.Name, err)
+		}
+		listener.Forward = fwd.Enqueue
+		if err := listener.Start(ctx); err != nil {
+			log.Fatalf("Failed to start listener %s: %v", listenerConfig.Name, err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	go fwd.Run(ctx)
+
+	// local status endpoint for field diagnostics
+	statusPort := edgeStatusPort.Get()
+	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fwd.Status())
+	})
+	go func() {
+		if err := http.ListenAndServe(":"+statusPort, nil); err != nil {
+			log.Printf("Edge status endpoint stopped: %v", err)
+		}
+	}()
+
+	log.Printf("Edge collector %s forwarding %d listeners to %s", fwd.NodeID, len(listeners), fwd.URL)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	log.Println("Shutting down edge collector")
+	for _, listener := range listeners {
+		if err := listener.Drain(collectors.DefaultDrainTimeout); err != nil {
+			log.Printf("Error draining listener %s: %v", listener.Name(), err)
+		}
+	}
+	cancel()
+	if err := fwd.Queue.Close(); err != nil {
+		log.Printf("Error closing forward queue: %v", err)
+	}
+}
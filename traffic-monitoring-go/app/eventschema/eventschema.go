@@ -0,0 +1,244 @@
+// Package eventschema holds the typed body of POST /ingest and the detail
+// structures the SIEM reads from it. It only depends on the standard library
+// so clients such as the data generator can import it and build events that
+// cannot drift from what the ingester parses.
+package eventschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severities accepted by the ingester (see models.EventSeverity)
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+	SeverityInfo     = "info"
+)
+
+// Categories accepted by the ingester (see models.EventCategory)
+const (
+	CategoryAuthentication = "authentication"
+	CategoryAuthorization  = "authorization"
+	CategoryNetwork        = "network"
+	CategoryMalware        = "malware"
+	CategorySystem         = "system"
+	CategoryVehicle        = "vehicle"
+	CategoryV2X            = "v2x"
+)
+
+// V2X radios, as normalized by siem.NormalizeRadio
+const (
+	RadioDSRC = "dsrc"
+	RadioCV2X = "cv2x"
+)
+
+// V2X message types
+const (
+	MessageBasicSafety      = "basic_safety"
+	MessageTrafficSignal    = "traffic_signal"
+	MessageResponse         = "response"
+	MessageDENM             = "denm"
+	MessageHazard           = "hazard"
+	MessageHazardWarning    = "hazard_warning"
+	MessageRoadworkWarning  = "roadwork_warning"
+	MessageEmergencyVehicle = "emergency_vehicle"
+	MessageSPaT             = "spat" // signal phase and timing of an intersection
+	MessageMAP              = "map"  // geometry of an intersection
+	MessageSRM              = "srm"  // signal request: a vehicle asking an intersection for priority
+	MessageSSM              = "ssm"  // signal status: an intersection's answers to the requests it received
+)
+
+// Roles of the vehicles sending signal requests, the J2735 BasicVehicleRole
+// values entitled to priority
+const (
+	RoleEmergency = "emergency"
+	RoleTransit   = "transit"
+)
+
+// Types of signal requests (J2735 PriorityRequestType)
+const (
+	RequestNew    = "request"
+	RequestUpdate = "update"
+	RequestCancel = "cancellation"
+)
+
+// Statuses of signal requests in SSMs (J2735 PrioritizationResponseStatus)
+const (
+	PriorityRequested  = "requested"
+	PriorityProcessing = "processing"
+	PriorityGranted    = "granted"
+	PriorityRejected   = "rejected"
+)
+
+// denmMessageTypes are the message types carrying decentralized environmental
+// notifications, which receivers are expected to react to
+var denmMessageTypes = map[string]bool{
+	MessageDENM:             true,
+	MessageHazard:           true,
+	MessageHazardWarning:    true,
+	MessageRoadworkWarning:  true,
+	MessageEmergencyVehicle: true,
+}
+
+// IsDENM reports whether a V2X message type is a DENM
+func IsDENM(messageType string) bool {
+	return denmMessageTypes[strings.ToLower(messageType)]
+}
+
+// Event is the body of POST /ingest. Details is one of the *Details structs
+// below, or a map for sources without a typed schema.
+type Event struct {
+	SourceName string      `json:"source_name"`
+	SourceType string      `json:"source_type"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Severity   string      `json:"severity"`
+	Category   string      `json:"category"`
+	Message    string      `json:"message"`
+	Details    interface{} `json:"details"`
+}
+
+// NetworkDetails are the connection fields the ingester copies onto the event
+type NetworkDetails struct {
+	SourceIP        string `json:"source_ip,omitempty"`
+	SourcePort      int    `json:"source_port,omitempty"`
+	DestinationIP   string `json:"destination_ip,omitempty"`
+	DestinationPort int    `json:"destination_port,omitempty"`
+	Protocol        string `json:"protocol,omitempty"`
+	Action          string `json:"action,omitempty"`
+	Status          string `json:"status,omitempty"`
+}
+
+// AttackDetails mark events that belong to a simulated or detected attack
+type AttackDetails struct {
+	Attack string `json:"attack,omitempty"`
+	Stage  string `json:"stage,omitempty"`
+}
+
+// FirewallDetails are the details of firewall and IDS events
+type FirewallDetails struct {
+	NetworkDetails
+	AttackDetails
+}
+
+// AuthenticationDetails are the details of authentication events
+type AuthenticationDetails struct {
+	NetworkDetails
+	AttackDetails
+	Username       string `json:"username"`
+	AttemptNumber  int    `json:"attempt_number,omitempty"`
+	PreviousFailed int    `json:"previous_failed,omitempty"`
+}
+
+// MalwareDetails are the details of malware events
+type MalwareDetails struct {
+	NetworkDetails
+	AttackDetails
+	MalwareType     string `json:"malware_type"`
+	MalwareName     string `json:"malware_name,omitempty"`
+	Host            string `json:"host,omitempty"`
+	Filename        string `json:"filename,omitempty"`
+	PropagationPath int    `json:"propagation_path,omitempty"`
+}
+
+// SystemDetails are the details of host and service events
+type SystemDetails struct {
+	NetworkDetails
+	EventType string `json:"event_type"`
+	Service   string `json:"service,omitempty"`
+}
+
+// VehicleDetails are the details of on-board vehicle events
+type VehicleDetails struct {
+	NetworkDetails
+	VehicleID string    `json:"vehicle_id"`
+	Component string    `json:"component,omitempty"`
+	Location  *Location `json:"location,omitempty"`
+}
+
+// V2XDetails are the details of V2X messages, read by siem.ParseV2XObservation,
+// the anomaly detectors, the DENM verifier and the CRL check
+type V2XDetails struct {
+	NetworkDetails
+	AttackDetails
+	VehicleID   string    `json:"vehicle_id"`
+	MessageType string    `json:"message_type"`
+	Radio       string    `json:"radio,omitempty"`
+	RSUID       string    `json:"rsu_id,omitempty"` // receiving RSU, when not the log source
+	Location    *Location `json:"location,omitempty"`
+	Speed       *float64  `json:"speed,omitempty"`   // km/h
+	Heading     *float64  `json:"heading,omitempty"` // degrees clockwise from north
+	RSSI        *float64  `json:"rssi,omitempty"`    // dBm at the receiver
+
+	RelevanceRadiusM int    `json:"relevance_radius_m,omitempty"` // DENMs only
+	CertificateID    string `json:"certificate_id,omitempty"`     // signer's HashedId8, HashedId10 or SHA-256
+
+	IntersectionID int           `json:"intersection_id,omitempty"` // SPaT, MAP, SRM and SSM only
+	SignalStates   []SignalState `json:"signal_states,omitempty"`   // SPaT only
+	Approaches     []Approach    `json:"approaches,omitempty"`      // MAP only
+
+	RequestID        int              `json:"request_id,omitempty"`        // SRM only, with the requester's ID naming a request
+	RequestType      string           `json:"request_type,omitempty"`      // SRM only
+	RequesterRole    string           `json:"requester_role,omitempty"`    // SRM only
+	InboundApproach  int              `json:"inbound_approach,omitempty"`  // SRM only, the approach ID of the MAP
+	ETASeconds       *float64         `json:"eta_seconds,omitempty"`       // SRM only, until the requester reaches the stop line
+	PriorityStatuses []PriorityStatus `json:"priority_statuses,omitempty"` // SSM only
+
+	MaliciousSource  string `json:"malicious_source,omitempty"`
+	SpeedChange      int    `json:"speed_change,omitempty"`
+	ResponseSequence int    `json:"response_sequence,omitempty"`
+}
+
+// Float returns a pointer to v, for the optional V2X measurements
+func Float(v float64) *float64 {
+	return &v
+}
+
+// Location is a coordinate, sent as a "lat,lon" string
+type Location struct {
+	Lat float64
+	Lon float64
+}
+
+// String formats the location as the ingester expects it
+func (l Location) String() string {
+	return fmt.Sprintf("%f,%f", l.Lat, l.Lon)
+}
+
+// MarshalJSON encodes the location as a "lat,lon" string
+func (l Location) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+// UnmarshalJSON decodes a "lat,lon" string
+func (l *Location) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	lat, lon, ok := ParseLocation(s)
+	if !ok {
+		return fmt.Errorf("invalid location %q, expected \"lat,lon\"", s)
+	}
+	l.Lat, l.Lon = lat, lon
+	return nil
+}
+
+// ParseLocation parses a "lat,lon" location string
+func ParseLocation(location string) (float64, float64, bool) {
+	parts := strings.Split(location, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	lat, errLat := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lon, errLon := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if errLat != nil || errLon != nil {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
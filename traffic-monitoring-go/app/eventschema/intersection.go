@@ -0,0 +1,153 @@
+package eventschema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signal states of a SPaT movement, the J2735 MovementPhaseState values a
+// simulated controller cycles through
+const (
+	SignalGreen  = "green"  // protected-Movement-Allowed
+	SignalYellow = "yellow" // protected-clearance
+	SignalRed    = "red"    // stop-And-Remain
+)
+
+// Intersection is a synthetic signalized intersection, as the simulator pulls
+// it from GET /simulator/intersections and broadcasts it in SPaT and MAP messages
+type Intersection struct {
+	IntersectionID int          `json:"intersection_id"` // J2735 IntersectionID
+	Name           string       `json:"name"`
+	Latitude       float64      `json:"latitude"`
+	Longitude      float64      `json:"longitude"`
+	Approaches     []Approach   `json:"approaches"`
+	TimingPlans    []TimingPlan `json:"timing_plans"`
+}
+
+// Approach is one road entering an intersection, described in MAP messages
+type Approach struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name,omitempty"` // e.g. "northbound Market St"
+	Heading     float64 `json:"heading"`        // degrees clockwise from north, of traffic entering
+	Lanes       int     `json:"lanes"`
+	SignalGroup int     `json:"signal_group"` // J2735 SignalGroupID controlling its lanes
+}
+
+// TimingPlan is a fixed-time signal plan. Plans with a From/To window (HH:MM,
+// UTC, wrapping past midnight when To is earlier) apply within it; a plan
+// without one applies whenever no windowed plan does.
+type TimingPlan struct {
+	Name          string        `json:"name"`
+	From          string        `json:"from,omitempty"`
+	To            string        `json:"to,omitempty"`
+	CycleSeconds  int           `json:"cycle_seconds"`
+	OffsetSeconds int           `json:"offset_seconds,omitempty"` // cycle start after the Unix epoch, for coordination
+	Phases        []PhaseTiming `json:"phases"`
+}
+
+// PhaseTiming is when a signal group shows green and yellow within a cycle;
+// it shows red for the rest of it
+type PhaseTiming struct {
+	SignalGroup   int `json:"signal_group"`
+	StartSeconds  int `json:"start_seconds"` // green onset after the cycle start
+	GreenSeconds  int `json:"green_seconds"`
+	YellowSeconds int `json:"yellow_seconds"`
+}
+
+// SignalState is the state of a signal group at an instant, the content of a SPaT movement
+type SignalState struct {
+	SignalGroup  int     `json:"signal_group"`
+	State        string  `json:"state"`
+	TimeToChange float64 `json:"time_to_change"` // seconds until the next state, J2735 minEndTime
+}
+
+// PriorityStatus is an intersection's answer to one signal request, an entry of an SSM
+type PriorityStatus struct {
+	RequesterID string `json:"requester_id"` // station ID of the SRM
+	RequestID   int    `json:"request_id"`
+	Role        string `json:"role,omitempty"`
+	SignalGroup int    `json:"signal_group,omitempty"` // of the approach the requester comes in on
+	Status      string `json:"status"`
+}
+
+// ParseClock parses an HH:MM time of day into minutes after midnight
+func ParseClock(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	hours, errHours := strconv.Atoi(parts[0])
+	minutes, errMinutes := strconv.Atoi(parts[1])
+	if errHours != nil || errMinutes != nil || hours < 0 || hours > 23 || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// ActivePlan returns the timing plan in force at an instant
+func (in Intersection) ActivePlan(at time.Time) (TimingPlan, bool) {
+	at = at.UTC()
+	minute := at.Hour()*60 + at.Minute()
+
+	var fallback *TimingPlan
+	for i, plan := range in.TimingPlans {
+		if plan.From == "" || plan.To == "" {
+			if fallback == nil {
+				fallback = &in.TimingPlans[i]
+			}
+			continue
+		}
+		from, errFrom := ParseClock(plan.From)
+		to, errTo := ParseClock(plan.To)
+		if errFrom != nil || errTo != nil {
+			continue
+		}
+		if from <= to && minute >= from && minute < to || from > to && (minute >= from || minute < to) {
+			return plan, true
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return TimingPlan{}, false
+}
+
+// SignalStates computes the state of every signal group of the plan in force
+// at an instant, the ground truth the simulator's SPaT messages carry. Cycles
+// are counted from the Unix epoch plus the plan's offset, so the states are
+// the same wherever and whenever they are computed.
+func (in Intersection) SignalStates(at time.Time) []SignalState {
+	plan, ok := in.ActivePlan(at)
+	if !ok || plan.CycleSeconds <= 0 {
+		return nil
+	}
+
+	cycle := int64(plan.CycleSeconds) * 1000
+	elapsed := (at.UnixNano()/int64(time.Millisecond) - int64(plan.OffsetSeconds)*1000) % cycle
+	if elapsed < 0 {
+		elapsed += cycle
+	}
+
+	states := make([]SignalState, 0, len(plan.Phases))
+	for _, phase := range plan.Phases {
+		green := int64(phase.StartSeconds) * 1000
+		yellow := green + int64(phase.GreenSeconds)*1000
+		red := yellow + int64(phase.YellowSeconds)*1000
+
+		// position within the phase, counted from its green onset
+		t := (elapsed - green + cycle) % cycle
+		state := SignalState{SignalGroup: phase.SignalGroup}
+		switch {
+		case t < yellow-green:
+			state.State, state.TimeToChange = SignalGreen, float64(yellow-green-t)/1000
+		case t < red-green:
+			state.State, state.TimeToChange = SignalYellow, float64(red-green-t)/1000
+		default:
+			state.State, state.TimeToChange = SignalRed, float64(cycle-t)/1000
+		}
+		states = append(states, state)
+	}
+	return states
+}
@@ -0,0 +1,11 @@
+package eventschema
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3 description of POST /ingest, with a schema for
+// each payload type the data generator and the intersection simulator send.
+// A valid request body matches exactly one of them; the contract tests
+// (tests/contract) check the generator's payloads against it.
+//
+//go:embed openapi.json
+var OpenAPI []byte
@@ -0,0 +1,617 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Request is a GraphQL request, as clients POST it
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Error is a request or field error. Field errors carry the path of the
+// field in the response.
+type Error struct {
+	Message   string        `json:"message"`
+	Locations []Location    `json:"locations,omitempty"`
+	Path      []interface{} `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Response is the result of a request. Data is absent when the request
+// failed before execution, and null when a non-null root field failed.
+type Response struct {
+	Data     interface{}
+	Errors   []*Error
+	executed bool
+}
+
+// Executed reports whether the operation ran; it did not when the request was
+// malformed or invalid
+func (r *Response) Executed() bool {
+	return r.executed
+}
+
+// MarshalJSON writes the response as {"data": ..., "errors": [...]}
+func (r *Response) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Data   *json.RawMessage `json:"data,omitempty"`
+		Errors []*Error         `json:"errors,omitempty"`
+	}{Errors: r.Errors}
+	if r.executed {
+		data, err := json.Marshal(r.Data)
+		if err != nil {
+			return nil, err
+		}
+		raw := json.RawMessage(data)
+		out.Data = &raw
+	}
+	return json.Marshal(out)
+}
+
+// Execute runs the request's query operation against the schema
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		if syntaxErr, ok := err.(*SyntaxError); ok {
+			return &Response{Errors: []*Error{{Message: "Syntax error: " + syntaxErr.Message, Locations: []Location{syntaxErr.Loc}}}}
+		}
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+	if op.Type != "query" {
+		return &Response{Errors: []*Error{{
+			Message:   fmt.Sprintf("%s operations are not supported, only queries", op.Type),
+			Locations: []Location{op.Loc},
+		}}}
+	}
+	if errs := s.validate(doc, op); len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+
+	e := &executor{ctx: ctx, schema: s, doc: doc}
+	if errs := e.coerceVariables(op, req.Variables); len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+
+	data, ok := e.executeSelectionSet(s.Query, nil, op.SelectionSet, nil)
+	resp := &Response{Errors: e.errors, executed: true}
+	if ok {
+		resp.Data = data
+	}
+	return resp
+}
+
+// selectOperation picks the operation named name, or the document's only operation
+func selectOperation(doc *Document, name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, fmt.Errorf("the document has %d operations, an operationName must be given", len(doc.Operations))
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// responseObject is an object of the response, which keeps its fields in query order
+type responseObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *responseObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// executor runs one operation, resolving fields one at a time and collecting field errors
+type executor struct {
+	ctx    context.Context
+	schema *Schema
+	doc    *Document
+	vars   map[string]interface{}
+	errors []*Error
+}
+
+func (e *executor) addError(message string, field *Field, path []interface{}) {
+	e.errors = append(e.errors, &Error{
+		Message:   message,
+		Locations: []Location{field.Loc},
+		Path:      append([]interface{}(nil), path...),
+	})
+}
+
+// coerceVariables checks the given variables against the operation's
+// definitions, applying defaults
+func (e *executor) coerceVariables(op *Operation, given map[string]interface{}) []*Error {
+	e.vars = map[string]interface{}{}
+	var errs []*Error
+	for _, def := range op.Variables {
+		t, err := e.schema.inputType(def.Type)
+		if err != nil {
+			errs = append(errs, &Error{Message: fmt.Sprintf("variable $%s: %v", def.Name, err), Locations: []Location{def.Loc}})
+			continue
+		}
+
+		value, ok := given[def.Name]
+		switch {
+		case ok:
+			value, err = e.coerceInput(t, value)
+		case def.Default != nil:
+			value, err = e.coerceInput(t, def.Default)
+		case def.Type.NonNull:
+			err = fmt.Errorf("a value of type %s is required", t)
+		default:
+			continue
+		}
+		if err != nil {
+			errs = append(errs, &Error{Message: fmt.Sprintf("variable $%s: %v", def.Name, err), Locations: []Location{def.Loc}})
+			continue
+		}
+		e.vars[def.Name] = value
+	}
+	return errs
+}
+
+// inputType resolves a type written in a query, which must be a scalar or enum, or a list of them
+func (s *Schema) inputType(ref *TypeRef) (Type, error) {
+	var t Type
+	if ref.Elem != nil {
+		elem, err := s.inputType(ref.Elem)
+		if err != nil {
+			return nil, err
+		}
+		t = &List{Of: elem}
+	} else {
+		named, ok := s.types[ref.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s", ref.Name)
+		}
+		if _, isObject := named.(*Object); isObject {
+			return nil, fmt.Errorf("%s is not an input type", ref.Name)
+		}
+		t = named
+	}
+	if ref.NonNull {
+		t = &NonNull{Of: t}
+	}
+	return t, nil
+}
+
+// coerceInput turns a query literal or JSON variable value into the Go value of an input type
+func (e *executor) coerceInput(t Type, value interface{}) (interface{}, error) {
+	if v, ok := value.(Variable); ok {
+		value, ok = e.vars[string(v)]
+		if !ok {
+			value = nil
+		}
+		// variables hold coerced values; only their nullability needs checking
+		if _, nonNull := t.(*NonNull); nonNull && value == nil {
+			return nil, fmt.Errorf("variable $%s of type %s is null", v, t)
+		}
+		return value, nil
+	}
+
+	if nonNull, ok := t.(*NonNull); ok {
+		if value == nil {
+			return nil, fmt.Errorf("expected a value of type %s, got null", t)
+		}
+		return e.coerceInput(nonNull.Of, value)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *List:
+		items, ok := value.([]interface{})
+		if !ok {
+			// a single value stands for a list of one
+			item, err := e.coerceInput(t.Of, value)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			coerced, err := e.coerceInput(t.Of, item)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %v", i, err)
+			}
+			list[i] = coerced
+		}
+		return list, nil
+	case *Enum:
+		var name string
+		switch v := value.(type) {
+		case EnumValue:
+			name = string(v)
+		case string:
+			name = v
+		}
+		for _, allowed := range t.Values {
+			if name == allowed {
+				return name, nil
+			}
+		}
+		return nil, fmt.Errorf("expected one of %s, got %s", strings.Join(t.Values, ", "), formatValue(value))
+	case *Scalar:
+		switch value.(type) {
+		case EnumValue, []*ObjectField, map[string]interface{}:
+			return nil, fmt.Errorf("expected a value of type %s, got %s", t.Name, formatValue(value))
+		}
+		parsed, err := t.ParseValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", t.Name, err)
+		}
+		return parsed, nil
+	}
+	return nil, fmt.Errorf("%s is not an input type", t)
+}
+
+// formatValue writes a value in an error message
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []*ObjectField, map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprint(value)
+}
+
+// coerceArgs gathers the arguments of a field or directive, applying defaults
+func (e *executor) coerceArgs(defs []*Arg, given []*Argument) (map[string]interface{}, error) {
+	args := make(map[string]interface{}, len(defs))
+	for _, def := range defs {
+		var arg *Argument
+		for _, candidate := range given {
+			if candidate.Name == def.Name {
+				arg = candidate
+				break
+			}
+		}
+
+		provided := arg != nil
+		if v, isVar := arg.value().(Variable); provided && isVar {
+			_, provided = e.vars[string(v)]
+		}
+		if !provided {
+			if def.Default != nil {
+				args[def.Name] = def.Default
+			} else if _, nonNull := def.Type.(*NonNull); nonNull {
+				return nil, fmt.Errorf("argument %s of type %s is required", def.Name, def.Type)
+			}
+			continue
+		}
+
+		value, err := e.coerceInput(def.Type, arg.Value)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %v", def.Name, err)
+		}
+		args[def.Name] = value
+	}
+	return args, nil
+}
+
+func (a *Argument) value() Value {
+	if a == nil {
+		return nil
+	}
+	return a.Value
+}
+
+// conditionArgs is the argument of @skip and @include
+var conditionArgs = []*Arg{{Name: "if", Type: &NonNull{Of: Boolean}}}
+
+// included applies the @skip and @include directives of a selection
+func (e *executor) included(directives []*Directive) bool {
+	for _, directive := range directives {
+		if directive.Name != "skip" && directive.Name != "include" {
+			continue
+		}
+		args, err := e.coerceArgs(conditionArgs, directive.Arguments)
+		if err != nil {
+			// validation already checked the argument
+			continue
+		}
+		if args["if"] == (directive.Name == "skip") {
+			return false
+		}
+	}
+	return true
+}
+
+// collectFields groups the fields selected on an object by response key, in query order
+func (e *executor) collectFields(obj *Object, selections []Selection, keys []string, fields map[string][]*Field, visited map[string]bool) []string {
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *Field:
+			if !e.included(selection.Directives) {
+				continue
+			}
+			key := selection.ResponseKey()
+			if _, seen := fields[key]; !seen {
+				keys = append(keys, key)
+			}
+			fields[key] = append(fields[key], selection)
+		case *InlineFragment:
+			if !e.included(selection.Directives) || selection.TypeCondition != "" && selection.TypeCondition != obj.Name {
+				continue
+			}
+			keys = e.collectFields(obj, selection.SelectionSet, keys, fields, visited)
+		case *FragmentSpread:
+			if visited[selection.Name] || !e.included(selection.Directives) {
+				continue
+			}
+			visited[selection.Name] = true
+			fragment := e.doc.Fragments[selection.Name]
+			if fragment == nil || fragment.TypeCondition != obj.Name {
+				continue
+			}
+			keys = e.collectFields(obj, fragment.SelectionSet, keys, fields, visited)
+		}
+	}
+	return keys
+}
+
+// executeSelectionSet resolves the selected fields of an object. It reports
+// false when a non-null field failed, nulling the object.
+func (e *executor) executeSelectionSet(obj *Object, source interface{}, selections []Selection, path []interface{}) (*responseObject, bool) {
+	fields := map[string][]*Field{}
+	keys := e.collectFields(obj, selections, nil, fields, map[string]bool{})
+
+	result := &responseObject{keys: keys, values: make(map[string]interface{}, len(keys))}
+	for _, key := range keys {
+		value, ok := e.executeField(obj, source, fields[key], append(path[:len(path):len(path)], key))
+		if !ok {
+			return nil, false
+		}
+		result.values[key] = value
+	}
+	return result, true
+}
+
+// executeField resolves and completes one response key of an object
+func (e *executor) executeField(obj *Object, source interface{}, fields []*Field, path []interface{}) (interface{}, bool) {
+	field := fields[0]
+	if field.Name == "__typename" {
+		return obj.Name, true
+	}
+	def := obj.FieldDef(field.Name)
+
+	result, err := e.resolve(def, source, field)
+	if err != nil {
+		e.addError(err.Error(), field, path)
+		_, nonNull := def.Type.(*NonNull)
+		return nil, !nonNull
+	}
+	return e.completeValue(def.Type, fields, result, path)
+}
+
+// resolve runs the field's resolver, or reads the field from its source
+func (e *executor) resolve(def *FieldDef, source interface{}, field *Field) (result interface{}, err error) {
+	args, err := e.coerceArgs(def.Args, field.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	if def.Resolve == nil {
+		return defaultResolve(source, def.Name), nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("graphql: resolver of %s panicked: %v", def.Name, r)
+			result, err = nil, fmt.Errorf("internal error resolving %s", def.Name)
+		}
+	}()
+	return def.Resolve(ResolveParams{Context: e.ctx, Source: source, Args: args})
+}
+
+// completeValue turns a resolved value into its response form. It reports
+// false when a null reached a non-null position, for the parent to be nulled.
+func (e *executor) completeValue(t Type, fields []*Field, result interface{}, path []interface{}) (interface{}, bool) {
+	if nonNull, ok := t.(*NonNull); ok {
+		value, ok := e.completeNullable(nonNull.Of, fields, result, path)
+		if !ok {
+			return nil, false
+		}
+		if value == nil {
+			e.addError(fmt.Sprintf("cannot return null for non-nullable field %s", fields[0].Name), fields[0], path)
+			return nil, false
+		}
+		return value, true
+	}
+
+	value, ok := e.completeNullable(t, fields, result, path)
+	if !ok {
+		return nil, true
+	}
+	return value, true
+}
+
+// completeNullable completes a value of a nullable type, reporting false when
+// it must be nulled because of an error
+func (e *executor) completeNullable(t Type, fields []*Field, result interface{}, path []interface{}) (interface{}, bool) {
+	v := reflect.ValueOf(result)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, true
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() == reflect.Map && v.IsNil() {
+		return nil, true
+	}
+
+	switch t := t.(type) {
+	case *List:
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			e.addError(fmt.Sprintf("expected a list for field %s, got %T", fields[0].Name, result), fields[0], path)
+			return nil, false
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			item, ok := e.completeValue(t.Of, fields, v.Index(i).Interface(), append(path[:len(path):len(path)], i))
+			if !ok {
+				return nil, false
+			}
+			list[i] = item
+		}
+		return list, true
+
+	case *Object:
+		var selections []Selection
+		for _, field := range fields {
+			selections = append(selections, field.SelectionSet...)
+		}
+		object, ok := e.executeSelectionSet(t, v.Interface(), selections, path)
+		if !ok {
+			return nil, false
+		}
+		return object, true
+
+	case *Enum:
+		name, err := serializeString(v.Interface())
+		if err == nil {
+			for _, allowed := range t.Values {
+				if name == allowed {
+					return name, true
+				}
+			}
+		}
+		e.addError(fmt.Sprintf("%v is not a value of %s", v.Interface(), t.Name), fields[0], path)
+		return nil, false
+
+	case *Scalar:
+		value, err := t.Serialize(v.Interface())
+		if err != nil {
+			e.addError(err.Error(), fields[0], path)
+			return nil, false
+		}
+		return value, true
+	}
+	e.addError(fmt.Sprintf("unsupported type %s", t), fields[0], path)
+	return nil, false
+}
+
+// jsonFields caches the index of struct fields by JSON name
+var jsonFields sync.Map // reflect.Type -> map[string][]int
+
+// defaultResolve reads a field from a map, or from the struct field of the same JSON name
+func defaultResolve(source interface{}, name string) interface{} {
+	v := reflect.ValueOf(source)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		value := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		if !value.IsValid() {
+			return nil
+		}
+		return value.Interface()
+	case reflect.Struct:
+		index, ok := structFields(v.Type())[name]
+		if !ok {
+			return nil
+		}
+		field, err := v.FieldByIndexErr(index)
+		if err != nil {
+			// a nil embedded pointer
+			return nil
+		}
+		return field.Interface()
+	}
+	return nil
+}
+
+// structFields indexes the exported fields of a struct type by JSON name,
+// including those promoted from embedded structs
+func structFields(t reflect.Type) map[string][]int {
+	if cached, ok := jsonFields.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+
+	index := map[string][]int{}
+	var walk func(t reflect.Type, prefix []int)
+	walk = func(t reflect.Type, prefix []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			position := append(prefix[:len(prefix):len(prefix)], i)
+			tag := strings.Split(f.Tag.Get("json"), ",")[0]
+			if tag == "-" {
+				continue
+			}
+			if f.Anonymous && tag == "" {
+				embedded := f.Type
+				if embedded.Kind() == reflect.Ptr {
+					embedded = embedded.Elem()
+				}
+				if embedded.Kind() == reflect.Struct {
+					walk(embedded, position)
+					continue
+				}
+			}
+			if !f.IsExported() {
+				continue
+			}
+			name := tag
+			if name == "" {
+				name = f.Name
+			}
+			// shallower fields win, as in encoding/json
+			if existing, ok := index[name]; !ok || len(existing) > len(position) {
+				index[name] = position
+			}
+		}
+	}
+	walk(t, nil)
+
+	jsonFields.Store(t, index)
+	return index
+}
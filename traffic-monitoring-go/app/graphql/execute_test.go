@@ -0,0 +1,157 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		operation string
+		variables map[string]interface{}
+		response  string
+	}{
+		{
+			name:     "fields in query order",
+			query:    `{ items(page_size: 2) { name id } }`,
+			response: `{"data":{"items":[{"name":"first","id":"1"},{"name":"second","id":"2"}]}}`,
+		},
+		{
+			name:     "aliases, __typename and fragments",
+			query:    `{ one: item(id: 1) { __typename ...f } two: item(id: "2") { name } } fragment f on Item { id severity }`,
+			response: `{"data":{"one":{"__typename":"Item","id":"1","severity":"high"},"two":{"name":"second"}}}`,
+		},
+		{
+			name:      "directives",
+			query:     `query ($all: Boolean!) { item(id: 3) { id name @include(if: $all) severity @skip(if: true) } }`,
+			variables: map[string]interface{}{"all": false},
+			response:  `{"data":{"item":{"id":"3"}}}`,
+		},
+		{
+			name:      "variables and enums",
+			query:     `query ($s: Severity = high, $n: Int) { items(severity: $s, page_size: $n) { id } }`,
+			variables: map[string]interface{}{"s": "low"},
+			response:  `{"data":{"items":[{"id":"2"},{"id":"3"}]}}`,
+		},
+		{
+			name:     "variable defaults",
+			query:    `query ($s: Severity = high) { items(severity: $s) { id } }`,
+			response: `{"data":{"items":[{"id":"1"}]}}`,
+		},
+		{
+			name:      "operation name",
+			query:     `query A { item(id: 1) { id } } query B { item(id: 2) { id } }`,
+			operation: "B",
+			response:  `{"data":{"item":{"id":"2"}}}`,
+		},
+		{
+			name:     "null object",
+			query:    `{ item(id: 9) { id } }`,
+			response: `{"data":{"item":null}}`,
+		},
+		{
+			name:     "resolver error nulls the field",
+			query:    `{ item(id: 1) { id broken } }`,
+			response: `{"data":{"item":{"id":"1","broken":null}},"errors":[{"message":"cannot load broken","locations":[{"line":1,"column":20}],"path":["item","broken"]}]}`,
+		},
+		{
+			name:     "panicking resolver",
+			query:    `{ item(id: 1) { panics } }`,
+			response: `{"data":{"item":{"panics":null}},"errors":[{"message":"internal error resolving panics","locations":[{"line":1,"column":17}],"path":["item","panics"]}]}`,
+		},
+		{
+			name:     "null in a non-null field nulls the nullable parent",
+			query:    `{ item(id: 1) { id required } }`,
+			response: `{"data":{"item":null},"errors":[{"message":"cannot return null for non-nullable field required","locations":[{"line":1,"column":20}],"path":["item","required"]}]}`,
+		},
+		{
+			name:     "null propagates through non-null lists to the data",
+			query:    `{ items(page_size: 1) { required } }`,
+			response: `{"data":null,"errors":[{"message":"cannot return null for non-nullable field required","locations":[{"line":1,"column":25}],"path":["items",0,"required"]}]}`,
+		},
+		{
+			name:     "custom scalar argument",
+			query:    `{ at(t: "2024-05-01T10:00:00Z") }`,
+			response: `{"data":{"at":"2024-05-01T10:00:00Z"}}`,
+		},
+	}
+
+	schema := newTestSchema(t, 0, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := schema.Execute(context.Background(), Request{Query: tt.query, OperationName: tt.operation, Variables: tt.variables})
+			assert.True(t, resp.Executed())
+			body, err := json.Marshal(resp)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.response, string(body))
+		})
+	}
+}
+
+func TestExecuteRequestErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		operation string
+		variables map[string]interface{}
+		message   string
+	}{
+		{"syntax error", `{ items { id }`, "", nil, "Syntax error: unexpected end of query"},
+		{"mutation", `mutation { items { id } }`, "", nil, "mutation operations are not supported, only queries"},
+		{"several operations without a name", `query A { items { id } } query B { items { id } }`, "", nil, "the document has 2 operations, an operationName must be given"},
+		{"unknown operation", `query A { items { id } }`, "B", nil, `unknown operation "B"`},
+		{"invalid query", `{ items { color } }`, "", nil, "cannot query field color on type Item"},
+		{"missing required variable", `query ($id: ID!) { item(id: $id) { id } }`, "", nil, "variable $id: a value of type ID! is required"},
+		{"variable of the wrong type", `query ($n: Int) { items(page_size: $n) { id } }`, "", map[string]interface{}{"n": "ten"}, "variable $n: Int: cannot represent ten as an Int"},
+		{"variable outside an enum", `query ($s: Severity) { items(severity: $s) { id } }`, "", map[string]interface{}{"s": "medium"}, `variable $s: expected one of high, low, got "medium"`},
+		{"variable of an object type", `query ($i: Item) { items { id } }`, "", nil, "variable $i: Item is not an input type"},
+		{"variable of an unknown type", `query ($i: Color) { items { id } }`, "", nil, "variable $i: unknown type Color"},
+	}
+
+	schema := newTestSchema(t, 0, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := schema.Execute(context.Background(), Request{Query: tt.query, OperationName: tt.operation, Variables: tt.variables})
+			assert.False(t, resp.Executed())
+			assert.Nil(t, resp.Data)
+			require.Len(t, resp.Errors, 1)
+			assert.Equal(t, tt.message, resp.Errors[0].Message)
+		})
+	}
+}
+
+func TestExecuteTenantScoping(t *testing.T) {
+	tests := []struct {
+		name     string
+		tenant   string
+		query    string
+		response string
+	}{
+		{"no tenant sees every item", "", `{ items { id } }`, `{"data":{"items":[{"id":"1"},{"id":"2"},{"id":"3"}]}}`},
+		{"a tenant sees its own items", "north", `{ items { id } }`, `{"data":{"items":[{"id":"1"},{"id":"3"}]}}`},
+		{"another tenant sees its own items", "south", `{ items { id } }`, `{"data":{"items":[{"id":"2"}]}}`},
+		{"a tenant cannot look up another's item", "south", `{ item(id: 1) { id } }`, `{"data":{"item":null}}`},
+		{"nested fields keep the tenant", "south", `{ items { children { id } } }`, `{"data":{"items":[{"children":[{"id":"2"}]}]}}`},
+		{"an unknown tenant sees nothing", "east", `{ items { id } }`, `{"data":{"items":[]}}`},
+	}
+
+	schema := newTestSchema(t, 0, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.tenant != "" {
+				ctx = context.WithValue(ctx, testTenantKey{}, tt.tenant)
+			}
+			resp := schema.Execute(ctx, Request{Query: tt.query})
+			body, err := json.Marshal(resp)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.response, string(body))
+		})
+	}
+}
@@ -0,0 +1,812 @@
+// Package graphql executes GraphQL queries against a schema of Go resolvers.
+// It covers what the SIEM's read API needs, so clients can join events,
+// alerts, rules and vehicles in one request without a GraphQL library:
+// queries with variables, aliases, fragments and @skip/@include over object,
+// list, enum and scalar types. Mutations, subscriptions, interfaces, unions and
+// input objects are not supported, and introspection is limited to __typename
+// (the schema is published as SDL instead).
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Location is a position in a query, 1-based
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Document is a parsed executable GraphQL document
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query, mutation or subscription of a document
+type Operation struct {
+	Type         string // query, mutation or subscription
+	Name         string
+	Variables    []*VariableDefinition
+	Directives   []*Directive
+	SelectionSet []Selection
+	Loc          Location
+}
+
+// VariableDefinition declares an operation variable
+type VariableDefinition struct {
+	Name    string
+	Type    *TypeRef
+	Default Value // nil without a default
+	Loc     Location
+}
+
+// TypeRef is a type written in a query, such as [String!]!
+type TypeRef struct {
+	Name    string   // named type, when Elem is nil
+	Elem    *TypeRef // list element
+	NonNull bool
+}
+
+func (t *TypeRef) String() string {
+	s := t.Name
+	if t.Elem != nil {
+		s = "[" + t.Elem.String() + "]"
+	}
+	if t.NonNull {
+		s += "!"
+	}
+	return s
+}
+
+// Selection is a *Field, *FragmentSpread or *InlineFragment
+type Selection interface {
+	location() Location
+}
+
+// Field selects a field of an object, under an alias when one is given
+type Field struct {
+	Alias        string
+	Name         string
+	Arguments    []*Argument
+	Directives   []*Directive
+	SelectionSet []Selection
+	Loc          Location
+}
+
+// ResponseKey is the key of the field in the response
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// FragmentSpread includes a named fragment
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+	Loc        Location
+}
+
+// InlineFragment includes selections, for objects of a type when it has a condition
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []*Directive
+	SelectionSet  []Selection
+	Loc           Location
+}
+
+// Fragment is a named fragment definition
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	Directives    []*Directive
+	SelectionSet  []Selection
+	Loc           Location
+}
+
+func (f *Field) location() Location          { return f.Loc }
+func (f *FragmentSpread) location() Location { return f.Loc }
+func (f *InlineFragment) location() Location { return f.Loc }
+
+// Directive is an @name(args) annotation
+type Directive struct {
+	Name      string
+	Arguments []*Argument
+	Loc       Location
+}
+
+// Argument is a name: value pair of a field or directive
+type Argument struct {
+	Name  string
+	Value Value
+	Loc   Location
+}
+
+// Value is a literal or variable in a query: Variable, EnumValue, int64,
+// float64, string, bool, nil (null), []Value or []*ObjectField
+type Value = interface{}
+
+// Variable refers to an operation variable
+type Variable string
+
+// EnumValue is an unquoted enum literal
+type EnumValue string
+
+// ObjectField is one field of an input object literal
+type ObjectField struct {
+	Name  string
+	Value Value
+}
+
+// SyntaxError is a malformed query
+type SyntaxError struct {
+	Message string
+	Loc     Location
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d:%d: %s", e.Loc.Line, e.Loc.Column, e.Message)
+}
+
+// token kinds
+const (
+	tokEOF = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind  int
+	value string
+	loc   Location
+}
+
+// lexer splits a query into tokens, skipping whitespace, commas and comments
+type lexer struct {
+	src  string
+	pos  int
+	line int
+	col  int
+}
+
+func (l *lexer) errorf(loc Location, format string, args ...interface{}) error {
+	return &SyntaxError{Message: fmt.Sprintf(format, args...), Loc: loc}
+}
+
+// advance moves past n bytes that hold no newline
+func (l *lexer) advance(n int) {
+	l.col += utf8.RuneCountInString(l.src[l.pos : l.pos+n])
+	l.pos += n
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.pos++
+			l.line, l.col = l.line+1, 1
+		case c == ' ' || c == '\t' || c == '\r' || c == ',' || c == 0xEF && strings.HasPrefix(l.src[l.pos:], "\uFEFF"):
+			if c == 0xEF {
+				l.advance(3)
+			} else {
+				l.advance(1)
+			}
+		case c == '#':
+			end := strings.IndexByte(l.src[l.pos:], '\n')
+			if end < 0 {
+				end = len(l.src) - l.pos
+			}
+			l.advance(end)
+		default:
+			return l.scan()
+		}
+	}
+	return token{kind: tokEOF, loc: Location{l.line, l.col}}, nil
+}
+
+func (l *lexer) scan() (token, error) {
+	loc := Location{l.line, l.col}
+	rest := l.src[l.pos:]
+	c := rest[0]
+
+	switch {
+	case strings.HasPrefix(rest, "..."):
+		l.advance(3)
+		return token{kind: tokPunct, value: "...", loc: loc}, nil
+	case strings.IndexByte("!$():=@[]{|}&", c) >= 0:
+		l.advance(1)
+		return token{kind: tokPunct, value: string(c), loc: loc}, nil
+	case c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+		n := 1
+		for n < len(rest) && (rest[n] == '_' || rest[n] >= 'A' && rest[n] <= 'Z' || rest[n] >= 'a' && rest[n] <= 'z' || rest[n] >= '0' && rest[n] <= '9') {
+			n++
+		}
+		l.advance(n)
+		return token{kind: tokName, value: rest[:n], loc: loc}, nil
+	case c == '-' || c >= '0' && c <= '9':
+		return l.scanNumber(loc)
+	case strings.HasPrefix(rest, `"""`):
+		return l.scanBlockString(loc)
+	case c == '"':
+		return l.scanString(loc)
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return token{}, l.errorf(loc, "unexpected character %q", r)
+}
+
+func (l *lexer) scanNumber(loc Location) (token, error) {
+	rest := l.src[l.pos:]
+	n := 0
+	if rest[n] == '-' {
+		n++
+	}
+	digits := func() int {
+		start := n
+		for n < len(rest) && rest[n] >= '0' && rest[n] <= '9' {
+			n++
+		}
+		return n - start
+	}
+	intStart := n
+	if digits() == 0 {
+		return token{}, l.errorf(loc, "invalid number")
+	}
+	if rest[intStart] == '0' && n-intStart > 1 {
+		return token{}, l.errorf(loc, "invalid number, unexpected digit after 0")
+	}
+	kind := tokInt
+	if n < len(rest) && rest[n] == '.' {
+		n++
+		kind = tokFloat
+		if digits() == 0 {
+			return token{}, l.errorf(loc, "invalid number, expected digit after .")
+		}
+	}
+	if n < len(rest) && (rest[n] == 'e' || rest[n] == 'E') {
+		n++
+		kind = tokFloat
+		if n < len(rest) && (rest[n] == '+' || rest[n] == '-') {
+			n++
+		}
+		if digits() == 0 {
+			return token{}, l.errorf(loc, "invalid number, expected digit in exponent")
+		}
+	}
+	if n < len(rest) && (rest[n] == '_' || rest[n] == '.' || rest[n] >= 'A' && rest[n] <= 'Z' || rest[n] >= 'a' && rest[n] <= 'z') {
+		return token{}, l.errorf(loc, "invalid number, unexpected %q", rest[n])
+	}
+	l.advance(n)
+	return token{kind: kind, value: rest[:n], loc: loc}, nil
+}
+
+func (l *lexer) scanString(loc Location) (token, error) {
+	var b strings.Builder
+	rest := l.src[l.pos:]
+	for n := 1; n < len(rest); {
+		c := rest[n]
+		switch {
+		case c == '"':
+			l.advance(n + 1)
+			return token{kind: tokString, value: b.String(), loc: loc}, nil
+		case c == '\n' || c == '\r':
+			return token{}, l.errorf(loc, "unterminated string")
+		case c == '\\':
+			if n+1 >= len(rest) {
+				return token{}, l.errorf(loc, "unterminated string")
+			}
+			switch rest[n+1] {
+			case '"', '\\', '/':
+				b.WriteByte(rest[n+1])
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if n+6 > len(rest) {
+					return token{}, l.errorf(loc, "invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(rest[n+2:n+6], 16, 32)
+				if err != nil {
+					return token{}, l.errorf(loc, "invalid unicode escape %q", rest[n:n+6])
+				}
+				b.WriteRune(rune(code))
+				n += 4
+			default:
+				return token{}, l.errorf(loc, "invalid escape \\%c", rest[n+1])
+			}
+			n += 2
+		default:
+			b.WriteByte(c)
+			n++
+		}
+	}
+	return token{}, l.errorf(loc, "unterminated string")
+}
+
+func (l *lexer) scanBlockString(loc Location) (token, error) {
+	rest := l.src[l.pos+3:]
+	var b strings.Builder
+	for n := 0; n < len(rest); {
+		switch {
+		case strings.HasPrefix(rest[n:], `\"""`):
+			b.WriteString(`"""`)
+			n += 4
+		case strings.HasPrefix(rest[n:], `"""`):
+			raw := l.src[l.pos : l.pos+3+n+3]
+			l.line += strings.Count(raw, "\n")
+			if i := strings.LastIndexByte(raw, '\n'); i >= 0 {
+				l.col = utf8.RuneCountInString(raw[i+1:]) + 1
+			} else {
+				l.col += utf8.RuneCountInString(raw)
+			}
+			l.pos += len(raw)
+			return token{kind: tokString, value: blockStringValue(b.String()), loc: loc}, nil
+		default:
+			b.WriteByte(rest[n])
+			n++
+		}
+	}
+	return token{}, l.errorf(loc, "unterminated block string")
+}
+
+// blockStringValue removes the common indentation and blank first and last lines of a block string
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = ""
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parser is a recursive descent parser of executable documents
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+// Parse parses an executable document: operations and fragment definitions
+func Parse(query string) (*Document, error) {
+	p := &parser{lex: &lexer{src: query, line: 1, col: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Fragments: map[string]*Fragment{}}
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.peek("{"):
+			loc := p.tok.loc
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", SelectionSet: selections, Loc: loc})
+		case p.tok.kind == tokName && (p.tok.value == "query" || p.tok.value == "mutation" || p.tok.value == "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+		case p.tok.kind == tokName && p.tok.value == "fragment":
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := doc.Fragments[fragment.Name]; exists {
+				return nil, &SyntaxError{Message: fmt.Sprintf("fragment %q is defined twice", fragment.Name), Loc: fragment.Loc}
+			}
+			doc.Fragments[fragment.Name] = fragment
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.Operations) == 0 {
+		return nil, &SyntaxError{Message: "the document has no operation", Loc: p.tok.loc}
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+// peek reports whether the current token is the punctuator s
+func (p *parser) peek(s string) bool {
+	return p.tok.kind == tokPunct && p.tok.value == s
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokEOF {
+		return &SyntaxError{Message: "unexpected end of query", Loc: p.tok.loc}
+	}
+	return &SyntaxError{Message: fmt.Sprintf("unexpected %q", p.tok.value), Loc: p.tok.loc}
+}
+
+// expect consumes the punctuator s
+func (p *parser) expect(s string) error {
+	if !p.peek(s) {
+		if p.tok.kind == tokEOF {
+			return &SyntaxError{Message: fmt.Sprintf("expected %q, got the end of the query", s), Loc: p.tok.loc}
+		}
+		return &SyntaxError{Message: fmt.Sprintf("expected %q, got %q", s, p.tok.value), Loc: p.tok.loc}
+	}
+	return p.advance()
+}
+
+// name consumes a name
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.unexpected()
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) operation() (*Operation, error) {
+	op := &Operation{Type: p.tok.value, Loc: p.tok.loc}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokName {
+		op.Name = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek("(") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for !p.peek(")") {
+			def := &VariableDefinition{Loc: p.tok.loc}
+			if err := p.expect("$"); err != nil {
+				return nil, err
+			}
+			var err error
+			if def.Name, err = p.name(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if def.Type, err = p.typeRef(); err != nil {
+				return nil, err
+			}
+			if p.peek("=") {
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+				if def.Default, err = p.value(true); err != nil {
+					return nil, err
+				}
+			}
+			op.Variables = append(op.Variables, def)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if op.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if op.SelectionSet, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) fragment() (*Fragment, error) {
+	fragment := &Fragment{Loc: p.tok.loc}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if fragment.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if fragment.Name == "on" {
+		return nil, &SyntaxError{Message: `a fragment cannot be named "on"`, Loc: fragment.Loc}
+	}
+	if p.tok.kind != tokName || p.tok.value != "on" {
+		return nil, p.unexpected()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if fragment.TypeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if fragment.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if fragment.SelectionSet, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return fragment, nil
+}
+
+func (p *parser) typeRef() (*TypeRef, error) {
+	var t *TypeRef
+	if p.peek("[") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		elem, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		t = &TypeRef{Elem: elem}
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		t = &TypeRef{Name: name}
+	}
+	if p.peek("!") {
+		t.NonNull = true
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (p *parser) selectionSet() ([]Selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var selections []Selection
+	for !p.peek("}") {
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	if len(selections) == 0 {
+		return nil, &SyntaxError{Message: "empty selection set", Loc: p.tok.loc}
+	}
+	return selections, p.advance()
+}
+
+func (p *parser) selection() (Selection, error) {
+	loc := p.tok.loc
+	if p.peek("...") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokName && p.tok.value != "on" {
+			spread := &FragmentSpread{Name: p.tok.value, Loc: loc}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			var err error
+			spread.Directives, err = p.directives()
+			return spread, err
+		}
+
+		inline := &InlineFragment{Loc: loc}
+		if p.tok.kind == tokName {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			var err error
+			if inline.TypeCondition, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if inline.Directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		if inline.SelectionSet, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+		return inline, nil
+	}
+
+	field := &Field{Loc: loc}
+	var err error
+	if field.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if p.peek(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		field.Alias = field.Name
+		if field.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if field.Arguments, err = p.arguments(false); err != nil {
+		return nil, err
+	}
+	if field.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek("{") {
+		if field.SelectionSet, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+func (p *parser) arguments(constant bool) ([]*Argument, error) {
+	if !p.peek("(") {
+		return nil, nil
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var args []*Argument
+	seen := map[string]bool{}
+	for !p.peek(")") {
+		arg := &Argument{Loc: p.tok.loc}
+		var err error
+		if arg.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if seen[arg.Name] {
+			return nil, &SyntaxError{Message: fmt.Sprintf("argument %q is given twice", arg.Name), Loc: arg.Loc}
+		}
+		seen[arg.Name] = true
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if arg.Value, err = p.value(constant); err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) == 0 {
+		return nil, &SyntaxError{Message: "empty argument list", Loc: p.tok.loc}
+	}
+	return args, p.advance()
+}
+
+func (p *parser) directives() ([]*Directive, error) {
+	var directives []*Directive
+	for p.peek("@") {
+		directive := &Directive{Loc: p.tok.loc}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		if directive.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if directive.Arguments, err = p.arguments(false); err != nil {
+			return nil, err
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+// value parses a value; constant values, such as variable defaults, may not refer to variables
+func (p *parser) value(constant bool) (Value, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokInt:
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, &SyntaxError{Message: fmt.Sprintf("integer %s out of range", tok.value), Loc: tok.loc}
+		}
+		return n, p.advance()
+	case tokFloat:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, &SyntaxError{Message: fmt.Sprintf("invalid float %s", tok.value), Loc: tok.loc}
+		}
+		return f, p.advance()
+	case tokString:
+		return tok.value, p.advance()
+	case tokName:
+		var v Value
+		switch tok.value {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = EnumValue(tok.value)
+		}
+		return v, p.advance()
+	}
+
+	switch {
+	case p.peek("$") && !constant:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return Variable(name), err
+	case p.peek("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := []Value{}
+		for !p.peek("]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, p.advance()
+	case p.peek("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		fields := []*ObjectField{}
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			value, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, &ObjectField{Name: name, Value: value})
+		}
+		return fields, p.advance()
+	}
+	return nil, p.unexpected()
+}
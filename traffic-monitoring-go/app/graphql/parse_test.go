@@ -0,0 +1,153 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		check func(t *testing.T, doc *Document)
+	}{
+		{
+			name:  "shorthand query",
+			query: `{ items { id } }`,
+			check: func(t *testing.T, doc *Document) {
+				require.Len(t, doc.Operations, 1)
+				op := doc.Operations[0]
+				assert.Equal(t, "query", op.Type)
+				assert.Empty(t, op.Name)
+				field := op.SelectionSet[0].(*Field)
+				assert.Equal(t, "items", field.Name)
+				assert.Equal(t, "id", field.SelectionSet[0].(*Field).Name)
+			},
+		},
+		{
+			name:  "named query with variables and defaults",
+			query: `query Page($size: Int = 20, $ids: [ID!]!) { items(page_size: $size) { id } }`,
+			check: func(t *testing.T, doc *Document) {
+				op := doc.Operations[0]
+				assert.Equal(t, "Page", op.Name)
+				require.Len(t, op.Variables, 2)
+				assert.Equal(t, "size", op.Variables[0].Name)
+				assert.Equal(t, "Int", op.Variables[0].Type.String())
+				assert.Equal(t, int64(20), op.Variables[0].Default)
+				assert.Equal(t, "[ID!]!", op.Variables[1].Type.String())
+				assert.Nil(t, op.Variables[1].Default)
+				arg := op.SelectionSet[0].(*Field).Arguments[0]
+				assert.Equal(t, Variable("size"), arg.Value)
+			},
+		},
+		{
+			name:  "aliases and argument values",
+			query: `{ first: item(id: "1", n: -3, f: 1.5e2, b: true, z: null, e: HIGH, l: [1, 2], o: {a: "x"}) { id } }`,
+			check: func(t *testing.T, doc *Document) {
+				field := doc.Operations[0].SelectionSet[0].(*Field)
+				assert.Equal(t, "first", field.Alias)
+				assert.Equal(t, "item", field.Name)
+				assert.Equal(t, "first", field.ResponseKey())
+				values := map[string]Value{}
+				for _, arg := range field.Arguments {
+					values[arg.Name] = arg.Value
+				}
+				assert.Equal(t, "1", values["id"])
+				assert.Equal(t, int64(-3), values["n"])
+				assert.Equal(t, 150.0, values["f"])
+				assert.Equal(t, true, values["b"])
+				assert.Nil(t, values["z"])
+				assert.Equal(t, EnumValue("HIGH"), values["e"])
+				assert.Equal(t, []Value{int64(1), int64(2)}, values["l"])
+				assert.Equal(t, []*ObjectField{{Name: "a", Value: "x"}}, values["o"])
+			},
+		},
+		{
+			name:  "fragments and directives",
+			query: "query { items { ...parts ... on Item @include(if: true) { name } } }\nfragment parts on Item @skip(if: false) { id }",
+			check: func(t *testing.T, doc *Document) {
+				selections := doc.Operations[0].SelectionSet[0].(*Field).SelectionSet
+				spread := selections[0].(*FragmentSpread)
+				assert.Equal(t, "parts", spread.Name)
+				inline := selections[1].(*InlineFragment)
+				assert.Equal(t, "Item", inline.TypeCondition)
+				assert.Equal(t, "include", inline.Directives[0].Name)
+				fragment := doc.Fragments["parts"]
+				require.NotNil(t, fragment)
+				assert.Equal(t, "Item", fragment.TypeCondition)
+				assert.Equal(t, "skip", fragment.Directives[0].Name)
+				assert.Equal(t, Location{Line: 2, Column: 1}, fragment.Loc)
+			},
+		},
+		{
+			name:  "strings, escapes, comments and commas",
+			query: "# leading comment\n{ item(id: \"a\\\"b\\u00e9\\n\", s: \"\"\"\n    block\n      indented\n    \"\"\"), { id } }",
+			check: func(t *testing.T, doc *Document) {
+				args := doc.Operations[0].SelectionSet[0].(*Field).Arguments
+				assert.Equal(t, "a\"bé\n", args[0].Value)
+				assert.Equal(t, "block\n  indented", args[1].Value)
+			},
+		},
+		{
+			name:  "several operations",
+			query: `query A { items { id } } query B { items { name } }`,
+			check: func(t *testing.T, doc *Document) {
+				require.Len(t, doc.Operations, 2)
+				assert.Equal(t, "A", doc.Operations[0].Name)
+				assert.Equal(t, "B", doc.Operations[1].Name)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.query)
+			require.NoError(t, err)
+			tt.check(t, doc)
+		})
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		message string
+		loc     Location
+	}{
+		{"empty document", ``, "the document has no operation", Location{1, 1}},
+		{"only a fragment", `fragment f on Item { id }`, "the document has no operation", Location{1, 26}},
+		{"unclosed selection set", `{ items { id }`, "unexpected end of query", Location{1, 15}},
+		{"empty selection set", `{ }`, "empty selection set", Location{1, 3}},
+		{"unexpected character", `{ items ? }`, `unexpected character '?'`, Location{1, 9}},
+		{"unterminated string", `{ item(id: "1) { id } }`, "unterminated string", Location{1, 12}},
+		{"invalid escape", `{ item(id: "\x") { id } }`, `invalid escape \x`, Location{1, 12}},
+		{"unterminated block string", `{ item(id: """abc) { id } }`, "unterminated block string", Location{1, 12}},
+		{"leading zero", `{ items(page_size: 01) { id } }`, "invalid number, unexpected digit after 0", Location{1, 20}},
+		{"number followed by a name", `{ items(page_size: 1x) { id } }`, `invalid number, unexpected 'x'`, Location{1, 20}},
+		{"missing exponent", `{ items(page_size: 1e) { id } }`, "invalid number, expected digit in exponent", Location{1, 20}},
+		{"integer out of range", `{ items(page_size: 99999999999999999999) { id } }`, "integer 99999999999999999999 out of range", Location{1, 20}},
+		{"argument given twice", `{ item(id: 1, id: 2) { id } }`, `argument "id" is given twice`, Location{1, 15}},
+		{"empty argument list", `{ item() { id } }`, "empty argument list", Location{1, 8}},
+		{"missing colon", `{ item(id 1) { id } }`, `expected ":", got "1"`, Location{1, 11}},
+		{"variable in a default", `query ($a: Int = $b) { items { id } }`, `unexpected "$"`, Location{1, 18}},
+		{"fragment named on", `fragment on on Item { id } { items { id } }`, `a fragment cannot be named "on"`, Location{1, 1}},
+		{"fragment defined twice", `{ items { id } } fragment f on Item { id } fragment f on Item { name }`, `fragment "f" is defined twice`, Location{1, 44}},
+		{"fragment without type condition", `{ items { id } } fragment f { id }`, `unexpected "{"`, Location{1, 29}},
+		{"unknown definition", `schema { query: Query }`, `unexpected "schema"`, Location{1, 1}},
+		{"unclosed list type", `query ($a: [Int) { items { id } }`, `expected "]", got ")"`, Location{1, 16}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			require.Error(t, err)
+			syntaxErr, ok := err.(*SyntaxError)
+			require.True(t, ok, "expected a *SyntaxError, got %T", err)
+			assert.Equal(t, tt.message, syntaxErr.Message)
+			assert.Equal(t, tt.loc, syntaxErr.Loc)
+		})
+	}
+}
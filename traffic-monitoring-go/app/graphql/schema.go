@@ -0,0 +1,418 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is a GraphQL type: *Scalar, *Enum, *Object, *List or *NonNull
+type Type interface {
+	String() string
+}
+
+// Named types are *Scalar, *Enum and *Object
+type namedType interface {
+	Type
+	typeName() string
+}
+
+// Scalar is a leaf type. Serialize turns a resolved Go value into its JSON
+// form; ParseValue turns an argument (from a literal or JSON variable) into
+// the Go value resolvers receive.
+type Scalar struct {
+	Name        string
+	Description string
+	Serialize   func(value interface{}) (interface{}, error)
+	ParseValue  func(value interface{}) (interface{}, error)
+}
+
+// Enum is a leaf type taking one of a set of names. Resolved values serialize
+// by their string form.
+type Enum struct {
+	Name        string
+	Description string
+	Values      []string
+}
+
+// Object is a type with fields
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*FieldDef
+}
+
+// FieldDef returns the field of the object named name
+func (o *Object) FieldDef(name string) *FieldDef {
+	for _, f := range o.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// List is a list of Of
+type List struct{ Of Type }
+
+// NonNull is a type whose values may not be null
+type NonNull struct{ Of Type }
+
+func (s *Scalar) String() string  { return s.Name }
+func (e *Enum) String() string    { return e.Name }
+func (o *Object) String() string  { return o.Name }
+func (l *List) String() string    { return "[" + l.Of.String() + "]" }
+func (n *NonNull) String() string { return n.Of.String() + "!" }
+
+func (s *Scalar) typeName() string { return s.Name }
+func (e *Enum) typeName() string   { return e.Name }
+func (o *Object) typeName() string { return o.Name }
+
+// FieldDef is the definition of a field of an object. Without Resolve the
+// field is read from its source: a map key or the struct field whose JSON
+// name is the field name.
+type FieldDef struct {
+	Name        string
+	Description string
+	Type        Type
+	Args        []*Arg
+	Resolve     ResolveFunc
+
+	// SizeArg names the argument bounding how many items the field returns,
+	// such as page_size; the fields selected under it count once per item
+	// towards the complexity of a query
+	SizeArg string
+}
+
+// Arg is an argument of a field. Default is used when the argument is omitted.
+type Arg struct {
+	Name        string
+	Description string
+	Type        Type
+	Default     interface{}
+}
+
+// ResolveFunc resolves a field of Source
+type ResolveFunc func(p ResolveParams) (interface{}, error)
+
+// ResolveParams are the inputs of a resolver. Source is the value resolved
+// for the parent object, dereferenced when it was a pointer. Args hold every
+// argument that was given or has a default, as the Go values of their types:
+// int, float64, string, bool, a string for enums, and []interface{} for lists.
+type ResolveParams struct {
+	Context context.Context
+	Source  interface{}
+	Args    map[string]interface{}
+}
+
+// Schema is a set of types reachable from the query root
+type Schema struct {
+	Query *Object
+
+	// MaxDepth bounds how deeply queries may nest fields, 0 for no bound.
+	// Nested list fields multiply the rows a query loads.
+	MaxDepth int
+
+	// MaxComplexity bounds the fields a query may resolve, 0 for no bound.
+	// The fields under one with a SizeArg count once per item it may return.
+	MaxComplexity int
+
+	types map[string]namedType
+}
+
+// NewSchema creates a schema rooted at query, checking that type names are unique
+func NewSchema(query *Object) (*Schema, error) {
+	s := &Schema{Query: query, types: map[string]namedType{}}
+	for _, scalar := range []*Scalar{Int, Float, String, Boolean, ID} {
+		s.types[scalar.Name] = scalar
+	}
+	if err := s.addType(query); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schema) addType(t Type) error {
+	switch t := t.(type) {
+	case *List:
+		return s.addType(t.Of)
+	case *NonNull:
+		return s.addType(t.Of)
+	case namedType:
+		if existing, ok := s.types[t.typeName()]; ok {
+			if existing != t {
+				return fmt.Errorf("graphql: two types are named %s", t.typeName())
+			}
+			return nil
+		}
+		s.types[t.typeName()] = t
+		if o, ok := t.(*Object); ok {
+			for _, f := range o.Fields {
+				if err := s.addType(f.Type); err != nil {
+					return err
+				}
+				for _, arg := range f.Args {
+					if _, isObject := namedOf(arg.Type).(*Object); isObject {
+						return fmt.Errorf("graphql: argument %s of %s.%s is an object, not an input type", arg.Name, o.Name, f.Name)
+					}
+					if err := s.addType(arg.Type); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("graphql: unsupported type %v", t)
+}
+
+// Type returns the named type of the schema
+func (s *Schema) Type(name string) Type {
+	if t, ok := s.types[name]; ok {
+		return t
+	}
+	return nil
+}
+
+// SDL describes the schema in the GraphQL schema definition language
+func (s *Schema) SDL() string {
+	names := make([]string, 0, len(s.types))
+	for name := range s.types {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		// the query root first, then the other types by name
+		if (names[i] == s.Query.Name) != (names[j] == s.Query.Name) {
+			return names[i] == s.Query.Name
+		}
+		return names[i] < names[j]
+	})
+
+	var b strings.Builder
+	b.WriteString("schema {\n  query: " + s.Query.Name + "\n}\n")
+	for _, name := range names {
+		switch t := s.types[name].(type) {
+		case *Scalar:
+			if t == Int || t == Float || t == String || t == Boolean || t == ID {
+				continue
+			}
+			b.WriteString("\n")
+			writeDescription(&b, "", t.Description)
+			b.WriteString("scalar " + t.Name + "\n")
+		case *Enum:
+			b.WriteString("\n")
+			writeDescription(&b, "", t.Description)
+			b.WriteString("enum " + t.Name + " {\n")
+			for _, value := range t.Values {
+				b.WriteString("  " + value + "\n")
+			}
+			b.WriteString("}\n")
+		case *Object:
+			b.WriteString("\n")
+			writeDescription(&b, "", t.Description)
+			b.WriteString("type " + t.Name + " {\n")
+			for _, f := range t.Fields {
+				writeDescription(&b, "  ", f.Description)
+				b.WriteString("  " + f.Name)
+				if len(f.Args) > 0 {
+					described := false
+					args := make([]string, len(f.Args))
+					for i, arg := range f.Args {
+						args[i] = arg.Name + ": " + arg.Type.String()
+						if arg.Default != nil {
+							args[i] += " = " + literal(arg.Default)
+						}
+						if arg.Description != "" {
+							args[i] = strconv.Quote(arg.Description) + " " + args[i]
+							described = true
+						}
+					}
+					if described {
+						// one argument per line, after its description
+						b.WriteString("(\n    " + strings.Join(args, "\n    ") + "\n  )")
+					} else {
+						b.WriteString("(" + strings.Join(args, ", ") + ")")
+					}
+				}
+				b.WriteString(": " + f.Type.String() + "\n")
+			}
+			b.WriteString("}\n")
+		}
+	}
+	return b.String()
+}
+
+func writeDescription(b *strings.Builder, indent, description string) {
+	if description != "" {
+		b.WriteString(indent + strconv.Quote(description) + "\n")
+	}
+}
+
+// literal writes a default argument value as a GraphQL literal
+func literal(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case EnumValue:
+		return string(v)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = literal(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+// namedOf strips the list and non-null wrappers of a type
+func namedOf(t Type) Type {
+	for {
+		switch wrapped := t.(type) {
+		case *List:
+			t = wrapped.Of
+		case *NonNull:
+			t = wrapped.Of
+		default:
+			return t
+		}
+	}
+}
+
+// Built-in scalars
+var (
+	Int = &Scalar{
+		Name:       "Int",
+		Serialize:  serializeInt,
+		ParseValue: serializeInt,
+	}
+	Float = &Scalar{
+		Name:       "Float",
+		Serialize:  serializeFloat,
+		ParseValue: serializeFloat,
+	}
+	String = &Scalar{
+		Name:      "String",
+		Serialize: serializeString,
+		ParseValue: func(value interface{}) (interface{}, error) {
+			if s, ok := value.(string); ok {
+				return s, nil
+			}
+			return nil, fmt.Errorf("expected a string, got %v", value)
+		},
+	}
+	Boolean = &Scalar{
+		Name: "Boolean",
+		Serialize: func(value interface{}) (interface{}, error) {
+			if v := reflect.ValueOf(value); v.Kind() == reflect.Bool {
+				return v.Bool(), nil
+			}
+			return nil, fmt.Errorf("cannot represent %v as a Boolean", value)
+		},
+		ParseValue: func(value interface{}) (interface{}, error) {
+			if b, ok := value.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("expected a boolean, got %v", value)
+		},
+	}
+	// ID serializes as a string and accepts strings and integers
+	ID = &Scalar{
+		Name:      "ID",
+		Serialize: serializeString,
+		ParseValue: func(value interface{}) (interface{}, error) {
+			if s, ok := value.(string); ok {
+				return s, nil
+			}
+			if n, err := serializeInt(value); err == nil {
+				return strconv.Itoa(n.(int)), nil
+			}
+			return nil, fmt.Errorf("expected an ID, got %v", value)
+		},
+	}
+	// Time is an RFC 3339 timestamp. Arguments take RFC 3339 timestamps.
+	Time = &Scalar{
+		Name:        "Time",
+		Description: "An RFC 3339 timestamp",
+		Serialize: func(value interface{}) (interface{}, error) {
+			if t, ok := value.(time.Time); ok {
+				return t.Format(time.RFC3339Nano), nil
+			}
+			return nil, fmt.Errorf("cannot represent %v as a Time", value)
+		},
+		ParseValue: func(value interface{}) (interface{}, error) {
+			if s, ok := value.(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					return t, nil
+				}
+			}
+			return nil, fmt.Errorf("expected an RFC 3339 timestamp, got %v", value)
+		},
+	}
+)
+
+// serializeInt accepts Go integers, and floats without a fraction as JSON numbers are
+func serializeInt(value interface{}) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	var n int64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt32 {
+			return nil, fmt.Errorf("%v is out of the range of Int", value)
+		}
+		n = int64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		if v.Float() != math.Trunc(v.Float()) {
+			return nil, fmt.Errorf("cannot represent %v as an Int", value)
+		}
+		if v.Float() < math.MinInt32 || v.Float() > math.MaxInt32 {
+			return nil, fmt.Errorf("%v is out of the range of Int", value)
+		}
+		n = int64(v.Float())
+	default:
+		return nil, fmt.Errorf("cannot represent %v as an Int", value)
+	}
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return nil, fmt.Errorf("%v is out of the range of Int", value)
+	}
+	return int(n), nil
+}
+
+func serializeFloat(value interface{}) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	return nil, fmt.Errorf("cannot represent %v as a Float", value)
+}
+
+// serializeString accepts strings, string types such as model enums, numbers and Stringers
+func serializeString(value interface{}) (interface{}, error) {
+	if s, ok := value.(fmt.Stringer); ok {
+		return s.String(), nil
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	}
+	return nil, fmt.Errorf("cannot represent %v as a String", value)
+}
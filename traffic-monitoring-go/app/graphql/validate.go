@@ -0,0 +1,328 @@
+package graphql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// validator checks an operation against the schema before it runs
+type validator struct {
+	schema *Schema
+	doc    *Document
+	op     *Operation
+	errors []*Error
+
+	// the fragments being expanded, to find cycles
+	expanding map[string]bool
+}
+
+func (v *validator) errorf(loc Location, format string, args ...interface{}) {
+	v.errors = append(v.errors, &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{loc}})
+}
+
+// validate checks that the operation only selects fields of the schema with
+// the arguments they take, that its fragments and variables are defined, and
+// that it nests no deeper than MaxDepth and resolves no more than MaxComplexity fields
+func (s *Schema) validate(doc *Document, op *Operation) []*Error {
+	v := &validator{schema: s, doc: doc, op: op, expanding: map[string]bool{}}
+
+	defined := map[string]bool{}
+	for _, def := range op.Variables {
+		if defined[def.Name] {
+			v.errorf(def.Loc, "variable $%s is defined twice", def.Name)
+		}
+		defined[def.Name] = true
+	}
+
+	v.directives(op.Directives)
+	complexity := v.selectionSet(s.Query, op.SelectionSet, 1)
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	if s.MaxComplexity > 0 && complexity > s.MaxComplexity {
+		v.errorf(op.Loc, "the query may resolve %d fields, more than %d", complexity, s.MaxComplexity)
+		return v.errors
+	}
+
+	// the variables the operation uses, through its fragments too
+	used := map[string]bool{}
+	v.variables(op.SelectionSet, used, map[string]bool{})
+	var undefined []string
+	for name := range used {
+		if !defined[name] {
+			undefined = append(undefined, name)
+		}
+	}
+	sort.Strings(undefined)
+	for _, name := range undefined {
+		v.errorf(op.Loc, "variable $%s is not defined by the operation", name)
+	}
+	return v.errors
+}
+
+// selectionSet checks selections made on obj and returns their complexity
+func (v *validator) selectionSet(obj *Object, selections []Selection, depth int) int {
+	responseFields := map[string]*Field{}
+	return v.selections(obj, selections, depth, responseFields)
+}
+
+// selections checks selections made on obj and returns their complexity;
+// responseFields holds the field each response key was first given to, since
+// fields merged under one key must agree
+func (v *validator) selections(obj *Object, selections []Selection, depth int, responseFields map[string]*Field) int {
+	complexity := 0
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *Field:
+			v.directives(selection.Directives)
+			complexity += v.field(obj, selection, depth)
+			key := selection.ResponseKey()
+			if previous, ok := responseFields[key]; ok {
+				if previous.Name != selection.Name || argumentsKey(previous.Arguments) != argumentsKey(selection.Arguments) {
+					v.errorf(selection.Loc, "fields selected as %s differ; use aliases to select both", key)
+				}
+			} else {
+				responseFields[key] = selection
+			}
+
+		case *InlineFragment:
+			v.directives(selection.Directives)
+			if selection.TypeCondition != "" && !v.spreadable(obj, selection.TypeCondition, selection.Loc) {
+				continue
+			}
+			complexity += v.selections(obj, selection.SelectionSet, depth, responseFields)
+
+		case *FragmentSpread:
+			v.directives(selection.Directives)
+			fragment, ok := v.doc.Fragments[selection.Name]
+			if !ok {
+				v.errorf(selection.Loc, "unknown fragment %s", selection.Name)
+				continue
+			}
+			if v.expanding[fragment.Name] {
+				v.errorf(selection.Loc, "fragment %s spreads itself", fragment.Name)
+				continue
+			}
+			if !v.spreadable(obj, fragment.TypeCondition, selection.Loc) {
+				continue
+			}
+			// a fragment is checked where it is spread, as depth depends on the place
+			v.expanding[fragment.Name] = true
+			v.directives(fragment.Directives)
+			complexity += v.selections(obj, fragment.SelectionSet, depth, responseFields)
+			delete(v.expanding, fragment.Name)
+		}
+	}
+	return complexity
+}
+
+// spreadable reports whether a fragment on typeName applies to obj; without
+// interfaces and unions, only fragments on the object's own type do
+func (v *validator) spreadable(obj *Object, typeName string, loc Location) bool {
+	t, ok := v.schema.types[typeName]
+	if !ok {
+		v.errorf(loc, "unknown type %s", typeName)
+		return false
+	}
+	if t != obj {
+		v.errorf(loc, "a fragment on %s cannot be spread within %s", typeName, obj.Name)
+		return false
+	}
+	return true
+}
+
+// field checks a field selected on obj and returns its complexity: 1, and
+// its subfields once per item it may return
+func (v *validator) field(obj *Object, field *Field, depth int) int {
+	if v.schema.MaxDepth > 0 && depth > v.schema.MaxDepth {
+		v.errorf(field.Loc, "the query nests deeper than %d fields", v.schema.MaxDepth)
+		return 1
+	}
+	if field.Name == "__typename" {
+		if len(field.Arguments) > 0 || field.SelectionSet != nil {
+			v.errorf(field.Loc, "__typename takes no arguments or selections")
+		}
+		return 1
+	}
+
+	def := obj.FieldDef(field.Name)
+	if def == nil {
+		v.errorf(field.Loc, "cannot query field %s on type %s", field.Name, obj.Name)
+		return 1
+	}
+	v.arguments(def.Args, field.Arguments, fmt.Sprintf("field %s.%s", obj.Name, def.Name), field.Loc)
+
+	if child, isObject := namedOf(def.Type).(*Object); isObject {
+		if field.SelectionSet == nil {
+			v.errorf(field.Loc, "field %s of type %s must have a selection of subfields", field.Name, def.Type)
+			return 1
+		}
+		return 1 + v.size(def, field)*v.selectionSet(child, field.SelectionSet, depth+1)
+	} else if field.SelectionSet != nil {
+		v.errorf(field.Loc, "field %s of type %s has no subfields", field.Name, def.Type)
+	}
+	return 1
+}
+
+// size returns the items a field may return as its SizeArg bounds them: the
+// value given, the default of a variable given, or the argument's default.
+// Fields without a SizeArg, and values not known before the query runs, count as 1.
+func (v *validator) size(def *FieldDef, field *Field) int {
+	if def.SizeArg == "" {
+		return 1
+	}
+	var value interface{}
+	for _, arg := range def.Args {
+		if arg.Name == def.SizeArg {
+			value = arg.Default
+		}
+	}
+	for _, arg := range field.Arguments {
+		if arg.Name != def.SizeArg {
+			continue
+		}
+		value = arg.Value
+		if name, isVar := arg.Value.(Variable); isVar {
+			for _, variable := range v.op.Variables {
+				if variable.Name == string(name) && variable.Default != nil {
+					value = variable.Default
+				}
+			}
+		}
+	}
+
+	switch n := value.(type) {
+	case int64:
+		if n > 1 {
+			return int(n)
+		}
+	case int:
+		if n > 1 {
+			return n
+		}
+	}
+	return 1
+}
+
+// arguments checks given arguments are defined and required ones given; their
+// values are checked when the operation runs, once variables are known
+func (v *validator) arguments(defs []*Arg, given []*Argument, of string, loc Location) {
+	for _, arg := range given {
+		known := false
+		for _, def := range defs {
+			if def.Name == arg.Name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			v.errorf(arg.Loc, "unknown argument %s of %s", arg.Name, of)
+		}
+	}
+	for _, def := range defs {
+		if _, nonNull := def.Type.(*NonNull); !nonNull || def.Default != nil {
+			continue
+		}
+		found := false
+		for _, arg := range given {
+			if arg.Name == def.Name && arg.Value != nil {
+				found = true
+			}
+		}
+		if !found {
+			v.errorf(loc, "argument %s of type %s of %s is required", def.Name, def.Type, of)
+		}
+	}
+}
+
+func (v *validator) directives(directives []*Directive) {
+	for _, directive := range directives {
+		switch directive.Name {
+		case "skip", "include":
+			v.arguments(conditionArgs, directive.Arguments, "@"+directive.Name, directive.Loc)
+		default:
+			v.errorf(directive.Loc, "unknown directive @%s", directive.Name)
+		}
+	}
+}
+
+// variables gathers the variables referred to by selections
+func (v *validator) variables(selections []Selection, used map[string]bool, fragments map[string]bool) {
+	var values func(value Value)
+	values = func(value Value) {
+		switch value := value.(type) {
+		case Variable:
+			used[string(value)] = true
+		case []Value:
+			for _, item := range value {
+				values(item)
+			}
+		case []*ObjectField:
+			for _, field := range value {
+				values(field.Value)
+			}
+		}
+	}
+	directives := func(directives []*Directive) {
+		for _, directive := range directives {
+			for _, arg := range directive.Arguments {
+				values(arg.Value)
+			}
+		}
+	}
+
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *Field:
+			for _, arg := range selection.Arguments {
+				values(arg.Value)
+			}
+			directives(selection.Directives)
+			v.variables(selection.SelectionSet, used, fragments)
+		case *InlineFragment:
+			directives(selection.Directives)
+			v.variables(selection.SelectionSet, used, fragments)
+		case *FragmentSpread:
+			directives(selection.Directives)
+			if fragment, ok := v.doc.Fragments[selection.Name]; ok && !fragments[selection.Name] {
+				fragments[selection.Name] = true
+				directives(fragment.Directives)
+				v.variables(fragment.SelectionSet, used, fragments)
+			}
+		}
+	}
+}
+
+// argumentsKey writes arguments in a canonical form, to compare the arguments of merged fields
+func argumentsKey(args []*Argument) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.Name + ":" + valueKey(arg.Value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func valueKey(value Value) string {
+	switch value := value.(type) {
+	case Variable:
+		return "$" + string(value)
+	case string:
+		return fmt.Sprintf("%q", value)
+	case []Value:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = valueKey(item)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case []*ObjectField:
+		fields := make([]string, len(value))
+		for i, field := range value {
+			fields[i] = field.Name + ":" + valueKey(field.Value)
+		}
+		sort.Strings(fields)
+		return "{" + strings.Join(fields, ",") + "}"
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,231 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTenantKey is the context key of the tenant a test request acts for
+type testTenantKey struct{}
+
+// testItem is a row of the test schema, owned by a tenant
+type testItem struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Tenant   string `json:"tenant"`
+	Severity string `json:"severity"`
+}
+
+var testItems = []testItem{
+	{ID: 1, Name: "first", Tenant: "north", Severity: "high"},
+	{ID: 2, Name: "second", Tenant: "south", Severity: "low"},
+	{ID: 3, Name: "third", Tenant: "north", Severity: "low"},
+}
+
+// visibleItems returns the items of the tenant ctx acts for, all of them
+// when it acts for none
+func visibleItems(ctx context.Context) []testItem {
+	tenant, _ := ctx.Value(testTenantKey{}).(string)
+	var items []testItem
+	for _, item := range testItems {
+		if tenant == "" || item.Tenant == tenant {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newTestSchema builds a schema of items with children, bounded like the
+// SIEM's: lists by page_size and limit arguments
+func newTestSchema(t *testing.T, maxDepth, maxComplexity int) *Schema {
+	severity := &Enum{Name: "Severity", Values: []string{"high", "low"}}
+	item := &Object{Name: "Item"}
+	item.Fields = []*FieldDef{
+		{Name: "id", Type: &NonNull{Of: ID}},
+		{Name: "name", Type: String},
+		{Name: "severity", Type: severity},
+		{Name: "children", Type: &NonNull{Of: &List{Of: &NonNull{Of: item}}},
+			Args:    []*Arg{{Name: "limit", Type: Int, Default: 5}},
+			SizeArg: "limit",
+			Resolve: func(p ResolveParams) (interface{}, error) {
+				return visibleItems(p.Context)[:1], nil
+			}},
+		{Name: "broken", Type: String, Resolve: func(p ResolveParams) (interface{}, error) {
+			return nil, errors.New("cannot load broken")
+		}},
+		{Name: "required", Type: &NonNull{Of: String}, Resolve: func(p ResolveParams) (interface{}, error) {
+			return nil, nil
+		}},
+		{Name: "panics", Type: String, Resolve: func(p ResolveParams) (interface{}, error) {
+			panic("resolver bug")
+		}},
+	}
+	query := &Object{Name: "Query", Fields: []*FieldDef{
+		{Name: "items", Type: &NonNull{Of: &List{Of: &NonNull{Of: item}}},
+			Args: []*Arg{
+				{Name: "page_size", Type: Int, Default: 10},
+				{Name: "severity", Type: severity},
+			},
+			SizeArg: "page_size",
+			Resolve: func(p ResolveParams) (interface{}, error) {
+				items := []testItem{}
+				for _, item := range visibleItems(p.Context) {
+					if severity, ok := p.Args["severity"]; !ok || severity == item.Severity {
+						items = append(items, item)
+					}
+				}
+				if size := p.Args["page_size"].(int); len(items) > size {
+					items = items[:size]
+				}
+				return items, nil
+			}},
+		{Name: "item", Type: item, Args: []*Arg{{Name: "id", Type: &NonNull{Of: ID}}},
+			Resolve: func(p ResolveParams) (interface{}, error) {
+				for _, item := range visibleItems(p.Context) {
+					if fmt.Sprint(item.ID) == p.Args["id"] {
+						return item, nil
+					}
+				}
+				return nil, nil
+			}},
+		{Name: "at", Type: Time, Args: []*Arg{{Name: "t", Type: &NonNull{Of: Time}}},
+			Resolve: func(p ResolveParams) (interface{}, error) {
+				return p.Args["t"], nil
+			}},
+	}}
+
+	schema, err := NewSchema(query)
+	require.NoError(t, err)
+	schema.MaxDepth = maxDepth
+	schema.MaxComplexity = maxComplexity
+	return schema
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		messages []string
+	}{
+		{"valid", `query ($s: Int) { items(page_size: $s) { id name children { id } } }`, nil},
+		{"valid fragments", `{ items { ...f ... on Item { name } } } fragment f on Item { id }`, nil},
+		{"unknown field", `{ items { id color } }`, []string{"cannot query field color on type Item"}},
+		{"unknown root field", `{ vehicles { id } }`, []string{"cannot query field vehicles on type Query"}},
+		{"missing subfields", `{ items }`, []string{"field items of type [Item!]! must have a selection of subfields"}},
+		{"subfields of a scalar", `{ items { name { first } } }`, []string{"field name of type String has no subfields"}},
+		{"unknown argument", `{ items(color: "red") { id } }`, []string{"unknown argument color of field Query.items"}},
+		{"missing required argument", `{ item { id } }`, []string{"argument id of type ID! of field Query.item is required"}},
+		{"null required argument", `{ item(id: null) { id } }`, []string{"argument id of type ID! of field Query.item is required"}},
+		{"unknown directive", `{ items @cached { id } }`, []string{"unknown directive @cached"}},
+		{"directive without its argument", `{ items @skip { id } }`, []string{"argument if of type Boolean! of @skip is required"}},
+		{"unknown fragment", `{ items { ...missing } }`, []string{"unknown fragment missing"}},
+		{"fragment on an unknown type", `{ items { ... on Vehicle { id } } }`, []string{"unknown type Vehicle"}},
+		{"fragment on another type", `{ ... on Item { id } }`, []string{"a fragment on Item cannot be spread within Query"}},
+		{"fragment spreading itself", `{ items { ...f } } fragment f on Item { children { ...f } }`, []string{"fragment f spreads itself"}},
+		{"conflicting response keys", `{ items { id: name id } }`, []string{"fields selected as id differ; use aliases to select both"}},
+		{"conflicting arguments", `{ a: items(page_size: 1) { id } a: items(page_size: 2) { id } }`, []string{"fields selected as a differ; use aliases to select both"}},
+		{"__typename with selections", `{ __typename { id } }`, []string{"__typename takes no arguments or selections"}},
+		{"undefined variable", `{ items(page_size: $size) { id } }`, []string{"variable $size is not defined by the operation"}},
+		{"undefined variable in a fragment", `query { items { ...f } } fragment f on Item { children(limit: $n) { id } }`, []string{"variable $n is not defined by the operation"}},
+		{"variable defined twice", `query ($a: Int, $a: Int) { items { id } }`, []string{"variable $a is defined twice"}},
+		{"every error is reported", `{ items { color } item { id } }`, []string{
+			"cannot query field color on type Item",
+			"argument id of type ID! of field Query.item is required",
+		}},
+	}
+
+	schema := newTestSchema(t, 0, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.query)
+			require.NoError(t, err)
+			errs := schema.validate(doc, doc.Operations[0])
+
+			messages := make([]string, len(errs))
+			for i, err := range errs {
+				messages[i] = err.Message
+				assert.NotEmpty(t, err.Locations, "error %q has no location", err.Message)
+			}
+			if tt.messages == nil {
+				assert.Empty(t, messages)
+			} else {
+				assert.Equal(t, tt.messages, messages)
+			}
+		})
+	}
+}
+
+func TestValidateDepth(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxDepth int
+		query    string
+		message  string
+	}{
+		{"at the limit", 3, `{ items { children { id } } }`, ""},
+		{"below the limit", 3, `{ items { id } }`, ""},
+		{"over the limit", 3, `{ items { children { children { id } } } }`, "the query nests deeper than 3 fields"},
+		{"over the limit through a fragment", 2, `{ items { ...f } } fragment f on Item { children { id } }`, "the query nests deeper than 2 fields"},
+		{"over the limit through an inline fragment", 2, `{ items { ... on Item { children { name } } } }`, "the query nests deeper than 2 fields"},
+		{"no limit", 0, `{ items { children { children { children { children { id } } } } } }`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := newTestSchema(t, tt.maxDepth, 0)
+			resp := schema.Execute(context.Background(), Request{Query: tt.query})
+			if tt.message == "" {
+				assert.Empty(t, resp.Errors)
+				assert.True(t, resp.Executed())
+				return
+			}
+			require.Len(t, resp.Errors, 1)
+			assert.Equal(t, tt.message, resp.Errors[0].Message)
+			assert.False(t, resp.Executed())
+		})
+	}
+}
+
+func TestValidateComplexity(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxComplexity int
+		query         string
+		variables     map[string]interface{}
+		complexity    int // reported when over the limit, 0 when within it
+	}{
+		// items(page_size: 10 by default) × (id + name) + items
+		{"default page size", 100, `{ items { id name } }`, nil, 0},
+		{"default page size over the limit", 20, `{ items { id name } }`, nil, 21},
+		{"page size given", 20, `{ items(page_size: 2) { id name } }`, nil, 0},
+		// items 50 × (id + children 5 × (id + name) + 1) + 1
+		{"nested lists multiply", 500, `{ items(page_size: 50) { id children { id name } } }`, nil, 601},
+		{"nested list limit given", 500, `{ items(page_size: 50) { id children(limit: 1) { id name } } }`, nil, 0},
+		// a variable's default counts; a value given only when the query runs does not
+		{"variable default", 100, `query ($n: Int = 200) { items(page_size: $n) { id } }`, map[string]interface{}{"n": 1}, 201},
+		{"variable without default", 100, `query ($n: Int) { items(page_size: $n) { id } }`, map[string]interface{}{"n": 200}, 0},
+		{"fragments count", 20, `{ items { ...f } } fragment f on Item { id name }`, nil, 21},
+		{"aliases count separately", 30, `{ a: items { id name } b: items { id name } }`, nil, 42},
+		{"no limit", 0, `{ items(page_size: 1000) { children(limit: 1000) { id } } }`, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := newTestSchema(t, 0, tt.maxComplexity)
+			resp := schema.Execute(context.Background(), Request{Query: tt.query, Variables: tt.variables})
+			if tt.complexity == 0 {
+				assert.Empty(t, resp.Errors)
+				assert.True(t, resp.Executed())
+				return
+			}
+			require.Len(t, resp.Errors, 1)
+			assert.Equal(t, fmt.Sprintf("the query may resolve %d fields, more than %d", tt.complexity, tt.maxComplexity), resp.Errors[0].Message)
+			assert.False(t, resp.Executed())
+		})
+	}
+}
@@ -2,12 +2,15 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
 	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
 	"traffic-monitoring-go/app/siem/elasticsearch"
 	"traffic-monitoring-go/app/siem/notifications"
 )
@@ -17,65 +20,55 @@ type AlertHandler struct {
 	DB 					*gorm.DB
 	NotificationManager	*notifications.NotificationManager
 	ESService			*elasticsearch.Service
+	OEMNotifier			*siem.OEMNotifier
+	Reviews				*siem.AlertReviewPolicy
 }
 
 
 // NewAlertHandler creates a new AlertHandler
 func NewAlertHandler(db *gorm.DB, esService *elasticsearch.Service) *AlertHandler {
-	// create a notification manager
-	manager := notifications.NewNotificationManager(db)
-
-	// register default notification channels
-	// for demonstration, using placeholder config values
-	emailChannel := notifications.NewEmailChannel(notifications.EmailConfig{
-		BaseNotificationConfig: notifications.BaseNotificationConfig{
-			Enabled: false, // disabled by default since it needs a real SMTP config
-			Name:	"default-email",
-		},
-		SMTPServer:		"smtp.example.com",
-		SMTPPort:		587,
-		Username:		"username",
-		Password:		"password",
-		FromAddress:	"siem@example.com",
-		ToAddresses:	[]string{"alerts@example.com"},
-	})
-
-	webhookChannel := notifications.NewWebhookChannel(notifications.WebhookConfig{
-		BaseNotificationConfig:	notifications.BaseNotificationConfig{
-			Enabled: false,
-			Name:	 "default-webhook",
-		},
-		URL:	"https://example.com/webhook",
-		Method:	"POST",
-	})
-
-	manager.RegisterChannel(emailChannel)
-	manager.RegisterChannel(webhookChannel)
-
+	manager := notifications.NewDefaultNotificationManager(db)
 
 	return &AlertHandler{
 		DB:		 				db,
 		NotificationManager:	manager,
 		ESService: 				esService,
+		OEMNotifier:			siem.NewOEMNotifier(db),
+		Reviews:				siem.NewAlertReviewPolicy(db),
 	}
 }
 
 
+// alertList is how GET /alerts may be sorted and projected
+var alertList = listSpec{
+	Model: models.Alert{},
+	Sortable: map[string]string{
+		"id":         "id",
+		"timestamp":  "timestamp",
+		"severity":   "severity",
+		"status":     "status",
+		"rule_id":    "rule_id",
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	},
+	DefaultSort: "timestamp:desc",
+}
+
 //GetAlerts handles GET /alerts
+// Takes the list parameters page, pageSize, sort and fields. Callers acting
+// for an organization only see its alerts.
 func (h *AlertHandler) GetAlerts(c *gin.Context) {
-	var alerts []models.Alert
-
-	// Basic pagination
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("pagesize", "50"))
-	offset := (page - 1) * pageSize
+	list, ok := parseListQuery(c, alertList)
+	if !ok {
+		return
+	}
 
 	// Basic filtering by severity and status
 	severity := c.Query("severity")
 	status := c.Query("status")
 
-	// Create a query builder
-	query := h.DB.Model(&models.Alert{}).Preload("Rule")
+	// Create a query builder on a read replica when one is available
+	query := database.ReadDB(h.DB).Model(&models.Alert{}).Preload("Rule").Scopes(tenantScope(c, "alerts.organization_id"))
 
 	if severity != "" {
 		query = query.Where("severity = ?", severity)
@@ -85,28 +78,36 @@ func (h *AlertHandler) GetAlerts(c *gin.Context) {
 		query = query.Where("status = ?", status)
 	}
 
-	// order by timestamp descending (most recent first)
-	query = query.Order("timestamp DESC")
+	// alerts of rules tagged with an ATT&CK technique or one of its sub-techniques
+	if technique := c.Query("technique"); technique != "" {
+		query = siem.FilterByTechnique(query, "alerts", technique)
+	}
+
+	// alerts of rules tagged with a V2X threat
+	if threat := c.Query("threat"); threat != "" {
+		query = siem.FilterByThreat(query, "alerts", threat)
+	}
+
+	// alerts raised by catch-up evaluation after downtime
+	if lateEvaluated := c.Query("late_evaluated"); lateEvaluated != "" {
+		query = query.Where("late_evaluated = ?", lateEvaluated == "true")
+	}
 
 	// Count total for pagination info
 	var total int64
-	query.Count(&total)
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	//Execute the query with pagination
-	if err:= query.Offset(offset).Limit(pageSize).Find(&alerts).Error; err != nil {
+	var alerts []models.Alert
+	if err:= list.paginate(query).Find(&alerts).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data": alerts,
-		"pagination": gin.H{
-			"page": page,
-			"pageSize": pageSize,
-			"total": total,
-			"pages": (total + int64(pageSize) - 1) / int64(pageSize),
-		},
-	})
+	respondList(c, alerts, total, list)
 }
 
 
@@ -119,7 +120,7 @@ func (h *AlertHandler) GetAlert(c *gin.Context) {
 	}
 
 	var alert models.Alert
-	if err := h.DB.Preload("Rule").Preload("SecurityEvent").First(&alert, id).Error; err != nil {
+	if err := h.DB.Preload("Rule").Preload("SecurityEvent").Scopes(tenantScope(c, "organization_id")).First(&alert, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
 		return
 	}
@@ -138,7 +139,7 @@ func (h *AlertHandler) UpdateAlert(c *gin.Context) {
 	}
 
 	var alert models.Alert
-	if err := h.DB.First(&alert, id).Error; err != nil {
+	if err := h.DB.Scopes(tenantScope(c, "organization_id")).First(&alert, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
 		return
 	}
@@ -155,6 +156,21 @@ func (h *AlertHandler) UpdateAlert(c *gin.Context) {
 		return
 	}
 
+	// status changes of alerts under four-eyes review apply once a second analyst agrees
+	var review *models.AlertReview
+	if updateData.Status != nil && h.Reviews.Requires(&alert, *updateData.Status) {
+		resolution := ""
+		if updateData.Resolution != nil {
+			resolution = *updateData.Resolution
+		}
+		review, _, err = h.Reviews.Request(&alert, *updateData.Status, resolution, currentReviewer(c))
+		if err != nil {
+			respondReviewError(c, err, review)
+			return
+		}
+		updateData.Status, updateData.Resolution = nil, nil
+	}
+
 	// Apply updates that were provided
 	if updateData.Status != nil {
 		alert.Status = *updateData.Status
@@ -166,25 +182,49 @@ func (h *AlertHandler) UpdateAlert(c *gin.Context) {
 		alert.Resolution = *updateData.Resolution
 	}
 
-	if err := h.DB.Save(&alert).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if review == nil || updateData.AssignedTo != nil {
+		if err := h.DB.Save(&alert).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if review != nil && review.State == models.AlertReviewPending {
+		c.JSON(http.StatusAccepted, gin.H{
+			"alert":   alert,
+			"review":  review,
+			"message": "Status change recorded; it applies once a second analyst approves it",
+		})
 		return
 	}
 
-	//Update in elastisearch if available
-	if h.ESService != nil {
-		if err := h.ESService.IndexAlert(&alert); err != nil {
-			// log error but dont fail the request
-			c.JSON(http.StatusOK, gin.H{
-				"alert": alert,
-				"warning": "Alert updated in database but could not be indexed in Elasticsearch: " + err.Error(),
-			})
-			return
+	if warning := h.publishAlertUpdate(&alert); warning != "" {
+		// log error but dont fail the request
+		c.JSON(http.StatusOK, gin.H{"alert": alert, "warning": warning})
+		return
 	}
+
+	c.JSON(http.StatusOK, alert)
 }
 
+// publishAlertUpdate notifies fleet operators of a confirmed compromise and
+// reindexes the alert, returning a warning when it could not be indexed
+func (h *AlertHandler) publishAlertUpdate(alert *models.Alert) string {
+	// tell the fleet operator of the vehicle about a confirmed compromise; operators
+	// already notified are skipped, so confirming again retries a failed queueing
+	if alert.Status == models.AlertStatusConfirmedMalicious {
+		if _, err := h.OEMNotifier.Notify(alert); err != nil {
+			log.Printf("Error queueing OEM notifications for alert %d: %v", alert.ID, err)
+		}
+	}
 
-	c.JSON(http.StatusOK, alert)
+	//Update in elastisearch if available
+	if h.ESService != nil {
+		if err := h.ESService.IndexAlert(alert); err != nil {
+			return "Alert updated in database but could not be indexed in Elasticsearch: " + err.Error()
+		}
+	}
+	return ""
 }
 
 
@@ -200,7 +240,7 @@ func (h *AlertHandler) SendNotification(c *gin.Context) {
 
 	// check if the alert exists
 	var alert models.Alert
-	if err := h.DB.First(&alert, id).Error; err != nil {
+	if err := h.DB.Scopes(tenantScope(c, "organization_id")).First(&alert, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
 		return
 	}
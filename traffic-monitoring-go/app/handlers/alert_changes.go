@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// AlertChangeHandler exposes the alert change stream for pull-based consumers
+type AlertChangeHandler struct {
+	DB        *gorm.DB
+	Publisher *siem.AlertOutboxPublisher
+}
+
+// NewAlertChangeHandler creates a new AlertChangeHandler
+func NewAlertChangeHandler(db *gorm.DB) *AlertChangeHandler {
+	return &AlertChangeHandler{DB: db, Publisher: siem.NewAlertOutboxPublisher(db)}
+}
+
+// GetAlertChanges handles GET /alerts/changes?after=<change id>&limit=
+// Consumers resume from the last change ID they processed.
+func (h *AlertChangeHandler) GetAlertChanges(c *gin.Context) {
+	after, _ := strconv.Atoi(c.DefaultQuery("after", "0"))
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	var changes []models.AlertChange
+	if err := h.DB.Where("id > ?", after).Order("id ASC").Limit(limit).Find(&changes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	messages := make([]siem.AlertChangeMessage, 0, len(changes))
+	for i := range changes {
+		messages = append(messages, siem.NewAlertChangeMessage(&changes[i]))
+	}
+
+	next := after
+	if len(changes) > 0 {
+		next = int(changes[len(changes)-1].ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"changes": messages,
+		"next":    next,
+	})
+}
+
+// GetAlertChangeStatus handles GET /alerts/changes/status
+func (h *AlertChangeHandler) GetAlertChangeStatus(c *gin.Context) {
+	status, err := h.Publisher.Status()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// currentReviewer identifies the caller for four-eyes review; shared API
+// tokens have no user ID and are refused by the review policy
+func currentReviewer(c *gin.Context) siem.Reviewer {
+	claims := middleware.CurrentClaims(c)
+	if claims == nil {
+		return siem.Reviewer{}
+	}
+	return siem.Reviewer{ID: claims.UserID, Name: claims.Actor(), Role: claims.Role}
+}
+
+// respondReviewError answers a failed review step
+func respondReviewError(c *gin.Context, err error, pending *models.AlertReview) {
+	switch {
+	case errors.Is(err, siem.ErrReviewerIdentity), errors.Is(err, siem.ErrReviewerRole):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, siem.ErrReviewPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "review": pending})
+	case errors.Is(err, siem.ErrSameReviewer), errors.Is(err, siem.ErrNoPendingReview):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// findReviewAlert loads the alert named by the :id parameter, answering the request when it cannot
+func (h *AlertHandler) findReviewAlert(c *gin.Context) (*models.Alert, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		return nil, false
+	}
+
+	var alert models.Alert
+	if err := h.DB.First(&alert, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &alert, true
+}
+
+// alertReviewList is how GET /alerts/reviews may be sorted and projected
+var alertReviewList = listSpec{
+	Model: models.AlertReview{},
+	Sortable: map[string]string{
+		"id":           "id",
+		"alert_id":     "alert_id",
+		"state":        "state",
+		"requested_at": "requested_at",
+		"reviewed_at":  "reviewed_at",
+		"created_at":   "created_at",
+	},
+	DefaultSort: "requested_at:asc",
+}
+
+// GetReviewQueue handles GET /alerts/reviews
+// Lists status changes by state (default pending) with their alerts;
+// awaiting_me=true leaves out the caller's own requests
+func (h *AlertHandler) GetReviewQueue(c *gin.Context) {
+	list, ok := parseListQuery(c, alertReviewList)
+	if !ok {
+		return
+	}
+
+	state := c.DefaultQuery("state", string(models.AlertReviewPending))
+	query := database.ReadDB(h.DB).Model(&models.AlertReview{}).Preload("Alert.Rule").
+		Where("state = ?", state)
+	if c.Query("awaiting_me") == "true" {
+		query = query.Where("requested_by_id <> ?", currentReviewer(c).ID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var reviews []models.AlertReview
+	if err := list.paginate(query).Find(&reviews).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, reviews, total, list)
+}
+
+// GetAlertReviews handles GET /alerts/:id/reviews
+// Returns the review history of an alert, newest first
+func (h *AlertHandler) GetAlertReviews(c *gin.Context) {
+	alert, ok := h.findReviewAlert(c)
+	if !ok {
+		return
+	}
+
+	var reviews []models.AlertReview
+	if err := h.DB.Where("alert_id = ?", alert.ID).Order("requested_at DESC").Find(&reviews).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": reviews})
+}
+
+// reviewDecision is the body of the approve and reject endpoints
+type reviewDecision struct {
+	Comment string `json:"comment"`
+}
+
+// ApproveAlertReview handles POST /alerts/:id/reviews/approve
+// Applies the pending status change as the second analyst
+func (h *AlertHandler) ApproveAlertReview(c *gin.Context) {
+	alert, ok := h.findReviewAlert(c)
+	if !ok {
+		return
+	}
+	var decision reviewDecision
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&decision); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	review, err := h.Reviews.Approve(alert, currentReviewer(c), decision.Comment)
+	if err != nil {
+		respondReviewError(c, err, nil)
+		return
+	}
+
+	response := gin.H{"alert": alert, "review": review}
+	if warning := h.publishAlertUpdate(alert); warning != "" {
+		response["warning"] = warning
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RejectAlertReview handles POST /alerts/:id/reviews/reject
+// Discards the pending status change; the requesting analyst may withdraw their own
+func (h *AlertHandler) RejectAlertReview(c *gin.Context) {
+	alert, ok := h.findReviewAlert(c)
+	if !ok {
+		return
+	}
+	var decision reviewDecision
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&decision); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	review, err := h.Reviews.Reject(alert, currentReviewer(c), decision.Comment)
+	if err != nil {
+		respondReviewError(c, err, nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alert": alert, "review": review})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// AnomalyDetectorHandler handles V2X anomaly detector configuration endpoints
+type AnomalyDetectorHandler struct {
+	DB *gorm.DB
+}
+
+// NewAnomalyDetectorHandler creates a new AnomalyDetectorHandler
+func NewAnomalyDetectorHandler(db *gorm.DB) *AnomalyDetectorHandler {
+	return &AnomalyDetectorHandler{DB: db}
+}
+
+// anomalyDetectorView is a detector's settings with its evaluation counts on this instance
+type anomalyDetectorView struct {
+	siem.AnomalyDetectorSettings
+	Stats siem.AnomalyDetectorStats `json:"stats"`
+}
+
+// GetAnomalyDetectors handles GET /anomaly-detectors
+// Lists the registered detectors with their effective and default params, and
+// how often each was evaluated and found an anomaly since this instance started
+func (h *AnomalyDetectorHandler) GetAnomalyDetectors(c *gin.Context) {
+	settings, err := siem.GetAnomalyDetectorSettings(h.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	detectors := make([]anomalyDetectorView, 0, len(settings))
+	for _, s := range settings {
+		detectors = append(detectors, anomalyDetectorView{AnomalyDetectorSettings: s, Stats: siem.GetAnomalyDetectorStats(s.Detector)})
+	}
+	c.JSON(http.StatusOK, detectors)
+}
+
+// EnableAnomalyDetector handles POST /anomaly-detectors/:name/enable
+func (h *AnomalyDetectorHandler) EnableAnomalyDetector(c *gin.Context) {
+	h.setEnabled(c, true)
+}
+
+// DisableAnomalyDetector handles POST /anomaly-detectors/:name/disable
+// Switches a noisy detector off without touching its severity or params
+func (h *AnomalyDetectorHandler) DisableAnomalyDetector(c *gin.Context) {
+	h.setEnabled(c, false)
+}
+
+func (h *AnomalyDetectorHandler) setEnabled(c *gin.Context, enabled bool) {
+	if _, ok := siem.LookupAnomalyDetector(c.Param("name")); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Anomaly detector not found"})
+		return
+	}
+
+	updatedBy := ""
+	if claims := middleware.CurrentClaims(c); claims != nil {
+		updatedBy = claims.Actor()
+	}
+	config, err := siem.SetAnomalyDetectorEnabled(h.DB, c.Param("name"), enabled, updatedBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, config)
+}
+
+// UpdateAnomalyDetector handles PUT /anomaly-detectors/:name
+// Stores the detector's enabled flag, severity and param overrides; params
+// left out keep their defaults
+func (h *AnomalyDetectorHandler) UpdateAnomalyDetector(c *gin.Context) {
+	var config models.AnomalyDetectorConfig
+	err := h.DB.Where("detector = ?", c.Param("name")).First(&config).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		config = models.AnomalyDetectorConfig{Enabled: true}
+	}
+
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	config.Detector = c.Param("name")
+	if err := siem.ValidateAnomalyDetectorConfig(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(&config).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateAnomalyConfigs()
+
+	c.JSON(http.StatusOK, config)
+}
+
+// ResetAnomalyDetector handles DELETE /anomaly-detectors/:name
+// Drops the stored config so the detector runs with its defaults
+func (h *AnomalyDetectorHandler) ResetAnomalyDetector(c *gin.Context) {
+	if _, ok := siem.LookupAnomalyDetector(c.Param("name")); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Anomaly detector not found"})
+		return
+	}
+
+	if err := h.DB.Where("detector = ?", c.Param("name")).Delete(&models.AnomalyDetectorConfig{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateAnomalyConfigs()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Anomaly detector reset to its defaults"})
+}
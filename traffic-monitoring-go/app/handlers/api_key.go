@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/auth"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
+)
+
+// issuedAPIKey is an API key record together with the key itself, which is
+// only ever returned by the request creating it
+type issuedAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// apiKeyRequest is the body of POST /log-sources/:id/keys and PUT /log-sources/:id/keys/:keyId
+type apiKeyRequest struct {
+	Name           string  `json:"name"`
+	RateLimit      float64 `json:"rate_limit"`
+	Burst          int     `json:"burst"`
+	OrganizationID *uint   `json:"organization_id"`
+}
+
+// apply validates the request and copies it onto key, answering the request when it is invalid
+func (r *apiKeyRequest) apply(c *gin.Context, db *gorm.DB, key *models.APIKey) bool {
+	key.Name = r.Name
+	key.RateLimit = r.RateLimit
+	key.Burst = r.Burst
+	key.OrganizationID = r.OrganizationID
+	if err := key.Validate().Err(); err != nil {
+		respondValidation(c, err)
+		return false
+	}
+	return assignOrganization(c, db, &key.OrganizationID)
+}
+
+// GetAPIKeys handles GET /log-sources/:id/keys
+// Lists the source's keys, revoked ones included, without the keys themselves
+func (h *LogSourceHandler) GetAPIKeys(c *gin.Context) {
+	source, ok := h.findLogSource(c)
+	if !ok {
+		return
+	}
+
+	var keys []models.APIKey
+	if err := h.DB.Where("log_source_id = ?", source.ID).Order("id DESC").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey handles POST /log-sources/:id/keys
+// Issues a key the source sends in X-API-Key to ingest events; the response
+// is the only time the key is shown
+func (h *LogSourceHandler) CreateAPIKey(c *gin.Context) {
+	source, ok := h.findLogSource(c)
+	if !ok {
+		return
+	}
+
+	var request apiKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	key := models.APIKey{LogSourceID: source.ID, CreatedBy: middleware.CurrentClaims(c).Actor()}
+	if !request.apply(c, h.DB, &key) {
+		return
+	}
+
+	issued, err := issueAPIKey(h.DB, &key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auth.InvalidateAPIKeys()
+
+	c.JSON(http.StatusCreated, issued)
+}
+
+// UpdateAPIKey handles PUT /log-sources/:id/keys/:keyId
+// Changes the name, rate limit and organization of a key
+func (h *LogSourceHandler) UpdateAPIKey(c *gin.Context) {
+	key, ok := h.findAPIKey(c)
+	if !ok {
+		return
+	}
+
+	var request apiKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !request.apply(c, h.DB, key) {
+		return
+	}
+
+	if err := h.DB.Save(key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auth.InvalidateAPIKeys()
+
+	c.JSON(http.StatusOK, key)
+}
+
+// RotateAPIKey handles POST /log-sources/:id/keys/:keyId/rotate
+// Issues a key with the same settings in place of an active one. The old key
+// is revoked at once, or keeps working for grace_minutes so the source can
+// switch over without dropping events.
+func (h *LogSourceHandler) RotateAPIKey(c *gin.Context) {
+	old, ok := h.findAPIKey(c)
+	if !ok {
+		return
+	}
+	if !old.Active(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only active keys can be rotated"})
+		return
+	}
+
+	var request struct {
+		GraceMinutes int `json:"grace_minutes"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.GraceMinutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "grace_minutes cannot be negative"})
+		return
+	}
+
+	actor := middleware.CurrentClaims(c).Actor()
+	key := models.APIKey{
+		LogSourceID:    old.LogSourceID,
+		Name:           old.Name,
+		OrganizationID: old.OrganizationID,
+		RateLimit:      old.RateLimit,
+		Burst:          old.Burst,
+		CreatedBy:      actor,
+	}
+	var issued *issuedAPIKey
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if issued, err = issueAPIKey(tx, &key); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{"replaced_by_id": key.ID}
+		if request.GraceMinutes == 0 {
+			updates["revoked_at"] = now
+			updates["revoked_by"] = actor
+		} else {
+			updates["expires_at"] = now.Add(time.Duration(request.GraceMinutes) * time.Minute)
+		}
+		return tx.Model(old).Updates(updates).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auth.InvalidateAPIKeys()
+
+	c.JSON(http.StatusCreated, issued)
+}
+
+// RevokeAPIKey handles DELETE /log-sources/:id/keys/:keyId
+// Revoked keys stop working within seconds on every instance and are kept for the record
+func (h *LogSourceHandler) RevokeAPIKey(c *gin.Context) {
+	key, ok := h.findAPIKey(c)
+	if !ok {
+		return
+	}
+	if key.RevokedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "API key is already revoked"})
+		return
+	}
+
+	now := time.Now()
+	key.RevokedAt = &now
+	key.RevokedBy = middleware.CurrentClaims(c).Actor()
+	if err := h.DB.Model(key).Select("revoked_at", "revoked_by").Updates(key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auth.InvalidateAPIKeys()
+
+	c.JSON(http.StatusOK, key)
+}
+
+// issueAPIKey generates the key of a new record and saves it with db
+func issueAPIKey(db *gorm.DB, key *models.APIKey) (*issuedAPIKey, error) {
+	secret, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	key.Prefix = prefix
+	key.KeyHash = hash
+	if err := db.Create(key).Error; err != nil {
+		return nil, err
+	}
+	return &issuedAPIKey{APIKey: *key, Key: secret}, nil
+}
+
+// findLogSource loads the log source named by the :id parameter, answering the request when it cannot
+func (h *LogSourceHandler) findLogSource(c *gin.Context) (*models.LogSource, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid log source ID"})
+		return nil, false
+	}
+
+	var source models.LogSource
+	if err := h.DB.First(&source, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Log source not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &source, true
+}
+
+// findAPIKey loads the key named by the :keyId parameter of the source named
+// by :id, answering the request when it cannot
+func (h *LogSourceHandler) findAPIKey(c *gin.Context) (*models.APIKey, bool) {
+	id, err := strconv.Atoi(c.Param("keyId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return nil, false
+	}
+
+	var key models.APIKey
+	if err := h.DB.Where("log_source_id = ?", c.Param("id")).First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &key, true
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// AttackHandler handles MITRE ATT&CK technique endpoints
+type AttackHandler struct {
+	DB *gorm.DB
+}
+
+// NewAttackHandler creates a new AttackHandler
+func NewAttackHandler(db *gorm.DB) *AttackHandler {
+	return &AttackHandler{DB: db}
+}
+
+// GetTechniques handles GET /attack/techniques
+// Lists the ATT&CK techniques known to the coverage map
+func (h *AttackHandler) GetTechniques(c *gin.Context) {
+	c.JSON(http.StatusOK, siem.AttackTechniques)
+}
+
+// GetCoverage handles GET /attack/coverage?days=30
+// Maps rules and the alerts of the last days onto ATT&CK techniques and tactics
+func (h *AttackHandler) GetCoverage(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days"})
+		return
+	}
+
+	since := clock.Default().Now().UTC().Add(-time.Duration(days) * 24 * time.Hour)
+	coverage, err := siem.ComputeAttackCoverage(h.DB, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, coverage)
+}
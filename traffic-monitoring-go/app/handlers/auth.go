@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/auth"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
+)
+
+// AuthHandler issues access tokens for users
+type AuthHandler struct {
+	DB *gorm.DB
+}
+
+// NewAuthHandler creates a new AuthHandler
+func NewAuthHandler(db *gorm.DB) *AuthHandler {
+	return &AuthHandler{DB: db}
+}
+
+// LoginRequest is the body of POST /auth/login
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Login handles POST /auth/login
+// Exchanges a user's email and password for a bearer token
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	err := h.DB.Where("LOWER(email) = ?", strings.ToLower(req.Email)).First(&user).Error
+	if err != nil || !auth.CheckPassword(user.HashedPassword, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	token, session, err := auth.StartSession(h.DB, &user, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_at":   session.ExpiresAt,
+		"session_id":   session.ID,
+		"user":         user,
+	})
+}
+
+// Logout handles POST /auth/logout
+// Revokes the session of the caller's token
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims := middleware.CurrentClaims(c)
+	if claims == nil || claims.TokenID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only session tokens can be logged out"})
+		return
+	}
+
+	if _, err := auth.RevokeToken(h.DB, claims.TokenID, claims.Actor(), "logout"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// GetMySessions handles GET /auth/sessions
+// Lists the caller's active sessions
+func (h *AuthHandler) GetMySessions(c *gin.Context) {
+	claims := middleware.CurrentClaims(c)
+	sessions := []models.UserSession{}
+	if claims != nil && claims.UserID != 0 {
+		err := h.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", claims.UserID, time.Now()).
+			Order("issued_at DESC").
+			Find(&sessions).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// GetCurrentUser handles GET /auth/me
+func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
+	c.JSON(http.StatusOK, middleware.CurrentClaims(c))
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
 	"traffic-monitoring-go/app/siem/collectors"
 )
 
@@ -25,6 +27,28 @@ func NewCollectorHandler(db *gorm.DB) *CollectorHandler {
 	manager.RegisterCollector(syslogCollector)
 	manager.RegisterCollector(snmpCollector)
 
+	// Restore listeners that were added at runtime
+	var listeners []models.CollectorListener
+	if err := db.Where("enabled = ?", true).Find(&listeners).Error; err != nil {
+		log.Printf("Warning: failed to load collector listeners: %v", err)
+	}
+	for _, listener := range listeners {
+		if err := manager.AddListener(listenerConfig(listener)); err != nil {
+			log.Printf("Warning: failed to start collector listener %s: %v", listener.Name, err)
+		}
+	}
+
+	// Restore MQTT brokers; a broker that is down is retried in the background
+	var brokers []models.MQTTBroker
+	if err := db.Where("enabled = ?", true).Find(&brokers).Error; err != nil {
+		log.Printf("Warning: failed to load MQTT brokers: %v", err)
+	}
+	for _, broker := range brokers {
+		if err := manager.AddMQTT(mqttConfig(broker)); err != nil {
+			log.Printf("Warning: failed to start MQTT collector %s: %v", broker.Name, err)
+		}
+	}
+
 	return &CollectorHandler{
 		DB:			db,
 		CollectorManager:	manager,
@@ -96,5 +120,148 @@ func (h *CollectorHandler) StopAllCollectors(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "All collectors stopped"})
 }
 
+// listenerConfig converts a stored listener into its runtime configuration
+func listenerConfig(listener models.CollectorListener) collectors.ListenerConfig {
+	return collectors.ListenerConfig{
+		Name:     listener.Name,
+		Protocol: listener.Protocol,
+		Port:     listener.Port,
+		Parser:   listener.Parser,
+	}
+}
+
+// GetListeners handles GET /collectors/listeners
+func (h *CollectorHandler) GetListeners(c *gin.Context) {
+	var listeners []models.CollectorListener
+	if err := h.DB.Order("name ASC").Find(&listeners).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, 0, len(listeners))
+	for _, listener := range listeners {
+		running, _ := h.CollectorManager.GetCollectorStatus(listener.Name)
+		result = append(result, gin.H{
+			"listener": listener,
+			"running":  running,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"listeners": result, "parsers": collectors.ParserNames()})
+}
+
+// AddListener handles POST /collectors/listeners
+// Binds the new socket immediately and persists the listener for restarts
+func (h *CollectorHandler) AddListener(c *gin.Context) {
+	var listener models.CollectorListener
+	if err := c.ShouldBindJSON(&listener); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	listener.Enabled = true
+
+	if err := listenerConfig(listener).Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.CollectorManager.AddListener(listenerConfig(listener)); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Create(&listener).Error; err != nil {
+		// keep runtime and stored state consistent
+		h.CollectorManager.RemoveCollector(listener.Name)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, listener)
+}
+
+// UpdateListener handles PUT /collectors/listeners/:name
+// Rebinds the listener with its new protocol, port or parser, or binds it when
+// it failed to at startup
+func (h *CollectorHandler) UpdateListener(c *gin.Context) {
+	var listener models.CollectorListener
+	if err := h.DB.Where("name = ?", c.Param("name")).First(&listener).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Listener not found"})
+		return
+	}
+
+	var request struct {
+		Protocol string `json:"protocol"`
+		Port     int    `json:"port"`
+		Parser   string `json:"parser"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Protocol != "" {
+		listener.Protocol = request.Protocol
+	}
+	if request.Port != 0 {
+		listener.Port = request.Port
+	}
+	if request.Parser != "" {
+		listener.Parser = request.Parser
+	}
+
+	config := listenerConfig(listener)
+	if err := config.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// a listener that failed to bind at startup was never registered, and is
+	// started now with its new configuration
+	_, registered := h.CollectorManager.GetCollectorStatus(listener.Name)
+	var err error
+	switch {
+	case registered == nil:
+		err = h.CollectorManager.ReplaceListener(config)
+	case listener.Enabled:
+		err = h.CollectorManager.AddListener(config)
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(&listener).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, listener)
+}
+
+// RemoveListener handles DELETE /collectors/listeners/:name
+// Drains in-flight messages before the socket is released
+func (h *CollectorHandler) RemoveListener(c *gin.Context) {
+	name := c.Param("name")
+
+	var listener models.CollectorListener
+	if err := h.DB.Where("name = ?", name).First(&listener).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Listener not found"})
+		return
+	}
+
+	// a listener that failed to bind at startup was never registered, so there is nothing to stop
+	if _, err := h.CollectorManager.GetCollectorStatus(name); err == nil {
+		if err := h.CollectorManager.RemoveCollector(name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	
+	if err := h.DB.Delete(&listener).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Listener removed successfully"})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/config"
+)
+
+// ConfigHandler handles the runtime configuration endpoints
+type ConfigHandler struct{}
+
+// NewConfigHandler creates a new ConfigHandler
+func NewConfigHandler() *ConfigHandler {
+	return &ConfigHandler{}
+}
+
+// GetConfig handles GET /config
+// Lists every setting with its effective value, where it came from and its
+// default; secret values are redacted
+func (h *ConfigHandler) GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, config.Entries())
+}
+
+// ReloadConfig handles POST /config/reload
+// Reads the config file again, as a change on disk or SIGHUP would, and
+// returns the keys that changed. A file with an invalid value is rejected
+// and the settings stay as they were.
+func (h *ConfigHandler) ReloadConfig(c *gin.Context) {
+	changed, err := config.Reload()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if changed == nil {
+		changed = []string{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changed": changed})
+}
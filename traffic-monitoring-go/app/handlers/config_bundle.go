@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/routing"
+)
+
+// ConfigBundleHandler handles configuration export and import for disaster
+// recovery and promotion between environments
+type ConfigBundleHandler struct {
+	DB *gorm.DB
+}
+
+// NewConfigBundleHandler creates a new ConfigBundleHandler
+func NewConfigBundleHandler(db *gorm.DB) *ConfigBundleHandler {
+	return &ConfigBundleHandler{DB: db}
+}
+
+// bundleErrorStatus maps bundle errors to HTTP statuses
+func bundleErrorStatus(err error) int {
+	switch err {
+	case siem.ErrBundleKeyMissing:
+		return http.StatusServiceUnavailable
+	case siem.ErrBundleSignature:
+		return http.StatusUnauthorized
+	}
+	return http.StatusBadRequest
+}
+
+// ExportConfig handles GET /admin/config/export
+// Downloads the configuration as a bundle signed with CONFIG_BUNDLE_KEY
+func (h *ConfigBundleHandler) ExportConfig(c *gin.Context) {
+	bundle, err := siem.ExportConfig(h.DB)
+	if err == siem.ErrBundleKeyMissing {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("siem-config-%s.json", time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.JSON(http.StatusOK, bundle)
+}
+
+// ImportConfig handles POST /admin/config/import
+// Verifies and applies a bundle; ?dry_run=true reports the changes without
+// applying them. Imported collector listeners and MQTT brokers start on the
+// next restart.
+func (h *ConfigBundleHandler) ImportConfig(c *gin.Context) {
+	var signed siem.SignedConfigBundle
+	if err := c.ShouldBindJSON(&signed); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bundle, err := siem.VerifyConfigBundle(&signed)
+	if err != nil {
+		c.JSON(bundleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	result, err := siem.ImportConfig(h.DB, bundle, dryRun)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !dryRun {
+		if err := routing.Load(h.DB); err != nil {
+			log.Printf("Error reloading event routing after configuration import: %v", err)
+		}
+		log.Printf("Imported configuration bundle exported at %s", bundle.ExportedAt.Format(time.RFC3339))
+	}
+
+	c.JSON(http.StatusOK, result)
+}
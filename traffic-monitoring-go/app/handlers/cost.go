@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/siem"
+)
+
+// CostHandler handles pipeline cost accounting endpoints
+type CostHandler struct{}
+
+// NewCostHandler creates a new CostHandler
+func NewCostHandler() *CostHandler {
+	return &CostHandler{}
+}
+
+// GetCostBreakdown handles GET /pipeline/cost
+// Reports sampled processing cost per category and message type, most expensive first
+func (h *CostHandler) GetCostBreakdown(c *gin.Context) {
+	breakdown, since, sampleRate := siem.GetCostBreakdown()
+
+	c.JSON(http.StatusOK, gin.H{
+		"since":       since,
+		"sample_rate": sampleRate,
+		"breakdown":   breakdown,
+	})
+}
+
+// ResetCostBreakdown handles DELETE /pipeline/cost
+func (h *CostHandler) ResetCostBreakdown(c *gin.Context) {
+	siem.ResetCostBreakdown()
+	c.JSON(http.StatusOK, gin.H{"message": "Cost breakdown reset"})
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// maxCRLUploadSize bounds an uploaded CRL
+const maxCRLUploadSize = 64 << 20
+
+// CRLHandler handles V2X PKI certificate revocation list endpoints
+type CRLHandler struct {
+	DB      *gorm.DB
+	Fetcher *siem.CRLFetcher
+}
+
+// NewCRLHandler creates a new CRLHandler
+func NewCRLHandler(db *gorm.DB) *CRLHandler {
+	return &CRLHandler{DB: db, Fetcher: siem.NewCRLFetcher(db)}
+}
+
+// GetCRLs handles GET /crls
+func (h *CRLHandler) GetCRLs(c *gin.Context) {
+	var crls []models.CertificateRevocationList
+	if err := h.DB.Order("name ASC").Find(&crls).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, crls)
+}
+
+// GetCRL handles GET /crls/:id
+func (h *CRLHandler) GetCRL(c *gin.Context) {
+	crl, ok := h.findCRL(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, crl)
+}
+
+// CreateCRL handles POST /crls
+// A CRL with a source_url is downloaded at once; others are filled by uploads
+func (h *CRLHandler) CreateCRL(c *gin.Context) {
+	crl := models.CertificateRevocationList{Enabled: true}
+	if err := c.ShouldBindJSON(&crl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if crl.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CRL name is required"})
+		return
+	}
+	crl.Entries, crl.FetchedAt, crl.LastError = 0, nil, ""
+
+	if err := h.DB.Create(&crl).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// a failed first download is recorded on the CRL and retried by the refresh job
+	if crl.SourceURL != "" {
+		h.Fetcher.Fetch(&crl)
+	}
+
+	c.JSON(http.StatusCreated, crl)
+}
+
+// UpdateCRL handles PUT /crls/:id
+// Changes the name, issuer, source URL or enabled flag; entries change by upload or refresh
+func (h *CRLHandler) UpdateCRL(c *gin.Context) {
+	crl, ok := h.findCRL(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name      *string `json:"name"`
+		Issuer    *string `json:"issuer"`
+		SourceURL *string `json:"source_url"`
+		Enabled   *bool   `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Name != nil {
+		if *request.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "CRL name is required"})
+			return
+		}
+		crl.Name = *request.Name
+	}
+	if request.Issuer != nil {
+		crl.Issuer = *request.Issuer
+	}
+	if request.SourceURL != nil {
+		crl.SourceURL = *request.SourceURL
+	}
+	if request.Enabled != nil {
+		crl.Enabled = *request.Enabled
+	}
+
+	if err := h.DB.Save(crl).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateRevocations()
+
+	c.JSON(http.StatusOK, crl)
+}
+
+// DeleteCRL handles DELETE /crls/:id
+func (h *CRLHandler) DeleteCRL(c *gin.Context) {
+	crl, ok := h.findCRL(c)
+	if !ok {
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("crl_id = ?", crl.ID).Delete(&models.RevokedCertificate{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(crl).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateRevocations()
+
+	c.JSON(http.StatusOK, gin.H{"message": "CRL deleted successfully"})
+}
+
+// UploadCRL handles POST /crls/:id/upload
+// Replaces the entries with an uploaded CRL: JSON with entries, a JSON array of
+// certificate IDs, or one certificate ID per line
+func (h *CRLHandler) UploadCRL(c *gin.Context) {
+	crl, ok := h.findCRL(c)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxCRLUploadSize))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "CRL too large"})
+		return
+	}
+	doc, err := siem.ParseCRL(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := siem.StoreCRL(h.DB, crl, doc); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, crl)
+}
+
+// RefreshCRL handles POST /crls/:id/refresh
+// Downloads the CRL from its source URL now
+func (h *CRLHandler) RefreshCRL(c *gin.Context) {
+	crl, ok := h.findCRL(c)
+	if !ok {
+		return
+	}
+	if crl.SourceURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CRL has no source URL; upload it instead"})
+		return
+	}
+
+	if err := h.Fetcher.Fetch(crl); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "crl": crl})
+		return
+	}
+
+	c.JSON(http.StatusOK, crl)
+}
+
+// crlEntryList is how GET /crls/:id/entries may be sorted and projected
+var crlEntryList = listSpec{
+	Model: models.RevokedCertificate{},
+	Sortable: map[string]string{
+		"certificate_id": "certificate_id",
+		"revoked_at":     "revoked_at",
+	},
+	DefaultSort:     "certificate_id:asc",
+	DefaultPageSize: 100,
+	MaxPageSize:     1000,
+}
+
+// GetCRLEntries handles GET /crls/:id/entries
+// Takes the list parameters page, pageSize, sort and fields.
+func (h *CRLHandler) GetCRLEntries(c *gin.Context) {
+	crl, ok := h.findCRL(c)
+	if !ok {
+		return
+	}
+	list, ok := parseListQuery(c, crlEntryList)
+	if !ok {
+		return
+	}
+
+	var entries []models.RevokedCertificate
+	if err := list.paginate(h.DB.Where("crl_id = ?", crl.ID)).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, entries, int64(crl.Entries), list)
+}
+
+// CheckCertificate handles GET /crls/check/:certificate_id
+// Lists the CRLs that revoke a certificate
+func (h *CRLHandler) CheckCertificate(c *gin.Context) {
+	id, ok := siem.NormalizeCertificateID(c.Param("certificate_id"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid certificate ID"})
+		return
+	}
+
+	var entries []struct {
+		models.RevokedCertificate
+		CRL     string `json:"crl" gorm:"column:crl"`
+		Enabled bool   `json:"crl_enabled" gorm:"column:crl_enabled"`
+	}
+	err := h.DB.Table("revoked_certificates").
+		Select("revoked_certificates.*, certificate_revocation_lists.name AS crl, certificate_revocation_lists.enabled AS crl_enabled").
+		Joins("JOIN certificate_revocation_lists ON certificate_revocation_lists.id = revoked_certificates.crl_id").
+		Where("revoked_certificates.certificate_id = ?", id).
+		Scan(&entries).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	revoked := false
+	for _, entry := range entries {
+		revoked = revoked || entry.Enabled
+	}
+	c.JSON(http.StatusOK, gin.H{"certificate_id": id, "revoked": revoked, "entries": entries})
+}
+
+// findCRL loads the CRL named by the :id parameter, answering the request when it cannot
+func (h *CRLHandler) findCRL(c *gin.Context) (*models.CertificateRevocationList, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CRL ID"})
+		return nil, false
+	}
+
+	var crl models.CertificateRevocationList
+	if err := h.DB.First(&crl, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "CRL not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &crl, true
+}
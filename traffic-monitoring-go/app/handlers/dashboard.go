@@ -5,6 +5,7 @@ package handlers
 import (
     "net/http"
     "strconv"
+    "time"
 
     "github.com/gin-gonic/gin"
     "gorm.io/gorm"
@@ -28,11 +29,48 @@ func NewDashboardHandler(db *gorm.DB, esService *elasticsearch.Service) *Dashboa
     }
 }
 
+// dashboardWindow reads the time window of a dashboard request: from and to
+// (RFC3339, either may be left open) when given, the timeRange preset
+// (default last_30_days) otherwise. Answers 400 and reports false when the
+// bounds are invalid.
+func (h *DashboardHandler) dashboardWindow(c *gin.Context) (string, siem.TimeWindow, bool) {
+    from, to := c.Query("from"), c.Query("to")
+    if from == "" && to == "" {
+        timeRange := c.DefaultQuery("timeRange", "last_30_days")
+        return timeRange, siem.DashboardTimeWindow(timeRange, h.DashboardService.Clock.Now()), true
+    }
+    
+    var window siem.TimeWindow
+    for _, bound := range []struct {
+        param string
+        value string
+        time  *time.Time
+    }{{"from", from, &window.From}, {"to", to, &window.To}} {
+        if bound.value == "" {
+            continue
+        }
+        t, err := time.Parse(time.RFC3339, bound.value)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.param + ", use RFC3339"})
+            return "", window, false
+        }
+        *bound.time = t
+    }
+    if !window.From.IsZero() && !window.To.IsZero() && !window.To.After(window.From) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+        return "", window, false
+    }
+    return siem.CustomTimeRange, window, true
+}
+
 // GetEventSummary handles GET /dashboard/events/summary
 func (h *DashboardHandler) GetEventSummary(c *gin.Context) {
-    timeRange := c.DefaultQuery("timeRange", "last_30_days")
+    _, window, ok := h.dashboardWindow(c)
+    if !ok {
+        return
+    }
     
-    summary, err := h.DashboardService.GetEventSummary(timeRange)
+    summary, err := h.DashboardService.GetEventSummary(window)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -43,9 +81,12 @@ func (h *DashboardHandler) GetEventSummary(c *gin.Context) {
 
 // GetAlertSummary handles GET /dashboard/alerts/summary
 func (h *DashboardHandler) GetAlertSummary(c *gin.Context) {
-    timeRange := c.DefaultQuery("timeRange", "last_30_days")
+    _, window, ok := h.dashboardWindow(c)
+    if !ok {
+        return
+    }
     
-    summary, err := h.DashboardService.GetAlertSummary(timeRange)
+    summary, err := h.DashboardService.GetAlertSummary(window)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -56,10 +97,13 @@ func (h *DashboardHandler) GetAlertSummary(c *gin.Context) {
 
 // GetEventTimeSeries handles GET /dashboard/events/timeseries
 func (h *DashboardHandler) GetEventTimeSeries(c *gin.Context) {
-    timeRange := c.DefaultQuery("timeRange", "last_30_days")
+    _, window, ok := h.dashboardWindow(c)
+    if !ok {
+        return
+    }
     groupBy := c.DefaultQuery("groupBy", "day")
     
-    data, err := h.DashboardService.GetEventTimeSeries(timeRange, groupBy)
+    data, err := h.DashboardService.GetEventTimeSeries(window, groupBy)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -70,10 +114,13 @@ func (h *DashboardHandler) GetEventTimeSeries(c *gin.Context) {
 
 // GetTopSourceIPs handles GET /dashboard/events/top-sources
 func (h *DashboardHandler) GetTopSourceIPs(c *gin.Context) {
-    timeRange := c.DefaultQuery("timeRange", "last_30_days")
+    _, window, ok := h.dashboardWindow(c)
+    if !ok {
+        return
+    }
     limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
     
-    data, err := h.DashboardService.GetTopSourceIPs(timeRange, limit)
+    data, err := h.DashboardService.GetTopSourceIPs(window, limit)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -84,10 +131,13 @@ func (h *DashboardHandler) GetTopSourceIPs(c *gin.Context) {
 
 // GetTopTriggeredRules handles GET /dashboard/alerts/top-rules
 func (h *DashboardHandler) GetTopTriggeredRules(c *gin.Context) {
-    timeRange := c.DefaultQuery("timeRange", "last_30_days")
+    _, window, ok := h.dashboardWindow(c)
+    if !ok {
+        return
+    }
     limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
     
-    data, err := h.DashboardService.GetTopTriggeredRules(timeRange, limit)
+    data, err := h.DashboardService.GetTopTriggeredRules(window, limit)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -98,38 +148,41 @@ func (h *DashboardHandler) GetTopTriggeredRules(c *gin.Context) {
 
 // GetDashboardOverview handles GET /dashboard/overview
 func (h *DashboardHandler) GetDashboardOverview(c *gin.Context) {
-    timeRange := c.DefaultQuery("timeRange", "last_30_days")
+    _, window, ok := h.dashboardWindow(c)
+    if !ok {
+        return
+    }
     
     // Get event summary
-    eventSummary, err := h.DashboardService.GetEventSummary(timeRange)
+    eventSummary, err := h.DashboardService.GetEventSummary(window)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get event summary: " + err.Error()})
         return
     }
     
     // Get alert summary
-    alertSummary, err := h.DashboardService.GetAlertSummary(timeRange)
+    alertSummary, err := h.DashboardService.GetAlertSummary(window)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get alert summary: " + err.Error()})
         return
     }
     
     // Get event time series
-    eventTimeSeries, err := h.DashboardService.GetEventTimeSeries(timeRange, "day")
+    eventTimeSeries, err := h.DashboardService.GetEventTimeSeries(window, "day")
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get event time series: " + err.Error()})
         return
     }
     
     // Get top source IPs
-    topSources, err := h.DashboardService.GetTopSourceIPs(timeRange, 5)
+    topSources, err := h.DashboardService.GetTopSourceIPs(window, 5)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get top sources: " + err.Error()})
         return
     }
     
     // Get top triggered rules
-    topRules, err := h.DashboardService.GetTopTriggeredRules(timeRange, 5)
+    topRules, err := h.DashboardService.GetTopTriggeredRules(window, 5)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get top rules: " + err.Error()})
         return
@@ -146,6 +199,34 @@ func (h *DashboardHandler) GetDashboardOverview(c *gin.Context) {
 }
 
 
+// GetDashboardSummary handles GET /dashboard/summary
+// Returns every dashboard panel, V2X included, from a few grouped queries. The
+// summary is cached for a short TTL and then reused while no event or alert
+// changed; refresh=true recomputes it. Answers If-Modified-Since with 304 when
+// the summary was generated no later than that.
+func (h *DashboardHandler) GetDashboardSummary(c *gin.Context) {
+    timeRange, window, ok := h.dashboardWindow(c)
+    if !ok {
+        return
+    }
+    refresh, _ := strconv.ParseBool(c.Query("refresh"))
+    
+    summary, err := h.DashboardService.GetSummary(timeRange, window, refresh)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get dashboard summary: " + err.Error()})
+        return
+    }
+    
+    generated := summary.GeneratedAt.UTC().Truncate(time.Second)
+    c.Header("Last-Modified", generated.Format(http.TimeFormat))
+    if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && !generated.After(since) {
+        c.Status(http.StatusNotModified)
+        return
+    }
+    
+    c.JSON(http.StatusOK, summary)
+}
+
 // GetElasticsearchDashboard handles GET /dashboard/es/overview
 func (h *DashboardHandler) GetElasticsearchDashboard(c *gin.Context) {
     // Check if Elasticsearch is available
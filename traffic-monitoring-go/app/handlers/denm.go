@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// DENMHandler handles the verification of vehicle reactions to DENM alerts
+type DENMHandler struct {
+	DB       *gorm.DB
+	Verifier *siem.DENMVerifier
+}
+
+// NewDENMHandler creates a new DENMHandler
+func NewDENMHandler(db *gorm.DB) *DENMHandler {
+	return &DENMHandler{DB: db, Verifier: siem.NewDENMVerifier(db)}
+}
+
+// GetVerifications handles GET /denm/verifications
+// Lists stored verifications, most recent first; ?suspicious=true keeps only
+// DENMs without plausible recipients
+func (h *DENMHandler) GetVerifications(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+
+	query := database.ReadDB(h.DB).Order("verified_at DESC").Limit(limit)
+	if suspicious := c.Query("suspicious"); suspicious != "" {
+		query = query.Where("suspicious = ?", suspicious == "true")
+	}
+
+	var verifications []models.DENMVerification
+	if err := query.Find(&verifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, verifications)
+}
+
+// loadAlert loads the alert named by the :alert_id parameter
+func (h *DENMHandler) loadAlert(c *gin.Context) (*models.Alert, bool) {
+	alertID, err := strconv.Atoi(c.Param("alert_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		return nil, false
+	}
+
+	var alert models.Alert
+	if err := h.DB.First(&alert, alertID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return nil, false
+	}
+	return &alert, true
+}
+
+// verify runs and stores the verification of an alert
+func (h *DENMHandler) verify(c *gin.Context, alert *models.Alert) {
+	verification, err := h.Verifier.VerifyAndStore(alert)
+	if err == siem.ErrNotDENM {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, verification)
+}
+
+// GetVerification handles GET /denm/verifications/:alert_id
+// Returns the stored verification, verifying the alert first if it has none
+func (h *DENMHandler) GetVerification(c *gin.Context) {
+	alert, ok := h.loadAlert(c)
+	if !ok {
+		return
+	}
+
+	var verification models.DENMVerification
+	err := h.DB.Where("alert_id = ?", alert.ID).First(&verification).Error
+	if err == nil {
+		c.JSON(http.StatusOK, verification)
+		return
+	}
+	if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.verify(c, alert)
+}
+
+// VerifyAlert handles POST /denm/verifications/:alert_id
+// Recomputes the verification, e.g. after late V2X reports arrived
+func (h *DENMHandler) VerifyAlert(c *gin.Context) {
+	alert, ok := h.loadAlert(c)
+	if !ok {
+		return
+	}
+	h.verify(c, alert)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/siem/elasticsearch"
+)
+
+// ESAdminHandler handles Elasticsearch index maintenance endpoints
+type ESAdminHandler struct {
+	ESService *elasticsearch.Service
+}
+
+// NewESAdminHandler creates a new ESAdminHandler
+func NewESAdminHandler(esService *elasticsearch.Service) *ESAdminHandler {
+	return &ESAdminHandler{ESService: esService}
+}
+
+// GetIndices handles GET /admin/elasticsearch/indices
+func (h *ESAdminHandler) GetIndices(c *gin.Context) {
+	pattern := c.DefaultQuery("pattern", "security-events*,security-alerts*,alerts*")
+
+	indices, err := h.ESService.ListIndices(pattern)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var totalDocs, totalBytes int64
+	for _, index := range indices {
+		totalDocs += index.DocsCount
+		totalBytes += index.SizeBytes
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"indices":     indices,
+		"count":       len(indices),
+		"total_docs":  totalDocs,
+		"total_bytes": totalBytes,
+	})
+}
+
+// ForceMergeIndices handles POST /admin/elasticsearch/indices/forcemerge
+func (h *ESAdminHandler) ForceMergeIndices(c *gin.Context) {
+	var request struct {
+		Pattern        string `json:"pattern" binding:"required"`
+		MaxNumSegments int    `json:"max_num_segments"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.ESService.ForceMerge(request.Pattern, request.MaxNumSegments)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Force merge completed", "result": result})
+}
+
+// DeleteIndices handles DELETE /admin/elasticsearch/indices?pattern=
+func (h *ESAdminHandler) DeleteIndices(c *gin.Context) {
+	pattern := c.Query("pattern")
+
+	deleted, err := h.ESService.DeleteIndices(pattern)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Indices deleted", "deleted": deleted})
+}
+
+// RolloverIndex handles POST /admin/elasticsearch/rollover
+func (h *ESAdminHandler) RolloverIndex(c *gin.Context) {
+	var request struct {
+		Alias      string                 `json:"alias" binding:"required"`
+		Conditions map[string]interface{} `json:"conditions"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.ESService.Rollover(request.Alias, request.Conditions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetSpill handles GET /admin/elasticsearch/spill
+// Reports documents spilled to disk during Elasticsearch outages and replay progress
+func (h *ESAdminHandler) GetSpill(c *gin.Context) {
+	c.JSON(http.StatusOK, h.ESService.SpillStats())
+}
+
+// GetBulk handles GET /admin/elasticsearch/bulk
+// Reports the bulk indexing buffer and flush results
+func (h *ESAdminHandler) GetBulk(c *gin.Context) {
+	c.JSON(http.StatusOK, h.ESService.BulkStats())
+}
+
+// GetILM handles GET /admin/elasticsearch/ilm
+// Reports the lifecycle phases and the ILM step of each event index
+func (h *ESAdminHandler) GetILM(c *gin.Context) {
+	status, err := h.ESService.ILMStatus()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// UpdateILM handles PUT /admin/elasticsearch/ilm
+// Rewrites the event and alert lifecycle policies with new phases
+// (rollover_max_age, rollover_max_size, warm_after, delete_after)
+func (h *ESAdminHandler) UpdateILM(c *gin.Context) {
+	var phases elasticsearch.ILMPhases
+	if err := c.ShouldBindJSON(&phases); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.ESService.UpdateILMPhases(phases); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lifecycle policies updated", "phases": phases})
+}
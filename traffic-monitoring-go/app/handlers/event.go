@@ -19,14 +19,38 @@ func NewEventHandler(db *gorm.DB) *EventHandler {
 	return &EventHandler{DB: db}
 }
 
+// userEventList is how GET /events may be sorted and projected.
+var userEventList = listSpec{
+	Model: models.UserEvent{},
+	Sortable: map[string]string{
+		"id":         "id",
+		"date":       "date",
+		"city":       "city",
+		"event_type": "event_type",
+	},
+	DefaultSort: "date:desc",
+}
+
 // GetEvents handles GET /events.
+// Takes the list parameters page, pageSize, sort and fields.
 func (h *EventHandler) GetEvents(c *gin.Context) {
+	list, ok := parseListQuery(c, userEventList)
+	if !ok {
+		return
+	}
+
+	var total int64
+	if err := h.DB.Model(&models.UserEvent{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	var events []models.UserEvent
-	if err := h.DB.Find(&events).Error; err != nil {
+	if err := list.paginate(h.DB).Find(&events).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, events)
+	respondList(c, events, total, list)
 }
 
 // CreateEvent handles POST /events.
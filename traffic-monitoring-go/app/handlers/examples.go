@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/siem"
+)
+
+// ExampleHandler serves the catalog of canonical ingest payloads
+type ExampleHandler struct{}
+
+// NewExampleHandler creates a new ExampleHandler
+func NewExampleHandler() *ExampleHandler {
+	return &ExampleHandler{}
+}
+
+// GetExamples handles GET /examples
+func (h *ExampleHandler) GetExamples(c *gin.Context) {
+	examples := siem.ExamplePayloads()
+
+	catalog := make([]siem.ExamplePayload, 0, len(examples))
+	for _, format := range siem.ExampleFormats() {
+		catalog = append(catalog, examples[format])
+	}
+
+	c.JSON(http.StatusOK, catalog)
+}
+
+// GetExample handles GET /examples/:format
+// With raw=true the bare payload is returned so it can be piped into an encoder test
+func (h *ExampleHandler) GetExample(c *gin.Context) {
+	example, ok := siem.ExamplePayloads()[c.Param("format")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown example format", "formats": siem.ExampleFormats()})
+		return
+	}
+
+	if c.Query("raw") == "true" && example.Payload != nil {
+		if text, isText := example.Payload.(string); isText {
+			c.Data(http.StatusOK, example.ContentType, []byte(text))
+			return
+		}
+		c.JSON(http.StatusOK, example.Payload)
+		return
+	}
+
+	c.JSON(http.StatusOK, example)
+}
+
+// ValidateExample handles POST /examples/:format/validate
+// Decodes the body with the server's parsing structs without ingesting it
+func (h *ExampleHandler) ValidateExample(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	if err := siem.ValidateExamplePayload(c.Param("format"), body); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"valid": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": true})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/siem"
+)
+
+// ForensicsHandler handles incident reconstruction endpoints
+type ForensicsHandler struct {
+	Search *siem.ForensicSearch
+}
+
+// NewForensicsHandler creates a new ForensicsHandler
+func NewForensicsHandler(db *gorm.DB) *ForensicsHandler {
+	return &ForensicsHandler{Search: siem.NewForensicSearch(db)}
+}
+
+// parseCenterTimestamp accepts RFC 3339 (with fractional seconds) or Unix milliseconds
+func parseCenterTimestamp(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("center_ts is required")
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond)).UTC(), nil
+	}
+	ts, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, errors.New("center_ts must be RFC 3339 or Unix milliseconds")
+	}
+	return ts, nil
+}
+
+// parseDistance parses a distance such as "500m", "1.5km" or "250" (meters)
+func parseDistance(value string) (float64, error) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(value, "km"):
+		value, multiplier = strings.TrimSuffix(value, "km"), 1000
+	case strings.HasSuffix(value, "m"):
+		value = strings.TrimSuffix(value, "m")
+	}
+	distance, err := strconv.ParseFloat(value, 64)
+	if err != nil || distance <= 0 {
+		return 0, errors.New("r must be a positive distance such as 500m or 1.5km")
+	}
+	return distance * multiplier, nil
+}
+
+// GetWindow handles GET /forensics/window
+// Returns every event, V2X message and alert within radius (default 30s) of
+// center_ts and, when location ("lat,lon") is given, within r (default 500m)
+// of it, ordered by timestamp with millisecond precision
+func (h *ForensicsHandler) GetWindow(c *gin.Context) {
+	center, err := parseCenterTimestamp(c.Query("center_ts"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	radius, err := time.ParseDuration(c.DefaultQuery("radius", "30s"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid radius"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "5000"))
+	if err != nil || limit <= 0 || limit > 50000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 50000"})
+		return
+	}
+
+	window := siem.ForensicWindow{Center: center, Radius: radius, Limit: limit}
+	if location := c.Query("location"); location != "" {
+		lat, lon, ok := siem.ParseLocation(location)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "location must be \"lat,lon\""})
+			return
+		}
+		distance, err := parseDistance(c.DefaultQuery("r", "500m"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		window.Latitude, window.Longitude, window.HasLocation, window.RadiusMeters = lat, lon, true, distance
+	}
+
+	if err := window.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.Search.Search(window)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// GeoHandler handles RSU registry and road network endpoints used for alert enrichment
+type GeoHandler struct {
+	DB *gorm.DB
+}
+
+// NewGeoHandler creates a new GeoHandler
+func NewGeoHandler(db *gorm.DB) *GeoHandler {
+	return &GeoHandler{DB: db}
+}
+
+// GetRSUs handles GET /rsus
+func (h *GeoHandler) GetRSUs(c *gin.Context) {
+	var rsus []models.RSU
+	if err := h.DB.Order("code ASC").Find(&rsus).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rsus)
+}
+
+// CreateRSU handles POST /rsus
+func (h *GeoHandler) CreateRSU(c *gin.Context) {
+	var rsu models.RSU
+	if err := c.ShouldBindJSON(&rsu); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if rsu.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "RSU code is required"})
+		return
+	}
+	if rsu.Latitude < -90 || rsu.Latitude > 90 || rsu.Longitude < -180 || rsu.Longitude > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid RSU coordinates"})
+		return
+	}
+
+	if err := h.DB.Create(&rsu).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rsu)
+}
+
+// DeleteRSU handles DELETE /rsus/:id
+func (h *GeoHandler) DeleteRSU(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid RSU ID"})
+		return
+	}
+
+	if err := h.DB.Delete(&models.RSU{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "RSU deleted successfully"})
+}
+
+// geoJSONFeatureCollection is the subset of GeoJSON accepted by the road import
+type geoJSONFeatureCollection struct {
+	Type     string `json:"type"`
+	Features []struct {
+		ID         interface{}            `json:"id"`
+		Properties map[string]interface{} `json:"properties"`
+		Geometry   struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+	} `json:"features"`
+}
+
+// ImportRoads handles POST /roads/import
+// Accepts a GeoJSON FeatureCollection of LineString/MultiLineString roads with
+// name, ref and id properties (as exported from OpenStreetMap). replace=true
+// clears the existing network first.
+func (h *GeoHandler) ImportRoads(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	var collection geoJSONFeatureCollection
+	if err := json.Unmarshal(body, &collection); err != nil || collection.Type != "FeatureCollection" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Body must be a GeoJSON FeatureCollection"})
+		return
+	}
+
+	var segments []models.RoadSegment
+	skipped := 0
+	for i, feature := range collection.Features {
+		var lines [][][]float64
+		switch feature.Geometry.Type {
+		case "LineString":
+			var line [][]float64
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &line); err != nil {
+				skipped++
+				continue
+			}
+			lines = [][][]float64{line}
+		case "MultiLineString":
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &lines); err != nil {
+				skipped++
+				continue
+			}
+		default:
+			skipped++
+			continue
+		}
+
+		segmentID := fmt.Sprintf("%d", i+1)
+		if feature.ID != nil {
+			segmentID = fmt.Sprintf("%v", feature.ID)
+		} else if id, ok := feature.Properties["id"]; ok {
+			segmentID = fmt.Sprintf("%v", id)
+		}
+		name, _ := feature.Properties["name"].(string)
+		ref, _ := feature.Properties["ref"].(string)
+
+		for _, line := range lines {
+			segment, ok := roadSegmentFromLine(segmentID, name, ref, line)
+			if !ok {
+				skipped++
+				continue
+			}
+			segments = append(segments, segment)
+		}
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if c.Query("replace") == "true" {
+			if err := tx.Where("1 = 1").Delete(&models.RoadSegment{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(segments) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&segments, 500).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Road network imported",
+		"imported": len(segments),
+		"skipped":  skipped,
+	})
+}
+
+// roadSegmentFromLine builds a segment from GeoJSON [lon, lat] positions
+func roadSegmentFromLine(segmentID, name, ref string, line [][]float64) (models.RoadSegment, bool) {
+	if len(line) < 2 {
+		return models.RoadSegment{}, false
+	}
+
+	segment := models.RoadSegment{
+		SegmentID: segmentID,
+		Name:      name,
+		Ref:       ref,
+		MinLat:    math.Inf(1),
+		MaxLat:    math.Inf(-1),
+		MinLon:    math.Inf(1),
+		MaxLon:    math.Inf(-1),
+	}
+
+	for _, position := range line {
+		if len(position) < 2 {
+			return models.RoadSegment{}, false
+		}
+		point := models.GeoPoint{Lat: position[1], Lon: position[0]}
+		segment.Geometry = append(segment.Geometry, point)
+		segment.MinLat = math.Min(segment.MinLat, point.Lat)
+		segment.MaxLat = math.Max(segment.MaxLat, point.Lat)
+		segment.MinLon = math.Min(segment.MinLon, point.Lon)
+		segment.MaxLon = math.Max(segment.MaxLon, point.Lon)
+	}
+
+	return segment, true
+}
+
+// GetRoadStats handles GET /roads
+func (h *GeoHandler) GetRoadStats(c *gin.Context) {
+	var count int64
+	if err := h.DB.Model(&models.RoadSegment{}).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"segments": count})
+}
+
+// LocateNearest handles GET /roads/nearest?lat=&lon=
+// Returns what an alert at that position would be enriched with
+func (h *GeoHandler) LocateNearest(c *gin.Context) {
+	lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+	lon, errLon := strconv.ParseFloat(c.Query("lon"), 64)
+	if errLat != nil || errLon != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lon are required"})
+		return
+	}
+
+	event := models.SecurityEvent{RawData: fmt.Sprintf(`{"details":{"latitude":%f,"longitude":%f}}`, lat, lon)}
+	var alert models.Alert
+	siem.EnrichAlert(h.DB, &alert, &event)
+
+	c.JSON(http.StatusOK, gin.H{
+		"nearest_rsu":     alert.NearestRSU,
+		"rsu_distance_m":  alert.RSUDistanceM,
+		"road_name":       alert.RoadName,
+		"road_segment":    alert.RoadSegment,
+		"road_distance_m": alert.RoadDistanceM,
+	})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// GeofenceHandler handles geofence and region-of-interest endpoints
+type GeofenceHandler struct {
+	DB *gorm.DB
+}
+
+// NewGeofenceHandler creates a new GeofenceHandler
+func NewGeofenceHandler(db *gorm.DB) *GeofenceHandler {
+	return &GeofenceHandler{DB: db}
+}
+
+// GetGeofences handles GET /geofences
+// Filters by kind (zone or odd)
+func (h *GeofenceHandler) GetGeofences(c *gin.Context) {
+	query := h.DB.Order("name ASC")
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var fences []models.Geofence
+	if err := query.Find(&fences).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, fences)
+}
+
+// GetGeofence handles GET /geofences/:id
+func (h *GeofenceHandler) GetGeofence(c *gin.Context) {
+	fence, ok := h.findGeofence(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, fence)
+}
+
+// CreateGeofence handles POST /geofences
+// Takes a polygon (polygon: [{lat, lon}, ...]) or a circle (center_lat,
+// center_lon, radius_m)
+func (h *GeofenceHandler) CreateGeofence(c *gin.Context) {
+	fence := models.Geofence{Enabled: true}
+	if err := c.ShouldBindJSON(&fence); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := siem.NormalizeGeofence(&fence); err != nil {
+		respondValidation(c, err)
+		return
+	}
+
+	if err := h.DB.Create(&fence).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateGeofences()
+
+	c.JSON(http.StatusCreated, fence)
+}
+
+// UpdateGeofence handles PUT /geofences/:id
+// A geofence referenced by rule conditions cannot be renamed
+func (h *GeofenceHandler) UpdateGeofence(c *gin.Context) {
+	fence, ok := h.findGeofence(c)
+	if !ok {
+		return
+	}
+
+	name := fence.Name
+	if err := c.ShouldBindJSON(fence); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := siem.NormalizeGeofence(fence); err != nil {
+		respondValidation(c, err)
+		return
+	}
+	if fence.Name != name && !h.checkUnreferenced(c, name) {
+		return
+	}
+
+	if err := h.DB.Save(fence).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateGeofences()
+
+	c.JSON(http.StatusOK, fence)
+}
+
+// DeleteGeofence handles DELETE /geofences/:id
+// A geofence referenced by rule conditions cannot be deleted
+func (h *GeofenceHandler) DeleteGeofence(c *gin.Context) {
+	fence, ok := h.findGeofence(c)
+	if !ok {
+		return
+	}
+	if !h.checkUnreferenced(c, fence.Name) {
+		return
+	}
+
+	if err := h.DB.Delete(fence).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateGeofences()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Geofence deleted successfully"})
+}
+
+// GetContainingGeofences handles GET /geofences/containing?lat=..&lon=..
+// Lists the enabled geofences a coordinate lies inside
+func (h *GeofenceHandler) GetContainingGeofences(c *gin.Context) {
+	lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+	lon, errLon := strconv.ParseFloat(c.Query("lon"), 64)
+	if errLat != nil || errLon != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lon are required"})
+		return
+	}
+
+	fences, err := siem.GeofencesContaining(h.DB, lat, lon)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, fences)
+}
+
+// checkUnreferenced answers 409 when rule conditions test the named geofence
+func (h *GeofenceHandler) checkUnreferenced(c *gin.Context, name string) bool {
+	rules, err := siem.RulesReferencingGeofence(h.DB, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if len(rules) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Geofence is referenced by rules", "rules": rules})
+		return false
+	}
+	return true
+}
+
+// findGeofence loads the geofence named by the :id parameter, answering the request when it cannot
+func (h *GeofenceHandler) findGeofence(c *gin.Context) (*models.Geofence, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid geofence ID"})
+		return nil, false
+	}
+
+	var fence models.Geofence
+	if err := h.DB.First(&fence, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Geofence not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &fence, true
+}
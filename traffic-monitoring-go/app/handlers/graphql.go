@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/graphql"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// GraphQLHandler handles the GraphQL API, which joins events, alerts, rules
+// and vehicles in one request
+type GraphQLHandler struct {
+	DB         *gorm.DB
+	Correlator *siem.VehicleCorrelator
+	Schema     *graphql.Schema
+}
+
+// NewGraphQLHandler creates a new GraphQLHandler
+func NewGraphQLHandler(db *gorm.DB) *GraphQLHandler {
+	return &GraphQLHandler{
+		DB:         db,
+		Correlator: siem.NewVehicleCorrelator(database.ReadDB(db)),
+		Schema:     graphqlSchema,
+	}
+}
+
+// Query handles POST /graphql and GET /graphql
+// Runs a query given as {query, operationName, variables} JSON, or as the
+// query, operationName and variables (a JSON object) parameters of a GET.
+// Field errors are reported in the errors of a 200 response beside the data
+// that could be resolved; malformed or invalid queries get a 400.
+func (h *GraphQLHandler) Query(c *gin.Context) {
+	var req graphql.Request
+	if c.Request.Method == http.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variables, expected a JSON object"})
+				return
+			}
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query is required"})
+		return
+	}
+
+	loader := newGraphQLLoader(database.ReadDB(h.DB), h.Correlator, middleware.CurrentOrganization(c))
+	ctx := context.WithValue(c.Request.Context(), graphqlLoaderKey{}, loader)
+	resp := h.Schema.Execute(ctx, req)
+
+	status := http.StatusOK
+	if !resp.Executed() {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, resp)
+}
+
+// GetSchema handles GET /graphql/schema
+// The schema in the GraphQL schema definition language, for client code generators
+func (h *GraphQLHandler) GetSchema(c *gin.Context) {
+	c.String(http.StatusOK, h.Schema.SDL())
+}
+
+// graphqlLoaderKey is the context key of the request's graphqlLoader
+type graphqlLoaderKey struct{}
+
+// graphqlLoader loads the rows one GraphQL request joins, each once. Lists
+// announce the IDs their items refer to, and the first lookup of an
+// announced ID loads all of them in one query: the rules of a page of alerts
+// cost one query rather than one per alert. A caller acting for one
+// organization sees its own events and alerts, and its own and shared rules.
+type graphqlLoader struct {
+	db             *gorm.DB
+	correlator     *siem.VehicleCorrelator
+	tracker        *siem.VehicleCorrelator // reads the tracks of the caller's events
+	organizationID *uint
+
+	rules       *batchLoader // models.Rule by ID
+	events      *batchLoader // models.SecurityEvent by ID
+	logSources  *batchLoader // models.LogSource by ID
+	eventAlerts *batchLoader // []models.Alert by security event ID
+	vehicles    map[string]*graphqlVehicle
+}
+
+func newGraphQLLoader(db *gorm.DB, correlator *siem.VehicleCorrelator, organizationID *uint) *graphqlLoader {
+	l := &graphqlLoader{db: db, correlator: correlator, organizationID: organizationID, vehicles: map[string]*graphqlVehicle{}}
+	tracker := *correlator
+	tracker.DB = correlator.DB.Scopes(l.tenant("organization_id")).Session(&gorm.Session{})
+	l.tracker = &tracker
+
+	l.rules = newBatchLoader(func(ids []uint) (map[uint]interface{}, error) {
+		var rules []models.Rule
+		if err := db.Scopes(l.sharedTenant("organization_id")).Where("id IN ?", ids).Find(&rules).Error; err != nil {
+			return nil, err
+		}
+		rows := make(map[uint]interface{}, len(rules))
+		for _, rule := range rules {
+			rows[rule.ID] = rule
+		}
+		return rows, nil
+	})
+
+	l.events = newBatchLoader(func(ids []uint) (map[uint]interface{}, error) {
+		var events []models.SecurityEvent
+		if err := db.Scopes(l.tenant("organization_id")).Where("id IN ?", ids).Find(&events).Error; err != nil {
+			return nil, err
+		}
+		rows := make(map[uint]interface{}, len(events))
+		for _, event := range events {
+			rows[event.ID] = event
+		}
+		l.announceEvents(events)
+		return rows, nil
+	})
+
+	l.logSources = newBatchLoader(func(ids []uint) (map[uint]interface{}, error) {
+		var sources []models.LogSource
+		if err := db.Where("id IN ?", ids).Find(&sources).Error; err != nil {
+			return nil, err
+		}
+		rows := make(map[uint]interface{}, len(sources))
+		for _, source := range sources {
+			rows[source.ID] = source
+		}
+		return rows, nil
+	})
+
+	l.eventAlerts = newBatchLoader(func(ids []uint) (map[uint]interface{}, error) {
+		var alerts []models.Alert
+		if err := db.Scopes(l.tenant("organization_id")).Where("security_event_id IN ?", ids).Order("timestamp ASC, id ASC").Find(&alerts).Error; err != nil {
+			return nil, err
+		}
+		byEvent := make(map[uint][]models.Alert, len(ids))
+		for _, alert := range alerts {
+			byEvent[alert.SecurityEventID] = append(byEvent[alert.SecurityEventID], alert)
+		}
+		rows := make(map[uint]interface{}, len(ids))
+		for _, id := range ids {
+			rows[id] = append([]models.Alert{}, byEvent[id]...)
+		}
+		l.announceAlerts(alerts)
+		return rows, nil
+	})
+	return l
+}
+
+// tenant restricts a query to the rows of the caller's organization
+func (l *graphqlLoader) tenant(column string) func(*gorm.DB) *gorm.DB {
+	return organizationScope(l.organizationID, column)
+}
+
+// sharedTenant also admits the rows shared by every tenant
+func (l *graphqlLoader) sharedTenant(column string) func(*gorm.DB) *gorm.DB {
+	return sharedOrganizationScope(l.organizationID, column)
+}
+
+// loaderFrom returns the loader of the request a resolver runs for
+func loaderFrom(ctx context.Context) *graphqlLoader {
+	return ctx.Value(graphqlLoaderKey{}).(*graphqlLoader)
+}
+
+// announceEvents prepares the rows events refer to, to be loaded together
+func (l *graphqlLoader) announceEvents(events []models.SecurityEvent) {
+	for _, event := range events {
+		l.logSources.want(event.LogSourceID)
+		l.eventAlerts.want(event.ID)
+	}
+}
+
+// announceAlerts prepares the rows alerts refer to, to be loaded together
+func (l *graphqlLoader) announceAlerts(alerts []models.Alert) {
+	for _, alert := range alerts {
+		l.rules.want(alert.RuleID)
+		l.events.want(alert.SecurityEventID)
+	}
+}
+
+// vehicle returns a vehicle with the source IDs linked to it on the other radio
+func (l *graphqlLoader) vehicle(id string) (*graphqlVehicle, error) {
+	if vehicle, ok := l.vehicles[id]; ok {
+		return vehicle, nil
+	}
+	ids, _, err := l.correlator.LinkedIDs(id)
+	if err != nil {
+		return nil, err
+	}
+	vehicle := &graphqlVehicle{ID: id, LinkedIDs: ids[1:], ids: ids}
+	l.vehicles[id] = vehicle
+	return vehicle, nil
+}
+
+// batchLoader loads rows of one kind by ID, keeping those already loaded
+type batchLoader struct {
+	load    func(ids []uint) (map[uint]interface{}, error)
+	loaded  map[uint]interface{}
+	pending map[uint]bool
+}
+
+func newBatchLoader(load func(ids []uint) (map[uint]interface{}, error)) *batchLoader {
+	return &batchLoader{load: load, loaded: map[uint]interface{}{}, pending: map[uint]bool{}}
+}
+
+// want announces an ID to load with the next lookup
+func (b *batchLoader) want(ids ...uint) {
+	for _, id := range ids {
+		if _, ok := b.loaded[id]; !ok {
+			b.pending[id] = true
+		}
+	}
+}
+
+// get returns the row of an ID, or nil when there is none, loading every
+// announced ID along with it
+func (b *batchLoader) get(id uint) (interface{}, error) {
+	if row, ok := b.loaded[id]; ok {
+		return row, nil
+	}
+	b.pending[id] = true
+	ids := make([]uint, 0, len(b.pending))
+	for pending := range b.pending {
+		ids = append(ids, pending)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	b.pending = map[uint]bool{}
+
+	rows, err := b.load(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, loaded := range ids {
+		b.loaded[loaded] = rows[loaded]
+	}
+	return b.loaded[id], nil
+}
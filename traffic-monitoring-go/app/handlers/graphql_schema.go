@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/graphql"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+const (
+	// graphqlMaxDepth bounds how deeply a GraphQL query nests fields
+	graphqlMaxDepth = 10
+
+	// graphqlMaxComplexity bounds the fields a GraphQL query may resolve,
+	// counting those of list items once per item a page may hold
+	graphqlMaxComplexity = 25000
+
+	// graphqlMaxPageSize bounds the page_size of GraphQL lists
+	graphqlMaxPageSize = 500
+
+	// graphqlMaxTrackPoints bounds the points of one vehicle track
+	graphqlMaxTrackPoints = 5000
+
+	// graphqlMaxTrackWindow bounds the time range of one vehicle track
+	graphqlMaxTrackWindow = 24 * time.Hour
+)
+
+// graphqlPage is a page of a GraphQL list
+type graphqlPage struct {
+	Items    interface{} `json:"items"`
+	Total    int64       `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+}
+
+// graphqlVehicle is a vehicle, known by one of its source IDs
+type graphqlVehicle struct {
+	ID        string   `json:"id"`
+	LinkedIDs []string `json:"linked_ids"` // source IDs of the vehicle on the other radio
+	ids       []string // ID and the linked IDs
+}
+
+// graphqlTrackPoint is one report of a vehicle
+type graphqlTrackPoint struct {
+	Timestamp   time.Time `json:"timestamp"`
+	SourceID    string    `json:"source_id"`
+	Radio       string    `json:"radio"`
+	MessageType string    `json:"message_type"`
+	Receiver    string    `json:"receiver"`
+	Latitude    *float64  `json:"latitude"`
+	Longitude   *float64  `json:"longitude"`
+	Speed       *float64  `json:"speed"`
+	Heading     *float64  `json:"heading"`
+	EventID     uint      `json:"event_id"`
+}
+
+// graphqlSchema is the schema of the GraphQL API. Field names follow the JSON
+// of the REST API; fields without a resolver are read from the model.
+var graphqlSchema = buildGraphQLSchema()
+
+func buildGraphQLSchema() *graphql.Schema {
+	nonNull := func(t graphql.Type) graphql.Type { return &graphql.NonNull{Of: t} }
+	listOf := func(t graphql.Type) graphql.Type {
+		return &graphql.NonNull{Of: &graphql.List{Of: &graphql.NonNull{Of: t}}}
+	}
+	field := func(name string, t graphql.Type) *graphql.FieldDef { return &graphql.FieldDef{Name: name, Type: t} }
+	pageArgs := func(args ...*graphql.Arg) []*graphql.Arg {
+		return append([]*graphql.Arg{
+			{Name: "page", Type: graphql.Int, Default: 1},
+			{Name: "page_size", Type: graphql.Int, Default: 50, Description: "at most 500"},
+		}, args...)
+	}
+	idArg := []*graphql.Arg{{Name: "id", Type: nonNull(graphql.ID)}}
+
+	event := &graphql.Object{Name: "SecurityEvent", Description: "A normalized security event"}
+	alert := &graphql.Object{Name: "Alert", Description: "An alert raised by a rule on an event"}
+	rule := &graphql.Object{Name: "Rule", Description: "A detection rule"}
+	logSource := &graphql.Object{Name: "LogSource", Description: "A source of security events"}
+	vehicle := &graphql.Object{Name: "Vehicle", Description: "A vehicle, with its source IDs on both V2X radios"}
+	trackPoint := &graphql.Object{Name: "TrackPoint", Description: "A V2X report of a vehicle"}
+	page := func(name string, item *graphql.Object) *graphql.Object {
+		return &graphql.Object{Name: name, Fields: []*graphql.FieldDef{
+			field("items", listOf(item)),
+			field("total", nonNull(graphql.Int)),
+			field("page", nonNull(graphql.Int)),
+			field("page_size", nonNull(graphql.Int)),
+		}}
+	}
+	eventPage, alertPage, rulePage := page("SecurityEventPage", event), page("AlertPage", alert), page("RulePage", rule)
+
+	logSource.Fields = []*graphql.FieldDef{
+		field("id", nonNull(graphql.ID)),
+		field("name", nonNull(graphql.String)),
+		field("type", nonNull(graphql.String)),
+		field("description", graphql.String),
+		field("enabled", nonNull(graphql.Boolean)),
+	}
+
+	event.Fields = []*graphql.FieldDef{
+		field("id", nonNull(graphql.ID)),
+		field("timestamp", nonNull(graphql.Time)),
+		field("source_ip", graphql.String),
+		field("source_port", graphql.Int),
+		field("destination_ip", graphql.String),
+		field("destination_port", graphql.Int),
+		field("protocol", graphql.String),
+		field("action", graphql.String),
+		field("status", graphql.String),
+		field("device_id", graphql.String),
+		field("log_source_id", nonNull(graphql.Int)),
+		field("severity", nonNull(graphql.String)),
+		field("category", nonNull(graphql.String)),
+		field("message", nonNull(graphql.String)),
+		field("raw_data", graphql.String),
+		field("trust_score", graphql.Float),
+		field("created_at", nonNull(graphql.Time)),
+		{Name: "log_source", Type: logSource, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return loaderFrom(p.Context).logSources.get(p.Source.(models.SecurityEvent).LogSourceID)
+		}},
+		{Name: "alerts", Type: listOf(alert), Description: "The alerts raised on the event",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return loaderFrom(p.Context).eventAlerts.get(p.Source.(models.SecurityEvent).ID)
+			}},
+		{Name: "vehicle_id", Type: graphql.String, Description: "The source ID that sent a V2X event",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				event := p.Source.(models.SecurityEvent)
+				if obs, ok := siem.ParseV2XObservation(&event, ""); ok {
+					return obs.VehicleID, nil
+				}
+				return nil, nil
+			}},
+		{Name: "vehicle", Type: vehicle, Description: "The vehicle that sent a V2X event",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				event := p.Source.(models.SecurityEvent)
+				obs, ok := siem.ParseV2XObservation(&event, "")
+				if !ok {
+					return nil, nil
+				}
+				return loaderFrom(p.Context).vehicle(obs.VehicleID)
+			}},
+	}
+
+	alert.Fields = []*graphql.FieldDef{
+		field("id", nonNull(graphql.ID)),
+		field("rule_id", nonNull(graphql.Int)),
+		field("security_event_id", nonNull(graphql.Int)),
+		field("timestamp", nonNull(graphql.Time)),
+		field("severity", nonNull(graphql.String)),
+		field("status", nonNull(graphql.String)),
+		field("assigned_to", graphql.Int),
+		field("resolution", graphql.String),
+		field("latitude", graphql.Float),
+		field("longitude", graphql.Float),
+		field("nearest_rsu", graphql.String),
+		field("road_name", graphql.String),
+		field("techniques", listOf(graphql.String)),
+		field("v2x_threats", listOf(graphql.String)),
+		field("late_evaluated", nonNull(graphql.Boolean)),
+		field("created_at", nonNull(graphql.Time)),
+		field("updated_at", nonNull(graphql.Time)),
+		{Name: "rule", Type: rule, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return loaderFrom(p.Context).rules.get(p.Source.(models.Alert).RuleID)
+		}},
+		{Name: "event", Type: event, Description: "The event the alert was raised on",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return loaderFrom(p.Context).events.get(p.Source.(models.Alert).SecurityEventID)
+			}},
+	}
+
+	rule.Fields = []*graphql.FieldDef{
+		field("id", nonNull(graphql.ID)),
+		field("name", nonNull(graphql.String)),
+		field("description", graphql.String),
+		field("condition", nonNull(graphql.String)),
+		field("severity", nonNull(graphql.String)),
+		field("category", nonNull(graphql.String)),
+		field("status", nonNull(graphql.String)),
+		field("techniques", listOf(graphql.String)),
+		field("v2x_threats", listOf(graphql.String)),
+		field("created_at", nonNull(graphql.Time)),
+		field("updated_at", nonNull(graphql.Time)),
+		{Name: "alerts", Type: nonNull(alertPage), Description: "The alerts the rule raised, newest first",
+			Args: pageArgs(&graphql.Arg{Name: "status", Type: graphql.String}), SizeArg: "page_size",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				p.Args["rule_id"] = int(p.Source.(models.Rule).ID)
+				return resolveAlerts(p)
+			}},
+	}
+
+	vehicle.Fields = []*graphql.FieldDef{
+		field("id", nonNull(graphql.ID)),
+		field("linked_ids", listOf(graphql.String)),
+		{Name: "track", Type: listOf(trackPoint),
+			Description: "The vehicle's reports from all its source IDs, oldest first; from defaults to an hour before to, to to now, and they may be at most 24 hours apart",
+			Args: []*graphql.Arg{
+				{Name: "from", Type: graphql.Time},
+				{Name: "to", Type: graphql.Time},
+				{Name: "limit", Type: graphql.Int, Default: 500, Description: "at most 5000"},
+			},
+			SizeArg: "limit",
+			Resolve: resolveTrack},
+	}
+
+	trackPoint.Fields = []*graphql.FieldDef{
+		field("timestamp", nonNull(graphql.Time)),
+		field("source_id", nonNull(graphql.String)),
+		field("radio", graphql.String),
+		field("message_type", graphql.String),
+		field("receiver", graphql.String),
+		field("latitude", graphql.Float),
+		field("longitude", graphql.Float),
+		field("speed", graphql.Float),
+		field("heading", graphql.Float),
+		field("event_id", nonNull(graphql.ID)),
+		{Name: "event", Type: event, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return loaderFrom(p.Context).events.get(p.Source.(graphqlTrackPoint).EventID)
+		}},
+	}
+
+	query := &graphql.Object{Name: "Query", Fields: []*graphql.FieldDef{
+		{Name: "events", Type: nonNull(eventPage), Description: "Security events, newest first",
+			Args: pageArgs(
+				&graphql.Arg{Name: "severity", Type: graphql.String},
+				&graphql.Arg{Name: "category", Type: graphql.String},
+				&graphql.Arg{Name: "source_ip", Type: graphql.String},
+				&graphql.Arg{Name: "destination_ip", Type: graphql.String},
+				&graphql.Arg{Name: "log_source_id", Type: graphql.Int},
+				&graphql.Arg{Name: "from", Type: graphql.Time},
+				&graphql.Arg{Name: "to", Type: graphql.Time},
+			),
+			SizeArg: "page_size",
+			Resolve: resolveEvents},
+		{Name: "event", Type: event, Args: idArg, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, err := graphqlID(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			return loaderFrom(p.Context).events.get(id)
+		}},
+		{Name: "alerts", Type: nonNull(alertPage), Description: "Alerts, newest first",
+			Args: pageArgs(
+				&graphql.Arg{Name: "severity", Type: graphql.String},
+				&graphql.Arg{Name: "status", Type: graphql.String},
+				&graphql.Arg{Name: "rule_id", Type: graphql.Int},
+				&graphql.Arg{Name: "from", Type: graphql.Time},
+				&graphql.Arg{Name: "to", Type: graphql.Time},
+			),
+			SizeArg: "page_size",
+			Resolve: resolveAlerts},
+		{Name: "alert", Type: alert, Args: idArg, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, err := graphqlID(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			var alert models.Alert
+			loader := loaderFrom(p.Context)
+			if err := loader.db.Scopes(loader.tenant("organization_id")).First(&alert, id).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, nil
+				}
+				return nil, err
+			}
+			loader.announceAlerts([]models.Alert{alert})
+			return alert, nil
+		}},
+		{Name: "rules", Type: nonNull(rulePage), Description: "Detection rules, by ID",
+			Args: pageArgs(
+				&graphql.Arg{Name: "status", Type: graphql.String},
+				&graphql.Arg{Name: "severity", Type: graphql.String},
+				&graphql.Arg{Name: "category", Type: graphql.String},
+			),
+			SizeArg: "page_size",
+			Resolve: resolveRules},
+		{Name: "rule", Type: rule, Args: idArg, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, err := graphqlID(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			return loaderFrom(p.Context).rules.get(id)
+		}},
+		{Name: "vehicle", Type: nonNull(vehicle), Description: "A vehicle by any of its source IDs",
+			Args: []*graphql.Arg{{Name: "id", Type: nonNull(graphql.String)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return loaderFrom(p.Context).vehicle(p.Args["id"].(string))
+			}},
+	}}
+
+	schema, err := graphql.NewSchema(query)
+	if err != nil {
+		panic(err)
+	}
+	schema.MaxDepth = graphqlMaxDepth
+	schema.MaxComplexity = graphqlMaxComplexity
+	return schema
+}
+
+// resolveEvents lists security events matching the arguments of Query.events
+func resolveEvents(p graphql.ResolveParams) (interface{}, error) {
+	page, err := graphqlPageArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	loader := loaderFrom(p.Context)
+
+	query := loader.db.Model(&models.SecurityEvent{}).Scopes(loader.tenant("organization_id"))
+	query = whereArgs(query, p.Args, "severity", "category", "source_ip", "destination_ip", "log_source_id")
+	query = whereTimeArgs(query, p.Args, "timestamp")
+
+	var events []models.SecurityEvent
+	if err := fetchPage(query, page, "timestamp DESC, id DESC", &events); err != nil {
+		return nil, err
+	}
+	loader.announceEvents(events)
+	page.Items = events
+	return page, nil
+}
+
+// resolveAlerts lists alerts matching the arguments of Query.alerts
+func resolveAlerts(p graphql.ResolveParams) (interface{}, error) {
+	page, err := graphqlPageArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	loader := loaderFrom(p.Context)
+
+	query := loader.db.Model(&models.Alert{}).Scopes(loader.tenant("organization_id"))
+	query = whereArgs(query, p.Args, "severity", "status", "rule_id")
+	query = whereTimeArgs(query, p.Args, "timestamp")
+
+	var alerts []models.Alert
+	if err := fetchPage(query, page, "timestamp DESC, id DESC", &alerts); err != nil {
+		return nil, err
+	}
+	loader.announceAlerts(alerts)
+	page.Items = alerts
+	return page, nil
+}
+
+// resolveRules lists rules matching the arguments of Query.rules
+func resolveRules(p graphql.ResolveParams) (interface{}, error) {
+	page, err := graphqlPageArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := loaderFrom(p.Context)
+	query := loader.db.Model(&models.Rule{}).Scopes(loader.sharedTenant("organization_id"))
+	query = whereArgs(query, p.Args, "status", "severity", "category")
+
+	var rules []models.Rule
+	if err := fetchPage(query, page, "id ASC", &rules); err != nil {
+		return nil, err
+	}
+	page.Items = rules
+	return page, nil
+}
+
+// resolveTrack lists the reports of a vehicle from all its source IDs
+func resolveTrack(p graphql.ResolveParams) (interface{}, error) {
+	vehicle := p.Source.(graphqlVehicle)
+	loader := loaderFrom(p.Context)
+
+	to, ok := p.Args["to"].(time.Time)
+	if !ok {
+		to = loader.correlator.Clock.Now()
+	}
+	from, ok := p.Args["from"].(time.Time)
+	if !ok {
+		from = to.Add(-time.Hour)
+	}
+	if !to.After(from) {
+		return nil, errors.New("to must be after from")
+	}
+	if to.Sub(from) > graphqlMaxTrackWindow {
+		return nil, errors.New("the time range may span at most 24 hours")
+	}
+	limit, _ := p.Args["limit"].(int)
+	if limit < 1 || limit > graphqlMaxTrackPoints {
+		return nil, fmt.Errorf("limit must be between 1 and %d", graphqlMaxTrackPoints)
+	}
+
+	observations, err := loader.tracker.Track(vehicle.ids, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]graphqlTrackPoint, len(observations))
+	for i, obs := range observations {
+		point := graphqlTrackPoint{
+			Timestamp:   obs.Generated,
+			SourceID:    obs.VehicleID,
+			Radio:       string(obs.Radio),
+			MessageType: obs.MessageType,
+			Receiver:    obs.Receiver,
+			EventID:     obs.EventID,
+		}
+		if obs.HasLocation {
+			lat, lon := obs.Latitude, obs.Longitude
+			point.Latitude, point.Longitude = &lat, &lon
+		}
+		if obs.HasSpeed {
+			speed := obs.Speed
+			point.Speed = &speed
+		}
+		if obs.HasHeading {
+			heading := obs.Heading
+			point.Heading = &heading
+		}
+		points[i] = point
+		loader.events.want(obs.EventID)
+	}
+	return points, nil
+}
+
+// graphqlPageArgs reads the page and page_size arguments of a list
+func graphqlPageArgs(args map[string]interface{}) (*graphqlPage, error) {
+	page, _ := args["page"].(int)
+	pageSize, _ := args["page_size"].(int)
+	if page < 1 {
+		return nil, errors.New("page must be at least 1")
+	}
+	if pageSize < 1 || pageSize > graphqlMaxPageSize {
+		return nil, fmt.Errorf("page_size must be between 1 and %d", graphqlMaxPageSize)
+	}
+	return &graphqlPage{Page: page, PageSize: pageSize}, nil
+}
+
+// fetchPage counts the rows of query into page and loads the page's rows into dest
+func fetchPage(query *gorm.DB, page *graphqlPage, order string, dest interface{}) error {
+	// a new session, so the count does not carry over into the find
+	query = query.Session(&gorm.Session{})
+	if err := query.Count(&page.Total).Error; err != nil {
+		return err
+	}
+	return query.Order(order).Offset((page.Page - 1) * page.PageSize).Limit(page.PageSize).Find(dest).Error
+}
+
+// whereArgs filters query by the given arguments, each named after its column
+func whereArgs(query *gorm.DB, args map[string]interface{}, names ...string) *gorm.DB {
+	for _, name := range names {
+		if value, ok := args[name]; ok && value != nil {
+			query = query.Where(name+" = ?", value)
+		}
+	}
+	return query
+}
+
+// whereTimeArgs bounds column by the from and to arguments
+func whereTimeArgs(query *gorm.DB, args map[string]interface{}, column string) *gorm.DB {
+	if from, ok := args["from"].(time.Time); ok {
+		query = query.Where(column+" >= ?", from)
+	}
+	if to, ok := args["to"].(time.Time); ok {
+		query = query.Where(column+" <= ?", to)
+	}
+	return query
+}
+
+// graphqlID reads the id argument of a model
+func graphqlID(args map[string]interface{}) (uint, error) {
+	id, err := strconv.ParseUint(args["id"].(string), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %q", args["id"])
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// HuntHandler handles threat hunting query endpoints
+type HuntHandler struct {
+	DB *gorm.DB
+}
+
+// NewHuntHandler creates a new HuntHandler
+func NewHuntHandler(db *gorm.DB) *HuntHandler {
+	return &HuntHandler{DB: db}
+}
+
+// loadHunts returns built-in hunts followed by custom hunts, optionally filtered by category
+func (h *HuntHandler) loadHunts(category string) ([]models.HuntQuery, error) {
+	hunts := make([]models.HuntQuery, 0)
+	for _, hunt := range siem.BuiltinHunts() {
+		if category != "" && string(hunt.Category) != category {
+			continue
+		}
+		hunt.Builtin = true
+		hunts = append(hunts, hunt)
+	}
+
+	var custom []models.HuntQuery
+	query := h.DB.Model(&models.HuntQuery{}).Order("name ASC")
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if err := query.Find(&custom).Error; err != nil {
+		return nil, err
+	}
+
+	return append(hunts, custom...), nil
+}
+
+// isBuiltinHuntName reports whether a name is reserved by a built-in hunt
+func isBuiltinHuntName(name string) bool {
+	for _, hunt := range siem.BuiltinHunts() {
+		if strings.EqualFold(hunt.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetHunts handles GET /hunts
+func (h *HuntHandler) GetHunts(c *gin.Context) {
+	hunts, err := h.loadHunts(c.Query("category"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, hunts)
+}
+
+// CreateHunt handles POST /hunts
+func (h *HuntHandler) CreateHunt(c *gin.Context) {
+	var hunt models.HuntQuery
+	if err := c.ShouldBindJSON(&hunt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if hunt.Name == "" || hunt.Query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Hunt name and query are required"})
+		return
+	}
+	if isBuiltinHuntName(hunt.Name) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A built-in hunt with this name already exists"})
+		return
+	}
+
+	if err := h.DB.Create(&hunt).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, hunt)
+}
+
+// DeleteHunt handles DELETE /hunts/:id
+func (h *HuntHandler) DeleteHunt(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hunt ID"})
+		return
+	}
+
+	if err := h.DB.Delete(&models.HuntQuery{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Hunt deleted successfully"})
+}
+
+// ExportHunts handles GET /hunts/export
+// format=json (default) returns parameterized definitions, format=ndjson returns Kibana saved searches
+func (h *HuntHandler) ExportHunts(c *gin.Context) {
+	hunts, err := h.loadHunts(c.Query("category"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.Header("Content-Disposition", "attachment; filename=hunts.json")
+		c.JSON(http.StatusOK, hunts)
+	case "ndjson":
+		data, err := siem.ExportHuntsNDJSON(hunts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=hunts.ndjson")
+		c.Data(http.StatusOK, "application/x-ndjson", data)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format, use json or ndjson"})
+	}
+}
+
+// ImportHunts handles POST /hunts/import
+// Accepts either a JSON array of hunt definitions or Kibana saved searches as NDJSON.
+// Hunts are upserted by name; names reserved by built-in hunts are skipped.
+func (h *HuntHandler) ImportHunts(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	var hunts []models.HuntQuery
+	if c.Query("format") == "ndjson" || strings.Contains(c.ContentType(), "ndjson") {
+		hunts, err = siem.ParseHuntsNDJSON(body)
+	} else {
+		err = json.Unmarshal(body, &hunts)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hunt import: " + err.Error()})
+		return
+	}
+
+	var created, updated int
+	var skipped []string
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		for _, hunt := range hunts {
+			if hunt.Name == "" || hunt.Query == "" || isBuiltinHuntName(hunt.Name) {
+				skipped = append(skipped, hunt.Name)
+				continue
+			}
+
+			var existing models.HuntQuery
+			if err := tx.Where("name = ?", hunt.Name).First(&existing).Error; err == nil {
+				existing.Description = hunt.Description
+				existing.Category = hunt.Category
+				existing.Query = hunt.Query
+				existing.Parameters = hunt.Parameters
+				existing.Columns = hunt.Columns
+				if err := tx.Save(&existing).Error; err != nil {
+					return err
+				}
+				updated++
+				continue
+			}
+
+			hunt.ID = 0
+			if err := tx.Create(&hunt).Error; err != nil {
+				return err
+			}
+			created++
+		}
+		return nil
+	})
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Hunts imported",
+		"created": created,
+		"updated": updated,
+		"skipped": skipped,
+	})
+}
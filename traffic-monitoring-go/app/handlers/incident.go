@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// IncidentHandler handles the incidents grouping related alerts into cases
+type IncidentHandler struct {
+	DB         *gorm.DB
+	Service    *siem.IncidentService
+	Correlator *siem.IncidentCorrelator
+}
+
+// NewIncidentHandler creates a new IncidentHandler
+func NewIncidentHandler(db *gorm.DB) *IncidentHandler {
+	correlator := siem.NewIncidentCorrelator(db)
+	return &IncidentHandler{DB: db, Service: correlator.Service, Correlator: correlator}
+}
+
+// incidentList is how GET /incidents may be sorted and projected
+var incidentList = listSpec{
+	Model: models.Incident{},
+	Sortable: map[string]string{
+		"id":          "id",
+		"status":      "status",
+		"severity":    "severity",
+		"alert_count": "alert_count",
+		"first_seen":  "first_seen",
+		"last_seen":   "last_seen",
+		"created_at":  "created_at",
+		"updated_at":  "updated_at",
+	},
+	DefaultSort: "last_seen:desc",
+}
+
+// incidentActor names the caller in incident timelines
+func incidentActor(c *gin.Context) string {
+	if claims := middleware.CurrentClaims(c); claims != nil {
+		return claims.Actor()
+	}
+	return "anonymous"
+}
+
+// respondIncidentError answers a failed incident change
+func respondIncidentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert, event or user not found"})
+	case errors.Is(err, siem.ErrIncidentClosed), errors.Is(err, siem.ErrAlertInIncident):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, siem.ErrAlertNotInIncident):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// findIncident loads the incident named by the :id parameter, answering the request when it cannot
+func (h *IncidentHandler) findIncident(c *gin.Context) (*models.Incident, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid incident ID"})
+		return nil, false
+	}
+
+	var incident models.Incident
+	if err := h.DB.Preload("Owner").First(&incident, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &incident, true
+}
+
+// respondIncident answers with the incident as it is now
+func (h *IncidentHandler) respondIncident(c *gin.Context, status int, id uint) {
+	var incident models.Incident
+	if err := h.DB.Preload("Owner").First(&incident, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(status, incident)
+}
+
+// GetIncidents handles GET /incidents
+// Filters by status, severity, owner_id and correlated (true for the
+// incidents the correlator opened, false for those opened by hand). Takes the
+// list parameters page, pageSize, sort and fields.
+func (h *IncidentHandler) GetIncidents(c *gin.Context) {
+	list, ok := parseListQuery(c, incidentList)
+	if !ok {
+		return
+	}
+
+	query := database.ReadDB(h.DB).Model(&models.Incident{}).Preload("Owner")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if severity := c.Query("severity"); severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+	if ownerID := c.Query("owner_id"); ownerID != "" {
+		query = query.Where("owner_id = ?", ownerID)
+	}
+	switch c.Query("correlated") {
+	case "true":
+		query = query.Where("correlation_key <> ''")
+	case "false":
+		query = query.Where("correlation_key = ''")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var incidents []models.Incident
+	if err := list.paginate(query).Find(&incidents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, incidents, total, list)
+}
+
+// GetIncident handles GET /incidents/:id
+// Returns the incident with its alerts, oldest first
+func (h *IncidentHandler) GetIncident(c *gin.Context) {
+	incident, ok := h.findIncident(c)
+	if !ok {
+		return
+	}
+
+	var alerts []models.Alert
+	if err := database.ReadDB(h.DB).Preload("Rule").Where("incident_id = ?", incident.ID).
+		Order("timestamp ASC, id ASC").Find(&alerts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"incident": incident, "alerts": alerts})
+}
+
+// createIncidentRequest is the body of POST /incidents
+type createIncidentRequest struct {
+	Title       string               `json:"title" binding:"required"`
+	Description string               `json:"description"`
+	Severity    models.EventSeverity `json:"severity"` // the highest of the alerts when empty
+	OwnerID     *uint                `json:"owner_id"`
+	AlertIDs    []uint               `json:"alert_ids"`
+}
+
+// CreateIncident handles POST /incidents
+// Opens an incident by hand, with the alerts listed in alert_ids
+func (h *IncidentHandler) CreateIncident(c *gin.Context) {
+	var request createIncidentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Severity != "" && !models.ValidSeverity(request.Severity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid severity: " + string(request.Severity)})
+		return
+	}
+
+	incident := models.Incident{
+		Title:       request.Title,
+		Description: request.Description,
+		Severity:    request.Severity,
+	}
+	if request.OwnerID != nil && *request.OwnerID != 0 {
+		var owner models.User
+		if err := h.DB.Select("id").First(&owner, *request.OwnerID).Error; err != nil {
+			respondIncidentError(c, err)
+			return
+		}
+		incident.OwnerID = request.OwnerID
+	}
+
+	if err := h.Service.Create(&incident, request.AlertIDs, incidentActor(c)); err != nil {
+		respondIncidentError(c, err)
+		return
+	}
+
+	h.respondIncident(c, http.StatusCreated, incident.ID)
+}
+
+// updateIncidentRequest is the body of PUT /incidents/:id
+type updateIncidentRequest struct {
+	Title       *string                `json:"title"`
+	Description *string                `json:"description"`
+	Status      *models.IncidentStatus `json:"status"`
+	Severity    *models.EventSeverity  `json:"severity"`
+	OwnerID     *uint                  `json:"owner_id"` // 0 removes the owner
+}
+
+// UpdateIncident handles PUT /incidents/:id
+// Changes the title, description, status, severity or owner of an incident;
+// status and owner changes are added to its timeline
+func (h *IncidentHandler) UpdateIncident(c *gin.Context) {
+	incident, ok := h.findIncident(c)
+	if !ok {
+		return
+	}
+
+	var request updateIncidentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Title != nil && *request.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Incident title is required"})
+		return
+	}
+	if request.Status != nil && !models.ValidIncidentStatus(*request.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status: " + string(*request.Status)})
+		return
+	}
+	if request.Severity != nil && !models.ValidSeverity(*request.Severity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid severity: " + string(*request.Severity)})
+		return
+	}
+
+	if err := h.Service.Update(incident, siem.IncidentUpdate{
+		Title:       request.Title,
+		Description: request.Description,
+		Status:      request.Status,
+		Severity:    request.Severity,
+		OwnerID:     request.OwnerID,
+	}, incidentActor(c)); err != nil {
+		respondIncidentError(c, err)
+		return
+	}
+
+	h.respondIncident(c, http.StatusOK, incident.ID)
+}
+
+// incidentAlertsRequest is the body of POST /incidents/:id/alerts
+type incidentAlertsRequest struct {
+	AlertIDs []uint `json:"alert_ids" binding:"required,min=1"`
+}
+
+// AddIncidentAlerts handles POST /incidents/:id/alerts
+// Adds the alerts in alert_ids; an alert of another incident has to be removed from it first
+func (h *IncidentHandler) AddIncidentAlerts(c *gin.Context) {
+	incident, ok := h.findIncident(c)
+	if !ok {
+		return
+	}
+
+	var request incidentAlertsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Service.AddAlerts(incident, request.AlertIDs, incidentActor(c)); err != nil {
+		respondIncidentError(c, err)
+		return
+	}
+
+	h.respondIncident(c, http.StatusOK, incident.ID)
+}
+
+// RemoveIncidentAlert handles DELETE /incidents/:id/alerts/:alertId
+func (h *IncidentHandler) RemoveIncidentAlert(c *gin.Context) {
+	incident, ok := h.findIncident(c)
+	if !ok {
+		return
+	}
+
+	alertID, err := strconv.ParseUint(c.Param("alertId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		return
+	}
+
+	if err := h.Service.RemoveAlert(incident, uint(alertID), incidentActor(c)); err != nil {
+		respondIncidentError(c, err)
+		return
+	}
+
+	h.respondIncident(c, http.StatusOK, incident.ID)
+}
+
+// incidentEventsRequest is the body of POST /incidents/:id/events
+type incidentEventsRequest struct {
+	EventIDs []uint `json:"event_ids" binding:"required,min=1"`
+}
+
+// GetIncidentEvents handles GET /incidents/:id/events
+// Returns the security events of the incident's alerts and those linked to it, oldest first
+func (h *IncidentHandler) GetIncidentEvents(c *gin.Context) {
+	incident, ok := h.findIncident(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.Service.Events(incident)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": events})
+}
+
+// LinkIncidentEvents handles POST /incidents/:id/events
+// Links the security events in event_ids to the incident besides those of its alerts
+func (h *IncidentHandler) LinkIncidentEvents(c *gin.Context) {
+	incident, ok := h.findIncident(c)
+	if !ok {
+		return
+	}
+
+	var request incidentEventsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Service.LinkEvents(incident, request.EventIDs, incidentActor(c)); err != nil {
+		respondIncidentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Events linked successfully"})
+}
+
+// GetIncidentTimeline handles GET /incidents/:id/timeline
+// Returns what was done to the incident and by whom, oldest first
+func (h *IncidentHandler) GetIncidentTimeline(c *gin.Context) {
+	incident, ok := h.findIncident(c)
+	if !ok {
+		return
+	}
+
+	var entries []models.IncidentEntry
+	if err := database.ReadDB(h.DB).Where("incident_id = ?", incident.ID).
+		Order("created_at ASC, id ASC").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": entries})
+}
+
+// incidentNoteRequest is the body of POST /incidents/:id/notes
+type incidentNoteRequest struct {
+	Message string `json:"message" binding:"required"`
+}
+
+// AddIncidentNote handles POST /incidents/:id/notes
+func (h *IncidentHandler) AddIncidentNote(c *gin.Context) {
+	incident, ok := h.findIncident(c)
+	if !ok {
+		return
+	}
+
+	var request incidentNoteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := h.Service.AddNote(incident, request.Message, incidentActor(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// CorrelateIncidents handles POST /incidents/correlate
+// Runs the incident correlation now instead of waiting for its next run
+func (h *IncidentHandler) CorrelateIncidents(c *gin.Context) {
+	result, err := h.Correlator.Correlate(h.Correlator.Clock.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -1,14 +1,26 @@
 package handlers
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/middleware"
 	"traffic-monitoring-go/app/models"
 	"traffic-monitoring-go/app/siem"
 	"traffic-monitoring-go/app/siem/elasticsearch"
+	"traffic-monitoring-go/app/siem/forwarder"
+	"traffic-monitoring-go/app/siem/live"
+	"traffic-monitoring-go/app/siem/routing"
 )
 
 // IngestionHandler handles event ingestion endpoints
@@ -17,15 +29,21 @@ type IngestionHandler struct {
 	EventIngester     *siem.EventIngester
 	EnhancedRuleEngine *siem.EnhancedRuleEngine
 	ESService         *elasticsearch.Service
+	Log               *logging.Logger
 }
 
 // NewIngestionHandler creates a new IngestionHandler
 func NewIngestionHandler(db *gorm.DB, esService *elasticsearch.Service) *IngestionHandler {
+	// shared by all request workers; stores each event together with its alerts
+	ingester := siem.NewEventIngester(db)
+	ingester.EvaluateRules = true
+
 	return &IngestionHandler{
 		DB:                db,
-		EventIngester:     siem.NewEventIngester(db),
+		EventIngester:     ingester,
 		EnhancedRuleEngine: siem.NewEnhancedRuleEngine(db),
 		ESService:         esService,
+		Log:               logging.New("ingest"),
 	}
 }
 
@@ -38,63 +56,66 @@ func (h *IngestionHandler) IngestEvent(c *gin.Context) {
 		return
 	}
 
-	// Use a transaction for both ingestion and rule evaluation
-	var securityEvent models.SecurityEvent
-	var alerts []models.Alert
-
-	err = h.DB.Transaction(func(tx *gorm.DB) error {
-		// Create a transaction-scoped ingester
-		ingester := siem.NewEventIngester(tx)
-
-		// Process the event
-		if err := ingester.IngestEvent(body); err != nil {
-			return err
-		}
-
-		// Get created event
-		if err := tx.Last(&securityEvent).Error; err != nil {
-			return err
-		}
+	// Measure the pipeline cost of a sample of events, count parse failures by
+	// client, and store the event for the caller
+	sample := siem.StartCostSample()
+	ctx := ingestContext(siem.WithParseSource(siem.WithCostSample(c.Request.Context(), sample),
+		siem.ParseSource{Collector: "api", Address: c.ClientIP(), MessageType: "event"}), c)
 
-		// Create a transaction-scoped rule engine
-		ruleEngine := siem.NewEnhancedRuleEngine(tx)
-
-		// Evaluate rules against the event
-		if err := ruleEngine.EvaluateEvent(&securityEvent); err != nil {
-			return err
-		}
-
-		// Get any alerts created for this event
-		if err := tx.Where("security_event_id = ?", securityEvent.ID).Find(&alerts).Error; err != nil {
-			// Just log the error but don't fail the transaction
-			c.Error(err)
-		}
-
-		return nil
+	// Store the event and evaluate rules against it in one transaction, on an
+	// ingest worker; a full queue is answered with 429 so the client retries
+	var result *siem.IngestResult
+	var ingestErr error
+	err = siem.DefaultIngestPool().Do(c.Request.Context(), "api", func() {
+		result, ingestErr = h.EventIngester.Ingest(ctx, body)
 	})
-
+	if err == nil {
+		err = ingestErr
+	}
+	if errors.Is(err, siem.ErrIngestQueueFull) {
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Ingest queue is full, retry later"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	securityEvent, alerts := *result.Event, result.Alerts
 
 	// Index in Elasticsearch if available
 	if h.ESService != nil {
-		// Index the security event
-		if err := h.ESService.IndexSecurityEvent(&securityEvent); err != nil {
-			// Log the error but don't fail the request
-			c.Error(err)
+		// Index the security event and the findings raised about it
+		for _, event := range result.Events() {
+			if err := h.ESService.IndexSecurityEvent(event); err != nil {
+				// Log the error but don't fail the request
+				h.Log.WithContext(ctx).Sampled("elasticsearch.index").Warn("failed to index event in Elasticsearch",
+					"event_id", event.ID, "error", err)
+				c.Error(err)
+			}
 		}
 
 		// Index any alerts
 		for _, alert := range alerts {
 			if err := h.ESService.IndexAlert(&alert); err != nil {
 				// Log the error but don't fail the request
+				h.Log.WithContext(ctx).Sampled("elasticsearch.index_alert").Warn("failed to index alert in Elasticsearch",
+					"alert_id", alert.ID, "error", err)
 				c.Error(err)
 			}
 		}
 	}
 
+	sample.Stage("indexing")
+
+	// Fan the committed event and its findings out to the configured sinks
+	for _, event := range result.Events() {
+		routing.Route(event)
+		live.Record(event)
+	}
+
+	siem.RecordEventCost(sample, &securityEvent)
+
 	// Check if there were Elasticsearch indexing errors
 	if len(c.Errors) > 0 {
 		c.JSON(http.StatusOK, gin.H{
@@ -111,4 +132,142 @@ func (h *IngestionHandler) IngestEvent(c *gin.Context) {
 		"event_id": securityEvent.ID,
 		"alerts_created": len(alerts),
 	})
-}
\ No newline at end of file
+}
+
+// ingestContext returns ctx storing events for the caller: in its
+// organization, and under the log source of its API key when it sent one
+func ingestContext(ctx context.Context, c *gin.Context) context.Context {
+	ctx = siem.WithOrganization(ctx, middleware.CurrentOrganization(c))
+	if apiKey := middleware.CurrentAPIKey(c); apiKey != nil {
+		ctx = siem.WithLogSource(ctx, apiKey.LogSourceID)
+	}
+	return ctx
+}
+
+// maxBatchBytes bounds the decompressed size of a forwarded batch
+const maxBatchBytes = 256 << 20
+
+// IngestBatch handles POST /ingest/batch
+// Accepts newline-delimited events, optionally gzip-compressed, as sent by edge
+// collectors in store-and-forward mode. Records at queue positions the node has
+// already delivered are skipped, so resending a batch after a lost response is safe.
+func (h *IngestionHandler) IngestBatch(c *gin.Context) {
+	var reader io.Reader = c.Request.Body
+	if c.GetHeader("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gzip body"})
+			return
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	body, err := io.ReadAll(io.LimitReader(reader, maxBatchBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	nodeID := c.GetHeader(forwarder.HeaderEdgeNode)
+	var start forwarder.Position
+	if nodeID != "" {
+		segment, errSegment := strconv.ParseInt(c.GetHeader(forwarder.HeaderQueueSegment), 10, 64)
+		offset, errOffset := strconv.ParseInt(c.GetHeader(forwarder.HeaderQueueOffset), 10, 64)
+		if errSegment != nil || errOffset != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Queue position headers are required with " + forwarder.HeaderEdgeNode})
+			return
+		}
+		start = forwarder.Position{Segment: segment, Offset: offset}
+	}
+
+	var events []*models.SecurityEvent // ingested, with their findings
+	ingested, duplicates, failed := 0, 0, 0
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var checkpoint models.EdgeCheckpoint
+		if nodeID != "" {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("node_id = ?", nodeID).First(&checkpoint).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				checkpoint = models.EdgeCheckpoint{NodeID: nodeID}
+			} else if err != nil {
+				return err
+			}
+		}
+		delivered := forwarder.Position{Segment: checkpoint.Segment, Offset: checkpoint.Offset}
+
+		ingester := siem.NewEventIngester(tx)
+		ingester.EvaluateRules = true
+		ctx := ingestContext(siem.WithParseSource(c.Request.Context(),
+			siem.ParseSource{Collector: "forwarder", Address: c.ClientIP(), MessageType: "event"}), c)
+
+		position := start
+		for _, line := range bytes.Split(bytes.TrimSuffix(body, []byte("\n")), []byte("\n")) {
+			recordPosition := position
+			position.Offset += int64(len(line) + 1)
+
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			if nodeID != "" && recordPosition.Before(delivered) {
+				duplicates++
+				continue
+			}
+
+			// the ingester gives each event a savepoint so one bad record does not abort the batch
+			result, err := ingester.Ingest(ctx, line)
+			if err == nil {
+				ingested++
+				events = append(events, result.Events()...)
+			} else {
+				h.Log.WithContext(ctx).Sampled("ingest.forwarded:"+nodeID).Error("failed to ingest forwarded event",
+					"node", nodeID, "error", err)
+				failed++
+			}
+		}
+
+		if nodeID == "" || !delivered.Before(position) {
+			return nil
+		}
+		checkpoint.Segment = position.Segment
+		checkpoint.Offset = position.Offset
+		checkpoint.EventsReceived += int64(ingested)
+		checkpoint.LastBatchAt = time.Now()
+		return tx.Save(&checkpoint).Error
+	})
+	if err != nil {
+		// the batch may have created log sources that were cached before it rolled back
+		siem.InvalidateLogSources()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, event := range events {
+		if h.ESService != nil {
+			if err := h.ESService.IndexSecurityEvent(event); err != nil {
+				h.Log.WithContext(c.Request.Context()).Sampled("elasticsearch.index").Warn("failed to index forwarded event in Elasticsearch",
+					"event_id", event.ID, "node", nodeID, "error", err)
+			}
+		}
+		routing.Route(event)
+		live.Record(event)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ingested":   ingested,
+		"duplicates": duplicates,
+		"failed":     failed,
+	})
+}
+
+// GetEdgeCheckpoints handles GET /ingest/edges
+// Reports how far each edge collector's forwarded queue has been ingested
+func (h *IngestionHandler) GetEdgeCheckpoints(c *gin.Context) {
+	var checkpoints []models.EdgeCheckpoint
+	if err := h.DB.Order("node_id ASC").Find(&checkpoints).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, checkpoints)
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/eventschema"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// IntersectionHandler handles synthetic intersection scenario endpoints
+type IntersectionHandler struct {
+	DB *gorm.DB
+}
+
+// NewIntersectionHandler creates a new IntersectionHandler
+func NewIntersectionHandler(db *gorm.DB) *IntersectionHandler {
+	return &IntersectionHandler{DB: db}
+}
+
+// GetIntersections handles GET /scenarios/intersections
+// Filters by enabled (true or false)
+func (h *IntersectionHandler) GetIntersections(c *gin.Context) {
+	query := h.DB.Order("intersection_id ASC")
+	if enabled := c.Query("enabled"); enabled != "" {
+		query = query.Where("enabled = ?", enabled == "true")
+	}
+
+	var intersections []models.SyntheticIntersection
+	if err := query.Find(&intersections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, intersections)
+}
+
+// GetIntersection handles GET /scenarios/intersections/:id
+func (h *IntersectionHandler) GetIntersection(c *gin.Context) {
+	intersection, ok := h.findIntersection(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, intersection)
+}
+
+// CreateIntersection handles POST /scenarios/intersections
+// Takes intersection_id, name, latitude, longitude, approaches ([{id, heading,
+// lanes, signal_group}]) and timing_plans ([{name, from, to, cycle_seconds,
+// offset_seconds, phases: [{signal_group, start_seconds, green_seconds, yellow_seconds}]}])
+func (h *IntersectionHandler) CreateIntersection(c *gin.Context) {
+	intersection := models.SyntheticIntersection{Enabled: true}
+	if err := c.ShouldBindJSON(&intersection); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := siem.NormalizeSyntheticIntersection(&intersection); err != nil {
+		respondValidation(c, err)
+		return
+	}
+
+	if err := h.DB.Create(&intersection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, intersection)
+}
+
+// UpdateIntersection handles PUT /scenarios/intersections/:id
+func (h *IntersectionHandler) UpdateIntersection(c *gin.Context) {
+	intersection, ok := h.findIntersection(c)
+	if !ok {
+		return
+	}
+
+	id := intersection.ID
+	if err := c.ShouldBindJSON(intersection); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	intersection.ID = id
+	if err := siem.NormalizeSyntheticIntersection(intersection); err != nil {
+		respondValidation(c, err)
+		return
+	}
+
+	if err := h.DB.Save(intersection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, intersection)
+}
+
+// DeleteIntersection handles DELETE /scenarios/intersections/:id
+func (h *IntersectionHandler) DeleteIntersection(c *gin.Context) {
+	intersection, ok := h.findIntersection(c)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(intersection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Intersection deleted successfully"})
+}
+
+// GetIntersectionState handles GET /scenarios/intersections/:id/state
+// The signal states the timing plans prescribe at (RFC 3339, default now):
+// the ground truth of the SPaT messages the simulator broadcasts
+func (h *IntersectionHandler) GetIntersectionState(c *gin.Context) {
+	intersection, ok := h.findIntersection(c)
+	if !ok {
+		return
+	}
+
+	at := time.Now().UTC()
+	if value := c.Query("at"); value != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid at, expected RFC 3339"})
+			return
+		}
+	}
+
+	scenario := intersection.Scenario()
+	plan, ok := scenario.ActivePlan(at)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No timing plan is in force at that time"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"intersection_id": intersection.IntersectionID,
+		"at":              at,
+		"plan":            plan.Name,
+		"signal_states":   scenario.SignalStates(at),
+	})
+}
+
+// VerifyIntersectionSPaT handles GET /scenarios/intersections/:id/verify
+// Compares the SPaT messages stored for the intersection between from and to
+// (RFC 3339, at most 24 hours apart, default the last hour) with its timing plans
+func (h *IntersectionHandler) VerifyIntersectionSPaT(c *gin.Context) {
+	intersection, ok := h.findIntersection(c)
+	if !ok {
+		return
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-time.Hour)
+	for _, bound := range []struct {
+		param string
+		value *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.param + ", expected RFC 3339"})
+			return
+		}
+		*bound.value = t
+	}
+
+	verification, err := siem.VerifySPaT(database.ReadDB(h.DB), intersection, from, to)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if !to.After(from) || to.Sub(from) > siem.MaxSPaTVerifyWindow {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, verification)
+}
+
+// ReviewIntersectionPriority handles GET /scenarios/intersections/:id/priority
+// Lists the signal requests (SRMs) the intersection received between from and
+// to (RFC 3339, at most 24 hours apart, default the last hour) with the status
+// its SSMs gave them, flagging those that look like fake preemption
+func (h *IntersectionHandler) ReviewIntersectionPriority(c *gin.Context) {
+	intersection, ok := h.findIntersection(c)
+	if !ok {
+		return
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-time.Hour)
+	for _, bound := range []struct {
+		param string
+		value *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.param + ", expected RFC 3339"})
+			return
+		}
+		*bound.value = t
+	}
+
+	review, err := siem.ReviewSignalPriority(database.ReadDB(h.DB), intersection, from, to)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if !to.After(from) || to.Sub(from) > siem.MaxPriorityReviewWindow {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+// GetSimulatorIntersections handles GET /simulator/intersections
+// The enabled intersections, as the V2X simulator pulls them to broadcast
+// their SPaT and MAP messages
+func (h *IntersectionHandler) GetSimulatorIntersections(c *gin.Context) {
+	var intersections []models.SyntheticIntersection
+	if err := h.DB.Where("enabled = ?", true).Order("intersection_id ASC").Find(&intersections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	scenarios := make([]eventschema.Intersection, len(intersections))
+	for i := range intersections {
+		scenarios[i] = intersections[i].Scenario()
+	}
+
+	c.JSON(http.StatusOK, scenarios)
+}
+
+// findIntersection loads the intersection named by the :id parameter, answering the request when it cannot
+func (h *IntersectionHandler) findIntersection(c *gin.Context) (*models.SyntheticIntersection, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid intersection ID"})
+		return nil, false
+	}
+
+	var intersection models.SyntheticIntersection
+	if err := h.DB.First(&intersection, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Intersection not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &intersection, true
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// KPIHandler handles V2X KPI endpoints
+type KPIHandler struct {
+	DB         *gorm.DB
+	KPIService *siem.KPIService
+}
+
+// NewKPIHandler creates a new KPIHandler
+func NewKPIHandler(db *gorm.DB) *KPIHandler {
+	return &KPIHandler{DB: db, KPIService: siem.NewKPIService(db)}
+}
+
+// GetKPIs handles GET /kpi
+// Filters: entity_type (vehicle|rsu), entity_id, from, to (RFC3339)
+func (h *KPIHandler) GetKPIs(c *gin.Context) {
+	query := database.ReadDB(h.DB).Model(&models.V2XKPI{})
+
+	if entityType := c.Query("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		query = query.Where("entity_id = ?", entityID)
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, use RFC3339"})
+			return
+		}
+		query = query.Where("interval_start >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, use RFC3339"})
+			return
+		}
+		query = query.Where("interval_end <= ?", t)
+	}
+
+	var kpis []models.V2XKPI
+	if err := query.Order("interval_start DESC, entity_type, entity_id").Limit(1000).Find(&kpis).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, kpis)
+}
+
+// GetKPISummary handles GET /kpi/summary
+// Averages the indicators of the most recent interval per entity type
+func (h *KPIHandler) GetKPISummary(c *gin.Context) {
+	db := database.ReadDB(h.DB)
+
+	var latest models.V2XKPI
+	if err := db.Order("interval_start DESC").First(&latest).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "No KPI intervals computed yet"})
+		return
+	}
+
+	var summary []struct {
+		EntityType      string   `json:"entity_type"`
+		Entities        int64    `json:"entities"`
+		Messages        int64    `json:"messages"`
+		PIRMeanMs       *float64 `json:"pir_mean_ms"`
+		InfoAgeMeanMs   *float64 `json:"info_age_mean_ms"`
+		NeighborDensity *float64 `json:"neighbor_density"`
+	}
+	err := db.Model(&models.V2XKPI{}).
+		Select(`entity_type, COUNT(*) AS entities, SUM(message_count) AS messages,
+			AVG(pir_mean_ms) AS pir_mean_ms, AVG(info_age_mean_ms) AS info_age_mean_ms,
+			AVG(neighbor_density) AS neighbor_density`).
+		Where("interval_start = ?", latest.IntervalStart).
+		Group("entity_type").
+		Scan(&summary).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"interval_start": latest.IntervalStart,
+		"interval_end":   latest.IntervalEnd,
+		"summary":        summary,
+	})
+}
+
+// ComputeKPIs handles POST /kpi/compute
+// Recomputes (and replaces) the KPIs of an explicit interval
+func (h *KPIHandler) ComputeKPIs(c *gin.Context) {
+	var request struct {
+		From time.Time `json:"from" binding:"required"`
+		To   time.Time `json:"to" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !request.To.After(request.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return
+	}
+
+	kpis, err := h.KPIService.ComputeInterval(request.From, request.To)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "KPIs computed", "records": len(kpis), "kpis": kpis})
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// LayoutHandler handles saved dashboard layouts and their per-role defaults
+type LayoutHandler struct {
+	DB *gorm.DB
+}
+
+// NewLayoutHandler creates a new LayoutHandler
+func NewLayoutHandler(db *gorm.DB) *LayoutHandler {
+	return &LayoutHandler{DB: db}
+}
+
+// builtinLayout is returned when neither the user nor their role has a default layout
+func builtinLayout() models.DashboardLayout {
+	return models.DashboardLayout{
+		Name: "Overview",
+		Widgets: []models.LayoutWidget{
+			{ID: "overview", Type: "overview", X: 0, Y: 0, Width: 12, Height: 2},
+			{ID: "events", Type: "event_timeseries", X: 0, Y: 2, Width: 8, Height: 4},
+			{ID: "alerts", Type: "alert_summary", X: 8, Y: 2, Width: 4, Height: 4},
+			{ID: "rules", Type: "top_rules", X: 0, Y: 6, Width: 6, Height: 4},
+			{ID: "sources", Type: "top_sources", X: 6, Y: 6, Width: 6, Height: 4},
+		},
+		DefaultTimeRange: "last_7_days",
+		IsDefault:        true,
+	}
+}
+
+// validateLayout checks the widgets and the default time range
+func validateLayout(layout *models.DashboardLayout) error {
+	if layout.Name == "" {
+		return errors.New("Layout name is required")
+	}
+
+	seen := make(map[string]bool)
+	for _, widget := range layout.Widgets {
+		if widget.ID == "" || widget.Type == "" {
+			return errors.New("Every widget needs an id and a type")
+		}
+		if seen[widget.ID] {
+			return errors.New("Duplicate widget id: " + widget.ID)
+		}
+		seen[widget.ID] = true
+		if widget.X < 0 || widget.Y < 0 || widget.Width <= 0 || widget.Height <= 0 {
+			return errors.New("Invalid position or size for widget " + widget.ID)
+		}
+	}
+
+	if layout.DefaultTimeRange != "" {
+		valid := false
+		for _, timeRange := range siem.DashboardTimeRanges {
+			if layout.DefaultTimeRange == timeRange {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return errors.New("Invalid default time range: " + layout.DefaultTimeRange)
+		}
+	}
+	return nil
+}
+
+// saveLayout stores a layout; when it is a default, the previous default of
+// the same user or role stops being one
+func (h *LayoutHandler) saveLayout(layout *models.DashboardLayout) error {
+	return h.DB.Transaction(func(tx *gorm.DB) error {
+		if layout.IsDefault {
+			query := tx.Model(&models.DashboardLayout{}).Where("is_default = ? AND id <> ?", true, layout.ID)
+			if layout.UserID != nil {
+				query = query.Where("user_id = ?", *layout.UserID)
+			} else {
+				query = query.Where("user_id IS NULL AND role = ?", layout.Role)
+			}
+			if err := query.Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(layout).Error
+	})
+}
+
+// mayActFor reports whether the caller may manage the layouts of a user:
+// admins manage everyone's, other users only their own
+func mayActFor(c *gin.Context, userID uint) bool {
+	claims := middleware.CurrentClaims(c)
+	return claims != nil && (claims.Role == models.AdminRole || claims.UserID == userID)
+}
+
+// userFromQuery loads the user named by the user_id query parameter, or the
+// logged-in user when it is omitted
+func (h *LayoutHandler) userFromQuery(c *gin.Context) (*models.User, bool) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		claims := middleware.CurrentClaims(c)
+		if c.Query("user_id") != "" || claims == nil || claims.UserID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+			return nil, false
+		}
+		userID = int(claims.UserID)
+	}
+	if !mayActFor(c, uint(userID)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Layouts of other users are not accessible"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// GetLayouts handles GET /dashboard/layouts?user_id=
+// Lists the user's layouts and the defaults of their role
+func (h *LayoutHandler) GetLayouts(c *gin.Context) {
+	user, ok := h.userFromQuery(c)
+	if !ok {
+		return
+	}
+
+	var layouts []models.DashboardLayout
+	if err := h.DB.Where("user_id = ?", user.ID).Order("name ASC").Find(&layouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var roleLayouts []models.DashboardLayout
+	if err := h.DB.Where("user_id IS NULL AND role = ?", user.Role).Order("name ASC").Find(&roleLayouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"layouts":      layouts,
+		"role":         user.Role,
+		"role_layouts": roleLayouts,
+	})
+}
+
+// GetEffectiveLayout handles GET /dashboard/layouts/effective?user_id=
+// Returns the layout to open: the user's default, else their role's default,
+// else the built-in overview
+func (h *LayoutHandler) GetEffectiveLayout(c *gin.Context) {
+	user, ok := h.userFromQuery(c)
+	if !ok {
+		return
+	}
+
+	var layout models.DashboardLayout
+	err := h.DB.Where("user_id = ? AND is_default = ?", user.ID, true).First(&layout).Error
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"source": "user", "layout": layout})
+		return
+	}
+	if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.DB.Where("user_id IS NULL AND role = ? AND is_default = ?", user.Role, true).First(&layout).Error
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"source": "role", "layout": layout})
+		return
+	}
+	if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"source": "builtin", "layout": builtinLayout()})
+}
+
+// CreateLayout handles POST /dashboard/layouts
+func (h *LayoutHandler) CreateLayout(c *gin.Context) {
+	var layout models.DashboardLayout
+	if err := c.ShouldBindJSON(&layout); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if claims := middleware.CurrentClaims(c); layout.UserID == nil && claims != nil && claims.UserID != 0 {
+		layout.UserID = &claims.UserID
+	}
+	if layout.UserID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required; role defaults are managed under /admin/dashboard-layouts"})
+		return
+	}
+	if !mayActFor(c, *layout.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Layouts of other users are not accessible"})
+		return
+	}
+	var user models.User
+	if err := h.DB.First(&user, *layout.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	layout.ID = 0
+	layout.Role = ""
+
+	if err := validateLayout(&layout); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.saveLayout(&layout); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, layout)
+}
+
+// loadLayout loads the layout named by the :id parameter, checking its scope
+func (h *LayoutHandler) loadLayout(c *gin.Context, roleLayout bool) (*models.DashboardLayout, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid layout ID"})
+		return nil, false
+	}
+
+	var layout models.DashboardLayout
+	if err := h.DB.First(&layout, id).Error; err != nil || (layout.UserID == nil) != roleLayout {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Layout not found"})
+		return nil, false
+	}
+	if !roleLayout && !mayActFor(c, *layout.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Layouts of other users are not accessible"})
+		return nil, false
+	}
+	return &layout, true
+}
+
+// updateLayout applies a request body to a stored layout, keeping its owner
+func (h *LayoutHandler) updateLayout(c *gin.Context, layout *models.DashboardLayout) {
+	id, userID, role, createdAt := layout.ID, layout.UserID, layout.Role, layout.CreatedAt
+	if err := c.ShouldBindJSON(layout); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	layout.ID, layout.UserID, layout.Role, layout.CreatedAt = id, userID, role, createdAt
+
+	if err := validateLayout(layout); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.saveLayout(layout); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, layout)
+}
+
+// UpdateLayout handles PUT /dashboard/layouts/:id
+func (h *LayoutHandler) UpdateLayout(c *gin.Context) {
+	layout, ok := h.loadLayout(c, false)
+	if !ok {
+		return
+	}
+	h.updateLayout(c, layout)
+}
+
+// DeleteLayout handles DELETE /dashboard/layouts/:id
+func (h *LayoutHandler) DeleteLayout(c *gin.Context) {
+	layout, ok := h.loadLayout(c, false)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(layout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Layout deleted successfully"})
+}
+
+// GetRoleLayouts handles GET /admin/dashboard-layouts
+func (h *LayoutHandler) GetRoleLayouts(c *gin.Context) {
+	query := h.DB.Where("user_id IS NULL").Order("role ASC, name ASC")
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+
+	var layouts []models.DashboardLayout
+	if err := query.Find(&layouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, layouts)
+}
+
+// CreateRoleLayout handles POST /admin/dashboard-layouts
+func (h *LayoutHandler) CreateRoleLayout(c *gin.Context) {
+	var layout models.DashboardLayout
+	if err := c.ShouldBindJSON(&layout); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !models.ValidUserRole(layout.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role: " + string(layout.Role)})
+		return
+	}
+	layout.ID = 0
+	layout.UserID = nil
+
+	if err := validateLayout(&layout); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.saveLayout(&layout); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, layout)
+}
+
+// UpdateRoleLayout handles PUT /admin/dashboard-layouts/:id
+func (h *LayoutHandler) UpdateRoleLayout(c *gin.Context) {
+	layout, ok := h.loadLayout(c, true)
+	if !ok {
+		return
+	}
+	h.updateLayout(c, layout)
+}
+
+// DeleteRoleLayout handles DELETE /admin/dashboard-layouts/:id
+func (h *LayoutHandler) DeleteRoleLayout(c *gin.Context) {
+	layout, ok := h.loadLayout(c, true)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(layout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Layout deleted successfully"})
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// listSpec describes how the items of a list endpoint may be sorted and projected
+type listSpec struct {
+	Model           interface{}       // fields= names are checked against its JSON fields
+	Sortable        map[string]string // sort= field to column
+	DefaultSort     string            // e.g. "timestamp:desc"
+	DefaultPageSize int               // 50 when zero
+	MaxPageSize     int               // 100 when zero
+}
+
+// listQuery is the page, order and projection a client asked a list endpoint for:
+// page, pageSize (or pagesize, limit), sort=field:dir[,field:dir] and fields=a,b
+type listQuery struct {
+	Page     int
+	PageSize int
+	Sort     []string // field:dir, as applied
+	Fields   []string // JSON fields to keep, all when empty
+	order    []string // ORDER BY terms
+}
+
+// parseListQuery reads the list parameters of a request, answering it with
+// 400 when they name a field the endpoint cannot sort or project on
+func parseListQuery(c *gin.Context, spec listSpec) (listQuery, bool) {
+	defaultSize, maxSize := spec.DefaultPageSize, spec.MaxPageSize
+	if defaultSize == 0 {
+		defaultSize = 50
+	}
+	if maxSize == 0 {
+		maxSize = 100
+	}
+
+	q := listQuery{Page: 1, PageSize: defaultSize}
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		q.Page = page
+	}
+	for _, param := range []string{"pageSize", "pagesize", "limit"} {
+		if size, err := strconv.Atoi(c.Query(param)); err == nil {
+			if size > 0 && size <= maxSize {
+				q.PageSize = size
+			}
+			break
+		}
+	}
+
+	for _, term := range strings.Split(c.DefaultQuery("sort", spec.DefaultSort), ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		field, dir := term, "asc"
+		if i := strings.LastIndex(term, ":"); i >= 0 {
+			field, dir = term[:i], strings.ToLower(term[i+1:])
+		}
+		column, ok := spec.Sortable[field]
+		if !ok && len(spec.Sortable) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This list cannot be sorted"})
+			return q, false
+		}
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot sort by %q (use %s)", field, strings.Join(sortedKeys(spec.Sortable), ", "))})
+			return q, false
+		}
+		if dir != "asc" && dir != "desc" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid sort direction %q (use asc or desc)", dir)})
+			return q, false
+		}
+		q.Sort = append(q.Sort, field+":"+dir)
+		q.order = append(q.order, column+" "+strings.ToUpper(dir))
+	}
+
+	if fields := c.Query("fields"); fields != "" {
+		known := jsonFields(reflect.TypeOf(spec.Model))
+		for _, field := range strings.Split(fields, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if !known[field] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown field %q", field)})
+				return q, false
+			}
+			q.Fields = append(q.Fields, field)
+		}
+	}
+	return q, true
+}
+
+// paginate orders a query and limits it to the requested page
+func (q listQuery) paginate(query *gorm.DB) *gorm.DB {
+	for _, term := range q.order {
+		query = query.Order(term)
+	}
+	return query.Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize)
+}
+
+// respondList answers with a page of items, keeping only the requested
+// fields, and the pagination metadata every list endpoint shares
+func respondList(c *gin.Context, items interface{}, total int64, q listQuery) {
+	respondListWith(c, items, total, q, nil)
+}
+
+// respondListWith is respondList for endpoints that also tell how the page
+// was found; the keys of extra are added to the response
+func respondListWith(c *gin.Context, items interface{}, total int64, q listQuery, extra gin.H) {
+	data, err := project(items, q.Fields)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"data": data,
+		"pagination": gin.H{
+			"page":     q.Page,
+			"pageSize": q.PageSize,
+			"total":    total,
+			"pages":    (total + int64(q.PageSize) - 1) / int64(q.PageSize),
+			"sort":     q.Sort,
+		},
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// project keeps only fields of each item, or returns the items as they are without fields
+func project(items interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return items, nil
+	}
+
+	encoded, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &objects); err != nil {
+		return nil, err
+	}
+
+	projected := make([]map[string]json.RawMessage, len(objects))
+	for i, object := range objects {
+		projected[i] = make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := object[field]; ok {
+				projected[i][field] = value
+			}
+		}
+	}
+	return projected, nil
+}
+
+// jsonFields returns the JSON names of the fields of a struct type, including embedded ones
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fields
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			for embedded := range jsonFields(field.Type) {
+				fields[embedded] = true
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = true
+	}
+	return fields
+}
+
+// sortedKeys lists the sortable fields of an endpoint in a stable order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/siem/live"
+)
+
+// LiveHandler handles the live statistics stream for wallboard displays and the live map
+type LiveHandler struct{}
+
+// NewLiveHandler creates a new LiveHandler
+func NewLiveHandler() *LiveHandler {
+	return &LiveHandler{}
+}
+
+// GetLiveStats handles GET /live/stats
+// Streams statistics snapshots as server-sent events ("stats"), starting with
+// the latest one; once=true returns the latest snapshot as plain JSON instead
+func (h *LiveHandler) GetLiveStats(c *gin.Context) {
+	if c.Query("once") == "true" {
+		c.JSON(http.StatusOK, live.Latest())
+		return
+	}
+
+	updates, unsubscribe := live.Subscribe()
+	defer unsubscribe()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // keep reverse proxies from buffering the stream
+
+	c.SSEvent("stats", live.Latest())
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case snapshot := <-updates:
+			c.SSEvent("stats", snapshot)
+			return true
+		}
+	})
+}
+
+// GetLiveMap handles GET /live/map
+// Returns the active vehicles clustered for zoom (0-22), each cluster with its
+// dominant heading and speeds; bbox=min_lon,min_lat,max_lon,max_lat keeps the
+// clusters whose centroid is in view. From zoom 18 every vehicle is its own marker.
+func (h *LiveHandler) GetLiveMap(c *gin.Context) {
+	zoom, err := strconv.Atoi(c.Query("zoom"))
+	if err != nil || zoom < 0 || zoom > live.MaxZoom {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid zoom, use 0-22"})
+		return
+	}
+
+	var bbox []float64
+	if value := c.Query("bbox"); value != "" {
+		parts := strings.Split(value, ",")
+		for _, part := range parts {
+			coordinate, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				break
+			}
+			bbox = append(bbox, coordinate)
+		}
+		if len(parts) != 4 || len(bbox) != 4 || bbox[0] > bbox[2] || bbox[1] > bbox[3] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bbox, use min_lon,min_lat,max_lon,max_lat"})
+			return
+		}
+	}
+
+	clusters, vehicles := live.VehicleClusters(zoom)
+	if bbox != nil {
+		inView := make([]live.VehicleCluster, 0, len(clusters))
+		for _, cluster := range clusters {
+			if cluster.Longitude >= bbox[0] && cluster.Latitude >= bbox[1] &&
+				cluster.Longitude <= bbox[2] && cluster.Latitude <= bbox[3] {
+				inView = append(inView, cluster)
+			}
+		}
+		clusters = inView
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"zoom":            zoom,
+		"active_vehicles": vehicles,
+		"clusters":        clusters,
+	})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/logging"
+)
+
+// LogLevelHandler handles the runtime log level endpoints
+type LogLevelHandler struct{}
+
+// NewLogLevelHandler creates a new LogLevelHandler
+func NewLogLevelHandler() *LogLevelHandler {
+	return &LogLevelHandler{}
+}
+
+// LogLevelsRequest changes log levels until the next restart. An empty level
+// returns the default or a component to its configured level.
+type LogLevelsRequest struct {
+	Default    *string           `json:"default"`
+	Components map[string]string `json:"components"`
+}
+
+// GetLogLevels handles GET /admin/log-levels
+// Lists the default level and the level of every component that has logged
+// or has a level configured
+func (h *LogLevelHandler) GetLogLevels(c *gin.Context) {
+	c.JSON(http.StatusOK, logging.Levels())
+}
+
+// UpdateLogLevels handles PUT /admin/log-levels
+// The levels are checked before any is applied, so a bad level changes
+// nothing
+func (h *LogLevelHandler) UpdateLogLevels(c *gin.Context) {
+	var req LogLevelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Default != nil && *req.Default != "" {
+		if _, err := logging.ParseLevel(*req.Default); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	for name, level := range req.Components {
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "component is required"})
+			return
+		}
+		if level == "" {
+			continue
+		}
+		if _, err := logging.ParseLevel(level); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("component '%s': %v", name, err)})
+			return
+		}
+	}
+
+	if req.Default != nil {
+		logging.SetDefaultLevel(*req.Default)
+	}
+	for name, level := range req.Components {
+		logging.SetLevel(name, level)
+	}
+
+	c.JSON(http.StatusOK, logging.Levels())
+}
@@ -6,7 +6,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"traffic-monitoring-go/app/auth"
 	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
 )
 
 
@@ -116,6 +118,7 @@ func (h *LogSourceHandler) UpdateLogSource(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	siem.InvalidateLogSources()
 
 	c.JSON(http.StatusOK, source)
 }
@@ -144,26 +147,135 @@ func (h *LogSourceHandler) DeleteLogSource(c *gin.Context) {
 		return
 	}
 
-	if err := h.DB.Delete(&models.LogSource{}, id).Error; err != nil {
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("log_source_id = ?", id).Delete(&models.SeverityMapping{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("log_source_id = ?", id).Delete(&models.APIKey{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.LogSource{}, id).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	siem.InvalidateLogSources()
+	siem.InvalidateSeverityMappings()
+	auth.InvalidateAPIKeys()
 
 	c.JSON(http.StatusOK, gin.H{"message": "Log source deleted successfully"})
 }
 
 
+// GetSeverityMappings handles GET /log-sources/:id/severity-mappings
+// Returns the source's mapping table and the defaults used for values it does not map
+func (h *LogSourceHandler) GetSeverityMappings(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid log source ID"})
+		return
+	}
 
+	var source models.LogSource
+	if err := h.DB.First(&source, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Log source not found"})
+		return
+	}
 
+	var mappings []models.SeverityMapping
+	if err := h.DB.Where("log_source_id = ?", source.ID).Order("source_value ASC").Find(&mappings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"log_source_id": source.ID,
+		"mappings":      mappings,
+		"defaults":      siem.DefaultSeverityMap,
+	})
+}
 
+// ReplaceSeverityMappings handles PUT /log-sources/:id/severity-mappings
+// Replaces the source's mapping table with {"mappings": {"<source value>": "<severity>"}}
+func (h *LogSourceHandler) ReplaceSeverityMappings(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid log source ID"})
+		return
+	}
 
+	var source models.LogSource
+	if err := h.DB.First(&source, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Log source not found"})
+		return
+	}
 
+	var request struct {
+		Mappings map[string]models.EventSeverity `json:"mappings" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	mappings := make([]models.SeverityMapping, 0, len(request.Mappings))
+	seen := make(map[string]bool)
+	for value, severity := range request.Mappings {
+		key := siem.NormalizeSeverityValue(value)
+		if key == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Source severity values must not be empty"})
+			return
+		}
+		if seen[key] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duplicate source severity value: " + key})
+			return
+		}
+		if !models.ValidSeverity(severity) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid severity for " + key + ": must be critical, high, medium, low or info"})
+			return
+		}
+		seen[key] = true
+		mappings = append(mappings, models.SeverityMapping{LogSourceID: source.ID, SourceValue: key, Severity: severity})
+	}
 
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("log_source_id = ?", source.ID).Delete(&models.SeverityMapping{}).Error; err != nil {
+			return err
+		}
+		if len(mappings) == 0 {
+			return nil
+		}
+		return tx.Create(&mappings).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateSeverityMappings()
 
+	c.JSON(http.StatusOK, gin.H{"log_source_id": source.ID, "mappings": mappings})
+}
 
+// DeleteSeverityMapping handles DELETE /log-sources/:id/severity-mappings/:value
+func (h *LogSourceHandler) DeleteSeverityMapping(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid log source ID"})
+		return
+	}
 
+	result := h.DB.Where("log_source_id = ? AND source_value = ?", id, siem.NormalizeSeverityValue(c.Param("value"))).
+		Delete(&models.SeverityMapping{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Severity mapping not found"})
+		return
+	}
+	siem.InvalidateSeverityMappings()
 
-
-
+	c.JSON(http.StatusOK, gin.H{"message": "Severity mapping deleted successfully"})
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/metrics"
+)
+
+var metricsToken = config.NewString("METRICS_TOKEN", "", "Bearer token scrapers present to /metrics; empty leaves it open", config.Secret)
+
+// MetricsHandler handles the Prometheus metrics endpoint
+type MetricsHandler struct {
+	Token string // bearer token scrapers must present; empty leaves /metrics open
+}
+
+// NewMetricsHandler creates a new MetricsHandler protected by METRICS_TOKEN
+func NewMetricsHandler() *MetricsHandler {
+	return &MetricsHandler{Token: metricsToken.Get()}
+}
+
+// GetMetrics handles GET /metrics
+// Exports the ingestion and detection pipeline metrics in the Prometheus text format
+func (h *MetricsHandler) GetMetrics(c *gin.Context) {
+	if h.Token != "" {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Metrics token required"})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	metrics.WriteText(c.Writer)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// MisbehaviorHandler handles V2X misbehavior report endpoints
+type MisbehaviorHandler struct {
+	DB       *gorm.DB
+	Reporter *siem.MisbehaviorReporter
+}
+
+// NewMisbehaviorHandler creates a new MisbehaviorHandler
+func NewMisbehaviorHandler(db *gorm.DB) *MisbehaviorHandler {
+	return &MisbehaviorHandler{DB: db, Reporter: siem.NewMisbehaviorReporter(db)}
+}
+
+// misbehaviorReportList is how GET /misbehavior-reports may be sorted and projected
+var misbehaviorReportList = listSpec{
+	Model: models.MisbehaviorReport{},
+	Sortable: map[string]string{
+		"id":            "id",
+		"source_id":     "source_id",
+		"window_start":  "window_start",
+		"window_end":    "window_end",
+		"anomaly_count": "anomaly_count",
+		"status":        "status",
+		"sent_at":       "sent_at",
+		"created_at":    "created_at",
+	},
+	DefaultSort: "created_at:desc",
+}
+
+// GetMisbehaviorReports handles GET /misbehavior-reports
+// Filters by source_id and status
+func (h *MisbehaviorHandler) GetMisbehaviorReports(c *gin.Context) {
+	list, ok := parseListQuery(c, misbehaviorReportList)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Model(&models.MisbehaviorReport{})
+	if sourceID := c.Query("source_id"); sourceID != "" {
+		query = query.Where("source_id = ?", sourceID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var reports []models.MisbehaviorReport
+	if err := list.paginate(query).Find(&reports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, reports, total, list)
+}
+
+// GetMisbehaviorReport handles GET /misbehavior-reports/:id
+// Returns the report with its MBR document
+func (h *MisbehaviorHandler) GetMisbehaviorReport(c *gin.Context) {
+	report, ok := h.findReport(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report, "document": json.RawMessage(report.Document)})
+}
+
+// GenerateMisbehaviorReports handles POST /misbehavior-reports/generate
+// Reports the anomalies between start and end (default: the last hour), for
+// one source_id or every source with enough anomalies
+func (h *MisbehaviorHandler) GenerateMisbehaviorReports(c *gin.Context) {
+	var request struct {
+		SourceID string     `json:"source_id"`
+		Start    *time.Time `json:"start"`
+		End      *time.Time `json:"end"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	end := h.Reporter.Clock.Now()
+	if request.End != nil {
+		end = *request.End
+	}
+	start := end.Add(-time.Hour)
+	if request.Start != nil {
+		start = *request.Start
+	}
+	if !start.Before(end) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start must be before end"})
+		return
+	}
+
+	reports, err := h.Reporter.Generate(start, end, request.SourceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"generated": len(reports), "reports": reports})
+}
+
+// ForwardMisbehaviorReport handles POST /misbehavior-reports/:id/forward
+// Sends the report to the Misbehavior Authority now, including failed reports
+func (h *MisbehaviorHandler) ForwardMisbehaviorReport(c *gin.Context) {
+	report, ok := h.findReport(c)
+	if !ok {
+		return
+	}
+	if h.Reporter.AuthorityURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No Misbehavior Authority configured (MBR_AUTHORITY_URL)"})
+		return
+	}
+
+	if err := h.Reporter.Forward(report); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// findReport loads the report named by the :id parameter, answering the request when it cannot
+func (h *MisbehaviorHandler) findReport(c *gin.Context) (*models.MisbehaviorReport, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report ID"})
+		return nil, false
+	}
+
+	var report models.MisbehaviorReport
+	if err := h.DB.First(&report, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Misbehavior report not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &report, true
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/collectors"
+)
+
+// mqttConfig converts a stored broker into its runtime configuration
+func mqttConfig(broker models.MQTTBroker) collectors.MQTTConfig {
+	return collectors.MQTTConfig{
+		Name:               broker.Name,
+		URL:                broker.URL,
+		ClientID:           broker.ClientID,
+		Username:           broker.Username,
+		Password:           broker.Password,
+		CACert:             broker.CACert,
+		ClientCert:         broker.ClientCert,
+		ClientKey:          broker.ClientKey,
+		InsecureSkipVerify: broker.InsecureSkipVerify,
+		KeepAlive:          time.Duration(broker.KeepAliveSeconds) * time.Second,
+		Topics:             broker.Topics,
+	}
+}
+
+// withoutSecrets blanks what the API never returns about a broker
+func withoutSecrets(broker *models.MQTTBroker) {
+	broker.Password = ""
+	broker.ClientKey = ""
+}
+
+// GetMQTTBrokers handles GET /collectors/mqtt
+func (h *CollectorHandler) GetMQTTBrokers(c *gin.Context) {
+	var brokers []models.MQTTBroker
+	if err := h.DB.Order("name ASC").Find(&brokers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, 0, len(brokers))
+	for i := range brokers {
+		withoutSecrets(&brokers[i])
+		running, _ := h.CollectorManager.GetCollectorStatus(brokers[i].Name)
+		result = append(result, gin.H{
+			"broker":  brokers[i],
+			"running": running,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"brokers": result, "parsers": collectors.ParserNames()})
+}
+
+// AddMQTTBroker handles POST /collectors/mqtt
+// Connects to the broker immediately and persists it for restarts. Each topic
+// names its parser and, for gateways whose messages do not say which radio
+// they came over, its radio (dsrc or cv2x).
+func (h *CollectorHandler) AddMQTTBroker(c *gin.Context) {
+	var broker models.MQTTBroker
+	if err := c.ShouldBindJSON(&broker); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	broker.Enabled = true
+	if broker.KeepAliveSeconds == 0 {
+		broker.KeepAliveSeconds = 60
+	}
+
+	if err := mqttConfig(broker).Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.CollectorManager.AddMQTT(mqttConfig(broker)); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Create(&broker).Error; err != nil {
+		// keep runtime and stored state consistent
+		h.CollectorManager.RemoveCollector(broker.Name)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	withoutSecrets(&broker)
+	c.JSON(http.StatusCreated, broker)
+}
+
+// UpdateMQTTBroker handles PUT /collectors/mqtt/:name
+// Reconnects with the new settings; the password and client key are kept
+// when the request leaves them out. Setting enabled to false disconnects.
+func (h *CollectorHandler) UpdateMQTTBroker(c *gin.Context) {
+	var broker models.MQTTBroker
+	if err := h.DB.Where("name = ?", c.Param("name")).First(&broker).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MQTT broker not found"})
+		return
+	}
+
+	id, name, password, clientKey := broker.ID, broker.Name, broker.Password, broker.ClientKey
+	if err := c.ShouldBindJSON(&broker); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	broker.ID, broker.Name = id, name
+	if broker.Password == "" {
+		broker.Password = password
+	}
+	if broker.ClientKey == "" {
+		broker.ClientKey = clientKey
+	}
+
+	config := mqttConfig(broker)
+	if err := config.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, registered := h.CollectorManager.GetCollectorStatus(name)
+	var err error
+	switch {
+	case !broker.Enabled:
+		if registered == nil {
+			err = h.CollectorManager.RemoveCollector(name)
+		}
+	case registered == nil:
+		err = h.CollectorManager.ReplaceMQTT(config)
+	default:
+		err = h.CollectorManager.AddMQTT(config)
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(&broker).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	withoutSecrets(&broker)
+	c.JSON(http.StatusOK, broker)
+}
+
+// RemoveMQTTBroker handles DELETE /collectors/mqtt/:name
+// Disconnects once the messages already received are ingested
+func (h *CollectorHandler) RemoveMQTTBroker(c *gin.Context) {
+	name := c.Param("name")
+
+	var broker models.MQTTBroker
+	if err := h.DB.Where("name = ?", name).First(&broker).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MQTT broker not found"})
+		return
+	}
+
+	if _, err := h.CollectorManager.GetCollectorStatus(name); err == nil {
+		if err := h.CollectorManager.RemoveCollector(name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := h.DB.Delete(&broker).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "MQTT broker removed successfully"})
+}
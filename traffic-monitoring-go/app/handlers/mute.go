@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// MuteHandler handles per-source mute endpoints
+type MuteHandler struct {
+	DB *gorm.DB
+}
+
+// NewMuteHandler creates a new MuteHandler
+func NewMuteHandler(db *gorm.DB) *MuteHandler {
+	return &MuteHandler{DB: db}
+}
+
+// GetMutes handles GET /mutes
+// Lists the active mutes; all=true includes expired and resolved ones
+func (h *MuteHandler) GetMutes(c *gin.Context) {
+	query := h.DB.Order("created_at DESC")
+	if c.Query("all") != "true" {
+		query = query.Where("resolved_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", clock.Default().Now())
+	}
+	if sourceType := c.Query("source_type"); sourceType != "" {
+		query = query.Where("source_type = ?", sourceType)
+	}
+
+	var mutes []models.SourceMute
+	if err := query.Find(&mutes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mutes)
+}
+
+// CreateMute handles POST /mutes
+// The mute lasts for duration (e.g. "2h"), until expires_at, or until resolved
+func (h *MuteHandler) CreateMute(c *gin.Context) {
+	var req struct {
+		SourceType  models.MuteSourceType `json:"source_type" binding:"required"`
+		SourceID    string                `json:"source_id" binding:"required"`
+		MessageType string                `json:"message_type"`
+		Reason      string                `json:"reason" binding:"required"`
+		CreatedBy   string                `json:"created_by"`
+		Duration    string                `json:"duration"`
+		ExpiresAt   *time.Time            `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch req.SourceType {
+	case models.MuteSourceVehicle, models.MuteSourceRSU, models.MuteSourceLogSource, models.MuteSourceIP:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source_type must be vehicle, rsu, log_source or source_ip"})
+		return
+	}
+
+	now := clock.Default().Now()
+	mute := models.SourceMute{
+		SourceType:  req.SourceType,
+		SourceID:    req.SourceID,
+		MessageType: req.MessageType,
+		Reason:      req.Reason,
+		CreatedBy:   req.CreatedBy,
+		ExpiresAt:   req.ExpiresAt,
+	}
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid duration"})
+			return
+		}
+		expiresAt := now.Add(duration)
+		mute.ExpiresAt = &expiresAt
+	}
+	if mute.ExpiresAt != nil && !mute.ExpiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mute expiry must be in the future"})
+		return
+	}
+
+	if err := h.DB.Create(&mute).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateMutes()
+
+	c.JSON(http.StatusCreated, mute)
+}
+
+// ResolveMute handles POST /mutes/:id/resolve
+func (h *MuteHandler) ResolveMute(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mute ID"})
+		return
+	}
+
+	var mute models.SourceMute
+	if err := h.DB.First(&mute, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mute not found"})
+		return
+	}
+
+	if mute.ResolvedAt == nil {
+		now := clock.Default().Now()
+		mute.ResolvedAt = &now
+		if err := h.DB.Save(&mute).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		siem.InvalidateMutes()
+	}
+
+	c.JSON(http.StatusOK, mute)
+}
+
+// DeleteMute handles DELETE /mutes/:id
+func (h *MuteHandler) DeleteMute(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mute ID"})
+		return
+	}
+
+	if err := h.DB.Delete(&models.SourceMute{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateMutes()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mute deleted successfully"})
+}
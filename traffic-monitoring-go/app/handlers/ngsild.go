@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/interop"
+)
+
+// NGSILDHandler serves the V2X traffic picture as NGSI-LD entities
+type NGSILDHandler struct {
+	Exporter *interop.NGSILDExporter
+}
+
+// NewNGSILDHandler creates a new NGSILDHandler
+func NewNGSILDHandler(db *gorm.DB) *NGSILDHandler {
+	return &NGSILDHandler{Exporter: interop.NewNGSILDExporter(db)}
+}
+
+// writeLD writes a JSON-LD response
+func writeLD(c *gin.Context, status int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(status, "application/ld+json", body)
+}
+
+// GetEntities handles GET /ngsi-ld/v1/entities?type=&limit=&offset=
+func (h *NGSILDHandler) GetEntities(c *gin.Context) {
+	entityType := c.Query("type")
+	switch entityType {
+	case "", interop.EntityTypeVehicle, interop.EntityTypeDevice, interop.EntityTypeAlert:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be Vehicle, Device or Alert"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	entities, err := h.Exporter.Entities(entityType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("NGSILD-Results-Count", strconv.Itoa(len(entities)))
+	if offset > len(entities) {
+		offset = len(entities)
+	}
+	end := offset + limit
+	if end > len(entities) {
+		end = len(entities)
+	}
+
+	page := make([]interop.Entity, 0, end-offset)
+	for _, entity := range entities[offset:end] {
+		page = append(page, interop.WithContext(entity))
+	}
+	writeLD(c, http.StatusOK, page)
+}
+
+// GetEntity handles GET /ngsi-ld/v1/entities/:id
+func (h *NGSILDHandler) GetEntity(c *gin.Context) {
+	id := c.Param("id")
+
+	entities, err := h.Exporter.Entities("")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, entity := range entities {
+		if entity.ID() == id {
+			writeLD(c, http.StatusOK, interop.WithContext(entity))
+			return
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Entity not found"})
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// OEMHandler handles fleet operator and OEM notification endpoints
+type OEMHandler struct {
+	DB       *gorm.DB
+	Notifier *siem.OEMNotifier
+}
+
+// NewOEMHandler creates a new OEMHandler
+func NewOEMHandler(db *gorm.DB) *OEMHandler {
+	return &OEMHandler{DB: db, Notifier: siem.NewOEMNotifier(db)}
+}
+
+// GetFleetOperators handles GET /fleet-operators
+func (h *OEMHandler) GetFleetOperators(c *gin.Context) {
+	var operators []models.FleetOperator
+	if err := h.DB.Order("name ASC").Find(&operators).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for i := range operators {
+		operators[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, operators)
+}
+
+// GetFleetOperator handles GET /fleet-operators/:id
+func (h *OEMHandler) GetFleetOperator(c *gin.Context) {
+	operator, ok := h.findOperator(c)
+	if !ok {
+		return
+	}
+
+	operator.Secret = ""
+	c.JSON(http.StatusOK, operator)
+}
+
+// CreateFleetOperator handles POST /fleet-operators
+// Takes the endpoint_url notifications are posted to, the secret signing
+// them and the vehicle_prefixes of the operator's source IDs
+func (h *OEMHandler) CreateFleetOperator(c *gin.Context) {
+	operator := models.FleetOperator{Enabled: true}
+	if err := c.ShouldBindJSON(&operator); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validFleetOperator(c, &operator) {
+		return
+	}
+
+	if err := h.DB.Create(&operator).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	operator.Secret = ""
+	c.JSON(http.StatusCreated, operator)
+}
+
+// UpdateFleetOperator handles PUT /fleet-operators/:id
+// The secret is kept when the request leaves it out
+func (h *OEMHandler) UpdateFleetOperator(c *gin.Context) {
+	operator, ok := h.findOperator(c)
+	if !ok {
+		return
+	}
+
+	secret := operator.Secret
+	if err := c.ShouldBindJSON(operator); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if operator.Secret == "" {
+		operator.Secret = secret
+	}
+	if !validFleetOperator(c, operator) {
+		return
+	}
+
+	if err := h.DB.Save(operator).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	operator.Secret = ""
+	c.JSON(http.StatusOK, operator)
+}
+
+// DeleteFleetOperator handles DELETE /fleet-operators/:id
+// Notifications still pending for the operator fail on their next attempt
+func (h *OEMHandler) DeleteFleetOperator(c *gin.Context) {
+	operator, ok := h.findOperator(c)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(operator).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Fleet operator deleted successfully"})
+}
+
+// oemNotificationList is how GET /oem-notifications may be sorted and projected
+var oemNotificationList = listSpec{
+	Model: models.OEMNotification{},
+	Sortable: map[string]string{
+		"id":          "id",
+		"alert_id":    "alert_id",
+		"operator_id": "operator_id",
+		"pseudonym":   "pseudonym",
+		"status":      "status",
+		"sent_at":     "sent_at",
+		"created_at":  "created_at",
+	},
+	DefaultSort: "created_at:desc",
+}
+
+// GetOEMNotifications handles GET /oem-notifications
+// Filters by alert_id, operator_id, pseudonym and status
+func (h *OEMHandler) GetOEMNotifications(c *gin.Context) {
+	list, ok := parseListQuery(c, oemNotificationList)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Model(&models.OEMNotification{})
+	if alertID := c.Query("alert_id"); alertID != "" {
+		query = query.Where("alert_id = ?", alertID)
+	}
+	if operatorID := c.Query("operator_id"); operatorID != "" {
+		query = query.Where("operator_id = ?", operatorID)
+	}
+	if pseudonym := c.Query("pseudonym"); pseudonym != "" {
+		query = query.Where("pseudonym = ?", pseudonym)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var notifications []models.OEMNotification
+	if err := list.paginate(query).Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, notifications, total, list)
+}
+
+// GetOEMNotification handles GET /oem-notifications/:id
+// Returns the notification with the payload sent to the operator
+func (h *OEMHandler) GetOEMNotification(c *gin.Context) {
+	notification, ok := h.findNotification(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notification": notification, "payload": json.RawMessage(notification.Payload)})
+}
+
+// DeliverOEMNotification handles POST /oem-notifications/:id/deliver
+// Sends the notification now, including failed ones
+func (h *OEMHandler) DeliverOEMNotification(c *gin.Context) {
+	notification, ok := h.findNotification(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Notifier.Deliver(notification); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "notification": notification})
+		return
+	}
+
+	c.JSON(http.StatusOK, notification)
+}
+
+// validFleetOperator checks a fleet operator before it is stored, answering the request when it is invalid
+func validFleetOperator(c *gin.Context, operator *models.FleetOperator) bool {
+	operator.Name = strings.TrimSpace(operator.Name)
+	if operator.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return false
+	}
+	endpoint, err := url.Parse(operator.EndpointURL)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "endpoint_url must be an http or https URL"})
+		return false
+	}
+	if operator.Secret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "secret is required to sign notifications"})
+		return false
+	}
+
+	prefixes := operator.VehiclePrefixes[:0]
+	for _, prefix := range operator.VehiclePrefixes {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "vehicle_prefixes must name at least one source ID prefix"})
+		return false
+	}
+	operator.VehiclePrefixes = prefixes
+	return true
+}
+
+// findOperator loads the fleet operator named by the :id parameter, answering the request when it cannot
+func (h *OEMHandler) findOperator(c *gin.Context) (*models.FleetOperator, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fleet operator ID"})
+		return nil, false
+	}
+
+	var operator models.FleetOperator
+	if err := h.DB.First(&operator, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Fleet operator not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &operator, true
+}
+
+// findNotification loads the notification named by the :id parameter, answering the request when it cannot
+func (h *OEMHandler) findNotification(c *gin.Context) (*models.OEMNotification, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return nil, false
+	}
+
+	var notification models.OEMNotification
+	if err := h.DB.First(&notification, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "OEM notification not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &notification, true
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/opendata"
+)
+
+// OpenDataHandler serves privacy-protected aggregates for public data portals
+type OpenDataHandler struct {
+	DB      *gorm.DB
+	Privacy opendata.PrivacyConfig
+}
+
+// NewOpenDataHandler creates a new OpenDataHandler
+func NewOpenDataHandler(db *gorm.DB) *OpenDataHandler {
+	return &OpenDataHandler{DB: db, Privacy: opendata.DefaultPrivacyConfig()}
+}
+
+// exportParams reads the time window, interval and privacy parameters of an export request
+func (h *OpenDataHandler) exportParams(c *gin.Context) (time.Time, time.Time, string, opendata.PrivacyConfig, bool) {
+	to := time.Now().UTC()
+	from := to.Add(-24 * time.Hour)
+
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, use RFC3339"})
+			return from, to, "", h.Privacy, false
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, use RFC3339"})
+			return from, to, "", h.Privacy, false
+		}
+	}
+
+	epsilon, _ := strconv.ParseFloat(c.Query("epsilon"), 64)
+	k, _ := strconv.Atoi(c.Query("k"))
+
+	return from, to, c.DefaultQuery("interval", "hour"), h.Privacy.Tighten(epsilon, k), true
+}
+
+// GetTrafficFlow handles GET /opendata/traffic-flow
+func (h *OpenDataHandler) GetTrafficFlow(c *gin.Context) {
+	from, to, interval, privacy, ok := h.exportParams(c)
+	if !ok {
+		return
+	}
+
+	export, err := opendata.TrafficFlow(h.DB, from, to, interval, privacy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.writeExport(c, export)
+}
+
+// GetMessageCounts handles GET /opendata/message-counts
+func (h *OpenDataHandler) GetMessageCounts(c *gin.Context) {
+	from, to, interval, privacy, ok := h.exportParams(c)
+	if !ok {
+		return
+	}
+
+	export, err := opendata.MessageCounts(h.DB, from, to, interval, privacy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.writeExport(c, export)
+}
+
+// writeExport renders an export as JSON, or as CSV when format=csv
+func (h *OpenDataHandler) writeExport(c *gin.Context, export *opendata.Export) {
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"period_start", "key", "count", "avg_speed"})
+	for _, bucket := range export.Buckets {
+		avgSpeed := ""
+		if bucket.AvgSpeed != nil {
+			avgSpeed = strconv.FormatFloat(*bucket.AvgSpeed, 'f', 1, 64)
+		}
+		writer.Write([]string{
+			bucket.PeriodStart.UTC().Format(time.RFC3339),
+			bucket.Key,
+			strconv.FormatInt(bucket.Count, 10),
+			avgSpeed,
+		})
+	}
+	writer.Flush()
+
+	c.Header("Content-Disposition", "attachment; filename="+export.Dataset+".csv")
+	c.Data(http.StatusOK, "text/csv", buf.Bytes())
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/auth"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
+)
+
+// OrganizationHandler manages the tenants of the SIEM
+type OrganizationHandler struct {
+	DB *gorm.DB
+}
+
+// NewOrganizationHandler creates a new OrganizationHandler
+func NewOrganizationHandler(db *gorm.DB) *OrganizationHandler {
+	return &OrganizationHandler{DB: db}
+}
+
+// GetOrganizations handles GET /organizations
+func (h *OrganizationHandler) GetOrganizations(c *gin.Context) {
+	var organizations []models.Organization
+	if err := h.DB.Order("slug ASC").Find(&organizations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, organizations)
+}
+
+// GetOrganization handles GET /organizations/:id
+func (h *OrganizationHandler) GetOrganization(c *gin.Context) {
+	organization, ok := h.findOrganization(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, organization)
+}
+
+// CreateOrganization handles POST /organizations
+// Organizations are enabled unless created with enabled false
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	organization := models.Organization{Enabled: true}
+	if err := c.ShouldBindJSON(&organization); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := organization.Validate().Err(); err != nil {
+		respondValidation(c, err)
+		return
+	}
+
+	var existing int64
+	if err := h.DB.Model(&models.Organization{}).Where("slug = ?", organization.Slug).Count(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "An organization with this slug already exists"})
+		return
+	}
+
+	if err := h.DB.Create(&organization).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auth.InvalidateOrganizations()
+
+	c.JSON(http.StatusCreated, organization)
+}
+
+// UpdateOrganization handles PUT /organizations/:id
+// The slug names the organization's Elasticsearch indices, so it cannot change
+func (h *OrganizationHandler) UpdateOrganization(c *gin.Context) {
+	organization, ok := h.findOrganization(c)
+	if !ok {
+		return
+	}
+
+	slug := organization.Slug
+	if err := c.ShouldBindJSON(organization); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if organization.Slug != slug {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The slug of an organization cannot change"})
+		return
+	}
+	if err := organization.Validate().Err(); err != nil {
+		respondValidation(c, err)
+		return
+	}
+
+	if err := h.DB.Save(organization).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auth.InvalidateOrganizations()
+
+	c.JSON(http.StatusOK, organization)
+}
+
+// DeleteOrganization handles DELETE /organizations/:id
+// Organizations that users, events, rules or API keys still belong to cannot
+// be deleted; disable them instead
+func (h *OrganizationHandler) DeleteOrganization(c *gin.Context) {
+	organization, ok := h.findOrganization(c)
+	if !ok {
+		return
+	}
+
+	for _, table := range []string{"users", "security_events", "rules", "api_keys"} {
+		var ids []uint
+		if err := h.DB.Table(table).Where("organization_id = ?", organization.ID).Limit(1).Pluck("id", &ids).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(ids) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "The organization still has " + table + "; disable it instead"})
+			return
+		}
+	}
+
+	if err := h.DB.Delete(organization).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auth.InvalidateOrganizations()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Organization deleted successfully"})
+}
+
+// findOrganization loads the organization named by the :id parameter, answering the request when it cannot
+func (h *OrganizationHandler) findOrganization(c *gin.Context) (*models.Organization, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return nil, false
+	}
+
+	var organization models.Organization
+	if err := h.DB.First(&organization, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &organization, true
+}
+
+// tenantScope restricts a query to the rows of the caller's organization;
+// callers acting for every tenant see all rows
+func tenantScope(c *gin.Context, column string) func(*gorm.DB) *gorm.DB {
+	return organizationScope(middleware.CurrentOrganization(c), column)
+}
+
+// sharedTenantScope is tenantScope also admitting the rows shared by every
+// tenant, such as the rules without an organization
+func sharedTenantScope(c *gin.Context, column string) func(*gorm.DB) *gorm.DB {
+	return sharedOrganizationScope(middleware.CurrentOrganization(c), column)
+}
+
+// organizationScope restricts a query to the rows of an organization, or
+// keeps every row for nil
+func organizationScope(organizationID *uint, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if organizationID != nil {
+			return db.Where(column+" = ?", *organizationID)
+		}
+		return db
+	}
+}
+
+// sharedOrganizationScope is organizationScope also admitting the rows shared by every tenant
+func sharedOrganizationScope(organizationID *uint, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if organizationID != nil {
+			return db.Where("("+column+" = ? OR "+column+" IS NULL)", *organizationID)
+		}
+		return db
+	}
+}
+
+// assignOrganization sets the organization of a row a caller creates or
+// updates: its own for a caller acting for one, otherwise the one requested,
+// which must exist. It answers the request when it cannot.
+func assignOrganization(c *gin.Context, db *gorm.DB, organizationID **uint) bool {
+	if own := middleware.CurrentOrganization(c); own != nil {
+		id := *own
+		*organizationID = &id
+		return true
+	}
+	if *organizationID == nil {
+		return true
+	}
+	if _, err := auth.OrganizationByID(db, **organizationID); err != nil {
+		if errors.Is(err, auth.ErrUnknownOrganization) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown organization_id: " + strconv.FormatUint(uint64(**organizationID), 10)})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return false
+	}
+	return true
+}
+
+// sameOrganization reports whether two organization IDs name the same tenant
+func sameOrganization(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
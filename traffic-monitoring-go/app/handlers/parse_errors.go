@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+)
+
+// ParseErrorHandler handles the parse error statistics endpoints
+type ParseErrorHandler struct {
+	DB *gorm.DB
+}
+
+// NewParseErrorHandler creates a new ParseErrorHandler
+func NewParseErrorHandler(db *gorm.DB) *ParseErrorHandler {
+	return &ParseErrorHandler{DB: db}
+}
+
+// parseErrorRange reads from and to (RFC3339), defaulting to the last 24 hours.
+// Counts are kept per hour, so the range covers the hours it overlaps.
+func parseErrorRange(c *gin.Context) (time.Time, time.Time, bool) {
+	to := time.Now().UTC()
+	if value := c.Query("to"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, use RFC3339"})
+			return time.Time{}, time.Time{}, false
+		}
+		to = t
+	}
+	from := to.Add(-24 * time.Hour)
+	if value := c.Query("from"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, use RFC3339"})
+			return time.Time{}, time.Time{}, false
+		}
+		from = t
+	}
+	return from.Truncate(time.Hour), to, true
+}
+
+type parseErrorTotal struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// GetParseErrors handles GET /stats/parse-errors
+// Totals parse failures by collector, message type and reason, with the
+// counts behind them by source address. Filters: from, to (RFC3339, default
+// the last 24 hours), collector, source, message_type, reason
+func (h *ParseErrorHandler) GetParseErrors(c *gin.Context) {
+	from, to, ok := parseErrorRange(c)
+	if !ok {
+		return
+	}
+
+	db := database.ReadDB(h.DB)
+	filtered := func() *gorm.DB {
+		query := db.Model(&models.ParseErrorCount{}).Where("bucket_start >= ? AND bucket_start < ?", from, to)
+		if collector := c.Query("collector"); collector != "" {
+			query = query.Where("collector = ?", collector)
+		}
+		if source := c.Query("source"); source != "" {
+			query = query.Where("source_address = ?", source)
+		}
+		if messageType := c.Query("message_type"); messageType != "" {
+			query = query.Where("message_type = ?", messageType)
+		}
+		if reason := c.Query("reason"); reason != "" {
+			query = query.Where("reason = ?", reason)
+		}
+		return query
+	}
+
+	totals := make(map[string][]parseErrorTotal)
+	var total int64
+	for _, column := range []string{"collector", "message_type", "reason"} {
+		var rows []parseErrorTotal
+		err := filtered().Select(column + " AS key, SUM(count) AS count").
+			Group(column).Order("count DESC").Scan(&rows).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		totals[column] = rows
+		if column == "collector" {
+			for _, row := range rows {
+				total += row.Count
+			}
+		}
+	}
+
+	var breakdown []struct {
+		Collector     string    `json:"collector"`
+		SourceAddress string    `json:"source_address"`
+		MessageType   string    `json:"message_type"`
+		Reason        string    `json:"reason"`
+		Count         int64     `json:"count"`
+		LastSeen      time.Time `json:"last_seen"`
+	}
+	err := filtered().
+		Select("collector, source_address, message_type, reason, SUM(count) AS count, MAX(last_seen) AS last_seen").
+		Group("collector, source_address, message_type, reason").
+		Order("count DESC").Limit(100).Scan(&breakdown).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":            from,
+		"to":              to,
+		"total_failures":  total,
+		"by_collector":    totals["collector"],
+		"by_message_type": totals["message_type"],
+		"by_reason":       totals["reason"],
+		"breakdown":       breakdown,
+	})
+}
+
+// GetParseErrorSources handles GET /stats/parse-errors/sources
+// Lists the source addresses with the most parse failures, with their failure
+// rate. Filters: from, to (RFC3339, default the last 24 hours), collector,
+// limit (default 10, max 100)
+func (h *ParseErrorHandler) GetParseErrorSources(c *gin.Context) {
+	from, to, ok := parseErrorRange(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	query := database.ReadDB(h.DB).Model(&models.ParseSourceCount{}).
+		Where("bucket_start >= ? AND bucket_start < ?", from, to)
+	if collector := c.Query("collector"); collector != "" {
+		query = query.Where("collector = ?", collector)
+	}
+
+	var sources []struct {
+		Collector     string  `json:"collector"`
+		SourceAddress string  `json:"source_address"`
+		Messages      int64   `json:"messages"`
+		Failures      int64   `json:"failures"`
+		FailureRate   float64 `json:"failure_rate" gorm:"-"`
+	}
+	err = query.Select("collector, source_address, SUM(messages) AS messages, SUM(failures) AS failures").
+		Group("collector, source_address").Having("SUM(failures) > 0").
+		Order("failures DESC").Limit(limit).Scan(&sources).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range sources {
+		if sources[i].Messages > 0 {
+			sources[i].FailureRate = float64(sources[i].Failures) / float64(sources[i].Messages)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "sources": sources})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/profiling"
+)
+
+// ProfilingHandler handles the runtime profiling endpoints
+type ProfilingHandler struct {
+	Capturer *profiling.Capturer
+}
+
+// NewProfilingHandler creates a new ProfilingHandler
+func NewProfilingHandler() *ProfilingHandler {
+	return &ProfilingHandler{Capturer: profiling.NewCapturerFromEnv()}
+}
+
+// GetPprof handles GET /debug/pprof/ and GET /debug/pprof/:name
+// Serves the net/http/pprof index, profiles (e.g. heap, goroutine,
+// profile?seconds=30) and traces
+func (h *ProfilingHandler) GetPprof(c *gin.Context) {
+	switch c.Param("name") {
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	case "":
+		pprof.Index(c.Writer, c.Request)
+	default:
+		pprof.Handler(c.Param("name")).ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// GetProfiles handles GET /admin/profiles
+// Lists the profiles captured to disk, newest first
+func (h *ProfilingHandler) GetProfiles(c *gin.Context) {
+	profiles, err := h.Capturer.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profiles)
+}
+
+// CaptureProfiles handles POST /admin/profiles
+// Captures a heap and a goroutine profile now, named after the optional reason
+func (h *ProfilingHandler) CaptureProfiles(c *gin.Context) {
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Reason == "" {
+		request.Reason = "manual"
+	}
+
+	profiles, err := h.Capturer.Capture(request.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, profiles)
+}
+
+// DownloadProfile handles GET /admin/profiles/:name
+// Returns the profile file, for go tool pprof
+func (h *ProfilingHandler) DownloadProfile(c *gin.Context) {
+	path, ok := h.Capturer.Path(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+		return
+	}
+
+	c.FileAttachment(path, c.Param("name"))
+}
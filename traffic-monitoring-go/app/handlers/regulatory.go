@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// RegulatoryHandler handles regulatory report template and report endpoints
+type RegulatoryHandler struct {
+	DB       *gorm.DB
+	Reporter *siem.RegulatoryReporter
+}
+
+// NewRegulatoryHandler creates a new RegulatoryHandler
+func NewRegulatoryHandler(db *gorm.DB) *RegulatoryHandler {
+	return &RegulatoryHandler{DB: db, Reporter: siem.NewRegulatoryReporter(db)}
+}
+
+// GetRegulatoryTemplates handles GET /regulatory-templates
+func (h *RegulatoryHandler) GetRegulatoryTemplates(c *gin.Context) {
+	var templates []models.RegulatoryTemplate
+	if err := h.DB.Order("name ASC").Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// GetRegulatoryTemplate handles GET /regulatory-templates/:id
+func (h *RegulatoryHandler) GetRegulatoryTemplate(c *gin.Context) {
+	template, ok := h.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// CreateRegulatoryTemplate handles POST /regulatory-templates
+// Sections default to all of them and formats to csv
+func (h *RegulatoryHandler) CreateRegulatoryTemplate(c *gin.Context) {
+	template := models.RegulatoryTemplate{Enabled: true}
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := siem.NormalizeRegulatoryTemplate(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Create(&template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, template)
+}
+
+// UpdateRegulatoryTemplate handles PUT /regulatory-templates/:id
+func (h *RegulatoryHandler) UpdateRegulatoryTemplate(c *gin.Context) {
+	template, ok := h.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	if err := c.ShouldBindJSON(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := siem.NormalizeRegulatoryTemplate(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// DeleteRegulatoryTemplate handles DELETE /regulatory-templates/:id
+// The reports generated from the template are deleted with it
+func (h *RegulatoryHandler) DeleteRegulatoryTemplate(c *gin.Context) {
+	template, ok := h.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("template_id = ?", template.ID).Delete(&models.RegulatoryReport{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(template).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Regulatory template deleted successfully"})
+}
+
+// GenerateRegulatoryReport handles POST /regulatory-templates/:id/generate
+// Builds the report of a completed month (period: YYYY-MM, default last
+// month), replacing the one generated before
+func (h *RegulatoryHandler) GenerateRegulatoryReport(c *gin.Context) {
+	template, ok := h.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Period string `json:"period"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Period == "" {
+		location, err := time.LoadLocation(template.Timezone)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		now := h.Reporter.Clock.Now().In(location)
+		request.Period = now.AddDate(0, 0, -now.Day()).Format("2006-01")
+	}
+	if _, _, err := siem.ParseRegulatoryPeriod(template, request.Period); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.Reporter.Generate(template, request.Period)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
+
+// regulatoryReportList is how GET /regulatory-reports may be sorted and projected
+var regulatoryReportList = listSpec{
+	Model: models.RegulatoryReport{},
+	Sortable: map[string]string{
+		"id":           "id",
+		"template_id":  "template_id",
+		"period":       "period",
+		"period_start": "period_start",
+		"period_end":   "period_end",
+		"size":         "size",
+		"created_at":   "created_at",
+	},
+	DefaultSort: "period:desc,template_id:asc",
+}
+
+// GetRegulatoryReports handles GET /regulatory-reports
+// Filters by template_id and period
+func (h *RegulatoryHandler) GetRegulatoryReports(c *gin.Context) {
+	list, ok := parseListQuery(c, regulatoryReportList)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Model(&models.RegulatoryReport{})
+	if templateID := c.Query("template_id"); templateID != "" {
+		query = query.Where("template_id = ?", templateID)
+	}
+	if period := c.Query("period"); period != "" {
+		query = query.Where("period = ?", period)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var reports []models.RegulatoryReport
+	err := list.paginate(query).Omit("archive").Find(&reports).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, reports, total, list)
+}
+
+// DownloadRegulatoryReport handles GET /regulatory-reports/:id/download
+// Returns the zip holding the report's CSV and XLSX files
+func (h *RegulatoryHandler) DownloadRegulatoryReport(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report ID"})
+		return
+	}
+
+	var report models.RegulatoryReport
+	if err := h.DB.First(&report, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Regulatory report not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+report.Filename+`"`)
+	c.Data(http.StatusOK, "application/zip", report.Archive)
+}
+
+// findTemplate loads the template named by the :id parameter, answering the request when it cannot
+func (h *RegulatoryHandler) findTemplate(c *gin.Context) (*models.RegulatoryTemplate, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return nil, false
+	}
+
+	var template models.RegulatoryTemplate
+	if err := h.DB.First(&template, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Regulatory template not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &template, true
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/siem/collectors"
+)
+
+// maxCaptureBytes bounds the size of an uploaded capture
+const maxCaptureBytes = 256 << 20
+
+// ReplayCapture handles POST /collectors/replays
+// Replays a pcap or pcapng capture, sent as the body or as the "capture" file
+// of a form, through the parsing and anomaly pipeline. Query: parser (default
+// json, the simulator's events), port (only datagrams to this UDP port),
+// speed (default 1, the original pace; 0 as fast as possible) and wait=true
+// to answer with the result once the replay has finished.
+func (h *CollectorHandler) ReplayCapture(c *gin.Context) {
+	config := collectors.ReplayConfig{Parser: c.DefaultQuery("parser", "json"), Speed: 1}
+	if value := c.Query("port"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid port"})
+			return
+		}
+		config.Port = port
+	}
+	if value := c.Query("speed"); value != "" {
+		speed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid speed"})
+			return
+		}
+		config.Speed = speed
+	}
+	if err := config.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var capture io.Reader = c.Request.Body
+	if file, err := c.FormFile("capture"); err == nil {
+		opened, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer opened.Close()
+		capture = opened
+	}
+	data, err := io.ReadAll(io.LimitReader(capture, maxCaptureBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read capture"})
+		return
+	}
+	if len(data) > maxCaptureBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Capture is larger than 256 MiB"})
+		return
+	}
+
+	replay, err := h.CollectorManager.StartReplay(config, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("wait") == "true" {
+		replay.Wait()
+		c.JSON(http.StatusOK, replay.Snapshot())
+		return
+	}
+	c.JSON(http.StatusAccepted, replay.Snapshot())
+}
+
+// GetReplays handles GET /collectors/replays
+func (h *CollectorHandler) GetReplays(c *gin.Context) {
+	c.JSON(http.StatusOK, h.CollectorManager.GetReplays())
+}
+
+// GetReplay handles GET /collectors/replays/:id
+func (h *CollectorHandler) GetReplay(c *gin.Context) {
+	replay, ok := h.CollectorManager.GetReplay(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Replay not found"})
+		return
+	}
+	c.JSON(http.StatusOK, replay.Snapshot())
+}
+
+// CancelReplay handles DELETE /collectors/replays/:id
+// Stops a running replay; the events it already ingested are kept
+func (h *CollectorHandler) CancelReplay(c *gin.Context) {
+	if err := h.CollectorManager.CancelReplay(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Replay cancelled"})
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// ReportHandler handles summary report template and report endpoints
+type ReportHandler struct {
+	DB       *gorm.DB
+	Reporter *siem.SummaryReporter
+}
+
+// NewReportHandler creates a new ReportHandler
+func NewReportHandler(db *gorm.DB) *ReportHandler {
+	return &ReportHandler{DB: db, Reporter: siem.NewSummaryReporter(db)}
+}
+
+// GetReportTemplates handles GET /report-templates
+func (h *ReportHandler) GetReportTemplates(c *gin.Context) {
+	var templates []models.ReportTemplate
+	if err := h.DB.Order("name ASC").Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// GetReportTemplate handles GET /report-templates/:id
+func (h *ReportHandler) GetReportTemplate(c *gin.Context) {
+	template, ok := h.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// CreateReportTemplate handles POST /report-templates
+// Sections default to all of them, formats to html and pdf and channels to
+// every enabled notification channel
+func (h *ReportHandler) CreateReportTemplate(c *gin.Context) {
+	template := models.ReportTemplate{Enabled: true}
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.normalize(c, &template) {
+		return
+	}
+
+	if err := h.DB.Create(&template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, template)
+}
+
+// UpdateReportTemplate handles PUT /report-templates/:id
+func (h *ReportHandler) UpdateReportTemplate(c *gin.Context) {
+	template, ok := h.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	if err := c.ShouldBindJSON(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.normalize(c, template) {
+		return
+	}
+
+	if err := h.DB.Save(template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// DeleteReportTemplate handles DELETE /report-templates/:id
+// The reports generated from the template are deleted with it
+func (h *ReportHandler) DeleteReportTemplate(c *gin.Context) {
+	template, ok := h.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("template_id = ?", template.ID).Delete(&models.Report{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(template).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report template deleted successfully"})
+}
+
+// GenerateReport handles POST /report-templates/:id/generate
+// Builds the report of a completed day (YYYY-MM-DD) or week (YYYY-Www),
+// by default the last one, replacing the one generated before. With
+// deliver, the report is also sent through the template's channels.
+func (h *ReportHandler) GenerateReport(c *gin.Context) {
+	template, ok := h.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Period  string `json:"period"`
+		Deliver bool   `json:"deliver"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Period == "" {
+		period, err := siem.LastReportPeriod(template, h.Reporter.Clock.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		request.Period = period
+	}
+	if _, _, err := siem.ParseReportPeriod(template, request.Period); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.Reporter.Generate(template, request.Period)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Deliver {
+		// the outcome is recorded on the report
+		h.Reporter.Deliver(template, report)
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
+
+// reportList is how GET /reports may be sorted and projected
+var reportList = listSpec{
+	Model: models.Report{},
+	Sortable: map[string]string{
+		"id":           "id",
+		"template_id":  "template_id",
+		"period":       "period",
+		"period_start": "period_start",
+		"period_end":   "period_end",
+		"delivered_at": "delivered_at",
+		"created_at":   "created_at",
+	},
+	DefaultSort: "period_start:desc,template_id:asc",
+}
+
+// GetReports handles GET /reports
+// Filters by template_id and period
+func (h *ReportHandler) GetReports(c *gin.Context) {
+	list, ok := parseListQuery(c, reportList)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Model(&models.Report{})
+	if templateID := c.Query("template_id"); templateID != "" {
+		query = query.Where("template_id = ?", templateID)
+	}
+	if period := c.Query("period"); period != "" {
+		query = query.Where("period = ?", period)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var reports []models.Report
+	err := list.paginate(query).Omit("html", "pdf").Find(&reports).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, reports, total, list)
+}
+
+// GetReportHTML handles GET /reports/:id/html
+func (h *ReportHandler) GetReportHTML(c *gin.Context) {
+	report, ok := h.findReport(c)
+	if !ok {
+		return
+	}
+	if len(report.HTML) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report was not rendered to HTML"})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", report.HTML)
+}
+
+// GetReportPDF handles GET /reports/:id/pdf
+func (h *ReportHandler) GetReportPDF(c *gin.Context) {
+	report, ok := h.findReport(c)
+	if !ok {
+		return
+	}
+	if len(report.PDF) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report was not rendered to PDF"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+report.Filename+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", report.PDF)
+}
+
+// DeliverReport handles POST /reports/:id/deliver
+// Sends the report again through its template's channels
+func (h *ReportHandler) DeliverReport(c *gin.Context) {
+	report, ok := h.findReport(c)
+	if !ok {
+		return
+	}
+
+	var template models.ReportTemplate
+	if err := h.DB.First(&template, report.TemplateID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Reporter.Deliver(&template, report); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "delivered_to": report.DeliveredTo})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// normalize validates a template and its channels, answering the request when it is invalid
+func (h *ReportHandler) normalize(c *gin.Context, template *models.ReportTemplate) bool {
+	if err := siem.NormalizeReportTemplate(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := h.Reporter.CheckChannels(template.Channels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// findTemplate loads the template named by the :id parameter, answering the request when it cannot
+func (h *ReportHandler) findTemplate(c *gin.Context) (*models.ReportTemplate, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return nil, false
+	}
+
+	var template models.ReportTemplate
+	if err := h.DB.First(&template, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Report template not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &template, true
+}
+
+// findReport loads the report named by the :id parameter, answering the request when it cannot
+func (h *ReportHandler) findReport(c *gin.Context) (*models.Report, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report ID"})
+		return nil, false
+	}
+
+	var report models.Report
+	if err := h.DB.First(&report, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &report, true
+}
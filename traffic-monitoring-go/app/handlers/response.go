@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// ResponseHandler handles the response actions of rules, their audit log and
+// what they blocked
+type ResponseHandler struct {
+	DB     *gorm.DB
+	Runner *siem.ResponseRunner
+}
+
+// NewResponseHandler creates a new ResponseHandler
+func NewResponseHandler(db *gorm.DB) *ResponseHandler {
+	return &ResponseHandler{DB: db, Runner: siem.NewResponseRunner(db)}
+}
+
+// responseExecutionList is how GET /response/executions may be sorted and projected
+var responseExecutionList = listSpec{
+	Model: models.ResponseExecution{},
+	Sortable: map[string]string{
+		"id":          "id",
+		"created_at":  "created_at",
+		"executed_at": "executed_at",
+		"status":      "status",
+		"type":        "type",
+	},
+	DefaultSort: "id:desc",
+}
+
+// findRuleAction loads the action :actionId of the rule :id
+func (h *ResponseHandler) findRuleAction(c *gin.Context) (*models.ResponseAction, bool) {
+	ruleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return nil, false
+	}
+	actionID, err := strconv.Atoi(c.Param("actionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action ID"})
+		return nil, false
+	}
+
+	var action models.ResponseAction
+	if err := h.DB.Where("rule_id = ?", ruleID).First(&action, actionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Response action not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &action, true
+}
+
+// GetResponseActions handles GET /rules/:id/actions
+func (h *ResponseHandler) GetResponseActions(c *gin.Context) {
+	ruleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	var actions []models.ResponseAction
+	if err := h.DB.Where("rule_id = ?", ruleID).Order("id ASC").Find(&actions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, actions)
+}
+
+// CreateResponseAction handles POST /rules/:id/actions
+// The action runs on each alert the rule raises from then on; dry_run=true
+// records what it would do without doing it
+func (h *ResponseHandler) CreateResponseAction(c *gin.Context) {
+	ruleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+	var req struct {
+		Name    string                    `json:"name" binding:"required"`
+		Type    models.ResponseActionType `json:"type" binding:"required"`
+		Config  map[string]string         `json:"config"`
+		Enabled *bool                     `json:"enabled"`
+		DryRun  bool                      `json:"dry_run"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rule models.Rule
+	if err := h.DB.First(&rule, ruleID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	action := models.ResponseAction{
+		RuleID:  rule.ID,
+		Name:    req.Name,
+		Type:    req.Type,
+		Config:  req.Config,
+		Enabled: req.Enabled == nil || *req.Enabled,
+		DryRun:  req.DryRun,
+	}
+	if claims := middleware.CurrentClaims(c); claims != nil {
+		action.CreatedBy = claims.Actor()
+	}
+	if err := h.Runner.Validate(&action); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Create(&action).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateResponseActions()
+
+	c.JSON(http.StatusCreated, action)
+}
+
+// UpdateResponseAction handles PUT /rules/:id/actions/:actionId
+// Takes any of name, config, enabled and dry_run
+func (h *ResponseHandler) UpdateResponseAction(c *gin.Context) {
+	action, ok := h.findRuleAction(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name    *string            `json:"name"`
+		Config  *map[string]string `json:"config"`
+		Enabled *bool              `json:"enabled"`
+		DryRun  *bool              `json:"dry_run"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		action.Name = *req.Name
+	}
+	if req.Config != nil {
+		action.Config = *req.Config
+	}
+	if req.Enabled != nil {
+		action.Enabled = *req.Enabled
+	}
+	if req.DryRun != nil {
+		action.DryRun = *req.DryRun
+	}
+	if err := h.Runner.Validate(action); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(action).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateResponseActions()
+
+	c.JSON(http.StatusOK, action)
+}
+
+// DeleteResponseAction handles DELETE /rules/:id/actions/:actionId
+// Its executions stay in the audit log
+func (h *ResponseHandler) DeleteResponseAction(c *gin.Context) {
+	action, ok := h.findRuleAction(c)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(action).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateResponseActions()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Response action deleted successfully"})
+}
+
+// DryRunResponseAction handles POST /rules/:id/actions/:actionId/dry-run
+// Shows what the action would do for alert_id, by default the latest alert of
+// the rule, and records the dry run in the audit log
+func (h *ResponseHandler) DryRunResponseAction(c *gin.Context) {
+	action, ok := h.findRuleAction(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		AlertID uint `json:"alert_id"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	query := h.DB.Preload("Rule").Preload("SecurityEvent").Where("rule_id = ?", action.RuleID)
+	if req.AlertID != 0 {
+		query = query.Where("id = ?", req.AlertID)
+	}
+	var alert models.Alert
+	if err := query.Order("id DESC").First(&alert).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No alert of the rule to dry run against"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	actor := "anonymous"
+	if claims := middleware.CurrentClaims(c); claims != nil {
+		actor = claims.Actor()
+	}
+	execution, err := h.Runner.DryRun(action, &alert, actor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, execution)
+}
+
+// GetResponseExecutions handles GET /response/executions
+// The audit log of response actions. Filters by rule_id, action_id, alert_id,
+// status and type; takes the list parameters page, pageSize, sort and fields
+func (h *ResponseHandler) GetResponseExecutions(c *gin.Context) {
+	list, ok := parseListQuery(c, responseExecutionList)
+	if !ok {
+		return
+	}
+
+	query := database.ReadDB(h.DB).Model(&models.ResponseExecution{})
+	for _, param := range []string{"rule_id", "action_id", "alert_id"} {
+		if value := c.Query(param); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			query = query.Where(param+" = ?", id)
+		}
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if actionType := c.Query("type"); actionType != "" {
+		query = query.Where("type = ?", actionType)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var executions []models.ResponseExecution
+	if err := list.paginate(query).Find(&executions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, executions, total, list)
+}
+
+// GetBlocklist handles GET /response/blocklist
+// Lists the blocked source IPs; all=true includes expired blocks, and
+// format=text answers one IP per line for firewalls to pull
+func (h *ResponseHandler) GetBlocklist(c *gin.Context) {
+	query := database.ReadDB(h.DB).Order("created_at DESC")
+	if c.Query("all") != "true" {
+		query = query.Where("expires_at IS NULL OR expires_at > ?", clock.Default().Now())
+	}
+
+	var blocked []models.BlockedIP
+	if err := query.Find(&blocked).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "text" {
+		var lines strings.Builder
+		for _, entry := range blocked {
+			lines.WriteString(entry.IP + "\n")
+		}
+		c.String(http.StatusOK, lines.String())
+		return
+	}
+	c.JSON(http.StatusOK, blocked)
+}
+
+// DeleteBlockedIP handles DELETE /response/blocklist/:id
+func (h *ResponseHandler) DeleteBlockedIP(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid blocklist entry ID"})
+		return
+	}
+
+	if err := h.DB.Delete(&models.BlockedIP{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "IP unblocked successfully"})
+}
+
+// GetUntrustedVehicles handles GET /response/untrusted-vehicles
+// Lists the V2X sources marked untrusted; all=true includes expired marks
+func (h *ResponseHandler) GetUntrustedVehicles(c *gin.Context) {
+	query := database.ReadDB(h.DB).Order("created_at DESC")
+	if c.Query("all") != "true" {
+		query = query.Where("expires_at IS NULL OR expires_at > ?", clock.Default().Now())
+	}
+
+	var vehicles []models.UntrustedVehicle
+	if err := query.Find(&vehicles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, vehicles)
+}
+
+// DeleteUntrustedVehicle handles DELETE /response/untrusted-vehicles/:id
+func (h *ResponseHandler) DeleteUntrustedVehicle(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid untrusted vehicle ID"})
+		return
+	}
+
+	if err := h.DB.Delete(&models.UntrustedVehicle{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vehicle trust restored successfully"})
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/elasticsearch"
+)
+
+// RetentionHandler handles retention policy endpoints
+type RetentionHandler struct {
+	DB      *gorm.DB
+	Manager *siem.RetentionManager
+}
+
+// NewRetentionHandler creates a new RetentionHandler
+func NewRetentionHandler(db *gorm.DB, esService *elasticsearch.Service) *RetentionHandler {
+	return &RetentionHandler{DB: db, Manager: siem.NewRetentionManager(db, esService)}
+}
+
+// GetRetentionPolicies handles GET /retention/policies
+func (h *RetentionHandler) GetRetentionPolicies(c *gin.Context) {
+	var policies []models.RetentionPolicy
+	if err := h.DB.Order("name ASC").Find(&policies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, policies)
+}
+
+// GetRetentionPolicy handles GET /retention/policies/:id
+func (h *RetentionHandler) GetRetentionPolicy(c *gin.Context) {
+	policy, ok := h.findPolicy(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// CreateRetentionPolicy handles POST /retention/policies
+// Takes target events (with an optional category and action delete or
+// rollup) or index (with an index_family), and max_age_days
+func (h *RetentionHandler) CreateRetentionPolicy(c *gin.Context) {
+	policy := models.RetentionPolicy{Enabled: true}
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := siem.NormalizeRetentionPolicy(&policy); err != nil {
+		respondValidation(c, err)
+		return
+	}
+
+	if err := h.DB.Create(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, policy)
+}
+
+// UpdateRetentionPolicy handles PUT /retention/policies/:id
+func (h *RetentionHandler) UpdateRetentionPolicy(c *gin.Context) {
+	policy, ok := h.findPolicy(c)
+	if !ok {
+		return
+	}
+
+	id := policy.ID
+	if err := c.ShouldBindJSON(policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	policy.ID = id
+	if err := siem.NormalizeRetentionPolicy(policy); err != nil {
+		respondValidation(c, err)
+		return
+	}
+
+	if err := h.DB.Save(policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeleteRetentionPolicy handles DELETE /retention/policies/:id
+func (h *RetentionHandler) DeleteRetentionPolicy(c *gin.Context) {
+	policy, ok := h.findPolicy(c)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Retention policy deleted successfully"})
+}
+
+// RunRetentionPolicy handles POST /retention/policies/:id/run
+// Purges what the policy expires now, enabled or not; dry_run=true only
+// reports what would be purged
+func (h *RetentionHandler) RunRetentionPolicy(c *gin.Context) {
+	policy, ok := h.findPolicy(c)
+	if !ok {
+		return
+	}
+
+	run := h.Manager.Run(policy, c.Query("dry_run") == "true")
+	if run.Error != "" {
+		c.JSON(http.StatusBadGateway, run)
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+// RunRetentionPolicies handles POST /retention/run
+// Applies every enabled policy now
+func (h *RetentionHandler) RunRetentionPolicies(c *gin.Context) {
+	runs, err := h.Manager.RunAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+// GetEventRollups handles GET /retention/rollups
+// Daily counts of the events rollup policies deleted. Query: from and to
+// (YYYY-MM-DD), category and log_source_id.
+func (h *RetentionHandler) GetEventRollups(c *gin.Context) {
+	query := database.ReadDB(h.DB).Order("day ASC, log_source_id ASC, category ASC, severity ASC")
+	for _, bound := range []struct{ param, condition string }{
+		{"from", "day >= ?"},
+		{"to", "day <= ?"},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.param + ", expected YYYY-MM-DD"})
+			return
+		}
+		query = query.Where(bound.condition, day)
+	}
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if value := c.Query("log_source_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid log_source_id"})
+			return
+		}
+		query = query.Where("log_source_id = ?", id)
+	}
+
+	var rollups []models.SecurityEventRollup
+	if err := query.Find(&rollups).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rollups)
+}
+
+// findPolicy loads the retention policy named by the :id parameter, answering the request when it cannot
+func (h *RetentionHandler) findPolicy(c *gin.Context) (*models.RetentionPolicy, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid retention policy ID"})
+		return nil, false
+	}
+
+	var policy models.RetentionPolicy
+	if err := h.DB.First(&policy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Retention policy not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &policy, true
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/routing"
+)
+
+// RoutingHandler handles event sink and routing rule endpoints
+type RoutingHandler struct {
+	DB *gorm.DB
+}
+
+// NewRoutingHandler creates a new RoutingHandler and loads the configured routes
+func NewRoutingHandler(db *gorm.DB) *RoutingHandler {
+	if err := routing.Load(db); err != nil {
+		log.Printf("Warning: failed to load event routing: %v", err)
+	}
+	return &RoutingHandler{DB: db}
+}
+
+// reload applies stored sink and rule changes to the running router
+func (h *RoutingHandler) reload() {
+	if err := routing.Load(h.DB); err != nil {
+		log.Printf("Error reloading event routing: %v", err)
+	}
+}
+
+// GetSinks handles GET /routing/sinks
+func (h *RoutingHandler) GetSinks(c *gin.Context) {
+	var sinks []models.EventSink
+	if err := h.DB.Order("name ASC").Find(&sinks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sinks)
+}
+
+// CreateSink handles POST /routing/sinks
+func (h *RoutingHandler) CreateSink(c *gin.Context) {
+	var sink models.EventSink
+	if err := c.ShouldBindJSON(&sink); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateEventSink(&sink); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Create(&sink).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.reload()
+
+	c.JSON(http.StatusCreated, sink)
+}
+
+// UpdateSink handles PUT /routing/sinks/:id
+func (h *RoutingHandler) UpdateSink(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sink ID"})
+		return
+	}
+
+	var sink models.EventSink
+	if err := h.DB.First(&sink, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sink not found"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&sink); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sink.ID = uint(id)
+
+	if err := validateEventSink(&sink); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(&sink).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.reload()
+
+	c.JSON(http.StatusOK, sink)
+}
+
+// DeleteSink handles DELETE /routing/sinks/:id
+func (h *RoutingHandler) DeleteSink(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sink ID"})
+		return
+	}
+
+	if err := h.DB.Delete(&models.EventSink{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.reload()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sink deleted successfully"})
+}
+
+// validateEventSink checks that a sink can be built from its configuration
+func validateEventSink(sink *models.EventSink) error {
+	if sink.Name == "" {
+		return errors.New("sink name is required")
+	}
+	if sink.Type == models.SinkTypePostgres {
+		// building a postgres sink connects and creates its table; leave that to the router
+		return nil
+	}
+	built, err := routing.NewSink(*sink, nil)
+	if err != nil {
+		return err
+	}
+	return built.Close()
+}
+
+// GetRoutingRules handles GET /routing/rules
+func (h *RoutingHandler) GetRoutingRules(c *gin.Context) {
+	var rules []models.RoutingRule
+	if err := h.DB.Order("id ASC").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateRoutingRule handles POST /routing/rules
+func (h *RoutingHandler) CreateRoutingRule(c *gin.Context) {
+	var rule models.RoutingRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if rule.Name == "" || len(rule.Sinks) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Routing rule name and at least one sink are required"})
+		return
+	}
+
+	if err := h.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.reload()
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRoutingRule handles PUT /routing/rules/:id
+func (h *RoutingHandler) UpdateRoutingRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid routing rule ID"})
+		return
+	}
+
+	var rule models.RoutingRule
+	if err := h.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Routing rule not found"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = uint(id)
+
+	if rule.Name == "" || len(rule.Sinks) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Routing rule name and at least one sink are required"})
+		return
+	}
+
+	if err := h.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.reload()
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRoutingRule handles DELETE /routing/rules/:id
+func (h *RoutingHandler) DeleteRoutingRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid routing rule ID"})
+		return
+	}
+
+	if err := h.DB.Delete(&models.RoutingRule{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.reload()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Routing rule deleted successfully"})
+}
+
+// GetRoutingMetrics handles GET /routing/metrics
+func (h *RoutingHandler) GetRoutingMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"sinks": routing.GetMetrics()})
+}
@@ -8,31 +8,61 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/elasticsearch"
 	)
 
 
 
 // RuleHandler handles rule-related endpoints
 type RuleHandler struct {
-	DB *gorm.DB
+	DB         *gorm.DB
+	Backtester *siem.RuleBacktester
+	CatchUp    *siem.CatchUpEvaluator
 }
 
 // NewRuleHandler creates a new RuleHandler
-func NewRuleHandler(db *gorm.DB) *RuleHandler {
-	return &RuleHandler{DB: db}
+func NewRuleHandler(db *gorm.DB, esService *elasticsearch.Service) *RuleHandler {
+	return &RuleHandler{
+		DB:         db,
+		Backtester: siem.NewRuleBacktester(db, esService),
+		CatchUp:    siem.NewCatchUpEvaluator(db),
+	}
 }
 
 
+// ruleList is how GET /rules may be sorted and projected
+var ruleList = listSpec{
+	Model: models.Rule{},
+	Sortable: map[string]string{
+		"id":         "id",
+		"name":       "name",
+		"severity":   "severity",
+		"category":   "category",
+		"status":     "status",
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	},
+	DefaultSort:     "name:asc",
+	DefaultPageSize: 100,
+	MaxPageSize:     1000,
+}
+
 // GetRules handles GET /rules
+// Takes the list parameters page, pageSize, sort and fields. Callers acting
+// for an organization see its rules and those shared by every tenant.
 func (h *RuleHandler) GetRules(c *gin.Context) {
-	var rules []models.Rule
+	list, ok := parseListQuery(c, ruleList)
+	if !ok {
+		return
+	}
 
 	// basic filtering by status
 	status := c.Query("status")
 	category := c.Query("category")
 
 	// Create a query builder
-	query := h.DB.Model(&models.Rule{})
+	query := h.DB.Model(&models.Rule{}).Scopes(sharedTenantScope(c, "organization_id"))
 
 	if status != "" {
 		query = query.Where("status = ?", status)
@@ -42,15 +72,29 @@ func (h *RuleHandler) GetRules(c *gin.Context) {
 		query = query.Where("category = ?", category)
 	}
 
-	// Order by name ascending
-	query = query.Order("name ASC")
+	// rules tagged with an ATT&CK technique or one of its sub-techniques
+	if technique := c.Query("technique"); technique != "" {
+		query = siem.FilterByTechnique(query, "rules", technique)
+	}
+
+	// rules tagged with a V2X threat
+	if threat := c.Query("threat"); threat != "" {
+		query = siem.FilterByThreat(query, "rules", threat)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := query.Find(&rules).Error; err != nil {
+	var rules []models.Rule
+	if err := list.paginate(query).Find(&rules).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, rules)
+	respondList(c, rules, total, list)
 }
 
 
@@ -63,7 +107,7 @@ func (h *RuleHandler) GetRule(c *gin.Context) {
 	}
 
 	var rule models.Rule
-	if err := h.DB.First(&rule, id).Error; err != nil {
+	if err := h.DB.Scopes(sharedTenantScope(c, "organization_id")).First(&rule, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
 		return
 	}
@@ -73,6 +117,7 @@ func (h *RuleHandler) GetRule(c *gin.Context) {
 
 
 // CreateRule handles POST /rules
+// Rules created by a caller acting for an organization only apply to its events
 func (h *RuleHandler) CreateRule(c *gin.Context) {
 	var rule models.Rule
 	if err := c.ShouldBindJSON(&rule); err != nil {
@@ -85,17 +130,27 @@ func (h *RuleHandler) CreateRule(c *gin.Context) {
 	if rule.Status == "" {
 		rule.Status = models.RuleStatusDisabled
 	}
+	if !assignOrganization(c, h.DB, &rule.OrganizationID) {
+		return
+	}
+
+	if err := siem.ValidateRule(h.DB, &rule); err != nil {
+		respondValidation(c, err)
+		return
+	}
 
 	if err := h.DB.Create(&rule).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	siem.InvalidateRuleIndex()
 
 	c.JSON(http.StatusCreated, rule)
 }
 
 
 // UpdateRule handles PUT /rules/:id
+// Callers acting for an organization may only change its own rules
 func (h *RuleHandler) UpdateRule(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -104,7 +159,7 @@ func (h *RuleHandler) UpdateRule(c *gin.Context) {
 	}
 
 	var rule models.Rule
-	if err := h.DB.First(&rule, id).Error; err != nil {
+	if err := h.DB.Scopes(tenantScope(c, "organization_id")).First(&rule, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
 		return
 	}
@@ -113,17 +168,27 @@ func (h *RuleHandler) UpdateRule(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !assignOrganization(c, h.DB, &rule.OrganizationID) {
+		return
+	}
+
+	if err := siem.ValidateRule(h.DB, &rule); err != nil {
+		respondValidation(c, err)
+		return
+	}
 
 	if err := h.DB.Save(&rule).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	siem.InvalidateRuleIndex()
 
 	c.JSON(http.StatusOK, rule)
 }
 
 
 // DeleteRule handles DELETE /rules/:id
+// Callers acting for an organization may only delete its own rules
 func (h *RuleHandler) DeleteRule(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -131,6 +196,16 @@ func (h *RuleHandler) DeleteRule(c *gin.Context) {
 		return
 	}
 
+	var owned int64
+	if err := h.DB.Model(&models.Rule{}).Scopes(tenantScope(c, "organization_id")).Where("id = ?", id).Count(&owned).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if owned == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
 
 	// check if any alerts reference this rule before deletion
 	var alertCount int64
@@ -147,23 +222,65 @@ func (h *RuleHandler) DeleteRule(c *gin.Context) {
 		return
 	}
 
-	if err := h.DB.Delete(&models.Rule{}, id).Error; err != nil {
+	// its response actions go with it; their executions stay in the audit log
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("rule_id = ?", id).Delete(&models.ResponseAction{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Rule{}, id).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	siem.InvalidateRuleIndex()
+	siem.InvalidateResponseActions()
 
 	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted successfully"})
 }
 
 
+// GetRuleEvaluationStats handles GET /rules/stats
+// Reports how many rule evaluations the scope index has avoided
+func (h *RuleHandler) GetRuleEvaluationStats(c *gin.Context) {
+	c.JSON(http.StatusOK, siem.GetRuleIndexStats())
+}
 
 
+// BacktestRule handles POST /rules/backtest
+// Evaluates a draft rule against historical events without creating alerts
+func (h *RuleHandler) BacktestRule(c *gin.Context) {
+	var req siem.BacktestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	result, err := h.Backtester.Run(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	c.JSON(http.StatusOK, result)
+}
 
 
+// CatchUpRules handles POST /rules/catch-up
+// Re-evaluates the events of a past window in timestamp order, e.g. after
+// downtime, raising late-evaluated alerts for matches missed in real time
+func (h *RuleHandler) CatchUpRules(c *gin.Context) {
+	var req siem.CatchUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	result, err := h.CatchUp.Run(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-
-
-
+	c.JSON(http.StatusOK, result)
+}
@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
 	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
 	"traffic-monitoring-go/app/siem/elasticsearch"
 )
 
@@ -15,6 +20,7 @@ import (
 type SecurityEventHandler struct {
 	DB        *gorm.DB
 	ESService *elasticsearch.Service
+	Searcher  *siem.EventSearcher
 }
 
 // NewSecurityEventHandler creates a new SecurityEventHandler
@@ -22,24 +28,45 @@ func NewSecurityEventHandler(db *gorm.DB, esService *elasticsearch.Service) *Sec
 	return &SecurityEventHandler{
 		DB:        db,
 		ESService: esService,
+		Searcher:  siem.NewEventSearcher(db, esService),
 	}
 }
 
+// securityEventList is how GET /security-events may be sorted and projected
+var securityEventList = listSpec{
+	Model: models.SecurityEvent{},
+	Sortable: map[string]string{
+		"id":         "id",
+		"timestamp":  "timestamp",
+		"severity":   "severity",
+		"category":   "category",
+		"source_ip":  "source_ip",
+		"device_id":  "device_id",
+		"created_at": "created_at",
+	},
+	DefaultSort: "timestamp:desc",
+}
+
+// securityEventSearchList is how GET /security-events/search may be
+// projected; hits come in the order of the search
+var securityEventSearchList = listSpec{Model: models.SecurityEvent{}}
+
 // GetSecurityEvents handles GET /security-events
+// Filters by severity and category; category=v2x lists V2X messages.
+// Takes the list parameters page, pageSize, sort and fields. Callers acting
+// for an organization only see its events.
 func (h *SecurityEventHandler) GetSecurityEvents(c *gin.Context) {
-	var events []models.SecurityEvent
-
-	// Basic pagination
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
-	offset := (page - 1) * pageSize
+	list, ok := parseListQuery(c, securityEventList)
+	if !ok {
+		return
+	}
 
 	// Basic filtering by severity and category
 	severity := c.Query("severity")
 	category := c.Query("category")
 
-	// Create a query builder
-	query := h.DB.Model(&models.SecurityEvent{})
+	// Create a query builder on a read replica when one is available
+	query := database.ReadDB(h.DB).Model(&models.SecurityEvent{}).Scopes(tenantScope(c, "organization_id"))
 
 	if severity != "" {
 		query = query.Where("severity = ?", severity)
@@ -49,28 +76,21 @@ func (h *SecurityEventHandler) GetSecurityEvents(c *gin.Context) {
 		query = query.Where("category = ?", category)
 	}
 
-	// Order by timestamp descending (most recent first)
-	query = query.Order("timestamp DESC")
-
 	// Count total for pagination info
 	var total int64
-	query.Count(&total)
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Execute the query with pagination
-	if err := query.Offset(offset).Limit(pageSize).Find(&events).Error; err != nil {
+	var events []models.SecurityEvent
+	if err := list.paginate(query).Find(&events).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data": events,
-		"pagination": gin.H{
-			"page":     page,
-			"pageSize": pageSize,
-			"total":    total,
-			"pages":    (total + int64(pageSize) - 1) / int64(pageSize),
-		},
-	})
+	respondList(c, events, total, list)
 }
 
 // GetSecurityEvent handles GET /security-events/:id
@@ -82,7 +102,7 @@ func (h *SecurityEventHandler) GetSecurityEvent(c *gin.Context) {
 	}
 
 	var event models.SecurityEvent
-	if err := h.DB.First(&event, id).Error; err != nil {
+	if err := h.DB.Scopes(tenantScope(c, "organization_id")).First(&event, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Security event not found"})
 		return
 	}
@@ -91,12 +111,20 @@ func (h *SecurityEventHandler) GetSecurityEvent(c *gin.Context) {
 }
 
 // CreateSecurityEvent handles POST /security-events
+// Events created by a caller acting for an organization belong to it
 func (h *SecurityEventHandler) CreateSecurityEvent(c *gin.Context) {
 	var event models.SecurityEvent
 	if err := c.ShouldBindJSON(&event); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := event.Validate().Err(); err != nil {
+		respondValidation(c, err)
+		return
+	}
+	if !assignOrganization(c, h.DB, &event.OrganizationID) {
+		return
+	}
 
 	// Save to database
 	if err := h.DB.Create(&event).Error; err != nil {
@@ -121,6 +149,7 @@ func (h *SecurityEventHandler) CreateSecurityEvent(c *gin.Context) {
 }
 
 // CreateBatchSecurityEvents handles POST /security-events/batch
+// Violations are reported per event as [index].field
 func (h *SecurityEventHandler) CreateBatchSecurityEvents(c *gin.Context) {
 	var events []models.SecurityEvent
 	if err := c.ShouldBindJSON(&events); err != nil {
@@ -128,6 +157,23 @@ func (h *SecurityEventHandler) CreateBatchSecurityEvents(c *gin.Context) {
 		return
 	}
 
+	// the batch is stored only if every event is valid
+	invalid := &models.ValidationError{}
+	for i := range events {
+		for _, v := range events[i].Validate().Violations {
+			invalid.Add(fmt.Sprintf("[%d].%s", i, v.Field), "%s", v.Message)
+		}
+	}
+	if err := invalid.Err(); err != nil {
+		respondValidation(c, err)
+		return
+	}
+	for i := range events {
+		if !assignOrganization(c, h.DB, &events[i].OrganizationID) {
+			return
+		}
+	}
+
 	// Use a transaction for batch insert
 	err := h.DB.Transaction(func(tx *gorm.DB) error {
 		for i := range events {
@@ -169,156 +215,153 @@ func (h *SecurityEventHandler) CreateBatchSecurityEvents(c *gin.Context) {
 }
 
 // SearchSecurityEvents handles GET /security-events/search
+// Filters by severity, category, source_ip, destination_ip, from and to, and
+// matches search against the message, addresses and device ID; query takes a
+// raw Elasticsearch query instead. highlight=true adds message snippets to each
+// hit; facets=severity,category,source (or facets=true for all of them) counts
+// the matches by those fields; geohash=u09t,u09w limits the search to located
+// events in those cells. While Elasticsearch is unavailable the filters are
+// applied to the database instead (without highlighting, raw queries or
+// geohashes), and backend tells which one served the search. Takes the list
+// parameters page, pageSize and fields.
 func (h *SecurityEventHandler) SearchSecurityEvents(c *gin.Context) {
-	// Check if Elasticsearch is available
-	if h.ESService == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Elasticsearch service not available"})
+	list, ok := parseListQuery(c, securityEventSearchList)
+	if !ok {
 		return
 	}
 
-	// Get pagination parameters
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
-	if page < 1 {
-		page = 1
-	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 50
+	search := siem.EventSearch{
+		Severity:      c.Query("severity"),
+		Category:      c.Query("category"),
+		SourceIP:      c.Query("source_ip"),
+		DestinationIP: c.Query("destination_ip"),
+		From:          c.Query("from"),
+		To:            c.Query("to"),
+		Text:          c.Query("search"),
+		Page:          list.Page,
+		PageSize:      list.PageSize,
 	}
 
-	// Build query from query parameters
-	var query map[string]interface{}
-	
-	// If a raw query is provided, use it
-	rawQuery := c.Query("query")
-	if rawQuery != "" {
-		if err := json.Unmarshal([]byte(rawQuery), &query); err != nil {
+	// A raw query replaces the individual parameters
+	if rawQuery := c.Query("query"); rawQuery != "" {
+		if err := json.Unmarshal([]byte(rawQuery), &search.Query); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query JSON: " + err.Error()})
 			return
 		}
-	} else {
-		// Otherwise, build a query from individual parameters
-		query = buildElasticsearchQuery(c)
 	}
 
-	// Execute search
-	events, total, err := h.ESService.SearchSecurityEvents(query, page, pageSize)
+	opts := elasticsearch.SearchOptions{Highlight: c.Query("highlight") == "true"}
+	if facets := c.Query("facets"); facets == "true" {
+		opts.Facets = []string{"severity", "category", "source"}
+	} else if facets != "" && facets != "false" {
+		for _, facet := range strings.Split(facets, ",") {
+			facet = strings.TrimSpace(facet)
+			if _, ok := elasticsearch.SearchFacetFields[facet]; !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown facet: " + facet + " (use severity, category or source)"})
+				return
+			}
+			opts.Facets = append(opts.Facets, facet)
+		}
+	}
+	if facetSize, err := strconv.Atoi(c.Query("facet_size")); err == nil && facetSize > 0 && facetSize <= 50 {
+		opts.FacetSize = facetSize
+	}
+	if geohashes := c.Query("geohash"); geohashes != "" {
+		for _, geohash := range strings.Split(geohashes, ",") {
+			geohash = strings.ToLower(strings.TrimSpace(geohash))
+			if !elasticsearch.ValidGeohash(geohash) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid geohash: " + geohash})
+				return
+			}
+			opts.Geohashes = append(opts.Geohashes, geohash)
+		}
+	}
+	search.Options = opts
+
+	// Execute search, on the database when Elasticsearch cannot serve it
+	result, err := h.Searcher.Search(search)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search events: " + err.Error()})
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to search events: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data": events,
-		"pagination": gin.H{
-			"page":     page,
-			"pageSize": pageSize,
-			"total":    total,
-			"pages":    (total + pageSize - 1) / pageSize,
-		},
-	})
-}
-
-// Helper function to build an Elasticsearch query from HTTP request params
-func buildElasticsearchQuery(c *gin.Context) map[string]interface{} {
-	// Start with a match_all query
-	query := map[string]interface{}{
-		"match_all": map[string]interface{}{},
-	}
-	
-	// Add bool query if filters are provided
-	var filters []map[string]interface{}
-	
-	// Add filters for common fields
-	if severity := c.Query("severity"); severity != "" {
-		filters = append(filters, map[string]interface{}{
-			"term": map[string]interface{}{
-				"severity": severity,
-			},
-		})
-	}
-	
-	if category := c.Query("category"); category != "" {
-		filters = append(filters, map[string]interface{}{
-			"term": map[string]interface{}{
-				"category": category,
-			},
-		})
+	extra := gin.H{
+		"took_ms": result.Took,
+		"routed":  result.Routed,
+		"backend": result.Backend,
 	}
-	
-	if sourceIP := c.Query("source_ip"); sourceIP != "" {
-		filters = append(filters, map[string]interface{}{
-			"term": map[string]interface{}{
-				"source_ip": sourceIP,
-			},
-		})
+	if result.FallbackReason != "" {
+		extra["fallback_reason"] = result.FallbackReason
 	}
-	
-	if destIP := c.Query("destination_ip"); destIP != "" {
-		filters = append(filters, map[string]interface{}{
-			"term": map[string]interface{}{
-				"destination_ip": destIP,
-			},
-		})
+	if result.Facets != nil {
+		extra["facets"] = result.Facets
 	}
-	
-	// Add time range filter
-	if from := c.Query("from"); from != "" {
-		if to := c.Query("to"); to != "" {
-			filters = append(filters, map[string]interface{}{
-				"range": map[string]interface{}{
-					"timestamp": map[string]interface{}{
-						"gte": from,
-						"lte": to,
-					},
-				},
-			})
-		} else {
-			filters = append(filters, map[string]interface{}{
-				"range": map[string]interface{}{
-					"timestamp": map[string]interface{}{
-						"gte": from,
-					},
-				},
-			})
+	respondListWith(c, result.Events, int64(result.Total), list, extra)
+}
+
+// GetEventDensity handles GET /security-events/density
+// Counts the V2X messages and anomaly findings located in the box given by
+// north, south, east and west (degrees) between from and to (RFC3339, the
+// last hour by default, at most 7 days) by geohash cell, so maps can draw heat
+// layers without the raw locations. precision sets the geohash length of the
+// cells (1-9), which otherwise is the finest keeping the box within 2048 cells.
+// Served from Elasticsearch geo aggregations, or from the database while
+// Elasticsearch is unavailable; backend tells which one.
+func (h *SecurityEventHandler) GetEventDensity(c *gin.Context) {
+	var density siem.EventDensity
+	for _, bound := range []struct {
+		param string
+		value *float64
+	}{{"north", &density.Box.North}, {"south", &density.Box.South}, {"east", &density.Box.East}, {"west", &density.Box.West}} {
+		value, err := strconv.ParseFloat(c.Query(bound.param), 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or missing " + bound.param})
+			return
 		}
-	} else if to := c.Query("to"); to != "" {
-		filters = append(filters, map[string]interface{}{
-			"range": map[string]interface{}{
-				"timestamp": map[string]interface{}{
-					"lte": to,
-				},
-			},
-		})
+		*bound.value = value
 	}
-	
-	// Add text search if provided
-	if searchText := c.Query("search"); searchText != "" {
-		query = map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": map[string]interface{}{
-					"multi_match": map[string]interface{}{
-						"query":  searchText,
-						"fields": []string{"message", "source_ip", "destination_ip", "device_id"},
-					},
-				},
-			},
+
+	density.To = time.Now().UTC()
+	density.From = density.To.Add(-time.Hour)
+	for _, bound := range []struct {
+		param string
+		value *time.Time
+	}{{"from", &density.From}, {"to", &density.To}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
 		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.param + ", use RFC3339"})
+			return
+		}
+		*bound.value = t
 	}
-	
-	// If we have filters, add them to the query
-	if len(filters) > 0 {
-		if boolQuery, ok := query["bool"].(map[string]interface{}); ok {
-			boolQuery["filter"] = filters
-		} else {
-			query = map[string]interface{}{
-				"bool": map[string]interface{}{
-					"must":   query,
-					"filter": filters,
-				},
-			}
+
+	if value := c.Query("precision"); value != "" {
+		precision, err := strconv.Atoi(value)
+		if err != nil || !elasticsearch.ValidDensityPrecision(precision) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid precision, use 1 to 9"})
+			return
 		}
+		density.Precision = precision
+	}
+
+	if err := density.Box.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid box: " + err.Error()})
+		return
 	}
-	
-	return query
-}
\ No newline at end of file
+	if !density.To.After(density.From) || density.To.Sub(density.From) > siem.MaxDensityWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from, at most 7 days later"})
+		return
+	}
+
+	result, err := h.Searcher.Density(density)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count event density: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
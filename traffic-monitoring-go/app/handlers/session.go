@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/auth"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
+)
+
+// SessionHandler handles the admin endpoints for user login sessions
+type SessionHandler struct {
+	DB *gorm.DB
+}
+
+// NewSessionHandler creates a new SessionHandler
+func NewSessionHandler(db *gorm.DB) *SessionHandler {
+	return &SessionHandler{DB: db}
+}
+
+// sessionList is how GET /admin/sessions may be sorted and projected
+var sessionList = listSpec{
+	Model: models.UserSession{},
+	Sortable: map[string]string{
+		"id":         "id",
+		"user_id":    "user_id",
+		"email":      "email",
+		"client_ip":  "client_ip",
+		"issued_at":  "issued_at",
+		"expires_at": "expires_at",
+		"revoked_at": "revoked_at",
+	},
+	DefaultSort: "issued_at:desc",
+}
+
+// GetSessions handles GET /admin/sessions
+// Lists active sessions, filtered by user_id; all=true includes revoked and expired ones
+func (h *SessionHandler) GetSessions(c *gin.Context) {
+	list, ok := parseListQuery(c, sessionList)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Model(&models.UserSession{})
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if c.Query("all") != "true" {
+		query = query.Where("revoked_at IS NULL AND expires_at > ?", time.Now())
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sessions []models.UserSession
+	if err := list.paginate(query).Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, sessions, total, list)
+}
+
+// TerminateSession handles DELETE /admin/sessions/:id
+// Revokes the session; its token is refused from then on
+func (h *SessionHandler) TerminateSession(c *gin.Context) {
+	var session models.UserSession
+	if err := h.DB.First(&session, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if !session.Active(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session is already revoked or expired"})
+		return
+	}
+
+	if _, err := auth.RevokeSession(h.DB, session.ID, middleware.CurrentClaims(c).Actor(), "terminated by an admin"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session terminated"})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// sigmaContentType is the media type of exported Sigma rules
+const sigmaContentType = "application/yaml; charset=utf-8"
+
+// ImportSigmaRules handles POST /rules/sigma
+// Converts a YAML stream of Sigma rules into disabled rules; ?category=
+// overrides the category read from their log sources and ?dry_run=true
+// returns the converted rules without creating them. Nothing is created
+// unless every rule converts.
+func (h *RuleHandler) ImportSigmaRules(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sigmaRules, err := siem.ParseSigmaRules(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category := models.EventCategory(c.Query("category"))
+	if category != "" && !models.ValidCategory(category) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category"})
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	result, err := siem.ImportSigmaRules(h.DB, sigmaRules, category, dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	switch {
+	case len(result.Errors) > 0:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "some Sigma rules could not be imported", "errors": result.Errors})
+	case dryRun:
+		c.JSON(http.StatusOK, result)
+	default:
+		c.JSON(http.StatusCreated, result)
+	}
+}
+
+// ExportSigmaRules handles GET /rules/sigma
+// Downloads the rules, filtered by status and category, as a YAML stream of
+// Sigma rules; rules without a Sigma equivalent are listed in comments
+func (h *RuleHandler) ExportSigmaRules(c *gin.Context) {
+	query := h.DB.Model(&models.Rule{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+
+	var rules []models.Rule
+	if err := query.Order("name ASC").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, _, err := siem.ExportSigmaRules(rules)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="rules-sigma.yml"`)
+	c.Data(http.StatusOK, sigmaContentType, data)
+}
+
+// ExportSigmaRule handles GET /rules/:id/sigma
+// Returns one rule as a Sigma rule, or 422 when it has no Sigma equivalent
+func (h *RuleHandler) ExportSigmaRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	var rule models.Rule
+	if err := h.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	data, skipped, err := siem.ExportSigmaRules([]models.Rule{rule})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(skipped) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": skipped[0].Reason})
+		return
+	}
+	c.Data(http.StatusOK, sigmaContentType, data)
+}
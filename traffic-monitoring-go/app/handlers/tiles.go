@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/maptiles"
+)
+
+// TileHandler serves cached basemap tiles for the map dashboards
+type TileHandler struct {
+	Proxy *maptiles.Proxy
+}
+
+// NewTileHandler creates a new TileHandler
+func NewTileHandler(proxy *maptiles.Proxy) *TileHandler {
+	return &TileHandler{Proxy: proxy}
+}
+
+// GetTile handles GET /tiles/:z/:x/:y (y carries the extension, e.g. 42.png)
+func (h *TileHandler) GetTile(c *gin.Context) {
+	yPart := c.Param("y")
+	ext := "png"
+	if dot := strings.LastIndex(yPart, "."); dot >= 0 {
+		ext = strings.ToLower(yPart[dot+1:])
+		yPart = yPart[:dot]
+	}
+
+	z, errZ := strconv.Atoi(c.Param("z"))
+	x, errX := strconv.Atoi(c.Param("x"))
+	y, errY := strconv.Atoi(yPart)
+	if errZ != nil || errX != nil || errY != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tile coordinates"})
+		return
+	}
+
+	data, contentType, err := h.Proxy.Tile(z, x, y, ext)
+	if errors.Is(err, maptiles.ErrInvalidTile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err == maptiles.ErrTileNotCached {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// GetTileStats handles GET /tiles/stats
+func (h *TileHandler) GetTileStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Proxy.Stats())
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// TransformRuleHandler handles ingest transform rule endpoints
+type TransformRuleHandler struct {
+	DB *gorm.DB
+}
+
+// NewTransformRuleHandler creates a new TransformRuleHandler
+func NewTransformRuleHandler(db *gorm.DB) *TransformRuleHandler {
+	return &TransformRuleHandler{DB: db}
+}
+
+// GetTransformRules handles GET /transform-rules
+func (h *TransformRuleHandler) GetTransformRules(c *gin.Context) {
+	var rules []models.TransformRule
+	query := h.DB.Order("priority DESC, id ASC")
+	if sourceName := c.Query("source_name"); sourceName != "" {
+		query = query.Where("source_name = ?", sourceName)
+	}
+	if err := query.Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// GetTransformRule handles GET /transform-rules/:id
+func (h *TransformRuleHandler) GetTransformRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transform rule ID"})
+		return
+	}
+
+	var rule models.TransformRule
+	if err := h.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transform rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// CreateTransformRule handles POST /transform-rules
+func (h *TransformRuleHandler) CreateTransformRule(c *gin.Context) {
+	var rule models.TransformRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateTransformRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateTransformRules()
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateTransformRule handles PUT /transform-rules/:id
+func (h *TransformRuleHandler) UpdateTransformRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transform rule ID"})
+		return
+	}
+
+	var rule models.TransformRule
+	if err := h.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transform rule not found"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = uint(id)
+
+	if err := validateTransformRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateTransformRules()
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteTransformRule handles DELETE /transform-rules/:id
+func (h *TransformRuleHandler) DeleteTransformRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transform rule ID"})
+		return
+	}
+
+	if err := h.DB.Delete(&models.TransformRule{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateTransformRules()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transform rule deleted successfully"})
+}
+
+// TestTransformRule handles POST /transform-rules/test
+// Applies a rule to a sample event without storing either, so mappings can be checked before saving
+func (h *TransformRuleHandler) TestTransformRule(c *gin.Context) {
+	var request struct {
+		Rule  models.TransformRule   `json:"rule"`
+		Event map[string]interface{} `json:"event" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !siem.RuleMatchesEvent(&request.Rule, request.Event) {
+		c.JSON(http.StatusOK, gin.H{"matched": false, "event": request.Event})
+		return
+	}
+
+	if err := siem.ApplyTransformRule(&request.Rule, request.Event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"matched": true, "event": request.Event})
+}
+
+// validateTransformRule checks the fields every stored transform rule needs
+func validateTransformRule(rule *models.TransformRule) error {
+	if rule.Name == "" {
+		return errors.New("Transform rule name is required")
+	}
+	if len(rule.Mappings) == 0 {
+		return errors.New("Transform rule needs at least one mapping")
+	}
+	for _, mapping := range rule.Mappings {
+		if mapping.To == "" {
+			return errors.New("Every mapping needs a target field")
+		}
+		if mapping.From == "" && mapping.Default == "" {
+			return errors.New("Every mapping needs a source field or a default value")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// trendDimensions is the order dimensions are reported in when none is requested
+var trendDimensions = []models.TrendDimension{
+	models.TrendAlertVolume,
+	models.TrendAnomalyTypes,
+	models.TrendEventCategories,
+	models.TrendMessageTypes,
+	models.TrendVehicleMessages,
+	models.TrendVehicleAlerts,
+	models.TrendV2XAnomalies,
+}
+
+// TrendHandler handles long-term trend analytics and trend alert rules
+type TrendHandler struct {
+	DB      *gorm.DB
+	Service *siem.TrendService
+}
+
+// NewTrendHandler creates a new TrendHandler
+func NewTrendHandler(db *gorm.DB) *TrendHandler {
+	return &TrendHandler{DB: db, Service: siem.NewTrendService(db)}
+}
+
+// GetTrends handles GET /trends?period=week|month&dimension=&limit=
+// Compares the last week (or 30 days) with the one before, for one dimension
+// or, without dimension, for all of them
+func (h *TrendHandler) GetTrends(c *gin.Context) {
+	period := models.TrendPeriod(c.DefaultQuery("period", string(models.TrendPeriodWeek)))
+	if _, ok := siem.TrendPeriodLength(period); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be week or month"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	dimensions := trendDimensions
+	if dimension := c.Query("dimension"); dimension != "" {
+		if !siem.ValidTrendDimension(models.TrendDimension(dimension)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown trend dimension: " + dimension})
+			return
+		}
+		dimensions = []models.TrendDimension{models.TrendDimension(dimension)}
+	}
+
+	reports := make([]*siem.TrendReport, 0, len(dimensions))
+	for _, dimension := range dimensions {
+		report, err := h.Service.Compute(dimension, period, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		reports = append(reports, report)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"period": period, "trends": reports})
+}
+
+// GetTrendRules handles GET /trends/rules
+func (h *TrendHandler) GetTrendRules(c *gin.Context) {
+	var rules []models.TrendRule
+	if err := h.DB.Order("name ASC").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateTrendRule handles POST /trends/rules
+func (h *TrendHandler) CreateTrendRule(c *gin.Context) {
+	rule := models.TrendRule{Enabled: true}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = 0
+
+	if err := siem.ValidateTrendRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateTrendRule handles PUT /trends/rules/:id
+func (h *TrendHandler) UpdateTrendRule(c *gin.Context) {
+	var rule models.TrendRule
+	if err := h.DB.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trend rule not found"})
+		return
+	}
+
+	id, createdAt := rule.ID, rule.CreatedAt
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID, rule.CreatedAt = id, createdAt
+
+	if err := siem.ValidateTrendRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteTrendRule handles DELETE /trends/rules/:id
+func (h *TrendHandler) DeleteTrendRule(c *gin.Context) {
+	result := h.DB.Delete(&models.TrendRule{}, c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trend rule not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Trend rule deleted successfully"})
+}
+
+// EvaluateTrendRules handles POST /trends/rules/evaluate
+// Runs the trend rules now instead of waiting for the scheduler
+func (h *TrendHandler) EvaluateTrendRules(c *gin.Context) {
+	fired, err := h.Service.EvaluateRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"fired": len(fired), "alerts": fired})
+}
+
+// GetTrendAlerts handles GET /trends/alerts?rule_id=&limit=
+func (h *TrendHandler) GetTrendAlerts(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	query := database.ReadDB(h.DB).Order("created_at DESC").Limit(limit)
+	if ruleID := c.Query("rule_id"); ruleID != "" {
+		query = query.Where("trend_rule_id = ?", ruleID)
+	}
+
+	var alerts []models.TrendAlert
+	if err := query.Find(&alerts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, alerts)
+}
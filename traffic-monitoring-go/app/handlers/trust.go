@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// TrustHandler handles the trust score endpoints of V2X source IDs
+type TrustHandler struct {
+	DB     *gorm.DB
+	Scorer *siem.TrustScorer
+}
+
+// NewTrustHandler creates a new TrustHandler
+func NewTrustHandler(db *gorm.DB) *TrustHandler {
+	return &TrustHandler{DB: db, Scorer: siem.NewTrustScorer(db)}
+}
+
+// sourceTrustList is how GET /trust-scores may be sorted and projected
+var sourceTrustList = listSpec{
+	Model: models.SourceTrust{},
+	Sortable: map[string]string{
+		"source_id":           "source_id",
+		"score":               "score",
+		"inconsistent_links":  "inconsistent_links",
+		"misbehavior_reports": "misbehavior_reports",
+		"updated_at":          "updated_at",
+	},
+	DefaultSort: "score:asc",
+}
+
+// GetTrustScores handles GET /trust-scores
+// Lists the stored scores, least trusted first; sources missing from it score 100.
+// Filters by max_score
+func (h *TrustHandler) GetTrustScores(c *gin.Context) {
+	list, ok := parseListQuery(c, sourceTrustList)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Model(&models.SourceTrust{})
+	if value := c.Query("max_score"); value != "" {
+		maxScore, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid max_score"})
+			return
+		}
+		query = query.Where("score <= ?", maxScore)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var scores []models.SourceTrust
+	if err := list.paginate(query).Find(&scores).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, scores, total, list)
+}
+
+// GetTrustScore handles GET /trust-scores/:source_id
+// Computes the current trust of a source ID, with what lowered it
+func (h *TrustHandler) GetTrustScore(c *gin.Context) {
+	sourceID := c.Param("source_id")
+
+	trust, err := h.Scorer.Trust(sourceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"source_id": sourceID, "trust": trust})
+}
+
+// UpdateTrustScores handles POST /trust-scores/update
+// Recomputes the stored scores now instead of at the next scheduled update
+func (h *TrustHandler) UpdateTrustScores(c *gin.Context) {
+	updated, err := h.Scorer.Update()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"updated": updated})
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/auth"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
+)
+
+// UserHandler manages the users who can log in
+type UserHandler struct {
+	DB *gorm.DB
+}
+
+// NewUserHandler creates a new UserHandler
+func NewUserHandler(db *gorm.DB) *UserHandler {
+	return &UserHandler{DB: db}
+}
+
+// UserRequest is the body of POST /users and PUT /users/:id; empty fields are left unchanged on update
+type UserRequest struct {
+	Email    string          `json:"email"`
+	Password string          `json:"password"`
+	Role     models.UserRole `json:"role"`
+	// MaxSessions overrides MAX_SESSIONS_PER_USER for the user; 0 restores it
+	MaxSessions *int `json:"max_sessions"`
+	// OrganizationID binds the user to a tenant; 0 makes them a user of the
+	// instance, who sees every tenant
+	OrganizationID *uint `json:"organization_id"`
+}
+
+// apply validates the request and copies it onto user
+func (r *UserRequest) apply(user *models.User) error {
+	if r.MaxSessions != nil {
+		if *r.MaxSessions < 0 {
+			return fmt.Errorf("max_sessions cannot be negative")
+		}
+		user.MaxSessions = *r.MaxSessions
+	}
+	if r.OrganizationID != nil {
+		user.OrganizationID = nil
+		if *r.OrganizationID != 0 {
+			id := *r.OrganizationID
+			user.OrganizationID = &id
+		}
+	}
+	if r.Email != "" {
+		user.Email = strings.TrimSpace(r.Email)
+	}
+	if r.Role != "" {
+		if !models.ValidUserRole(r.Role) {
+			return fmt.Errorf("Invalid role: %s", r.Role)
+		}
+		user.Role = r.Role
+	}
+	if r.Password != "" {
+		if len(r.Password) < auth.MinPasswordLength {
+			return fmt.Errorf("Password must be at least %d characters", auth.MinPasswordLength)
+		}
+		hash, err := auth.HashPassword(r.Password)
+		if err != nil {
+			return err
+		}
+		user.HashedPassword = hash
+	}
+	return nil
+}
+
+// GetUsers handles GET /users
+func (h *UserHandler) GetUsers(c *gin.Context) {
+	var users []models.User
+	if err := h.DB.Order("email ASC").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// GetUser handles GET /users/:id
+func (h *UserHandler) GetUser(c *gin.Context) {
+	var user models.User
+	if err := h.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// CreateUser handles POST /users
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Email == "" || req.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email and password are required"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.ViewerRole
+	}
+
+	var user models.User
+	if err := req.apply(&user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !assignOrganization(c, h.DB, &user.OrganizationID) {
+		return
+	}
+	if err := h.DB.Create(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, user)
+}
+
+// UpdateUser handles PUT /users/:id
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	var user models.User
+	if err := h.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var req UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role, hash, organization := user.Role, user.HashedPassword, user.OrganizationID
+	if err := req.apply(&user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !assignOrganization(c, h.DB, &user.OrganizationID) {
+		return
+	}
+	if err := h.DB.Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// tokens carry the role and organization, and a new password should lock
+	// out whoever knew the old one
+	if user.Role != role || user.HashedPassword != hash || !sameOrganization(user.OrganizationID, organization) {
+		if _, err := auth.RevokeUserSessions(h.DB, user.ID, middleware.CurrentClaims(c).Actor(), "role, password or organization changed"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// LogoutUser handles POST /users/:id/logout
+// Revokes every active session of the user
+func (h *UserHandler) LogoutUser(c *gin.Context) {
+	var user models.User
+	if err := h.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	revoked, err := auth.RevokeUserSessions(h.DB, user.ID, middleware.CurrentClaims(c).Actor(), "forced logout")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User logged out", "revoked_sessions": revoked})
+}
+
+// DeleteUser handles DELETE /users/:id
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if claims := middleware.CurrentClaims(c); claims != nil && uint64(claims.UserID) == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Users cannot delete themselves"})
+		return
+	}
+
+	result := h.DB.Delete(&models.User{}, id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if _, err := auth.RevokeUserSessions(h.DB, uint(id), middleware.CurrentClaims(c).Actor(), "user deleted"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
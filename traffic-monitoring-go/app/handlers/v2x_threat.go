@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// V2XThreatHandler handles V2X threat taxonomy endpoints
+type V2XThreatHandler struct {
+	DB *gorm.DB
+}
+
+// NewV2XThreatHandler creates a new V2XThreatHandler
+func NewV2XThreatHandler(db *gorm.DB) *V2XThreatHandler {
+	return &V2XThreatHandler{DB: db}
+}
+
+// GetThreats handles GET /v2x-threats
+func (h *V2XThreatHandler) GetThreats(c *gin.Context) {
+	var threats []models.V2XThreat
+	if err := h.DB.Order("code ASC").Find(&threats).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, threats)
+}
+
+// CreateThreat handles POST /v2x-threats
+func (h *V2XThreatHandler) CreateThreat(c *gin.Context) {
+	var threat models.V2XThreat
+	if err := c.ShouldBindJSON(&threat); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := siem.NormalizeThreat(&threat); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Create(&threat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, threat)
+}
+
+// UpdateThreat handles PUT /v2x-threats/:id
+// The code is kept, since rules and alerts are tagged with it
+func (h *V2XThreatHandler) UpdateThreat(c *gin.Context) {
+	threat, ok := h.findThreat(c)
+	if !ok {
+		return
+	}
+
+	code := threat.Code
+	if err := c.ShouldBindJSON(threat); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	threat.Code = code
+	if err := siem.NormalizeThreat(threat); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(threat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, threat)
+}
+
+// DeleteThreat handles DELETE /v2x-threats/:id
+// A threat still tagged on rules cannot be deleted
+func (h *V2XThreatHandler) DeleteThreat(c *gin.Context) {
+	threat, ok := h.findThreat(c)
+	if !ok {
+		return
+	}
+
+	var rules []string
+	if err := siem.FilterByThreat(h.DB.Model(&models.Rule{}), "rules", threat.Code).Pluck("name", &rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(rules) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Threat is tagged on rules", "rules": rules})
+		return
+	}
+
+	if err := h.DB.Delete(threat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Threat deleted successfully"})
+}
+
+// GetThreatCoverage handles GET /v2x-threats/coverage?days=30
+// Maps rules, detected anomalies and the alerts of the last days onto the V2X threats
+func (h *V2XThreatHandler) GetThreatCoverage(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days"})
+		return
+	}
+
+	since := clock.Default().Now().UTC().Add(-time.Duration(days) * 24 * time.Hour)
+	coverage, err := siem.ComputeThreatCoverage(h.DB, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, coverage)
+}
+
+// findThreat loads the threat named by the :id parameter, answering the request when it cannot
+func (h *V2XThreatHandler) findThreat(c *gin.Context) (*models.V2XThreat, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid threat ID"})
+		return nil, false
+	}
+
+	var threat models.V2XThreat
+	if err := h.DB.First(&threat, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Threat not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &threat, true
+}
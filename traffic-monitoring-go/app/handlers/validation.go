@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/models"
+)
+
+// respondValidation answers a request whose input failed validation: 422
+// listing every violation for a *models.ValidationError, 500 otherwise
+func respondValidation(c *gin.Context, err error) {
+	var invalid *models.ValidationError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "validation failed",
+			"violations": invalid.Violations,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
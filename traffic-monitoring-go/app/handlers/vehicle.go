@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// VehicleHandler handles the merged per-vehicle view across V2X radios
+type VehicleHandler struct {
+	DB         *gorm.DB
+	Correlator *siem.VehicleCorrelator
+}
+
+// NewVehicleHandler creates a new VehicleHandler
+func NewVehicleHandler(db *gorm.DB) *VehicleHandler {
+	return &VehicleHandler{DB: db, Correlator: siem.NewVehicleCorrelator(db)}
+}
+
+// vehicleSource summarizes the recent reports of one source ID
+type vehicleSource struct {
+	SourceID     string               `json:"source_id"`
+	Radio        models.RadioProtocol `json:"radio,omitempty"`
+	MessageCount int                  `json:"message_count"`
+	LastSeen     time.Time            `json:"last_seen"`
+	Latitude     *float64             `json:"latitude,omitempty"`
+	Longitude    *float64             `json:"longitude,omitempty"`
+	Speed        *float64             `json:"speed,omitempty"`
+}
+
+// GetVehicle handles GET /vehicles/:id
+// Merges the recent reports of the vehicle and of every source ID linked to it
+// on the other radio, with the last known position across all of them
+func (h *VehicleHandler) GetVehicle(c *gin.Context) {
+	vehicleID := c.Param("id")
+
+	ids, links, err := h.Correlator.LinkedIDs(vehicleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := h.Correlator.Clock.Now()
+	observations, err := h.Correlator.RecentObservations(now.Add(-h.Correlator.Window), now.Add(time.Second))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	sources := make(map[string]*vehicleSource)
+	var lastPosition *vehicleSource
+	for _, obs := range observations {
+		if !wanted[obs.VehicleID] {
+			continue
+		}
+		source, ok := sources[obs.VehicleID]
+		if !ok {
+			source = &vehicleSource{SourceID: obs.VehicleID}
+			sources[obs.VehicleID] = source
+		}
+		source.MessageCount++
+		source.LastSeen = obs.Generated
+		if obs.Radio != "" {
+			source.Radio = obs.Radio
+		}
+		if obs.HasLocation {
+			lat, lon := obs.Latitude, obs.Longitude
+			source.Latitude, source.Longitude = &lat, &lon
+			if lastPosition == nil || !obs.Generated.Before(lastPosition.LastSeen) {
+				lastPosition = &vehicleSource{SourceID: obs.VehicleID, Radio: obs.Radio, LastSeen: obs.Generated, Latitude: &lat, Longitude: &lon}
+			}
+		}
+		if obs.HasSpeed {
+			speed := obs.Speed
+			source.Speed = &speed
+		}
+	}
+
+	if len(sources) == 0 && len(links) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No recent reports or radio links for this vehicle"})
+		return
+	}
+
+	merged := make([]vehicleSource, 0, len(ids))
+	for _, id := range ids {
+		if source, ok := sources[id]; ok {
+			merged = append(merged, *source)
+		}
+	}
+
+	inconsistent := false
+	for _, link := range links {
+		inconsistent = inconsistent || link.Inconsistent
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"vehicle_id":    vehicleID,
+		"linked_ids":    ids[1:],
+		"sources":       merged,
+		"last_position": lastPosition,
+		"links":         links,
+		"inconsistent":  inconsistent,
+		"window":        h.Correlator.Window.String(),
+	})
+}
+
+// vehicleLinkList is how GET /vehicles/links may be sorted and projected
+var vehicleLinkList = listSpec{
+	Model: models.VehicleLink{},
+	Sortable: map[string]string{
+		"id":                   "id",
+		"dsrc_id":              "dsrc_id",
+		"cv2x_id":              "cv2x_id",
+		"matched_samples":      "matched_samples",
+		"median_distance_m":    "median_distance_m",
+		"inconsistent_samples": "inconsistent_samples",
+		"first_seen":           "first_seen",
+		"last_seen":            "last_seen",
+	},
+	DefaultSort:     "last_seen:desc",
+	DefaultPageSize: 100,
+	MaxPageSize:     1000,
+}
+
+// GetVehicleLinks handles GET /vehicles/links
+// Lists DSRC/C-V2X source ID pairs of the same vehicle; inconsistent=true
+// returns only vehicles whose radios disagreed. Takes the list parameters
+// page, pageSize, sort and fields.
+func (h *VehicleHandler) GetVehicleLinks(c *gin.Context) {
+	list, ok := parseListQuery(c, vehicleLinkList)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Model(&models.VehicleLink{})
+	if c.Query("inconsistent") == "true" {
+		query = query.Where("inconsistent = ?", true)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var links []models.VehicleLink
+	if err := list.paginate(query).Find(&links).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, links, total, list)
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// VehicleRegistryHandler handles the persistent pseudonymous vehicles the
+// rotating temporary IDs and certificates of V2X senders resolve to
+type VehicleRegistryHandler struct {
+	DB       *gorm.DB
+	Registry *siem.VehicleRegistry
+}
+
+// NewVehicleRegistryHandler creates a new VehicleRegistryHandler
+func NewVehicleRegistryHandler(db *gorm.DB) *VehicleRegistryHandler {
+	return &VehicleRegistryHandler{DB: db, Registry: siem.NewVehicleRegistry(db)}
+}
+
+// registeredVehicleList is how GET /registered-vehicles may be sorted and projected
+var registeredVehicleList = listSpec{
+	Model: models.RegisteredVehicle{},
+	Sortable: map[string]string{
+		"id":          "id",
+		"pseudonym":   "pseudonym",
+		"first_seen":  "first_seen",
+		"last_seen":   "last_seen",
+		"trust_score": "trust_score",
+	},
+	DefaultSort: "last_seen:desc",
+}
+
+// GetRegisteredVehicles handles GET /registered-vehicles
+// Filters by max_trust (vehicles trusted at most that much) and since (RFC3339, last seen after)
+func (h *VehicleRegistryHandler) GetRegisteredVehicles(c *gin.Context) {
+	list, ok := parseListQuery(c, registeredVehicleList)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Model(&models.RegisteredVehicle{})
+	if value := c.Query("max_trust"); value != "" {
+		maxTrust, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid max_trust"})
+			return
+		}
+		query = query.Where("trust_score <= ?", maxTrust)
+	}
+	if value := c.Query("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since, use RFC3339"})
+			return
+		}
+		query = query.Where("last_seen >= ?", since)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var vehicles []models.RegisteredVehicle
+	if err := list.paginate(query).Find(&vehicles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, vehicles, total, list)
+}
+
+// LookupRegisteredVehicle handles GET /registered-vehicles/lookup?identifier=
+// Returns the vehicle a temporary ID or certificate hashed ID was resolved to
+func (h *VehicleRegistryHandler) LookupRegisteredVehicle(c *gin.Context) {
+	identifier := c.Query("identifier")
+	if identifier == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "identifier is required"})
+		return
+	}
+
+	vehicle, err := h.Registry.Lookup(identifier)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No registered vehicle has this identifier"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, vehicle)
+}
+
+// GetRegisteredVehicle handles GET /registered-vehicles/:id
+// Returns the vehicle with the identifiers it was seen under, most recent first
+func (h *VehicleRegistryHandler) GetRegisteredVehicle(c *gin.Context) {
+	vehicle, ok := h.findVehicle(c)
+	if !ok {
+		return
+	}
+
+	identifiers, err := h.Registry.Identifiers(vehicle.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	vehicle.Identifiers = identifiers
+
+	c.JSON(http.StatusOK, vehicle)
+}
+
+// GetRegisteredVehicleMessages handles GET /registered-vehicles/:id/messages
+// Pages the V2X messages sent under any identifier of the vehicle.
+// Filters: from, to (RFC3339)
+func (h *VehicleRegistryHandler) GetRegisteredVehicleMessages(c *gin.Context) {
+	h.listEvents(c, h.Registry.Messages)
+}
+
+// GetRegisteredVehicleAnomalies handles GET /registered-vehicles/:id/anomalies
+// Pages the anomalies detected in messages of the vehicle. Filters: from, to (RFC3339)
+func (h *VehicleRegistryHandler) GetRegisteredVehicleAnomalies(c *gin.Context) {
+	h.listEvents(c, h.Registry.Anomalies)
+}
+
+// GetRegisteredVehicleTrust handles GET /registered-vehicles/:id/trust
+// Recomputes the trust score of the vehicle, with what lowered it
+func (h *VehicleRegistryHandler) GetRegisteredVehicleTrust(c *gin.Context) {
+	vehicle, ok := h.findVehicle(c)
+	if !ok {
+		return
+	}
+
+	trust, err := h.Registry.UpdateTrust(vehicle)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"vehicle_id": vehicle.ID, "pseudonym": vehicle.Pseudonym, "trust": trust})
+}
+
+// ResolveRegisteredVehicles handles POST /registered-vehicles/resolve
+// Resolves the identifiers seen between start and end (default: the last hour)
+func (h *VehicleRegistryHandler) ResolveRegisteredVehicles(c *gin.Context) {
+	var request struct {
+		Start *time.Time `json:"start"`
+		End   *time.Time `json:"end"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	end := h.Registry.Clock.Now()
+	if request.End != nil {
+		end = *request.End
+	}
+	start := end.Add(-time.Hour)
+	if request.Start != nil {
+		start = *request.Start
+	}
+	if !start.Before(end) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start must be before end"})
+		return
+	}
+
+	vehicles, err := h.Registry.Resolve(start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"resolved": len(vehicles), "vehicles": vehicles})
+}
+
+// listEvents pages the events of the :id vehicle a registry query selects
+func (h *VehicleRegistryHandler) listEvents(c *gin.Context, selectEvents func([]models.VehicleIdentifier) *gorm.DB) {
+	list, ok := parseListQuery(c, securityEventList)
+	if !ok {
+		return
+	}
+	vehicle, ok := h.findVehicle(c)
+	if !ok {
+		return
+	}
+
+	identifiers, err := h.Registry.Identifiers(vehicle.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := selectEvents(identifiers)
+	for _, bound := range []struct{ param, condition string }{{"from", "timestamp >= ?"}, {"to", "timestamp < ?"}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.param + ", use RFC3339"})
+			return
+		}
+		query = query.Where(bound.condition, t)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var events []models.SecurityEvent
+	if err := list.paginate(query).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondList(c, events, total, list)
+}
+
+// findVehicle loads the vehicle named by the :id parameter, answering the request when it cannot
+func (h *VehicleRegistryHandler) findVehicle(c *gin.Context) (*models.RegisteredVehicle, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vehicle ID"})
+		return nil, false
+	}
+
+	var vehicle models.RegisteredVehicle
+	if err := h.DB.First(&vehicle, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Registered vehicle not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &vehicle, true
+}
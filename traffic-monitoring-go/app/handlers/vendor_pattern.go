@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// VendorPatternHandler handles RSU vendor syslog pattern endpoints
+type VendorPatternHandler struct {
+	DB *gorm.DB
+}
+
+// NewVendorPatternHandler creates a new VendorPatternHandler
+func NewVendorPatternHandler(db *gorm.DB) *VendorPatternHandler {
+	return &VendorPatternHandler{DB: db}
+}
+
+// GetVendorPatterns handles GET /vendor-patterns
+func (h *VendorPatternHandler) GetVendorPatterns(c *gin.Context) {
+	var patterns []models.VendorPattern
+	query := h.DB.Order("priority DESC, id ASC")
+	if vendor := c.Query("vendor"); vendor != "" {
+		query = query.Where("vendor = ?", vendor)
+	}
+	if err := query.Find(&patterns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, patterns)
+}
+
+// GetVendorPattern handles GET /vendor-patterns/:id
+func (h *VendorPatternHandler) GetVendorPattern(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vendor pattern ID"})
+		return
+	}
+
+	var pattern models.VendorPattern
+	if err := h.DB.First(&pattern, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vendor pattern not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pattern)
+}
+
+// CreateVendorPattern handles POST /vendor-patterns
+func (h *VendorPatternHandler) CreateVendorPattern(c *gin.Context) {
+	pattern := models.VendorPattern{Enabled: true}
+	if err := c.ShouldBindJSON(&pattern); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := siem.ValidateVendorPattern(&pattern); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Create(&pattern).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateVendorPatterns()
+
+	c.JSON(http.StatusCreated, pattern)
+}
+
+// UpdateVendorPattern handles PUT /vendor-patterns/:id
+func (h *VendorPatternHandler) UpdateVendorPattern(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vendor pattern ID"})
+		return
+	}
+
+	var pattern models.VendorPattern
+	if err := h.DB.First(&pattern, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vendor pattern not found"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&pattern); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pattern.ID = uint(id)
+
+	if err := siem.ValidateVendorPattern(&pattern); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(&pattern).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateVendorPatterns()
+
+	c.JSON(http.StatusOK, pattern)
+}
+
+// DeleteVendorPattern handles DELETE /vendor-patterns/:id
+func (h *VendorPatternHandler) DeleteVendorPattern(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vendor pattern ID"})
+		return
+	}
+
+	if err := h.DB.Delete(&models.VendorPattern{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	siem.InvalidateVendorPatterns()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vendor pattern deleted successfully"})
+}
+
+// TestVendorPattern handles POST /vendor-patterns/test
+// Parses sample syslog lines with a pattern without storing either, so patterns
+// can be checked against a vendor's output before saving
+func (h *VendorPatternHandler) TestVendorPattern(c *gin.Context) {
+	var request struct {
+		Pattern models.VendorPattern `json:"pattern"`
+		Lines   []string             `json:"lines" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := siem.ValidateVendorPattern(&request.Pattern); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	compiled, err := siem.CompileVendorPattern(&request.Pattern)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]gin.H, 0, len(request.Lines))
+	for _, line := range request.Lines {
+		event := map[string]interface{}{"source_name": request.Pattern.SourceName, "message": line}
+		if compiled.Parse(event) {
+			results = append(results, gin.H{"line": line, "matched": true, "event": event})
+		} else {
+			results = append(results, gin.H{"line": line, "matched": false})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
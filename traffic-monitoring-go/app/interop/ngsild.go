@@ -0,0 +1,296 @@
+// Package interop exposes the SIEM's traffic picture in the formats used by
+// smart-city platforms
+package interop
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+var (
+	ngsiLDWindowMinutes = config.NewInt("NGSI_LD_WINDOW_MINUTES", 10, "Minutes back vehicle positions and hazards are exported from", config.Min(1))
+	ngsiLDBrokerURL     = config.NewString("NGSI_LD_BROKER_URL", "", "NGSI-LD context broker the entities are pushed to; empty disables the push")
+	ngsiLDSyncSeconds   = config.NewInt("NGSI_LD_SYNC_SECONDS", 30, "Seconds between pushes to the NGSI-LD broker", config.Min(1))
+	ngsiLDTenant        = config.NewString("NGSI_LD_TENANT", "", "NGSI-LD broker tenant")
+)
+
+// NGSILDContext is the @context of every exported entity: the NGSI-LD core
+// context plus the FIWARE Smart Data Models transportation vocabulary
+var NGSILDContext = []string{
+	"https://raw.githubusercontent.com/smart-data-models/dataModel.Transportation/master/context.jsonld",
+	"https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld",
+}
+
+// Entity types produced by the exporter
+const (
+	EntityTypeVehicle = "Vehicle"
+	EntityTypeDevice  = "Device" // roadside units
+	EntityTypeAlert   = "Alert"  // hazards reported over V2X
+)
+
+// hazardMessageTypes are the V2X message types exported as Alert entities
+var hazardMessageTypes = map[string]string{
+	"hazard":           "hazardOnRoad",
+	"hazard_warning":   "hazardOnRoad",
+	"roadwork_warning": "roadWorks",
+}
+
+// Entity is an NGSI-LD entity in normalized form
+type Entity map[string]interface{}
+
+// ID returns the entity's URN
+func (e Entity) ID() string {
+	id, _ := e["id"].(string)
+	return id
+}
+
+// NGSILDExporter builds NGSI-LD entities from V2X events and the RSU registry.
+// Signal phase states are not exported: SPaT messages reach the SIEM without
+// decoded phases, so there is nothing to publish for traffic signals yet.
+type NGSILDExporter struct {
+	DB     *gorm.DB
+	Clock  clock.Clock
+	Window time.Duration // how far back vehicle positions and hazards are taken from
+}
+
+// NewNGSILDExporter creates an exporter; NGSI_LD_WINDOW_MINUTES sets the window (default 10)
+func NewNGSILDExporter(db *gorm.DB) *NGSILDExporter {
+	return &NGSILDExporter{DB: db, Clock: clock.Default(), Window: time.Duration(ngsiLDWindowMinutes.Get()) * time.Minute}
+}
+
+// EntityID returns the URN of an entity, e.g. urn:ngsi-ld:Vehicle:VEH001
+func EntityID(entityType, id string) string {
+	return fmt.Sprintf("urn:ngsi-ld:%s:%s", entityType, id)
+}
+
+func property(value interface{}, observedAt time.Time) map[string]interface{} {
+	p := map[string]interface{}{"type": "Property", "value": value}
+	if !observedAt.IsZero() {
+		p["observedAt"] = observedAt.UTC().Format(time.RFC3339)
+	}
+	return p
+}
+
+func geoProperty(lat, lon float64, observedAt time.Time) map[string]interface{} {
+	p := property(map[string]interface{}{"type": "Point", "coordinates": []float64{lon, lat}}, observedAt)
+	p["type"] = "GeoProperty"
+	return p
+}
+
+// recentObservations returns the V2X observations of the window, oldest first
+func (x *NGSILDExporter) recentObservations() ([]siem.V2XObservation, error) {
+	var events []models.SecurityEvent
+	err := x.DB.Preload("LogSource").
+		Where("category IN ? AND created_at >= ?",
+			[]models.EventCategory{models.CategoryV2X, models.CategoryVehicle}, x.Clock.Now().Add(-x.Window)).
+		Order("created_at ASC").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+
+	observations := make([]siem.V2XObservation, 0, len(events))
+	for i := range events {
+		if obs, ok := siem.ParseV2XObservation(&events[i], events[i].LogSource.Name); ok {
+			observations = append(observations, obs)
+		}
+	}
+	return observations, nil
+}
+
+// Entities returns the entities of one type, or of every type when entityType is empty
+func (x *NGSILDExporter) Entities(entityType string) ([]Entity, error) {
+	var entities []Entity
+
+	if entityType == "" || entityType == EntityTypeDevice {
+		devices, err := x.roadsideUnits()
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, devices...)
+	}
+
+	if entityType == "" || entityType == EntityTypeVehicle || entityType == EntityTypeAlert {
+		observations, err := x.recentObservations()
+		if err != nil {
+			return nil, err
+		}
+		if entityType == "" || entityType == EntityTypeVehicle {
+			entities = append(entities, vehicles(observations)...)
+		}
+		if entityType == "" || entityType == EntityTypeAlert {
+			entities = append(entities, hazards(observations)...)
+		}
+	}
+
+	sort.Slice(entities, func(i, j int) bool { return entities[i].ID() < entities[j].ID() })
+	return entities, nil
+}
+
+// vehicles returns one Vehicle entity per vehicle at its last known position
+func vehicles(observations []siem.V2XObservation) []Entity {
+	latest := make(map[string]siem.V2XObservation)
+	for _, obs := range observations {
+		if obs.HasLocation {
+			latest[obs.VehicleID] = obs
+		}
+	}
+
+	entities := make([]Entity, 0, len(latest))
+	for vehicleID, obs := range latest {
+		entity := Entity{
+			"id":                     EntityID(EntityTypeVehicle, vehicleID),
+			"type":                   EntityTypeVehicle,
+			"vehiclePlateIdentifier": property(vehicleID, time.Time{}),
+			"location":               geoProperty(obs.Latitude, obs.Longitude, obs.Generated),
+		}
+		if obs.HasSpeed {
+			entity["speed"] = property(obs.Speed, obs.Generated)
+		}
+		if obs.Receiver != "" {
+			entity["refDevice"] = map[string]interface{}{
+				"type":   "Relationship",
+				"object": EntityID(EntityTypeDevice, obs.Receiver),
+			}
+		}
+		entities = append(entities, entity)
+	}
+	return entities
+}
+
+// hazards returns an Alert entity for each hazard message of the window
+func hazards(observations []siem.V2XObservation) []Entity {
+	var entities []Entity
+	for _, obs := range observations {
+		subCategory, ok := hazardMessageTypes[strings.ToLower(obs.MessageType)]
+		if !ok || !obs.HasLocation {
+			continue
+		}
+		entities = append(entities, Entity{
+			"id":          EntityID(EntityTypeAlert, strconv.FormatUint(uint64(obs.EventID), 10)),
+			"type":        EntityTypeAlert,
+			"category":    property("traffic", time.Time{}),
+			"subCategory": property(subCategory, time.Time{}),
+			"location":    geoProperty(obs.Latitude, obs.Longitude, obs.Generated),
+			"dateIssued":  property(obs.Generated.UTC().Format(time.RFC3339), time.Time{}),
+			"alertSource": property(EntityID(EntityTypeVehicle, obs.VehicleID), time.Time{}),
+		})
+	}
+	return entities
+}
+
+// roadsideUnits returns a Device entity for each registered RSU
+func (x *NGSILDExporter) roadsideUnits() ([]Entity, error) {
+	var rsus []models.RSU
+	if err := x.DB.Find(&rsus).Error; err != nil {
+		return nil, err
+	}
+
+	entities := make([]Entity, 0, len(rsus))
+	for _, rsu := range rsus {
+		entity := Entity{
+			"id":       EntityID(EntityTypeDevice, rsu.Code),
+			"type":     EntityTypeDevice,
+			"name":     property(rsu.Code, time.Time{}),
+			"category": property([]string{"roadSideUnit"}, time.Time{}),
+			"location": geoProperty(rsu.Latitude, rsu.Longitude, time.Time{}),
+		}
+		entities = append(entities, entity)
+	}
+	return entities, nil
+}
+
+// WithContext returns a copy of the entity carrying the @context, as required
+// for application/ld+json payloads
+func WithContext(entity Entity) Entity {
+	withContext := make(Entity, len(entity)+1)
+	for key, value := range entity {
+		withContext[key] = value
+	}
+	withContext["@context"] = NGSILDContext
+	return withContext
+}
+
+// StartBrokerSync pushes the entities to an NGSI-LD context broker (e.g. Orion-LD)
+// every NGSI_LD_SYNC_SECONDS (default 30) when NGSI_LD_BROKER_URL is set.
+// NGSI_LD_TENANT selects the broker tenant.
+func (x *NGSILDExporter) StartBrokerSync() {
+	brokerURL := strings.TrimRight(ngsiLDBrokerURL.Get(), "/")
+	if brokerURL == "" {
+		return
+	}
+	seconds := ngsiLDSyncSeconds.Get()
+	tenant := ngsiLDTenant.Get()
+	client := &http.Client{Timeout: 15 * time.Second}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(seconds) * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			count, err := x.pushToBroker(client, brokerURL, tenant)
+			if err != nil {
+				log.Printf("Error pushing NGSI-LD entities to %s: %v", brokerURL, err)
+				continue
+			}
+			log.Printf("Pushed %d NGSI-LD entities to %s", count, brokerURL)
+		}
+	}()
+
+	log.Printf("NGSI-LD broker sync started for %s every %ds", brokerURL, seconds)
+}
+
+// pushToBroker upserts the current entities with a batch entity operation
+func (x *NGSILDExporter) pushToBroker(client *http.Client, brokerURL, tenant string) (int, error) {
+	entities, err := x.Entities("")
+	if err != nil {
+		return 0, err
+	}
+	if len(entities) == 0 {
+		return 0, nil
+	}
+
+	payload := make([]Entity, 0, len(entities))
+	for _, entity := range entities {
+		payload = append(payload, WithContext(entity))
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, brokerURL+"/ngsi-ld/v1/entityOperations/upsert", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/ld+json")
+	if tenant != "" {
+		req.Header.Set("NGSILD-Tenant", tenant)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("broker returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return len(entities), nil
+}
@@ -0,0 +1,513 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+)
+
+// Level is the severity of a log record
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses debug, info, warn (or warning) and error
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (debug, info, warn, error)", name)
+}
+
+// parseComponentLevels parses LOG_LEVELS, e.g. "rules=debug,elasticsearch=warn"
+func parseComponentLevels(value string) (map[string]Level, error) {
+	levels := make(map[string]Level)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q is not component=level", pair)
+		}
+		level, err := ParseLevel(pair[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(pair[:i])] = level
+	}
+	return levels, nil
+}
+
+var (
+	defaultLevel = config.NewString("LOG_LEVEL", "info", "Lowest level logged by components without a level of their own",
+		config.OneOf("debug", "info", "warn", "error"), config.Reloadable)
+	componentLevels = config.NewString("LOG_LEVELS", "", "Levels of single components, e.g. rules=debug,elasticsearch=warn; "+
+		"a component such as collectors.mqtt also takes the level of collectors",
+		config.Check(func(value string) error {
+			_, err := parseComponentLevels(value)
+			return err
+		}), config.Reloadable)
+	logFormat = config.NewString("LOG_FORMAT", "json", "Format of log records: json, or text for key=value lines",
+		config.OneOf("json", "text"), config.Reloadable)
+)
+
+// component is a named part of the SIEM that logs, such as "rules", with the
+// level it logs at
+type component struct {
+	name  string
+	level int32 // a Level, read on every record
+}
+
+var (
+	levelMutex sync.RWMutex
+	components = make(map[string]*component)
+	configured map[string]Level         // from LOG_LEVELS
+	overrides  = make(map[string]Level) // set at run time with SetLevel
+	// the default level set at run time with SetDefaultLevel, if any
+	defaultOverride *Level
+)
+
+// the levels follow changes of LOG_LEVEL and LOG_LEVELS
+func init() {
+	config.OnLoad(refreshLevels)
+}
+
+// refreshLevels recomputes the level of every component
+func refreshLevels() {
+	levelMutex.Lock()
+	defer levelMutex.Unlock()
+
+	configured, _ = parseComponentLevels(componentLevels.Get())
+	for _, c := range components {
+		atomic.StoreInt32(&c.level, int32(levelOfLocked(c.name)))
+	}
+}
+
+// levelOfLocked returns the level of the named component: the one set at run
+// time, else the configured one, of the component or the closest parent
+// (collectors for collectors.mqtt), else the default level
+func levelOfLocked(name string) Level {
+	for _, levels := range []map[string]Level{overrides, configured} {
+		for key := name; key != ""; {
+			if level, ok := levels[key]; ok {
+				return level
+			}
+			i := strings.LastIndex(key, ".")
+			if i < 0 {
+				break
+			}
+			key = key[:i]
+		}
+	}
+	if defaultOverride != nil {
+		return *defaultOverride
+	}
+	level, _ := ParseLevel(defaultLevel.Get())
+	return level
+}
+
+// componentNamed returns the component with name, registering it on first use
+func componentNamed(name string) *component {
+	levelMutex.RLock()
+	c, ok := components[name]
+	levelMutex.RUnlock()
+	if ok {
+		return c
+	}
+
+	levelMutex.Lock()
+	defer levelMutex.Unlock()
+	if c, ok := components[name]; ok {
+		return c
+	}
+	if configured == nil {
+		configured, _ = parseComponentLevels(componentLevels.Get())
+	}
+	c = &component{name: name, level: int32(levelOfLocked(name))}
+	components[name] = c
+	return c
+}
+
+// SetLevel sets the level of a component, and of its children without a level
+// of their own, until the next restart; an empty level returns it to the
+// configured one
+func SetLevel(name, level string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("component is required")
+	}
+	levelMutex.Lock()
+	if level == "" {
+		delete(overrides, name)
+	} else {
+		parsed, err := ParseLevel(level)
+		if err != nil {
+			levelMutex.Unlock()
+			return err
+		}
+		overrides[name] = parsed
+	}
+	levelMutex.Unlock()
+	refreshLevels()
+	return nil
+}
+
+// SetDefaultLevel sets the level of components without a level of their own
+// until the next restart; an empty level returns to LOG_LEVEL
+func SetDefaultLevel(level string) error {
+	levelMutex.Lock()
+	if level == "" {
+		defaultOverride = nil
+	} else {
+		parsed, err := ParseLevel(level)
+		if err != nil {
+			levelMutex.Unlock()
+			return err
+		}
+		defaultOverride = &parsed
+	}
+	levelMutex.Unlock()
+	refreshLevels()
+	return nil
+}
+
+// ComponentLevel is the level a component logs at
+type ComponentLevel struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+	Override  bool   `json:"override"` // set at run time rather than configured
+}
+
+// LevelStatus is the default level and that of every component that has logged
+type LevelStatus struct {
+	Default         string           `json:"default"`
+	DefaultOverride bool             `json:"default_override"`
+	Components      []ComponentLevel `json:"components"`
+}
+
+// Levels returns the levels of the default and of every component, by name
+func Levels() LevelStatus {
+	levelMutex.RLock()
+	defer levelMutex.RUnlock()
+
+	status := LevelStatus{Default: defaultLevel.Get(), DefaultOverride: defaultOverride != nil, Components: []ComponentLevel{}}
+	if defaultOverride != nil {
+		status.Default = defaultOverride.String()
+	}
+
+	names := make(map[string]bool, len(components)+len(overrides))
+	for name := range components {
+		names[name] = true
+	}
+	for name := range overrides {
+		names[name] = true
+	}
+	for name := range configured {
+		names[name] = true
+	}
+	for name := range names {
+		_, override := overrides[name]
+		status.Components = append(status.Components, ComponentLevel{
+			Component: name,
+			Level:     levelOfLocked(name).String(),
+			Override:  override,
+		})
+	}
+	sort.Slice(status.Components, func(i, j int) bool { return status.Components[i].Component < status.Components[j].Component })
+	return status
+}
+
+// Logger writes structured records for one component. Records carry the
+// component, the fields added with With and WithContext, and their own
+// key/value pairs. Loggers are safe for concurrent use, and With and
+// WithContext return new loggers instead of changing them. A nil *Logger, as
+// in a struct built without its constructor, logs as the "app" component.
+type Logger struct {
+	component *component
+	fields    []interface{}
+	class     string // sampling class, see Sampled
+}
+
+// New returns the logger of a component; components are named like
+// "collectors" or "collectors.mqtt", and their levels are set by LOG_LEVEL,
+// LOG_LEVELS and SetLevel
+func New(name string) *Logger {
+	return &Logger{component: componentNamed(name)}
+}
+
+// With returns a logger adding key/value pairs to every record
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if l == nil {
+		l = defaultLogger
+	}
+	next := *l
+	next.fields = append(append([]interface{}{}, l.fields...), keyvals...)
+	return &next
+}
+
+// WithContext returns a logger adding the request and correlation IDs of ctx
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	if l == nil {
+		l = defaultLogger
+	}
+	if ctx == nil {
+		return l
+	}
+	var keyvals []interface{}
+	if id := RequestID(ctx); id != "" {
+		keyvals = append(keyvals, "request_id", id)
+	}
+	if id := CorrelationID(ctx); id != "" {
+		keyvals = append(keyvals, "correlation_id", id)
+	}
+	if len(keyvals) == 0 {
+		return l
+	}
+	return l.With(keyvals...)
+}
+
+// Sampled returns a logger whose records count against the quota of class in
+// the default sampler, see Sampler; a flood of them is logged as its first few
+// records and a summary
+func (l *Logger) Sampled(class string) *Logger {
+	if l == nil {
+		l = defaultLogger
+	}
+	next := *l
+	next.class = class
+	return &next
+}
+
+// Enabled reports whether records of level are written, for callers that
+// would do work to build them
+func (l *Logger) Enabled(level Level) bool {
+	if l == nil {
+		l = defaultLogger
+	}
+	return level >= Level(atomic.LoadInt32(&l.component.level))
+}
+
+// Debug writes a debug record
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { l.log(LevelDebug, msg, keyvals) }
+
+// Info writes an info record
+func (l *Logger) Info(msg string, keyvals ...interface{}) { l.log(LevelInfo, msg, keyvals) }
+
+// Warn writes a warning record
+func (l *Logger) Warn(msg string, keyvals ...interface{}) { l.log(LevelWarn, msg, keyvals) }
+
+// Error writes an error record
+func (l *Logger) Error(msg string, keyvals ...interface{}) { l.log(LevelError, msg, keyvals) }
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if l == nil {
+		l = defaultLogger
+	}
+	if !l.Enabled(level) {
+		return
+	}
+	if l.class != "" && !defaultSampler.allow(l.class) {
+		return
+	}
+	write(time.Now(), level, l.component.name, msg, l.fields, keyvals)
+}
+
+var (
+	outputMutex sync.Mutex
+	output      io.Writer = os.Stderr
+)
+
+// SetOutput sets where records are written, stderr by default
+func SetOutput(w io.Writer) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	output = w
+}
+
+// write formats one record as LOG_FORMAT says and writes it
+func write(at time.Time, level Level, component, msg string, fields, keyvals []interface{}) {
+	pairs := make([]interface{}, 0, 8+len(fields)+len(keyvals))
+	pairs = append(pairs, "time", at.UTC().Format(time.RFC3339Nano), "level", level.String(),
+		"component", component, "msg", msg)
+	pairs = append(pairs, fields...)
+	pairs = append(pairs, keyvals...)
+	if len(pairs)%2 != 0 {
+		pairs = append(pairs, "(missing)")
+	}
+
+	var buffer bytes.Buffer
+	if logFormat.Get() == "text" {
+		for i := 0; i < len(pairs); i += 2 {
+			if i > 0 {
+				buffer.WriteByte(' ')
+			}
+			buffer.WriteString(fmt.Sprint(pairs[i]))
+			buffer.WriteByte('=')
+			buffer.WriteString(textValue(pairs[i+1]))
+		}
+	} else {
+		buffer.WriteByte('{')
+		for i := 0; i < len(pairs); i += 2 {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+			key, _ := json.Marshal(fmt.Sprint(pairs[i]))
+			buffer.Write(key)
+			buffer.WriteByte(':')
+			buffer.Write(jsonValue(pairs[i+1]))
+		}
+		buffer.WriteByte('}')
+	}
+	buffer.WriteByte('\n')
+
+	outputMutex.Lock()
+	output.Write(buffer.Bytes())
+	outputMutex.Unlock()
+}
+
+// plainValue turns errors, durations and other Stringers into text
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+func jsonValue(value interface{}) []byte {
+	encoded, err := json.Marshal(plainValue(value))
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return encoded
+}
+
+func textValue(value interface{}) string {
+	text := fmt.Sprint(plainValue(value))
+	if text == "" || strings.ContainsAny(text, " \t\n\"=") {
+		return strconv.Quote(text)
+	}
+	return text
+}
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	correlationIDKey
+)
+
+// NewID returns a random ID for a request or a correlation
+func NewID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(id)
+}
+
+// WithRequestID returns ctx carrying the ID of the HTTP request it serves
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithCorrelationID returns ctx carrying the correlation ID that follows a
+// message from ingestion, through the events stored for it, to their alerts
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or ""
+func CorrelationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
+
+// EnsureCorrelationID returns ctx carrying a correlation ID, a new one unless
+// it already carries one
+func EnsureCorrelationID(ctx context.Context) context.Context {
+	if CorrelationID(ctx) != "" {
+		return ctx
+	}
+	return WithCorrelationID(ctx, NewID())
+}
+
+// stdlibWriter turns the lines of the standard log package into records of
+// the "app" component, leveled by how they start
+type stdlibWriter struct{}
+
+func (stdlibWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+	level := LevelInfo
+	switch {
+	case strings.HasPrefix(msg, "Warning: "):
+		level, msg = LevelWarn, strings.TrimPrefix(msg, "Warning: ")
+	case strings.HasPrefix(msg, "Warning"):
+		level = LevelWarn
+	case strings.HasPrefix(msg, "Error"), strings.HasPrefix(msg, "Failed"), strings.HasPrefix(msg, "Fatal"):
+		level = LevelError
+	}
+	defaultLogger.log(level, msg, nil)
+	return len(p), nil
+}
+
+// defaultLogger logs the lines of the standard log package and for nil loggers
+var defaultLogger = New("app")
+
+// RedirectStdLog sends the output of the standard log package, and so of the
+// code not yet given a Logger, through the structured logger
+func RedirectStdLog() {
+	log.SetFlags(0)
+	log.SetOutput(stdlibWriter{})
+}
@@ -0,0 +1,160 @@
+// Package logging is the structured logger of the SIEM. Each component, such
+// as the collectors, the rule engine or the Elasticsearch service, logs through
+// a Logger of its own (see New), whose records carry the component, the
+// request and correlation IDs of their context and key/value fields, written
+// as JSON or key=value text. Components log at the level LOG_LEVEL and
+// LOG_LEVELS set, changeable at run time with SetLevel.
+//
+// Log output is also kept bounded on hot paths: a flood of identical errors
+// (e.g. a misbehaving sender hitting a collector) is logged as its first few
+// occurrences plus a periodic summary of what was suppressed.
+package logging
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+)
+
+var (
+	sampleFirst = config.NewInt("LOG_SAMPLE_FIRST", 10, "Messages of each class logged per interval; 0 disables sampling",
+		config.Min(0), config.Reloadable)
+	sampleIntervalSeconds = config.NewInt("LOG_SAMPLE_INTERVAL_SECONDS", 60, "Seconds of each log sampling interval",
+		config.Min(1), config.Reloadable)
+)
+
+// Sampler logs the first N messages of each class per interval and counts the rest
+type Sampler struct {
+	mutex    sync.Mutex
+	first    int
+	interval time.Duration
+	classes  map[string]*classCount
+	ticker   *time.Ticker
+	output   func(format string, args ...interface{})
+}
+
+type classCount struct {
+	logged     int
+	suppressed int
+}
+
+// NewSampler creates a sampler that logs first messages per class every interval.
+// first <= 0 disables sampling.
+func NewSampler(first int, interval time.Duration) *Sampler {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &Sampler{
+		first:    first,
+		interval: interval,
+		classes:  make(map[string]*classCount),
+		output:   log.Printf,
+	}
+}
+
+// NewSamplerFromEnv configures a sampler from LOG_SAMPLE_FIRST (default 10,
+// 0 disables sampling) and LOG_SAMPLE_INTERVAL_SECONDS (default 60)
+func NewSamplerFromEnv() *Sampler {
+	return NewSampler(sampleFirst.Get(), time.Duration(sampleIntervalSeconds.Get())*time.Second)
+}
+
+var defaultSampler = NewSamplerFromEnv()
+
+// the default sampler is created before the configuration is loaded, and follows its changes
+func init() {
+	config.OnLoad(func() {
+		Configure(sampleFirst.Get(), time.Duration(sampleIntervalSeconds.Get())*time.Second)
+	})
+}
+
+// Sampled logs through the default sampler. class groups messages that are
+// counted together, e.g. "listener.parse:syslog".
+func Sampled(class, format string, args ...interface{}) {
+	defaultSampler.Printf(class, format, args...)
+}
+
+// Configure changes the default sampler's limits
+func Configure(first int, interval time.Duration) {
+	defaultSampler.Configure(first, interval)
+}
+
+// Configure changes the sampler's limits; counts of the current interval are kept
+func (s *Sampler) Configure(first int, interval time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.first = first
+	if interval > 0 {
+		s.interval = interval
+		if s.ticker != nil {
+			s.ticker.Reset(interval)
+		}
+	}
+}
+
+// Printf logs the message unless its class already used up this interval's quota
+func (s *Sampler) Printf(class, format string, args ...interface{}) {
+	if s.allow(class) {
+		s.output(format, args...)
+	}
+}
+
+// allow counts a message of class and reports whether it is within this
+// interval's quota
+func (s *Sampler) allow(class string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.first <= 0 {
+		return true
+	}
+
+	if s.ticker == nil {
+		// summaries are only needed once something is sampled
+		s.ticker = time.NewTicker(s.interval)
+		go s.run(s.ticker)
+	}
+
+	count, ok := s.classes[class]
+	if !ok {
+		count = &classCount{}
+		s.classes[class] = count
+	}
+	if count.logged >= s.first {
+		count.suppressed++
+		return false
+	}
+	count.logged++
+	return true
+}
+
+func (s *Sampler) run(ticker *time.Ticker) {
+	for range ticker.C {
+		s.Flush()
+	}
+}
+
+// Flush logs a summary for every class with suppressed messages and starts a new interval
+func (s *Sampler) Flush() {
+	s.mutex.Lock()
+	classes := s.classes
+	interval := s.interval
+	s.classes = make(map[string]*classCount)
+	s.mutex.Unlock()
+
+	names := make([]string, 0, len(classes))
+	for name, count := range classes {
+		if count.suppressed > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		count := classes[name]
+		s.output("Log sampling: suppressed %d of %d %q messages in the last %s",
+			count.suppressed, count.logged+count.suppressed, name, interval)
+	}
+}
@@ -1,40 +1,224 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/config"
 	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/interop"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/profiling"
 	"traffic-monitoring-go/app/routes"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/clock"
 	"traffic-monitoring-go/app/siem/elasticsearch"
+	"traffic-monitoring-go/app/siem/live"
+	"traffic-monitoring-go/app/startup"
+)
+
+var (
+	kibanaURL           = config.NewString("KIBANA_URL", "", "Kibana to report in /readyz, if any")
+	configReloadSeconds = config.NewInt("CONFIG_RELOAD_SECONDS", 30, "Seconds between checks of the config file for changes", config.Min(1))
 )
 
 func main() {
+	// Write everything logged, including by the standard log package, as structured records
+	logging.RedirectStdLog()
+
+	// Read the settings from the config file, the environment and -set flags
+	config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := config.Load(); err != nil {
+		log.Fatalf("Failed to load the configuration: %v", err)
+	}
+	config.Watch(time.Duration(configReloadSeconds.Get()) * time.Second)
+
+	// Select the clock source (CLOCK_MODE=replay derives "now" from message timestamps)
+	clock.SetDefault(clock.FromEnv())
+
 	// Initialize the database connection.
 	db := database.SetupDatabase()
 
+	// Charge query time to sampled events for the pipeline cost breakdown
+	if err := siem.RegisterCostCallbacks(db); err != nil {
+		log.Printf("Warning: failed to register cost accounting callbacks: %v", err)
+	}
+
+	// Drop cached API responses when the tables behind them change
+	if err := middleware.RegisterCacheInvalidation(db); err != nil {
+		log.Printf("Warning: failed to register response cache invalidation: %v", err)
+	}
+
+	// Connect read replicas (DB_REPLICA_DSNS); dashboards and lists read from them
+	database.SetupReplicas()
+
+	// share cache invalidations and the recent messages of each V2X source with
+	// the other instances through Redis (REDIS_URL, STARTUP_REDIS_*)
+	redis, err := cache.Connect(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to set up Redis: %v", err)
+	}
+	if redis != nil {
+		startup.Start(context.Background(), startup.Dependency{
+			Name:           "redis",
+			Policy:         startup.Degraded,
+			MaxWait:        30 * time.Second,
+			InitialBackoff: time.Second,
+			MaxBackoff:     30 * time.Second,
+			Check:          func(ctx context.Context) error { return redis.Ping() },
+		}.FromEnv())
+	}
+
+	// create the default V2X threat taxonomy, which default rules are tagged with
+	if err := database.CreateDefaultV2XThreats(db); err != nil {
+		log.Printf("Warning: failed to create default V2X threats: %v", err)
+	}
+
 	// create default rules
 	if err := database.CreateDefaultRules(db); err != nil {
 		log.Printf("Warning: failed to create default rules: %v", err)
 	}
 
-	// initialize Elasticsearch service
+	// make the configured admin able to log in (ADMIN_EMAIL, ADMIN_PASSWORD)
+	if err := database.EnsureAdminUser(db); err != nil {
+		log.Printf("Warning: failed to set up the admin user: %v", err)
+	}
+
+	// capture heap and goroutine profiles when the process crosses a threshold
+	// (PROFILE_GOROUTINE_THRESHOLD, PROFILE_HEAP_THRESHOLD_MB, PROFILE_DIR)
+	profiling.NewCapturerFromEnv().Start()
+
+	// compute V2X KPIs for each completed interval
+	siem.NewKPIService(db).StartKPIScheduler()
+
+	// link DSRC and C-V2X source IDs of the same vehicle (VEHICLE_CORRELATION_*)
+	siem.NewVehicleCorrelator(db).Start()
+
+	// group related alerts into incidents (INCIDENT_CORRELATION_*)
+	siem.NewIncidentCorrelator(db).Start()
+
+	// run the response actions of rules on their alerts (RESPONSE_ACTIONS_*, RESPONSE_SCRIPT_*)
+	siem.NewResponseRunner(db).Start()
+
+	// resolve rotating temporary IDs and certificates into registered vehicles (VEHICLE_REGISTRY_*)
+	siem.NewVehicleRegistry(db).Start()
+
+	// keep a rolling trust score per V2X source ID (TRUST_WINDOW_HOURS, TRUST_UPDATE_MINUTES)
+	siem.NewTrustScorer(db).Start()
+
+	// check that vehicles near a DENM slowed down (DENM_DEFAULT_RADIUS_M, DENM_VERIFY_*)
+	siem.NewDENMVerifier(db).Start()
+
+	// raise trend alerts when a tracked count grows past its rule's ratio (TREND_EVAL_MINUTES)
+	siem.NewTrendService(db).Start()
+
+	// download V2X PKI CRLs that have a source URL (CRL_REFRESH_MINUTES)
+	siem.NewCRLFetcher(db).Start()
+
+	// report misbehaving V2X sources to the Misbehavior Authority (MBR_AUTHORITY_URL, MBR_WINDOW_MINUTES)
+	siem.NewMisbehaviorReporter(db).Start()
+
+	// deliver signed notices of confirmed compromises to fleet operators (OEM_NOTIFY_INTERVAL_SECONDS)
+	siem.NewOEMNotifier(db).Start()
+
+	// package each regulatory template's report once a month is over (REGULATORY_REPORT_CHECK_MINUTES)
+	siem.NewRegulatoryReporter(db).Start()
+
+	// generate and deliver the daily and weekly summary reports (SUMMARY_REPORT_CHECK_MINUTES)
+	siem.NewSummaryReporter(db).Start()
+
+	// save parse failure statistics and alert on sources that mostly send unparseable
+	// messages (PARSE_ERROR_FLUSH_SECONDS, PARSE_ERROR_RATE_THRESHOLD, PARSE_ERROR_MIN_MESSAGES)
+	siem.NewParseErrorReporter(db).Start()
+
+	// push live traffic statistics to wallboards (LIVE_STATS_SECONDS)
+	live.Start(db)
+
+	// publish alert changes from the outbox to Kafka or a webhook (ALERT_CDC_*)
+	siem.NewAlertOutboxPublisher(db).Start()
+
+	// push vehicles, RSUs and hazards to an NGSI-LD context broker (NGSI_LD_BROKER_URL)
+	interop.NewNGSILDExporter(db).StartBrokerSync()
+
+	// initialize Elasticsearch in the background (STARTUP_ELASTICSEARCH_MAX_WAIT_SECONDS,
+	// STARTUP_ELASTICSEARCH_POLICY); by default the API runs degraded until it is reachable
 	esService := elasticsearch.NewService()
-	if err := esService.Initialize(); err != nil {
-		log.Printf("Warning: Failed to initialize Elasticsearch: %v", err)
-		log.Println("The application will continue without Elasticsearch integration\nBut try to fix this issue checking the codebase")
+	esService.OrganizationSlug = siem.OrganizationSlugs(db) // names tenant indices security-events-{org}-YYYY.MM.DD
+	startup.Start(context.Background(), startup.Dependency{
+		Name:           "elasticsearch",
+		Policy:         startup.Degraded,
+		MaxWait:        60 * time.Second,
+		InitialBackoff: 2 * time.Second,
+		MaxBackoff:     30 * time.Second,
+		Check:          func(ctx context.Context) error { return esService.Initialize() },
+	}.FromEnv())
+
+	// report Kibana in /readyz when KIBANA_URL is set (STARTUP_KIBANA_*)
+	if kibanaURL := kibanaURL.Get(); kibanaURL != "" {
+		startup.Start(context.Background(), startup.Dependency{
+			Name:           "kibana",
+			Policy:         startup.Degraded,
+			MaxWait:        120 * time.Second,
+			InitialBackoff: 2 * time.Second,
+			MaxBackoff:     30 * time.Second,
+			Check:          startup.HTTPCheck(strings.TrimSuffix(kibanaURL, "/") + "/api/status"),
+		}.FromEnv())
 	}
 
+	// spill index operations to disk while Elasticsearch is unreachable (ES_SPILL_*)
+	if err := esService.StartSpill(); err != nil {
+		log.Printf("Warning: failed to start Elasticsearch spill buffer: %v", err)
+	}
+
+	// index through the _bulk API from an in-memory buffer (ES_BULK_*)
+	esService.StartBulk()
+
+	// purge expired events and Elasticsearch indices by retention policy
+	// (RETENTION_CHECK_MINUTES, RETENTION_BATCH_SIZE)
+	siem.NewRetentionManager(db, esService).Start()
 
-	// Create a new Gin router with default middleware (logger and recovery).
-	router := gin.Default()
+
+	// Create a new Gin router logging every request as a structured record, and recovering from panics
+	router := gin.New()
+	router.Use(middleware.AccessLog(), gin.Recovery())
 
 	// Register all API routes.
 	routes.RegisterRoutes(router, db, esService)
 
 	// Start the server on port 8080.
-	log.Println("Starting SIEM server on port 8080...")
-	if err := router.Run(":8080"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{Addr: ":8080", Handler: router}
+	go func() {
+		log.Println("Starting SIEM server on port 8080...")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	log.Println("Shutting down SIEM server")
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+
+	// flush documents still buffered for Elasticsearch
+	if err := esService.Close(10 * time.Second); err != nil {
+		log.Printf("Error flushing Elasticsearch buffers: %v", err)
 	}
 
 }
@@ -0,0 +1,285 @@
+package maptiles
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+)
+
+var (
+	tileUpstreamURL = config.NewString("TILE_UPSTREAM_URL", "https://tile.openstreetmap.org/{z}/{x}/{y}.png", "Tile server cache misses are fetched from, with {z}, {x}, {y} and optionally {ext} placeholders")
+	tileCacheDir    = config.NewString("TILE_CACHE_DIR", "data/tiles", "Directory of the basemap tile cache")
+	tileCacheMaxMB  = config.NewInt("TILE_CACHE_MAX_MB", 512, "Megabytes of the basemap tile cache", config.Min(1))
+	tileMaxZoom     = config.NewInt("TILE_MAX_ZOOM", 19, "Highest zoom level served", config.Min(1))
+	tileOffline     = config.NewBool("TILE_OFFLINE", false, "Serve cached tiles only, for air-gapped deployments")
+)
+
+// Proxy serves basemap tiles from a disk cache, fetching misses from an
+// upstream tile server. In offline mode only cached tiles are served, which
+// lets air-gapped deployments run from a pre-seeded cache.
+type Proxy struct {
+	UpstreamURL   string // template with {z}, {x}, {y} and optionally {ext}, e.g. https://tile.openstreetmap.org/{z}/{x}/{y}.png
+	CacheDir      string
+	MaxCacheBytes int64
+	MaxZoom       int
+	Offline       bool
+	UserAgent     string
+	HTTPClient    *http.Client
+
+	mutex      sync.Mutex
+	cacheBytes int64
+	scanned    bool
+	hits       uint64
+	misses     uint64
+}
+
+// Stats describes the cache state of the proxy
+type Stats struct {
+	UpstreamURL   string `json:"upstream_url"`
+	Offline       bool   `json:"offline"`
+	CacheDir      string `json:"cache_dir"`
+	CacheBytes    int64  `json:"cache_bytes"`
+	MaxCacheBytes int64  `json:"max_cache_bytes"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+}
+
+// ErrTileNotCached is returned in offline mode when a tile is not in the cache
+var ErrTileNotCached = fmt.Errorf("tile not cached and proxy is offline")
+
+// ErrInvalidTile is wrapped by the errors about tiles that cannot exist, such
+// as coordinates outside the grid or a format the upstream server does not serve
+var ErrInvalidTile = errors.New("invalid tile")
+
+// NewProxyFromEnv creates a Proxy configured from environment variables
+func NewProxyFromEnv() *Proxy {
+	return &Proxy{
+		UpstreamURL:   tileUpstreamURL.Get(),
+		CacheDir:      tileCacheDir.Get(),
+		MaxCacheBytes: int64(tileCacheMaxMB.Get()) * 1024 * 1024,
+		MaxZoom:       tileMaxZoom.Get(),
+		Offline:       tileOffline.Get(),
+		UserAgent:     "traffic-monitoring-siem-tile-proxy/1.0",
+		HTTPClient:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Tile returns the tile bytes and content type for z/x/y with the given extension
+func (p *Proxy) Tile(z, x, y int, ext string) ([]byte, string, error) {
+	if err := p.validate(z, x, y, ext); err != nil {
+		return nil, "", err
+	}
+
+	path := p.tilePath(z, x, y, ext)
+	if data, err := os.ReadFile(path); err == nil {
+		p.mutex.Lock()
+		p.hits++
+		p.mutex.Unlock()
+		// touch the file so eviction keeps recently used tiles
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return data, contentType(ext), nil
+	}
+
+	p.mutex.Lock()
+	p.misses++
+	p.mutex.Unlock()
+
+	if p.Offline {
+		return nil, "", ErrTileNotCached
+	}
+	// without {ext} in the template, the upstream serves tiles in one format only
+	if format := p.upstreamFormat(); format != "" && contentType(format) != contentType(ext) {
+		return nil, "", fmt.Errorf("%w: the upstream tile server serves %s tiles, not %s", ErrInvalidTile, format, ext)
+	}
+
+	data, err := p.fetch(z, x, y, ext)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := p.store(path, data); err != nil {
+		log.Printf("Warning: failed to cache tile %d/%d/%d: %v", z, x, y, err)
+	}
+
+	return data, contentType(ext), nil
+}
+
+// Stats returns the current cache statistics
+func (p *Proxy) Stats() Stats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.scanCache()
+
+	return Stats{
+		UpstreamURL:   p.UpstreamURL,
+		Offline:       p.Offline,
+		CacheDir:      p.CacheDir,
+		CacheBytes:    p.cacheBytes,
+		MaxCacheBytes: p.MaxCacheBytes,
+		Hits:          p.hits,
+		Misses:        p.misses,
+	}
+}
+
+// validate rejects coordinates outside the tile grid and unknown formats
+func (p *Proxy) validate(z, x, y int, ext string) error {
+	if z < 0 || z > p.MaxZoom {
+		return fmt.Errorf("%w: zoom level %d out of range 0-%d", ErrInvalidTile, z, p.MaxZoom)
+	}
+	limit := 1 << uint(z)
+	if x < 0 || x >= limit || y < 0 || y >= limit {
+		return fmt.Errorf("%w: tile %d/%d/%d out of range", ErrInvalidTile, z, x, y)
+	}
+	if contentType(ext) == "" {
+		return fmt.Errorf("%w: unsupported tile format %q", ErrInvalidTile, ext)
+	}
+	return nil
+}
+
+// tilePath returns the cache location of a tile
+func (p *Proxy) tilePath(z, x, y int, ext string) string {
+	return filepath.Join(p.CacheDir, strconv.Itoa(z), strconv.Itoa(x), fmt.Sprintf("%d.%s", y, ext))
+}
+
+// upstreamFormat returns the extension of the tiles the upstream serves when
+// its template has no {ext}, e.g. png, or "" when any format can be asked for
+func (p *Proxy) upstreamFormat() string {
+	if strings.Contains(p.UpstreamURL, "{ext}") {
+		return ""
+	}
+	path := p.UpstreamURL
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if contentType(format) == "" {
+		return ""
+	}
+	return format
+}
+
+// fetch downloads a tile from the upstream server
+func (p *Proxy) fetch(z, x, y int, ext string) ([]byte, error) {
+	url := strings.NewReplacer(
+		"{z}", strconv.Itoa(z),
+		"{x}", strconv.Itoa(x),
+		"{y}", strconv.Itoa(y),
+		"{ext}", ext,
+	).Replace(p.UpstreamURL)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// OSM tile usage policy requires an identifying user agent
+	req.Header.Set("User-Agent", p.UserAgent)
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream tile server returned status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// store writes a tile to the cache and evicts old tiles if over the limit
+func (p *Proxy) store(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.scanCache()
+	p.cacheBytes += int64(len(data))
+
+	if p.MaxCacheBytes > 0 && p.cacheBytes > p.MaxCacheBytes {
+		p.evict()
+	}
+	return nil
+}
+
+// scanCache computes the cache size once, on first use
+func (p *Proxy) scanCache() {
+	if p.scanned {
+		return
+	}
+	p.scanned = true
+	p.cacheBytes = 0
+	filepath.Walk(p.CacheDir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			p.cacheBytes += info.Size()
+		}
+		return nil
+	})
+}
+
+// evict removes least recently used tiles until the cache is at 90% of its limit
+func (p *Proxy) evict() {
+	type cachedTile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var tiles []cachedTile
+	filepath.Walk(p.CacheDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			tiles = append(tiles, cachedTile{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+
+	sort.Slice(tiles, func(i, j int) bool { return tiles[i].modTime.Before(tiles[j].modTime) })
+
+	target := p.MaxCacheBytes * 9 / 10
+	removed := 0
+	for _, tile := range tiles {
+		if p.cacheBytes <= target {
+			break
+		}
+		if err := os.Remove(tile.path); err != nil {
+			continue
+		}
+		p.cacheBytes -= tile.size
+		removed++
+	}
+
+	log.Printf("Tile cache evicted %d tiles, now %d bytes", removed, p.cacheBytes)
+}
+
+// contentType maps a tile extension to its MIME type
+func contentType(ext string) string {
+	switch ext {
+	case "png":
+		return "image/png"
+	case "jpg", "jpeg":
+		return "image/jpeg"
+	case "webp":
+		return "image/webp"
+	case "pbf", "mvt":
+		return "application/x-protobuf"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,235 @@
+// Package metrics keeps the counters, histograms and gauges describing the
+// ingestion and detection pipeline and writes them in the Prometheus text
+// exposition format, so the SIEM can be scraped without a client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds, from 1ms to 10s
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric is anything the registry can write
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = map[string]metric{}
+)
+
+// register adds a metric to the registry; names must be unique
+func register(m metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, exists := registry[m.name()]; exists {
+		panic("metrics: duplicate metric " + m.name())
+	}
+	registry[m.name()] = m
+}
+
+// WriteText writes every registered metric in the Prometheus text format, sorted by name
+func WriteText(w io.Writer) {
+	registryMutex.Lock()
+	metrics := make([]metric, 0, len(registry))
+	for _, m := range registry {
+		metrics = append(metrics, m)
+	}
+	registryMutex.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name() < metrics[j].name() })
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	metricName string
+	help       string
+	labels     []string
+
+	mutex  sync.Mutex
+	values map[string]float64 // by encoded label values
+}
+
+// NewCounterVec registers a counter with the given label names
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{metricName: name, help: help, labels: labels, values: map[string]float64{}}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter for the label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter for the label values
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := labelKey(c.labels, labelValues)
+	c.mutex.Lock()
+	c.values[key] += v
+	c.mutex.Unlock()
+}
+
+func (c *CounterVec) name() string { return c.metricName }
+
+func (c *CounterVec) write(w io.Writer) {
+	writeHeader(w, c.metricName, c.help, "counter")
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, labelSet(c.labels, key, ""), formatValue(c.values[key]))
+	}
+}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	metricName string
+	help       string
+	labels     []string
+	buckets    []float64
+
+	mutex      sync.Mutex
+	histograms map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram with the given upper bounds, in
+// increasing order, and label names
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{metricName: name, help: help, labels: labels, buckets: buckets, histograms: map[string]*histogram{}}
+	register(h)
+	return h
+}
+
+// Observe records a value for the label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := labelKey(h.labels, labelValues)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	hist, ok := h.histograms[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.histograms[key] = hist
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hist.counts[i]++
+	}
+	hist.count++
+	hist.sum += v
+}
+
+func (h *HistogramVec) name() string { return h.metricName }
+
+func (h *HistogramVec) write(w io.Writer) {
+	writeHeader(w, h.metricName, h.help, "histogram")
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	keys := make([]string, 0, len(h.histograms))
+	for key := range h.histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		hist := h.histograms[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hist.counts[i]
+			le := `le="` + formatValue(bound) + `"`
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, labelSet(h.labels, key, le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, labelSet(h.labels, key, `le="+Inf"`), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, labelSet(h.labels, key, ""), formatValue(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, labelSet(h.labels, key, ""), hist.count)
+	}
+}
+
+// GaugeFunc is a gauge whose value is read when the metrics are written
+type GaugeFunc struct {
+	metricName string
+	help       string
+	value      func() float64
+}
+
+// NewGaugeFunc registers a gauge reporting value()
+func NewGaugeFunc(name, help string, value func() float64) *GaugeFunc {
+	g := &GaugeFunc{metricName: name, help: help, value: value}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string { return g.metricName }
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatValue(g.value()))
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelKey encodes label values as a map key; missing values are empty
+func labelKey(labels, values []string) string {
+	if len(values) != len(labels) {
+		padded := make([]string, len(labels))
+		copy(padded, values)
+		values = padded
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelSet renders {name="value",...} from an encoded key, with extra appended
+func labelSet(labels []string, key, extra string) string {
+	var pairs []string
+	if len(labels) > 0 {
+		values := strings.Split(key, "\xff")
+		escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+		for i, label := range labels {
+			pairs = append(pairs, label+`="`+escape.Replace(values[i])+`"`)
+		}
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/metrics"
+	"traffic-monitoring-go/app/models"
+)
+
+// APIKeyHeader carries the API key of a log source, see auth.GenerateAPIKey
+const APIKeyHeader = "X-API-Key"
+
+// edgeBatchPath is the route edge forwarders send batches to with
+// INGEST_API_TOKEN; a node forwards the events of many sources, so it has no
+// key of a single source
+const edgeBatchPath = "/ingest/batch"
+
+var (
+	requireAPIKeys = config.NewBool("INGEST_REQUIRE_API_KEYS", true, "Refuse ingestion without a log source API key, but for the batches of edge forwarders; false also accepts INGEST_API_TOKEN, bearer and admin tokens")
+	keyRateLimit   = config.NewFloat("INGEST_KEY_RATE_LIMIT", 50, "Ingest requests per second of API keys without a limit of their own", config.Positive)
+	keyBurst       = config.NewInt("INGEST_KEY_BURST", 100, "Ingest requests API keys without a burst of their own may send at once", config.Min(1))
+)
+
+var ingestRateLimited = metrics.NewCounterVec("siem_ingest_rate_limited_total",
+	"Ingest requests refused for exceeding the rate limit of their API key, by key", "key")
+
+// CurrentAPIKey returns the log source API key the caller presented, or nil
+func CurrentAPIKey(c *gin.Context) *models.APIKey {
+	if claims := CurrentClaims(c); claims != nil {
+		return claims.APIKey
+	}
+	return nil
+}
+
+// IngestAPIKeys guards the ingest routes. Requests made with an API key are
+// held to the key's rate limit and answered with 429 and Retry-After above it.
+// Requests without a key are refused unless INGEST_REQUIRE_API_KEYS=false,
+// except the batches edge forwarders send with INGEST_API_TOKEN. Keys
+// without a limit of their own get INGEST_KEY_RATE_LIMIT requests per second
+// (default 50) in bursts of up to INGEST_KEY_BURST (default 100). Each
+// instance keeps its own limits.
+func IngestAPIKeys() gin.HandlerFunc {
+	required := requireAPIKeys.Get()
+	limiter := newRateLimiter(keyRateLimit.Get(), keyBurst.Get())
+
+	return func(c *gin.Context) {
+		apiKey := CurrentAPIKey(c)
+		if apiKey == nil {
+			if required && !(c.FullPath() == edgeBatchPath && usedIngestToken(c)) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Ingestion requires a log source API key in " + APIKeyHeader})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if wait := limiter.reserve(apiKey, time.Now()); wait > 0 {
+			ingestRateLimited.Inc(strconv.FormatUint(uint64(apiKey.ID), 10))
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit of the API key exceeded, retry later"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// usedIngestToken reports whether the caller presented INGEST_API_TOKEN
+func usedIngestToken(c *gin.Context) bool {
+	claims := CurrentClaims(c)
+	return claims != nil && claims.Subject == ingestTokenSubject
+}
+
+// rateLimiter is a token bucket per API key: a key may send up to its burst
+// at once, and the bucket refills at its rate
+type rateLimiter struct {
+	mutex   sync.Mutex
+	rate    float64 // for keys without a rate of their own
+	burst   int     // for keys without a burst of their own
+	buckets map[uint]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, buckets: make(map[uint]*tokenBucket)}
+}
+
+// reserve takes a token for one request of key, returning 0 when it may
+// proceed and otherwise how long until a token is available
+func (l *rateLimiter) reserve(key *models.APIKey, now time.Time) time.Duration {
+	rate, burst := key.RateLimit, float64(key.Burst)
+	if rate <= 0 {
+		rate = l.rate
+	}
+	if burst <= 0 {
+		burst = float64(l.burst)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	bucket, ok := l.buckets[key.ID]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, updated: now}
+		l.buckets[key.ID] = bucket
+	}
+
+	// refill for the time since the last request, up to the burst
+	if elapsed := now.Sub(bucket.updated).Seconds(); elapsed > 0 {
+		bucket.tokens = math.Min(burst, bucket.tokens+elapsed*rate)
+		bucket.updated = now
+	}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0
+	}
+	return time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+}
@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/auth"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+)
+
+// IngestRole is the role of clients presenting INGEST_API_TOKEN, such as edge
+// forwarders and generators. It is never assigned to users.
+const IngestRole models.UserRole = "ingest"
+
+var (
+	adminAPIToken  = config.NewString("ADMIN_API_TOKEN", "", "Shared token granting the admin role in X-Admin-Token", config.Secret)
+	ingestAPIToken = config.NewString("INGEST_API_TOKEN", "", "Shared token granting the ingest role in X-Ingest-Token", config.Secret)
+)
+
+// claimsKey is the gin context key holding the caller's *auth.Claims
+const claimsKey = "auth.claims"
+
+// ingestTokenSubject is the subject of callers presenting INGEST_API_TOKEN
+const ingestTokenSubject = "ingest-token"
+
+// OrganizationHeader names the tenant the shared admin and ingest tokens act
+// for; callers signed in as a user of an organization act for it alone
+const OrganizationHeader = "X-Organization"
+
+// publicPaths are served without credentials
+var publicPaths = map[string]bool{
+	"/":                true,
+	"/health":          true,
+	"/health/replicas": true,
+	"/metrics":         true, // guarded by METRICS_TOKEN instead, for Prometheus scrapers
+	"/readyz":          true,
+	"/auth/login":      true,
+}
+
+// readRoles may use the safe methods of every route
+var readRoles = []models.UserRole{models.AdminRole, models.AnalystRole, models.ViewerRole, models.UserRoleUser}
+
+// Authenticate identifies the caller of every non-public route from a bearer
+// token issued by /auth/login, the X-Admin-Token header (as admin), the
+// X-Ingest-Token header matching INGEST_API_TOKEN (as ingest) or a log source
+// API key in X-API-Key (as ingest, for the key's source). GET requests may
+// pass the token as access_token, since browsers cannot set headers on event streams.
+// Bearer tokens of revoked sessions are refused. The caller's organization is
+// resolved from the token, or from X-Organization for the shared tokens.
+func Authenticate(db *gorm.DB) gin.HandlerFunc {
+	adminToken := adminAPIToken.Get()
+	ingestToken := ingestAPIToken.Get()
+
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if publicPaths[path] || strings.HasPrefix(path, "/ui/") {
+			c.Next()
+			return
+		}
+
+		claims, ok := authenticate(c, db, adminToken, ingestToken)
+		if !ok {
+			return
+		}
+
+		// the tenant comes with the token; the shared tokens may name one
+		err := auth.ResolveOrganization(db, claims, c.GetHeader(OrganizationHeader))
+		switch {
+		case errors.Is(err, auth.ErrUnknownOrganization):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unknown organization or not yours: " + c.GetHeader(OrganizationHeader)})
+			return
+		case errors.Is(err, auth.ErrOrganizationDisabled):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Organization is disabled"})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Cannot resolve the organization: " + err.Error()})
+			return
+		}
+		c.Set(claimsKey, claims)
+		c.Next()
+	}
+}
+
+// authenticate returns the claims of the caller's credentials, answering the request when there are none
+func authenticate(c *gin.Context, db *gorm.DB, adminToken, ingestToken string) (*auth.Claims, bool) {
+	if provided := c.GetHeader("X-Admin-Token"); provided != "" && tokenMatches(provided, adminToken) {
+		return &auth.Claims{Subject: "admin-token", Role: models.AdminRole}, true
+	}
+	if provided := c.GetHeader(APIKeyHeader); provided != "" {
+		apiKey, err := auth.LookupAPIKey(db, provided)
+		switch {
+		case errors.Is(err, auth.ErrInvalidAPIKey):
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid, revoked or expired API key"})
+			return nil, false
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Cannot verify the API key: " + err.Error()})
+			return nil, false
+		}
+		// the key's events belong to its tenant
+		return &auth.Claims{
+			Subject:        "api-key:" + strconv.FormatUint(uint64(apiKey.ID), 10),
+			Role:           IngestRole,
+			OrganizationID: apiKey.OrganizationID,
+			APIKey:         apiKey,
+		}, true
+	}
+	if provided := c.GetHeader("X-Ingest-Token"); provided != "" && tokenMatches(provided, ingestToken) {
+		return &auth.Claims{Subject: ingestTokenSubject, Role: IngestRole}, true
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" && c.Request.Method == http.MethodGet {
+		token = c.Query("access_token")
+	}
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return nil, false
+	}
+
+	claims, err := auth.ParseToken(token)
+	if err == nil {
+		err = auth.CheckSession(db, claims)
+	}
+	switch {
+	case errors.Is(err, auth.ErrTokenRevoked):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return nil, false
+	case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrTokenExpired):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return nil, false
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Cannot verify the session: " + err.Error()})
+		return nil, false
+	}
+	return claims, true
+}
+
+// tokenMatches compares a shared token in constant time; an unconfigured token matches nothing
+func tokenMatches(provided, configured string) bool {
+	return configured != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(configured)) == 1
+}
+
+// CurrentClaims returns the authenticated caller, or nil on public routes
+func CurrentClaims(c *gin.Context) *auth.Claims {
+	value, ok := c.Get(claimsKey)
+	if !ok {
+		return nil
+	}
+	claims, _ := value.(*auth.Claims)
+	return claims
+}
+
+// CurrentOrganization returns the tenant the caller acts for, or nil when it acts for every tenant
+func CurrentOrganization(c *gin.Context) *uint {
+	if claims := CurrentClaims(c); claims != nil {
+		return claims.OrganizationID
+	}
+	return nil
+}
+
+// TenantRoutes keeps callers acting for one organization to the routes whose
+// handlers scope what they read and write by tenant, given as gin route paths;
+// every other route serves all tenants and is refused to them
+func TenantRoutes(paths ...string) gin.HandlerFunc {
+	scoped := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		scoped[path] = true
+	}
+
+	return func(c *gin.Context) {
+		// unmatched routes fall through to the 404 handler
+		if CurrentOrganization(c) == nil || c.FullPath() == "" || scoped[c.FullPath()] {
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This route is not available to callers acting for an organization"})
+	}
+}
+
+// hasRole reports whether the caller holds one of roles
+func hasRole(c *gin.Context, roles []models.UserRole) bool {
+	claims := CurrentClaims(c)
+	if claims == nil {
+		return false
+	}
+	for _, role := range roles {
+		if claims.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole restricts every method of a route group to the given roles
+func RequireRole(roles ...models.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasRole(c, roles) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient role for this operation"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// WriteAccess lets every user role read a route group and restricts the
+// methods that change data to the given roles
+func WriteAccess(roles ...models.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed := roles
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			allowed = readRoles
+		}
+		if !hasRole(c, allowed) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient role for this operation"})
+			return
+		}
+		c.Next()
+	}
+}
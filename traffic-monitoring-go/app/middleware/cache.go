@@ -0,0 +1,279 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+)
+
+var cacheTTLSeconds = config.NewInt("HTTP_CACHE_TTL_SECONDS", 30, "Seconds a cached API response is served; 0 disables the cache",
+	config.Min(0), config.Reloadable)
+
+// responseCacheTTL bounds how long a cached response is served, configured with
+// HTTP_CACHE_TTL_SECONDS (default 30). Writes on this instance invalidate entries
+// at once; the TTL covers writes made through other instances.
+func responseCacheTTL() time.Duration {
+	return time.Duration(cacheTTLSeconds.Get()) * time.Second
+}
+
+// maxCachedResponses bounds the number of cached responses
+const maxCachedResponses = 1000
+
+// cachedResponse is a stored 200 response and the table versions it was built from
+type cachedResponse struct {
+	etag     string
+	header   http.Header
+	body     []byte
+	storedAt time.Time
+	versions []uint64
+}
+
+// responseCache holds cached read responses and a version per table, bumped on every write
+type responseCache struct {
+	mutex    sync.Mutex
+	entries  map[string]*cachedResponse
+	versions map[string]uint64
+	all      uint64 // bumped by writes whose table is unknown
+}
+
+var defaultResponseCache = &responseCache{
+	entries:  make(map[string]*cachedResponse),
+	versions: make(map[string]uint64),
+}
+
+// snapshot returns the current versions of tables; the caller holds the mutex
+func (rc *responseCache) snapshot(tables []string) []uint64 {
+	versions := make([]uint64, len(tables)+1)
+	versions[0] = rc.all
+	for i, table := range tables {
+		versions[i+1] = rc.versions[table]
+	}
+	return versions
+}
+
+// lookup returns the entry for key while it is fresh. Entries younger than
+// maxAge are served even after a write, matching what clients may cache.
+func (rc *responseCache) lookup(key string, tables []string, maxAge time.Duration) *cachedResponse {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	entry, ok := rc.entries[key]
+	if !ok {
+		return nil
+	}
+	age := time.Since(entry.storedAt)
+	if age >= responseCacheTTL() {
+		delete(rc.entries, key)
+		return nil
+	}
+	if age < maxAge {
+		return entry
+	}
+	current := rc.snapshot(tables)
+	for i := range current {
+		if current[i] != entry.versions[i] {
+			delete(rc.entries, key)
+			return nil
+		}
+	}
+	return entry
+}
+
+// store caches an entry built from the versions seen before the handler ran,
+// so a write racing with the handler leaves it stale rather than hides the write
+func (rc *responseCache) store(key string, entry *cachedResponse) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if len(rc.entries) >= maxCachedResponses {
+		for k, old := range rc.entries {
+			if time.Since(old.storedAt) >= responseCacheTTL() {
+				delete(rc.entries, k)
+			}
+		}
+		if len(rc.entries) >= maxCachedResponses {
+			rc.entries = make(map[string]*cachedResponse)
+		}
+	}
+	rc.entries[key] = entry
+}
+
+// InvalidateCache marks the cached responses built from tables as stale; with
+// no tables, every cached response is
+func InvalidateCache(tables ...string) {
+	rc := defaultResponseCache
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if len(tables) == 0 {
+		rc.all++
+		return
+	}
+	for _, table := range tables {
+		rc.versions[table]++
+	}
+}
+
+// cacheKey identifies a request by path and sorted query, without
+// credentials, and by the tenant it was answered for
+func cacheKey(c *gin.Context) string {
+	query := c.Request.URL.Query()
+	query.Del("access_token")
+	key := c.Request.URL.Path + "?" + query.Encode()
+	if claims := CurrentClaims(c); claims != nil && claims.Organization != "" {
+		key = claims.Organization + ":" + key
+	}
+	return key
+}
+
+// etagMatches reports whether an If-None-Match header lists etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedWriter holds back the response body until its ETag is known
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// writeCached answers from a cached response, or with 304 when the client has it
+func writeCached(c *gin.Context, entry *cachedResponse, maxAge time.Duration) {
+	header := c.Writer.Header()
+	for name, values := range entry.header {
+		header[name] = values
+	}
+	header.Set("ETag", entry.etag)
+	header.Set("Cache-Control", cacheControl(maxAge))
+	header.Set("X-Cache", "HIT")
+
+	if etagMatches(c.GetHeader("If-None-Match"), entry.etag) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, header.Get("Content-Type"), entry.body)
+	c.Abort()
+}
+
+func cacheControl(maxAge time.Duration) string {
+	return "private, max-age=" + strconv.Itoa(int(maxAge.Seconds())) + ", must-revalidate"
+}
+
+// Cached serves a read endpoint from memory while the tables it is built from
+// are unchanged, tags responses with an ETag and answers matching
+// If-None-Match requests with 304. Clients may reuse a response for maxAge.
+func Cached(maxAge time.Duration, tables ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet || responseCacheTTL() == 0 {
+			c.Next()
+			return
+		}
+
+		key := cacheKey(c)
+		if entry := defaultResponseCache.lookup(key, tables, maxAge); entry != nil {
+			writeCached(c, entry, maxAge)
+			return
+		}
+
+		defaultResponseCache.mutex.Lock()
+		versions := defaultResponseCache.snapshot(tables)
+		defaultResponseCache.mutex.Unlock()
+
+		writer := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Header("Cache-Control", cacheControl(maxAge))
+		c.Header("X-Cache", "MISS")
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if c.Writer.Status() != http.StatusOK {
+			c.Writer.Write(writer.body.Bytes())
+			return
+		}
+		sum := sha256.Sum256(writer.body.Bytes())
+		entry := &cachedResponse{
+			etag:     `"` + hex.EncodeToString(sum[:16]) + `"`,
+			header:   c.Writer.Header().Clone(),
+			body:     writer.body.Bytes(),
+			storedAt: time.Now(),
+			versions: versions,
+		}
+		entry.header.Del("X-Cache")
+		entry.header.Del(RequestIDHeader)
+		entry.header.Del(CorrelationIDHeader)
+		defaultResponseCache.store(key, entry)
+
+		c.Header("ETag", entry.etag)
+		if etagMatches(c.GetHeader("If-None-Match"), entry.etag) {
+			c.Writer.WriteHeader(http.StatusNotModified)
+			c.Writer.WriteHeaderNow()
+			return
+		}
+		c.Writer.Write(entry.body)
+	}
+}
+
+// writeStatement finds the table written by a raw INSERT, UPDATE or DELETE
+var writeStatement = regexp.MustCompile(`(?i)^\s*(?:INSERT\s+INTO|UPDATE|DELETE\s+FROM)\s+"?(\w+)"?`)
+
+// RegisterCacheInvalidation invalidates cached responses whenever a table is
+// written through db
+func RegisterCacheInvalidation(db *gorm.DB) error {
+	invalidate := func(tx *gorm.DB) {
+		if tx.Error != nil {
+			return
+		}
+		if tx.Statement.Table != "" {
+			InvalidateCache(tx.Statement.Table)
+		}
+	}
+	invalidateRaw := func(tx *gorm.DB) {
+		if tx.Error != nil {
+			return
+		}
+		sql := strings.TrimSpace(tx.Statement.SQL.String())
+		if match := writeStatement.FindStringSubmatch(sql); match != nil {
+			InvalidateCache(strings.ToLower(match[1]))
+			return
+		}
+		if !strings.HasPrefix(strings.ToUpper(sql), "SELECT") {
+			InvalidateCache()
+		}
+	}
+
+	callback := db.Callback()
+	if err := callback.Create().After("gorm:create").Register("cache:invalidate_create", invalidate); err != nil {
+		return err
+	}
+	if err := callback.Update().After("gorm:update").Register("cache:invalidate_update", invalidate); err != nil {
+		return err
+	}
+	if err := callback.Delete().After("gorm:delete").Register("cache:invalidate_delete", invalidate); err != nil {
+		return err
+	}
+	return callback.Raw().After("gorm:raw").Register("cache:invalidate_raw", invalidateRaw)
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/logging"
+)
+
+const (
+	// RequestIDHeader carries the ID of a request, taken from the client or
+	// generated, and is echoed in the response
+	RequestIDHeader = "X-Request-ID"
+
+	// CorrelationIDHeader carries the ID that follows what a request ingests
+	// through the events stored for it and their alerts. Clients such as edge
+	// forwarders may send their own; it defaults to the request ID.
+	CorrelationIDHeader = "X-Correlation-ID"
+)
+
+// requestIDPattern keeps IDs from clients short and safe to log
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID gives every request a request and a correlation ID, in its
+// context for loggers (see logging.Logger.WithContext) and in the response
+// headers
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = logging.NewID()
+		}
+		correlationID := c.GetHeader(CorrelationIDHeader)
+		if !requestIDPattern.MatchString(correlationID) {
+			correlationID = requestID
+		}
+
+		ctx := logging.WithCorrelationID(logging.WithRequestID(c.Request.Context(), requestID), correlationID)
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(RequestIDHeader, requestID)
+		c.Header(CorrelationIDHeader, correlationID)
+		c.Next()
+	}
+}
+
+// quietPaths are polled by probes and scrapers; their requests are logged at debug
+var quietPaths = map[string]bool{
+	"/health":          true,
+	"/health/replicas": true,
+	"/metrics":         true,
+	"/readyz":          true,
+}
+
+// AccessLog logs every request through the "http" component once it is
+// served: as an error when it failed on the server, a warning when the client
+// erred, and otherwise as info
+func AccessLog() gin.HandlerFunc {
+	logger := logging.New("http")
+
+	return func(c *gin.Context) {
+		started := time.Now()
+		path := c.Request.URL.Path
+		c.Next()
+
+		status := c.Writer.Status()
+		record := logger.WithContext(c.Request.Context())
+		write := record.Info
+		switch {
+		case status >= 500:
+			write = record.Error
+		case status >= 400:
+			write = record.Warn
+		case quietPaths[path]:
+			write = record.Debug
+		}
+		keyvals := []interface{}{
+			"method", c.Request.Method,
+			"path", path,
+			"route", c.FullPath(),
+			"status", status,
+			"duration_ms", float64(time.Since(started).Microseconds()) / 1000,
+			"bytes", c.Writer.Size(),
+			"client_ip", c.ClientIP(),
+		}
+		if len(c.Errors) > 0 {
+			keyvals = append(keyvals, "errors", c.Errors.Errors())
+		}
+		write("request served", keyvals...)
+	}
+}
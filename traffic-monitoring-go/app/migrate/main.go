@@ -0,0 +1,147 @@
+// Command migrate applies and inspects the schema migrations of the SIEM
+// database named by DSN. The SIEM refuses to start while migrations are
+// pending, unless it runs with DB_AUTO_MIGRATE=true.
+//
+//	migrate up                apply every pending migration
+//	migrate up-to VERSION     apply the pending migrations up to VERSION
+//	migrate down              roll back the latest migration
+//	migrate status            list the migrations and when they were applied
+//	migrate create NAME       write an empty migration to -dir
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/logger"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/database"
+)
+
+// migrationNamePattern keeps the names of new migrations usable in file names
+var migrationNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: migrate [-dir DIR] [-config FILE] [-set KEY=VALUE]... COMMAND
+
+Commands:
+  up               apply every pending migration
+  up-to VERSION    apply the pending migrations up to VERSION
+  down             roll back the latest migration
+  status           list the migrations and when they were applied
+  create NAME      write an empty migration named NAME to DIR
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	dir := flag.String("dir", "migrations", "directory new migrations are written to")
+	config.RegisterFlags(flag.CommandLine)
+	flag.Usage = usage
+	flag.Parse()
+	if err := config.Load(); err != nil {
+		log.Fatalf("Failed to load the configuration: %v", err)
+	}
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+	if command == "create" {
+		if len(args) != 1 {
+			log.Fatalf("create takes the name of the migration")
+		}
+		path, err := create(*dir, args[0], time.Now())
+		if err != nil {
+			log.Fatalf("Failed to create the migration: %v", err)
+		}
+		fmt.Println(path)
+		return
+	}
+
+	db := database.Connect()
+	db.Logger = logger.Default.LogMode(logger.Warn)
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	switch command {
+	case "up", "up-to":
+		var target int64
+		if command == "up-to" {
+			if len(args) != 1 {
+				log.Fatalf("up-to takes the version to migrate to")
+			}
+			if target, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+				log.Fatalf("Invalid version %q", args[0])
+			}
+		}
+		applied, err := migrator.Up(target)
+		for _, migration := range applied {
+			fmt.Printf("applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+	case "down":
+		migration, err := migrator.Down()
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		if migration == nil {
+			fmt.Println("no applied migrations")
+			return
+		}
+		fmt.Printf("rolled back %d_%s\n", migration.Version, migration.Name)
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatalf("Failed to read the migration status: %v", err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%-25s %d_%s\n", applied, status.Version, status.Name)
+		}
+
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// create writes an empty migration named name to dir, versioned by now, and returns its path
+func create(dir, name string, now time.Time) (string, error) {
+	name = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "-", "_"))
+	if !migrationNamePattern.MatchString(name) {
+		return "", fmt.Errorf("name %q must be lowercase letters, digits and underscores", name)
+	}
+
+	path := filepath.Join(dir, now.UTC().Format("20060102150405")+"_"+name+".sql")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString("-- +goose Up\n\n\n-- +goose Down\n\n")
+	return path, err
+}
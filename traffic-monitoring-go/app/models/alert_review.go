@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// AlertReviewState is the progress of a four-eyes review
+type AlertReviewState string
+
+const (
+	AlertReviewPending  AlertReviewState = "pending"  // waiting for a second analyst
+	AlertReviewApproved AlertReviewState = "approved" // a second analyst agreed and the status was applied
+	AlertReviewRejected AlertReviewState = "rejected" // a second analyst disagreed, or the first withdrew it
+)
+
+// AlertReview is a status change of an alert under four-eyes review: the first
+// analyst requests it and it only applies once a different analyst approves.
+// An alert has at most one pending review.
+type AlertReview struct {
+	ID              uint             `gorm:"primaryKey" json:"id"`
+	AlertID         uint             `gorm:"not null;index" json:"alert_id"`
+	Alert           *Alert           `gorm:"foreignKey:AlertID" json:"alert,omitempty"`
+	FromStatus      AlertStatus      `gorm:"not null" json:"from_status"`
+	Status          AlertStatus      `gorm:"not null" json:"status"` // the requested status
+	Resolution      string           `json:"resolution,omitempty"`
+	State           AlertReviewState `gorm:"not null;index" json:"state"`
+	RequestedByID   uint             `gorm:"not null" json:"requested_by_id"`
+	RequestedBy     string           `gorm:"not null" json:"requested_by"`
+	RequestedAt     time.Time        `gorm:"not null" json:"requested_at"`
+	ReviewedByID    *uint            `json:"reviewed_by_id,omitempty"`
+	ReviewedBy      string           `json:"reviewed_by,omitempty"`
+	ReviewedAt      *time.Time       `json:"reviewed_at,omitempty"`
+	ReviewerComment string           `json:"reviewer_comment,omitempty"`
+	CreatedAt       time.Time        `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time        `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for AlertReview
+func (AlertReview) TableName() string {
+	return "alert_reviews"
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// AnomalyDetectorConfig overrides the defaults of a registered V2X anomaly
+// detector. Params holds its thresholds by name; missing ones keep the
+// detector's default.
+type AnomalyDetectorConfig struct {
+	ID        uint               `gorm:"primaryKey" json:"id"`
+	Detector  string             `gorm:"not null;unique" json:"detector"`
+	Enabled   bool               `gorm:"not null;default:true" json:"enabled"`
+	Severity  EventSeverity      `json:"severity,omitempty"` // of the findings; empty keeps the detector's
+	Params    map[string]float64 `gorm:"serializer:json;type:jsonb" json:"params"`
+	UpdatedBy string             `json:"updated_by,omitempty"`
+	CreatedAt time.Time          `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time          `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for AnomalyDetectorConfig
+func (AnomalyDetectorConfig) TableName() string {
+	return "anomaly_detector_configs"
+}
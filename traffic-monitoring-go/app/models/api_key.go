@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// APIKey authenticates one log source on the ingest API; events sent with it
+// are stored under that source. Only a hash of the key is kept: the key
+// itself is shown once, when it is created or rotated.
+type APIKey struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	LogSourceID    uint       `gorm:"not null;index" json:"log_source_id"`
+	Name           string     `json:"name"`                                   // what uses the key, e.g. a host
+	Prefix         string     `gorm:"not null" json:"prefix"`                 // the start of the key, to tell keys apart
+	KeyHash        string     `gorm:"not null;unique" json:"-"`               // SHA-256 of the key
+	OrganizationID *uint      `gorm:"index" json:"organization_id,omitempty"` // the tenant its events belong to
+	RateLimit      float64    `json:"rate_limit"`                             // requests per second; 0 uses INGEST_KEY_RATE_LIMIT
+	Burst          int        `json:"burst"`                                  // requests it may send at once; 0 uses INGEST_KEY_BURST
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`                   // end of the grace period of a rotated key
+	ReplacedByID   *uint      `json:"replaced_by_id,omitempty"`               // the key a rotation issued in its place
+	RevokedAt      *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	RevokedBy      string     `json:"revoked_by,omitempty"`
+	CreatedBy      string     `json:"created_by"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for APIKey
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// Active reports whether the key is accepted at now
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Validate checks the settings of a key
+func (k *APIKey) Validate() *ValidationError {
+	errs := &ValidationError{}
+	if k.RateLimit < 0 {
+		errs.Add("rate_limit", "cannot be negative, got %g", k.RateLimit)
+	}
+	if k.Burst < 0 {
+		errs.Add("burst", "cannot be negative, got %d", k.Burst)
+	}
+	return errs
+}
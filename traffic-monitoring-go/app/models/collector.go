@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// CollectorListener persists a collector listener added at runtime so it is
+// restored when the SIEM restarts
+type CollectorListener struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"not null;unique" json:"name"`
+	Protocol  string    `gorm:"not null" json:"protocol"`
+	Port      int       `gorm:"not null" json:"port"`
+	Parser    string    `gorm:"not null" json:"parser"`
+	Enabled   bool      `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for CollectorListener
+func (CollectorListener) TableName() string {
+	return "collector_listeners"
+}
+
+// EdgeCheckpoint is the queue position up to which an edge collector's forwarded
+// events have been ingested, so resent batches are not ingested twice
+type EdgeCheckpoint struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	NodeID         string    `gorm:"not null;unique" json:"node_id"`
+	Segment        int64     `gorm:"not null" json:"segment"`
+	Offset         int64     `gorm:"not null" json:"offset"`
+	EventsReceived int64     `gorm:"not null;default:0" json:"events_received"`
+	LastBatchAt    time.Time `json:"last_batch_at"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for EdgeCheckpoint
+func (EdgeCheckpoint) TableName() string {
+	return "edge_checkpoints"
+}
+
+// MQTTTopic is a topic filter an MQTT collector subscribes to
+type MQTTTopic struct {
+	Filter string        `json:"filter"`           // may use the + and # wildcards
+	QoS    byte          `json:"qos"`              // 0, 1 or 2
+	Parser string        `json:"parser,omitempty"` // default json
+	Radio  RadioProtocol `json:"radio,omitempty"`  // set on messages that do not report theirs
+}
+
+// MQTTBroker persists an MQTT collector: a broker V2X gateways publish to and
+// the topics read from it, restored when the SIEM restarts
+type MQTTBroker struct {
+	ID                 uint        `gorm:"primaryKey" json:"id"`
+	Name               string      `gorm:"not null;unique" json:"name"`
+	URL                string      `gorm:"not null" json:"url"` // tcp:// or mqtt://, ssl://, tls:// or mqtts:// for TLS
+	ClientID           string      `json:"client_id,omitempty"` // when set, the broker keeps the session across reconnects
+	Username           string      `json:"username,omitempty"`
+	Password           string      `json:"password,omitempty"`                 // never returned by the API
+	CACert             string      `gorm:"type:text" json:"ca_cert,omitempty"` // PEM; the system roots when empty
+	ClientCert         string      `gorm:"type:text" json:"client_cert,omitempty"`
+	ClientKey          string      `gorm:"type:text" json:"client_key,omitempty"` // never returned by the API
+	InsecureSkipVerify bool        `gorm:"not null;default:false" json:"insecure_skip_verify"`
+	KeepAliveSeconds   int         `gorm:"not null;default:60" json:"keep_alive_seconds"`
+	Topics             []MQTTTopic `gorm:"serializer:json;type:jsonb" json:"topics"`
+	Enabled            bool        `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt          time.Time   `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt          time.Time   `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for MQTTBroker
+func (MQTTBroker) TableName() string {
+	return "mqtt_brokers"
+}
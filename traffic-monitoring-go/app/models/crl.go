@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// CertificateRevocationList is a V2X PKI CRL. Lists with a SourceURL are
+// downloaded periodically; others are uploaded.
+type CertificateRevocationList struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"not null;unique" json:"name"`
+	Issuer     string     `json:"issuer"`
+	SourceURL  string     `json:"source_url,omitempty"`
+	IssuedAt   *time.Time `json:"issued_at,omitempty"`
+	NextUpdate *time.Time `json:"next_update,omitempty"`
+	Entries    int        `gorm:"not null;default:0" json:"entries"`
+	FetchedAt  *time.Time `json:"fetched_at,omitempty"` // last successful download or upload
+	LastError  string     `json:"last_error,omitempty"`
+	Enabled    bool       `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for CertificateRevocationList
+func (CertificateRevocationList) TableName() string {
+	return "certificate_revocation_lists"
+}
+
+// RevokedCertificate is an entry of a CRL. CertificateID is the certificate's
+// hashed ID (HashedId8 or HashedId10 in IEEE 1609.2) as lowercase hex.
+type RevokedCertificate struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	CRLID         uint       `gorm:"column:crl_id;not null;uniqueIndex:idx_revoked_certificates_crl_certificate" json:"crl_id"`
+	CertificateID string     `gorm:"not null;uniqueIndex:idx_revoked_certificates_crl_certificate;index" json:"certificate_id"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	Reason        string     `json:"reason,omitempty"`
+}
+
+// TableName returns the table name for RevokedCertificate
+func (RevokedCertificate) TableName() string {
+	return "revoked_certificates"
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// DENMVerification measures whether a DENM (decentralized environmental
+// notification, e.g. a hazard warning) changed the behavior of the vehicles it
+// was addressed to. Vehicles inside the declared relevance radius are compared
+// with a control ring of vehicles just outside it. An alert whose DENM had no
+// plausible recipients at all is flagged as suspicious.
+type DENMVerification struct {
+	ID                     uint      `gorm:"primaryKey" json:"id"`
+	AlertID                uint      `gorm:"not null;uniqueIndex" json:"alert_id"`
+	SecurityEventID        uint      `gorm:"not null" json:"security_event_id"`
+	SenderID               string    `json:"sender_id"`
+	MessageType            string    `json:"message_type"`
+	RadiusM                float64   `json:"radius_m"`
+	Latitude               float64   `json:"latitude"`
+	Longitude              float64   `json:"longitude"`
+	InsideVehicles         int       `json:"inside_vehicles"`
+	InsideMeasured         int       `json:"inside_measured"` // with speed reports before and after the DENM
+	InsideSlowed           int       `json:"inside_slowed"`
+	InsideMeanSpeedChange  *float64  `json:"inside_mean_speed_change,omitempty"`
+	OutsideVehicles        int       `json:"outside_vehicles"`
+	OutsideMeasured        int       `json:"outside_measured"`
+	OutsideSlowed          int       `json:"outside_slowed"`
+	OutsideMeanSpeedChange *float64  `json:"outside_mean_speed_change,omitempty"`
+	Effectiveness          *float64  `json:"effectiveness,omitempty"` // share slowed inside minus share slowed outside
+	Suspicious             bool      `gorm:"not null;default:false;index" json:"suspicious"`
+	SuspiciousReason       string    `json:"suspicious_reason,omitempty"`
+	WindowStart            time.Time `json:"window_start"`
+	WindowEnd              time.Time `json:"window_end"`
+	VerifiedAt             time.Time `gorm:"index" json:"verified_at"`
+}
+
+// TableName returns the table name for DENMVerification
+func (DENMVerification) TableName() string {
+	return "denm_verifications"
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// RSU is a registered roadside unit
+type RSU struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Code      string    `gorm:"not null;unique" json:"code"`
+	Name      string    `json:"name"`
+	Latitude  float64   `gorm:"not null" json:"latitude"`
+	Longitude float64   `gorm:"not null" json:"longitude"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for RSU
+func (RSU) TableName() string {
+	return "rsus"
+}
+
+// GeoPoint is a WGS84 coordinate
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// RoadSegment is one polyline of an imported road network. The bounding box
+// columns let lookups discard distant segments before measuring distances.
+type RoadSegment struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	SegmentID string     `gorm:"index" json:"segment_id"`
+	Name      string     `json:"name"`
+	Ref       string     `json:"ref,omitempty"`
+	Geometry  []GeoPoint `gorm:"serializer:json" json:"geometry"`
+	MinLat    float64    `gorm:"index" json:"min_lat"`
+	MaxLat    float64    `json:"max_lat"`
+	MinLon    float64    `gorm:"index" json:"min_lon"`
+	MaxLon    float64    `json:"max_lon"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName returns the table name for RoadSegment
+func (RoadSegment) TableName() string {
+	return "road_segments"
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// GeofenceShape is how a geofence's area is given
+type GeofenceShape string
+
+const (
+	GeofencePolygon GeofenceShape = "polygon" // Polygon holds the vertices
+	GeofenceCircle  GeofenceShape = "circle"  // CenterLat/CenterLon and RadiusM
+)
+
+// GeofenceKind is what a geofence is used for
+type GeofenceKind string
+
+const (
+	GeofenceZone GeofenceKind = "zone" // a region of interest referenced by rules
+	GeofenceODD  GeofenceKind = "odd"  // part of the operational design domain vehicles must stay in
+)
+
+// Geofence is a named area that rule conditions ("location inside <name>")
+// and anomaly detectors refer to. The bounding box columns let lookups
+// discard distant geofences before testing the shape.
+type Geofence struct {
+	ID          uint          `gorm:"primaryKey" json:"id"`
+	Name        string        `gorm:"not null;unique" json:"name"`
+	Description string        `json:"description,omitempty"`
+	Kind        GeofenceKind  `gorm:"not null;default:zone" json:"kind"`
+	Shape       GeofenceShape `gorm:"not null" json:"shape"`
+	Polygon     []GeoPoint    `gorm:"serializer:json" json:"polygon,omitempty"`
+	CenterLat   float64       `json:"center_lat,omitempty"`
+	CenterLon   float64       `json:"center_lon,omitempty"`
+	RadiusM     float64       `json:"radius_m,omitempty"`
+	Enabled     bool          `gorm:"not null" json:"enabled"`
+	MinLat      float64       `json:"min_lat"`
+	MaxLat      float64       `json:"max_lat"`
+	MinLon      float64       `json:"min_lon"`
+	MaxLon      float64       `json:"max_lon"`
+	CreatedAt   time.Time     `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time     `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for Geofence
+func (Geofence) TableName() string {
+	return "geofences"
+}
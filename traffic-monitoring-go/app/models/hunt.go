@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// HuntParameter describes a placeholder used inside a hunt query
+type HuntParameter struct {
+	Name        string `json:"name"`
+	Default     string `json:"default"`
+	Description string `json:"description,omitempty"`
+}
+
+// HuntQuery is a saved, parameterized threat hunting query.
+// Query is written in KQL with {{name}} placeholders for parameters.
+type HuntQuery struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	Name        string          `gorm:"not null;unique" json:"name"`
+	Description string          `json:"description"`
+	Category    EventCategory   `json:"category"`
+	Query       string          `gorm:"type:text;not null" json:"query"`
+	Parameters  []HuntParameter `gorm:"serializer:json" json:"parameters"`
+	Columns     []string        `gorm:"serializer:json" json:"columns"`
+	Builtin     bool            `gorm:"-" json:"builtin"`
+	CreatedAt   time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for HuntQuery
+func (HuntQuery) TableName() string {
+	return "hunt_queries"
+}
@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// IncidentStatus is the progress of the investigation of an incident
+type IncidentStatus string
+
+const (
+	IncidentOpen          IncidentStatus = "open"
+	IncidentInvestigating IncidentStatus = "investigating"
+	IncidentContained     IncidentStatus = "contained" // the attack was stopped, clean-up is ongoing
+	IncidentClosed        IncidentStatus = "closed"
+)
+
+// ValidIncidentStatus reports whether s is one of the incident statuses
+func ValidIncidentStatus(s IncidentStatus) bool {
+	switch s {
+	case IncidentOpen, IncidentInvestigating, IncidentContained, IncidentClosed:
+		return true
+	}
+	return false
+}
+
+// Incident is a case grouping related alerts, so analysts work the attack
+// rather than each alert it raised. Analysts open incidents by hand; the
+// incident correlator opens them for alerts sharing a vehicle, a source IP or
+// a V2X threat, which CorrelationKey records. An alert belongs to at most one
+// incident.
+type Incident struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Title          string         `gorm:"not null" json:"title"`
+	Description    string         `json:"description,omitempty"`
+	Status         IncidentStatus `gorm:"not null;index" json:"status"`
+	Severity       EventSeverity  `gorm:"not null" json:"severity"` // raised to the highest of its alerts as they join
+	OwnerID        *uint          `gorm:"index" json:"owner_id,omitempty"`
+	Owner          *User          `gorm:"foreignKey:OwnerID" json:"owner,omitempty"`
+	CorrelationKey string         `gorm:"index" json:"correlation_key,omitempty"` // e.g. vehicle:EMV001, ip:10.0.0.1 or threat:V2X-SPOOF
+	AlertCount     int            `gorm:"not null;default:0" json:"alert_count"`
+	FirstSeen      *time.Time     `json:"first_seen,omitempty"` // of its alerts
+	LastSeen       *time.Time     `gorm:"index" json:"last_seen,omitempty"`
+	CreatedBy      string         `gorm:"not null" json:"created_by"`
+	ClosedAt       *time.Time     `json:"closed_at,omitempty"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for Incident
+func (Incident) TableName() string {
+	return "incidents"
+}
+
+// IncidentEntryKind is what an incident timeline entry records
+type IncidentEntryKind string
+
+const (
+	IncidentEntryCreated       IncidentEntryKind = "created"
+	IncidentEntryAlertAdded    IncidentEntryKind = "alert_added"
+	IncidentEntryAlertRemoved  IncidentEntryKind = "alert_removed"
+	IncidentEntryEventLinked   IncidentEntryKind = "event_linked"
+	IncidentEntryStatusChanged IncidentEntryKind = "status_changed"
+	IncidentEntryOwnerChanged  IncidentEntryKind = "owner_changed"
+	IncidentEntryNote          IncidentEntryKind = "note"
+)
+
+// IncidentEntry is one entry of the timeline of an incident: what was done
+// to it, by whom, and the alert or event concerned
+type IncidentEntry struct {
+	ID              uint              `gorm:"primaryKey" json:"id"`
+	IncidentID      uint              `gorm:"not null;index" json:"incident_id"`
+	Kind            IncidentEntryKind `gorm:"not null" json:"kind"`
+	Actor           string            `gorm:"not null" json:"actor"`
+	Message         string            `json:"message,omitempty"`
+	AlertID         *uint             `json:"alert_id,omitempty"`
+	SecurityEventID *uint             `gorm:"index" json:"security_event_id,omitempty"`
+	CreatedAt       time.Time         `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName returns the table name for IncidentEntry
+func (IncidentEntry) TableName() string {
+	return "incident_entries"
+}
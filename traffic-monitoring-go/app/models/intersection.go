@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"traffic-monitoring-go/app/eventschema"
+)
+
+// SyntheticIntersection is a declared signalized intersection the V2X simulator
+// broadcasts SPaT and MAP messages for. Its timing plans are the ground truth
+// intersection analytics and SPaT checks are tested against.
+type SyntheticIntersection struct {
+	ID             uint                     `gorm:"primaryKey" json:"id"`
+	IntersectionID int                      `gorm:"not null;unique" json:"intersection_id"` // J2735 IntersectionID
+	Name           string                   `gorm:"not null;unique" json:"name"`
+	Description    string                   `json:"description,omitempty"`
+	Latitude       float64                  `gorm:"not null" json:"latitude"`
+	Longitude      float64                  `gorm:"not null" json:"longitude"`
+	Approaches     []eventschema.Approach   `gorm:"serializer:json" json:"approaches"`
+	TimingPlans    []eventschema.TimingPlan `gorm:"serializer:json" json:"timing_plans"`
+	Enabled        bool                     `gorm:"not null" json:"enabled"` // broadcast by the simulator
+	CreatedAt      time.Time                `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time                `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for SyntheticIntersection
+func (SyntheticIntersection) TableName() string {
+	return "synthetic_intersections"
+}
+
+// Scenario returns the intersection as the simulator consumes it
+func (i *SyntheticIntersection) Scenario() eventschema.Intersection {
+	return eventschema.Intersection{
+		IntersectionID: i.IntersectionID,
+		Name:           i.Name,
+		Latitude:       i.Latitude,
+		Longitude:      i.Longitude,
+		Approaches:     i.Approaches,
+		TimingPlans:    i.TimingPlans,
+	}
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// KPIEntityType identifies what a KPI record describes
+type KPIEntityType string
+
+const (
+	KPIEntityVehicle KPIEntityType = "vehicle"
+	KPIEntityRSU     KPIEntityType = "rsu"
+)
+
+// V2XKPI holds the standard V2X performance indicators of one vehicle or RSU
+// over one interval. Inter-reception times are measured between consecutive
+// messages from the same vehicle; information age is reception minus generation time.
+type V2XKPI struct {
+	ID              uint          `gorm:"primaryKey" json:"id"`
+	IntervalStart   time.Time     `gorm:"not null;index" json:"interval_start"`
+	IntervalEnd     time.Time     `gorm:"not null" json:"interval_end"`
+	EntityType      KPIEntityType `gorm:"not null;index" json:"entity_type"`
+	EntityID        string        `gorm:"not null;index" json:"entity_id"`
+	MessageCount    int           `json:"message_count"`
+	PIRMeanMs       *float64      `json:"pir_mean_ms,omitempty"`
+	PIRP95Ms        *float64      `json:"pir_p95_ms,omitempty"`
+	InfoAgeMeanMs   *float64      `json:"info_age_mean_ms,omitempty"`
+	InfoAgeP95Ms    *float64      `json:"info_age_p95_ms,omitempty"`
+	NeighborDensity float64       `json:"neighbor_density"`
+	CreatedAt       time.Time     `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName returns the table name for V2XKPI
+func (V2XKPI) TableName() string {
+	return "v2x_kpis"
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// LayoutWidget places one dashboard widget on the grid
+type LayoutWidget struct {
+	ID      string                 `json:"id"`
+	Type    string                 `json:"type"` // e.g. event_timeseries, top_rules, map, live_stats
+	Title   string                 `json:"title,omitempty"`
+	X       int                    `json:"x"`
+	Y       int                    `json:"y"`
+	Width   int                    `json:"w"`
+	Height  int                    `json:"h"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// DashboardLayout is a saved analyst workspace. Layouts belong either to a user
+// (UserID set) or, as the defaults of everyone with a role, to a role (Role set).
+type DashboardLayout struct {
+	ID               uint              `gorm:"primaryKey" json:"id"`
+	Name             string            `gorm:"not null" json:"name"`
+	UserID           *uint             `gorm:"index" json:"user_id,omitempty"`
+	Role             UserRole          `gorm:"type:VARCHAR(20);index" json:"role,omitempty"`
+	Widgets          []LayoutWidget    `gorm:"serializer:json" json:"widgets"`
+	DefaultTimeRange string            `json:"default_time_range,omitempty"`
+	DefaultFilters   map[string]string `gorm:"serializer:json" json:"default_filters,omitempty"`
+	IsDefault        bool              `gorm:"not null;default:false" json:"is_default"`
+	CreatedAt        time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for DashboardLayout
+func (DashboardLayout) TableName() string {
+	return "dashboard_layouts"
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// MisbehaviorReportStatus is the delivery state of a misbehavior report
+type MisbehaviorReportStatus string
+
+const (
+	MisbehaviorReportLocal   MisbehaviorReportStatus = "local"   // no Misbehavior Authority configured
+	MisbehaviorReportPending MisbehaviorReportStatus = "pending" // waiting to be forwarded
+	MisbehaviorReportSent    MisbehaviorReportStatus = "sent"
+	MisbehaviorReportFailed  MisbehaviorReportStatus = "failed" // gave up after repeated delivery errors
+)
+
+// MisbehaviorReport is a misbehavior report (MBR) on one V2X source ID, in the
+// spirit of SAE J3287 and ETSI TS 103 759: the anomalies detected for the
+// source in a window, with the messages they were detected in as evidence.
+// Document holds the report as sent to the Misbehavior Authority.
+type MisbehaviorReport struct {
+	ID           uint                    `gorm:"primaryKey" json:"id"`
+	ReportID     string                  `gorm:"not null;unique" json:"report_id"`
+	SourceID     string                  `gorm:"not null;uniqueIndex:idx_misbehavior_reports_source_window" json:"source_id"`
+	WindowStart  time.Time               `gorm:"not null;uniqueIndex:idx_misbehavior_reports_source_window" json:"window_start"`
+	WindowEnd    time.Time               `gorm:"not null" json:"window_end"`
+	AnomalyCount int                     `gorm:"not null" json:"anomaly_count"`
+	AnomalyTypes []string                `gorm:"serializer:json;type:jsonb" json:"anomaly_types"`
+	Document     string                  `gorm:"type:jsonb;not null" json:"-"`
+	Status       MisbehaviorReportStatus `gorm:"not null;index" json:"status"`
+	Attempts     int                     `gorm:"not null;default:0" json:"attempts"`
+	LastError    string                  `json:"last_error,omitempty"`
+	SentAt       *time.Time              `json:"sent_at,omitempty"`
+	CreatedAt    time.Time               `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName returns the table name for MisbehaviorReport
+func (MisbehaviorReport) TableName() string {
+	return "misbehavior_reports"
+}
@@ -73,16 +73,29 @@ func (UserEvent) TableName() string {
 type UserRole string
 
 const (
-	AdminRole    UserRole = "admin"
-	UserRoleUser UserRole = "user"
+	AdminRole    UserRole = "admin"   // manages rules, sources, users and configuration
+	AnalystRole  UserRole = "analyst" // triages alerts and works with events
+	ViewerRole   UserRole = "viewer"  // read-only
+	UserRoleUser UserRole = "user"    // legacy role, treated as viewer
 )
 
+// ValidUserRole reports whether role can be assigned to a user
+func ValidUserRole(role UserRole) bool {
+	switch role {
+	case AdminRole, AnalystRole, ViewerRole, UserRoleUser:
+		return true
+	}
+	return false
+}
+
 // User represents a user of the system.
 type User struct {
 	ID             uint     `gorm:"primaryKey" json:"id"`
 	Email          string   `gorm:"unique;not null" json:"email"`
-	HashedPassword string   `gorm:"not null" json:"hashed_password"`
+	HashedPassword string   `gorm:"not null" json:"-"`
 	Role           UserRole `gorm:"type:VARCHAR(20)" json:"role"`
+	MaxSessions    int      `gorm:"not null;default:0" json:"max_sessions"` // concurrent sessions; 0 uses MAX_SESSIONS_PER_USER
+	OrganizationID *uint    `gorm:"index" json:"organization_id,omitempty"` // the tenant the user works for; nil sees every tenant
 }
 
 // TableName returns the table name for User.
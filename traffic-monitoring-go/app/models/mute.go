@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// MuteSourceType is the kind of source a mute applies to
+type MuteSourceType string
+
+const (
+	MuteSourceVehicle   MuteSourceType = "vehicle"    // details.vehicle_id or device_id
+	MuteSourceRSU       MuteSourceType = "rsu"        // details.rsu_id or the log source name
+	MuteSourceLogSource MuteSourceType = "log_source" // log source name
+	MuteSourceIP        MuteSourceType = "source_ip"
+)
+
+// SourceMute silences alerts (and anomalies) from one noisy source. A mute ends when
+// it expires or is resolved; without ExpiresAt it lasts until resolved.
+// MessageType, when set, limits the mute to that message type (e.g. SPAT).
+type SourceMute struct {
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	SourceType      MuteSourceType `gorm:"not null;index:idx_source_mutes_source" json:"source_type"`
+	SourceID        string         `gorm:"not null;index:idx_source_mutes_source" json:"source_id"`
+	MessageType     string         `json:"message_type,omitempty"`
+	Reason          string         `gorm:"not null" json:"reason"`
+	CreatedBy       string         `json:"created_by,omitempty"`
+	ExpiresAt       *time.Time     `gorm:"index" json:"expires_at,omitempty"`
+	ResolvedAt      *time.Time     `json:"resolved_at,omitempty"`
+	SuppressedCount int64          `gorm:"not null;default:0" json:"suppressed_count"`
+	CreatedAt       time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for SourceMute
+func (SourceMute) TableName() string {
+	return "source_mutes"
+}
+
+// Active reports whether the mute is in force at now
+func (m *SourceMute) Active(now time.Time) bool {
+	if m.ResolvedAt != nil {
+		return false
+	}
+	return m.ExpiresAt == nil || now.Before(*m.ExpiresAt)
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// FleetOperator is a vehicle OEM or fleet operator told when an alert on one
+// of its vehicles is confirmed malicious. Vehicles are matched by the prefix
+// of their V2X source ID (pseudonym).
+type FleetOperator struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	Name            string    `gorm:"not null;unique" json:"name"`
+	Description     string    `json:"description,omitempty"`
+	EndpointURL     string    `gorm:"not null" json:"endpoint_url"`
+	Secret          string    `gorm:"not null" json:"secret,omitempty"` // HMAC key signing the notifications; never returned by the API
+	VehiclePrefixes []string  `gorm:"serializer:json;type:jsonb" json:"vehicle_prefixes"`
+	Enabled         bool      `gorm:"not null" json:"enabled"`
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for FleetOperator
+func (FleetOperator) TableName() string {
+	return "fleet_operators"
+}
+
+// OEMNotificationStatus is the delivery state of a fleet operator notification
+type OEMNotificationStatus string
+
+const (
+	OEMNotificationPending OEMNotificationStatus = "pending" // waiting to be delivered
+	OEMNotificationSent    OEMNotificationStatus = "sent"
+	OEMNotificationFailed  OEMNotificationStatus = "failed" // gave up after repeated delivery errors
+)
+
+// OEMNotification is the notice of a confirmed compromise sent to a fleet
+// operator. Payload holds the document as signed and sent; an alert is
+// notified to each operator once.
+type OEMNotification struct {
+	ID                uint                  `gorm:"primaryKey" json:"id"`
+	NotificationID    string                `gorm:"not null;unique" json:"notification_id"`
+	AlertID           uint                  `gorm:"not null;uniqueIndex:idx_oem_notifications_alert_operator" json:"alert_id"`
+	OperatorID        uint                  `gorm:"not null;uniqueIndex:idx_oem_notifications_alert_operator" json:"operator_id"`
+	Pseudonym         string                `gorm:"not null;index" json:"pseudonym"`
+	CertificateID     string                `json:"certificate_id,omitempty"`
+	RecommendedAction string                `gorm:"not null" json:"recommended_action"`
+	Payload           string                `gorm:"type:jsonb;not null" json:"-"`
+	Status            OEMNotificationStatus `gorm:"not null;index" json:"status"`
+	Attempts          int                   `gorm:"not null;default:0" json:"attempts"`
+	LastError         string                `json:"last_error,omitempty"`
+	SentAt            *time.Time            `json:"sent_at,omitempty"`
+	CreatedAt         time.Time             `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName returns the table name for OEMNotification
+func (OEMNotification) TableName() string {
+	return "oem_notifications"
+}
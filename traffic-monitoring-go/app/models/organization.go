@@ -0,0 +1,40 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// organizationSlugPattern keeps slugs usable in Elasticsearch index names
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+
+// Organization is a tenant of the SIEM, such as a road operator. Users,
+// events, rules and alerts may belong to one; those without an organization
+// belong to the operator of the instance, whose users see every tenant.
+// Rules without an organization apply to the events of every tenant.
+type Organization struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Slug      string    `gorm:"not null;unique" json:"slug"` // names the tenant in Elasticsearch indices and the X-Organization header
+	Name      string    `gorm:"not null" json:"name"`
+	Enabled   bool      `gorm:"not null" json:"enabled"` // disabled tenants cannot sign in or ingest
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for Organization
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+// Validate checks the fields of an organization
+func (o *Organization) Validate() *ValidationError {
+	errs := &ValidationError{}
+	if !organizationSlugPattern.MatchString(o.Slug) {
+		errs.Add("slug", "must be 1 to 40 lowercase letters, digits or dashes, starting with a letter or digit, got %q", o.Slug)
+	}
+	if strings.TrimSpace(o.Name) == "" {
+		errs.Add("name", "is required")
+	}
+	return errs
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AlertChangeOperation is the kind of alert state change recorded in the outbox
+type AlertChangeOperation string
+
+const (
+	AlertChangeCreated AlertChangeOperation = "created"
+	AlertChangeUpdated AlertChangeOperation = "updated"
+)
+
+// AlertChange is a row of the transactional alert outbox. It is written in the
+// same transaction as the alert itself, so a committed alert change is never lost
+// even if the process crashes before the change is published downstream.
+type AlertChange struct {
+	ID          uint                 `gorm:"primaryKey" json:"id"`
+	AlertID     uint                 `gorm:"not null;index" json:"alert_id"`
+	Operation   AlertChangeOperation `gorm:"not null" json:"operation"`
+	Payload     string               `gorm:"type:jsonb;not null" json:"-"`
+	Attempts    int                  `gorm:"not null;default:0" json:"attempts"`
+	LastError   string               `json:"last_error,omitempty"`
+	PublishedAt *time.Time           `gorm:"index" json:"published_at,omitempty"`
+	CreatedAt   time.Time            `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName returns the table name for AlertChange
+func (AlertChange) TableName() string {
+	return "alert_outbox"
+}
+
+// AfterCreate records the new alert in the outbox within the creating transaction
+func (a *Alert) AfterCreate(tx *gorm.DB) error {
+	return recordAlertChange(tx, a, AlertChangeCreated)
+}
+
+// AfterUpdate records the updated alert in the outbox within the updating transaction
+func (a *Alert) AfterUpdate(tx *gorm.DB) error {
+	return recordAlertChange(tx, a, AlertChangeUpdated)
+}
+
+// recordAlertChange stores a snapshot of the alert without its associations
+func recordAlertChange(tx *gorm.DB, alert *Alert, operation AlertChangeOperation) error {
+	if alert.ID == 0 {
+		return nil
+	}
+
+	encoded, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	var snapshot map[string]interface{}
+	if err := json.Unmarshal(encoded, &snapshot); err != nil {
+		return err
+	}
+	delete(snapshot, "rule")
+	delete(snapshot, "security_event")
+	delete(snapshot, "assigned_user")
+
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	change := AlertChange{AlertID: alert.ID, Operation: operation, Payload: string(payload)}
+	return tx.Session(&gorm.Session{NewDB: true}).Create(&change).Error
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// ParseErrorCount counts the messages from one source that failed to parse
+// for one reason, per hour
+type ParseErrorCount struct {
+	ID            uint      `gorm:"primaryKey" json:"-"`
+	BucketStart   time.Time `gorm:"not null;uniqueIndex:idx_parse_error_counts_key" json:"bucket_start"`
+	Collector     string    `gorm:"not null;uniqueIndex:idx_parse_error_counts_key" json:"collector"`
+	SourceAddress string    `gorm:"not null;uniqueIndex:idx_parse_error_counts_key" json:"source_address"`
+	MessageType   string    `gorm:"not null;uniqueIndex:idx_parse_error_counts_key" json:"message_type"`
+	Reason        string    `gorm:"not null;uniqueIndex:idx_parse_error_counts_key" json:"reason"`
+	Count         int64     `gorm:"not null;default:0" json:"count"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// TableName returns the table name for ParseErrorCount
+func (ParseErrorCount) TableName() string {
+	return "parse_error_counts"
+}
+
+// ParseSourceCount counts the messages received from one source, and how many
+// of them failed to parse, per hour
+type ParseSourceCount struct {
+	ID            uint      `gorm:"primaryKey" json:"-"`
+	BucketStart   time.Time `gorm:"not null;uniqueIndex:idx_parse_source_counts_key" json:"bucket_start"`
+	Collector     string    `gorm:"not null;uniqueIndex:idx_parse_source_counts_key" json:"collector"`
+	SourceAddress string    `gorm:"not null;uniqueIndex:idx_parse_source_counts_key" json:"source_address"`
+	Messages      int64     `gorm:"not null;default:0" json:"messages"`
+	Failures      int64     `gorm:"not null;default:0" json:"failures"`
+}
+
+// TableName returns the table name for ParseSourceCount
+func (ParseSourceCount) TableName() string {
+	return "parse_source_counts"
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// RegulatoryTemplate describes the monthly report a jurisdiction expects:
+// which sections, over which corridors, in which formats and with which
+// column headers. Corridors name zone geofences; none means all of them.
+type RegulatoryTemplate struct {
+	ID           uint              `gorm:"primaryKey" json:"id"`
+	Name         string            `gorm:"not null;unique" json:"name"`
+	Jurisdiction string            `gorm:"not null" json:"jurisdiction"`
+	Sections     []string          `gorm:"serializer:json;type:jsonb" json:"sections"` // message_volumes, security_incidents, anomalies
+	Corridors    []string          `gorm:"serializer:json;type:jsonb" json:"corridors,omitempty"`
+	Formats      []string          `gorm:"serializer:json;type:jsonb" json:"formats"`           // csv, xlsx
+	Headers      map[string]string `gorm:"serializer:json;type:jsonb" json:"headers,omitempty"` // column key to header label
+	Delimiter    string            `gorm:"not null;default:','" json:"delimiter"`
+	Timezone     string            `gorm:"not null;default:UTC" json:"timezone"` // month boundaries are taken in this zone
+	Enabled      bool              `gorm:"not null" json:"enabled"`
+	CreatedAt    time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for RegulatoryTemplate
+func (RegulatoryTemplate) TableName() string {
+	return "regulatory_templates"
+}
+
+// RegulatoryReport is a generated monthly report package, a zip holding one
+// file per section and format
+type RegulatoryReport struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	TemplateID  uint      `gorm:"not null;uniqueIndex:idx_regulatory_reports_template_period" json:"template_id"`
+	Period      string    `gorm:"not null;uniqueIndex:idx_regulatory_reports_template_period" json:"period"` // YYYY-MM
+	PeriodStart time.Time `gorm:"not null" json:"period_start"`
+	PeriodEnd   time.Time `gorm:"not null" json:"period_end"`
+	Filename    string    `gorm:"not null" json:"filename"`
+	Size        int       `gorm:"not null" json:"size"`
+	Archive     []byte    `gorm:"not null" json:"-"`
+	CreatedAt   time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName returns the table name for RegulatoryReport
+func (RegulatoryReport) TableName() string {
+	return "regulatory_reports"
+}
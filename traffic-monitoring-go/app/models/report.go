@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// ReportSchedule is how often a summary report is generated
+type ReportSchedule string
+
+const (
+	ReportDaily  ReportSchedule = "daily"  // the day before, reported as YYYY-MM-DD
+	ReportWeekly ReportSchedule = "weekly" // the Monday-to-Sunday week before, reported as YYYY-Www
+)
+
+// ReportTemplate describes a scheduled summary report: its sections, the
+// formats it is rendered to and the notification channels it is delivered
+// through. HTMLTemplate, when set, is an html/template replacing the default
+// HTML layout; the PDF keeps the default one.
+type ReportTemplate struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	Name         string         `gorm:"not null;unique" json:"name"`
+	Title        string         `json:"title,omitempty"`
+	Schedule     ReportSchedule `gorm:"not null" json:"schedule"`
+	Sections     []string       `gorm:"serializer:json;type:jsonb" json:"sections"` // event_counts, top_rules, top_attackers, anomaly_trends
+	TopN         int            `gorm:"not null;default:10" json:"top_n"`
+	Formats      []string       `gorm:"serializer:json;type:jsonb" json:"formats"`            // html, pdf
+	Channels     []string       `gorm:"serializer:json;type:jsonb" json:"channels,omitempty"` // notification channel names; none means all enabled ones
+	Timezone     string         `gorm:"not null;default:UTC" json:"timezone"`                 // day and week boundaries are taken in this zone
+	HTMLTemplate string         `gorm:"type:text" json:"html_template,omitempty"`
+	Enabled      bool           `gorm:"not null" json:"enabled"`
+	CreatedAt    time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for ReportTemplate
+func (ReportTemplate) TableName() string {
+	return "report_templates"
+}
+
+// Report is a generated summary report and the outcome of its delivery
+type Report struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	TemplateID    uint       `gorm:"not null;uniqueIndex:idx_reports_template_period" json:"template_id"`
+	Period        string     `gorm:"not null;uniqueIndex:idx_reports_template_period" json:"period"`
+	PeriodStart   time.Time  `gorm:"not null" json:"period_start"`
+	PeriodEnd     time.Time  `gorm:"not null" json:"period_end"`
+	Filename      string     `gorm:"not null" json:"filename"` // without extension
+	HTML          []byte     `json:"-"`
+	PDF           []byte     `json:"-"`
+	HTMLSize      int        `gorm:"not null;default:0" json:"html_size"`
+	PDFSize       int        `gorm:"not null;default:0" json:"pdf_size"`
+	DeliveredTo   []string   `gorm:"serializer:json;type:jsonb" json:"delivered_to,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	DeliveryError string     `json:"delivery_error,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName returns the table name for Report
+func (Report) TableName() string {
+	return "reports"
+}
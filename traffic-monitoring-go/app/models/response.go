@@ -0,0 +1,108 @@
+package models
+
+import "time"
+
+// ResponseActionType is what a response action does when its rule fires
+type ResponseActionType string
+
+const (
+	ResponseWebhook        ResponseActionType = "webhook"         // config: url, method, header:<Name>
+	ResponseBlockIP        ResponseActionType = "block_ip"        // config: duration; blocks the event's source IP
+	ResponseUntrustVehicle ResponseActionType = "untrust_vehicle" // config: duration; marks the event's V2X source untrusted
+	ResponseScript         ResponseActionType = "script"          // config: script, a file of RESPONSE_SCRIPT_DIR
+)
+
+// ResponseAction is an automated response a rule triggers on each alert it
+// raises. Actions in dry run record what they would do without doing it.
+type ResponseAction struct {
+	ID        uint               `gorm:"primaryKey" json:"id"`
+	RuleID    uint               `gorm:"not null;index" json:"rule_id"`
+	Name      string             `gorm:"not null" json:"name"`
+	Type      ResponseActionType `gorm:"not null" json:"type"`
+	Config    map[string]string  `gorm:"serializer:json;type:jsonb" json:"config"`
+	Enabled   bool               `gorm:"not null" json:"enabled"`
+	DryRun    bool               `gorm:"not null;default:false" json:"dry_run"`
+	CreatedBy string             `json:"created_by,omitempty"`
+	CreatedAt time.Time          `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time          `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for ResponseAction
+func (ResponseAction) TableName() string {
+	return "response_actions"
+}
+
+// ResponseExecutionStatus is where a response execution stands
+type ResponseExecutionStatus string
+
+const (
+	ResponsePending   ResponseExecutionStatus = "pending"
+	ResponseSucceeded ResponseExecutionStatus = "succeeded"
+	ResponseFailed    ResponseExecutionStatus = "failed"  // out of attempts
+	ResponseDryRun    ResponseExecutionStatus = "dry_run" // recorded what it would have done
+	ResponseSkipped   ResponseExecutionStatus = "skipped" // nothing to act on, e.g. an event without source IP
+)
+
+// ResponseExecution is the audit log of response actions: one row per action
+// an alert triggered, queued with the alert and updated once it ran
+type ResponseExecution struct {
+	ID          uint                    `gorm:"primaryKey" json:"id"`
+	ActionID    uint                    `gorm:"not null;index" json:"action_id"`
+	RuleID      uint                    `gorm:"not null;index" json:"rule_id"`
+	AlertID     uint                    `gorm:"not null;index" json:"alert_id"`
+	Type        ResponseActionType      `gorm:"not null" json:"type"`
+	Status      ResponseExecutionStatus `gorm:"not null;index" json:"status"`
+	DryRun      bool                    `gorm:"not null;default:false" json:"dry_run"`
+	TriggeredBy string                  `gorm:"not null" json:"triggered_by"` // "rule", or the user of a manual dry run
+	Target      string                  `json:"target,omitempty"`             // the URL, IP, V2X source or script acted on
+	Output      string                  `json:"output,omitempty"`
+	Error       string                  `json:"error,omitempty"`
+	Attempts    int                     `gorm:"not null;default:0" json:"attempts"`
+	ExecutedAt  *time.Time              `json:"executed_at,omitempty"`
+	CreatedAt   time.Time               `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName returns the table name for ResponseExecution
+func (ResponseExecution) TableName() string {
+	return "response_executions"
+}
+
+// BlockedIP is a source IP a response action put on the blocklist, for
+// firewalls and gateways to enforce. Without ExpiresAt it stays blocked until
+// removed.
+type BlockedIP struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	IP        string     `gorm:"not null;unique" json:"ip"`
+	Reason    string     `gorm:"not null" json:"reason"`
+	RuleID    *uint      `json:"rule_id,omitempty"`
+	AlertID   *uint      `json:"alert_id,omitempty"`
+	ActionID  *uint      `json:"action_id,omitempty"`
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for BlockedIP
+func (BlockedIP) TableName() string {
+	return "ip_blocklist"
+}
+
+// UntrustedVehicle is a V2X source a response action marked untrusted, with
+// the registered vehicle it resolved to when the registry knew it
+type UntrustedVehicle struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	SourceID            string     `gorm:"not null;unique" json:"source_id"`
+	RegisteredVehicleID *uint      `gorm:"index" json:"registered_vehicle_id,omitempty"`
+	Reason              string     `gorm:"not null" json:"reason"`
+	RuleID              *uint      `json:"rule_id,omitempty"`
+	AlertID             *uint      `json:"alert_id,omitempty"`
+	ActionID            *uint      `json:"action_id,omitempty"`
+	ExpiresAt           *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	CreatedAt           time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for UntrustedVehicle
+func (UntrustedVehicle) TableName() string {
+	return "untrusted_vehicles"
+}
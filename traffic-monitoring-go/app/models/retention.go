@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// RetentionTarget is what a retention policy prunes
+type RetentionTarget string
+
+const (
+	RetentionTargetEvents RetentionTarget = "events" // rows of security_events, V2X messages included
+	RetentionTargetIndex  RetentionTarget = "index"  // daily Elasticsearch indices of a family
+)
+
+// RetentionAction is what a retention policy does with expired data
+type RetentionAction string
+
+const (
+	RetentionDelete RetentionAction = "delete"
+	RetentionRollup RetentionAction = "rollup" // count events per day before deleting them
+)
+
+// RetentionPolicy expires security events of a category, or the daily
+// Elasticsearch indices of a family, once they are older than MaxAgeDays.
+// Events that back an alert or a DENM verification are always kept.
+type RetentionPolicy struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	Name        string          `gorm:"not null;unique" json:"name"`
+	Target      RetentionTarget `gorm:"not null" json:"target"`
+	Category    EventCategory   `json:"category,omitempty"`     // events target; empty applies to every category
+	IndexFamily string          `json:"index_family,omitempty"` // index target, e.g. security-events
+	Action      RetentionAction `gorm:"not null" json:"action"`
+	MaxAgeDays  int             `gorm:"not null" json:"max_age_days"`
+	Enabled     bool            `gorm:"not null" json:"enabled"`
+	LastRunAt   *time.Time      `json:"last_run_at,omitempty"`
+	LastPurged  int64           `json:"last_purged"` // events or indices removed by the last run
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for RetentionPolicy
+func (RetentionPolicy) TableName() string {
+	return "retention_policies"
+}
+
+// SecurityEventRollup counts the security events of a day that a rollup
+// retention policy deleted, per log source, category and severity
+type SecurityEventRollup struct {
+	ID          uint          `gorm:"primaryKey" json:"-"`
+	Day         time.Time     `gorm:"not null;uniqueIndex:idx_security_event_rollups_key" json:"day"`
+	LogSourceID uint          `gorm:"not null;uniqueIndex:idx_security_event_rollups_key" json:"log_source_id"`
+	Category    EventCategory `gorm:"not null;uniqueIndex:idx_security_event_rollups_key" json:"category"`
+	Severity    EventSeverity `gorm:"not null;uniqueIndex:idx_security_event_rollups_key" json:"severity"`
+	Count       int64         `gorm:"not null" json:"count"`
+}
+
+// TableName returns the table name for SecurityEventRollup
+func (SecurityEventRollup) TableName() string {
+	return "security_event_rollups"
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// SinkType identifies where a routed event is delivered
+type SinkType string
+
+const (
+	SinkTypePostgres      SinkType = "postgres"
+	SinkTypeElasticsearch SinkType = "elasticsearch"
+	SinkTypeKafka         SinkType = "kafka"
+	SinkTypeWebhook       SinkType = "webhook"
+)
+
+// EventSink is a destination ingested events can be routed to.
+// Config holds the type-specific settings, e.g. url, index, topic or table.
+type EventSink struct {
+	ID        uint              `gorm:"primaryKey" json:"id"`
+	Name      string            `gorm:"not null;unique" json:"name"`
+	Type      SinkType          `gorm:"not null" json:"type"`
+	Config    map[string]string `gorm:"serializer:json" json:"config"`
+	QueueSize int               `gorm:"not null;default:1000" json:"queue_size"`
+	Enabled   bool              `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for EventSink
+func (EventSink) TableName() string {
+	return "event_sinks"
+}
+
+// RoutingRule sends events matching its categories and severities to a set of sinks.
+// Empty Categories or Severities match any value.
+type RoutingRule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"not null;unique" json:"name"`
+	Description string    `json:"description"`
+	Categories  []string  `gorm:"serializer:json" json:"categories"`
+	Severities  []string  `gorm:"serializer:json" json:"severities"`
+	Sinks       []string  `gorm:"serializer:json" json:"sinks"`
+	Enabled     bool      `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for RoutingRule
+func (RoutingRule) TableName() string {
+	return "routing_rules"
+}
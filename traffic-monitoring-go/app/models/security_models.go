@@ -49,6 +49,9 @@ type SecurityEvent struct {
 	Category		EventCategory	`gorm:"not null" json:"category"`
 	Message			string		`gorm:"not null" json:"message"`
 	RawData			string		`gorm:"type:text" json:"raw_data"`
+	TrustScore		*float64	`json:"trust_score,omitempty"` // of the V2X source when the event arrived, see siem.SourceTrustScore
+	OrganizationID		*uint		`gorm:"index" json:"organization_id,omitempty"` // the tenant that sent it
+	CorrelationID		string		`gorm:"index" json:"correlation_id,omitempty"` // of the request or message it was ingested from, see logging.CorrelationID
 	CreatedAt		time.Time	`gorm:"autoCreateTime" json:"created_at"`
 }
 
@@ -99,6 +102,14 @@ const (
 	RuleStatusTesting	RuleStatus = "testing"
 )
 
+// RuleScope limits which events a rule is evaluated against.
+// Empty lists place no restriction on that dimension.
+type RuleScope struct {
+	Categories	[]EventCategory	`json:"categories,omitempty"`
+	LogSourceIDs	[]uint		`json:"log_source_ids,omitempty"`
+	MessageTypes	[]string	`json:"message_types,omitempty"`
+}
+
 //Rule represents a detection rule for security events
 type Rule struct {
 	ID		uint		`gorm:"primaryKey" json:"id"`
@@ -108,7 +119,11 @@ type Rule struct {
 	Severity	EventSeverity	`gorm:"not null" json:"severity"`
 	Category	EventCategory	`gorm:"not null" json:"category"`
 	Status		RuleStatus	`gorm:"not null" json:"status"`
+	Scope		RuleScope	`gorm:"serializer:json" json:"scope"`
+	Techniques	[]string	`gorm:"serializer:json;type:jsonb" json:"techniques,omitempty"` // MITRE ATT&CK technique IDs, e.g. T1557 or T1110.001
+	V2XThreats	[]string	`gorm:"column:v2x_threats;serializer:json;type:jsonb" json:"v2x_threats,omitempty"` // V2X threat taxonomy codes, e.g. V2X-SPOOF
 	CreatedBy	uint		`json:"created_by"`
+	OrganizationID	*uint		`gorm:"index" json:"organization_id,omitempty"` // the tenant whose events it applies to; nil applies to all
 	CreatedAt	time.Time	`gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt	time.Time	`gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -128,6 +143,7 @@ const (
 	AlertStatusClosed		AlertStatus = "closed"
 	AlertStatusInProgress		AlertStatus = "in_progress"
 	AlertStatusFalsePositive	AlertStatus = "false_positive"
+	AlertStatusConfirmedMalicious	AlertStatus = "confirmed_malicious" // an analyst confirmed the activity was an attack
 )
 
 
@@ -139,12 +155,26 @@ type Alert struct {
     Rule           Rule          `gorm:"foreignKey:RuleID" json:"rule"`
     SecurityEventID uint          `json:"security_event_id"`
     SecurityEvent  SecurityEvent `gorm:"foreignKey:SecurityEventID" json:"security_event"`
-    Timestamp      time.Time     `gorm:"not null" json:"timestamp"`
+    Timestamp      time.Time     `gorm:"not null;index" json:"timestamp"`
     Severity       EventSeverity `gorm:"not null" json:"severity"`
     Status         AlertStatus   `gorm:"not null" json:"status"`
     AssignedTo     *uint         `json:"assigned_to,omitempty"`
     AssignedUser   *User         `gorm:"foreignKey:AssignedTo" json:"assigned_user,omitempty"`
     Resolution     string        `json:"resolution,omitempty"`
+    Latitude       *float64      `json:"latitude,omitempty"`
+    Longitude      *float64      `json:"longitude,omitempty"`
+    NearestRSU     string        `json:"nearest_rsu,omitempty"`
+    RSUDistanceM   *float64      `json:"rsu_distance_m,omitempty"`
+    RoadName       string        `json:"road_name,omitempty"`
+    RoadSegment    string        `json:"road_segment,omitempty"`
+    RoadDistanceM  *float64      `json:"road_distance_m,omitempty"`
+    Techniques     []string      `gorm:"serializer:json;type:jsonb" json:"techniques,omitempty"` // the rule's ATT&CK techniques when it fired
+    V2XThreats     []string      `gorm:"column:v2x_threats;serializer:json;type:jsonb" json:"v2x_threats,omitempty"` // the rule's V2X threats when it fired
+    LateEvaluated  bool          `gorm:"not null;default:false;index" json:"late_evaluated"` // raised by a catch-up evaluation after the event
+    EvaluatedAt    *time.Time    `json:"evaluated_at,omitempty"`                              // when a late evaluation raised it
+    IncidentID     *uint         `gorm:"index" json:"incident_id,omitempty"`                  // the incident grouping it
+    OrganizationID *uint         `gorm:"index" json:"organization_id,omitempty"`              // the tenant of its event
+    CorrelationID  string        `gorm:"index" json:"correlation_id,omitempty"`               // of its event
     CreatedAt      time.Time     `gorm:"autoCreateTime" json:"created_at"`
     UpdatedAt      time.Time     `gorm:"autoUpdateTime" json:"updated_at"`
 }
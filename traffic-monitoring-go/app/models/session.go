@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// UserSession is a login of a user: the access token issued for it, known by
+// its token ID, and whether it has been revoked before expiring
+type UserSession struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	TokenID      string     `gorm:"not null;unique" json:"-"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	Email        string     `json:"email"`
+	ClientIP     string     `json:"client_ip,omitempty"`
+	UserAgent    string     `json:"user_agent,omitempty"`
+	IssuedAt     time.Time  `gorm:"not null" json:"issued_at"`
+	ExpiresAt    time.Time  `gorm:"not null;index" json:"expires_at"`
+	RevokedAt    *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	RevokedBy    string     `json:"revoked_by,omitempty"`
+	RevokeReason string     `json:"revoke_reason,omitempty"`
+}
+
+// TableName returns the table name for UserSession
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
+
+// Active reports whether the session's token is still accepted at now
+func (s *UserSession) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
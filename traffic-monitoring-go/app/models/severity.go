@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// SeverityMapping translates one severity value used by a log source (e.g. a
+// syslog level "3" or a vendor's "warn") into a SIEM severity. Source values
+// are stored lowercase.
+type SeverityMapping struct {
+	ID          uint          `gorm:"primaryKey" json:"id"`
+	LogSourceID uint          `gorm:"not null;uniqueIndex:idx_severity_mappings_source_value" json:"log_source_id"`
+	SourceValue string        `gorm:"not null;uniqueIndex:idx_severity_mappings_source_value" json:"source_value"`
+	Severity    EventSeverity `gorm:"not null" json:"severity"`
+	CreatedAt   time.Time     `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time     `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for SeverityMapping
+func (SeverityMapping) TableName() string {
+	return "severity_mappings"
+}
+
+// ValidSeverity reports whether s is one of the SIEM severities
+func ValidSeverity(s EventSeverity) bool {
+	switch s {
+	case SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// V2XThreat is a category of the V2X threat taxonomy, the automotive
+// counterpart of ATT&CK techniques. Rules are tagged with threat codes, and
+// the anomalies of the listed types are evidence of the threat.
+type V2XThreat struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Code         string    `gorm:"not null;unique" json:"code"` // e.g. V2X-SPOOF
+	Name         string    `gorm:"not null" json:"name"`
+	Description  string    `json:"description"`
+	AnomalyTypes []string  `gorm:"serializer:json;type:jsonb" json:"anomaly_types"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for V2XThreat
+func (V2XThreat) TableName() string {
+	return "v2x_threats"
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// FieldMapping copies a value from a third-party field path to a SIEM schema path.
+// Paths use dots for nesting, e.g. "src.addr" -> "details.source_ip".
+type FieldMapping struct {
+	From       string            `json:"from"`
+	To         string            `json:"to"`
+	Default    string            `json:"default,omitempty"`
+	Values     map[string]string `json:"values,omitempty"`  // value translation, e.g. {"7": "info"}
+	Convert    string            `json:"convert,omitempty"` // string, number, unix, unix_ms
+	KeepSource bool              `json:"keep_source,omitempty"`
+}
+
+// TransformRule maps events from a third-party format onto the SIEM ingest schema.
+// A rule applies when SourceName matches the incoming source_name (empty matches
+// any source) and, if MatchField is set, that field equals MatchValue.
+type TransformRule struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Name        string         `gorm:"not null;unique" json:"name"`
+	Description string         `json:"description"`
+	SourceName  string         `gorm:"index" json:"source_name"`
+	MatchField  string         `json:"match_field,omitempty"`
+	MatchValue  string         `json:"match_value,omitempty"`
+	Mappings    []FieldMapping `gorm:"serializer:json" json:"mappings"`
+	Priority    int            `gorm:"not null;default:0" json:"priority"`
+	Enabled     bool           `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for TransformRule
+func (TransformRule) TableName() string {
+	return "transform_rules"
+}
@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// TrendPeriod is the length of the two windows a trend compares
+type TrendPeriod string
+
+const (
+	TrendPeriodWeek  TrendPeriod = "week"  // last 7 days against the 7 before
+	TrendPeriodMonth TrendPeriod = "month" // last 30 days against the 30 before
+)
+
+// TrendDimension is what a trend counts, broken down by key
+type TrendDimension string
+
+const (
+	TrendAlertVolume     TrendDimension = "alert_volume"     // alerts by severity
+	TrendAnomalyTypes    TrendDimension = "anomaly_types"    // alerts by rule
+	TrendEventCategories TrendDimension = "event_categories" // events by category
+	TrendMessageTypes    TrendDimension = "message_types"    // V2X messages by message type
+	TrendVehicleMessages TrendDimension = "vehicle_messages" // V2X messages by vehicle
+	TrendVehicleAlerts   TrendDimension = "vehicle_alerts"   // alerts on V2X events by vehicle
+	TrendV2XAnomalies    TrendDimension = "v2x_anomalies"    // V2X anomaly findings by anomaly type
+)
+
+// TrendRule raises a trend alert when a key of a dimension grows by at least
+// MinRatio from the previous window to the current one, e.g. the alerts of an
+// "Invalid Signature" rule doubling week over week
+type TrendRule struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Name        string         `gorm:"not null;uniqueIndex" json:"name"`
+	Description string         `json:"description"`
+	Dimension   TrendDimension `gorm:"type:VARCHAR(30);not null" json:"dimension"`
+	Key         string         `gorm:"not null" json:"key"` // a key of the dimension, or "all" for its total
+	Period      TrendPeriod    `gorm:"type:VARCHAR(10);not null" json:"period"`
+	MinRatio    float64        `gorm:"not null" json:"min_ratio"` // current / previous, e.g. 2 for "doubled"
+	MinCount    int64          `gorm:"not null" json:"min_count"` // current count below which the rule stays quiet
+	Severity    EventSeverity  `gorm:"not null" json:"severity"`
+	Enabled     bool           `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for TrendRule
+func (TrendRule) TableName() string {
+	return "trend_rules"
+}
+
+// TrendAlert records a trend rule firing
+type TrendAlert struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	TrendRuleID uint           `gorm:"not null;index" json:"trend_rule_id"`
+	RuleName    string         `json:"rule_name"`
+	Dimension   TrendDimension `json:"dimension"`
+	Key         string         `json:"key"`
+	Period      TrendPeriod    `json:"period"`
+	WindowStart time.Time      `json:"window_start"`
+	WindowEnd   time.Time      `gorm:"index" json:"window_end"`
+	Current     int64          `json:"current"`
+	Previous    int64          `json:"previous"`
+	Ratio       *float64       `json:"ratio,omitempty"` // nil when the previous window was empty
+	Severity    EventSeverity  `json:"severity"`
+	Message     string         `json:"message"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName returns the table name for TrendAlert
+func (TrendAlert) TableName() string {
+	return "trend_alerts"
+}
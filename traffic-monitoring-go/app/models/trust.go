@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// SourceTrust is the rolling trust score of a V2X source ID: 100 less the
+// penalties for what was held against it since WindowStart. Sources nothing
+// is held against have no row and a score of 100.
+type SourceTrust struct {
+	ID                 uint           `gorm:"primaryKey" json:"id"`
+	SourceID           string         `gorm:"not null;unique" json:"source_id"`
+	Score              float64        `gorm:"not null;index" json:"score"`
+	Anomalies          map[string]int `gorm:"serializer:json;type:jsonb" json:"anomalies"` // by anomaly type, revoked certificates included
+	InconsistentLinks  int            `gorm:"not null;default:0" json:"inconsistent_links"`
+	MisbehaviorReports int            `gorm:"not null;default:0" json:"misbehavior_reports"`
+	WindowStart        time.Time      `gorm:"not null" json:"window_start"`
+	UpdatedAt          time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for SourceTrust
+func (SourceTrust) TableName() string {
+	return "source_trust_scores"
+}
@@ -0,0 +1,330 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"traffic-monitoring-go/app/eventschema"
+)
+
+// Violation is one constraint an object breaks
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every constraint an object breaks, so an API client
+// can fix them all at once
+type ValidationError struct {
+	Violations []Violation `json:"violations"`
+}
+
+// Add records a violation on a field
+func (e *ValidationError) Add(field, format string, args ...interface{}) {
+	e.Violations = append(e.Violations, Violation{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns the error when there are violations, and nil otherwise
+func (e *ValidationError) Err() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Field + ": " + v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidCategory reports whether c is one of the event categories
+func ValidCategory(c EventCategory) bool {
+	switch c {
+	case CategoryAuthentication, CategoryAuthorization, CategoryNetwork, CategoryMalware,
+		CategorySystem, CategoryVehicle, CategoryV2X:
+		return true
+	}
+	return false
+}
+
+// ValidRuleStatus reports whether s is one of the rule statuses
+func ValidRuleStatus(s RuleStatus) bool {
+	switch s {
+	case RuleStatusEnabled, RuleStatusDisabled, RuleStatusTesting:
+		return true
+	}
+	return false
+}
+
+// validCoordinate reports whether lat and lon are within WGS84 ranges
+func validCoordinate(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// Validate checks the fields of a rule; the condition's syntax is checked by the rule engine
+func (r *Rule) Validate() *ValidationError {
+	errs := &ValidationError{}
+	if strings.TrimSpace(r.Name) == "" {
+		errs.Add("name", "is required")
+	}
+	if strings.TrimSpace(r.Condition) == "" {
+		errs.Add("condition", "is required")
+	}
+	if !ValidSeverity(r.Severity) {
+		errs.Add("severity", "must be one of critical, high, medium, low or info, got %q", r.Severity)
+	}
+	if !ValidCategory(r.Category) {
+		errs.Add("category", "must be one of authentication, authorization, network, malware, system, vehicle or v2x, got %q", r.Category)
+	}
+	if !ValidRuleStatus(r.Status) {
+		errs.Add("status", "must be one of enabled, disabled or testing, got %q", r.Status)
+	}
+	for i, category := range r.Scope.Categories {
+		if !ValidCategory(category) {
+			errs.Add(fmt.Sprintf("scope.categories[%d]", i), "unknown category %q", category)
+		}
+	}
+	return errs
+}
+
+// Validate checks a geofence's name, kind and the shape it describes
+func (g *Geofence) Validate() *ValidationError {
+	errs := &ValidationError{}
+	name := strings.TrimSpace(g.Name)
+	if name == "" {
+		errs.Add("name", "is required")
+	} else if strings.ContainsAny(name, " \t\n") {
+		errs.Add("name", "may not contain spaces, rule conditions refer to it")
+	}
+	if g.Kind != "" && g.Kind != GeofenceZone && g.Kind != GeofenceODD {
+		errs.Add("kind", "must be zone or odd, got %q", g.Kind)
+	}
+
+	switch g.Shape {
+	case GeofencePolygon:
+		vertices := len(g.Polygon)
+		if vertices > 3 && g.Polygon[0] == g.Polygon[vertices-1] {
+			vertices-- // a closing vertex repeating the first one is optional
+		}
+		if vertices < 3 {
+			errs.Add("polygon", "needs at least 3 vertices, got %d", vertices)
+		}
+		for i, p := range g.Polygon {
+			if !validCoordinate(p.Lat, p.Lon) {
+				errs.Add(fmt.Sprintf("polygon[%d]", i), "%g,%g is not a valid coordinate", p.Lat, p.Lon)
+			}
+		}
+	case GeofenceCircle:
+		if !validCoordinate(g.CenterLat, g.CenterLon) {
+			errs.Add("center_lat", "%g,%g is not a valid coordinate", g.CenterLat, g.CenterLon)
+		}
+		if g.RadiusM <= 0 {
+			errs.Add("radius_m", "must be greater than 0 for a circle")
+		}
+	default:
+		errs.Add("shape", "must be polygon or circle, got %q", g.Shape)
+	}
+	return errs
+}
+
+// Validate checks the fields of a security event submitted through the API,
+// including the coordinates carried in its details
+func (e *SecurityEvent) Validate() *ValidationError {
+	errs := &ValidationError{}
+	if e.Timestamp.IsZero() {
+		errs.Add("timestamp", "is required")
+	}
+	if strings.TrimSpace(e.Message) == "" {
+		errs.Add("message", "is required")
+	}
+	if !ValidSeverity(e.Severity) {
+		errs.Add("severity", "must be one of critical, high, medium, low or info, got %q", e.Severity)
+	}
+	if !ValidCategory(e.Category) {
+		errs.Add("category", "must be one of authentication, authorization, network, malware, system, vehicle or v2x, got %q", e.Category)
+	}
+	if p := e.SourcePort; p != nil && (*p < 0 || *p > 65535) {
+		errs.Add("source_port", "must be between 0 and 65535, got %d", *p)
+	}
+	if p := e.DestinationPort; p != nil && (*p < 0 || *p > 65535) {
+		errs.Add("destination_port", "must be between 0 and 65535, got %d", *p)
+	}
+
+	if e.RawData == "" {
+		return errs
+	}
+	var raw struct {
+		Details map[string]interface{} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(e.RawData), &raw); err != nil {
+		// raw data is free-form text unless it is a JSON object
+		if strings.HasPrefix(strings.TrimSpace(e.RawData), "{") {
+			errs.Add("raw_data", "is not valid JSON: %v", err)
+		}
+		return errs
+	}
+	if location, ok := raw.Details["location"].(string); ok {
+		parts := strings.Split(location, ",")
+		var lat, lon float64
+		var errLat, errLon error
+		if len(parts) == 2 {
+			lat, errLat = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+			lon, errLon = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		}
+		if len(parts) != 2 || errLat != nil || errLon != nil {
+			errs.Add("raw_data.details.location", "must be \"lat,lon\", got %q", location)
+		} else if !validCoordinate(lat, lon) {
+			errs.Add("raw_data.details.location", "%g,%g is not a valid coordinate", lat, lon)
+		}
+	}
+	lat, hasLat := raw.Details["latitude"].(float64)
+	lon, hasLon := raw.Details["longitude"].(float64)
+	if hasLat != hasLon {
+		errs.Add("raw_data.details", "latitude and longitude must be given together")
+	} else if hasLat && !validCoordinate(lat, lon) {
+		errs.Add("raw_data.details", "%g,%g is not a valid coordinate", lat, lon)
+	}
+	if speed, ok := raw.Details["speed"].(float64); ok && speed < 0 {
+		errs.Add("raw_data.details.speed", "must not be negative")
+	}
+	return errs
+}
+
+// Validate checks a retention policy's name, target and the data it expires
+func (p *RetentionPolicy) Validate() *ValidationError {
+	errs := &ValidationError{}
+	if strings.TrimSpace(p.Name) == "" {
+		errs.Add("name", "is required")
+	}
+	if p.MaxAgeDays < 1 {
+		errs.Add("max_age_days", "must be at least 1, got %d", p.MaxAgeDays)
+	}
+
+	switch p.Target {
+	case RetentionTargetEvents:
+		if p.Category != "" && !ValidCategory(p.Category) {
+			errs.Add("category", "must be empty for every category or one of authentication, authorization, network, malware, system, vehicle or v2x, got %q", p.Category)
+		}
+		if p.Action != RetentionDelete && p.Action != RetentionRollup {
+			errs.Add("action", "must be delete or rollup, got %q", p.Action)
+		}
+		if p.IndexFamily != "" {
+			errs.Add("index_family", "only applies to the index target")
+		}
+	case RetentionTargetIndex:
+		if strings.TrimSpace(p.IndexFamily) == "" {
+			errs.Add("index_family", "is required for the index target")
+		}
+		if p.Action != RetentionDelete {
+			errs.Add("action", "must be delete for the index target, got %q", p.Action)
+		}
+		if p.Category != "" {
+			errs.Add("category", "only applies to the events target")
+		}
+	default:
+		errs.Add("target", "must be events or index, got %q", p.Target)
+	}
+	return errs
+}
+
+// Validate checks a synthetic intersection's location, approaches and timing
+// plans, so the simulator only ever broadcasts a consistent controller
+func (i *SyntheticIntersection) Validate() *ValidationError {
+	errs := &ValidationError{}
+	if strings.TrimSpace(i.Name) == "" {
+		errs.Add("name", "is required")
+	}
+	if i.IntersectionID < 0 || i.IntersectionID > 65535 {
+		errs.Add("intersection_id", "must be between 0 and 65535, got %d", i.IntersectionID)
+	}
+	if !validCoordinate(i.Latitude, i.Longitude) {
+		errs.Add("latitude", "%g,%g is not a valid coordinate", i.Latitude, i.Longitude)
+	}
+
+	if len(i.Approaches) == 0 {
+		errs.Add("approaches", "needs at least one approach")
+	}
+	approachIDs := make(map[int]bool)
+	signalGroups := make(map[int]bool)
+	for n, approach := range i.Approaches {
+		field := fmt.Sprintf("approaches[%d]", n)
+		if approachIDs[approach.ID] {
+			errs.Add(field+".id", "duplicates approach %d", approach.ID)
+		}
+		approachIDs[approach.ID] = true
+		if approach.Heading < 0 || approach.Heading >= 360 {
+			errs.Add(field+".heading", "must be between 0 and 360 degrees, got %g", approach.Heading)
+		}
+		if approach.Lanes < 1 {
+			errs.Add(field+".lanes", "must be at least 1, got %d", approach.Lanes)
+		}
+		if approach.SignalGroup < 1 || approach.SignalGroup > 255 {
+			errs.Add(field+".signal_group", "must be between 1 and 255, got %d", approach.SignalGroup)
+		}
+		signalGroups[approach.SignalGroup] = true
+	}
+
+	if len(i.TimingPlans) == 0 {
+		errs.Add("timing_plans", "needs at least one timing plan")
+	}
+	fallbacks := 0
+	for n, plan := range i.TimingPlans {
+		field := fmt.Sprintf("timing_plans[%d]", n)
+		if strings.TrimSpace(plan.Name) == "" {
+			errs.Add(field+".name", "is required")
+		}
+		switch {
+		case plan.From == "" && plan.To == "":
+			fallbacks++
+			if fallbacks == 2 {
+				errs.Add(field, "only one plan may omit from and to")
+			}
+		case plan.From == "" || plan.To == "":
+			errs.Add(field, "from and to must be given together")
+		default:
+			for _, bound := range []struct{ name, value string }{{"from", plan.From}, {"to", plan.To}} {
+				if _, err := eventschema.ParseClock(bound.value); err != nil {
+					errs.Add(field+"."+bound.name, "%v", err)
+				}
+			}
+		}
+		if plan.CycleSeconds < 1 {
+			errs.Add(field+".cycle_seconds", "must be at least 1, got %d", plan.CycleSeconds)
+		}
+		if len(plan.Phases) == 0 {
+			errs.Add(field+".phases", "needs at least one phase")
+		}
+
+		timed := make(map[int]bool)
+		for p, phase := range plan.Phases {
+			phaseField := fmt.Sprintf("%s.phases[%d]", field, p)
+			if !signalGroups[phase.SignalGroup] {
+				errs.Add(phaseField+".signal_group", "%d controls no approach", phase.SignalGroup)
+			}
+			if timed[phase.SignalGroup] {
+				errs.Add(phaseField+".signal_group", "%d is timed twice", phase.SignalGroup)
+			}
+			timed[phase.SignalGroup] = true
+			if phase.GreenSeconds < 1 {
+				errs.Add(phaseField+".green_seconds", "must be at least 1, got %d", phase.GreenSeconds)
+			}
+			if phase.YellowSeconds < 0 {
+				errs.Add(phaseField+".yellow_seconds", "must not be negative, got %d", phase.YellowSeconds)
+			}
+			if plan.CycleSeconds >= 1 {
+				if phase.StartSeconds < 0 || phase.StartSeconds >= plan.CycleSeconds {
+					errs.Add(phaseField+".start_seconds", "must be within the %d s cycle, got %d", plan.CycleSeconds, phase.StartSeconds)
+				}
+				if phase.GreenSeconds+phase.YellowSeconds > plan.CycleSeconds {
+					errs.Add(phaseField, "green and yellow last longer than the %d s cycle", plan.CycleSeconds)
+				}
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,96 @@
+package models
+
+import "time"
+
+// RadioProtocol is the V2X access technology a message was received over
+type RadioProtocol string
+
+const (
+	RadioDSRC RadioProtocol = "dsrc" // IEEE 802.11p / WAVE
+	RadioCV2X RadioProtocol = "cv2x" // LTE/NR sidelink (PC5)
+)
+
+// VehicleLink records that a DSRC and a C-V2X source ID belong to the same
+// physical vehicle, inferred from matching trajectories. Inconsistent samples
+// are matched reports whose position or speed disagree across the two radios.
+type VehicleLink struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	DSRCID              string     `gorm:"not null;uniqueIndex:idx_vehicle_links_pair" json:"dsrc_id"`
+	CV2XID              string     `gorm:"not null;uniqueIndex:idx_vehicle_links_pair;index" json:"cv2x_id"`
+	MatchedSamples      int        `json:"matched_samples"`
+	MedianDistanceM     float64    `json:"median_distance_m"`
+	InconsistentSamples int        `json:"inconsistent_samples"`
+	Inconsistent        bool       `gorm:"not null;default:false;index" json:"inconsistent"`
+	InconsistencyReason string     `json:"inconsistency_reason,omitempty"`
+	LastInconsistentAt  *time.Time `json:"last_inconsistent_at,omitempty"`
+	FirstSeen           time.Time  `json:"first_seen"`
+	LastSeen            time.Time  `gorm:"index" json:"last_seen"`
+	CreatedAt           time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for VehicleLink
+func (VehicleLink) TableName() string {
+	return "vehicle_links"
+}
+
+// VehicleIdentifierKind is what a vehicle identifier is
+type VehicleIdentifierKind string
+
+const (
+	IdentifierTemporaryID VehicleIdentifierKind = "temporary_id" // source ID of the messages, rotated for privacy
+	IdentifierCertificate VehicleIdentifierKind = "certificate"  // hashed ID of the signing pseudonym certificate
+)
+
+// How an identifier was attributed to its registered vehicle
+const (
+	LinkedByFirstSight  = "first_sight"  // no known identifier matched; the vehicle was registered with it
+	LinkedByCertificate = "certificate"  // messages under it were signed by a certificate of the vehicle
+	LinkedByTemporaryID = "temporary_id" // a certificate seen in messages of a temporary ID of the vehicle
+	LinkedByRadioLink   = "radio_link"   // linked to a source ID of the vehicle on the other radio
+	LinkedByRotation    = "rotation"     // appeared where and shortly after an ID of the vehicle went silent
+)
+
+// RegisteredVehicle is a persistent pseudonymous vehicle, the identity the
+// vehicle registry resolves rotating temporary IDs and certificates to
+type RegisteredVehicle struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	Pseudonym      string     `gorm:"not null;unique" json:"pseudonym"`
+	FirstSeen      time.Time  `gorm:"not null" json:"first_seen"`
+	LastSeen       time.Time  `gorm:"not null;index" json:"last_seen"`
+	LastLatitude   *float64   `json:"last_latitude,omitempty"`
+	LastLongitude  *float64   `json:"last_longitude,omitempty"`
+	TrustScore     float64    `gorm:"not null;default:100;index" json:"trust_score"` // 0 to 100, see siem.Trust
+	TrustUpdatedAt *time.Time `json:"trust_updated_at,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	Identifiers []VehicleIdentifier `gorm:"foreignKey:VehicleID" json:"identifiers,omitempty"`
+}
+
+// TableName returns the table name for RegisteredVehicle
+func (RegisteredVehicle) TableName() string {
+	return "registered_vehicles"
+}
+
+// VehicleIdentifier is a temporary ID or certificate a registered vehicle was
+// seen with. Each identifier belongs to one vehicle.
+type VehicleIdentifier struct {
+	ID            uint                  `gorm:"primaryKey" json:"id"`
+	VehicleID     uint                  `gorm:"not null;index" json:"vehicle_id"`
+	Kind          VehicleIdentifierKind `gorm:"not null;uniqueIndex:idx_vehicle_identifiers_value" json:"kind"`
+	Value         string                `gorm:"not null;uniqueIndex:idx_vehicle_identifiers_value" json:"value"`
+	Radio         RadioProtocol         `json:"radio,omitempty"`
+	LinkedBy      string                `gorm:"not null" json:"linked_by"`
+	FirstSeen     time.Time             `gorm:"not null" json:"first_seen"`
+	LastSeen      time.Time             `gorm:"not null;index" json:"last_seen"`
+	LastLatitude  *float64              `json:"last_latitude,omitempty"`
+	LastLongitude *float64              `json:"last_longitude,omitempty"`
+	CreatedAt     time.Time             `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time             `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for VehicleIdentifier
+func (VehicleIdentifier) TableName() string {
+	return "vehicle_identifiers"
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// VendorPattern turns the syslog lines a roadside unit vendor emits for
+// received V2X messages into v2x events. Pattern is grok-style: each
+// %{SYNTAX:field} or %{SYNTAX:field:int|float} capture becomes an event detail,
+// e.g. "RX %{WORD:message_type} from %{HEX:vehicle_id} rssi=%{INT:rssi:int}".
+// The timestamp, severity and message captures replace the event's own fields.
+type VendorPattern struct {
+	ID          uint          `gorm:"primaryKey" json:"id"`
+	Name        string        `gorm:"not null;unique" json:"name"`
+	Vendor      string        `gorm:"not null;index" json:"vendor"` // log source name of the parsed events
+	Description string        `json:"description"`
+	SourceName  string        `json:"source_name,omitempty"` // incoming source_name the pattern applies to; empty applies to any
+	Pattern     string        `gorm:"not null" json:"pattern"`
+	Radio       string        `json:"radio,omitempty"` // radio reported when the line does not capture one
+	Severity    EventSeverity `json:"severity,omitempty"`
+	Priority    int           `gorm:"not null;default:0" json:"priority"`
+	Enabled     bool          `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt   time.Time     `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time     `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for VendorPattern
+func (VendorPattern) TableName() string {
+	return "vendor_patterns"
+}
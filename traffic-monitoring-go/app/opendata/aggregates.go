@@ -0,0 +1,200 @@
+package opendata
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+)
+
+var (
+	openDataEpsilon  = config.NewFloat("OPENDATA_EPSILON", 1, "Differential privacy budget per released count of the open data exports", config.Positive)
+	openDataK        = config.NewInt("OPENDATA_K_THRESHOLD", 10, "Records an open data bucket needs to be released", config.Min(1))
+	openDataMaxCount = config.NewInt("OPENDATA_MAX_VEHICLE_COUNT", 100, "Vehicles one traffic measurement may add to an open data count; larger counts are clamped", config.Min(1))
+)
+
+// PrivacyConfig controls the protection applied to exported aggregates.
+// Epsilon is the differential privacy budget per released count (smaller is
+// more private) and KThreshold suppresses buckets with fewer records, as
+// counted with noise. A record adds CountSensitivity to a message count and
+// at most MaxVehicleCount to a vehicle count; vehicle counts and speeds are
+// clamped to MaxVehicleCount and MaxSpeed before they are aggregated.
+type PrivacyConfig struct {
+	Epsilon          float64 `json:"epsilon"`
+	KThreshold       int     `json:"k_threshold"`
+	CountSensitivity float64 `json:"count_sensitivity"`
+	MaxVehicleCount  float64 `json:"max_vehicle_count"`
+	MaxSpeed         float64 `json:"max_speed"`
+}
+
+// Bucket is one released aggregate
+type Bucket struct {
+	PeriodStart time.Time `json:"period_start"`
+	Key         string    `json:"key"`
+	Count       int64     `json:"count"`
+	AvgSpeed    *float64  `json:"avg_speed,omitempty"`
+}
+
+// Export is the result of an aggregate export
+type Export struct {
+	Dataset    string        `json:"dataset"`
+	From       time.Time     `json:"from"`
+	To         time.Time     `json:"to"`
+	Interval   string        `json:"interval"`
+	Privacy    PrivacyConfig `json:"privacy"`
+	Buckets    []Bucket      `json:"buckets"`
+	Suppressed int           `json:"suppressed"`
+}
+
+// rawBucket is an aggregate row before privacy protection
+type rawBucket struct {
+	PeriodStart time.Time
+	Key         string
+	Records     int64
+	Total       float64
+	AvgSpeed    *float64
+}
+
+// validIntervals are the date_trunc units exports may be grouped by
+var validIntervals = map[string]bool{"hour": true, "day": true, "week": true, "month": true}
+
+// DefaultPrivacyConfig reads the privacy floor from the environment
+func DefaultPrivacyConfig() PrivacyConfig {
+	return PrivacyConfig{
+		Epsilon:          openDataEpsilon.Get(),
+		KThreshold:       openDataK.Get(),
+		CountSensitivity: 1,
+		MaxVehicleCount:  float64(openDataMaxCount.Get()),
+		MaxSpeed:         200,
+	}
+}
+
+// Tighten applies caller-requested parameters, which may only make the export more private
+func (p PrivacyConfig) Tighten(epsilon float64, k int) PrivacyConfig {
+	if epsilon > 0 && epsilon < p.Epsilon {
+		p.Epsilon = epsilon
+	}
+	if k > p.KThreshold {
+		p.KThreshold = k
+	}
+	return p
+}
+
+// TrafficFlow exports vehicle counts and average speeds per station and interval
+func TrafficFlow(db *gorm.DB, from, to time.Time, interval string, privacy PrivacyConfig) (*Export, error) {
+	if !validIntervals[interval] {
+		return nil, fmt.Errorf("invalid interval %q, use hour, day, week or month", interval)
+	}
+
+	// clamped so that one measurement moves a sum by at most the bound the noise is scaled to
+	var rows []rawBucket
+	err := db.Table("traffic_measurements").
+		Select(fmt.Sprintf(`date_trunc('%s', traffic_measurements.timestamp) AS period_start,
+			stations.code AS key,
+			COUNT(*) AS records,
+			COALESCE(SUM(LEAST(GREATEST(traffic_measurements.vehicle_count, 0), ?)), 0) AS total,
+			AVG(CASE WHEN traffic_measurements.speed IS NOT NULL THEN LEAST(GREATEST(traffic_measurements.speed, 0), ?) END) AS avg_speed`, interval),
+			privacy.MaxVehicleCount, privacy.MaxSpeed).
+		Joins("JOIN sensors ON sensors.id = traffic_measurements.sensor_id").
+		Joins("JOIN stations ON stations.id = sensors.station_id").
+		Where("traffic_measurements.timestamp BETWEEN ? AND ?", from, to).
+		Group("period_start, stations.code").
+		Order("period_start, stations.code").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return protect("traffic_flow", from, to, interval, rows, privacy, privacy.MaxVehicleCount), nil
+}
+
+// MessageCounts exports V2X and vehicle message counts per message type and interval
+func MessageCounts(db *gorm.DB, from, to time.Time, interval string, privacy PrivacyConfig) (*Export, error) {
+	if !validIntervals[interval] {
+		return nil, fmt.Errorf("invalid interval %q, use hour, day, week or month", interval)
+	}
+
+	// message_type lives in the raw event; guard the cast for non-JSON payloads
+	messageType := `COALESCE(
+		CASE WHEN raw_data ~ '^\s*\{' THEN COALESCE(raw_data::jsonb->'details'->>'message_type', raw_data::jsonb->>'message_type') END,
+		category)`
+
+	var rows []rawBucket
+	err := db.Table("security_events").
+		Select(fmt.Sprintf(`date_trunc('%s', timestamp) AS period_start,
+			%s AS key,
+			COUNT(*) AS records,
+			COUNT(*) AS total`, interval, messageType)).
+		Where("category IN ?", []string{"v2x", "vehicle"}).
+		Where("timestamp BETWEEN ? AND ?", from, to).
+		Group("period_start, key").
+		Order("period_start, key").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return protect("message_counts", from, to, interval, rows, privacy, privacy.CountSensitivity), nil
+}
+
+// protect suppresses small buckets and adds Laplace noise to the released
+// values; sensitivity is the most one record can add to a bucket's total.
+// Buckets are suppressed on a noisy count of their records, as suppressing on
+// the exact count would tell whether a record was there.
+func protect(dataset string, from, to time.Time, interval string, rows []rawBucket, privacy PrivacyConfig, sensitivity float64) *Export {
+	export := &Export{
+		Dataset:  dataset,
+		From:     from,
+		To:       to,
+		Interval: interval,
+		Privacy:  privacy,
+		Buckets:  make([]Bucket, 0, len(rows)),
+	}
+
+	for _, row := range rows {
+		if float64(row.Records)+laplace(1/privacy.Epsilon) < float64(privacy.KThreshold) {
+			export.Suppressed++
+			continue
+		}
+
+		noisy := row.Total + laplace(sensitivity/privacy.Epsilon)
+		bucket := Bucket{
+			PeriodStart: row.PeriodStart,
+			Key:         row.Key,
+			Count:       int64(math.Max(0, math.Round(noisy))),
+		}
+
+		if row.AvgSpeed != nil {
+			// one record can move the mean by at most MaxSpeed/n
+			speed := *row.AvgSpeed + laplace(privacy.MaxSpeed/(float64(row.Records)*privacy.Epsilon))
+			speed = math.Round(math.Max(0, speed)*10) / 10
+			bucket.AvgSpeed = &speed
+		}
+
+		export.Buckets = append(export.Buckets, bucket)
+	}
+
+	return export
+}
+
+// laplace draws from a zero-centred Laplace distribution with the given scale
+func laplace(scale float64) float64 {
+	u := uniform() - 0.5
+	if u == 0 {
+		return 0
+	}
+	return -scale * math.Copysign(1, u) * math.Log(1-2*math.Abs(u))
+}
+
+// uniform returns a cryptographically random float in [0, 1)
+func uniform() float64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("opendata: failed to read random bytes: %v", err))
+	}
+	return float64(binary.BigEndian.Uint64(b[:])>>11) / (1 << 53)
+}
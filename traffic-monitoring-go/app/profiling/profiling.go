@@ -0,0 +1,235 @@
+// Package profiling captures heap and goroutine profiles to disk when the
+// process crosses configured thresholds, so a leak or a pile-up of blocked
+// goroutines in a collector or the rule engine leaves evidence behind even
+// when nobody was watching /debug/pprof at the time.
+package profiling
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+)
+
+var (
+	profileDir                = config.NewString("PROFILE_DIR", "profiles", "Directory captured profiles are written to")
+	profileCheckSeconds       = config.NewInt("PROFILE_CHECK_SECONDS", 30, "Seconds between checks of the profile thresholds", config.Min(1))
+	profileCooldownMinutes    = config.NewInt("PROFILE_COOLDOWN_MINUTES", 15, "Minutes between automatic profile captures", config.Min(0))
+	profileGoroutineThreshold = config.NewInt("PROFILE_GOROUTINE_THRESHOLD", 0, "Goroutines that trigger a profile capture; 0 disables", config.Min(0))
+	profileHeapThresholdMB    = config.NewInt("PROFILE_HEAP_THRESHOLD_MB", 0, "Heap megabytes that trigger a profile capture; 0 disables", config.Min(0))
+	profileKeep               = config.NewInt("PROFILE_KEEP", 20, "Profile captures kept on disk", config.Min(1))
+)
+
+// Profile is a profile file captured to disk
+type Profile struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"` // heap or goroutine
+	Reason    string    `json:"reason"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Capturer writes profiles to Dir, automatically when a threshold is crossed
+// (at most once per Cooldown) or on request
+type Capturer struct {
+	Dir                string
+	Interval           time.Duration
+	Cooldown           time.Duration
+	GoroutineThreshold int    // 0 disables the goroutine trigger
+	HeapThresholdBytes uint64 // 0 disables the heap trigger
+	Keep               int    // captures kept; older ones are deleted
+
+	mutex       sync.Mutex
+	lastCapture time.Time
+}
+
+// NewCapturerFromEnv configures a capturer from PROFILE_DIR (default
+// profiles), PROFILE_CHECK_SECONDS (default 30), PROFILE_COOLDOWN_MINUTES
+// (default 15), PROFILE_GOROUTINE_THRESHOLD, PROFILE_HEAP_THRESHOLD_MB and
+// PROFILE_KEEP (default 20)
+func NewCapturerFromEnv() *Capturer {
+	return &Capturer{
+		Dir:                profileDir.Get(),
+		Interval:           time.Duration(profileCheckSeconds.Get()) * time.Second,
+		Cooldown:           time.Duration(profileCooldownMinutes.Get()) * time.Minute,
+		GoroutineThreshold: profileGoroutineThreshold.Get(),
+		HeapThresholdBytes: uint64(profileHeapThresholdMB.Get()) << 20,
+		Keep:               profileKeep.Get(),
+	}
+}
+
+// Capture writes a heap and a goroutine profile named after the reason and
+// returns them
+func (c *Capturer) Capture(reason string) ([]Profile, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := os.MkdirAll(c.Dir, 0o750); err != nil {
+		return nil, err
+	}
+	c.lastCapture = time.Now()
+	stamp := c.lastCapture.UTC().Format("20060102T150405Z")
+
+	var profiles []Profile
+	for _, kind := range []string{"heap", "goroutine"} {
+		name := fmt.Sprintf("%s-%s-%s.pprof", stamp, sanitizeReason(reason), kind)
+		path := filepath.Join(c.Dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			return profiles, err
+		}
+		if kind == "heap" {
+			runtime.GC() // report live objects as of now
+		}
+		err = pprof.Lookup(kind).WriteTo(f, 0)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return profiles, err
+		}
+		if profile, ok := parseProfile(c.Dir, name); ok {
+			profiles = append(profiles, profile)
+		}
+	}
+
+	c.prune()
+	return profiles, nil
+}
+
+// List returns the captured profiles, newest first
+func (c *Capturer) List() ([]Profile, error) {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Profile{}, nil
+		}
+		return nil, err
+	}
+
+	profiles := []Profile{}
+	for _, entry := range entries {
+		if profile, ok := parseProfile(c.Dir, entry.Name()); ok {
+			profiles = append(profiles, profile)
+		}
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name > profiles[j].Name })
+	return profiles, nil
+}
+
+// Path returns the file of a captured profile, or false when no such profile exists
+func (c *Capturer) Path(name string) (string, bool) {
+	if name != filepath.Base(name) {
+		return "", false
+	}
+	if _, ok := parseProfile(c.Dir, name); !ok {
+		return "", false
+	}
+	return filepath.Join(c.Dir, name), true
+}
+
+// prune deletes the oldest captures beyond Keep; a capture is a heap and a goroutine profile
+func (c *Capturer) prune() {
+	profiles, err := c.List()
+	if err != nil {
+		return
+	}
+	for i := 2 * c.Keep; i < len(profiles); i++ {
+		os.Remove(filepath.Join(c.Dir, profiles[i].Name))
+	}
+}
+
+// check captures profiles when a threshold is crossed outside the cooldown
+func (c *Capturer) check() {
+	c.mutex.Lock()
+	cooling := !c.lastCapture.IsZero() && time.Since(c.lastCapture) < c.Cooldown
+	c.mutex.Unlock()
+	if cooling {
+		return
+	}
+
+	var reason string
+	if goroutines := runtime.NumGoroutine(); c.GoroutineThreshold > 0 && goroutines >= c.GoroutineThreshold {
+		reason = fmt.Sprintf("goroutines-%d", goroutines)
+	} else if c.HeapThresholdBytes > 0 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc >= c.HeapThresholdBytes {
+			reason = fmt.Sprintf("heap-%dmb", stats.HeapAlloc>>20)
+		}
+	}
+	if reason == "" {
+		return
+	}
+
+	profiles, err := c.Capture(reason)
+	if err != nil {
+		log.Printf("Error capturing profiles (%s): %v", reason, err)
+		return
+	}
+	log.Printf("Captured %d profiles to %s (%s)", len(profiles), c.Dir, reason)
+}
+
+// Start checks the thresholds in the background; it does nothing when no threshold is set
+func (c *Capturer) Start() {
+	if c.GoroutineThreshold == 0 && c.HeapThresholdBytes == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(c.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			c.check()
+		}
+	}()
+	log.Printf("Profile capture started: goroutines >= %d, heap >= %d MB, into %s", c.GoroutineThreshold, c.HeapThresholdBytes>>20, c.Dir)
+}
+
+// parseProfile describes a capture file from its name, <stamp>-<reason>-<kind>.pprof
+func parseProfile(dir, name string) (Profile, bool) {
+	base := strings.TrimSuffix(name, ".pprof")
+	if base == name {
+		return Profile{}, false
+	}
+	first, last := strings.Index(base, "-"), strings.LastIndex(base, "-")
+	if first < 0 || first == last {
+		return Profile{}, false
+	}
+	kind := base[last+1:]
+	if kind != "heap" && kind != "goroutine" {
+		return Profile{}, false
+	}
+	createdAt, err := time.Parse("20060102T150405Z", base[:first])
+	if err != nil {
+		return Profile{}, false
+	}
+	info, err := os.Stat(filepath.Join(dir, name))
+	if err != nil || !info.Mode().IsRegular() {
+		return Profile{}, false
+	}
+	return Profile{Name: name, Kind: kind, Reason: base[first+1 : last], Size: info.Size(), CreatedAt: createdAt}, true
+}
+
+// sanitizeReason keeps a reason usable in a file name
+func sanitizeReason(reason string) string {
+	reason = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, reason)
+	if reason == "" {
+		return "manual"
+	}
+	return reason
+}
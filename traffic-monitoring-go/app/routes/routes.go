@@ -2,14 +2,52 @@ package routes
 
 import (
 	"net/http"
+	"time"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
 	"traffic-monitoring-go/app/handlers"
+	"traffic-monitoring-go/app/maptiles"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
 	"traffic-monitoring-go/app/siem/elasticsearch"
+	"traffic-monitoring-go/app/startup"
+	"traffic-monitoring-go/app/webui"
 )
 
 // RegisterRoutes sets up all the API endpoints and binds them to their handlers.
 func RegisterRoutes(router *gin.Engine, db *gorm.DB, esService *elasticsearch.Service) {
+	// Every request gets a request ID and a correlation ID for its log records
+	router.Use(middleware.RequestID())
+
+	// Every route except login, health checks and the console assets needs a caller
+	router.Use(middleware.Authenticate(db))
+
+	// Callers acting for an organization only reach the routes scoped by tenant
+	router.Use(middleware.TenantRoutes(
+		"/auth/me", "/auth/logout", "/auth/sessions",
+		"/security-events/", "/security-events/:id", "/security-events/batch",
+		"/alerts/", "/alerts/:id", "/alerts/:id/notify",
+		"/rules/", "/rules/:id",
+		"/ingest/", "/ingest/batch",
+		"/graphql", "/graphql/schema",
+	))
+
+	// Access policies: viewers read, analysts also work alerts and events,
+	// admins also manage rules, sources, users and configuration
+	analystWrites := middleware.WriteAccess(models.AdminRole, models.AnalystRole)
+	adminWrites := middleware.WriteAccess(models.AdminRole)
+	ingestWrites := middleware.WriteAccess(models.AdminRole, models.AnalystRole, middleware.IngestRole)
+	adminOnly := middleware.RequireRole(models.AdminRole)
+
+	// Ingestion is held to the rate limit of each log source API key
+	ingestKeys := middleware.IngestAPIKeys()
+
+	// Expensive reads polled by dashboards and map layers are served from memory
+	// until the tables behind them change
+	dashboardCache := middleware.Cached(5*time.Second, "security_events", "alerts", "rules", "log_sources")
+	geoCache := middleware.Cached(0, "rsus", "road_segments")
+
 	// Create handler instances.
 	stationHandler := handlers.NewStationHandler(db)
 	sensorHandler := handlers.NewSensorHandler(db)
@@ -21,7 +59,7 @@ func RegisterRoutes(router *gin.Engine, db *gorm.DB, esService *elasticsearch.Se
 	// Create handler instances for SIEM funcitonality
 	securityEventHandler := handlers.NewSecurityEventHandler(db, esService)
 	alertHandler := handlers.NewAlertHandler(db, esService)
-	ruleHandler := handlers.NewRuleHandler(db)
+	ruleHandler := handlers.NewRuleHandler(db, esService)
 	logSourceHandler := handlers.NewLogSourceHandler(db)
 
 
@@ -32,10 +70,147 @@ func RegisterRoutes(router *gin.Engine, db *gorm.DB, esService *elasticsearch.Se
 	// create a dashboard handler
 	dashboardHandler := handlers.NewDashboardHandler(db, esService)
 
+	// Create threat hunting handler
+	huntHandler := handlers.NewHuntHandler(db)
+
+	// Create ingest transform rule handler
+	transformRuleHandler := handlers.NewTransformRuleHandler(db)
+
+	// Create RSU vendor syslog pattern handler
+	vendorPatternHandler := handlers.NewVendorPatternHandler(db)
+
+	// Create V2X PKI certificate revocation list handler
+	crlHandler := handlers.NewCRLHandler(db)
+
+	// Create V2X misbehavior report handler
+	misbehaviorHandler := handlers.NewMisbehaviorHandler(db)
+
+	// Create fleet operator notification handler
+	oemHandler := handlers.NewOEMHandler(db)
+
+	// Create regulatory report handler
+	regulatoryHandler := handlers.NewRegulatoryHandler(db)
+
+	// Create summary report handler
+	reportHandler := handlers.NewReportHandler(db)
+
+	// Create V2X anomaly detector configuration handler
+	anomalyDetectorHandler := handlers.NewAnomalyDetectorHandler(db)
+
+	// Create map tile proxy handler
+	tileHandler := handlers.NewTileHandler(maptiles.NewProxyFromEnv())
+
+	// Create open data export handler
+	openDataHandler := handlers.NewOpenDataHandler(db)
+
+	// Create pipeline cost accounting handler
+	costHandler := handlers.NewCostHandler()
+
+	// Create V2X KPI handler
+	kpiHandler := handlers.NewKPIHandler(db)
+
+	// Create example payload catalog handler
+	exampleHandler := handlers.NewExampleHandler()
+
+	// Create RSU registry and road network handler
+	geoHandler := handlers.NewGeoHandler(db)
+
+	// Create geofence handler
+	geofenceHandler := handlers.NewGeofenceHandler(db)
+
+	// Create alert change stream handler
+	alertChangeHandler := handlers.NewAlertChangeHandler(db)
+
+	// Create source mute handler
+	muteHandler := handlers.NewMuteHandler(db)
+
+	// Create event routing handler
+	routingHandler := handlers.NewRoutingHandler(db)
+
+	// Create NGSI-LD export handler
+	ngsildHandler := handlers.NewNGSILDHandler(db)
+
+	// Create incident forensics handler
+	forensicsHandler := handlers.NewForensicsHandler(db)
+
+	// Create incident (alert case) handler
+	incidentHandler := handlers.NewIncidentHandler(db)
+
+	// Create response action handler
+	responseHandler := handlers.NewResponseHandler(db)
+
+	// Create V2X message export handler
+	v2xExportHandler := handlers.NewV2XExportHandler(db)
+
+	// Create synthetic intersection scenario handler
+	intersectionHandler := handlers.NewIntersectionHandler(db)
+
+	// Create multi-radio vehicle handler
+	vehicleHandler := handlers.NewVehicleHandler(db)
+
+	// Create registered vehicle handler
+	vehicleRegistryHandler := handlers.NewVehicleRegistryHandler(db)
+
+	// Create V2X source trust score handler
+	trustHandler := handlers.NewTrustHandler(db)
+
+	// Create GraphQL handler
+	graphqlHandler := handlers.NewGraphQLHandler(db)
+
+	// Create DENM reaction verification handler
+	denmHandler := handlers.NewDENMHandler(db)
+
+	// Create live statistics stream and live map handler
+	liveHandler := handlers.NewLiveHandler()
+
+	// Create dashboard layout handler
+	layoutHandler := handlers.NewLayoutHandler(db)
+
+	// Create configuration export/import handler
+	configBundleHandler := handlers.NewConfigBundleHandler(db)
+
+	// Create runtime configuration handler
+	configHandler := handlers.NewConfigHandler()
+
+	// Create runtime log level handler
+	logLevelHandler := handlers.NewLogLevelHandler()
+
+	// Create trend analytics handler
+	trendHandler := handlers.NewTrendHandler(db)
+
+	// Create ATT&CK coverage handler
+	attackHandler := handlers.NewAttackHandler(db)
+
+	// Create V2X threat taxonomy handler
+	v2xThreatHandler := handlers.NewV2XThreatHandler(db)
+
+	// Create authentication and user management handlers
+	authHandler := handlers.NewAuthHandler(db)
+	userHandler := handlers.NewUserHandler(db)
+	sessionHandler := handlers.NewSessionHandler(db)
+
+	// Create organization handler
+	organizationHandler := handlers.NewOrganizationHandler(db)
+
+	// Create Elasticsearch admin handler
+	esAdminHandler := handlers.NewESAdminHandler(esService)
+
+	// Create runtime profiling handler
+	profilingHandler := handlers.NewProfilingHandler()
+
+	// Create Prometheus metrics handler
+	metricsHandler := handlers.NewMetricsHandler()
+
+	// Create parse error statistics handler
+	parseErrorHandler := handlers.NewParseErrorHandler(db)
+
+	// Create retention policy handler
+	retentionHandler := handlers.NewRetentionHandler(db, esService)
+
 
 
 	// Station routes.
-	stationRoutes := router.Group("/stations")
+	stationRoutes := router.Group("/stations", analystWrites)
 	{
 		stationRoutes.GET("/", stationHandler.GetStations)
 		stationRoutes.POST("/", stationHandler.CreateStation)
@@ -46,7 +221,7 @@ func RegisterRoutes(router *gin.Engine, db *gorm.DB, esService *elasticsearch.Se
 	}
 
 	// Sensor routes.
-	sensorRoutes := router.Group("/sensors")
+	sensorRoutes := router.Group("/sensors", analystWrites)
 	{
 		sensorRoutes.GET("/", sensorHandler.GetSensors)
 		sensorRoutes.POST("/", sensorHandler.CreateSensor)
@@ -56,7 +231,7 @@ func RegisterRoutes(router *gin.Engine, db *gorm.DB, esService *elasticsearch.Se
 	}
 
 	// Measurement routes.
-	measurementRoutes := router.Group("/measurements")
+	measurementRoutes := router.Group("/measurements", analystWrites)
 	{
 		measurementRoutes.GET("/", measurementHandler.GetMeasurements)
 		measurementRoutes.POST("/", measurementHandler.CreateMeasurement)
@@ -65,7 +240,7 @@ func RegisterRoutes(router *gin.Engine, db *gorm.DB, esService *elasticsearch.Se
 	}
 
 	// Event routes.
-	eventRoutes := router.Group("/events")
+	eventRoutes := router.Group("/events", analystWrites)
 	{
 		eventRoutes.GET("/", eventHandler.GetEvents)
 		eventRoutes.POST("/", eventHandler.CreateEvent)
@@ -75,69 +250,121 @@ func RegisterRoutes(router *gin.Engine, db *gorm.DB, esService *elasticsearch.Se
 	}
 
 	// Security event routes
-	securityEventRoutes := router.Group("/security-events")
+	securityEventRoutes := router.Group("/security-events", analystWrites)
 	{
 		securityEventRoutes.GET("/", securityEventHandler.GetSecurityEvents)
 		securityEventRoutes.POST("/", securityEventHandler.CreateSecurityEvent)
+		securityEventRoutes.GET("/density", securityEventHandler.GetEventDensity)
 		securityEventRoutes.GET("/:id", securityEventHandler.GetSecurityEvent)
 		securityEventRoutes.POST("/batch", securityEventHandler.CreateBatchSecurityEvents)
 	}
 
 
 	// Alert routes
-	alertRoutes := router.Group("/alerts")
+	alertRoutes := router.Group("/alerts", analystWrites)
 	{
 		alertRoutes.GET("/", alertHandler.GetAlerts)
 		alertRoutes.GET("/:id", alertHandler.GetAlert)
 		alertRoutes.PUT("/:id", alertHandler.UpdateAlert)
 		alertRoutes.POST("/:id/notify", alertHandler.SendNotification)
 		alertRoutes.GET("/channels", alertHandler.GetNotificationChannels)
+		alertRoutes.GET("/changes", alertChangeHandler.GetAlertChanges)
+		alertRoutes.GET("/changes/status", alertChangeHandler.GetAlertChangeStatus)
+		alertRoutes.GET("/reviews", alertHandler.GetReviewQueue)
+		alertRoutes.GET("/:id/reviews", alertHandler.GetAlertReviews)
+		alertRoutes.POST("/:id/reviews/approve", alertHandler.ApproveAlertReview)
+		alertRoutes.POST("/:id/reviews/reject", alertHandler.RejectAlertReview)
 	}
 
 	// Rule routes
-	ruleRoutes := router.Group("/rules")
+	ruleRoutes := router.Group("/rules", adminWrites)
 	{
 		ruleRoutes.GET("/", ruleHandler.GetRules)
 		ruleRoutes.POST("/", ruleHandler.CreateRule)
+		ruleRoutes.GET("/stats", ruleHandler.GetRuleEvaluationStats)
+		ruleRoutes.POST("/backtest", ruleHandler.BacktestRule)
+		ruleRoutes.POST("/catch-up", ruleHandler.CatchUpRules)
+		ruleRoutes.GET("/sigma", ruleHandler.ExportSigmaRules)
+		ruleRoutes.POST("/sigma", ruleHandler.ImportSigmaRules)
 		ruleRoutes.GET("/:id", ruleHandler.GetRule)
 		ruleRoutes.PUT("/:id", ruleHandler.UpdateRule)
 		ruleRoutes.DELETE("/:id", ruleHandler.DeleteRule)
+		ruleRoutes.GET("/:id/sigma", ruleHandler.ExportSigmaRule)
+		ruleRoutes.GET("/:id/actions", responseHandler.GetResponseActions)
+		ruleRoutes.POST("/:id/actions", responseHandler.CreateResponseAction)
+		ruleRoutes.PUT("/:id/actions/:actionId", responseHandler.UpdateResponseAction)
+		ruleRoutes.DELETE("/:id/actions/:actionId", responseHandler.DeleteResponseAction)
+		ruleRoutes.POST("/:id/actions/:actionId/dry-run", responseHandler.DryRunResponseAction)
+	}
+
+
+	// Response action audit log, IP blocklist and untrusted vehicles
+	responseRoutes := router.Group("/response", analystWrites)
+	{
+		responseRoutes.GET("/executions", responseHandler.GetResponseExecutions)
+		responseRoutes.GET("/blocklist", responseHandler.GetBlocklist)
+		responseRoutes.DELETE("/blocklist/:id", responseHandler.DeleteBlockedIP)
+		responseRoutes.GET("/untrusted-vehicles", responseHandler.GetUntrustedVehicles)
+		responseRoutes.DELETE("/untrusted-vehicles/:id", responseHandler.DeleteUntrustedVehicle)
 	}
 
 	// Log source routes
-	logSourceRoutes := router.Group("/log-sources")
+	logSourceRoutes := router.Group("/log-sources", adminWrites)
 	{
 		logSourceRoutes.GET("/", logSourceHandler.GetLogSources)
 		logSourceRoutes.POST("/", logSourceHandler.CreateLogSource)
 		logSourceRoutes.GET("/:id", logSourceHandler.GetLogSource)
 		logSourceRoutes.PUT("/:id", logSourceHandler.UpdateLogSource)
 		logSourceRoutes.DELETE("/:id", logSourceHandler.DeleteLogSource)
+		logSourceRoutes.GET("/:id/severity-mappings", logSourceHandler.GetSeverityMappings)
+		logSourceRoutes.PUT("/:id/severity-mappings", logSourceHandler.ReplaceSeverityMappings)
+		logSourceRoutes.DELETE("/:id/severity-mappings/:value", logSourceHandler.DeleteSeverityMapping)
+		logSourceRoutes.GET("/:id/keys", logSourceHandler.GetAPIKeys)
+		logSourceRoutes.POST("/:id/keys", logSourceHandler.CreateAPIKey)
+		logSourceRoutes.PUT("/:id/keys/:keyId", logSourceHandler.UpdateAPIKey)
+		logSourceRoutes.POST("/:id/keys/:keyId/rotate", logSourceHandler.RotateAPIKey)
+		logSourceRoutes.DELETE("/:id/keys/:keyId", logSourceHandler.RevokeAPIKey)
 	}
 
 
 
 	// Ingestion routes
-	ingestionRoutes := router.Group("/ingest")
+	ingestionRoutes := router.Group("/ingest", ingestWrites)
 	{
-		ingestionRoutes.POST("/", ingestionHandler.IngestEvent)
+		ingestionRoutes.POST("/", ingestKeys, ingestionHandler.IngestEvent)
+		ingestionRoutes.POST("/batch", ingestKeys, ingestionHandler.IngestBatch)
+		ingestionRoutes.GET("/edges", ingestionHandler.GetEdgeCheckpoints)
 	}
 
 
 	// Collector routes
-	collectorRoutes := router.Group("/collectors")
+	collectorRoutes := router.Group("/collectors", adminWrites)
 	{
 		collectorRoutes.GET("/", collectorHandler.GetCollectors)
 		collectorRoutes.POST("/:name/start", collectorHandler.StartCollector)
 		collectorRoutes.POST("/:name/stop", collectorHandler.StopCollector)
 		collectorRoutes.POST("/start-all", collectorHandler.StartAllCollectors)
 		collectorRoutes.POST("/stop-all", collectorHandler.StopAllCollectors)
+		collectorRoutes.GET("/listeners", collectorHandler.GetListeners)
+		collectorRoutes.POST("/listeners", collectorHandler.AddListener)
+		collectorRoutes.PUT("/listeners/:name", collectorHandler.UpdateListener)
+		collectorRoutes.DELETE("/listeners/:name", collectorHandler.RemoveListener)
+		collectorRoutes.GET("/mqtt", collectorHandler.GetMQTTBrokers)
+		collectorRoutes.POST("/mqtt", collectorHandler.AddMQTTBroker)
+		collectorRoutes.PUT("/mqtt/:name", collectorHandler.UpdateMQTTBroker)
+		collectorRoutes.DELETE("/mqtt/:name", collectorHandler.RemoveMQTTBroker)
+		collectorRoutes.GET("/replays", collectorHandler.GetReplays)
+		collectorRoutes.POST("/replays", collectorHandler.ReplayCapture)
+		collectorRoutes.GET("/replays/:id", collectorHandler.GetReplay)
+		collectorRoutes.DELETE("/replays/:id", collectorHandler.CancelReplay)
 	}
 
 
 	// Dashboard routes
-	dashboardRoutes := router.Group("/dashboard")
+	dashboardRoutes := router.Group("/dashboard", analystWrites, dashboardCache)
 	{
 		dashboardRoutes.GET("/overview", dashboardHandler.GetDashboardOverview)
+		dashboardRoutes.GET("/summary", dashboardHandler.GetDashboardSummary)
 		dashboardRoutes.GET("/events/summary", dashboardHandler.GetEventSummary)
 		dashboardRoutes.GET("/alerts/summary", dashboardHandler.GetAlertSummary)
 		dashboardRoutes.GET("/events/timeseries", dashboardHandler.GetEventTimeSeries)
@@ -146,10 +373,541 @@ func RegisterRoutes(router *gin.Engine, db *gorm.DB, esService *elasticsearch.Se
 	}
 
 
+	// Threat hunting routes
+	huntRoutes := router.Group("/hunts", analystWrites)
+	{
+		huntRoutes.GET("/", huntHandler.GetHunts)
+		huntRoutes.POST("/", huntHandler.CreateHunt)
+		huntRoutes.DELETE("/:id", huntHandler.DeleteHunt)
+		huntRoutes.GET("/export", huntHandler.ExportHunts)
+		huntRoutes.POST("/import", huntHandler.ImportHunts)
+	}
+
+
+	// Ingest transform rule routes
+	transformRoutes := router.Group("/transform-rules", adminWrites)
+	{
+		transformRoutes.GET("/", transformRuleHandler.GetTransformRules)
+		transformRoutes.POST("/", transformRuleHandler.CreateTransformRule)
+		transformRoutes.POST("/test", transformRuleHandler.TestTransformRule)
+		transformRoutes.GET("/:id", transformRuleHandler.GetTransformRule)
+		transformRoutes.PUT("/:id", transformRuleHandler.UpdateTransformRule)
+		transformRoutes.DELETE("/:id", transformRuleHandler.DeleteTransformRule)
+	}
+
+
+	// RSU vendor syslog pattern routes
+	vendorPatternRoutes := router.Group("/vendor-patterns", adminWrites)
+	{
+		vendorPatternRoutes.GET("/", vendorPatternHandler.GetVendorPatterns)
+		vendorPatternRoutes.POST("/", vendorPatternHandler.CreateVendorPattern)
+		vendorPatternRoutes.POST("/test", vendorPatternHandler.TestVendorPattern)
+		vendorPatternRoutes.GET("/:id", vendorPatternHandler.GetVendorPattern)
+		vendorPatternRoutes.PUT("/:id", vendorPatternHandler.UpdateVendorPattern)
+		vendorPatternRoutes.DELETE("/:id", vendorPatternHandler.DeleteVendorPattern)
+	}
+
+
+	// V2X PKI certificate revocation list routes
+	crlRoutes := router.Group("/crls", adminWrites)
+	{
+		crlRoutes.GET("/", crlHandler.GetCRLs)
+		crlRoutes.POST("/", crlHandler.CreateCRL)
+		crlRoutes.GET("/check/:certificate_id", crlHandler.CheckCertificate)
+		crlRoutes.GET("/:id", crlHandler.GetCRL)
+		crlRoutes.PUT("/:id", crlHandler.UpdateCRL)
+		crlRoutes.DELETE("/:id", crlHandler.DeleteCRL)
+		crlRoutes.POST("/:id/upload", crlHandler.UploadCRL)
+		crlRoutes.POST("/:id/refresh", crlHandler.RefreshCRL)
+		crlRoutes.GET("/:id/entries", crlHandler.GetCRLEntries)
+	}
+
+
+	// V2X misbehavior report routes
+	misbehaviorRoutes := router.Group("/misbehavior-reports", analystWrites)
+	{
+		misbehaviorRoutes.GET("/", misbehaviorHandler.GetMisbehaviorReports)
+		misbehaviorRoutes.POST("/generate", misbehaviorHandler.GenerateMisbehaviorReports)
+		misbehaviorRoutes.GET("/:id", misbehaviorHandler.GetMisbehaviorReport)
+		misbehaviorRoutes.POST("/:id/forward", misbehaviorHandler.ForwardMisbehaviorReport)
+	}
+
+
+	// Fleet operator routes, notified when alerts on their vehicles are confirmed malicious
+	fleetOperatorRoutes := router.Group("/fleet-operators", adminOnly)
+	{
+		fleetOperatorRoutes.GET("/", oemHandler.GetFleetOperators)
+		fleetOperatorRoutes.POST("/", oemHandler.CreateFleetOperator)
+		fleetOperatorRoutes.GET("/:id", oemHandler.GetFleetOperator)
+		fleetOperatorRoutes.PUT("/:id", oemHandler.UpdateFleetOperator)
+		fleetOperatorRoutes.DELETE("/:id", oemHandler.DeleteFleetOperator)
+	}
+
+	// OEM notification routes
+	oemNotificationRoutes := router.Group("/oem-notifications", analystWrites)
+	{
+		oemNotificationRoutes.GET("/", oemHandler.GetOEMNotifications)
+		oemNotificationRoutes.GET("/:id", oemHandler.GetOEMNotification)
+		oemNotificationRoutes.POST("/:id/deliver", oemHandler.DeliverOEMNotification)
+	}
+
+
+	// Regulatory report routes: monthly packages per jurisdiction template
+	regulatoryTemplateRoutes := router.Group("/regulatory-templates", adminWrites)
+	{
+		regulatoryTemplateRoutes.GET("/", regulatoryHandler.GetRegulatoryTemplates)
+		regulatoryTemplateRoutes.POST("/", regulatoryHandler.CreateRegulatoryTemplate)
+		regulatoryTemplateRoutes.GET("/:id", regulatoryHandler.GetRegulatoryTemplate)
+		regulatoryTemplateRoutes.PUT("/:id", regulatoryHandler.UpdateRegulatoryTemplate)
+		regulatoryTemplateRoutes.DELETE("/:id", regulatoryHandler.DeleteRegulatoryTemplate)
+		regulatoryTemplateRoutes.POST("/:id/generate", regulatoryHandler.GenerateRegulatoryReport)
+	}
+
+	regulatoryReportRoutes := router.Group("/regulatory-reports", adminWrites)
+	{
+		regulatoryReportRoutes.GET("/", regulatoryHandler.GetRegulatoryReports)
+		regulatoryReportRoutes.GET("/:id/download", regulatoryHandler.DownloadRegulatoryReport)
+	}
+
+
+	// Summary report routes: daily and weekly reports delivered through the notification channels
+	reportTemplateRoutes := router.Group("/report-templates", adminWrites)
+	{
+		reportTemplateRoutes.GET("/", reportHandler.GetReportTemplates)
+		reportTemplateRoutes.POST("/", reportHandler.CreateReportTemplate)
+		reportTemplateRoutes.GET("/:id", reportHandler.GetReportTemplate)
+		reportTemplateRoutes.PUT("/:id", reportHandler.UpdateReportTemplate)
+		reportTemplateRoutes.DELETE("/:id", reportHandler.DeleteReportTemplate)
+		reportTemplateRoutes.POST("/:id/generate", reportHandler.GenerateReport)
+	}
+
+	reportRoutes := router.Group("/reports", adminWrites)
+	{
+		reportRoutes.GET("/", reportHandler.GetReports)
+		reportRoutes.GET("/:id/html", reportHandler.GetReportHTML)
+		reportRoutes.GET("/:id/pdf", reportHandler.GetReportPDF)
+		reportRoutes.POST("/:id/deliver", reportHandler.DeliverReport)
+	}
+
+
+	// V2X anomaly detector configuration routes
+	anomalyDetectorRoutes := router.Group("/anomaly-detectors", adminWrites)
+	{
+		anomalyDetectorRoutes.GET("/", anomalyDetectorHandler.GetAnomalyDetectors)
+		anomalyDetectorRoutes.PUT("/:name", anomalyDetectorHandler.UpdateAnomalyDetector)
+		anomalyDetectorRoutes.DELETE("/:name", anomalyDetectorHandler.ResetAnomalyDetector)
+		anomalyDetectorRoutes.POST("/:name/enable", anomalyDetectorHandler.EnableAnomalyDetector)
+		anomalyDetectorRoutes.POST("/:name/disable", anomalyDetectorHandler.DisableAnomalyDetector)
+	}
+
+
+	// Retention policy routes
+	retentionRoutes := router.Group("/retention", adminWrites)
+	{
+		retentionRoutes.GET("/policies", retentionHandler.GetRetentionPolicies)
+		retentionRoutes.POST("/policies", retentionHandler.CreateRetentionPolicy)
+		retentionRoutes.GET("/policies/:id", retentionHandler.GetRetentionPolicy)
+		retentionRoutes.PUT("/policies/:id", retentionHandler.UpdateRetentionPolicy)
+		retentionRoutes.DELETE("/policies/:id", retentionHandler.DeleteRetentionPolicy)
+		retentionRoutes.POST("/policies/:id/run", retentionHandler.RunRetentionPolicy)
+		retentionRoutes.POST("/run", retentionHandler.RunRetentionPolicies)
+		retentionRoutes.GET("/rollups", retentionHandler.GetEventRollups)
+	}
+
+
+	// Map tile proxy routes
+	tileRoutes := router.Group("/tiles", analystWrites)
+	{
+		tileRoutes.GET("/stats", tileHandler.GetTileStats)
+		tileRoutes.GET("/:z/:x/:y", tileHandler.GetTile)
+	}
+
+
+	// Open data routes (privacy-protected aggregates)
+	openDataRoutes := router.Group("/opendata", analystWrites, middleware.Cached(30*time.Second, "security_events"))
+	{
+		openDataRoutes.GET("/traffic-flow", openDataHandler.GetTrafficFlow)
+		openDataRoutes.GET("/message-counts", openDataHandler.GetMessageCounts)
+	}
+
+
+	// Pipeline cost accounting routes
+	pipelineRoutes := router.Group("/pipeline", analystWrites)
+	{
+		pipelineRoutes.GET("/cost", costHandler.GetCostBreakdown)
+		pipelineRoutes.DELETE("/cost", costHandler.ResetCostBreakdown)
+	}
+
+
+	// V2X KPI routes
+	kpiRoutes := router.Group("/kpi", analystWrites, middleware.Cached(30*time.Second, "v2x_kpis"))
+	{
+		kpiRoutes.GET("/", kpiHandler.GetKPIs)
+		kpiRoutes.GET("/summary", kpiHandler.GetKPISummary)
+		kpiRoutes.POST("/compute", kpiHandler.ComputeKPIs)
+	}
+
+
+	// Example payload catalog routes
+	exampleRoutes := router.Group("/examples", analystWrites)
+	{
+		exampleRoutes.GET("/", exampleHandler.GetExamples)
+		exampleRoutes.GET("/:format", exampleHandler.GetExample)
+		exampleRoutes.POST("/:format/validate", exampleHandler.ValidateExample)
+	}
+
+
+	// RSU registry routes
+	rsuRoutes := router.Group("/rsus", adminWrites, geoCache)
+	{
+		rsuRoutes.GET("/", geoHandler.GetRSUs)
+		rsuRoutes.POST("/", geoHandler.CreateRSU)
+		rsuRoutes.DELETE("/:id", geoHandler.DeleteRSU)
+	}
+
+	// Road network routes
+	roadRoutes := router.Group("/roads", adminWrites, geoCache)
+	{
+		roadRoutes.GET("/", geoHandler.GetRoadStats)
+		roadRoutes.POST("/import", geoHandler.ImportRoads)
+		roadRoutes.GET("/nearest", geoHandler.LocateNearest)
+	}
+
+	// Geofence routes, referenced by rule conditions and anomaly detectors
+	geofenceRoutes := router.Group("/geofences", adminWrites)
+	{
+		geofenceRoutes.GET("/", geofenceHandler.GetGeofences)
+		geofenceRoutes.POST("/", geofenceHandler.CreateGeofence)
+		geofenceRoutes.GET("/containing", geofenceHandler.GetContainingGeofences)
+		geofenceRoutes.GET("/:id", geofenceHandler.GetGeofence)
+		geofenceRoutes.PUT("/:id", geofenceHandler.UpdateGeofence)
+		geofenceRoutes.DELETE("/:id", geofenceHandler.DeleteGeofence)
+	}
+
+
+	// Synthetic intersection scenario routes, the ground truth of simulated SPaT and MAP
+	// and the review of the signal requests made to them
+	intersectionRoutes := router.Group("/scenarios/intersections", analystWrites)
+	{
+		intersectionRoutes.GET("/", intersectionHandler.GetIntersections)
+		intersectionRoutes.POST("/", intersectionHandler.CreateIntersection)
+		intersectionRoutes.GET("/:id", intersectionHandler.GetIntersection)
+		intersectionRoutes.PUT("/:id", intersectionHandler.UpdateIntersection)
+		intersectionRoutes.DELETE("/:id", intersectionHandler.DeleteIntersection)
+		intersectionRoutes.GET("/:id/state", intersectionHandler.GetIntersectionState)
+		intersectionRoutes.GET("/:id/verify", intersectionHandler.VerifyIntersectionSPaT)
+		intersectionRoutes.GET("/:id/priority", intersectionHandler.ReviewIntersectionPriority)
+	}
+
+	// Scenarios the V2X simulator pulls with the ingest token
+	simulatorRoutes := router.Group("/simulator", middleware.RequireRole(models.AdminRole, models.AnalystRole, middleware.IngestRole))
+	{
+		simulatorRoutes.GET("/intersections", intersectionHandler.GetSimulatorIntersections)
+	}
+
+
+	// Source mute routes
+	muteRoutes := router.Group("/mutes", analystWrites)
+	{
+		muteRoutes.GET("/", muteHandler.GetMutes)
+		muteRoutes.POST("/", muteHandler.CreateMute)
+		muteRoutes.POST("/:id/resolve", muteHandler.ResolveMute)
+		muteRoutes.DELETE("/:id", muteHandler.DeleteMute)
+	}
+
+
+	// Event routing routes
+	routingRoutes := router.Group("/routing", adminWrites)
+	{
+		routingRoutes.GET("/sinks", routingHandler.GetSinks)
+		routingRoutes.POST("/sinks", routingHandler.CreateSink)
+		routingRoutes.PUT("/sinks/:id", routingHandler.UpdateSink)
+		routingRoutes.DELETE("/sinks/:id", routingHandler.DeleteSink)
+		routingRoutes.GET("/rules", routingHandler.GetRoutingRules)
+		routingRoutes.POST("/rules", routingHandler.CreateRoutingRule)
+		routingRoutes.PUT("/rules/:id", routingHandler.UpdateRoutingRule)
+		routingRoutes.DELETE("/rules/:id", routingHandler.DeleteRoutingRule)
+		routingRoutes.GET("/metrics", routingHandler.GetRoutingMetrics)
+	}
+
+
+	// NGSI-LD export routes for smart-city platforms
+	ngsildRoutes := router.Group("/ngsi-ld/v1", analystWrites, middleware.Cached(5*time.Second, "security_events", "alerts", "rsus", "vehicle_links"))
+	{
+		ngsildRoutes.GET("/entities", ngsildHandler.GetEntities)
+		ngsildRoutes.GET("/entities/:id", ngsildHandler.GetEntity)
+	}
+
+
+	// Incident routes (cases grouping related alerts)
+	incidentRoutes := router.Group("/incidents", analystWrites)
+	{
+		incidentRoutes.GET("/", incidentHandler.GetIncidents)
+		incidentRoutes.POST("/", incidentHandler.CreateIncident)
+		incidentRoutes.POST("/correlate", incidentHandler.CorrelateIncidents)
+		incidentRoutes.GET("/:id", incidentHandler.GetIncident)
+		incidentRoutes.PUT("/:id", incidentHandler.UpdateIncident)
+		incidentRoutes.POST("/:id/alerts", incidentHandler.AddIncidentAlerts)
+		incidentRoutes.DELETE("/:id/alerts/:alertId", incidentHandler.RemoveIncidentAlert)
+		incidentRoutes.GET("/:id/events", incidentHandler.GetIncidentEvents)
+		incidentRoutes.POST("/:id/events", incidentHandler.LinkIncidentEvents)
+		incidentRoutes.GET("/:id/timeline", incidentHandler.GetIncidentTimeline)
+		incidentRoutes.POST("/:id/notes", incidentHandler.AddIncidentNote)
+	}
+
+
+	// Incident forensics routes
+	forensicsRoutes := router.Group("/forensics", analystWrites)
+	{
+		forensicsRoutes.GET("/window", forensicsHandler.GetWindow)
+	}
+
+
+	// V2X message export routes
+	v2xRoutes := router.Group("/v2x", analystWrites)
+	{
+		v2xRoutes.POST("/export-pcap", v2xExportHandler.ExportPcap)
+	}
+
+
+	// Vehicle routes (DSRC and C-V2X reports merged per physical vehicle)
+	vehicleRoutes := router.Group("/vehicles", analystWrites)
+	{
+		vehicleRoutes.GET("/links", vehicleHandler.GetVehicleLinks)
+		vehicleRoutes.GET("/:id", vehicleHandler.GetVehicle)
+	}
+
+
+	// Registered vehicle routes (rotating temporary IDs and certificates
+	// resolved into persistent pseudonymous vehicles)
+	registeredVehicleRoutes := router.Group("/registered-vehicles", analystWrites)
+	{
+		registeredVehicleRoutes.GET("/", vehicleRegistryHandler.GetRegisteredVehicles)
+		registeredVehicleRoutes.GET("/lookup", vehicleRegistryHandler.LookupRegisteredVehicle)
+		registeredVehicleRoutes.POST("/resolve", vehicleRegistryHandler.ResolveRegisteredVehicles)
+		registeredVehicleRoutes.GET("/:id", vehicleRegistryHandler.GetRegisteredVehicle)
+		registeredVehicleRoutes.GET("/:id/messages", vehicleRegistryHandler.GetRegisteredVehicleMessages)
+		registeredVehicleRoutes.GET("/:id/anomalies", vehicleRegistryHandler.GetRegisteredVehicleAnomalies)
+		registeredVehicleRoutes.GET("/:id/trust", vehicleRegistryHandler.GetRegisteredVehicleTrust)
+	}
+
+
+	// V2X source trust score routes (rules test them as trust_score)
+	trustRoutes := router.Group("/trust-scores", analystWrites)
+	{
+		trustRoutes.GET("/", trustHandler.GetTrustScores)
+		trustRoutes.POST("/update", trustHandler.UpdateTrustScores)
+		trustRoutes.GET("/:source_id", trustHandler.GetTrustScore)
+	}
+
+
+	// GraphQL API joining events, alerts, rules and vehicles; queries only
+	// read, so every reading role may POST them
+	graphqlRoutes := router.Group("/graphql", middleware.RequireRole(models.AdminRole, models.AnalystRole, models.ViewerRole, models.UserRoleUser))
+	{
+		graphqlRoutes.POST("", graphqlHandler.Query)
+		graphqlRoutes.GET("", graphqlHandler.Query)
+		graphqlRoutes.GET("/schema", graphqlHandler.GetSchema)
+	}
+
+
+	// DENM reaction verification
+	denmRoutes := router.Group("/denm", analystWrites)
+	{
+		denmRoutes.GET("/verifications", denmHandler.GetVerifications)
+		denmRoutes.GET("/verifications/:alert_id", denmHandler.GetVerification)
+		denmRoutes.POST("/verifications/:alert_id", denmHandler.VerifyAlert)
+	}
+
+
+	// Live statistics stream for wallboards and clustered vehicles for the live map
+	liveRoutes := router.Group("/live", analystWrites)
+	{
+		liveRoutes.GET("/stats", liveHandler.GetLiveStats)
+		liveRoutes.GET("/map", liveHandler.GetLiveMap)
+	}
+
+
+	// Saved dashboard layouts
+	layoutRoutes := router.Group("/dashboard/layouts", analystWrites)
+	{
+		layoutRoutes.GET("", layoutHandler.GetLayouts)
+		layoutRoutes.GET("/effective", layoutHandler.GetEffectiveLayout)
+		layoutRoutes.POST("", layoutHandler.CreateLayout)
+		layoutRoutes.PUT("/:id", layoutHandler.UpdateLayout)
+		layoutRoutes.DELETE("/:id", layoutHandler.DeleteLayout)
+	}
+
+
+	// Per-role default dashboard layouts
+	roleLayoutRoutes := router.Group("/admin/dashboard-layouts", adminOnly)
+	{
+		roleLayoutRoutes.GET("", layoutHandler.GetRoleLayouts)
+		roleLayoutRoutes.POST("", layoutHandler.CreateRoleLayout)
+		roleLayoutRoutes.PUT("/:id", layoutHandler.UpdateRoleLayout)
+		roleLayoutRoutes.DELETE("/:id", layoutHandler.DeleteRoleLayout)
+	}
+
+
+	// Configuration export/import for disaster recovery
+	configRoutes := router.Group("/admin/config", adminOnly)
+	{
+		configRoutes.GET("/export", configBundleHandler.ExportConfig)
+		configRoutes.POST("/import", configBundleHandler.ImportConfig)
+	}
+
+
+	// Runtime settings, with secrets redacted, and reloading the config file
+	settingRoutes := router.Group("/config", adminOnly)
+	{
+		settingRoutes.GET("", configHandler.GetConfig)
+		settingRoutes.POST("/reload", configHandler.ReloadConfig)
+	}
+
+
+	// Per-component log levels, adjustable until the next restart
+	logLevelRoutes := router.Group("/admin/log-levels", adminOnly)
+	{
+		logLevelRoutes.GET("", logLevelHandler.GetLogLevels)
+		logLevelRoutes.PUT("", logLevelHandler.UpdateLogLevels)
+	}
+
+
+	// Long-term trend routes (week over week, month over month)
+	trendRoutes := router.Group("/trends", adminWrites)
+	{
+		trendRoutes.GET("", middleware.Cached(time.Minute, "security_events", "alerts"), trendHandler.GetTrends)
+		trendRoutes.GET("/rules", trendHandler.GetTrendRules)
+		trendRoutes.POST("/rules", trendHandler.CreateTrendRule)
+		trendRoutes.POST("/rules/evaluate", trendHandler.EvaluateTrendRules)
+		trendRoutes.PUT("/rules/:id", trendHandler.UpdateTrendRule)
+		trendRoutes.DELETE("/rules/:id", trendHandler.DeleteTrendRule)
+		trendRoutes.GET("/alerts", trendHandler.GetTrendAlerts)
+	}
+
+
+	// MITRE ATT&CK technique coverage routes
+	attackRoutes := router.Group("/attack", analystWrites)
+	{
+		attackRoutes.GET("/techniques", attackHandler.GetTechniques)
+		attackRoutes.GET("/coverage", middleware.Cached(time.Minute, "rules", "alerts"), attackHandler.GetCoverage)
+	}
+
+
+	// V2X threat taxonomy routes
+	v2xThreatRoutes := router.Group("/v2x-threats", adminWrites)
+	{
+		v2xThreatRoutes.GET("/", v2xThreatHandler.GetThreats)
+		v2xThreatRoutes.POST("/", v2xThreatHandler.CreateThreat)
+		v2xThreatRoutes.GET("/coverage", middleware.Cached(time.Minute, "rules", "alerts", "security_events", "v2x_threats"), v2xThreatHandler.GetThreatCoverage)
+		v2xThreatRoutes.PUT("/:id", v2xThreatHandler.UpdateThreat)
+		v2xThreatRoutes.DELETE("/:id", v2xThreatHandler.DeleteThreat)
+	}
+
+
+	// Authentication routes
+	authRoutes := router.Group("/auth")
+	{
+		authRoutes.POST("/login", authHandler.Login)
+		authRoutes.GET("/me", authHandler.GetCurrentUser)
+		authRoutes.POST("/logout", authHandler.Logout)
+		authRoutes.GET("/sessions", authHandler.GetMySessions)
+	}
+
+
+	// User management routes
+	userRoutes := router.Group("/users", adminOnly)
+	{
+		userRoutes.GET("/", userHandler.GetUsers)
+		userRoutes.POST("/", userHandler.CreateUser)
+		userRoutes.GET("/:id", userHandler.GetUser)
+		userRoutes.PUT("/:id", userHandler.UpdateUser)
+		userRoutes.DELETE("/:id", userHandler.DeleteUser)
+		userRoutes.POST("/:id/logout", userHandler.LogoutUser)
+	}
+
+
+	// Organization routes
+	organizationRoutes := router.Group("/organizations", adminOnly)
+	{
+		organizationRoutes.GET("/", organizationHandler.GetOrganizations)
+		organizationRoutes.POST("/", organizationHandler.CreateOrganization)
+		organizationRoutes.GET("/:id", organizationHandler.GetOrganization)
+		organizationRoutes.PUT("/:id", organizationHandler.UpdateOrganization)
+		organizationRoutes.DELETE("/:id", organizationHandler.DeleteOrganization)
+	}
+
+
+	// Active session routes
+	sessionRoutes := router.Group("/admin/sessions", adminOnly)
+	{
+		sessionRoutes.GET("", sessionHandler.GetSessions)
+		sessionRoutes.DELETE("/:id", sessionHandler.TerminateSession)
+	}
+
+
+	// Elasticsearch admin routes
+	esAdminRoutes := router.Group("/admin/elasticsearch", adminOnly)
+	{
+		esAdminRoutes.GET("/indices", esAdminHandler.GetIndices)
+		esAdminRoutes.DELETE("/indices", esAdminHandler.DeleteIndices)
+		esAdminRoutes.POST("/indices/forcemerge", esAdminHandler.ForceMergeIndices)
+		esAdminRoutes.POST("/rollover", esAdminHandler.RolloverIndex)
+		esAdminRoutes.GET("/ilm", esAdminHandler.GetILM)
+		esAdminRoutes.PUT("/ilm", esAdminHandler.UpdateILM)
+		esAdminRoutes.GET("/spill", esAdminHandler.GetSpill)
+		esAdminRoutes.GET("/bulk", esAdminHandler.GetBulk)
+	}
+
+
+	// Runtime profiling routes: live pprof and the profiles captured on thresholds
+	pprofRoutes := router.Group("/debug/pprof", adminOnly)
+	{
+		pprofRoutes.GET("/", profilingHandler.GetPprof)
+		pprofRoutes.GET("/:name", profilingHandler.GetPprof)
+		pprofRoutes.POST("/symbol", profilingHandler.GetPprof)
+	}
+
+	profileRoutes := router.Group("/admin/profiles", adminOnly)
+	{
+		profileRoutes.GET("", profilingHandler.GetProfiles)
+		profileRoutes.POST("", profilingHandler.CaptureProfiles)
+		profileRoutes.GET("/:name", profilingHandler.DownloadProfile)
+	}
+
+	// Prometheus metrics of the ingestion and detection pipeline
+	router.GET("/metrics", metricsHandler.GetMetrics)
+
+	// Parse failure statistics by collector, source address, message type and reason
+	statsRoutes := router.Group("/stats", analystWrites)
+	{
+		statsRoutes.GET("/parse-errors", parseErrorHandler.GetParseErrors)
+		statsRoutes.GET("/parse-errors/sources", parseErrorHandler.GetParseErrorSources)
+	}
+
+
 	// Health check endpoint for service discovery
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
+	// Readiness of the dependencies awaited at startup; 503 while starting or failed
+	router.GET("/readyz", func(c *gin.Context) {
+		readiness := startup.Report()
+		status := http.StatusOK
+		if !readiness.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, readiness)
+	})
+
+	// Read replica health
+	router.GET("/health/replicas", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"replicas": database.GetReplicaStatus()})
+	})
+
+	// Embedded console at / (EMBEDDED_UI=false disables it)
+	webui.Register(router)
+
 
 }
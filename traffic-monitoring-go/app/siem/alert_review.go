@@ -0,0 +1,211 @@
+package siem
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+var (
+	// ErrReviewerIdentity is returned when a review comes from a shared API token
+	// rather than an analyst's own account, so the two reviewers cannot be told apart
+	ErrReviewerIdentity = errors.New("four-eyes review needs a personal analyst account")
+	// ErrReviewerRole is returned when the reviewer is neither an analyst nor an admin
+	ErrReviewerRole = errors.New("only analysts and admins may review alert status changes")
+	// ErrSameReviewer is returned when the analyst who requested a status change tries to approve it
+	ErrSameReviewer = errors.New("the status change must be approved by a different analyst")
+	// ErrReviewPending is returned when another status change of the alert is awaiting review
+	ErrReviewPending = errors.New("another status change of this alert is awaiting review")
+	// ErrNoPendingReview is returned when approving or rejecting an alert with nothing to review
+	ErrNoPendingReview = errors.New("alert has no status change awaiting review")
+)
+
+// Reviewer is the analyst acting on an alert review
+type Reviewer struct {
+	ID   uint
+	Name string
+	Role models.UserRole
+}
+
+// check refuses reviewers that cannot count as one of the four eyes
+func (r Reviewer) check() error {
+	if r.ID == 0 {
+		return ErrReviewerIdentity
+	}
+	if r.Role != models.AnalystRole && r.Role != models.AdminRole {
+		return ErrReviewerRole
+	}
+	return nil
+}
+
+// AlertReviewPolicy enforces four-eyes review of alert status changes: on
+// alerts of the configured severities, a status change requested by one
+// analyst only applies once a different analyst approves it
+type AlertReviewPolicy struct {
+	DB         *gorm.DB
+	Clock      clock.Clock
+	Severities map[models.EventSeverity]bool
+}
+
+var fourEyesSeverities = config.NewString("ALERT_FOUR_EYES_SEVERITIES", "",
+	"Comma-separated severities whose alerts need a second analyst to change status")
+
+// NewAlertReviewPolicy creates a policy for the severities listed in
+// ALERT_FOUR_EYES_SEVERITIES (comma-separated, e.g. "critical"); review is
+// off when it is unset
+func NewAlertReviewPolicy(db *gorm.DB) *AlertReviewPolicy {
+	severities := make(map[models.EventSeverity]bool)
+	for _, severity := range strings.Split(fourEyesSeverities.Get(), ",") {
+		if severity = strings.ToLower(strings.TrimSpace(severity)); severity != "" {
+			severities[models.EventSeverity(severity)] = true
+		}
+	}
+	return &AlertReviewPolicy{DB: db, Clock: clock.Default(), Severities: severities}
+}
+
+// Requires reports whether changing the alert to status needs a second analyst
+func (p *AlertReviewPolicy) Requires(alert *models.Alert, status models.AlertStatus) bool {
+	return p.Severities[alert.Severity] && status != alert.Status
+}
+
+// Request records an analyst's request to change an alert's status. The first
+// request is stored as a pending review; the same request from a different
+// analyst approves it, applying the status and resolution to alert. It
+// returns the review and whether the status was applied. With
+// ErrReviewPending, the returned review is the one awaiting approval.
+func (p *AlertReviewPolicy) Request(alert *models.Alert, status models.AlertStatus, resolution string, reviewer Reviewer) (*models.AlertReview, bool, error) {
+	if err := reviewer.check(); err != nil {
+		return nil, false, err
+	}
+
+	var review models.AlertReview
+	applied := false
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		pending, err := lockPendingReview(tx, alert)
+		if err != nil {
+			return err
+		}
+
+		if pending == nil {
+			review = models.AlertReview{
+				AlertID:       alert.ID,
+				FromStatus:    alert.Status,
+				Status:        status,
+				Resolution:    resolution,
+				State:         models.AlertReviewPending,
+				RequestedByID: reviewer.ID,
+				RequestedBy:   reviewer.Name,
+				RequestedAt:   p.Clock.Now(),
+			}
+			return tx.Create(&review).Error
+		}
+
+		review = *pending
+		if pending.Status != status {
+			return ErrReviewPending
+		}
+		if resolution != "" {
+			review.Resolution = resolution
+		}
+		applied = true
+		return p.approve(tx, alert, &review, reviewer, "")
+	})
+	if err != nil {
+		if errors.Is(err, ErrReviewPending) {
+			return &review, false, err
+		}
+		return nil, false, err
+	}
+	return &review, applied, nil
+}
+
+// Approve applies the pending status change of an alert on behalf of a second analyst
+func (p *AlertReviewPolicy) Approve(alert *models.Alert, reviewer Reviewer, comment string) (*models.AlertReview, error) {
+	return p.decide(alert, reviewer, func(tx *gorm.DB, review *models.AlertReview) error {
+		return p.approve(tx, alert, review, reviewer, comment)
+	})
+}
+
+// Reject discards the pending status change of an alert, leaving its status as
+// it was. The requesting analyst may reject their own request to withdraw it.
+func (p *AlertReviewPolicy) Reject(alert *models.Alert, reviewer Reviewer, comment string) (*models.AlertReview, error) {
+	return p.decide(alert, reviewer, func(tx *gorm.DB, review *models.AlertReview) error {
+		return tx.Save(p.close(review, models.AlertReviewRejected, reviewer, comment)).Error
+	})
+}
+
+// decide runs fn on the locked pending review of an alert
+func (p *AlertReviewPolicy) decide(alert *models.Alert, reviewer Reviewer, fn func(tx *gorm.DB, review *models.AlertReview) error) (*models.AlertReview, error) {
+	if err := reviewer.check(); err != nil {
+		return nil, err
+	}
+
+	var review models.AlertReview
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		pending, err := lockPendingReview(tx, alert)
+		if err != nil {
+			return err
+		}
+		if pending == nil {
+			return ErrNoPendingReview
+		}
+		review = *pending
+		return fn(tx, &review)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// approve applies a pending review to the alert and records the second reviewer
+func (p *AlertReviewPolicy) approve(tx *gorm.DB, alert *models.Alert, review *models.AlertReview, reviewer Reviewer, comment string) error {
+	if review.RequestedByID == reviewer.ID {
+		return ErrSameReviewer
+	}
+
+	alert.Status = review.Status
+	if review.Resolution != "" {
+		alert.Resolution = review.Resolution
+	}
+	if err := tx.Save(alert).Error; err != nil {
+		return err
+	}
+	return tx.Save(p.close(review, models.AlertReviewApproved, reviewer, comment)).Error
+}
+
+// close records the outcome of a review
+func (p *AlertReviewPolicy) close(review *models.AlertReview, state models.AlertReviewState, reviewer Reviewer, comment string) *models.AlertReview {
+	now := p.Clock.Now()
+	reviewerID := reviewer.ID
+	review.State = state
+	review.ReviewedByID = &reviewerID
+	review.ReviewedBy = reviewer.Name
+	review.ReviewedAt = &now
+	review.ReviewerComment = comment
+	return review
+}
+
+// lockPendingReview locks the alert, serializing reviews of it, and returns
+// its pending review, if any. The alert is reloaded so the caller works on
+// the status other reviewers may have just changed.
+func lockPendingReview(tx *gorm.DB, alert *models.Alert) (*models.AlertReview, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(alert, alert.ID).Error; err != nil {
+		return nil, err
+	}
+
+	var review models.AlertReview
+	err := tx.Where("alert_id = ? AND state = ?", alert.ID, models.AlertReviewPending).First(&review).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
@@ -0,0 +1,583 @@
+package siem
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/metrics"
+	"traffic-monitoring-go/app/models"
+)
+
+var (
+	anomaliesDetected = metrics.NewCounterVec("siem_anomalies_total",
+		"V2X anomalies detected, by anomaly type; muted ones are counted as suppressed", "type", "suppressed")
+	anomalyEvaluations = metrics.NewCounterVec("siem_anomaly_detector_evaluations_total",
+		"V2X observations checked by each enabled anomaly detector", "detector")
+	anomalyHits = metrics.NewCounterVec("siem_anomaly_detector_hits_total",
+		"V2X observations each anomaly detector found an anomaly in, muted or not", "detector")
+)
+
+// AnomalyParams are the thresholds of a detector by name
+type AnomalyParams map[string]float64
+
+// Anomaly is what a detector found in a V2X observation
+type Anomaly struct {
+	Message string
+	Details map[string]interface{} // added to the finding's details
+}
+
+// AnomalyDetector is a V2X anomaly detector plugin. Detect is given an
+// observation and the earlier observations of the same source ID within
+// anomalyHistoryWindow, oldest first, and returns nil when it finds nothing.
+// Params hold DefaultParams overridden by the detector's stored config.
+type AnomalyDetector interface {
+	Name() string // also the anomaly_type of its findings
+	Description() string
+	DefaultSeverity() models.EventSeverity
+	DefaultParams() AnomalyParams
+	Detect(obs V2XObservation, history []V2XObservation, params AnomalyParams) *Anomaly
+}
+
+// CrossSourceAnomalyDetector is an AnomalyDetector that compares a source with
+// the others, as Sybil detection must. It is run with DetectAcross instead of
+// Detect, which is additionally given the observations of every other source
+// generated within crossSourceWindow of the observation, oldest first.
+type CrossSourceAnomalyDetector interface {
+	AnomalyDetector
+	DetectAcross(obs V2XObservation, history, others []V2XObservation, params AnomalyParams) *Anomaly
+}
+
+var (
+	anomalyRegistryMutex sync.RWMutex
+	anomalyRegistry      = make(map[string]AnomalyDetector)
+	anomalyParamSettings = make(map[string]map[string]config.FloatSetting) // by detector and param
+)
+
+// anomalyParamKey names the setting overriding the default of a detector's
+// param, e.g. ANOMALY_POSITION_JUMP_MAX_SPEED_MPS
+func anomalyParamKey(detector, param string) string {
+	key := strings.ToUpper("ANOMALY_" + detector + "_" + param)
+	return strings.NewReplacer("-", "_", ".", "_").Replace(key)
+}
+
+// RegisterAnomalyDetector adds a detector to those run on every V2X event,
+// with a reloadable setting for the default of each of its params.
+// Registering two detectors with the same name panics.
+func RegisterAnomalyDetector(detector AnomalyDetector) {
+	anomalyRegistryMutex.Lock()
+	defer anomalyRegistryMutex.Unlock()
+
+	name := detector.Name()
+	if name == "" {
+		panic("siem: anomaly detector without a name")
+	}
+	if _, exists := anomalyRegistry[name]; exists {
+		panic("siem: anomaly detector registered twice: " + name)
+	}
+	anomalyRegistry[name] = detector
+
+	params := make(map[string]config.FloatSetting)
+	for param, value := range detector.DefaultParams() {
+		params[param] = config.NewFloat(anomalyParamKey(name, param), value,
+			fmt.Sprintf("Default %s of the %s anomaly detector; a stored detector config overrides it", param, name),
+			config.Min(0), config.Reloadable)
+	}
+	anomalyParamSettings[name] = params
+}
+
+// defaultAnomalyParams returns the defaults of a detector's params as configured
+func defaultAnomalyParams(detector AnomalyDetector) AnomalyParams {
+	anomalyRegistryMutex.RLock()
+	settings := anomalyParamSettings[detector.Name()]
+	anomalyRegistryMutex.RUnlock()
+
+	params := detector.DefaultParams()
+	for name := range params {
+		if setting, ok := settings[name]; ok {
+			params[name] = setting.Get()
+		}
+	}
+	return params
+}
+
+// AnomalyDetectors returns the registered detectors ordered by name
+func AnomalyDetectors() []AnomalyDetector {
+	anomalyRegistryMutex.RLock()
+	defer anomalyRegistryMutex.RUnlock()
+
+	detectors := make([]AnomalyDetector, 0, len(anomalyRegistry))
+	for _, detector := range anomalyRegistry {
+		detectors = append(detectors, detector)
+	}
+	sort.Slice(detectors, func(i, j int) bool { return detectors[i].Name() < detectors[j].Name() })
+	return detectors
+}
+
+// LookupAnomalyDetector returns the registered detector with the given name
+func LookupAnomalyDetector(name string) (AnomalyDetector, bool) {
+	anomalyRegistryMutex.RLock()
+	defer anomalyRegistryMutex.RUnlock()
+	detector, ok := anomalyRegistry[name]
+	return detector, ok
+}
+
+// anomalyConfigCacheTTL bounds how long a config changed on another instance takes to apply here
+const anomalyConfigCacheTTL = 10 * time.Second
+
+// anomalyConfigCache keeps the stored detector configs in memory so checking an event costs no query
+type anomalyConfigCache struct {
+	mutex    sync.RWMutex
+	loaded   bool
+	loadedAt time.Time
+	configs  map[string]models.AnomalyDetectorConfig
+}
+
+var defaultAnomalyConfigs = &anomalyConfigCache{}
+
+// InvalidateAnomalyConfigs forces the detector config cache to reload. Call it whenever configs change.
+func InvalidateAnomalyConfigs() {
+	cache.Invalidate("anomaly_configs")
+}
+
+// invalidate drops the cached detector configs of this instance
+func (c *anomalyConfigCache) invalidate() {
+	c.mutex.Lock()
+	c.loaded = false
+	c.mutex.Unlock()
+}
+
+func init() {
+	cache.OnInvalidate("anomaly_configs", defaultAnomalyConfigs.invalidate)
+}
+
+func (c *anomalyConfigCache) get(db *gorm.DB) (map[string]models.AnomalyDetectorConfig, error) {
+	c.mutex.RLock()
+	if c.loaded && time.Since(c.loadedAt) <= anomalyConfigCacheTTL {
+		configs := c.configs
+		c.mutex.RUnlock()
+		return configs, nil
+	}
+	c.mutex.RUnlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded || time.Since(c.loadedAt) > anomalyConfigCacheTTL {
+		var stored []models.AnomalyDetectorConfig
+		if err := db.Find(&stored).Error; err != nil {
+			return nil, err
+		}
+		configs := make(map[string]models.AnomalyDetectorConfig, len(stored))
+		for _, config := range stored {
+			configs[config.Detector] = config
+		}
+		c.configs = configs
+		c.loaded = true
+		c.loadedAt = time.Now()
+	}
+	return c.configs, nil
+}
+
+// AnomalyDetectorSettings are the effective settings of a registered detector
+type AnomalyDetectorSettings struct {
+	Detector      string               `json:"detector"`
+	Description   string               `json:"description"`
+	Enabled       bool                 `json:"enabled"`
+	Severity      models.EventSeverity `json:"severity"`
+	Params        AnomalyParams        `json:"params"`
+	DefaultParams AnomalyParams        `json:"default_params"`
+	Configured    bool                 `json:"configured"` // a stored config overrides the defaults
+}
+
+// settingsFor applies a stored config, if any, to a detector's defaults
+func settingsFor(detector AnomalyDetector, config *models.AnomalyDetectorConfig) AnomalyDetectorSettings {
+	settings := AnomalyDetectorSettings{
+		Detector:      detector.Name(),
+		Description:   detector.Description(),
+		Enabled:       true,
+		Severity:      detector.DefaultSeverity(),
+		Params:        make(AnomalyParams),
+		DefaultParams: defaultAnomalyParams(detector),
+	}
+	for name, value := range settings.DefaultParams {
+		settings.Params[name] = value
+	}
+	if config == nil {
+		return settings
+	}
+
+	settings.Configured = true
+	settings.Enabled = config.Enabled
+	if config.Severity != "" {
+		settings.Severity = config.Severity
+	}
+	for name, value := range config.Params {
+		if _, known := settings.DefaultParams[name]; known {
+			settings.Params[name] = value
+		}
+	}
+	return settings
+}
+
+// GetAnomalyDetectorSettings returns the effective settings of every registered detector
+func GetAnomalyDetectorSettings(db *gorm.DB) ([]AnomalyDetectorSettings, error) {
+	configs, err := defaultAnomalyConfigs.get(db)
+	if err != nil {
+		return nil, err
+	}
+
+	detectors := AnomalyDetectors()
+	settings := make([]AnomalyDetectorSettings, 0, len(detectors))
+	for _, detector := range detectors {
+		var config *models.AnomalyDetectorConfig
+		if stored, ok := configs[detector.Name()]; ok {
+			config = &stored
+		}
+		settings = append(settings, settingsFor(detector, config))
+	}
+	return settings, nil
+}
+
+// SetAnomalyDetectorEnabled switches a detector on or off, keeping its other
+// settings; the change applies to the next event without a restart
+func SetAnomalyDetectorEnabled(db *gorm.DB, name string, enabled bool, updatedBy string) (*models.AnomalyDetectorConfig, error) {
+	if _, ok := LookupAnomalyDetector(name); !ok {
+		return nil, fmt.Errorf("unknown anomaly detector %q", name)
+	}
+
+	config := models.AnomalyDetectorConfig{Detector: name, Enabled: true}
+	err := db.Where("detector = ?", name).FirstOrCreate(&config).Error
+	if err != nil {
+		return nil, err
+	}
+	// updated rather than saved, since GORM would leave a false enabled to its database default
+	err = db.Model(&config).Updates(map[string]interface{}{"enabled": enabled, "updated_by": updatedBy}).Error
+	if err != nil {
+		return nil, err
+	}
+	config.Enabled, config.UpdatedBy = enabled, updatedBy
+	InvalidateAnomalyConfigs()
+	return &config, nil
+}
+
+// AnomalyDetectorStats counts a detector's evaluations since the process started
+type AnomalyDetectorStats struct {
+	Evaluations int64   `json:"evaluations"`
+	Hits        int64   `json:"hits"`
+	HitRate     float64 `json:"hit_rate"` // hits per evaluation
+}
+
+// anomalyDetectorCounts mirrors the evaluation and hit counters for the config API
+type anomalyDetectorCounts struct {
+	mutex  sync.Mutex
+	counts map[string]*AnomalyDetectorStats
+}
+
+var defaultAnomalyDetectorCounts = &anomalyDetectorCounts{counts: make(map[string]*AnomalyDetectorStats)}
+
+func (c *anomalyDetectorCounts) evaluated(detector string) {
+	anomalyEvaluations.Inc(detector)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stats := c.counts[detector]
+	if stats == nil {
+		stats = &AnomalyDetectorStats{}
+		c.counts[detector] = stats
+	}
+	stats.Evaluations++
+}
+
+func (c *anomalyDetectorCounts) hit(detector string) {
+	anomalyHits.Inc(detector)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if stats := c.counts[detector]; stats != nil {
+		stats.Hits++
+	}
+}
+
+// GetAnomalyDetectorStats returns the evaluation and hit counts of a detector on this instance
+func GetAnomalyDetectorStats(detector string) AnomalyDetectorStats {
+	defaultAnomalyDetectorCounts.mutex.Lock()
+	defer defaultAnomalyDetectorCounts.mutex.Unlock()
+
+	stats := defaultAnomalyDetectorCounts.counts[detector]
+	if stats == nil {
+		return AnomalyDetectorStats{}
+	}
+	result := *stats
+	if result.Evaluations > 0 {
+		result.HitRate = float64(result.Hits) / float64(result.Evaluations)
+	}
+	return result
+}
+
+// ValidateAnomalyDetectorConfig checks that a config names a registered
+// detector, a known severity and only that detector's params
+func ValidateAnomalyDetectorConfig(config *models.AnomalyDetectorConfig) error {
+	detector, ok := LookupAnomalyDetector(config.Detector)
+	if !ok {
+		return fmt.Errorf("unknown anomaly detector %q", config.Detector)
+	}
+
+	switch config.Severity {
+	case "", models.SeverityCritical, models.SeverityHigh, models.SeverityMedium, models.SeverityLow, models.SeverityInfo:
+	default:
+		return fmt.Errorf("invalid severity %q", config.Severity)
+	}
+
+	defaults := detector.DefaultParams()
+	for name, value := range config.Params {
+		if _, known := defaults[name]; !known {
+			names := make([]string, 0, len(defaults))
+			for known := range defaults {
+				names = append(names, known)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("detector %s has no param %q (params: %s)", config.Detector, name, strings.Join(names, ", "))
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+			return fmt.Errorf("param %s must be a non-negative number", name)
+		}
+	}
+	return nil
+}
+
+const (
+	anomalyHistoryWindow  = 30 * time.Second // observations of a source kept for the detectors
+	maxAnomalyHistory     = 200              // per source, so a flooding source cannot grow memory unbounded
+	anomalySweepInterval  = time.Minute      // how often sources that went quiet are forgotten
+	crossSourceWindow     = 5 * time.Second  // observations of all sources kept for cross-source detectors
+	maxCrossSourceHistory = 5000             // across sources
+)
+
+// V2XAnomalyDetector runs the registered detectors on V2X events. It keeps
+// the recent observations of each source ID in memory, so detection on one
+// instance sees the messages that instance ingested, and those of the other
+// instances when they share Redis (ANOMALY_SHARED_HISTORY). Cross-source
+// detectors compare the sources seen by this instance.
+type V2XAnomalyDetector struct {
+	mutex     sync.Mutex
+	history   map[string][]V2XObservation
+	recent    []V2XObservation // of all sources, sorted by generation time
+	lastSweep time.Time
+}
+
+var defaultV2XAnomalyDetector = NewV2XAnomalyDetector()
+
+// NewV2XAnomalyDetector creates a detector with empty history
+func NewV2XAnomalyDetector() *V2XAnomalyDetector {
+	return &V2XAnomalyDetector{history: make(map[string][]V2XObservation)}
+}
+
+// record adds an observation to its source's history and returns the earlier
+// observations within the history window, oldest first
+func (d *V2XAnomalyDetector) record(obs V2XObservation) []V2XObservation {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	cutoff := obs.Generated.Add(-anomalyHistoryWindow)
+	kept := d.history[obs.VehicleID][:0:0]
+	var earlier []V2XObservation
+	for _, previous := range d.history[obs.VehicleID] {
+		if previous.Generated.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, previous)
+		if previous.Generated.Before(obs.Generated) {
+			earlier = append(earlier, previous)
+		}
+	}
+
+	// reports may arrive out of order; keep the history sorted by generation time
+	i := sort.Search(len(kept), func(i int) bool { return kept[i].Generated.After(obs.Generated) })
+	kept = append(kept, V2XObservation{})
+	copy(kept[i+1:], kept[i:])
+	kept[i] = obs
+	if len(kept) > maxAnomalyHistory {
+		kept = kept[len(kept)-maxAnomalyHistory:]
+	}
+	d.history[obs.VehicleID] = kept
+	d.recordRecent(obs)
+
+	if now := time.Now(); now.Sub(d.lastSweep) >= anomalySweepInterval {
+		d.lastSweep = now
+		for vehicleID, observations := range d.history {
+			if observations[len(observations)-1].Generated.Before(cutoff) {
+				delete(d.history, vehicleID)
+			}
+		}
+	}
+	return earlier
+}
+
+// recordRecent adds an observation to the cross-source window. The caller holds the mutex.
+func (d *V2XAnomalyDetector) recordRecent(obs V2XObservation) {
+	cutoff := obs.Generated.Add(-crossSourceWindow)
+	start := sort.Search(len(d.recent), func(i int) bool { return !d.recent[i].Generated.Before(cutoff) })
+	if excess := len(d.recent) - start + 1 - maxCrossSourceHistory; excess > 0 {
+		start += excess
+	}
+	recent := append(d.recent[:0:0], d.recent[start:]...)
+
+	i := sort.Search(len(recent), func(i int) bool { return recent[i].Generated.After(obs.Generated) })
+	recent = append(recent, V2XObservation{})
+	copy(recent[i+1:], recent[i:])
+	recent[i] = obs
+	d.recent = recent
+}
+
+// others returns the observations of other sources generated within
+// crossSourceWindow of obs, oldest first
+func (d *V2XAnomalyDetector) others(obs V2XObservation) []V2XObservation {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	from, to := obs.Generated.Add(-crossSourceWindow), obs.Generated.Add(crossSourceWindow)
+	var others []V2XObservation
+	for _, other := range d.recent {
+		if other.Generated.Before(from) || other.Generated.After(to) || other.VehicleID == obs.VehicleID {
+			continue
+		}
+		others = append(others, other)
+	}
+	return others
+}
+
+// Inspect runs the enabled detectors on a V2X event and returns the raw
+// findings to ingest, one per anomaly. Anomalies of muted sources are counted
+// on the mute instead.
+func (d *V2XAnomalyDetector) Inspect(db *gorm.DB, event *models.SecurityEvent) ([][]byte, error) {
+	if event.Category != models.CategoryV2X && event.Category != models.CategoryVehicle {
+		return nil, nil
+	}
+	// findings are V2X events too; they are not messages to inspect
+	if strings.Contains(event.RawData, `"anomaly_type"`) {
+		return nil, nil
+	}
+	obs, ok := ParseV2XObservation(event, "")
+	if !ok {
+		return nil, nil
+	}
+
+	settings, err := GetAnomalyDetectorSettings(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := locateInGeofences(db, &obs); err != nil {
+		return nil, err
+	}
+	history := d.record(obs)
+	if shared := sharedHistory(obs); len(shared) > 0 {
+		history = mergeHistory(obs, history, shared)
+	}
+
+	type detected struct {
+		settings AnomalyDetectorSettings
+		anomaly  *Anomaly
+	}
+	var found []detected
+	var others []V2XObservation
+	othersLoaded := false
+	for _, s := range settings {
+		if !s.Enabled {
+			continue
+		}
+		detector, ok := LookupAnomalyDetector(s.Detector)
+		if !ok {
+			continue
+		}
+		defaultAnomalyDetectorCounts.evaluated(s.Detector)
+		var anomaly *Anomaly
+		if across, ok := detector.(CrossSourceAnomalyDetector); ok {
+			if !othersLoaded {
+				others, othersLoaded = d.others(obs), true
+			}
+			anomaly = across.DetectAcross(obs, history, others, s.Params)
+		} else {
+			anomaly = detector.Detect(obs, history, s.Params)
+		}
+		if anomaly != nil {
+			defaultAnomalyDetectorCounts.hit(s.Detector)
+			found = append(found, detected{settings: s, anomaly: anomaly})
+		}
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+
+	mute, err := FindMute(db, event)
+	if err != nil {
+		return nil, err
+	}
+	if mute != nil {
+		for _, f := range found {
+			anomaliesDetected.Inc(f.settings.Detector, "true")
+			if err := RecordSuppression(db, mute); err != nil {
+				return nil, err
+			}
+			log.Printf("Suppressed %s anomaly for %s, event: %d (source %s %s muted: %s)", f.settings.Detector, obs.VehicleID, event.ID, mute.SourceType, mute.SourceID, mute.Reason)
+		}
+		return nil, nil
+	}
+
+	findings := make([][]byte, 0, len(found))
+	for _, f := range found {
+		anomaliesDetected.Inc(f.settings.Detector, "false")
+		finding, err := anomalyEvent(event, f.settings, f.anomaly)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, finding)
+	}
+	return findings, nil
+}
+
+// DetectAnomalies runs the registered anomaly detectors on an event
+func DetectAnomalies(db *gorm.DB, event *models.SecurityEvent) ([][]byte, error) {
+	return defaultV2XAnomalyDetector.Inspect(db, event)
+}
+
+// anomalyEvent builds the raw security event reporting an anomaly, carrying
+// the V2X fields of the message it was found in
+func anomalyEvent(event *models.SecurityEvent, settings AnomalyDetectorSettings, anomaly *Anomaly) ([]byte, error) {
+	details := map[string]interface{}{
+		"anomaly_type": settings.Detector,
+		"event_id":     event.ID,
+	}
+
+	var raw struct {
+		Details map[string]interface{} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(event.RawData), &raw); err == nil {
+		for _, field := range []string{"vehicle_id", "rsu_id", "location", "radio", "message_type", "certificate_id"} {
+			if value, ok := raw.Details[field]; ok {
+				details[field] = value
+			}
+		}
+	}
+	if _, ok := details["vehicle_id"]; !ok && event.DeviceID != "" {
+		details["vehicle_id"] = event.DeviceID
+	}
+	for key, value := range anomaly.Details {
+		details[key] = value
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"source_name": "v2x-anomaly",
+		"source_type": string(models.SourceTypeApplication),
+		"timestamp":   event.Timestamp,
+		"severity":    string(settings.Severity),
+		"category":    string(models.CategoryV2X),
+		"message":     anomaly.Message,
+		"details":     details,
+	})
+}
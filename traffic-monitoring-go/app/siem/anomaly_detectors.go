@@ -0,0 +1,199 @@
+package siem
+
+import (
+	"fmt"
+	"math"
+
+	"traffic-monitoring-go/app/models"
+)
+
+// The built-in V2X anomaly detectors
+const (
+	AnomalyPositionJump = "position_jump"
+	AnomalySpeedJump    = "speed_jump"
+	AnomalyFrequency    = "frequency"
+	AnomalyOutsideODD   = "outside_odd"
+)
+
+func init() {
+	RegisterAnomalyDetector(positionJumpDetector{})
+	RegisterAnomalyDetector(speedJumpDetector{})
+	RegisterAnomalyDetector(frequencyDetector{})
+	RegisterAnomalyDetector(outsideODDDetector{})
+}
+
+// lastWith returns the latest observation of history satisfying ok
+func lastWith(history []V2XObservation, ok func(V2XObservation) bool) (V2XObservation, bool) {
+	for i := len(history) - 1; i >= 0; i-- {
+		if ok(history[i]) {
+			return history[i], true
+		}
+	}
+	return V2XObservation{}, false
+}
+
+// positionJumpDetector flags a source whose consecutive positions imply a
+// speed no vehicle reaches
+type positionJumpDetector struct{}
+
+func (positionJumpDetector) Name() string { return AnomalyPositionJump }
+
+func (positionJumpDetector) Description() string {
+	return "Consecutive positions of a source further apart than max_speed_mps allows; jumps below min_distance_m are GNSS noise"
+}
+
+func (positionJumpDetector) DefaultSeverity() models.EventSeverity { return models.SeverityMedium }
+
+func (positionJumpDetector) DefaultParams() AnomalyParams {
+	return AnomalyParams{"max_speed_mps": 70, "min_distance_m": 50}
+}
+
+func (positionJumpDetector) Detect(obs V2XObservation, history []V2XObservation, params AnomalyParams) *Anomaly {
+	if !obs.HasLocation {
+		return nil
+	}
+	previous, ok := lastWith(history, func(o V2XObservation) bool { return o.HasLocation })
+	if !ok {
+		return nil
+	}
+
+	seconds := obs.Generated.Sub(previous.Generated).Seconds()
+	distance := DistanceMeters(previous.Latitude, previous.Longitude, obs.Latitude, obs.Longitude)
+	if seconds <= 0 || distance < params["min_distance_m"] || distance/seconds <= params["max_speed_mps"] {
+		return nil
+	}
+	return &Anomaly{
+		Message: fmt.Sprintf("V2X source %s moved %.0fm in %.1fs (%.0f m/s)", obs.VehicleID, distance, seconds, distance/seconds),
+		Details: map[string]interface{}{
+			"distance_m":        math.Round(distance),
+			"interval_s":        seconds,
+			"implied_speed_mps": math.Round(distance / seconds),
+		},
+	}
+}
+
+// speedJumpDetector flags a source whose reported speed changes faster than
+// any vehicle accelerates or brakes
+type speedJumpDetector struct{}
+
+func (speedJumpDetector) Name() string { return AnomalySpeedJump }
+
+func (speedJumpDetector) Description() string {
+	return "Reported speed changing by more than max_change_per_second (in the unit of the reports) between consecutive reports"
+}
+
+func (speedJumpDetector) DefaultSeverity() models.EventSeverity { return models.SeverityMedium }
+
+func (speedJumpDetector) DefaultParams() AnomalyParams {
+	return AnomalyParams{"max_change_per_second": 40, "min_interval_s": 0.1}
+}
+
+func (speedJumpDetector) Detect(obs V2XObservation, history []V2XObservation, params AnomalyParams) *Anomaly {
+	if !obs.HasSpeed {
+		return nil
+	}
+	previous, ok := lastWith(history, func(o V2XObservation) bool { return o.HasSpeed })
+	if !ok {
+		return nil
+	}
+
+	// closely spaced reports would turn rounding into huge rates
+	seconds := math.Max(obs.Generated.Sub(previous.Generated).Seconds(), params["min_interval_s"])
+	change := math.Abs(obs.Speed - previous.Speed)
+	if seconds <= 0 || change/seconds <= params["max_change_per_second"] {
+		return nil
+	}
+	return &Anomaly{
+		Message: fmt.Sprintf("V2X source %s speed changed from %.1f to %.1f in %.1fs", obs.VehicleID, previous.Speed, obs.Speed, seconds),
+		Details: map[string]interface{}{
+			"previous_speed": previous.Speed,
+			"speed":          obs.Speed,
+			"interval_s":     seconds,
+		},
+	}
+}
+
+// frequencyDetector flags a source sending more messages than a V2X stack
+// generates, as when messages are replayed or one radio fakes several sources
+type frequencyDetector struct{}
+
+func (frequencyDetector) Name() string { return AnomalyFrequency }
+
+func (frequencyDetector) Description() string {
+	return "More than max_messages messages from a source within window_s seconds; reported once per burst"
+}
+
+func (frequencyDetector) DefaultSeverity() models.EventSeverity { return models.SeverityLow }
+
+func (frequencyDetector) DefaultParams() AnomalyParams {
+	return AnomalyParams{"max_messages": 20, "window_s": 1}
+}
+
+func (frequencyDetector) Detect(obs V2XObservation, history []V2XObservation, params AnomalyParams) *Anomaly {
+	window := params["window_s"]
+	count := 1
+	for i := len(history) - 1; i >= 0; i-- {
+		if obs.Generated.Sub(history[i].Generated).Seconds() > window {
+			break
+		}
+		count++
+	}
+
+	// only the message crossing the limit is reported, not every one after it
+	limit := int(params["max_messages"])
+	if count != limit+1 {
+		return nil
+	}
+	return &Anomaly{
+		Message: fmt.Sprintf("V2X source %s sent %d messages within %gs", obs.VehicleID, count, window),
+		Details: map[string]interface{}{
+			"messages": count,
+			"window_s": window,
+		},
+	}
+}
+
+// outsideODDDetector flags a source leaving the operational design domain,
+// the geofences of kind odd. It does nothing while there are none.
+type outsideODDDetector struct{}
+
+func (outsideODDDetector) Name() string { return AnomalyOutsideODD }
+
+func (outsideODDDetector) Description() string {
+	return "A source reporting min_reports consecutive positions outside every geofence of kind odd (operational design domain); reported once per exit"
+}
+
+func (outsideODDDetector) DefaultSeverity() models.EventSeverity { return models.SeverityMedium }
+
+func (outsideODDDetector) DefaultParams() AnomalyParams {
+	return AnomalyParams{"min_reports": 2} // a single position just outside can be GNSS error
+}
+
+func (outsideODDDetector) Detect(obs V2XObservation, history []V2XObservation, params AnomalyParams) *Anomaly {
+	outside := func(o V2XObservation) bool { return o.HasLocation && o.HasODD && !o.InODD }
+	if !outside(obs) {
+		return nil
+	}
+
+	// only the report completing min_reports is flagged, not every one after it
+	required := int(math.Max(params["min_reports"], 1))
+	count := 1
+	for i := len(history) - 1; i >= 0 && count <= required; i-- {
+		if !history[i].HasLocation || !history[i].HasODD {
+			continue
+		}
+		if !outside(history[i]) {
+			break
+		}
+		count++
+	}
+	if count != required {
+		return nil
+	}
+	return &Anomaly{
+		Message: fmt.Sprintf("V2X source %s is outside the operational design domain", obs.VehicleID),
+		Details: map[string]interface{}{
+			"reports_outside": count,
+		},
+	}
+}
@@ -0,0 +1,200 @@
+package siem
+
+import (
+	"fmt"
+	"math"
+
+	"traffic-monitoring-go/app/models"
+)
+
+// AnomalyKinematicImplausible is reported when a report cannot follow from the
+// source's recent track under any physically possible motion
+const AnomalyKinematicImplausible = "kinematic_implausible"
+
+func init() {
+	RegisterAnomalyDetector(kinematicDetector{})
+}
+
+// trackPoint is an observation in a plane tangent at the source's previous
+// position, with speeds in m/s
+type trackPoint struct {
+	t, x, y     float64 // seconds and meters relative to the previous report
+	speed       float64
+	hasSpeed    bool
+	heading     float64
+	hasHeading  bool
+	vx, vy      float64 // velocity, reported or derived from the point before
+	hasVelocity bool
+}
+
+// kinematicDetector keeps a short track of each source and checks every
+// report against a constant-acceleration prediction from it: the position
+// must lie within reach of the predicted one, speed may change no faster than
+// max_accel_mps2, the displacement must agree with the reported speeds, and
+// the heading must turn no faster than max_yaw_rate_dps and point along the
+// direction of travel
+type kinematicDetector struct{}
+
+func (kinematicDetector) Name() string { return AnomalyKinematicImplausible }
+
+func (kinematicDetector) Description() string {
+	return "Reports whose position, speed or heading cannot follow from the source's track under a constant-acceleration model bounded by max_accel_mps2 and max_yaw_rate_dps; reported speeds are converted with speed_to_mps"
+}
+
+func (kinematicDetector) DefaultSeverity() models.EventSeverity { return models.SeverityMedium }
+
+func (kinematicDetector) DefaultParams() AnomalyParams {
+	return AnomalyParams{
+		"max_accel_mps2":            10, // hard braking is about 8-10 m/s²
+		"max_yaw_rate_dps":          60, // at speeds above min_turn_speed_mps
+		"min_turn_speed_mps":        3,  // below it vehicles turn in place and headings are noisy
+		"max_heading_deviation_deg": 60, // between heading and direction of travel
+		"heading_tolerance_deg":     10,
+		"position_tolerance_m":      15, // GNSS error
+		"speed_tolerance_mps":       2,
+		"speed_to_mps":              0.2778, // reports in km/h; 1 for m/s
+		"max_gap_s":                 5,      // older reports do not constrain the next one
+	}
+}
+
+// kinematicTrack returns the located reports at the end of history separated by gaps
+// of at most maxGap, at most three, oldest first
+func kinematicTrack(obs V2XObservation, history []V2XObservation, maxGap float64) []V2XObservation {
+	var track []V2XObservation
+	next := obs
+	for i := len(history) - 1; i >= 0 && len(track) < 3; i-- {
+		previous := history[i]
+		if !previous.HasLocation {
+			continue
+		}
+		if gap := next.Generated.Sub(previous.Generated).Seconds(); gap <= 0 || gap > maxGap {
+			break
+		}
+		track = append([]V2XObservation{previous}, track...)
+		next = previous
+	}
+	return track
+}
+
+func (kinematicDetector) Detect(obs V2XObservation, history []V2XObservation, params AnomalyParams) *Anomaly {
+	if !obs.HasLocation {
+		return nil
+	}
+	track := kinematicTrack(obs, history, params["max_gap_s"])
+	if len(track) == 0 {
+		return nil
+	}
+
+	origin := track[len(track)-1]
+	points := make([]trackPoint, 0, len(track)+1)
+	for i, o := range append(track, obs) {
+		p := trackPoint{t: o.Generated.Sub(origin.Generated).Seconds()}
+		p.x, p.y = LocalOffsetMeters(origin.Latitude, origin.Longitude, o.Latitude, o.Longitude)
+		if o.HasSpeed {
+			p.speed, p.hasSpeed = o.Speed*params["speed_to_mps"], true
+		}
+		p.heading, p.hasHeading = o.Heading, o.HasHeading
+		switch {
+		case p.hasSpeed && p.hasHeading:
+			rad := p.heading * math.Pi / 180
+			p.vx, p.vy, p.hasVelocity = p.speed*math.Sin(rad), p.speed*math.Cos(rad), true
+		case i > 0 && p.t > points[i-1].t:
+			dt := p.t - points[i-1].t
+			p.vx, p.vy, p.hasVelocity = (p.x-points[i-1].x)/dt, (p.y-points[i-1].y)/dt, true
+		}
+		points = append(points, p)
+	}
+
+	current, previous := points[len(points)-1], points[len(points)-2]
+	dt := current.t - previous.t
+	maxAccel := params["max_accel_mps2"]
+	reach := params["position_tolerance_m"] + 0.5*maxAccel*dt*dt
+	displacement := math.Hypot(current.x-previous.x, current.y-previous.y)
+
+	implausible := func(check, reason string, details map[string]interface{}) *Anomaly {
+		details["check"] = check
+		details["interval_s"] = math.Round(dt*1000) / 1000
+		details["track_length"] = len(track)
+		return &Anomaly{
+			Message: fmt.Sprintf("V2X source %s report is kinematically implausible: %s", obs.VehicleID, reason),
+			Details: details,
+		}
+	}
+
+	// the position must be reachable from the prediction of the track
+	if previous.hasVelocity {
+		ax, ay := 0.0, 0.0
+		if len(points) >= 3 && points[len(points)-3].hasVelocity {
+			before := points[len(points)-3]
+			if span := previous.t - before.t; span > 0 {
+				ax, ay = (previous.vx-before.vx)/span, (previous.vy-before.vy)/span
+				// the estimate is noisy; never predict more than the bound
+				if a := math.Hypot(ax, ay); a > maxAccel {
+					ax, ay = ax*maxAccel/a, ay*maxAccel/a
+				}
+			}
+		}
+		predictedX := previous.x + previous.vx*dt + 0.5*ax*dt*dt
+		predictedY := previous.y + previous.vy*dt + 0.5*ay*dt*dt
+		residual := math.Hypot(current.x-predictedX, current.y-predictedY)
+		// a changed acceleration can move the vehicle by up to a·dt² from the prediction
+		if residual > params["position_tolerance_m"]+maxAccel*dt*dt {
+			return implausible("position", fmt.Sprintf("%.0fm from the position predicted by its track", residual), map[string]interface{}{
+				"residual_m": math.Round(residual),
+			})
+		}
+	}
+
+	// speed can change no faster than the vehicle accelerates or brakes
+	if current.hasSpeed && previous.hasSpeed {
+		change := math.Abs(current.speed - previous.speed)
+		if change > maxAccel*dt+params["speed_tolerance_mps"] {
+			return implausible("speed", fmt.Sprintf("speed changed by %.1f m/s in %.1fs", change, dt), map[string]interface{}{
+				"speed_change_mps": math.Round(change*10) / 10,
+			})
+		}
+
+		// the distance covered must match the reported speeds
+		expected := (current.speed + previous.speed) / 2 * dt
+		if math.Abs(displacement-expected) > reach+params["speed_tolerance_mps"]*dt {
+			return implausible("displacement", fmt.Sprintf("moved %.0fm while its speed implies %.0fm", displacement, expected), map[string]interface{}{
+				"displacement_m": math.Round(displacement),
+				"expected_m":     math.Round(expected),
+			})
+		}
+	}
+
+	if current.hasHeading {
+		moving := current.hasSpeed && current.speed >= params["min_turn_speed_mps"]
+
+		// headings turn no faster than the vehicle can steer
+		if moving && previous.hasHeading {
+			turn := headingDifference(current.heading, previous.heading)
+			if turn > params["max_yaw_rate_dps"]*dt+params["heading_tolerance_deg"] {
+				return implausible("heading", fmt.Sprintf("heading turned %.0f° in %.1fs", turn, dt), map[string]interface{}{
+					"heading_change_deg": math.Round(turn),
+				})
+			}
+		}
+
+		// a moving vehicle travels along its heading
+		if moving && displacement > 2*params["position_tolerance_m"] {
+			travel := math.Atan2(current.x-previous.x, current.y-previous.y) * 180 / math.Pi
+			if deviation := headingDifference(current.heading, travel); deviation > params["max_heading_deviation_deg"] {
+				return implausible("direction", fmt.Sprintf("heading %.0f° but travelling towards %.0f°", current.heading, math.Mod(travel+360, 360)), map[string]interface{}{
+					"heading_deviation_deg": math.Round(deviation),
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// headingDifference returns the smallest angle between two headings in degrees
+func headingDifference(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
@@ -0,0 +1,73 @@
+package siem
+
+import (
+	"fmt"
+	"strings"
+
+	"traffic-monitoring-go/app/eventschema"
+	"traffic-monitoring-go/app/models"
+)
+
+// AnomalyGhostPriorityRequest is reported when a source asks an intersection
+// for signal priority without broadcasting the BSMs a vehicle on its way would
+const AnomalyGhostPriorityRequest = "ghost_priority_request"
+
+func init() {
+	RegisterAnomalyDetector(ghostPriorityRequestDetector{})
+}
+
+// ghostPriorityRequestDetector flags the signal requests (SRMs) of sources
+// that sent no located BSM shortly before, as a sender faking an emergency
+// vehicle to preempt the signals does
+type ghostPriorityRequestDetector struct{}
+
+func (ghostPriorityRequestDetector) Name() string { return AnomalyGhostPriorityRequest }
+
+func (ghostPriorityRequestDetector) Description() string {
+	return "A new signal request (SRM) from a source that sent fewer than min_bsms located basic safety messages within window_s seconds before it; reported once per request"
+}
+
+func (ghostPriorityRequestDetector) DefaultSeverity() models.EventSeverity {
+	return models.SeverityHigh
+}
+
+func (ghostPriorityRequestDetector) DefaultParams() AnomalyParams {
+	return AnomalyParams{"min_bsms": 1, "window_s": 5}
+}
+
+func (ghostPriorityRequestDetector) Detect(obs V2XObservation, history []V2XObservation, params AnomalyParams) *Anomaly {
+	if !strings.EqualFold(obs.MessageType, eventschema.MessageSRM) || obs.RequestType == eventschema.RequestCancel {
+		return nil
+	}
+
+	bsms := 0
+	for _, previous := range history {
+		// only the first SRM of a request is checked, not every renewal
+		if strings.EqualFold(previous.MessageType, eventschema.MessageSRM) &&
+			previous.IntersectionID == obs.IntersectionID && previous.RequestID == obs.RequestID {
+			return nil
+		}
+		if strings.EqualFold(previous.MessageType, eventschema.MessageBasicSafety) && previous.HasLocation &&
+			obs.Generated.Sub(previous.Generated).Seconds() <= params["window_s"] {
+			bsms++
+		}
+	}
+	if float64(bsms) >= params["min_bsms"] {
+		return nil
+	}
+
+	role := obs.RequesterRole
+	if role == "" {
+		role = "unknown"
+	}
+	return &Anomaly{
+		Message: fmt.Sprintf("V2X source %s requested %s signal priority at intersection %d without broadcasting BSMs", obs.VehicleID, role, obs.IntersectionID),
+		Details: map[string]interface{}{
+			"intersection_id": obs.IntersectionID,
+			"request_id":      obs.RequestID,
+			"requester_role":  obs.RequesterRole,
+			"bsms":            bsms,
+			"window_s":        params["window_s"],
+		},
+	}
+}
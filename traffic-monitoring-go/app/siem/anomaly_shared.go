@@ -0,0 +1,94 @@
+package siem
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/logging"
+)
+
+var anomalySharedHistory = config.NewBool("ANOMALY_SHARED_HISTORY", true,
+	"Share the recent observations of each V2X source ID between instances through Redis, when REDIS_URL is set, so the detectors see the messages every instance ingested",
+	config.Reloadable)
+
+// anomalyLog is the logger of the anomaly detection
+var anomalyLog = logging.New("anomaly")
+
+// sharedHistory records obs in the history of its source ID in Redis and
+// returns the observations recorded there before it, by any instance. It
+// returns nil when the instances share no Redis or it did not answer, and
+// detection goes on with the history of this instance.
+func sharedHistory(obs V2XObservation) []V2XObservation {
+	r := cache.Shared()
+	if r == nil || !anomalySharedHistory.Get() {
+		return nil
+	}
+	data, err := json.Marshal(obs)
+	if err != nil {
+		return nil
+	}
+
+	key := cache.Key("v2x", "history", obs.VehicleID)
+	replies, err := r.Pipeline(
+		[]string{"LRANGE", key, "0", "-1"},
+		[]string{"RPUSH", key, string(data)},
+		[]string{"LTRIM", key, strconv.Itoa(-maxAnomalyHistory), "-1"},
+		[]string{"PEXPIRE", key, strconv.FormatInt(anomalyHistoryWindow.Milliseconds(), 10)},
+	)
+	if err != nil {
+		cache.RecordFailure("v2x_history")
+		anomalyLog.Sampled("anomaly.shared_history").Warn("failed to read the shared history of a V2X source, using this instance's",
+			"vehicle_id", obs.VehicleID, "error", err)
+		return nil
+	}
+
+	items, _ := replies[0].([]interface{})
+	shared := make([]V2XObservation, 0, len(items))
+	for _, item := range items {
+		text, ok := item.(string)
+		if !ok {
+			continue
+		}
+		var previous V2XObservation
+		if err := json.Unmarshal([]byte(text), &previous); err != nil {
+			continue
+		}
+		shared = append(shared, previous)
+	}
+	return shared
+}
+
+// mergeHistory adds the shared observations of obs's source to the local
+// history: those generated before obs within the history window that the
+// local history lacks, keeping it sorted by generation time and bounded
+func mergeHistory(obs V2XObservation, local, shared []V2XObservation) []V2XObservation {
+	seen := make(map[uint]bool, len(local))
+	for _, previous := range local {
+		seen[previous.EventID] = true
+	}
+
+	cutoff := obs.Generated.Add(-anomalyHistoryWindow)
+	merged := append([]V2XObservation(nil), local...)
+	for _, previous := range shared {
+		if seen[previous.EventID] || previous.EventID == obs.EventID {
+			continue
+		}
+		if previous.Generated.Before(cutoff) || !previous.Generated.Before(obs.Generated) {
+			continue
+		}
+		seen[previous.EventID] = true
+		merged = append(merged, previous)
+	}
+	if len(merged) == len(local) {
+		return local
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Generated.Before(merged[j].Generated) })
+	if len(merged) > maxAnomalyHistory {
+		merged = merged[len(merged)-maxAnomalyHistory:]
+	}
+	return merged
+}
@@ -0,0 +1,155 @@
+package siem
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"traffic-monitoring-go/app/models"
+)
+
+// AnomalySybilSuspected is reported when several source IDs appear to be sent
+// by one transmitter
+const AnomalySybilSuspected = "sybil_suspected"
+
+// maxSybilIDs bounds the IDs listed in a finding
+const maxSybilIDs = 20
+
+func init() {
+	RegisterAnomalyDetector(sybilDetector{})
+}
+
+// sybilDetector flags a source ID that looks like one of several identities of
+// a single transmitter: other IDs share its fingerprint, the receiver and
+// RSSI of their messages (or their source IP when match_source_ip is 1), or
+// report positions overlapping its own, which distinct vehicles cannot
+type sybilDetector struct{}
+
+func (sybilDetector) Name() string { return AnomalySybilSuspected }
+
+func (sybilDetector) Description() string {
+	return "More than max_ids_per_fingerprint source IDs received at one receiver within rssi_tolerance_db of each other (or from one source IP when match_source_ip is 1) within window_s, or min_overlapping_ids IDs reporting positions within overlap_radius_m of each other; reported once per episode"
+}
+
+func (sybilDetector) DefaultSeverity() models.EventSeverity { return models.SeverityHigh }
+
+func (sybilDetector) DefaultParams() AnomalyParams {
+	return AnomalyParams{
+		"window_s":                2,
+		"max_ids_per_fingerprint": 3,
+		"rssi_tolerance_db":       1.5,
+		"match_source_ip":         0, // RSUs forwarding for many vehicles share one address
+		"overlap_radius_m":        2,
+		"overlap_window_s":        0.5,
+		"min_overlapping_ids":     3, // two cars side by side can come close with GNSS error
+	}
+}
+
+// Detect is not used; the detector runs with DetectAcross
+func (sybilDetector) Detect(V2XObservation, []V2XObservation, AnomalyParams) *Anomaly {
+	return nil
+}
+
+func (d sybilDetector) DetectAcross(obs V2XObservation, history, others []V2XObservation, params AnomalyParams) *Anomaly {
+	match := d.match(obs, others, params)
+	if match == nil {
+		return nil
+	}
+
+	// report an episode once, not on every message sent during it
+	if len(history) > 0 {
+		previous := history[len(history)-1]
+		if obs.Generated.Sub(previous.Generated).Seconds() <= params["window_s"] {
+			if earlier := d.match(previous, others, params); earlier != nil && earlier.check == match.check {
+				return nil
+			}
+		}
+	}
+
+	ids := match.ids
+	if len(ids) > maxSybilIDs {
+		ids = ids[:maxSybilIDs]
+	}
+	match.details["check"] = match.check
+	match.details["sybil_ids"] = ids
+	match.details["id_count"] = len(match.ids) + 1
+	return &Anomaly{Message: match.message, Details: match.details}
+}
+
+// sybilMatch is what ties an observation to other source IDs
+type sybilMatch struct {
+	check   string // fingerprint or overlap
+	ids     []string
+	message string
+	details map[string]interface{}
+}
+
+// match checks an observation against the latest observations of the other
+// sources before it
+func (sybilDetector) match(obs V2XObservation, others []V2XObservation, params AnomalyParams) *sybilMatch {
+	matchIP := params["match_source_ip"] >= 1 && obs.SourceIP != ""
+	if matchIP || (obs.HasRSSI && obs.Receiver != "") {
+		latest := latestBySource(others, obs.Generated, params["window_s"], func(o V2XObservation) bool {
+			return (matchIP && o.SourceIP == obs.SourceIP) || o.Receiver == obs.Receiver
+		})
+		var ids []string
+		for id, other := range latest {
+			sameIP := matchIP && other.SourceIP == obs.SourceIP
+			sameSignal := obs.HasRSSI && other.HasRSSI && obs.Receiver != "" && other.Receiver == obs.Receiver &&
+				math.Abs(other.RSSI-obs.RSSI) <= params["rssi_tolerance_db"]
+			if sameIP || sameSignal {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) >= int(params["max_ids_per_fingerprint"]) && len(ids) > 0 {
+			sort.Strings(ids)
+			details := map[string]interface{}{"receiver": obs.Receiver}
+			if obs.HasRSSI {
+				details["rssi_dbm"] = obs.RSSI
+			}
+			if matchIP {
+				details["source_ip"] = obs.SourceIP
+			}
+			return &sybilMatch{
+				check:   "fingerprint",
+				ids:     ids,
+				message: fmt.Sprintf("V2X source %s shares a transmitter fingerprint with %d other IDs at %s", obs.VehicleID, len(ids), obs.Receiver),
+				details: details,
+			}
+		}
+	}
+
+	if obs.HasLocation {
+		latest := latestBySource(others, obs.Generated, params["overlap_window_s"], func(o V2XObservation) bool { return o.HasLocation })
+		var ids []string
+		for id, other := range latest {
+			if DistanceMeters(obs.Latitude, obs.Longitude, other.Latitude, other.Longitude) <= params["overlap_radius_m"] {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 && len(ids)+1 >= int(params["min_overlapping_ids"]) {
+			sort.Strings(ids)
+			return &sybilMatch{
+				check:   "overlap",
+				ids:     ids,
+				message: fmt.Sprintf("V2X source %s reports a position within %gm of %d other IDs", obs.VehicleID, params["overlap_radius_m"], len(ids)),
+				details: map[string]interface{}{"radius_m": params["overlap_radius_m"]},
+			}
+		}
+	}
+	return nil
+}
+
+// latestBySource returns the latest observation of each source generated at
+// most window seconds before at, among those satisfying ok
+func latestBySource(observations []V2XObservation, at time.Time, window float64, ok func(V2XObservation) bool) map[string]V2XObservation {
+	latest := make(map[string]V2XObservation)
+	for _, o := range observations {
+		if o.Generated.After(at) || at.Sub(o.Generated).Seconds() > window || !ok(o) {
+			continue
+		}
+		latest[o.VehicleID] = o
+	}
+	return latest
+}
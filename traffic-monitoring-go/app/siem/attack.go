@@ -0,0 +1,234 @@
+package siem
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+)
+
+// AttackTechnique is a MITRE ATT&CK technique rules can be tagged with
+type AttackTechnique struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Tactics []string `json:"tactics"`
+}
+
+// AttackTechniques are the ATT&CK (Enterprise and ICS) techniques relevant to
+// a traffic and V2X SIEM. Rules may also be tagged with techniques not listed.
+var AttackTechniques = []AttackTechnique{
+	{ID: "T1040", Name: "Network Sniffing", Tactics: []string{"credential-access", "discovery"}},
+	{ID: "T1046", Name: "Network Service Discovery", Tactics: []string{"discovery"}},
+	{ID: "T1070", Name: "Indicator Removal", Tactics: []string{"defense-evasion"}},
+	{ID: "T1071", Name: "Application Layer Protocol", Tactics: []string{"command-and-control"}},
+	{ID: "T1078", Name: "Valid Accounts", Tactics: []string{"initial-access", "persistence", "privilege-escalation", "defense-evasion"}},
+	{ID: "T1110", Name: "Brute Force", Tactics: []string{"credential-access"}},
+	{ID: "T1133", Name: "External Remote Services", Tactics: []string{"initial-access", "persistence"}},
+	{ID: "T1190", Name: "Exploit Public-Facing Application", Tactics: []string{"initial-access"}},
+	{ID: "T1204", Name: "User Execution", Tactics: []string{"execution"}},
+	{ID: "T1498", Name: "Network Denial of Service", Tactics: []string{"impact"}},
+	{ID: "T1499", Name: "Endpoint Denial of Service", Tactics: []string{"impact"}},
+	{ID: "T1557", Name: "Adversary-in-the-Middle", Tactics: []string{"credential-access", "collection"}},
+	{ID: "T1562", Name: "Impair Defenses", Tactics: []string{"defense-evasion"}},
+	{ID: "T1565", Name: "Data Manipulation", Tactics: []string{"impact"}},
+	{ID: "T1595", Name: "Active Scanning", Tactics: []string{"reconnaissance"}},
+	{ID: "T0814", Name: "Denial of Service", Tactics: []string{"inhibit-response-function"}},
+	{ID: "T0830", Name: "Adversary-in-the-Middle (ICS)", Tactics: []string{"collection"}},
+	{ID: "T0831", Name: "Manipulation of Control", Tactics: []string{"impact"}},
+	{ID: "T0832", Name: "Manipulation of View", Tactics: []string{"impact"}},
+	{ID: "T0855", Name: "Unauthorized Command Message", Tactics: []string{"impair-process-control"}},
+	{ID: "T0856", Name: "Spoof Reporting Message", Tactics: []string{"evasion", "impair-process-control"}},
+}
+
+// techniqueID matches technique and sub-technique IDs such as T1557 and T1110.001
+var techniqueID = regexp.MustCompile(`^T\d{4}(\.\d{3})?$`)
+
+// NormalizeTechniques uppercases, validates and deduplicates technique IDs
+func NormalizeTechniques(techniques []string) ([]string, error) {
+	normalized := make([]string, 0, len(techniques))
+	seen := make(map[string]bool)
+	for _, technique := range techniques {
+		technique = strings.ToUpper(strings.TrimSpace(technique))
+		if !techniqueID.MatchString(technique) {
+			return nil, fmt.Errorf("invalid ATT&CK technique ID %q, expected e.g. T1557 or T1110.001", technique)
+		}
+		if !seen[technique] {
+			seen[technique] = true
+			normalized = append(normalized, technique)
+		}
+	}
+	return normalized, nil
+}
+
+// parentTechnique returns T1110 for T1110.001, and the ID itself otherwise
+func parentTechnique(technique string) string {
+	if i := strings.IndexByte(technique, '.'); i >= 0 {
+		return technique[:i]
+	}
+	return technique
+}
+
+// jsonbArrayElements expands a JSONB tag column into one row per tag, treating
+// NULL and non-array values as no tags
+func jsonbArrayElements(column string) string {
+	return fmt.Sprintf("jsonb_array_elements_text(CASE WHEN jsonb_typeof(%s) = 'array' THEN %s ELSE '[]'::jsonb END)", column, column)
+}
+
+// FilterByTechnique restricts query to rows of table tagged with technique or,
+// for a technique, any of its sub-techniques
+func FilterByTechnique(query *gorm.DB, table, technique string) *gorm.DB {
+	technique = strings.ToUpper(strings.TrimSpace(technique))
+	return query.Where(
+		fmt.Sprintf("EXISTS (SELECT 1 FROM %s AS technique(id) WHERE technique.id = ? OR technique.id LIKE ?)", jsonbArrayElements(table+".techniques")),
+		technique, technique+".%",
+	)
+}
+
+// TechniqueCoverage is the detection coverage of one technique
+type TechniqueCoverage struct {
+	AttackTechnique
+	Status       string     `json:"status"` // fired, covered, disabled or uncovered
+	Rules        []string   `json:"rules"`
+	EnabledRules int        `json:"enabled_rules"`
+	Alerts       int64      `json:"alerts"` // in the coverage window
+	LastAlertAt  *time.Time `json:"last_alert_at,omitempty"`
+}
+
+// TacticCoverage counts the covered techniques of a tactic
+type TacticCoverage struct {
+	Tactic     string `json:"tactic"`
+	Techniques int    `json:"techniques"`
+	Covered    int    `json:"covered"`
+	Fired      int    `json:"fired"`
+}
+
+// AttackCoverage maps the rules and recent alerts onto ATT&CK techniques
+type AttackCoverage struct {
+	Since      time.Time           `json:"since"`
+	Techniques []TechniqueCoverage `json:"techniques"`
+	Tactics    []TacticCoverage    `json:"tactics"`
+	Covered    int                 `json:"covered"`
+	Fired      int                 `json:"fired"`
+}
+
+// ComputeAttackCoverage reports which techniques have rules and which had
+// alerts since the given time. A rule tagged with a sub-technique also covers
+// its parent technique.
+func ComputeAttackCoverage(db *gorm.DB, since time.Time) (*AttackCoverage, error) {
+	readDB := database.ReadDB(db)
+
+	entries := make(map[string]*TechniqueCoverage)
+	entry := func(id string) *TechniqueCoverage {
+		if e, ok := entries[id]; ok {
+			return e
+		}
+		e := &TechniqueCoverage{AttackTechnique: AttackTechnique{ID: id, Tactics: []string{}}, Rules: []string{}}
+		entries[id] = e
+		return e
+	}
+	for _, technique := range AttackTechniques {
+		entry(technique.ID).AttackTechnique = technique
+	}
+
+	var rules []models.Rule
+	if err := readDB.Select("id", "name", "status", "techniques").Order("name ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		tagged := make(map[string]bool)
+		for _, technique := range rule.Techniques {
+			tagged[technique] = true
+			tagged[parentTechnique(technique)] = true
+		}
+		for id := range tagged {
+			e := entry(id)
+			e.Rules = append(e.Rules, rule.Name)
+			if rule.Status == models.RuleStatusEnabled {
+				e.EnabledRules++
+			}
+		}
+	}
+
+	var rows []struct {
+		Technique string
+		Alerts    int64
+		LastAlert time.Time
+	}
+	err := readDB.Table("alerts").
+		Select("technique.id AS technique, COUNT(*) AS alerts, MAX(alerts.timestamp) AS last_alert").
+		Joins("CROSS JOIN LATERAL "+jsonbArrayElements("alerts.techniques")+" AS technique(id)").
+		Where("alerts.timestamp >= ?", since).
+		Group("technique.id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		ids := []string{row.Technique}
+		if parent := parentTechnique(row.Technique); parent != row.Technique {
+			ids = append(ids, parent)
+		}
+		for _, id := range ids {
+			e := entry(id)
+			e.Alerts += row.Alerts
+			if e.LastAlertAt == nil || row.LastAlert.After(*e.LastAlertAt) {
+				last := row.LastAlert
+				e.LastAlertAt = &last
+			}
+		}
+	}
+
+	coverage := &AttackCoverage{Since: since, Techniques: make([]TechniqueCoverage, 0, len(entries))}
+	tactics := make(map[string]*TacticCoverage)
+	for _, e := range entries {
+		switch {
+		case e.Alerts > 0:
+			e.Status = "fired"
+		case e.EnabledRules > 0:
+			e.Status = "covered"
+		case len(e.Rules) > 0:
+			e.Status = "disabled"
+		default:
+			e.Status = "uncovered"
+		}
+		if e.Status == "fired" {
+			coverage.Fired++
+		}
+		if e.EnabledRules > 0 {
+			coverage.Covered++
+		}
+
+		for _, tactic := range e.Tactics {
+			t, ok := tactics[tactic]
+			if !ok {
+				t = &TacticCoverage{Tactic: tactic}
+				tactics[tactic] = t
+			}
+			t.Techniques++
+			if e.EnabledRules > 0 {
+				t.Covered++
+			}
+			if e.Status == "fired" {
+				t.Fired++
+			}
+		}
+		coverage.Techniques = append(coverage.Techniques, *e)
+	}
+
+	sort.Slice(coverage.Techniques, func(i, j int) bool {
+		return coverage.Techniques[i].ID < coverage.Techniques[j].ID
+	})
+	coverage.Tactics = make([]TacticCoverage, 0, len(tactics))
+	for _, t := range tactics {
+		coverage.Tactics = append(coverage.Tactics, *t)
+	}
+	sort.Slice(coverage.Tactics, func(i, j int) bool {
+		return coverage.Tactics[i].Tactic < coverage.Tactics[j].Tactic
+	})
+	return coverage, nil
+}
@@ -0,0 +1,140 @@
+package clock
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+)
+
+// Clock is the source of "now" for ingestion, rule evaluation and dashboards
+type Clock interface {
+	// Now returns the current time as seen by this clock
+	Now() time.Time
+}
+
+// Observer is implemented by clocks that derive their time from observed event timestamps
+type Observer interface {
+	// Observe feeds a message timestamp into the clock
+	Observe(t time.Time)
+}
+
+// RealClock reads the system wall clock
+type RealClock struct{}
+
+// Now returns time.Now()
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a manually controlled clock for deterministic tests
+type FakeClock struct {
+	now   time.Time
+	mutex sync.Mutex
+}
+
+// NewFakeClock creates a FakeClock frozen at the given time
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t}
+}
+
+// Now returns the frozen time
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Set moves the clock to the given time
+func (c *FakeClock) Set(t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = t
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// ReplayClock derives "now" from the latest message timestamp it has observed.
+// It is used when replaying captured traffic so time windows follow the data
+// rather than the wall clock. Until a timestamp is observed it defers to Fallback.
+type ReplayClock struct {
+	Fallback Clock
+	latest   time.Time
+	mutex    sync.RWMutex
+}
+
+// NewReplayClock creates a ReplayClock that falls back to the real clock
+func NewReplayClock() *ReplayClock {
+	return &ReplayClock{Fallback: RealClock{}}
+}
+
+// Observe advances the clock if t is later than anything seen so far.
+// Out-of-order timestamps never move the clock backwards.
+func (c *ReplayClock) Observe(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if t.After(c.latest) {
+		c.latest = t
+	}
+}
+
+// Now returns the latest observed timestamp, or the fallback time if none has been seen
+func (c *ReplayClock) Now() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.latest.IsZero() {
+		if c.Fallback == nil {
+			return time.Now()
+		}
+		return c.Fallback.Now()
+	}
+	return c.latest
+}
+
+var (
+	defaultClock Clock = RealClock{}
+	defaultMutex sync.RWMutex
+)
+
+// Default returns the process-wide clock used by components that were not given one explicitly
+func Default() Clock {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultClock
+}
+
+// SetDefault replaces the process-wide clock
+func SetDefault(c Clock) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultClock = c
+}
+
+// Now is shorthand for Default().Now()
+func Now() time.Time {
+	return Default().Now()
+}
+
+var clockMode = config.NewString("CLOCK_MODE", "real", `Clock source: "real", or "replay" to derive now from message timestamps`,
+	config.OneOf("real", "replay"))
+
+// FromEnv builds a clock from CLOCK_MODE ("real" or "replay")
+func FromEnv() Clock {
+	switch strings.ToLower(clockMode.Get()) {
+	case "replay":
+		return NewReplayClock()
+	default:
+		return RealClock{}
+	}
+}
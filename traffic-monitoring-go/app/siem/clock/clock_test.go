@@ -0,0 +1,106 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		move func(c *FakeClock)
+		want time.Time
+	}{
+		{"frozen", func(*FakeClock) {}, start},
+		{"advance", func(c *FakeClock) { c.Advance(90 * time.Second) }, start.Add(90 * time.Second)},
+		{"advance twice", func(c *FakeClock) {
+			c.Advance(time.Hour)
+			c.Advance(30 * time.Minute)
+		}, start.Add(90 * time.Minute)},
+		{"advance by nothing", func(c *FakeClock) { c.Advance(0) }, start},
+		{"set", func(c *FakeClock) { c.Set(start.Add(-24 * time.Hour)) }, start.Add(-24 * time.Hour)},
+		{"set then advance", func(c *FakeClock) {
+			c.Set(start.Add(time.Hour))
+			c.Advance(time.Minute)
+		}, start.Add(61 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewFakeClock(start)
+			tt.move(c)
+			assert.Equal(t, tt.want, c.Now())
+			assert.Equal(t, tt.want, c.Now(), "Now should not move the clock")
+		})
+	}
+}
+
+func TestReplayClockObserve(t *testing.T) {
+	fallback := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		observed []time.Time
+		want     time.Time
+	}{
+		{"nothing observed", nil, fallback},
+		{"zero time ignored", []time.Time{{}}, fallback},
+		{"one timestamp", []time.Time{base}, base},
+		{"in order", []time.Time{base, base.Add(time.Second), base.Add(2 * time.Second)}, base.Add(2 * time.Second)},
+		{"out of order", []time.Time{base.Add(time.Minute), base, base.Add(30 * time.Second)}, base.Add(time.Minute)},
+		{"zero time after a timestamp", []time.Time{base, {}}, base},
+		{"repeated", []time.Time{base, base}, base},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewReplayClock()
+			c.Fallback = NewFakeClock(fallback)
+			var previous time.Time
+			for _, observed := range tt.observed {
+				c.Observe(observed)
+				now := c.Now()
+				if !previous.IsZero() {
+					assert.False(t, now.Before(previous), "Observe moved the clock backwards from %s to %s", previous, now)
+				}
+				if !observed.IsZero() {
+					previous = now
+				}
+			}
+			assert.Equal(t, tt.want, c.Now())
+		})
+	}
+}
+
+func TestReplayClockWithoutFallback(t *testing.T) {
+	c := &ReplayClock{}
+	before := time.Now()
+	now := c.Now()
+	assert.False(t, now.Before(before), "Expected the wall clock without a fallback")
+	assert.False(t, now.After(time.Now()))
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		mode string
+		want Clock
+	}{
+		{"", RealClock{}},
+		{"real", RealClock{}},
+		{"replay", NewReplayClock()},
+		// not one of the modes, so the default
+		{"wall", RealClock{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			t.Setenv("CLOCK_MODE", tt.mode)
+			assert.IsType(t, tt.want, FromEnv())
+		})
+	}
+}
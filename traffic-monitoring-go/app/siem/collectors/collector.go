@@ -4,9 +4,24 @@ import (
 	"context"
 	"errors"
 	"gorm.io/gorm"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/metrics"
 	"traffic-monitoring-go/app/siem"
 )
 
+var (
+	messagesReceived = metrics.NewCounterVec("siem_collector_messages_total",
+		"Messages (packets, lines or traps) received by collectors", "collector")
+	bytesReceived = metrics.NewCounterVec("siem_collector_bytes_total",
+		"Bytes received by collectors", "collector")
+)
+
+// countMessage records a message received by a collector
+func countMessage(collector string, message []byte) {
+	messagesReceived.Inc(collector)
+	bytesReceived.Add(float64(len(message)), collector)
+}
+
 // Collector defines the interface for all security event collectors
 type Collector interface {
 	// Start begins collection process
@@ -21,6 +36,7 @@ type Collector interface {
 type BaseCollector struct {
 	DB           *gorm.DB
 	EventIngester *siem.EventIngester
+	Log          *logging.Logger
 	Running      bool
 	StopChan     chan struct{}
 }
@@ -30,6 +46,7 @@ func NewBaseCollector(db *gorm.DB) *BaseCollector {
 	return &BaseCollector{
 		DB:           db,
 		EventIngester: siem.NewEventIngester(db),
+		Log:          logging.New("collectors"),
 		Running:      false,
 		StopChan:     make(chan struct{}),
 	}
@@ -0,0 +1,174 @@
+package collectors
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+const (
+	// defaultExportPort is the UDP port of exported messages that did not record one
+	defaultExportPort = 5000
+
+	// maxExportPackets bounds the packets of one exported capture
+	maxExportPackets = 100000
+
+	// exportPageSize is the number of stored messages read per query
+	exportPageSize = 500
+)
+
+// V2XExportFilter selects the V2X messages exported to a capture
+type V2XExportFilter struct {
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	SourceIDs    []string  `json:"source_ids,omitempty"`    // vehicle or station IDs
+	MessageTypes []string  `json:"message_types,omitempty"` // e.g. BSM, CAM or DENM, in any case
+	Port         int       `json:"port,omitempty"`          // destination UDP port of messages that recorded none
+	Limit        int       `json:"limit,omitempty"`         // packets, 10000 by default
+}
+
+// Normalize fills in the defaults of a filter and checks it
+func (f *V2XExportFilter) Normalize() error {
+	if f.Start.IsZero() || f.End.IsZero() {
+		return errors.New("start and end are required")
+	}
+	if !f.End.After(f.Start) {
+		return errors.New("end must be after start")
+	}
+	if f.Port == 0 {
+		f.Port = defaultExportPort
+	}
+	if f.Port < 1 || f.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535, got %d", f.Port)
+	}
+	if f.Limit == 0 {
+		f.Limit = 10000
+	}
+	if f.Limit < 1 || f.Limit > maxExportPackets {
+		return fmt.Errorf("limit must be between 1 and %d, got %d", maxExportPackets, f.Limit)
+	}
+	return nil
+}
+
+// V2XExportResult counts the messages written to a capture
+type V2XExportResult struct {
+	Exported  int  `json:"exported"`
+	Skipped   int  `json:"skipped"`   // matching messages whose raw data does not fit a UDP datagram
+	Truncated bool `json:"truncated"` // more messages matched than the limit
+}
+
+// ExportV2XPcap writes the V2X messages matching filter, oldest first, to a
+// pcap capture: each stored raw message becomes the payload of a UDP datagram
+// from its source address, broadcast when it recorded no destination. A
+// listener with the json parser ingests the capture again through ReplayCapture.
+func ExportV2XPcap(db *gorm.DB, filter V2XExportFilter, w io.Writer) (V2XExportResult, error) {
+	var result V2XExportResult
+	if err := filter.Normalize(); err != nil {
+		return result, err
+	}
+	writer, err := NewPcapWriter(w)
+	if err != nil {
+		return result, err
+	}
+
+	sourceIDs := make(map[string]bool, len(filter.SourceIDs))
+	for _, id := range filter.SourceIDs {
+		sourceIDs[id] = true
+	}
+	messageTypes := make(map[string]bool, len(filter.MessageTypes))
+	for _, messageType := range filter.MessageTypes {
+		messageTypes[strings.ToLower(messageType)] = true
+	}
+
+	// pages go by (timestamp, id), the order of the capture; FindInBatches
+	// would page by ID alone and skip or repeat messages
+	var afterTimestamp time.Time
+	var afterID uint
+	for {
+		query := db.Where("category IN ?", []models.EventCategory{models.CategoryV2X, models.CategoryVehicle}).
+			Where("timestamp >= ? AND timestamp < ?", filter.Start, filter.End)
+		if afterID != 0 {
+			query = query.Where("timestamp > ? OR (timestamp = ? AND id > ?)", afterTimestamp, afterTimestamp, afterID)
+		}
+		var events []models.SecurityEvent
+		if err := query.Order("timestamp ASC, id ASC").Limit(exportPageSize).Find(&events).Error; err != nil {
+			return result, err
+		}
+
+		for i := range events {
+			event := &events[i]
+			afterTimestamp, afterID = event.Timestamp, event.ID
+			obs, ok := siem.ParseV2XObservation(event, "")
+			if !ok {
+				continue
+			}
+			if len(sourceIDs) > 0 && !sourceIDs[obs.VehicleID] {
+				continue
+			}
+			if len(messageTypes) > 0 && !messageTypes[strings.ToLower(obs.MessageType)] {
+				continue
+			}
+			if result.Exported == filter.Limit {
+				result.Truncated = true
+				return result, nil
+			}
+
+			frame, err := EncodeUDP(exportDatagram(event, filter.Port))
+			if err != nil {
+				result.Skipped++
+				continue
+			}
+			if err := writer.WritePacket(event.Timestamp, frame); err != nil {
+				return result, err
+			}
+			result.Exported++
+		}
+
+		if len(events) < exportPageSize {
+			break
+		}
+	}
+	return result, nil
+}
+
+// exportDatagram addresses the raw data of an event as the datagram it arrived in
+func exportDatagram(event *models.SecurityEvent, defaultPort int) UDPDatagram {
+	src, dst := net.ParseIP(event.SourceIP), net.ParseIP(event.DestinationIP)
+	v6 := src != nil && src.To4() == nil || src == nil && dst != nil && dst.To4() == nil
+	if src == nil || (src.To4() == nil) != v6 {
+		src = net.IPv4zero
+		if v6 {
+			src = net.IPv6unspecified
+		}
+	}
+	if dst == nil || (dst.To4() == nil) != v6 {
+		dst = net.IPv4bcast
+		if v6 {
+			dst = net.ParseIP("ff02::1") // all nodes
+		}
+	}
+
+	dstPort := defaultPort
+	if event.DestinationPort != nil && *event.DestinationPort > 0 && *event.DestinationPort <= 65535 {
+		dstPort = *event.DestinationPort
+	}
+	srcPort := dstPort
+	if event.SourcePort != nil && *event.SourcePort > 0 && *event.SourcePort <= 65535 {
+		srcPort = *event.SourcePort
+	}
+
+	return UDPDatagram{
+		Source:      net.JoinHostPort(src.String(), strconv.Itoa(srcPort)),
+		Destination: net.JoinHostPort(dst.String(), strconv.Itoa(dstPort)),
+		DstPort:     dstPort,
+		Payload:     []byte(event.RawData),
+	}
+}
@@ -0,0 +1,292 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/live"
+	"traffic-monitoring-go/app/siem/routing"
+)
+
+// DefaultDrainTimeout bounds how long a removed listener waits for in-flight messages
+const DefaultDrainTimeout = 10 * time.Second
+
+// ListenerConfig describes a collector listener that can be added at runtime
+type ListenerConfig struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"` // udp or tcp
+	Port     int    `json:"port"`
+	Parser   string `json:"parser"`
+}
+
+// Validate checks that the listener configuration is usable
+func (c ListenerConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("listener name is required")
+	}
+	if c.Protocol != "udp" && c.Protocol != "tcp" {
+		return fmt.Errorf("unsupported protocol %q, use udp or tcp", c.Protocol)
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid port %d", c.Port)
+	}
+	if _, ok := GetParser(c.Parser); !ok {
+		return fmt.Errorf("unknown parser %q, available: %v", c.Parser, ParserNames())
+	}
+	return nil
+}
+
+// ListenerCollector receives messages on a UDP or TCP port and ingests them with
+// a configurable parser. TCP messages are newline-delimited. Stopping drains
+// in-flight messages instead of dropping them.
+type ListenerCollector struct {
+	*BaseCollector
+	Config ListenerConfig
+
+	// Forward, when set, receives parsed events instead of the local ingester
+	// (store-and-forward mode on edge nodes without a database)
+	Forward func(eventJSON []byte) error
+
+	parse      ParserFunc
+	mutex      sync.Mutex
+	packetConn net.PacketConn
+	listener   net.Listener
+	conns      map[net.Conn]struct{}
+	inflight   sync.WaitGroup
+	done       chan struct{}
+}
+
+// Ensure ListenerCollector implements CollectorInterface
+var _ CollectorInterface = (*ListenerCollector)(nil)
+
+// NewListenerCollector creates a new ListenerCollector
+func NewListenerCollector(db *gorm.DB, config ListenerConfig) (*ListenerCollector, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	parse, _ := GetParser(config.Parser)
+	base := NewBaseCollector(db)
+	base.Log = logging.New("collectors.listener").With("collector", config.Name)
+	return &ListenerCollector{
+		BaseCollector: base,
+		Config:        config,
+		parse:         parse,
+	}, nil
+}
+
+// Name returns the collector's name
+func (c *ListenerCollector) Name() string {
+	return c.Config.Name
+}
+
+// IsRunning returns whether the collector is running
+func (c *ListenerCollector) IsRunning() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Running
+}
+
+// Start binds the socket and begins receiving messages
+func (c *ListenerCollector) Start(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.Running {
+		return fmt.Errorf("listener %s is already running", c.Config.Name)
+	}
+
+	address := fmt.Sprintf(":%d", c.Config.Port)
+	c.done = make(chan struct{})
+	c.conns = make(map[net.Conn]struct{})
+
+	switch c.Config.Protocol {
+	case "udp":
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return fmt.Errorf("failed to listen on UDP port %d: %v", c.Config.Port, err)
+		}
+		c.packetConn = conn
+		go c.serveUDP(ctx, conn, c.done)
+	case "tcp":
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return fmt.Errorf("failed to listen on TCP port %d: %v", c.Config.Port, err)
+		}
+		c.listener = listener
+		go c.serveTCP(listener, c.done)
+	}
+
+	c.Running = true
+	c.Log.Info("listener started", "protocol", c.Config.Protocol, "port", c.Config.Port, "parser", c.Config.Parser)
+	return nil
+}
+
+// Stop closes the socket and drains in-flight messages
+func (c *ListenerCollector) Stop() error {
+	return c.Drain(DefaultDrainTimeout)
+}
+
+// Drain stops accepting new messages, then waits up to timeout for messages
+// already received to be ingested before closing remaining connections
+func (c *ListenerCollector) Drain(timeout time.Duration) error {
+	c.mutex.Lock()
+	if !c.Running {
+		c.mutex.Unlock()
+		return fmt.Errorf("listener %s is not running", c.Config.Name)
+	}
+
+	close(c.done)
+	if c.packetConn != nil {
+		c.packetConn.Close()
+	}
+	if c.listener != nil {
+		c.listener.Close()
+	}
+	c.Running = false
+	c.mutex.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		c.Log.Info("listener drained")
+	case <-time.After(timeout):
+		// close idle TCP connections that are still open after the grace period
+		c.mutex.Lock()
+		for conn := range c.conns {
+			conn.Close()
+		}
+		c.mutex.Unlock()
+		c.Log.Warn("listener drain timed out, closed remaining connections", "timeout", timeout)
+	}
+
+	return nil
+}
+
+// serveUDP reads datagrams until the listener is drained
+func (c *ListenerCollector) serveUDP(ctx context.Context, conn net.PacketConn, done chan struct{}) {
+	buffer := make([]byte, 65536)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			default:
+			}
+			c.Log.Sampled("listener.read:"+c.Config.Name).Error("failed to read from listener", "error", err)
+			continue
+		}
+
+		message := make([]byte, n)
+		copy(message, buffer[:n])
+
+		// datagrams cannot be slowed down, so a full ingest queue drops them
+		source := addr.String()
+		c.inflight.Add(1)
+		siem.DefaultIngestPool().Submit(c.Config.Name, func() {
+			defer c.inflight.Done()
+			c.process(message, source)
+		}, c.inflight.Done)
+	}
+}
+
+// serveTCP accepts connections until the listener is drained
+func (c *ListenerCollector) serveTCP(listener net.Listener, done chan struct{}) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			c.Log.Sampled("listener.accept:"+c.Config.Name).Error("failed to accept on listener", "error", err)
+			continue
+		}
+
+		c.mutex.Lock()
+		c.conns[conn] = struct{}{}
+		c.mutex.Unlock()
+
+		c.inflight.Add(1)
+		go c.handleConn(conn)
+	}
+}
+
+// handleConn ingests newline-delimited messages from a TCP connection
+func (c *ListenerCollector) handleConn(conn net.Conn) {
+	defer c.inflight.Done()
+	defer func() {
+		conn.Close()
+		c.mutex.Lock()
+		delete(c.conns, conn)
+		c.mutex.Unlock()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		// waiting for room in the ingest queue stops reading, which slows the
+		// sender down; the line is only lost if the oldest drop policy evicts it
+		siem.DefaultIngestPool().Wait(context.Background(), c.Config.Name, func() {
+			c.process(scanner.Bytes(), conn.RemoteAddr().String())
+		})
+	}
+}
+
+// process parses and ingests a single message, under a correlation ID of its own
+func (c *ListenerCollector) process(message []byte, sourceAddr string) {
+	sample := siem.StartCostSample()
+	countMessage(c.Config.Name, message)
+	source := siem.ParseSource{Collector: c.Config.Name, Address: sourceAddr, MessageType: c.Config.Parser}
+
+	// not tied to the listener's context: Drain waits for in-flight events to be stored
+	ctx := logging.WithCorrelationID(context.Background(), logging.NewID())
+	logger := c.Log.WithContext(ctx).With("source", sourceAddr)
+
+	eventJSON, err := c.parse(message, sourceAddr)
+	if err != nil {
+		siem.RecordParseFailure(source, err)
+		logger.Sampled("listener.parse:"+c.Config.Name).Warn("failed to parse message", "parser", c.Config.Parser, "error", err)
+		return
+	}
+	sample.Stage("parse")
+
+	if c.Forward != nil {
+		if err := c.Forward(eventJSON); err != nil {
+			logger.Sampled("listener.forward:"+c.Config.Name).Error("failed to queue event for forwarding", "error", err)
+		}
+		return
+	}
+
+	result, err := siem.NewEventIngester(c.DB).Ingest(siem.WithParseSource(siem.WithCostSample(ctx, sample), source), eventJSON)
+	if err != nil {
+		logger.Sampled("listener.ingest:"+c.Config.Name).Error("failed to ingest event", "error", err)
+		return
+	}
+
+	for _, event := range result.Events() {
+		routing.Route(event)
+		live.Record(event)
+	}
+
+	siem.RecordEventCost(sample, result.Event)
+}
@@ -3,10 +3,11 @@ package collectors
 import (
 	"context"
 	"fmt"
-	"log"
 	"sync"
 
 	"gorm.io/gorm"
+
+	"traffic-monitoring-go/app/logging"
 )
 
 // CollectorInterface extends the Collector interface with status reporting
@@ -21,7 +22,9 @@ var _ CollectorInterface = (*BaseCollector)(nil)
 // CollectorManager manages all security event collectors
 type CollectorManager struct {
 	DB          *gorm.DB
+	Log         *logging.Logger
 	collectors  map[string]CollectorInterface
+	replays     map[string]*Replay
 	mutex       sync.Mutex
 	ctx         context.Context
 	cancel      context.CancelFunc
@@ -32,6 +35,7 @@ func NewCollectorManager(db *gorm.DB) *CollectorManager {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &CollectorManager{
 		DB:         db,
+		Log:        logging.New("collectors"),
 		collectors: make(map[string]CollectorInterface),
 		ctx:        ctx,
 		cancel:     cancel,
@@ -49,7 +53,7 @@ func (m *CollectorManager) RegisterCollector(collector CollectorInterface) error
 	}
 
 	m.collectors[name] = collector
-	log.Printf("Registered collector: %s", name)
+	m.Log.Info("collector registered", "collector", name)
 	return nil
 }
 
@@ -68,7 +72,7 @@ func (m *CollectorManager) StartCollector(name string) error {
 		return fmt.Errorf("failed to start collector '%s': %v", name, err)
 	}
 
-	log.Printf("Started collector: %s", name)
+	m.Log.Info("collector started", "collector", name)
 	return nil
 }
 
@@ -87,7 +91,7 @@ func (m *CollectorManager) StopCollector(name string) error {
 		return fmt.Errorf("failed to stop collector '%s': %v", name, err)
 	}
 
-	log.Printf("Stopped collector: %s", name)
+	m.Log.Info("collector stopped", "collector", name)
 	return nil
 }
 
@@ -99,10 +103,10 @@ func (m *CollectorManager) StartAll() error {
 	for name, collector := range m.collectors {
 		err := collector.Start(m.ctx)
 		if err != nil {
-			log.Printf("Failed to start collector '%s': %v", name, err)
+			m.Log.Error("failed to start collector", "collector", name, "error", err)
 			// continue starting other collectors instead of returning early
 		} else {
-			log.Printf("Started collector: %s", name)
+			m.Log.Info("collector started", "collector", name)
 		}
 	}
 
@@ -121,9 +125,9 @@ func (m *CollectorManager) StopAll() {
 	for name, collector := range m.collectors {
 		err := collector.Stop()
 		if err != nil {
-			log.Printf("Error stopping collector '%s': %v", name, err)
+			m.Log.Error("failed to stop collector", "collector", name, "error", err)
 		} else {
-			log.Printf("Stopped collector: %s", name)
+			m.Log.Info("collector stopped", "collector", name)
 		}
 	}
 }
@@ -153,4 +157,160 @@ func (m *CollectorManager) GetCollectorStatus(name string) (bool, error) {
 
 	// Use the IsRunning method directly
 	return collector.IsRunning(), nil
-}
\ No newline at end of file
+}
+// AddListener creates, registers and starts a listener without restarting the SIEM
+func (m *CollectorManager) AddListener(config ListenerConfig) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.collectors[config.Name]; exists {
+		return fmt.Errorf("collector with name '%s' already registered", config.Name)
+	}
+
+	listener, err := NewListenerCollector(m.DB, config)
+	if err != nil {
+		return err
+	}
+
+	if err := listener.Start(m.ctx); err != nil {
+		return err
+	}
+
+	m.collectors[config.Name] = listener
+	m.Log.Info("listener added", "collector", config.Name)
+	return nil
+}
+
+// ReplaceListener swaps a listener for one with a new configuration.
+// When the port changes the new socket is bound before the old one is drained,
+// so there is no gap in collection.
+func (m *CollectorManager) ReplaceListener(config ListenerConfig) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	existing, exists := m.collectors[config.Name]
+	if !exists {
+		return fmt.Errorf("collector '%s' not found", config.Name)
+	}
+	old, ok := existing.(*ListenerCollector)
+	if !ok {
+		return fmt.Errorf("collector '%s' is not a runtime listener", config.Name)
+	}
+
+	replacement, err := NewListenerCollector(m.DB, config)
+	if err != nil {
+		return err
+	}
+
+	samePort := old.Config.Port == config.Port && old.Config.Protocol == config.Protocol
+	if samePort && old.IsRunning() {
+		old.Stop()
+	}
+
+	if err := replacement.Start(m.ctx); err != nil {
+		if samePort {
+			// put the previous listener back rather than leaving the port unbound
+			old.Start(m.ctx)
+		}
+		return err
+	}
+
+	if !samePort && old.IsRunning() {
+		old.Stop()
+	}
+
+	m.collectors[config.Name] = replacement
+	m.Log.Info("listener replaced", "collector", config.Name)
+	return nil
+}
+
+// RemoveCollector drains a collector if it is running and unregisters it
+func (m *CollectorManager) RemoveCollector(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	collector, exists := m.collectors[name]
+	if !exists {
+		return fmt.Errorf("collector '%s' not found", name)
+	}
+
+	if collector.IsRunning() {
+		if err := collector.Stop(); err != nil {
+			return fmt.Errorf("failed to stop collector '%s': %v", name, err)
+		}
+	}
+
+	delete(m.collectors, name)
+	m.Log.Info("collector removed", "collector", name)
+	return nil
+}
+
+// GetListenerConfigs returns the configuration of every runtime listener
+func (m *CollectorManager) GetListenerConfigs() map[string]ListenerConfig {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	configs := make(map[string]ListenerConfig)
+	for name, collector := range m.collectors {
+		if listener, ok := collector.(*ListenerCollector); ok {
+			configs[name] = listener.Config
+		}
+	}
+	return configs
+}
+
+// AddMQTT creates, registers and starts an MQTT collector without restarting the SIEM
+func (m *CollectorManager) AddMQTT(config MQTTConfig) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.collectors[config.Name]; exists {
+		return fmt.Errorf("collector with name '%s' already registered", config.Name)
+	}
+
+	collector, err := NewMQTTCollector(m.DB, config)
+	if err != nil {
+		return err
+	}
+
+	if err := collector.Start(m.ctx); err != nil {
+		return err
+	}
+
+	m.collectors[config.Name] = collector
+	m.Log.Info("MQTT collector added", "collector", config.Name)
+	return nil
+}
+
+// ReplaceMQTT swaps an MQTT collector for one with a new configuration. The
+// previous collector disconnects first, so a broker that allows a client ID
+// only once sees a single session.
+func (m *CollectorManager) ReplaceMQTT(config MQTTConfig) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	existing, exists := m.collectors[config.Name]
+	if !exists {
+		return fmt.Errorf("collector '%s' not found", config.Name)
+	}
+	old, ok := existing.(*MQTTCollector)
+	if !ok {
+		return fmt.Errorf("collector '%s' is not an MQTT collector", config.Name)
+	}
+
+	replacement, err := NewMQTTCollector(m.DB, config)
+	if err != nil {
+		return err
+	}
+
+	if old.IsRunning() {
+		old.Stop()
+	}
+	if err := replacement.Start(m.ctx); err != nil {
+		return err
+	}
+
+	m.collectors[config.Name] = replacement
+	m.Log.Info("MQTT collector replaced", "collector", config.Name)
+	return nil
+}
@@ -0,0 +1,469 @@
+package collectors
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/live"
+	"traffic-monitoring-go/app/siem/routing"
+)
+
+const (
+	mqttMinBackoff = time.Second
+	mqttMaxBackoff = time.Minute
+)
+
+// MQTTConfig describes an MQTT collector that can be added at runtime
+type MQTTConfig struct {
+	Name               string
+	URL                string // tcp:// or mqtt://, ssl://, tls:// or mqtts:// for TLS
+	ClientID           string // when set, the session (and QoS 1/2 messages) survives reconnects
+	Username           string
+	Password           string
+	CACert             string // PEM
+	ClientCert         string // PEM
+	ClientKey          string // PEM
+	InsecureSkipVerify bool
+	KeepAlive          time.Duration // default 60s
+	Topics             []models.MQTTTopic
+}
+
+// Validate checks that the MQTT configuration is usable
+func (c MQTTConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("collector name is required")
+	}
+	if _, _, err := c.address(); err != nil {
+		return err
+	}
+	if _, err := c.tlsConfig(); err != nil {
+		return err
+	}
+	if c.KeepAlive < 0 || c.KeepAlive > 65535*time.Second {
+		return fmt.Errorf("keep alive must be between 0 and 65535 seconds")
+	}
+	if len(c.Topics) == 0 {
+		return fmt.Errorf("at least one topic is required")
+	}
+	for _, topic := range c.Topics {
+		if !validTopicFilter(topic.Filter) {
+			return fmt.Errorf("invalid topic filter %q", topic.Filter)
+		}
+		if topic.QoS > 2 {
+			return fmt.Errorf("topic %q: QoS must be 0, 1 or 2", topic.Filter)
+		}
+		if _, ok := GetParser(topicParser(topic)); !ok {
+			return fmt.Errorf("topic %q: unknown parser %q, available: %v", topic.Filter, topic.Parser, ParserNames())
+		}
+		if topic.Radio != "" && siem.NormalizeRadio(string(topic.Radio)) == "" {
+			return fmt.Errorf("topic %q: unknown radio %q, use %s or %s", topic.Filter, topic.Radio, models.RadioDSRC, models.RadioCV2X)
+		}
+	}
+	return nil
+}
+
+// address returns the host:port of the broker and whether it speaks TLS
+func (c MQTTConfig) address() (string, bool, error) {
+	broker, err := url.Parse(c.URL)
+	if err != nil || broker.Hostname() == "" {
+		return "", false, fmt.Errorf("invalid broker URL %q", c.URL)
+	}
+	useTLS, port := false, "1883"
+	switch broker.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		useTLS, port = true, "8883"
+	default:
+		return "", false, fmt.Errorf("unsupported broker URL scheme %q, use tcp, mqtt, ssl, tls or mqtts", broker.Scheme)
+	}
+	if broker.Port() != "" {
+		port = broker.Port()
+	}
+	return net.JoinHostPort(broker.Hostname(), port), useTLS, nil
+}
+
+// tlsConfig builds the TLS settings of the connection, nil for plain TCP
+func (c MQTTConfig) tlsConfig() (*tls.Config, error) {
+	address, useTLS, err := c.address()
+	if err != nil || !useTLS {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(address)
+	config := &tls.Config{ServerName: host, InsecureSkipVerify: c.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+	if c.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, errors.New("ca_cert holds no PEM certificate")
+		}
+		config.RootCAs = pool
+	}
+	if c.ClientCert != "" || c.ClientKey != "" {
+		certificate, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// topicParser is the parser of a topic's messages
+func topicParser(topic models.MQTTTopic) string {
+	if topic.Parser == "" {
+		return "json"
+	}
+	return topic.Parser
+}
+
+// MQTTCollector subscribes to topics of an MQTT broker, such as the ones RSU
+// gateways publish V2X messages to, and ingests each message with the
+// topic's parser. QoS 1 and 2 messages are acknowledged once ingested, and
+// the collector reconnects with backoff when the connection drops.
+type MQTTCollector struct {
+	*BaseCollector
+	Config MQTTConfig
+
+	clientID     string
+	cleanSession bool
+	mutex        sync.Mutex
+	conn         *mqttConn
+	done         chan struct{}
+	finished     chan struct{}
+}
+
+// Ensure MQTTCollector implements CollectorInterface
+var _ CollectorInterface = (*MQTTCollector)(nil)
+
+// NewMQTTCollector creates a new MQTTCollector
+func NewMQTTCollector(db *gorm.DB, config MQTTConfig) (*MQTTCollector, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.KeepAlive == 0 {
+		config.KeepAlive = 60 * time.Second
+	}
+
+	collector := &MQTTCollector{BaseCollector: NewBaseCollector(db), Config: config, clientID: config.ClientID}
+	collector.Log = logging.New("collectors.mqtt").With("collector", config.Name)
+	if collector.clientID == "" {
+		// without a stable client ID there is no session to resume
+		var b [6]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, err
+		}
+		collector.clientID, collector.cleanSession = "siem-"+hex.EncodeToString(b[:]), true
+	}
+	return collector, nil
+}
+
+// Name returns the collector's name
+func (c *MQTTCollector) Name() string {
+	return c.Config.Name
+}
+
+// IsRunning returns whether the collector is running
+func (c *MQTTCollector) IsRunning() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Running
+}
+
+// Start connects to the broker in the background and keeps reconnecting until stopped
+func (c *MQTTCollector) Start(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.Running {
+		return fmt.Errorf("MQTT collector %s is already running", c.Config.Name)
+	}
+
+	c.done = make(chan struct{})
+	c.finished = make(chan struct{})
+	go c.run(ctx, c.done, c.finished)
+
+	c.Running = true
+	c.Log.Info("MQTT collector started", "url", c.Config.URL, "topics", len(c.Config.Topics))
+	return nil
+}
+
+// Stop disconnects from the broker, waiting for the message being ingested
+func (c *MQTTCollector) Stop() error {
+	c.mutex.Lock()
+	if !c.Running {
+		c.mutex.Unlock()
+		return fmt.Errorf("MQTT collector %s is not running", c.Config.Name)
+	}
+	close(c.done)
+	if c.conn != nil {
+		c.conn.disconnect()
+	}
+	c.Running = false
+	finished := c.finished
+	c.mutex.Unlock()
+
+	select {
+	case <-finished:
+		c.Log.Info("MQTT collector stopped")
+	case <-time.After(DefaultDrainTimeout):
+		c.Log.Warn("MQTT collector stop timed out", "timeout", DefaultDrainTimeout)
+	}
+	return nil
+}
+
+// run keeps a session open until the collector is stopped
+func (c *MQTTCollector) run(ctx context.Context, done, finished chan struct{}) {
+	defer close(finished)
+
+	backoff := mqttMinBackoff
+	for {
+		started := time.Now()
+		err := c.session(ctx, done)
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+		c.Log.Sampled("mqtt.session:"+c.Config.Name).Warn("MQTT collector disconnected", "error", err, "retry_in", backoff)
+
+		// a session that lasted resets the backoff
+		if time.Since(started) > mqttMaxBackoff {
+			backoff = mqttMinBackoff
+		}
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > mqttMaxBackoff {
+			backoff = mqttMaxBackoff
+		}
+	}
+}
+
+// session connects, subscribes and ingests messages until the connection fails
+func (c *MQTTCollector) session(ctx context.Context, done chan struct{}) error {
+	address, _, _ := c.Config.address()
+	tlsConfig, err := c.Config.tlsConfig()
+	if err != nil {
+		return err
+	}
+	conn, err := dialMQTT(address, tlsConfig, c.Config, c.clientID, c.cleanSession)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	select {
+	case <-done:
+		c.mutex.Unlock()
+		conn.disconnect()
+		return nil
+	default:
+	}
+	c.conn = conn
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		c.conn = nil
+		c.mutex.Unlock()
+		conn.conn.Close()
+	}()
+
+	filters := make([]string, len(c.Config.Topics))
+	qos := make([]byte, len(c.Config.Topics))
+	for i, topic := range c.Config.Topics {
+		filters[i], qos[i] = topic.Filter, topic.QoS
+	}
+	const subscribeID = 1
+	if err := conn.subscribe(subscribeID, filters, qos); err != nil {
+		return err
+	}
+	c.Log.Info("MQTT collector connected", "address", address)
+
+	// ping at half the keep-alive so the broker never times the session out
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	if c.Config.KeepAlive > 0 {
+		go func() {
+			ticker := time.NewTicker(c.Config.KeepAlive / 2)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopPing:
+					return
+				case <-ticker.C:
+					if err := conn.ping(); err != nil {
+						conn.conn.Close()
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	// QoS 2 messages ingested but not yet released by the broker, which may resend them
+	pendingRelease := make(map[uint16]bool)
+	for {
+		if c.Config.KeepAlive > 0 {
+			conn.conn.SetReadDeadline(time.Now().Add(c.Config.KeepAlive * 3 / 2))
+		}
+		packet, err := conn.read()
+		if err != nil {
+			return err
+		}
+
+		switch packet.kind {
+		case mqttPublish:
+			publish, err := parsePublish(packet)
+			if err != nil {
+				return err
+			}
+			if publish.qos == 2 && pendingRelease[publish.packetID] {
+				// a resent message that was already ingested
+				if err := conn.ack(mqttPubrec, publish.packetID); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := c.ingest(ctx, publish); err != nil {
+				// left unacknowledged, the broker resends it on the next session
+				return err
+			}
+			switch publish.qos {
+			case 1:
+				err = conn.ack(mqttPuback, publish.packetID)
+			case 2:
+				pendingRelease[publish.packetID] = true
+				err = conn.ack(mqttPubrec, publish.packetID)
+			}
+			if err != nil {
+				return err
+			}
+
+		case mqttPubrel:
+			packetID, err := packet.packetID()
+			if err != nil {
+				return err
+			}
+			delete(pendingRelease, packetID)
+			if err := conn.ack(mqttPubcomp, packetID); err != nil {
+				return err
+			}
+
+		case mqttSuback:
+			if len(packet.body) < 2 {
+				return errors.New("SUBACK without packet identifier")
+			}
+			for i, code := range packet.body[2:] {
+				if code == 0x80 && i < len(filters) {
+					c.Log.Warn("broker refused the subscription", "filter", filters[i])
+				}
+			}
+
+		case mqttPingresp:
+		default:
+			return fmt.Errorf("unexpected MQTT packet type %d", packet.kind)
+		}
+	}
+}
+
+// ingest queues a message for ingestion and waits for it, so a full ingest
+// queue stops reading and the broker holds the messages back
+func (c *MQTTCollector) ingest(ctx context.Context, publish mqttPublishPacket) error {
+	topic, ok := c.topic(publish.topic)
+	if !ok {
+		c.Log.Sampled("mqtt.topic:"+c.Config.Name).Warn("message on an unsubscribed topic", "topic", publish.topic)
+		return nil
+	}
+	return siem.DefaultIngestPool().Wait(ctx, c.Config.Name, func() {
+		c.process(topic, publish.topic, publish.payload)
+	})
+}
+
+// topic returns the subscription a topic name falls under, the first one listed when several match
+func (c *MQTTCollector) topic(name string) (models.MQTTTopic, bool) {
+	for _, topic := range c.Config.Topics {
+		if topicMatches(topic.Filter, name) {
+			return topic, true
+		}
+	}
+	return models.MQTTTopic{}, false
+}
+
+// process parses and ingests a single message, under a correlation ID of its own
+func (c *MQTTCollector) process(topic models.MQTTTopic, topicName string, message []byte) {
+	sample := siem.StartCostSample()
+	countMessage(c.Config.Name, message)
+	parser := topicParser(topic)
+	source := siem.ParseSource{Collector: c.Config.Name, Address: topicName, MessageType: parser}
+	ctx := logging.WithCorrelationID(context.Background(), logging.NewID())
+	logger := c.Log.WithContext(ctx).With("topic", topicName)
+
+	parse, _ := GetParser(parser)
+	address, _, _ := c.Config.address()
+	eventJSON, err := parse(message, address)
+	if err != nil {
+		siem.RecordParseFailure(source, err)
+		logger.Sampled("mqtt.parse:"+c.Config.Name).Warn("failed to parse message", "parser", parser, "error", err)
+		return
+	}
+	if topic.Radio != "" {
+		eventJSON = withRadio(eventJSON, siem.NormalizeRadio(string(topic.Radio)))
+	}
+	sample.Stage("parse")
+
+	result, err := siem.NewEventIngester(c.DB).Ingest(siem.WithParseSource(siem.WithCostSample(ctx, sample), source), eventJSON)
+	if err != nil {
+		logger.Sampled("mqtt.ingest:"+c.Config.Name).Error("failed to ingest event", "error", err)
+		return
+	}
+
+	for _, event := range result.Events() {
+		routing.Route(event)
+		live.Record(event)
+	}
+
+	siem.RecordEventCost(sample, result.Event)
+}
+
+// withRadio sets the radio of an event that does not report one, such as
+// the messages of a gateway publishing DSRC and C-V2X on separate topics
+func withRadio(eventJSON []byte, radio models.RadioProtocol) []byte {
+	var event map[string]interface{}
+	if json.Unmarshal(eventJSON, &event) != nil {
+		return eventJSON
+	}
+	details, ok := event["details"].(map[string]interface{})
+	if !ok {
+		details = make(map[string]interface{})
+		event["details"] = details
+	}
+	if _, ok := details["radio"]; ok {
+		return eventJSON
+	}
+	details["radio"] = string(radio)
+
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return eventJSON
+	}
+	return encoded
+}
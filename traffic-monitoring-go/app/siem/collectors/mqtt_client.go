@@ -0,0 +1,303 @@
+package collectors
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttPubrec     = 5
+	mqttPubrel     = 6
+	mqttPubcomp    = 7
+	mqttSubscribe  = 8
+	mqttSuback     = 9
+	mqttPingreq    = 12
+	mqttPingresp   = 13
+	mqttDisconnect = 14
+)
+
+const (
+	mqttDialTimeout   = 10 * time.Second
+	maxMQTTPacketSize = 16 << 20 // larger publishes are not V2X messages and end the session
+)
+
+// mqttConnackErrors are the CONNACK return codes refusing a connection
+var mqttConnackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// mqttPacket is a received control packet
+type mqttPacket struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// mqttPublishPacket is a decoded PUBLISH
+type mqttPublishPacket struct {
+	topic    string
+	qos      byte
+	packetID uint16
+	payload  []byte
+}
+
+// mqttConn is a connection to an MQTT broker. Reads happen on one goroutine;
+// writes are serialized so keep-alive pings can be sent alongside acks.
+type mqttConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+}
+
+// dialMQTT connects to the broker at address and completes the MQTT handshake
+func dialMQTT(address string, tlsConfig *tls.Config, config MQTTConfig, clientID string, cleanSession bool) (*mqttConn, error) {
+	dialer := &net.Dialer{Timeout: mqttDialTimeout}
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &mqttConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := c.connect(config, clientID, cleanSession); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect sends CONNECT and waits for the broker to accept it
+func (c *mqttConn) connect(config MQTTConfig, clientID string, cleanSession bool) error {
+	var flags byte
+	if cleanSession {
+		flags |= 0x02
+	}
+	if config.Username != "" {
+		flags |= 0x80
+		if config.Password != "" {
+			flags |= 0x40
+		}
+	}
+
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, 4, flags) // protocol level 4 is MQTT 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(config.KeepAlive/time.Second))
+	body = appendMQTTString(body, clientID)
+	if flags&0x80 != 0 {
+		body = appendMQTTString(body, config.Username)
+	}
+	if flags&0x40 != 0 {
+		body = appendMQTTString(body, config.Password)
+	}
+
+	c.conn.SetDeadline(time.Now().Add(mqttDialTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+	if err := c.write(mqttConnect, 0, body); err != nil {
+		return err
+	}
+	packet, err := c.read()
+	if err != nil {
+		return err
+	}
+	if packet.kind != mqttConnack || len(packet.body) != 2 {
+		return fmt.Errorf("expected CONNACK, got packet type %d", packet.kind)
+	}
+	if code := packet.body[1]; code != 0 {
+		if reason, ok := mqttConnackErrors[code]; ok {
+			return fmt.Errorf("broker refused the connection: %s", reason)
+		}
+		return fmt.Errorf("broker refused the connection with code %d", code)
+	}
+	return nil
+}
+
+// subscribe sends one SUBSCRIBE for filters at their QoS; the SUBACK arrives with the other packets
+func (c *mqttConn) subscribe(packetID uint16, filters []string, qos []byte) error {
+	body := binary.BigEndian.AppendUint16(nil, packetID)
+	for i, filter := range filters {
+		body = appendMQTTString(body, filter)
+		body = append(body, qos[i])
+	}
+	return c.write(mqttSubscribe, 0x02, body)
+}
+
+// ack answers a PUBLISH, PUBREC or PUBREL with the packet the protocol expects next
+func (c *mqttConn) ack(kind byte, packetID uint16) error {
+	var flags byte
+	if kind == mqttPubrel {
+		flags = 0x02
+	}
+	return c.write(kind, flags, binary.BigEndian.AppendUint16(nil, packetID))
+}
+
+// ping sends PINGREQ so the broker keeps the connection open
+func (c *mqttConn) ping() error {
+	return c.write(mqttPingreq, 0, nil)
+}
+
+// disconnect tells the broker the session ends cleanly and closes the connection
+func (c *mqttConn) disconnect() {
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.write(mqttDisconnect, 0, nil)
+	c.conn.Close()
+}
+
+// write sends a control packet
+func (c *mqttConn) write(kind, flags byte, body []byte) error {
+	packet := []byte{kind<<4 | flags}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// read receives the next control packet
+func (c *mqttConn) read() (mqttPacket, error) {
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return mqttPacket{}, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return mqttPacket{}, errors.New("malformed MQTT remaining length")
+		}
+		digit, err := c.reader.ReadByte()
+		if err != nil {
+			return mqttPacket{}, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	if length > maxMQTTPacketSize {
+		return mqttPacket{}, fmt.Errorf("MQTT packet of %d bytes exceeds the %d byte limit", length, maxMQTTPacketSize)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return mqttPacket{}, err
+	}
+	return mqttPacket{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+// parsePublish decodes the topic, QoS, packet ID and payload of a PUBLISH
+func parsePublish(packet mqttPacket) (mqttPublishPacket, error) {
+	publish := mqttPublishPacket{qos: (packet.flags >> 1) & 0x03}
+	if publish.qos > 2 {
+		return publish, errors.New("invalid PUBLISH QoS 3")
+	}
+	topic, rest, err := readMQTTString(packet.body)
+	if err != nil {
+		return publish, err
+	}
+	publish.topic = topic
+	if publish.qos > 0 {
+		if len(rest) < 2 {
+			return publish, errors.New("PUBLISH without packet identifier")
+		}
+		publish.packetID = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	publish.payload = rest
+	return publish, nil
+}
+
+// packetID reads the packet identifier that PUBACK, PUBREC, PUBREL, PUBCOMP and SUBACK start with
+func (p mqttPacket) packetID() (uint16, error) {
+	if len(p.body) < 2 {
+		return 0, fmt.Errorf("packet type %d without packet identifier", p.kind)
+	}
+	return binary.BigEndian.Uint16(p.body), nil
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readMQTTString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("truncated MQTT string")
+	}
+	length := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+length {
+		return "", nil, errors.New("truncated MQTT string")
+	}
+	return string(b[2 : 2+length]), b[2+length:], nil
+}
+
+// validTopicFilter checks the wildcards of a topic filter: + and # take a
+// whole level, and # only the last one
+func validTopicFilter(filter string) bool {
+	if filter == "" || len(filter) > 65535 {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return false
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return false
+		}
+	}
+	return true
+}
+
+// topicMatches reports whether a topic name matches a filter. Wildcards at
+// the first level do not match topics starting with $, which brokers reserve.
+func topicMatches(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	filterLevels, topicLevels := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true // also matches the parent level
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
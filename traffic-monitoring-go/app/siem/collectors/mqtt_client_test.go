@@ -0,0 +1,261 @@
+package collectors
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingConn is a connection that keeps what is written to it
+type recordingConn struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	return c.written.Write(b)
+}
+
+// encodeMQTT returns the bytes mqttConn.write sends for a packet
+func encodeMQTT(t *testing.T, send func(c *mqttConn) error) []byte {
+	conn := &recordingConn{}
+	require.NoError(t, send(&mqttConn{conn: conn}))
+	return conn.written.Bytes()
+}
+
+// decodeMQTT reads one packet from raw bytes
+func decodeMQTT(raw []byte) (mqttPacket, error) {
+	c := &mqttConn{reader: bufio.NewReader(bytes.NewReader(raw))}
+	return c.read()
+}
+
+func TestMQTTRemainingLength(t *testing.T) {
+	tests := []struct {
+		length int
+		header []byte // fixed header of a PUBLISH with a body that long
+	}{
+		{0, []byte{0x30, 0x00}},
+		{1, []byte{0x30, 0x01}},
+		{127, []byte{0x30, 0x7f}},
+		{128, []byte{0x30, 0x80, 0x01}},
+		{321, []byte{0x30, 0xc1, 0x02}},
+		{16383, []byte{0x30, 0xff, 0x7f}},
+		{16384, []byte{0x30, 0x80, 0x80, 0x01}},
+		{2097151, []byte{0x30, 0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x30, 0x80, 0x80, 0x80, 0x01}},
+		{maxMQTTPacketSize, []byte{0x30, 0x80, 0x80, 0x80, 0x08}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.length), func(t *testing.T) {
+			body := bytes.Repeat([]byte{'x'}, tt.length)
+			raw := encodeMQTT(t, func(c *mqttConn) error { return c.write(mqttPublish, 0, body) })
+			require.Len(t, raw, len(tt.header)+tt.length)
+			assert.Equal(t, tt.header, raw[:len(tt.header)])
+
+			packet, err := decodeMQTT(raw)
+			require.NoError(t, err)
+			assert.Equal(t, byte(mqttPublish), packet.kind)
+			assert.Equal(t, byte(0), packet.flags)
+			assert.Len(t, packet.body, tt.length)
+		})
+	}
+}
+
+func TestMQTTReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+		err  string
+	}{
+		{"nothing", nil, io.EOF.Error()},
+		{"no remaining length", []byte{0x30}, io.EOF.Error()},
+		{"unfinished remaining length", []byte{0x30, 0x80, 0x80}, io.EOF.Error()},
+		{"five length bytes", []byte{0x30, 0x80, 0x80, 0x80, 0x80, 0x01}, "malformed MQTT remaining length"},
+		{"over the size limit", []byte{0x30, 0x81, 0x80, 0x80, 0x08}, "MQTT packet of 16777217 bytes exceeds the 16777216 byte limit"},
+		{"truncated body", []byte{0x30, 0x05, 'a', 'b'}, io.ErrUnexpectedEOF.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeMQTT(tt.raw)
+			require.Error(t, err)
+			assert.Equal(t, tt.err, err.Error())
+		})
+	}
+}
+
+func TestParsePublish(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     []byte
+		publish mqttPublishPacket
+		err     string
+	}{
+		{
+			name:    "QoS 0",
+			raw:     []byte{0x30, 0x07, 0x00, 0x03, 'a', '/', 'b', 'h', 'i'},
+			publish: mqttPublishPacket{topic: "a/b", payload: []byte("hi")},
+		},
+		{
+			name:    "QoS 1 with packet identifier",
+			raw:     []byte{0x32, 0x09, 0x00, 0x03, 'a', '/', 'b', 0x01, 0x02, 'h', 'i'},
+			publish: mqttPublishPacket{topic: "a/b", qos: 1, packetID: 0x0102, payload: []byte("hi")},
+		},
+		{
+			name:    "QoS 2, retained and duplicate, without payload",
+			raw:     []byte{0x3d, 0x07, 0x00, 0x03, 'a', '/', 'b', 0x00, 0x09},
+			publish: mqttPublishPacket{topic: "a/b", qos: 2, packetID: 9, payload: []byte{}},
+		},
+		{
+			name: "QoS 3",
+			raw:  []byte{0x36, 0x07, 0x00, 0x03, 'a', '/', 'b', 0x00, 0x01},
+			err:  "invalid PUBLISH QoS 3",
+		},
+		{
+			name: "QoS 1 without packet identifier",
+			raw:  []byte{0x32, 0x06, 0x00, 0x03, 'a', '/', 'b', 0x01},
+			err:  "PUBLISH without packet identifier",
+		},
+		{
+			name: "topic longer than the packet",
+			raw:  []byte{0x30, 0x04, 0x00, 0x05, 'a', '/'},
+			err:  "truncated MQTT string",
+		},
+		{
+			name: "no topic length",
+			raw:  []byte{0x30, 0x01, 0x00},
+			err:  "truncated MQTT string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet, err := decodeMQTT(tt.raw)
+			require.NoError(t, err)
+			require.Equal(t, byte(mqttPublish), packet.kind)
+
+			publish, err := parsePublish(packet)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.err, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.publish, publish)
+		})
+	}
+}
+
+// TestMQTTAckFlows decodes what the broker sends and encodes the answer the
+// session gives it: PUBACK for QoS 1, PUBREC then PUBCOMP for QoS 2
+func TestMQTTAckFlows(t *testing.T) {
+	tests := []struct {
+		name     string
+		received []byte
+		kind     byte // of the received packet
+		ack      byte // the packet answering it
+		reply    []byte
+	}{
+		{
+			name:     "QoS 1 PUBLISH is answered with PUBACK",
+			received: []byte{0x32, 0x08, 0x00, 0x01, 't', 0x00, 0x2a, 'm', 's', 'g'},
+			kind:     mqttPublish,
+			ack:      mqttPuback,
+			reply:    []byte{0x40, 0x02, 0x00, 0x2a},
+		},
+		{
+			name:     "QoS 2 PUBLISH is answered with PUBREC",
+			received: []byte{0x34, 0x08, 0x00, 0x01, 't', 0x12, 0x34, 'm', 's', 'g'},
+			kind:     mqttPublish,
+			ack:      mqttPubrec,
+			reply:    []byte{0x50, 0x02, 0x12, 0x34},
+		},
+		{
+			name:     "PUBREL is answered with PUBCOMP",
+			received: []byte{0x62, 0x02, 0x12, 0x34},
+			kind:     mqttPubrel,
+			ack:      mqttPubcomp,
+			reply:    []byte{0x70, 0x02, 0x12, 0x34},
+		},
+		{
+			name:     "PUBREC is answered with PUBREL and its reserved flags",
+			received: []byte{0x50, 0x02, 0xff, 0xff},
+			kind:     mqttPubrec,
+			ack:      mqttPubrel,
+			reply:    []byte{0x62, 0x02, 0xff, 0xff},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet, err := decodeMQTT(tt.received)
+			require.NoError(t, err)
+			require.Equal(t, tt.kind, packet.kind)
+
+			var packetID uint16
+			if packet.kind == mqttPublish {
+				publish, err := parsePublish(packet)
+				require.NoError(t, err)
+				packetID = publish.packetID
+			} else {
+				packetID, err = packet.packetID()
+				require.NoError(t, err)
+			}
+
+			reply := encodeMQTT(t, func(c *mqttConn) error { return c.ack(tt.ack, packetID) })
+			assert.Equal(t, tt.reply, reply)
+		})
+	}
+}
+
+func TestMQTTSubscribe(t *testing.T) {
+	raw := encodeMQTT(t, func(c *mqttConn) error {
+		return c.subscribe(1, []string{"v2x/+/bsm", "rsu/#"}, []byte{1, 2})
+	})
+	assert.Equal(t, []byte{
+		0x82, 0x16, // SUBSCRIBE with its reserved flags
+		0x00, 0x01, // packet identifier
+		0x00, 0x09, 'v', '2', 'x', '/', '+', '/', 'b', 's', 'm', 0x01,
+		0x00, 0x05, 'r', 's', 'u', '/', '#', 0x02,
+	}, raw)
+}
+
+func TestMQTTSuback(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      []byte
+		packetID uint16
+		codes    []byte
+		err      string
+	}{
+		{"granted", []byte{0x90, 0x04, 0x00, 0x01, 0x01, 0x02}, 1, []byte{0x01, 0x02}, ""},
+		{"one refused", []byte{0x90, 0x04, 0x00, 0x01, 0x00, 0x80}, 1, []byte{0x00, 0x80}, ""},
+		{"no return codes", []byte{0x90, 0x02, 0x01, 0x00}, 256, []byte{}, ""},
+		{"no packet identifier", []byte{0x90, 0x01, 0x00}, 0, nil, "packet type 9 without packet identifier"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet, err := decodeMQTT(tt.raw)
+			require.NoError(t, err)
+			assert.Equal(t, byte(mqttSuback), packet.kind)
+
+			packetID, err := packet.packetID()
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.err, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.packetID, packetID)
+			assert.Equal(t, tt.codes, packet.body[2:])
+		})
+	}
+}
@@ -0,0 +1,456 @@
+package collectors
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Link-layer header types of the captures the replay can decode
+// (https://www.tcpdump.org/linktypes.html)
+const (
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLoop     = 108
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+	linkTypeSLL2     = 276
+)
+
+// maxCapturedPacket bounds the packet length read from a capture, so a
+// corrupt length cannot allocate unbounded memory
+const maxCapturedPacket = 256 << 10
+
+// CapturedPacket is one packet read from a capture file
+type CapturedPacket struct {
+	Timestamp time.Time
+	LinkType  uint32
+	Data      []byte
+}
+
+// PcapReader reads packets from a pcap or pcapng capture
+type PcapReader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	ng    bool
+
+	// classic pcap
+	linkType uint32
+	nanos    bool
+
+	// pcapng, per interface of the current section
+	interfaces []pcapngInterface
+}
+
+// pcapngInterface is an Interface Description Block of a pcapng section
+type pcapngInterface struct {
+	linkType   uint32
+	resolution time.Duration // of the packet timestamps
+}
+
+// NewPcapReader reads the file header of a pcap or pcapng capture
+func NewPcapReader(r io.Reader) (*PcapReader, error) {
+	reader := &PcapReader{r: bufio.NewReader(r)}
+
+	magic, err := reader.r.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("not a capture file: %v", err)
+	}
+	if binary.BigEndian.Uint32(magic) == 0x0A0D0D0A {
+		reader.ng = true
+		return reader, nil
+	}
+
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(reader.r, header); err != nil {
+		return nil, fmt.Errorf("truncated pcap header: %v", err)
+	}
+	switch binary.LittleEndian.Uint32(header) {
+	case 0xa1b2c3d4:
+		reader.order = binary.LittleEndian
+	case 0xa1b23c4d:
+		reader.order, reader.nanos = binary.LittleEndian, true
+	case 0xd4c3b2a1:
+		reader.order = binary.BigEndian
+	case 0x4d3cb2a1:
+		reader.order, reader.nanos = binary.BigEndian, true
+	default:
+		return nil, errors.New("not a pcap or pcapng file")
+	}
+	reader.linkType = reader.order.Uint32(header[20:24]) & 0x0FFFFFFF
+	return reader, nil
+}
+
+// ReadPacket returns the next packet, or io.EOF at the end of the capture
+func (p *PcapReader) ReadPacket() (CapturedPacket, error) {
+	if p.ng {
+		return p.readBlock()
+	}
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(p.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return CapturedPacket{}, errors.New("truncated pcap record header")
+		}
+		return CapturedPacket{}, err
+	}
+	seconds, fraction := p.order.Uint32(header[0:4]), p.order.Uint32(header[4:8])
+	length := p.order.Uint32(header[8:12])
+	if length > maxCapturedPacket {
+		return CapturedPacket{}, fmt.Errorf("pcap record of %d bytes is too large", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return CapturedPacket{}, errors.New("truncated pcap record")
+	}
+
+	nanos := int64(fraction) * 1000
+	if p.nanos {
+		nanos = int64(fraction)
+	}
+	return CapturedPacket{Timestamp: time.Unix(int64(seconds), nanos).UTC(), LinkType: p.linkType, Data: data}, nil
+}
+
+// readBlock reads pcapng blocks until a packet block
+func (p *PcapReader) readBlock() (CapturedPacket, error) {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(p.r, header); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return CapturedPacket{}, errors.New("truncated pcapng block header")
+			}
+			return CapturedPacket{}, err
+		}
+
+		if binary.BigEndian.Uint32(header[0:4]) == 0x0A0D0D0A {
+			// a Section Header Block sets the byte order of its section
+			magic := make([]byte, 4)
+			if _, err := io.ReadFull(p.r, magic); err != nil {
+				return CapturedPacket{}, errors.New("truncated pcapng section header")
+			}
+			switch binary.LittleEndian.Uint32(magic) {
+			case 0x1A2B3C4D:
+				p.order = binary.LittleEndian
+			case 0x4D3C2B1A:
+				p.order = binary.BigEndian
+			default:
+				return CapturedPacket{}, errors.New("invalid pcapng byte-order magic")
+			}
+			p.interfaces = nil
+			if err := p.skip(int64(p.order.Uint32(header[4:8])) - 12); err != nil {
+				return CapturedPacket{}, err
+			}
+			continue
+		}
+		if p.order == nil {
+			return CapturedPacket{}, errors.New("pcapng block outside a section")
+		}
+
+		blockType, length := p.order.Uint32(header[0:4]), p.order.Uint32(header[4:8])
+		if length < 12 || length%4 != 0 || length > maxCapturedPacket+64 {
+			return CapturedPacket{}, fmt.Errorf("invalid pcapng block length %d", length)
+		}
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(p.r, body); err != nil {
+			return CapturedPacket{}, errors.New("truncated pcapng block")
+		}
+		body = body[:len(body)-4] // trailing copy of the length
+
+		switch blockType {
+		case 1: // Interface Description Block
+			if len(body) < 8 {
+				return CapturedPacket{}, errors.New("truncated pcapng interface description")
+			}
+			p.interfaces = append(p.interfaces, pcapngInterface{
+				linkType:   uint32(p.order.Uint16(body[0:2])),
+				resolution: p.timestampResolution(body[8:]),
+			})
+		case 6: // Enhanced Packet Block
+			if len(body) < 20 {
+				return CapturedPacket{}, errors.New("truncated pcapng packet block")
+			}
+			id := p.order.Uint32(body[0:4])
+			if int(id) >= len(p.interfaces) {
+				return CapturedPacket{}, fmt.Errorf("pcapng packet on undescribed interface %d", id)
+			}
+			iface := p.interfaces[id]
+			ticks := uint64(p.order.Uint32(body[4:8]))<<32 | uint64(p.order.Uint32(body[8:12]))
+			captured := p.order.Uint32(body[12:16])
+			if int(captured) > len(body)-20 {
+				return CapturedPacket{}, errors.New("pcapng packet longer than its block")
+			}
+			timestamp := time.Unix(0, 0).Add(time.Duration(ticks) * iface.resolution).UTC()
+			return CapturedPacket{Timestamp: timestamp, LinkType: iface.linkType, Data: body[20 : 20+captured]}, nil
+		case 3: // Simple Packet Block, without a timestamp
+			if len(body) < 4 || len(p.interfaces) == 0 {
+				return CapturedPacket{}, errors.New("invalid pcapng simple packet block")
+			}
+			captured := len(body) - 4
+			if original := int(p.order.Uint32(body[0:4])); original < captured {
+				captured = original
+			}
+			return CapturedPacket{LinkType: p.interfaces[0].linkType, Data: body[4 : 4+captured]}, nil
+		}
+		// other blocks (statistics, name resolution, custom) carry no packets
+	}
+}
+
+// timestampResolution reads the if_tsresol option of an interface, microseconds by default
+func (p *PcapReader) timestampResolution(options []byte) time.Duration {
+	for len(options) >= 4 {
+		code, length := p.order.Uint16(options[0:2]), int(p.order.Uint16(options[2:4]))
+		if code == 0 || len(options) < 4+length {
+			break
+		}
+		if code == 9 && length >= 1 {
+			value := options[4]
+			if value&0x80 != 0 {
+				return time.Second / time.Duration(uint64(1)<<(value&0x7F))
+			}
+			resolution := time.Second
+			for i := byte(0); i < value && resolution > 1; i++ {
+				resolution /= 10
+			}
+			return resolution
+		}
+		options = options[4+(length+3)/4*4:]
+	}
+	return time.Microsecond
+}
+
+// skip discards n bytes
+func (p *PcapReader) skip(n int64) error {
+	if n < 0 {
+		return errors.New("invalid pcapng block length")
+	}
+	if _, err := io.CopyN(io.Discard, p.r, n); err != nil {
+		return errors.New("truncated pcapng block")
+	}
+	return nil
+}
+
+// UDPDatagram is the UDP payload of a captured packet
+type UDPDatagram struct {
+	Source      string // host:port
+	Destination string
+	DstPort     int
+	Payload     []byte
+}
+
+// DecodeUDP extracts the UDP datagram of a captured packet; ok is false for
+// other protocols, fragments and link types the replay does not decode
+func DecodeUDP(packet CapturedPacket) (UDPDatagram, bool) {
+	data := packet.Data
+	var etherType uint16
+	switch packet.LinkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return UDPDatagram{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[12:14]), data[14:]
+		for (etherType == 0x8100 || etherType == 0x88A8) && len(data) >= 4 { // VLAN tags
+			etherType, data = binary.BigEndian.Uint16(data[2:4]), data[4:]
+		}
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return UDPDatagram{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[14:16]), data[16:]
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return UDPDatagram{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[0:2]), data[20:]
+	case linkTypeNull, linkTypeLoop:
+		if len(data) < 4 {
+			return UDPDatagram{}, false
+		}
+		data = data[4:] // the address family; the IP version says the rest
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+	default:
+		return UDPDatagram{}, false
+	}
+	if etherType != 0 && etherType != 0x0800 && etherType != 0x86DD {
+		return UDPDatagram{}, false
+	}
+	if len(data) == 0 {
+		return UDPDatagram{}, false
+	}
+
+	var src, dst net.IP
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return UDPDatagram{}, false
+		}
+		headerLen := int(data[0]&0x0F) * 4
+		fragment := binary.BigEndian.Uint16(data[6:8])
+		if data[9] != 17 || headerLen < 20 || len(data) < headerLen || fragment&0x3FFF != 0 {
+			return UDPDatagram{}, false
+		}
+		if total := int(binary.BigEndian.Uint16(data[2:4])); total >= headerLen && total < len(data) {
+			data = data[:total] // drop Ethernet padding
+		}
+		src, dst, data = net.IP(data[12:16]), net.IP(data[16:20]), data[headerLen:]
+	case 6:
+		if len(data) < 40 || data[6] != 17 {
+			return UDPDatagram{}, false
+		}
+		src, dst, data = net.IP(data[8:24]), net.IP(data[24:40]), data[40:]
+	default:
+		return UDPDatagram{}, false
+	}
+
+	if len(data) < 8 {
+		return UDPDatagram{}, false
+	}
+	srcPort, dstPort := binary.BigEndian.Uint16(data[0:2]), binary.BigEndian.Uint16(data[2:4])
+	payload := data[8:]
+	if length := int(binary.BigEndian.Uint16(data[4:6])); length >= 8 && length-8 < len(payload) {
+		payload = payload[:length-8]
+	}
+	return UDPDatagram{
+		Source:      net.JoinHostPort(src.String(), strconv.Itoa(int(srcPort))),
+		Destination: net.JoinHostPort(dst.String(), strconv.Itoa(int(dstPort))),
+		DstPort:     int(dstPort),
+		Payload:     payload,
+	}, true
+}
+
+// PcapWriter writes Ethernet frames to a classic pcap capture
+type PcapWriter struct {
+	w io.Writer
+}
+
+// NewPcapWriter writes the file header of a microsecond pcap capture
+func NewPcapWriter(w io.Writer) (*PcapWriter, error) {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:6], 2) // version 2.4
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], maxCapturedPacket) // snapshot length
+	binary.LittleEndian.PutUint32(header[20:24], linkTypeEthernet)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &PcapWriter{w: w}, nil
+}
+
+// WritePacket appends a frame captured at timestamp
+func (p *PcapWriter) WritePacket(timestamp time.Time, frame []byte) error {
+	if len(frame) > maxCapturedPacket {
+		return fmt.Errorf("frame of %d bytes is too large", len(frame))
+	}
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(timestamp.Unix()))
+	binary.LittleEndian.PutUint32(header[4:8], uint32(timestamp.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(header[8:12], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(header[12:16], uint32(len(frame)))
+	if _, err := p.w.Write(header); err != nil {
+		return err
+	}
+	_, err := p.w.Write(frame)
+	return err
+}
+
+// EncodeUDP builds the Ethernet frame of a UDP datagram between the
+// host:port addresses of Source and Destination, the reverse of DecodeUDP.
+// Both addresses must be of the same IP version.
+func EncodeUDP(datagram UDPDatagram) ([]byte, error) {
+	src, srcPort, err := splitUDPAddress(datagram.Source)
+	if err != nil {
+		return nil, fmt.Errorf("source: %v", err)
+	}
+	dst, dstPort, err := splitUDPAddress(datagram.Destination)
+	if err != nil {
+		return nil, fmt.Errorf("destination: %v", err)
+	}
+	src4, dst4 := src.To4(), dst.To4()
+	if (src4 == nil) != (dst4 == nil) {
+		return nil, errors.New("source and destination are of different IP versions")
+	}
+
+	udpLength := 8 + len(datagram.Payload)
+	if udpLength > 0xFFFF-40 {
+		return nil, fmt.Errorf("payload of %d bytes does not fit a UDP datagram", len(datagram.Payload))
+	}
+	udp := make([]byte, udpLength)
+	binary.BigEndian.PutUint16(udp[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(udp[2:4], uint16(dstPort))
+	binary.BigEndian.PutUint16(udp[4:6], uint16(udpLength))
+	copy(udp[8:], datagram.Payload)
+
+	// broadcast from a locally administered address, as a radio would send it
+	frame := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02, 0, 0, 0, 0, 0x01, 0, 0}
+	if src4 != nil {
+		binary.BigEndian.PutUint16(frame[12:14], 0x0800)
+		ip := make([]byte, 20)
+		ip[0] = 0x45 // version 4, 20-byte header
+		binary.BigEndian.PutUint16(ip[2:4], uint16(20+udpLength))
+		ip[8], ip[9] = 64, 17 // TTL, UDP
+		copy(ip[12:16], src4)
+		copy(ip[16:20], dst4)
+		binary.BigEndian.PutUint16(ip[10:12], internetChecksum(ip))
+		// a zero UDP checksum means none over IPv4
+		return append(append(frame, ip...), udp...), nil
+	}
+
+	binary.BigEndian.PutUint16(frame[12:14], 0x86DD)
+	ip := make([]byte, 40)
+	ip[0] = 0x60 // version 6
+	binary.BigEndian.PutUint16(ip[4:6], uint16(udpLength))
+	ip[6], ip[7] = 17, 64 // UDP, hop limit
+	copy(ip[8:24], src.To16())
+	copy(ip[24:40], dst.To16())
+	// the checksum is mandatory over IPv6, and covers a pseudo-header
+	pseudo := make([]byte, 40, 40+udpLength)
+	copy(pseudo[0:32], ip[8:40])
+	binary.BigEndian.PutUint32(pseudo[32:36], uint32(udpLength))
+	pseudo[39] = 17
+	checksum := internetChecksum(append(pseudo, udp...))
+	if checksum == 0 {
+		checksum = 0xFFFF
+	}
+	binary.BigEndian.PutUint16(udp[6:8], checksum)
+	return append(append(frame, ip...), udp...), nil
+}
+
+// splitUDPAddress parses a host:port address with an IP host
+func splitUDPAddress(address string) (net.IP, int, error) {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, 0, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, 0, fmt.Errorf("%q is not an IP address", host)
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port < 0 || port > 65535 {
+		return nil, 0, fmt.Errorf("invalid port %q", portText)
+	}
+	return ip, port, nil
+}
+
+// internetChecksum is the ones' complement checksum of IP and UDP headers
+func internetChecksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i : i+2]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xFFFF {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,315 @@
+package collectors
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/live"
+	"traffic-monitoring-go/app/siem/routing"
+)
+
+// replayCollector names replayed messages in the parse error statistics
+const replayCollector = "pcap-replay"
+
+// maxReplays is the number of finished replays kept for their results
+const maxReplays = 50
+
+// replayLog is the logger of capture replays
+var replayLog = logging.New("collectors.replay")
+
+// ReplayStatus is the state of a capture replay
+type ReplayStatus string
+
+const (
+	ReplayRunning   ReplayStatus = "running"
+	ReplayCompleted ReplayStatus = "completed"
+	ReplayFailed    ReplayStatus = "failed"
+	ReplayCancelled ReplayStatus = "cancelled"
+)
+
+// ReplayConfig configures a capture replay
+type ReplayConfig struct {
+	Parser string  `json:"parser"` // parser of the UDP payloads, json for the simulator's events
+	Port   int     `json:"port"`   // replays only datagrams to this UDP port when set
+	Speed  float64 `json:"speed"`  // 1 replays at the original pace, 10 ten times faster, 0 as fast as possible
+}
+
+// Validate checks a replay configuration
+func (c ReplayConfig) Validate() error {
+	if _, ok := GetParser(c.Parser); !ok {
+		return fmt.Errorf("unknown parser %q, available: %v", c.Parser, ParserNames())
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535, or 0 for any")
+	}
+	if c.Speed < 0 {
+		return fmt.Errorf("speed must not be negative")
+	}
+	return nil
+}
+
+// ReplayResult counts what a replay did with the packets of its capture
+type ReplayResult struct {
+	Packets      int        `json:"packets"`
+	Datagrams    int        `json:"datagrams"` // UDP datagrams replayed
+	Skipped      int        `json:"skipped"`   // packets that are not UDP, or not to the port
+	Ingested     int        `json:"ingested"`
+	Findings     int        `json:"findings"` // anomalies and other events the SIEM raised
+	Alerts       int        `json:"alerts"`
+	ParseErrors  int        `json:"parse_errors"`
+	IngestErrors int        `json:"ingest_errors"`
+	CaptureStart *time.Time `json:"capture_start,omitempty"`
+	CaptureEnd   *time.Time `json:"capture_end,omitempty"`
+}
+
+// Replay is a capture replayed through the ingestion pipeline
+type Replay struct {
+	ID         string       `json:"id"`
+	Config     ReplayConfig `json:"config"`
+	Status     ReplayStatus `json:"status"`
+	Error      string       `json:"error,omitempty"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	Result     ReplayResult `json:"result"`
+
+	mutex  sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Snapshot returns a copy of the replay's progress
+func (r *Replay) Snapshot() Replay {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return Replay{
+		ID:         r.ID,
+		Config:     r.Config,
+		Status:     r.Status,
+		Error:      r.Error,
+		StartedAt:  r.StartedAt,
+		FinishedAt: r.FinishedAt,
+		Result:     r.Result,
+	}
+}
+
+// Wait blocks until the replay has finished
+func (r *Replay) Wait() {
+	<-r.done
+}
+
+// ReplayCapture replays the UDP payloads of a pcap or pcapng capture through
+// the parser and ingestion pipeline, as a listener would have received them,
+// keeping the original spacing of the packets divided by config.Speed.
+// progress is updated as packets are replayed.
+func ReplayCapture(ctx context.Context, db *gorm.DB, config ReplayConfig, capture io.Reader, progress func(func(*ReplayResult))) error {
+	reader, err := NewPcapReader(capture)
+	if err != nil {
+		return err
+	}
+	parse, _ := GetParser(config.Parser)
+
+	ingester := siem.NewEventIngester(db)
+	ingester.EvaluateRules = true
+
+	var firstPacket, wallStart time.Time
+	for {
+		packet, err := reader.ReadPacket()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		datagram, ok := DecodeUDP(packet)
+		if !ok || config.Port != 0 && datagram.DstPort != config.Port {
+			progress(func(r *ReplayResult) { r.Packets++; r.Skipped++ })
+			continue
+		}
+
+		// wait until the packet is due; packets without a timestamp are not delayed
+		if config.Speed > 0 && !packet.Timestamp.IsZero() {
+			if firstPacket.IsZero() {
+				firstPacket, wallStart = packet.Timestamp, time.Now()
+			}
+			due := wallStart.Add(time.Duration(float64(packet.Timestamp.Sub(firstPacket)) / config.Speed))
+			if wait := time.Until(due); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+
+		countMessage(replayCollector, datagram.Payload)
+		source := siem.ParseSource{Collector: replayCollector, Address: datagram.Source, MessageType: config.Parser}
+		eventJSON, err := parse(datagram.Payload, datagram.Source)
+		if err != nil {
+			siem.RecordParseFailure(source, err)
+			progress(func(r *ReplayResult) { r.observe(packet); r.Datagrams++; r.ParseErrors++ })
+			continue
+		}
+
+		datagramCtx := logging.WithCorrelationID(ctx, logging.NewID())
+		result, err := ingester.Ingest(siem.WithParseSource(datagramCtx, source), eventJSON)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			replayLog.WithContext(datagramCtx).Sampled("replay.ingest").Error("failed to ingest replayed event",
+				"source", datagram.Source, "error", err)
+			progress(func(r *ReplayResult) { r.observe(packet); r.Datagrams++; r.IngestErrors++ })
+			continue
+		}
+
+		for _, event := range result.Events() {
+			routing.Route(event)
+			live.Record(event)
+		}
+		progress(func(r *ReplayResult) {
+			r.observe(packet)
+			r.Datagrams++
+			r.Ingested++
+			r.Findings += len(result.Findings)
+			r.Alerts += len(result.Alerts)
+		})
+	}
+}
+
+// observe counts a replayed packet and extends the capture time range to it
+func (r *ReplayResult) observe(packet CapturedPacket) {
+	r.Packets++
+	if packet.Timestamp.IsZero() {
+		return
+	}
+	timestamp := packet.Timestamp
+	if r.CaptureStart == nil || timestamp.Before(*r.CaptureStart) {
+		r.CaptureStart = &timestamp
+	}
+	if r.CaptureEnd == nil || timestamp.After(*r.CaptureEnd) {
+		r.CaptureEnd = &timestamp
+	}
+}
+
+// StartReplay replays a capture in the background; the replay is listed
+// until maxReplays newer ones have finished
+func (m *CollectorManager) StartReplay(config ReplayConfig, capture []byte) (*Replay, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := NewPcapReader(bytes.NewReader(capture)); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	replay := &Replay{
+		ID:        hex.EncodeToString(id),
+		Config:    config,
+		Status:    ReplayRunning,
+		StartedAt: time.Now(),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	m.mutex.Lock()
+	if m.replays == nil {
+		m.replays = make(map[string]*Replay)
+	}
+	m.replays[replay.ID] = replay
+	m.pruneReplays()
+	m.mutex.Unlock()
+
+	go func() {
+		defer close(replay.done)
+		defer cancel()
+
+		err := ReplayCapture(ctx, m.DB, config, bytes.NewReader(capture), func(update func(*ReplayResult)) {
+			replay.mutex.Lock()
+			update(&replay.Result)
+			replay.mutex.Unlock()
+		})
+
+		replay.mutex.Lock()
+		defer replay.mutex.Unlock()
+		finished := time.Now()
+		replay.FinishedAt = &finished
+		switch {
+		case errors.Is(err, context.Canceled):
+			replay.Status = ReplayCancelled
+		case err != nil:
+			replay.Status, replay.Error = ReplayFailed, err.Error()
+		default:
+			replay.Status = ReplayCompleted
+		}
+		m.Log.Info("capture replay finished", "replay", replay.ID, "status", replay.Status,
+			"ingested", replay.Result.Ingested, "packets", replay.Result.Packets)
+	}()
+	return replay, nil
+}
+
+// pruneReplays forgets the oldest finished replays beyond maxReplays; the caller holds the mutex
+func (m *CollectorManager) pruneReplays() {
+	for len(m.replays) > maxReplays {
+		var oldest *Replay
+		for _, replay := range m.replays {
+			snapshot := replay.Snapshot()
+			if snapshot.Status != ReplayRunning && (oldest == nil || snapshot.StartedAt.Before(oldest.StartedAt)) {
+				oldest = replay
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		delete(m.replays, oldest.ID)
+	}
+}
+
+// GetReplays returns the progress of the replays, newest first
+func (m *CollectorManager) GetReplays() []Replay {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	replays := make([]Replay, 0, len(m.replays))
+	for _, replay := range m.replays {
+		replays = append(replays, replay.Snapshot())
+	}
+	sort.Slice(replays, func(i, j int) bool { return replays[i].StartedAt.After(replays[j].StartedAt) })
+	return replays
+}
+
+// GetReplay returns a replay by ID
+func (m *CollectorManager) GetReplay(id string) (*Replay, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	replay, ok := m.replays[id]
+	return replay, ok
+}
+
+// CancelReplay stops a running replay; the events already ingested are kept
+func (m *CollectorManager) CancelReplay(id string) error {
+	replay, ok := m.GetReplay(id)
+	if !ok {
+		return fmt.Errorf("replay '%s' not found", id)
+	}
+	replay.cancel()
+	return nil
+}
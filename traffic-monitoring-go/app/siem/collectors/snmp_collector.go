@@ -2,14 +2,15 @@ package collectors
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
 	"net"
 	"time"
 
 	"gorm.io/gorm"
-	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/live"
+	"traffic-monitoring-go/app/siem/routing"
 )
 
 // SNMPCollector collects events from SNMP traps
@@ -24,8 +25,10 @@ var _ CollectorInterface = (*SNMPCollector)(nil)
 
 // NewSNMPCollector creates a new SNMPCollector
 func NewSNMPCollector(db *gorm.DB, port int) *SNMPCollector {
+	base := NewBaseCollector(db)
+	base.Log = logging.New("collectors.snmp")
 	return &SNMPCollector{
-		BaseCollector: NewBaseCollector(db),
+		BaseCollector: base,
 		Port:         port,
 	}
 }
@@ -49,7 +52,7 @@ func (c *SNMPCollector) Start(ctx context.Context) error {
 	}
 
 	c.Running = true
-	log.Printf("SNMP collector started on UDP port %d", c.Port)
+	c.Log.Info("SNMP collector started", "port", c.Port)
 
 	// start processing in a goroutine
 	go func() {
@@ -57,15 +60,15 @@ func (c *SNMPCollector) Start(ctx context.Context) error {
 		for {
 			select {
 			case <-c.StopChan:
-				log.Println("SNMP collector received stop signal")
+				c.Log.Info("SNMP collector received stop signal")
 				return
 			case <-ctx.Done():
-				log.Println("SNMP collector context canceled")
+				c.Log.Info("SNMP collector context canceled")
 				return
 			default:
 				// set a read deadline to allow checking for the stop signal
 				if err := c.listener.SetReadDeadline(time.Now().Add(1 * time.Second)); err != nil {
-					log.Printf("Error setting read deadline: %v", err)
+					c.Log.Error("failed to set read deadline", "error", err)
 					continue
 				}
 
@@ -76,16 +79,20 @@ func (c *SNMPCollector) Start(ctx context.Context) error {
 						// timeout is expected when no data is received
 						continue
 					}
-					log.Printf("Error reading SNMP trap: %v", err)
+					c.Log.Sampled("snmp.read").Error("failed to read SNMP trap", "error", err)
 					continue
 				}
 
 				// process the received trap
-				trap := buffer[:n]
-				log.Printf("Received SNMP trap: %d bytes from %s", n, addr.String())
-
-				// Parse and process the SNMP trap
-				go c.processSNMPTrap(trap, addr.String())
+				trap := make([]byte, n)
+				copy(trap, buffer[:n])
+				c.Log.Sampled("snmp.received").Debug("SNMP trap received", "bytes", n, "source", addr.String())
+
+				// Parse and process the SNMP trap on an ingest worker
+				source := addr.String()
+				siem.DefaultIngestPool().Submit("snmp", func() {
+					c.processSNMPTrap(ctx, trap, source)
+				}, nil)
 			}
 		}
 	}()
@@ -104,54 +111,35 @@ func (c *SNMPCollector) Stop() error {
 		c.listener.Close()
 	}
 	c.Running = false
-	log.Println("SNMP collector stopped")
+	c.Log.Info("SNMP collector stopped")
 	return nil
 }
 
-// processSNMPTrap handles a received SNMP trap
-func (c *SNMPCollector) processSNMPTrap(trap []byte, sourceAddr string) {
-	// Parse the source IP from the address
-	srcIP, _, err := net.SplitHostPort(sourceAddr)
-	if err != nil {
-		srcIP = sourceAddr // fallback to using the full address
-	}
-
-	// Create a raw event from the SNMP trap
-	rawEvent := struct {
-		SourceName string                 `json:"source_name"`
-		SourceType string                 `json:"source_type"`
-		Timestamp  time.Time              `json:"timestamp"`
-		Severity   string                 `json:"severity"`
-		Category   string                 `json:"category"`
-		Message    string                 `json:"message"`
-		Details    map[string]interface{} `json:"details"`
-	}{
-		SourceName: "snmp",
-		SourceType: string(models.SourceTypeNetwork),
-		Timestamp:  time.Now(),
-		Severity:   string(models.SeverityInfo),
-		Category:   string(models.CategoryNetwork),
-		Message:    fmt.Sprintf("SNMP trap received from %s", sourceAddr),
-		Details: map[string]interface{}{
-			"source_ip":  srcIP,
-			"raw_length": len(trap),
-			"protocol":   "SNMP",
-		},
-	}
-
-	// Convert to JSON for ingestion
-	eventJSON, err := json.Marshal(rawEvent)
+// processSNMPTrap handles a received SNMP trap, under a correlation ID of its own
+func (c *SNMPCollector) processSNMPTrap(ctx context.Context, trap []byte, sourceAddr string) {
+	ctx = logging.WithCorrelationID(ctx, logging.NewID())
+	logger := c.Log.WithContext(ctx).With("source", sourceAddr)
+	countMessage("snmp", trap)
+	source := siem.ParseSource{Collector: "snmp", Address: sourceAddr, MessageType: "snmp"}
+	eventJSON, err := ParseSNMPTrap(trap, sourceAddr)
 	if err != nil {
-		log.Printf("Error marshaling SNMP event: %v", err)
+		siem.RecordParseFailure(source, err)
+		logger.Sampled("snmp.parse").Warn("failed to parse SNMP trap", "error", err)
 		return
 	}
 
 	// Ingest the event
-	err = c.EventIngester.IngestEvent(eventJSON)
+	result, err := c.EventIngester.Ingest(siem.WithParseSource(ctx, source), eventJSON)
 	if err != nil {
-		log.Printf("Error ingesting SNMP event: %v", err)
+		logger.Sampled("snmp.ingest").Error("failed to ingest event", "error", err)
 		return
 	}
 
-	log.Printf("Processed SNMP trap from %s", sourceAddr)
+	// Fan the event and its findings out to the configured sinks
+	for _, event := range result.Events() {
+		routing.Route(event)
+		live.Record(event)
+	}
+
+	logger.Sampled("snmp.processed").Debug("SNMP trap processed", "event_id", result.Event.ID)
 }
\ No newline at end of file
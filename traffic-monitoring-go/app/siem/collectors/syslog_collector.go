@@ -2,14 +2,15 @@ package collectors
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
 	"net"
 	"time"
 
 	"gorm.io/gorm"
-	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/live"
+	"traffic-monitoring-go/app/siem/routing"
 )
 
 // SyslogCollector collects events from syslog
@@ -24,8 +25,10 @@ var _ CollectorInterface = (*SyslogCollector)(nil)
 
 // NewSyslogCollector creates a new SyslogCollector
 func NewSyslogCollector(db *gorm.DB, port int) *SyslogCollector {
+	base := NewBaseCollector(db)
+	base.Log = logging.New("collectors.syslog")
 	return &SyslogCollector{
-		BaseCollector: NewBaseCollector(db),
+		BaseCollector: base,
 		Port:         port,
 	}
 }
@@ -49,7 +52,7 @@ func (c *SyslogCollector) Start(ctx context.Context) error {
 	}
 
 	c.Running = true
-	log.Printf("Syslog collector started on UDP port %d", c.Port)
+	c.Log.Info("Syslog collector started", "port", c.Port)
 
 	// start processing in a goroutine
 	go func() {
@@ -57,15 +60,15 @@ func (c *SyslogCollector) Start(ctx context.Context) error {
 		for {
 			select {
 			case <-c.StopChan:
-				log.Println("Syslog collector received stop signal")
+				c.Log.Info("Syslog collector received stop signal")
 				return
 			case <-ctx.Done():
-				log.Println("Syslog collector context canceled")
+				c.Log.Info("Syslog collector context canceled")
 				return
 			default:
 				// set a read deadline to allow checking for the stop signal
 				if err := c.listener.SetReadDeadline(time.Now().Add(1 * time.Second)); err != nil {
-					log.Printf("Error setting read deadline: %v", err)
+					c.Log.Error("failed to set read deadline", "error", err)
 					continue
 				}
 
@@ -76,16 +79,20 @@ func (c *SyslogCollector) Start(ctx context.Context) error {
 						//Timeout is expected when no data is received
 						continue
 					}
-					log.Printf("Error reading syslog message: %v", err)
+					c.Log.Sampled("syslog.read").Error("failed to read syslog message", "error", err)
 					continue
 				}
 
 				// process the received message
-				message := buffer[:n]
-				log.Printf("Received %d bytes from %s", n, addr.String())
-
-				//parse and process the syslog message
-				go c.processSyslogMessage(message, addr.String())
+				message := make([]byte, n)
+				copy(message, buffer[:n])
+				c.Log.Sampled("syslog.received").Debug("syslog message received", "bytes", n, "source", addr.String())
+
+				//parse and process the syslog message on an ingest worker
+				source := addr.String()
+				siem.DefaultIngestPool().Submit("syslog", func() {
+					c.processSyslogMessage(ctx, message, source)
+				}, nil)
 			}
 		}
 	}()
@@ -104,53 +111,35 @@ func (c *SyslogCollector) Stop() error {
 		c.listener.Close()
 	}
 	c.Running = false
-	log.Println("Syslog collector stopped")
+	c.Log.Info("Syslog collector stopped")
 	return nil
 }
 
-// processSyslogMessage handles a received syslog message
-func (c *SyslogCollector) processSyslogMessage(message []byte, sourceAddr string) {
-	// Parse the source IP from the address
-	srcIP, _, err := net.SplitHostPort(sourceAddr)
-	if err != nil {
-		srcIP = sourceAddr // fallback to using the full address
-	}
-
-	// create a raw event from the syslog message
-	rawEvent := struct {
-		SourceName string                 `json:"source_name"`
-		SourceType string                 `json:"source_type"`
-		Timestamp  time.Time              `json:"timestamp"`
-		Severity   string                 `json:"severity"`
-		Category   string                 `json:"category"`
-		Message    string                 `json:"message"`
-		Details    map[string]interface{} `json:"details"`
-	}{
-		SourceName: "syslog",
-		SourceType: string(models.SourceTypeSystem),
-		Timestamp:  time.Now(), // in real implementation, parse from the message
-		Severity:   string(models.SeverityInfo),
-		Category:   string(models.CategorySystem),
-		Message:    string(message),
-		Details: map[string]interface{}{
-			"source_ip":  srcIP,
-			"raw_length": len(message),
-		},
-	}
-
-	// convert to JSON for ingestion
-	eventJSON, err := json.Marshal(rawEvent)
+// processSyslogMessage handles a received syslog message, under a correlation ID of its own
+func (c *SyslogCollector) processSyslogMessage(ctx context.Context, message []byte, sourceAddr string) {
+	ctx = logging.WithCorrelationID(ctx, logging.NewID())
+	logger := c.Log.WithContext(ctx).With("source", sourceAddr)
+	countMessage("syslog", message)
+	source := siem.ParseSource{Collector: "syslog", Address: sourceAddr, MessageType: "syslog"}
+	eventJSON, err := ParseSyslog(message, sourceAddr)
 	if err != nil {
-		log.Printf("Error marshaling syslog event: %v", err)
+		siem.RecordParseFailure(source, err)
+		logger.Sampled("syslog.parse").Warn("failed to parse syslog message", "error", err)
 		return
 	}
 
 	// ingest the event
-	err = c.EventIngester.IngestEvent(eventJSON)
+	result, err := c.EventIngester.Ingest(siem.WithParseSource(ctx, source), eventJSON)
 	if err != nil {
-		log.Printf("Error ingesting syslog event: %v", err)
+		logger.Sampled("syslog.ingest").Error("failed to ingest event", "error", err)
 		return
 	}
 
-	log.Printf("Processed syslog message from %s", sourceAddr)
+	// Fan the event and its findings out to the configured sinks
+	for _, event := range result.Events() {
+		routing.Route(event)
+		live.Record(event)
+	}
+
+	logger.Sampled("syslog.processed").Debug("syslog message processed", "event_id", result.Event.ID)
 }
\ No newline at end of file
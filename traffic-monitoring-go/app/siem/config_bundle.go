@@ -0,0 +1,505 @@
+package siem
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// ConfigBundleFormatVersion is the version of the bundle layout written by Export
+const ConfigBundleFormatVersion = 1
+
+// configBundleAlgorithm names the signature scheme of signed bundles
+const configBundleAlgorithm = "hmac-sha256"
+
+var (
+	// ErrBundleKeyMissing is returned when CONFIG_BUNDLE_KEY is not set
+	ErrBundleKeyMissing = errors.New("CONFIG_BUNDLE_KEY is not configured")
+	// ErrBundleSignature is returned when a bundle was not signed with this instance's key or was altered
+	ErrBundleSignature = errors.New("bundle signature does not match")
+)
+
+// ConfigBundle is the SIEM configuration of an instance, without any event,
+// alert or measurement data. Cross references use the IDs of the exporting
+// instance and are remapped on import.
+type ConfigBundle struct {
+	FormatVersion       int                            `json:"format_version"`
+	ExportedAt          time.Time                      `json:"exported_at"`
+	LogSources          []models.LogSource             `json:"log_sources"`
+	SeverityMappings    []models.SeverityMapping       `json:"severity_mappings"`
+	Rules               []models.Rule                  `json:"rules"`
+	TransformRules      []models.TransformRule         `json:"transform_rules"`
+	VendorPatterns      []models.VendorPattern         `json:"vendor_patterns"`
+	CollectorListeners  []models.CollectorListener     `json:"collector_listeners"`
+	MQTTBrokers         []models.MQTTBroker            `json:"mqtt_brokers"`
+	EventSinks          []models.EventSink             `json:"event_sinks"`
+	RoutingRules        []models.RoutingRule           `json:"routing_rules"`
+	HuntQueries         []models.HuntQuery             `json:"hunt_queries"`
+	SourceMutes         []models.SourceMute            `json:"source_mutes"` // active mutes only
+	RSUs                []models.RSU                   `json:"rsus"`
+	RoadSegments        []models.RoadSegment           `json:"road_segments"`
+	Intersections       []models.SyntheticIntersection `json:"intersections"`
+	DashboardLayouts    []models.DashboardLayout       `json:"dashboard_layouts"` // role defaults only
+	TrendRules          []models.TrendRule             `json:"trend_rules"`
+	V2XThreats          []models.V2XThreat             `json:"v2x_threats"`
+	AnomalyDetectors    []models.AnomalyDetectorConfig `json:"anomaly_detectors"`
+	Geofences           []models.Geofence              `json:"geofences"`
+	FleetOperators      []models.FleetOperator         `json:"fleet_operators"`
+	RegulatoryTemplates []models.RegulatoryTemplate    `json:"regulatory_templates"`
+	RetentionPolicies   []models.RetentionPolicy       `json:"retention_policies"`
+	ResponseActions     []models.ResponseAction        `json:"response_actions"`
+	ReportTemplates     []models.ReportTemplate        `json:"report_templates"`
+}
+
+// SignedConfigBundle is the exported file: the bundle and its signature
+type SignedConfigBundle struct {
+	Algorithm string          `json:"algorithm"`
+	Bundle    json.RawMessage `json:"bundle"`
+	Signature string          `json:"signature"`
+}
+
+// ConfigImportCount counts the entries of one bundle section applied by an import
+type ConfigImportCount struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+}
+
+// ConfigImportResult summarizes an import
+type ConfigImportResult struct {
+	DryRun     bool                          `json:"dry_run"`
+	ExportedAt time.Time                     `json:"exported_at"`
+	Sections   map[string]*ConfigImportCount `json:"sections"`
+}
+
+var bundleSigningKey = config.NewString("CONFIG_BUNDLE_KEY", "", "Key signing the configuration bundles moved between instances", config.Secret)
+
+// bundleKey returns the signing key shared by the instances a bundle moves between
+func bundleKey() ([]byte, error) {
+	key := bundleSigningKey.Get()
+	if key == "" {
+		return nil, ErrBundleKeyMissing
+	}
+	return []byte(key), nil
+}
+
+// signBundle computes the signature of a bundle. Whitespace is not signed,
+// so a bundle stays valid when it is reformatted.
+func signBundle(key []byte, bundle []byte) (string, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, bundle); err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(compact.Bytes())
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ExportConfig collects the configuration of this instance into a signed bundle
+func ExportConfig(db *gorm.DB) (*SignedConfigBundle, error) {
+	key, err := bundleKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// read from the primary: a DR copy must not miss changes still replicating
+	bundle := ConfigBundle{FormatVersion: ConfigBundleFormatVersion, ExportedAt: time.Now().UTC()}
+
+	queries := []struct {
+		query *gorm.DB
+		dest  interface{}
+	}{
+		{db.Order("id ASC"), &bundle.LogSources},
+		{db.Order("id ASC"), &bundle.SeverityMappings},
+		{db.Order("id ASC"), &bundle.Rules},
+		{db.Order("id ASC"), &bundle.TransformRules},
+		{db.Order("id ASC"), &bundle.VendorPatterns},
+		{db.Order("id ASC"), &bundle.CollectorListeners},
+		{db.Order("id ASC"), &bundle.MQTTBrokers},
+		{db.Order("id ASC"), &bundle.EventSinks},
+		{db.Order("id ASC"), &bundle.RoutingRules},
+		{db.Order("id ASC"), &bundle.HuntQueries},
+		{db.Where("resolved_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", clock.Now()).Order("id ASC"), &bundle.SourceMutes},
+		{db.Order("id ASC"), &bundle.RSUs},
+		{db.Order("id ASC"), &bundle.RoadSegments},
+		{db.Order("id ASC"), &bundle.Intersections},
+		{db.Where("user_id IS NULL").Order("id ASC"), &bundle.DashboardLayouts},
+		{db.Order("id ASC"), &bundle.TrendRules},
+		{db.Order("id ASC"), &bundle.V2XThreats},
+		{db.Order("id ASC"), &bundle.AnomalyDetectors},
+		{db.Order("id ASC"), &bundle.Geofences},
+		{db.Order("id ASC"), &bundle.FleetOperators},
+		{db.Order("id ASC"), &bundle.RegulatoryTemplates},
+		{db.Order("id ASC"), &bundle.RetentionPolicies},
+		{db.Order("id ASC"), &bundle.ResponseActions},
+		{db.Order("id ASC"), &bundle.ReportTemplates},
+	}
+	for _, q := range queries {
+		if err := q.query.Find(q.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	payload, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signBundle(key, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedConfigBundle{Algorithm: configBundleAlgorithm, Bundle: payload, Signature: signature}, nil
+}
+
+// VerifyConfigBundle checks the signature of a bundle and decodes it
+func VerifyConfigBundle(signed *SignedConfigBundle) (*ConfigBundle, error) {
+	key, err := bundleKey()
+	if err != nil {
+		return nil, err
+	}
+	if signed.Algorithm != configBundleAlgorithm {
+		return nil, fmt.Errorf("unsupported bundle algorithm: %q", signed.Algorithm)
+	}
+
+	expected, err := signBundle(key, signed.Bundle)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %v", err)
+	}
+	if !hmac.Equal([]byte(expected), []byte(signed.Signature)) {
+		return nil, ErrBundleSignature
+	}
+
+	var bundle ConfigBundle
+	if err := json.Unmarshal(signed.Bundle, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %v", err)
+	}
+	if bundle.FormatVersion != ConfigBundleFormatVersion {
+		return nil, fmt.Errorf("unsupported bundle format version %d", bundle.FormatVersion)
+	}
+	return &bundle, nil
+}
+
+// upsertConfig stores item, updating the first row matching where/args
+// instead of creating one. id points to the item's ID field.
+func upsertConfig(tx *gorm.DB, item interface{}, id *uint, count *ConfigImportCount, where string, args ...interface{}) error {
+	var ids []uint
+	if err := tx.Model(item).Where(where, args...).Order("id ASC").Limit(1).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		*id = ids[0]
+		count.Updated++
+		return tx.Save(item).Error
+	}
+
+	*id = 0
+	count.Created++
+	return tx.Create(item).Error
+}
+
+// ImportConfig applies a verified bundle. Entries are matched to existing
+// configuration by name (code for RSUs and V2X threats, J2735 ID for
+// intersections) and updated, or created; configuration missing from the
+// bundle is kept. With dryRun the changes are rolled back.
+func ImportConfig(db *gorm.DB, bundle *ConfigBundle, dryRun bool) (*ConfigImportResult, error) {
+	result := &ConfigImportResult{DryRun: dryRun, ExportedAt: bundle.ExportedAt, Sections: make(map[string]*ConfigImportCount)}
+	section := func(name string) *ConfigImportCount {
+		count := &ConfigImportCount{}
+		result.Sections[name] = count
+		return count
+	}
+	errDryRun := errors.New("dry run")
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// log source IDs are referenced by severity mappings and rule scopes
+		sourceIDs := make(map[uint]uint)
+		count := section("log_sources")
+		for i := range bundle.LogSources {
+			source := &bundle.LogSources[i]
+			exportedID := source.ID
+			if err := upsertConfig(tx, source, &source.ID, count, "name = ?", source.Name); err != nil {
+				return fmt.Errorf("log source %s: %v", source.Name, err)
+			}
+			sourceIDs[exportedID] = source.ID
+		}
+
+		count = section("severity_mappings")
+		for i := range bundle.SeverityMappings {
+			mapping := &bundle.SeverityMappings[i]
+			sourceID, ok := sourceIDs[mapping.LogSourceID]
+			if !ok {
+				return fmt.Errorf("severity mapping %q references log source %d, which is not in the bundle", mapping.SourceValue, mapping.LogSourceID)
+			}
+			mapping.LogSourceID = sourceID
+			if err := upsertConfig(tx, mapping, &mapping.ID, count, "log_source_id = ? AND source_value = ?", mapping.LogSourceID, mapping.SourceValue); err != nil {
+				return fmt.Errorf("severity mapping %q: %v", mapping.SourceValue, err)
+			}
+		}
+
+		// rule conditions refer to geofences by name
+		count = section("geofences")
+		for i := range bundle.Geofences {
+			fence := &bundle.Geofences[i]
+			if err := NormalizeGeofence(fence); err != nil {
+				return fmt.Errorf("geofence %s: %v", fence.Name, err)
+			}
+			if err := upsertConfig(tx, fence, &fence.ID, count, "name = ?", fence.Name); err != nil {
+				return fmt.Errorf("geofence %s: %v", fence.Name, err)
+			}
+		}
+
+		// rules are tagged with threat codes
+		count = section("v2x_threats")
+		for i := range bundle.V2XThreats {
+			threat := &bundle.V2XThreats[i]
+			if err := upsertConfig(tx, threat, &threat.ID, count, "code = ?", threat.Code); err != nil {
+				return fmt.Errorf("V2X threat %s: %v", threat.Code, err)
+			}
+		}
+
+		// rule IDs are referenced by response actions
+		ruleIDs := make(map[uint]uint)
+		count = section("rules")
+		for i := range bundle.Rules {
+			rule := &bundle.Rules[i]
+			exportedID := rule.ID
+			for j, id := range rule.Scope.LogSourceIDs {
+				sourceID, ok := sourceIDs[id]
+				if !ok {
+					return fmt.Errorf("rule %s is scoped to log source %d, which is not in the bundle", rule.Name, id)
+				}
+				rule.Scope.LogSourceIDs[j] = sourceID
+			}
+			if err := upsertConfig(tx, rule, &rule.ID, count, "name = ?", rule.Name); err != nil {
+				return fmt.Errorf("rule %s: %v", rule.Name, err)
+			}
+			ruleIDs[exportedID] = rule.ID
+		}
+
+		count = section("response_actions")
+		runner := NewResponseRunner(tx)
+		for i := range bundle.ResponseActions {
+			action := &bundle.ResponseActions[i]
+			ruleID, ok := ruleIDs[action.RuleID]
+			if !ok {
+				return fmt.Errorf("response action %s belongs to rule %d, which is not in the bundle", action.Name, action.RuleID)
+			}
+			action.RuleID = ruleID
+			if err := runner.Validate(action); err != nil {
+				return fmt.Errorf("response action %s: %v", action.Name, err)
+			}
+			if err := upsertConfig(tx, action, &action.ID, count, "rule_id = ? AND name = ?", action.RuleID, action.Name); err != nil {
+				return fmt.Errorf("response action %s: %v", action.Name, err)
+			}
+		}
+
+		count = section("transform_rules")
+		for i := range bundle.TransformRules {
+			rule := &bundle.TransformRules[i]
+			if err := upsertConfig(tx, rule, &rule.ID, count, "name = ?", rule.Name); err != nil {
+				return fmt.Errorf("transform rule %s: %v", rule.Name, err)
+			}
+		}
+
+		count = section("vendor_patterns")
+		for i := range bundle.VendorPatterns {
+			pattern := &bundle.VendorPatterns[i]
+			if err := upsertConfig(tx, pattern, &pattern.ID, count, "name = ?", pattern.Name); err != nil {
+				return fmt.Errorf("vendor pattern %s: %v", pattern.Name, err)
+			}
+		}
+
+		count = section("collector_listeners")
+		for i := range bundle.CollectorListeners {
+			listener := &bundle.CollectorListeners[i]
+			if err := upsertConfig(tx, listener, &listener.ID, count, "name = ?", listener.Name); err != nil {
+				return fmt.Errorf("collector listener %s: %v", listener.Name, err)
+			}
+		}
+
+		count = section("mqtt_brokers")
+		for i := range bundle.MQTTBrokers {
+			broker := &bundle.MQTTBrokers[i]
+			if err := upsertConfig(tx, broker, &broker.ID, count, "name = ?", broker.Name); err != nil {
+				return fmt.Errorf("MQTT broker %s: %v", broker.Name, err)
+			}
+		}
+
+		count = section("event_sinks")
+		for i := range bundle.EventSinks {
+			sink := &bundle.EventSinks[i]
+			if err := upsertConfig(tx, sink, &sink.ID, count, "name = ?", sink.Name); err != nil {
+				return fmt.Errorf("event sink %s: %v", sink.Name, err)
+			}
+		}
+
+		count = section("fleet_operators")
+		for i := range bundle.FleetOperators {
+			operator := &bundle.FleetOperators[i]
+			if err := upsertConfig(tx, operator, &operator.ID, count, "name = ?", operator.Name); err != nil {
+				return fmt.Errorf("fleet operator %s: %v", operator.Name, err)
+			}
+		}
+
+		count = section("regulatory_templates")
+		for i := range bundle.RegulatoryTemplates {
+			template := &bundle.RegulatoryTemplates[i]
+			if err := NormalizeRegulatoryTemplate(template); err != nil {
+				return fmt.Errorf("regulatory template %s: %v", template.Name, err)
+			}
+			if err := upsertConfig(tx, template, &template.ID, count, "name = ?", template.Name); err != nil {
+				return fmt.Errorf("regulatory template %s: %v", template.Name, err)
+			}
+		}
+
+		count = section("routing_rules")
+		for i := range bundle.RoutingRules {
+			rule := &bundle.RoutingRules[i]
+			if err := upsertConfig(tx, rule, &rule.ID, count, "name = ?", rule.Name); err != nil {
+				return fmt.Errorf("routing rule %s: %v", rule.Name, err)
+			}
+		}
+
+		count = section("hunt_queries")
+		for i := range bundle.HuntQueries {
+			query := &bundle.HuntQueries[i]
+			if err := upsertConfig(tx, query, &query.ID, count, "name = ?", query.Name); err != nil {
+				return fmt.Errorf("hunt query %s: %v", query.Name, err)
+			}
+		}
+
+		count = section("source_mutes")
+		for i := range bundle.SourceMutes {
+			mute := &bundle.SourceMutes[i]
+			err := upsertConfig(tx, mute, &mute.ID, count,
+				"source_type = ? AND source_id = ? AND message_type = ? AND resolved_at IS NULL",
+				mute.SourceType, mute.SourceID, mute.MessageType)
+			if err != nil {
+				return fmt.Errorf("source mute %s %s: %v", mute.SourceType, mute.SourceID, err)
+			}
+		}
+
+		count = section("rsus")
+		for i := range bundle.RSUs {
+			rsu := &bundle.RSUs[i]
+			if err := upsertConfig(tx, rsu, &rsu.ID, count, "code = ?", rsu.Code); err != nil {
+				return fmt.Errorf("RSU %s: %v", rsu.Code, err)
+			}
+		}
+
+		count = section("road_segments")
+		for i := range bundle.RoadSegments {
+			segment := &bundle.RoadSegments[i]
+			if err := upsertConfig(tx, segment, &segment.ID, count, "segment_id = ?", segment.SegmentID); err != nil {
+				return fmt.Errorf("road segment %s: %v", segment.SegmentID, err)
+			}
+		}
+
+		// SPaT and MAP messages name intersections by their J2735 ID
+		count = section("intersections")
+		for i := range bundle.Intersections {
+			intersection := &bundle.Intersections[i]
+			if err := NormalizeSyntheticIntersection(intersection); err != nil {
+				return fmt.Errorf("intersection %d: %v", intersection.IntersectionID, err)
+			}
+			if err := upsertConfig(tx, intersection, &intersection.ID, count, "intersection_id = ?", intersection.IntersectionID); err != nil {
+				return fmt.Errorf("intersection %d: %v", intersection.IntersectionID, err)
+			}
+		}
+
+		count = section("dashboard_layouts")
+		for i := range bundle.DashboardLayouts {
+			layout := &bundle.DashboardLayouts[i]
+			if layout.UserID != nil {
+				continue
+			}
+			if layout.IsDefault {
+				err := tx.Model(&models.DashboardLayout{}).
+					Where("user_id IS NULL AND role = ? AND name <> ?", layout.Role, layout.Name).
+					Update("is_default", false).Error
+				if err != nil {
+					return err
+				}
+			}
+			if err := upsertConfig(tx, layout, &layout.ID, count, "user_id IS NULL AND role = ? AND name = ?", layout.Role, layout.Name); err != nil {
+				return fmt.Errorf("dashboard layout %s: %v", layout.Name, err)
+			}
+		}
+
+		count = section("trend_rules")
+		for i := range bundle.TrendRules {
+			rule := &bundle.TrendRules[i]
+			if err := upsertConfig(tx, rule, &rule.ID, count, "name = ?", rule.Name); err != nil {
+				return fmt.Errorf("trend rule %s: %v", rule.Name, err)
+			}
+		}
+
+		count = section("anomaly_detectors")
+		for i := range bundle.AnomalyDetectors {
+			config := &bundle.AnomalyDetectors[i]
+			if err := ValidateAnomalyDetectorConfig(config); err != nil {
+				return fmt.Errorf("anomaly detector %s: %v", config.Detector, err)
+			}
+			if err := upsertConfig(tx, config, &config.ID, count, "detector = ?", config.Detector); err != nil {
+				return fmt.Errorf("anomaly detector %s: %v", config.Detector, err)
+			}
+		}
+
+		// the last run of a policy is the importing instance's own
+		count = section("retention_policies")
+		for i := range bundle.RetentionPolicies {
+			policy := &bundle.RetentionPolicies[i]
+			if err := NormalizeRetentionPolicy(policy); err != nil {
+				return fmt.Errorf("retention policy %s: %v", policy.Name, err)
+			}
+			withoutRun := tx.Omit("last_run_at", "last_purged", "last_error").Session(&gorm.Session{})
+			if err := upsertConfig(withoutRun, policy, &policy.ID, count, "name = ?", policy.Name); err != nil {
+				return fmt.Errorf("retention policy %s: %v", policy.Name, err)
+			}
+		}
+
+		// reports name their notification channels, which keep their names across instances
+		count = section("report_templates")
+		for i := range bundle.ReportTemplates {
+			template := &bundle.ReportTemplates[i]
+			if err := NormalizeReportTemplate(template); err != nil {
+				return fmt.Errorf("report template %s: %v", template.Name, err)
+			}
+			if err := upsertConfig(tx, template, &template.ID, count, "name = ?", template.Name); err != nil {
+				return fmt.Errorf("report template %s: %v", template.Name, err)
+			}
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return nil, err
+	}
+
+	if !dryRun {
+		InvalidateRuleIndex()
+		InvalidateLogSources()
+		InvalidateSeverityMappings()
+		InvalidateMutes()
+		InvalidateVendorPatterns()
+		InvalidateTransformRules()
+		InvalidateAnomalyConfigs()
+		InvalidateGeofences()
+		InvalidateResponseActions()
+	}
+	return result, nil
+}
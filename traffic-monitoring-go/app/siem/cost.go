@@ -0,0 +1,260 @@
+package siem
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+)
+
+// costSampleRate is the fraction of events whose pipeline cost is measured,
+// configured with COST_SAMPLE_RATE (0-1)
+var costSampleRate = config.NewFloat("COST_SAMPLE_RATE", 0.1, "Fraction of events whose pipeline cost is measured",
+	config.Min(0), config.Max(1), config.Reloadable)
+
+type costContextKey struct{}
+
+// CostSample measures one event's time through the pipeline.
+// A nil *CostSample is valid and records nothing, so callers need not check sampling.
+type CostSample struct {
+	start  time.Time
+	mark   time.Time
+	stages map[string]time.Duration
+	dbTime int64 // nanoseconds, updated by the GORM callbacks
+}
+
+// StartCostSample begins measuring an event, or returns nil when the event is not sampled
+func StartCostSample() *CostSample {
+	if rate := costSampleRate.Get(); rate <= 0 || rand.Float64() >= rate {
+		return nil
+	}
+	now := time.Now()
+	return &CostSample{start: now, mark: now, stages: make(map[string]time.Duration)}
+}
+
+// DB returns db scoped so its queries are charged to this sample
+func (s *CostSample) DB(db *gorm.DB) *gorm.DB {
+	if s == nil {
+		return db
+	}
+	return db.WithContext(WithCostSample(db.Statement.Context, s))
+}
+
+// WithCostSample returns ctx carrying the sample, so queries run with ctx and
+// the stages of the ingester are charged to it
+func WithCostSample(ctx context.Context, s *CostSample) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, costContextKey{}, s)
+}
+
+// costSampleFrom returns the sample carried by ctx, or nil
+func costSampleFrom(ctx context.Context) *CostSample {
+	s, _ := ctx.Value(costContextKey{}).(*CostSample)
+	return s
+}
+
+// Stage records the time since the previous stage under name
+func (s *CostSample) Stage(name string) {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	s.stages[name] += now.Sub(s.mark)
+	s.mark = now
+}
+
+// CostEntry is the accumulated cost of one category and message type
+type CostEntry struct {
+	Category    string `json:"category"`
+	MessageType string `json:"message_type"`
+	Events      uint64 `json:"events"`
+	Samples     uint64 `json:"samples"`
+
+	wallTime time.Duration
+	dbTime   time.Duration
+	stages   map[string]time.Duration
+}
+
+// CostReport is a CostEntry with per-event averages and extrapolated totals
+type CostReport struct {
+	Category          string             `json:"category"`
+	MessageType       string             `json:"message_type"`
+	Events            uint64             `json:"events"`
+	Samples           uint64             `json:"samples"`
+	AvgWallMs         float64            `json:"avg_wall_ms"`
+	AvgDBMs           float64            `json:"avg_db_ms"`
+	AvgNonDBMs        float64            `json:"avg_non_db_ms"` // wall time not spent waiting on the database, not CPU time
+	AvgStageMs        map[string]float64 `json:"avg_stage_ms"`
+	EstimatedTotalSec float64            `json:"estimated_total_sec"`
+	SharePercent      float64            `json:"share_percent"`
+}
+
+// CostTracker accumulates sampled pipeline costs per category and message type
+type CostTracker struct {
+	mutex   sync.Mutex
+	entries map[string]*CostEntry
+	since   time.Time
+}
+
+var costTracker = &CostTracker{entries: make(map[string]*CostEntry), since: time.Now()}
+
+// RecordEventCost counts an event and, when it was sampled, adds its measured cost
+func RecordEventCost(sample *CostSample, event *models.SecurityEvent) {
+	if event == nil {
+		return
+	}
+
+	messageType := eventMessageType(event)
+	if messageType == "" {
+		messageType = "unknown"
+	}
+	key := string(event.Category) + "|" + messageType
+
+	costTracker.mutex.Lock()
+	defer costTracker.mutex.Unlock()
+
+	entry, ok := costTracker.entries[key]
+	if !ok {
+		entry = &CostEntry{
+			Category:    string(event.Category),
+			MessageType: messageType,
+			stages:      make(map[string]time.Duration),
+		}
+		costTracker.entries[key] = entry
+	}
+
+	entry.Events++
+	if sample == nil {
+		return
+	}
+
+	entry.Samples++
+	entry.wallTime += time.Since(sample.start)
+	entry.dbTime += time.Duration(atomic.LoadInt64(&sample.dbTime))
+	for stage, duration := range sample.stages {
+		entry.stages[stage] += duration
+	}
+}
+
+// GetCostBreakdown returns the cost per category and message type, most expensive first
+func GetCostBreakdown() ([]CostReport, time.Time, float64) {
+	costTracker.mutex.Lock()
+	defer costTracker.mutex.Unlock()
+
+	reports := make([]CostReport, 0, len(costTracker.entries))
+	var total float64
+	for _, entry := range costTracker.entries {
+		report := CostReport{
+			Category:    entry.Category,
+			MessageType: entry.MessageType,
+			Events:      entry.Events,
+			Samples:     entry.Samples,
+			AvgStageMs:  make(map[string]float64),
+		}
+
+		if entry.Samples > 0 {
+			samples := float64(entry.Samples)
+			report.AvgWallMs = durationMs(entry.wallTime) / samples
+			report.AvgDBMs = durationMs(entry.dbTime) / samples
+			report.AvgNonDBMs = report.AvgWallMs - report.AvgDBMs
+			if report.AvgNonDBMs < 0 {
+				report.AvgNonDBMs = 0
+			}
+			for stage, duration := range entry.stages {
+				report.AvgStageMs[stage] = durationMs(duration) / samples
+			}
+			report.EstimatedTotalSec = report.AvgWallMs * float64(entry.Events) / 1000
+		}
+
+		total += report.EstimatedTotalSec
+		reports = append(reports, report)
+	}
+
+	for i := range reports {
+		if total > 0 {
+			reports[i].SharePercent = reports[i].EstimatedTotalSec / total * 100
+		}
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].EstimatedTotalSec > reports[j].EstimatedTotalSec
+	})
+
+	return reports, costTracker.since, costSampleRate.Get()
+}
+
+// ResetCostBreakdown clears the accumulated costs
+func ResetCostBreakdown() {
+	costTracker.mutex.Lock()
+	defer costTracker.mutex.Unlock()
+
+	costTracker.entries = make(map[string]*CostEntry)
+	costTracker.since = time.Now()
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// RegisterCostCallbacks installs GORM callbacks that charge query time to the
+// cost sample carried in the statement context
+func RegisterCostCallbacks(db *gorm.DB) error {
+	before := func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Context.Value(costContextKey{}).(*CostSample); ok {
+			tx.InstanceSet("cost:start", time.Now())
+		}
+	}
+	after := func(tx *gorm.DB) {
+		sample, ok := tx.Statement.Context.Value(costContextKey{}).(*CostSample)
+		if !ok {
+			return
+		}
+		if start, ok := tx.InstanceGet("cost:start"); ok {
+			atomic.AddInt64(&sample.dbTime, int64(time.Since(start.(time.Time))))
+		}
+	}
+
+	callback := db.Callback()
+	if err := callback.Create().Before("gorm:create").Register("cost:before_create", before); err != nil {
+		return err
+	}
+	if err := callback.Create().After("gorm:create").Register("cost:after_create", after); err != nil {
+		return err
+	}
+	if err := callback.Query().Before("gorm:query").Register("cost:before_query", before); err != nil {
+		return err
+	}
+	if err := callback.Query().After("gorm:query").Register("cost:after_query", after); err != nil {
+		return err
+	}
+	if err := callback.Update().Before("gorm:update").Register("cost:before_update", before); err != nil {
+		return err
+	}
+	if err := callback.Update().After("gorm:update").Register("cost:after_update", after); err != nil {
+		return err
+	}
+	if err := callback.Delete().Before("gorm:delete").Register("cost:before_delete", before); err != nil {
+		return err
+	}
+	if err := callback.Delete().After("gorm:delete").Register("cost:after_delete", after); err != nil {
+		return err
+	}
+	if err := callback.Row().Before("gorm:row").Register("cost:before_row", before); err != nil {
+		return err
+	}
+	if err := callback.Row().After("gorm:row").Register("cost:after_row", after); err != nil {
+		return err
+	}
+	if err := callback.Raw().Before("gorm:raw").Register("cost:before_raw", before); err != nil {
+		return err
+	}
+	return callback.Raw().After("gorm:raw").Register("cost:after_raw", after)
+}
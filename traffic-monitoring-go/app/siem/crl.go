@@ -0,0 +1,424 @@
+package siem
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// AnomalyRevokedCertificate is the anomaly type of V2X messages signed by a revoked certificate
+const AnomalyRevokedCertificate = "revoked_certificate"
+
+// maxCRLSize bounds a downloaded or uploaded CRL
+const maxCRLSize = 64 << 20
+
+// certificateFields are the event details that may carry the signer's certificate ID
+var certificateFields = []string{"certificate_id", "signer_id", "cert_id"}
+
+// NormalizeCertificateID returns a certificate hashed ID as lowercase hex, accepting
+// "0x" prefixes and ":" or space separators. HashedId8, HashedId10 and full
+// SHA-256 digests are accepted.
+func NormalizeCertificateID(value string) (string, bool) {
+	id := strings.ToLower(strings.TrimSpace(value))
+	id = strings.TrimPrefix(id, "0x")
+	id = strings.NewReplacer(":", "", " ", "").Replace(id)
+	switch len(id) {
+	case 16, 20, 64:
+	default:
+		return "", false
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+// CRLDocument is a parsed CRL
+type CRLDocument struct {
+	Issuer     string
+	IssuedAt   *time.Time
+	NextUpdate *time.Time
+	Entries    []models.RevokedCertificate
+}
+
+// ParseCRL reads a CRL as JSON ({"issuer", "issued_at", "next_update",
+// "entries": [{"certificate_id", "revoked_at", "reason"}]}), as a JSON array of
+// certificate IDs, or as text with one certificate ID per line and # comments.
+// Duplicate entries are dropped.
+func ParseCRL(data []byte) (*CRLDocument, error) {
+	doc := &CRLDocument{}
+	seen := make(map[string]bool)
+	add := func(value string, revokedAt *time.Time, reason string) error {
+		id, ok := NormalizeCertificateID(value)
+		if !ok {
+			return fmt.Errorf("invalid certificate ID %q", value)
+		}
+		if !seen[id] {
+			seen[id] = true
+			doc.Entries = append(doc.Entries, models.RevokedCertificate{CertificateID: id, RevokedAt: revokedAt, Reason: reason})
+		}
+		return nil
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var parsed struct {
+			Issuer     string     `json:"issuer"`
+			IssuedAt   *time.Time `json:"issued_at"`
+			NextUpdate *time.Time `json:"next_update"`
+			Entries    []struct {
+				CertificateID string     `json:"certificate_id"`
+				RevokedAt     *time.Time `json:"revoked_at"`
+				Reason        string     `json:"reason"`
+			} `json:"entries"`
+		}
+		if err := json.Unmarshal(trimmed, &parsed); err != nil {
+			return nil, fmt.Errorf("invalid CRL JSON: %v", err)
+		}
+		doc.Issuer, doc.IssuedAt, doc.NextUpdate = parsed.Issuer, parsed.IssuedAt, parsed.NextUpdate
+		for _, entry := range parsed.Entries {
+			if err := add(entry.CertificateID, entry.RevokedAt, entry.Reason); err != nil {
+				return nil, err
+			}
+		}
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var ids []string
+		if err := json.Unmarshal(trimmed, &ids); err != nil {
+			return nil, fmt.Errorf("invalid CRL JSON: %v", err)
+		}
+		for _, id := range ids {
+			if err := add(id, nil, ""); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			if err := add(text, nil, ""); err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// StoreCRL replaces the entries of a CRL with those of a parsed document
+func StoreCRL(db *gorm.DB, crl *models.CertificateRevocationList, doc *CRLDocument) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("crl_id = ?", crl.ID).Delete(&models.RevokedCertificate{}).Error; err != nil {
+			return err
+		}
+		for i := range doc.Entries {
+			doc.Entries[i].ID = 0
+			doc.Entries[i].CRLID = crl.ID
+		}
+		if len(doc.Entries) > 0 {
+			if err := tx.CreateInBatches(doc.Entries, 1000).Error; err != nil {
+				return err
+			}
+		}
+
+		now := clock.Now()
+		if doc.Issuer != "" {
+			crl.Issuer = doc.Issuer
+		}
+		crl.IssuedAt = doc.IssuedAt
+		crl.NextUpdate = doc.NextUpdate
+		crl.Entries = len(doc.Entries)
+		crl.FetchedAt = &now
+		crl.LastError = ""
+		return tx.Save(crl).Error
+	})
+	if err != nil {
+		return err
+	}
+	InvalidateRevocations()
+	return nil
+}
+
+// revocation is a revoked certificate as seen by the ingest check
+type revocation struct {
+	CRL       string
+	RevokedAt *time.Time
+	Reason    string
+}
+
+// revocationCacheTTL bounds how long a CRL changed on another instance takes to apply here
+const revocationCacheTTL = 30 * time.Second
+
+// revocationCache keeps the certificates revoked by enabled CRLs in memory, so
+// checking a message costs no query
+type revocationCache struct {
+	mutex    sync.RWMutex
+	loaded   bool
+	loadedAt time.Time
+	revoked  map[string]revocation
+}
+
+var defaultRevocations = &revocationCache{}
+
+// InvalidateRevocations forces the revocation cache to reload. Call it whenever CRLs change.
+func InvalidateRevocations() {
+	cache.Invalidate("crl_revocations")
+}
+
+// invalidate drops the cached revocations of this instance
+func (c *revocationCache) invalidate() {
+	c.mutex.Lock()
+	c.loaded = false
+	c.mutex.Unlock()
+}
+
+func init() {
+	cache.OnInvalidate("crl_revocations", defaultRevocations.invalidate)
+}
+
+func (c *revocationCache) get(db *gorm.DB) (map[string]revocation, error) {
+	c.mutex.RLock()
+	if c.loaded && time.Since(c.loadedAt) <= revocationCacheTTL {
+		revoked := c.revoked
+		c.mutex.RUnlock()
+		return revoked, nil
+	}
+	c.mutex.RUnlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded || time.Since(c.loadedAt) > revocationCacheTTL {
+		var rows []struct {
+			CertificateID string
+			RevokedAt     *time.Time
+			Reason        string
+			CRL           string `gorm:"column:crl"`
+		}
+		err := db.Table("revoked_certificates").
+			Select("revoked_certificates.certificate_id, revoked_certificates.revoked_at, revoked_certificates.reason, certificate_revocation_lists.name AS crl").
+			Joins("JOIN certificate_revocation_lists ON certificate_revocation_lists.id = revoked_certificates.crl_id").
+			Where("certificate_revocation_lists.enabled = ?", true).
+			Order("revoked_certificates.id ASC").
+			Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		revoked := make(map[string]revocation, len(rows))
+		for _, row := range rows {
+			if _, ok := revoked[row.CertificateID]; !ok {
+				revoked[row.CertificateID] = revocation{CRL: row.CRL, RevokedAt: row.RevokedAt, Reason: row.Reason}
+			}
+		}
+		c.revoked = revoked
+		c.loaded = true
+		c.loadedAt = time.Now()
+	}
+	return c.revoked, nil
+}
+
+// RevokedSigner describes a V2X message signed by a revoked certificate
+type RevokedSigner struct {
+	CertificateID string
+	CRL           string
+	RevokedAt     *time.Time
+	Reason        string
+}
+
+// FindRevokedSigner returns the revocation of the certificate that signed a V2X
+// event, or nil when the event names no certificate or it was valid when the
+// message was sent
+func FindRevokedSigner(db *gorm.DB, event *models.SecurityEvent) (*RevokedSigner, error) {
+	if event.Category != models.CategoryV2X && event.Category != models.CategoryVehicle {
+		return nil, nil
+	}
+	revoked, err := defaultRevocations.get(db)
+	if err != nil || len(revoked) == 0 {
+		return nil, err
+	}
+
+	var raw struct {
+		Details map[string]interface{} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(event.RawData), &raw); err != nil || raw.Details == nil {
+		return nil, nil
+	}
+	for _, field := range certificateFields {
+		value, _ := raw.Details[field].(string)
+		id, ok := NormalizeCertificateID(value)
+		if !ok {
+			continue
+		}
+		entry, ok := revoked[id]
+		if !ok {
+			return nil, nil
+		}
+		if entry.RevokedAt != nil && event.Timestamp.Before(*entry.RevokedAt) {
+			return nil, nil
+		}
+		return &RevokedSigner{CertificateID: id, CRL: entry.CRL, RevokedAt: entry.RevokedAt, Reason: entry.Reason}, nil
+	}
+	return nil, nil
+}
+
+// RevokedSignerEvent builds the high-severity event raised for a V2X message
+// signed by a revoked certificate
+func RevokedSignerEvent(event *models.SecurityEvent, signer *RevokedSigner) ([]byte, error) {
+	vehicleID := event.DeviceID
+	details := map[string]interface{}{
+		"anomaly_type":   AnomalyRevokedCertificate,
+		"certificate_id": signer.CertificateID,
+		"crl":            signer.CRL,
+		"event_id":       event.ID,
+	}
+	if signer.RevokedAt != nil {
+		details["revoked_at"] = signer.RevokedAt
+	}
+	if signer.Reason != "" {
+		details["revocation_reason"] = signer.Reason
+	}
+
+	var raw struct {
+		Details map[string]interface{} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(event.RawData), &raw); err == nil {
+		for _, field := range []string{"vehicle_id", "rsu_id", "location", "radio", "message_type"} {
+			if value, ok := raw.Details[field]; ok {
+				details[field] = value
+			}
+		}
+		if id, ok := raw.Details["vehicle_id"].(string); ok && id != "" {
+			vehicleID = id
+		}
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"source_name": "v2x-pki",
+		"source_type": string(models.SourceTypeApplication),
+		"timestamp":   event.Timestamp,
+		"severity":    string(models.SeverityHigh),
+		"category":    string(models.CategoryV2X),
+		"message":     fmt.Sprintf("V2X message from %s signed by revoked certificate %s (CRL %s)", vehicleID, signer.CertificateID, signer.CRL),
+		"details":     details,
+	})
+}
+
+// CRLFetcher downloads the CRLs that have a source URL
+type CRLFetcher struct {
+	DB     *gorm.DB
+	Client *http.Client
+}
+
+// NewCRLFetcher creates a new CRLFetcher
+func NewCRLFetcher(db *gorm.DB) *CRLFetcher {
+	return &CRLFetcher{DB: db, Client: &http.Client{Timeout: 60 * time.Second}}
+}
+
+// Fetch downloads a CRL and replaces its entries, recording the error on failure
+func (f *CRLFetcher) Fetch(crl *models.CertificateRevocationList) error {
+	if crl.SourceURL == "" {
+		return errors.New("CRL has no source URL")
+	}
+
+	doc, err := f.download(crl.SourceURL)
+	if err == nil {
+		err = StoreCRL(f.DB, crl, doc)
+	}
+	if err != nil {
+		crl.LastError = err.Error()
+		if updateErr := f.DB.Model(crl).Update("last_error", crl.LastError).Error; updateErr != nil {
+			log.Printf("Error recording CRL %s failure: %v", crl.Name, updateErr)
+		}
+		return err
+	}
+	log.Printf("Fetched CRL %s: %d revoked certificates", crl.Name, crl.Entries)
+	return nil
+}
+
+func (f *CRLFetcher) download(url string) (*CRLDocument, error) {
+	resp, err := f.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCRLSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxCRLSize {
+		return nil, fmt.Errorf("CRL exceeds %d bytes", maxCRLSize)
+	}
+	return ParseCRL(data)
+}
+
+// RefreshDue fetches every enabled CRL with a source URL whose next update has
+// passed, or that was last fetched more than maxAge ago
+func (f *CRLFetcher) RefreshDue(maxAge time.Duration) (int, error) {
+	var crls []models.CertificateRevocationList
+	if err := f.DB.Where("enabled = ? AND source_url <> ''", true).Find(&crls).Error; err != nil {
+		return 0, err
+	}
+
+	now := clock.Now()
+	fetched := 0
+	for i := range crls {
+		crl := &crls[i]
+		due := crl.FetchedAt == nil || now.Sub(*crl.FetchedAt) >= maxAge ||
+			(crl.NextUpdate != nil && !now.Before(*crl.NextUpdate))
+		if !due {
+			continue
+		}
+		if err := f.Fetch(crl); err != nil {
+			log.Printf("Error fetching CRL %s: %v", crl.Name, err)
+			continue
+		}
+		fetched++
+	}
+	return fetched, nil
+}
+
+var crlRefreshMinutes = config.NewInt("CRL_REFRESH_MINUTES", 60, "Minutes between downloads of the V2X PKI CRLs", config.Min(1))
+
+// Start refreshes downloaded CRLs every CRL_REFRESH_MINUTES (default 60)
+func (f *CRLFetcher) Start() {
+	interval := time.Duration(crlRefreshMinutes.Get()) * time.Minute
+
+	go func() {
+		if _, err := f.RefreshDue(interval); err != nil {
+			log.Printf("Error refreshing CRLs: %v", err)
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := f.RefreshDue(interval); err != nil {
+				log.Printf("Error refreshing CRLs: %v", err)
+			}
+		}
+	}()
+
+	log.Printf("CRL refresh started every %s", interval)
+}
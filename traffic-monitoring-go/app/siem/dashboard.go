@@ -4,17 +4,24 @@ package siem
 import (
     "time"
     "gorm.io/gorm"
+    "traffic-monitoring-go/app/database"
     "traffic-monitoring-go/app/models"
+    "traffic-monitoring-go/app/siem/clock"
 )
 
 // DashboardService provides data for SIEM dashboards
 type DashboardService struct {
-    DB *gorm.DB
+    DB    *gorm.DB
+    Clock clock.Clock
+
+    // SummaryTTL is how long GetSummary serves a summary without checking for new data
+    SummaryTTL time.Duration
+    summaries  summaryCache
 }
 
 // NewDashboardService creates a new DashboardService
 func NewDashboardService(db *gorm.DB) *DashboardService {
-    return &DashboardService{DB: db}
+    return &DashboardService{DB: db, Clock: clock.Default(), SummaryTTL: dashboardSummaryTTL()}
 }
 
 // EventCountSummary contains event count totals by severity
@@ -34,6 +41,7 @@ type AlertSummary struct {
     InProgress   int64 `json:"in_progress"`
     Closed       int64 `json:"closed"`
     FalsePositive int64 `json:"false_positive"`
+    ConfirmedMalicious int64 `json:"confirmed_malicious"`
     
     Critical     int64 `json:"critical"`
     High         int64 `json:"high"`
@@ -48,100 +56,90 @@ type TimeSeriesData struct {
 }
 
 // GetEventSummary returns summary counts of security events
-func (s *DashboardService) GetEventSummary(timeRange string) (*EventCountSummary, error) {
+func (s *DashboardService) GetEventSummary(window TimeWindow) (*EventCountSummary, error) {
     var summary EventCountSummary
     
     // Build query based on time range
-    query := s.DB.Model(&models.SecurityEvent{})
-    timeFilter := getTimeFilter(timeRange)
-    if timeFilter != "" {
-        query = query.Where(timeFilter)
-    }
-    
-    // Get total count
-    if err := query.Count(&summary.Total).Error; err != nil {
-        return nil, err
-    }
-    
-    // Get counts by severity
-    if err := query.Where("severity = ?", models.SeverityCritical).Count(&summary.Critical).Error; err != nil {
-        return nil, err
-    }
-    
-    if err := query.Where("severity = ?", models.SeverityHigh).Count(&summary.High).Error; err != nil {
-        return nil, err
-    }
+    query := window.Apply(database.ReadDB(s.DB).Model(&models.SecurityEvent{}), "timestamp")
     
-    if err := query.Where("severity = ?", models.SeverityMedium).Count(&summary.Medium).Error; err != nil {
-        return nil, err
+    // Count all severities in one pass
+    var rows []struct {
+        Severity models.EventSeverity
+        Count    int64
     }
-    
-    if err := query.Where("severity = ?", models.SeverityLow).Count(&summary.Low).Error; err != nil {
+    if err := query.Select("severity, count(*) as count").Group("severity").Scan(&rows).Error; err != nil {
         return nil, err
     }
     
-    if err := query.Where("severity = ?", models.SeverityInfo).Count(&summary.Info).Error; err != nil {
-        return nil, err
+    for _, row := range rows {
+        summary.Total += row.Count
+        switch row.Severity {
+        case models.SeverityCritical:
+            summary.Critical = row.Count
+        case models.SeverityHigh:
+            summary.High = row.Count
+        case models.SeverityMedium:
+            summary.Medium = row.Count
+        case models.SeverityLow:
+            summary.Low = row.Count
+        case models.SeverityInfo:
+            summary.Info = row.Count
+        }
     }
     
     return &summary, nil
 }
 
 // GetAlertSummary returns summary counts of alerts
-func (s *DashboardService) GetAlertSummary(timeRange string) (*AlertSummary, error) {
+func (s *DashboardService) GetAlertSummary(window TimeWindow) (*AlertSummary, error) {
     var summary AlertSummary
     
     // Build query based on time range
-    query := s.DB.Model(&models.Alert{})
-    timeFilter := getTimeFilter(timeRange)
-    if timeFilter != "" {
-        query = query.Where(timeFilter)
-    }
-    
-    // Get total count
-    if err := query.Count(&summary.Total).Error; err != nil {
-        return nil, err
-    }
-    
-    // Get counts by status
-    if err := query.Where("status = ?", models.AlertStatusOpen).Count(&summary.Open).Error; err != nil {
-        return nil, err
-    }
-    
-    if err := query.Where("status = ?", models.AlertStatusInProgress).Count(&summary.InProgress).Error; err != nil {
-        return nil, err
-    }
-    
-    if err := query.Where("status = ?", models.AlertStatusClosed).Count(&summary.Closed).Error; err != nil {
-        return nil, err
-    }
-    
-    if err := query.Where("status = ?", models.AlertStatusFalsePositive).Count(&summary.FalsePositive).Error; err != nil {
-        return nil, err
-    }
-    
-    // Get counts by severity
-    if err := query.Where("severity = ?", models.SeverityCritical).Count(&summary.Critical).Error; err != nil {
-        return nil, err
-    }
+    query := window.Apply(database.ReadDB(s.DB).Model(&models.Alert{}), "timestamp")
     
-    if err := query.Where("severity = ?", models.SeverityHigh).Count(&summary.High).Error; err != nil {
-        return nil, err
+    // Count every status and severity combination in one pass
+    var rows []struct {
+        Status   models.AlertStatus
+        Severity models.EventSeverity
+        Count    int64
     }
-    
-    if err := query.Where("severity = ?", models.SeverityMedium).Count(&summary.Medium).Error; err != nil {
+    if err := query.Select("status, severity, count(*) as count").Group("status, severity").Scan(&rows).Error; err != nil {
         return nil, err
     }
     
-    if err := query.Where("severity = ?", models.SeverityLow).Count(&summary.Low).Error; err != nil {
-        return nil, err
+    for _, row := range rows {
+        summary.Total += row.Count
+        
+        switch row.Status {
+        case models.AlertStatusOpen:
+            summary.Open += row.Count
+        case models.AlertStatusInProgress:
+            summary.InProgress += row.Count
+        case models.AlertStatusClosed:
+            summary.Closed += row.Count
+        case models.AlertStatusFalsePositive:
+            summary.FalsePositive += row.Count
+        case models.AlertStatusConfirmedMalicious:
+            summary.ConfirmedMalicious += row.Count
+        }
+        
+        switch row.Severity {
+        case models.SeverityCritical:
+            summary.Critical += row.Count
+        case models.SeverityHigh:
+            summary.High += row.Count
+        case models.SeverityMedium:
+            summary.Medium += row.Count
+        case models.SeverityLow:
+            summary.Low += row.Count
+        }
     }
     
     return &summary, nil
 }
 
 // GetEventTimeSeries returns time series data for security events
-func (s *DashboardService) GetEventTimeSeries(timeRange string, groupBy string) (*TimeSeriesData, error) {
+func (s *DashboardService) GetEventTimeSeries(window TimeWindow, groupBy string) (*TimeSeriesData, error) {
     // Set default grouping if not specified
     if groupBy == "" {
         groupBy = "day"
@@ -153,11 +151,7 @@ func (s *DashboardService) GetEventTimeSeries(timeRange string, groupBy string)
     }
     
     // Build query based on time range
-    query := s.DB.Model(&models.SecurityEvent{})
-    timeFilter := getTimeFilter(timeRange)
-    if timeFilter != "" {
-        query = query.Where(timeFilter)
-    }
+    query := window.Apply(database.ReadDB(s.DB).Model(&models.SecurityEvent{}), "timestamp")
     
     // Format time grouping based on group by parameter
     var timeFormat string
@@ -197,7 +191,7 @@ func (s *DashboardService) GetEventTimeSeries(timeRange string, groupBy string)
 }
 
 // GetTopSourceIPs returns the most common source IPs for security events
-func (s *DashboardService) GetTopSourceIPs(timeRange string, limit int) ([]map[string]interface{}, error) {
+func (s *DashboardService) GetTopSourceIPs(window TimeWindow, limit int) ([]map[string]interface{}, error) {
     if limit <= 0 {
         limit = 10 // Default limit
     }
@@ -208,11 +202,7 @@ func (s *DashboardService) GetTopSourceIPs(timeRange string, limit int) ([]map[s
     }
     
     // Build query based on time range
-    query := s.DB.Model(&models.SecurityEvent{})
-    timeFilter := getTimeFilter(timeRange)
-    if timeFilter != "" {
-        query = query.Where(timeFilter)
-    }
+    query := window.Apply(database.ReadDB(s.DB).Model(&models.SecurityEvent{}), "timestamp")
     
     // Execute the query
     if err := query.Select("source_ip, count(*) as count").
@@ -237,7 +227,7 @@ func (s *DashboardService) GetTopSourceIPs(timeRange string, limit int) ([]map[s
 }
 
 // GetTopTriggeredRules returns the most frequently triggered rules
-func (s *DashboardService) GetTopTriggeredRules(timeRange string, limit int) ([]map[string]interface{}, error) {
+func (s *DashboardService) GetTopTriggeredRules(window TimeWindow, limit int) ([]map[string]interface{}, error) {
     if limit <= 0 {
         limit = 10 // Default limit
     }
@@ -249,13 +239,8 @@ func (s *DashboardService) GetTopTriggeredRules(timeRange string, limit int) ([]
     }
     
     // Build query based on time range
-    query := s.DB.Model(&models.Alert{}).
-        Joins("JOIN rules ON alerts.rule_id = rules.id")
-    
-    timeFilter := getTimeFilter(timeRange)
-    if timeFilter != "" {
-        query = query.Where(timeFilter)
-    }
+    query := window.Apply(database.ReadDB(s.DB).Model(&models.Alert{}).
+        Joins("JOIN rules ON alerts.rule_id = rules.id"), "alerts.timestamp")
     
     // Execute the query
     if err := query.Select("alerts.rule_id, rules.name as rule_name, count(*) as count").
@@ -279,30 +264,58 @@ func (s *DashboardService) GetTopTriggeredRules(timeRange string, limit int) ([]
     return data, nil
 }
 
-// Helper function to convert time range to SQL filter
-func getTimeFilter(timeRange string) string {
-    now := time.Now()
-    
+// DashboardTimeRanges are the time ranges accepted by the dashboard endpoints
+var DashboardTimeRanges = []string{"today", "yesterday", "last_7_days", "last_30_days", "this_month", "last_month", "this_year"}
+
+// CustomTimeRange labels windows given by their bounds rather than one of the DashboardTimeRanges
+const CustomTimeRange = "custom"
+
+// TimeWindow is the time range a dashboard query covers, from From included
+// to To excluded; a zero From or To leaves that end open
+type TimeWindow struct {
+    From time.Time
+    To   time.Time
+}
+
+// Apply narrows query to the rows whose column falls in the window. The
+// bounds are bound as parameters, so they keep their time zone.
+func (w TimeWindow) Apply(query *gorm.DB, column string) *gorm.DB {
+    if !w.From.IsZero() {
+        query = query.Where(column+" >= ?", w.From)
+    }
+    if !w.To.IsZero() {
+        query = query.Where(column+" < ?", w.To)
+    }
+    return query
+}
+
+// Equal reports whether two windows cover the same time range
+func (w TimeWindow) Equal(other TimeWindow) bool {
+    return w.From.Equal(other.From) && w.To.Equal(other.To)
+}
+
+// DashboardTimeWindow converts a time range to the window it covers relative
+// to now, with days starting at midnight in the zone of now. Unknown time
+// ranges leave the window open.
+func DashboardTimeWindow(timeRange string, now time.Time) TimeWindow {
+    today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
     switch timeRange {
     case "today":
-        return "date(timestamp) = curdate()"
+        return TimeWindow{From: today, To: today.AddDate(0, 0, 1)}
     case "yesterday":
-        yesterday := now.AddDate(0, 0, -1)
-        return "date(timestamp) = '" + yesterday.Format("2006-01-02") + "'"
+        return TimeWindow{From: today.AddDate(0, 0, -1), To: today}
     case "last_7_days":
-        startDate := now.AddDate(0, 0, -7)
-        return "timestamp >= '" + startDate.Format("2006-01-02") + "'"
+        return TimeWindow{From: today.AddDate(0, 0, -7)}
     case "last_30_days":
-        startDate := now.AddDate(0, 0, -30)
-        return "timestamp >= '" + startDate.Format("2006-01-02") + "'"
+        return TimeWindow{From: today.AddDate(0, 0, -30)}
     case "this_month":
-        return "year(timestamp) = year(curdate()) and month(timestamp) = month(curdate())"
+        return TimeWindow{From: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())}
     case "last_month":
-        lastMonth := now.AddDate(0, -1, 0)
-        return "year(timestamp) = year('" + lastMonth.Format("2006-01-02") + "') and month(timestamp) = month('" + lastMonth.Format("2006-01-02") + "')"
+        startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+        return TimeWindow{From: startOfMonth.AddDate(0, -1, 0), To: startOfMonth}
     case "this_year":
-        return "year(timestamp) = year(curdate())"
+        return TimeWindow{From: time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())}
     default:
-        return "" // No filter
+        return TimeWindow{} // No filter
     }
 }
@@ -0,0 +1,259 @@
+package siem
+
+import (
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+)
+
+const (
+	// dashboardSummaryTopN is how many sources and rules a summary ranks
+	dashboardSummaryTopN = 5
+
+	// maxDashboardSummaries bounds the cached summaries; custom windows each
+	// take one, and the cache starts over once it is full
+	maxDashboardSummaries = 64
+
+	// dashboardSummaryMaxAge bounds how long a summary is kept by revalidation
+	// alone, since deletions such as retention runs do not move the watermark
+	dashboardSummaryMaxAge = 5 * time.Minute
+)
+
+// DashboardSummary is every dashboard panel of a time range at once, computed
+// in a few grouped queries instead of one query per panel
+type DashboardSummary struct {
+	TimeRange        string                   `json:"time_range"`
+	From             *time.Time               `json:"from,omitempty"`
+	To               *time.Time               `json:"to,omitempty"`
+	GeneratedAt      time.Time                `json:"generated_at"`
+	EventSummary     EventCountSummary        `json:"event_summary"`
+	EventsByCategory map[string]int64         `json:"events_by_category"`
+	AlertSummary     AlertSummary             `json:"alert_summary"`
+	EventTimeSeries  TimeSeriesData           `json:"event_time_series"` // by hour for windows of up to two days, by day otherwise
+	TopSources       []map[string]interface{} `json:"top_sources"`
+	TopRules         []map[string]interface{} `json:"top_rules"`
+	V2X              V2XDashboardSummary      `json:"v2x"`
+}
+
+// V2XDashboardSummary counts the V2X messages of a time range and the
+// anomalies the detectors raised on them
+type V2XDashboardSummary struct {
+	Messages      int64            `json:"messages"`
+	ByMessageType map[string]int64 `json:"by_message_type"`
+	Anomalies     int64            `json:"anomalies"`
+	ByAnomalyType map[string]int64 `json:"by_anomaly_type"`
+}
+
+// dashboardWatermark changes whenever an event or alert is added or an alert is updated
+type dashboardWatermark struct {
+	EventID      uint
+	AlertID      uint
+	AlertUpdated *time.Time
+}
+
+func (w dashboardWatermark) equal(other dashboardWatermark) bool {
+	if w.EventID != other.EventID || w.AlertID != other.AlertID {
+		return false
+	}
+	if w.AlertUpdated == nil || other.AlertUpdated == nil {
+		return w.AlertUpdated == other.AlertUpdated
+	}
+	return w.AlertUpdated.Equal(*other.AlertUpdated)
+}
+
+// summaryEntry is a cached summary of a time range. Its mutex is held while
+// the summary is computed, so concurrent requests wait for one computation.
+type summaryEntry struct {
+	mutex     sync.Mutex
+	summary   *DashboardSummary
+	window    TimeWindow // it was computed for, which moves with the date for relative ranges
+	watermark dashboardWatermark
+	checkedAt time.Time
+}
+
+// summaryCache holds the cached summaries by time range, and custom windows by their bounds
+type summaryCache struct {
+	mutex   sync.Mutex
+	entries map[string]*summaryEntry
+}
+
+func (c *summaryCache) entry(timeRange string, window TimeWindow) *summaryEntry {
+	key := timeRange
+	if timeRange == CustomTimeRange {
+		key += "|" + window.From.UTC().Format(time.RFC3339Nano) + "|" + window.To.UTC().Format(time.RFC3339Nano)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.entries == nil || len(c.entries) >= maxDashboardSummaries {
+		c.entries = make(map[string]*summaryEntry)
+	}
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &summaryEntry{}
+		c.entries[key] = entry
+	}
+	return entry
+}
+
+var dashboardSummaryTTLSeconds = config.NewInt("DASHBOARD_SUMMARY_TTL_SECONDS", 15,
+	"Seconds a dashboard summary is served without checking for new data; 0 checks on every request", config.Min(0), config.Reloadable)
+
+// dashboardSummaryTTL is how long a summary is served without checking for
+// new data, from DASHBOARD_SUMMARY_TTL_SECONDS (default 15, 0 to check on every request)
+func dashboardSummaryTTL() time.Duration {
+	return time.Duration(dashboardSummaryTTLSeconds.Get()) * time.Second
+}
+
+// GetSummary returns the summary of a window, labelled with the time range it
+// was derived from or CustomTimeRange. A summary younger than the TTL is
+// served as is, unless refresh is set; an older one is served again when no
+// event or alert was added or changed since it was computed (up to five
+// minutes), and recomputed otherwise.
+func (s *DashboardService) GetSummary(timeRange string, window TimeWindow, refresh bool) (*DashboardSummary, error) {
+	entry := s.summaries.entry(timeRange, window)
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	now := s.Clock.Now()
+	if entry.summary != nil && entry.window.Equal(window) && !refresh && now.Sub(entry.checkedAt) < s.SummaryTTL {
+		return entry.summary, nil
+	}
+
+	watermark, err := s.watermark()
+	if err != nil {
+		return nil, err
+	}
+	if entry.summary != nil && entry.window.Equal(window) && entry.watermark.equal(watermark) &&
+		now.Sub(entry.summary.GeneratedAt) < dashboardSummaryMaxAge {
+		entry.checkedAt = now
+		return entry.summary, nil
+	}
+
+	summary, err := s.computeSummary(timeRange, window, now)
+	if err != nil {
+		return nil, err
+	}
+	entry.summary, entry.window, entry.watermark, entry.checkedAt = summary, window, watermark, now
+	return summary, nil
+}
+
+// watermark reads the latest event and alert in one query
+func (s *DashboardService) watermark() (dashboardWatermark, error) {
+	var watermark dashboardWatermark
+	err := database.ReadDB(s.DB).Raw(`SELECT
+		(SELECT COALESCE(MAX(id), 0) FROM security_events) AS event_id,
+		(SELECT COALESCE(MAX(id), 0) FROM alerts) AS alert_id,
+		(SELECT MAX(updated_at) FROM alerts) AS alert_updated`).Scan(&watermark).Error
+	return watermark, err
+}
+
+// computeSummary runs the grouped queries of a summary
+func (s *DashboardService) computeSummary(timeRange string, window TimeWindow, now time.Time) (*DashboardSummary, error) {
+	db := database.ReadDB(s.DB)
+
+	summary := &DashboardSummary{
+		TimeRange:        timeRange,
+		GeneratedAt:      now,
+		EventsByCategory: make(map[string]int64),
+		EventTimeSeries:  TimeSeriesData{Labels: []string{}, Data: []int64{}},
+		V2X: V2XDashboardSummary{
+			ByMessageType: make(map[string]int64),
+			ByAnomalyType: make(map[string]int64),
+		},
+	}
+	if !window.From.IsZero() {
+		summary.From = &window.From
+	}
+	if !window.To.IsZero() {
+		summary.To = &window.To
+	}
+
+	// severities, categories and the time series of events in one pass
+	bucket := "to_char(date_trunc('day', timestamp), 'YYYY-MM-DD')"
+	if !window.From.IsZero() && !window.To.IsZero() && window.To.Sub(window.From) <= 48*time.Hour {
+		bucket = "to_char(date_trunc('hour', timestamp), 'YYYY-MM-DD HH24:00')"
+	}
+	var eventRows []struct {
+		TimeGroup string
+		Severity  models.EventSeverity
+		Category  string
+		Count     int64
+	}
+	if err := window.Apply(db.Model(&models.SecurityEvent{}), "timestamp").
+		Select(bucket + " AS time_group, severity, category, count(*) AS count").
+		Group("time_group, severity, category").
+		Order("time_group").
+		Scan(&eventRows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range eventRows {
+		summary.EventSummary.Total += row.Count
+		switch row.Severity {
+		case models.SeverityCritical:
+			summary.EventSummary.Critical += row.Count
+		case models.SeverityHigh:
+			summary.EventSummary.High += row.Count
+		case models.SeverityMedium:
+			summary.EventSummary.Medium += row.Count
+		case models.SeverityLow:
+			summary.EventSummary.Low += row.Count
+		case models.SeverityInfo:
+			summary.EventSummary.Info += row.Count
+		}
+		summary.EventsByCategory[row.Category] += row.Count
+
+		series := &summary.EventTimeSeries
+		if n := len(series.Labels); n == 0 || series.Labels[n-1] != row.TimeGroup {
+			series.Labels = append(series.Labels, row.TimeGroup)
+			series.Data = append(series.Data, 0)
+		}
+		series.Data[len(series.Data)-1] += row.Count
+	}
+
+	alerts, err := s.GetAlertSummary(window)
+	if err != nil {
+		return nil, err
+	}
+	summary.AlertSummary = *alerts
+
+	if summary.TopSources, err = s.GetTopSourceIPs(window, dashboardSummaryTopN); err != nil {
+		return nil, err
+	}
+	if summary.TopRules, err = s.GetTopTriggeredRules(window, dashboardSummaryTopN); err != nil {
+		return nil, err
+	}
+
+	// V2X messages by type and the anomalies raised on them, also in one pass
+	var v2xRows []struct {
+		MessageType *string
+		AnomalyType *string
+		Count       int64
+	}
+	if err := window.Apply(db.Model(&models.SecurityEvent{}), "timestamp").
+		Select(v2xDetailPattern("message_type")+" AS message_type, "+v2xDetailPattern("anomaly_type")+" AS anomaly_type, count(*) AS count").
+		Where("category = ?", models.CategoryV2X).
+		Group("message_type, anomaly_type").
+		Scan(&v2xRows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range v2xRows {
+		if row.AnomalyType != nil {
+			summary.V2X.Anomalies += row.Count
+			summary.V2X.ByAnomalyType[*row.AnomalyType] += row.Count
+			continue
+		}
+		summary.V2X.Messages += row.Count
+		messageType := "unknown"
+		if row.MessageType != nil {
+			messageType = *row.MessageType
+		}
+		summary.V2X.ByMessageType[messageType] += row.Count
+	}
+
+	return summary, nil
+}
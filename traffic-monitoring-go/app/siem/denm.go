@@ -0,0 +1,314 @@
+package siem
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/eventschema"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// ErrNotDENM is returned when an alert was not raised on a located DENM
+var ErrNotDENM = errors.New("alert was not raised on a DENM with a location")
+
+// IsDENMMessageType reports whether a V2X message type is a DENM
+func IsDENMMessageType(messageType string) bool {
+	return eventschema.IsDENM(messageType)
+}
+
+// DENMVerifier checks whether vehicles within a DENM's relevance radius slowed
+// down after it was sent, compared with vehicles just outside the radius
+type DENMVerifier struct {
+	DB    *gorm.DB
+	Clock clock.Clock
+
+	DefaultRadius float64       // relevance radius (m) when the DENM does not declare one
+	Before        time.Duration // speed reports before the DENM used as baseline
+	After         time.Duration // speed reports after the DENM checked for a reaction
+	ControlFactor float64       // the control ring extends to this multiple of the radius
+	Slowdown      float64       // relative speed reduction counted as a reaction
+
+	notDENM map[uint]time.Time // alerts the background check found not to be DENMs, by alert time
+}
+
+var (
+	denmDefaultRadius = config.NewFloat("DENM_DEFAULT_RADIUS_M", 500, "Meters around a DENM without a relevance area that vehicles are checked in", config.Positive)
+	denmVerifyBefore  = config.NewInt("DENM_VERIFY_BEFORE_SECONDS", 60, "Seconds before a DENM speeds are compared from", config.Min(1))
+	denmVerifyAfter   = config.NewInt("DENM_VERIFY_AFTER_SECONDS", 120, "Seconds after a DENM speeds are compared until", config.Min(1))
+)
+
+// NewDENMVerifier creates a verifier configured from DENM_DEFAULT_RADIUS_M
+// (default 500), DENM_VERIFY_BEFORE_SECONDS (default 60) and
+// DENM_VERIFY_AFTER_SECONDS (default 120)
+func NewDENMVerifier(db *gorm.DB) *DENMVerifier {
+	return &DENMVerifier{
+		DB:            db,
+		Clock:         clock.Default(),
+		DefaultRadius: denmDefaultRadius.Get(),
+		Before:        time.Duration(denmVerifyBefore.Get()) * time.Second,
+		After:         time.Duration(denmVerifyAfter.Get()) * time.Second,
+		ControlFactor: 3,
+		Slowdown:      0.1,
+		notDENM:       make(map[uint]time.Time),
+	}
+}
+
+// denmRadius reads the declared relevance radius (m) from the event details
+func denmRadius(event *models.SecurityEvent) (float64, bool) {
+	var raw struct {
+		Details map[string]interface{} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(event.RawData), &raw); err != nil {
+		return 0, false
+	}
+	for _, key := range []string{"relevance_radius_m", "radius_m", "relevance_radius"} {
+		switch value := raw.Details[key].(type) {
+		case float64:
+			if value > 0 {
+				return value, true
+			}
+		case string:
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed > 0 {
+				return parsed, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// vehicleReaction collects the speed reports of one vehicle around a DENM
+type vehicleReaction struct {
+	before, after []float64
+	distance      float64
+	positioned    bool
+	afterPosition bool // distance is taken from a report after the DENM
+}
+
+func meanSpeed(speeds []float64) float64 {
+	total := 0.0
+	for _, speed := range speeds {
+		total += speed
+	}
+	return total / float64(len(speeds))
+}
+
+// Verify computes the reaction to the DENM an alert was raised on
+func (v *DENMVerifier) Verify(alert *models.Alert) (*models.DENMVerification, error) {
+	db := database.ReadDB(v.DB)
+
+	var event models.SecurityEvent
+	if err := db.Preload("LogSource").First(&event, alert.SecurityEventID).Error; err != nil {
+		return nil, err
+	}
+	denm, ok := ParseV2XObservation(&event, event.LogSource.Name)
+	if !ok || !denm.HasLocation || !IsDENMMessageType(denm.MessageType) {
+		return nil, ErrNotDENM
+	}
+
+	radius, ok := denmRadius(&event)
+	if !ok {
+		radius = v.DefaultRadius
+	}
+
+	verification := &models.DENMVerification{
+		AlertID:         alert.ID,
+		SecurityEventID: event.ID,
+		SenderID:        denm.VehicleID,
+		MessageType:     denm.MessageType,
+		RadiusM:         radius,
+		Latitude:        denm.Latitude,
+		Longitude:       denm.Longitude,
+		WindowStart:     denm.Generated.Add(-v.Before),
+		WindowEnd:       denm.Generated.Add(v.After),
+		VerifiedAt:      v.Clock.Now(),
+	}
+
+	var events []models.SecurityEvent
+	err := db.Preload("LogSource").
+		Where("category IN ? AND timestamp >= ? AND timestamp < ? AND id <> ?",
+			[]models.EventCategory{models.CategoryV2X, models.CategoryVehicle},
+			verification.WindowStart, verification.WindowEnd, event.ID).
+		Order("timestamp ASC").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// the position that decides inside or outside is the first report after the
+	// DENM, or the last one before it for vehicles that went quiet
+	reactions := make(map[string]*vehicleReaction)
+	for i := range events {
+		obs, ok := ParseV2XObservation(&events[i], events[i].LogSource.Name)
+		if !ok || obs.VehicleID == denm.VehicleID {
+			continue
+		}
+		reaction := reactions[obs.VehicleID]
+		if reaction == nil {
+			reaction = &vehicleReaction{}
+			reactions[obs.VehicleID] = reaction
+		}
+
+		after := !obs.Generated.Before(denm.Generated)
+		if obs.HasSpeed {
+			if after {
+				reaction.after = append(reaction.after, obs.Speed)
+			} else {
+				reaction.before = append(reaction.before, obs.Speed)
+			}
+		}
+		if obs.HasLocation && !reaction.afterPosition {
+			reaction.distance = DistanceMeters(denm.Latitude, denm.Longitude, obs.Latitude, obs.Longitude)
+			reaction.positioned = true
+			reaction.afterPosition = after
+		}
+	}
+
+	var insideChange, outsideChange float64
+	for _, reaction := range reactions {
+		if !reaction.positioned || reaction.distance > radius*v.ControlFactor {
+			continue
+		}
+		inside := reaction.distance <= radius
+		if inside {
+			verification.InsideVehicles++
+		} else {
+			verification.OutsideVehicles++
+		}
+		if len(reaction.before) == 0 || len(reaction.after) == 0 {
+			continue
+		}
+
+		before, after := meanSpeed(reaction.before), meanSpeed(reaction.after)
+		slowed := before > 0 && after <= before*(1-v.Slowdown)
+		if inside {
+			verification.InsideMeasured++
+			insideChange += after - before
+			if slowed {
+				verification.InsideSlowed++
+			}
+		} else {
+			verification.OutsideMeasured++
+			outsideChange += after - before
+			if slowed {
+				verification.OutsideSlowed++
+			}
+		}
+	}
+
+	if verification.InsideMeasured > 0 {
+		change := insideChange / float64(verification.InsideMeasured)
+		verification.InsideMeanSpeedChange = &change
+	}
+	if verification.OutsideMeasured > 0 {
+		change := outsideChange / float64(verification.OutsideMeasured)
+		verification.OutsideMeanSpeedChange = &change
+	}
+	if verification.InsideMeasured > 0 && verification.OutsideMeasured > 0 {
+		effectiveness := float64(verification.InsideSlowed)/float64(verification.InsideMeasured) -
+			float64(verification.OutsideSlowed)/float64(verification.OutsideMeasured)
+		verification.Effectiveness = &effectiveness
+	}
+
+	if verification.InsideVehicles == 0 {
+		verification.Suspicious = true
+		verification.SuspiciousReason = "no vehicles reported a position within the declared radius around the DENM"
+	}
+
+	return verification, nil
+}
+
+// VerifyAndStore verifies an alert and stores the result, replacing an earlier one
+func (v *DENMVerifier) VerifyAndStore(alert *models.Alert) (*models.DENMVerification, error) {
+	verification, err := v.Verify(alert)
+	if err != nil {
+		return nil, err
+	}
+
+	err = v.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("alert_id = ?", alert.ID).Delete(&models.DENMVerification{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(verification).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return verification, nil
+}
+
+// verifyPending verifies the V2X alerts of the last day whose DENM reaction window has closed
+func (v *DENMVerifier) verifyPending() (int, error) {
+	now := v.Clock.Now()
+	cutoff := now.Add(-v.After)
+	since := now.Add(-24 * time.Hour)
+
+	skip := make([]uint, 0, len(v.notDENM))
+	for id, at := range v.notDENM {
+		if at.Before(since) {
+			delete(v.notDENM, id)
+		} else {
+			skip = append(skip, id)
+		}
+	}
+
+	var alerts []models.Alert
+	query := v.DB.Joins("JOIN security_events ON security_events.id = alerts.security_event_id").
+		Where("security_events.category = ? AND security_events.timestamp <= ?", models.CategoryV2X, cutoff).
+		Where("alerts.timestamp >= ?", since).
+		Where("NOT EXISTS (SELECT 1 FROM denm_verifications WHERE denm_verifications.alert_id = alerts.id)").
+		Order("alerts.id ASC").
+		Limit(500)
+	if len(skip) > 0 {
+		query = query.Where("alerts.id NOT IN ?", skip)
+	}
+	if err := query.Find(&alerts).Error; err != nil {
+		return 0, err
+	}
+
+	verified := 0
+	for i := range alerts {
+		verification, err := v.VerifyAndStore(&alerts[i])
+		if err == ErrNotDENM {
+			v.notDENM[alerts[i].ID] = alerts[i].Timestamp
+			continue
+		}
+		if err != nil {
+			log.Printf("Error verifying DENM reaction for alert %d: %v", alerts[i].ID, err)
+			continue
+		}
+		verified++
+		if verification.Suspicious {
+			log.Printf("Suspicious DENM: alert %d, %s from %s had no plausible recipients within %.0fm",
+				alerts[i].ID, verification.MessageType, verification.SenderID, verification.RadiusM)
+		}
+	}
+	return verified, nil
+}
+
+// Start verifies the DENM alerts whose reaction window has closed every minute
+func (v *DENMVerifier) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			verified, err := v.verifyPending()
+			if err != nil {
+				log.Printf("Error verifying DENM reactions: %v", err)
+				continue
+			}
+			if verified > 0 {
+				log.Printf("Verified vehicle reactions for %d DENM alerts", verified)
+			}
+		}
+	}()
+
+	log.Printf("DENM reaction verification started (radius %.0fm, %s before, %s after)", v.DefaultRadius, v.Before, v.After)
+}
@@ -0,0 +1,254 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// IndexFamilies are the index name prefixes owned by the SIEM.
+// Admin operations refuse to touch indices outside these families.
+var IndexFamilies = []string{"security-events", "security-alerts", "alerts"}
+
+// indexPatternChars restricts admin patterns to plain index names and wildcards
+var indexPatternChars = regexp.MustCompile(`^[a-z0-9._*-]+$`)
+
+// IndexInfo describes a single index as reported by the _cat API
+type IndexInfo struct {
+	Index     string `json:"index"`
+	Health    string `json:"health"`
+	Status    string `json:"status"`
+	DocsCount int64  `json:"docs_count"`
+	SizeBytes int64  `json:"size_bytes"`
+	Primaries int    `json:"primaries"`
+	Replicas  int    `json:"replicas"`
+}
+
+// ValidateIndexPattern checks that every comma-separated part of pattern
+// belongs to one of the SIEM index families
+func ValidateIndexPattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("index pattern is required")
+	}
+
+	for _, part := range strings.Split(pattern, ",") {
+		part = strings.TrimSpace(part)
+		if !indexPatternChars.MatchString(part) {
+			return fmt.Errorf("invalid index pattern %q", part)
+		}
+
+		allowed := false
+		for _, family := range IndexFamilies {
+			if part == family || strings.HasPrefix(part, family+"-") || part == family+"*" {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("index pattern %q is outside the SIEM index families (%s)", part, strings.Join(IndexFamilies, ", "))
+		}
+	}
+
+	return nil
+}
+
+// doAdminRequest performs a request against the cluster and returns the body on success
+func (c *ESClient) doAdminRequest(method, path string, body interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewBuffer(payload)
+	}
+
+	req, err := http.NewRequest(method, c.URL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("elasticsearch returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return respBody, nil
+}
+
+// ListIndices returns the indices matching pattern with their sizes and document counts
+func (c *ESClient) ListIndices(pattern string) ([]IndexInfo, error) {
+	path := fmt.Sprintf("/_cat/indices/%s?format=json&bytes=b&s=index", url.PathEscape(pattern))
+	body, err := c.doAdminRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// _cat returns every value as a string
+	var rows []map[string]string
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, err
+	}
+
+	indices := make([]IndexInfo, 0, len(rows))
+	for _, row := range rows {
+		docs, _ := strconv.ParseInt(row["docs.count"], 10, 64)
+		size, _ := strconv.ParseInt(row["store.size"], 10, 64)
+		pri, _ := strconv.Atoi(row["pri"])
+		rep, _ := strconv.Atoi(row["rep"])
+		indices = append(indices, IndexInfo{
+			Index:     row["index"],
+			Health:    row["health"],
+			Status:    row["status"],
+			DocsCount: docs,
+			SizeBytes: size,
+			Primaries: pri,
+			Replicas:  rep,
+		})
+	}
+
+	return indices, nil
+}
+
+// ForceMerge merges the segments of the indices matching pattern
+func (c *ESClient) ForceMerge(pattern string, maxNumSegments int) (map[string]interface{}, error) {
+	if maxNumSegments <= 0 {
+		maxNumSegments = 1
+	}
+
+	path := fmt.Sprintf("/%s/_forcemerge?max_num_segments=%d", url.PathEscape(pattern), maxNumSegments)
+	body, err := c.doAdminRequest("POST", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteIndices deletes the indices matching pattern and returns their names
+func (c *ESClient) DeleteIndices(pattern string) ([]string, error) {
+	// resolve the pattern first so the caller knows exactly what was removed
+	indices, err := c.ListIndices(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(indices) == 0 {
+		return []string{}, nil
+	}
+
+	names := make([]string, len(indices))
+	for i, index := range indices {
+		names[i] = index.Index
+	}
+
+	if _, err := c.doAdminRequest("DELETE", "/"+url.PathEscape(strings.Join(names, ",")), nil); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// Rollover rolls the write alias over to a new index, optionally only when conditions are met
+func (c *ESClient) Rollover(alias string, conditions map[string]interface{}) (map[string]interface{}, error) {
+	var body interface{}
+	if len(conditions) > 0 {
+		body = map[string]interface{}{"conditions": conditions}
+	}
+
+	respBody, err := c.doAdminRequest("POST", fmt.Sprintf("/%s/_rollover", url.PathEscape(alias)), body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListIndices lists SIEM indices matching pattern
+func (s *Service) ListIndices(pattern string) ([]IndexInfo, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if !s.isInitialized() {
+		return nil, fmt.Errorf("elasticsearch service not initialized")
+	}
+	if err := ValidateIndexPattern(pattern); err != nil {
+		return nil, err
+	}
+
+	return s.Client.ListIndices(pattern)
+}
+
+// ForceMerge force-merges SIEM indices matching pattern
+func (s *Service) ForceMerge(pattern string, maxNumSegments int) (map[string]interface{}, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if !s.isInitialized() {
+		return nil, fmt.Errorf("elasticsearch service not initialized")
+	}
+	if err := ValidateIndexPattern(pattern); err != nil {
+		return nil, err
+	}
+
+	return s.Client.ForceMerge(pattern, maxNumSegments)
+}
+
+// DeleteIndices deletes SIEM indices matching pattern
+func (s *Service) DeleteIndices(pattern string) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if !s.isInitialized() {
+		return nil, fmt.Errorf("elasticsearch service not initialized")
+	}
+	if err := ValidateIndexPattern(pattern); err != nil {
+		return nil, err
+	}
+
+	return s.Client.DeleteIndices(pattern)
+}
+
+// Rollover rolls over a SIEM write alias
+func (s *Service) Rollover(alias string, conditions map[string]interface{}) (map[string]interface{}, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if !s.isInitialized() {
+		return nil, fmt.Errorf("elasticsearch service not initialized")
+	}
+	if strings.Contains(alias, "*") {
+		return nil, fmt.Errorf("rollover requires a concrete alias, not a pattern")
+	}
+	if err := ValidateIndexPattern(alias); err != nil {
+		return nil, err
+	}
+
+	return s.Client.Rollover(alias, conditions)
+}
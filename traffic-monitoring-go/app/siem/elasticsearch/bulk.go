@@ -0,0 +1,281 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/metrics"
+)
+
+var (
+	indexSeconds = metrics.NewHistogramVec("siem_es_index_seconds",
+		"Time of Elasticsearch index requests, by mode (single or bulk)", metrics.DefaultBuckets, "mode")
+	indexErrors = metrics.NewCounterVec("siem_es_index_errors_total",
+		"Documents Elasticsearch failed to index or rejected, by mode", "mode")
+	searchSeconds = metrics.NewHistogramVec("siem_es_search_seconds",
+		"Time of Elasticsearch event searches, by whether they were routed by geohash", metrics.DefaultBuckets, "routed")
+)
+
+var (
+	bulkBufferSize = config.NewInt("ES_BULK_BUFFER_SIZE", 10000, "Documents buffered for the _bulk API; 0 indexes each on its own", config.Min(0))
+	bulkMaxBatch   = config.NewInt("ES_BULK_MAX_BATCH", 500, "Documents per _bulk request", config.Min(1))
+	bulkFlushMS    = config.NewInt("ES_BULK_FLUSH_MS", 1000, "Milliseconds a document may wait in the bulk buffer", config.Min(1))
+)
+
+// errBulkBufferFull is returned when documents arrive faster than they can be flushed
+var errBulkBufferFull = errors.New("bulk indexing buffer is full")
+
+// bulkOp is one buffered index operation
+type bulkOp struct {
+	index   string
+	id      uint
+	routing string
+	doc     []byte
+}
+
+// bulkWriter buffers index operations in memory and sends them with the _bulk
+// API when a batch is full or the flush interval elapses
+type bulkWriter struct {
+	service  *Service
+	ops      chan bulkOp
+	maxBatch int
+	interval time.Duration
+	done     chan struct{}
+
+	closeMutex sync.RWMutex
+	closed     bool
+
+	mutex       sync.Mutex
+	queued      uint64
+	indexed     uint64
+	batches     uint64
+	rejected    uint64
+	spilled     uint64
+	dropped     uint64
+	lastFlushAt time.Time
+	lastError   string
+}
+
+// BulkStats describes the bulk indexing buffer
+type BulkStats struct {
+	Enabled       bool       `json:"enabled"`
+	Buffered      int        `json:"buffered"`
+	BufferSize    int        `json:"buffer_size"`
+	MaxBatch      int        `json:"max_batch"`
+	FlushInterval string     `json:"flush_interval"`
+	Queued        uint64     `json:"queued"`
+	Indexed       uint64     `json:"indexed"`
+	Batches       uint64     `json:"batches"`
+	Rejected      uint64     `json:"rejected"` // documents Elasticsearch refused
+	Spilled       uint64     `json:"spilled"`  // documents moved to the spill buffer after a failed flush
+	Dropped       uint64     `json:"dropped"`  // documents lost because no spill buffer was available
+	LastFlushAt   *time.Time `json:"last_flush_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// StartBulk routes index operations through an in-memory buffer flushed with
+// the _bulk API. ES_BULK_BUFFER_SIZE (default 10000, 0 disables) bounds the
+// buffer, ES_BULK_MAX_BATCH (default 500) the documents per request and
+// ES_BULK_FLUSH_MS (default 1000) how long a document may wait in the buffer.
+func (s *Service) StartBulk() {
+	bufferSize := bulkBufferSize.Get()
+	if bufferSize == 0 {
+		return
+	}
+	maxBatch := bulkMaxBatch.Get()
+
+	writer := &bulkWriter{
+		service:  s,
+		ops:      make(chan bulkOp, bufferSize),
+		maxBatch: maxBatch,
+		interval: time.Duration(bulkFlushMS.Get()) * time.Millisecond,
+		done:     make(chan struct{}),
+	}
+	s.mutex.Lock()
+	s.bulk = writer
+	s.mutex.Unlock()
+
+	go writer.run()
+	s.Log.Info("bulk indexing started", "buffer", bufferSize, "batch", maxBatch, "flush_interval", writer.interval)
+}
+
+// add buffers an operation without blocking
+func (w *bulkWriter) add(index string, id uint, routing string, doc []byte) error {
+	w.closeMutex.RLock()
+	defer w.closeMutex.RUnlock()
+	if w.closed {
+		return errors.New("bulk indexing is shut down")
+	}
+
+	select {
+	case w.ops <- bulkOp{index: index, id: id, routing: routing, doc: doc}:
+		w.mutex.Lock()
+		w.queued++
+		w.mutex.Unlock()
+		return nil
+	default:
+		return errBulkBufferFull
+	}
+}
+
+func (w *bulkWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]bulkOp, 0, w.maxBatch)
+	for {
+		select {
+		case op, ok := <-w.ops:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, op)
+			if len(batch) >= w.maxBatch {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush sends a batch; when Elasticsearch is unavailable the batch moves to the spill buffer
+func (w *bulkWriter) flush(batch []bulkOp) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var body bytes.Buffer
+	for _, op := range batch {
+		body.Write(bulkAction(op.index, op.id, op.routing))
+		body.WriteByte('\n')
+		body.Write(op.doc)
+		body.WriteByte('\n')
+	}
+
+	started := time.Now()
+	rejected, err := w.service.Client.bulk(&body)
+	indexSeconds.Observe(time.Since(started).Seconds(), "bulk")
+	if err != nil {
+		indexErrors.Add(float64(len(batch)), "bulk")
+	} else if rejected > 0 {
+		indexErrors.Add(float64(rejected), "bulk")
+	}
+
+	spilled, dropped := 0, 0
+	if err != nil {
+		spill := w.service.spillBuffer()
+		for _, op := range batch {
+			if spill != nil && isTransient(err) && spill.add(op.index, op.id, op.routing, op.doc) == nil {
+				spilled++
+			} else {
+				dropped++
+			}
+		}
+		if dropped > 0 {
+			w.service.Log.Error("failed to flush documents, some dropped", "documents", len(batch), "dropped", dropped, "error", err)
+		}
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.batches++
+	w.lastFlushAt = time.Now()
+	if err != nil {
+		w.lastError = err.Error()
+		w.spilled += uint64(spilled)
+		w.dropped += uint64(dropped)
+		return
+	}
+	w.indexed += uint64(len(batch) - rejected)
+	w.rejected += uint64(rejected)
+}
+
+// close stops accepting operations and waits up to timeout for the buffer to be flushed
+func (w *bulkWriter) close(timeout time.Duration) error {
+	w.closeMutex.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.ops)
+	}
+	w.closeMutex.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("timed out flushing the bulk indexing buffer")
+	}
+}
+
+// spillBuffer returns the spill buffer, or nil when spilling is disabled
+func (s *Service) spillBuffer() *spillBuffer {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.spill
+}
+
+// bulkWriter returns the bulk indexing buffer, or nil when it is disabled
+func (s *Service) bulkWriter() *bulkWriter {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.bulk
+}
+
+// BulkStats returns the state of the bulk indexing buffer
+func (s *Service) BulkStats() BulkStats {
+	writer := s.bulkWriter()
+	if writer == nil {
+		return BulkStats{}
+	}
+
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	stats := BulkStats{
+		Enabled:       true,
+		Buffered:      len(writer.ops),
+		BufferSize:    cap(writer.ops),
+		MaxBatch:      writer.maxBatch,
+		FlushInterval: writer.interval.String(),
+		Queued:        writer.queued,
+		Indexed:       writer.indexed,
+		Batches:       writer.batches,
+		Rejected:      writer.rejected,
+		Spilled:       writer.spilled,
+		Dropped:       writer.dropped,
+		LastError:     writer.lastError,
+	}
+	if !writer.lastFlushAt.IsZero() {
+		lastFlush := writer.lastFlushAt
+		stats.LastFlushAt = &lastFlush
+	}
+	return stats
+}
+
+// Close flushes buffered documents and closes the spill buffer. Call it on shutdown.
+func (s *Service) Close(timeout time.Duration) error {
+	s.mutex.RLock()
+	writer, spill := s.bulk, s.spill
+	s.mutex.RUnlock()
+
+	var err error
+	if writer != nil {
+		err = writer.close(timeout)
+	}
+	if spill != nil {
+		if closeErr := spill.queue.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -7,31 +7,66 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 	"strings"
 
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/logging"
 	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
 )
 
 // ESClient is a simple Elasticsearch client
 type ESClient struct {
 	URL     	string
 	HTTPClient 	*http.Client
+
+	// GeohashRoutingPrecision routes located events to shards by this many
+	// characters of their geohash (0 disables custom routing)
+	GeohashRoutingPrecision int
+	// EventShards is the number of primary shards of new event indices
+	EventShards int
+	// ILM writes events through the EventsWriteAlias rollover alias and
+	// ages event and alert indices out by the ILMPhases policies
+	ILM       bool
+	ILMPhases ILMPhases
 }
 
-// NewESClient creates a new Elasticsearch client
+var (
+	esURL                     = config.NewString("ELASTICSEARCH_URL", "http://elasticsearch:9200", "URL of the Elasticsearch cluster")
+	esGeohashRoutingPrecision = config.NewInt("ES_GEOHASH_ROUTING_PRECISION", 0,
+		"Geohash characters located events are routed to shards by; 0 disables routing", config.Min(0), config.Max(12))
+	esEventShards = config.NewInt("ES_EVENT_SHARDS", 1, "Primary shards of new event indices", config.Min(1))
+	esILMEnabled  = config.NewBool("ES_ILM_ENABLED", true, "Roll event indices over by the ES_ILM_* phases instead of writing daily indices")
+)
+
+// NewESClient creates a new Elasticsearch client. ES_GEOHASH_ROUTING_PRECISION
+// (1 to 12, default 0 which disables it) routes located events to shards by
+// geohash prefix, and ES_EVENT_SHARDS (default 1) sets the shards of new
+// event indices; routing only narrows searches when there are several.
+// ES_ILM_ENABLED=false keeps writing daily event indices instead of rolling
+// them over by the phases of ILMPhasesFromEnv.
 func NewESClient() *ESClient {
-	url := os.Getenv("ELASTICSEARCH_URL")
-	if url == "" {
-		url = "http://elasticsearch:9200" // Default URL
+	precision := esGeohashRoutingPrecision.Get()
+	if precision > indexedGeohashPrecision {
+		precision = indexedGeohashPrecision
+	}
+	phases := ILMPhasesFromEnv()
+	if err := phases.Validate(); err != nil {
+		logging.New("elasticsearch").Warn("invalid ES_ILM_* setting, using the default phases", "error", err)
+		phases = defaultILMPhases
 	}
 
 	return &ESClient{
-		URL: url,
+		URL: esURL.Get(),
 		HTTPClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		GeohashRoutingPrecision: precision,
+		EventShards:             esEventShards.Get(),
+		ILM:                     esILMEnabled.Get(),
+		ILMPhases:               phases,
 	}
 }
 
@@ -108,11 +143,20 @@ func (c *ESClient) createIndexIfNotExists(index string) error {
                     "message": map[string]interface{}{
                         "type": "text",
                     },
+                    "geohash": map[string]interface{}{
+                        "type": "keyword",
+                    },
+                    "location": map[string]interface{}{
+                        "type": "geo_point",
+                    },
+                    "anomaly_type": map[string]interface{}{
+                        "type": "keyword",
+                    },
                     // Add other fields as needed
                 },
             },
             "settings": map[string]interface{}{
-                "number_of_shards": 1,
+                "number_of_shards": c.EventShards,
                 "number_of_replicas": 0,
             },
         }
@@ -187,6 +231,7 @@ func (c *ESClient) IndexSecurityEvent(event *models.SecurityEvent) error {
 		"status":          event.Status,
 		"user_id":         event.UserID,
 		"device_id":       event.DeviceID,
+		"trust_score":     event.TrustScore,
 		"log_source_id":   event.LogSourceID,
 		"severity":        event.Severity,
 		"category":        event.Category,
@@ -266,16 +311,58 @@ func (c *ESClient) IndexAlert(alert *models.Alert) error {
 	return nil
 }
 
+// SearchOptions asks a search for more than the matching events
+type SearchOptions struct {
+	Highlight bool     // return message snippets with the matched terms marked
+	Facets    []string // count the matches by these facets (see SearchFacetFields)
+	FacetSize int      // values per facet, 10 when unset
+	Geohashes []string // only match located events within these geohash cells
+}
+
+// SearchFacetFields maps the facets a search can count by to event fields
+var SearchFacetFields = map[string]string{
+	"severity": "severity",
+	"category": "category",
+	"source":   "log_source_id",
+}
+
+// FacetCount is the number of matching events with one value of a facet
+type FacetCount struct {
+	Value interface{} `json:"value"`
+	Count int         `json:"count"`
+}
+
+// SearchResult is a page of matching events. With highlighting, each event
+// carries its message snippets under "highlight".
+type SearchResult struct {
+	Events []map[string]interface{}
+	Total  int
+	Facets map[string][]FacetCount
+	Took   int  // milliseconds Elasticsearch spent on the search
+	Routed bool // whether the search only went to the shards of its geohashes
+}
+
 // SearchSecurityEvents searches for security events in Elasticsearch
 func (c *ESClient) SearchSecurityEvents(query map[string]interface{}, from, size int, timeRange string) ([]map[string]interface{}, int, error) {
-    // Determine the indices to search based on timeRange
+	result, err := c.SearchSecurityEventsWithOptions(query, from, size, timeRange, SearchOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	return result.Events, result.Total, nil
+}
+
+// SearchSecurityEventsWithOptions searches for security events, returning
+// highlights and facet counts along with the hits when asked to
+func (c *ESClient) SearchSecurityEventsWithOptions(query map[string]interface{}, from, size int, timeRange string, opts SearchOptions) (*SearchResult, error) {
+    // Determine the indices to search based on timeRange; the wildcard before
+    // the date takes in the daily indices of tenants, security-events-{org}-YYYY.MM.DD
     var indexPattern string
     switch timeRange {
     case "today":
-        indexPattern = fmt.Sprintf("security-events-%s", time.Now().Format("2006.01.02"))
+        indexPattern = fmt.Sprintf("security-events-*%s", time.Now().Format("2006.01.02"))
     case "yesterday":
         yesterday := time.Now().AddDate(0, 0, -1)
-        indexPattern = fmt.Sprintf("security-events-%s", yesterday.Format("2006.01.02"))
+        indexPattern = fmt.Sprintf("security-events-*%s", yesterday.Format("2006.01.02"))
     case "last_7_days":
         indexPattern = "security-events-*"
         // Add a date range filter to the query
@@ -343,7 +430,7 @@ func (c *ESClient) SearchSecurityEvents(query map[string]interface{}, from, size
 		}
 	
 	case "this_month":
-		indexPattern = fmt.Sprintf("security-events-%s.*", time.Now().Format("2006.01"))
+		indexPattern = fmt.Sprintf("security-events-*%s.*", time.Now().Format("2006.01"))
 		if query == nil {
 			query = make(map[string]interface{})
 		}
@@ -377,7 +464,7 @@ func (c *ESClient) SearchSecurityEvents(query map[string]interface{}, from, size
 	
 	case "last_month":
 		lastMonth := time.Now().AddDate(0, -1, 0)
-		indexPattern = fmt.Sprintf("security-events-%s.*", lastMonth.Format("2006.01"))
+		indexPattern = fmt.Sprintf("security-events-*%s.*", lastMonth.Format("2006.01"))
 		if query == nil {
 			query = make(map[string]interface{})
 		}
@@ -414,6 +501,17 @@ func (c *ESClient) SearchSecurityEvents(query map[string]interface{}, from, size
         indexPattern = "security-events-*"
     }
 
+    // rolled-over indices are numbered rather than dated, so the day ranges
+    // search them all and filter on the timestamp instead
+    if c.ILM && indexPattern != "security-events-*" {
+        indexPattern = "security-events-*"
+        query = timeRangeFilter(query, timeRange)
+    }
+
+    if len(opts.Geohashes) > 0 {
+        query = geohashFilter(query, opts.Geohashes)
+    }
+
     // Add pagination parameters
     searchQuery := map[string]interface{}{
         "query": query,
@@ -428,56 +526,90 @@ func (c *ESClient) SearchSecurityEvents(query map[string]interface{}, from, size
         },
     }
 
+	if opts.Highlight {
+		searchQuery["highlight"] = map[string]interface{}{
+			"fields": map[string]interface{}{
+				"message": map[string]interface{}{
+					"fragment_size":       150,
+					"number_of_fragments": 3,
+				},
+			},
+		}
+	}
+	if len(opts.Facets) > 0 {
+		facetSize := opts.FacetSize
+		if facetSize <= 0 {
+			facetSize = 10
+		}
+		aggs := make(map[string]interface{})
+		for _, facet := range opts.Facets {
+			field, ok := SearchFacetFields[facet]
+			if !ok {
+				return nil, fmt.Errorf("unknown facet %q", facet)
+			}
+			aggs[facet] = map[string]interface{}{
+				"terms": map[string]interface{}{"field": field, "size": facetSize},
+			}
+		}
+		searchQuery["aggs"] = aggs
+	}
+
     searchJSON, err := json.Marshal(searchQuery)
     if err != nil {
-        return nil, 0, err
+        return nil, err
     }
 
-    // Execute search
+    // Execute search, only on the shards holding the geohashes when routed
     url := fmt.Sprintf("%s/%s/_search", c.URL, indexPattern)
+    routing := c.searchRouting(opts.Geohashes)
+    if routing != "" {
+        url += "?routing=" + routing
+    }
     req, err := http.NewRequest("POST", url, bytes.NewBuffer(searchJSON))
     if err != nil {
-        return nil, 0, err
+        return nil, err
     }
     req.Header.Set("Content-Type", "application/json")
 
+    started := time.Now()
     resp, err := c.HTTPClient.Do(req)
     if err != nil {
-        return nil, 0, err
+        return nil, err
     }
     defer resp.Body.Close()
 
     if resp.StatusCode != http.StatusOK {
         body, _ := io.ReadAll(resp.Body)
-        return nil, 0, fmt.Errorf("failed to search security events: %s", string(body))
+        return nil, fmt.Errorf("failed to search security events: %s", string(body))
     }
 
     // Parse response
     var result map[string]interface{}
     if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-        return nil, 0, err
+        return nil, err
     }
+    searchSeconds.Observe(time.Since(started).Seconds(), strconv.FormatBool(routing != ""))
 
     // Extract hits
     hitsMap, ok := result["hits"].(map[string]interface{})
     if !ok {
-        return nil, 0, errors.New("unexpected response format: missing hits")
+        return nil, errors.New("unexpected response format: missing hits")
     }
 
     totalMap, ok := hitsMap["total"].(map[string]interface{})
     if !ok {
-        return nil, 0, errors.New("unexpected response format: missing total")
+        return nil, errors.New("unexpected response format: missing total")
     }
 
     totalValue, ok := totalMap["value"].(float64)
     if !ok {
-        return nil, 0, errors.New("unexpected response format: missing total value")
+        return nil, errors.New("unexpected response format: missing total value")
     }
     total := int(totalValue)
 
     hitsArray, ok := hitsMap["hits"].([]interface{})
     if !ok {
-        return nil, total, errors.New("unexpected response format: hits is not an array")
+        return nil, errors.New("unexpected response format: hits is not an array")
     }
 
     // Extract events from hits
@@ -493,16 +625,48 @@ func (c *ESClient) SearchSecurityEvents(query map[string]interface{}, from, size
             continue
         }
 
+        if opts.Highlight {
+            if highlight, ok := hitMap["highlight"].(map[string]interface{}); ok {
+                source["highlight"] = highlight["message"]
+            }
+        }
+
         events = append(events, source)
     }
 
-    return events, total, nil
+    took, _ := result["took"].(float64)
+    searchResult := &SearchResult{Events: events, Total: total, Took: int(took), Routed: routing != ""}
+    if len(opts.Facets) > 0 {
+        searchResult.Facets = parseFacets(result["aggregations"], opts.Facets)
+    }
+    return searchResult, nil
+}
+
+// parseFacets reads the terms aggregations of a search into facet counts
+func parseFacets(aggregations interface{}, facets []string) map[string][]FacetCount {
+	aggs, _ := aggregations.(map[string]interface{})
+	counts := make(map[string][]FacetCount, len(facets))
+	for _, facet := range facets {
+		values := []FacetCount{}
+		agg, _ := aggs[facet].(map[string]interface{})
+		buckets, _ := agg["buckets"].([]interface{})
+		for _, bucket := range buckets {
+			b, ok := bucket.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			count, _ := b["doc_count"].(float64)
+			values = append(values, FacetCount{Value: b["key"], Count: int(count)})
+		}
+		counts[facet] = values
+	}
+	return counts
 }
 
 // GetEventDashboardStats returns statistics for the dashboard
 func (c *ESClient) GetEventDashboardStats(timeRange string) (map[string]interface{}, error) {
 	// Build time filter
-	timeFilter := buildTimeFilter(timeRange)
+	timeFilter := buildTimeFilter(timeRange, clock.Now())
 
 	// Build aggregation query
 	queryMap := map[string]interface{}{
@@ -567,9 +731,8 @@ func (c *ESClient) GetEventDashboardStats(timeRange string) (map[string]interfac
 	return result, nil
 }
 
-// Helper function to build time filter for Elasticsearch
-func buildTimeFilter(timeRange string) map[string]interface{} {
-	now := time.Now()
+// Helper function to build time filter for Elasticsearch relative to now
+func buildTimeFilter(timeRange string, now time.Time) map[string]interface{} {
 	var startTime time.Time
 
 	switch timeRange {
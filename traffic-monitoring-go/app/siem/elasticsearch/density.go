@@ -0,0 +1,225 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxDensityPrecision is the finest geohash precision density is counted by,
+// the precision located events are indexed with
+const maxDensityPrecision = indexedGeohashPrecision
+
+// BoundingBox is a map area in degrees. West is greater than East for boxes
+// crossing the antimeridian.
+type BoundingBox struct {
+	North float64 `json:"north"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	West  float64 `json:"west"`
+}
+
+// Validate checks the box lies within the coordinate ranges and north of its south
+func (b BoundingBox) Validate() error {
+	if b.North < -90 || b.North > 90 || b.South < -90 || b.South > 90 {
+		return errors.New("latitudes must be between -90 and 90")
+	}
+	if b.East < -180 || b.East > 180 || b.West < -180 || b.West > 180 {
+		return errors.New("longitudes must be between -180 and 180")
+	}
+	if b.North <= b.South {
+		return errors.New("north must be greater than south")
+	}
+	return nil
+}
+
+// Contains reports whether a coordinate lies in the box
+func (b BoundingBox) Contains(lat, lon float64) bool {
+	if lat < b.South || lat > b.North {
+		return false
+	}
+	if b.West <= b.East {
+		return lon >= b.West && lon <= b.East
+	}
+	return lon >= b.West || lon <= b.East
+}
+
+// width is the longitude span of the box in degrees
+func (b BoundingBox) width() float64 {
+	if b.West <= b.East {
+		return b.East - b.West
+	}
+	return 360 - b.West + b.East
+}
+
+// geohashCellSize returns the latitude and longitude span of a geohash cell
+func geohashCellSize(precision int) (float64, float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lonBits))
+}
+
+// DensityPrecision is the finest geohash precision at which the box spans
+// no more than maxCells cells
+func DensityPrecision(box BoundingBox, maxCells int) int {
+	for precision := maxDensityPrecision; precision > 1; precision-- {
+		latSpan, lonSpan := geohashCellSize(precision)
+		cells := math.Ceil((box.North-box.South)/latSpan+1) * math.Ceil(box.width()/lonSpan+1)
+		if cells <= float64(maxCells) {
+			return precision
+		}
+	}
+	return 1
+}
+
+// ValidDensityPrecision reports whether density can be counted by geohashes of this length
+func ValidDensityPrecision(precision int) bool {
+	return precision >= 1 && precision <= maxDensityPrecision
+}
+
+// GeohashCenter returns the coordinate at the center of a geohash cell
+func GeohashCenter(geohash string) (float64, float64) {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	even := true
+	for _, r := range geohash {
+		ch := strings.IndexRune(geohashAlphabet, r)
+		for bit := 4; bit >= 0; bit-- {
+			half := &lonRange
+			if !even {
+				half = &latRange
+			}
+			mid := (half[0] + half[1]) / 2
+			if ch>>uint(bit)&1 == 1 {
+				half[0] = mid
+			} else {
+				half[1] = mid
+			}
+			even = !even
+		}
+	}
+	return (latRange[0] + latRange[1]) / 2, (lonRange[0] + lonRange[1]) / 2
+}
+
+// DensityCell counts the located events of one geohash cell
+type DensityCell struct {
+	Geohash   string  `json:"geohash"`
+	Latitude  float64 `json:"latitude"` // of the cell center
+	Longitude float64 `json:"longitude"`
+	Messages  int     `json:"messages"`  // V2X messages, anomaly findings excluded
+	Anomalies int     `json:"anomalies"` // findings of the anomaly detectors
+}
+
+// GeoDensity counts the located events between from and to inside a box by
+// geohash cell, splitting the anomaly findings from the messages. It returns
+// the size most populated cells and the events of all the cells. Events
+// indexed before anomaly_type was added to their documents count as messages.
+func (c *ESClient) GeoDensity(box BoundingBox, from, to time.Time, precision, size int) ([]DensityCell, int, error) {
+	searchQuery := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{
+						"range": map[string]interface{}{
+							"timestamp": map[string]interface{}{
+								"gte": from.Format(time.RFC3339Nano),
+								"lt":  to.Format(time.RFC3339Nano),
+							},
+						},
+					},
+					map[string]interface{}{
+						"geo_bounding_box": map[string]interface{}{
+							"location": map[string]interface{}{
+								"top_left":     map[string]float64{"lat": box.North, "lon": box.West},
+								"bottom_right": map[string]float64{"lat": box.South, "lon": box.East},
+							},
+						},
+					},
+				},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"cells": map[string]interface{}{
+				"geohash_grid": map[string]interface{}{
+					"field":     "location",
+					"precision": precision,
+					"size":      size,
+				},
+				"aggs": map[string]interface{}{
+					"anomalies": map[string]interface{}{
+						"filter": map[string]interface{}{
+							"exists": map[string]interface{}{"field": "anomaly_type"},
+						},
+					},
+				},
+			},
+		},
+		"track_total_hits": true,
+	}
+
+	searchJSON, err := json.Marshal(searchQuery)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	url := fmt.Sprintf("%s/security-events-*/_search", c.URL)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(searchJSON))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, 0, fmt.Errorf("failed to aggregate event density: %s", string(body))
+	}
+
+	var result struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Aggregations struct {
+			Cells struct {
+				Buckets []struct {
+					Key       string `json:"key"`
+					DocCount  int    `json:"doc_count"`
+					Anomalies struct {
+						DocCount int `json:"doc_count"`
+					} `json:"anomalies"`
+				} `json:"buckets"`
+			} `json:"cells"`
+		} `json:"aggregations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, err
+	}
+
+	cells := make([]DensityCell, 0, len(result.Aggregations.Cells.Buckets))
+	for _, bucket := range result.Aggregations.Cells.Buckets {
+		lat, lon := GeohashCenter(bucket.Key)
+		cells = append(cells, DensityCell{
+			Geohash:   bucket.Key,
+			Latitude:  lat,
+			Longitude: lon,
+			Messages:  bucket.DocCount - bucket.Anomalies.DocCount,
+			Anomalies: bucket.Anomalies.DocCount,
+		})
+	}
+	return cells, result.Hits.Total.Value, nil
+}
@@ -0,0 +1,171 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"traffic-monitoring-go/app/eventschema"
+	"traffic-monitoring-go/app/models"
+)
+
+// geohashAlphabet is the base32 alphabet of geohashes
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// indexedGeohashPrecision is the length of the geohash stored with located events
+const indexedGeohashPrecision = 9
+
+// GeohashEncode returns the geohash of a coordinate with the given number of characters
+func GeohashEncode(lat, lon float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	hash := make([]byte, 0, precision)
+	bit, ch, even := 0, 0, true
+	for len(hash) < precision {
+		if even {
+			mid := (lonRange[0] + lonRange[1]) / 2
+			if lon >= mid {
+				ch |= 1 << (4 - bit)
+				lonRange[0] = mid
+			} else {
+				lonRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if lat >= mid {
+				ch |= 1 << (4 - bit)
+				latRange[0] = mid
+			} else {
+				latRange[1] = mid
+			}
+		}
+		even = !even
+		if bit < 4 {
+			bit++
+		} else {
+			hash = append(hash, geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// ValidGeohash reports whether s is a geohash of 1 to 12 characters
+func ValidGeohash(s string) bool {
+	if len(s) == 0 || len(s) > 12 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune(geohashAlphabet, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// eventLocation reads the coordinates in an event's details, like
+// siem.EventLocation, which this package cannot import
+func eventLocation(event *models.SecurityEvent) (float64, float64, bool) {
+	var raw struct {
+		Details map[string]interface{} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(event.RawData), &raw); err != nil || raw.Details == nil {
+		return 0, 0, false
+	}
+
+	if location, ok := raw.Details["location"].(string); ok {
+		return eventschema.ParseLocation(location)
+	}
+
+	lat, latOK := raw.Details["latitude"].(float64)
+	lon, lonOK := raw.Details["longitude"].(float64)
+	return lat, lon, latOK && lonOK
+}
+
+// eventAnomalyType reads the anomaly_type of a finding's details, "" for
+// events that are not anomaly findings
+func eventAnomalyType(event *models.SecurityEvent) string {
+	if !strings.Contains(event.RawData, `"anomaly_type"`) {
+		return ""
+	}
+	var raw struct {
+		Details struct {
+			AnomalyType string `json:"anomaly_type"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(event.RawData), &raw); err != nil {
+		return ""
+	}
+	return raw.Details.AnomalyType
+}
+
+// eventRouting returns the routing key of a located event's geohash, or ""
+// when geohash routing is off or the event has no location
+func (c *ESClient) eventRouting(geohash string) string {
+	if c.GeohashRoutingPrecision == 0 || geohash == "" {
+		return ""
+	}
+	return geohash[:c.GeohashRoutingPrecision]
+}
+
+// searchRouting returns the routing keys covering a search scoped to
+// geohash prefixes. A prefix shorter than the routing precision spans many
+// routing keys, so such searches go to every shard.
+func (c *ESClient) searchRouting(geohashes []string) string {
+	if c.GeohashRoutingPrecision == 0 || len(geohashes) == 0 {
+		return ""
+	}
+	keys := map[string]bool{}
+	for _, geohash := range geohashes {
+		if len(geohash) < c.GeohashRoutingPrecision {
+			return ""
+		}
+		keys[geohash[:c.GeohashRoutingPrecision]] = true
+	}
+	routing := make([]string, 0, len(keys))
+	for key := range keys {
+		routing = append(routing, key)
+	}
+	sort.Strings(routing)
+	return strings.Join(routing, ",")
+}
+
+// geohashFilter restricts query to events whose geohash starts with one of the prefixes
+func geohashFilter(query map[string]interface{}, geohashes []string) map[string]interface{} {
+	should := make([]interface{}, 0, len(geohashes))
+	for _, geohash := range geohashes {
+		should = append(should, map[string]interface{}{"prefix": map[string]interface{}{"geohash": geohash}})
+	}
+	filter := map[string]interface{}{
+		"bool": map[string]interface{}{"should": should, "minimum_should_match": 1},
+	}
+
+	must := []interface{}{}
+	if len(query) > 0 {
+		must = append(must, query)
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{"must": must, "filter": []interface{}{filter}},
+	}
+}
+
+// bulkAction is the action line of a bulk index operation
+func bulkAction(index string, id uint, routing string) []byte {
+	action := map[string]interface{}{"_index": index, "_id": strconv.FormatUint(uint64(id), 10)}
+	if routing != "" {
+		action["routing"] = routing
+	}
+	line, _ := json.Marshal(map[string]interface{}{"index": action})
+	return line
+}
+
+// documentURL is the URL of a document, with its routing when it has one
+func (c *ESClient) documentURL(index string, id uint, routing string) string {
+	url := fmt.Sprintf("%s/%s/_doc/%d", c.URL, index, id)
+	if routing != "" {
+		url += "?routing=" + routing
+	}
+	return url
+}
@@ -0,0 +1,358 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+)
+
+const (
+	// EventsWriteAlias is the rollover alias security events are indexed
+	// through when ILM is enabled; it points at the newest security-events-NNNNNN index
+	EventsWriteAlias = "security-events-write"
+
+	// eventsBootstrapIndex is the first index behind EventsWriteAlias
+	eventsBootstrapIndex = "security-events-000001"
+
+	// EventsILMPolicy rolls event indices over and ages them out
+	EventsILMPolicy = "security-events-policy"
+
+	// AlertsILMPolicy ages the daily alert indices out. Alerts are re-indexed
+	// under their ID when they change, so they stay in dated indices rather
+	// than behind a rollover alias, where an update could land in a newer index.
+	AlertsILMPolicy = "security-alerts-policy"
+)
+
+var (
+	ilmAgePattern  = regexp.MustCompile(`^([0-9]+)(d|h|m|s)$`)
+	ilmSizePattern = regexp.MustCompile(`^[0-9]+(b|kb|mb|gb|tb)$`)
+)
+
+// ILMPhases are the lifecycle phase durations of the SIEM indices, in
+// Elasticsearch time units (30d, 12h) and byte sizes (50gb)
+type ILMPhases struct {
+	RolloverMaxAge  string `json:"rollover_max_age"`  // hot: roll the event write index over at this age
+	RolloverMaxSize string `json:"rollover_max_size"` // or when a primary shard reaches this size
+	WarmAfter       string `json:"warm_after"`        // lower the priority, and force-merge event indices, after this age
+	DeleteAfter     string `json:"delete_after"`      // delete after this age
+}
+
+// defaultILMPhases keep a day of events per hot index, 7 days of them hot and 90 in total
+var defaultILMPhases = ILMPhases{RolloverMaxAge: "1d", RolloverMaxSize: "50gb", WarmAfter: "7d", DeleteAfter: "90d"}
+
+var (
+	ilmRolloverMaxAge  = config.NewString("ES_ILM_ROLLOVER_MAX_AGE", defaultILMPhases.RolloverMaxAge, "Age the event write index is rolled over at")
+	ilmRolloverMaxSize = config.NewString("ES_ILM_ROLLOVER_MAX_SIZE", defaultILMPhases.RolloverMaxSize, "Primary shard size the event write index is rolled over at")
+	ilmWarmAfter       = config.NewString("ES_ILM_WARM_AFTER", defaultILMPhases.WarmAfter, "Age indices move to the warm phase at")
+	ilmDeleteAfter     = config.NewString("ES_ILM_DELETE_AFTER", defaultILMPhases.DeleteAfter, "Age indices are deleted at")
+)
+
+// ILMPhasesFromEnv reads the phases from ES_ILM_ROLLOVER_MAX_AGE (default 1d),
+// ES_ILM_ROLLOVER_MAX_SIZE (default 50gb), ES_ILM_WARM_AFTER (default 7d) and
+// ES_ILM_DELETE_AFTER (default 90d)
+func ILMPhasesFromEnv() ILMPhases {
+	return ILMPhases{
+		RolloverMaxAge:  ilmRolloverMaxAge.Get(),
+		RolloverMaxSize: ilmRolloverMaxSize.Get(),
+		WarmAfter:       ilmWarmAfter.Get(),
+		DeleteAfter:     ilmDeleteAfter.Get(),
+	}
+}
+
+// Validate checks the units of the phases and that they are in order
+func (p ILMPhases) Validate() error {
+	maxAge, err := ilmAge(p.RolloverMaxAge)
+	if err != nil {
+		return fmt.Errorf("rollover_max_age: %v", err)
+	}
+	if !ilmSizePattern.MatchString(p.RolloverMaxSize) {
+		return fmt.Errorf("rollover_max_size: %q is not a size such as 50gb", p.RolloverMaxSize)
+	}
+	warm, err := ilmAge(p.WarmAfter)
+	if err != nil {
+		return fmt.Errorf("warm_after: %v", err)
+	}
+	del, err := ilmAge(p.DeleteAfter)
+	if err != nil {
+		return fmt.Errorf("delete_after: %v", err)
+	}
+	if maxAge <= 0 {
+		return fmt.Errorf("rollover_max_age must be greater than zero")
+	}
+	if del <= warm {
+		return fmt.Errorf("delete_after (%s) must be later than warm_after (%s)", p.DeleteAfter, p.WarmAfter)
+	}
+	return nil
+}
+
+// ilmAge parses an Elasticsearch time value such as 7d
+func ilmAge(value string) (time.Duration, error) {
+	match := ilmAgePattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("%q is not a time value such as 7d or 12h", value)
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, err
+	}
+	unit := map[string]time.Duration{"d": 24 * time.Hour, "h": time.Hour, "m": time.Minute, "s": time.Second}[match[2]]
+	return time.Duration(n) * unit, nil
+}
+
+// ilmPolicy is the body of an ILM policy with the phases. Only indices
+// written through an alias roll over and are force-merged when warm: the
+// force merge makes an index read-only, and alerts are updated in place.
+func ilmPolicy(phases ILMPhases, rollover bool) map[string]interface{} {
+	hot := map[string]interface{}{
+		"set_priority": map[string]interface{}{"priority": 100},
+	}
+	warm := map[string]interface{}{
+		"set_priority": map[string]interface{}{"priority": 50},
+	}
+	if rollover {
+		hot["rollover"] = map[string]interface{}{
+			"max_age":                phases.RolloverMaxAge,
+			"max_primary_shard_size": phases.RolloverMaxSize,
+		}
+		warm["forcemerge"] = map[string]interface{}{"max_num_segments": 1}
+	}
+
+	return map[string]interface{}{
+		"policy": map[string]interface{}{
+			"_meta": map[string]interface{}{"managed_by": "traffic-monitoring-go"},
+			"phases": map[string]interface{}{
+				"hot": map[string]interface{}{
+					"min_age": "0ms",
+					"actions": hot,
+				},
+				"warm": map[string]interface{}{
+					"min_age": phases.WarmAfter,
+					"actions": warm,
+				},
+				"delete": map[string]interface{}{
+					"min_age": phases.DeleteAfter,
+					"actions": map[string]interface{}{"delete": map[string]interface{}{}},
+				},
+			},
+		},
+	}
+}
+
+// putILMPolicies writes the event and alert policies with the phases
+func (c *ESClient) putILMPolicies(phases ILMPhases) error {
+	if _, err := c.doAdminRequest("PUT", "/_ilm/policy/"+EventsILMPolicy, ilmPolicy(phases, true)); err != nil {
+		return fmt.Errorf("failed to put %s: %v", EventsILMPolicy, err)
+	}
+	if _, err := c.doAdminRequest("PUT", "/_ilm/policy/"+AlertsILMPolicy, ilmPolicy(phases, false)); err != nil {
+		return fmt.Errorf("failed to put %s: %v", AlertsILMPolicy, err)
+	}
+	return nil
+}
+
+// ensureILM creates the policies that do not exist yet from c.ILMPhases, so
+// phases changed through the API survive restarts, and bootstraps the first
+// event index behind the write alias
+func (c *ESClient) ensureILM() error {
+	policies, err := c.getILMPhases()
+	if err != nil {
+		return err
+	}
+	if policies == nil {
+		if err := c.putILMPolicies(c.ILMPhases); err != nil {
+			return err
+		}
+	} else {
+		c.ILMPhases = *policies
+	}
+
+	resp, err := c.HTTPClient.Head(fmt.Sprintf("%s/_alias/%s", c.URL, EventsWriteAlias))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	_, err = c.doAdminRequest("PUT", "/"+eventsBootstrapIndex, map[string]interface{}{
+		"aliases": map[string]interface{}{
+			EventsWriteAlias: map[string]interface{}{"is_write_index": true},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to bootstrap %s: %v", eventsBootstrapIndex, err)
+	}
+	return nil
+}
+
+// getILMPhases reads the phases of the events policy, or nil when it does not exist
+func (c *ESClient) getILMPhases() (*ILMPhases, error) {
+	resp, err := c.HTTPClient.Get(fmt.Sprintf("%s/_ilm/policy/%s", c.URL, EventsILMPolicy))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("elasticsearch returned status %d reading %s", resp.StatusCode, EventsILMPolicy)
+	}
+
+	var body map[string]struct {
+		Policy struct {
+			Phases struct {
+				Hot struct {
+					Actions struct {
+						Rollover struct {
+							MaxAge              string `json:"max_age"`
+							MaxPrimaryShardSize string `json:"max_primary_shard_size"`
+						} `json:"rollover"`
+					} `json:"actions"`
+				} `json:"hot"`
+				Warm struct {
+					MinAge string `json:"min_age"`
+				} `json:"warm"`
+				Delete struct {
+					MinAge string `json:"min_age"`
+				} `json:"delete"`
+			} `json:"phases"`
+		} `json:"policy"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	phases := body[EventsILMPolicy].Policy.Phases
+	return &ILMPhases{
+		RolloverMaxAge:  phases.Hot.Actions.Rollover.MaxAge,
+		RolloverMaxSize: phases.Hot.Actions.Rollover.MaxPrimaryShardSize,
+		WarmAfter:       phases.Warm.MinAge,
+		DeleteAfter:     phases.Delete.MinAge,
+	}, nil
+}
+
+// eventIndex is the index a security event is written to: the rollover
+// alias with ILM, or the daily index without, named after the event's
+// organization when it has one (security-events-{org}-YYYY.MM.DD). Tenants
+// share the rollover alias, whose documents carry their organization_id.
+func (c *ESClient) eventIndex(organization string, timestamp time.Time) string {
+	if c.ILM {
+		return EventsWriteAlias
+	}
+	return dailyIndex("security-events", organization, timestamp)
+}
+
+// dailyIndex names the index of a family for a day, and for a tenant when organization is set
+func dailyIndex(family, organization string, timestamp time.Time) string {
+	if organization != "" {
+		family += "-" + organization
+	}
+	return fmt.Sprintf("%s-%s", family, timestamp.Format("2006.01.02"))
+}
+
+// lifecycleSettings are the template settings attaching indices to a policy
+func (c *ESClient) lifecycleSettings(policy string, rolloverAlias string) map[string]interface{} {
+	if !c.ILM {
+		return nil
+	}
+	settings := map[string]interface{}{"index.lifecycle.name": policy}
+	if rolloverAlias != "" {
+		settings["index.lifecycle.rollover_alias"] = rolloverAlias
+	}
+	return settings
+}
+
+// ILMStatus is the lifecycle configuration of the SIEM indices
+type ILMStatus struct {
+	Enabled    bool                   `json:"enabled"`
+	WriteAlias string                 `json:"write_alias,omitempty"`
+	Policies   []string               `json:"policies,omitempty"`
+	Phases     *ILMPhases             `json:"phases,omitempty"`
+	Indices    map[string]interface{} `json:"indices,omitempty"` // _ilm/explain of the event indices
+}
+
+// ILMStatus reports the phases and the lifecycle step of each event index
+func (s *Service) ILMStatus() (ILMStatus, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if !s.isInitialized() {
+		return ILMStatus{}, fmt.Errorf("elasticsearch service not initialized")
+	}
+	if !s.Client.ILM {
+		return ILMStatus{}, nil
+	}
+
+	body, err := s.Client.doAdminRequest("GET", "/security-events-*/_ilm/explain?only_managed=true", nil)
+	if err != nil {
+		return ILMStatus{}, err
+	}
+	var explain struct {
+		Indices map[string]interface{} `json:"indices"`
+	}
+	if err := json.Unmarshal(body, &explain); err != nil {
+		return ILMStatus{}, err
+	}
+
+	phases := s.Client.ILMPhases
+	return ILMStatus{
+		Enabled:    true,
+		WriteAlias: EventsWriteAlias,
+		Policies:   []string{EventsILMPolicy, AlertsILMPolicy},
+		Phases:     &phases,
+		Indices:    explain.Indices,
+	}, nil
+}
+
+// UpdateILMPhases rewrites both policies with new phases; indices already
+// in a phase pick up the change when they enter the next one
+func (s *Service) UpdateILMPhases(phases ILMPhases) error {
+	if err := phases.Validate(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.isInitialized() {
+		return fmt.Errorf("elasticsearch service not initialized")
+	}
+	if !s.Client.ILM {
+		return fmt.Errorf("index lifecycle management is disabled (ES_ILM_ENABLED=false)")
+	}
+	if err := s.Client.putILMPolicies(phases); err != nil {
+		return err
+	}
+	s.Client.ILMPhases = phases
+	return nil
+}
+
+// timeRangeFilter narrows a query to the events of a day-relative range,
+// for searches that cannot pick dated indices
+func timeRangeFilter(query map[string]interface{}, timeRange string) map[string]interface{} {
+	var timestamp map[string]interface{}
+	switch timeRange {
+	case "today":
+		timestamp = map[string]interface{}{"gte": "now/d"}
+	case "yesterday":
+		timestamp = map[string]interface{}{"gte": "now-1d/d", "lt": "now/d"}
+	default:
+		return query
+	}
+
+	must := []interface{}{}
+	if len(query) > 0 {
+		must = append(must, query)
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must":   must,
+			"filter": []interface{}{map[string]interface{}{"range": map[string]interface{}{"timestamp": timestamp}}},
+		},
+	}
+}
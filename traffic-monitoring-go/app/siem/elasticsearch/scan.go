@@ -0,0 +1,86 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"traffic-monitoring-go/app/models"
+)
+
+// ScanSecurityEvents returns up to size indexed security events with timestamps in
+// [start, end) and IDs above afterID, ordered by ID. Passing the last ID back as
+// afterID pages through the whole range with search_after.
+func (c *ESClient) ScanSecurityEvents(start, end time.Time, afterID uint, size int) ([]models.SecurityEvent, error) {
+	query := map[string]interface{}{
+		"size": size,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{
+						"range": map[string]interface{}{
+							"timestamp": map[string]interface{}{
+								"gte": start.Format(time.RFC3339Nano),
+								"lt":  end.Format(time.RFC3339Nano),
+							},
+						},
+					},
+				},
+			},
+		},
+		"sort":         []interface{}{map[string]interface{}{"id": "asc"}},
+		"search_after": []interface{}{afterID},
+	}
+
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Post(
+		fmt.Sprintf("%s/security-events-*/_search?ignore_unavailable=true", c.URL),
+		"application/json",
+		bytes.NewBuffer(queryJSON),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to scan security events: %s", string(body))
+	}
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source models.SecurityEvent `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	events := make([]models.SecurityEvent, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		events = append(events, hit.Source)
+	}
+	return events, nil
+}
+
+// ScanSecurityEvents pages through indexed security events, see ESClient.ScanSecurityEvents
+func (s *Service) ScanSecurityEvents(start, end time.Time, afterID uint, size int) ([]models.SecurityEvent, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if !s.isInitialized() {
+		return nil, fmt.Errorf("elasticsearch service not initialized")
+	}
+
+	return s.Client.ScanSecurityEvents(start, end, afterID, size)
+}
@@ -2,57 +2,54 @@ package elasticsearch
 
 import (
 	"fmt"
-	"log"
 	"sync"
-	"time"
+	"sync/atomic"
 	"io"
 	"encoding/json"
 	"net/http"
 	"bytes"
+	"time"
 
 
 
+	"traffic-monitoring-go/app/logging"
 	"traffic-monitoring-go/app/models"
 )
 
 // Service is a service for interacting with Elasticsearch
 type Service struct {
 	Client      *ESClient
-	initialized bool
+	Log         *logging.Logger
+	// OrganizationSlug names the tenant of events and alerts in their index
+	// names; when nil, every document is indexed as belonging to no tenant
+	OrganizationSlug func(id uint) string
+	initialized atomic.Bool  // set by Initialize, read without taking a lock
+	initMutex   sync.Mutex   // one Initialize at a time, held while it calls Elasticsearch
 	mutex       sync.RWMutex
+	spill       *spillBuffer // set by StartSpill
+	bulk        *bulkWriter  // set by StartBulk
 }
 
 // NewService creates a new Elasticsearch Service
 func NewService() *Service {
 	return &Service{
 		Client:      NewESClient(),
-		initialized: false,
+		Log:         logging.New("elasticsearch"),
 	}
 }
 
 // Initialize initializes the Elasticsearch service
 func (s *Service) Initialize() error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	s.initMutex.Lock()
+	defer s.initMutex.Unlock()
 
-	if s.initialized {
+	if s.isInitialized() {
 		return nil
 	}
 
-	// Test connection to Elasticsearch
-	const maxRetries = 5
-	for i := 0; i < maxRetries; i++ {
-		err := s.Client.CheckConnection()
-		if err == nil {
-			break
-		}
-
-		if i == maxRetries-1 {
-			return fmt.Errorf("failed to connect to Elasticsearch after %d retries: %v", maxRetries, err)
-		}
-
-		log.Printf("Failed to connect to Elasticsearch, retrying in 10 seconds... (%d/%d)", i+1, maxRetries)
-		time.Sleep(10 * time.Second)
+	// Test connection to Elasticsearch; callers retry (see startup.Await)
+	if err := s.Client.CheckConnection(); err != nil {
+		return fmt.Errorf("failed to connect to Elasticsearch: %v", err)
 	}
 
 	// Create index templates for events and alerts
@@ -60,11 +57,24 @@ func (s *Service) Initialize() error {
         return fmt.Errorf("failed to create index templates: %v", err)
     }
 
-	s.initialized = true
-	log.Println("Elasticsearch service initialized successfully")
+	// create the lifecycle policies and the first index behind the event write alias
+	if s.Client.ILM {
+		if err := s.Client.ensureILM(); err != nil {
+			return fmt.Errorf("failed to set up index lifecycle management: %v", err)
+		}
+	}
+
+	s.initialized.Store(true)
+	s.Log.Info("Elasticsearch service initialized", "url", s.Client.URL, "ilm", s.Client.ILM)
 	return nil
 }
 
+// isInitialized tells whether Initialize has succeeded. It may be called from
+// any goroutine, as Initialize runs in the background while requests arrive.
+func (s *Service) isInitialized() bool {
+	return s.initialized.Load()
+}
+
 
 // createIndexTemplates creates index templates for security events and alerts
 func (s *Service) createIndexTemplates() error {
@@ -73,7 +83,7 @@ func (s *Service) createIndexTemplates() error {
         "index_patterns": []string{"security-events-*"},
         "template": map[string]interface{}{
             "settings": map[string]interface{}{
-                "number_of_shards": 1,
+                "number_of_shards": s.Client.EventShards,
                 "number_of_replicas": 0,
             },
             "mappings": map[string]interface{}{
@@ -122,6 +132,24 @@ func (s *Service) createIndexTemplates() error {
                     "log_source_id": map[string]interface{}{
                         "type": "integer",
                     },
+                    "trust_score": map[string]interface{}{
+                        "type": "float",
+                    },
+                    "geohash": map[string]interface{}{
+                        "type": "keyword",
+                    },
+                    "location": map[string]interface{}{
+                        "type": "geo_point",
+                    },
+                    "anomaly_type": map[string]interface{}{
+                        "type": "keyword",
+                    },
+                    "organization_id": map[string]interface{}{
+                        "type": "integer",
+                    },
+                    "correlation_id": map[string]interface{}{
+                        "type": "keyword",
+                    },
                     "created_at": map[string]interface{}{
                         "type": "date",
                     },
@@ -158,9 +186,21 @@ func (s *Service) createIndexTemplates() error {
                     "status": map[string]interface{}{
                         "type": "keyword",
                     },
+                    "techniques": map[string]interface{}{
+                        "type": "keyword",
+                    },
+                    "v2x_threats": map[string]interface{}{
+                        "type": "keyword",
+                    },
                     "assigned_to": map[string]interface{}{
                         "type": "integer",
                     },
+                    "organization_id": map[string]interface{}{
+                        "type": "integer",
+                    },
+                    "correlation_id": map[string]interface{}{
+                        "type": "keyword",
+                    },
                     "resolution": map[string]interface{}{
                         "type": "text",
                     },
@@ -175,6 +215,16 @@ func (s *Service) createIndexTemplates() error {
         },
     }
 
+    // attach new indices to their lifecycle policies
+    eventSettings := eventsTemplate["template"].(map[string]interface{})["settings"].(map[string]interface{})
+    for key, value := range s.Client.lifecycleSettings(EventsILMPolicy, EventsWriteAlias) {
+        eventSettings[key] = value
+    }
+    alertSettings := alertsTemplate["template"].(map[string]interface{})["settings"].(map[string]interface{})
+    for key, value := range s.Client.lifecycleSettings(AlertsILMPolicy, "") {
+        alertSettings[key] = value
+    }
+
     // Put the templates to Elasticsearch
     eventsJSON, err := json.Marshal(eventsTemplate)
     if err != nil {
@@ -228,22 +278,45 @@ func (s *Service) createIndexTemplates() error {
 
 // IndexSecurityEvent indexes a security event in Elasticsearch
 func (s *Service) IndexSecurityEvent(event *models.SecurityEvent) error {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	// the rollover alias with ILM, otherwise a time-based index name
+	indexName := s.Client.eventIndex(s.organization(event.OrganizationID), event.Timestamp)
+
+	eventMap, geohash := EventDocument(event)
+
+	// located (V2X) events are routed to a shard by their geohash when
+	// geohash routing is enabled
+	routing := ""
+	if geohash != "" {
+		routing = s.Client.eventRouting(geohash)
+	}
+
+	// convert to JSON
+	eventJSON, err := json.Marshal(eventMap)
+	if err != nil {
+		return err
+	}
 
-	if !s.initialized {
-		return fmt.Errorf("elasticsearch service not initialized")
+	// index document, spilling it to disk while Elasticsearch is unavailable
+	if err := s.index(indexName, event.ID, routing, eventJSON); err != nil {
+		return fmt.Errorf("failed to index security event: %v", err)
 	}
 
-	// create a time-based index name in the format "security-events-YYYY.MM.DD"
-	indexDate := event.Timestamp.Format("2020.01.02")
-	indexName := fmt.Sprintf("security-events-%s", indexDate)
+	return nil
+
 
-	// ensure index exists
-	if err := s.Client.createIndexIfNotExists(indexName); err != nil {
-		return fmt.Errorf("failed to create index: %v", err)
+}
+
+// organization returns the slug naming an organization's indices, "" for none
+func (s *Service) organization(id *uint) string {
+	if id == nil || s.OrganizationSlug == nil {
+		return ""
 	}
+	return s.OrganizationSlug(*id)
+}
 
+// EventDocument is the document a security event is indexed as, and the
+// geohash of its location ("" for events without one)
+func EventDocument(event *models.SecurityEvent) (map[string]interface{}, string) {
 	// create a copy of the event with proper handling of empty fields
 	eventMap := map[string]interface{}{
 		"id":			event.ID,
@@ -286,55 +359,37 @@ func (s *Service) IndexSecurityEvent(event *models.SecurityEvent) error {
 	if event.UserID != nil {
 		eventMap["user_id"] = *event.UserID
 	}
-
-	// convert to JSON
-	eventJSON, err := json.Marshal(eventMap)
-	if err != nil {
-		return err
+	if event.TrustScore != nil {
+		eventMap["trust_score"] = *event.TrustScore
 	}
-
-	// index document
-	url := fmt.Sprintf("%s/%s/_doc/%d", s.Client.URL, indexName, event.ID)
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(eventJSON))
-	if err != nil {
-		return err
+	if event.OrganizationID != nil {
+		eventMap["organization_id"] = *event.OrganizationID
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := s.Client.HTTPClient.Do(req)
-	if err != nil {
-		return err
+	if event.CorrelationID != "" {
+		eventMap["correlation_id"] = event.CorrelationID
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to index security event: %s", string(body))
+	// located (V2X) events carry their geohash
+	geohash := ""
+	if lat, lon, ok := eventLocation(event); ok {
+		geohash = GeohashEncode(lat, lon, indexedGeohashPrecision)
+		eventMap["geohash"] = geohash
+		eventMap["location"] = map[string]float64{"lat": lat, "lon": lon}
 	}
 
-	return nil
-
+	// findings of the anomaly detectors carry their type, for density maps
+	if anomalyType := eventAnomalyType(event); anomalyType != "" {
+		eventMap["anomaly_type"] = anomalyType
+	}
 
+	return eventMap, geohash
 }
 
 // IndexAlert indexes an alert in Elasticsearch
 func (s *Service) IndexAlert(alert *models.Alert) error {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	if !s.initialized {
-		return fmt.Errorf("elasticsearch service not initialized")
-	}
-
-	
-	// Create a time-based index name in the format "security-alerts-YYYY.MM.DD"
-    indexDate := alert.Timestamp.Format("2006.01.02")
-    indexName := fmt.Sprintf("security-alerts-%s", indexDate)
-
-    // Ensure the index exists
-    if err := s.Client.createIndexIfNotExists(indexName); err != nil {
-        return fmt.Errorf("failed to create index: %v", err)
-    }
+	// Create a time-based index name in the format "security-alerts-YYYY.MM.DD",
+	// or "security-alerts-{org}-YYYY.MM.DD" for the alerts of a tenant
+    indexName := dailyIndex("security-alerts", s.organization(alert.OrganizationID), alert.Timestamp)
 
     // Convert alert to map for indexing
     alertMap := map[string]interface{}{
@@ -355,30 +410,28 @@ func (s *Service) IndexAlert(alert *models.Alert) error {
     if alert.Resolution != "" {
         alertMap["resolution"] = alert.Resolution
     }
-
-    // Convert to JSON
-    alertJSON, err := json.Marshal(alertMap)
-    if err != nil {
-        return err
+    if len(alert.Techniques) > 0 {
+        alertMap["techniques"] = alert.Techniques
     }
-
-    // Index document
-    url := fmt.Sprintf("%s/%s/_doc/%d", s.Client.URL, indexName, alert.ID)
-    req, err := http.NewRequest("PUT", url, bytes.NewBuffer(alertJSON))
-    if err != nil {
-        return err
+    if len(alert.V2XThreats) > 0 {
+        alertMap["v2x_threats"] = alert.V2XThreats
+    }
+    if alert.OrganizationID != nil {
+        alertMap["organization_id"] = *alert.OrganizationID
+    }
+    if alert.CorrelationID != "" {
+        alertMap["correlation_id"] = alert.CorrelationID
     }
-    req.Header.Set("Content-Type", "application/json")
 
-    resp, err := s.Client.HTTPClient.Do(req)
+    // Convert to JSON
+    alertJSON, err := json.Marshal(alertMap)
     if err != nil {
         return err
     }
-    defer resp.Body.Close()
 
-    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-        body, _ := io.ReadAll(resp.Body)
-        return fmt.Errorf("failed to index alert: %s", string(body))
+    // Index document, spilling it to disk while Elasticsearch is unavailable
+    if err := s.index(indexName, alert.ID, "", alertJSON); err != nil {
+        return fmt.Errorf("failed to index alert: %v", err)
     }
 
     return nil
@@ -391,7 +444,7 @@ func (s *Service) SearchSecurityEvents(query map[string]interface{}, page, pageS
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	if !s.initialized {
+	if !s.isInitialized() {
 		return nil, 0, fmt.Errorf("elasticsearch service not initialized")
 	}
 
@@ -399,14 +452,40 @@ func (s *Service) SearchSecurityEvents(query map[string]interface{}, page, pageS
 	return s.Client.SearchSecurityEvents(query, from, pageSize, "last_30_days")
 }
 
+// SearchSecurityEventsWithOptions searches for security events, returning
+// highlights and facet counts along with the hits when asked to
+func (s *Service) SearchSecurityEventsWithOptions(query map[string]interface{}, page, pageSize int, opts SearchOptions) (*SearchResult, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if !s.isInitialized() {
+		return nil, fmt.Errorf("elasticsearch service not initialized")
+	}
+
+	from := (page - 1) * pageSize
+	return s.Client.SearchSecurityEventsWithOptions(query, from, pageSize, "last_30_days", opts)
+}
+
 // GetDashboardStats gets dashboard statistics from Elasticsearch
 func (s *Service) GetDashboardStats(timeRange string) (map[string]interface{}, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	if !s.initialized {
+	if !s.isInitialized() {
 		return nil, fmt.Errorf("elasticsearch service not initialized")
 	}
 
 	return s.Client.GetEventDashboardStats(timeRange)
 }
+
+// GeoDensity counts located events by geohash cell (see ESClient.GeoDensity)
+func (s *Service) GeoDensity(box BoundingBox, from, to time.Time, precision, size int) ([]DensityCell, int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if !s.isInitialized() {
+		return nil, 0, fmt.Errorf("elasticsearch service not initialized")
+	}
+
+	return s.Client.GeoDensity(box, from, to, precision, size)
+}
@@ -0,0 +1,351 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/siem/forwarder"
+)
+
+var (
+	spillMaxMB = config.NewInt("ES_SPILL_MAX_MB", 512,
+		"Megabytes of index operations spilled to disk while Elasticsearch is unreachable; 0 disables spilling", config.Min(0))
+	spillDir           = config.NewString("ES_SPILL_DIR", "data/es-spill", "Directory of the Elasticsearch spill buffer")
+	spillReplaySeconds = config.NewInt("ES_SPILL_REPLAY_SECONDS", 10, "Seconds between attempts to replay the spill buffer", config.Min(1))
+)
+
+// spillReplayBatch is the number of spilled documents sent per bulk request
+const spillReplayBatch = 500
+
+// statusError is an error response from Elasticsearch
+type statusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("elasticsearch returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// isTransient reports whether an index operation may succeed later: the cluster
+// was unreachable, overloaded or failing, rather than rejecting the document
+func isTransient(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusTooManyRequests || status.StatusCode >= 500
+	}
+	return true
+}
+
+// spillRecord is one index operation waiting in the spill buffer
+type spillRecord struct {
+	Index   string          `json:"index"`
+	ID      uint            `json:"id"`
+	Routing string          `json:"routing,omitempty"`
+	Doc     json.RawMessage `json:"doc"`
+}
+
+// spillBuffer holds index operations on disk while Elasticsearch is unreachable
+type spillBuffer struct {
+	queue    *forwarder.DiskQueue
+	interval time.Duration
+
+	mutex        sync.Mutex
+	spilled      uint64
+	replayed     uint64
+	rejected     uint64
+	lastSpillAt  time.Time
+	lastReplayAt time.Time
+	lastError    string
+}
+
+// SpillStats describes the spill buffer and replay progress
+type SpillStats struct {
+	Enabled      bool                  `json:"enabled"`
+	Spilled      uint64                `json:"spilled"`
+	Replayed     uint64                `json:"replayed"`
+	Rejected     uint64                `json:"rejected"` // documents Elasticsearch refused on replay
+	LastSpillAt  *time.Time            `json:"last_spill_at,omitempty"`
+	LastReplayAt *time.Time            `json:"last_replay_at,omitempty"`
+	LastError    string                `json:"last_error,omitempty"`
+	Queue        *forwarder.QueueStats `json:"queue,omitempty"`
+}
+
+// StartSpill enables the on-disk spill buffer: index operations that fail
+// because Elasticsearch is unreachable are queued in ES_SPILL_DIR (default
+// data/es-spill, bounded by ES_SPILL_MAX_MB, default 512, 0 disables) and
+// replayed every ES_SPILL_REPLAY_SECONDS (default 10) once it is back
+func (s *Service) StartSpill() error {
+	maxMB := spillMaxMB.Get()
+	if maxMB == 0 {
+		return nil
+	}
+
+	queue, err := forwarder.OpenDiskQueue(spillDir.Get(), int64(maxMB)<<20)
+	if err != nil {
+		return fmt.Errorf("failed to open spill buffer: %v", err)
+	}
+
+	spill := &spillBuffer{queue: queue, interval: time.Duration(spillReplaySeconds.Get()) * time.Second}
+	s.mutex.Lock()
+	s.spill = spill
+	s.mutex.Unlock()
+
+	go s.replayLoop(spill)
+
+	if pending := queue.Stats().PendingBytes; pending > 0 {
+		s.Log.Info("spill buffer has documents pending replay", "bytes", pending)
+	}
+	return nil
+}
+
+// pending reports whether spilled operations are waiting for replay.
+// New operations queue behind them so documents are applied in order.
+func (b *spillBuffer) pending() bool {
+	return b.queue.Stats().PendingBytes > 0
+}
+
+func (b *spillBuffer) add(index string, id uint, routing string, doc []byte) error {
+	record, err := json.Marshal(spillRecord{Index: index, ID: id, Routing: routing, Doc: doc})
+	if err != nil {
+		return err
+	}
+	if err := b.queue.Append(record); err != nil {
+		return fmt.Errorf("failed to spill document to disk: %v", err)
+	}
+
+	b.mutex.Lock()
+	b.spilled++
+	b.lastSpillAt = time.Now()
+	b.mutex.Unlock()
+	return nil
+}
+
+// index writes a document through the bulk buffer when enabled, spilling it to
+// disk when Elasticsearch is unavailable. A non-empty routing places the
+// document on the shard of that routing key.
+func (s *Service) index(indexName string, id uint, routing string, doc []byte) error {
+	spill, bulk, initialized := s.spillBuffer(), s.bulkWriter(), s.isInitialized()
+	if spill != nil && (!initialized || spill.pending()) {
+		return spill.add(indexName, id, routing, doc)
+	}
+	if !initialized {
+		return fmt.Errorf("elasticsearch service not initialized")
+	}
+
+	if bulk != nil {
+		err := bulk.add(indexName, id, routing, doc)
+		if err != nil && spill != nil {
+			return spill.add(indexName, id, routing, doc)
+		}
+		return err
+	}
+
+	started := time.Now()
+	err := s.Client.putDocument(indexName, id, routing, doc)
+	indexSeconds.Observe(time.Since(started).Seconds(), "single")
+	if err != nil {
+		indexErrors.Inc("single")
+	}
+	if err != nil && spill != nil && isTransient(err) {
+		return spill.add(indexName, id, routing, doc)
+	}
+	return err
+}
+
+// putDocument indexes a document under its ID, creating the index first if needed
+func (c *ESClient) putDocument(indexName string, id uint, routing string, doc []byte) error {
+	if err := c.createIndexIfNotExists(indexName); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	req, err := http.NewRequest("PUT", c.documentURL(indexName, id, routing), bytes.NewBuffer(doc))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return &statusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return nil
+}
+
+// replayLoop drains the spill buffer whenever Elasticsearch is reachable
+func (s *Service) replayLoop(spill *spillBuffer) {
+	ticker := time.NewTicker(spill.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !spill.pending() {
+			continue
+		}
+		if err := s.ensureInitialized(); err != nil {
+			spill.recordError(err)
+			continue
+		}
+
+		for spill.pending() {
+			replayed, err := s.replayBatch(spill)
+			if err != nil {
+				spill.recordError(err)
+				s.Log.Error("failed to replay spilled documents", "error", err)
+				break
+			}
+			s.Log.Info("spilled documents replayed", "documents", replayed)
+		}
+	}
+}
+
+// ensureInitialized completes initialization that failed while Elasticsearch was down
+func (s *Service) ensureInitialized() error {
+	if s.isInitialized() {
+		return nil
+	}
+
+	if err := s.Client.CheckConnection(); err != nil {
+		return err
+	}
+	return s.Initialize()
+}
+
+// replayBatch sends the oldest spilled documents with one bulk request
+func (s *Service) replayBatch(spill *spillBuffer) (int, error) {
+	batch, err := spill.queue.Peek(spillReplayBatch)
+	if err != nil || len(batch.Records) == 0 {
+		return 0, err
+	}
+
+	var body bytes.Buffer
+	for _, line := range batch.Records {
+		var record spillRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			continue
+		}
+		body.Write(bulkAction(record.Index, record.ID, record.Routing))
+		body.WriteByte('\n')
+		body.Write(record.Doc)
+		body.WriteByte('\n')
+	}
+
+	rejected := 0
+	if body.Len() > 0 {
+		if rejected, err = s.Client.bulk(&body); err != nil {
+			return 0, err
+		}
+	}
+	if err := spill.queue.Commit(batch.End); err != nil {
+		return 0, err
+	}
+
+	spill.mutex.Lock()
+	spill.replayed += uint64(len(batch.Records) - rejected)
+	spill.rejected += uint64(rejected)
+	spill.lastReplayAt = time.Now()
+	spill.mutex.Unlock()
+	return len(batch.Records), nil
+}
+
+// bulk sends a bulk request and returns the number of documents rejected for
+// good. Any transient item failure fails the whole request so it is retried;
+// replaying a document under its ID is idempotent.
+func (c *ESClient) bulk(body io.Reader) (int, error) {
+	req, err := http.NewRequest("POST", c.URL+"/_bulk", body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, &statusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return 0, err
+	}
+	if !result.Errors {
+		return 0, nil
+	}
+
+	rejected := 0
+	for _, item := range result.Items {
+		for _, op := range item {
+			if op.Status == http.StatusTooManyRequests || op.Status >= 500 {
+				return 0, &statusError{StatusCode: op.Status, Body: string(op.Error)}
+			}
+			if op.Status >= 300 {
+				rejected++
+			}
+		}
+	}
+	return rejected, nil
+}
+
+func (b *spillBuffer) recordError(err error) {
+	b.mutex.Lock()
+	b.lastError = err.Error()
+	b.mutex.Unlock()
+}
+
+// SpillStats returns the spill buffer size and replay progress
+func (s *Service) SpillStats() SpillStats {
+	s.mutex.RLock()
+	spill := s.spill
+	s.mutex.RUnlock()
+	if spill == nil {
+		return SpillStats{}
+	}
+
+	spill.mutex.Lock()
+	stats := SpillStats{
+		Enabled:   true,
+		Spilled:   spill.spilled,
+		Replayed:  spill.replayed,
+		Rejected:  spill.rejected,
+		LastError: spill.lastError,
+	}
+	if !spill.lastSpillAt.IsZero() {
+		lastSpill := spill.lastSpillAt
+		stats.LastSpillAt = &lastSpill
+	}
+	if !spill.lastReplayAt.IsZero() {
+		lastReplay := spill.lastReplayAt
+		stats.LastReplayAt = &lastReplay
+	}
+	spill.mutex.Unlock()
+
+	queue := spill.queue.Stats()
+	stats.Queue = &queue
+	return stats
+}
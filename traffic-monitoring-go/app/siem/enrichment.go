@@ -0,0 +1,150 @@
+package siem
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+)
+
+// roadSearchRadius bounds how far from an alert a road segment may be to be reported,
+// configured with ENRICH_ROAD_RADIUS_M
+var roadSearchRadius = config.NewFloat("ENRICH_ROAD_RADIUS_M", 500, "Meters from an alert a road segment may be to be reported",
+	config.Positive, config.Reloadable)
+
+// EventLocation returns the coordinates recorded in an event's details, either as
+// a "lat,lon" location string or as separate latitude/longitude numbers
+func EventLocation(event *models.SecurityEvent) (float64, float64, bool) {
+	var raw struct {
+		Details map[string]interface{} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(event.RawData), &raw); err != nil || raw.Details == nil {
+		return 0, 0, false
+	}
+
+	if location, ok := raw.Details["location"].(string); ok {
+		return ParseLocation(location)
+	}
+
+	lat, latOK := raw.Details["latitude"].(float64)
+	lon, lonOK := raw.Details["longitude"].(float64)
+	return lat, lon, latOK && lonOK
+}
+
+// EnrichAlert sets the coordinates, nearest RSU and nearest road of an alert
+// from its event. Lookup failures are logged and leave the alert unenriched.
+func EnrichAlert(db *gorm.DB, alert *models.Alert, event *models.SecurityEvent) {
+	lat, lon, ok := EventLocation(event)
+	if !ok {
+		return
+	}
+	alert.Latitude = &lat
+	alert.Longitude = &lon
+
+	if rsu, distance, err := NearestRSU(db, lat, lon); err != nil {
+		log.Printf("Error looking up nearest RSU for alert: %v", err)
+	} else if rsu != nil {
+		alert.NearestRSU = rsu.Code
+		alert.RSUDistanceM = &distance
+	}
+
+	if segment, distance, err := NearestRoad(db, lat, lon, roadSearchRadius.Get()); err != nil {
+		log.Printf("Error looking up nearest road for alert: %v", err)
+	} else if segment != nil {
+		alert.RoadName = segment.Name
+		if alert.RoadName == "" {
+			alert.RoadName = segment.Ref
+		}
+		alert.RoadSegment = segment.SegmentID
+		alert.RoadDistanceM = &distance
+	}
+}
+
+// NearestRSU returns the registered RSU closest to a coordinate and its distance in meters
+func NearestRSU(db *gorm.DB, lat, lon float64) (*models.RSU, float64, error) {
+	var rsus []models.RSU
+	if err := db.Find(&rsus).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var nearest *models.RSU
+	best := math.Inf(1)
+	for i := range rsus {
+		distance := DistanceMeters(lat, lon, rsus[i].Latitude, rsus[i].Longitude)
+		if distance < best {
+			best = distance
+			nearest = &rsus[i]
+		}
+	}
+
+	return nearest, best, nil
+}
+
+// NearestRoad returns the road segment closest to a coordinate within radius meters
+func NearestRoad(db *gorm.DB, lat, lon, radius float64) (*models.RoadSegment, float64, error) {
+	// degrees of latitude/longitude covering the radius, for the bounding box prefilter
+	dLat := radius / 111320
+	dLon := radius / (111320 * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+
+	var segments []models.RoadSegment
+	err := db.Where("min_lat <= ? AND max_lat >= ? AND min_lon <= ? AND max_lon >= ?",
+		lat+dLat, lat-dLat, lon+dLon, lon-dLon).
+		Find(&segments).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var nearest *models.RoadSegment
+	best := math.Inf(1)
+	for i := range segments {
+		distance := distanceToPolyline(lat, lon, segments[i].Geometry)
+		if distance < best {
+			best = distance
+			nearest = &segments[i]
+		}
+	}
+
+	if nearest == nil || best > radius {
+		return nil, 0, nil
+	}
+	return nearest, best, nil
+}
+
+// distanceToPolyline returns the distance in meters from a point to the closest
+// part of a polyline, using a local equirectangular projection
+func distanceToPolyline(lat, lon float64, line []models.GeoPoint) float64 {
+	if len(line) == 0 {
+		return math.Inf(1)
+	}
+	if len(line) == 1 {
+		return DistanceMeters(lat, lon, line[0].Lat, line[0].Lon)
+	}
+
+	const metersPerDegree = 111320.0
+	cosLat := math.Cos(lat * math.Pi / 180)
+	project := func(p models.GeoPoint) (float64, float64) {
+		return (p.Lon - lon) * metersPerDegree * cosLat, (p.Lat - lat) * metersPerDegree
+	}
+
+	best := math.Inf(1)
+	for i := 0; i < len(line)-1; i++ {
+		ax, ay := project(line[i])
+		bx, by := project(line[i+1])
+
+		// closest point on segment AB to the origin (the alert position)
+		dx, dy := bx-ax, by-ay
+		t := 0.0
+		if lengthSq := dx*dx + dy*dy; lengthSq > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lengthSq))
+		}
+		px, py := ax+t*dx, ay+t*dy
+
+		if distance := math.Hypot(px, py); distance < best {
+			best = distance
+		}
+	}
+	return best
+}
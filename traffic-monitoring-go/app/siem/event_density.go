@@ -0,0 +1,153 @@
+package siem
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/elasticsearch"
+)
+
+const (
+	// MaxDensityWindow bounds the time range of a density map
+	MaxDensityWindow = 7 * 24 * time.Hour
+
+	// maxDensityCells bounds the cells of a density map, and picks the
+	// precision of maps that do not ask for one
+	maxDensityCells = 2048
+)
+
+// EventDensity asks for the density of located events in a map area
+type EventDensity struct {
+	Box       elasticsearch.BoundingBox
+	From      time.Time
+	To        time.Time
+	Precision int // geohash length of the cells, 0 for the finest with at most 2048 cells in the box
+}
+
+// EventDensityResult is the message and anomaly density of a map area by
+// geohash cell, most populated cells first
+type EventDensityResult struct {
+	Box            elasticsearch.BoundingBox   `json:"box"`
+	From           time.Time                   `json:"from"`
+	To             time.Time                   `json:"to"`
+	Precision      int                         `json:"precision"`
+	Cells          []elasticsearch.DensityCell `json:"cells"`
+	Messages       int                         `json:"messages"`  // in the cells returned
+	Anomalies      int                         `json:"anomalies"` // in the cells returned
+	Truncated      bool                        `json:"truncated"` // whether less populated cells were left out
+	Backend        string                      `json:"backend"`
+	FallbackReason string                      `json:"fallback_reason,omitempty"` // why Elasticsearch could not serve the map
+}
+
+// Density counts the located events of a map area by geohash cell, from the
+// geo aggregations of Elasticsearch, or from the database while Elasticsearch
+// cannot serve them
+func (s *EventSearcher) Density(density EventDensity) (*EventDensityResult, error) {
+	if err := density.Box.Validate(); err != nil {
+		return nil, err
+	}
+	if !density.To.After(density.From) {
+		return nil, errors.New("to must be after from")
+	}
+	if density.To.Sub(density.From) > MaxDensityWindow {
+		return nil, errors.New("the time range may span at most 7 days")
+	}
+	if density.Precision == 0 {
+		density.Precision = elasticsearch.DensityPrecision(density.Box, maxDensityCells)
+	}
+	if !elasticsearch.ValidDensityPrecision(density.Precision) {
+		return nil, errors.New("precision must be between 1 and 9")
+	}
+
+	result := &EventDensityResult{
+		Box:       density.Box,
+		From:      density.From,
+		To:        density.To,
+		Precision: density.Precision,
+	}
+
+	esErr := errors.New("elasticsearch is not configured")
+	if s.ES != nil {
+		cells, total, err := s.ES.GeoDensity(density.Box, density.From, density.To, density.Precision, maxDensityCells)
+		if err == nil {
+			eventSearches.Inc(SearchBackendElasticsearch)
+			result.Cells, result.Backend = cells, SearchBackendElasticsearch
+			result.count()
+			result.Truncated = result.Messages+result.Anomalies < total
+			return result, nil
+		}
+		esErr = err
+	}
+
+	if err := s.densityFromDatabase(density, result); err != nil {
+		return nil, err
+	}
+	result.Backend, result.FallbackReason = SearchBackendPostgres, esErr.Error()
+	eventSearches.Inc(SearchBackendPostgres)
+	return result, nil
+}
+
+// densityFromDatabase reads the locations of the V2X events in the time range
+// and buckets those inside the box by geohash
+func (s *EventSearcher) densityFromDatabase(density EventDensity, result *EventDensityResult) error {
+	byGeohash := make(map[string]*elasticsearch.DensityCell)
+	var events []models.SecurityEvent
+	err := database.ReadDB(s.DB).Select("id", "raw_data").
+		Where("category = ? AND timestamp >= ? AND timestamp < ?", models.CategoryV2X, density.From, density.To).
+		FindInBatches(&events, 1000, func(tx *gorm.DB, batch int) error {
+			for i := range events {
+				lat, lon, ok := EventLocation(&events[i])
+				if !ok || !density.Box.Contains(lat, lon) {
+					continue
+				}
+				geohash := elasticsearch.GeohashEncode(lat, lon, density.Precision)
+				cell, ok := byGeohash[geohash]
+				if !ok {
+					cell = &elasticsearch.DensityCell{Geohash: geohash}
+					cell.Latitude, cell.Longitude = elasticsearch.GeohashCenter(geohash)
+					byGeohash[geohash] = cell
+				}
+				if strings.Contains(events[i].RawData, `"anomaly_type"`) {
+					cell.Anomalies++
+				} else {
+					cell.Messages++
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	result.Cells = make([]elasticsearch.DensityCell, 0, len(byGeohash))
+	for _, cell := range byGeohash {
+		result.Cells = append(result.Cells, *cell)
+	}
+	sort.Slice(result.Cells, func(i, j int) bool {
+		a, b := result.Cells[i], result.Cells[j]
+		if a.Messages+a.Anomalies != b.Messages+b.Anomalies {
+			return a.Messages+a.Anomalies > b.Messages+b.Anomalies
+		}
+		return a.Geohash < b.Geohash
+	})
+	if len(result.Cells) > maxDensityCells {
+		result.Cells = result.Cells[:maxDensityCells]
+		result.Truncated = true
+	}
+	result.count()
+	return nil
+}
+
+// count totals the messages and anomalies of the cells
+func (r *EventDensityResult) count() {
+	r.Messages, r.Anomalies = 0, 0
+	for _, cell := range r.Cells {
+		r.Messages += cell.Messages
+		r.Anomalies += cell.Anomalies
+	}
+}
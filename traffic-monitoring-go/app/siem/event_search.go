@@ -0,0 +1,345 @@
+package siem
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/metrics"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+	"traffic-monitoring-go/app/siem/elasticsearch"
+)
+
+// Backends an event search may be served from
+const (
+	SearchBackendElasticsearch = "elasticsearch"
+	SearchBackendPostgres      = "postgres"
+)
+
+// eventSearches counts event searches by the backend that answered them
+var eventSearches = metrics.NewCounterVec("siem_event_searches_total",
+	"Security event searches, by the backend that served them", "backend")
+
+// searchWindow is how far back a search without bounds looks, the days of
+// indices Elasticsearch searches (see ESClient.SearchSecurityEventsWithOptions)
+const searchWindow = 30
+
+// EventSearch is a security event search. Its fields are filters both
+// backends apply; a raw Query replaces them and can only be run by Elasticsearch.
+type EventSearch struct {
+	Severity      string
+	Category      string
+	SourceIP      string
+	DestinationIP string
+	From          string // RFC 3339, YYYY-MM-DD or date math such as now-1h or now-7d/d
+	To            string
+	Text          string // words matched against the message, addresses and device ID
+
+	Query    map[string]interface{} // raw Elasticsearch query
+	Page     int
+	PageSize int
+	Options  elasticsearch.SearchOptions // highlighting is not available from Postgres
+}
+
+// EventSearchResult is a page of matching events, in the document shape of
+// the events index whichever backend served it
+type EventSearchResult struct {
+	elasticsearch.SearchResult
+	Backend        string
+	FallbackReason string // why Elasticsearch could not serve the search
+}
+
+// EventSearcher searches security events in Elasticsearch and falls back to
+// the database while Elasticsearch is unconfigured, uninitialized or failing
+type EventSearcher struct {
+	DB    *gorm.DB
+	ES    *elasticsearch.Service
+	Clock clock.Clock
+}
+
+// NewEventSearcher creates an EventSearcher; es may be nil
+func NewEventSearcher(db *gorm.DB, es *elasticsearch.Service) *EventSearcher {
+	return &EventSearcher{DB: db, ES: es, Clock: clock.Default()}
+}
+
+// ESQuery is the Elasticsearch query of the search's filters, or its raw query
+func (s EventSearch) ESQuery() map[string]interface{} {
+	if s.Query != nil {
+		return s.Query
+	}
+
+	query := map[string]interface{}{
+		"match_all": map[string]interface{}{},
+	}
+	if s.Text != "" {
+		query = map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":  s.Text,
+						"fields": []string{"message", "source_ip", "destination_ip", "device_id"},
+					},
+				},
+			},
+		}
+	}
+
+	var filters []map[string]interface{}
+	for _, term := range []struct{ field, value string }{
+		{"severity", s.Severity},
+		{"category", s.Category},
+		{"source_ip", s.SourceIP},
+		{"destination_ip", s.DestinationIP},
+	} {
+		if term.value != "" {
+			filters = append(filters, map[string]interface{}{
+				"term": map[string]interface{}{term.field: term.value},
+			})
+		}
+	}
+	if s.From != "" || s.To != "" {
+		bounds := map[string]interface{}{}
+		if s.From != "" {
+			bounds["gte"] = s.From
+		}
+		if s.To != "" {
+			bounds["lte"] = s.To
+		}
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{"timestamp": bounds},
+		})
+	}
+
+	if len(filters) > 0 {
+		if boolQuery, ok := query["bool"].(map[string]interface{}); ok {
+			boolQuery["filter"] = filters
+		} else {
+			query = map[string]interface{}{
+				"bool": map[string]interface{}{
+					"must":   query,
+					"filter": filters,
+				},
+			}
+		}
+	}
+	return query
+}
+
+// Search runs a search on Elasticsearch, or on the database when Elasticsearch
+// cannot serve it. Raw queries and geohash filters have no database
+// equivalent and fail along with Elasticsearch.
+func (s *EventSearcher) Search(search EventSearch) (*EventSearchResult, error) {
+	esErr := errors.New("elasticsearch is not configured")
+	if s.ES != nil {
+		result, err := s.ES.SearchSecurityEventsWithOptions(search.ESQuery(), search.Page, search.PageSize, search.Options)
+		if err == nil {
+			eventSearches.Inc(SearchBackendElasticsearch)
+			return &EventSearchResult{SearchResult: *result, Backend: SearchBackendElasticsearch}, nil
+		}
+		esErr = err
+	}
+
+	if search.Query != nil {
+		return nil, fmt.Errorf("%v (raw queries are not answered from the database)", esErr)
+	}
+	if len(search.Options.Geohashes) > 0 {
+		return nil, fmt.Errorf("%v (geohash filters are not answered from the database)", esErr)
+	}
+
+	result, err := s.searchDatabase(search)
+	if err != nil {
+		return nil, err
+	}
+	result.FallbackReason = esErr.Error()
+	eventSearches.Inc(SearchBackendPostgres)
+	return result, nil
+}
+
+// searchDatabase applies the search's filters to security_events, newest first
+func (s *EventSearcher) searchDatabase(search EventSearch) (*EventSearchResult, error) {
+	now := s.Clock.Now()
+	from := now.AddDate(0, 0, -searchWindow).Truncate(24 * time.Hour)
+	if search.From != "" {
+		bound, err := parseSearchTime(search.From, now, false)
+		if err != nil {
+			return nil, fmt.Errorf("from: %v", err)
+		}
+		if bound.After(from) {
+			from = bound
+		}
+	}
+	var to *time.Time
+	if search.To != "" {
+		bound, err := parseSearchTime(search.To, now, true)
+		if err != nil {
+			return nil, fmt.Errorf("to: %v", err)
+		}
+		to = &bound
+	}
+
+	started := time.Now()
+	db := database.ReadDB(s.DB)
+	filtered := func() *gorm.DB {
+		query := db.Model(&models.SecurityEvent{}).Where("timestamp >= ?", from)
+		if to != nil {
+			query = query.Where("timestamp <= ?", *to)
+		}
+		for _, term := range []struct{ column, value string }{
+			{"severity", search.Severity},
+			{"category", search.Category},
+			{"source_ip", search.SourceIP},
+			{"destination_ip", search.DestinationIP},
+		} {
+			if term.value != "" {
+				query = query.Where(term.column+" = ?", term.value)
+			}
+		}
+		if words := strings.Fields(search.Text); len(words) > 0 {
+			// like multi_match, any word in any of the fields matches
+			var conditions []string
+			var args []interface{}
+			for _, word := range words {
+				pattern := "%" + escapeLike(word) + "%"
+				conditions = append(conditions, "(message ILIKE ? OR source_ip ILIKE ? OR destination_ip ILIKE ? OR device_id ILIKE ?)")
+				args = append(args, pattern, pattern, pattern, pattern)
+			}
+			query = query.Where(strings.Join(conditions, " OR "), args...)
+		}
+		return query
+	}
+
+	var total int64
+	if err := filtered().Count(&total).Error; err != nil {
+		return nil, err
+	}
+	var events []models.SecurityEvent
+	if err := filtered().Order("timestamp DESC, id DESC").
+		Offset((search.Page - 1) * search.PageSize).Limit(search.PageSize).
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	result := &EventSearchResult{Backend: SearchBackendPostgres}
+	result.Total = int(total)
+	result.Events = make([]map[string]interface{}, len(events))
+	for i := range events {
+		result.Events[i], _ = elasticsearch.EventDocument(&events[i])
+	}
+
+	if len(search.Options.Facets) > 0 {
+		facetSize := search.Options.FacetSize
+		if facetSize <= 0 {
+			facetSize = 10
+		}
+		result.Facets = make(map[string][]elasticsearch.FacetCount, len(search.Options.Facets))
+		for _, facet := range search.Options.Facets {
+			column, ok := elasticsearch.SearchFacetFields[facet]
+			if !ok {
+				return nil, fmt.Errorf("unknown facet %q", facet)
+			}
+			var rows []struct {
+				Value string
+				Count int
+			}
+			if err := filtered().Select(column + " AS value, COUNT(*) AS count").
+				Group(column).Order("count DESC, value ASC").Limit(facetSize).
+				Scan(&rows).Error; err != nil {
+				return nil, err
+			}
+			counts := make([]elasticsearch.FacetCount, len(rows))
+			for j, row := range rows {
+				counts[j] = elasticsearch.FacetCount{Value: facetValue(row.Value), Count: row.Count}
+			}
+			result.Facets[facet] = counts
+		}
+	}
+
+	result.Took = int(time.Since(started) / time.Millisecond)
+	return result, nil
+}
+
+// facetValue reports numeric facet values, such as log source IDs, as numbers like Elasticsearch does
+func facetValue(value string) interface{} {
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		return n
+	}
+	return value
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// parseSearchTime reads a search bound: an RFC 3339 timestamp, a YYYY-MM-DD
+// day, or Elasticsearch date math relative to now (now, now-15m, now-7d/d).
+// Rounding goes to the start of the unit, or its end for an upper bound.
+func parseSearchTime(value string, now time.Time, upper bool) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "2006-01-02" && upper {
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+			return t, nil
+		}
+	}
+
+	if !strings.HasPrefix(value, "now") {
+		return time.Time{}, fmt.Errorf("unsupported time %q, expected RFC 3339, YYYY-MM-DD or now[-+]N(s|m|h|d|w)[/unit]", value)
+	}
+	expr, rounding := strings.TrimPrefix(value, "now"), ""
+	if i := strings.Index(expr, "/"); i >= 0 {
+		expr, rounding = expr[:i], expr[i+1:]
+	}
+
+	t := now.UTC()
+	if expr != "" {
+		if len(expr) < 3 {
+			return time.Time{}, fmt.Errorf("unsupported date math %q", value)
+		}
+		sign := time.Duration(1)
+		switch expr[0] {
+		case '-':
+			sign = -1
+		case '+':
+		default:
+			return time.Time{}, fmt.Errorf("unsupported date math %q", value)
+		}
+		amount, unit := expr[1:len(expr)-1], expr[len(expr)-1:]
+		n, err := strconv.Atoi(amount)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unsupported date math %q", value)
+		}
+		step, ok := dateMathUnits[unit]
+		if !ok {
+			return time.Time{}, fmt.Errorf("unsupported date math unit %q in %q", unit, value)
+		}
+		t = t.Add(sign * time.Duration(n) * step)
+	}
+
+	if rounding != "" {
+		step, ok := dateMathUnits[rounding]
+		if !ok {
+			return time.Time{}, fmt.Errorf("unsupported date math rounding %q in %q", rounding, value)
+		}
+		t = t.Truncate(step)
+		if upper {
+			t = t.Add(step - time.Nanosecond)
+		}
+	}
+	return t, nil
+}
+
+// dateMathUnits are the date math units with a fixed length
+var dateMathUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
@@ -0,0 +1,224 @@
+package siem
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"traffic-monitoring-go/app/eventschema"
+	"traffic-monitoring-go/app/models"
+)
+
+// ExamplePayload is a canonical request body for one ingest format
+type ExamplePayload struct {
+	Format      string      `json:"format"`
+	Description string      `json:"description"`
+	Method      string      `json:"method,omitempty"`
+	Endpoint    string      `json:"endpoint,omitempty"`
+	ContentType string      `json:"content_type"`
+	Payload     interface{} `json:"payload,omitempty"`
+	Supported   bool        `json:"supported"`
+	Note        string      `json:"note,omitempty"`
+
+	// decode parses a body with the same struct the server uses for this format
+	decode func(body []byte) error
+}
+
+// exampleTime keeps example payloads stable between calls
+var exampleTime = time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+func intPtr(v int) *int           { return &v }
+func floatPtr(v float64) *float64 { return &v }
+
+// strictDecode decodes body into v, rejecting unknown fields so encoder typos surface
+func strictDecode(body []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// ExamplePayloads returns the example catalog, keyed by format name.
+// Payloads are built from the structs used when parsing each format.
+func ExamplePayloads() map[string]ExamplePayload {
+	v2xEvent := eventschema.Event{
+		SourceName: "rsu-104",
+		SourceType: string(models.SourceTypeVehicle),
+		Timestamp:  exampleTime,
+		Severity:   eventschema.SeverityInfo,
+		Category:   eventschema.CategoryV2X,
+		Message:    "V2X basic_safety message from vehicle VEH001",
+		Details: eventschema.V2XDetails{
+			VehicleID:   "VEH001",
+			MessageType: eventschema.MessageBasicSafety,
+			Location:    &eventschema.Location{Lat: 37.7749, Lon: -122.4194},
+			Speed:       eventschema.Float(42),
+		},
+	}
+
+	networkEvent := RawEvent{
+		SourceName: "firewall-01",
+		SourceType: string(models.SourceTypeNetwork),
+		Timestamp:  exampleTime,
+		Severity:   string(models.SeverityMedium),
+		Category:   string(models.CategoryNetwork),
+		Message:    "Blocked inbound connection",
+		Details: map[string]interface{}{
+			"source_ip":        "203.0.113.10",
+			"source_port":      51544,
+			"destination_ip":   "10.0.0.5",
+			"destination_port": 22,
+			"protocol":         "TCP",
+			"action":           "block",
+		},
+	}
+
+	securityEvents := []models.SecurityEvent{
+		{
+			Timestamp:       exampleTime,
+			SourceIP:        "203.0.113.10",
+			SourcePort:      intPtr(51544),
+			DestinationIP:   "10.0.0.5",
+			DestinationPort: intPtr(22),
+			Protocol:        "TCP",
+			Action:          "block",
+			LogSourceID:     1,
+			Severity:        models.SeverityMedium,
+			Category:        models.CategoryNetwork,
+			Message:         "Blocked inbound connection",
+		},
+	}
+
+	measurements := []models.TrafficMeasurement{
+		{SensorID: 1, Timestamp: exampleTime, Speed: floatPtr(48.5), VehicleCount: intPtr(12)},
+	}
+
+	transformRule := models.TransformRule{
+		Name:       "vendor-firewall",
+		SourceName: "vendor-fw",
+		Mappings: []models.FieldMapping{
+			{From: "src_ip", To: "details.source_ip"},
+			{From: "epoch", To: "timestamp", Convert: "unix"},
+			{From: "sev", To: "severity", Values: map[string]string{"1": "critical", "5": "info"}},
+			{To: "category", Default: string(models.CategoryNetwork)},
+		},
+		Enabled: true,
+	}
+
+	listenerJSON, _ := json.Marshal(networkEvent)
+
+	return map[string]ExamplePayload{
+		"ingest_event": {
+			Format:      "ingest_event",
+			Description: "Single security event, normalized and evaluated against rules",
+			Method:      "POST",
+			Endpoint:    "/ingest/",
+			ContentType: "application/json",
+			Payload:     v2xEvent,
+			Supported:   true,
+			decode: func(body []byte) error {
+				var event RawEvent
+				return strictDecode(body, &event)
+			},
+		},
+		"security_event_batch": {
+			Format:      "security_event_batch",
+			Description: "Batch of already-normalized security events",
+			Method:      "POST",
+			Endpoint:    "/security-events/batch",
+			ContentType: "application/json",
+			Payload:     securityEvents,
+			Supported:   true,
+			decode: func(body []byte) error {
+				var events []models.SecurityEvent
+				return strictDecode(body, &events)
+			},
+		},
+		"measurement_batch": {
+			Format:      "measurement_batch",
+			Description: "Batch of traffic sensor measurements",
+			Method:      "POST",
+			Endpoint:    "/measurements/batch",
+			ContentType: "application/json",
+			Payload:     measurements,
+			Supported:   true,
+			decode: func(body []byte) error {
+				var batch []models.TrafficMeasurement
+				return strictDecode(body, &batch)
+			},
+		},
+		"listener_json": {
+			Format:      "listener_json",
+			Description: "Newline-delimited ingest events sent to a collector listener with the json parser",
+			ContentType: "application/x-ndjson",
+			Payload:     string(listenerJSON) + "\n",
+			Supported:   true,
+			decode: func(body []byte) error {
+				for _, line := range bytes.Split(bytes.TrimSpace(body), []byte("\n")) {
+					var event RawEvent
+					if err := strictDecode(line, &event); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		"syslog": {
+			Format:      "syslog",
+			Description: "RFC 5424 syslog line sent to a collector listener with the syslog parser",
+			ContentType: "text/plain",
+			Payload:     "<34>1 2024-01-15T10:30:00Z rsu-104 sshd 2211 - - Failed password for root from 203.0.113.10",
+			Supported:   true,
+			decode: func(body []byte) error {
+				if len(bytes.TrimSpace(body)) == 0 {
+					return fmt.Errorf("empty syslog message")
+				}
+				return nil
+			},
+		},
+		"transform_rule": {
+			Format:      "transform_rule",
+			Description: "Field mapping for a third-party event format",
+			Method:      "POST",
+			Endpoint:    "/transform-rules/",
+			ContentType: "application/json",
+			Payload:     transformRule,
+			Supported:   true,
+			decode: func(body []byte) error {
+				var rule models.TransformRule
+				return strictDecode(body, &rule)
+			},
+		},
+		"binary_v2x_frame": {
+			Format:      "binary_v2x_frame",
+			Description: "UPER-encoded J2735/ETSI V2X frame as hex",
+			ContentType: "application/octet-stream",
+			Supported:   false,
+			Note:        "This build has no binary V2X decoder; send decoded messages as ingest_event with category v2x",
+		},
+	}
+}
+
+// ExampleFormats returns the format names of the example catalog in order
+func ExampleFormats() []string {
+	examples := ExamplePayloads()
+	formats := make([]string, 0, len(examples))
+	for format := range examples {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// ValidateExamplePayload decodes body as the given format with the server's own structs
+func ValidateExamplePayload(format string, body []byte) error {
+	example, ok := ExamplePayloads()[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	if !example.Supported || example.decode == nil {
+		return fmt.Errorf("format %q is not supported by this server", format)
+	}
+	return example.decode(body)
+}
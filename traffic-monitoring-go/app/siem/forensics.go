@@ -0,0 +1,231 @@
+package siem
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+)
+
+// Forensic item kinds
+const (
+	ForensicKindEvent = "event" // security event without V2X content
+	ForensicKindV2X   = "v2x"   // V2X message
+	ForensicKindSPaT  = "spat"  // signal phase and timing message
+	ForensicKindAlert = "alert" // alert raised by a detection rule
+)
+
+// spatMessageTypes are the V2X message types carrying signal phase and timing
+var spatMessageTypes = map[string]bool{
+	"spat":           true,
+	"traffic_signal": true,
+}
+
+// ForensicTimeFormat renders timestamps with millisecond precision
+const ForensicTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// MaxForensicRadius bounds the time radius of a forensic window
+const MaxForensicRadius = 30 * time.Minute
+
+// ForensicWindow is a space-time window around an incident. The spatial part
+// is optional: without a location every record of the time window is returned.
+type ForensicWindow struct {
+	Center       time.Time
+	Radius       time.Duration
+	Latitude     float64
+	Longitude    float64
+	HasLocation  bool
+	RadiusMeters float64
+	Limit        int
+}
+
+// ForensicItem is one record of the reconstructed timeline
+type ForensicItem struct {
+	Kind        string                `json:"kind"`
+	Timestamp   string                `json:"timestamp"`
+	TimestampMS int64                 `json:"timestamp_ms"`
+	OffsetMS    int64                 `json:"offset_ms"` // relative to the window center
+	Latitude    *float64              `json:"latitude,omitempty"`
+	Longitude   *float64              `json:"longitude,omitempty"`
+	DistanceM   *float64              `json:"distance_m,omitempty"`
+	VehicleID   string                `json:"vehicle_id,omitempty"`
+	MessageType string                `json:"message_type,omitempty"`
+	Speed       *float64              `json:"speed,omitempty"`
+	Event       *models.SecurityEvent `json:"event,omitempty"`
+	Alert       *models.Alert         `json:"alert,omitempty"`
+
+	at time.Time
+	id uint
+}
+
+// ForensicResult is the timeline of a window ordered by timestamp
+type ForensicResult struct {
+	Center    string         `json:"center"`
+	Start     string         `json:"start"`
+	End       string         `json:"end"`
+	Items     []ForensicItem `json:"items"`
+	Counts    map[string]int `json:"counts"`
+	Unlocated int            `json:"unlocated"` // records of the time window without coordinates, left out by the location filter
+	Truncated bool           `json:"truncated"`
+}
+
+// ForensicSearch reconstructs what happened in a space-time window.
+// Anomalies are reported through the alerts raised for them; SPaT messages are
+// returned as received since signal phases are not decoded yet.
+type ForensicSearch struct {
+	DB *gorm.DB
+}
+
+// NewForensicSearch creates a new ForensicSearch
+func NewForensicSearch(db *gorm.DB) *ForensicSearch {
+	return &ForensicSearch{DB: db}
+}
+
+// Validate checks the window bounds
+func (w ForensicWindow) Validate() error {
+	if w.Center.IsZero() {
+		return errors.New("center timestamp is required")
+	}
+	if w.Radius <= 0 || w.Radius > MaxForensicRadius {
+		return errors.New("radius must be positive and at most " + MaxForensicRadius.String())
+	}
+	if w.HasLocation && w.RadiusMeters <= 0 {
+		return errors.New("distance radius must be positive")
+	}
+	if w.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	return nil
+}
+
+// Search returns the events, V2X messages and alerts of the window
+func (s *ForensicSearch) Search(window ForensicWindow) (*ForensicResult, error) {
+	if err := window.Validate(); err != nil {
+		return nil, err
+	}
+
+	start := window.Center.Add(-window.Radius)
+	end := window.Center.Add(window.Radius)
+	db := database.ReadDB(s.DB)
+	result := &ForensicResult{
+		Center: window.Center.UTC().Format(ForensicTimeFormat),
+		Start:  start.UTC().Format(ForensicTimeFormat),
+		End:    end.UTC().Format(ForensicTimeFormat),
+		Items:  make([]ForensicItem, 0),
+		Counts: make(map[string]int),
+	}
+
+	// the time range uses the timestamp indexes; the spatial filter is applied
+	// here since event coordinates live in the raw payload
+	var events []models.SecurityEvent
+	err := db.Preload("LogSource").
+		Where("timestamp BETWEEN ? AND ?", start, end).
+		Order("timestamp ASC, id ASC").
+		Limit(window.Limit + 1).
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > window.Limit {
+		events = events[:window.Limit]
+		result.Truncated = true
+	}
+
+	for i := range events {
+		event := &events[i]
+		item := ForensicItem{Kind: ForensicKindEvent, Event: event, at: event.Timestamp, id: event.ID}
+
+		if obs, ok := ParseV2XObservation(event, event.LogSource.Name); ok {
+			item.Kind = ForensicKindV2X
+			if spatMessageTypes[strings.ToLower(obs.MessageType)] {
+				item.Kind = ForensicKindSPaT
+			}
+			item.VehicleID = obs.VehicleID
+			item.MessageType = obs.MessageType
+			if obs.HasSpeed {
+				speed := obs.Speed
+				item.Speed = &speed
+			}
+			if obs.HasLocation {
+				lat, lon := obs.Latitude, obs.Longitude
+				item.Latitude, item.Longitude = &lat, &lon
+			}
+		}
+
+		if s.admit(window, &item, result) {
+			result.Items = append(result.Items, item)
+		}
+	}
+
+	var alerts []models.Alert
+	err = db.Preload("Rule").
+		Where("timestamp BETWEEN ? AND ?", start, end).
+		Order("timestamp ASC, id ASC").
+		Limit(window.Limit + 1).
+		Find(&alerts).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(alerts) > window.Limit {
+		alerts = alerts[:window.Limit]
+		result.Truncated = true
+	}
+
+	for i := range alerts {
+		alert := &alerts[i]
+		item := ForensicItem{
+			Kind:      ForensicKindAlert,
+			Alert:     alert,
+			Latitude:  alert.Latitude,
+			Longitude: alert.Longitude,
+			at:        alert.Timestamp,
+			id:        alert.ID,
+		}
+		if s.admit(window, &item, result) {
+			result.Items = append(result.Items, item)
+		}
+	}
+
+	sort.SliceStable(result.Items, func(i, j int) bool {
+		a, b := result.Items[i], result.Items[j]
+		if !a.at.Equal(b.at) {
+			return a.at.Before(b.at)
+		}
+		if a.Kind != b.Kind {
+			return a.Kind > b.Kind // events before the alerts they raised
+		}
+		return a.id < b.id
+	})
+
+	for i := range result.Items {
+		item := &result.Items[i]
+		item.Timestamp = item.at.UTC().Format(ForensicTimeFormat)
+		item.TimestampMS = item.at.UnixNano() / int64(time.Millisecond)
+		item.OffsetMS = int64(item.at.Sub(window.Center) / time.Millisecond)
+		result.Counts[item.Kind]++
+	}
+
+	return result, nil
+}
+
+// admit applies the spatial filter, recording the distance to the window center
+func (s *ForensicSearch) admit(window ForensicWindow, item *ForensicItem, result *ForensicResult) bool {
+	if !window.HasLocation {
+		return true
+	}
+	if item.Latitude == nil || item.Longitude == nil {
+		result.Unlocated++
+		return false
+	}
+
+	distance := DistanceMeters(window.Latitude, window.Longitude, *item.Latitude, *item.Longitude)
+	if distance > window.RadiusMeters {
+		return false
+	}
+	item.DistanceM = &distance
+	return true
+}
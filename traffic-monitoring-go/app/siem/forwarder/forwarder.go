@@ -0,0 +1,224 @@
+package forwarder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+)
+
+var (
+	forwardURL        = config.NewString("FORWARD_URL", "", "Central SIEM the edge forwards its events to")
+	edgeNodeID        = config.NewString("EDGE_NODE_ID", "", "Name of this edge node; the hostname when empty")
+	forwardQueueDir   = config.NewString("FORWARD_QUEUE_DIR", "data/forward-queue", "Directory of the forward queue")
+	forwardQueueMaxMB = config.NewInt("FORWARD_QUEUE_MAX_MB", 256, "Megabytes of events the forward queue holds", config.Min(1))
+	forwardBatchSize  = config.NewInt("FORWARD_BATCH_SIZE", 500, "Events per forwarded batch", config.Min(1))
+	forwardToken      = config.NewString("INGEST_API_TOKEN", "", "Ingest token of the central SIEM", config.Secret)
+)
+
+// Headers that identify a forwarded batch. The central SIEM uses the node and
+// queue position to drop records it already ingested when a batch is resent.
+const (
+	HeaderEdgeNode     = "X-Edge-Node"
+	HeaderQueueSegment = "X-Queue-Segment"
+	HeaderQueueOffset  = "X-Queue-Offset"
+)
+
+// HeaderIngestToken carries the shared INGEST_API_TOKEN authorizing the batch
+const HeaderIngestToken = "X-Ingest-Token"
+
+// maxBackoff caps the wait between retries while the central SIEM is unreachable
+const maxBackoff = 5 * time.Minute
+
+// Forwarder ships queued events to the central SIEM's batch ingest endpoint
+type Forwarder struct {
+	Queue     *DiskQueue
+	URL       string
+	NodeID    string
+	BatchSize int
+	Token     string // sent as HeaderIngestToken when set
+	Client    *http.Client
+
+	mutex       sync.Mutex
+	sent        uint64
+	failures    uint64
+	lastSentAt  time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// Status is the forwarder's delivery state
+type Status struct {
+	NodeID      string     `json:"node_id"`
+	URL         string     `json:"url"`
+	Sent        uint64     `json:"sent"`
+	Failures    uint64     `json:"failures"`
+	LastSentAt  *time.Time `json:"last_sent_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	Queue       QueueStats `json:"queue"`
+}
+
+// NewForwarderFromEnv configures a forwarder from FORWARD_URL (the central SIEM),
+// EDGE_NODE_ID (default hostname), FORWARD_QUEUE_DIR (default data/forward-queue),
+// FORWARD_QUEUE_MAX_MB (default 256), FORWARD_BATCH_SIZE (default 500) and
+// INGEST_API_TOKEN (the central SIEM's ingest token)
+func NewForwarderFromEnv() (*Forwarder, error) {
+	url := strings.TrimRight(forwardURL.Get(), "/")
+	if url == "" {
+		return nil, fmt.Errorf("FORWARD_URL is required in store-and-forward mode")
+	}
+
+	nodeID := edgeNodeID.Get()
+	if nodeID == "" {
+		nodeID, _ = os.Hostname()
+	}
+
+	queue, err := OpenDiskQueue(forwardQueueDir.Get(), int64(forwardQueueMaxMB.Get())<<20)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open forward queue: %v", err)
+	}
+
+	return &Forwarder{
+		Queue:     queue,
+		URL:       url,
+		NodeID:    nodeID,
+		BatchSize: forwardBatchSize.Get(),
+		Token:     forwardToken.Get(),
+		Client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Enqueue buffers a normalized event for delivery
+func (f *Forwarder) Enqueue(eventJSON []byte) error {
+	return f.Queue.Append(eventJSON)
+}
+
+// Run delivers batches until ctx is cancelled, backing off while deliveries fail
+func (f *Forwarder) Run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		batch, err := f.Queue.Peek(f.BatchSize)
+		if err == nil && len(batch.Records) > 0 {
+			err = f.send(batch)
+			if err == nil {
+				err = f.Queue.Commit(batch.End)
+			}
+			f.record(len(batch.Records), err)
+		}
+
+		wait := 5 * time.Second
+		if err != nil {
+			log.Printf("Error forwarding events to %s (retrying in %s): %v", f.URL, backoff, err)
+			wait = backoff
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		} else {
+			backoff = time.Second
+			if len(batch.Records) == f.BatchSize {
+				wait = 0 // more records are waiting
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-f.Queue.Available():
+			// new records only shorten the wait when the central SIEM is reachable
+			if err != nil {
+				<-timer.C
+			}
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// send posts a batch as gzip-compressed NDJSON
+func (f *Forwarder) send(batch Batch) error {
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	for _, record := range batch.Records {
+		writer.Write(record)
+		writer.Write([]byte("\n"))
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, f.URL+"/ingest/batch", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set(HeaderEdgeNode, f.NodeID)
+	req.Header.Set(HeaderQueueSegment, strconv.FormatInt(batch.Start.Segment, 10))
+	req.Header.Set(HeaderQueueOffset, strconv.FormatInt(batch.Start.Offset, 10))
+	if f.Token != "" {
+		req.Header.Set(HeaderIngestToken, f.Token)
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("central SIEM returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+func (f *Forwarder) record(records int, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err != nil {
+		f.failures++
+		f.lastError = err.Error()
+		f.lastErrorAt = time.Now()
+		return
+	}
+	f.sent += uint64(records)
+	f.lastSentAt = time.Now()
+}
+
+// Status returns the forwarder's delivery state and queue backlog
+func (f *Forwarder) Status() Status {
+	f.mutex.Lock()
+	status := Status{
+		NodeID:    f.NodeID,
+		URL:       f.URL,
+		Sent:      f.sent,
+		Failures:  f.failures,
+		LastError: f.lastError,
+	}
+	if !f.lastSentAt.IsZero() {
+		lastSent := f.lastSentAt
+		status.LastSentAt = &lastSent
+	}
+	if !f.lastErrorAt.IsZero() {
+		lastError := f.lastErrorAt
+		status.LastErrorAt = &lastError
+	}
+	f.mutex.Unlock()
+
+	status.Queue = f.Queue.Stats()
+	return status
+}
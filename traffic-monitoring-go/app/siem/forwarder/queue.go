@@ -0,0 +1,328 @@
+// Package forwarder implements the store-and-forward mode of edge collectors:
+// normalized events are buffered in a bounded on-disk queue and shipped to the
+// central SIEM in compressed batches, resuming where they left off after WAN
+// outages or restarts.
+package forwarder
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// segmentMaxBytes is the size at which the queue starts a new segment file
+const segmentMaxBytes = 4 << 20
+
+// Position identifies a record in the queue: the segment file and the byte
+// offset of the record in it. Positions only ever increase.
+type Position struct {
+	Segment int64 `json:"segment"`
+	Offset  int64 `json:"offset"`
+}
+
+// Before reports whether p comes before other
+func (p Position) Before(other Position) bool {
+	return p.Segment < other.Segment || (p.Segment == other.Segment && p.Offset < other.Offset)
+}
+
+// Batch is a run of records read from a single segment
+type Batch struct {
+	Start   Position
+	End     Position // position after the last record
+	Records [][]byte
+}
+
+// DiskQueue is a bounded, append-only queue of newline-delimited records stored
+// in segment files. Records survive process restarts; when the queue exceeds its
+// size bound the oldest segment is discarded.
+type DiskQueue struct {
+	mutex    sync.Mutex
+	dir      string
+	maxBytes int64
+
+	segments  []int64 // segment numbers on disk, oldest first
+	sizes     map[int64]int64
+	write     *os.File
+	read      Position
+	dropped   uint64 // records lost to the size bound
+	available chan struct{}
+}
+
+// QueueStats describes the queue backlog
+type QueueStats struct {
+	Segments     int      `json:"segments"`
+	Bytes        int64    `json:"bytes"`
+	PendingBytes int64    `json:"pending_bytes"`
+	MaxBytes     int64    `json:"max_bytes"`
+	Read         Position `json:"read"`
+	Dropped      uint64   `json:"dropped"`
+}
+
+// OpenDiskQueue opens or creates the queue stored in dir
+func OpenDiskQueue(dir string, maxBytes int64) (*DiskQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	q := &DiskQueue{
+		dir:       dir,
+		maxBytes:  maxBytes,
+		sizes:     make(map[int64]int64),
+		available: make(chan struct{}, 1),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "segment-") || !strings.HasSuffix(name, ".ndjson") {
+			continue
+		}
+		number, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, "segment-"), ".ndjson"), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		q.segments = append(q.segments, number)
+		q.sizes[number] = info.Size()
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+
+	if err := q.loadCursor(); err != nil {
+		return nil, err
+	}
+	if len(q.segments) == 0 {
+		q.segments = []int64{q.read.Segment}
+	}
+	if q.read.Segment < q.segments[0] {
+		q.read = Position{Segment: q.segments[0]}
+	}
+
+	last := q.segments[len(q.segments)-1]
+	if q.write, err = os.OpenFile(q.segmentPath(last), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *DiskQueue) segmentPath(number int64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("segment-%016d.ndjson", number))
+}
+
+func (q *DiskQueue) cursorPath() string {
+	return filepath.Join(q.dir, "cursor.json")
+}
+
+func (q *DiskQueue) loadCursor() error {
+	data, err := os.ReadFile(q.cursorPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &q.read)
+}
+
+// saveCursor persists the read position atomically
+func (q *DiskQueue) saveCursor() error {
+	data, err := json.Marshal(q.read)
+	if err != nil {
+		return err
+	}
+	tmp := q.cursorPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.cursorPath())
+}
+
+// Available is signalled after records are appended
+func (q *DiskQueue) Available() <-chan struct{} {
+	return q.available
+}
+
+// Append adds one record. Records must not contain newlines.
+func (q *DiskQueue) Append(record []byte) error {
+	if strings.ContainsRune(string(record), '\n') {
+		return errors.New("record contains a newline")
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	current := q.segments[len(q.segments)-1]
+	if q.sizes[current] >= segmentMaxBytes {
+		if err := q.write.Close(); err != nil {
+			return err
+		}
+		current++
+		file, err := os.OpenFile(q.segmentPath(current), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		q.write = file
+		q.segments = append(q.segments, current)
+		q.sizes[current] = 0
+	}
+
+	q.enforceBound(int64(len(record) + 1))
+
+	n, err := q.write.Write(append(record, '\n'))
+	q.sizes[current] += int64(n)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case q.available <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// enforceBound discards the oldest segments until incoming bytes fit
+func (q *DiskQueue) enforceBound(incoming int64) {
+	total := incoming
+	for _, number := range q.segments {
+		total += q.sizes[number]
+	}
+
+	for total > q.maxBytes && len(q.segments) > 1 {
+		oldest := q.segments[0]
+		if oldest == q.read.Segment {
+			q.dropped += q.countRecords(oldest, q.read.Offset)
+			q.read = Position{Segment: q.segments[1]}
+			q.saveCursor()
+		}
+		total -= q.sizes[oldest]
+		os.Remove(q.segmentPath(oldest))
+		delete(q.sizes, oldest)
+		q.segments = q.segments[1:]
+	}
+}
+
+// countRecords counts the unread records of a segment from offset
+func (q *DiskQueue) countRecords(number, offset int64) uint64 {
+	file, err := os.Open(q.segmentPath(number))
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0
+	}
+
+	var count uint64
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), segmentMaxBytes)
+	for scanner.Scan() {
+		count++
+	}
+	return count
+}
+
+// Peek returns up to max unread records from the current read segment without
+// consuming them. An empty batch means there is nothing to send.
+func (q *DiskQueue) Peek(max int) (Batch, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	// skip segments that are fully read and already closed for writing
+	for q.read.Offset >= q.sizes[q.read.Segment] && q.read.Segment < q.segments[len(q.segments)-1] {
+		q.advanceSegment()
+	}
+
+	batch := Batch{Start: q.read, End: q.read}
+	if q.read.Offset >= q.sizes[q.read.Segment] {
+		return batch, nil
+	}
+
+	file, err := os.Open(q.segmentPath(q.read.Segment))
+	if err != nil {
+		return batch, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(q.read.Offset, io.SeekStart); err != nil {
+		return batch, err
+	}
+
+	// only read what was completely written when Peek started
+	reader := bufio.NewReader(io.LimitReader(file, q.sizes[q.read.Segment]-q.read.Offset))
+	for len(batch.Records) < max {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return batch, err
+		}
+		batch.End.Offset += int64(len(line))
+		batch.Records = append(batch.Records, line[:len(line)-1])
+	}
+	return batch, nil
+}
+
+// advanceSegment moves the read position to the next segment and deletes the read one
+func (q *DiskQueue) advanceSegment() {
+	finished := q.read.Segment
+	for i, number := range q.segments {
+		if number == finished && i+1 < len(q.segments) {
+			q.read = Position{Segment: q.segments[i+1]}
+			q.segments = append(q.segments[:i], q.segments[i+1:]...)
+			break
+		}
+	}
+	os.Remove(q.segmentPath(finished))
+	delete(q.sizes, finished)
+	q.saveCursor()
+}
+
+// Commit marks everything before end as delivered
+func (q *DiskQueue) Commit(end Position) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !q.read.Before(end) {
+		return nil
+	}
+	q.read = end
+	return q.saveCursor()
+}
+
+// Stats returns the queue backlog
+func (q *DiskQueue) Stats() QueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	stats := QueueStats{Segments: len(q.segments), MaxBytes: q.maxBytes, Read: q.read, Dropped: q.dropped}
+	for _, number := range q.segments {
+		stats.Bytes += q.sizes[number]
+		if number == q.read.Segment {
+			stats.PendingBytes += q.sizes[number] - q.read.Offset
+		} else if number > q.read.Segment {
+			stats.PendingBytes += q.sizes[number]
+		}
+	}
+	return stats
+}
+
+// Close closes the segment being written
+func (q *DiskQueue) Close() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.write.Close()
+}
@@ -0,0 +1,202 @@
+package siem
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/models"
+)
+
+// NormalizeGeofence validates a geofence before it is stored and computes its
+// bounding box; every violation is reported in a *models.ValidationError
+func NormalizeGeofence(fence *models.Geofence) error {
+	fence.Name = strings.TrimSpace(fence.Name)
+	if err := fence.Validate().Err(); err != nil {
+		return err
+	}
+	if fence.Kind == "" {
+		fence.Kind = models.GeofenceZone
+	}
+
+	switch fence.Shape {
+	case models.GeofencePolygon:
+		// a closing vertex repeating the first one is optional
+		if n := len(fence.Polygon); n > 3 && fence.Polygon[0] == fence.Polygon[n-1] {
+			fence.Polygon = fence.Polygon[:n-1]
+		}
+		fence.MinLat, fence.MaxLat = math.Inf(1), math.Inf(-1)
+		fence.MinLon, fence.MaxLon = math.Inf(1), math.Inf(-1)
+		for _, p := range fence.Polygon {
+			fence.MinLat, fence.MaxLat = math.Min(fence.MinLat, p.Lat), math.Max(fence.MaxLat, p.Lat)
+			fence.MinLon, fence.MaxLon = math.Min(fence.MinLon, p.Lon), math.Max(fence.MaxLon, p.Lon)
+		}
+		fence.CenterLat, fence.CenterLon, fence.RadiusM = 0, 0, 0
+	case models.GeofenceCircle:
+		dLat := fence.RadiusM / 111320
+		dLon := fence.RadiusM / (111320 * math.Max(math.Cos(fence.CenterLat*math.Pi/180), 0.01))
+		fence.MinLat, fence.MaxLat = fence.CenterLat-dLat, fence.CenterLat+dLat
+		fence.MinLon, fence.MaxLon = fence.CenterLon-dLon, fence.CenterLon+dLon
+		fence.Polygon = nil
+	}
+	return nil
+}
+
+// GeofenceContains reports whether a coordinate lies inside a geofence
+func GeofenceContains(fence *models.Geofence, lat, lon float64) bool {
+	if lat < fence.MinLat || lat > fence.MaxLat || lon < fence.MinLon || lon > fence.MaxLon {
+		return false
+	}
+	if fence.Shape == models.GeofenceCircle {
+		return DistanceMeters(fence.CenterLat, fence.CenterLon, lat, lon) <= fence.RadiusM
+	}
+
+	// even-odd ray casting towards the east; geofences are small enough for
+	// latitude and longitude to be treated as plane coordinates
+	inside := false
+	polygon := fence.Polygon
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > lat) != (b.Lat > lat) {
+			crossLon := a.Lon + (lat-a.Lat)/(b.Lat-a.Lat)*(b.Lon-a.Lon)
+			if lon < crossLon {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// geofenceCacheTTL bounds how long a geofence changed on another instance takes to apply here
+const geofenceCacheTTL = 10 * time.Second
+
+// geofenceCache keeps the enabled geofences in memory so rule conditions and
+// anomaly detection cost no query
+type geofenceCache struct {
+	mutex    sync.RWMutex
+	loaded   bool
+	loadedAt time.Time
+	fences   []models.Geofence
+	byName   map[string]*models.Geofence
+}
+
+var defaultGeofenceCache = &geofenceCache{}
+
+// InvalidateGeofences forces the geofence cache to reload. Call it whenever geofences change.
+func InvalidateGeofences() {
+	cache.Invalidate("geofences")
+}
+
+// invalidate drops the cached geofences of this instance
+func (c *geofenceCache) invalidate() {
+	c.mutex.Lock()
+	c.loaded = false
+	c.mutex.Unlock()
+}
+
+func init() {
+	cache.OnInvalidate("geofences", defaultGeofenceCache.invalidate)
+}
+
+func (c *geofenceCache) get(db *gorm.DB) ([]models.Geofence, map[string]*models.Geofence, error) {
+	c.mutex.RLock()
+	if c.loaded && time.Since(c.loadedAt) <= geofenceCacheTTL {
+		fences, byName := c.fences, c.byName
+		c.mutex.RUnlock()
+		return fences, byName, nil
+	}
+	c.mutex.RUnlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded || time.Since(c.loadedAt) > geofenceCacheTTL {
+		var fences []models.Geofence
+		if err := db.Where("enabled = ?", true).Order("name ASC").Find(&fences).Error; err != nil {
+			return nil, nil, err
+		}
+		byName := make(map[string]*models.Geofence, len(fences))
+		for i := range fences {
+			byName[fences[i].Name] = &fences[i]
+		}
+		c.fences = fences
+		c.byName = byName
+		c.loaded = true
+		c.loadedAt = time.Now()
+	}
+	return c.fences, c.byName, nil
+}
+
+// InGeofence reports whether a coordinate lies inside the enabled geofence
+// with the given name; unknown or disabled geofences are an error
+func InGeofence(db *gorm.DB, name string, lat, lon float64) (bool, error) {
+	_, byName, err := defaultGeofenceCache.get(db)
+	if err != nil {
+		return false, err
+	}
+	fence, ok := byName[name]
+	if !ok {
+		return false, fmt.Errorf("unknown or disabled geofence: %s", name)
+	}
+	return GeofenceContains(fence, lat, lon), nil
+}
+
+// GeofencesContaining returns the enabled geofences a coordinate lies inside
+func GeofencesContaining(db *gorm.DB, lat, lon float64) ([]models.Geofence, error) {
+	fences, _, err := defaultGeofenceCache.get(db)
+	if err != nil {
+		return nil, err
+	}
+	containing := []models.Geofence{}
+	for i := range fences {
+		if GeofenceContains(&fences[i], lat, lon) {
+			containing = append(containing, fences[i])
+		}
+	}
+	return containing, nil
+}
+
+// RulesReferencingGeofence returns the names of the rules whose condition tests the named geofence
+func RulesReferencingGeofence(db *gorm.DB, name string) ([]string, error) {
+	var rules []models.Rule
+	if err := db.Select("name", "condition").Where("condition LIKE ?", "%"+name+"%").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	reference := regexp.MustCompile(`\blocation\s+(inside|outside)\s+` + regexp.QuoteMeta(name) + `(\s|\)|$)`)
+	names := []string{}
+	for _, rule := range rules {
+		if reference.MatchString(rule.Condition) {
+			names = append(names, rule.Name)
+		}
+	}
+	return names, nil
+}
+
+// locateInGeofences sets the geofence fields of a located observation
+func locateInGeofences(db *gorm.DB, obs *V2XObservation) error {
+	if !obs.HasLocation {
+		return nil
+	}
+	fences, _, err := defaultGeofenceCache.get(db)
+	if err != nil {
+		return err
+	}
+	for i := range fences {
+		fence := &fences[i]
+		if fence.Kind == models.GeofenceODD {
+			obs.HasODD = true
+		}
+		if GeofenceContains(fence, obs.Latitude, obs.Longitude) {
+			obs.Geofences = append(obs.Geofences, fence.Name)
+			if fence.Kind == models.GeofenceODD {
+				obs.InODD = true
+			}
+		}
+	}
+	return nil
+}
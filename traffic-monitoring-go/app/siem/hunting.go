@@ -0,0 +1,221 @@
+package siem
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"traffic-monitoring-go/app/models"
+)
+
+// huntPlaceholder matches {{name}} parameters inside hunt queries
+var huntPlaceholder = regexp.MustCompile(`{{\s*([a-zA-Z0-9_]+)\s*}}`)
+
+// BuiltinHunts returns the hunt queries shipped with the SIEM, one or more per category
+func BuiltinHunts() []models.HuntQuery {
+	return []models.HuntQuery{
+		{
+			Name:        "Brute force by source IP",
+			Description: "Repeated authentication failures, optionally narrowed to one source IP",
+			Category:    models.CategoryAuthentication,
+			Query:       "category:authentication and status:failure and source_ip:{{source_ip}}",
+			Parameters: []models.HuntParameter{
+				{Name: "source_ip", Default: "*", Description: "Source IP to hunt for"},
+			},
+			Columns: []string{"timestamp", "source_ip", "message"},
+		},
+		{
+			Name:        "Blocked connections to host",
+			Description: "Firewall blocks towards a destination, typical of port scans",
+			Category:    models.CategoryNetwork,
+			Query:       "category:network and action:block and destination_ip:{{destination_ip}}",
+			Parameters: []models.HuntParameter{
+				{Name: "destination_ip", Default: "*", Description: "Targeted host"},
+			},
+			Columns: []string{"timestamp", "source_ip", "destination_ip", "destination_port", "protocol"},
+		},
+		{
+			Name:        "Malware detections",
+			Description: "Antivirus detections filtered by minimum severity",
+			Category:    models.CategoryMalware,
+			Query:       "category:malware and severity:({{severity}})",
+			Parameters: []models.HuntParameter{
+				{Name: "severity", Default: "critical or high", Description: "Severities to include"},
+			},
+			Columns: []string{"timestamp", "source_ip", "severity", "message"},
+		},
+		{
+			Name:        "Service crashes",
+			Description: "System events reporting crashed or stopped services",
+			Category:    models.CategorySystem,
+			Query:       "category:system and (message:*crash* or message:*service_stop*)",
+			Columns:     []string{"timestamp", "source_ip", "message"},
+		},
+		{
+			Name:        "Critical vehicle events",
+			Description: "Critical component events for a vehicle",
+			Category:    models.CategoryVehicle,
+			Query:       "category:vehicle and severity:critical and device_id:{{device_id}}",
+			Parameters: []models.HuntParameter{
+				{Name: "device_id", Default: "*", Description: "Vehicle identifier"},
+			},
+			Columns: []string{"timestamp", "device_id", "message"},
+		},
+		{
+			Name:        "Spoofed V2X messages",
+			Description: "V2X messages flagged as potentially spoofed",
+			Category:    models.CategoryV2X,
+			Query:       "category:v2x and message:*spoofed*",
+			Columns:     []string{"timestamp", "device_id", "severity", "message"},
+		},
+	}
+}
+
+// RenderHuntQuery substitutes parameters into a hunt query, falling back to parameter defaults
+func RenderHuntQuery(hunt *models.HuntQuery, values map[string]string) string {
+	defaults := make(map[string]string, len(hunt.Parameters))
+	for _, p := range hunt.Parameters {
+		defaults[p.Name] = p.Default
+	}
+
+	return huntPlaceholder.ReplaceAllStringFunc(hunt.Query, func(match string) string {
+		name := huntPlaceholder.FindStringSubmatch(match)[1]
+		if v, ok := values[name]; ok && v != "" {
+			return v
+		}
+		if v, ok := defaults[name]; ok && v != "" {
+			return v
+		}
+		return "*"
+	})
+}
+
+// huntSavedObjectID derives a stable Kibana saved object ID from the hunt name
+func huntSavedObjectID(name string) string {
+	slug := strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "-"), "-")
+	return "hunt-" + slug
+}
+
+// HuntToKibanaSavedSearch converts a hunt into a Kibana saved search object.
+// Kibana has no notion of parameters, so the query is rendered with its defaults.
+func HuntToKibanaSavedSearch(hunt *models.HuntQuery) (map[string]interface{}, error) {
+	searchSource := map[string]interface{}{
+		"query": map[string]interface{}{
+			"query":    RenderHuntQuery(hunt, nil),
+			"language": "kuery",
+		},
+		"filter":       []interface{}{},
+		"indexRefName": "kibanaSavedObjectMeta.searchSourceJSON.index",
+	}
+	searchSourceJSON, err := json.Marshal(searchSource)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := hunt.Columns
+	if len(columns) == 0 {
+		columns = []string{"message"}
+	}
+
+	return map[string]interface{}{
+		"type": "search",
+		"id":   huntSavedObjectID(hunt.Name),
+		"attributes": map[string]interface{}{
+			"title":       hunt.Name,
+			"description": hunt.Description,
+			"columns":     columns,
+			"sort":        [][]string{{"timestamp", "desc"}},
+			"kibanaSavedObjectMeta": map[string]interface{}{
+				"searchSourceJSON": string(searchSourceJSON),
+			},
+		},
+		"references": []map[string]interface{}{
+			{
+				"id":   "security-events",
+				"name": "kibanaSavedObjectMeta.searchSourceJSON.index",
+				"type": "index-pattern",
+			},
+		},
+	}, nil
+}
+
+// ExportHuntsNDJSON writes hunts as newline-delimited Kibana saved searches
+func ExportHuntsNDJSON(hunts []models.HuntQuery) ([]byte, error) {
+	var buf bytes.Buffer
+	for i := range hunts {
+		obj, err := HuntToKibanaSavedSearch(&hunts[i])
+		if err != nil {
+			return nil, err
+		}
+		line, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseHuntsNDJSON reads Kibana saved searches (one per line) back into hunt queries.
+// Objects that are not saved searches, such as index patterns, are skipped.
+func ParseHuntsNDJSON(data []byte) ([]models.HuntQuery, error) {
+	var hunts []models.HuntQuery
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var obj struct {
+			Type       string `json:"type"`
+			Attributes struct {
+				Title                 string   `json:"title"`
+				Description           string   `json:"description"`
+				Columns               []string `json:"columns"`
+				KibanaSavedObjectMeta struct {
+					SearchSourceJSON string `json:"searchSourceJSON"`
+				} `json:"kibanaSavedObjectMeta"`
+			} `json:"attributes"`
+		}
+		if err := json.Unmarshal(line, &obj); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		if obj.Type != "search" {
+			continue
+		}
+
+		var searchSource struct {
+			Query struct {
+				Query interface{} `json:"query"`
+			} `json:"query"`
+		}
+		if err := json.Unmarshal([]byte(obj.Attributes.KibanaSavedObjectMeta.SearchSourceJSON), &searchSource); err != nil {
+			return nil, fmt.Errorf("line %d: invalid searchSourceJSON: %v", lineNo, err)
+		}
+		query, ok := searchSource.Query.Query.(string)
+		if !ok || query == "" {
+			return nil, fmt.Errorf("line %d: saved search %q has no KQL query", lineNo, obj.Attributes.Title)
+		}
+
+		hunts = append(hunts, models.HuntQuery{
+			Name:        obj.Attributes.Title,
+			Description: obj.Attributes.Description,
+			Query:       query,
+			Columns:     obj.Attributes.Columns,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return hunts, nil
+}
@@ -0,0 +1,533 @@
+package siem
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+var (
+	// ErrIncidentClosed is returned when alerts or events are added to a closed incident
+	ErrIncidentClosed = errors.New("incident is closed, reopen it first")
+	// ErrAlertInIncident is returned when adding an alert that belongs to another incident
+	ErrAlertInIncident = errors.New("alert belongs to another incident")
+	// ErrAlertNotInIncident is returned when removing an alert the incident does not hold
+	ErrAlertNotInIncident = errors.New("alert does not belong to this incident")
+)
+
+// IncidentCorrelatorActor is the actor of the timeline entries the correlator writes
+const IncidentCorrelatorActor = "correlator"
+
+// incidentSeverityRanks orders severities, for an incident to take the highest of its alerts
+var incidentSeverityRanks = map[models.EventSeverity]int{
+	models.SeverityInfo:     1,
+	models.SeverityLow:      2,
+	models.SeverityMedium:   3,
+	models.SeverityHigh:     4,
+	models.SeverityCritical: 5,
+}
+
+// IncidentService manages incidents and keeps their timelines
+type IncidentService struct {
+	DB    *gorm.DB
+	Clock clock.Clock
+}
+
+// NewIncidentService creates a new IncidentService
+func NewIncidentService(db *gorm.DB) *IncidentService {
+	return &IncidentService{DB: db, Clock: clock.Default()}
+}
+
+// IncidentUpdate is a change of an incident's fields; nil fields are kept
+type IncidentUpdate struct {
+	Title       *string
+	Description *string
+	Status      *models.IncidentStatus
+	Severity    *models.EventSeverity
+	OwnerID     *uint // 0 removes the owner
+}
+
+// Create opens an incident holding the given alerts
+func (s *IncidentService) Create(incident *models.Incident, alertIDs []uint, actor string) error {
+	if incident.Status == "" {
+		incident.Status = models.IncidentOpen
+	}
+	if incident.Severity == "" {
+		incident.Severity = models.SeverityInfo
+	}
+	incident.CreatedBy = actor
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Owner").Create(incident).Error; err != nil {
+			return err
+		}
+		message := "Opened by " + actor
+		if incident.CorrelationKey != "" {
+			message = "Opened for alerts sharing " + incident.CorrelationKey
+		}
+		if err := addIncidentEntry(tx, incident.ID, models.IncidentEntryCreated, actor, message, nil, nil); err != nil {
+			return err
+		}
+		return s.attach(tx, incident, alertIDs, actor)
+	})
+}
+
+// AddAlerts adds alerts to an incident. Alerts already in it are skipped;
+// alerts of another incident make the whole call fail with ErrAlertInIncident.
+func (s *IncidentService) AddAlerts(incident *models.Incident, alertIDs []uint, actor string) error {
+	if incident.Status == models.IncidentClosed {
+		return ErrIncidentClosed
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		return s.attach(tx, incident, alertIDs, actor)
+	})
+}
+
+// RemoveAlert takes an alert out of an incident
+func (s *IncidentService) RemoveAlert(incident *models.Incident, alertID uint, actor string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		// updated through the loaded alert, so that its change reaches the outbox
+		var alert models.Alert
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND incident_id = ?", alertID, incident.ID).First(&alert).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAlertNotInIncident
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&alert).Update("incident_id", nil).Error; err != nil {
+			return err
+		}
+		if err := addIncidentEntry(tx, incident.ID, models.IncidentEntryAlertRemoved, actor,
+			fmt.Sprintf("Alert %d removed", alertID), &alertID, nil); err != nil {
+			return err
+		}
+		return refreshIncident(tx, incident)
+	})
+}
+
+// Update changes the fields of an incident, recording status and owner
+// changes in its timeline
+func (s *IncidentService) Update(incident *models.Incident, update IncidentUpdate, actor string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		changes := map[string]interface{}{}
+		if update.Title != nil {
+			changes["title"] = *update.Title
+		}
+		if update.Description != nil {
+			changes["description"] = *update.Description
+		}
+		if update.Severity != nil {
+			changes["severity"] = *update.Severity
+		}
+		if update.Status != nil && *update.Status != incident.Status {
+			changes["status"] = *update.Status
+			if *update.Status == models.IncidentClosed {
+				changes["closed_at"] = s.Clock.Now()
+			} else {
+				changes["closed_at"] = nil
+			}
+			if err := addIncidentEntry(tx, incident.ID, models.IncidentEntryStatusChanged, actor,
+				fmt.Sprintf("Status changed from %s to %s", incident.Status, *update.Status), nil, nil); err != nil {
+				return err
+			}
+		}
+		if update.OwnerID != nil {
+			var owner *uint
+			message := "Owner removed"
+			if *update.OwnerID != 0 {
+				owner = update.OwnerID
+				var user models.User
+				if err := tx.Select("id", "email").First(&user, *owner).Error; err != nil {
+					return err
+				}
+				message = "Assigned to " + user.Email
+			}
+			changes["owner_id"] = owner
+			if err := addIncidentEntry(tx, incident.ID, models.IncidentEntryOwnerChanged, actor, message, nil, nil); err != nil {
+				return err
+			}
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		return tx.Model(incident).Updates(changes).Error
+	})
+}
+
+// AddNote adds an analyst's note to the timeline of an incident
+func (s *IncidentService) AddNote(incident *models.Incident, message, actor string) (*models.IncidentEntry, error) {
+	entry := models.IncidentEntry{IncidentID: incident.ID, Kind: models.IncidentEntryNote, Actor: actor, Message: message}
+	if err := s.DB.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// LinkEvents links security events to an incident besides those of its
+// alerts, such as messages an analyst found while investigating it. Events
+// already linked are skipped.
+func (s *IncidentService) LinkEvents(incident *models.Incident, eventIDs []uint, actor string) error {
+	if incident.Status == models.IncidentClosed {
+		return ErrIncidentClosed
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var events []models.SecurityEvent
+		if err := tx.Select("id", "message").Where("id IN ?", eventIDs).Find(&events).Error; err != nil {
+			return err
+		}
+		if len(events) != len(uniqueIDs(eventIDs)) {
+			return gorm.ErrRecordNotFound
+		}
+
+		var linked []uint
+		if err := tx.Model(&models.IncidentEntry{}).
+			Where("incident_id = ? AND kind = ? AND security_event_id IN ?", incident.ID, models.IncidentEntryEventLinked, eventIDs).
+			Pluck("security_event_id", &linked).Error; err != nil {
+			return err
+		}
+		skip := make(map[uint]bool, len(linked))
+		for _, id := range linked {
+			skip[id] = true
+		}
+
+		for i := range events {
+			if skip[events[i].ID] {
+				continue
+			}
+			eventID := events[i].ID
+			if err := addIncidentEntry(tx, incident.ID, models.IncidentEntryEventLinked, actor,
+				fmt.Sprintf("Event %d linked: %s", eventID, events[i].Message), nil, &eventID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Events returns the security events of an incident, those its alerts were
+// raised on and those linked to it, oldest first
+func (s *IncidentService) Events(incident *models.Incident) ([]models.SecurityEvent, error) {
+	db := database.ReadDB(s.DB)
+	var events []models.SecurityEvent
+	err := db.Where("id IN (?) OR id IN (?)",
+		db.Model(&models.Alert{}).Select("security_event_id").Where("incident_id = ?", incident.ID),
+		db.Model(&models.IncidentEntry{}).Select("security_event_id").
+			Where("incident_id = ? AND kind = ?", incident.ID, models.IncidentEntryEventLinked),
+	).Order("timestamp ASC, id ASC").Find(&events).Error
+	return events, err
+}
+
+// attach adds alerts to an incident within tx
+func (s *IncidentService) attach(tx *gorm.DB, incident *models.Incident, alertIDs []uint, actor string) error {
+	alertIDs = uniqueIDs(alertIDs)
+	if len(alertIDs) == 0 {
+		return refreshIncident(tx, incident)
+	}
+
+	var alerts []models.Alert
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Rule", func(db *gorm.DB) *gorm.DB { return db.Select("id", "name") }).
+		Where("id IN ?", alertIDs).Order("timestamp ASC, id ASC").Find(&alerts).Error; err != nil {
+		return err
+	}
+	if len(alerts) != len(alertIDs) {
+		return gorm.ErrRecordNotFound
+	}
+
+	for i := range alerts {
+		alert := &alerts[i]
+		if alert.IncidentID != nil {
+			if *alert.IncidentID == incident.ID {
+				continue
+			}
+			return ErrAlertInIncident
+		}
+		// updated through the loaded alert, so that its change reaches the outbox
+		if err := tx.Model(alert).Update("incident_id", incident.ID).Error; err != nil {
+			return err
+		}
+		alertID := alert.ID
+		eventID := alert.SecurityEventID
+		if err := addIncidentEntry(tx, incident.ID, models.IncidentEntryAlertAdded, actor,
+			fmt.Sprintf("Alert %d added: %s (%s)", alert.ID, alert.Rule.Name, alert.Severity), &alertID, &eventID); err != nil {
+			return err
+		}
+	}
+	return refreshIncident(tx, incident)
+}
+
+// refreshIncident recomputes the alert count and time span of an incident
+// from its alerts, raising its severity to the highest of them
+func refreshIncident(tx *gorm.DB, incident *models.Incident) error {
+	var stats struct {
+		Count     int
+		FirstSeen *time.Time
+		LastSeen  *time.Time
+	}
+	if err := tx.Model(&models.Alert{}).
+		Select("COUNT(*) AS count, MIN(timestamp) AS first_seen, MAX(timestamp) AS last_seen").
+		Where("incident_id = ?", incident.ID).Scan(&stats).Error; err != nil {
+		return err
+	}
+	var severities []models.EventSeverity
+	if err := tx.Model(&models.Alert{}).Where("incident_id = ?", incident.ID).
+		Distinct().Pluck("severity", &severities).Error; err != nil {
+		return err
+	}
+
+	severity := incident.Severity
+	for _, s := range severities {
+		if incidentSeverityRanks[s] > incidentSeverityRanks[severity] {
+			severity = s
+		}
+	}
+	return tx.Model(incident).Updates(map[string]interface{}{
+		"alert_count": stats.Count,
+		"first_seen":  stats.FirstSeen,
+		"last_seen":   stats.LastSeen,
+		"severity":    severity,
+	}).Error
+}
+
+// addIncidentEntry appends an entry to the timeline of an incident
+func addIncidentEntry(tx *gorm.DB, incidentID uint, kind models.IncidentEntryKind, actor, message string, alertID, eventID *uint) error {
+	return tx.Create(&models.IncidentEntry{
+		IncidentID:      incidentID,
+		Kind:            kind,
+		Actor:           actor,
+		Message:         message,
+		AlertID:         alertID,
+		SecurityEventID: eventID,
+	}).Error
+}
+
+// uniqueIDs drops repeated IDs, keeping the first occurrence
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := ids[:0:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// incidentKeyPriority orders the correlation keys an alert is grouped by,
+// the most specific first
+var incidentKeyPriority = []string{"vehicle:", "ip:", "threat:"}
+
+// incidentKeyRank is the position of a correlation key's kind in incidentKeyPriority
+func incidentKeyRank(key string) int {
+	for rank, prefix := range incidentKeyPriority {
+		if strings.HasPrefix(key, prefix) {
+			return rank
+		}
+	}
+	return len(incidentKeyPriority)
+}
+
+// incidentKeys are the correlation keys of an alert: the V2X source of its
+// event, the source IP of its event and the V2X threats of its rule
+func incidentKeys(alert *models.Alert) []string {
+	var keys []string
+	if obs, ok := ParseV2XObservation(&alert.SecurityEvent, ""); ok && obs.VehicleID != "" {
+		keys = append(keys, "vehicle:"+obs.VehicleID)
+	}
+	if alert.SecurityEvent.SourceIP != "" {
+		keys = append(keys, "ip:"+alert.SecurityEvent.SourceIP)
+	}
+	for _, threat := range alert.V2XThreats {
+		keys = append(keys, "threat:"+threat)
+	}
+	return keys
+}
+
+// incidentTitle names an incident the correlator opens for a key
+func incidentTitle(key string) string {
+	kind, value, _ := strings.Cut(key, ":")
+	switch kind {
+	case "vehicle":
+		return "Alerts on V2X source " + value
+	case "ip":
+		return "Alerts from " + value
+	default:
+		return "Alerts on V2X threat " + value
+	}
+}
+
+// IncidentCorrelator groups the alerts no incident holds yet: an alert joins
+// the open incident of the correlator sharing its vehicle, source IP or V2X
+// threat (in that order) when that incident saw an alert within the window,
+// and alerts sharing one of those keys open a new incident once there are
+// MinAlerts of them within the window
+type IncidentCorrelator struct {
+	DB        *gorm.DB
+	Clock     clock.Clock
+	Service   *IncidentService
+	Window    time.Duration // between related alerts
+	Interval  time.Duration // between runs
+	MinAlerts int           // related alerts opening an incident
+}
+
+var (
+	incidentWindowMinutes   = config.NewInt("INCIDENT_CORRELATION_WINDOW_MINUTES", 30, "Minutes within which related alerts are grouped into an incident", config.Min(1))
+	incidentMinAlerts       = config.NewInt("INCIDENT_CORRELATION_MIN_ALERTS", 2, "Related alerts opening an incident", config.Min(1))
+	incidentIntervalSeconds = config.NewInt("INCIDENT_CORRELATION_INTERVAL_SECONDS", 60, "Seconds between incident correlation runs", config.Min(1))
+)
+
+// NewIncidentCorrelator creates a correlator configured from
+// INCIDENT_CORRELATION_WINDOW_MINUTES (default 30),
+// INCIDENT_CORRELATION_MIN_ALERTS (default 2) and
+// INCIDENT_CORRELATION_INTERVAL_SECONDS (default 60)
+func NewIncidentCorrelator(db *gorm.DB) *IncidentCorrelator {
+	service := NewIncidentService(db)
+	return &IncidentCorrelator{
+		DB:        db,
+		Clock:     service.Clock,
+		Service:   service,
+		Window:    time.Duration(incidentWindowMinutes.Get()) * time.Minute,
+		Interval:  time.Duration(incidentIntervalSeconds.Get()) * time.Second,
+		MinAlerts: incidentMinAlerts.Get(),
+	}
+}
+
+// IncidentCorrelation is what a correlation run did
+type IncidentCorrelation struct {
+	Opened   []models.Incident `json:"opened"`
+	Attached int               `json:"attached"` // alerts added to incidents opened before
+}
+
+// Correlate groups the active alerts of the window ending at now that no
+// incident holds. Closed and false positive alerts are left alone.
+func (c *IncidentCorrelator) Correlate(now time.Time) (IncidentCorrelation, error) {
+	var result IncidentCorrelation
+	since := now.Add(-c.Window)
+
+	var alerts []models.Alert
+	if err := c.DB.Preload("SecurityEvent").
+		Where("incident_id IS NULL AND timestamp >= ? AND status IN ?", since,
+			[]models.AlertStatus{models.AlertStatusOpen, models.AlertStatusInProgress, models.AlertStatusConfirmedMalicious}).
+		Order("timestamp ASC, id ASC").Find(&alerts).Error; err != nil {
+		return result, err
+	}
+	if len(alerts) == 0 {
+		return result, nil
+	}
+
+	// the open incidents of the correlator alerts of the window may join
+	var incidents []models.Incident
+	if err := c.DB.Where("status <> ? AND correlation_key <> '' AND last_seen >= ?", models.IncidentClosed, since.Add(-c.Window)).
+		Order("last_seen DESC").Find(&incidents).Error; err != nil {
+		return result, err
+	}
+	byKey := make(map[string]*models.Incident, len(incidents))
+	for i := range incidents {
+		if _, ok := byKey[incidents[i].CorrelationKey]; !ok {
+			byKey[incidents[i].CorrelationKey] = &incidents[i]
+		}
+	}
+
+	joining := make(map[uint][]uint) // incident ID to the alerts joining it
+	pending := make(map[string][]*models.Alert)
+	var keys []string
+	for i := range alerts {
+		alert := &alerts[i]
+		alertKeys := incidentKeys(alert)
+		sort.SliceStable(alertKeys, func(a, b int) bool { return incidentKeyRank(alertKeys[a]) < incidentKeyRank(alertKeys[b]) })
+
+		joined := false
+		for _, key := range alertKeys {
+			incident, ok := byKey[key]
+			if !ok || incident.LastSeen == nil || alert.Timestamp.Sub(*incident.LastSeen) > c.Window {
+				continue
+			}
+			joining[incident.ID] = append(joining[incident.ID], alert.ID)
+			if alert.Timestamp.After(*incident.LastSeen) {
+				seen := alert.Timestamp
+				incident.LastSeen = &seen
+			}
+			joined = true
+			break
+		}
+		if joined {
+			continue
+		}
+		for _, key := range alertKeys {
+			if _, ok := pending[key]; !ok {
+				keys = append(keys, key)
+			}
+			pending[key] = append(pending[key], alert)
+		}
+	}
+
+	for i := range incidents {
+		alertIDs := joining[incidents[i].ID]
+		if len(alertIDs) == 0 {
+			continue
+		}
+		if err := c.Service.AddAlerts(&incidents[i], alertIDs, IncidentCorrelatorActor); err != nil {
+			return result, err
+		}
+		result.Attached += len(alertIDs)
+	}
+
+	// the most specific keys open incidents first; an alert goes to one incident
+	sort.SliceStable(keys, func(a, b int) bool { return incidentKeyRank(keys[a]) < incidentKeyRank(keys[b]) })
+	grouped := make(map[uint]bool)
+	for _, key := range keys {
+		var alertIDs []uint
+		for _, alert := range pending[key] {
+			if !grouped[alert.ID] {
+				alertIDs = append(alertIDs, alert.ID)
+			}
+		}
+		if len(alertIDs) < c.MinAlerts {
+			continue
+		}
+
+		incident := models.Incident{Title: incidentTitle(key), CorrelationKey: key}
+		if err := c.Service.Create(&incident, alertIDs, IncidentCorrelatorActor); err != nil {
+			return result, err
+		}
+		for _, id := range alertIDs {
+			grouped[id] = true
+		}
+		result.Opened = append(result.Opened, incident)
+	}
+	return result, nil
+}
+
+// Start runs the correlation every Interval
+func (c *IncidentCorrelator) Start() {
+	go func() {
+		ticker := time.NewTicker(c.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			result, err := c.Correlate(c.Clock.Now())
+			if err != nil {
+				log.Printf("Error correlating alerts into incidents: %v", err)
+				continue
+			}
+			if len(result.Opened) > 0 || result.Attached > 0 {
+				log.Printf("Opened %d incidents and added %d alerts to open ones", len(result.Opened), result.Attached)
+			}
+		}
+	}()
+
+	log.Printf("Incident correlation started with %s windows", c.Window)
+}
@@ -0,0 +1,193 @@
+package siem
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/metrics"
+)
+
+// ingestLog is the logger of the ingest pool and the ingesters
+var ingestLog = logging.New("ingest")
+
+// ErrIngestQueueFull is returned when the ingest queue has no room for more work
+var ErrIngestQueueFull = errors.New("ingest queue is full")
+
+// Drop policies applied by IngestPool.Submit when the queue is full
+const (
+	DropNewest = "newest" // the submitted work is dropped
+	DropOldest = "oldest" // the longest-queued work is dropped to make room
+)
+
+var (
+	ingestDropped = metrics.NewCounterVec("siem_ingest_dropped_total",
+		"Messages dropped because the ingest queue was full, by input", "input")
+	_ = metrics.NewGaugeFunc("siem_ingest_queue_depth",
+		"Messages waiting in the ingest queue", func() float64 { return float64(DefaultIngestPool().Depth()) })
+	_ = metrics.NewGaugeFunc("siem_ingest_queue_capacity",
+		"Capacity of the ingest queue", func() float64 { return float64(DefaultIngestPool().QueueSize) })
+)
+
+var (
+	ingestWorkers    = config.NewInt("INGEST_WORKERS", 16, "Workers ingesting queued messages", config.Min(1))
+	ingestQueueSize  = config.NewInt("INGEST_QUEUE_SIZE", 10000, "Messages the ingest queue holds", config.Min(1))
+	ingestDropPolicy = config.NewString("INGEST_DROP_POLICY", DropNewest, "Message dropped when the ingest queue is full: newest or oldest",
+		config.OneOf(DropNewest, DropOldest))
+)
+
+// ingestJob is queued ingestion work
+type ingestJob struct {
+	input   string
+	run     func()
+	dropped func() // called instead of run when the job is dropped
+}
+
+// IngestPool runs ingestion work on a fixed number of workers fed by a
+// bounded queue, so a flood of packets waits in the queue or is dropped
+// instead of starting a goroutine and a database transaction per packet
+type IngestPool struct {
+	Workers    int
+	QueueSize  int
+	DropPolicy string
+
+	jobs chan ingestJob
+	once sync.Once
+}
+
+// NewIngestPoolFromEnv configures a pool from INGEST_WORKERS (default 16),
+// INGEST_QUEUE_SIZE (default 10000) and INGEST_DROP_POLICY (newest or oldest,
+// default newest)
+func NewIngestPoolFromEnv() *IngestPool {
+	policy := ingestDropPolicy.Get()
+	if policy != DropOldest {
+		policy = DropNewest
+	}
+	return &IngestPool{
+		Workers:    ingestWorkers.Get(),
+		QueueSize:  ingestQueueSize.Get(),
+		DropPolicy: policy,
+	}
+}
+
+var (
+	defaultIngestPool     *IngestPool
+	defaultIngestPoolOnce sync.Once
+)
+
+// DefaultIngestPool returns the pool shared by the collectors and the ingest API
+func DefaultIngestPool() *IngestPool {
+	defaultIngestPoolOnce.Do(func() {
+		defaultIngestPool = NewIngestPoolFromEnv()
+	})
+	return defaultIngestPool
+}
+
+// start creates the queue and the workers on first use
+func (p *IngestPool) start() {
+	p.once.Do(func() {
+		p.jobs = make(chan ingestJob, p.QueueSize)
+		for i := 0; i < p.Workers; i++ {
+			go func() {
+				for job := range p.jobs {
+					job.run()
+				}
+			}()
+		}
+		ingestLog.Info("ingest pool started", "workers", p.Workers, "queue", p.QueueSize, "drop_policy", p.DropPolicy)
+	})
+}
+
+// Depth returns the number of queued jobs
+func (p *IngestPool) Depth() int {
+	p.start()
+	return len(p.jobs)
+}
+
+// Submit queues work from an input that cannot be slowed down, such as a UDP
+// socket. When the queue is full the work, or under DropOldest the
+// longest-queued work, is dropped and its dropped func called. It reports
+// whether the work was queued.
+func (p *IngestPool) Submit(input string, work, dropped func()) bool {
+	p.start()
+	job := ingestJob{input: input, run: work, dropped: dropped}
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+	}
+
+	if p.DropPolicy == DropOldest {
+		select {
+		case oldest := <-p.jobs:
+			p.drop(oldest)
+		default:
+		}
+		select {
+		case p.jobs <- job:
+			return true
+		default:
+		}
+	}
+	p.drop(job)
+	return false
+}
+
+// Do queues work and waits for it to finish. It fails with ErrIngestQueueFull
+// without queueing when the queue is full, so API callers can be told to retry.
+func (p *IngestPool) Do(ctx context.Context, input string, work func()) error {
+	p.start()
+	done := make(chan error, 1)
+	job := ingestJob{
+		input:   input,
+		run:     func() { work(); done <- nil },
+		dropped: func() { done <- ErrIngestQueueFull },
+	}
+	select {
+	case p.jobs <- job:
+	default:
+		ingestDropped.Inc(input)
+		return ErrIngestQueueFull
+	}
+	return p.wait(ctx, done)
+}
+
+// Wait queues work, waiting for room in the queue, and waits for it to
+// finish. Stream inputs use it so a full queue slows down the sender.
+func (p *IngestPool) Wait(ctx context.Context, input string, work func()) error {
+	p.start()
+	done := make(chan error, 1)
+	job := ingestJob{
+		input:   input,
+		run:     func() { work(); done <- nil },
+		dropped: func() { done <- ErrIngestQueueFull },
+	}
+	select {
+	case p.jobs <- job:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.wait(ctx, done)
+}
+
+// wait returns when a queued job has run or been dropped. Once queued, the
+// job runs even if ctx is done, so work must not depend on the caller.
+func (p *IngestPool) wait(ctx context.Context, done chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drop counts a dropped job and notifies its submitter
+func (p *IngestPool) drop(job ingestJob) {
+	ingestDropped.Inc(job.input)
+	ingestLog.Sampled("ingest.dropped:"+job.input).Warn("ingest queue full, dropped a message", "input", job.input)
+	if job.dropped != nil {
+		job.dropped()
+	}
+}
@@ -1,26 +1,49 @@
 package siem
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/metrics"
 	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
 )
 
-// EventIngester handles ingestion of security events from various sources
+var (
+	eventsIngested = metrics.NewCounterVec("siem_events_ingested_total",
+		"Security events stored, including the findings raised about them, by log source", "source")
+
+	// ParseFailures counts messages dropped because they could not be parsed,
+	// by the collector or API that received them
+	ParseFailures = metrics.NewCounterVec("siem_parse_failures_total",
+		"Messages that could not be parsed into a security event, by input", "input")
+)
+
+// EventIngester handles ingestion of security events from various sources.
+// It holds no per-event state, so one ingester can be shared by collectors and
+// HTTP workers ingesting concurrently.
 type EventIngester struct {
-	DB *gorm.DB
+	DB    *gorm.DB
+	Clock clock.Clock
+	Log   *logging.Logger
+
+	// EvaluateRules runs the enhanced rule engine on each event in the same
+	// transaction that stores it, so the event and its alerts commit together
+	EvaluateRules bool
 }
 
 // NewEventIngester creates a new EventIngester
 func NewEventIngester(db *gorm.DB) *EventIngester {
-	return &EventIngester{DB: db}
+	return &EventIngester{DB: db, Clock: clock.Default(), Log: ingestLog}
 }
 
 
-// RawEvent represents a raw security event before normalization
+// RawEvent represents a raw security event before normalization. Clients
+// build it with eventschema.Event and its typed details.
 type RawEvent struct {
 	SourceName 		string			`json:"source_name"`
 	SourceType		string			`json:"source_type"`
@@ -32,38 +55,171 @@ type RawEvent struct {
 }
 
 
+// IngestResult is the outcome of ingesting one event
+type IngestResult struct {
+	EventID uint                  `json:"event_id"`
+	Event   *models.SecurityEvent `json:"-"`
+	Alerts  []models.Alert        `json:"alerts"` // raised by the rules, when the ingester evaluates them
+
+	// Findings are events the SIEM raised about this one, such as a V2X
+	// message signed by a revoked certificate; their alerts are in Alerts
+	Findings []*models.SecurityEvent `json:"-"`
+}
+
+// Events returns the ingested event followed by its findings, the events to
+// index and route
+func (r *IngestResult) Events() []*models.SecurityEvent {
+	return append([]*models.SecurityEvent{r.Event}, r.Findings...)
+}
+
 // IngestEvent processes a raw event, normalizes it, and stores it
-func (e *EventIngester) IngestEvent(rawEventData []byte) error {
-	//Parse the raw event
-	var rawEvent RawEvent
-	if err := json.Unmarshal(rawEventData, &rawEvent); err != nil {
-		return err
+func (e *EventIngester) IngestEvent(ctx context.Context, rawEventData []byte) error {
+	_, err := e.Ingest(ctx, rawEventData)
+	return err
+}
+
+// Ingest processes a raw event like IngestEvent and returns the stored event
+// and any alerts it raised. Cancelling ctx aborts the database work and rolls
+// back the event; a cost sample attached with WithCostSample is charged, the
+// message is counted against a source attached with WithParseSource, the
+// event belongs to the tenant attached with WithOrganization, and to the log
+// source attached with WithLogSource. The event, its findings and their alerts
+// carry the correlation ID of ctx, a new one when it has none.
+func (e *EventIngester) Ingest(ctx context.Context, rawEventData []byte) (*IngestResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
+	ctx = logging.EnsureCorrelationID(ctx)
+	sample := costSampleFrom(ctx)
 
-	// Find or create the log source
-	var logSource models.LogSource
-	result := e.DB.Where("name = ?", rawEvent.SourceName).First(&logSource)
-	if result.Error != nil {
-		// create a new log source if it doesn't exist
-		logSource = models.LogSource{
-			Name:		rawEvent.SourceName,
-			Type:		models.LogSourceType(rawEvent.SourceType),
-			Description:	"Auto-created from ingested event",
-			Enabled:	true,
+	result := &IngestResult{}
+	err := e.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		event, err := e.store(tx, rawEventData, logSourceFrom(ctx))
+		if err != nil {
+			return err
 		}
-		if err := e.DB.Create(&logSource).Error; err != nil {
+		result.EventID = event.ID
+		result.Event = event
+		sample.Stage("ingest")
+
+		// flag V2X messages signed by revoked certificates with an event of their own
+		signer, err := FindRevokedSigner(tx, event)
+		if err != nil {
+			return err
+		}
+		if signer != nil {
+			findingData, err := RevokedSignerEvent(event, signer)
+			if err != nil {
+				return err
+			}
+			finding, err := e.store(tx, findingData, 0)
+			if err != nil {
+				return err
+			}
+			result.Findings = append(result.Findings, finding)
+			sample.Stage("crl")
+		}
+
+		// run the V2X anomaly detectors, recording each anomaly as an event of its own
+		anomalies, err := DetectAnomalies(tx, event)
+		if err != nil {
 			return err
 		}
+		for _, findingData := range anomalies {
+			finding, err := e.store(tx, findingData, 0)
+			if err != nil {
+				return err
+			}
+			result.Findings = append(result.Findings, finding)
+		}
+		sample.Stage("anomaly")
+
+		if e.EvaluateRules {
+			engine := &EnhancedRuleEngine{DB: tx, Clock: e.Clock, Log: ruleEngineLog}
+			for _, evaluated := range append([]*models.SecurityEvent{event}, result.Findings...) {
+				alerts, err := engine.Evaluate(evaluated)
+				if err != nil {
+					return err
+				}
+				result.Alerts = append(result.Alerts, alerts...)
+			}
+			sample.Stage("rules")
+		}
+		return nil
+	})
+	recordIngestParse(ctx, err)
+	if err != nil {
+		// a log source created by the rolled back transaction may have been cached
+		var parseErr *eventParseError
+		if !errors.As(err, &parseErr) {
+			defaultLogSources.invalidate()
+		}
+		e.Log.WithContext(ctx).Debug("event not ingested", "error", err)
+		return nil, err
+	}
+
+	for _, event := range result.Events() {
+		eventsIngested.Inc(event.LogSource.Name)
+	}
+	return result, nil
+}
+
+// store normalizes a raw event and saves it with tx, under the log source
+// with logSourceID or, when it is 0, the one the event names
+func (e *EventIngester) store(tx *gorm.DB, rawEventData []byte, logSourceID uint) (*models.SecurityEvent, error) {
+	// Turn RSU vendor syslog lines into v2x events
+	vendorParsed, err := ApplyVendorPatterns(tx, rawEventData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Map third-party field names onto the ingest schema before parsing
+	transformed, err := NewTransformEngine(tx).Apply(vendorParsed)
+	if err != nil {
+		return nil, err
+	}
+
+	//Parse the raw event
+	var rawEvent RawEvent
+	if err := json.Unmarshal(transformed, &rawEvent); err != nil {
+		ParseFailures.Inc("event_json")
+		return nil, &eventParseError{err: err}
+	}
+
+	// Events without a timestamp are stamped on arrival; replay clocks follow the message time instead
+	if rawEvent.Timestamp.IsZero() {
+		rawEvent.Timestamp = e.Clock.Now()
+	} else if observer, ok := e.Clock.(clock.Observer); ok {
+		observer.Observe(rawEvent.Timestamp)
+	}
+
+	// Find or create the log source, unless the event is bound to one
+	var logSource *models.LogSource
+	if logSourceID != 0 {
+		logSource, err = defaultLogSources.lookupID(tx, logSourceID)
+	} else {
+		logSource, err = findOrCreateLogSource(tx, &rawEvent)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Translate the source's severity scale into SIEM severities
+	severity, err := MapSeverity(tx, logSource, rawEvent.Severity)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create the security event
 	securityEvent := models.SecurityEvent{
 		Timestamp:	rawEvent.Timestamp,
 		LogSourceID:	logSource.ID,
-		Severity:	models.EventSeverity(rawEvent.Severity),
+		Severity:	severity,
 		Category:	models.EventCategory(rawEvent.Category),
 		Message:	rawEvent.Message,
-		RawData:	string(rawEventData),
+		RawData:	string(vendorParsed), // vendor-parsed lines keep their parsed details; the line itself stays in the message
+		OrganizationID:	organizationFrom(tx.Statement.Context),
+		CorrelationID:	logging.CorrelationID(tx.Statement.Context),
 	}
 
 	// Extract common fields from details if present
@@ -92,25 +248,86 @@ func (e *EventIngester) IngestEvent(rawEventData []byte) error {
 		if status, ok := rawEvent.Details["status"].(string); ok {
 			securityEvent.Status = status
 		}
-		if deviceID, ok := rawEvent.Details["devide_id"].(string); ok {
+		// devide_id is the misspelt key read before device_id, which older senders still use
+		deviceID, ok := rawEvent.Details["device_id"].(string)
+		if !ok {
+			deviceID, ok = rawEvent.Details["devide_id"].(string)
+		}
+		if ok {
 			securityEvent.DeviceID = deviceID
 		}
+
+		// V2X messages, and the findings about them, carry the trust score of their source
+		if sourceID, ok := rawEvent.Details["vehicle_id"].(string); ok && sourceID != "" &&
+			(securityEvent.Category == models.CategoryV2X || securityEvent.Category == models.CategoryVehicle) {
+			score, err := SourceTrustScore(tx, sourceID)
+			if err != nil {
+				return nil, err
+			}
+			securityEvent.TrustScore = &score
+		}
 	}
 
 
 	// save the security event
-	if err := e.DB.Create(&securityEvent).Error; err != nil {
-		return err
+	if err := tx.Create(&securityEvent).Error; err != nil {
+		return nil, err
 	}
+	securityEvent.LogSource = *logSource
 
-	log.Printf("Ingested security event: %s (ID: %d)", securityEvent.Message, securityEvent.ID)
-	return nil
+	e.Log.WithContext(tx.Statement.Context).Sampled("ingest.event").Info("security event ingested",
+		"event_id", securityEvent.ID, "source", logSource.Name, "category", securityEvent.Category, "message", securityEvent.Message)
+	return &securityEvent, nil
 }
 
+type logSourceContextKey struct{}
 
+// WithLogSource returns ctx binding the events the ingester stores to a log
+// source, such as the one of the API key they were sent with, whatever source
+// they name. The findings raised about them keep their own sources.
+func WithLogSource(ctx context.Context, logSourceID uint) context.Context {
+	return context.WithValue(ctx, logSourceContextKey{}, logSourceID)
+}
 
+// logSourceFrom returns the log source bound by ctx, or 0
+func logSourceFrom(ctx context.Context) uint {
+	logSourceID, _ := ctx.Value(logSourceContextKey{}).(uint)
+	return logSourceID
+}
 
+// findOrCreateLogSource returns the log source named by the event, creating it
+// on first sight. Creation holds a transaction-scoped advisory lock on the name,
+// so concurrent ingesters seeing a new source create it only once.
+func findOrCreateLogSource(tx *gorm.DB, rawEvent *RawEvent) (*models.LogSource, error) {
+	cached, err := defaultLogSources.lookupName(tx, rawEvent.SourceName)
+	if err == nil {
+		return cached, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
 
+	var logSource models.LogSource
 
-
-
+	err = tx.Transaction(func(lockTx *gorm.DB) error {
+		if err := lockTx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "log_source:"+rawEvent.SourceName).Error; err != nil {
+			return err
+		}
+		// another ingester may have created it while we waited for the lock
+		err := lockTx.Where("name = ?", rawEvent.SourceName).First(&logSource).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		logSource = models.LogSource{
+			Name:        rawEvent.SourceName,
+			Type:        models.LogSourceType(rawEvent.SourceType),
+			Description: "Auto-created from ingested event",
+			Enabled:     true,
+		}
+		return lockTx.Create(&logSource).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &logSource, nil
+}
@@ -0,0 +1,149 @@
+package siem
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/eventschema"
+	"traffic-monitoring-go/app/models"
+)
+
+const (
+	// MaxSPaTVerifyWindow bounds the time range of one SPaT verification
+	MaxSPaTVerifyWindow = 24 * time.Hour
+
+	// spatTransitionTolerance is how far from a state change a SPaT may still
+	// report the previous or next state, for clock skew and timestamp rounding
+	spatTransitionTolerance = time.Second
+
+	// maxSPaTMismatches bounds the mismatches listed in a verification
+	maxSPaTMismatches = 100
+)
+
+// NormalizeSyntheticIntersection trims an intersection's name and validates
+// it; every violation is reported in a *models.ValidationError
+func NormalizeSyntheticIntersection(intersection *models.SyntheticIntersection) error {
+	intersection.Name = strings.TrimSpace(intersection.Name)
+	for i := range intersection.TimingPlans {
+		plan := &intersection.TimingPlans[i]
+		plan.Name, plan.From, plan.To = strings.TrimSpace(plan.Name), strings.TrimSpace(plan.From), strings.TrimSpace(plan.To)
+	}
+	return intersection.Validate().Err()
+}
+
+// SPaTMismatch is a signal group whose broadcast state contradicts the timing plan
+type SPaTMismatch struct {
+	EventID     uint      `json:"event_id"`
+	Timestamp   time.Time `json:"timestamp"`
+	SenderID    string    `json:"sender_id"`
+	SignalGroup int       `json:"signal_group"`
+	Reported    string    `json:"reported"` // empty when the message omits the group
+	Expected    string    `json:"expected"` // empty when the plan has no such group
+}
+
+// SPaTVerification compares the SPaT messages of an intersection stored in a
+// time range with the states its timing plans prescribe
+type SPaTVerification struct {
+	IntersectionID int            `json:"intersection_id"`
+	From           time.Time      `json:"from"`
+	To             time.Time      `json:"to"`
+	Messages       int            `json:"messages"`
+	Consistent     int            `json:"consistent"` // messages whose every signal group matches
+	MismatchCount  int            `json:"mismatch_count"`
+	Mismatches     []SPaTMismatch `json:"mismatches"` // the first 100
+}
+
+// VerifySPaT checks every SPaT message stored for an intersection between from
+// and to against its timing plans. A state within a second of a change
+// counts as matching either side of it.
+func VerifySPaT(db *gorm.DB, intersection *models.SyntheticIntersection, from, to time.Time) (SPaTVerification, error) {
+	result := SPaTVerification{
+		IntersectionID: intersection.IntersectionID,
+		From:           from,
+		To:             to,
+		Mismatches:     []SPaTMismatch{},
+	}
+	if !to.After(from) {
+		return result, errors.New("to must be after from")
+	}
+	if to.Sub(from) > MaxSPaTVerifyWindow {
+		return result, errors.New("the time range may span at most 24 hours")
+	}
+	scenario := intersection.Scenario()
+
+	// batches go by ID, which pages them; the verification does not depend on order
+	var events []models.SecurityEvent
+	err := db.Where("category = ?", models.CategoryV2X).
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		FindInBatches(&events, 500, func(tx *gorm.DB, batch int) error {
+			for i := range events {
+				event := &events[i]
+				obs, ok := ParseV2XObservation(event, "")
+				if !ok || !strings.EqualFold(obs.MessageType, eventschema.MessageSPaT) {
+					continue
+				}
+				var raw struct {
+					Details eventschema.V2XDetails `json:"details"`
+				}
+				if err := json.Unmarshal([]byte(event.RawData), &raw); err != nil || raw.Details.IntersectionID != intersection.IntersectionID {
+					continue
+				}
+
+				mismatches := compareSPaT(scenario, event.Timestamp, raw.Details.SignalStates)
+				result.Messages++
+				if len(mismatches) == 0 {
+					result.Consistent++
+				}
+				result.MismatchCount += len(mismatches)
+				for _, mismatch := range mismatches {
+					if len(result.Mismatches) == maxSPaTMismatches {
+						break
+					}
+					mismatch.EventID, mismatch.Timestamp, mismatch.SenderID = event.ID, event.Timestamp, obs.VehicleID
+					result.Mismatches = append(result.Mismatches, mismatch)
+				}
+			}
+			return nil
+		}).Error
+	return result, err
+}
+
+// compareSPaT lists the signal groups of a SPaT whose state the intersection's
+// plans do not prescribe at the time it was generated
+func compareSPaT(scenario eventschema.Intersection, at time.Time, reported []eventschema.SignalState) []SPaTMismatch {
+	truth := scenario.SignalStates(at)
+	expected := make(map[int]string, len(truth))
+	for _, state := range truth {
+		expected[state.SignalGroup] = state.State
+	}
+	// the states just before and after, which a SPaT near a change may show
+	nearby := make(map[int]map[string]bool)
+	for _, shifted := range []time.Time{at.Add(-spatTransitionTolerance), at.Add(spatTransitionTolerance)} {
+		for _, state := range scenario.SignalStates(shifted) {
+			if nearby[state.SignalGroup] == nil {
+				nearby[state.SignalGroup] = make(map[string]bool)
+			}
+			nearby[state.SignalGroup][state.State] = true
+		}
+	}
+
+	var mismatches []SPaTMismatch
+	seen := make(map[int]bool)
+	for _, state := range reported {
+		seen[state.SignalGroup] = true
+		want, known := expected[state.SignalGroup]
+		if known && (state.State == want || nearby[state.SignalGroup][state.State]) {
+			continue
+		}
+		mismatches = append(mismatches, SPaTMismatch{SignalGroup: state.SignalGroup, Reported: state.State, Expected: want})
+	}
+	for _, state := range truth {
+		if !seen[state.SignalGroup] {
+			mismatches = append(mismatches, SPaTMismatch{SignalGroup: state.SignalGroup, Expected: state.State})
+		}
+	}
+	return mismatches
+}
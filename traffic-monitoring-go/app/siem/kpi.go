@@ -0,0 +1,206 @@
+package siem
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// KPIService computes and persists standard V2X performance indicators
+type KPIService struct {
+	DB             *gorm.DB
+	Clock          clock.Clock
+	NeighborRadius float64 // meters within which two vehicles count as neighbours
+}
+
+var (
+	kpiNeighborRadius  = config.NewFloat("KPI_NEIGHBOR_RADIUS_M", 300, "Meters within which two vehicles count as neighbours in the KPIs", config.Positive)
+	kpiIntervalMinutes = config.NewInt("KPI_INTERVAL_MINUTES", 5, "Minutes of each KPI interval", config.Min(1))
+)
+
+// NewKPIService creates a new KPIService
+func NewKPIService(db *gorm.DB) *KPIService {
+	return &KPIService{DB: db, Clock: clock.Default(), NeighborRadius: kpiNeighborRadius.Get()}
+}
+
+// ComputeInterval computes the KPIs of every vehicle and RSU seen in [start, end)
+// and replaces any records previously stored for that interval
+func (s *KPIService) ComputeInterval(start, end time.Time) ([]models.V2XKPI, error) {
+	var events []models.SecurityEvent
+	err := s.DB.Preload("LogSource").
+		Where("category = ? AND created_at >= ? AND created_at < ?", models.CategoryV2X, start, end).
+		Order("created_at ASC").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byVehicle := make(map[string][]V2XObservation)
+	byReceiver := make(map[string][]V2XObservation)
+	for i := range events {
+		obs, ok := ParseV2XObservation(&events[i], events[i].LogSource.Name)
+		if !ok {
+			continue
+		}
+		byVehicle[obs.VehicleID] = append(byVehicle[obs.VehicleID], obs)
+		if obs.Receiver != "" {
+			byReceiver[obs.Receiver] = append(byReceiver[obs.Receiver], obs)
+		}
+	}
+
+	// last known position of each vehicle, for neighbour density
+	type position struct{ lat, lon float64 }
+	positions := make(map[string]position)
+	for vehicleID, observations := range byVehicle {
+		for i := len(observations) - 1; i >= 0; i-- {
+			if observations[i].HasLocation {
+				positions[vehicleID] = position{observations[i].Latitude, observations[i].Longitude}
+				break
+			}
+		}
+	}
+
+	kpis := make([]models.V2XKPI, 0, len(byVehicle)+len(byReceiver))
+
+	for vehicleID, observations := range byVehicle {
+		kpi := kpiFromObservations(models.KPIEntityVehicle, vehicleID, start, end, observations)
+
+		if own, ok := positions[vehicleID]; ok {
+			neighbors := 0
+			for otherID, other := range positions {
+				if otherID != vehicleID && DistanceMeters(own.lat, own.lon, other.lat, other.lon) <= s.NeighborRadius {
+					neighbors++
+				}
+			}
+			kpi.NeighborDensity = float64(neighbors)
+		}
+
+		kpis = append(kpis, kpi)
+	}
+
+	for receiver, observations := range byReceiver {
+		kpi := kpiFromObservations(models.KPIEntityRSU, receiver, start, end, observations)
+
+		vehicles := make(map[string]bool)
+		for _, obs := range observations {
+			vehicles[obs.VehicleID] = true
+		}
+		kpi.NeighborDensity = float64(len(vehicles))
+
+		kpis = append(kpis, kpi)
+	}
+
+	sort.Slice(kpis, func(i, j int) bool {
+		if kpis[i].EntityType != kpis[j].EntityType {
+			return kpis[i].EntityType < kpis[j].EntityType
+		}
+		return kpis[i].EntityID < kpis[j].EntityID
+	})
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("interval_start = ? AND interval_end = ?", start, end).Delete(&models.V2XKPI{}).Error; err != nil {
+			return err
+		}
+		if len(kpis) == 0 {
+			return nil
+		}
+		return tx.Create(&kpis).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return kpis, nil
+}
+
+// kpiFromObservations computes inter-reception time and information age for a set of messages
+func kpiFromObservations(entityType models.KPIEntityType, entityID string, start, end time.Time, observations []V2XObservation) models.V2XKPI {
+	kpi := models.V2XKPI{
+		IntervalStart: start,
+		IntervalEnd:   end,
+		EntityType:    entityType,
+		EntityID:      entityID,
+		MessageCount:  len(observations),
+	}
+
+	// inter-reception time is per transmitter, so group by vehicle first
+	lastReceived := make(map[string]time.Time)
+	var pir, age []float64
+	for _, obs := range observations {
+		if last, ok := lastReceived[obs.VehicleID]; ok {
+			pir = append(pir, float64(obs.Received.Sub(last))/float64(time.Millisecond))
+		}
+		lastReceived[obs.VehicleID] = obs.Received
+
+		if !obs.Generated.IsZero() && !obs.Received.IsZero() {
+			age = append(age, float64(obs.Received.Sub(obs.Generated))/float64(time.Millisecond))
+		}
+	}
+
+	kpi.PIRMeanMs, kpi.PIRP95Ms = meanAndP95(pir)
+	kpi.InfoAgeMeanMs, kpi.InfoAgeP95Ms = meanAndP95(age)
+	return kpi
+}
+
+// meanAndP95 returns the mean and 95th percentile, or nils for an empty sample
+func meanAndP95(values []float64) (*float64, *float64) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	mean := sum / float64(len(sorted))
+
+	index := int(float64(len(sorted))*0.95+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	p95 := sorted[index]
+
+	return &mean, &p95
+}
+
+// lastInterval returns the last interval of the given length completed by
+// the service's clock, aligned to multiples of the length
+func (s *KPIService) lastInterval(interval time.Duration) (start, end time.Time) {
+	end = s.Clock.Now().Truncate(interval)
+	return end.Add(-interval), end
+}
+
+// StartKPIScheduler computes the KPIs of each completed interval in the background.
+// The interval length comes from KPI_INTERVAL_MINUTES (default 5).
+func (s *KPIService) StartKPIScheduler() {
+	interval := time.Duration(kpiIntervalMinutes.Get()) * time.Minute
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			start, end := s.lastInterval(interval)
+			kpis, err := s.ComputeInterval(start, end)
+			if err != nil {
+				log.Printf("Error computing V2X KPIs for %s: %v", start.Format(time.RFC3339), err)
+				continue
+			}
+			log.Printf("Computed %d V2X KPI records for %s", len(kpis), start.Format(time.RFC3339))
+		}
+	}()
+
+	log.Printf("V2X KPI scheduler started with %s intervals", interval)
+}
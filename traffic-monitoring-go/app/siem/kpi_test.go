@@ -0,0 +1,64 @@
+package siem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+func TestKPILastInterval(t *testing.T) {
+	midnight := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		advance  time.Duration // from midnight
+		interval time.Duration
+		start    time.Time
+		end      time.Time
+	}{
+		{"on a boundary", 10 * time.Minute, 5 * time.Minute,
+			midnight.Add(5 * time.Minute), midnight.Add(10 * time.Minute)},
+		{"inside an interval", 12*time.Minute + 30*time.Second, 5 * time.Minute,
+			midnight.Add(5 * time.Minute), midnight.Add(10 * time.Minute)},
+		{"just before a boundary", 15*time.Minute - time.Nanosecond, 5 * time.Minute,
+			midnight.Add(5 * time.Minute), midnight.Add(10 * time.Minute)},
+		{"across midnight", 2 * time.Minute, 5 * time.Minute,
+			midnight.Add(-5 * time.Minute), midnight},
+		{"hourly", 90 * time.Minute, time.Hour,
+			midnight, midnight.Add(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := clock.NewFakeClock(midnight)
+			c.Advance(tt.advance)
+			s := &KPIService{Clock: c}
+
+			start, end := s.lastInterval(tt.interval)
+			assert.Equal(t, tt.start, start)
+			assert.Equal(t, tt.end, end)
+		})
+	}
+}
+
+func TestKPILastIntervalFollowsClock(t *testing.T) {
+	c := clock.NewFakeClock(time.Date(2024, 5, 1, 10, 3, 0, 0, time.UTC))
+	s := &KPIService{Clock: c}
+	interval := 5 * time.Minute
+
+	// each tick of the scheduler computes the interval completed since the last
+	var starts []time.Time
+	for i := 0; i < 3; i++ {
+		start, end := s.lastInterval(interval)
+		assert.Equal(t, interval, end.Sub(start))
+		starts = append(starts, start)
+		c.Advance(interval)
+	}
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 5, 1, 9, 55, 0, 0, time.UTC),
+		time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC),
+	}, starts)
+}
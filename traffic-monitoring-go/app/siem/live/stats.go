@@ -0,0 +1,199 @@
+// Package live keeps a small set of traffic statistics in memory and pushes
+// them to wallboard displays, so they never have to poll the heavy endpoints
+package live
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// rateWindow is the number of one-second buckets message rates are averaged over
+const rateWindow = 10
+
+// activeVehicleTTL is how long a vehicle counts as active after its last message
+const activeVehicleTTL = time.Minute
+
+// protocolUnspecified labels V2X messages that do not report their radio
+const protocolUnspecified = "unspecified"
+
+// Snapshot is one statistics update as pushed to clients
+type Snapshot struct {
+	Timestamp            time.Time          `json:"timestamp"`
+	EventsPerSecond      float64            `json:"events_per_second"`
+	V2XMessagesPerSecond map[string]float64 `json:"v2x_messages_per_second"` // by radio protocol
+	ActiveVehicles       int                `json:"active_vehicles"`
+	OpenCriticalAlerts   int64              `json:"open_critical_alerts"`
+}
+
+// bucket counts the messages of one second
+type bucket struct {
+	second    int64
+	events    int
+	protocols map[string]int
+}
+
+// Stats aggregates ingested events incrementally and broadcasts snapshots
+type Stats struct {
+	mutex       sync.Mutex
+	buckets     [rateWindow]bucket
+	vehicles    map[string]time.Time
+	subscribers map[chan Snapshot]struct{}
+	latest      Snapshot
+}
+
+var defaultStats = &Stats{
+	vehicles:    make(map[string]time.Time),
+	subscribers: make(map[chan Snapshot]struct{}),
+}
+
+// Record counts an ingested event in the default statistics and moves its
+// vehicle on the live map
+func Record(event *models.SecurityEvent) {
+	now := time.Now()
+	obs, isV2X := observe(event)
+	defaultStats.record(obs, isV2X, now)
+	if isV2X {
+		defaultVehicleMap.Update(obs, now)
+	}
+}
+
+// Subscribe registers for snapshots of the default statistics; call the
+// returned function to unsubscribe
+func Subscribe() (<-chan Snapshot, func()) {
+	return defaultStats.Subscribe()
+}
+
+// Latest returns the most recent snapshot of the default statistics
+func Latest() Snapshot {
+	return defaultStats.Latest()
+}
+
+// observe extracts the V2X observation of an event, if it is a V2X or vehicle event
+func observe(event *models.SecurityEvent) (siem.V2XObservation, bool) {
+	if event.Category != models.CategoryV2X && event.Category != models.CategoryVehicle {
+		return siem.V2XObservation{}, false
+	}
+	return siem.ParseV2XObservation(event, "")
+}
+
+// Record counts an event received at now
+func (s *Stats) Record(event *models.SecurityEvent, now time.Time) {
+	obs, isV2X := observe(event)
+	s.record(obs, isV2X, now)
+}
+
+// record counts an event, with its V2X observation when isV2X
+func (s *Stats) record(obs siem.V2XObservation, isV2X bool, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	second := now.Unix()
+	b := &s.buckets[second%rateWindow]
+	if b.second != second {
+		*b = bucket{second: second, protocols: make(map[string]int)}
+	}
+	b.events++
+
+	if isV2X {
+		protocol := string(obs.Radio)
+		if protocol == "" {
+			protocol = protocolUnspecified
+		}
+		b.protocols[protocol]++
+		s.vehicles[obs.VehicleID] = now
+	}
+}
+
+// Subscribe registers a client. Slow clients miss updates instead of blocking others.
+func (s *Stats) Subscribe() (<-chan Snapshot, func()) {
+	updates := make(chan Snapshot, 1)
+
+	s.mutex.Lock()
+	s.subscribers[updates] = struct{}{}
+	s.mutex.Unlock()
+
+	return updates, func() {
+		s.mutex.Lock()
+		delete(s.subscribers, updates)
+		s.mutex.Unlock()
+	}
+}
+
+// Latest returns the most recent snapshot
+func (s *Stats) Latest() Snapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.latest
+}
+
+// snapshot computes rates over the last rateWindow complete seconds and prunes idle vehicles
+func (s *Stats) snapshot(now time.Time, openCritical int64) Snapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snapshot := Snapshot{
+		Timestamp:            now,
+		V2XMessagesPerSecond: make(map[string]float64),
+		OpenCriticalAlerts:   openCritical,
+	}
+
+	current := now.Unix()
+	for _, b := range s.buckets {
+		if b.second >= current || b.second < current-rateWindow {
+			continue
+		}
+		snapshot.EventsPerSecond += float64(b.events) / rateWindow
+		for protocol, count := range b.protocols {
+			snapshot.V2XMessagesPerSecond[protocol] += float64(count) / rateWindow
+		}
+	}
+
+	for vehicleID, lastSeen := range s.vehicles {
+		if now.Sub(lastSeen) > activeVehicleTTL {
+			delete(s.vehicles, vehicleID)
+		}
+	}
+	snapshot.ActiveVehicles = len(s.vehicles)
+
+	s.latest = snapshot
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- snapshot:
+		default:
+		}
+	}
+	return snapshot
+}
+
+var statsSeconds = config.NewInt("LIVE_STATS_SECONDS", 5, "Seconds between live traffic statistics pushed to wallboards", config.Min(1))
+
+// Start pushes a snapshot every LIVE_STATS_SECONDS (default 5). The open
+// critical alert count is the only value read from the database, once per push.
+func Start(db *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(statsSeconds.Get()) * time.Second)
+		defer ticker.Stop()
+
+		var openCritical int64
+		for now := range ticker.C {
+			err := database.ReadDB(db).Model(&models.Alert{}).
+				Where("severity = ? AND status IN ?", models.SeverityCritical,
+					[]models.AlertStatus{models.AlertStatusOpen, models.AlertStatusInProgress}).
+				Count(&openCritical).Error
+			if err != nil {
+				log.Printf("Error counting open critical alerts for live statistics: %v", err)
+			}
+			defaultStats.snapshot(now, openCritical)
+			defaultVehicleMap.Prune(now)
+		}
+	}()
+
+	log.Printf("Live statistics stream started, pushing every %ds", statsSeconds.Get())
+}
@@ -0,0 +1,262 @@
+package live
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/siem"
+)
+
+const (
+	// MaxZoom is the deepest zoom level the live map is clustered for
+	MaxZoom = 22
+
+	// clusterCellPixels is the size of the grid cells vehicles are clustered in, in screen pixels
+	clusterCellPixels = 64
+
+	// unclusteredZoom is the zoom level from which every vehicle is a marker of its own
+	unclusteredZoom = 18
+
+	// clusterCacheTTL is how long the clusters of a zoom level are reused;
+	// map clients polling at the same zoom share one computation
+	clusterCacheTTL = 2 * time.Second
+
+	// headingSectors is the number of compass points headings are binned into
+	headingSectors = 8
+)
+
+// compassPoints names the heading sectors, clockwise from north
+var compassPoints = [headingSectors]string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+
+// vehicleMarker is the last reported state of one vehicle
+type vehicleMarker struct {
+	latitude   float64
+	longitude  float64
+	speed      float64
+	hasSpeed   bool
+	heading    float64
+	hasHeading bool
+	seen       time.Time
+}
+
+// VehicleCluster is one marker of the live map: the vehicles in a grid cell
+// at the requested zoom, with the direction most of them are heading
+type VehicleCluster struct {
+	Latitude  float64 `json:"latitude"` // centroid of the vehicles
+	Longitude float64 `json:"longitude"`
+	Count     int     `json:"count"`
+	VehicleID string  `json:"vehicle_id,omitempty"` // when the cluster is a single vehicle
+
+	// Heading is the mean heading, in degrees clockwise from north, of the
+	// vehicles in the dominant compass sector; HeadingShare is the fraction of
+	// the vehicles reporting a heading that are in that sector
+	Heading      *float64 `json:"heading,omitempty"`
+	Direction    string   `json:"direction,omitempty"`
+	HeadingShare *float64 `json:"heading_share,omitempty"`
+
+	SpeedMean *float64 `json:"speed_mean,omitempty"` // as reported by the vehicles
+	SpeedMax  *float64 `json:"speed_max,omitempty"`
+}
+
+// VehicleMap keeps the last position of each active vehicle and clusters them per zoom level
+type VehicleMap struct {
+	mutex    sync.Mutex
+	vehicles map[string]vehicleMarker
+	clusters map[int]clusterSnapshot
+}
+
+// clusterSnapshot is the clustering of one zoom level at a point in time
+type clusterSnapshot struct {
+	computed time.Time
+	vehicles int
+	clusters []VehicleCluster
+}
+
+var defaultVehicleMap = NewVehicleMap()
+
+// NewVehicleMap creates an empty VehicleMap
+func NewVehicleMap() *VehicleMap {
+	return &VehicleMap{
+		vehicles: make(map[string]vehicleMarker),
+		clusters: make(map[int]clusterSnapshot),
+	}
+}
+
+// VehicleClusters clusters the vehicles of the default map at zoom
+func VehicleClusters(zoom int) ([]VehicleCluster, int) {
+	return defaultVehicleMap.Clusters(zoom, time.Now())
+}
+
+// Update moves a vehicle to the position of an observation received at now;
+// observations without a location are ignored
+func (m *VehicleMap) Update(obs siem.V2XObservation, now time.Time) {
+	if !obs.HasLocation || obs.VehicleID == "" {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	marker := m.vehicles[obs.VehicleID]
+	marker.latitude, marker.longitude = obs.Latitude, obs.Longitude
+	marker.seen = now
+	// keep the last speed and heading when a message omits them
+	if obs.HasSpeed {
+		marker.speed, marker.hasSpeed = obs.Speed, true
+	}
+	if obs.HasHeading {
+		marker.heading, marker.hasHeading = obs.Heading, true
+	}
+	m.vehicles[obs.VehicleID] = marker
+}
+
+// Clusters returns the clusters of the vehicles active at now, at zoom
+// (0-MaxZoom), and the number of vehicles clustered. The result is shared
+// between callers for clusterCacheTTL and must not be modified.
+func (m *VehicleMap) Clusters(zoom int, now time.Time) ([]VehicleCluster, int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if cached, ok := m.clusters[zoom]; ok && now.Sub(cached.computed) < clusterCacheTTL {
+		return cached.clusters, cached.vehicles
+	}
+
+	m.prune(now)
+	clusters := clusterVehicles(m.vehicles, zoom)
+	m.clusters[zoom] = clusterSnapshot{computed: now, vehicles: len(m.vehicles), clusters: clusters}
+	return clusters, len(m.vehicles)
+}
+
+// prune forgets the vehicles idle for longer than activeVehicleTTL; the caller holds the mutex
+func (m *VehicleMap) prune(now time.Time) {
+	for vehicleID, marker := range m.vehicles {
+		if now.Sub(marker.seen) > activeVehicleTTL {
+			delete(m.vehicles, vehicleID)
+		}
+	}
+}
+
+// Prune forgets idle vehicles and the cached clusters that have expired
+func (m *VehicleMap) Prune(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.prune(now)
+	for zoom, cached := range m.clusters {
+		if now.Sub(cached.computed) >= clusterCacheTTL {
+			delete(m.clusters, zoom)
+		}
+	}
+}
+
+// cellKey is a grid cell of clusterCellPixels at one zoom level
+type cellKey struct {
+	x, y int64
+}
+
+// clusterVehicles groups vehicles by Web Mercator grid cell at zoom; from
+// unclusteredZoom every vehicle is returned on its own
+func clusterVehicles(vehicles map[string]vehicleMarker, zoom int) []VehicleCluster {
+	ids := make([]string, 0, len(vehicles))
+	for vehicleID := range vehicles {
+		ids = append(ids, vehicleID)
+	}
+	sort.Strings(ids)
+
+	cells := make(map[cellKey][]string)
+	var order []cellKey
+	for _, vehicleID := range ids {
+		key := cellKey{x: int64(len(order))} // a cell per vehicle when unclustered
+		if zoom < unclusteredZoom {
+			x, y := mercatorPixels(vehicles[vehicleID].latitude, vehicles[vehicleID].longitude, zoom)
+			key = cellKey{x: int64(math.Floor(x / clusterCellPixels)), y: int64(math.Floor(y / clusterCellPixels))}
+		}
+		if _, ok := cells[key]; !ok {
+			order = append(order, key)
+		}
+		cells[key] = append(cells[key], vehicleID)
+	}
+
+	clusters := make([]VehicleCluster, 0, len(order))
+	for _, key := range order {
+		clusters = append(clusters, summarizeCluster(vehicles, cells[key]))
+	}
+	return clusters
+}
+
+// mercatorPixels projects a position to Web Mercator pixel coordinates at zoom
+func mercatorPixels(lat, lon float64, zoom int) (float64, float64) {
+	// the projection is undefined at the poles
+	lat = math.Max(-85.05112878, math.Min(85.05112878, lat))
+	scale := 256 * math.Exp2(float64(zoom))
+	sin := math.Sin(lat * math.Pi / 180)
+	x := (lon + 180) / 360 * scale
+	y := (0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi)) * scale
+	return x, y
+}
+
+// summarizeCluster computes the centroid, dominant heading and speeds of a cluster
+func summarizeCluster(vehicles map[string]vehicleMarker, ids []string) VehicleCluster {
+	cluster := VehicleCluster{Count: len(ids)}
+	if len(ids) == 1 {
+		cluster.VehicleID = ids[0]
+	}
+
+	var sectors [headingSectors][]float64
+	var withHeading, withSpeed int
+	var speedSum, speedMax float64
+	for _, vehicleID := range ids {
+		marker := vehicles[vehicleID]
+		cluster.Latitude += marker.latitude / float64(len(ids))
+		cluster.Longitude += marker.longitude / float64(len(ids))
+
+		if marker.hasHeading {
+			heading := math.Mod(math.Mod(marker.heading, 360)+360, 360)
+			sector := int(math.Floor((heading+180.0/headingSectors)/(360.0/headingSectors))) % headingSectors
+			sectors[sector] = append(sectors[sector], heading)
+			withHeading++
+		}
+		if marker.hasSpeed {
+			speedSum += marker.speed
+			if withSpeed == 0 || marker.speed > speedMax {
+				speedMax = marker.speed
+			}
+			withSpeed++
+		}
+	}
+
+	if withHeading > 0 {
+		// the busiest sector rather than the mean of all headings, which two
+		// opposite lanes of traffic would cancel out
+		dominant := 0
+		for sector := range sectors {
+			if len(sectors[sector]) > len(sectors[dominant]) {
+				dominant = sector
+			}
+		}
+		heading := circularMean(sectors[dominant])
+		share := float64(len(sectors[dominant])) / float64(withHeading)
+		cluster.Heading, cluster.Direction, cluster.HeadingShare = &heading, compassPoints[dominant], &share
+	}
+	if withSpeed > 0 {
+		mean := speedSum / float64(withSpeed)
+		cluster.SpeedMean, cluster.SpeedMax = &mean, &speedMax
+	}
+	return cluster
+}
+
+// circularMean averages headings in degrees, so 350 and 10 average to 0
+func circularMean(headings []float64) float64 {
+	var sin, cos float64
+	for _, heading := range headings {
+		sin += math.Sin(heading * math.Pi / 180)
+		cos += math.Cos(heading * math.Pi / 180)
+	}
+	mean := math.Atan2(sin, cos) * 180 / math.Pi
+	if mean < 0 {
+		mean += 360
+	}
+	return math.Mod(math.Round(mean*10)/10, 360)
+}
@@ -0,0 +1,120 @@
+package siem
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/metrics"
+	"traffic-monitoring-go/app/models"
+)
+
+var logSourceLookups = metrics.NewCounterVec("siem_log_source_cache_lookups_total",
+	"Log source lookups of ingested events, by whether the cache held the source", "result")
+
+const (
+	// logSourceCacheTTL bounds how long a log source changed on another
+	// instance takes to apply here when the instances share no Redis
+	logSourceCacheTTL = 30 * time.Second
+
+	// maxCachedLogSources bounds the memory of a flood of auto-created sources
+	maxCachedLogSources = 10000
+)
+
+// logSourceCache keeps the log sources events were stored under in memory, by
+// name and by ID, so storing an event costs no lookup query. Sources are cached
+// as they are looked up; creating one needs no invalidation.
+type logSourceCache struct {
+	mutex    sync.RWMutex
+	loadedAt time.Time
+	byName   map[string]*models.LogSource
+	byID     map[uint]*models.LogSource
+}
+
+var defaultLogSources = &logSourceCache{}
+
+// InvalidateLogSources forces the log sources to reload. Call it whenever log
+// sources are updated or deleted.
+func InvalidateLogSources() {
+	cache.Invalidate("log_sources")
+}
+
+// invalidate drops the cached log sources of this instance
+func (c *logSourceCache) invalidate() {
+	c.mutex.Lock()
+	c.byName, c.byID = nil, nil
+	c.mutex.Unlock()
+}
+
+func init() {
+	cache.OnInvalidate("log_sources", defaultLogSources.invalidate)
+}
+
+// cached returns a copy of the cached source with the name, or with the ID when byID is set
+func (c *logSourceCache) cached(name string, id uint, byID bool) (*models.LogSource, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.byName == nil || time.Since(c.loadedAt) > logSourceCacheTTL {
+		return nil, false
+	}
+	var source *models.LogSource
+	if byID {
+		source = c.byID[id]
+	} else {
+		source = c.byName[name]
+	}
+	if source == nil {
+		return nil, false
+	}
+	copied := *source
+	return &copied, true
+}
+
+// store caches a source read from the database
+func (c *logSourceCache) store(source *models.LogSource) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.byName == nil || time.Since(c.loadedAt) > logSourceCacheTTL || len(c.byID) >= maxCachedLogSources {
+		c.byName = make(map[string]*models.LogSource)
+		c.byID = make(map[uint]*models.LogSource)
+		c.loadedAt = time.Now()
+	}
+	copied := *source
+	c.byName[copied.Name] = &copied
+	c.byID[copied.ID] = &copied
+}
+
+// lookupName returns the log source with the name; a missing source is not cached
+func (c *logSourceCache) lookupName(db *gorm.DB, name string) (*models.LogSource, error) {
+	if source, ok := c.cached(name, 0, false); ok {
+		logSourceLookups.Inc("hit")
+		return source, nil
+	}
+	logSourceLookups.Inc("miss")
+
+	var source models.LogSource
+	if err := db.Where("name = ?", name).First(&source).Error; err != nil {
+		return nil, err
+	}
+	c.store(&source)
+	return &source, nil
+}
+
+// lookupID returns the log source with the ID
+func (c *logSourceCache) lookupID(db *gorm.DB, id uint) (*models.LogSource, error) {
+	if source, ok := c.cached("", id, true); ok {
+		logSourceLookups.Inc("hit")
+		return source, nil
+	}
+	logSourceLookups.Inc("miss")
+
+	var source models.LogSource
+	if err := db.First(&source, id).Error; err != nil {
+		return nil, err
+	}
+	c.store(&source)
+	return &source, nil
+}
@@ -0,0 +1,394 @@
+package siem
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+	"traffic-monitoring-go/app/siem/routing"
+)
+
+// AnomalyCrossRadioInconsistency is reported for both source IDs of a
+// DSRC/C-V2X vehicle link whose paired reports disagree
+const AnomalyCrossRadioInconsistency = "cross_radio_inconsistency"
+
+const (
+	misbehaviorReportVersion = 1
+	maxMisbehaviorEvidence   = 20 // evidence items kept per observation
+	maxMisbehaviorAttempts   = 5  // delivery attempts before a report is marked failed
+)
+
+// MisbehaviorEvidence is one detection backing a misbehavior observation
+type MisbehaviorEvidence struct {
+	EventID     uint      `json:"event_id,omitempty"` // the V2X message the anomaly was detected in
+	FindingID   uint      `json:"finding_id,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	MessageType string    `json:"message_type,omitempty"`
+	Radio       string    `json:"radio,omitempty"`
+	Receiver    string    `json:"receiver,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Summary     string    `json:"summary"`
+}
+
+// MisbehaviorObservation groups the anomalies of one type in a report
+type MisbehaviorObservation struct {
+	Type      string                `json:"type"`
+	Count     int                   `json:"count"`
+	FirstSeen time.Time             `json:"first_seen"`
+	LastSeen  time.Time             `json:"last_seen"`
+	Evidence  []MisbehaviorEvidence `json:"evidence"`
+}
+
+// MisbehaviorReportDocument is the MBR sent to the Misbehavior Authority
+type MisbehaviorReportDocument struct {
+	Version              int                      `json:"version"`
+	ReportID             string                   `json:"report_id"`
+	GenerationTime       time.Time                `json:"generation_time"`
+	ReporterID           string                   `json:"reporter_id"`
+	ReportedID           string                   `json:"reported_id"` // the misbehaving source ID (pseudonym)
+	ReportedCertificates []string                 `json:"reported_certificates,omitempty"`
+	WindowStart          time.Time                `json:"window_start"`
+	WindowEnd            time.Time                `json:"window_end"`
+	Observations         []MisbehaviorObservation `json:"observations"`
+}
+
+// misbehaviorAnomaly is an anomaly attributed to a source ID
+type misbehaviorAnomaly struct {
+	sourceID      string
+	anomalyType   string
+	certificateID string
+	evidence      MisbehaviorEvidence
+}
+
+// MisbehaviorReporter aggregates the V2X anomalies of each source ID into
+// misbehavior reports and forwards them to a Misbehavior Authority
+type MisbehaviorReporter struct {
+	DB           *gorm.DB
+	Clock        clock.Clock
+	Client       *http.Client
+	AuthorityURL string // reports stay local when empty
+	Token        string // sent as a bearer token to the authority when set
+	ReporterID   string
+	Window       time.Duration
+	MinAnomalies int // anomalies a source needs in a window to be reported
+}
+
+var (
+	mbrAuthorityURL   = config.NewString("MBR_AUTHORITY_URL", "", "Misbehavior Authority reports are sent to; reports stay local when empty")
+	mbrAuthorityToken = config.NewString("MBR_AUTHORITY_TOKEN", "", "Bearer token of the Misbehavior Authority", config.Secret)
+	mbrReporterID     = config.NewString("MBR_REPORTER_ID", "traffic-monitoring-siem", "Identity of the SIEM in misbehavior reports")
+	mbrWindowMinutes  = config.NewInt("MBR_WINDOW_MINUTES", 15, "Minutes of anomalies each misbehavior report covers", config.Min(1))
+	mbrMinAnomalies   = config.NewInt("MBR_MIN_ANOMALIES", 1, "Anomalies a source needs in a window to be reported", config.Min(1))
+)
+
+// NewMisbehaviorReporter configures a reporter from MBR_AUTHORITY_URL,
+// MBR_AUTHORITY_TOKEN, MBR_REPORTER_ID, MBR_WINDOW_MINUTES (default 15) and
+// MBR_MIN_ANOMALIES (default 1)
+func NewMisbehaviorReporter(db *gorm.DB) *MisbehaviorReporter {
+	return &MisbehaviorReporter{
+		DB:           db,
+		Clock:        clock.Default(),
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		AuthorityURL: mbrAuthorityURL.Get(),
+		Token:        mbrAuthorityToken.Get(),
+		ReporterID:   mbrReporterID.Get(),
+		Window:       time.Duration(mbrWindowMinutes.Get()) * time.Minute,
+		MinAnomalies: mbrMinAnomalies.Get(),
+	}
+}
+
+// anomalies collects the anomalies detected in [start, end): V2X findings
+// carrying an anomaly_type, and inconsistent DSRC/C-V2X vehicle links
+func (r *MisbehaviorReporter) anomalies(start, end time.Time) ([]misbehaviorAnomaly, error) {
+	var events []models.SecurityEvent
+	err := r.DB.Where("category = ? AND timestamp >= ? AND timestamp < ? AND raw_data LIKE ?",
+		models.CategoryV2X, start, end, `%"anomaly_type"%`).
+		Order("timestamp ASC").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var anomalies []misbehaviorAnomaly
+	for _, event := range events {
+		var raw struct {
+			Details map[string]interface{} `json:"details"`
+		}
+		if json.Unmarshal([]byte(event.RawData), &raw) != nil {
+			continue
+		}
+		detail := func(key string) string {
+			value, _ := raw.Details[key].(string)
+			return value
+		}
+		anomalyType, sourceID := detail("anomaly_type"), detail("vehicle_id")
+		if anomalyType == "" || sourceID == "" {
+			continue
+		}
+
+		evidence := MisbehaviorEvidence{
+			FindingID:   event.ID,
+			Timestamp:   event.Timestamp,
+			MessageType: detail("message_type"),
+			Radio:       detail("radio"),
+			Receiver:    detail("rsu_id"),
+			Location:    detail("location"),
+			Summary:     event.Message,
+		}
+		if eventID, ok := raw.Details["event_id"].(float64); ok {
+			evidence.EventID = uint(eventID)
+		}
+		anomalies = append(anomalies, misbehaviorAnomaly{
+			sourceID:      sourceID,
+			anomalyType:   anomalyType,
+			certificateID: detail("certificate_id"),
+			evidence:      evidence,
+		})
+	}
+
+	var links []models.VehicleLink
+	err = r.DB.Where("inconsistent = ? AND last_inconsistent_at >= ? AND last_inconsistent_at < ?", true, start, end).
+		Find(&links).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		for _, pair := range [][2]string{{link.DSRCID, link.CV2XID}, {link.CV2XID, link.DSRCID}} {
+			anomalies = append(anomalies, misbehaviorAnomaly{
+				sourceID:    pair[0],
+				anomalyType: AnomalyCrossRadioInconsistency,
+				evidence: MisbehaviorEvidence{
+					Timestamp: *link.LastInconsistentAt,
+					Summary:   fmt.Sprintf("reports inconsistent with linked source %s: %s", pair[1], link.InconsistencyReason),
+				},
+			})
+		}
+	}
+	return anomalies, nil
+}
+
+// Generate creates a report for every source ID with at least MinAnomalies
+// anomalies in [start, end), or only for sourceID when it is set. Sources
+// already reported for a window starting at start are skipped.
+func (r *MisbehaviorReporter) Generate(start, end time.Time, sourceID string) ([]models.MisbehaviorReport, error) {
+	anomalies, err := r.anomalies(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	bySource := make(map[string][]misbehaviorAnomaly)
+	for _, anomaly := range anomalies {
+		if sourceID == "" || anomaly.sourceID == sourceID {
+			bySource[anomaly.sourceID] = append(bySource[anomaly.sourceID], anomaly)
+		}
+	}
+	sources := make([]string, 0, len(bySource))
+	for source, found := range bySource {
+		if len(found) >= r.MinAnomalies {
+			sources = append(sources, source)
+		}
+	}
+	sort.Strings(sources)
+
+	var reports []models.MisbehaviorReport
+	for _, source := range sources {
+		report, err := r.buildReport(source, start, end, bySource[source])
+		if err != nil {
+			return nil, err
+		}
+		result := r.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "source_id"}, {Name: "window_start"}},
+			DoNothing: true,
+		}).Create(report)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			reports = append(reports, *report)
+		}
+	}
+	return reports, nil
+}
+
+// buildReport assembles the MBR document of one source
+func (r *MisbehaviorReporter) buildReport(sourceID string, start, end time.Time, anomalies []misbehaviorAnomaly) (*models.MisbehaviorReport, error) {
+	reportID, err := newReportID()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := MisbehaviorReportDocument{
+		Version:        misbehaviorReportVersion,
+		ReportID:       reportID,
+		GenerationTime: r.Clock.Now().UTC(),
+		ReporterID:     r.ReporterID,
+		ReportedID:     sourceID,
+		WindowStart:    start.UTC(),
+		WindowEnd:      end.UTC(),
+	}
+
+	observations := make(map[string]*MisbehaviorObservation)
+	certificates := make(map[string]bool)
+	for _, anomaly := range anomalies {
+		observation, ok := observations[anomaly.anomalyType]
+		if !ok {
+			observation = &MisbehaviorObservation{Type: anomaly.anomalyType, FirstSeen: anomaly.evidence.Timestamp}
+			observations[anomaly.anomalyType] = observation
+		}
+		observation.Count++
+		if anomaly.evidence.Timestamp.Before(observation.FirstSeen) {
+			observation.FirstSeen = anomaly.evidence.Timestamp
+		}
+		if anomaly.evidence.Timestamp.After(observation.LastSeen) {
+			observation.LastSeen = anomaly.evidence.Timestamp
+		}
+		if len(observation.Evidence) < maxMisbehaviorEvidence {
+			observation.Evidence = append(observation.Evidence, anomaly.evidence)
+		}
+		if anomaly.certificateID != "" && !certificates[anomaly.certificateID] {
+			certificates[anomaly.certificateID] = true
+			doc.ReportedCertificates = append(doc.ReportedCertificates, anomaly.certificateID)
+		}
+	}
+
+	types := make([]string, 0, len(observations))
+	for anomalyType := range observations {
+		types = append(types, anomalyType)
+	}
+	sort.Strings(types)
+	for _, anomalyType := range types {
+		doc.Observations = append(doc.Observations, *observations[anomalyType])
+	}
+
+	document, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	status := models.MisbehaviorReportLocal
+	if r.AuthorityURL != "" {
+		status = models.MisbehaviorReportPending
+	}
+	return &models.MisbehaviorReport{
+		ReportID:     reportID,
+		SourceID:     sourceID,
+		WindowStart:  start,
+		WindowEnd:    end,
+		AnomalyCount: len(anomalies),
+		AnomalyTypes: types,
+		Document:     string(document),
+		Status:       status,
+	}, nil
+}
+
+// newReportID returns a random 128-bit report identifier
+func newReportID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// Forward sends a report to the Misbehavior Authority and records the outcome
+func (r *MisbehaviorReporter) Forward(report *models.MisbehaviorReport) error {
+	if r.AuthorityURL == "" {
+		return fmt.Errorf("no Misbehavior Authority configured (MBR_AUTHORITY_URL)")
+	}
+
+	var headers map[string]string
+	if r.Token != "" {
+		headers = map[string]string{"Authorization": "Bearer " + r.Token}
+	}
+	sendErr := routing.PostJSON(r.Client, http.MethodPost, r.AuthorityURL, headers, json.RawMessage(report.Document))
+
+	report.Attempts++
+	if sendErr == nil {
+		now := r.Clock.Now()
+		report.Status = models.MisbehaviorReportSent
+		report.LastError = ""
+		report.SentAt = &now
+	} else {
+		report.LastError = sendErr.Error()
+		report.Status = models.MisbehaviorReportPending
+		if report.Attempts >= maxMisbehaviorAttempts {
+			report.Status = models.MisbehaviorReportFailed
+		}
+	}
+
+	err := r.DB.Model(report).Updates(map[string]interface{}{
+		"status":     report.Status,
+		"attempts":   report.Attempts,
+		"last_error": report.LastError,
+		"sent_at":    report.SentAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// ForwardPending forwards the reports waiting for delivery, oldest first
+func (r *MisbehaviorReporter) ForwardPending() (int, error) {
+	if r.AuthorityURL == "" {
+		return 0, nil
+	}
+
+	var reports []models.MisbehaviorReport
+	err := r.DB.Where("status = ?", models.MisbehaviorReportPending).
+		Order("created_at ASC").
+		Limit(100).
+		Find(&reports).Error
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range reports {
+		if err := r.Forward(&reports[i]); err != nil {
+			log.Printf("Error forwarding misbehavior report %s: %v", reports[i].ReportID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// Start reports each completed window in the background and forwards pending reports
+func (r *MisbehaviorReporter) Start() {
+	go func() {
+		ticker := time.NewTicker(r.Window)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			end := r.Clock.Now().Truncate(r.Window)
+			start := end.Add(-r.Window)
+			reports, err := r.Generate(start, end, "")
+			if err != nil {
+				log.Printf("Error generating misbehavior reports for %s: %v", start.Format(time.RFC3339), err)
+			} else if len(reports) > 0 {
+				log.Printf("Generated %d misbehavior reports for %s", len(reports), start.Format(time.RFC3339))
+			}
+
+			if _, err := r.ForwardPending(); err != nil {
+				log.Printf("Error forwarding misbehavior reports: %v", err)
+			}
+		}
+	}()
+
+	target := "kept locally"
+	if r.AuthorityURL != "" {
+		target = "forwarded to " + r.AuthorityURL
+	}
+	log.Printf("Misbehavior reporting started with %s windows, reports %s", r.Window, target)
+}
@@ -0,0 +1,143 @@
+package siem
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// muteCacheTTL bounds how long a mute created on another instance takes to apply here
+const muteCacheTTL = 10 * time.Second
+
+// muteCache keeps the unresolved mutes in memory so checking an event costs no query
+type muteCache struct {
+	mutex    sync.RWMutex
+	loaded   bool
+	loadedAt time.Time
+	mutes    []models.SourceMute
+}
+
+var defaultMuteCache = &muteCache{}
+
+// InvalidateMutes forces the mute cache to reload. Call it whenever mutes change.
+func InvalidateMutes() {
+	cache.Invalidate("mutes")
+}
+
+// invalidate drops the cached mutes of this instance
+func (c *muteCache) invalidate() {
+	c.mutex.Lock()
+	c.loaded = false
+	c.mutex.Unlock()
+}
+
+func init() {
+	cache.OnInvalidate("mutes", defaultMuteCache.invalidate)
+}
+
+func (c *muteCache) get(db *gorm.DB) ([]models.SourceMute, error) {
+	c.mutex.RLock()
+	if c.loaded && time.Since(c.loadedAt) <= muteCacheTTL {
+		mutes := c.mutes
+		c.mutex.RUnlock()
+		return mutes, nil
+	}
+	c.mutex.RUnlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded || time.Since(c.loadedAt) > muteCacheTTL {
+		var mutes []models.SourceMute
+		if err := db.Where("resolved_at IS NULL").Find(&mutes).Error; err != nil {
+			return nil, err
+		}
+		c.mutes = mutes
+		c.loaded = true
+		c.loadedAt = time.Now()
+	}
+	return c.mutes, nil
+}
+
+// FindMute returns the active mute covering an event, or nil. Both alerting and
+// anomaly detection must skip events for which a mute is returned.
+func FindMute(db *gorm.DB, event *models.SecurityEvent) (*models.SourceMute, error) {
+	mutes, err := defaultMuteCache.get(db)
+	if err != nil || len(mutes) == 0 {
+		return nil, err
+	}
+
+	now := clock.Default().Now()
+	var details map[string]interface{}
+	detailsParsed := false
+	detail := func(key string) string {
+		if !detailsParsed {
+			var raw struct {
+				Details map[string]interface{} `json:"details"`
+			}
+			if json.Unmarshal([]byte(event.RawData), &raw) == nil {
+				details = raw.Details
+			}
+			detailsParsed = true
+		}
+		value, _ := details[key].(string)
+		return value
+	}
+
+	sourceName := ""
+	for i := range mutes {
+		mute := &mutes[i]
+		if !mute.Active(now) {
+			continue
+		}
+		if mute.MessageType != "" && !strings.EqualFold(mute.MessageType, eventMessageType(event)) {
+			continue
+		}
+
+		var candidates []string
+		switch mute.SourceType {
+		case models.MuteSourceVehicle:
+			candidates = []string{detail("vehicle_id"), event.DeviceID}
+		case models.MuteSourceRSU, models.MuteSourceLogSource:
+			if sourceName == "" {
+				sourceName = logSourceName(db, event)
+			}
+			candidates = []string{sourceName}
+			if mute.SourceType == models.MuteSourceRSU {
+				candidates = append(candidates, detail("rsu_id"))
+			}
+		case models.MuteSourceIP:
+			candidates = []string{event.SourceIP}
+		}
+
+		for _, candidate := range candidates {
+			if candidate != "" && strings.EqualFold(candidate, mute.SourceID) {
+				return mute, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// logSourceName returns the name of the event's log source, loading it if needed
+func logSourceName(db *gorm.DB, event *models.SecurityEvent) string {
+	if event.LogSource.Name != "" {
+		return event.LogSource.Name
+	}
+	logSource, err := defaultLogSources.lookupID(db, event.LogSourceID)
+	if err != nil {
+		return ""
+	}
+	return logSource.Name
+}
+
+// RecordSuppression counts an alert or anomaly that a mute suppressed
+func RecordSuppression(db *gorm.DB, mute *models.SourceMute) error {
+	return db.Model(&models.SourceMute{}).Where("id = ?", mute.ID).
+		UpdateColumn("suppressed_count", gorm.Expr("suppressed_count + 1")).Error
+}
@@ -1,10 +1,16 @@
 package notifications
 
 import (
+	"errors"
+
 	"traffic-monitoring-go/app/models"
 )
 
 
+// ErrChannelDisabled is returned by channels asked to deliver a report while disabled
+var ErrChannelDisabled = errors.New("channel is disabled")
+
+
 // NotificationChannel defines the interface for sending notifications
 type NotificationChannel interface {
 	// send sends a notification about an alert
@@ -23,3 +29,18 @@ type BaseNotificationConfig struct {
 }
 
 
+// Report is a generated summary report to deliver
+type Report struct {
+	Subject		string
+	HTML		[]byte	// sent as the body
+	PDF		[]byte	// attached when not empty
+	Filename	string	// name of the attachments, without extension
+}
+
+
+// ReportChannel is a channel that can also deliver summary reports
+type ReportChannel interface {
+	NotificationChannel
+	// SendReport delivers a report, or returns ErrChannelDisabled
+	SendReport(report *Report) error
+}
@@ -4,10 +4,13 @@ package notifications
 
 import (
 	"bytes"
-	
+	"encoding/base64"
 	"fmt"
 	"log"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
+	"strings"
 	"text/template"
 	"time"
 
@@ -27,6 +30,17 @@ type EmailConfig struct {
 	BodyTemplate    string `json:"body_template"`
 }
 
+// templateFuncs are available to the subject and body templates
+var templateFuncs = template.FuncMap{
+	// meters formats an optional distance, e.g. for .Alert.RSUDistanceM
+	"meters": func(distance *float64) string {
+		if distance == nil {
+			return "?"
+		}
+		return fmt.Sprintf("%.0f", *distance)
+	},
+}
+
 // EmailChannel sends notifications via email
 type EmailChannel struct {
 	Config EmailConfig
@@ -52,7 +66,15 @@ Event Details:
 - Category: {{ .Event.Category }}
 - Source IP: {{ .Event.SourceIP }}
 - Message: {{ .Event.Message }}
-
+{{ if .Alert.Latitude }}
+Location: {{ .Alert.Latitude }}, {{ .Alert.Longitude }}
+{{- if .Alert.NearestRSU }}
+- Nearest RSU: {{ .Alert.NearestRSU }} ({{ meters .Alert.RSUDistanceM }} m)
+{{- end }}
+{{- if .Alert.RoadName }}
+- Road: {{ .Alert.RoadName }}{{ if .Alert.RoadSegment }} [segment {{ .Alert.RoadSegment }}]{{ end }} ({{ meters .Alert.RoadDistanceM }} m)
+{{- end }}
+{{ end }}
 Please check your SIEM system for more details.
 `
 	}
@@ -106,7 +128,7 @@ func (c *EmailChannel) Send(alert *models.Alert) error {
 	}
 
 	// Parse and execute the subject template
-	subjectTmpl, err := template.New("subject").Parse(c.Config.SubjectTemplate)
+	subjectTmpl, err := template.New("subject").Funcs(templateFuncs).Parse(c.Config.SubjectTemplate)
 	if err != nil {
 		return fmt.Errorf("failed to parse subject template: %v", err)
 	}
@@ -118,7 +140,7 @@ func (c *EmailChannel) Send(alert *models.Alert) error {
 	subject := subjectBuf.String()
 
 	// Parse and execute the body template
-	bodyTmpl, err := template.New("body").Parse(c.Config.BodyTemplate)
+	bodyTmpl, err := template.New("body").Funcs(templateFuncs).Parse(c.Config.BodyTemplate)
 	if err != nil {
 		return fmt.Errorf("failed to parse body template: %v", err)
 	}
@@ -165,3 +187,63 @@ func (c *EmailChannel) Send(alert *models.Alert) error {
 	log.Printf("Sent email notification for alert %d to %d recipients", alert.ID, len(c.Config.ToAddresses))
 	return nil
 }
+
+// SendReport emails a summary report as an HTML message, with its PDF attached
+func (c *EmailChannel) SendReport(report *Report) error {
+	if !c.Config.Enabled {
+		return ErrChannelDisabled
+	}
+	if len(c.Config.ToAddresses) == 0 {
+		return fmt.Errorf("no recipient addresses configured")
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	html, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=utf-8"}})
+	if err != nil {
+		return err
+	}
+	html.Write(report.HTML)
+	if len(report.PDF) > 0 {
+		attachment, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/pdf"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", report.Filename+".pdf")},
+		})
+		if err != nil {
+			return err
+		}
+		encoded := base64.StdEncoding.EncodeToString(report.PDF)
+		for len(encoded) > 76 {
+			fmt.Fprintf(attachment, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(attachment, "%s\r\n", encoded)
+	}
+	if err := parts.Close(); err != nil {
+		return err
+	}
+
+	msg := []byte(fmt.Sprintf("To: %s\r\n"+
+		"From: %s\r\n"+
+		"Subject: %s\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: multipart/mixed; boundary=%s\r\n"+
+		"\r\n"+
+		"%s", strings.Join(c.Config.ToAddresses, ", "), c.Config.FromAddress, report.Subject, parts.Boundary(), body.String()))
+
+	auth := smtp.PlainAuth("", c.Config.Username, c.Config.Password, c.Config.SMTPServer)
+	err = smtp.SendMail(
+		fmt.Sprintf("%s:%d", c.Config.SMTPServer, c.Config.SMTPPort),
+		auth,
+		c.Config.FromAddress,
+		c.Config.ToAddresses,
+		msg,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	log.Printf("Sent report %s by email to %d recipients", report.Filename, len(c.Config.ToAddresses))
+	return nil
+}
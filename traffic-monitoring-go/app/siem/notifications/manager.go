@@ -1,18 +1,19 @@
 package notifications
 
 import (
-	
+	"errors"
 	"fmt"
-	"log"
 	"sync"
 
 	"gorm.io/gorm"
+	"traffic-monitoring-go/app/logging"
 	"traffic-monitoring-go/app/models"
 )
 
 // NotificationManager manages all notification channels
 type NotificationManager struct {
 	DB		*gorm.DB
+	Log		*logging.Logger
 	channels	map[string]NotificationChannel
 	mutex		sync.Mutex
 }
@@ -21,10 +22,45 @@ type NotificationManager struct {
 func NewNotificationManager(db *gorm.DB) *NotificationManager {
 	return &NotificationManager{
 		DB:		db,
+		Log:		logging.New("notifications"),
 		channels:	make(map[string]NotificationChannel),
 	}
 }
 
+// NewDefaultNotificationManager creates a manager with the default email and
+// webhook channels, which are registered disabled until configured
+func NewDefaultNotificationManager(db *gorm.DB) *NotificationManager {
+	manager := NewNotificationManager(db)
+
+	// register default notification channels
+	// for demonstration, using placeholder config values
+	emailChannel := NewEmailChannel(EmailConfig{
+		BaseNotificationConfig: BaseNotificationConfig{
+			Enabled: false, // disabled by default since it needs a real SMTP config
+			Name:	"default-email",
+		},
+		SMTPServer:		"smtp.example.com",
+		SMTPPort:		587,
+		Username:		"username",
+		Password:		"password",
+		FromAddress:	"siem@example.com",
+		ToAddresses:	[]string{"alerts@example.com"},
+	})
+
+	webhookChannel := NewWebhookChannel(WebhookConfig{
+		BaseNotificationConfig:	BaseNotificationConfig{
+			Enabled: false,
+			Name:	 "default-webhook",
+		},
+		URL:	"https://example.com/webhook",
+		Method:	"POST",
+	})
+
+	manager.RegisterChannel(emailChannel)
+	manager.RegisterChannel(webhookChannel)
+	return manager
+}
+
 // RegisterChannel adds a notification channel to the manager
 func (m *NotificationManager) RegisterChannel(channel NotificationChannel) error {
 	m.mutex.Lock()
@@ -36,7 +72,7 @@ func (m *NotificationManager) RegisterChannel(channel NotificationChannel) error
 	}
 
 	m.channels[name] = channel
-	log.Printf("Registered notification channel: %s (%s)", name, channel.Type())
+	m.Log.Info("registered notification channel", "channel", name, "type", channel.Type())
 	return nil
 }
 
@@ -58,10 +94,11 @@ func (m *NotificationManager) SendNotification(alertID uint) error {
 
 	var errs []error
 	var successCount int
+	alertLog := m.Log.With("alert_id", alert.ID, "correlation_id", alert.CorrelationID)
 
 	for _, channel := range channels {
 		if err := channel.Send(&alert); err != nil {
-			log.Printf("Error sending notification through channel '%s': %v", channel.Name(), err)
+			alertLog.Error("failed to send notification", "channel", channel.Name(), "error", err)
 			errs = append(errs, fmt.Errorf("channel '%s': %v", channel.Name(), err))
 		} else {
 			successCount++
@@ -73,7 +110,7 @@ func (m *NotificationManager) SendNotification(alertID uint) error {
 			len(errs), successCount, errs[0])
 	}
 
-	log.Printf("Successfully sent notifications for alert %d through %d channels", alertID, successCount)
+	alertLog.Info("sent notifications", "channels", successCount)
 	return nil
 }
 
@@ -89,3 +126,55 @@ func (m *NotificationManager) GetChannelNames() []string {
 
 	return names
 }
+
+// SendReport delivers a summary report through the named channels, or all
+// of them when none are named, and returns the channels that delivered it.
+// Disabled channels and channels that cannot deliver reports are skipped
+// unless named.
+func (m *NotificationManager) SendReport(report *Report, names []string) ([]string, error) {
+	m.mutex.Lock()
+	var channels []NotificationChannel
+	if len(names) == 0 {
+		for _, channel := range m.channels {
+			channels = append(channels, channel)
+		}
+	} else {
+		for _, name := range names {
+			channel, ok := m.channels[name]
+			if !ok {
+				m.mutex.Unlock()
+				return nil, fmt.Errorf("unknown notification channel '%s'", name)
+			}
+			channels = append(channels, channel)
+		}
+	}
+	m.mutex.Unlock()
+
+	var delivered []string
+	var errs []error
+	for _, channel := range channels {
+		reportChannel, ok := channel.(ReportChannel)
+		if !ok {
+			if len(names) > 0 {
+				errs = append(errs, fmt.Errorf("channel '%s' cannot deliver reports", channel.Name()))
+			}
+			continue
+		}
+		err := reportChannel.SendReport(report)
+		if errors.Is(err, ErrChannelDisabled) && len(names) == 0 {
+			continue
+		}
+		if err != nil {
+			m.Log.Error("failed to send report", "channel", channel.Name(), "report", report.Filename, "error", err)
+			errs = append(errs, fmt.Errorf("channel '%s': %v", channel.Name(), err))
+			continue
+		}
+		delivered = append(delivered, channel.Name())
+	}
+
+	if len(errs) > 0 {
+		return delivered, fmt.Errorf("failed to send report through %d channels (succeeded: %d): %v",
+			len(errs), len(delivered), errs[0])
+	}
+	return delivered, nil
+}
@@ -90,6 +90,14 @@ func (c *WebhookChannel) Send(alert *models.Alert) error {
 		Category    models.EventCategory `json:"category"`
 		SourceIP    string               `json:"source_ip,omitempty"`
 		Description string               `json:"description,omitempty"`
+		Latitude    *float64             `json:"latitude,omitempty"`
+		Longitude   *float64             `json:"longitude,omitempty"`
+		NearestRSU  string               `json:"nearest_rsu,omitempty"`
+		RSUDistance *float64             `json:"rsu_distance_m,omitempty"`
+		RoadName    string               `json:"road_name,omitempty"`
+		RoadSegment string               `json:"road_segment,omitempty"`
+		RoadDistance *float64            `json:"road_distance_m,omitempty"`
+		CorrelationID string             `json:"correlation_id,omitempty"`
 	}{
 		AlertID:     alert.ID,
 		RuleID:      alert.RuleID,
@@ -102,6 +110,14 @@ func (c *WebhookChannel) Send(alert *models.Alert) error {
 		Category:    alert.SecurityEvent.Category,
 		SourceIP:    alert.SecurityEvent.SourceIP,
 		Description: alert.Rule.Description,
+		Latitude:    alert.Latitude,
+		Longitude:   alert.Longitude,
+		NearestRSU:  alert.NearestRSU,
+		RSUDistance: alert.RSUDistanceM,
+		RoadName:    alert.RoadName,
+		RoadSegment: alert.RoadSegment,
+		RoadDistance: alert.RoadDistanceM,
+		CorrelationID: alert.CorrelationID,
 	}
 	
 	jsonPayload, err := json.Marshal(payload)
@@ -124,6 +140,9 @@ func (c *WebhookChannel) Send(alert *models.Alert) error {
 	for key, value := range c.Config.Headers {
 		req.Header.Set(key, value)
 	}
+	if alert.CorrelationID != "" {
+		req.Header.Set("X-Correlation-ID", alert.CorrelationID)
+	}
 	
 	// Send the request
 	resp, err := c.Client.Do(req)
@@ -140,3 +159,51 @@ func (c *WebhookChannel) Send(alert *models.Alert) error {
 	log.Printf("Sent webhook notification for alert %d to %s", alert.ID, c.Config.URL)
 	return nil
 }
+
+// SendReport posts a summary report as JSON, the PDF encoded in base64
+func (c *WebhookChannel) SendReport(report *Report) error {
+	if !c.Config.Enabled {
+		return ErrChannelDisabled
+	}
+	if c.Config.URL == "" {
+		return fmt.Errorf("no webhook URL configured")
+	}
+
+	jsonPayload, err := json.Marshal(struct {
+		Subject  string `json:"subject"`
+		Filename string `json:"filename"`
+		HTML     string `json:"html"`
+		PDF      []byte `json:"pdf,omitempty"`
+	}{
+		Subject:  report.Subject,
+		Filename: report.Filename,
+		HTML:     string(report.HTML),
+		PDF:      report.PDF,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %v", err)
+	}
+
+	req, err := http.NewRequest(c.Config.Method, c.Config.URL, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %v", err)
+	}
+	if _, ok := c.Config.Headers["Content-Type"]; !ok {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range c.Config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned non-success status: %d", resp.StatusCode)
+	}
+
+	log.Printf("Sent report %s to webhook %s", report.Filename, c.Config.URL)
+	return nil
+}
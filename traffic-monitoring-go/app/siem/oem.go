@@ -0,0 +1,390 @@
+package siem
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+	"traffic-monitoring-go/app/siem/routing"
+)
+
+const (
+	oemNotificationVersion = 1
+	maxOEMAttempts         = 5 // delivery attempts before a notification is marked failed
+	maxOEMReports          = 5 // recent misbehavior reports summarized as evidence
+)
+
+// Recommended actions sent to fleet operators
+const (
+	OEMActionRevokeCredentials = "revoke_credentials" // the vehicle's keys are in an attacker's hands
+	OEMActionInspectVehicle    = "inspect_vehicle"    // the on-board unit misbehaves and needs a diagnosis
+)
+
+// OEMEvidence summarizes why an alert on a vehicle was confirmed malicious
+type OEMEvidence struct {
+	AlertID            uint      `json:"alert_id"`
+	Rule               string    `json:"rule"`
+	Severity           string    `json:"severity"`
+	V2XThreats         []string  `json:"v2x_threats,omitempty"`
+	DetectedAt         time.Time `json:"detected_at"`
+	ConfirmedAt        time.Time `json:"confirmed_at"`
+	Resolution         string    `json:"resolution,omitempty"`
+	Summary            string    `json:"summary"` // the message of the event that raised the alert
+	AnomalyType        string    `json:"anomaly_type,omitempty"`
+	MessageType        string    `json:"message_type,omitempty"`
+	Receiver           string    `json:"receiver,omitempty"`
+	Location           string    `json:"location,omitempty"`
+	MisbehaviorReports []string  `json:"misbehavior_reports,omitempty"` // recent MBRs on the pseudonym
+	AnomalyTypes       []string  `json:"anomaly_types,omitempty"`       // anomalies those reports cover
+}
+
+// OEMNotificationDocument is the signed notice sent to a fleet operator
+type OEMNotificationDocument struct {
+	Version           int         `json:"version"`
+	NotificationID    string      `json:"notification_id"`
+	IssuedAt          time.Time   `json:"issued_at"`
+	Issuer            string      `json:"issuer"`
+	Operator          string      `json:"operator"`
+	Pseudonym         string      `json:"pseudonym"`
+	CertificateID     string      `json:"certificate_id,omitempty"`
+	LinkedPseudonyms  []string    `json:"linked_pseudonyms,omitempty"` // other radio IDs of the same vehicle
+	Evidence          OEMEvidence `json:"evidence"`
+	RecommendedAction string      `json:"recommended_action"`
+}
+
+// OEMNotifier tells vehicle OEMs and fleet operators about alerts on their
+// vehicles that analysts confirmed malicious. Each notification is signed
+// with the operator's secret: X-SIEM-Signature carries
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), with the
+// timestamp in X-SIEM-Timestamp.
+type OEMNotifier struct {
+	DB       *gorm.DB
+	Clock    clock.Clock
+	Client   *http.Client
+	Issuer   string
+	Interval time.Duration
+}
+
+var (
+	oemNotifyInterval = config.NewInt("OEM_NOTIFY_INTERVAL_SECONDS", 30, "Seconds between deliveries of pending OEM notices", config.Min(1))
+	oemNotifyIssuer   = config.NewString("OEM_NOTIFY_ISSUER", "", "Issuer of the OEM notices; MBR_REPORTER_ID when empty")
+)
+
+// NewOEMNotifier configures a notifier from OEM_NOTIFY_ISSUER (default
+// MBR_REPORTER_ID) and OEM_NOTIFY_INTERVAL_SECONDS (default 30)
+func NewOEMNotifier(db *gorm.DB) *OEMNotifier {
+	issuer := oemNotifyIssuer.Get()
+	if issuer == "" {
+		issuer = mbrReporterID.Get()
+	}
+	return &OEMNotifier{
+		DB:       db,
+		Clock:    clock.Default(),
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		Issuer:   issuer,
+		Interval: time.Duration(oemNotifyInterval.Get()) * time.Second,
+	}
+}
+
+// RecommendedOEMAction picks the action to recommend for an alert: credentials
+// are revoked when the vehicle's identity is abused, otherwise the vehicle is
+// inspected
+func RecommendedOEMAction(anomalyType string, threats []string) string {
+	switch anomalyType {
+	case AnomalyRevokedCertificate, AnomalySybilSuspected:
+		return OEMActionRevokeCredentials
+	}
+	for _, threat := range threats {
+		if threat == "V2X-SPOOF" || threat == "V2X-SYBIL" {
+			return OEMActionRevokeCredentials
+		}
+	}
+	return OEMActionInspectVehicle
+}
+
+// Notify queues a notification of a confirmed alert to each enabled fleet
+// operator whose vehicle prefixes match the alert's vehicle or a source ID
+// linked to it. Operators already notified of the alert are skipped, and an
+// alert on no vehicle notifies no one.
+func (n *OEMNotifier) Notify(alert *models.Alert) ([]models.OEMNotification, error) {
+	var event models.SecurityEvent
+	if err := n.DB.First(&event, alert.SecurityEventID).Error; err != nil {
+		return nil, err
+	}
+	obs, ok := ParseV2XObservation(&event, "")
+	if !ok {
+		return nil, nil
+	}
+
+	var operators []models.FleetOperator
+	if err := n.DB.Where("enabled = ?", true).Order("name ASC").Find(&operators).Error; err != nil {
+		return nil, err
+	}
+	linked, err := n.linkedPseudonyms(obs.VehicleID)
+	if err != nil {
+		return nil, err
+	}
+	var matched []models.FleetOperator
+	for _, operator := range operators {
+		if operatorMatches(&operator, append([]string{obs.VehicleID}, linked...)) {
+			matched = append(matched, operator)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+
+	var rule models.Rule
+	if err := n.DB.Select("name").First(&rule, alert.RuleID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	evidence, certificateID, err := n.evidence(alert, &event, rule.Name, obs.VehicleID)
+	if err != nil {
+		return nil, err
+	}
+	action := RecommendedOEMAction(evidence.AnomalyType, alert.V2XThreats)
+
+	var created []models.OEMNotification
+	for _, operator := range matched {
+		notificationID, err := newReportID()
+		if err != nil {
+			return created, err
+		}
+		payload, err := json.Marshal(OEMNotificationDocument{
+			Version:           oemNotificationVersion,
+			NotificationID:    notificationID,
+			IssuedAt:          n.Clock.Now().UTC(),
+			Issuer:            n.Issuer,
+			Operator:          operator.Name,
+			Pseudonym:         obs.VehicleID,
+			CertificateID:     certificateID,
+			LinkedPseudonyms:  linked,
+			Evidence:          *evidence,
+			RecommendedAction: action,
+		})
+		if err != nil {
+			return created, err
+		}
+
+		notification := models.OEMNotification{
+			NotificationID:    notificationID,
+			AlertID:           alert.ID,
+			OperatorID:        operator.ID,
+			Pseudonym:         obs.VehicleID,
+			CertificateID:     certificateID,
+			RecommendedAction: action,
+			Payload:           string(payload),
+			Status:            models.OEMNotificationPending,
+		}
+		result := n.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&notification)
+		if result.Error != nil {
+			return created, result.Error
+		}
+		if result.RowsAffected > 0 {
+			created = append(created, notification)
+		}
+	}
+	return created, nil
+}
+
+// operatorMatches reports whether one of the pseudonyms starts with a vehicle prefix of the operator
+func operatorMatches(operator *models.FleetOperator, pseudonyms []string) bool {
+	for _, prefix := range operator.VehiclePrefixes {
+		if prefix == "" {
+			continue
+		}
+		for _, pseudonym := range pseudonyms {
+			if strings.HasPrefix(pseudonym, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// linkedPseudonyms returns the source IDs linked to a pseudonym over the other radio
+func (n *OEMNotifier) linkedPseudonyms(pseudonym string) ([]string, error) {
+	var links []models.VehicleLink
+	if err := n.DB.Where("dsrc_id = ? OR cv2x_id = ?", pseudonym, pseudonym).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	var linked []string
+	for _, link := range links {
+		if link.DSRCID == pseudonym {
+			linked = append(linked, link.CV2XID)
+		} else {
+			linked = append(linked, link.DSRCID)
+		}
+	}
+	sort.Strings(linked)
+	return linked, nil
+}
+
+// evidence summarizes the alert, the event that raised it and the recent
+// misbehavior reports on the pseudonym, and returns the certificate the
+// event names
+func (n *OEMNotifier) evidence(alert *models.Alert, event *models.SecurityEvent, ruleName, pseudonym string) (*OEMEvidence, string, error) {
+	var raw struct {
+		Details map[string]interface{} `json:"details"`
+	}
+	_ = json.Unmarshal([]byte(event.RawData), &raw)
+	detail := func(key string) string {
+		value, _ := raw.Details[key].(string)
+		return value
+	}
+
+	evidence := &OEMEvidence{
+		AlertID:     alert.ID,
+		Rule:        ruleName,
+		Severity:    string(alert.Severity),
+		V2XThreats:  alert.V2XThreats,
+		DetectedAt:  alert.Timestamp.UTC(),
+		ConfirmedAt: n.Clock.Now().UTC(),
+		Resolution:  alert.Resolution,
+		Summary:     event.Message,
+		AnomalyType: detail("anomaly_type"),
+		MessageType: detail("message_type"),
+		Receiver:    detail("rsu_id"),
+		Location:    detail("location"),
+	}
+
+	var reports []models.MisbehaviorReport
+	err := n.DB.Select("report_id", "anomaly_types").
+		Where("source_id = ?", pseudonym).
+		Order("window_start DESC").
+		Limit(maxOEMReports).
+		Find(&reports).Error
+	if err != nil {
+		return nil, "", err
+	}
+	types := make(map[string]bool)
+	for _, report := range reports {
+		evidence.MisbehaviorReports = append(evidence.MisbehaviorReports, report.ReportID)
+		for _, anomalyType := range report.AnomalyTypes {
+			if !types[anomalyType] {
+				types[anomalyType] = true
+				evidence.AnomalyTypes = append(evidence.AnomalyTypes, anomalyType)
+			}
+		}
+	}
+	sort.Strings(evidence.AnomalyTypes)
+
+	certificateID, ok := NormalizeCertificateID(detail("certificate_id"))
+	if !ok {
+		certificateID = ""
+	}
+	return evidence, certificateID, nil
+}
+
+// SignOEMPayload returns the signature header value of a notification body sent at timestamp
+func SignOEMPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver sends a notification to its fleet operator and records the outcome
+func (n *OEMNotifier) Deliver(notification *models.OEMNotification) error {
+	// a deleted or disabled operator counts as a failed attempt so the
+	// notification does not stay pending forever
+	var sendErr error
+	var operator models.FleetOperator
+	if err := n.DB.First(&operator, notification.OperatorID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		sendErr = fmt.Errorf("fleet operator %d no longer exists", notification.OperatorID)
+	} else if !operator.Enabled {
+		sendErr = fmt.Errorf("fleet operator %s is disabled", operator.Name)
+	} else {
+		// sign the bytes as sent; the stored jsonb does not keep the original spacing
+		body, err := json.Marshal(json.RawMessage(notification.Payload))
+		if err != nil {
+			return err
+		}
+		timestamp := strconv.FormatInt(n.Clock.Now().Unix(), 10)
+		headers := map[string]string{
+			"X-SIEM-Timestamp": timestamp,
+			"X-SIEM-Signature": SignOEMPayload(operator.Secret, timestamp, body),
+		}
+		sendErr = routing.PostJSON(n.Client, http.MethodPost, operator.EndpointURL, headers, json.RawMessage(body))
+	}
+
+	notification.Attempts++
+	if sendErr == nil {
+		now := n.Clock.Now()
+		notification.Status = models.OEMNotificationSent
+		notification.LastError = ""
+		notification.SentAt = &now
+	} else {
+		notification.LastError = sendErr.Error()
+		notification.Status = models.OEMNotificationPending
+		if notification.Attempts >= maxOEMAttempts {
+			notification.Status = models.OEMNotificationFailed
+		}
+	}
+
+	err := n.DB.Model(notification).Updates(map[string]interface{}{
+		"status":     notification.Status,
+		"attempts":   notification.Attempts,
+		"last_error": notification.LastError,
+		"sent_at":    notification.SentAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// DeliverPending delivers the notifications waiting for delivery, oldest first
+func (n *OEMNotifier) DeliverPending() (int, error) {
+	var notifications []models.OEMNotification
+	err := n.DB.Where("status = ?", models.OEMNotificationPending).
+		Order("created_at ASC").
+		Limit(100).
+		Find(&notifications).Error
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range notifications {
+		if err := n.Deliver(&notifications[i]); err != nil {
+			log.Printf("Error delivering OEM notification %s: %v", notifications[i].NotificationID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// Start delivers pending notifications in the background
+func (n *OEMNotifier) Start() {
+	go func() {
+		ticker := time.NewTicker(n.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := n.DeliverPending(); err != nil {
+				log.Printf("Error delivering OEM notifications: %v", err)
+			}
+		}
+	}()
+	log.Printf("OEM notification delivery started every %s", n.Interval)
+}
@@ -0,0 +1,51 @@
+package siem
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/auth"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/models"
+)
+
+type organizationContextKey struct{}
+
+// WithOrganization returns ctx carrying the tenant the ingester stamps on the
+// events it stores, and on the findings and alerts they raise. Events
+// ingested without one, such as by the collectors, belong to no tenant.
+func WithOrganization(ctx context.Context, organizationID *uint) context.Context {
+	return context.WithValue(ctx, organizationContextKey{}, organizationID)
+}
+
+// organizationFrom returns the tenant carried by ctx, or nil
+func organizationFrom(ctx context.Context) *uint {
+	if ctx == nil {
+		return nil
+	}
+	organizationID, _ := ctx.Value(organizationContextKey{}).(*uint)
+	return organizationID
+}
+
+// ruleTenantAdmits reports whether a rule applies to the tenant of an event:
+// rules without an organization apply to every tenant, the others to their own
+func ruleTenantAdmits(rule *models.Rule, event *models.SecurityEvent) bool {
+	if rule.OrganizationID == nil {
+		return true
+	}
+	return event.OrganizationID != nil && *event.OrganizationID == *rule.OrganizationID
+}
+
+// OrganizationSlugs resolves organization IDs to the slugs naming their
+// Elasticsearch indices; an organization that cannot be resolved is logged and
+// indexed with the events of no tenant
+func OrganizationSlugs(db *gorm.DB) func(id uint) string {
+	return func(id uint) string {
+		organization, err := auth.OrganizationByID(db, id)
+		if err != nil {
+			logging.Sampled("organizations.slug", "Error resolving organization %d for indexing: %v", id, err)
+			return ""
+		}
+		return organization.Slug
+	}
+}
@@ -0,0 +1,204 @@
+package siem
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/routing"
+)
+
+// AlertChangeMessage is what downstream consumers receive for each alert change.
+// Delivery is at-least-once: consumers should ignore change IDs they have already seen.
+type AlertChangeMessage struct {
+	ChangeID   uint                        `json:"change_id"`
+	AlertID    uint                        `json:"alert_id"`
+	Operation  models.AlertChangeOperation `json:"operation"`
+	OccurredAt time.Time                   `json:"occurred_at"`
+	Alert      json.RawMessage             `json:"alert"`
+}
+
+// NewAlertChangeMessage builds the published form of an outbox row
+func NewAlertChangeMessage(change *models.AlertChange) AlertChangeMessage {
+	return AlertChangeMessage{
+		ChangeID:   change.ID,
+		AlertID:    change.AlertID,
+		Operation:  change.Operation,
+		OccurredAt: change.CreatedAt,
+		Alert:      json.RawMessage(change.Payload),
+	}
+}
+
+// AlertOutboxPublisher relays alert changes from the outbox table to Kafka or a webhook
+type AlertOutboxPublisher struct {
+	DB        *gorm.DB
+	Publish   func(message AlertChangeMessage) error
+	Target    string
+	BatchSize int
+	Interval  time.Duration
+	Retention time.Duration // published rows older than this are purged
+}
+
+var (
+	cdcIntervalSeconds = config.NewInt("ALERT_CDC_INTERVAL_SECONDS", 2, "Seconds between publications of the alert change outbox", config.Min(1))
+	cdcRetentionHours  = config.NewInt("ALERT_CDC_RETENTION_HOURS", 72, "Hours published alert changes are kept in the outbox", config.Min(1))
+	cdcKafkaURL        = config.NewString("ALERT_CDC_KAFKA_URL", "", "Kafka REST proxy alert changes are published to")
+	cdcTopic           = config.NewString("ALERT_CDC_TOPIC", "siem.alerts", "Kafka topic of the alert changes")
+	cdcWebhookURL      = config.NewString("ALERT_CDC_WEBHOOK_URL", "", "Webhook alert changes are posted to when no Kafka proxy is set")
+)
+
+// NewAlertOutboxPublisher configures a publisher from the environment:
+// ALERT_CDC_KAFKA_URL (REST proxy) with ALERT_CDC_TOPIC, or ALERT_CDC_WEBHOOK_URL.
+// Without a target, Publish is nil and changes stay in the outbox for pull consumers.
+func NewAlertOutboxPublisher(db *gorm.DB) *AlertOutboxPublisher {
+	p := &AlertOutboxPublisher{
+		DB:        db,
+		BatchSize: 100,
+		Interval:  time.Duration(cdcIntervalSeconds.Get()) * time.Second,
+		Retention: time.Duration(cdcRetentionHours.Get()) * time.Hour,
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	if proxyURL := cdcKafkaURL.Get(); proxyURL != "" {
+		topic := cdcTopic.Get()
+		p.Target = "kafka topic " + topic
+		p.Publish = func(message AlertChangeMessage) error {
+			// keyed by alert so all changes of one alert stay ordered on one partition
+			return routing.PublishKafka(client, proxyURL, topic, strconv.FormatUint(uint64(message.AlertID), 10), message)
+		}
+	} else if webhookURL := cdcWebhookURL.Get(); webhookURL != "" {
+		p.Target = "webhook " + webhookURL
+		p.Publish = func(message AlertChangeMessage) error {
+			return routing.PostJSON(client, http.MethodPost, webhookURL, nil, message)
+		}
+	}
+
+	return p
+}
+
+// Start publishes pending changes in the background. Rows are marked published only
+// after the target accepts them, so changes left over from a crash are sent on restart.
+func (p *AlertOutboxPublisher) Start() {
+	if p.Publish == nil {
+		log.Println("Alert change stream has no publish target; changes are available from GET /alerts/changes")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.Interval)
+		defer ticker.Stop()
+
+		lastPurge := time.Now()
+		for range ticker.C {
+			for {
+				published, err := p.PublishPending()
+				if err != nil {
+					log.Printf("Error publishing alert changes to %s: %v", p.Target, err)
+					break
+				}
+				if published < p.BatchSize {
+					break
+				}
+			}
+
+			if time.Since(lastPurge) > time.Hour {
+				if err := p.Purge(); err != nil {
+					log.Printf("Error purging published alert changes: %v", err)
+				}
+				lastPurge = time.Now()
+			}
+		}
+	}()
+
+	log.Printf("Alert change stream publishing to %s", p.Target)
+}
+
+// PublishPending publishes the oldest unpublished changes in order and returns how
+// many were published. It stops at the first failure so changes are never reordered.
+func (p *AlertOutboxPublisher) PublishPending() (int, error) {
+	if p.Publish == nil {
+		return 0, errors.New("no alert change publish target configured")
+	}
+
+	published := 0
+	var publishErr error
+
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		// lock the batch so several SIEM instances never publish the same rows concurrently
+		var changes []models.AlertChange
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("published_at IS NULL").
+			Order("id ASC").
+			Limit(p.BatchSize).
+			Find(&changes).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range changes {
+			change := &changes[i]
+			if publishErr = p.Publish(NewAlertChangeMessage(change)); publishErr != nil {
+				return tx.Model(change).Updates(map[string]interface{}{
+					"attempts":   gorm.Expr("attempts + 1"),
+					"last_error": publishErr.Error(),
+				}).Error
+			}
+
+			now := time.Now()
+			err := tx.Model(change).Updates(map[string]interface{}{
+				"attempts":     gorm.Expr("attempts + 1"),
+				"last_error":   "",
+				"published_at": now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			published++
+		}
+		return nil
+	})
+	if err != nil {
+		return published, err
+	}
+	return published, publishErr
+}
+
+// Purge deletes published changes older than the retention period
+func (p *AlertOutboxPublisher) Purge() error {
+	cutoff := time.Now().Add(-p.Retention)
+	return p.DB.Where("published_at IS NOT NULL AND published_at < ?", cutoff).Delete(&models.AlertChange{}).Error
+}
+
+// AlertOutboxStatus summarizes the outbox backlog
+type AlertOutboxStatus struct {
+	Target          string     `json:"target,omitempty"`
+	Pending         int64      `json:"pending"`
+	OldestPendingAt *time.Time `json:"oldest_pending_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+}
+
+// Status reports how many changes are waiting to be published
+func (p *AlertOutboxPublisher) Status() (AlertOutboxStatus, error) {
+	status := AlertOutboxStatus{Target: p.Target}
+	if err := p.DB.Model(&models.AlertChange{}).Where("published_at IS NULL").Count(&status.Pending).Error; err != nil {
+		return status, err
+	}
+	if status.Pending == 0 {
+		return status, nil
+	}
+
+	var oldest models.AlertChange
+	if err := p.DB.Where("published_at IS NULL").Order("id ASC").First(&oldest).Error; err != nil {
+		return status, err
+	}
+	status.OldestPendingAt = &oldest.CreatedAt
+	status.LastError = oldest.LastError
+	return status, nil
+}
@@ -0,0 +1,463 @@
+package siem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/metrics"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// parseLog is the logger of the parsers and the parse error statistics
+var parseLog = logging.New("parsers")
+
+// AnomalyParseFailureSurge is reported for a source most of whose messages
+// fail to parse, which may be malformed attack traffic
+const AnomalyParseFailureSurge = "parse_failure_surge"
+
+// maxParseErrorLength bounds the last error kept for each parse error count
+const maxParseErrorLength = 500
+
+var parseFailuresByReason = metrics.NewCounterVec("siem_parse_failures_by_reason_total",
+	"Messages that could not be parsed into a security event, by collector, message type and reason",
+	"collector", "message_type", "reason")
+
+// ParseSource identifies where a message came from, for the parse error statistics
+type ParseSource struct {
+	Collector   string // the collector, listener or API that received the message
+	Address     string // the sender, host or host:port
+	MessageType string // the format the message was parsed as
+}
+
+type parseSourceContextKey struct{}
+
+// WithParseSource returns ctx carrying source, so the ingester counts the
+// message, and its parse failure if any, against it. Events ingested without
+// a source, such as the findings the SIEM raises, are not counted.
+func WithParseSource(ctx context.Context, source ParseSource) context.Context {
+	return context.WithValue(ctx, parseSourceContextKey{}, source)
+}
+
+// parseSourceFrom returns the source carried by ctx
+func parseSourceFrom(ctx context.Context) (ParseSource, bool) {
+	source, ok := ctx.Value(parseSourceContextKey{}).(ParseSource)
+	return source, ok
+}
+
+// eventParseError is returned by the ingester when a message is not a valid raw event
+type eventParseError struct {
+	err error
+}
+
+func (e *eventParseError) Error() string { return e.err.Error() }
+func (e *eventParseError) Unwrap() error { return e.err }
+
+// parseFailureReason classifies a parse error into a low-cardinality reason
+func parseFailureReason(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return "invalid_json"
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			return "wrong_type:" + typeErr.Field
+		}
+		return "wrong_type"
+	case errors.As(err, &timeErr):
+		return "invalid_timestamp"
+	default:
+		return "other"
+	}
+}
+
+// sourceHost drops the port of a host:port address, so a sender's messages
+// are counted together whichever port they came from
+func sourceHost(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+type parseErrorKey struct {
+	bucket      time.Time
+	collector   string
+	address     string
+	messageType string
+	reason      string
+}
+
+type parseErrorTally struct {
+	count     int64
+	lastError string
+	lastSeen  time.Time
+}
+
+type parseSourceKey struct {
+	bucket    time.Time
+	collector string
+	address   string
+}
+
+type parseSourceTally struct {
+	messages int64
+	failures int64
+}
+
+// parseStats accumulates parse counts in memory until the reporter flushes them
+type parseStats struct {
+	mu      sync.Mutex
+	errors  map[parseErrorKey]*parseErrorTally
+	sources map[parseSourceKey]*parseSourceTally
+}
+
+var defaultParseStats = newParseStats()
+
+func newParseStats() *parseStats {
+	return &parseStats{
+		errors:  make(map[parseErrorKey]*parseErrorTally),
+		sources: make(map[parseSourceKey]*parseSourceTally),
+	}
+}
+
+// record counts a message from source, and its failure when err is not nil
+func (s *parseStats) record(source ParseSource, err error, now time.Time) {
+	bucket := now.UTC().Truncate(time.Hour)
+	address := sourceHost(source.Address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sourceKey := parseSourceKey{bucket: bucket, collector: source.Collector, address: address}
+	tally := s.sources[sourceKey]
+	if tally == nil {
+		tally = &parseSourceTally{}
+		s.sources[sourceKey] = tally
+	}
+	tally.messages++
+	if err == nil {
+		return
+	}
+	tally.failures++
+
+	errorKey := parseErrorKey{
+		bucket:      bucket,
+		collector:   source.Collector,
+		address:     address,
+		messageType: source.MessageType,
+		reason:      parseFailureReason(err),
+	}
+	errTally := s.errors[errorKey]
+	if errTally == nil {
+		errTally = &parseErrorTally{}
+		s.errors[errorKey] = errTally
+	}
+	errTally.count++
+	errTally.lastError = err.Error()
+	if len(errTally.lastError) > maxParseErrorLength {
+		errTally.lastError = errTally.lastError[:maxParseErrorLength]
+	}
+	errTally.lastSeen = now
+}
+
+// take returns the counts accumulated so far and starts over
+func (s *parseStats) take() (map[parseErrorKey]*parseErrorTally, map[parseSourceKey]*parseSourceTally) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs, sources := s.errors, s.sources
+	s.errors = make(map[parseErrorKey]*parseErrorTally)
+	s.sources = make(map[parseSourceKey]*parseSourceTally)
+	return errs, sources
+}
+
+// restore adds counts that could not be saved back, so the next flush retries them
+func (s *parseStats) restore(errs map[parseErrorKey]*parseErrorTally, sources map[parseSourceKey]*parseSourceTally) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, tally := range errs {
+		if current := s.errors[key]; current != nil {
+			current.count += tally.count
+		} else {
+			s.errors[key] = tally
+		}
+	}
+	for key, tally := range sources {
+		if current := s.sources[key]; current != nil {
+			current.messages += tally.messages
+			current.failures += tally.failures
+		} else {
+			s.sources[key] = tally
+		}
+	}
+}
+
+// RecordParseFailure counts a message a collector could not turn into a raw
+// event, before it reached the ingester
+func RecordParseFailure(source ParseSource, err error) {
+	ParseFailures.Inc(source.Collector)
+	recordParse(source, err)
+}
+
+// recordParse counts a message from source in the parse error statistics
+func recordParse(source ParseSource, err error) {
+	if err != nil {
+		parseFailuresByReason.Inc(source.Collector, source.MessageType, parseFailureReason(err))
+	}
+	defaultParseStats.record(source, err, time.Now())
+}
+
+// recordIngestParse counts a message ingested with a parse source in ctx:
+// parse failures as failures, and any other outcome as a parsed message
+func recordIngestParse(ctx context.Context, err error) {
+	source, ok := parseSourceFrom(ctx)
+	if !ok {
+		return
+	}
+	var parseErr *eventParseError
+	if errors.As(err, &parseErr) {
+		parseLog.WithContext(ctx).Sampled("parse."+source.Collector).Debug("failed to parse event",
+			"collector", source.Collector, "address", source.Address, "message_type", source.MessageType, "error", err)
+		recordParse(source, err)
+		return
+	}
+	recordParse(source, nil)
+}
+
+// ParseErrorReporter saves the parse error statistics and raises a system
+// finding for each source whose messages mostly fail to parse
+type ParseErrorReporter struct {
+	DB          *gorm.DB
+	Clock       clock.Clock
+	Interval    time.Duration
+	Threshold   float64       // failure rate of a source, over one interval, that raises a finding
+	MinMessages int64         // messages a source must send in an interval to be judged
+	Cooldown    time.Duration // between findings on the same source
+
+	stats     *parseStats
+	lastAlert map[parseSourceKey]time.Time // keyed without bucket
+}
+
+var (
+	parseErrorFlushSeconds  = config.NewInt("PARSE_ERROR_FLUSH_SECONDS", 60, "Seconds between saves of the parse failure statistics", config.Min(1))
+	parseErrorRateThreshold = config.NewFloat("PARSE_ERROR_RATE_THRESHOLD", 0.5,
+		"Failure rate of a source over one flush interval that raises a finding", config.Positive, config.Max(1))
+	parseErrorMinMessages = config.NewInt("PARSE_ERROR_MIN_MESSAGES", 20, "Messages a source must send in an interval to be judged", config.Min(1))
+	parseErrorCooldown    = config.NewInt("PARSE_ERROR_ALERT_COOLDOWN_MINUTES", 60, "Minutes between parse failure findings on the same source", config.Min(0))
+)
+
+// NewParseErrorReporter configures a reporter from PARSE_ERROR_FLUSH_SECONDS
+// (default 60), PARSE_ERROR_RATE_THRESHOLD (default 0.5),
+// PARSE_ERROR_MIN_MESSAGES (default 20) and PARSE_ERROR_ALERT_COOLDOWN_MINUTES
+// (default 60)
+func NewParseErrorReporter(db *gorm.DB) *ParseErrorReporter {
+	return &ParseErrorReporter{
+		DB:          db,
+		Clock:       clock.Default(),
+		Interval:    time.Duration(parseErrorFlushSeconds.Get()) * time.Second,
+		Threshold:   parseErrorRateThreshold.Get(),
+		MinMessages: int64(parseErrorMinMessages.Get()),
+		Cooldown:    time.Duration(parseErrorCooldown.Get()) * time.Minute,
+		stats:       defaultParseStats,
+		lastAlert:   make(map[parseSourceKey]time.Time),
+	}
+}
+
+// Flush saves the counts accumulated since the last flush and raises a
+// finding for each source over the failure rate threshold in that time
+func (r *ParseErrorReporter) Flush() (int, error) {
+	errs, sources := r.stats.take()
+	if len(errs) == 0 && len(sources) == 0 {
+		return 0, nil
+	}
+	if err := r.save(errs, sources); err != nil {
+		r.stats.restore(errs, sources)
+		return 0, err
+	}
+	return r.raiseFindings(errs, sources)
+}
+
+// save adds the counts to their hourly rows
+func (r *ParseErrorReporter) save(errs map[parseErrorKey]*parseErrorTally, sources map[parseSourceKey]*parseSourceTally) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for key, tally := range sources {
+			row := models.ParseSourceCount{
+				BucketStart:   key.bucket,
+				Collector:     key.collector,
+				SourceAddress: key.address,
+				Messages:      tally.messages,
+				Failures:      tally.failures,
+			}
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "bucket_start"}, {Name: "collector"}, {Name: "source_address"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"messages": gorm.Expr("parse_source_counts.messages + ?", tally.messages),
+					"failures": gorm.Expr("parse_source_counts.failures + ?", tally.failures),
+				}),
+			}).Create(&row).Error
+			if err != nil {
+				return err
+			}
+		}
+		for key, tally := range errs {
+			row := models.ParseErrorCount{
+				BucketStart:   key.bucket,
+				Collector:     key.collector,
+				SourceAddress: key.address,
+				MessageType:   key.messageType,
+				Reason:        key.reason,
+				Count:         tally.count,
+				LastError:     tally.lastError,
+				LastSeen:      tally.lastSeen,
+			}
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "bucket_start"}, {Name: "collector"}, {Name: "source_address"},
+					{Name: "message_type"}, {Name: "reason"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"count":      gorm.Expr("parse_error_counts.count + ?", tally.count),
+					"last_error": tally.lastError,
+					"last_seen":  tally.lastSeen,
+				}),
+			}).Create(&row).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// parseSurge is a source whose failure rate crossed the threshold in one flush
+type parseSurge struct {
+	key       parseSourceKey
+	messages  int64
+	failures  int64
+	topReason string
+}
+
+// raiseFindings ingests a system finding for each source over the threshold
+// that has not had one within the cooldown
+func (r *ParseErrorReporter) raiseFindings(errs map[parseErrorKey]*parseErrorTally, sources map[parseSourceKey]*parseSourceTally) (int, error) {
+	// a flush can straddle an hour, so add the buckets of each source together
+	totals := make(map[parseSourceKey]*parseSourceTally)
+	for key, tally := range sources {
+		key.bucket = time.Time{}
+		total := totals[key]
+		if total == nil {
+			total = &parseSourceTally{}
+			totals[key] = total
+		}
+		total.messages += tally.messages
+		total.failures += tally.failures
+	}
+	reasons := make(map[parseSourceKey]map[string]int64)
+	for key, tally := range errs {
+		sourceKey := parseSourceKey{collector: key.collector, address: key.address}
+		if reasons[sourceKey] == nil {
+			reasons[sourceKey] = make(map[string]int64)
+		}
+		reasons[sourceKey][key.reason] += tally.count
+	}
+
+	now := r.Clock.Now()
+	var surges []parseSurge
+	for key, total := range totals {
+		if total.messages < r.MinMessages || float64(total.failures)/float64(total.messages) < r.Threshold {
+			continue
+		}
+		if last, ok := r.lastAlert[key]; ok && now.Sub(last) < r.Cooldown {
+			continue
+		}
+		surges = append(surges, parseSurge{key: key, messages: total.messages, failures: total.failures, topReason: topReason(reasons[key])})
+	}
+	sort.Slice(surges, func(i, j int) bool {
+		if surges[i].key.collector != surges[j].key.collector {
+			return surges[i].key.collector < surges[j].key.collector
+		}
+		return surges[i].key.address < surges[j].key.address
+	})
+
+	ingester := NewEventIngester(r.DB)
+	ingester.Clock = r.Clock
+	ingester.EvaluateRules = true
+	raised := 0
+	for _, surge := range surges {
+		data, err := ParseFailureSurgeEvent(surge.key.collector, surge.key.address, surge.messages, surge.failures, surge.topReason, r.Interval, now)
+		if err != nil {
+			return raised, err
+		}
+		if _, err := ingester.Ingest(context.Background(), data); err != nil {
+			return raised, err
+		}
+		r.lastAlert[surge.key] = now
+		raised++
+	}
+	return raised, nil
+}
+
+// topReason returns the most frequent reason, the first by name on a tie
+func topReason(reasons map[string]int64) string {
+	top := ""
+	for reason, count := range reasons {
+		if top == "" || count > reasons[top] || count == reasons[top] && reason < top {
+			top = reason
+		}
+	}
+	return top
+}
+
+// ParseFailureSurgeEvent builds the system finding raised for a source most
+// of whose messages failed to parse within window
+func ParseFailureSurgeEvent(collector, address string, messages, failures int64, reason string, window time.Duration, at time.Time) ([]byte, error) {
+	rate := float64(failures) / float64(messages)
+	return json.Marshal(map[string]interface{}{
+		"source_name": "siem-parser",
+		"source_type": string(models.SourceTypeSystem),
+		"timestamp":   at,
+		"severity":    string(models.SeverityHigh),
+		"category":    string(models.CategorySystem),
+		"message": fmt.Sprintf("%d of %d messages from %s on %s failed to parse (%.0f%%), possibly malformed attack traffic",
+			failures, messages, address, collector, rate*100),
+		"details": map[string]interface{}{
+			"anomaly_type": AnomalyParseFailureSurge,
+			"collector":    collector,
+			"source_ip":    address,
+			"messages":     messages,
+			"failures":     failures,
+			"failure_rate": rate,
+			"top_reason":   reason,
+			"window":       window.String(),
+		},
+	})
+}
+
+// Start flushes the parse error statistics every interval
+func (r *ParseErrorReporter) Start() {
+	go func() {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			raised, err := r.Flush()
+			if err != nil {
+				parseLog.Error("failed to flush parse error statistics", "error", err)
+			} else if raised > 0 {
+				parseLog.Info("raised parse failure surge findings", "findings", raised)
+			}
+		}
+	}()
+
+	parseLog.Info("parse error statistics reporter started", "interval", r.Interval, "threshold_pct", r.Threshold*100)
+}
@@ -0,0 +1,152 @@
+package siem
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// pdfStyle is the font of a line of a PDF document
+type pdfStyle int
+
+const (
+	pdfTitle   pdfStyle = iota // Helvetica-Bold 16
+	pdfHeading                 // Helvetica-Bold 12
+	pdfText                    // Helvetica 10
+	pdfMono                    // Courier 9, for table rows
+)
+
+// pdfFonts are the font resource, size and line height of each style
+var pdfFonts = map[pdfStyle]struct {
+	resource string
+	size     float64
+	leading  float64
+}{
+	pdfTitle:   {"F2", 16, 24},
+	pdfHeading: {"F2", 12, 20},
+	pdfText:    {"F1", 10, 14},
+	pdfMono:    {"F3", 9, 12},
+}
+
+// pdfLine is one line of a PDF document
+type pdfLine struct {
+	style pdfStyle
+	text  string
+}
+
+// A4 pages in points, with the margin left on each side
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 50
+)
+
+// writePDF writes a minimal PDF document of A4 pages holding the lines in the
+// standard Helvetica and Courier fonts, which every reader has. Characters
+// outside Latin-1 are written as '?'; lines too long for the page are wrapped.
+func writePDF(w io.Writer, title string, lines []pdfLine) error {
+	// lay the lines out on pages
+	var pages []bytes.Buffer
+	y := 0.0
+	for _, line := range lines {
+		font := pdfFonts[line.style]
+		for _, text := range pdfWrap(line.text, line.style) {
+			if len(pages) == 0 || y-font.leading < pdfMargin {
+				pages = append(pages, bytes.Buffer{})
+				y = pdfPageHeight - pdfMargin
+			}
+			y -= font.leading
+			fmt.Fprintf(&pages[len(pages)-1], "BT /%s %.0f Tf %d %.1f Td (%s) Tj ET\n", font.resource, font.size, pdfMargin, y, pdfEscape(text))
+		}
+	}
+	if len(pages) == 0 {
+		pages = append(pages, bytes.Buffer{})
+	}
+
+	// objects 1 to 6 are the catalog, the page tree, the info and the three
+	// fonts; each page then takes two, itself and its content stream
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 7+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		fmt.Sprintf("<< /Title (%s) /Producer (V2X SIEM) >>", pdfEscape(title)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	)
+	for i, page := range pages {
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 4 0 R /F2 5 0 R /F3 6 0 R >> >> /Contents %d 0 R >>",
+				pdfPageWidth, pdfPageHeight, 8+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()),
+		)
+	}
+
+	var doc bytes.Buffer
+	doc.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = doc.Len()
+		fmt.Fprintf(&doc, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := doc.Len()
+	fmt.Fprintf(&doc, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&doc, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&doc, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := w.Write(doc.Bytes())
+	return err
+}
+
+// pdfWrap splits a line into the lines that fit the page width, at spaces
+// where it can. Helvetica widths are estimated at half the font size.
+func pdfWrap(text string, style pdfStyle) []string {
+	charWidth := pdfFonts[style].size * 0.5
+	if style == pdfMono {
+		charWidth = pdfFonts[style].size * 0.6
+	}
+	width := int((pdfPageWidth - 2*pdfMargin) / charWidth)
+
+	runes := []rune(text)
+	var lines []string
+	for len(runes) > width {
+		cut := width
+		for i := width; i > width/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		lines = append(lines, string(runes[:cut]))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	return append(lines, string(runes))
+}
+
+// pdfEscape encodes text as the body of a PDF literal string in Latin-1
+func pdfEscape(text string) string {
+	var out strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r == '\t':
+			out.WriteByte(' ')
+		case r < 32 || r > 255:
+			out.WriteByte('?')
+		case r < 128:
+			out.WriteRune(r)
+		default:
+			fmt.Fprintf(&out, "\\%03o", r)
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,452 @@
+package siem
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// Sections of a regulatory report
+const (
+	RegulatoryMessageVolumes    = "message_volumes"
+	RegulatorySecurityIncidents = "security_incidents"
+	RegulatoryAnomalies         = "anomalies"
+)
+
+// regulatoryAllCorridors labels the rows covering the whole network
+const regulatoryAllCorridors = "ALL"
+
+// regulatoryColumns lists the column keys of each section; templates rename them with Headers
+var regulatoryColumns = map[string][]string{
+	RegulatoryMessageVolumes:    {"period", "corridor", "message_type", "messages", "vehicles"},
+	RegulatorySecurityIncidents: {"period", "corridor", "severity", "alerts", "confirmed_malicious", "false_positive"},
+	RegulatoryAnomalies:         {"period", "corridor", "anomaly_type", "findings", "sources"},
+}
+
+// NormalizeRegulatoryTemplate validates a template before it is stored, filling in defaults
+func NormalizeRegulatoryTemplate(template *models.RegulatoryTemplate) error {
+	template.Name = strings.TrimSpace(template.Name)
+	if template.Name == "" || template.Jurisdiction == "" {
+		return fmt.Errorf("name and jurisdiction are required")
+	}
+	if len(template.Sections) == 0 {
+		template.Sections = []string{RegulatoryMessageVolumes, RegulatorySecurityIncidents, RegulatoryAnomalies}
+	}
+	for _, section := range template.Sections {
+		if _, ok := regulatoryColumns[section]; !ok {
+			return fmt.Errorf("unknown section %q (use %s, %s or %s)", section, RegulatoryMessageVolumes, RegulatorySecurityIncidents, RegulatoryAnomalies)
+		}
+	}
+	if len(template.Formats) == 0 {
+		template.Formats = []string{"csv"}
+	}
+	for _, format := range template.Formats {
+		if format != "csv" && format != "xlsx" {
+			return fmt.Errorf("unknown format %q (use csv or xlsx)", format)
+		}
+	}
+	if template.Delimiter == "" {
+		template.Delimiter = ","
+	}
+	if utf8.RuneCountInString(template.Delimiter) != 1 || template.Delimiter == "\"" || template.Delimiter == "\n" {
+		return fmt.Errorf("delimiter must be a single character")
+	}
+	if template.Timezone == "" {
+		template.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(template.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", template.Timezone)
+	}
+	return nil
+}
+
+// RegulatoryReporter packages the monthly V2X reports regulators ask for:
+// message volumes, security incidents and anomalies per corridor, with
+// corridors given by zone geofences
+type RegulatoryReporter struct {
+	DB       *gorm.DB
+	Clock    clock.Clock
+	Interval time.Duration // how often the scheduler looks for months to report
+}
+
+var regulatoryCheckMinutes = config.NewInt("REGULATORY_REPORT_CHECK_MINUTES", 60, "Minutes between checks for months to report", config.Min(1))
+
+// NewRegulatoryReporter configures a reporter from REGULATORY_REPORT_CHECK_MINUTES (default 60)
+func NewRegulatoryReporter(db *gorm.DB) *RegulatoryReporter {
+	return &RegulatoryReporter{
+		DB:       db,
+		Clock:    clock.Default(),
+		Interval: time.Duration(regulatoryCheckMinutes.Get()) * time.Minute,
+	}
+}
+
+// ParseRegulatoryPeriod returns the bounds of a YYYY-MM month in a template's timezone
+func ParseRegulatoryPeriod(template *models.RegulatoryTemplate, period string) (time.Time, time.Time, error) {
+	location, err := time.LoadLocation(template.Timezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start, err := time.ParseInLocation("2006-01", period, location)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("period must be a month as YYYY-MM")
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// regulatoryCount counts the rows of one key and the distinct IDs behind them
+type regulatoryCount struct {
+	count int
+	ids   map[string]bool
+	extra map[string]int
+}
+
+// regulatoryCounts aggregates a section by corridor and one more key
+type regulatoryCounts map[[2]string]*regulatoryCount
+
+func (counts regulatoryCounts) add(corridors []string, key, id string) *regulatoryCount {
+	var last *regulatoryCount
+	for _, corridor := range corridors {
+		entry, ok := counts[[2]string{corridor, key}]
+		if !ok {
+			entry = &regulatoryCount{ids: make(map[string]bool), extra: make(map[string]int)}
+			counts[[2]string{corridor, key}] = entry
+		}
+		entry.count++
+		if id != "" {
+			entry.ids[id] = true
+		}
+		last = entry
+	}
+	return last
+}
+
+// sortedKeys orders the aggregated keys with the network totals first
+func (counts regulatoryCounts) sortedKeys() [][2]string {
+	keys := make([][2]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			if keys[i][0] == regulatoryAllCorridors || keys[j][0] == regulatoryAllCorridors {
+				return keys[i][0] == regulatoryAllCorridors
+			}
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
+
+// corridors returns the zone geofences a template reports on
+func (r *RegulatoryReporter) corridors(template *models.RegulatoryTemplate) ([]models.Geofence, error) {
+	fences, byName, err := defaultGeofenceCache.get(r.DB)
+	if err != nil {
+		return nil, err
+	}
+	var corridors []models.Geofence
+	if len(template.Corridors) == 0 {
+		for _, fence := range fences {
+			if fence.Kind == models.GeofenceZone {
+				corridors = append(corridors, fence)
+			}
+		}
+		return corridors, nil
+	}
+	for _, name := range template.Corridors {
+		fence, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or disabled corridor geofence: %s", name)
+		}
+		corridors = append(corridors, *fence)
+	}
+	return corridors, nil
+}
+
+// locateCorridors returns the corridors a coordinate lies in, with the network total
+func locateCorridors(corridors []models.Geofence, lat, lon float64, ok bool) []string {
+	names := []string{regulatoryAllCorridors}
+	if !ok {
+		return names
+	}
+	for i := range corridors {
+		if GeofenceContains(&corridors[i], lat, lon) {
+			names = append(names, corridors[i].Name)
+		}
+	}
+	return names
+}
+
+// Generate builds the report package of a template for a YYYY-MM period,
+// replacing the one generated before for the same period
+func (r *RegulatoryReporter) Generate(template *models.RegulatoryTemplate, period string) (*models.RegulatoryReport, error) {
+	start, end, err := ParseRegulatoryPeriod(template, period)
+	if err != nil {
+		return nil, err
+	}
+	if end.After(r.Clock.Now()) {
+		return nil, fmt.Errorf("period %s has not ended yet", period)
+	}
+	corridors, err := r.corridors(template)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make(map[string][][]string)
+	needEvents := false
+	for _, section := range template.Sections {
+		if section == RegulatoryMessageVolumes || section == RegulatoryAnomalies {
+			needEvents = true
+		}
+	}
+	volumes, anomalies := regulatoryCounts{}, regulatoryCounts{}
+	if needEvents {
+		if err := r.countEvents(start, end, corridors, volumes, anomalies); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, section := range template.Sections {
+		var rows [][]string
+		switch section {
+		case RegulatoryMessageVolumes:
+			for _, key := range volumes.sortedKeys() {
+				entry := volumes[key]
+				rows = append(rows, []string{period, key[0], key[1], strconv.Itoa(entry.count), strconv.Itoa(len(entry.ids))})
+			}
+		case RegulatoryAnomalies:
+			for _, key := range anomalies.sortedKeys() {
+				entry := anomalies[key]
+				rows = append(rows, []string{period, key[0], key[1], strconv.Itoa(entry.count), strconv.Itoa(len(entry.ids))})
+			}
+		case RegulatorySecurityIncidents:
+			incidents, err := r.countIncidents(start, end, corridors)
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range incidents.sortedKeys() {
+				entry := incidents[key]
+				rows = append(rows, []string{period, key[0], key[1], strconv.Itoa(entry.count),
+					strconv.Itoa(entry.extra[string(models.AlertStatusConfirmedMalicious)]),
+					strconv.Itoa(entry.extra[string(models.AlertStatusFalsePositive)])})
+			}
+		}
+		tables[section] = rows
+	}
+
+	archive, err := r.pack(template, period, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	report := models.RegulatoryReport{
+		TemplateID:  template.ID,
+		Period:      period,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Filename:    fmt.Sprintf("%s-%s.zip", regulatoryFileName(template.Name), period),
+		Size:        len(archive),
+		Archive:     archive,
+	}
+	err = r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "template_id"}, {Name: "period"}},
+		DoUpdates: clause.AssignmentColumns([]string{"period_start", "period_end", "filename", "size", "archive", "created_at"}),
+	}).Create(&report).Error
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// countEvents aggregates the V2X messages and anomaly findings of [start, end)
+func (r *RegulatoryReporter) countEvents(start, end time.Time, corridors []models.Geofence, volumes, anomalies regulatoryCounts) error {
+	var batch []models.SecurityEvent
+	return r.DB.Select("id", "timestamp", "device_id", "raw_data").
+		Where("category = ? AND timestamp >= ? AND timestamp < ?", models.CategoryV2X, start, end).
+		FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				event := &batch[i]
+				var raw struct {
+					Details map[string]interface{} `json:"details"`
+				}
+				if json.Unmarshal([]byte(event.RawData), &raw) != nil {
+					continue
+				}
+				detail := func(key string) string {
+					value, _ := raw.Details[key].(string)
+					return value
+				}
+				vehicleID := detail("vehicle_id")
+				if vehicleID == "" {
+					vehicleID = event.DeviceID
+				}
+				lat, lon, located := EventLocation(event)
+				names := locateCorridors(corridors, lat, lon, located)
+
+				if anomalyType := detail("anomaly_type"); anomalyType != "" {
+					anomalies.add(names, anomalyType, vehicleID)
+					continue
+				}
+				messageType := detail("message_type")
+				if messageType == "" {
+					messageType = "unknown"
+				}
+				volumes.add(names, messageType, vehicleID)
+			}
+			return nil
+		}).Error
+}
+
+// countIncidents aggregates the alerts raised in [start, end) by severity
+func (r *RegulatoryReporter) countIncidents(start, end time.Time, corridors []models.Geofence) (regulatoryCounts, error) {
+	var alerts []models.Alert
+	err := r.DB.Select("id", "severity", "status", "latitude", "longitude").
+		Where("timestamp >= ? AND timestamp < ?", start, end).
+		Find(&alerts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	incidents := regulatoryCounts{}
+	for _, alert := range alerts {
+		located := alert.Latitude != nil && alert.Longitude != nil
+		var lat, lon float64
+		if located {
+			lat, lon = *alert.Latitude, *alert.Longitude
+		}
+		for _, name := range locateCorridors(corridors, lat, lon, located) {
+			entry := incidents.add([]string{name}, string(alert.Severity), "")
+			entry.extra[string(alert.Status)]++
+		}
+	}
+	return incidents, nil
+}
+
+// pack writes each section in each format of the template into a zip
+func (r *RegulatoryReporter) pack(template *models.RegulatoryTemplate, period string, tables map[string][][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	base := regulatoryFileName(template.Name) + "-" + period
+
+	var sheets []xlsxSheet
+	for _, section := range template.Sections {
+		header := make([]string, 0, len(regulatoryColumns[section]))
+		for _, column := range regulatoryColumns[section] {
+			if label, ok := template.Headers[column]; ok && label != "" {
+				column = label
+			}
+			header = append(header, column)
+		}
+		rows := append([][]string{header}, tables[section]...)
+		sheets = append(sheets, xlsxSheet{name: section, rows: rows})
+
+		for _, format := range template.Formats {
+			if format != "csv" {
+				continue
+			}
+			f, err := archive.Create(fmt.Sprintf("%s-%s.csv", base, section))
+			if err != nil {
+				return nil, err
+			}
+			w := csv.NewWriter(f)
+			w.Comma, _ = utf8.DecodeRuneInString(template.Delimiter)
+			if err := w.WriteAll(rows); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, format := range template.Formats {
+		if format != "xlsx" {
+			continue
+		}
+		f, err := archive.Create(base + ".xlsx")
+		if err != nil {
+			return nil, err
+		}
+		if err := writeXLSX(f, sheets); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// regulatoryFileName turns a template name into a file name
+func regulatoryFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// GenerateDue reports the last completed month of each enabled template that
+// has no report for it yet
+func (r *RegulatoryReporter) GenerateDue() (int, error) {
+	var templates []models.RegulatoryTemplate
+	if err := r.DB.Where("enabled = ?", true).Find(&templates).Error; err != nil {
+		return 0, err
+	}
+
+	generated := 0
+	for i := range templates {
+		template := &templates[i]
+		location, err := time.LoadLocation(template.Timezone)
+		if err != nil {
+			log.Printf("Error loading timezone of regulatory template %s: %v", template.Name, err)
+			continue
+		}
+		now := r.Clock.Now().In(location)
+		period := now.AddDate(0, 0, -now.Day()).Format("2006-01") // the month before this one
+
+		var existing int64
+		if err := r.DB.Model(&models.RegulatoryReport{}).Where("template_id = ? AND period = ?", template.ID, period).Count(&existing).Error; err != nil {
+			return generated, err
+		}
+		if existing > 0 {
+			continue
+		}
+		if _, err := r.Generate(template, period); err != nil {
+			log.Printf("Error generating regulatory report %s for %s: %v", template.Name, period, err)
+			continue
+		}
+		generated++
+	}
+	return generated, nil
+}
+
+// Start generates each template's monthly report in the background once the month is over
+func (r *RegulatoryReporter) Start() {
+	go func() {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if generated, err := r.GenerateDue(); err != nil {
+				log.Printf("Error generating regulatory reports: %v", err)
+			} else if generated > 0 {
+				log.Printf("Generated %d regulatory reports", generated)
+			}
+		}
+	}()
+	log.Printf("Regulatory reporting started, checking for completed months every %s", r.Interval)
+}
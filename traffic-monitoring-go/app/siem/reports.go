@@ -0,0 +1,690 @@
+package siem
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+	"traffic-monitoring-go/app/siem/notifications"
+)
+
+// Sections of a summary report
+const (
+	ReportEventCounts   = "event_counts"
+	ReportTopRules      = "top_rules"
+	ReportTopAttackers  = "top_attackers"
+	ReportAnomalyTrends = "anomaly_trends"
+)
+
+var reportSections = []string{ReportEventCounts, ReportTopRules, ReportTopAttackers, ReportAnomalyTrends}
+
+// reportFuncs are available to report HTML templates
+var reportFuncs = template.FuncMap{
+	// change formats the change of a trend item against the previous period
+	"change": func(item TrendItem) string {
+		switch {
+		case item.ChangePct != nil:
+			return fmt.Sprintf("%+.0f%%", *item.ChangePct)
+		case item.Current > 0:
+			return "new"
+		}
+		return "-"
+	},
+	// bar is the width, in percent, of a count against the largest one
+	"bar": func(count, max int64) int64 {
+		if max <= 0 {
+			return 0
+		}
+		return count * 100 / max
+	},
+}
+
+// NormalizeReportTemplate validates a template before it is stored, filling in defaults
+func NormalizeReportTemplate(tmpl *models.ReportTemplate) error {
+	tmpl.Name = strings.TrimSpace(tmpl.Name)
+	if tmpl.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if tmpl.Schedule != models.ReportDaily && tmpl.Schedule != models.ReportWeekly {
+		return fmt.Errorf("schedule must be %s or %s", models.ReportDaily, models.ReportWeekly)
+	}
+	if len(tmpl.Sections) == 0 {
+		tmpl.Sections = reportSections
+	}
+	for _, section := range tmpl.Sections {
+		if !containsString(reportSections, section) {
+			return fmt.Errorf("unknown section %q (use %s)", section, strings.Join(reportSections, ", "))
+		}
+	}
+	if tmpl.TopN == 0 {
+		tmpl.TopN = 10
+	}
+	if tmpl.TopN < 1 || tmpl.TopN > 100 {
+		return fmt.Errorf("top_n must be between 1 and 100")
+	}
+	if len(tmpl.Formats) == 0 {
+		tmpl.Formats = []string{"html", "pdf"}
+	}
+	for _, format := range tmpl.Formats {
+		if format != "html" && format != "pdf" {
+			return fmt.Errorf("unknown format %q (use html or pdf)", format)
+		}
+	}
+	if tmpl.Timezone == "" {
+		tmpl.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(tmpl.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", tmpl.Timezone)
+	}
+	if tmpl.HTMLTemplate != "" {
+		if _, err := template.New("report").Funcs(reportFuncs).Parse(tmpl.HTMLTemplate); err != nil {
+			return fmt.Errorf("invalid html_template: %v", err)
+		}
+	}
+	return nil
+}
+
+// ParseReportPeriod returns the bounds of a period of a template in its
+// timezone: a day as YYYY-MM-DD, or an ISO week as YYYY-Www
+func ParseReportPeriod(tmpl *models.ReportTemplate, period string) (time.Time, time.Time, error) {
+	location, err := time.LoadLocation(tmpl.Timezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if tmpl.Schedule == models.ReportDaily {
+		start, err := time.ParseInLocation("2006-01-02", period, location)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("period must be a day as YYYY-MM-DD")
+		}
+		return start, start.AddDate(0, 0, 1), nil
+	}
+
+	var year, week int
+	if _, err := fmt.Sscanf(period, "%d-W%d", &year, &week); err != nil || week < 1 || week > 53 {
+		return time.Time{}, time.Time{}, fmt.Errorf("period must be an ISO week as YYYY-Www")
+	}
+	// the first ISO week of a year is the one holding January 4th
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, location)
+	start := jan4.AddDate(0, 0, -(int(jan4.Weekday())+6)%7+7*(week-1))
+	if y, w := start.ISOWeek(); y != year || w != week {
+		return time.Time{}, time.Time{}, fmt.Errorf("%d has no week %d", year, week)
+	}
+	return start, start.AddDate(0, 0, 7), nil
+}
+
+// LastReportPeriod returns the last period of a template completed at now
+func LastReportPeriod(tmpl *models.ReportTemplate, now time.Time) (string, error) {
+	location, err := time.LoadLocation(tmpl.Timezone)
+	if err != nil {
+		return "", err
+	}
+	now = now.In(location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+
+	if tmpl.Schedule == models.ReportDaily {
+		return today.AddDate(0, 0, -1).Format("2006-01-02"), nil
+	}
+	lastWeek := today.AddDate(0, 0, -(int(today.Weekday())+6)%7-7)
+	year, week := lastWeek.ISOWeek()
+	return fmt.Sprintf("%04d-W%02d", year, week), nil
+}
+
+// ReportData is what a summary report shows, and what HTML templates render.
+// Sections left out of the template are nil.
+type ReportData struct {
+	Title        string
+	Template     string
+	Schedule     models.ReportSchedule
+	Period       string
+	From         time.Time
+	To           time.Time
+	Timezone     string
+	GeneratedAt  time.Time
+	Events       *ReportEvents
+	TopRules     []TrendItem // alerts by rule, most first
+	TopAttackers []ReportAttacker
+	Anomalies    *ReportAnomalies
+}
+
+// ReportEvents counts the events and alerts of the period against the one before
+type ReportEvents struct {
+	Total            TrendItem
+	ByCategory       []TrendItem // most first
+	Alerts           TrendItem
+	AlertsBySeverity []TrendItem // most first
+}
+
+// ReportAttacker is a source IP of the events alerts were raised on
+type ReportAttacker struct {
+	SourceIP string
+	Alerts   int64
+	Events   int64
+	Rules    int64
+	LastSeen time.Time
+}
+
+// ReportAnomalies is the V2X anomaly findings of the period by type, in total
+// and by day of a weekly report or hour of a daily one
+type ReportAnomalies struct {
+	Total   TrendItem
+	Buckets []string
+	Types   []ReportAnomalyType // most first
+	Max     int64               // largest count of a type in a bucket
+}
+
+// ReportAnomalyType is the findings of one anomaly type
+type ReportAnomalyType struct {
+	TrendItem
+	Counts []int64 // by bucket
+}
+
+// SummaryReporter generates the daily and weekly summary reports of the
+// report templates and delivers them through the notification channels
+type SummaryReporter struct {
+	DB       *gorm.DB
+	Clock    clock.Clock
+	Trends   *TrendService
+	Notifier *notifications.NotificationManager
+	Interval time.Duration // how often the scheduler looks for periods to report
+}
+
+var summaryCheckMinutes = config.NewInt("SUMMARY_REPORT_CHECK_MINUTES", 15, "Minutes between checks for summary reports due", config.Min(1))
+
+// NewSummaryReporter configures a reporter from SUMMARY_REPORT_CHECK_MINUTES (default 15)
+func NewSummaryReporter(db *gorm.DB) *SummaryReporter {
+	return &SummaryReporter{
+		DB:       db,
+		Clock:    clock.Default(),
+		Trends:   NewTrendService(db),
+		Notifier: notifications.NewDefaultNotificationManager(db),
+		Interval: time.Duration(summaryCheckMinutes.Get()) * time.Minute,
+	}
+}
+
+// CheckChannels reports an error for channel names the notifier does not know
+func (r *SummaryReporter) CheckChannels(names []string) error {
+	known := r.Notifier.GetChannelNames()
+	for _, name := range names {
+		if !containsString(known, name) {
+			sort.Strings(known)
+			return fmt.Errorf("unknown notification channel %q (use %s)", name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// Collect computes the sections of a template over [from, to)
+func (r *SummaryReporter) Collect(tmpl *models.ReportTemplate, period string, from, to time.Time) (*ReportData, error) {
+	data := &ReportData{
+		Title:       tmpl.Title,
+		Template:    tmpl.Name,
+		Schedule:    tmpl.Schedule,
+		Period:      period,
+		From:        from,
+		To:          to,
+		Timezone:    tmpl.Timezone,
+		GeneratedAt: r.Clock.Now(),
+	}
+	if data.Title == "" {
+		data.Title = tmpl.Name
+	}
+
+	for _, section := range tmpl.Sections {
+		var err error
+		switch section {
+		case ReportEventCounts:
+			data.Events, err = r.collectEvents(from, to)
+		case ReportTopRules:
+			var rules *TrendReport
+			if rules, err = r.Trends.CompareWindows(models.TrendAnomalyTypes, from, to, 0); err == nil {
+				data.TopRules = topTrendItems(rules.Items, tmpl.TopN)
+			}
+		case ReportTopAttackers:
+			data.TopAttackers, err = r.collectAttackers(from, to, tmpl.TopN)
+		case ReportAnomalyTrends:
+			data.Anomalies, err = r.collectAnomalies(tmpl, from, to)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", section, err)
+		}
+	}
+	return data, nil
+}
+
+// topTrendItems orders items by their count in the current period, keeping
+// the first n that occurred in it
+func topTrendItems(items []TrendItem, n int) []TrendItem {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Current != items[j].Current {
+			return items[i].Current > items[j].Current
+		}
+		return items[i].Key < items[j].Key
+	})
+	top := make([]TrendItem, 0, n)
+	for _, item := range items {
+		if item.Current == 0 || len(top) == n {
+			break
+		}
+		top = append(top, item)
+	}
+	return top
+}
+
+func (r *SummaryReporter) collectEvents(from, to time.Time) (*ReportEvents, error) {
+	categories, err := r.Trends.CompareWindows(models.TrendEventCategories, from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+	severities, err := r.Trends.CompareWindows(models.TrendAlertVolume, from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &ReportEvents{
+		Total:            categories.Total,
+		ByCategory:       topTrendItems(categories.Items, len(categories.Items)),
+		Alerts:           severities.Total,
+		AlertsBySeverity: topTrendItems(severities.Items, len(severities.Items)),
+	}, nil
+}
+
+// collectAttackers ranks the source IPs of alerted events by their alerts
+func (r *SummaryReporter) collectAttackers(from, to time.Time, n int) ([]ReportAttacker, error) {
+	var attackers []ReportAttacker
+	err := database.ReadDB(r.DB).Table("alerts").
+		Select("security_events.source_ip, COUNT(*) AS alerts, COUNT(DISTINCT alerts.security_event_id) AS events, "+
+			"COUNT(DISTINCT alerts.rule_id) AS rules, MAX(alerts.timestamp) AS last_seen").
+		Joins("JOIN security_events ON security_events.id = alerts.security_event_id").
+		Where("alerts.timestamp >= ? AND alerts.timestamp < ? AND security_events.source_ip <> ''", from, to).
+		Group("security_events.source_ip").
+		Order("alerts DESC, security_events.source_ip").
+		Limit(n).
+		Scan(&attackers).Error
+	return attackers, err
+}
+
+// collectAnomalies counts the anomaly findings by type, in total against the
+// period before and by day (weekly reports) or hour (daily reports)
+func (r *SummaryReporter) collectAnomalies(tmpl *models.ReportTemplate, from, to time.Time) (*ReportAnomalies, error) {
+	trend, err := r.Trends.CompareWindows(models.TrendV2XAnomalies, from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(tmpl.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	anomalies := &ReportAnomalies{Total: trend.Total}
+	next, layout, sqlLayout := func(t time.Time) time.Time { return t.Add(time.Hour) }, "15:00", "HH24:00"
+	if tmpl.Schedule == models.ReportWeekly {
+		next, layout, sqlLayout = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }, "2006-01-02", "YYYY-MM-DD"
+	}
+	index := make(map[string]int)
+	for t := from; t.Before(to); t = next(t) {
+		label := t.In(location).Format(layout)
+		if _, ok := index[label]; !ok { // a 25-hour day repeats an hour
+			index[label] = len(anomalies.Buckets)
+			anomalies.Buckets = append(anomalies.Buckets, label)
+		}
+	}
+
+	var rows []struct {
+		Key    string
+		Bucket string
+		Count  int64
+	}
+	key := v2xDetailPattern("anomaly_type")
+	err = database.ReadDB(r.DB).Table("security_events").
+		Select(key+" AS key, to_char(security_events.timestamp AT TIME ZONE ?, ?) AS bucket, COUNT(*) AS count", tmpl.Timezone, sqlLayout).
+		Where("security_events.category = ? AND security_events.timestamp >= ? AND security_events.timestamp < ?", models.CategoryV2X, from, to).
+		Where(key + " IS NOT NULL").
+		Group("1, 2").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byType := make(map[string][]int64)
+	for _, row := range rows {
+		i, ok := index[row.Bucket]
+		if !ok {
+			continue
+		}
+		if byType[row.Key] == nil {
+			byType[row.Key] = make([]int64, len(anomalies.Buckets))
+		}
+		byType[row.Key][i] += row.Count
+		if byType[row.Key][i] > anomalies.Max {
+			anomalies.Max = byType[row.Key][i]
+		}
+	}
+	for _, item := range topTrendItems(trend.Items, len(trend.Items)) {
+		counts := byType[item.Key]
+		if counts == nil {
+			counts = make([]int64, len(anomalies.Buckets))
+		}
+		anomalies.Types = append(anomalies.Types, ReportAnomalyType{TrendItem: item, Counts: counts})
+	}
+	return anomalies, nil
+}
+
+// Generate builds the report of a template for a completed period, replacing
+// the one generated before for the same period
+func (r *SummaryReporter) Generate(tmpl *models.ReportTemplate, period string) (*models.Report, error) {
+	from, to, err := ParseReportPeriod(tmpl, period)
+	if err != nil {
+		return nil, err
+	}
+	if to.After(r.Clock.Now()) {
+		return nil, fmt.Errorf("period %s has not ended yet", period)
+	}
+	data, err := r.Collect(tmpl, period, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := models.Report{
+		TemplateID:  tmpl.ID,
+		Period:      period,
+		PeriodStart: from,
+		PeriodEnd:   to,
+		Filename:    fmt.Sprintf("%s-%s", regulatoryFileName(tmpl.Name), period),
+	}
+	for _, format := range tmpl.Formats {
+		switch format {
+		case "html":
+			if report.HTML, err = RenderReportHTML(tmpl, data); err != nil {
+				return nil, err
+			}
+		case "pdf":
+			var buf bytes.Buffer
+			if err := writePDF(&buf, data.Title+" "+period, reportPDFLines(data)); err != nil {
+				return nil, err
+			}
+			report.PDF = buf.Bytes()
+		}
+	}
+	report.HTMLSize, report.PDFSize = len(report.HTML), len(report.PDF)
+
+	err = r.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "template_id"}, {Name: "period"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"period_start": report.PeriodStart, "period_end": report.PeriodEnd, "filename": report.Filename,
+			"html": report.HTML, "pdf": report.PDF, "html_size": report.HTMLSize, "pdf_size": report.PDFSize,
+			"delivered_to": nil, "delivered_at": nil, "delivery_error": "", "created_at": r.Clock.Now(),
+		}),
+	}).Create(&report).Error
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Deliver sends a report through the channels of its template and records
+// where it was delivered. HTML-less reports are delivered with a short body
+// pointing at the PDF.
+func (r *SummaryReporter) Deliver(tmpl *models.ReportTemplate, report *models.Report) error {
+	title := tmpl.Title
+	if title == "" {
+		title = tmpl.Name
+	}
+	message := &notifications.Report{
+		Subject:  fmt.Sprintf("%s: %s", title, report.Period),
+		HTML:     report.HTML,
+		PDF:      report.PDF,
+		Filename: report.Filename,
+	}
+	if len(message.HTML) == 0 {
+		message.HTML = []byte("<p>" + template.HTMLEscapeString(message.Subject) + ": see the attached PDF.</p>")
+	}
+
+	delivered, err := r.Notifier.SendReport(message, tmpl.Channels)
+	now := r.Clock.Now()
+	report.DeliveredTo, report.DeliveredAt, report.DeliveryError = delivered, &now, ""
+	if err != nil {
+		report.DeliveryError = err.Error()
+	} else if len(delivered) == 0 {
+		report.DeliveryError = "no enabled notification channel can deliver reports"
+	}
+	if saveErr := r.DB.Model(report).Select("delivered_to", "delivered_at", "delivery_error").Updates(report).Error; saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+// GenerateDue generates and delivers the last completed period of each
+// enabled template that has no report for it yet
+func (r *SummaryReporter) GenerateDue() (int, error) {
+	var templates []models.ReportTemplate
+	if err := r.DB.Where("enabled = ?", true).Find(&templates).Error; err != nil {
+		return 0, err
+	}
+
+	generated := 0
+	for i := range templates {
+		tmpl := &templates[i]
+		period, err := LastReportPeriod(tmpl, r.Clock.Now())
+		if err != nil {
+			log.Printf("Error loading timezone of report template %s: %v", tmpl.Name, err)
+			continue
+		}
+
+		var existing int64
+		if err := r.DB.Model(&models.Report{}).Where("template_id = ? AND period = ?", tmpl.ID, period).Count(&existing).Error; err != nil {
+			return generated, err
+		}
+		if existing > 0 {
+			continue
+		}
+		report, err := r.Generate(tmpl, period)
+		if err != nil {
+			log.Printf("Error generating report %s for %s: %v", tmpl.Name, period, err)
+			continue
+		}
+		generated++
+		if err := r.Deliver(tmpl, report); err != nil {
+			log.Printf("Error delivering report %s for %s: %v", tmpl.Name, period, err)
+		}
+	}
+	return generated, nil
+}
+
+// Start generates each template's report in the background once its day or week is over
+func (r *SummaryReporter) Start() {
+	go func() {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if generated, err := r.GenerateDue(); err != nil {
+				log.Printf("Error generating summary reports: %v", err)
+			} else if generated > 0 {
+				log.Printf("Generated %d summary reports", generated)
+			}
+		}
+	}()
+	log.Printf("Summary reporting started, checking for completed periods every %s", r.Interval)
+}
+
+// RenderReportHTML renders report data with the template's HTML layout, or the default one
+func RenderReportHTML(tmpl *models.ReportTemplate, data *ReportData) ([]byte, error) {
+	layout := tmpl.HTMLTemplate
+	if layout == "" {
+		layout = defaultReportHTML
+	}
+	t, err := template.New("report").Funcs(reportFuncs).Parse(layout)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// reportPDFLines lays the report data out as text, tables in fixed width
+func reportPDFLines(data *ReportData) []pdfLine {
+	lines := []pdfLine{
+		{pdfTitle, data.Title},
+		{pdfText, fmt.Sprintf("%s report %s: %s to %s (%s)", strings.Title(string(data.Schedule)), data.Period,
+			data.From.Format("2006-01-02 15:04"), data.To.Format("2006-01-02 15:04"), data.Timezone)},
+	}
+	change := reportFuncs["change"].(func(TrendItem) string)
+	table := func(heading string, header []string, rows [][]string) {
+		lines = append(lines, pdfLine{pdfText, ""}, pdfLine{pdfHeading, heading})
+		if len(rows) == 0 {
+			lines = append(lines, pdfLine{pdfText, "None in this period."})
+			return
+		}
+		widths := make([]int, len(header))
+		for _, row := range append([][]string{header}, rows...) {
+			for i, cell := range row {
+				if n := len([]rune(cell)); n > widths[i] {
+					widths[i] = n
+				}
+			}
+		}
+		format := func(row []string) string {
+			cells := make([]string, len(row))
+			for i, cell := range row {
+				if i == 0 {
+					cells[i] = cell + strings.Repeat(" ", widths[i]-len([]rune(cell)))
+				} else {
+					cells[i] = strings.Repeat(" ", widths[i]-len([]rune(cell))) + cell
+				}
+			}
+			return strings.Join(cells, "  ")
+		}
+		lines = append(lines, pdfLine{pdfMono, format(header)})
+		for _, row := range rows {
+			lines = append(lines, pdfLine{pdfMono, format(row)})
+		}
+	}
+	trendRows := func(items []TrendItem) [][]string {
+		rows := make([][]string, 0, len(items))
+		for _, item := range items {
+			rows = append(rows, []string{item.Key, strconv.FormatInt(item.Current, 10), strconv.FormatInt(item.Previous, 10), change(item)})
+		}
+		return rows
+	}
+	trendHeader := []string{"", "Count", "Previous", "Change"}
+
+	if data.Events != nil {
+		lines = append(lines, pdfLine{pdfText, ""},
+			pdfLine{pdfText, fmt.Sprintf("Events: %d (%s), alerts: %d (%s)",
+				data.Events.Total.Current, change(data.Events.Total), data.Events.Alerts.Current, change(data.Events.Alerts))})
+		table("Events by category", append([]string{"Category"}, trendHeader[1:]...), trendRows(data.Events.ByCategory))
+		table("Alerts by severity", append([]string{"Severity"}, trendHeader[1:]...), trendRows(data.Events.AlertsBySeverity))
+	}
+	if data.TopRules != nil {
+		table("Top rules", append([]string{"Rule"}, trendHeader[1:]...), trendRows(data.TopRules))
+	}
+	if data.TopAttackers != nil {
+		rows := make([][]string, 0, len(data.TopAttackers))
+		for _, attacker := range data.TopAttackers {
+			rows = append(rows, []string{attacker.SourceIP, strconv.FormatInt(attacker.Alerts, 10), strconv.FormatInt(attacker.Events, 10),
+				strconv.FormatInt(attacker.Rules, 10), attacker.LastSeen.In(data.From.Location()).Format("2006-01-02 15:04")})
+		}
+		table("Top attacker IPs", []string{"Source IP", "Alerts", "Events", "Rules", "Last seen"}, rows)
+	}
+	if data.Anomalies != nil {
+		table(fmt.Sprintf("V2X anomalies: %d (%s)", data.Anomalies.Total.Current, change(data.Anomalies.Total)),
+			append([]string{"Anomaly type"}, trendHeader[1:]...), trendRows(reportAnomalyItems(data.Anomalies)))
+		if len(data.Anomalies.Types) > 0 {
+			rows := make([][]string, 0, len(data.Anomalies.Buckets))
+			for i, bucket := range data.Anomalies.Buckets {
+				row := []string{bucket}
+				for _, anomalyType := range data.Anomalies.Types {
+					row = append(row, strconv.FormatInt(anomalyType.Counts[i], 10))
+				}
+				rows = append(rows, row)
+			}
+			header := []string{""}
+			for _, anomalyType := range data.Anomalies.Types {
+				header = append(header, anomalyType.Key)
+			}
+			table("V2X anomalies over the period", header, rows)
+		}
+	}
+	return lines
+}
+
+func reportAnomalyItems(anomalies *ReportAnomalies) []TrendItem {
+	items := make([]TrendItem, len(anomalies.Types))
+	for i, anomalyType := range anomalies.Types {
+		items[i] = anomalyType.TrendItem
+	}
+	return items
+}
+
+// defaultReportHTML is the HTML layout of reports whose template has none
+const defaultReportHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }} {{ .Period }}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; margin: 24px; }
+table { border-collapse: collapse; margin-bottom: 16px; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 10px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.bar { background: #c0392b; height: 10px; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<p class="muted">{{ .Schedule }} report {{ .Period }}: {{ .From.Format "2006-01-02 15:04" }} to {{ .To.Format "2006-01-02 15:04" }} ({{ .Timezone }})</p>
+{{ with .Events }}
+<h2>Events and alerts</h2>
+<p>{{ .Total.Current }} events ({{ change .Total }}), {{ .Alerts.Current }} alerts ({{ change .Alerts }})</p>
+<table>
+<tr><th>Category</th><th>Events</th><th>Previous</th><th>Change</th></tr>
+{{ range .ByCategory }}<tr><td>{{ .Key }}</td><td>{{ .Current }}</td><td>{{ .Previous }}</td><td>{{ change . }}</td></tr>
+{{ end }}</table>
+<table>
+<tr><th>Severity</th><th>Alerts</th><th>Previous</th><th>Change</th></tr>
+{{ range .AlertsBySeverity }}<tr><td>{{ .Key }}</td><td>{{ .Current }}</td><td>{{ .Previous }}</td><td>{{ change . }}</td></tr>
+{{ end }}</table>
+{{ end }}
+{{ if .TopRules }}
+<h2>Top rules</h2>
+<table>
+<tr><th>Rule</th><th>Alerts</th><th>Previous</th><th>Change</th></tr>
+{{ range .TopRules }}<tr><td>{{ .Key }}</td><td>{{ .Current }}</td><td>{{ .Previous }}</td><td>{{ change . }}</td></tr>
+{{ end }}</table>
+{{ end }}
+{{ if .TopAttackers }}
+<h2>Top attacker IPs</h2>
+<table>
+<tr><th>Source IP</th><th>Alerts</th><th>Events</th><th>Rules</th><th>Last seen</th></tr>
+{{ range .TopAttackers }}<tr><td>{{ .SourceIP }}</td><td>{{ .Alerts }}</td><td>{{ .Events }}</td><td>{{ .Rules }}</td><td>{{ .LastSeen.Format "2006-01-02 15:04" }}</td></tr>
+{{ end }}</table>
+{{ end }}
+{{ with .Anomalies }}
+<h2>V2X anomalies</h2>
+<p>{{ .Total.Current }} anomalies ({{ change .Total }})</p>
+{{ $max := .Max }}{{ $buckets := .Buckets }}
+{{ range .Types }}
+<h3>{{ .Key }}: {{ .Current }} ({{ change .TrendItem }})</h3>
+<table>
+{{ range $i, $count := .Counts }}<tr><td>{{ index $buckets $i }}</td><td>{{ $count }}</td><td style="width: 200px"><div class="bar" style="width: {{ bar $count $max }}%"></div></td></tr>
+{{ end }}</table>
+{{ end }}
+{{ end }}
+</body>
+</html>
+`
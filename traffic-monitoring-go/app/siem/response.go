@@ -0,0 +1,529 @@
+package siem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/metrics"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+	"traffic-monitoring-go/app/siem/routing"
+)
+
+// ResponseTriggeredByRule is the trigger of executions queued by alerts
+const ResponseTriggeredByRule = "rule"
+
+// responseOutputLimit bounds the script output kept in the audit log
+const responseOutputLimit = 4096
+
+var responseExecutions = metrics.NewCounterVec("siem_response_executions_total",
+	"Response actions run, by action type and outcome", "type", "status")
+
+// responseActionCacheTTL bounds how long an action changed on another instance takes to apply here
+const responseActionCacheTTL = 10 * time.Second
+
+// responseActionCache keeps the enabled response actions by rule in memory so
+// alerts of rules without actions cost no query
+type responseActionCache struct {
+	mutex    sync.RWMutex
+	loaded   bool
+	loadedAt time.Time
+	byRule   map[uint][]models.ResponseAction
+}
+
+var defaultResponseActionCache = &responseActionCache{}
+
+// InvalidateResponseActions forces the response action cache to reload. Call
+// it whenever response actions change.
+func InvalidateResponseActions() {
+	cache.Invalidate("response_actions")
+}
+
+// invalidate drops the cached response actions of this instance
+func (c *responseActionCache) invalidate() {
+	c.mutex.Lock()
+	c.loaded = false
+	c.mutex.Unlock()
+}
+
+func init() {
+	cache.OnInvalidate("response_actions", defaultResponseActionCache.invalidate)
+}
+
+func (c *responseActionCache) get(db *gorm.DB, ruleID uint) ([]models.ResponseAction, error) {
+	c.mutex.RLock()
+	if c.loaded && time.Since(c.loadedAt) <= responseActionCacheTTL {
+		actions := c.byRule[ruleID]
+		c.mutex.RUnlock()
+		return actions, nil
+	}
+	c.mutex.RUnlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded || time.Since(c.loadedAt) > responseActionCacheTTL {
+		var actions []models.ResponseAction
+		if err := db.Where("enabled = ?", true).Order("id ASC").Find(&actions).Error; err != nil {
+			return nil, err
+		}
+		c.byRule = make(map[uint][]models.ResponseAction)
+		for _, action := range actions {
+			c.byRule[action.RuleID] = append(c.byRule[action.RuleID], action)
+		}
+		c.loaded = true
+		c.loadedAt = time.Now()
+	}
+	return c.byRule[ruleID], nil
+}
+
+// QueueResponseActions queues the enabled response actions of a rule for an
+// alert it raised. Queued with db, the executions commit with the alert and
+// the response runner picks them up once they do.
+func QueueResponseActions(db *gorm.DB, rule *models.Rule, alert *models.Alert) error {
+	actions, err := defaultResponseActionCache.get(db, rule.ID)
+	if err != nil || len(actions) == 0 {
+		return err
+	}
+
+	executions := make([]models.ResponseExecution, 0, len(actions))
+	for _, action := range actions {
+		executions = append(executions, models.ResponseExecution{
+			ActionID:    action.ID,
+			RuleID:      rule.ID,
+			AlertID:     alert.ID,
+			Type:        action.Type,
+			Status:      models.ResponsePending,
+			DryRun:      action.DryRun,
+			TriggeredBy: ResponseTriggeredByRule,
+		})
+	}
+	return db.Create(&executions).Error
+}
+
+// ResponsePayload describes the alert a response action runs for. Webhooks
+// receive it as their body and scripts on their standard input.
+type ResponsePayload struct {
+	ActionID   uint                 `json:"action_id"`
+	Action     string               `json:"action"`
+	AlertID    uint                 `json:"alert_id"`
+	RuleID     uint                 `json:"rule_id"`
+	Rule       string               `json:"rule"`
+	Severity   models.EventSeverity `json:"severity"`
+	Timestamp  time.Time            `json:"timestamp"`
+	EventID    uint                 `json:"event_id"`
+	Message    string               `json:"message,omitempty"`
+	SourceIP   string               `json:"source_ip,omitempty"`
+	VehicleID  string               `json:"vehicle_id,omitempty"` // V2X source of the event
+	V2XThreats []string             `json:"v2x_threats,omitempty"`
+	DryRun     bool                 `json:"dry_run"`
+}
+
+// ResponseRunner runs queued response actions in the background and records
+// the outcome of each in the audit log
+type ResponseRunner struct {
+	DB            *gorm.DB
+	Clock         clock.Clock
+	Client        *http.Client
+	Interval      time.Duration
+	BatchSize     int
+	MaxAttempts   int           // a failing action is retried on later runs up to this many attempts
+	GlobalDryRun  bool          // run every action in dry run
+	ScriptDir     string        // where script actions are looked up; empty disables them
+	ScriptTimeout time.Duration // a script still running is killed after this
+}
+
+var (
+	responseInterval      = config.NewInt("RESPONSE_ACTIONS_INTERVAL_SECONDS", 5, "Seconds between runs of the pending response actions", config.Min(1))
+	responseMaxAttempts   = config.NewInt("RESPONSE_ACTIONS_MAX_ATTEMPTS", 3, "Attempts at a failing response action", config.Min(1))
+	responseDryRun        = config.NewBool("RESPONSE_ACTIONS_DRY_RUN", false, "Run every response action in dry run")
+	responseScriptDir     = config.NewString("RESPONSE_SCRIPT_DIR", "", "Directory script actions are looked up in; empty disables them")
+	responseScriptTimeout = config.NewInt("RESPONSE_SCRIPT_TIMEOUT_SECONDS", 30, "Seconds a script action may run", config.Min(1))
+)
+
+// NewResponseRunner configures a runner from the environment:
+// RESPONSE_ACTIONS_INTERVAL_SECONDS (default 5), RESPONSE_ACTIONS_MAX_ATTEMPTS
+// (default 3), RESPONSE_ACTIONS_DRY_RUN, RESPONSE_SCRIPT_DIR and
+// RESPONSE_SCRIPT_TIMEOUT_SECONDS (default 30)
+func NewResponseRunner(db *gorm.DB) *ResponseRunner {
+	return &ResponseRunner{
+		DB:            db,
+		Clock:         clock.Default(),
+		Client:        &http.Client{Timeout: 10 * time.Second},
+		Interval:      time.Duration(responseInterval.Get()) * time.Second,
+		BatchSize:     20,
+		MaxAttempts:   responseMaxAttempts.Get(),
+		GlobalDryRun:  responseDryRun.Get(),
+		ScriptDir:     responseScriptDir.Get(),
+		ScriptTimeout: time.Duration(responseScriptTimeout.Get()) * time.Second,
+	}
+}
+
+// Validate checks the type and configuration of a response action
+func (r *ResponseRunner) Validate(action *models.ResponseAction) error {
+	if strings.TrimSpace(action.Name) == "" {
+		return errors.New("name is required")
+	}
+
+	allowed := map[string]bool{}
+	switch action.Type {
+	case models.ResponseWebhook:
+		allowed["url"], allowed["method"] = true, true
+		target, err := url.Parse(action.Config["url"])
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return errors.New("webhook actions need an http or https url")
+		}
+		switch action.Config["method"] {
+		case "", http.MethodPost, http.MethodPut:
+		default:
+			return errors.New("webhook method must be POST or PUT")
+		}
+	case models.ResponseBlockIP, models.ResponseUntrustVehicle:
+		allowed["duration"] = true
+		if value, ok := action.Config["duration"]; ok {
+			if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+				return fmt.Errorf("invalid duration %q", value)
+			}
+		}
+	case models.ResponseScript:
+		allowed["script"] = true
+		if r.ScriptDir == "" {
+			return errors.New("script actions are disabled; set RESPONSE_SCRIPT_DIR to enable them")
+		}
+		name := action.Config["script"]
+		if name == "" || filepath.Base(name) != name || strings.HasPrefix(name, ".") {
+			return errors.New("script must name a file of the script directory")
+		}
+	default:
+		return errors.New("type must be webhook, block_ip, untrust_vehicle or script")
+	}
+
+	for key := range action.Config {
+		if !allowed[key] && !(action.Type == models.ResponseWebhook && strings.HasPrefix(key, "header:")) {
+			return fmt.Errorf("unknown %s config %q", action.Type, key)
+		}
+	}
+	return nil
+}
+
+// Start runs queued actions in the background
+func (r *ResponseRunner) Start() {
+	go func() {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			for {
+				ran, err := r.RunPending()
+				if err != nil {
+					log.Printf("Error running response actions: %v", err)
+					break
+				}
+				if ran < r.BatchSize {
+					break
+				}
+			}
+		}
+	}()
+
+	mode := ""
+	if r.GlobalDryRun {
+		mode = " in dry run"
+	}
+	log.Printf("Response action runner started%s, checking every %s", mode, r.Interval)
+}
+
+// RunPending runs the oldest pending executions and returns how many it ran.
+// Failed attempts stay pending until they run out of attempts.
+func (r *ResponseRunner) RunPending() (int, error) {
+	ran := 0
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// lock the batch so several SIEM instances never run the same action twice
+		var executions []models.ResponseExecution
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", models.ResponsePending).
+			Order("id ASC").
+			Limit(r.BatchSize).
+			Find(&executions).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range executions {
+			if err := r.run(tx, &executions[i]); err != nil {
+				return err
+			}
+			ran++
+		}
+		return nil
+	})
+	return ran, err
+}
+
+// run runs one pending execution and records its outcome
+func (r *ResponseRunner) run(tx *gorm.DB, execution *models.ResponseExecution) error {
+	now := r.Clock.Now()
+	execution.Attempts++
+	execution.ExecutedAt = &now
+
+	var action models.ResponseAction
+	var alert models.Alert
+	switch {
+	case tx.First(&action, execution.ActionID).Error != nil:
+		execution.Status, execution.Error = models.ResponseSkipped, "the action was deleted"
+	case !action.Enabled:
+		execution.Status, execution.Error = models.ResponseSkipped, "the action was disabled"
+	case tx.Preload("Rule").Preload("SecurityEvent").First(&alert, execution.AlertID).Error != nil:
+		execution.Status, execution.Error = models.ResponseSkipped, "the alert was deleted"
+	default:
+		execution.DryRun = execution.DryRun || action.DryRun || r.GlobalDryRun
+		if err := r.execute(tx, execution, &action, &alert); err != nil {
+			execution.Error = err.Error()
+			if execution.Attempts >= r.MaxAttempts {
+				execution.Status = models.ResponseFailed
+			}
+			log.Printf("Response action %s failed for alert %d (attempt %d): %v", action.Name, alert.ID, execution.Attempts, err)
+		} else {
+			execution.Error = ""
+		}
+	}
+
+	if execution.Status != models.ResponsePending {
+		responseExecutions.Inc(string(execution.Type), string(execution.Status))
+	}
+	return tx.Save(execution).Error
+}
+
+// DryRun shows what an action would do for an alert, recording the dry run in
+// the audit log as triggered by actor
+func (r *ResponseRunner) DryRun(action *models.ResponseAction, alert *models.Alert, actor string) (*models.ResponseExecution, error) {
+	now := r.Clock.Now()
+	execution := &models.ResponseExecution{
+		ActionID:    action.ID,
+		RuleID:      action.RuleID,
+		AlertID:     alert.ID,
+		Type:        action.Type,
+		DryRun:      true,
+		TriggeredBy: actor,
+		Attempts:    1,
+		ExecutedAt:  &now,
+	}
+	if err := r.execute(r.DB, execution, action, alert); err != nil {
+		execution.Status, execution.Error = models.ResponseFailed, err.Error()
+	}
+	responseExecutions.Inc(string(execution.Type), string(execution.Status))
+	if err := r.DB.Create(execution).Error; err != nil {
+		return nil, err
+	}
+	return execution, nil
+}
+
+// execute performs an action for an alert, or describes it in dry run,
+// setting the target, output and status of the execution. It returns the
+// error of a failed attempt, leaving the status as it was.
+func (r *ResponseRunner) execute(tx *gorm.DB, execution *models.ResponseExecution, action *models.ResponseAction, alert *models.Alert) error {
+	payload := newResponsePayload(action, alert, execution.DryRun)
+	reason := fmt.Sprintf("rule %q alert %d", alert.Rule.Name, alert.ID)
+
+	done := func(output string) error {
+		execution.Output = output
+		if execution.DryRun {
+			execution.Status = models.ResponseDryRun
+		} else {
+			execution.Status = models.ResponseSucceeded
+		}
+		return nil
+	}
+	skip := func(why string) error {
+		execution.Status, execution.Output = models.ResponseSkipped, why
+		return nil
+	}
+
+	switch action.Type {
+	case models.ResponseWebhook:
+		method := action.Config["method"]
+		if method == "" {
+			method = http.MethodPost
+		}
+		execution.Target = action.Config["url"]
+		if execution.DryRun {
+			return done(fmt.Sprintf("would %s the alert to %s", method, execution.Target))
+		}
+		headers := map[string]string{}
+		for key, value := range action.Config {
+			if strings.HasPrefix(key, "header:") {
+				headers[strings.TrimPrefix(key, "header:")] = value
+			}
+		}
+		if err := routing.PostJSON(r.Client, method, execution.Target, headers, payload); err != nil {
+			return err
+		}
+		return done(fmt.Sprintf("%s %s accepted", method, execution.Target))
+
+	case models.ResponseBlockIP:
+		if payload.SourceIP == "" {
+			return skip("the event has no source IP")
+		}
+		execution.Target = payload.SourceIP
+		expiresAt := responseExpiry(action, execution.ExecutedAt)
+		if execution.DryRun {
+			return done("would block " + payload.SourceIP + untilText(expiresAt))
+		}
+		blocked := models.BlockedIP{
+			IP:        payload.SourceIP,
+			Reason:    reason,
+			RuleID:    &alert.RuleID,
+			AlertID:   &alert.ID,
+			ActionID:  &action.ID,
+			ExpiresAt: expiresAt,
+		}
+		err := tx.Transaction(func(inner *gorm.DB) error {
+			return inner.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "ip"}},
+				DoUpdates: clause.AssignmentColumns([]string{"reason", "rule_id", "alert_id", "action_id", "expires_at", "updated_at"}),
+			}).Create(&blocked).Error
+		})
+		if err != nil {
+			return err
+		}
+		return done("blocked " + payload.SourceIP + untilText(expiresAt))
+
+	case models.ResponseUntrustVehicle:
+		if payload.VehicleID == "" {
+			return skip("the event has no V2X source")
+		}
+		execution.Target = payload.VehicleID
+		expiresAt := responseExpiry(action, execution.ExecutedAt)
+		if execution.DryRun {
+			return done("would mark V2X source " + payload.VehicleID + " untrusted" + untilText(expiresAt))
+		}
+		untrusted := models.UntrustedVehicle{
+			SourceID:  payload.VehicleID,
+			Reason:    reason,
+			RuleID:    &alert.RuleID,
+			AlertID:   &alert.ID,
+			ActionID:  &action.ID,
+			ExpiresAt: expiresAt,
+		}
+		err := tx.Transaction(func(inner *gorm.DB) error {
+			var identifier models.VehicleIdentifier
+			err := inner.Where("kind = ? AND value = ?", models.IdentifierTemporaryID, payload.VehicleID).Limit(1).Find(&identifier).Error
+			if err != nil {
+				return err
+			}
+			if identifier.ID != 0 {
+				untrusted.RegisteredVehicleID = &identifier.VehicleID
+			}
+			return inner.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "source_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"registered_vehicle_id", "reason", "rule_id", "alert_id", "action_id", "expires_at", "updated_at"}),
+			}).Create(&untrusted).Error
+		})
+		if err != nil {
+			return err
+		}
+		return done("marked V2X source " + payload.VehicleID + " untrusted" + untilText(expiresAt))
+
+	case models.ResponseScript:
+		if r.ScriptDir == "" {
+			return errors.New("script actions are disabled; set RESPONSE_SCRIPT_DIR to enable them")
+		}
+		execution.Target = filepath.Join(r.ScriptDir, action.Config["script"])
+		if execution.DryRun {
+			return done("would run " + execution.Target)
+		}
+		output, err := r.runScript(execution.Target, payload)
+		execution.Output = output
+		if err != nil {
+			return err
+		}
+		return done(output)
+	}
+	return fmt.Errorf("unknown response action type %q", action.Type)
+}
+
+// runScript runs a script with the payload on its standard input and its
+// main fields in SIEM_* environment variables, returning its combined output
+func (r *ResponseRunner) runScript(path string, payload ResponsePayload) (string, error) {
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.ScriptTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Dir = r.ScriptDir
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(),
+		"SIEM_ALERT_ID="+strconv.FormatUint(uint64(payload.AlertID), 10),
+		"SIEM_RULE="+payload.Rule,
+		"SIEM_SEVERITY="+string(payload.Severity),
+		"SIEM_SOURCE_IP="+payload.SourceIP,
+		"SIEM_VEHICLE_ID="+payload.VehicleID,
+	)
+	out, err := cmd.CombinedOutput()
+	output := string(out)
+	if len(output) > responseOutputLimit {
+		output = output[:responseOutputLimit]
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return output, fmt.Errorf("script timed out after %s", r.ScriptTimeout)
+	}
+	return output, err
+}
+
+// newResponsePayload describes an alert to the action it triggered
+func newResponsePayload(action *models.ResponseAction, alert *models.Alert, dryRun bool) ResponsePayload {
+	payload := ResponsePayload{
+		ActionID:   action.ID,
+		Action:     action.Name,
+		AlertID:    alert.ID,
+		RuleID:     alert.RuleID,
+		Rule:       alert.Rule.Name,
+		Severity:   alert.Severity,
+		Timestamp:  alert.Timestamp,
+		EventID:    alert.SecurityEventID,
+		Message:    alert.SecurityEvent.Message,
+		SourceIP:   alert.SecurityEvent.SourceIP,
+		V2XThreats: alert.V2XThreats,
+		DryRun:     dryRun,
+	}
+	if obs, ok := ParseV2XObservation(&alert.SecurityEvent, ""); ok {
+		payload.VehicleID = obs.VehicleID
+	}
+	return payload
+}
+
+// responseExpiry is when a block or untrust by the action lapses, nil for never
+func responseExpiry(action *models.ResponseAction, from *time.Time) *time.Time {
+	duration, err := time.ParseDuration(action.Config["duration"])
+	if err != nil || duration <= 0 {
+		return nil
+	}
+	expiresAt := from.Add(duration)
+	return &expiresAt
+}
+
+func untilText(expiresAt *time.Time) string {
+	if expiresAt == nil {
+		return ""
+	}
+	return " until " + expiresAt.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,269 @@
+package siem
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+	"traffic-monitoring-go/app/siem/elasticsearch"
+)
+
+// indexDateLayout is the date suffix of the daily SIEM indices, e.g. security-alerts-2024.05.31
+const indexDateLayout = "2006.01.02"
+
+// retentionRuns serializes policy runs, so a manual purge and the schedule
+// never delete the same rows at once
+var retentionRuns sync.Mutex
+
+// RetentionRun is the outcome of applying one retention policy
+type RetentionRun struct {
+	PolicyID   uint      `json:"policy_id"`
+	PolicyName string    `json:"policy_name"`
+	DryRun     bool      `json:"dry_run"`
+	Cutoff     time.Time `json:"cutoff"`
+	Purged     int64     `json:"purged"`            // events or indices removed, or that would be on a dry run
+	RolledUp   int64     `json:"rolled_up"`         // events counted into security_event_rollups
+	Kept       int64     `json:"kept"`              // expired events kept because an alert or DENM verification refers to them
+	Indices    []string  `json:"indices,omitempty"` // for index policies
+	Error      string    `json:"error,omitempty"`
+}
+
+// NormalizeRetentionPolicy trims a policy's fields, defaults its action to
+// delete and validates it, including the index family against those the SIEM owns
+func NormalizeRetentionPolicy(policy *models.RetentionPolicy) error {
+	policy.Name = strings.TrimSpace(policy.Name)
+	policy.IndexFamily = strings.TrimSpace(policy.IndexFamily)
+	if policy.Action == "" {
+		policy.Action = models.RetentionDelete
+	}
+
+	errs := policy.Validate()
+	if policy.Target == models.RetentionTargetIndex && policy.IndexFamily != "" {
+		known := false
+		for _, family := range elasticsearch.IndexFamilies {
+			known = known || policy.IndexFamily == family
+		}
+		if !known {
+			errs.Add("index_family", "must be one of %s, got %q", strings.Join(elasticsearch.IndexFamilies, ", "), policy.IndexFamily)
+		}
+	}
+	return errs.Err()
+}
+
+// RetentionManager applies the enabled retention policies on a schedule
+type RetentionManager struct {
+	DB        *gorm.DB
+	ES        *elasticsearch.Service
+	Clock     clock.Clock
+	Interval  time.Duration
+	BatchSize int // events deleted per transaction
+}
+
+var (
+	retentionCheckMinutes = config.NewInt("RETENTION_CHECK_MINUTES", 60, "Minutes between applications of the retention policies", config.Min(1))
+	retentionBatchSize    = config.NewInt("RETENTION_BATCH_SIZE", 5000, "Events deleted per transaction by the retention policies", config.Min(1))
+)
+
+// NewRetentionManager configures a manager from the environment:
+// RETENTION_CHECK_MINUTES (default 60) and RETENTION_BATCH_SIZE (default 5000)
+func NewRetentionManager(db *gorm.DB, es *elasticsearch.Service) *RetentionManager {
+	return &RetentionManager{
+		DB:        db,
+		ES:        es,
+		Clock:     clock.Default(),
+		Interval:  time.Duration(retentionCheckMinutes.Get()) * time.Minute,
+		BatchSize: retentionBatchSize.Get(),
+	}
+}
+
+// Start applies the enabled policies every interval
+func (m *RetentionManager) Start() {
+	go func() {
+		ticker := time.NewTicker(m.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			runs, err := m.RunAll()
+			if err != nil {
+				log.Printf("Error loading retention policies: %v", err)
+				continue
+			}
+			for _, run := range runs {
+				if run.Error != "" {
+					log.Printf("Retention policy %q failed: %s", run.PolicyName, run.Error)
+				} else if run.Purged > 0 {
+					log.Printf("Retention policy %q purged %d items older than %s", run.PolicyName, run.Purged, run.Cutoff.Format(time.RFC3339))
+				}
+			}
+		}
+	}()
+
+	log.Printf("Retention policies applied every %s", m.Interval)
+}
+
+// RunAll applies every enabled policy
+func (m *RetentionManager) RunAll() ([]RetentionRun, error) {
+	var policies []models.RetentionPolicy
+	if err := m.DB.Where("enabled = ?", true).Order("id").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	runs := make([]RetentionRun, 0, len(policies))
+	for i := range policies {
+		runs = append(runs, m.Run(&policies[i], false))
+	}
+	return runs, nil
+}
+
+// Run applies a policy, whether or not it is enabled. A dry run only counts
+// what would be purged and leaves the policy's last run untouched.
+func (m *RetentionManager) Run(policy *models.RetentionPolicy, dryRun bool) RetentionRun {
+	retentionRuns.Lock()
+	defer retentionRuns.Unlock()
+
+	now := m.Clock.Now()
+	run := RetentionRun{
+		PolicyID:   policy.ID,
+		PolicyName: policy.Name,
+		DryRun:     dryRun,
+		Cutoff:     now.AddDate(0, 0, -policy.MaxAgeDays),
+	}
+
+	var err error
+	switch policy.Target {
+	case models.RetentionTargetEvents:
+		err = m.purgeEvents(policy, &run)
+	case models.RetentionTargetIndex:
+		err = m.purgeIndices(policy, &run)
+	default:
+		err = fmt.Errorf("unknown retention target %q", policy.Target)
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if dryRun {
+		return run
+	}
+
+	policy.LastRunAt, policy.LastPurged, policy.LastError = &now, run.Purged, run.Error
+	if err := m.DB.Model(policy).Updates(map[string]interface{}{
+		"last_run_at": now,
+		"last_purged": run.Purged,
+		"last_error":  run.Error,
+	}).Error; err != nil {
+		log.Printf("Error recording the run of retention policy %q: %v", policy.Name, err)
+	}
+	return run
+}
+
+// expiredEvents selects the events a policy expires, without those an alert
+// or a DENM verification refers to
+func (m *RetentionManager) expiredEvents(tx *gorm.DB, policy *models.RetentionPolicy, cutoff time.Time) *gorm.DB {
+	query := tx.Model(&models.SecurityEvent{}).
+		Where("timestamp < ?", cutoff).
+		Where("NOT EXISTS (SELECT 1 FROM alerts WHERE alerts.security_event_id = security_events.id)").
+		Where("NOT EXISTS (SELECT 1 FROM denm_verifications WHERE denm_verifications.security_event_id = security_events.id)")
+	if policy.Category != "" {
+		query = query.Where("category = ?", policy.Category)
+	}
+	return query
+}
+
+// purgeEvents deletes expired events in batches, counting them into the
+// daily rollups first when the policy rolls up
+func (m *RetentionManager) purgeEvents(policy *models.RetentionPolicy, run *RetentionRun) error {
+	expired := m.DB.Model(&models.SecurityEvent{}).Where("timestamp < ?", run.Cutoff)
+	if policy.Category != "" {
+		expired = expired.Where("category = ?", policy.Category)
+	}
+	var total int64
+	if err := expired.Count(&total).Error; err != nil {
+		return err
+	}
+	if err := m.expiredEvents(m.DB, policy, run.Cutoff).Count(&run.Purged).Error; err != nil {
+		return err
+	}
+	run.Kept = total - run.Purged
+	if run.DryRun {
+		if policy.Action == models.RetentionRollup {
+			run.RolledUp = run.Purged
+		}
+		return nil
+	}
+
+	run.Purged = 0
+	for {
+		var deleted int64
+		err := m.DB.Transaction(func(tx *gorm.DB) error {
+			var ids []uint
+			if err := m.expiredEvents(tx, policy, run.Cutoff).Order("id").Limit(m.BatchSize).Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+
+			if policy.Action == models.RetentionRollup {
+				if err := tx.Exec(`INSERT INTO security_event_rollups (day, log_source_id, category, severity, count)
+					SELECT date_trunc('day', timestamp), log_source_id, category, severity, COUNT(*)
+					FROM security_events WHERE id IN ?
+					GROUP BY 1, 2, 3, 4
+					ON CONFLICT (day, log_source_id, category, severity)
+					DO UPDATE SET count = security_event_rollups.count + EXCLUDED.count`, ids).Error; err != nil {
+					return err
+				}
+			}
+
+			result := tx.Where("id IN ?", ids).Delete(&models.SecurityEvent{})
+			deleted = result.RowsAffected
+			return result.Error
+		})
+		if err != nil {
+			return err
+		}
+
+		run.Purged += deleted
+		if policy.Action == models.RetentionRollup {
+			run.RolledUp += deleted
+		}
+		if deleted < int64(m.BatchSize) {
+			return nil
+		}
+	}
+}
+
+// purgeIndices deletes the daily indices of the policy's family dated before
+// the cutoff; indices without a date suffix are left alone
+func (m *RetentionManager) purgeIndices(policy *models.RetentionPolicy, run *RetentionRun) error {
+	if m.ES == nil {
+		return fmt.Errorf("elasticsearch is not configured")
+	}
+	prefix := policy.IndexFamily + "-"
+	indices, err := m.ES.ListIndices(prefix + "*")
+	if err != nil {
+		return err
+	}
+
+	cutoffDay := run.Cutoff.UTC().Truncate(24 * time.Hour)
+	for _, index := range indices {
+		// tenant indices put the organization between the family and the date
+		day, err := time.Parse(indexDateLayout, index.Index[strings.LastIndex(index.Index, "-")+1:])
+		if err != nil || !day.Before(cutoffDay) {
+			continue
+		}
+		if !run.DryRun {
+			if _, err := m.ES.DeleteIndices(index.Index); err != nil {
+				return fmt.Errorf("deleting %s: %v", index.Index, err)
+			}
+		}
+		run.Indices = append(run.Indices, index.Index)
+		run.Purged++
+	}
+	return nil
+}
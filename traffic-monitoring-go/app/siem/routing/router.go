@@ -0,0 +1,272 @@
+package routing
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+)
+
+// SinkMetrics is the delivery record of one sink as reported by the API
+type SinkMetrics struct {
+	Name            string          `json:"name"`
+	Type            models.SinkType `json:"type"`
+	Active          bool            `json:"active"`
+	Delivered       uint64          `json:"delivered"`
+	Failed          uint64          `json:"failed"`
+	Dropped         uint64          `json:"dropped"`
+	QueueLength     int             `json:"queue_length"`
+	QueueCapacity   int             `json:"queue_capacity"`
+	AvgLatencyMs    float64         `json:"avg_latency_ms"`
+	LastDeliveredAt *time.Time      `json:"last_delivered_at,omitempty"`
+	LastError       string          `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time      `json:"last_error_at,omitempty"`
+}
+
+// sinkCounters accumulate a sink's metrics; they survive router reloads
+type sinkCounters struct {
+	mutex           sync.Mutex
+	sinkType        models.SinkType
+	delivered       uint64
+	failed          uint64
+	dropped         uint64
+	latency         time.Duration
+	lastDeliveredAt time.Time
+	lastError       string
+	lastErrorAt     time.Time
+}
+
+func (c *sinkCounters) record(err error, latency time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if err != nil {
+		c.failed++
+		c.lastError = err.Error()
+		c.lastErrorAt = now
+		return
+	}
+	c.delivered++
+	c.latency += latency
+	c.lastDeliveredAt = now
+}
+
+func (c *sinkCounters) fail(err error) {
+	c.mutex.Lock()
+	c.lastError = err.Error()
+	c.lastErrorAt = time.Now()
+	c.mutex.Unlock()
+}
+
+func (c *sinkCounters) drop() {
+	c.mutex.Lock()
+	c.dropped++
+	c.mutex.Unlock()
+}
+
+// sinkWorker owns a sink and its queue. Each sink is drained by its own
+// goroutine so a slow or failing sink only ever fills its own queue.
+type sinkWorker struct {
+	sink     Sink
+	queue    chan *models.SecurityEvent
+	counters *sinkCounters
+}
+
+func (w *sinkWorker) run() {
+	for event := range w.queue {
+		start := time.Now()
+		err := w.sink.Deliver(event)
+		w.counters.record(err, time.Since(start))
+	}
+	if err := w.sink.Close(); err != nil {
+		log.Printf("Error closing event sink: %v", err)
+	}
+}
+
+// Router fans ingested events out to the sinks selected by the routing rules
+type Router struct {
+	mutex    sync.RWMutex
+	rules    []models.RoutingRule
+	workers  map[string]*sinkWorker
+	counters map[string]*sinkCounters
+}
+
+var defaultRouter = &Router{
+	workers:  make(map[string]*sinkWorker),
+	counters: make(map[string]*sinkCounters),
+}
+
+// Load (re)builds the default router from the enabled sinks and routing rules
+func Load(db *gorm.DB) error {
+	return defaultRouter.Load(db)
+}
+
+// Route queues an event for delivery by the default router
+func Route(event *models.SecurityEvent) {
+	defaultRouter.Route(event)
+}
+
+// GetMetrics returns the delivery metrics of the default router
+func GetMetrics() []SinkMetrics {
+	return defaultRouter.Metrics()
+}
+
+// Load replaces the router's sinks and rules with those stored in the database.
+// Events already queued on replaced sinks are still delivered before they close.
+func (r *Router) Load(db *gorm.DB) error {
+	var sinks []models.EventSink
+	if err := db.Where("enabled = ?", true).Find(&sinks).Error; err != nil {
+		return err
+	}
+	var rules []models.RoutingRule
+	if err := db.Where("enabled = ?", true).Order("id ASC").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	workers := make(map[string]*sinkWorker, len(sinks))
+	for _, config := range sinks {
+		counters, ok := r.counters[config.Name]
+		if !ok {
+			counters = &sinkCounters{}
+			r.counters[config.Name] = counters
+		}
+		counters.sinkType = config.Type
+
+		sink, err := NewSink(config, db)
+		if err != nil {
+			log.Printf("Error creating event sink %s: %v", config.Name, err)
+			counters.fail(err)
+			continue
+		}
+
+		queueSize := config.QueueSize
+		if queueSize <= 0 {
+			queueSize = 1000
+		}
+		worker := &sinkWorker{
+			sink:     sink,
+			queue:    make(chan *models.SecurityEvent, queueSize),
+			counters: counters,
+		}
+		go worker.run()
+		workers[config.Name] = worker
+	}
+
+	// Route holds the read lock while queueing, so no send can race these closes
+	for _, worker := range r.workers {
+		close(worker.queue)
+	}
+	r.workers = workers
+	r.rules = rules
+
+	log.Printf("Event routing loaded with %d sinks and %d rules", len(workers), len(rules))
+	return nil
+}
+
+// Route queues an event on every sink selected by a matching rule. Queueing never
+// blocks: when a sink's queue is full the event is dropped for that sink only.
+func (r *Router) Route(event *models.SecurityEvent) {
+	if event == nil {
+		return
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if len(r.rules) == 0 {
+		return
+	}
+
+	// sinks share a copy so later changes by the caller are not delivered
+	routed := *event
+	selected := make(map[string]bool)
+	for _, rule := range r.rules {
+		if !RuleMatches(&rule, &routed) {
+			continue
+		}
+		for _, name := range rule.Sinks {
+			if selected[name] {
+				continue
+			}
+			selected[name] = true
+
+			worker, ok := r.workers[name]
+			if !ok {
+				continue
+			}
+			select {
+			case worker.queue <- &routed:
+			default:
+				worker.counters.drop()
+			}
+		}
+	}
+}
+
+// RuleMatches reports whether a routing rule selects an event
+func RuleMatches(rule *models.RoutingRule, event *models.SecurityEvent) bool {
+	if len(rule.Categories) > 0 && !contains(rule.Categories, string(event.Category)) {
+		return false
+	}
+	if len(rule.Severities) > 0 && !contains(rule.Severities, string(event.Severity)) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Metrics returns the delivery metrics of every sink the router has known, by name
+func (r *Router) Metrics() []SinkMetrics {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	metrics := make([]SinkMetrics, 0, len(r.counters))
+	for name, counters := range r.counters {
+		counters.mutex.Lock()
+		m := SinkMetrics{
+			Name:      name,
+			Type:      counters.sinkType,
+			Delivered: counters.delivered,
+			Failed:    counters.failed,
+			Dropped:   counters.dropped,
+			LastError: counters.lastError,
+		}
+		if counters.delivered > 0 {
+			m.AvgLatencyMs = float64(counters.latency) / float64(counters.delivered) / float64(time.Millisecond)
+		}
+		if !counters.lastDeliveredAt.IsZero() {
+			lastDelivered := counters.lastDeliveredAt
+			m.LastDeliveredAt = &lastDelivered
+		}
+		if !counters.lastErrorAt.IsZero() {
+			lastError := counters.lastErrorAt
+			m.LastErrorAt = &lastError
+		}
+		counters.mutex.Unlock()
+
+		if worker, ok := r.workers[name]; ok {
+			m.Active = true
+			m.QueueLength = len(worker.queue)
+			m.QueueCapacity = cap(worker.queue)
+		}
+		metrics = append(metrics, m)
+	}
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics
+}
@@ -0,0 +1,248 @@
+package routing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+)
+
+// Sink delivers routed events to one destination
+type Sink interface {
+	Deliver(event *models.SecurityEvent) error
+	Close() error
+}
+
+// defaultElasticsearchURL is where Elasticsearch sinks without a url index
+var defaultElasticsearchURL = config.NewString("ELASTICSEARCH_URL", "http://elasticsearch:9200", "URL of the Elasticsearch cluster")
+
+// tableNamePattern restricts postgres sink tables to plain identifiers
+var tableNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// NewSink builds the sink described by config. Postgres sinks without a dsn
+// write to the primary database.
+func NewSink(config models.EventSink, primary *gorm.DB) (Sink, error) {
+	timeout := 10 * time.Second
+	if seconds, err := strconv.Atoi(config.Config["timeout_seconds"]); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+
+	switch config.Type {
+	case models.SinkTypePostgres:
+		return newPostgresSink(config.Config, primary)
+
+	case models.SinkTypeElasticsearch:
+		baseURL := config.Config["url"]
+		if baseURL == "" {
+			baseURL = defaultElasticsearchURL.Get()
+		}
+		index := config.Config["index"]
+		if index == "" {
+			index = "routed-events"
+		}
+		return &elasticsearchSink{URL: strings.TrimRight(baseURL, "/"), Index: index, Client: client}, nil
+
+	case models.SinkTypeKafka:
+		if config.Config["url"] == "" || config.Config["topic"] == "" {
+			return nil, fmt.Errorf("kafka sink requires url (REST proxy) and topic")
+		}
+		return &kafkaSink{URL: strings.TrimRight(config.Config["url"], "/"), Topic: config.Config["topic"], Client: client}, nil
+
+	case models.SinkTypeWebhook:
+		if config.Config["url"] == "" {
+			return nil, fmt.Errorf("webhook sink requires url")
+		}
+		method := strings.ToUpper(config.Config["method"])
+		if method == "" {
+			method = http.MethodPost
+		}
+		headers := make(map[string]string)
+		for key, value := range config.Config {
+			if strings.HasPrefix(key, "header.") {
+				headers[strings.TrimPrefix(key, "header.")] = value
+			}
+		}
+		return &webhookSink{URL: config.Config["url"], Method: method, Headers: headers, Client: client}, nil
+	}
+
+	return nil, fmt.Errorf("unknown sink type %q", config.Type)
+}
+
+// routedEvent is the row written by postgres sinks
+type routedEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	EventID   uint      `gorm:"index"`
+	Timestamp time.Time `gorm:"index"`
+	Category  string    `gorm:"index"`
+	Severity  string
+	Payload   string    `gorm:"type:jsonb"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// postgresSink writes events to a table on the primary or a separate database
+type postgresSink struct {
+	DB    *gorm.DB
+	Table string
+	owned bool // the connection was opened for this sink and is closed with it
+}
+
+func newPostgresSink(config map[string]string, primary *gorm.DB) (*postgresSink, error) {
+	table := config["table"]
+	if table == "" {
+		table = "routed_events"
+	}
+	if !tableNamePattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+
+	sink := &postgresSink{DB: primary, Table: table}
+	if dsn := config["dsn"]; dsn != "" {
+		db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Warn)})
+		if err != nil {
+			return nil, err
+		}
+		sink.DB = db
+		sink.owned = true
+	}
+	if sink.DB == nil {
+		return nil, fmt.Errorf("postgres sink requires a dsn")
+	}
+
+	if err := sink.DB.Table(table).AutoMigrate(&routedEvent{}); err != nil {
+		sink.Close()
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (s *postgresSink) Deliver(event *models.SecurityEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	row := routedEvent{
+		EventID:   event.ID,
+		Timestamp: event.Timestamp,
+		Category:  string(event.Category),
+		Severity:  string(event.Severity),
+		Payload:   string(payload),
+	}
+	return s.DB.Table(s.Table).Create(&row).Error
+}
+
+func (s *postgresSink) Close() error {
+	if !s.owned {
+		return nil
+	}
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// elasticsearchSink indexes events into a dedicated index, keyed by event ID
+type elasticsearchSink struct {
+	URL    string
+	Index  string
+	Client *http.Client
+}
+
+func (s *elasticsearchSink) Deliver(event *models.SecurityEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	target := fmt.Sprintf("%s/%s/_doc/%d", s.URL, url.PathEscape(s.Index), event.ID)
+	return send(s.Client, http.MethodPut, target, "application/json", body, nil)
+}
+
+func (s *elasticsearchSink) Close() error { return nil }
+
+// kafkaSink publishes events to a topic through a Kafka REST proxy, keyed by event ID
+type kafkaSink struct {
+	URL    string
+	Topic  string
+	Client *http.Client
+}
+
+func (s *kafkaSink) Deliver(event *models.SecurityEvent) error {
+	return PublishKafka(s.Client, s.URL, s.Topic, strconv.FormatUint(uint64(event.ID), 10), event)
+}
+
+func (s *kafkaSink) Close() error { return nil }
+
+// webhookSink sends each event as JSON to an external endpoint
+type webhookSink struct {
+	URL     string
+	Method  string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+func (s *webhookSink) Deliver(event *models.SecurityEvent) error {
+	return PostJSON(s.Client, s.Method, s.URL, s.Headers, event)
+}
+
+func (s *webhookSink) Close() error { return nil }
+
+// PublishKafka produces one JSON record to a topic through a Kafka REST proxy (v2 API).
+// Records with the same key land on the same partition and keep their order.
+func PublishKafka(client *http.Client, proxyURL, topic, key string, value interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"records": []map[string]interface{}{
+			{"key": key, "value": value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	target := fmt.Sprintf("%s/topics/%s", strings.TrimRight(proxyURL, "/"), url.PathEscape(topic))
+	return send(client, http.MethodPost, target, "application/vnd.kafka.json.v2+json", body, nil)
+}
+
+// PostJSON sends value as a JSON request body to an external endpoint
+func PostJSON(client *http.Client, method, target string, headers map[string]string, value interface{}) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return send(client, method, target, "application/json", body, headers)
+}
+
+// send performs an HTTP request and treats any non-2xx response as a failed delivery
+func send(client *http.Client, method, target, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned status %d: %s", method, target, resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package siem
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/models"
+)
+
+const (
+	maxAggregateWindow  = 24 * time.Hour
+	maxWindowSamples    = 10000       // per rule, clause and group, so one noisy group cannot grow memory unbounded
+	windowSweepInterval = time.Minute // how often groups that went quiet are forgotten
+)
+
+// aggregateClause matches window aggregates in rule conditions:
+//
+//	count(<field>, <window>) <op> <number>
+//	sum|avg|min|max(<field>, <window>[, <by>]) <op> <number>
+//
+// count counts the events in the window with this event's value of field;
+// the others aggregate the numeric field over the events in the window with
+// this event's value of by, or over all of them without by. An aggregate sees
+// the events that reach it: under AND, those matching the clauses before it.
+var aggregateClause = regexp.MustCompile(`^(count|sum|avg|min|max)\(\s*([\w.]+)\s*,\s*(\w+)\s*(?:,\s*([\w.]+)\s*)?\)\s*(>=|<=|==|!=|<>|=|>|<)\s*(-?[0-9.]+)$`)
+
+// aggregate is a parsed window aggregate clause
+type aggregate struct {
+	function  string
+	field     string
+	window    time.Duration
+	by        string
+	operator  string
+	threshold string
+}
+
+// parseAggregate parses a window aggregate clause
+func parseAggregate(clause string) (*aggregate, error) {
+	m := aggregateClause.FindStringSubmatch(clause)
+	if m == nil {
+		return nil, fmt.Errorf("invalid aggregate %q, expected e.g. count(source_ip, 5m) > 20 or avg(details.speed, 1m, device_id) > 40", clause)
+	}
+	window, err := time.ParseDuration(m[3])
+	if err != nil || window <= 0 || window > maxAggregateWindow {
+		return nil, fmt.Errorf("invalid aggregate window %q, expected a duration such as 30s, 5m or 1h up to 24h", m[3])
+	}
+	agg := &aggregate{function: m[1], field: m[2], window: window, by: m[4], operator: m[5], threshold: m[6]}
+	if agg.function == "count" && agg.by != "" {
+		return nil, fmt.Errorf("count groups by its own field and takes no third argument")
+	}
+	for _, field := range []string{agg.field, agg.by} {
+		if field != "" && !strings.Contains(field, ".") && !conditionFields[field] {
+			return nil, fmt.Errorf("unknown aggregate field %q", field)
+		}
+		if strings.Contains(field, ".") && !strings.HasPrefix(field, "raw_data.") && !strings.HasPrefix(field, "details.") {
+			return nil, fmt.Errorf("nested aggregate fields must start with raw_data. or details.")
+		}
+	}
+	return agg, nil
+}
+
+// windowSample is one event recorded in a window
+type windowSample struct {
+	eventID uint
+	at      time.Time
+	value   float64
+}
+
+// WindowStore keeps the recent events seen by the aggregate clauses of rule
+// conditions. Like the anomaly detector history it lives in memory, so an
+// aggregate on one instance sees the events that instance evaluated.
+type WindowStore struct {
+	mutex     sync.Mutex
+	windows   map[string][]windowSample // by rule, clause and group, sorted by time
+	lastSweep time.Time
+}
+
+var defaultWindowStore = NewWindowStore()
+
+// NewWindowStore creates an empty store; backtests use their own so replayed
+// events do not count towards live windows
+func NewWindowStore() *WindowStore {
+	return &WindowStore{windows: make(map[string][]windowSample)}
+}
+
+// record adds an event to a window and returns the samples within the
+// window ending at the event, including it. An event already recorded, e.g.
+// when it is re-evaluated by catch-up, is not counted twice.
+func (s *WindowStore) record(key string, window time.Duration, sample windowSample) []windowSample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	samples := s.windows[key]
+	from := sample.at.Add(-window)
+	recorded := false
+	kept := samples[:0:0]
+	for _, previous := range samples {
+		if !previous.at.After(from) {
+			continue
+		}
+		kept = append(kept, previous)
+		recorded = recorded || (sample.eventID != 0 && previous.eventID == sample.eventID)
+	}
+	if !recorded {
+		// events may arrive out of order; keep the window sorted by time
+		i := sort.Search(len(kept), func(i int) bool { return kept[i].at.After(sample.at) })
+		kept = append(kept, windowSample{})
+		copy(kept[i+1:], kept[i:])
+		kept[i] = sample
+		if len(kept) > maxWindowSamples {
+			kept = kept[len(kept)-maxWindowSamples:]
+		}
+	}
+	s.windows[key] = kept
+
+	if now := time.Now(); now.Sub(s.lastSweep) >= windowSweepInterval {
+		s.lastSweep = now
+		for k, w := range s.windows {
+			if len(w) == 0 || w[len(w)-1].at.Before(sample.at.Add(-maxAggregateWindow)) {
+				delete(s.windows, k)
+			}
+		}
+	}
+
+	var within []windowSample
+	for _, previous := range kept {
+		if previous.at.After(from) && !previous.at.After(sample.at) {
+			within = append(within, previous)
+		}
+	}
+	return within
+}
+
+// evaluateAggregate records the event in the clause's window and compares
+// the aggregate over the window with the threshold. Events without the
+// aggregated (or grouping) field neither count nor match.
+func (e *EnhancedRuleEngine) evaluateAggregate(event *conditionEvent, rule *models.Rule, clause string, agg *aggregate) (bool, error) {
+	value, ok := aggregateFieldValue(event, agg.field)
+	if !ok {
+		return false, nil
+	}
+	group := ""
+	if agg.function == "count" {
+		group = value
+	} else if agg.by != "" {
+		if group, ok = aggregateFieldValue(event, agg.by); !ok {
+			return false, nil
+		}
+	}
+	sample := windowSample{eventID: event.ID, at: event.Timestamp}
+	if agg.function != "count" {
+		var err error
+		if sample.value, err = strconv.ParseFloat(value, 64); err != nil {
+			return false, nil // not a number
+		}
+	}
+
+	store := e.Windows
+	if store == nil {
+		store = defaultWindowStore
+	}
+	samples := store.record(fmt.Sprintf("%d\x00%s\x00%s", rule.ID, clause, group), agg.window, sample)
+
+	var result float64
+	switch agg.function {
+	case "count":
+		result = float64(len(samples))
+	case "sum", "avg":
+		for _, s := range samples {
+			result += s.value
+		}
+		if agg.function == "avg" {
+			result /= float64(len(samples))
+		}
+	case "min", "max":
+		result = samples[0].value
+		for _, s := range samples[1:] {
+			if (agg.function == "min" && s.value < result) || (agg.function == "max" && s.value > result) {
+				result = s.value
+			}
+		}
+	}
+	return compareNumber(strconv.FormatFloat(result, 'f', -1, 64), agg.operator, agg.threshold)
+}
+
+// aggregateFieldValue returns an event field as text; details.<path> is
+// short for raw_data.details.<path>
+func aggregateFieldValue(event *conditionEvent, field string) (string, bool) {
+	if strings.HasPrefix(field, "details.") {
+		field = "raw_data." + field
+	}
+	if !strings.HasPrefix(field, "raw_data.") {
+		var value string
+		switch field {
+		case "severity":
+			value = string(event.Severity)
+		case "category":
+			value = string(event.Category)
+		case "source_ip":
+			value = event.SourceIP
+		case "destination_ip":
+			value = event.DestinationIP
+		case "protocol":
+			value = event.Protocol
+		case "action":
+			value = event.Action
+		case "status":
+			value = event.Status
+		case "message":
+			value = event.Message
+		case "source_port":
+			if event.SourcePort != nil {
+				value = strconv.Itoa(*event.SourcePort)
+			}
+		case "destination_port":
+			if event.DestinationPort != nil {
+				value = strconv.Itoa(*event.DestinationPort)
+			}
+		case "device_id":
+			value = event.DeviceID
+		}
+		return value, value != ""
+	}
+
+	current, err := event.rawData()
+	if err != nil {
+		return "", false
+	}
+	for _, part := range strings.Split(strings.TrimPrefix(field, "raw_data."), ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		current = object[part]
+	}
+	switch v := current.(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
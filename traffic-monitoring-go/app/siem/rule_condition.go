@@ -0,0 +1,807 @@
+package siem
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"traffic-monitoring-go/app/models"
+)
+
+// Rule conditions are boolean expressions over event fields:
+//
+//	condition = or
+//	or        = and { "OR" and }
+//	and       = not { "AND" not }
+//	not       = "NOT" not | primary
+//	primary   = "(" condition ")" | "true" | "false" | aggregate | clause
+//	clause    = field operator value
+//	          | field ["not"] "in" "(" value { "," value } ")"
+//	          | field ["not"] "between" number "and" number
+//	          | field ["not"] "exists"
+//	          | "location" ("inside" | "outside") geofence
+//
+// AND binds tighter than OR. The AND, OR and NOT joining clauses are upper
+// case, so values may contain the words "and" and "or"; operators are not
+// case-sensitive. A value runs to the next AND or OR, or to the parenthesis
+// closing its group, as in "message contains failed login"; quote it ("..."
+// or '...', escaping the quote and backslash with a backslash) to keep an
+// AND, an OR, a closing parenthesis or surrounding spaces in it. Aggregates are described with aggregateClause.
+//
+// Parsing compiles the clauses: each resolves its field to an accessor and
+// converts its value once, so evaluating a condition against an event reads
+// fields and compares values without going back to the text.
+
+// conditionNode is a node of a parsed condition
+type conditionNode interface {
+	evaluate(e *EnhancedRuleEngine, event *conditionEvent, rule *models.Rule) (bool, error)
+}
+
+// conditionEvent is an event being evaluated against the rules. Its raw data
+// is parsed once, by the first clause that reads it, for all the rules.
+type conditionEvent struct {
+	*models.SecurityEvent
+
+	raw       interface{}
+	rawErr    error
+	rawParsed bool
+}
+
+func newConditionEvent(event *models.SecurityEvent) *conditionEvent {
+	return &conditionEvent{SecurityEvent: event}
+}
+
+// rawData returns the event's raw data decoded from JSON
+func (ev *conditionEvent) rawData() (interface{}, error) {
+	if !ev.rawParsed {
+		ev.rawErr = json.Unmarshal([]byte(ev.RawData), &ev.raw)
+		ev.rawParsed = true
+	}
+	return ev.raw, ev.rawErr
+}
+
+// orNode matches when any of its terms does
+type orNode struct {
+	terms []conditionNode
+}
+
+// andNode matches when all of its terms do
+type andNode struct {
+	terms []conditionNode
+}
+
+// notNode negates its operand
+type notNode struct {
+	operand conditionNode
+}
+
+// literalNode is true or false
+type literalNode struct {
+	value bool
+}
+
+// comparisonClause compares a field with a value: "severity = high"
+type comparisonClause struct {
+	text     string
+	field    string
+	operator string
+	value    string
+	quoted   bool // a quoted "null" is the string, not the missing value
+
+	get     fieldAccessor
+	compare *comparison
+}
+
+// inClause tests a field against a list of values: "protocol in (tcp, udp)"
+type inClause struct {
+	text   string
+	field  string
+	values []string
+	negate bool
+
+	get     fieldAccessor
+	compare []*comparison // equality with each value
+}
+
+// betweenClause tests a numeric field against an inclusive range:
+// "destination_port between 1 and 1023"
+type betweenClause struct {
+	text      string
+	field     string
+	low, high float64
+	negate    bool
+
+	get fieldAccessor
+}
+
+// existsClause tests whether an event has a field: "raw_data.details.vehicle_id exists"
+type existsClause struct {
+	text   string
+	field  string
+	negate bool
+
+	get fieldAccessor
+}
+
+// locationClause tests the event's coordinates against a geofence
+type locationClause struct {
+	text     string
+	operator string // inside or outside
+	geofence string
+}
+
+// aggregateNode is a window aggregate; its text keys the window, so editing
+// the rest of the condition keeps the aggregate's history
+type aggregateNode struct {
+	text string
+	agg  *aggregate
+}
+
+func (n *orNode) evaluate(e *EnhancedRuleEngine, event *conditionEvent, rule *models.Rule) (bool, error) {
+	for _, term := range n.terms {
+		matched, err := term.evaluate(e, event, rule)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+func (n *andNode) evaluate(e *EnhancedRuleEngine, event *conditionEvent, rule *models.Rule) (bool, error) {
+	for _, term := range n.terms {
+		matched, err := term.evaluate(e, event, rule)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (n *notNode) evaluate(e *EnhancedRuleEngine, event *conditionEvent, rule *models.Rule) (bool, error) {
+	matched, err := n.operand.evaluate(e, event, rule)
+	if err != nil {
+		return false, err
+	}
+	return !matched, nil
+}
+
+func (n *literalNode) evaluate(*EnhancedRuleEngine, *conditionEvent, *models.Rule) (bool, error) {
+	return n.value, nil
+}
+
+func (c *comparisonClause) evaluate(e *EnhancedRuleEngine, event *conditionEvent, rule *models.Rule) (bool, error) {
+	fieldValue, err := c.get(event)
+	if err != nil {
+		return false, err
+	}
+	return c.compare.match(fieldValue, e.Clock.Now)
+}
+
+// evaluate compares the field with each value for equality; an event without
+// the field is in no list
+func (c *inClause) evaluate(e *EnhancedRuleEngine, event *conditionEvent, rule *models.Rule) (bool, error) {
+	fieldValue, err := c.get(event)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	if fieldValue != nil {
+		for _, value := range c.compare {
+			if found, err = value.match(fieldValue, e.Clock.Now); err != nil {
+				return false, err
+			} else if found {
+				break
+			}
+		}
+	}
+	return found != c.negate, nil
+}
+
+// evaluate tests the range; an event without the field, or with a value that
+// is not a number, is in no range
+func (c *betweenClause) evaluate(e *EnhancedRuleEngine, event *conditionEvent, rule *models.Rule) (bool, error) {
+	fieldValue, err := c.get(event)
+	if err != nil {
+		return false, err
+	}
+	number, ok := numericValue(fieldValue)
+	in := ok && number >= c.low && number <= c.high
+	return in != c.negate, nil
+}
+
+// evaluate treats missing fields, JSON nulls and empty strings as absent
+func (c *existsClause) evaluate(e *EnhancedRuleEngine, event *conditionEvent, rule *models.Rule) (bool, error) {
+	fieldValue, err := c.get(event)
+	if err != nil {
+		return false, err
+	}
+	exists := fieldValue != nil && fieldValue != ""
+	return exists != c.negate, nil
+}
+
+func (c *locationClause) evaluate(e *EnhancedRuleEngine, event *conditionEvent, rule *models.Rule) (bool, error) {
+	return e.evaluateLocation(event.SecurityEvent, c.operator, c.geofence)
+}
+
+func (n *aggregateNode) evaluate(e *EnhancedRuleEngine, event *conditionEvent, rule *models.Rule) (bool, error) {
+	return e.evaluateAggregate(event, rule, n.text, n.agg)
+}
+
+// numericValue converts a field value to a number, if it is one
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+// forEachClause calls fn with every clause and aggregate of a condition
+func forEachClause(node conditionNode, fn func(conditionNode)) {
+	switch n := node.(type) {
+	case *orNode:
+		for _, term := range n.terms {
+			forEachClause(term, fn)
+		}
+	case *andNode:
+		for _, term := range n.terms {
+			forEachClause(term, fn)
+		}
+	case *notNode:
+		forEachClause(n.operand, fn)
+	case *literalNode:
+	default:
+		fn(node)
+	}
+}
+
+// conditionError is a syntax error in a condition, at a byte offset
+type conditionError struct {
+	pos int
+	msg string
+}
+
+func (e *conditionError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.pos+1, e.msg)
+}
+
+// conditionCache holds the parsed conditions of rules evaluated outside the
+// rule index, such as backtested drafts, so evaluating one again does not
+// parse it again; it is emptied when it fills up with conditions of edited rules
+var conditionCache = struct {
+	sync.Mutex
+	nodes map[string]conditionNode
+}{nodes: make(map[string]conditionNode)}
+
+const maxCachedConditions = 1024
+
+// cachedCondition parses a condition, or returns it parsed earlier
+func cachedCondition(condition string) (conditionNode, error) {
+	conditionCache.Lock()
+	node, ok := conditionCache.nodes[condition]
+	conditionCache.Unlock()
+	if ok {
+		return node, nil
+	}
+
+	node, err := parseCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+	conditionCache.Lock()
+	if len(conditionCache.nodes) >= maxCachedConditions {
+		conditionCache.nodes = make(map[string]conditionNode)
+	}
+	conditionCache.nodes[condition] = node
+	conditionCache.Unlock()
+	return node, nil
+}
+
+// parseCondition parses a rule condition
+func parseCondition(condition string) (conditionNode, error) {
+	p := &conditionParser{src: condition}
+	if strings.TrimSpace(condition) == "" {
+		return nil, p.errorf(0, "condition is empty")
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	tok, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tok.kind == tokenEOF:
+		return node, nil
+	case tok.kind == tokenRParen:
+		return nil, p.errorf(tok.pos, "unexpected \")\" with no matching \"(\"")
+	case tok.kind == tokenWord && (tok.text == "and" || tok.text == "or"):
+		return nil, p.errorf(tok.pos, "expected AND or OR, found %q (AND and OR are upper case)", tok.text)
+	default:
+		return nil, p.errorf(tok.pos, "expected AND, OR or the end of the condition, found %s", tok.describe())
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+// conditionToken is a token of a condition; the text of a string is unquoted
+type conditionToken struct {
+	kind     tokenKind
+	text     string
+	pos, end int
+}
+
+// describe names a token in error messages
+func (t conditionToken) describe() string {
+	switch t.kind {
+	case tokenEOF:
+		return "the end of the condition"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// fieldName matches the fields a clause may name
+var fieldName = regexp.MustCompile(`^[A-Za-z_][\w.-]*$`)
+
+// aggregateFunctions start window aggregates when followed by "("
+var aggregateFunctions = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+// conditionParser is a recursive descent parser over an on-demand lexer:
+// where a value is expected the lexer reads it raw, so bare values may hold
+// spaces, commas and balanced parentheses
+type conditionParser struct {
+	src string
+	pos int
+}
+
+func (p *conditionParser) errorf(pos int, format string, args ...interface{}) error {
+	return &conditionError{pos: pos, msg: fmt.Sprintf(format, args...)}
+}
+
+func isConditionSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// skipSpace returns the offset of the first non-space byte from i
+func (p *conditionParser) skipSpace(i int) int {
+	for i < len(p.src) && isConditionSpace(p.src[i]) {
+		i++
+	}
+	return i
+}
+
+// peek returns the next token without consuming it
+func (p *conditionParser) peek() (conditionToken, error) {
+	i := p.skipSpace(p.pos)
+	if i == len(p.src) {
+		return conditionToken{kind: tokenEOF, pos: i, end: i}, nil
+	}
+
+	switch c := p.src[i]; {
+	case c == '(':
+		return conditionToken{kind: tokenLParen, text: "(", pos: i, end: i + 1}, nil
+	case c == ')':
+		return conditionToken{kind: tokenRParen, text: ")", pos: i, end: i + 1}, nil
+	case c == ',':
+		return conditionToken{kind: tokenComma, text: ",", pos: i, end: i + 1}, nil
+	case c == '"' || c == '\'':
+		return p.quoted(i)
+	case strings.IndexByte("=!<>", c) >= 0:
+		if i+1 < len(p.src) {
+			switch op := p.src[i : i+2]; op {
+			case "==", "!=", "<>", ">=", "<=":
+				return conditionToken{kind: tokenOperator, text: op, pos: i, end: i + 2}, nil
+			}
+		}
+		if c == '!' {
+			return conditionToken{}, p.errorf(i, "unexpected \"!\", expected an operator such as != or not contains")
+		}
+		return conditionToken{kind: tokenOperator, text: string(c), pos: i, end: i + 1}, nil
+	}
+
+	j := i
+	for j < len(p.src) && !isConditionSpace(p.src[j]) && strings.IndexByte("(),\"'=!<>", p.src[j]) < 0 {
+		j++
+	}
+	return conditionToken{kind: tokenWord, text: p.src[i:j], pos: i, end: j}, nil
+}
+
+// next consumes the next token
+func (p *conditionParser) next() (conditionToken, error) {
+	tok, err := p.peek()
+	if err == nil {
+		p.pos = tok.end
+	}
+	return tok, err
+}
+
+// quoted reads the string starting with the quote at i; a backslash escapes
+// the quote and itself, and is kept before any other character
+func (p *conditionParser) quoted(i int) (conditionToken, error) {
+	quote := p.src[i]
+	var text strings.Builder
+	for j := i + 1; j < len(p.src); j++ {
+		switch {
+		case p.src[j] == '\\' && j+1 < len(p.src) && (p.src[j+1] == quote || p.src[j+1] == '\\'):
+			text.WriteByte(p.src[j+1])
+			j++
+		case p.src[j] == quote:
+			return conditionToken{kind: tokenString, text: text.String(), pos: i, end: j + 1}, nil
+		default:
+			text.WriteByte(p.src[j])
+		}
+	}
+	return conditionToken{}, p.errorf(i, "unterminated string, missing closing %c", quote)
+}
+
+// connectiveAt reports whether an AND or OR starts at i
+func (p *conditionParser) connectiveAt(i int) bool {
+	for _, keyword := range []string{"AND", "OR"} {
+		if strings.HasPrefix(p.src[i:], keyword) {
+			end := i + len(keyword)
+			if end == len(p.src) || isConditionSpace(p.src[end]) || p.src[end] == '(' {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// value reads a quoted or bare value. A bare value ends at an AND or OR, at
+// a parenthesis closing the group around it and, in lists, at a comma.
+func (p *conditionParser) value(inList bool) (conditionToken, error) {
+	tok, err := p.peek()
+	if err != nil {
+		return tok, err
+	}
+	if tok.kind == tokenString {
+		p.pos = tok.end
+		return tok, nil
+	}
+
+	start := p.skipSpace(p.pos)
+	depth := 0
+	i := start
+scan:
+	for ; i < len(p.src); i++ {
+		switch c := p.src[i]; {
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				break scan
+			}
+			depth--
+		case c == ',' && inList && depth == 0:
+			break scan
+		case isConditionSpace(c) && depth == 0 && p.connectiveAt(p.skipSpace(i)):
+			break scan
+		}
+	}
+	text := strings.TrimRight(p.src[start:i], " \t\r\n")
+	p.pos = start + len(text)
+	return conditionToken{kind: tokenWord, text: text, pos: start, end: p.pos}, nil
+}
+
+// keyword reports whether the next token is the upper case keyword, consuming it if so
+func (p *conditionParser) keyword(keyword string) (bool, error) {
+	tok, err := p.peek()
+	if err != nil {
+		return false, err
+	}
+	if tok.kind == tokenWord && tok.text == keyword {
+		p.pos = tok.end
+		return true, nil
+	}
+	return false, nil
+}
+
+func (p *conditionParser) parseOr() (conditionNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := &orNode{terms: []conditionNode{node}}
+	for {
+		if found, err := p.keyword("OR"); err != nil {
+			return nil, err
+		} else if !found {
+			break
+		}
+		if node, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		or.terms = append(or.terms, node)
+	}
+	if len(or.terms) == 1 {
+		return or.terms[0], nil
+	}
+	return or, nil
+}
+
+func (p *conditionParser) parseAnd() (conditionNode, error) {
+	node, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	and := &andNode{terms: []conditionNode{node}}
+	for {
+		if found, err := p.keyword("AND"); err != nil {
+			return nil, err
+		} else if !found {
+			break
+		}
+		if node, err = p.parseNot(); err != nil {
+			return nil, err
+		}
+		and.terms = append(and.terms, node)
+	}
+	if len(and.terms) == 1 {
+		return and.terms[0], nil
+	}
+	return and, nil
+}
+
+func (p *conditionParser) parseNot() (conditionNode, error) {
+	if found, err := p.keyword("NOT"); err != nil {
+		return nil, err
+	} else if found {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *conditionParser) parsePrimary() (conditionNode, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case tok.kind == tokenLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if closing.kind != tokenRParen {
+			if closing.kind == tokenEOF {
+				return nil, p.errorf(tok.pos, "missing \")\" to close this \"(\"")
+			}
+			return nil, p.errorf(closing.pos, "expected AND, OR or \")\", found %s", closing.describe())
+		}
+		return node, nil
+	case tok.kind == tokenEOF:
+		return nil, p.errorf(tok.pos, "expected a clause, found the end of the condition")
+	case tok.kind != tokenWord:
+		return nil, p.errorf(tok.pos, "expected a clause, found %s", tok.describe())
+	case tok.text == "true" || tok.text == "false":
+		return &literalNode{value: tok.text == "true"}, nil
+	case tok.text == "AND" || tok.text == "OR":
+		return nil, p.errorf(tok.pos, "expected a clause before %s", tok.text)
+	case aggregateFunctions[tok.text] && tok.end < len(p.src) && p.src[tok.end] == '(':
+		return p.parseAggregate(tok)
+	case !fieldName.MatchString(tok.text):
+		return nil, p.errorf(tok.pos, "expected a field name, found %q", tok.text)
+	}
+	return p.parseClause(tok)
+}
+
+// parseAggregate reads a window aggregate, from the function name to its threshold
+func (p *conditionParser) parseAggregate(function conditionToken) (conditionNode, error) {
+	closing := strings.IndexByte(p.src[function.end:], ')')
+	if closing < 0 {
+		return nil, p.errorf(function.pos, "missing \")\" to close %s(", function.text)
+	}
+	p.pos = function.end + closing + 1
+
+	operator, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if operator.kind != tokenOperator {
+		return nil, p.errorf(operator.pos, "expected a comparison after %s(...), found %s", function.text, operator.describe())
+	}
+	threshold, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if threshold.kind != tokenWord {
+		return nil, p.errorf(threshold.pos, "expected a number after %s, found %s", operator.text, threshold.describe())
+	}
+
+	text := p.src[function.pos:threshold.end]
+	agg, err := parseAggregate(text)
+	if err != nil {
+		return nil, p.errorf(function.pos, "%s", err.Error())
+	}
+	return &aggregateNode{text: text, agg: agg}, nil
+}
+
+// parseClause reads the operator and value of a clause on field
+func (p *conditionParser) parseClause(field conditionToken) (conditionNode, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	operator := strings.ToLower(tok.text)
+	switch {
+	case tok.kind == tokenEOF:
+		return nil, p.errorf(tok.pos, "expected an operator after %q, found the end of the condition", field.text)
+	case tok.kind == tokenOperator:
+	case tok.kind != tokenWord:
+		return nil, p.errorf(tok.pos, "expected an operator after %q, found %s", field.text, tok.describe())
+	case operator == "is" || operator == "not":
+		// two-word operators: is not, not contains, not in, not between, not exists
+		second, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if second.kind == tokenWord {
+			combined := operator + " " + strings.ToLower(second.text)
+			switch combined {
+			case "is not", "not contains", "not in", "not between", "not exists":
+				operator = combined
+				p.pos = second.end
+			}
+		}
+		if operator == "not" {
+			return nil, p.errorf(tok.pos, "expected contains, in, between or exists after \"not\", found %s", second.describe())
+		}
+	}
+
+	if field.text == "location" {
+		if operator != "inside" && operator != "outside" {
+			return nil, p.errorf(tok.pos, "location supports inside and outside, not %q", tok.text)
+		}
+		geofence, err := p.value(false)
+		if err != nil {
+			return nil, err
+		}
+		if geofence.text == "" {
+			return nil, p.errorf(geofence.pos, "expected a geofence name after %q", tok.text)
+		}
+		return &locationClause{text: p.src[field.pos:p.pos], operator: operator, geofence: geofence.text}, nil
+	}
+
+	negate := strings.HasPrefix(operator, "not ") && operator != "not contains"
+	switch strings.TrimPrefix(operator, "not ") {
+	case "exists":
+		return &existsClause{text: p.src[field.pos:p.pos], field: field.text, negate: negate, get: compileField(field.text)}, nil
+	case "in":
+		values, err := p.parseList(tok)
+		if err != nil {
+			return nil, err
+		}
+		compare := make([]*comparison, len(values))
+		for i, value := range values {
+			compare[i] = compileComparison("=", value, true)
+		}
+		return &inClause{text: p.src[field.pos:p.pos], field: field.text, values: values, negate: negate,
+			get: compileField(field.text), compare: compare}, nil
+	case "between":
+		low, high, err := p.parseRange()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenClause{text: p.src[field.pos:p.pos], field: field.text, low: low, high: high, negate: negate,
+			get: compileField(field.text)}, nil
+	}
+
+	if !conditionOperators[operator] {
+		return nil, p.errorf(tok.pos, "unknown operator %q", tok.text)
+	}
+	value, err := p.value(false)
+	if err != nil {
+		return nil, err
+	}
+	if value.kind != tokenString && value.text == "" {
+		return nil, p.errorf(value.pos, "expected a value after %q", tok.text)
+	}
+	return &comparisonClause{
+		text:     p.src[field.pos:p.pos],
+		field:    field.text,
+		operator: operator,
+		value:    value.text,
+		quoted:   value.kind == tokenString,
+		get:      compileField(field.text),
+		compare:  compileComparison(operator, value.text, value.kind == tokenString),
+	}, nil
+}
+
+// parseList reads the parenthesized values of an in clause
+func (p *conditionParser) parseList(operator conditionToken) ([]string, error) {
+	open, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if open.kind != tokenLParen {
+		return nil, p.errorf(open.pos, "expected \"(\" to start the list after %q, found %s", operator.text, open.describe())
+	}
+
+	var values []string
+	for {
+		value, err := p.value(true)
+		if err != nil {
+			return nil, err
+		}
+		if value.kind != tokenString && value.text == "" {
+			return nil, p.errorf(value.pos, "expected a value in the list")
+		}
+		values = append(values, value.text)
+
+		sep, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch sep.kind {
+		case tokenComma:
+			continue
+		case tokenRParen:
+			return values, nil
+		case tokenEOF:
+			return nil, p.errorf(open.pos, "missing \")\" to close this list")
+		default:
+			return nil, p.errorf(sep.pos, "expected \",\" or \")\" in the list, found %s", sep.describe())
+		}
+	}
+}
+
+// parseRange reads the "low and high" of a between clause
+func (p *conditionParser) parseRange() (float64, float64, error) {
+	var bounds [2]float64
+	for i := range bounds {
+		if i == 1 {
+			and, err := p.next()
+			if err != nil {
+				return 0, 0, err
+			}
+			if and.kind != tokenWord || strings.ToLower(and.text) != "and" {
+				return 0, 0, p.errorf(and.pos, "expected \"and\" between the bounds of the range, found %s", and.describe())
+			}
+		}
+		bound, err := p.next()
+		if err != nil {
+			return 0, 0, err
+		}
+		number, err := strconv.ParseFloat(bound.text, 64)
+		if bound.kind != tokenWord || err != nil {
+			return 0, 0, p.errorf(bound.pos, "expected a number for the range, found %s", bound.describe())
+		}
+		bounds[i] = number
+	}
+	if bounds[0] > bounds[1] {
+		return 0, 0, p.errorf(p.pos, "range %v to %v is empty, the lower bound comes first", bounds[0], bounds[1])
+	}
+	return bounds[0], bounds[1], nil
+}
@@ -0,0 +1,298 @@
+package siem
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// conditionTree writes a parsed condition with its grouping made explicit
+func conditionTree(node conditionNode) string {
+	join := func(terms []conditionNode, connective string) string {
+		parts := make([]string, len(terms))
+		for i, term := range terms {
+			parts[i] = conditionTree(term)
+		}
+		return "(" + strings.Join(parts, " "+connective+" ") + ")"
+	}
+	switch n := node.(type) {
+	case *orNode:
+		return join(n.terms, "OR")
+	case *andNode:
+		return join(n.terms, "AND")
+	case *notNode:
+		return "NOT " + conditionTree(n.operand)
+	case *literalNode:
+		return fmt.Sprint(n.value)
+	case *comparisonClause:
+		return "[" + n.text + "]"
+	case *inClause:
+		return "[" + n.text + "]"
+	case *betweenClause:
+		return "[" + n.text + "]"
+	case *existsClause:
+		return "[" + n.text + "]"
+	case *locationClause:
+		return "[" + n.text + "]"
+	case *aggregateNode:
+		return "[" + n.text + "]"
+	}
+	return fmt.Sprintf("%T", node)
+}
+
+func TestParseConditionPrecedence(t *testing.T) {
+	tests := []struct {
+		condition string
+		tree      string
+	}{
+		{"severity = high", "[severity = high]"},
+		{"severity = high AND protocol = tcp OR category = network",
+			"(([severity = high] AND [protocol = tcp]) OR [category = network])"},
+		{"severity = high OR protocol = tcp AND category = network",
+			"([severity = high] OR ([protocol = tcp] AND [category = network]))"},
+		{"(severity = high OR protocol = tcp) AND category = network",
+			"(([severity = high] OR [protocol = tcp]) AND [category = network])"},
+		{"severity = high OR protocol = tcp OR category = network",
+			"([severity = high] OR [protocol = tcp] OR [category = network])"},
+		{"NOT severity = high AND protocol = tcp",
+			"(NOT [severity = high] AND [protocol = tcp])"},
+		{"NOT (severity = high AND protocol = tcp)",
+			"NOT ([severity = high] AND [protocol = tcp])"},
+		{"NOT NOT true", "NOT NOT true"},
+		{"((severity = high))", "[severity = high]"},
+		// lower case and, or and not belong to the value
+		{"message contains error and warning OR severity = high",
+			"([message contains error and warning] OR [severity = high])"},
+		{"message = not found AND status = failure",
+			"([message = not found] AND [status = failure])"},
+		// a value runs to the parenthesis closing its group, keeping balanced ones
+		{"(message = disk (sda) full) AND severity = high",
+			"([message = disk (sda) full] AND [severity = high])"},
+		{`message = "a AND b" OR message = 'it\'s (done'`,
+			`([message = "a AND b"] OR [message = 'it\'s (done'])`},
+		{"protocol in (tcp, udp) AND destination_port between 1 and 1023 OR details.vehicle_id exists",
+			"(([protocol in (tcp, udp)] AND [destination_port between 1 and 1023]) OR [details.vehicle_id exists])"},
+		{"location inside depot AND count(source_ip, 5m) > 20",
+			"([location inside depot] AND [count(source_ip, 5m) > 20])"},
+		{"severity=high AND(protocol=tcp)", "([severity=high] AND [protocol=tcp])"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			node, err := parseCondition(tt.condition)
+			require.NoError(t, err)
+			assert.Equal(t, tt.tree, conditionTree(node))
+		})
+	}
+}
+
+func TestConditionOperators(t *testing.T) {
+	port, score := 22, 0.75
+	event := &models.SecurityEvent{
+		Severity:        models.SeverityHigh,
+		Category:        models.CategoryNetwork,
+		SourceIP:        "10.0.0.5",
+		Protocol:        "tcp",
+		Message:         "failed login for admin",
+		DestinationPort: &port,
+		TrustScore:      &score,
+		RawData:         `{"details": {"vehicle_id": "V-1", "speed": 42.5, "emergency": true, "tags": null, "empty": ""}}`,
+	}
+	engine := &EnhancedRuleEngine{Clock: clock.NewFakeClock(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))}
+
+	tests := []struct {
+		condition string
+		matched   bool
+		err       string
+	}{
+		// equality, on strings, numbers and booleans
+		{"severity = high", true, ""},
+		{"severity == high", true, ""},
+		{"severity is high", true, ""},
+		{"severity = HIGH", false, ""},
+		{"severity != low", true, ""},
+		{"severity <> high", false, ""},
+		{"severity is not low", true, ""},
+		{"destination_port = 22.0", true, ""},
+		{"trust_score = 0.75", true, ""},
+		{"details.emergency = true", true, ""},
+		{"details.emergency is not TRUE", false, ""},
+
+		// string operators, whose names are not case-sensitive
+		{"message contains failed login", true, ""},
+		{"message CONTAINS login", true, ""},
+		{"message not contains admin", false, ""},
+		{"message startswith failed", true, ""},
+		{"message endswith admin", true, ""},
+		{"message matches ^failed .* admin$", true, ""},
+		{"message matches ^admin", false, ""},
+		{"message = failed login for admin", true, ""},
+		{"message = 'failed login for admin'", true, ""},
+		{"message contains \"login AND\"", false, ""},
+
+		// numeric comparisons, on fields and raw data
+		{"destination_port > 21", true, ""},
+		{"destination_port >= 22", true, ""},
+		{"destination_port < 22", false, ""},
+		{"destination_port <= 22", true, ""},
+		{"details.speed > 40", true, ""},
+		{"trust_score < 0.5", false, ""},
+
+		// a missing field is null, and is in no list or range
+		{"source_port is null", true, ""},
+		{"source_port = NULL", true, ""},
+		{"source_port = \"null\"", false, ""},
+		{"source_port != null", false, ""},
+		{"source_port is not \"null\"", true, ""},
+		{"source_port > 10", false, ""},
+		{"details.missing is null", true, ""},
+		{"details.vehicle_id.inner is null", true, ""},
+
+		// in
+		{"protocol in (tcp, udp)", true, ""},
+		{"protocol IN (udp, icmp)", false, ""},
+		{"protocol not in (tcp, udp)", false, ""},
+		{"protocol in (\"tcp\")", true, ""},
+		{"destination_port in (21, 22, 23)", true, ""},
+		{"source_port in (1, 2)", false, ""},
+		{"source_port not in (1, 2)", true, ""},
+
+		// between, inclusive
+		{"destination_port between 1 and 1023", true, ""},
+		{"destination_port between 22 and 22", true, ""},
+		{"destination_port not between 1 and 1023", false, ""},
+		{"details.speed between 40 and 50", true, ""},
+		{"details.vehicle_id between 1 and 2", false, ""},
+		{"source_port not between 1 and 2", true, ""},
+
+		// exists treats nulls and empty strings as absent
+		{"details.vehicle_id exists", true, ""},
+		{"details.empty exists", false, ""},
+		{"details.tags exists", false, ""},
+		{"details.tags not exists", true, ""},
+		{"source_port exists", false, ""},
+		{"raw_data.details.speed exists", true, ""},
+
+		// literals and connectives, which short-circuit
+		{"true", true, ""},
+		{"false", false, ""},
+		{"NOT true", false, ""},
+		{"severity = low OR protocol = tcp", true, ""},
+		{"severity = high AND protocol = udp", false, ""},
+		{"NOT (severity = low OR protocol = udp)", true, ""},
+		{"severity = high and category = network", false, ""},
+		{"false AND hostname = a", false, ""},
+		{"true OR hostname = a", true, ""},
+
+		// values that do not suit the field fail the comparison
+		{"hostname = a", false, "unknown field: hostname"},
+		{"event.hostname = a", false, "unknown field: event.hostname"},
+		{"destination_port > high", false, `failed to parse rule value as number: strconv.ParseFloat: parsing "high": invalid syntax`},
+		{"message matches [a", false, "invalid regex: error parsing regexp: missing closing ]: `[a`"},
+		{"details.emergency > false", false, "unsupported boolean operator: >"},
+		{"details.emergency = yes", false, "invalid boolean value: yes"},
+		{"severity > high", false, "unsupported string operator: >"},
+		{"destination_port contains 2", false, "unsupported numeric operator: contains"},
+		{"true AND hostname = a", false, "unknown field: hostname"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			node, err := parseCondition(tt.condition)
+			require.NoError(t, err)
+			matched, err := node.evaluate(engine, newConditionEvent(event), &models.Rule{})
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.err, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.matched, matched)
+		})
+	}
+}
+
+func TestConditionRawDataErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawData string
+		err     string
+	}{
+		{"not JSON", `{"details":`, "error parsing raw data JSON: unexpected end of JSON input"},
+		{"not an object", `[1, 2]`, "error parsing raw data JSON: not an object"},
+	}
+
+	node, err := parseCondition("details.speed > 40")
+	require.NoError(t, err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &models.SecurityEvent{RawData: tt.rawData}
+			_, err := node.evaluate(&EnhancedRuleEngine{Clock: clock.Default()}, newConditionEvent(event), &models.Rule{})
+			require.Error(t, err)
+			assert.Equal(t, tt.err, err.Error())
+		})
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	tests := []struct {
+		condition string
+		err       string
+	}{
+		{"", "column 1: condition is empty"},
+		{"   ", "column 1: condition is empty"},
+		{"severity", `column 9: expected an operator after "severity", found the end of the condition`},
+		{"severity = ", `column 12: expected a value after "="`},
+		{"severity like high", `column 10: unknown operator "like"`},
+		{"severity ~ high", `column 10: unknown operator "~"`},
+		{"severity ! high", `column 10: unexpected "!", expected an operator such as != or not contains`},
+		{"severity (high)", `column 10: expected an operator after "severity", found "("`},
+		{"message not like x", `column 9: expected contains, in, between or exists after "not", found "like"`},
+		{"= high", `column 1: expected a clause, found "="`},
+		{"sev*rity = high", `column 1: expected a field name, found "sev*rity"`},
+		{"AND severity = high", "column 1: expected a clause before AND"},
+		{"severity = high OR", "column 19: expected a clause, found the end of the condition"},
+		{"NOT", "column 4: expected a clause, found the end of the condition"},
+		{"(severity = high", `column 1: missing ")" to close this "("`},
+		{"(true false)", `column 7: expected AND, OR or ")", found "false"`},
+		{"severity = high)", `column 16: unexpected ")" with no matching "("`},
+		{"true false", `column 6: expected AND, OR or the end of the condition, found "false"`},
+		{"device_id exists and severity = high", `column 18: expected AND or OR, found "and" (AND and OR are upper case)`},
+		{`message = "unterminated`, `column 11: unterminated string, missing closing "`},
+		{`message = 'unterminated\'`, `column 11: unterminated string, missing closing '`},
+
+		{"protocol in tcp", `column 13: expected "(" to start the list after "in", found "tcp"`},
+		{"protocol in (tcp, udp", `column 13: missing ")" to close this list`},
+		{"protocol in (tcp,, udp)", "column 18: expected a value in the list"},
+		{"protocol in ()", "column 14: expected a value in the list"},
+
+		{"destination_port between 1", `column 27: expected "and" between the bounds of the range, found the end of the condition`},
+		{"destination_port between 1 or 2", `column 28: expected "and" between the bounds of the range, found "or"`},
+		{"destination_port between low and 2", `column 26: expected a number for the range, found "low"`},
+		{"destination_port between 10 and 1", "column 34: range 10 to 1 is empty, the lower bound comes first"},
+
+		{"location near depot", `column 10: location supports inside and outside, not "near"`},
+		{"location inside", `column 16: expected a geofence name after "inside"`},
+
+		{"count(source_ip, 5m > 20", `column 1: missing ")" to close count(`},
+		{"count(source_ip, 5m) 20", `column 22: expected a comparison after count(...), found "20"`},
+		{"count(source_ip, 5m) >", `column 23: expected a number after >, found the end of the condition`},
+		{"count(source_ip, 48h) > 20", `column 1: invalid aggregate window "48h", expected a duration such as 30s, 5m or 1h up to 24h`},
+		{"count(hostname, 5m) > 20", `column 1: unknown aggregate field "hostname"`},
+		{"count(source_ip, 5m, protocol) > 20", "column 1: count groups by its own field and takes no third argument"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			_, err := parseCondition(tt.condition)
+			require.Error(t, err)
+			assert.Equal(t, tt.err, err.Error())
+		})
+	}
+}
@@ -1,58 +1,79 @@
 package siem
 
 import (
-	"log"
 	"strings"
-	"time"
 
 	"gorm.io/gorm"
+	"traffic-monitoring-go/app/logging"
 	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
 )
 
 // RuleEngine evaluates ecurity events against rules
 type RuleEngine struct {
-	DB *gorm.DB
+	DB    *gorm.DB
+	Clock clock.Clock
+	Log   *logging.Logger
 }
 
 
 // NewRuleEngine creates a new RuleEngine
 func NewRuleEngine(db *gorm.DB) *RuleEngine {
-	return &RuleEngine{DB: db}
+	return &RuleEngine{DB: db, Clock: clock.Default(), Log: ruleEngineLog}
 }
 
 
 // EvaluateEvent checks an event against all enabled rules and creates alerts if matches
 func (e *RuleEngine) EvaluateEvent(event *models.SecurityEvent) error {
-	// get all enabled rules
-	var rules []models.Rule
-	if err := e.DB.Where("status = ?", models.RuleStatusEnabled).Find(&rules).Error; err != nil {
+	// get the enabled rules whose scope admits this event
+	rules, err := defaultRuleIndex.Candidates(e.DB, event)
+	if err != nil {
 		return err
 	}
 
 	//Evaluate each rule against the event
 	for _, rule := range rules {
-		matched, err := e.evaluateRule(event, &rule)
+		logger := e.Log.WithContext(e.DB.Statement.Context).With("event_id", event.ID, "rule", rule.Name)
+		matched, err := e.evaluateRule(event, &rule.Rule)
 		if err != nil {
-			log.Printf("Error evaluating rule %s: %v", rule.Name, err)
+			logger.Sampled("rules.evaluate:"+rule.Name).Warn("failed to evaluate rule", "error", err)
 			continue
 		}
 
 		if matched {
+			// muted sources still have their events stored, but raise no alerts
+			if mute, err := FindMute(e.DB, event); err != nil {
+				logger.Error("failed to check source mutes", "error", err)
+			} else if mute != nil {
+				if err := RecordSuppression(e.DB, mute); err != nil {
+					logger.Error("failed to record suppressed alert", "error", err)
+				}
+				logger.Info("alert suppressed by mute", "source_type", mute.SourceType, "source_id", mute.SourceID, "reason", mute.Reason)
+				continue
+			}
+
 			// create an alert
 			alert := models.Alert{
 				RuleID:			rule.ID,
 				SecurityEventID:	event.ID,
-				Timestamp:		time.Now(),
+				Timestamp:		e.Clock.Now(),
 				Severity:		rule.Severity,
 				Status:			models.AlertStatusOpen,
+				Techniques:		rule.Techniques,
+				V2XThreats:		rule.V2XThreats,
+				OrganizationID:		event.OrganizationID,
+				CorrelationID:		event.CorrelationID,
 			}
 
+			// add nearest RSU and road for field dispatch when the event has coordinates
+			EnrichAlert(e.DB, &alert, event)
+
 			if err := e.DB.Create(&alert).Error; err != nil {
-				log.Printf("Error creating alert for rule %s: %v", rule.Name, err)
+				logger.Error("failed to create alert", "error", err)
 				continue
 			}
 
-			log.Printf("Created alert for rule: %s, event: %d", rule.Name, event.ID)
+			logger.Info("alert created", "alert_id", alert.ID, "severity", alert.Severity)
 		}
 	}
 	
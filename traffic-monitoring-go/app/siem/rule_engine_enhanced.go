@@ -1,223 +1,316 @@
 package siem
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
 	"regexp"
 	"strings"
 	"time"
 	"strconv"
 
 	"gorm.io/gorm"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/metrics"
 	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
 )
 
+var ruleEvaluationSeconds = metrics.NewHistogramVec("siem_rule_evaluation_seconds",
+	"Time to evaluate the candidate rules against one event", metrics.DefaultBuckets)
+
+// ruleEngineLog is the logger of the rule engines
+var ruleEngineLog = logging.New("rules")
+
 // EnhancedRuleEngine is an improved rule evaluation engine
 type EnhancedRuleEngine struct {
-	DB *gorm.DB
+	DB    *gorm.DB
+	Clock clock.Clock
+	Log   *logging.Logger
+
+	// LateEvaluation marks the alerts raised as late-evaluated and skips rules
+	// that already alerted on the event. Set by catch-up evaluation.
+	LateEvaluation bool
+
+	// Windows holds the state of aggregate clauses; nil uses the shared store
+	Windows *WindowStore
 }
 
 
 // NewEnhancedRuleEngine creates a new EnhancedRuleEngine
 func NewEnhancedRuleEngine(db *gorm.DB) *EnhancedRuleEngine {
-	return &EnhancedRuleEngine{DB: db}
+	return &EnhancedRuleEngine{DB: db, Clock: clock.Default(), Log: ruleEngineLog}
 }
 
 
 // EvaluateEvent checks an event against all enabled rules and creates alerts if matched
 func (e *EnhancedRuleEngine) EvaluateEvent(event *models.SecurityEvent) error {
-	// get all enabled rules
-	var rules []models.Rule
-	if err := e.DB.Where("status = ?", models.RuleStatusEnabled).Find(&rules).Error; err != nil {
-		return err
+	_, err := e.Evaluate(event)
+	return err
+}
+
+// Evaluate checks an event like EvaluateEvent and returns the alerts it created
+func (e *EnhancedRuleEngine) Evaluate(event *models.SecurityEvent) ([]models.Alert, error) {
+	started := time.Now()
+	defer func() { ruleEvaluationSeconds.Observe(time.Since(started).Seconds()) }()
+
+	// get the enabled rules whose scope admits this event
+	rules, err := defaultRuleIndex.Candidates(e.DB, event)
+	if err != nil {
+		return nil, err
 	}
 
-	// evaluate each rule against the event
-	for _, rule := range rules {
-		matched, err := e.evaluateRule(event, &rule)
+	// evaluate each rule against the event, which parses its raw data at most once
+	ev := newConditionEvent(event)
+	var alerts []models.Alert
+	for i := range rules {
+		alert, err := e.applyRule(ev, &rules[i])
 		if err != nil {
-			log.Printf("Error evaluating rule %s: %v", rule.Name, err)
+			e.ruleLog(event, &rules[i].Rule).Error("failed to create alert", "error", err)
 			continue
 		}
-
-		if matched {
-			// create an alert
-			alert := models.Alert{
-				RuleID:			rule.ID,
-				SecurityEventID:	event.ID,
-				Timestamp:		time.Now(),
-				Severity:		rule.Severity,
-				Status:			models.AlertStatusOpen,
-			}
-
-			if err := e.DB.Create(&alert).Error; err != nil {
-				log.Printf("Error creating alert for rule %s: %v", rule.Name, err)
-				continue
-			}
-
-			log.Printf("Created alert for rule: %s, event: %d", rule.Name, event.ID)
+		if alert != nil {
+			alerts = append(alerts, *alert)
 		}
 	}
 
-	return nil
+	return alerts, nil
 }
 
-// evaluateRule checks if an event matches a rule
-func (e *EnhancedRuleEngine) evaluateRule(event *models.SecurityEvent, rule *models.Rule) (bool, error) {
-	// Parse rule condition
-	condition := rule.Condition
-
-	// support for complex conditions with AND, OR, and NOT operators
-	// simplified parser, in a real system you'd use a proper expression parser
-
-	// first handle NOT operators
-	notPattern := regexp.MustCompile(`NOT\s+\(([^)]+)\)`)
-	for notPattern.MatchString(condition) {
-		condition = notPattern.ReplaceAllStringFunc(condition, func(match string) string {
-			// extract the condition inside NOT()
-			subExpr := notPattern.FindStringSubmatch(match)[1]
-
-			// evaluate the sub-expression
-			result, err := e.evaluateSimpleCondition(event, subExpr)
-			if err != nil {
-				log.Printf("Error evaluating NOT condition: %v", err)
-				return "false" // default to false on error
-			}
+// ruleLog returns the logger for what a rule does with an event, with the
+// correlation ID of the transaction evaluating it
+func (e *EnhancedRuleEngine) ruleLog(event *models.SecurityEvent, rule *models.Rule) *logging.Logger {
+	return e.Log.WithContext(e.DB.Statement.Context).With("event_id", event.ID, "rule", rule.Name)
+}
 
-			// return the negated result
-			return strconv.FormatBool(!result)
-		})
+// applyRule evaluates one rule against an event and raises an alert when it
+// matches. It returns the alert, or nil when none was created.
+func (e *EnhancedRuleEngine) applyRule(ev *conditionEvent, compiled *indexedRule) (*models.Alert, error) {
+	event, rule := ev.SecurityEvent, &compiled.Rule
+	matched, err := compiled.evaluate(e, ev)
+	if err != nil {
+		e.ruleLog(event, rule).Sampled("rules.evaluate:"+rule.Name).Warn("failed to evaluate rule", "error", err)
+		return nil, nil
 	}
-
-	// handle AND operators
-	if strings.Contains(condition, " AND ") {
-		parts := strings.Split(condition, " AND ")
-		for _, part := range parts {
-			result, err := e.evaluateSimpleCondition(event, strings.TrimSpace(part))
-			if err != nil {
-				return false, err
-			}
-			if !result {
-				return false, nil // short-circuit on first false condition
-			}
+	if !matched {
+		if e.Log.Enabled(logging.LevelDebug) {
+			e.ruleLog(event, rule).Debug("rule did not match")
 		}
-		return true, nil // all conditions were true
+		return nil, nil
 	}
-
-	// handle OR operators
-	if strings.Contains(condition, " OR ") {
-		parts := strings.Split(condition, " OR ")
-		for _, part := range parts {
-			result, err := e.evaluateSimpleCondition(event, strings.TrimSpace(part))
-			if err != nil {
-				return false, err
-			}
-			if result {
-				return true, nil // short-circuit on first true condition
-			}
+	logger := e.ruleLog(event, rule)
+
+	// muted sources still have their events stored, but raise no alerts
+	if mute, err := FindMute(e.DB, event); err != nil {
+		logger.Error("failed to check source mutes", "error", err)
+	} else if mute != nil {
+		if err := RecordSuppression(e.DB, mute); err != nil {
+			logger.Error("failed to record suppressed alert", "error", err)
 		}
-		return false, nil // no conditions were true
+		logger.Info("alert suppressed by mute", "source_type", mute.SourceType, "source_id", mute.SourceID, "reason", mute.Reason)
+		return nil, nil
 	}
 
-	// if no AND or OR, it's a simple condition
-	return e.evaluateSimpleCondition(event, condition)
-}
+	// create an alert
+	alert := models.Alert{
+		RuleID:			rule.ID,
+		SecurityEventID:	event.ID,
+		Timestamp:		e.Clock.Now(),
+		Severity:		rule.Severity,
+		Status:			models.AlertStatusOpen,
+		Techniques:		rule.Techniques,
+		V2XThreats:		rule.V2XThreats,
+		OrganizationID:		event.OrganizationID,
+		CorrelationID:		event.CorrelationID,
+	}
+
+	if e.LateEvaluation {
+		// a rule that already alerted on this event in real time must not alert twice
+		var existing int64
+		if err := e.DB.Model(&models.Alert{}).Where("rule_id = ? AND security_event_id = ?", rule.ID, event.ID).Count(&existing).Error; err != nil {
+			return nil, err
+		}
+		if existing > 0 {
+			return nil, nil
+		}
+		evaluatedAt := time.Now()
+		alert.LateEvaluated = true
+		alert.EvaluatedAt = &evaluatedAt
+	}
 
+	// add nearest RSU and road for field dispatch when the event has coordinates
+	EnrichAlert(e.DB, &alert, event)
 
-// evaluateSimpleCondition evaluates a single condition against an event
-func (e *EnhancedRuleEngine) evaluateSimpleCondition(event *models.SecurityEvent, condition string) (bool, error) {
-	// handle true/false literals
-	if condition == "true" {
-		return true, nil
+	if err := e.DB.Create(&alert).Error; err != nil {
+		return nil, err
 	}
-	if condition == "false" {
-		return false, nil
+
+	// queue the rule's response actions; the runner takes them once the alert commits
+	if err := QueueResponseActions(e.DB, rule, &alert); err != nil {
+		return nil, err
 	}
 
-	// Parse condition in the format "field operator value"
-	parts := strings.SplitN(condition, " ", 3)
-	if len(parts) != 3 {
-		return false, fmt.Errorf("invalid condition format: %s", condition)
+	logger.Info("alert created", "alert_id", alert.ID, "severity", alert.Severity, "late", alert.LateEvaluated)
+	return &alert, nil
+}
+
+// evaluateRule checks if an event matches a rule that is not in the rule
+// index, such as a draft being backtested
+func (e *EnhancedRuleEngine) evaluateRule(event *models.SecurityEvent, rule *models.Rule) (bool, error) {
+	// parse the condition into an expression tree (see rule_condition.go)
+	condition, err := cachedCondition(rule.Condition)
+	if err != nil {
+		return false, fmt.Errorf("invalid condition: %v", err)
 	}
+	return condition.evaluate(e, newConditionEvent(event), rule)
+}
 
-	field := parts[0]
-	operator := parts[1]
-	value := parts[2]
 
-	// extract value from event based on field
-	var fieldValue interface{}
+// fieldAccessor reads the field a clause tests from an event. Nested fields
+// the event does not have are nil.
+type fieldAccessor func(event *conditionEvent) (interface{}, error)
+
+// compileField returns the accessor of a field tested by a condition;
+// details.<path> is short for raw_data.details.<path>. Accessors of unknown
+// fields fail, as rules saved before validation may still name them.
+func compileField(field string) fieldAccessor {
+	if strings.HasPrefix(field, "details.") {
+		field = "raw_data." + field
+	}
 
 	// handle nested JSON fields
 	if strings.Contains(field, ".") {
-		// if the field refers to the raw data as JSON
-		if strings.HasPrefix(field, "raw_data.") {
-			var rawData map[string]interface{}
-			if err := json.Unmarshal([]byte(event.RawData), &rawData); err != nil {
-				return false, fmt.Errorf("error parsing raw data JSON: %v", err)
+		// only the raw data is JSON
+		if !strings.HasPrefix(field, "raw_data.") {
+			return unknownField(field)
+		}
+		path := strings.Split(strings.TrimPrefix(field, "raw_data."), ".")
+		return func(event *conditionEvent) (interface{}, error) {
+			rawData, err := event.rawData()
+			if err != nil {
+				return nil, fmt.Errorf("error parsing raw data JSON: %v", err)
+			}
+			if _, ok := rawData.(map[string]interface{}); !ok && rawData != nil {
+				return nil, fmt.Errorf("error parsing raw data JSON: not an object")
 			}
-
-			// extract nested field
-			nestedField := field[9:] // remove "raw_data." prefix
-			parts := strings.Split(nestedField, ".")
 
 			// Navigate through the nested structure
 			current := rawData
-			for i, part := range parts {
-				if i == len(parts)-1 {
-					fieldValue = current[part]
-					break
-				}
-
-				next, ok := current[part].(map[string]interface{})
+			for _, part := range path {
+				object, ok := current.(map[string]interface{})
 				if !ok {
-					return false, fmt.Errorf("field not found or not an object: %s", part)
+					return nil, nil
 				}
-				current = next
+				current = object[part]
 			}
+			return current, nil
 		}
-	} else {
-		// handle direct fields
-		switch field {
-		case "severity":
-			fieldValue = string(event.Severity)
-		case "category":
-			fieldValue = string(event.Category)
-		case "source_ip":
-			fieldValue = event.SourceIP
-		case "destination_ip":
-			fieldValue = event.DestinationIP
-		case "protocol":
-			fieldValue = event.Protocol
-		case "action":
-			fieldValue = event.Action
-		case "status":
-			fieldValue = event.Status
-		case "message":
-			fieldValue = event.Message
-		case "source_port":
+	}
+
+	// handle direct fields
+	switch field {
+	case "severity":
+		return func(event *conditionEvent) (interface{}, error) { return string(event.Severity), nil }
+	case "category":
+		return func(event *conditionEvent) (interface{}, error) { return string(event.Category), nil }
+	case "source_ip":
+		return func(event *conditionEvent) (interface{}, error) { return event.SourceIP, nil }
+	case "destination_ip":
+		return func(event *conditionEvent) (interface{}, error) { return event.DestinationIP, nil }
+	case "protocol":
+		return func(event *conditionEvent) (interface{}, error) { return event.Protocol, nil }
+	case "action":
+		return func(event *conditionEvent) (interface{}, error) { return event.Action, nil }
+	case "status":
+		return func(event *conditionEvent) (interface{}, error) { return event.Status, nil }
+	case "message":
+		return func(event *conditionEvent) (interface{}, error) { return event.Message, nil }
+	case "source_port":
+		return func(event *conditionEvent) (interface{}, error) {
 			if event.SourcePort != nil {
-				fieldValue = *event.SourcePort
+				return *event.SourcePort, nil
 			}
-		case "destination_port":
+			return nil, nil
+		}
+	case "destination_port":
+		return func(event *conditionEvent) (interface{}, error) {
 			if event.DestinationPort != nil {
-				fieldValue = *event.DestinationPort
+				return *event.DestinationPort, nil
 			}
-		case "device_id":
-			fieldValue = event.DeviceID
-		default:
-			return false, fmt.Errorf("unknown field: %s", field)
+			return nil, nil
 		}
+	case "device_id":
+		return func(event *conditionEvent) (interface{}, error) { return event.DeviceID, nil }
+	case "trust_score":
+		return func(event *conditionEvent) (interface{}, error) {
+			if event.TrustScore != nil {
+				return *event.TrustScore, nil
+			}
+			return nil, nil
+		}
+	default:
+		return unknownField(field)
+	}
+}
+
+// unknownField returns the accessor of a field events do not have
+func unknownField(field string) fieldAccessor {
+	err := fmt.Errorf("unknown field: %s", field)
+	return func(*conditionEvent) (interface{}, error) { return nil, err }
+}
+
+
+// comparison is the operator and value of a clause, with the value converted
+// once for each type of field it may be compared with
+type comparison struct {
+	operator string
+	value    string
+	quoted   bool // a quoted "null" is the string, not the missing value
+
+	number     float64
+	numberErr  error
+	boolean    bool
+	booleanErr error
+	regex      *regexp.Regexp
+	regexErr   error
+}
+
+// compileComparison converts the value of a clause. Values that do not
+// convert fail the comparisons with fields of that type only.
+func compileComparison(operator, value string, quoted bool) *comparison {
+	c := &comparison{operator: operator, value: value, quoted: quoted}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		c.numberErr = fmt.Errorf("failed to parse rule value as number: %v", err)
+	}
+	c.number = number
+
+	switch strings.ToLower(value) {
+	case "true":
+		c.boolean = true
+	case "false":
+	default:
+		c.booleanErr = fmt.Errorf("invalid boolean value: %s", value)
 	}
 
+	if operator == "matches" {
+		if c.regex, err = regexp.Compile(value); err != nil {
+			c.regexErr = fmt.Errorf("invalid regex: %v", err)
+		}
+	}
+	return c
+}
+
+// match compares a field's value with the clause's value; an unquoted null
+// stands for a missing field
+func (c *comparison) match(fieldValue interface{}, now func() time.Time) (bool, error) {
 	// Handle null/nil values
 	if fieldValue == nil {
 		// Special case for operators that work with null
-		switch operator {
+		switch c.operator {
 		case "is", "=", "==":
-			return strings.ToLower(value) == "null", nil
+			return !c.quoted && strings.ToLower(c.value) == "null", nil
 		case "is not", "!=", "<>":
-			return strings.ToLower(value) != "null", nil
+			return c.quoted || strings.ToLower(c.value) != "null", nil
 		default:
 			return false, nil // All other operations on null return false
 		}
@@ -227,32 +320,82 @@ func (e *EnhancedRuleEngine) evaluateSimpleCondition(event *models.SecurityEvent
 	// Compare based on field type and operator
 	switch v := fieldValue.(type) {
 	case string:
-		return compareString(v, operator, value)
-	case int, int32, int64, uint, uint32, uint64:
-		numValue := fmt.Sprintf("%d", v)
-		return compareNumber(numValue, operator, value)
-	case float32, float64:
-		numValue := fmt.Sprintf("%f", v)
-		return compareNumber(numValue, operator, value)
+		return c.matchString(v)
+	case int:
+		return c.matchNumber(float64(v))
+	case int32:
+		return c.matchNumber(float64(v))
+	case int64:
+		return c.matchNumber(float64(v))
+	case uint:
+		return c.matchNumber(float64(v))
+	case uint32:
+		return c.matchNumber(float64(v))
+	case uint64:
+		return c.matchNumber(float64(v))
+	case float32:
+		return c.matchNumber(roundFloat(float64(v), 32))
+	case float64:
+		return c.matchNumber(roundFloat(v, 64))
 	case bool:
-		switch strings.ToLower(value) {
-		case "true":
-			return compareBoolean(v, operator, true)
-		case "false":
-			return compareBoolean(v, operator, false)
-		default:
-			return false, fmt.Errorf("invalid boolean value: %s", value)
+		if c.booleanErr != nil {
+			return false, c.booleanErr
 		}
+		return compareBoolean(v, c.operator, c.boolean)
 	case time.Time:
-		return compareTime(v, operator, value)
+		return compareTime(v, c.operator, c.value, now())
 	default:
 		// Convert to string as fallback
-		strValue := fmt.Sprintf("%v", v)
-		return compareString(strValue, operator, value)
+		return c.matchString(fmt.Sprintf("%v", v))
 	}
 }
 
+// matchString compares a string field, with the regular expression compiled once
+func (c *comparison) matchString(fieldValue string) (bool, error) {
+	if c.operator == "matches" {
+		if c.regexErr != nil {
+			return false, c.regexErr
+		}
+		return c.regex.MatchString(fieldValue), nil
+	}
+	return compareString(fieldValue, c.operator, c.value)
+}
 
+// matchNumber compares a numeric field
+func (c *comparison) matchNumber(fieldNum float64) (bool, error) {
+	if c.numberErr != nil {
+		return false, c.numberErr
+	}
+	return compareNumbers(fieldNum, c.operator, c.number)
+}
+
+// roundFloat rounds a float field to the six decimals conditions compare it to
+func roundFloat(value float64, bitSize int) float64 {
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(value, 'f', 6, bitSize), 64)
+	if err != nil {
+		return value
+	}
+	return rounded
+}
+
+
+// evaluateLocation tests an event's coordinates against a named geofence.
+// Events without coordinates are neither inside nor outside any geofence.
+func (e *EnhancedRuleEngine) evaluateLocation(event *models.SecurityEvent, operator, geofence string) (bool, error) {
+	if operator != "inside" && operator != "outside" {
+		return false, fmt.Errorf("unsupported location operator: %s", operator)
+	}
+
+	lat, lon, ok := EventLocation(event)
+	if !ok {
+		return false, nil
+	}
+	inside, err := InGeofence(e.DB, strings.TrimSpace(geofence), lat, lon)
+	if err != nil {
+		return false, err
+	}
+	return inside == (operator == "inside"), nil
+}
 
 // compareString compares string values
 func compareString(fieldValue, operator, ruleValue string) (bool, error) {
@@ -293,7 +436,11 @@ func compareNumber(fieldValue, operator, ruleValue string) (bool, error) {
 	if err != nil {
 		return false, fmt.Errorf("failed to parse rule value as number: %v", err)
 	}
+	return compareNumbers(fieldNum, operator, ruleNum)
+}
 
+// compareNumbers compares parsed numeric values
+func compareNumbers(fieldNum float64, operator string, ruleNum float64) (bool, error) {
 	switch operator {
 	case "=", "==", "is":
 		return fieldNum == ruleNum, nil
@@ -324,8 +471,8 @@ func compareBoolean(fieldValue bool, operator string, ruleValue bool) (bool, err
 	}
 }
 
-// compareTime compares time values
-func compareTime(fieldValue time.Time, operator, ruleValue string) (bool, error) {
+// compareTime compares time values, resolving relative expressions against now
+func compareTime(fieldValue time.Time, operator, ruleValue string, now time.Time) (bool, error) {
 	// Parse the rule time value
 	var ruleTime time.Time
 	var err error
@@ -333,12 +480,10 @@ func compareTime(fieldValue time.Time, operator, ruleValue string) (bool, error)
 	// Check for special time values
 	switch ruleValue {
 	case "now":
-		ruleTime = time.Now()
+		ruleTime = now
 	case "today":
-		now := time.Now()
 		ruleTime = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 	case "yesterday":
-		now := time.Now()
 		ruleTime = time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, now.Location())
 	default:
 		// Try various time formats
@@ -378,17 +523,17 @@ func compareTime(fieldValue time.Time, operator, ruleValue string) (bool, error)
 		unit := strings.TrimSpace(parts[1])
 		switch unit {
 		case "second", "seconds":
-			ruleTime = time.Now().Add(time.Duration(-num) * time.Second)
+			ruleTime = now.Add(time.Duration(-num) * time.Second)
 		case "minute", "minutes":
-			ruleTime = time.Now().Add(time.Duration(-num) * time.Minute)
+			ruleTime = now.Add(time.Duration(-num) * time.Minute)
 		case "hour", "hours":
-			ruleTime = time.Now().Add(time.Duration(-num) * time.Hour)
+			ruleTime = now.Add(time.Duration(-num) * time.Hour)
 		case "day", "days":
-			ruleTime = time.Now().AddDate(0, 0, -num)
+			ruleTime = now.AddDate(0, 0, -num)
 		case "month", "months":
-			ruleTime = time.Now().AddDate(0, -num, 0)
+			ruleTime = now.AddDate(0, -num, 0)
 		case "year", "years":
-			ruleTime = time.Now().AddDate(-num, 0, 0)
+			ruleTime = now.AddDate(-num, 0, 0)
 		default:
 			return false, fmt.Errorf("unknown time unit: %s", unit)
 		}
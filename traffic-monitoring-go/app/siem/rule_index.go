@@ -0,0 +1,269 @@
+package siem
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/models"
+)
+
+// ruleIndexTTL bounds how stale the in-memory rule index may get when rules
+// are changed by another instance that cannot invalidate this one
+const ruleIndexTTL = 30 * time.Second
+
+// RuleIndex keeps enabled rules in memory, bucketed by category scope, so the
+// engines only evaluate the rules that can apply to a given event. Conditions
+// are compiled as the rules load, so events are evaluated without parsing them.
+type RuleIndex struct {
+	mutex      sync.RWMutex
+	loaded     bool
+	loadedAt   time.Time
+	ttl        time.Duration
+	total      int
+	unscoped   []indexedRule
+	byCategory map[models.EventCategory][]indexedRule
+
+	events    uint64
+	evaluated uint64
+	skipped   uint64
+}
+
+// RuleIndexStats reports how much work the rule index has saved
+type RuleIndexStats struct {
+	IndexedRules     int       `json:"indexed_rules"`
+	LoadedAt         time.Time `json:"loaded_at"`
+	EventsProcessed  uint64    `json:"events_processed"`
+	RuleEvaluations  uint64    `json:"rule_evaluations"`
+	EvaluationsSaved uint64    `json:"evaluations_saved"`
+	SavedPercent     float64   `json:"saved_percent"`
+}
+
+// indexedRule is an enabled rule with its condition compiled
+type indexedRule struct {
+	models.Rule
+	condition conditionNode
+	err       error // why the condition did not compile
+}
+
+// compileRule compiles the condition of a rule; a condition that does not
+// compile fails each evaluation of the rule with its syntax error
+func compileRule(rule models.Rule) indexedRule {
+	condition, err := parseCondition(rule.Condition)
+	if err != nil {
+		err = fmt.Errorf("invalid condition: %v", err)
+	}
+	return indexedRule{Rule: rule, condition: condition, err: err}
+}
+
+// evaluate checks if an event matches the rule
+func (r *indexedRule) evaluate(e *EnhancedRuleEngine, event *conditionEvent) (bool, error) {
+	if r.err != nil {
+		return false, r.err
+	}
+	return r.condition.evaluate(e, event, &r.Rule)
+}
+
+// NewRuleIndex creates an empty RuleIndex that reloads after ttl
+func NewRuleIndex(ttl time.Duration) *RuleIndex {
+	return &RuleIndex{ttl: ttl}
+}
+
+var defaultRuleIndex = NewRuleIndex(ruleIndexTTL)
+
+// InvalidateRuleIndex forces the shared rule index to reload on the next event,
+// on every instance. Call it whenever rules are created, updated or deleted.
+func InvalidateRuleIndex() {
+	cache.Invalidate("rules")
+}
+
+func init() {
+	cache.OnInvalidate("rules", defaultRuleIndex.Invalidate)
+}
+
+// GetRuleIndexStats returns the statistics of the shared rule index
+func GetRuleIndexStats() RuleIndexStats {
+	return defaultRuleIndex.Stats()
+}
+
+// Invalidate drops the cached rules
+func (idx *RuleIndex) Invalidate() {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	idx.loaded = false
+}
+
+// load rebuilds the index from the enabled rules in the database, compiling
+// their conditions
+func (idx *RuleIndex) load(db *gorm.DB) error {
+	var rules []models.Rule
+	if err := db.Where("status = ?", models.RuleStatusEnabled).Order("id ASC").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	unscoped := make([]indexedRule, 0)
+	byCategory := make(map[models.EventCategory][]indexedRule)
+	for _, enabled := range rules {
+		rule := compileRule(enabled)
+		if len(rule.Scope.Categories) == 0 {
+			unscoped = append(unscoped, rule)
+			continue
+		}
+		for _, category := range rule.Scope.Categories {
+			byCategory[category] = append(byCategory[category], rule)
+		}
+	}
+
+	idx.unscoped = unscoped
+	idx.byCategory = byCategory
+	idx.total = len(rules)
+	idx.loaded = true
+	idx.loadedAt = time.Now()
+	return nil
+}
+
+// Candidates returns the enabled rules whose scope and tenant admit the event,
+// ordered by rule ID, with their compiled conditions
+func (idx *RuleIndex) Candidates(db *gorm.DB, event *models.SecurityEvent) ([]indexedRule, error) {
+	idx.mutex.RLock()
+	stale := !idx.loaded || time.Since(idx.loadedAt) > idx.ttl
+	idx.mutex.RUnlock()
+
+	if stale {
+		idx.mutex.Lock()
+		if !idx.loaded || time.Since(idx.loadedAt) > idx.ttl {
+			if err := idx.load(db); err != nil {
+				idx.mutex.Unlock()
+				return nil, err
+			}
+		}
+		idx.mutex.Unlock()
+	}
+
+	idx.mutex.RLock()
+	bucket := idx.byCategory[event.Category]
+	total := idx.total
+	candidates := make([]indexedRule, 0, len(idx.unscoped)+len(bucket))
+	candidates = append(candidates, idx.unscoped...)
+	candidates = append(candidates, bucket...)
+	idx.mutex.RUnlock()
+
+	messageType := ""
+	messageTypeParsed := false
+	filtered := candidates[:0]
+	for _, rule := range candidates {
+		if !ruleTenantAdmits(&rule.Rule, event) {
+			continue
+		}
+		if len(rule.Scope.LogSourceIDs) > 0 && !containsUint(rule.Scope.LogSourceIDs, event.LogSourceID) {
+			continue
+		}
+		if len(rule.Scope.MessageTypes) > 0 {
+			if !messageTypeParsed {
+				messageType = eventMessageType(event)
+				messageTypeParsed = true
+			}
+			if !containsString(rule.Scope.MessageTypes, messageType) {
+				continue
+			}
+		}
+		filtered = append(filtered, rule)
+	}
+
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].ID < filtered[j].ID })
+
+	atomic.AddUint64(&idx.events, 1)
+	atomic.AddUint64(&idx.evaluated, uint64(len(filtered)))
+	if total > len(filtered) {
+		atomic.AddUint64(&idx.skipped, uint64(total-len(filtered)))
+	}
+
+	return filtered, nil
+}
+
+// Stats returns a snapshot of the index statistics
+func (idx *RuleIndex) Stats() RuleIndexStats {
+	idx.mutex.RLock()
+	stats := RuleIndexStats{
+		IndexedRules: idx.total,
+		LoadedAt:     idx.loadedAt,
+	}
+	idx.mutex.RUnlock()
+
+	stats.EventsProcessed = atomic.LoadUint64(&idx.events)
+	stats.RuleEvaluations = atomic.LoadUint64(&idx.evaluated)
+	stats.EvaluationsSaved = atomic.LoadUint64(&idx.skipped)
+	if all := stats.RuleEvaluations + stats.EvaluationsSaved; all > 0 {
+		stats.SavedPercent = float64(stats.EvaluationsSaved) / float64(all) * 100
+	}
+
+	return stats
+}
+
+// ruleScopeAdmits reports whether a rule's scope admits an event, the same check
+// Candidates applies through the index buckets
+func ruleScopeAdmits(rule *models.Rule, event *models.SecurityEvent) bool {
+	if !ruleTenantAdmits(rule, event) {
+		return false
+	}
+	if len(rule.Scope.Categories) > 0 {
+		admitted := false
+		for _, category := range rule.Scope.Categories {
+			if category == event.Category {
+				admitted = true
+				break
+			}
+		}
+		if !admitted {
+			return false
+		}
+	}
+	if len(rule.Scope.LogSourceIDs) > 0 && !containsUint(rule.Scope.LogSourceIDs, event.LogSourceID) {
+		return false
+	}
+	if len(rule.Scope.MessageTypes) > 0 && !containsString(rule.Scope.MessageTypes, eventMessageType(event)) {
+		return false
+	}
+	return true
+}
+
+// eventMessageType reads the message type (e.g. BSM, CAM) recorded in the raw event
+func eventMessageType(event *models.SecurityEvent) string {
+	var raw struct {
+		MessageType string                 `json:"message_type"`
+		Details     map[string]interface{} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(event.RawData), &raw); err != nil {
+		return ""
+	}
+	if raw.MessageType != "" {
+		return raw.MessageType
+	}
+	if messageType, ok := raw.Details["message_type"].(string); ok {
+		return messageType
+	}
+	return ""
+}
+
+func containsUint(values []uint, value uint) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
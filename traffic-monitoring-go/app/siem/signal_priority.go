@@ -0,0 +1,249 @@
+package siem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/eventschema"
+	"traffic-monitoring-go/app/models"
+)
+
+const (
+	// MaxPriorityReviewWindow bounds the time range of one signal priority review
+	MaxPriorityReviewWindow = 24 * time.Hour
+
+	// priorityReachRadius is how close to an intersection a requester has to
+	// come for its request to count as made on the way through it
+	priorityReachRadius = 50.0
+
+	// priorityBSMMargin extends the time range the BSMs of the requesters are
+	// read from, for vehicles requesting just after from or passing after to
+	priorityBSMMargin = time.Minute
+
+	// maxPriorityRequests bounds the requests listed in a review
+	maxPriorityRequests = 500
+)
+
+// priorityRoles are the requester roles entitled to signal priority
+var priorityRoles = map[string]bool{
+	eventschema.RoleEmergency: true,
+	eventschema.RoleTransit:   true,
+}
+
+// PriorityRequestReview is one signal request made to an intersection, as
+// its SRMs and the SSMs answering it show it, and what speaks against it
+type PriorityRequestReview struct {
+	RequesterID     string     `json:"requester_id"`
+	RequestID       int        `json:"request_id"`
+	Role            string     `json:"role,omitempty"`
+	InboundApproach int        `json:"inbound_approach,omitempty"`
+	FirstSeen       time.Time  `json:"first_seen"`
+	LastSeen        time.Time  `json:"last_seen"`
+	SRMs            int        `json:"srms"`
+	Cancelled       bool       `json:"cancelled"`
+	Status          string     `json:"status,omitempty"` // the latest an SSM gave it
+	GrantedAt       *time.Time `json:"granted_at,omitempty"`
+	BSMs            int        `json:"bsms"`                // of the requester, within a minute of the time range
+	ClosestM        *float64   `json:"closest_m,omitempty"` // to the intersection, in those BSMs
+	Suspicious      bool       `json:"suspicious"`
+	Reasons         []string   `json:"reasons,omitempty"`
+}
+
+// SignalPriorityReview lists the signal requests (SRMs) an intersection
+// received in a time range with the answers (SSMs) it gave, flagging those
+// that look like fake preemption
+type SignalPriorityReview struct {
+	IntersectionID    int                     `json:"intersection_id"`
+	From              time.Time               `json:"from"`
+	To                time.Time               `json:"to"`
+	SRMs              int                     `json:"srms"`
+	SSMs              int                     `json:"ssms"`
+	RequestCount      int                     `json:"request_count"`
+	SuspiciousCount   int                     `json:"suspicious_count"`
+	SuspiciousGranted int                     `json:"suspicious_granted"` // suspicious requests the intersection granted
+	Requests          []PriorityRequestReview `json:"requests"`           // the first 500 seen
+}
+
+// requesterTrack is what the BSMs of a requester show about its way to an intersection
+type requesterTrack struct {
+	bsms    int
+	closest float64
+}
+
+// ReviewSignalPriority pairs the SRMs sent to an intersection between from
+// and to with the statuses its SSMs gave them. A request is suspicious when
+// its requester broadcast no BSM within a minute of the time range, never came
+// within 50 m of the intersection or claims a role not entitled to priority,
+// or when only SSMs mention it.
+func ReviewSignalPriority(db *gorm.DB, intersection *models.SyntheticIntersection, from, to time.Time) (SignalPriorityReview, error) {
+	review := SignalPriorityReview{
+		IntersectionID: intersection.IntersectionID,
+		From:           from,
+		To:             to,
+		Requests:       []PriorityRequestReview{},
+	}
+	if !to.After(from) {
+		return review, errors.New("to must be after from")
+	}
+	if to.Sub(from) > MaxPriorityReviewWindow {
+		return review, errors.New("the time range may span at most 24 hours")
+	}
+
+	type requestKey struct {
+		requester string
+		id        int
+	}
+	requests := make(map[requestKey]*PriorityRequestReview)
+	request := func(requester string, id int, at time.Time) *PriorityRequestReview {
+		key := requestKey{requester, id}
+		r, ok := requests[key]
+		if !ok {
+			r = &PriorityRequestReview{RequesterID: requester, RequestID: id, FirstSeen: at, LastSeen: at}
+			requests[key] = r
+		}
+		if at.Before(r.FirstSeen) {
+			r.FirstSeen = at
+		}
+		if at.After(r.LastSeen) {
+			r.LastSeen = at
+		}
+		return r
+	}
+	tracks := make(map[string]*requesterTrack)
+
+	// batches go by ID, which pages them; the review does not depend on order
+	// except for the latest status, which is taken by generation time
+	statusAt := make(map[requestKey]time.Time)
+	var events []models.SecurityEvent
+	err := db.Where("category = ?", models.CategoryV2X).
+		Where("timestamp >= ? AND timestamp < ?", from.Add(-priorityBSMMargin), to.Add(priorityBSMMargin)).
+		FindInBatches(&events, 500, func(tx *gorm.DB, batch int) error {
+			for i := range events {
+				event := &events[i]
+				// findings copy the fields of the message they were raised on
+				if strings.Contains(event.RawData, `"anomaly_type"`) {
+					continue
+				}
+				obs, ok := ParseV2XObservation(event, "")
+				if !ok {
+					continue
+				}
+				inRange := !event.Timestamp.Before(from) && event.Timestamp.Before(to)
+
+				switch strings.ToLower(obs.MessageType) {
+				case eventschema.MessageBasicSafety:
+					if !obs.HasLocation {
+						continue
+					}
+					track := tracks[obs.VehicleID]
+					if track == nil {
+						track = &requesterTrack{closest: math.Inf(1)}
+						tracks[obs.VehicleID] = track
+					}
+					track.bsms++
+					track.closest = math.Min(track.closest, DistanceMeters(intersection.Latitude, intersection.Longitude, obs.Latitude, obs.Longitude))
+
+				case eventschema.MessageSRM:
+					if !inRange || obs.IntersectionID != intersection.IntersectionID {
+						continue
+					}
+					var raw struct {
+						Details eventschema.V2XDetails `json:"details"`
+					}
+					if err := json.Unmarshal([]byte(event.RawData), &raw); err != nil {
+						continue
+					}
+					review.SRMs++
+					r := request(obs.VehicleID, obs.RequestID, event.Timestamp)
+					r.SRMs++
+					if raw.Details.RequesterRole != "" {
+						r.Role = raw.Details.RequesterRole
+					}
+					if raw.Details.InboundApproach != 0 {
+						r.InboundApproach = raw.Details.InboundApproach
+					}
+					if raw.Details.RequestType == eventschema.RequestCancel {
+						r.Cancelled = true
+					}
+
+				case eventschema.MessageSSM:
+					if !inRange || obs.IntersectionID != intersection.IntersectionID {
+						continue
+					}
+					var raw struct {
+						Details eventschema.V2XDetails `json:"details"`
+					}
+					if err := json.Unmarshal([]byte(event.RawData), &raw); err != nil {
+						continue
+					}
+					review.SSMs++
+					for _, status := range raw.Details.PriorityStatuses {
+						r := request(status.RequesterID, status.RequestID, event.Timestamp)
+						key := requestKey{status.RequesterID, status.RequestID}
+						if at, ok := statusAt[key]; !ok || !event.Timestamp.Before(at) {
+							statusAt[key] = event.Timestamp
+							r.Status = status.Status
+						}
+						if r.Role == "" {
+							r.Role = status.Role
+						}
+						if status.Status == eventschema.PriorityGranted && (r.GrantedAt == nil || event.Timestamp.Before(*r.GrantedAt)) {
+							granted := event.Timestamp
+							r.GrantedAt = &granted
+						}
+					}
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return review, err
+	}
+
+	for _, r := range requests {
+		if track, ok := tracks[r.RequesterID]; ok {
+			r.BSMs = track.bsms
+			closest := math.Round(track.closest)
+			r.ClosestM = &closest
+		}
+		switch {
+		case r.SRMs == 0:
+			r.Reasons = append(r.Reasons, "answered in SSMs without any SRM making the request")
+		case r.BSMs == 0:
+			r.Reasons = append(r.Reasons, "the requester broadcast no BSM")
+		case *r.ClosestM > priorityReachRadius:
+			r.Reasons = append(r.Reasons, fmt.Sprintf("the requester came no closer than %.0f m to the intersection", *r.ClosestM))
+		}
+		if r.Role != "" && !priorityRoles[r.Role] {
+			r.Reasons = append(r.Reasons, fmt.Sprintf("role %s is not entitled to priority", r.Role))
+		}
+
+		r.Suspicious = len(r.Reasons) > 0
+		review.RequestCount++
+		if r.Suspicious {
+			review.SuspiciousCount++
+			if r.GrantedAt != nil {
+				review.SuspiciousGranted++
+			}
+		}
+		review.Requests = append(review.Requests, *r)
+	}
+
+	sort.Slice(review.Requests, func(i, j int) bool {
+		a, b := review.Requests[i], review.Requests[j]
+		if !a.FirstSeen.Equal(b.FirstSeen) {
+			return a.FirstSeen.Before(b.FirstSeen)
+		}
+		return a.RequesterID < b.RequesterID
+	})
+	if len(review.Requests) > maxPriorityRequests {
+		review.Requests = review.Requests[:maxPriorityRequests]
+	}
+	return review, nil
+}
@@ -0,0 +1,261 @@
+package siem
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/models"
+)
+
+// TransformEngine rewrites third-party events into the SIEM ingest schema
+// using the declarative transform rules stored in the database
+type TransformEngine struct {
+	DB *gorm.DB
+}
+
+// NewTransformEngine creates a new TransformEngine
+func NewTransformEngine(db *gorm.DB) *TransformEngine {
+	return &TransformEngine{DB: db}
+}
+
+// transformRuleCacheTTL bounds how long a rule changed on another instance takes to apply here
+const transformRuleCacheTTL = 10 * time.Second
+
+// transformRuleCache keeps the enabled transform rules, highest priority first
+type transformRuleCache struct {
+	mutex    sync.RWMutex
+	loaded   bool
+	loadedAt time.Time
+	rules    []models.TransformRule
+}
+
+var defaultTransformRules = &transformRuleCache{}
+
+// InvalidateTransformRules forces the transform rule cache to reload. Call it whenever rules change.
+func InvalidateTransformRules() {
+	cache.Invalidate("transform_rules")
+}
+
+// invalidate drops the cached rules of this instance
+func (c *transformRuleCache) invalidate() {
+	c.mutex.Lock()
+	c.loaded = false
+	c.mutex.Unlock()
+}
+
+func init() {
+	cache.OnInvalidate("transform_rules", defaultTransformRules.invalidate)
+}
+
+func (c *transformRuleCache) get(db *gorm.DB) ([]models.TransformRule, error) {
+	c.mutex.RLock()
+	if c.loaded && time.Since(c.loadedAt) <= transformRuleCacheTTL {
+		rules := c.rules
+		c.mutex.RUnlock()
+		return rules, nil
+	}
+	c.mutex.RUnlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded || time.Since(c.loadedAt) > transformRuleCacheTTL {
+		var rules []models.TransformRule
+		if err := db.Where("enabled = ?", true).Order("priority DESC, id ASC").Find(&rules).Error; err != nil {
+			return nil, err
+		}
+		c.rules = rules
+		c.loaded = true
+		c.loadedAt = time.Now()
+	}
+	return c.rules, nil
+}
+
+// Apply runs all enabled, matching transform rules over a raw event.
+// Events that match no rule are returned unchanged.
+func (t *TransformEngine) Apply(rawEventData []byte) ([]byte, error) {
+	rules, err := defaultTransformRules.get(t.DB)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return rawEventData, nil
+	}
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(rawEventData, &event); err != nil {
+		return nil, err
+	}
+
+	applied := false
+	for i := range rules {
+		if !RuleMatchesEvent(&rules[i], event) {
+			continue
+		}
+		if err := ApplyTransformRule(&rules[i], event); err != nil {
+			return nil, fmt.Errorf("transform rule %s: %v", rules[i].Name, err)
+		}
+		applied = true
+	}
+
+	if !applied {
+		return rawEventData, nil
+	}
+	return json.Marshal(event)
+}
+
+// RuleMatchesEvent reports whether a transform rule applies to a decoded event
+func RuleMatchesEvent(rule *models.TransformRule, event map[string]interface{}) bool {
+	if rule.SourceName != "" && rule.SourceName != "*" {
+		sourceName, _ := getPath(event, "source_name")
+		if fmt.Sprintf("%v", sourceName) != rule.SourceName {
+			return false
+		}
+	}
+
+	if rule.MatchField != "" {
+		value, ok := getPath(event, rule.MatchField)
+		if !ok || fmt.Sprintf("%v", value) != rule.MatchValue {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ApplyTransformRule applies every mapping of a rule to a decoded event in place
+func ApplyTransformRule(rule *models.TransformRule, event map[string]interface{}) error {
+	for _, mapping := range rule.Mappings {
+		if mapping.To == "" {
+			return fmt.Errorf("mapping from %q has no target field", mapping.From)
+		}
+
+		var value interface{}
+		found := false
+		if mapping.From != "" {
+			value, found = getPath(event, mapping.From)
+		}
+		if !found {
+			if mapping.Default == "" {
+				continue
+			}
+			value = mapping.Default
+		}
+
+		if translated, ok := mapping.Values[fmt.Sprintf("%v", value)]; ok {
+			value = translated
+		}
+
+		converted, err := convertValue(value, mapping.Convert)
+		if err != nil {
+			return fmt.Errorf("field %s: %v", mapping.From, err)
+		}
+
+		if found && !mapping.KeepSource && mapping.From != mapping.To {
+			deletePath(event, mapping.From)
+		}
+		setPath(event, mapping.To, converted)
+	}
+
+	return nil
+}
+
+// convertValue converts a mapped value into the requested representation
+func convertValue(value interface{}, convert string) (interface{}, error) {
+	switch convert {
+	case "":
+		return value, nil
+	case "string":
+		return fmt.Sprintf("%v", value), nil
+	case "number":
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			return strconv.ParseFloat(strings.TrimSpace(v), 64)
+		default:
+			return nil, fmt.Errorf("cannot convert %T to number", value)
+		}
+	case "unix", "unix_ms":
+		var n float64
+		switch v := value.(type) {
+		case float64:
+			n = v
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, err
+			}
+			n = parsed
+		default:
+			return nil, fmt.Errorf("cannot convert %T to timestamp", value)
+		}
+		// keep the fraction to the microsecond, as fine as a float64 of
+		// seconds since the epoch resolves
+		whole, fraction := math.Modf(n)
+		if convert == "unix_ms" {
+			t := time.UnixMilli(int64(whole)).Add(time.Duration(math.Round(fraction*1e3)) * time.Microsecond)
+			return t.UTC().Format(time.RFC3339Nano), nil
+		}
+		t := time.Unix(int64(whole), int64(math.Round(fraction*1e6))*int64(time.Microsecond))
+		return t.UTC().Format(time.RFC3339Nano), nil
+	default:
+		return nil, fmt.Errorf("unknown conversion %q", convert)
+	}
+}
+
+// getPath reads a dotted path from nested maps
+func getPath(m map[string]interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	current := m
+	for i, part := range parts {
+		value, ok := current[part]
+		if !ok {
+			return nil, false
+		}
+		if i == len(parts)-1 {
+			return value, true
+		}
+		next, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return nil, false
+}
+
+// setPath writes a dotted path into nested maps, creating intermediate maps as needed
+func setPath(m map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	current := m
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
+
+// deletePath removes a dotted path from nested maps
+func deletePath(m map[string]interface{}, path string) {
+	parts := strings.Split(path, ".")
+	current := m
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		current = next
+	}
+	delete(current, parts[len(parts)-1])
+}
@@ -0,0 +1,41 @@
+package siem
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertValueTimestamps(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		convert string
+		want    string
+		err     string
+	}{
+		{"whole seconds", float64(1700000000), "unix", "2023-11-14T22:13:20Z", ""},
+		{"fractional seconds", 1700000000.123, "unix", "2023-11-14T22:13:20.123Z", ""},
+		{"microseconds", 1700000000.000001, "unix", "2023-11-14T22:13:20.000001Z", ""},
+		{"fractional seconds as text", " 1700000000.5 ", "unix", "2023-11-14T22:13:20.5Z", ""},
+		{"before the epoch", -1.5, "unix", "1969-12-31T23:59:58.5Z", ""},
+		{"whole milliseconds", float64(1700000000123), "unix_ms", "2023-11-14T22:13:20.123Z", ""},
+		{"fractional milliseconds", "1700000000123.25", "unix_ms", "2023-11-14T22:13:20.12325Z", ""},
+		{"not a number", "soon", "unix", "", `strconv.ParseFloat: parsing "soon": invalid syntax`},
+		{"not a timestamp", true, "unix", "", "cannot convert bool to timestamp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertValue(tt.value, tt.convert)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.err, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
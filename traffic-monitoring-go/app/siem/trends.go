@@ -0,0 +1,347 @@
+package siem
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// trendTotalKey names the total of a dimension in trend rules
+const trendTotalKey = "all"
+
+// v2xDetailPattern extracts a string field of the event details in SQL, without
+// failing on raw data that is not valid JSON
+func v2xDetailPattern(field string) string {
+	return `substring(security_events.raw_data from '"` + field + `"\s*:\s*"([^"]+)"')`
+}
+
+// trendQuery describes how a dimension is counted
+type trendQuery struct {
+	table      string
+	timeColumn string
+	key        string
+	joins      string
+	where      string
+	args       []interface{}
+}
+
+var vehicleKey = "COALESCE(" + v2xDetailPattern("vehicle_id") + ", NULLIF(security_events.device_id, ''))"
+
+var trendQueries = map[models.TrendDimension]trendQuery{
+	models.TrendAlertVolume: {
+		table: "alerts", timeColumn: "alerts.timestamp", key: "alerts.severity",
+	},
+	models.TrendAnomalyTypes: {
+		table: "alerts", timeColumn: "alerts.timestamp", key: "rules.name",
+		joins: "JOIN rules ON rules.id = alerts.rule_id",
+	},
+	models.TrendEventCategories: {
+		table: "security_events", timeColumn: "security_events.timestamp", key: "security_events.category",
+	},
+	models.TrendMessageTypes: {
+		table: "security_events", timeColumn: "security_events.timestamp", key: v2xDetailPattern("message_type"),
+		where: "security_events.category = ?", args: []interface{}{models.CategoryV2X},
+	},
+	models.TrendVehicleMessages: {
+		table: "security_events", timeColumn: "security_events.timestamp", key: vehicleKey,
+		where: "security_events.category = ?", args: []interface{}{models.CategoryV2X},
+	},
+	models.TrendVehicleAlerts: {
+		table: "alerts", timeColumn: "alerts.timestamp", key: vehicleKey,
+		joins: "JOIN security_events ON security_events.id = alerts.security_event_id",
+		where: "security_events.category = ?", args: []interface{}{models.CategoryV2X},
+	},
+	models.TrendV2XAnomalies: {
+		table: "security_events", timeColumn: "security_events.timestamp", key: v2xDetailPattern("anomaly_type"),
+		where: "security_events.category = ?", args: []interface{}{models.CategoryV2X},
+	},
+}
+
+// ValidTrendDimension reports whether dimension can be computed
+func ValidTrendDimension(dimension models.TrendDimension) bool {
+	_, ok := trendQueries[dimension]
+	return ok
+}
+
+// TrendPeriodLength returns the length of each window of a period
+func TrendPeriodLength(period models.TrendPeriod) (time.Duration, bool) {
+	switch period {
+	case models.TrendPeriodWeek:
+		return 7 * 24 * time.Hour, true
+	case models.TrendPeriodMonth:
+		return 30 * 24 * time.Hour, true
+	}
+	return 0, false
+}
+
+// TrendItem compares the count of one key in the current and previous windows
+type TrendItem struct {
+	Key       string   `json:"key"`
+	Current   int64    `json:"current"`
+	Previous  int64    `json:"previous"`
+	Change    int64    `json:"change"`
+	ChangePct *float64 `json:"change_pct,omitempty"` // nil when the previous window was empty
+	Ratio     *float64 `json:"ratio,omitempty"`
+}
+
+func newTrendItem(key string, current, previous int64) TrendItem {
+	item := TrendItem{Key: key, Current: current, Previous: previous, Change: current - previous}
+	if previous > 0 {
+		ratio := float64(current) / float64(previous)
+		pct := (ratio - 1) * 100
+		item.Ratio, item.ChangePct = &ratio, &pct
+	}
+	return item
+}
+
+// TrendReport is a dimension broken down by key over two consecutive windows
+type TrendReport struct {
+	Dimension     models.TrendDimension `json:"dimension"`
+	Period        models.TrendPeriod    `json:"period"`
+	CurrentStart  time.Time             `json:"current_start"`
+	CurrentEnd    time.Time             `json:"current_end"`
+	PreviousStart time.Time             `json:"previous_start"`
+	Total         TrendItem             `json:"total"`
+	Items         []TrendItem           `json:"items"` // largest absolute change first
+	Keys          int                   `json:"keys"`  // keys seen, before the limit
+}
+
+// Find returns the item of key, or the total for "all"
+func (r *TrendReport) Find(key string) (TrendItem, bool) {
+	if key == trendTotalKey {
+		return r.Total, true
+	}
+	for _, item := range r.Items {
+		if item.Key == key {
+			return item, true
+		}
+	}
+	return TrendItem{}, false
+}
+
+// TrendService computes week-over-week and month-over-month trends and raises
+// trend alerts when a rule's threshold is crossed
+type TrendService struct {
+	DB    *gorm.DB
+	Clock clock.Clock
+}
+
+// NewTrendService creates a new TrendService
+func NewTrendService(db *gorm.DB) *TrendService {
+	return &TrendService{DB: db, Clock: clock.Default()}
+}
+
+// Compute compares the window ending at the current hour with the one before
+// it. limit bounds the items returned; 0 returns every key.
+func (s *TrendService) Compute(dimension models.TrendDimension, period models.TrendPeriod, limit int) (*TrendReport, error) {
+	length, ok := TrendPeriodLength(period)
+	if !ok {
+		return nil, fmt.Errorf("unknown trend period: %s", period)
+	}
+
+	end := s.Clock.Now().UTC().Truncate(time.Hour)
+	report, err := s.CompareWindows(dimension, end.Add(-length), end, limit)
+	if err != nil {
+		return nil, err
+	}
+	report.Period = period
+	return report, nil
+}
+
+// CompareWindows compares [start, end) with the window of the same length
+// before it. limit bounds the items returned; 0 returns every key.
+func (s *TrendService) CompareWindows(dimension models.TrendDimension, start, end time.Time, limit int) (*TrendReport, error) {
+	query, ok := trendQueries[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown trend dimension: %s", dimension)
+	}
+
+	report := &TrendReport{
+		Dimension:     dimension,
+		CurrentEnd:    end,
+		CurrentStart:  start,
+		PreviousStart: start.Add(-end.Sub(start)),
+	}
+
+	var rows []struct {
+		Key      string `gorm:"column:trend_key"`
+		Current  int64
+		Previous int64
+	}
+	db := database.ReadDB(s.DB).Table(query.table).
+		Select(fmt.Sprintf("%s AS trend_key, SUM(CASE WHEN %s >= ? THEN 1 ELSE 0 END) AS current, SUM(CASE WHEN %s < ? THEN 1 ELSE 0 END) AS previous",
+			query.key, query.timeColumn, query.timeColumn), report.CurrentStart, report.CurrentStart)
+	if query.joins != "" {
+		db = db.Joins(query.joins)
+	}
+	if query.where != "" {
+		db = db.Where(query.where, query.args...)
+	}
+	err := db.Where(query.timeColumn+" >= ? AND "+query.timeColumn+" < ?", report.PreviousStart, end).
+		Where(query.key + " IS NOT NULL").
+		Group(query.key).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var current, previous int64
+	report.Items = make([]TrendItem, 0, len(rows))
+	for _, row := range rows {
+		current += row.Current
+		previous += row.Previous
+		report.Items = append(report.Items, newTrendItem(row.Key, row.Current, row.Previous))
+	}
+	report.Total = newTrendItem(trendTotalKey, current, previous)
+	report.Keys = len(report.Items)
+
+	sort.Slice(report.Items, func(i, j int) bool {
+		a, b := report.Items[i].Change, report.Items[j].Change
+		if a < 0 {
+			a = -a
+		}
+		if b < 0 {
+			b = -b
+		}
+		if a != b {
+			return a > b
+		}
+		return report.Items[i].Key < report.Items[j].Key
+	})
+	if limit > 0 && len(report.Items) > limit {
+		report.Items = report.Items[:limit]
+	}
+	return report, nil
+}
+
+// ValidateTrendRule checks a trend rule before it is stored
+func ValidateTrendRule(rule *models.TrendRule) error {
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+	if !ValidTrendDimension(rule.Dimension) {
+		return fmt.Errorf("unknown trend dimension: %s", rule.Dimension)
+	}
+	if _, ok := TrendPeriodLength(rule.Period); !ok {
+		return fmt.Errorf("period must be %s or %s", models.TrendPeriodWeek, models.TrendPeriodMonth)
+	}
+	if rule.Key == "" {
+		rule.Key = trendTotalKey
+	}
+	if rule.MinRatio <= 1 {
+		return errors.New("min_ratio must be greater than 1")
+	}
+	if rule.MinCount < 0 {
+		return errors.New("min_count must not be negative")
+	}
+	if rule.Severity == "" {
+		rule.Severity = models.SeverityMedium
+	}
+	return nil
+}
+
+// EvaluateRules checks every enabled trend rule and records an alert for each
+// one whose threshold is crossed. A rule fires at most once per period.
+func (s *TrendService) EvaluateRules() ([]models.TrendAlert, error) {
+	var rules []models.TrendRule
+	if err := s.DB.Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	reports := make(map[string]*TrendReport)
+	var fired []models.TrendAlert
+	for _, rule := range rules {
+		reportKey := string(rule.Dimension) + "|" + string(rule.Period)
+		report, ok := reports[reportKey]
+		if !ok {
+			var err error
+			if report, err = s.Compute(rule.Dimension, rule.Period, 0); err != nil {
+				log.Printf("Error computing trend %s for rule %s: %v", reportKey, rule.Name, err)
+				continue
+			}
+			reports[reportKey] = report
+		}
+
+		item, ok := report.Find(rule.Key)
+		if !ok || item.Current < rule.MinCount || item.Current == 0 {
+			continue
+		}
+		if item.Ratio != nil && *item.Ratio < rule.MinRatio {
+			continue
+		}
+
+		length, _ := TrendPeriodLength(rule.Period)
+		var recent int64
+		err := s.DB.Model(&models.TrendAlert{}).
+			Where("trend_rule_id = ? AND window_end > ?", rule.ID, report.CurrentEnd.Add(-length)).
+			Count(&recent).Error
+		if err != nil {
+			return fired, err
+		}
+		if recent > 0 {
+			continue
+		}
+
+		alert := models.TrendAlert{
+			TrendRuleID: rule.ID,
+			RuleName:    rule.Name,
+			Dimension:   rule.Dimension,
+			Key:         rule.Key,
+			Period:      rule.Period,
+			WindowStart: report.CurrentStart,
+			WindowEnd:   report.CurrentEnd,
+			Current:     item.Current,
+			Previous:    item.Previous,
+			Ratio:       item.Ratio,
+			Severity:    rule.Severity,
+		}
+		if item.Ratio != nil {
+			alert.Message = fmt.Sprintf("%s %s rose %.1fx %s (%d from %d)",
+				rule.Dimension, rule.Key, *item.Ratio, trendPeriodPhrase(rule.Period), item.Current, item.Previous)
+		} else {
+			alert.Message = fmt.Sprintf("%s %s appeared this %s (%d, none the %s before)",
+				rule.Dimension, rule.Key, rule.Period, item.Current, rule.Period)
+		}
+		if err := s.DB.Create(&alert).Error; err != nil {
+			return fired, err
+		}
+		log.Printf("Trend alert for rule %s: %s", rule.Name, alert.Message)
+		fired = append(fired, alert)
+	}
+	return fired, nil
+}
+
+func trendPeriodPhrase(period models.TrendPeriod) string {
+	if period == models.TrendPeriodMonth {
+		return "month over month"
+	}
+	return "week over week"
+}
+
+var trendEvalMinutes = config.NewInt("TREND_EVAL_MINUTES", 60, "Minutes between evaluations of the trend rules", config.Min(1))
+
+// Start evaluates the trend rules in the background every TREND_EVAL_MINUTES (default 60)
+func (s *TrendService) Start() {
+	interval := time.Duration(trendEvalMinutes.Get()) * time.Minute
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := s.EvaluateRules(); err != nil {
+				log.Printf("Error evaluating trend rules: %v", err)
+			}
+		}
+	}()
+
+	log.Printf("Trend rule evaluation started every %s", interval)
+}
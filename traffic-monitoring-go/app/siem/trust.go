@@ -0,0 +1,323 @@
+package siem
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// Trust score penalties, in points off 100
+const (
+	trustPenaltyAnomaly           = 10 // per anomaly of a type without its own penalty
+	trustPenaltyMisbehaviorReport = 20 // per misbehavior report
+)
+
+// trustPenalties are the penalties of anomaly types weighing more or less
+// than trustPenaltyAnomaly. A revoked signing certificate weighs the most:
+// it is the only signature check whose outcome reaches the SIEM.
+var trustPenalties = map[string]float64{
+	AnomalyRevokedCertificate:      40,
+	AnomalyCrossRadioInconsistency: 15,
+}
+
+// Trust is how far one or more V2X source IDs are trusted: 100 less penalties
+// for the anomalies detected in their messages, their inconsistent DSRC/C-V2X
+// links and the misbehavior reports on them since a time, down to 0
+type Trust struct {
+	Score              float64        `json:"score"`
+	Since              time.Time      `json:"since"`
+	Anomalies          map[string]int `json:"anomalies"` // by anomaly type
+	InconsistentLinks  int            `json:"inconsistent_links"`
+	MisbehaviorReports int            `json:"misbehavior_reports"`
+
+	links map[uint]bool // counted once when both source IDs of a link are tallied together
+}
+
+func newTrust(since time.Time) *Trust {
+	return &Trust{Score: 100, Since: since, Anomalies: map[string]int{}, links: map[uint]bool{}}
+}
+
+// add counts what is held against another source ID in t
+func (t *Trust) add(other *Trust) {
+	for anomalyType, count := range other.Anomalies {
+		t.Anomalies[anomalyType] += count
+	}
+	for id := range other.links {
+		t.links[id] = true
+	}
+	t.InconsistentLinks = len(t.links)
+	t.MisbehaviorReports += other.MisbehaviorReports
+	t.score()
+}
+
+// score applies the penalties
+func (t *Trust) score() {
+	t.Score = 100
+	for anomalyType, count := range t.Anomalies {
+		penalty, ok := trustPenalties[anomalyType]
+		if !ok {
+			penalty = trustPenaltyAnomaly
+		}
+		t.Score -= penalty * float64(count)
+	}
+	t.Score -= trustPenalties[AnomalyCrossRadioInconsistency] * float64(t.InconsistentLinks)
+	t.Score -= trustPenaltyMisbehaviorReport * float64(t.MisbehaviorReports)
+	if t.Score < 0 {
+		t.Score = 0
+	}
+}
+
+// detailColumn is the SQL expression of a string field of an event's details,
+// NULL for events whose raw data is not a JSON object
+func detailColumn(key string) string {
+	return `(CASE WHEN raw_data ~ '^\s*\{' THEN raw_data::jsonb->'details'->>'` + key + `' END)`
+}
+
+// TrustScorer keeps a rolling trust score for each V2X source ID something
+// is held against, for ingestion to stamp on the source's events
+type TrustScorer struct {
+	DB       *gorm.DB
+	Clock    clock.Clock
+	Window   time.Duration // anomalies, links and reports counted
+	Interval time.Duration // between score updates
+}
+
+var (
+	trustWindowHours   = config.NewInt("TRUST_WINDOW_HOURS", 24, "Hours of anomalies, links and reports trust scores are computed over", config.Min(1))
+	trustUpdateMinutes = config.NewInt("TRUST_UPDATE_MINUTES", 5, "Minutes between trust score updates", config.Min(1))
+)
+
+// NewTrustScorer creates a trust scorer configured from TRUST_WINDOW_HOURS
+// (default 24) and TRUST_UPDATE_MINUTES (default 5)
+func NewTrustScorer(db *gorm.DB) *TrustScorer {
+	return &TrustScorer{
+		DB:       db,
+		Clock:    clock.Default(),
+		Window:   time.Duration(trustWindowHours.Get()) * time.Hour,
+		Interval: time.Duration(trustUpdateMinutes.Get()) * time.Minute,
+	}
+}
+
+// Since is the start of the window scores are computed over
+func (s *TrustScorer) Since() time.Time {
+	return s.Clock.Now().Add(-s.Window)
+}
+
+// Tally computes the trust of each source ID among sourceIDs that something
+// is held against since a time, or of every such source when sourceIDs is nil
+func (s *TrustScorer) Tally(since time.Time, sourceIDs []string) (map[string]*Trust, error) {
+	trusts := make(map[string]*Trust)
+	trust := func(sourceID string) *Trust {
+		t, ok := trusts[sourceID]
+		if !ok {
+			t = newTrust(since)
+			trusts[sourceID] = t
+		}
+		return t
+	}
+	if sourceIDs != nil && len(sourceIDs) == 0 {
+		return trusts, nil // IN () is not valid SQL
+	}
+
+	var anomalies []struct {
+		SourceID    string
+		AnomalyType string
+		Count       int
+	}
+	query := s.DB.Model(&models.SecurityEvent{}).
+		Select(detailColumn("vehicle_id")+" AS source_id, "+detailColumn("anomaly_type")+" AS anomaly_type, COUNT(*) AS count").
+		Where("category = ? AND timestamp >= ? AND raw_data LIKE ?", models.CategoryV2X, since, `%"anomaly_type"%`)
+	if sourceIDs != nil {
+		query = query.Where(detailColumn("vehicle_id")+" IN ?", sourceIDs)
+	}
+	if err := query.Group("1, 2").Scan(&anomalies).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range anomalies {
+		if row.SourceID != "" && row.AnomalyType != "" {
+			trust(row.SourceID).Anomalies[row.AnomalyType] += row.Count
+		}
+	}
+
+	var links []models.VehicleLink
+	query = s.DB.Where("inconsistent = ? AND last_inconsistent_at >= ?", true, since)
+	if sourceIDs != nil {
+		query = query.Where("dsrc_id IN ? OR cv2x_id IN ?", sourceIDs, sourceIDs)
+	}
+	if err := query.Find(&links).Error; err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool, len(sourceIDs))
+	for _, id := range sourceIDs {
+		wanted[id] = true
+	}
+	for _, link := range links {
+		for _, id := range []string{link.DSRCID, link.CV2XID} {
+			if sourceIDs == nil || wanted[id] {
+				t := trust(id)
+				t.links[link.ID] = true
+				t.InconsistentLinks = len(t.links)
+			}
+		}
+	}
+
+	var reports []struct {
+		SourceID string
+		Count    int
+	}
+	query = s.DB.Model(&models.MisbehaviorReport{}).
+		Select("source_id, COUNT(*) AS count").
+		Where("window_end >= ?", since)
+	if sourceIDs != nil {
+		query = query.Where("source_id IN ?", sourceIDs)
+	}
+	if err := query.Group("source_id").Scan(&reports).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range reports {
+		trust(row.SourceID).MisbehaviorReports += row.Count
+	}
+
+	for _, t := range trusts {
+		t.score()
+	}
+	return trusts, nil
+}
+
+// Trust computes the combined trust of source IDs over the window, such as
+// the temporary IDs of one vehicle
+func (s *TrustScorer) Trust(sourceIDs ...string) (*Trust, error) {
+	since := s.Since()
+	combined := newTrust(since)
+	if len(sourceIDs) == 0 {
+		return combined, nil
+	}
+	trusts, err := s.Tally(since, sourceIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range sourceIDs {
+		if t, ok := trusts[id]; ok {
+			combined.add(t)
+		}
+	}
+	return combined, nil
+}
+
+// Update recomputes the stored score of every source something is held
+// against over the window, and forgets the sources back at 100
+func (s *TrustScorer) Update() (int, error) {
+	since := s.Since()
+	trusts, err := s.Tally(since, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		for sourceID, t := range trusts {
+			row := models.SourceTrust{
+				SourceID:           sourceID,
+				Score:              t.Score,
+				Anomalies:          t.Anomalies,
+				InconsistentLinks:  t.InconsistentLinks,
+				MisbehaviorReports: t.MisbehaviorReports,
+				WindowStart:        since,
+			}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "source_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"score", "anomalies", "inconsistent_links", "misbehavior_reports", "window_start", "updated_at"}),
+			}).Create(&row).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Where("window_start < ?", since).Delete(&models.SourceTrust{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	defaultSourceTrust.invalidate()
+	return len(trusts), nil
+}
+
+// Start updates the scores in the background
+func (s *TrustScorer) Start() {
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := s.Update(); err != nil {
+				log.Printf("Error updating source trust scores: %v", err)
+			}
+		}
+	}()
+
+	log.Printf("Trust scorer started: scores over %s, updated every %s", s.Window, s.Interval)
+}
+
+// sourceTrustCacheTTL bounds how long a score updated on another instance takes to apply here
+const sourceTrustCacheTTL = 10 * time.Second
+
+// sourceTrustCache keeps the stored scores in memory so stamping an event costs no query
+type sourceTrustCache struct {
+	mutex    sync.RWMutex
+	loaded   bool
+	loadedAt time.Time
+	scores   map[string]float64
+}
+
+var defaultSourceTrust = &sourceTrustCache{}
+
+func (c *sourceTrustCache) invalidate() {
+	c.mutex.Lock()
+	c.loaded = false
+	c.mutex.Unlock()
+}
+
+func (c *sourceTrustCache) get(db *gorm.DB) (map[string]float64, error) {
+	c.mutex.RLock()
+	if c.loaded && time.Since(c.loadedAt) <= sourceTrustCacheTTL {
+		scores := c.scores
+		c.mutex.RUnlock()
+		return scores, nil
+	}
+	c.mutex.RUnlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded || time.Since(c.loadedAt) > sourceTrustCacheTTL {
+		var stored []models.SourceTrust
+		if err := db.Select("source_id", "score").Find(&stored).Error; err != nil {
+			return nil, err
+		}
+		scores := make(map[string]float64, len(stored))
+		for _, row := range stored {
+			scores[row.SourceID] = row.Score
+		}
+		c.scores = scores
+		c.loaded = true
+		c.loadedAt = time.Now()
+	}
+	return c.scores, nil
+}
+
+// SourceTrustScore returns the last computed trust score of a V2X source ID,
+// 100 when nothing is held against it
+func SourceTrustScore(db *gorm.DB, sourceID string) (float64, error) {
+	scores, err := defaultSourceTrust.get(db)
+	if err != nil {
+		return 0, err
+	}
+	if score, ok := scores[sourceID]; ok {
+		return score, nil
+	}
+	return 100, nil
+}
@@ -0,0 +1,161 @@
+package siem
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"traffic-monitoring-go/app/eventschema"
+	"traffic-monitoring-go/app/models"
+)
+
+// V2XObservation is the V2X view of a security event: who sent which message,
+// where and when, and when it reached the SIEM. V2X messages arrive as events
+// of category v2x (or vehicle) with these fields in their details.
+type V2XObservation struct {
+	EventID     uint
+	VehicleID   string
+	MessageType string
+	Radio       models.RadioProtocol // empty when the access technology is not reported
+	Receiver    string               // RSU or log source that received the message
+	SourceIP    string               // address the message came from, when the receiver reports it
+	RSSI        float64              // received signal strength at the receiver in dBm
+	HasRSSI     bool
+	Generated   time.Time
+	Received    time.Time
+	Latitude    float64
+	Longitude   float64
+	HasLocation bool
+	Speed       float64
+	HasSpeed    bool
+	Heading     float64 // degrees clockwise from north
+	HasHeading  bool
+	Certificate string   // normalized hashed ID of the signing certificate, when the message names it
+	Geofences   []string // names of the enabled geofences containing the location, set by anomaly detection
+	InODD       bool     // inside a geofence of the operational design domain
+	HasODD      bool     // some enabled geofence belongs to the operational design domain
+
+	IntersectionID int    // J2735 IntersectionID of SPaT, MAP, SRM and SSM messages
+	RequestID      int    // SRM only
+	RequestType    string // SRM only
+	RequesterRole  string // SRM only
+}
+
+// ParseV2XObservation extracts the V2X fields from an event. receiver names the
+// RSU or log source when the event does not carry an explicit rsu_id.
+func ParseV2XObservation(event *models.SecurityEvent, receiver string) (V2XObservation, bool) {
+	var raw struct {
+		Details map[string]interface{} `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(event.RawData), &raw); err != nil || raw.Details == nil {
+		return V2XObservation{}, false
+	}
+
+	obs := V2XObservation{
+		EventID:   event.ID,
+		Receiver:  receiver,
+		SourceIP:  event.SourceIP,
+		Generated: event.Timestamp,
+		Received:  event.CreatedAt,
+	}
+
+	obs.VehicleID, _ = raw.Details["vehicle_id"].(string)
+	if obs.VehicleID == "" {
+		obs.VehicleID = event.DeviceID
+	}
+	if obs.VehicleID == "" {
+		return V2XObservation{}, false
+	}
+
+	obs.MessageType, _ = raw.Details["message_type"].(string)
+	if radio, ok := raw.Details["radio"].(string); ok {
+		obs.Radio = NormalizeRadio(radio)
+	} else {
+		obs.Radio = NormalizeRadio(event.Protocol)
+	}
+	if rsu, ok := raw.Details["rsu_id"].(string); ok && rsu != "" {
+		obs.Receiver = rsu
+	}
+
+	if location, ok := raw.Details["location"].(string); ok {
+		obs.Latitude, obs.Longitude, obs.HasLocation = ParseLocation(location)
+	}
+
+	obs.Speed, obs.HasSpeed = detailFloat(raw.Details["speed"])
+	obs.Heading, obs.HasHeading = detailFloat(raw.Details["heading"])
+	obs.RSSI, obs.HasRSSI = detailFloat(raw.Details["rssi"])
+	if id, ok := detailFloat(raw.Details["intersection_id"]); ok {
+		obs.IntersectionID = int(id)
+	}
+	if id, ok := detailFloat(raw.Details["request_id"]); ok {
+		obs.RequestID = int(id)
+	}
+	obs.RequestType, _ = raw.Details["request_type"].(string)
+	obs.RequesterRole, _ = raw.Details["requester_role"].(string)
+	for _, field := range certificateFields {
+		if value, ok := raw.Details[field].(string); ok {
+			if id, ok := NormalizeCertificateID(value); ok {
+				obs.Certificate = id
+				break
+			}
+		}
+	}
+
+	return obs, true
+}
+
+// detailFloat reads a number sent as a JSON number or string
+func detailFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+			return parsed, true
+		}
+	}
+	return 0, false
+}
+
+// NormalizeRadio maps the names senders use for V2X access technologies to a
+// RadioProtocol, or "" when the value is not a V2X radio
+func NormalizeRadio(value string) models.RadioProtocol {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "dsrc", "802.11p", "wave", "its-g5":
+		return models.RadioDSRC
+	case "cv2x", "c-v2x", "pc5", "lte-v2x", "nr-v2x":
+		return models.RadioCV2X
+	}
+	return ""
+}
+
+// ParseLocation parses a "lat,lon" pair
+func ParseLocation(location string) (float64, float64, bool) {
+	return eventschema.ParseLocation(location)
+}
+
+// LocalOffsetMeters projects a coordinate onto a plane tangent at an origin,
+// returning its east and north offsets; accurate over the few hundred meters
+// a vehicle covers between reports
+func LocalOffsetMeters(originLat, originLon, lat, lon float64) (float64, float64) {
+	const earthRadius = 6371000.0
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	east := toRad(lon-originLon) * math.Cos(toRad(originLat)) * earthRadius
+	north := toRad(lat-originLat) * earthRadius
+	return east, north
+}
+
+// DistanceMeters returns the great-circle distance between two coordinates
+func DistanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371000.0
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
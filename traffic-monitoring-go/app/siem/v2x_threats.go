@@ -0,0 +1,277 @@
+package siem
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/models"
+)
+
+// detectedAnomalyTypes are the anomaly types the SIEM itself detects: those
+// outside the detector plugins and those of the enabled plugins. A threat
+// listing one of them is covered even without a rule tagged with it.
+func detectedAnomalyTypes(db *gorm.DB) (map[string]bool, error) {
+	detected := map[string]bool{AnomalyRevokedCertificate: true, AnomalyCrossRadioInconsistency: true}
+
+	settings, err := GetAnomalyDetectorSettings(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range settings {
+		if s.Enabled {
+			detected[s.Detector] = true
+		}
+	}
+	return detected, nil
+}
+
+// ErrUnknownThreat is returned by NormalizeThreats for codes missing from the taxonomy
+var ErrUnknownThreat = errors.New("unknown V2X threat")
+
+// NormalizeThreats uppercases and deduplicates V2X threat codes, rejecting
+// codes that are not in the taxonomy
+func NormalizeThreats(db *gorm.DB, codes []string) ([]string, error) {
+	normalized := make([]string, 0, len(codes))
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !seen[code] {
+			seen[code] = true
+			normalized = append(normalized, code)
+		}
+	}
+	if len(normalized) == 0 {
+		return normalized, nil
+	}
+
+	var known []string
+	if err := db.Model(&models.V2XThreat{}).Where("code IN ?", normalized).Pluck("code", &known).Error; err != nil {
+		return nil, err
+	}
+	if len(known) < len(normalized) {
+		found := make(map[string]bool, len(known))
+		for _, code := range known {
+			found[code] = true
+		}
+		for _, code := range normalized {
+			if !found[code] {
+				return nil, fmt.Errorf("%w %q", ErrUnknownThreat, code)
+			}
+		}
+	}
+	return normalized, nil
+}
+
+// FilterByThreat restricts query to rows of table tagged with a V2X threat code
+func FilterByThreat(query *gorm.DB, table, code string) *gorm.DB {
+	return query.Where(
+		fmt.Sprintf("EXISTS (SELECT 1 FROM %s AS threat(code) WHERE threat.code = ?)", jsonbArrayElements(table+".v2x_threats")),
+		strings.ToUpper(strings.TrimSpace(code)),
+	)
+}
+
+// ThreatCoverage is the detection coverage of one V2X threat
+type ThreatCoverage struct {
+	models.V2XThreat
+	Status       string     `json:"status"` // fired, covered, disabled or uncovered
+	Rules        []string   `json:"rules"`
+	EnabledRules int        `json:"enabled_rules"`
+	Detectors    []string   `json:"detectors"` // anomaly types of the threat the SIEM detects
+	Alerts       int64      `json:"alerts"`    // in the coverage window
+	Anomalies    int64      `json:"anomalies"` // in the coverage window
+	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// V2XThreatCoverage maps the rules, anomalies and recent alerts onto the V2X threat taxonomy
+type V2XThreatCoverage struct {
+	Since   time.Time        `json:"since"`
+	Threats []ThreatCoverage `json:"threats"`
+	Covered int              `json:"covered"`
+	Fired   int              `json:"fired"`
+}
+
+// ComputeThreatCoverage reports which V2X threats have rules or detected
+// anomaly types, and which had alerts or anomalies since the given time
+func ComputeThreatCoverage(db *gorm.DB, since time.Time) (*V2XThreatCoverage, error) {
+	readDB := database.ReadDB(db)
+
+	var threats []models.V2XThreat
+	if err := readDB.Order("code ASC").Find(&threats).Error; err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]*ThreatCoverage, len(threats))
+	entries := make([]*ThreatCoverage, 0, len(threats))
+	detected, err := detectedAnomalyTypes(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, threat := range threats {
+		e := &ThreatCoverage{V2XThreat: threat, Rules: []string{}, Detectors: []string{}}
+		for _, anomalyType := range threat.AnomalyTypes {
+			if detected[anomalyType] {
+				e.Detectors = append(e.Detectors, anomalyType)
+			}
+		}
+		byCode[threat.Code] = e
+		entries = append(entries, e)
+	}
+
+	seen := func(e *ThreatCoverage, at time.Time) {
+		if e.LastSeenAt == nil || at.After(*e.LastSeenAt) {
+			e.LastSeenAt = &at
+		}
+	}
+
+	var rules []models.Rule
+	if err := readDB.Select("id", "name", "status", "v2x_threats").Order("name ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		for _, code := range rule.V2XThreats {
+			if e, ok := byCode[code]; ok {
+				e.Rules = append(e.Rules, rule.Name)
+				if rule.Status == models.RuleStatusEnabled {
+					e.EnabledRules++
+				}
+			}
+		}
+	}
+
+	var alertRows []struct {
+		Code      string
+		Alerts    int64
+		LastAlert time.Time
+	}
+	err = readDB.Table("alerts").
+		Select("threat.code AS code, COUNT(*) AS alerts, MAX(alerts.timestamp) AS last_alert").
+		Joins("CROSS JOIN LATERAL "+jsonbArrayElements("alerts.v2x_threats")+" AS threat(code)").
+		Where("alerts.timestamp >= ?", since).
+		Group("threat.code").
+		Scan(&alertRows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range alertRows {
+		if e, ok := byCode[row.Code]; ok {
+			e.Alerts += row.Alerts
+			seen(e, row.LastAlert)
+		}
+	}
+
+	anomalies, err := countAnomalies(readDB, since)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		for _, anomalyType := range e.AnomalyTypes {
+			if count, ok := anomalies[anomalyType]; ok {
+				e.Anomalies += count.anomalies
+				seen(e, count.lastSeen)
+			}
+		}
+	}
+
+	coverage := &V2XThreatCoverage{Since: since, Threats: make([]ThreatCoverage, 0, len(entries))}
+	for _, e := range entries {
+		switch {
+		case e.Alerts > 0 || e.Anomalies > 0:
+			e.Status = "fired"
+		case e.EnabledRules > 0 || len(e.Detectors) > 0:
+			e.Status = "covered"
+		case len(e.Rules) > 0:
+			e.Status = "disabled"
+		default:
+			e.Status = "uncovered"
+		}
+		if e.Status == "fired" {
+			coverage.Fired++
+		}
+		if e.EnabledRules > 0 || len(e.Detectors) > 0 {
+			coverage.Covered++
+		}
+		coverage.Threats = append(coverage.Threats, *e)
+	}
+	return coverage, nil
+}
+
+// anomalyCount is the number of anomalies of one type and when the last was seen
+type anomalyCount struct {
+	anomalies int64
+	lastSeen  time.Time
+}
+
+// countAnomalies counts the V2X anomalies detected since the given time by type
+func countAnomalies(db *gorm.DB, since time.Time) (map[string]anomalyCount, error) {
+	var rows []struct {
+		AnomalyType string
+		Anomalies   int64
+		LastSeen    time.Time
+	}
+	err := db.Table("security_events").
+		Select(`substring(raw_data from '"anomaly_type"\s*:\s*"([^"]+)"') AS anomaly_type, COUNT(*) AS anomalies, MAX(timestamp) AS last_seen`).
+		Where("category = ? AND timestamp >= ? AND raw_data LIKE ?", models.CategoryV2X, since, `%"anomaly_type"%`).
+		Group("1").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]anomalyCount, len(rows)+1)
+	for _, row := range rows {
+		if row.AnomalyType != "" {
+			counts[row.AnomalyType] = anomalyCount{anomalies: row.Anomalies, lastSeen: row.LastSeen}
+		}
+	}
+
+	var links []models.VehicleLink
+	err = db.Select("last_inconsistent_at").
+		Where("inconsistent = ? AND last_inconsistent_at >= ?", true, since).
+		Find(&links).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(links) > 0 {
+		count := anomalyCount{anomalies: int64(len(links))}
+		for _, link := range links {
+			if link.LastInconsistentAt.After(count.lastSeen) {
+				count.lastSeen = *link.LastInconsistentAt
+			}
+		}
+		counts[AnomalyCrossRadioInconsistency] = count
+	}
+	return counts, nil
+}
+
+// sortedAnomalyTypes trims, deduplicates and sorts anomaly type names
+func sortedAnomalyTypes(types []string) []string {
+	normalized := make([]string, 0, len(types))
+	seen := make(map[string]bool)
+	for _, anomalyType := range types {
+		anomalyType = strings.ToLower(strings.TrimSpace(anomalyType))
+		if anomalyType != "" && !seen[anomalyType] {
+			seen[anomalyType] = true
+			normalized = append(normalized, anomalyType)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// NormalizeThreat validates a taxonomy entry before it is stored
+func NormalizeThreat(threat *models.V2XThreat) error {
+	threat.Code = strings.ToUpper(strings.TrimSpace(threat.Code))
+	threat.Name = strings.TrimSpace(threat.Name)
+	if threat.Code == "" || strings.ContainsAny(threat.Code, " ,") {
+		return fmt.Errorf("threat code is required and may not contain spaces or commas")
+	}
+	if threat.Name == "" {
+		return fmt.Errorf("threat name is required")
+	}
+	threat.AnomalyTypes = sortedAnomalyTypes(threat.AnomalyTypes)
+	return nil
+}
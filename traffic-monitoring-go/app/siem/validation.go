@@ -0,0 +1,148 @@
+package siem
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+)
+
+// conditionFields are the event fields a rule condition may test directly;
+// raw_data.<path> tests a field of the event's raw JSON, and details.<path>
+// is short for raw_data.details.<path>
+var conditionFields = map[string]bool{
+	"severity": true, "category": true, "source_ip": true, "destination_ip": true,
+	"protocol": true, "action": true, "status": true, "message": true,
+	"source_port": true, "destination_port": true, "device_id": true,
+	"trust_score": true,
+}
+
+// conditionOperators are the comparisons the rule engine understands
+var conditionOperators = map[string]bool{
+	"=": true, "==": true, "is": true, "!=": true, "<>": true, "is not": true,
+	"contains": true, "not contains": true, "startswith": true, "endswith": true, "matches": true,
+	">": true, ">=": true, "<": true, "<=": true,
+}
+
+// ValidateRule normalizes a rule's technique and threat tags and checks the
+// rule, including its condition, the way the rule engine will read it.
+// Every problem found is reported in a *models.ValidationError; other errors
+// come from the database.
+func ValidateRule(db *gorm.DB, rule *models.Rule) error {
+	errs := rule.Validate()
+
+	for _, problem := range conditionProblems(db, rule.Condition) {
+		errs.Add("condition", "%s", problem)
+	}
+
+	if techniques, err := NormalizeTechniques(rule.Techniques); err != nil {
+		errs.Add("techniques", "%s", err.Error())
+	} else {
+		rule.Techniques = techniques
+	}
+
+	threats, err := NormalizeThreats(db, rule.V2XThreats)
+	switch {
+	case errors.Is(err, ErrUnknownThreat):
+		errs.Add("v2x_threats", "%s", err.Error())
+	case err != nil:
+		return err
+	default:
+		rule.V2XThreats = threats
+	}
+
+	return errs.Err()
+}
+
+// conditionProblems lists what the rule engine would fail on, or silently
+// misread, when evaluating condition: the syntax error, if any, or the
+// problems of each clause
+func conditionProblems(db *gorm.DB, condition string) []string {
+	if strings.TrimSpace(condition) == "" {
+		return nil
+	}
+
+	node, err := parseCondition(condition)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	forEachClause(node, func(clause conditionNode) {
+		if problem := clauseProblem(db, clause); problem != "" {
+			problems = append(problems, problem)
+		}
+	})
+	return problems
+}
+
+// clauseProblem checks the fields and values of a parsed clause
+func clauseProblem(db *gorm.DB, clause conditionNode) string {
+	switch c := clause.(type) {
+	case *locationClause:
+		if _, byName, err := defaultGeofenceCache.get(db); err == nil && byName[c.geofence] == nil {
+			return fmt.Sprintf("%q: unknown or disabled geofence %q", c.text, c.geofence)
+		}
+	case *comparisonClause:
+		if problem := fieldProblem(c.text, c.field); problem != "" {
+			return problem
+		}
+		if c.operator == "matches" {
+			if _, err := regexp.Compile(c.value); err != nil {
+				return fmt.Sprintf("%q: invalid regular expression: %v", c.text, err)
+			}
+		}
+		// enum fields compared for equality must name a value they can take
+		if c.operator == "=" || c.operator == "==" || c.operator == "!=" || c.operator == "<>" {
+			return enumProblem(c.text, c.field, c.value)
+		}
+	case *inClause:
+		if problem := fieldProblem(c.text, c.field); problem != "" {
+			return problem
+		}
+		for _, value := range c.values {
+			if problem := enumProblem(c.text, c.field, value); problem != "" {
+				return problem
+			}
+		}
+	case *betweenClause:
+		if problem := fieldProblem(c.text, c.field); problem != "" {
+			return problem
+		}
+		if !strings.Contains(c.field, ".") && c.field != "source_port" && c.field != "destination_port" && c.field != "trust_score" {
+			return fmt.Sprintf("%q: %s is not numeric", c.text, c.field)
+		}
+	case *existsClause:
+		return fieldProblem(c.text, c.field)
+	}
+	return ""
+}
+
+// fieldProblem checks that a clause names a field the rule engine knows
+func fieldProblem(clause, field string) string {
+	if strings.Contains(field, ".") {
+		if !strings.HasPrefix(field, "raw_data.") && !strings.HasPrefix(field, "details.") || strings.HasSuffix(field, ".") {
+			return fmt.Sprintf("%q: nested fields must start with raw_data. or details.", clause)
+		}
+	} else if !conditionFields[field] {
+		return fmt.Sprintf("%q: unknown field %q", clause, field)
+	}
+	return ""
+}
+
+// enumProblem checks that a value compared with an enum field is one it can take
+func enumProblem(clause, field, value string) string {
+	switch field {
+	case "severity":
+		if !models.ValidSeverity(models.EventSeverity(value)) {
+			return fmt.Sprintf("%q: unknown severity %q", clause, value)
+		}
+	case "category":
+		if !models.ValidCategory(models.EventCategory(value)) {
+			return fmt.Sprintf("%q: unknown category %q", clause, value)
+		}
+	}
+	return ""
+}
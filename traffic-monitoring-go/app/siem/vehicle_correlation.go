@@ -0,0 +1,317 @@
+package siem
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// VehicleCorrelator links DSRC and C-V2X source IDs transmitted by the same
+// physical vehicle. Two IDs are linked when their reports, paired by generation
+// time, put them at the same place throughout the window; linked IDs whose
+// paired reports then disagree on position or speed are flagged.
+type VehicleCorrelator struct {
+	DB    *gorm.DB
+	Clock clock.Clock
+
+	Window               time.Duration // observations correlated per run
+	MatchTolerance       time.Duration // max generation time difference of paired reports
+	MinMatches           int           // paired reports needed to link two IDs
+	MaxDistance          float64       // median distance (m) of paired reports for a link
+	InconsistentDistance float64       // distance (m) at which a paired report is inconsistent
+	SpeedTolerance       float64       // speed difference at which a paired report is inconsistent
+}
+
+var (
+	correlationWindowMinutes = config.NewInt("VEHICLE_CORRELATION_WINDOW_MINUTES", 5, "Minutes of reports each vehicle correlation run pairs", config.Min(1))
+	correlationMaxDistance   = config.NewFloat("VEHICLE_CORRELATION_MAX_DISTANCE_M", 15,
+		"Meters within which DSRC and C-V2X reports count as the same vehicle", config.Positive)
+)
+
+// NewVehicleCorrelator creates a correlator configured from
+// VEHICLE_CORRELATION_WINDOW_MINUTES (default 5) and VEHICLE_CORRELATION_MAX_DISTANCE_M (default 15)
+func NewVehicleCorrelator(db *gorm.DB) *VehicleCorrelator {
+	return &VehicleCorrelator{
+		DB:                   db,
+		Clock:                clock.Default(),
+		Window:               time.Duration(correlationWindowMinutes.Get()) * time.Minute,
+		MatchTolerance:       time.Second,
+		MinMatches:           3,
+		MaxDistance:          correlationMaxDistance.Get(),
+		InconsistentDistance: 50,
+		SpeedTolerance:       10,
+	}
+}
+
+// trackKey identifies the reports of one source ID on one radio
+type trackKey struct {
+	radio     models.RadioProtocol
+	vehicleID string
+}
+
+// linkCandidate is the comparison of a DSRC track with a C-V2X track
+type linkCandidate struct {
+	dsrcID, cv2xID   string
+	matches          int
+	medianDistance   float64
+	inconsistent     int
+	reason           string
+	first, last      time.Time
+	lastInconsistent time.Time
+}
+
+// RecentObservations returns the V2X observations generated in [start, end), oldest first
+func (c *VehicleCorrelator) RecentObservations(start, end time.Time) ([]V2XObservation, error) {
+	var events []models.SecurityEvent
+	err := c.DB.Preload("LogSource").
+		Where("category IN ? AND timestamp >= ? AND timestamp < ?",
+			[]models.EventCategory{models.CategoryV2X, models.CategoryVehicle}, start, end).
+		Order("timestamp ASC").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+
+	observations := make([]V2XObservation, 0, len(events))
+	for i := range events {
+		if obs, ok := ParseV2XObservation(&events[i], events[i].LogSource.Name); ok {
+			observations = append(observations, obs)
+		}
+	}
+	return observations, nil
+}
+
+// Correlate compares the DSRC and C-V2X tracks of [start, end) and records the links found
+func (c *VehicleCorrelator) Correlate(start, end time.Time) ([]models.VehicleLink, error) {
+	observations, err := c.RecentObservations(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := make(map[trackKey][]V2XObservation)
+	for _, obs := range observations {
+		if obs.Radio == "" || !obs.HasLocation {
+			continue
+		}
+		key := trackKey{radio: obs.Radio, vehicleID: obs.VehicleID}
+		tracks[key] = append(tracks[key], obs)
+	}
+
+	var candidates []linkCandidate
+	for dsrcKey, dsrcTrack := range tracks {
+		if dsrcKey.radio != models.RadioDSRC {
+			continue
+		}
+		for cv2xKey, cv2xTrack := range tracks {
+			if cv2xKey.radio != models.RadioCV2X {
+				continue
+			}
+			if candidate, ok := c.compare(dsrcTrack, cv2xTrack); ok {
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+
+	// closely following vehicles can match several IDs; keep the closest pairs one-to-one
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].medianDistance != candidates[j].medianDistance {
+			return candidates[i].medianDistance < candidates[j].medianDistance
+		}
+		return candidates[i].matches > candidates[j].matches
+	})
+	usedDSRC := make(map[string]bool)
+	usedCV2X := make(map[string]bool)
+
+	var links []models.VehicleLink
+	for _, candidate := range candidates {
+		if usedDSRC[candidate.dsrcID] || usedCV2X[candidate.cv2xID] {
+			continue
+		}
+		usedDSRC[candidate.dsrcID] = true
+		usedCV2X[candidate.cv2xID] = true
+
+		link, err := c.recordLink(candidate)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *link)
+	}
+	return links, nil
+}
+
+// compare pairs each DSRC report with the C-V2X report closest in generation time
+func (c *VehicleCorrelator) compare(dsrcTrack, cv2xTrack []V2XObservation) (linkCandidate, bool) {
+	first, last := dsrcTrack[0].Generated, dsrcTrack[len(dsrcTrack)-1].Generated
+	if cv2xTrack[len(cv2xTrack)-1].Generated.Before(first.Add(-c.MatchTolerance)) ||
+		cv2xTrack[0].Generated.After(last.Add(c.MatchTolerance)) {
+		return linkCandidate{}, false
+	}
+
+	candidate := linkCandidate{dsrcID: dsrcTrack[0].VehicleID, cv2xID: cv2xTrack[0].VehicleID}
+	var distances []float64
+	j := 0
+	for _, a := range dsrcTrack {
+		for j+1 < len(cv2xTrack) && absDuration(cv2xTrack[j+1].Generated.Sub(a.Generated)) <= absDuration(cv2xTrack[j].Generated.Sub(a.Generated)) {
+			j++
+		}
+		b := cv2xTrack[j]
+		if absDuration(b.Generated.Sub(a.Generated)) > c.MatchTolerance {
+			continue
+		}
+
+		distance := DistanceMeters(a.Latitude, a.Longitude, b.Latitude, b.Longitude)
+		distances = append(distances, distance)
+		if candidate.first.IsZero() {
+			candidate.first = a.Generated
+		}
+		candidate.last = a.Generated
+
+		switch {
+		case distance > c.InconsistentDistance:
+			candidate.inconsistent++
+			candidate.lastInconsistent = a.Generated
+			candidate.reason = fmt.Sprintf("positions %.0fm apart at %s", distance, a.Generated.UTC().Format(time.RFC3339))
+		case a.HasSpeed && b.HasSpeed && math.Abs(a.Speed-b.Speed) > c.SpeedTolerance:
+			candidate.inconsistent++
+			candidate.lastInconsistent = a.Generated
+			candidate.reason = fmt.Sprintf("speeds %.1f and %.1f at %s", a.Speed, b.Speed, a.Generated.UTC().Format(time.RFC3339))
+		}
+	}
+
+	if len(distances) < c.MinMatches {
+		return linkCandidate{}, false
+	}
+	sort.Float64s(distances)
+	candidate.matches = len(distances)
+	candidate.medianDistance = distances[len(distances)/2]
+	return candidate, candidate.medianDistance <= c.MaxDistance
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// recordLink creates or extends the stored link of a candidate pair
+func (c *VehicleCorrelator) recordLink(candidate linkCandidate) (*models.VehicleLink, error) {
+	var link models.VehicleLink
+	err := c.DB.Where("dsrc_id = ? AND cv2x_id = ?", candidate.dsrcID, candidate.cv2xID).First(&link).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	if err == gorm.ErrRecordNotFound {
+		link = models.VehicleLink{DSRCID: candidate.dsrcID, CV2XID: candidate.cv2xID, FirstSeen: candidate.first}
+	}
+
+	link.MatchedSamples += candidate.matches
+	link.MedianDistanceM = candidate.medianDistance
+	if candidate.last.After(link.LastSeen) {
+		link.LastSeen = candidate.last
+	}
+	if candidate.inconsistent > 0 {
+		link.InconsistentSamples += candidate.inconsistent
+		link.Inconsistent = true
+		link.InconsistencyReason = candidate.reason
+		lastInconsistent := candidate.lastInconsistent
+		link.LastInconsistentAt = &lastInconsistent
+	}
+
+	if err := c.DB.Save(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// LinkedIDs returns the source IDs linked to vehicleID, including vehicleID itself
+func (c *VehicleCorrelator) LinkedIDs(vehicleID string) ([]string, []models.VehicleLink, error) {
+	var links []models.VehicleLink
+	err := c.DB.Where("dsrc_id = ? OR cv2x_id = ?", vehicleID, vehicleID).
+		Order("last_seen DESC").
+		Find(&links).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := []string{vehicleID}
+	seen := map[string]bool{vehicleID: true}
+	for _, link := range links {
+		for _, id := range []string{link.DSRCID, link.CV2XID} {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, links, nil
+}
+
+// Track returns the observations of the given source IDs generated in
+// [start, end), oldest first, at most limit of them. The IDs are matched in
+// SQL against the device ID and the raw payload, then checked on the parsed
+// observation.
+func (c *VehicleCorrelator) Track(ids []string, start, end time.Time, limit int) ([]V2XObservation, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	conditions := []string{"device_id IN ?"}
+	args := []interface{}{ids}
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		conditions = append(conditions, "raw_data LIKE ?")
+		args = append(args, `%"`+escapeLike(id)+`"%`)
+		wanted[id] = true
+	}
+
+	var events []models.SecurityEvent
+	err := c.DB.Preload("LogSource").
+		Where("category IN ? AND timestamp >= ? AND timestamp < ?",
+			[]models.EventCategory{models.CategoryV2X, models.CategoryVehicle}, start, end).
+		Where(strings.Join(conditions, " OR "), args...).
+		Order("timestamp ASC, id ASC").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+
+	observations := make([]V2XObservation, 0, len(events))
+	for i := range events {
+		if obs, ok := ParseV2XObservation(&events[i], events[i].LogSource.Name); ok && wanted[obs.VehicleID] {
+			observations = append(observations, obs)
+		}
+	}
+	return observations, nil
+}
+
+// Start correlates each completed window in the background
+func (c *VehicleCorrelator) Start() {
+	go func() {
+		ticker := time.NewTicker(c.Window)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			end := c.Clock.Now().Truncate(c.Window)
+			start := end.Add(-c.Window)
+			links, err := c.Correlate(start, end)
+			if err != nil {
+				log.Printf("Error correlating DSRC and C-V2X vehicles for %s: %v", start.Format(time.RFC3339), err)
+				continue
+			}
+			if len(links) > 0 {
+				log.Printf("Correlated %d DSRC/C-V2X vehicle pairs for %s", len(links), start.Format(time.RFC3339))
+			}
+		}
+	}()
+
+	log.Printf("DSRC/C-V2X vehicle correlation started with %s windows", c.Window)
+}
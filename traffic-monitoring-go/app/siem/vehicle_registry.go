@@ -0,0 +1,531 @@
+package siem
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/config"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// rotationSpeed (m/s) bounds how far a vehicle can move while it switches temporary IDs
+const rotationSpeed = 50
+
+// VehicleRegistry resolves the temporary IDs V2X senders rotate for privacy,
+// and the pseudonym certificates they sign with, into persistent pseudonymous
+// vehicles. An identifier joins the vehicle of a certificate or temporary ID
+// it was seen with, of a source ID linked to it on the other radio, or of a
+// temporary ID that went silent shortly before and close to where it
+// appeared; an identifier matching none, or several vehicles, registers a new one.
+type VehicleRegistry struct {
+	DB         *gorm.DB
+	Clock      clock.Clock
+	Correlator *VehicleCorrelator // DSRC/C-V2X links
+	Scorer     *TrustScorer
+
+	Window      time.Duration // observations resolved per run
+	MaxGap      time.Duration // longest silence between the last message of a rotated ID and the first of the next
+	MaxDistance float64       // meters between them, beyond the distance covered during the gap
+}
+
+var (
+	registryWindowMinutes = config.NewInt("VEHICLE_REGISTRY_WINDOW_MINUTES", 1, "Minutes of observations each vehicle registry run resolves", config.Min(1))
+	registryMaxGapSeconds = config.NewFloat("VEHICLE_REGISTRY_MAX_GAP_SECONDS", 5,
+		"Longest silence in seconds between the last message of a rotated ID and the first of the next", config.Positive)
+	registryMaxDistance = config.NewFloat("VEHICLE_REGISTRY_MAX_DISTANCE_M", 30,
+		"Meters between a rotated ID and the next, beyond the distance covered during the gap", config.Positive)
+)
+
+// NewVehicleRegistry creates a registry configured from VEHICLE_REGISTRY_WINDOW_MINUTES
+// (default 1), VEHICLE_REGISTRY_MAX_GAP_SECONDS (default 5) and VEHICLE_REGISTRY_MAX_DISTANCE_M
+// (default 30); trust scores follow the TRUST_* settings of NewTrustScorer
+func NewVehicleRegistry(db *gorm.DB) *VehicleRegistry {
+	return &VehicleRegistry{
+		DB:          db,
+		Clock:       clock.Default(),
+		Correlator:  NewVehicleCorrelator(db),
+		Scorer:      NewTrustScorer(db),
+		Window:      time.Duration(registryWindowMinutes.Get()) * time.Minute,
+		MaxGap:      time.Duration(registryMaxGapSeconds.Get() * float64(time.Second)),
+		MaxDistance: registryMaxDistance.Get(),
+	}
+}
+
+// registryTrack is what one temporary ID sent in a window
+type registryTrack struct {
+	tempID       string
+	radio        models.RadioProtocol
+	certificates []string
+	first, last  time.Time
+	firstFix     *V2XObservation // first located observation
+	lastFix      *V2XObservation // last located observation
+}
+
+// registryState is the identifiers and vehicles a resolution run works on
+type registryState struct {
+	identifiers map[models.VehicleIdentifierKind]map[string]*models.VehicleIdentifier
+	vehicles    map[uint]*models.RegisteredVehicle
+	touched     map[uint]bool
+}
+
+func (s *registryState) identifier(kind models.VehicleIdentifierKind, value string) *models.VehicleIdentifier {
+	return s.identifiers[kind][value]
+}
+
+// observations returns the V2X messages generated in [start, end), oldest
+// first, leaving out the findings recorded about them
+func (r *VehicleRegistry) observations(start, end time.Time) ([]V2XObservation, error) {
+	var events []models.SecurityEvent
+	err := r.DB.Preload("LogSource").
+		Where("category IN ? AND timestamp >= ? AND timestamp < ? AND raw_data NOT LIKE ?",
+			[]models.EventCategory{models.CategoryV2X, models.CategoryVehicle}, start, end, `%"anomaly_type"%`).
+		Order("timestamp ASC, id ASC").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+
+	observations := make([]V2XObservation, 0, len(events))
+	for i := range events {
+		if obs, ok := ParseV2XObservation(&events[i], events[i].LogSource.Name); ok {
+			observations = append(observations, obs)
+		}
+	}
+	return observations, nil
+}
+
+// tracks groups observations by temporary ID, in the order the IDs first appeared
+func tracks(observations []V2XObservation) []*registryTrack {
+	var ordered []*registryTrack
+	byID := make(map[string]*registryTrack)
+	for i := range observations {
+		obs := &observations[i]
+		track, ok := byID[obs.VehicleID]
+		if !ok {
+			track = &registryTrack{tempID: obs.VehicleID, first: obs.Generated}
+			byID[obs.VehicleID] = track
+			ordered = append(ordered, track)
+		}
+		if obs.Generated.Before(track.first) {
+			track.first = obs.Generated
+		}
+		if obs.Generated.After(track.last) {
+			track.last = obs.Generated
+		}
+		if obs.Radio != "" {
+			track.radio = obs.Radio
+		}
+		if obs.Certificate != "" && !containsString(track.certificates, obs.Certificate) {
+			track.certificates = append(track.certificates, obs.Certificate)
+		}
+		if obs.HasLocation {
+			if track.firstFix == nil || obs.Generated.Before(track.firstFix.Generated) {
+				track.firstFix = obs
+			}
+			if track.lastFix == nil || !obs.Generated.Before(track.lastFix.Generated) {
+				track.lastFix = obs
+			}
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].first.Before(ordered[j].first) })
+	return ordered
+}
+
+// Resolve attributes the identifiers seen in [start, end) to registered
+// vehicles, registering new ones as needed, and returns the vehicles seen
+// with their trust scores updated. Resolving a window again is harmless.
+func (r *VehicleRegistry) Resolve(start, end time.Time) ([]models.RegisteredVehicle, error) {
+	observations, err := r.observations(start, end)
+	if err != nil {
+		return nil, err
+	}
+	ordered := tracks(observations)
+	if len(ordered) == 0 {
+		return nil, nil
+	}
+
+	var tempIDs, certificates []string
+	for _, track := range ordered {
+		tempIDs = append(tempIDs, track.tempID)
+		certificates = append(certificates, track.certificates...)
+	}
+
+	var touched []uint
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		state, err := r.loadState(tx, start, tempIDs, certificates)
+		if err != nil {
+			return err
+		}
+		for _, track := range ordered {
+			if err := r.resolveTrack(tx, state, track); err != nil {
+				return err
+			}
+		}
+
+		for id := range state.touched {
+			if err := tx.Save(state.vehicles[id]).Error; err != nil {
+				return err
+			}
+			touched = append(touched, id)
+		}
+		for _, byValue := range state.identifiers {
+			for _, identifier := range byValue {
+				if err := tx.Save(identifier).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var vehicles []models.RegisteredVehicle
+	if err := r.DB.Where("id IN ?", touched).Order("id ASC").Find(&vehicles).Error; err != nil {
+		return nil, err
+	}
+	for i := range vehicles {
+		if _, err := r.UpdateTrust(&vehicles[i]); err != nil {
+			return nil, err
+		}
+	}
+	return vehicles, nil
+}
+
+// loadState loads the identifiers seen in the window, the temporary IDs that
+// went silent just before it or within it (which IDs may have rotated from),
+// and their vehicles
+func (r *VehicleRegistry) loadState(tx *gorm.DB, start time.Time, tempIDs, certificates []string) (*registryState, error) {
+	query := tx.Where("kind = ? AND (value IN ? OR last_seen >= ?)", models.IdentifierTemporaryID, tempIDs, start.Add(-r.MaxGap))
+	if len(certificates) > 0 {
+		query = query.Or("kind = ? AND value IN ?", models.IdentifierCertificate, certificates)
+	}
+	var identifiers []models.VehicleIdentifier
+	if err := query.Find(&identifiers).Error; err != nil {
+		return nil, err
+	}
+
+	state := &registryState{
+		identifiers: map[models.VehicleIdentifierKind]map[string]*models.VehicleIdentifier{
+			models.IdentifierTemporaryID: {},
+			models.IdentifierCertificate: {},
+		},
+		vehicles: map[uint]*models.RegisteredVehicle{},
+		touched:  map[uint]bool{},
+	}
+	var vehicleIDs []uint
+	for i := range identifiers {
+		identifier := &identifiers[i]
+		state.identifiers[identifier.Kind][identifier.Value] = identifier
+		vehicleIDs = append(vehicleIDs, identifier.VehicleID)
+	}
+	if len(vehicleIDs) > 0 {
+		var vehicles []models.RegisteredVehicle
+		if err := tx.Where("id IN ?", vehicleIDs).Find(&vehicles).Error; err != nil {
+			return nil, err
+		}
+		for i := range vehicles {
+			state.vehicles[vehicles[i].ID] = &vehicles[i]
+		}
+	}
+	return state, nil
+}
+
+// resolveTrack attributes the temporary ID and certificates of a track to a vehicle
+func (r *VehicleRegistry) resolveTrack(tx *gorm.DB, state *registryState, track *registryTrack) error {
+	var vehicle *models.RegisteredVehicle
+	linkedBy := models.LinkedByFirstSight
+	if identifier := state.identifier(models.IdentifierTemporaryID, track.tempID); identifier != nil {
+		vehicle = state.vehicles[identifier.VehicleID]
+	}
+	if vehicle == nil {
+		for _, certificate := range track.certificates {
+			if identifier := state.identifier(models.IdentifierCertificate, certificate); identifier != nil {
+				vehicle, linkedBy = state.vehicles[identifier.VehicleID], models.LinkedByCertificate
+				break
+			}
+		}
+	}
+	if vehicle == nil {
+		linked, err := r.radioLinked(tx, state, track.tempID)
+		if err != nil {
+			return err
+		}
+		if linked != nil {
+			vehicle, linkedBy = linked, models.LinkedByRadioLink
+		}
+	}
+	if vehicle == nil {
+		if rotated := r.rotatedFrom(state, track); rotated != nil {
+			vehicle, linkedBy = rotated, models.LinkedByRotation
+		}
+	}
+	if vehicle == nil {
+		pseudonym, err := newPseudonym()
+		if err != nil {
+			return err
+		}
+		vehicle = &models.RegisteredVehicle{Pseudonym: pseudonym, FirstSeen: track.first, LastSeen: track.last, TrustScore: 100}
+		if err := tx.Create(vehicle).Error; err != nil {
+			return err
+		}
+		state.vehicles[vehicle.ID] = vehicle
+	}
+
+	// the vehicle spans what it sent under every identifier
+	if track.first.Before(vehicle.FirstSeen) {
+		vehicle.FirstSeen = track.first
+	}
+	if !track.last.Before(vehicle.LastSeen) {
+		vehicle.LastSeen = track.last
+		if track.lastFix != nil {
+			lat, lon := track.lastFix.Latitude, track.lastFix.Longitude
+			vehicle.LastLatitude, vehicle.LastLongitude = &lat, &lon
+		}
+	}
+	state.touched[vehicle.ID] = true
+
+	r.record(state, vehicle, models.IdentifierTemporaryID, track.tempID, linkedBy, track)
+	for _, certificate := range track.certificates {
+		certificateLinkedBy := models.LinkedByTemporaryID
+		if linkedBy == models.LinkedByFirstSight {
+			certificateLinkedBy = models.LinkedByFirstSight
+		}
+		r.record(state, vehicle, models.IdentifierCertificate, certificate, certificateLinkedBy, track)
+	}
+	return nil
+}
+
+// record adds an identifier to a vehicle, or extends the one already known.
+// An identifier registered to another vehicle stays with it.
+func (r *VehicleRegistry) record(state *registryState, vehicle *models.RegisteredVehicle, kind models.VehicleIdentifierKind, value, linkedBy string, track *registryTrack) {
+	identifier := state.identifier(kind, value)
+	if identifier == nil {
+		identifier = &models.VehicleIdentifier{
+			VehicleID: vehicle.ID,
+			Kind:      kind,
+			Value:     value,
+			LinkedBy:  linkedBy,
+			FirstSeen: track.first,
+			LastSeen:  track.last,
+		}
+		state.identifiers[kind][value] = identifier
+	} else if identifier.VehicleID != vehicle.ID {
+		log.Printf("Vehicle registry: %s %s of vehicle %d was also seen with vehicle %d", kind, value, identifier.VehicleID, vehicle.ID)
+		return
+	}
+
+	if track.first.Before(identifier.FirstSeen) {
+		identifier.FirstSeen = track.first
+	}
+	if !track.last.Before(identifier.LastSeen) {
+		identifier.LastSeen = track.last
+		if track.lastFix != nil {
+			lat, lon := track.lastFix.Latitude, track.lastFix.Longitude
+			identifier.LastLatitude, identifier.LastLongitude = &lat, &lon
+		}
+	}
+	if kind == models.IdentifierTemporaryID && track.radio != "" {
+		identifier.Radio = track.radio
+	}
+}
+
+// radioLinked returns the vehicle of a source ID consistently linked to tempID
+// on the other radio
+func (r *VehicleRegistry) radioLinked(tx *gorm.DB, state *registryState, tempID string) (*models.RegisteredVehicle, error) {
+	_, links, err := r.Correlator.LinkedIDs(tempID)
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		if link.Inconsistent {
+			continue // the two IDs disagree on where the vehicle is, so one may be spoofed
+		}
+		id := link.DSRCID
+		if id == tempID {
+			id = link.CV2XID
+		}
+		identifier := state.identifier(models.IdentifierTemporaryID, id)
+		if identifier == nil {
+			var stored models.VehicleIdentifier
+			err := tx.Where("kind = ? AND value = ?", models.IdentifierTemporaryID, id).Limit(1).Find(&stored).Error
+			if err != nil {
+				return nil, err
+			}
+			if stored.ID == 0 {
+				continue
+			}
+			identifier = &stored
+			state.identifiers[models.IdentifierTemporaryID][id] = identifier
+		}
+		if vehicle, ok := state.vehicles[identifier.VehicleID]; ok {
+			return vehicle, nil
+		}
+		var vehicle models.RegisteredVehicle
+		if err := tx.First(&vehicle, identifier.VehicleID).Error; err != nil {
+			return nil, err
+		}
+		state.vehicles[vehicle.ID] = &vehicle
+		return &vehicle, nil
+	}
+	return nil, nil
+}
+
+// rotatedFrom returns the vehicle whose temporary ID on the same radio went
+// silent at most MaxGap before the track began, close enough to where it
+// began, when exactly one vehicle fits
+func (r *VehicleRegistry) rotatedFrom(state *registryState, track *registryTrack) *models.RegisteredVehicle {
+	if track.firstFix == nil {
+		return nil
+	}
+	var match *models.RegisteredVehicle
+	for _, identifier := range state.identifiers[models.IdentifierTemporaryID] {
+		gap := track.first.Sub(identifier.LastSeen)
+		if gap <= 0 || gap > r.MaxGap || identifier.LastLatitude == nil {
+			continue
+		}
+		if identifier.Radio != "" && track.radio != "" && identifier.Radio != track.radio {
+			continue
+		}
+		vehicle := state.vehicles[identifier.VehicleID]
+		if vehicle == nil || vehicle.LastSeen.After(identifier.LastSeen) {
+			continue // the vehicle kept sending under another ID
+		}
+		distance := DistanceMeters(*identifier.LastLatitude, *identifier.LastLongitude, track.firstFix.Latitude, track.firstFix.Longitude)
+		if distance > r.MaxDistance+rotationSpeed*gap.Seconds() {
+			continue
+		}
+		if match != nil && match.ID != vehicle.ID {
+			return nil // ambiguous: several vehicles went silent nearby
+		}
+		match = vehicle
+	}
+	return match
+}
+
+// newPseudonym returns a random name for a registered vehicle
+func newPseudonym() (string, error) {
+	var b [6]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return "PV-" + hex.EncodeToString(b[:]), nil
+}
+
+// Identifiers returns the identifiers of a vehicle, the most recently seen first
+func (r *VehicleRegistry) Identifiers(vehicleID uint) ([]models.VehicleIdentifier, error) {
+	var identifiers []models.VehicleIdentifier
+	err := r.DB.Where("vehicle_id = ?", vehicleID).Order("last_seen DESC, id ASC").Find(&identifiers).Error
+	return identifiers, err
+}
+
+// Lookup returns the vehicle a temporary ID or certificate was resolved to
+func (r *VehicleRegistry) Lookup(value string) (*models.RegisteredVehicle, error) {
+	values := []string{value}
+	if certificate, ok := NormalizeCertificateID(value); ok && certificate != value {
+		values = append(values, certificate)
+	}
+	var identifier models.VehicleIdentifier
+	if err := r.DB.Where("value IN ?", values).Order("last_seen DESC").First(&identifier).Error; err != nil {
+		return nil, err
+	}
+	var vehicle models.RegisteredVehicle
+	if err := r.DB.First(&vehicle, identifier.VehicleID).Error; err != nil {
+		return nil, err
+	}
+	return &vehicle, nil
+}
+
+// vehicleIDCondition matches the events whose details name one of the
+// temporary IDs, or whose device is one of them
+const vehicleIDCondition = `(device_id IN ? OR (CASE WHEN raw_data ~ '^\s*\{' THEN raw_data::jsonb->'details'->>'vehicle_id' END) IN ?)`
+
+// Messages returns the query of the V2X messages sent under the temporary IDs
+// of a vehicle, without the findings about them
+func (r *VehicleRegistry) Messages(identifiers []models.VehicleIdentifier) *gorm.DB {
+	tempIDs := temporaryIDs(identifiers)
+	return r.DB.Model(&models.SecurityEvent{}).
+		Where("category IN ?", []models.EventCategory{models.CategoryV2X, models.CategoryVehicle}).
+		Where(vehicleIDCondition, tempIDs, tempIDs).
+		Where("raw_data NOT LIKE ?", `%"anomaly_type"%`)
+}
+
+// Anomalies returns the query of the anomaly findings about the temporary IDs of a vehicle
+func (r *VehicleRegistry) Anomalies(identifiers []models.VehicleIdentifier) *gorm.DB {
+	tempIDs := temporaryIDs(identifiers)
+	return r.DB.Model(&models.SecurityEvent{}).
+		Where("category = ?", models.CategoryV2X).
+		Where(vehicleIDCondition, tempIDs, tempIDs).
+		Where("raw_data LIKE ?", `%"anomaly_type"%`)
+}
+
+// temporaryIDs returns the temporary ID values among identifiers, never empty
+// so that IN conditions stay valid
+func temporaryIDs(identifiers []models.VehicleIdentifier) []string {
+	ids := []string{}
+	for _, identifier := range identifiers {
+		if identifier.Kind == models.IdentifierTemporaryID {
+			ids = append(ids, identifier.Value)
+		}
+	}
+	if len(ids) == 0 {
+		ids = append(ids, "")
+	}
+	return ids
+}
+
+// Trust computes the trust of a vehicle from everything held against its temporary IDs
+func (r *VehicleRegistry) Trust(vehicle *models.RegisteredVehicle) (*Trust, error) {
+	identifiers, err := r.Identifiers(vehicle.ID)
+	if err != nil {
+		return nil, err
+	}
+	var tempIDs []string
+	for _, identifier := range identifiers {
+		if identifier.Kind == models.IdentifierTemporaryID {
+			tempIDs = append(tempIDs, identifier.Value)
+		}
+	}
+	return r.Scorer.Trust(tempIDs...)
+}
+
+// UpdateTrust computes the trust of a vehicle and stores its score
+func (r *VehicleRegistry) UpdateTrust(vehicle *models.RegisteredVehicle) (*Trust, error) {
+	trust, err := r.Trust(vehicle)
+	if err != nil {
+		return nil, err
+	}
+	now := r.Clock.Now()
+	vehicle.TrustScore, vehicle.TrustUpdatedAt = trust.Score, &now
+	err = r.DB.Model(vehicle).Updates(map[string]interface{}{"trust_score": trust.Score, "trust_updated_at": now}).Error
+	return trust, err
+}
+
+// Start resolves each completed window in the background
+func (r *VehicleRegistry) Start() {
+	go func() {
+		ticker := time.NewTicker(r.Window)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			end := r.Clock.Now().Truncate(r.Window)
+			start := end.Add(-r.Window)
+			vehicles, err := r.Resolve(start, end)
+			if err != nil {
+				log.Printf("Error resolving registered vehicles for %s: %v", start.Format(time.RFC3339), err)
+				continue
+			}
+			if len(vehicles) > 0 {
+				log.Printf("Resolved the identifiers of %d registered vehicles for %s", len(vehicles), start.Format(time.RFC3339))
+			}
+		}
+	}()
+
+	log.Printf("Vehicle registry started with %s windows, linking temporary IDs up to %s apart", r.Window, r.MaxGap)
+}
@@ -0,0 +1,301 @@
+package siem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/cache"
+	"traffic-monitoring-go/app/logging"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem/clock"
+)
+
+// grokSyntax are the named sub-patterns vendor patterns can reference as %{NAME}
+var grokSyntax = map[string]string{
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"INT":               `[+-]?\d+`,
+	"NUMBER":            `[+-]?(?:\d+(?:\.\d*)?|\.\d+)`,
+	"HEX":               `(?:0[xX])?[0-9A-Fa-f]+`,
+	"UUID":              `[0-9A-Fa-f]{8}-(?:[0-9A-Fa-f]{4}-){3}[0-9A-Fa-f]{12}`,
+	"MAC":               `(?:[0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2}`,
+	"IP":                `(?:\d{1,3}\.){3}\d{1,3}|[0-9A-Fa-f]*:[0-9A-Fa-f:.]+`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\b`,
+	"LOCATION":          `[+-]?\d+(?:\.\d+)?\s*,\s*[+-]?\d+(?:\.\d+)?`,
+	"TIMESTAMP_ISO8601": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	"SYSLOGTIMESTAMP":   `[A-Z][a-z]{2} +\d{1,2} \d{2}:\d{2}:\d{2}`,
+}
+
+// grokReference matches %{SYNTAX}, %{SYNTAX:field} and %{SYNTAX:field:type}
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?(?::(\w+))?\}`)
+
+// vendorTimestampLayouts are the timestamp formats accepted in a timestamp capture
+var vendorTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// CompiledVendorPattern is a vendor pattern ready to match syslog lines
+type CompiledVendorPattern struct {
+	Pattern *models.VendorPattern
+	regex   *regexp.Regexp
+	types   map[string]string // capture name -> int or float
+}
+
+// CompileVendorPattern expands the grok references of a vendor pattern into a
+// regular expression
+func CompileVendorPattern(pattern *models.VendorPattern) (*CompiledVendorPattern, error) {
+	compiled := &CompiledVendorPattern{Pattern: pattern, types: make(map[string]string)}
+
+	var expandErr error
+	expanded := grokReference.ReplaceAllStringFunc(pattern.Pattern, func(reference string) string {
+		parts := grokReference.FindStringSubmatch(reference)
+		syntax, field, fieldType := parts[1], parts[2], parts[3]
+		sub, ok := grokSyntax[syntax]
+		if !ok {
+			expandErr = fmt.Errorf("unknown grok syntax %%{%s}", syntax)
+			return ""
+		}
+		if field == "" {
+			return "(?:" + sub + ")"
+		}
+		if _, seen := compiled.types[field]; seen {
+			expandErr = fmt.Errorf("field %s is captured twice", field)
+			return ""
+		}
+		switch fieldType {
+		case "", "int", "float":
+		default:
+			expandErr = fmt.Errorf("field %s has unknown type %s, use int or float", field, fieldType)
+			return ""
+		}
+		compiled.types[field] = fieldType
+		return "(?P<" + field + ">" + sub + ")"
+	})
+	if expandErr != nil {
+		return nil, expandErr
+	}
+
+	regex, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+	compiled.regex = regex
+	return compiled, nil
+}
+
+// ValidateVendorPattern checks a vendor pattern before it is stored
+func ValidateVendorPattern(pattern *models.VendorPattern) error {
+	if pattern.Name == "" {
+		return errors.New("name is required")
+	}
+	if pattern.Vendor == "" {
+		return errors.New("vendor is required")
+	}
+	if pattern.Severity != "" && !models.ValidSeverity(pattern.Severity) {
+		return fmt.Errorf("unknown severity: %s", pattern.Severity)
+	}
+	if pattern.Radio != "" && NormalizeRadio(pattern.Radio) == "" {
+		return fmt.Errorf("unknown radio: %s", pattern.Radio)
+	}
+
+	compiled, err := CompileVendorPattern(pattern)
+	if err != nil {
+		return err
+	}
+	if _, ok := compiled.types["vehicle_id"]; !ok {
+		return errors.New("pattern must capture vehicle_id")
+	}
+	return nil
+}
+
+// Parse rewrites a decoded event whose message matches the pattern into a v2x
+// event and reports whether it matched
+func (p *CompiledVendorPattern) Parse(event map[string]interface{}) bool {
+	if p.Pattern.SourceName != "" {
+		if sourceName, _ := event["source_name"].(string); sourceName != p.Pattern.SourceName {
+			return false
+		}
+	}
+	line, _ := event["message"].(string)
+	match := p.regex.FindStringSubmatch(line)
+	if match == nil {
+		return false
+	}
+
+	details, _ := event["details"].(map[string]interface{})
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	if p.Pattern.Radio != "" {
+		details["radio"] = p.Pattern.Radio
+	}
+	if p.Pattern.Severity != "" {
+		event["severity"] = string(p.Pattern.Severity)
+	}
+
+	for i, field := range p.regex.SubexpNames() {
+		if field == "" || match[i] == "" {
+			continue
+		}
+		value := match[i]
+		switch field {
+		case "timestamp":
+			if timestamp, ok := parseVendorTimestamp(value); ok {
+				event["timestamp"] = timestamp.Format(time.RFC3339Nano)
+				continue
+			}
+		case "severity", "message":
+			event[field] = value
+			continue
+		}
+		details[field] = convertVendorValue(value, p.types[field])
+	}
+
+	if _, ok := details["location"]; !ok {
+		latitude, hasLatitude := details["latitude"].(float64)
+		longitude, hasLongitude := details["longitude"].(float64)
+		if hasLatitude && hasLongitude {
+			details["location"] = fmt.Sprintf("%f,%f", latitude, longitude)
+		}
+	}
+	details["vendor"] = p.Pattern.Vendor
+	details["vendor_pattern"] = p.Pattern.Name
+
+	event["details"] = details
+	event["source_name"] = p.Pattern.Vendor
+	event["source_type"] = string(models.SourceTypeStation)
+	event["category"] = string(models.CategoryV2X)
+	return true
+}
+
+// convertVendorValue converts a capture to its declared type, keeping the text
+// when it does not parse
+func convertVendorValue(value, fieldType string) interface{} {
+	switch fieldType {
+	case "int":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+// parseVendorTimestamp parses an ISO 8601 or syslog timestamp; timestamps
+// without a zone are UTC and syslog timestamps take the current year
+func parseVendorTimestamp(value string) (time.Time, bool) {
+	for _, layout := range vendorTimestampLayouts {
+		if timestamp, err := time.Parse(layout, value); err == nil {
+			return timestamp, true
+		}
+	}
+	if timestamp, err := time.Parse(time.Stamp, value); err == nil {
+		return timestamp.AddDate(clock.Now().UTC().Year(), 0, 0), true
+	}
+	return time.Time{}, false
+}
+
+// vendorPatternCacheTTL bounds how long a pattern changed on another instance takes to apply here
+const vendorPatternCacheTTL = 10 * time.Second
+
+// vendorPatternCache keeps the enabled patterns compiled, highest priority first
+type vendorPatternCache struct {
+	mutex    sync.RWMutex
+	loaded   bool
+	loadedAt time.Time
+	patterns []*CompiledVendorPattern
+}
+
+var defaultVendorPatterns = &vendorPatternCache{}
+
+// InvalidateVendorPatterns forces the vendor pattern cache to reload. Call it whenever patterns change.
+func InvalidateVendorPatterns() {
+	cache.Invalidate("vendor_patterns")
+}
+
+// invalidate drops the cached patterns of this instance
+func (c *vendorPatternCache) invalidate() {
+	c.mutex.Lock()
+	c.loaded = false
+	c.mutex.Unlock()
+}
+
+func init() {
+	cache.OnInvalidate("vendor_patterns", defaultVendorPatterns.invalidate)
+}
+
+func (c *vendorPatternCache) get(db *gorm.DB) ([]*CompiledVendorPattern, error) {
+	c.mutex.RLock()
+	if c.loaded && time.Since(c.loadedAt) <= vendorPatternCacheTTL {
+		patterns := c.patterns
+		c.mutex.RUnlock()
+		return patterns, nil
+	}
+	c.mutex.RUnlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded || time.Since(c.loadedAt) > vendorPatternCacheTTL {
+		var rows []models.VendorPattern
+		if err := db.Where("enabled = ?", true).Order("priority DESC, id ASC").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		patterns := make([]*CompiledVendorPattern, 0, len(rows))
+		for i := range rows {
+			compiled, err := CompileVendorPattern(&rows[i])
+			if err != nil {
+				logging.Sampled("vendor.pattern:"+rows[i].Name, "Skipping vendor pattern %s: %v", rows[i].Name, err)
+				continue
+			}
+			patterns = append(patterns, compiled)
+		}
+		c.patterns = patterns
+		c.loaded = true
+		c.loadedAt = time.Now()
+	}
+	return c.patterns, nil
+}
+
+// ApplyVendorPatterns rewrites a raw event carrying an RSU vendor's syslog line
+// into a v2x event with the first matching vendor pattern. Events that are
+// already v2x, or match no pattern, are returned unchanged.
+func ApplyVendorPatterns(db *gorm.DB, rawEventData []byte) ([]byte, error) {
+	patterns, err := defaultVendorPatterns.get(db)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return rawEventData, nil
+	}
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(rawEventData, &event); err != nil {
+		return nil, err
+	}
+	if category, _ := event["category"].(string); strings.EqualFold(category, string(models.CategoryV2X)) {
+		return rawEventData, nil
+	}
+
+	for _, pattern := range patterns {
+		if pattern.Parse(event) {
+			return json.Marshal(event)
+		}
+	}
+	return rawEventData, nil
+}
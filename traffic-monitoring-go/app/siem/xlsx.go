@@ -0,0 +1,104 @@
+package siem
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// xlsxSheet is one worksheet of a workbook: a header row and data rows
+type xlsxSheet struct {
+	name string
+	rows [][]string
+}
+
+// writeXLSX writes a minimal Office Open XML workbook with one worksheet per
+// sheet. Cells holding integers are written as numbers, others as inline strings.
+func writeXLSX(w io.Writer, sheets []xlsxSheet) error {
+	archive := zip.NewWriter(w)
+	add := func(name, content string) error {
+		f, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, xml.Header+content)
+		return err
+	}
+
+	var overrides, entries, rels bytes.Buffer
+	for i, sheet := range sheets {
+		n := i + 1
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&entries, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(xlsxSheetName(sheet.name)), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			overrides.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + entries.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+	}
+	for _, part := range parts {
+		if err := add(part.name, part.content); err != nil {
+			return err
+		}
+	}
+
+	for i, sheet := range sheets {
+		var data bytes.Buffer
+		data.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+		for r, row := range sheet.rows {
+			fmt.Fprintf(&data, `<row r="%d">`, r+1)
+			for c, value := range row {
+				ref := xlsxColumn(c) + strconv.Itoa(r+1)
+				if _, err := strconv.ParseInt(value, 10, 64); err == nil && r > 0 {
+					fmt.Fprintf(&data, `<c r="%s"><v>%s</v></c>`, ref, value)
+				} else {
+					fmt.Fprintf(&data, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, xmlEscape(value))
+				}
+			}
+			data.WriteString(`</row>`)
+		}
+		data.WriteString(`</sheetData></worksheet>`)
+		if err := add(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), data.String()); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// xlsxColumn returns the letters naming a zero-based column: A, B, ..., Z, AA, ...
+func xlsxColumn(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// xlsxSheetName fits a name to the 31 characters a worksheet name may have
+func xlsxSheetName(name string) string {
+	if len(name) > 31 {
+		return name[:31]
+	}
+	return name
+}
+
+func xmlEscape(value string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
@@ -0,0 +1,291 @@
+// Package startup waits for the services the SIEM depends on, with exponential
+// backoff and jitter, and reports their state for readiness probes.
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"traffic-monitoring-go/app/config"
+)
+
+// Policy decides how the SIEM starts when a dependency is not up after its max wait
+type Policy string
+
+const (
+	Required Policy = "required" // startup fails
+	Degraded Policy = "degraded" // the API starts without it and keeps waiting in the background
+)
+
+// State is where a dependency is in its startup
+type State string
+
+const (
+	StateWaiting  State = "waiting"
+	StateReady    State = "ready"
+	StateDegraded State = "degraded" // past its max wait, still retried in the background
+	StateFailed   State = "failed"   // a required dependency that did not come up
+)
+
+// ErrDegraded is returned by Await when a degraded-policy dependency is not up
+// after its max wait; it keeps being retried in the background
+var ErrDegraded = errors.New("dependency unavailable, continuing in degraded mode")
+
+// Dependency is a service to wait for at startup. Check is retried until it
+// succeeds; it may also complete the dependency's setup, since it runs until
+// the first success only.
+type Dependency struct {
+	Name           string
+	Policy         Policy
+	MaxWait        time.Duration
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Check          func(ctx context.Context) error
+}
+
+func init() {
+	config.RegisterPrefix("STARTUP_", "Startup wait of a dependency: STARTUP_<NAME>_MAX_WAIT_SECONDS and STARTUP_<NAME>_POLICY (required or degraded)")
+}
+
+// FromEnv overrides the max wait and policy with STARTUP_<NAME>_MAX_WAIT_SECONDS
+// and STARTUP_<NAME>_POLICY (required or degraded)
+func (d Dependency) FromEnv() Dependency {
+	prefix := "STARTUP_" + strings.ToUpper(d.Name) + "_"
+	if seconds, err := strconv.Atoi(config.Get(prefix + "MAX_WAIT_SECONDS")); err == nil && seconds >= 0 {
+		d.MaxWait = time.Duration(seconds) * time.Second
+	}
+	switch policy := Policy(strings.ToLower(config.Get(prefix + "POLICY"))); policy {
+	case Required, Degraded:
+		d.Policy = policy
+	}
+	return d
+}
+
+// Status is the reported state of a dependency
+type Status struct {
+	Name      string     `json:"name"`
+	Policy    Policy     `json:"policy"`
+	State     State      `json:"state"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error,omitempty"`
+	Since     time.Time  `json:"since"`
+	ReadyAt   *time.Time `json:"ready_at,omitempty"`
+}
+
+// registry tracks the status of every dependency awaited by this process
+type registry struct {
+	mutex    sync.Mutex
+	statuses []*Status
+}
+
+var defaultRegistry = &registry{}
+
+func (r *registry) add(dep Dependency) *Status {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	status := &Status{Name: dep.Name, Policy: dep.Policy, State: StateWaiting, Since: time.Now()}
+	r.statuses = append(r.statuses, status)
+	return status
+}
+
+func (r *registry) update(status *Status, fn func(*Status)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	fn(status)
+}
+
+// jitterRand is seeded per process so instances restarted together spread their retries
+var (
+	jitterMutex sync.Mutex
+	jitterRand  = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter spreads retries of many instances over the second half of backoff
+func jitter(backoff time.Duration) time.Duration {
+	half := backoff / 2
+	jitterMutex.Lock()
+	defer jitterMutex.Unlock()
+	return half + time.Duration(jitterRand.Int63n(int64(half)+1))
+}
+
+// Await runs dep.Check with exponential backoff until it succeeds or MaxWait
+// passes. A required dependency that is not up returns an error; a degraded one
+// returns ErrDegraded and is retried in the background until it succeeds.
+func Await(ctx context.Context, dep Dependency) error {
+	dep = withDefaults(dep)
+	return await(ctx, dep, defaultRegistry.add(dep))
+}
+
+// Start awaits dep in the background, so the API can serve while it comes up;
+// /readyz reports it as waiting meanwhile. A required dependency that does not
+// come up stops the process.
+func Start(ctx context.Context, dep Dependency) {
+	dep = withDefaults(dep)
+	status := defaultRegistry.add(dep)
+	go func() {
+		err := await(ctx, dep, status)
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrDegraded):
+			log.Printf("Warning: %s is not available, continuing in degraded mode until it is", dep.Name)
+		default:
+			log.Fatalf("Startup failed: %v", err)
+		}
+	}()
+}
+
+func withDefaults(dep Dependency) Dependency {
+	if dep.Policy == "" {
+		dep.Policy = Required
+	}
+	if dep.InitialBackoff <= 0 {
+		dep.InitialBackoff = time.Second
+	}
+	if dep.MaxBackoff < dep.InitialBackoff {
+		dep.MaxBackoff = dep.InitialBackoff
+	}
+	return dep
+}
+
+func await(ctx context.Context, dep Dependency, status *Status) error {
+	backoff := dep.InitialBackoff
+	deadline := time.Now().Add(dep.MaxWait)
+	var err error
+	for {
+		if err = attempt(ctx, dep, status); err == nil {
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 || ctx.Err() != nil {
+			break
+		}
+		wait := jitter(backoff)
+		if wait > remaining {
+			wait = remaining
+		}
+		log.Printf("Waiting for %s, retrying in %s: %v", dep.Name, wait.Round(time.Millisecond), err)
+		if !sleep(ctx, wait) {
+			break
+		}
+		if backoff *= 2; backoff > dep.MaxBackoff {
+			backoff = dep.MaxBackoff
+		}
+	}
+
+	if dep.Policy == Required {
+		defaultRegistry.update(status, func(s *Status) { s.State = StateFailed })
+		return fmt.Errorf("%s not available after %s: %v", dep.Name, dep.MaxWait, err)
+	}
+
+	defaultRegistry.update(status, func(s *Status) { s.State = StateDegraded })
+	go func() {
+		for sleep(ctx, jitter(dep.MaxBackoff)) {
+			if attempt(ctx, dep, status) == nil {
+				log.Printf("%s is available, leaving degraded mode", dep.Name)
+				return
+			}
+		}
+	}()
+	return ErrDegraded
+}
+
+// attempt runs one check and records its outcome
+func attempt(ctx context.Context, dep Dependency, status *Status) error {
+	err := dep.Check(ctx)
+	defaultRegistry.update(status, func(s *Status) {
+		s.Attempts++
+		if err != nil {
+			s.LastError = err.Error()
+			return
+		}
+		now := time.Now()
+		s.State = StateReady
+		s.LastError = ""
+		s.ReadyAt = &now
+	})
+	return err
+}
+
+// HTTPCheck returns a check that succeeds when url answers 200
+func HTTPCheck(url string) func(ctx context.Context) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// sleep waits for d, returning false when ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Readiness summarizes the dependencies: "starting" while any is still within
+// its wait, "failed" when a required one did not come up, "degraded" when the
+// SIEM runs without one, and "ready" otherwise
+type Readiness struct {
+	Status       string   `json:"status"`
+	Dependencies []Status `json:"dependencies"`
+}
+
+// Ready reports whether the instance should receive traffic
+func (r Readiness) Ready() bool {
+	return r.Status == "ready" || r.Status == "degraded"
+}
+
+// Report returns the readiness of this process
+func Report() Readiness {
+	defaultRegistry.mutex.Lock()
+	defer defaultRegistry.mutex.Unlock()
+
+	readiness := Readiness{Status: "ready", Dependencies: make([]Status, 0, len(defaultRegistry.statuses))}
+	var waiting, failed, degraded bool
+	for _, status := range defaultRegistry.statuses {
+		readiness.Dependencies = append(readiness.Dependencies, *status)
+		switch status.State {
+		case StateWaiting:
+			waiting = true
+		case StateFailed:
+			failed = true
+		case StateDegraded:
+			degraded = true
+		}
+	}
+	switch {
+	case failed:
+		readiness.Status = "failed"
+	case waiting:
+		readiness.Status = "starting"
+	case degraded:
+		readiness.Status = "degraded"
+	}
+	return readiness
+}
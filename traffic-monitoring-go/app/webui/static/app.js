@@ -0,0 +1,396 @@
+// Traffic SIEM console: a dependency-free client of the public API
+(function () {
+  'use strict';
+
+  var SEVERITIES = ['critical', 'high', 'medium', 'low', 'info'];
+  var TOKEN_KEY = 'siem.token';
+  var state = {
+    view: null, eventPage: 1, eventPages: 1, alertTimer: null, mapTimer: null,
+    token: localStorage.getItem(TOKEN_KEY), live: null
+  };
+
+  function $(id) { return document.getElementById(id); }
+
+  function el(tag, attrs, children) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (key) {
+      if (key === 'text') node.textContent = attrs[key];
+      else if (key === 'class') node.className = attrs[key];
+      else if (key.indexOf('on') === 0) node.addEventListener(key.slice(2), attrs[key]);
+      else node.setAttribute(key, attrs[key]);
+    });
+    (children || []).forEach(function (child) { node.appendChild(child); });
+    return node;
+  }
+
+  function td(text, cls) { return el('td', { text: text == null ? '' : String(text), class: cls || '' }); }
+
+  function showError(message) {
+    var box = $('error');
+    box.textContent = message;
+    box.hidden = !message;
+  }
+
+  function api(method, path, body) {
+    var options = { method: method, headers: {} };
+    if (state.token) options.headers['Authorization'] = 'Bearer ' + state.token;
+    if (body !== undefined) {
+      options.headers['Content-Type'] = 'application/json';
+      options.body = JSON.stringify(body);
+    }
+    return fetch(path, options).then(function (resp) {
+      if (resp.status === 401 && path !== '/auth/login') showLogin();
+      return resp.text().then(function (text) {
+        var data = text ? JSON.parse(text) : null;
+        if (!resp.ok) throw new Error((data && data.error) || resp.status + ' ' + resp.statusText);
+        return data;
+      });
+    }).catch(function (err) {
+      showError(method + ' ' + path + ': ' + err.message);
+      throw err;
+    });
+  }
+
+  function formatTime(value) {
+    if (!value) return '';
+    var date = new Date(value);
+    return isNaN(date) ? value : date.toLocaleString();
+  }
+
+  function severityCell(severity) { return td(severity, 'severity ' + severity); }
+
+  function fillSeverityOptions() {
+    document.querySelectorAll('.severity-filter').forEach(function (select) {
+      select.appendChild(el('option', { value: '', text: 'All severities' }));
+      SEVERITIES.forEach(function (s) { select.appendChild(el('option', { value: s, text: s })); });
+    });
+    document.querySelectorAll('.severity-select').forEach(function (select) {
+      SEVERITIES.forEach(function (s) { select.appendChild(el('option', { value: s, text: s })); });
+      select.value = 'medium';
+    });
+  }
+
+  // ---- live statistics (server-sent events) ----
+
+  function startLiveStats() {
+    if (!window.EventSource) return;
+    if (state.live) state.live.close();
+    var source = state.live = new EventSource('/live/stats?access_token=' + encodeURIComponent(state.token));
+    source.addEventListener('stats', function (e) {
+      var stats = JSON.parse(e.data);
+      $('live-eps').textContent = stats.events_per_second.toFixed(1);
+      $('live-vehicles').textContent = stats.active_vehicles;
+      $('live-critical').textContent = stats.open_critical_alerts;
+    });
+  }
+
+  // ---- alerts ----
+
+  function loadAlerts() {
+    var params = new URLSearchParams({ pagesize: '100' });
+    if ($('alert-status').value) params.set('status', $('alert-status').value);
+    if ($('alert-severity').value) params.set('severity', $('alert-severity').value);
+
+    return api('GET', '/alerts/?' + params).then(function (resp) {
+      var rows = $('alert-rows');
+      rows.textContent = '';
+      (resp.data || []).forEach(function (alert) {
+        var location = [alert.road_name, alert.nearest_rsu].filter(Boolean).join(' / ');
+        var status = el('select', {
+          onchange: function () {
+            api('PUT', '/alerts/' + alert.id, { status: status.value }).then(loadAlerts);
+          }
+        });
+        ['open', 'in_progress', 'closed', 'false_positive', 'confirmed_malicious'].forEach(function (s) {
+          status.appendChild(el('option', { value: s, text: s.replace('_', ' ') }));
+        });
+        status.value = alert.status;
+
+        rows.appendChild(el('tr', {}, [
+          td(formatTime(alert.timestamp)),
+          severityCell(alert.severity),
+          td(alert.rule ? alert.rule.name : alert.rule_id),
+          el('td', {}, [el('a', {
+            href: '#events', text: '#' + alert.security_event_id,
+            onclick: function () { showEvent(alert.security_event_id); }
+          })]),
+          td(location),
+          el('td', {}, [status]),
+          td(alert.late_evaluated ? 'late' : '', 'muted')
+        ]));
+      });
+      if (!rows.children.length) rows.appendChild(el('tr', {}, [td('No alerts', 'muted')]));
+    });
+  }
+
+  function scheduleAlerts() {
+    clearInterval(state.alertTimer);
+    if (state.view === 'alerts' && $('alert-auto').checked) {
+      state.alertTimer = setInterval(loadAlerts, 5000);
+    }
+  }
+
+  // ---- events ----
+
+  function loadEvents() {
+    var params = new URLSearchParams({ page: String(state.eventPage), pageSize: '50' });
+    if ($('event-severity').value) params.set('severity', $('event-severity').value);
+    if ($('event-category').value) params.set('category', $('event-category').value);
+
+    return api('GET', '/security-events/?' + params).then(function (resp) {
+      var rows = $('event-rows');
+      rows.textContent = '';
+      (resp.data || []).forEach(function (event) {
+        rows.appendChild(el('tr', { class: 'clickable', onclick: function () { showEvent(event.id); } }, [
+          td(formatTime(event.timestamp)),
+          severityCell(event.severity),
+          td(event.category),
+          td(event.source_ip || event.device_id),
+          td(event.message)
+        ]));
+      });
+      state.eventPages = Math.max(1, resp.pagination.pages);
+      $('event-page').textContent = state.eventPage + ' / ' + state.eventPages;
+    });
+  }
+
+  function showEvent(id) {
+    api('GET', '/security-events/' + id).then(function (event) {
+      var detail = $('event-detail');
+      var raw = event.raw_data;
+      try { raw = JSON.parse(raw); } catch (e) { /* keep as text */ }
+      event.raw_data = raw;
+      detail.textContent = JSON.stringify(event, null, 2);
+      detail.hidden = false;
+    });
+  }
+
+  // ---- V2X map ----
+
+  function point(entity) {
+    var location = entity.location && entity.location.value;
+    if (!location || !location.coordinates) return null;
+    return { lon: location.coordinates[0], lat: location.coordinates[1] };
+  }
+
+  function value(entity, name) {
+    return entity[name] ? entity[name].value : undefined;
+  }
+
+  function loadMap() {
+    return api('GET', '/ngsi-ld/v1/entities?limit=1000').then(function (entities) {
+      var svg = $('map');
+      var ns = 'http://www.w3.org/2000/svg';
+      svg.textContent = '';
+
+      var items = (entities || []).map(function (entity) {
+        return { entity: entity, at: point(entity) };
+      }).filter(function (item) { return item.at; });
+
+      var counts = { Vehicle: 0, Device: 0, Alert: 0 };
+      items.forEach(function (item) { counts[item.entity.type] = (counts[item.entity.type] || 0) + 1; });
+      $('map-summary').textContent = counts.Vehicle + ' vehicles, ' + counts.Device + ' RSUs, ' + counts.Alert + ' hazards';
+      if (!items.length) return;
+
+      // fit all positions into the view with an equirectangular projection
+      var minLat = Infinity, maxLat = -Infinity, minLon = Infinity, maxLon = -Infinity;
+      items.forEach(function (item) {
+        minLat = Math.min(minLat, item.at.lat); maxLat = Math.max(maxLat, item.at.lat);
+        minLon = Math.min(minLon, item.at.lon); maxLon = Math.max(maxLon, item.at.lon);
+      });
+      var scaleLon = Math.cos((minLat + maxLat) / 2 * Math.PI / 180);
+      var spanX = Math.max((maxLon - minLon) * scaleLon, 1e-4);
+      var spanY = Math.max(maxLat - minLat, 1e-4);
+      var scale = Math.min(920 / spanX, 520 / spanY);
+      function project(at) {
+        return {
+          x: 500 + ((at.lon - (minLon + maxLon) / 2) * scaleLon) * scale,
+          y: 300 - (at.lat - (minLat + maxLat) / 2) * scale
+        };
+      }
+
+      var order = { Device: 0, Vehicle: 1, Alert: 2 };
+      items.sort(function (a, b) { return order[a.entity.type] - order[b.entity.type]; });
+      items.forEach(function (item) {
+        var p = project(item.at);
+        var shape = document.createElementNS(ns, item.entity.type === 'Device' ? 'rect' : 'circle');
+        if (item.entity.type === 'Device') {
+          shape.setAttribute('x', p.x - 6); shape.setAttribute('y', p.y - 6);
+          shape.setAttribute('width', 12); shape.setAttribute('height', 12);
+        } else {
+          shape.setAttribute('cx', p.x); shape.setAttribute('cy', p.y);
+          shape.setAttribute('r', item.entity.type === 'Alert' ? 9 : 6);
+        }
+        shape.setAttribute('class', { Vehicle: 'vehicle', Device: 'rsu', Alert: 'hazard' }[item.entity.type] || '');
+        shape.addEventListener('mouseenter', function () { describe(item); });
+        svg.appendChild(shape);
+      });
+    });
+  }
+
+  function describe(item) {
+    var entity = item.entity;
+    var lines = [entity.id, item.at.lat.toFixed(5) + ', ' + item.at.lon.toFixed(5)];
+    if (value(entity, 'speed') !== undefined) lines.push('speed ' + value(entity, 'speed'));
+    if (value(entity, 'subCategory')) lines.push(value(entity, 'subCategory'));
+    if (entity.location.observedAt) lines.push(formatTime(entity.location.observedAt));
+    $('map-tooltip').textContent = lines.join('\n');
+  }
+
+  // ---- rules ----
+
+  function loadRules() {
+    return api('GET', '/rules/?pageSize=1000').then(function (resp) {
+      var rows = $('rule-rows');
+      rows.textContent = '';
+      (resp.data || []).forEach(function (rule) {
+        rows.appendChild(el('tr', {}, [
+          td(rule.name),
+          el('td', {}, [el('code', { text: rule.condition })]),
+          severityCell(rule.severity),
+          td(rule.category),
+          td(rule.status, 'status ' + rule.status),
+          el('td', { class: 'actions' }, [
+            el('button', { type: 'button', text: 'Edit', onclick: function () { editRule(rule); } }),
+            el('button', {
+              type: 'button', text: rule.status === 'enabled' ? 'Disable' : 'Enable',
+              onclick: function () {
+                rule.status = rule.status === 'enabled' ? 'disabled' : 'enabled';
+                api('PUT', '/rules/' + rule.id, rule).then(loadRules);
+              }
+            }),
+            el('button', {
+              type: 'button', text: 'Delete', class: 'danger',
+              onclick: function () {
+                if (confirm('Delete rule ' + rule.name + '?')) api('DELETE', '/rules/' + rule.id).then(loadRules);
+              }
+            })
+          ])
+        ]));
+      });
+    });
+  }
+
+  function editRule(rule) {
+    $('rule-id').value = rule ? rule.id : '';
+    $('rule-name').value = rule ? rule.name : '';
+    $('rule-condition').value = rule ? rule.condition : '';
+    $('rule-severity').value = rule ? rule.severity : 'medium';
+    $('rule-category').value = rule ? rule.category : 'v2x';
+    $('rule-status').value = rule ? rule.status : 'disabled';
+    $('rule-description').value = rule ? rule.description : '';
+    $('rule-save').textContent = rule ? 'Save rule' : 'Create rule';
+    $('rule-cancel').hidden = !rule;
+  }
+
+  function saveRule(e) {
+    e.preventDefault();
+    var id = $('rule-id').value;
+    var rule = {
+      name: $('rule-name').value,
+      condition: $('rule-condition').value,
+      severity: $('rule-severity').value,
+      category: $('rule-category').value,
+      status: $('rule-status').value,
+      description: $('rule-description').value
+    };
+    var request = id ? api('PUT', '/rules/' + id, rule) : api('POST', '/rules/', rule);
+    request.then(function () { editRule(null); return loadRules(); });
+  }
+
+  // ---- navigation ----
+
+  var loaders = { alerts: loadAlerts, events: loadEvents, map: loadMap, rules: loadRules };
+
+  function show(view) {
+    if (!loaders[view]) view = 'alerts';
+    state.view = view;
+    showError('');
+    document.querySelectorAll('.view').forEach(function (section) {
+      section.hidden = section.id !== 'view-' + view;
+    });
+    document.querySelectorAll('nav a').forEach(function (link) {
+      link.classList.toggle('active', link.dataset.view === view);
+    });
+
+    loaders[view]();
+    scheduleAlerts();
+    clearInterval(state.mapTimer);
+    if (view === 'map') state.mapTimer = setInterval(loadMap, 10000);
+  }
+
+  // ---- session ----
+
+  function showLogin() {
+    state.token = null;
+    localStorage.removeItem(TOKEN_KEY);
+    clearInterval(state.alertTimer);
+    clearInterval(state.mapTimer);
+    if (state.live) state.live.close();
+    state.live = null;
+    document.querySelectorAll('.view').forEach(function (section) { section.hidden = true; });
+    $('session').hidden = true;
+    $('login-form').hidden = false;
+  }
+
+  function login(e) {
+    e.preventDefault();
+    api('POST', '/auth/login', { email: $('login-email').value, password: $('login-password').value })
+      .then(function (resp) {
+        state.token = resp.access_token;
+        localStorage.setItem(TOKEN_KEY, state.token);
+        $('login-password').value = '';
+        start();
+      });
+  }
+
+  // start opens the console once a token is available
+  function start() {
+    api('GET', '/auth/me').then(function (me) {
+      showError('');
+      $('login-form').hidden = true;
+      $('session-user').textContent = me.email + ' (' + me.role + ')';
+      $('session').hidden = false;
+      show(location.hash.slice(1));
+      startLiveStats();
+    });
+  }
+
+  function init() {
+    fillSeverityOptions();
+
+    $('login-form').addEventListener('submit', login);
+    $('logout').addEventListener('click', function (e) {
+      e.preventDefault();
+      // revoke the session server-side; the console logs out even if that fails
+      api('POST', '/auth/logout').catch(function () {}).then(showLogin);
+    });
+
+    $('alert-status').addEventListener('change', loadAlerts);
+    $('alert-severity').addEventListener('change', loadAlerts);
+    $('alert-auto').addEventListener('change', scheduleAlerts);
+
+    $('event-search').addEventListener('submit', function (e) {
+      e.preventDefault();
+      state.eventPage = 1;
+      loadEvents();
+    });
+    $('event-prev').addEventListener('click', function () {
+      if (state.eventPage > 1) { state.eventPage--; loadEvents(); }
+    });
+    $('event-next').addEventListener('click', function () {
+      if (state.eventPage < state.eventPages) { state.eventPage++; loadEvents(); }
+    });
+
+    $('rule-form').addEventListener('submit', saveRule);
+    $('rule-cancel').addEventListener('click', function () { editRule(null); });
+
+    window.addEventListener('hashchange', function () {
+      if (state.token) show(location.hash.slice(1));
+    });
+    if (state.token) start();
+    else showLogin();
+  }
+
+  document.addEventListener('DOMContentLoaded', init);
+})();
@@ -0,0 +1,42 @@
+// Package webui embeds a small single-page console for deployments that run
+// without Kibana or a separate frontend. It only calls the public API.
+package webui
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"traffic-monitoring-go/app/config"
+)
+
+//go:embed static
+var static embed.FS
+
+var embeddedUI = config.NewBool("EMBEDDED_UI", true, "Serve the embedded console at / and /ui")
+
+// Register serves the console at / and its assets under /ui, unless
+// EMBEDDED_UI is set to false
+func Register(router *gin.Engine) {
+	if !embeddedUI.Get() {
+		return
+	}
+
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		log.Printf("Warning: embedded UI is unavailable: %v", err)
+		return
+	}
+	index, err := fs.ReadFile(assets, "index.html")
+	if err != nil {
+		log.Printf("Warning: embedded UI is unavailable: %v", err)
+		return
+	}
+
+	router.GET("/", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", index)
+	})
+	router.StaticFS("/ui", http.FS(assets))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"traffic-monitoring-go/app/eventschema"
+)
+
+// contractAttackEvents is how many events of each attack a contract run sends,
+// enough for every stage of the scenarios
+const contractAttackEvents = 2
+
+// contractPayload is a payload of a contract run and what it stands for
+type contractPayload struct {
+	name  string
+	event Event
+}
+
+// runContract sends one payload of every type the generator and the
+// intersection simulator produce, each built by the encoder of normal runs,
+// and returns the exit status: 0 when the SIEM accepted all of them. The
+// contract tests (tests/contract) start it against an in-process SIEM.
+func runContract() int {
+	var payloads []contractPayload
+	for _, category := range []string{CategoryAuthentication, CategoryAuthorization, CategoryNetwork, CategoryMalware, CategorySystem, CategoryVehicle} {
+		payloads = append(payloads, contractPayload{category, generateEvent(SeverityMedium, category, "")})
+	}
+	for _, messageType := range v2xMessageTypes {
+		payloads = append(payloads, contractPayload{"v2x " + messageType, generateEvent(SeverityMedium, CategoryV2X, messageType)})
+	}
+	for _, attackType := range attackTypes {
+		for i, step := range attackScenario(attackType, contractAttackEvents) {
+			payloads = append(payloads, contractPayload{fmt.Sprintf("%s event %d", attackType, i+1), step.Event})
+		}
+	}
+
+	failed := 0
+	intersections, ok := fetchIntersections()
+	if ok && len(intersections) > 0 {
+		now := time.Now()
+		in := intersections[0]
+		payloads = append(payloads,
+			contractPayload{"MAP", mapEvent(in, now)},
+			contractPayload{"SPaT", spatEvent(in, now)})
+
+		// an emergency vehicle asking for priority on the first approach, and the intersection's answer
+		if len(in.Approaches) > 0 {
+			approach := in.Approaches[0]
+			bsm := generateEvent(SeverityInfo, CategoryV2X, eventschema.MessageBasicSafety)
+			request := priorityRequest{requestID: 1, requestType: eventschema.RequestNew, role: eventschema.RoleEmergency, approach: approach.ID, eta: 12}
+			srm := srmEvent(bsm, in, request)
+			payloads = append(payloads,
+				contractPayload{"SRM", srm},
+				contractPayload{"SSM", ssmEvent(in, []eventschema.PriorityStatus{{
+					RequesterID: srm.Details.(eventschema.V2XDetails).VehicleID,
+					RequestID:   request.requestID,
+					Role:        request.role,
+					SignalGroup: approach.SignalGroup,
+					Status:      eventschema.PriorityGranted,
+				}}, now)})
+		} else {
+			log.Println("Contract: the declared intersection has no approach, cannot send SRM and SSM")
+			failed++
+		}
+	} else {
+		log.Println("Contract: no enabled intersection is declared, cannot send SPaT, MAP, SRM and SSM")
+		failed++
+	}
+
+	for _, payload := range payloads {
+		if err := postEvent(payload.event); err != nil {
+			log.Printf("Contract: %s payload rejected: %v", payload.name, err)
+			failed++
+			continue
+		}
+		log.Printf("Contract: %s payload accepted", payload.name)
+	}
+
+	if failed > 0 {
+		log.Printf("Contract: failed with %d problems", failed)
+		return 1
+	}
+	log.Printf("Contract: all %d payloads accepted", len(payloads))
+	return 0
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+
+	"traffic-monitoring-go/app/eventschema"
+)
+
+// Attacks injected into the BSM streams of the traffic simulation, named in
+// the attack field of the details of the messages they forge
+const (
+	InjectTeleport   = "position_teleport"
+	InjectSpeedSpike = "speed_spike"
+	InjectFlood      = "message_flood"
+	InjectClone      = "id_clone"
+	InjectReplay     = "stale_replay"
+	InjectPreemption = "fake_preemption"
+)
+
+// attackInjection is how often each attack is injected, from INJECT_* variables
+type attackInjection struct {
+	teleportRate   float64 // of BSMs reporting a position 500 m to 2 km away
+	speedSpikeRate float64 // of BSMs reporting 80 to 150 km/h more
+	floodRate      float64 // of BSMs sent floodMessages times at once
+	floodMessages  int
+	cloneRate      float64 // chance per step that a second sender takes over the ID of a vehicle
+	cloneDuration  time.Duration
+	replayRate     float64 // of BSMs followed by a replay of one of the vehicle's from replayAge ago
+	replayAge      time.Duration
+	preemptionRate float64 // chance per step that a sender without BSMs requests emergency priority at an intersection
+	preemptionTime time.Duration
+}
+
+func (a attackInjection) enabled() bool {
+	return a.teleportRate > 0 || a.speedSpikeRate > 0 || a.floodRate > 0 || a.cloneRate > 0 || a.replayRate > 0 || a.preemptionRate > 0
+}
+
+// loadAttackInjection reads INJECT_TELEPORT_RATE, INJECT_SPEED_SPIKE_RATE,
+// INJECT_FLOOD_RATE (with INJECT_FLOOD_MESSAGES, default 50),
+// INJECT_CLONE_RATE (with INJECT_CLONE_SECONDS, default 30),
+// INJECT_REPLAY_RATE (with INJECT_REPLAY_AGE_SECONDS, default 30) and
+// INJECT_PREEMPTION_RATE (with INJECT_PREEMPTION_SECONDS, default 30). Rates
+// are between 0 (the default, never) and 1.
+func loadAttackInjection() attackInjection {
+	rate := func(name string) float64 {
+		var value float64
+		fmt.Sscanf(os.Getenv(name), "%g", &value)
+		return math.Max(0, math.Min(value, 1))
+	}
+	count := func(name string, fallback int) int {
+		value := fallback
+		fmt.Sscanf(os.Getenv(name), "%d", &value)
+		if value < 1 {
+			value = fallback
+		}
+		return value
+	}
+
+	return attackInjection{
+		teleportRate:   rate("INJECT_TELEPORT_RATE"),
+		speedSpikeRate: rate("INJECT_SPEED_SPIKE_RATE"),
+		floodRate:      rate("INJECT_FLOOD_RATE"),
+		floodMessages:  count("INJECT_FLOOD_MESSAGES", 50),
+		cloneRate:      rate("INJECT_CLONE_RATE"),
+		cloneDuration:  time.Duration(count("INJECT_CLONE_SECONDS", 30)) * time.Second,
+		replayRate:     rate("INJECT_REPLAY_RATE"),
+		replayAge:      time.Duration(count("INJECT_REPLAY_AGE_SECONDS", 30)) * time.Second,
+		preemptionRate: rate("INJECT_PREEMPTION_RATE"),
+		preemptionTime: time.Duration(count("INJECT_PREEMPTION_SECONDS", 30)) * time.Second,
+	}
+}
+
+// idClone is a second sender broadcasting the BSMs of one vehicle under the ID of another
+type idClone struct {
+	victim *simulatedVehicle
+	donor  *simulatedVehicle
+	until  time.Time
+}
+
+// fakePreemption is a sender parked near an intersection, requesting the
+// priority of an emergency vehicle approaching it
+type fakePreemption struct {
+	id        string
+	sourceIP  string
+	node      int
+	approach  eventschema.Approach
+	location  eventschema.Location
+	distance  float64 // meters to the stop line it claims
+	requestID int
+	sent      time.Time
+	until     time.Time
+}
+
+// attackInjector forges the attacks of an attackInjection into BSM streams
+type attackInjector struct {
+	config      attackInjection
+	history     map[string][]Event // recent BSMs by vehicle, for replays
+	clones      []idClone
+	preemptions []*fakePreemption
+	spoofers    int // started so far, numbering the next
+}
+
+func newAttackInjector(config attackInjection) *attackInjector {
+	return &attackInjector{config: config, history: make(map[string][]Event)}
+}
+
+// inject returns the messages sent in place of the BSM of a vehicle: the BSM,
+// possibly tampered with by a teleport, a speed spike or a flood (at most one
+// of them), and a replay of an older BSM next to it
+func (j *attackInjector) inject(vehicle *simulatedVehicle, bsm Event, now time.Time) []Event {
+	if j.config.replayRate > 0 {
+		j.remember(vehicle.id, bsm, now)
+	}
+
+	events := []Event{bsm}
+	switch {
+	case rand.Float64() < j.config.teleportRate:
+		details := bsm.Details.(eventschema.V2XDetails)
+		distance, bearing := 500+rand.Float64()*1500, rand.Float64()*2*math.Pi
+		details.Location = &eventschema.Location{
+			Lat: details.Location.Lat + distance*math.Cos(bearing)/metersPerDegree,
+			Lon: details.Location.Lon + distance*math.Sin(bearing)/(metersPerDegree*math.Cos(details.Location.Lat*math.Pi/180)),
+		}
+		events[0] = injected(bsm, details, InjectTeleport)
+		log.Printf("Injected %s: %s reported %.0f m away", InjectTeleport, vehicle.id, distance)
+	case rand.Float64() < j.config.speedSpikeRate:
+		details := bsm.Details.(eventschema.V2XDetails)
+		spike := 80 + rand.Float64()*70
+		details.Speed = eventschema.Float(math.Round((*details.Speed+spike)*10) / 10)
+		events[0] = injected(bsm, details, InjectSpeedSpike)
+		log.Printf("Injected %s: %s reported %.0f km/h faster", InjectSpeedSpike, vehicle.id, spike)
+	case rand.Float64() < j.config.floodRate:
+		details := bsm.Details.(eventschema.V2XDetails)
+		for i := 1; i < j.config.floodMessages; i++ {
+			flood := injected(bsm, details, InjectFlood)
+			flood.Timestamp = bsm.Timestamp.Add(time.Duration(i) * time.Millisecond)
+			events = append(events, flood)
+		}
+		log.Printf("Injected %s: %s sent %d BSMs at once", InjectFlood, vehicle.id, j.config.floodMessages)
+	}
+
+	if rand.Float64() < j.config.replayRate {
+		if replay, ok := j.stale(vehicle.id, now); ok {
+			events = append(events, injected(replay, replay.Details.(eventschema.V2XDetails), InjectReplay))
+			log.Printf("Injected %s: %s BSM of %s sent again", InjectReplay, vehicle.id, replay.Timestamp.Format(time.RFC3339))
+		}
+	}
+	return events
+}
+
+// cloneEvents starts clones at cloneRate and returns the BSMs the running
+// ones send: the position, speed and heading of the donor under the ID of the
+// victim, from another address
+func (j *attackInjector) cloneEvents(simulation *trafficSimulation, now time.Time) []Event {
+	active := j.clones[:0]
+	for _, clone := range j.clones {
+		if now.Before(clone.until) {
+			active = append(active, clone)
+		}
+	}
+	j.clones = active
+
+	if len(simulation.vehicles) > 1 && rand.Float64() < j.config.cloneRate {
+		victim := simulation.vehicles[rand.Intn(len(simulation.vehicles))]
+		donor := simulation.vehicles[rand.Intn(len(simulation.vehicles))]
+		for donor == victim {
+			donor = simulation.vehicles[rand.Intn(len(simulation.vehicles))]
+		}
+		j.clones = append(j.clones, idClone{victim: victim, donor: donor, until: now.Add(j.config.cloneDuration)})
+		log.Printf("Injected %s: a second sender uses the ID of %s for %s", InjectClone, victim.id, j.config.cloneDuration)
+	}
+
+	events := make([]Event, 0, len(j.clones))
+	for i, clone := range j.clones {
+		bsm := simulation.bsmEvent(clone.donor, now)
+		details := bsm.Details.(eventschema.V2XDetails)
+		details.VehicleID = clone.victim.id
+		details.Radio = clone.victim.radio
+		details.SourceIP = fmt.Sprintf("192.168.101.%d", i%254+1)
+		bsm.Message = fmt.Sprintf("V2X %s message from vehicle %s", eventschema.MessageBasicSafety, clone.victim.id)
+		events = append(events, injected(bsm, details, InjectClone))
+	}
+	return events
+}
+
+// preemptionEvents starts fake preemptions at preemptionRate and returns the
+// SRMs the running ones send every priorityRefresh: the requests of an
+// emergency vehicle 100 to 250 m up an approach of a declared intersection,
+// from a sender that broadcasts no BSMs. The intersection grants them like
+// any other.
+func (j *attackInjector) preemptionEvents(simulation *trafficSimulation, now time.Time) []Event {
+	active := j.preemptions[:0]
+	for _, preemption := range j.preemptions {
+		if now.Before(preemption.until) {
+			active = append(active, preemption)
+		} else if signal, ok := simulation.signals[preemption.node]; ok {
+			signal.cancel(preemption.id)
+		}
+	}
+	j.preemptions = active
+
+	if len(simulation.signals) > 0 && rand.Float64() < j.config.preemptionRate {
+		nodes := make([]int, 0, len(simulation.signals))
+		for node, signal := range simulation.signals {
+			if len(signal.intersection.Approaches) > 0 {
+				nodes = append(nodes, node)
+			}
+		}
+		if len(nodes) > 0 {
+			node := nodes[rand.Intn(len(nodes))]
+			in := simulation.signals[node].intersection
+			approach := in.Approaches[rand.Intn(len(in.Approaches))]
+
+			// upstream of the intersection, against the heading of the traffic entering
+			distance := 100 + rand.Float64()*150
+			bearing := (approach.Heading + 180) * math.Pi / 180
+			j.spoofers++
+			preemption := &fakePreemption{
+				id:       fmt.Sprintf("EMV%03d", 900+j.spoofers%100),
+				sourceIP: fmt.Sprintf("192.168.102.%d", j.spoofers%254+1),
+				node:     node,
+				approach: approach,
+				location: eventschema.Location{
+					Lat: in.Latitude + distance*math.Cos(bearing)/metersPerDegree,
+					Lon: in.Longitude + distance*math.Sin(bearing)/(metersPerDegree*math.Cos(in.Latitude*math.Pi/180)),
+				},
+				distance:  distance,
+				requestID: rand.Intn(256),
+				until:     now.Add(j.config.preemptionTime),
+			}
+			j.preemptions = append(j.preemptions, preemption)
+			log.Printf("Injected %s: %s requests priority at intersection %d for %s", InjectPreemption, preemption.id, in.IntersectionID, j.config.preemptionTime)
+		}
+	}
+
+	var events []Event
+	for _, preemption := range j.preemptions {
+		signal, ok := simulation.signals[preemption.node]
+		if !ok || now.Sub(preemption.sent) < priorityRefresh {
+			continue
+		}
+		requestType := eventschema.RequestUpdate
+		if preemption.sent.IsZero() {
+			requestType = eventschema.RequestNew
+		}
+		preemption.sent = now
+
+		// it claims to approach at 50 km/h, but never gets closer
+		request := priorityRequest{
+			requestID:   preemption.requestID,
+			requestType: requestType,
+			role:        eventschema.RoleEmergency,
+			approach:    preemption.approach.ID,
+			eta:         math.Round(preemption.distance/(50/3.6)*10) / 10,
+		}
+		signal.receive(preemption.id, request, preemption.approach.SignalGroup, now)
+
+		location := preemption.location
+		srm := srmEvent(Event{
+			SourceName: "v2x",
+			SourceType: "v2x",
+			Timestamp:  now,
+			Severity:   SeverityInfo,
+			Category:   CategoryV2X,
+			Details: eventschema.V2XDetails{
+				NetworkDetails: eventschema.NetworkDetails{SourceIP: preemption.sourceIP},
+				VehicleID:      preemption.id,
+				Radio:          eventschema.RadioDSRC,
+				Location:       &location,
+				Speed:          eventschema.Float(50),
+				Heading:        eventschema.Float(preemption.approach.Heading),
+			},
+		}, signal.intersection, request)
+		events = append(events, injected(srm, srm.Details.(eventschema.V2XDetails), InjectPreemption))
+	}
+	return events
+}
+
+// remember keeps the BSMs of a vehicle sent within the replay age, and the one before
+func (j *attackInjector) remember(vehicleID string, bsm Event, now time.Time) {
+	history := append(j.history[vehicleID], bsm)
+	cutoff := now.Add(-j.config.replayAge)
+	for len(history) > 1 && !history[1].Timestamp.After(cutoff) {
+		history = history[1:]
+	}
+	j.history[vehicleID] = history
+}
+
+// stale returns the BSM a vehicle sent about the replay age ago, once it has been running that long
+func (j *attackInjector) stale(vehicleID string, now time.Time) (Event, bool) {
+	history := j.history[vehicleID]
+	if len(history) == 0 || history[0].Timestamp.After(now.Add(-j.config.replayAge)) {
+		return Event{}, false
+	}
+	return history[0], true
+}
+
+// injected labels a forged message with the attack it belongs to
+func injected(event Event, details eventschema.V2XDetails, attack string) Event {
+	details.AttackDetails = eventschema.AttackDetails{Attack: attack, Stage: "injected"}
+	event.Details = details
+	return event
+}
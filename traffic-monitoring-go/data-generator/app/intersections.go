@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"traffic-monitoring-go/app/eventschema"
+)
+
+// mapEverySPaTs is how many SPaT broadcasts of an intersection go by between two of its MAPs
+const mapEverySPaTs = 10
+
+// runIntersections broadcasts, every second, a SPaT message for each enabled
+// intersection declared in the SIEM, and a MAP message every ten seconds. The
+// declarations are pulled again every intersectionRefresh.
+func runIntersections() {
+	intersections, _ := fetchIntersections()
+	spatTicker := time.NewTicker(time.Second)
+	refreshTicker := time.NewTicker(intersectionRefresh)
+	defer spatTicker.Stop()
+	defer refreshTicker.Stop()
+
+	spats := 0
+	for {
+		select {
+		case <-refreshTicker.C:
+			if refreshed, ok := fetchIntersections(); ok {
+				intersections = refreshed
+			}
+		case now := <-spatTicker.C:
+			for _, in := range intersections {
+				if spats%mapEverySPaTs == 0 {
+					sendEvent(mapEvent(in, now))
+				}
+				sendEvent(spatEvent(in, now))
+			}
+			spats++
+		}
+	}
+}
+
+// fetchIntersections pulls the enabled synthetic intersections, reporting
+// false when the SIEM could not be asked
+func fetchIntersections() ([]eventschema.Intersection, bool) {
+	req, err := http.NewRequest(http.MethodGet, siemAPIURL+"/simulator/intersections", nil)
+	if err != nil {
+		log.Printf("Error creating intersection request: %v", err)
+		return nil, false
+	}
+	if ingestToken != "" {
+		req.Header.Set("X-Ingest-Token", ingestToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("Error fetching intersections: %v", err)
+		return nil, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Error response fetching intersections: %d", resp.StatusCode)
+		return nil, false
+	}
+
+	var intersections []eventschema.Intersection
+	if err := json.NewDecoder(resp.Body).Decode(&intersections); err != nil {
+		log.Printf("Error decoding intersections: %v", err)
+		return nil, false
+	}
+	names := make([]string, len(intersections))
+	for i, in := range intersections {
+		names[i] = fmt.Sprintf("%d (%s)", in.IntersectionID, in.Name)
+	}
+	log.Printf("Simulating %d intersections: %s", len(intersections), strings.Join(names, ", "))
+	return intersections, true
+}
+
+// intersectionDetails are the V2X fields shared by the SPaT, MAP and SSM
+// messages of an intersection, sent by the roadside unit at its center
+func intersectionDetails(in eventschema.Intersection, messageType string) eventschema.V2XDetails {
+	return eventschema.V2XDetails{
+		NetworkDetails: eventschema.NetworkDetails{
+			SourceIP: fmt.Sprintf("10.20.%d.%d", in.IntersectionID>>8&255, in.IntersectionID&255),
+		},
+		VehicleID:      fmt.Sprintf("RSU-INT-%d", in.IntersectionID), // sender station ID
+		MessageType:    messageType,
+		Radio:          eventschema.RadioDSRC,
+		Location:       &eventschema.Location{Lat: in.Latitude, Lon: in.Longitude},
+		IntersectionID: in.IntersectionID,
+	}
+}
+
+// spatEvent is the SPaT message of an intersection at an instant, carrying the signal states its timing plans prescribe
+func spatEvent(in eventschema.Intersection, now time.Time) Event {
+	details := intersectionDetails(in, eventschema.MessageSPaT)
+	details.SignalStates = in.SignalStates(now)
+
+	return Event{
+		SourceName: "v2x",
+		SourceType: "v2x",
+		Timestamp:  now,
+		Severity:   SeverityInfo,
+		Category:   CategoryV2X,
+		Message:    fmt.Sprintf("V2X SPaT message from intersection %d", in.IntersectionID),
+		Details:    details,
+	}
+}
+
+// mapEvent is the MAP message describing the approaches of an intersection
+func mapEvent(in eventschema.Intersection, now time.Time) Event {
+	details := intersectionDetails(in, eventschema.MessageMAP)
+	details.Approaches = in.Approaches
+
+	return Event{
+		SourceName: "v2x",
+		SourceType: "v2x",
+		Timestamp:  now,
+		Severity:   SeverityInfo,
+		Category:   CategoryV2X,
+		Message:    fmt.Sprintf("V2X MAP message from intersection %d", in.IntersectionID),
+		Details:    details,
+	}
+}
@@ -3,52 +3,63 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
 	"strings"
 	"time"
+
+	"traffic-monitoring-go/app/eventschema"
 )
 
 // Configuration parameters
 var (
-	siemAPIURL           string
-	eventsPerMinute      int
-	enableAttackSim      bool
-	attackFrequency      int
-	includeV2XEvents     bool
+	siemAPIURL               string
+	ingestToken              string
+	ingestAPIKey             string
+	eventsPerMinute          int
+	enableAttackSim          bool
+	attackFrequency          int
+	includeV2XEvents         bool
+	simulateIntersections    bool
+	intersectionRefresh      time.Duration
+	contractMode             bool
+	replayFile               string
+	replaySpeed              float64
+	replayShiftTimestamps    bool
+	simulateTraffic          bool
+	trafficVehicles          int
+	trafficEmergencyVehicles int
+	roadNetworkFile          string
+	bsmInterval              time.Duration
+	injection                attackInjection
 )
 
-// Event severity levels
+// Event severity levels and categories, shared with the SIEM
 const (
-	SeverityCritical = "critical"
-	SeverityHigh     = "high"
-	SeverityMedium   = "medium"
-	SeverityLow      = "low"
-	SeverityInfo     = "info"
-)
+	SeverityCritical = eventschema.SeverityCritical
+	SeverityHigh     = eventschema.SeverityHigh
+	SeverityMedium   = eventschema.SeverityMedium
+	SeverityLow      = eventschema.SeverityLow
+	SeverityInfo     = eventschema.SeverityInfo
 
-// Event categories
-const (
-	CategoryAuthentication = "authentication"
-	CategoryAuthorization  = "authorization"
-	CategoryNetwork        = "network"
-	CategoryMalware        = "malware"
-	CategorySystem         = "system"
-	CategoryVehicle        = "vehicle"
-	CategoryV2X            = "v2x"
+	CategoryAuthentication = eventschema.CategoryAuthentication
+	CategoryAuthorization  = eventschema.CategoryAuthorization
+	CategoryNetwork        = eventschema.CategoryNetwork
+	CategoryMalware        = eventschema.CategoryMalware
+	CategorySystem         = eventschema.CategorySystem
+	CategoryVehicle        = eventschema.CategoryVehicle
+	CategoryV2X            = eventschema.CategoryV2X
 )
 
-// Event represents a security event
-type Event struct {
-	SourceName string                 `json:"source_name"`
-	SourceType string                 `json:"source_type"`
-	Timestamp  time.Time              `json:"timestamp"`
-	Severity   string                 `json:"severity"`
-	Category   string                 `json:"category"`
-	Message    string                 `json:"message"`
-	Details    map[string]interface{} `json:"details"`
+// Event is the ingest request body, with typed details from eventschema
+type Event = eventschema.Event
+
+// randomLocation returns a point in the simulated area of San Francisco
+func randomLocation() *eventschema.Location {
+	return &eventschema.Location{Lat: 37.7749 + rand.Float64()*0.02, Lon: -122.4194 + rand.Float64()*0.02}
 }
 
 func main() {
@@ -64,6 +75,9 @@ func main() {
 	log.Printf("Attack simulation enabled: %t", enableAttackSim)
 	log.Printf("Attack frequency: %d minutes", attackFrequency)
 	log.Printf("V2X events included: %t", includeV2XEvents)
+	log.Printf("Intersection simulation enabled: %t", simulateIntersections)
+	log.Printf("Traffic simulation enabled: %t", simulateTraffic)
+	log.Printf("Attack injection enabled: %t", injection.enabled())
 
 	// Start the data generator
 	log.Printf("Starting data generator. Sending to %s", siemAPIURL)
@@ -80,6 +94,26 @@ func main() {
 
 	log.Println("SIEM is available! Starting to send events...")
 
+	// Send one payload of every type and exit, for the contract tests
+	if contractMode {
+		os.Exit(runContract())
+	}
+
+	// Replay an exported event dump and exit, for load tests and bug reproduction
+	if replayFile != "" {
+		os.Exit(runReplay())
+	}
+
+	// Broadcast SPaT and MAP for the intersections declared in the SIEM
+	if simulateIntersections {
+		go runIntersections()
+	}
+
+	// Drive vehicles along the road network, broadcasting their BSMs
+	if simulateTraffic {
+		go runTraffic()
+	}
+
 	// Set up ticker for normal events
 	interval := time.Minute / time.Duration(eventsPerMinute)
 	eventTicker := time.NewTicker(interval)
@@ -116,6 +150,13 @@ func loadConfig() {
 	// Remove trailing slash if present
 	siemAPIURL = strings.TrimSuffix(siemAPIURL, "/")
 
+	// Shared token the SIEM accepts for ingestion
+	ingestToken = os.Getenv("INGEST_API_TOKEN")
+	// Log source API key, which the SIEM requires unless
+	// INGEST_REQUIRE_API_KEYS=false; every event sent with it is stored under
+	// its log source
+	ingestAPIKey = os.Getenv("INGEST_API_KEY")
+
 	// Get events per minute
 	eventsPerMinuteStr := os.Getenv("EVENTS_PER_MINUTE")
 	if eventsPerMinuteStr == "" {
@@ -145,6 +186,63 @@ func loadConfig() {
 	// Get V2X events setting
 	includeV2XEventsStr := os.Getenv("INCLUDE_V2X_EVENTS")
 	includeV2XEvents = strings.ToLower(includeV2XEventsStr) == "true"
+
+	// Get intersection simulation settings
+	simulateIntersections = strings.ToLower(os.Getenv("SIMULATE_INTERSECTIONS")) == "true"
+	refreshSeconds := 60 // Default: pull the declared intersections every minute
+	if refreshStr := os.Getenv("INTERSECTION_REFRESH_SECONDS"); refreshStr != "" {
+		fmt.Sscanf(refreshStr, "%d", &refreshSeconds)
+		if refreshSeconds < 1 {
+			refreshSeconds = 1
+		}
+	}
+	intersectionRefresh = time.Duration(refreshSeconds) * time.Second
+
+	// Get traffic simulation settings
+	simulateTraffic = strings.ToLower(os.Getenv("SIMULATE_TRAFFIC")) == "true"
+	trafficVehicles = 10 // Default: 10 vehicles
+	if vehiclesStr := os.Getenv("TRAFFIC_VEHICLES"); vehiclesStr != "" {
+		fmt.Sscanf(vehiclesStr, "%d", &trafficVehicles)
+		if trafficVehicles < 1 {
+			trafficVehicles = 1
+		}
+	}
+	trafficEmergencyVehicles = 1 // Default: one of them requests signal priority
+	if emergencyStr := os.Getenv("TRAFFIC_EMERGENCY_VEHICLES"); emergencyStr != "" {
+		fmt.Sscanf(emergencyStr, "%d", &trafficEmergencyVehicles)
+		if trafficEmergencyVehicles < 0 {
+			trafficEmergencyVehicles = 0
+		}
+	}
+	roadNetworkFile = os.Getenv("ROAD_NETWORK_FILE") // GeoJSON or .osm; a built-in grid when unset
+	intervalMs := 1000 // Default: one BSM per vehicle every second
+	if intervalStr := os.Getenv("BSM_INTERVAL_MS"); intervalStr != "" {
+		fmt.Sscanf(intervalStr, "%d", &intervalMs)
+		if intervalMs < 100 {
+			intervalMs = 100 // the 10 Hz of J2735 BSMs
+		}
+	}
+	bsmInterval = time.Duration(intervalMs) * time.Millisecond
+
+	// Get attack injection settings, forged into the simulated traffic
+	injection = loadAttackInjection()
+	if injection.enabled() && !simulateTraffic {
+		log.Println("Attack injection needs SIMULATE_TRAFFIC=true, no attack will be injected")
+	}
+
+	// Get contract mode setting
+	contractMode = strings.ToLower(os.Getenv("CONTRACT_MODE")) == "true"
+
+	// Get replay settings
+	replayFile = os.Getenv("REPLAY_FILE")
+	replaySpeed = 1 // Default: the original pace
+	if speedStr := os.Getenv("REPLAY_SPEED"); speedStr != "" {
+		fmt.Sscanf(speedStr, "%g", &replaySpeed)
+		if replaySpeed < 0 {
+			replaySpeed = 0 // as fast as possible
+		}
+	}
+	replayShiftTimestamps = strings.ToLower(os.Getenv("REPLAY_KEEP_TIMESTAMPS")) != "true"
 }
 
 // isSIEMAvailable checks if the SIEM API is available
@@ -180,21 +278,38 @@ func generateRandomEvent() Event {
 	}
 	
 	category := categories[rand.Intn(len(categories))]
+	messageType := v2xMessageTypes[rand.Intn(len(v2xMessageTypes))]
+
+	return generateEvent(severity, category, messageType)
+}
 
+// v2xMessageTypes are the message types of the V2X events sent between attacks
+var v2xMessageTypes = []string{
+	eventschema.MessageBasicSafety,
+	eventschema.MessageEmergencyVehicle,
+	eventschema.MessageRoadworkWarning,
+	eventschema.MessageTrafficSignal,
+	eventschema.MessageHazard,
+}
+
+// generateEvent creates a security event of a category with random details;
+// messageType is the message type of V2X events
+func generateEvent(severity, category, messageType string) Event {
 	// Generate event details based on category
 	sourceIP := fmt.Sprintf("192.168.%d.%d", rand.Intn(10), rand.Intn(254)+1)
 	sourcePort := 1024 + rand.Intn(64510)
 	destIP := fmt.Sprintf("10.0.%d.%d", rand.Intn(10), rand.Intn(254)+1)
 	destPort := []int{22, 80, 443, 3306, 5432, 8080, 8443}[rand.Intn(7)]
 	
-	details := map[string]interface{}{
-		"source_ip":        sourceIP,
-		"source_port":      sourcePort,
-		"destination_ip":   destIP,
-		"destination_port": destPort,
+	network := eventschema.NetworkDetails{
+		SourceIP:        sourceIP,
+		SourcePort:      sourcePort,
+		DestinationIP:   destIP,
+		DestinationPort: destPort,
 	}
 	
 	// Add category-specific details
+	var details interface{} = network
 	message := ""
 	sourceType := "system"
 	
@@ -205,8 +320,8 @@ func generateRandomEvent() Event {
 		status := []string{"success", "failure"}[rand.Intn(2)]
 		sourceType = "authentication"
 		
-		details["username"] = username
-		details["status"] = status
+		network.Status = status
+		details = eventschema.AuthenticationDetails{NetworkDetails: network, Username: username}
 		
 		if status == "success" {
 			message = fmt.Sprintf("User %s successfully authenticated from %s", username, sourceIP)
@@ -221,8 +336,9 @@ func generateRandomEvent() Event {
 		action := actions[rand.Intn(len(actions))]
 		sourceType = "firewall"
 		
-		details["protocol"] = protocol
-		details["action"] = action
+		network.Protocol = protocol
+		network.Action = action
+		details = network
 		
 		message = fmt.Sprintf("%s connection from %s:%d to %s:%d %s", 
 			protocol, sourceIP, sourcePort, destIP, destPort, action)
@@ -234,8 +350,7 @@ func generateRandomEvent() Event {
 		filename := filenames[rand.Intn(len(filenames))]
 		sourceType = "antivirus"
 		
-		details["malware_type"] = malwareType
-		details["filename"] = filename
+		details = eventschema.MalwareDetails{NetworkDetails: network, MalwareType: malwareType, Filename: filename}
 		
 		message = fmt.Sprintf("Detected %s in file %s from host %s", malwareType, filename, sourceIP)
 		
@@ -246,8 +361,7 @@ func generateRandomEvent() Event {
 		service := services[rand.Intn(len(services))]
 		sourceType = "system"
 		
-		details["event_type"] = eventType
-		details["service"] = service
+		details = eventschema.SystemDetails{NetworkDetails: network, EventType: eventType, Service: service}
 		
 		message = fmt.Sprintf("System event: %s - %s on %s", eventType, service, sourceIP)
 		
@@ -258,23 +372,34 @@ func generateRandomEvent() Event {
 		component := componentTypes[rand.Intn(len(componentTypes))]
 		sourceType = "vehicle"
 		
-		details["vehicle_id"] = vehicleID
-		details["component"] = component
-		details["location"] = fmt.Sprintf("%f,%f", 37.7749+rand.Float64()*0.02, -122.4194+rand.Float64()*0.02)
+		details = eventschema.VehicleDetails{
+			NetworkDetails: network,
+			VehicleID:      vehicleID,
+			Component:      component,
+			Location:       randomLocation(),
+		}
 		
 		message = fmt.Sprintf("Vehicle %s reported %s %s event", vehicleID, severity, component)
 		
 	case CategoryV2X:
-		messageTypes := []string{"basic_safety", "emergency_vehicle", "roadwork_warning", "traffic_signal", "hazard"}
-		messageType := messageTypes[rand.Intn(len(messageTypes))]
 		vehicleIDs := []string{"VEH001", "VEH002", "VEH003", "VEH004", "VEH005"}
 		vehicleID := vehicleIDs[rand.Intn(len(vehicleIDs))]
 		sourceType = "v2x"
 		
-		details["vehicle_id"] = vehicleID
-		details["message_type"] = messageType
-		details["location"] = fmt.Sprintf("%f,%f", 37.7749+rand.Float64()*0.02, -122.4194+rand.Float64()*0.02)
-		details["speed"] = 35 + rand.Intn(30)
+		radios := []string{eventschema.RadioDSRC, eventschema.RadioCV2X}
+		v2x := eventschema.V2XDetails{
+			NetworkDetails: network,
+			VehicleID:      vehicleID,
+			MessageType:    messageType,
+			Radio:          radios[rand.Intn(len(radios))],
+			Location:       randomLocation(),
+			Speed:          eventschema.Float(float64(35 + rand.Intn(30))),
+		}
+		if eventschema.IsDENM(messageType) {
+			// DENMs declare the radius within which receivers should react
+			v2x.RelevanceRadiusM = 200 + 100*rand.Intn(4)
+		}
+		details = v2x
 		
 		message = fmt.Sprintf("V2X %s message from vehicle %s", messageType, vehicleID)
 	}
@@ -290,10 +415,18 @@ func generateRandomEvent() Event {
 	}
 }
 
+// attackTypes are the simulated attacks, v2x_spoofing last
+var attackTypes = []string{"brute_force", "port_scan", "malware_spread", "v2x_spoofing"}
+
+// attackStep is one event of an attack scenario and the pause before the next
+type attackStep struct {
+	Event Event
+	Pause time.Duration
+}
+
 // generateAttackScenario simulates an attack by sending a series of related events
 func generateAttackScenario() {
 	// Choose attack type
-	attackTypes := []string{"brute_force", "port_scan", "malware_spread", "v2x_spoofing"}
 	attackType := attackTypes[rand.Intn(len(attackTypes))]
 	
 	// If V2X events are disabled, don't use v2x_spoofing attack
@@ -301,15 +434,25 @@ func generateAttackScenario() {
 		attackType = attackTypes[rand.Intn(len(attackTypes)-1)]
 	}
 	
-	// Common attack details
-	attackerIP := fmt.Sprintf("45.%d.%d.%d", rand.Intn(255), rand.Intn(255), rand.Intn(255))
-	targetIP := fmt.Sprintf("10.0.%d.%d", rand.Intn(10), rand.Intn(254)+1)
-	
 	// Number of events in the attack
 	eventCount := 5 + rand.Intn(10)
 	
 	log.Printf("Generating %s attack scenario with %d events", attackType, eventCount)
 	
+	for _, step := range attackScenario(attackType, eventCount) {
+		step.Event.Timestamp = time.Now()
+		sendEvent(step.Event)
+		time.Sleep(step.Pause)
+	}
+}
+
+// attackScenario builds the events of an attack, stamped with the current time
+func attackScenario(attackType string, eventCount int) []attackStep {
+	// Common attack details
+	attackerIP := fmt.Sprintf("45.%d.%d.%d", rand.Intn(255), rand.Intn(255), rand.Intn(255))
+	targetIP := fmt.Sprintf("10.0.%d.%d", rand.Intn(10), rand.Intn(254)+1)
+	
+	var steps []attackStep
 	switch attackType {
 	case "brute_force":
 		// Simulate brute force authentication attack
@@ -324,16 +467,14 @@ func generateAttackScenario() {
 				Severity:   SeverityMedium,
 				Category:   CategoryAuthentication,
 				Message:    fmt.Sprintf("Failed authentication attempt for user %s from %s", username, attackerIP),
-				Details: map[string]interface{}{
-					"username":       username,
-					"source_ip":      attackerIP,
-					"status":         "failure",
-					"attempt_number": i + 1,
-					"attack":         "brute_force",
+				Details: eventschema.AuthenticationDetails{
+					NetworkDetails: eventschema.NetworkDetails{SourceIP: attackerIP, Status: "failure"},
+					AttackDetails:  eventschema.AttackDetails{Attack: "brute_force"},
+					Username:       username,
+					AttemptNumber:  i + 1,
 				},
 			}
-			sendEvent(event)
-			time.Sleep(time.Millisecond * time.Duration(500+rand.Intn(500)))
+			steps = append(steps, attackStep{Event: event, Pause: time.Millisecond * time.Duration(500+rand.Intn(500))})
 		}
 		
 		// Final successful login
@@ -344,15 +485,14 @@ func generateAttackScenario() {
 			Severity:   SeverityCritical,
 			Category:   CategoryAuthentication,
 			Message:    fmt.Sprintf("Successful authentication for user %s after multiple failures from %s", username, attackerIP),
-			Details: map[string]interface{}{
-				"username":        username,
-				"source_ip":       attackerIP,
-				"status":          "success",
-				"previous_failed": eventCount - 1,
-				"attack":          "brute_force",
+			Details: eventschema.AuthenticationDetails{
+				NetworkDetails: eventschema.NetworkDetails{SourceIP: attackerIP, Status: "success"},
+				AttackDetails:  eventschema.AttackDetails{Attack: "brute_force"},
+				Username:       username,
+				PreviousFailed: eventCount - 1,
 			},
 		}
-		sendEvent(event)
+		steps = append(steps, attackStep{Event: event})
 		
 	case "port_scan":
 		// Simulate port scanning
@@ -367,18 +507,19 @@ func generateAttackScenario() {
 				Severity:   SeverityHigh,
 				Category:   CategoryNetwork,
 				Message:    fmt.Sprintf("Port scan detected from %s to %s:%d", attackerIP, targetIP, port),
-				Details: map[string]interface{}{
-					"source_ip":        attackerIP,
-					"source_port":      rand.Intn(65535),
-					"destination_ip":   targetIP,
-					"destination_port": port,
-					"protocol":         "TCP",
-					"action":           "block",
-					"attack":           "port_scan",
+				Details: eventschema.FirewallDetails{
+					NetworkDetails: eventschema.NetworkDetails{
+						SourceIP:        attackerIP,
+						SourcePort:      1 + rand.Intn(65535),
+						DestinationIP:   targetIP,
+						DestinationPort: port,
+						Protocol:        "TCP",
+						Action:          "block",
+					},
+					AttackDetails: eventschema.AttackDetails{Attack: "port_scan"},
 				},
 			}
-			sendEvent(event)
-			time.Sleep(time.Millisecond * time.Duration(100+rand.Intn(200)))
+			steps = append(steps, attackStep{Event: event, Pause: time.Millisecond * time.Duration(100+rand.Intn(200))})
 		}
 		
 	case "malware_spread":
@@ -400,18 +541,16 @@ func generateAttackScenario() {
 			Severity:   SeverityCritical,
 			Category:   CategoryMalware,
 			Message:    fmt.Sprintf("Initial %s infection detected on %s", malwareType, hosts[0]),
-			Details: map[string]interface{}{
-				"malware_type": malwareType,
-				"malware_name": malwareName,
-				"source_ip":    attackerIP,
-				"host":         hosts[0],
-				"filename":     "/tmp/infected.bin",
-				"attack":       "malware_spread",
-				"stage":        "initial_infection",
+			Details: eventschema.MalwareDetails{
+				NetworkDetails: eventschema.NetworkDetails{SourceIP: attackerIP},
+				AttackDetails:  eventschema.AttackDetails{Attack: "malware_spread", Stage: "initial_infection"},
+				MalwareType:    malwareType,
+				MalwareName:    malwareName,
+				Host:           hosts[0],
+				Filename:       "/tmp/infected.bin",
 			},
 		}
-		sendEvent(event)
-		time.Sleep(time.Second * time.Duration(1+rand.Intn(2)))
+		steps = append(steps, attackStep{Event: event, Pause: time.Second * time.Duration(1+rand.Intn(2))})
 		
 		// Spreading across systems
 		for i := 1; i < len(hosts); i++ {
@@ -422,26 +561,23 @@ func generateAttackScenario() {
 				Severity:   SeverityHigh,
 				Category:   CategoryMalware,
 				Message:    fmt.Sprintf("%s spreading to %s from %s", malwareName, hosts[i], hosts[i-1]),
-				Details: map[string]interface{}{
-					"malware_type":     malwareType,
-					"malware_name":     malwareName,
-					"source_ip":        hosts[i-1],
-					"destination_ip":   hosts[i],
-					"filename":         "/tmp/infected.bin",
-					"attack":           "malware_spread",
-					"stage":            "propagation",
-					"propagation_path": i,
+				Details: eventschema.MalwareDetails{
+					NetworkDetails:  eventschema.NetworkDetails{SourceIP: hosts[i-1], DestinationIP: hosts[i]},
+					AttackDetails:   eventschema.AttackDetails{Attack: "malware_spread", Stage: "propagation"},
+					MalwareType:     malwareType,
+					MalwareName:     malwareName,
+					Filename:        "/tmp/infected.bin",
+					PropagationPath: i,
 				},
 			}
-			sendEvent(event)
-			time.Sleep(time.Second * time.Duration(1+rand.Intn(3)))
+			steps = append(steps, attackStep{Event: event, Pause: time.Second * time.Duration(1+rand.Intn(3))})
 		}
 		
 	case "v2x_spoofing":
 		// Simulate V2X message spoofing
 		vehicleIDs := []string{"VEH001", "VEH002", "VEH003", "VEH004", "VEH005"}
 		attackerVehicle := fmt.Sprintf("UNKNOWN_%X", rand.Intn(0x1000000))
-		messageTypes := []string{"emergency_vehicle", "traffic_signal", "hazard_warning"}
+		messageTypes := []string{eventschema.MessageEmergencyVehicle, eventschema.MessageTrafficSignal, eventschema.MessageHazardWarning}
 		messageType := messageTypes[rand.Intn(len(messageTypes))]
 		
 		// Initial spoofed message
@@ -452,16 +588,14 @@ func generateAttackScenario() {
 			Severity:   SeverityCritical,
 			Category:   CategoryV2X,
 			Message:    fmt.Sprintf("Potentially spoofed V2X %s message detected from unregistered vehicle", messageType),
-			Details: map[string]interface{}{
-				"vehicle_id":   attackerVehicle,
-				"message_type": messageType,
-				"location":     fmt.Sprintf("%f,%f", 37.7749+rand.Float64()*0.02, -122.4194+rand.Float64()*0.02),
-				"attack":       "v2x_spoofing",
-				"stage":        "initial_detection",
+			Details: eventschema.V2XDetails{
+				AttackDetails: eventschema.AttackDetails{Attack: "v2x_spoofing", Stage: "initial_detection"},
+				VehicleID:     attackerVehicle,
+				MessageType:   messageType,
+				Location:      randomLocation(),
 			},
 		}
-		sendEvent(event)
-		time.Sleep(time.Second * time.Duration(1+rand.Intn(2)))
+		steps = append(steps, attackStep{Event: event, Pause: time.Second * time.Duration(1+rand.Intn(2))})
 		
 		// Vehicle responses to spoofed message
 		for i := 0; i < eventCount-1; i++ {
@@ -473,47 +607,68 @@ func generateAttackScenario() {
 				Severity:   SeverityHigh,
 				Category:   CategoryV2X,
 				Message:    fmt.Sprintf("Vehicle %s responding to potentially spoofed message from %s", victimVehicle, attackerVehicle),
-				Details: map[string]interface{}{
-					"vehicle_id":        victimVehicle,
-					"message_type":      "response",
-					"malicious_source":  attackerVehicle,
-					"location":          fmt.Sprintf("%f,%f", 37.7749+rand.Float64()*0.02, -122.4194+rand.Float64()*0.02),
-					"speed_change":      -10 - rand.Intn(20),
-					"attack":            "v2x_spoofing",
-					"stage":             "vehicle_response",
-					"response_sequence": i + 1,
+				Details: eventschema.V2XDetails{
+					AttackDetails:    eventschema.AttackDetails{Attack: "v2x_spoofing", Stage: "vehicle_response"},
+					VehicleID:        victimVehicle,
+					MessageType:      eventschema.MessageResponse,
+					Location:         randomLocation(),
+					MaliciousSource:  attackerVehicle,
+					SpeedChange:      -10 - rand.Intn(20),
+					ResponseSequence: i + 1,
 				},
 			}
-			sendEvent(event)
-			time.Sleep(time.Second * time.Duration(rand.Intn(2)))
+			steps = append(steps, attackStep{Event: event, Pause: time.Second * time.Duration(rand.Intn(2))})
 		}
 	}
+	return steps
 }
 
 // sendEvent sends an event to the SIEM API
 func sendEvent(event Event) {
-	jsonData, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("Error marshaling event: %v", err)
+	if err := postEvent(event); err != nil {
+		log.Printf("Error sending event: %v", err)
 		return
 	}
 	
-	resp, err := http.Post(siemAPIURL+"/ingest", "application/json", strings.NewReader(string(jsonData)))
+	// Successful send
+	if rand.Intn(100) < 5 { // Only log ~5% of events to avoid flooding logs
+		log.Printf("Sent %s %s event: %s", event.Severity, event.Category, event.Message)
+	}
+}
+
+// postEvent posts an event to the SIEM API, returning an error unless the SIEM accepted it
+func postEvent(event Event) error {
+	jsonData, err := json.Marshal(event)
 	if err != nil {
-		log.Printf("Error sending event: %v", err)
-		return
+		return fmt.Errorf("marshaling event: %v", err)
+	}
+	return postPayload(jsonData)
+}
+
+// postPayload posts an ingest request body to the SIEM API, returning an error unless the SIEM accepted it
+func postPayload(jsonData []byte) error {
+	req, err := http.NewRequest(http.MethodPost, siemAPIURL+"/ingest", strings.NewReader(string(jsonData)))
+	if err != nil {
+		return fmt.Errorf("creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ingestAPIKey != "" {
+		req.Header.Set("X-API-Key", ingestAPIKey)
+	} else if ingestToken != "" {
+		req.Header.Set("X-Ingest-Token", ingestToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
 	
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Error response from SIEM: %d", resp.StatusCode)
-		return
-	}
-	
-	// Successful send
-	if rand.Intn(100) < 5 { // Only log ~5% of events to avoid flooding logs
-		log.Printf("Sent %s %s event: %s", event.Severity, event.Category, event.Message)
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("response from SIEM: %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
+	return nil
 }
 
 // weightedRandomChoice selects a random item from choices based on weights
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"traffic-monitoring-go/app/eventschema"
+)
+
+// Signal priority of the traffic simulation: emergency vehicles send SRMs to
+// the declared intersections ahead of them, which answer in SSMs
+const (
+	priorityRange   = 300.0           // meters short of a stop line emergency vehicles request priority from
+	priorityRefresh = time.Second     // between two SRMs of a request, or two SSMs of an intersection
+	priorityTimeout = 3 * time.Second // an intersection drops a request not renewed for this long
+)
+
+// priorityRequest is the content of an SRM
+type priorityRequest struct {
+	requestID   int
+	requestType string
+	role        string
+	approach    int     // approach ID of the MAP
+	eta         float64 // seconds to the stop line
+}
+
+// vehicleRequest is the signal request a vehicle keeps while approaching an intersection
+type vehicleRequest struct {
+	node      int
+	requestID int
+	approach  eventschema.Approach
+	sent      time.Time
+}
+
+// signalRequest is a signal request an intersection received and its answer
+type signalRequest struct {
+	requestID   int
+	role        string
+	signalGroup int
+	status      string
+	renewed     time.Time
+}
+
+// receive records an SRM at an intersection. Emergency vehicles are granted
+// priority at once; the signals keep their timing plans, and granted vehicles
+// proceed through the red.
+func (signal *signalizedNode) receive(requesterID string, request priorityRequest, signalGroup int, now time.Time) {
+	if signal.requests == nil {
+		signal.requests = make(map[string]*signalRequest)
+	}
+	if existing, ok := signal.requests[requesterID]; ok && existing.requestID == request.requestID {
+		existing.renewed = now
+		return
+	}
+	status := eventschema.PriorityProcessing
+	if request.role == eventschema.RoleEmergency {
+		status = eventschema.PriorityGranted
+	}
+	signal.requests[requesterID] = &signalRequest{
+		requestID:   request.requestID,
+		role:        request.role,
+		signalGroup: signalGroup,
+		status:      status,
+		renewed:     now,
+	}
+	signal.changed = true
+}
+
+// cancel removes the request of a requester from an intersection
+func (signal *signalizedNode) cancel(requesterID string) {
+	if _, ok := signal.requests[requesterID]; ok {
+		delete(signal.requests, requesterID)
+		signal.changed = true
+	}
+}
+
+// granted reports whether the intersection of a node granted a vehicle priority
+func (s *trafficSimulation) granted(vehicle *simulatedVehicle, node int) bool {
+	signal, ok := s.signals[node]
+	if !ok {
+		return false
+	}
+	request, ok := signal.requests[vehicle.id]
+	return ok && request.status == eventschema.PriorityGranted
+}
+
+// nextSignal returns the signalized node a vehicle reaches next within
+// meters, the approach it comes in on and the distance to the stop line
+func (s *trafficSimulation) nextSignal(vehicle *simulatedVehicle, meters float64) (int, eventschema.Approach, float64, bool) {
+	if len(vehicle.route) == 0 {
+		return 0, eventschema.Approach{}, 0, false
+	}
+	edges := s.network.edges
+	distance := edges[vehicle.route[0]].length - vehicle.offset
+	for k := 0; k < len(vehicle.route) && distance-trafficStopGap < meters; k++ {
+		edge := edges[vehicle.route[k]]
+		if signal, ok := s.signals[edge.to]; ok {
+			if approach, ok := signal.approachOf(edge); ok {
+				return edge.to, approach, math.Max(distance-trafficStopGap, 0), true
+			}
+		}
+		if k+1 < len(vehicle.route) {
+			distance += edges[vehicle.route[k+1]].length
+		}
+	}
+	return 0, eventschema.Approach{}, 0, false
+}
+
+// requestEvents returns the SRMs of the emergency vehicles: a request when an
+// intersection comes within priorityRange, renewed every priorityRefresh, and
+// its cancellation once the vehicle has passed the intersection
+func (s *trafficSimulation) requestEvents(now time.Time) []Event {
+	var events []Event
+	for _, vehicle := range s.vehicles {
+		if vehicle.role == "" {
+			continue
+		}
+		node, approach, distance, ok := s.nextSignal(vehicle, priorityRange)
+
+		request := vehicle.request
+		if request != nil && (!ok || node != request.node) {
+			if signal, ok := s.signals[request.node]; ok {
+				signal.cancel(vehicle.id)
+				events = append(events, srmEvent(s.bsmEvent(vehicle, now), signal.intersection, priorityRequest{
+					requestID:   request.requestID,
+					requestType: eventschema.RequestCancel,
+					role:        vehicle.role,
+					approach:    request.approach.ID,
+				}))
+			}
+			vehicle.request, request = nil, nil
+		}
+		if !ok {
+			continue
+		}
+
+		requestType := eventschema.RequestUpdate
+		if request == nil {
+			vehicle.requests++
+			request = &vehicleRequest{node: node, requestID: vehicle.requests % 256, approach: approach}
+			vehicle.request = request
+			requestType = eventschema.RequestNew
+		} else if now.Sub(request.sent) < priorityRefresh {
+			continue
+		}
+		request.sent = now
+
+		srm := priorityRequest{
+			requestID:   request.requestID,
+			requestType: requestType,
+			role:        vehicle.role,
+			approach:    approach.ID,
+			eta:         math.Round(distance/math.Max(vehicle.speed, 1)*10) / 10,
+		}
+		signal := s.signals[node]
+		signal.receive(vehicle.id, srm, approach.SignalGroup, now)
+		events = append(events, srmEvent(s.bsmEvent(vehicle, now), signal.intersection, srm))
+	}
+	return events
+}
+
+// statusEvents returns the SSMs of the intersections with requests, sent
+// when a request comes or goes and every priorityRefresh in between
+func (s *trafficSimulation) statusEvents(now time.Time) []Event {
+	var events []Event
+	for _, signal := range s.signals {
+		for requesterID, request := range signal.requests {
+			if now.Sub(request.renewed) > priorityTimeout {
+				delete(signal.requests, requesterID)
+				signal.changed = true
+			}
+		}
+		if len(signal.requests) == 0 || (!signal.changed && now.Sub(signal.statusSent) < priorityRefresh) {
+			continue
+		}
+
+		statuses := make([]eventschema.PriorityStatus, 0, len(signal.requests))
+		for requesterID, request := range signal.requests {
+			statuses = append(statuses, eventschema.PriorityStatus{
+				RequesterID: requesterID,
+				RequestID:   request.requestID,
+				Role:        request.role,
+				SignalGroup: request.signalGroup,
+				Status:      request.status,
+			})
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].RequesterID < statuses[j].RequesterID })
+
+		events = append(events, ssmEvent(signal.intersection, statuses, now))
+		signal.statusSent, signal.changed = now, false
+	}
+	return events
+}
+
+// srmEvent is the SRM a requester sends to an intersection, carrying the
+// position, speed and heading of its BSM
+func srmEvent(bsm Event, in eventschema.Intersection, request priorityRequest) Event {
+	details := bsm.Details.(eventschema.V2XDetails)
+	details.MessageType = eventschema.MessageSRM
+	details.IntersectionID = in.IntersectionID
+	details.RequestID = request.requestID
+	details.RequestType = request.requestType
+	details.RequesterRole = request.role
+	details.InboundApproach = request.approach
+	if request.requestType != eventschema.RequestCancel {
+		details.ETASeconds = eventschema.Float(request.eta)
+	}
+
+	bsm.Message = fmt.Sprintf("V2X SRM %s from %s vehicle %s to intersection %d", request.requestType, request.role, details.VehicleID, in.IntersectionID)
+	bsm.Details = details
+	return bsm
+}
+
+// ssmEvent is the SSM an intersection broadcasts with the status of the requests it holds
+func ssmEvent(in eventschema.Intersection, statuses []eventschema.PriorityStatus, now time.Time) Event {
+	details := intersectionDetails(in, eventschema.MessageSSM)
+	details.PriorityStatuses = statuses
+
+	return Event{
+		SourceName: "v2x",
+		SourceType: "v2x",
+		Timestamp:  now,
+		Severity:   SeverityInfo,
+		Category:   CategoryV2X,
+		Message:    fmt.Sprintf("V2X SSM message from intersection %d", in.IntersectionID),
+		Details:    details,
+	}
+}
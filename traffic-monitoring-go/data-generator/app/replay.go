@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxReplayLine bounds an NDJSON line, large enough for events carrying raw V2X payloads
+const maxReplayLine = 4 << 20
+
+// replayEvent is an event of a dump, as the ingest request body it is sent as
+type replayEvent struct {
+	line      int
+	timestamp time.Time // zero when the dump has none; the SIEM stamps it on arrival
+	at        time.Time // when it is sent relative to the others: its timestamp, or the one before it
+	payload   map[string]interface{}
+}
+
+// runReplay sends the events of an exported dump (REPLAY_FILE) to /ingest,
+// spaced as they originally were divided by replaySpeed, and returns the
+// exit status: 0 when the SIEM accepted all of them. Unless
+// REPLAY_KEEP_TIMESTAMPS is set, events are stamped with the time they are
+// sent, so detections over recent events see them.
+func runReplay() int {
+	events, err := readReplayFile(replayFile)
+	if err != nil {
+		log.Printf("Replay: %v", err)
+		return 1
+	}
+	if len(events) == 0 {
+		log.Printf("Replay: %s has no events", replayFile)
+		return 1
+	}
+
+	// Dumps are often newest first; replay them in the order they happened
+	var previous time.Time
+	for i := range events {
+		if !events[i].timestamp.IsZero() {
+			previous = events[i].timestamp
+		}
+		events[i].at = previous
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].at.Before(events[j].at)
+	})
+
+	var first time.Time
+	for _, event := range events {
+		if !event.at.IsZero() {
+			first = event.at
+			break
+		}
+	}
+	start := time.Now()
+	if replayShiftTimestamps && !first.IsZero() {
+		log.Printf("Replay: %d events from %s, shifted to start now", len(events), first.Format(time.RFC3339))
+	} else {
+		log.Printf("Replay: %d events from %s", len(events), replayFile)
+	}
+
+	failed := 0
+	var maxLag time.Duration
+	for i, event := range events {
+		if !event.at.IsZero() {
+			// events are stamped when they are due, at the replay pace
+			due := time.Now()
+			if replaySpeed > 0 {
+				due = start.Add(time.Duration(float64(event.at.Sub(first)) / replaySpeed))
+				if wait := time.Until(due); wait > 0 {
+					time.Sleep(wait)
+				} else if -wait > maxLag {
+					maxLag = -wait
+				}
+			}
+			if replayShiftTimestamps && !event.timestamp.IsZero() {
+				event.payload["timestamp"] = due.UTC().Format(time.RFC3339Nano)
+			}
+		}
+
+		body, err := json.Marshal(event.payload)
+		if err == nil {
+			err = postPayload(body)
+		}
+		if err != nil {
+			log.Printf("Replay: event on line %d rejected: %v", event.line, err)
+			failed++
+		}
+		if (i+1)%1000 == 0 {
+			log.Printf("Replay: sent %d of %d events", i+1, len(events))
+		}
+	}
+
+	log.Printf("Replay: sent %d events in %s, at most %s behind schedule", len(events), time.Since(start).Round(time.Millisecond), maxLag.Round(time.Millisecond))
+	if failed > 0 {
+		log.Printf("Replay: %d events rejected", failed)
+		return 1
+	}
+	return 0
+}
+
+// readReplayFile reads a dump as CSV when its name ends in .csv, as NDJSON otherwise
+func readReplayFile(path string) ([]replayEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return readReplayCSV(file)
+	}
+	return readReplayNDJSON(file)
+}
+
+// readReplayNDJSON reads one event per line: an ingest request body, or a
+// stored security event whose raw_data holds the body it was ingested from
+func readReplayNDJSON(r io.Reader) ([]replayEvent, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayLine)
+
+	var events []replayEvent
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		event, err := replayPayload(record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		event.line = line
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// readReplayCSV reads a header row and one event per row. The columns of the
+// ingest schema (timestamp, source_name, source_type, severity, category,
+// message, and details or raw_data as JSON) are used as such; any other
+// column is added to the details.
+func readReplayCSV(r io.Reader) ([]replayEvent, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading the CSV header: %v", err)
+	}
+
+	var events []replayEvent
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record := make(map[string]interface{})
+		details := make(map[string]interface{})
+		for i, column := range header {
+			if i >= len(row) || row[i] == "" {
+				continue
+			}
+			column = strings.TrimSpace(column)
+			switch column {
+			case "timestamp", "source_name", "source_type", "severity", "category", "message", "raw_data":
+				record[column] = row[i]
+			case "details":
+				if err := json.Unmarshal([]byte(row[i]), &details); err != nil {
+					return nil, fmt.Errorf("line %d: details: %v", line, err)
+				}
+			default:
+				details[column] = csvValue(row[i])
+			}
+		}
+		if len(details) > 0 {
+			record["details"] = details
+		}
+
+		event, err := replayPayload(record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		event.line = line
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// csvValue keeps numbers numeric, as the ingester reads ports from details as numbers
+func csvValue(value string) interface{} {
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return number
+	}
+	return value
+}
+
+// replayPayload turns a record of a dump into the ingest request body to send
+func replayPayload(record map[string]interface{}) (replayEvent, error) {
+	var event replayEvent
+	if value, ok := record["timestamp"].(string); ok && value != "" {
+		timestamp, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return event, fmt.Errorf("invalid timestamp %q, use RFC3339", value)
+		}
+		event.timestamp = timestamp
+	}
+
+	// A stored event keeps the body it was ingested from
+	if rawData, ok := record["raw_data"].(string); ok {
+		var payload map[string]interface{}
+		if json.Unmarshal([]byte(rawData), &payload) == nil {
+			if value, ok := payload["timestamp"].(string); ok && event.timestamp.IsZero() {
+				event.timestamp, _ = time.Parse(time.RFC3339Nano, value)
+			} else if !ok && !event.timestamp.IsZero() {
+				payload["timestamp"] = event.timestamp.Format(time.RFC3339Nano)
+			}
+			event.payload = payload
+			return event, nil
+		}
+	}
+
+	payload := make(map[string]interface{})
+	for _, field := range []string{"timestamp", "source_name", "source_type", "severity", "category", "message", "details"} {
+		if value, ok := record[field]; ok {
+			payload[field] = value
+		}
+	}
+	// Stored events name their source through the log source they were attributed to
+	if logSource, ok := record["log_source"].(map[string]interface{}); ok {
+		if _, ok := payload["source_name"]; !ok {
+			payload["source_name"] = logSource["name"]
+		}
+		if _, ok := payload["source_type"]; !ok {
+			payload["source_type"] = logSource["type"]
+		}
+	}
+	if _, ok := payload["message"]; !ok {
+		return event, fmt.Errorf("event without message")
+	}
+	event.payload = payload
+	return event, nil
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	metersPerDegree     = 111320.0
+	defaultSpeedLimitKH = 50.0 // km/h, for roads that do not declare one
+)
+
+// roadNode is a point where roads meet or bend
+type roadNode struct {
+	lat, lon float64
+	out      []int // edges leaving the node
+}
+
+// roadEdge is a straight stretch of road driven in one direction
+type roadEdge struct {
+	from, to   int
+	name       string
+	length     float64 // meters
+	heading    float64 // degrees clockwise from north
+	speedLimit float64 // m/s
+}
+
+// roadNetwork is the directed graph simulated vehicles drive on, with the
+// nodes their routes go between
+type roadNetwork struct {
+	nodes     []roadNode
+	edges     []roadEdge
+	waypoints []int
+	index     map[[2]int64]int // nodes by rounded coordinates, so roads sharing a point connect
+}
+
+func newRoadNetwork() *roadNetwork {
+	return &roadNetwork{index: make(map[[2]int64]int)}
+}
+
+// node returns the node at a coordinate, adding it when there is none within about 10 cm
+func (n *roadNetwork) node(lat, lon float64) int {
+	key := [2]int64{int64(math.Round(lat * 1e6)), int64(math.Round(lon * 1e6))}
+	if id, ok := n.index[key]; ok {
+		return id
+	}
+	n.nodes = append(n.nodes, roadNode{lat: lat, lon: lon})
+	n.index[key] = len(n.nodes) - 1
+	return len(n.nodes) - 1
+}
+
+// addRoad adds a road through points ([lat, lon]), in both directions unless oneway
+func (n *roadNetwork) addRoad(name string, points [][2]float64, speedLimitKH float64, oneway bool) {
+	if speedLimitKH <= 0 {
+		speedLimitKH = defaultSpeedLimitKH
+	}
+	for i := 1; i < len(points); i++ {
+		from, to := n.node(points[i-1][0], points[i-1][1]), n.node(points[i][0], points[i][1])
+		if from == to {
+			continue
+		}
+		n.addEdge(from, to, name, speedLimitKH/3.6)
+		if !oneway {
+			n.addEdge(to, from, name, speedLimitKH/3.6)
+		}
+	}
+}
+
+func (n *roadNetwork) addEdge(from, to int, name string, speedLimit float64) {
+	a, b := n.nodes[from], n.nodes[to]
+	n.edges = append(n.edges, roadEdge{
+		from:       from,
+		to:         to,
+		name:       name,
+		length:     distanceMeters(a.lat, a.lon, b.lat, b.lon),
+		heading:    bearing(a.lat, a.lon, b.lat, b.lon),
+		speedLimit: speedLimit,
+	})
+	n.nodes[from].out = append(n.nodes[from].out, len(n.edges)-1)
+}
+
+// position is the coordinate at offset meters along an edge
+func (n *roadNetwork) position(edge int, offset float64) (float64, float64) {
+	e := n.edges[edge]
+	a, b := n.nodes[e.from], n.nodes[e.to]
+	f := offset / e.length
+	return a.lat + (b.lat-a.lat)*f, a.lon + (b.lon-a.lon)*f
+}
+
+// route returns the fastest edges from one node to another at the speed
+// limits, nil when the destination cannot be reached
+func (n *roadNetwork) route(from, to int) []int {
+	if from == to {
+		return nil
+	}
+	seconds := make([]float64, len(n.nodes))
+	via := make([]int, len(n.nodes))
+	for i := range seconds {
+		seconds[i], via[i] = math.Inf(1), -1
+	}
+	seconds[from] = 0
+	queue := &routeQueue{{node: from}}
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(routeEntry)
+		if current.node == to {
+			break
+		}
+		if current.seconds > seconds[current.node] {
+			continue
+		}
+		for _, edge := range n.nodes[current.node].out {
+			e := n.edges[edge]
+			if t := current.seconds + e.length/e.speedLimit; t < seconds[e.to] {
+				seconds[e.to], via[e.to] = t, edge
+				heap.Push(queue, routeEntry{node: e.to, seconds: t})
+			}
+		}
+	}
+	if via[to] < 0 {
+		return nil
+	}
+
+	var edges []int
+	for node := to; node != from; node = n.edges[via[node]].from {
+		edges = append([]int{via[node]}, edges...)
+	}
+	return edges
+}
+
+type routeEntry struct {
+	node    int
+	seconds float64
+}
+
+// routeQueue is a min-heap of nodes by travel time
+type routeQueue []routeEntry
+
+func (q routeQueue) Len() int            { return len(q) }
+func (q routeQueue) Less(i, j int) bool  { return q[i].seconds < q[j].seconds }
+func (q routeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *routeQueue) Push(x interface{}) { *q = append(*q, x.(routeEntry)) }
+func (q *routeQueue) Pop() interface{} {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// loadRoadNetwork reads a road network from a GeoJSON file or an OSM XML
+// extract (.osm), or builds the default grid when path is empty
+func loadRoadNetwork(path string) (*roadNetwork, error) {
+	var network *roadNetwork
+	var err error
+	switch {
+	case path == "":
+		network = defaultRoadNetwork()
+	case strings.EqualFold(filepath.Ext(path), ".osm"):
+		network, err = loadOSM(path)
+	default:
+		network, err = loadGeoJSON(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(network.edges) == 0 {
+		return nil, fmt.Errorf("%s has no roads", path)
+	}
+
+	// without declared waypoints, routes go between dead ends and junctions,
+	// or any nodes vehicles can leave in networks with too few of them
+	if len(network.waypoints) == 0 {
+		neighbors := make([]map[int]bool, len(network.nodes))
+		for i := range neighbors {
+			neighbors[i] = make(map[int]bool)
+		}
+		for _, edge := range network.edges {
+			neighbors[edge.from][edge.to] = true
+			neighbors[edge.to][edge.from] = true
+		}
+		for id, node := range network.nodes {
+			if len(node.out) > 0 && len(neighbors[id]) != 2 {
+				network.waypoints = append(network.waypoints, id)
+			}
+		}
+	}
+	if len(network.waypoints) < 2 {
+		network.waypoints = nil
+		for id, node := range network.nodes {
+			if len(node.out) > 0 {
+				network.waypoints = append(network.waypoints, id)
+			}
+		}
+	}
+	if len(network.waypoints) < 2 {
+		return nil, fmt.Errorf("road network needs at least two nodes vehicles can leave")
+	}
+	return network, nil
+}
+
+// defaultRoadNetwork is a grid of 4 by 4 streets 400 m apart in the simulated
+// area of San Francisco: 50 km/h avenues running north-south and 30 km/h streets
+func defaultRoadNetwork() *roadNetwork {
+	network := newRoadNetwork()
+	const blocks = 3
+	spacingLat := 400 / metersPerDegree
+	spacingLon := 400 / (metersPerDegree * math.Cos(37.7749*math.Pi/180))
+	for i := 0; i <= blocks; i++ {
+		var avenue, street [][2]float64
+		for j := 0; j <= blocks; j++ {
+			avenue = append(avenue, [2]float64{37.7749 + float64(j)*spacingLat, -122.4194 + float64(i)*spacingLon})
+			street = append(street, [2]float64{37.7749 + float64(i)*spacingLat, -122.4194 + float64(j)*spacingLon})
+		}
+		network.addRoad(fmt.Sprintf("Avenue %d", i+1), avenue, 50, false)
+		network.addRoad(fmt.Sprintf("Street %d", i+1), street, 30, false)
+	}
+	return network
+}
+
+// geoJSONFile is a FeatureCollection of roads (LineString and
+// MultiLineString features) and waypoints (Point features)
+type geoJSONFile struct {
+	Features []struct {
+		Geometry struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	} `json:"features"`
+}
+
+// loadGeoJSON reads roads whose properties may give a name, a speed limit as
+// speed_limit_kmh or OSM's maxspeed, and oneway
+func loadGeoJSON(path string) (*roadNetwork, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file geoJSONFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	network := newRoadNetwork()
+	var waypoints [][2]float64
+	for i, feature := range file.Features {
+		name, _ := feature.Properties["name"].(string)
+		speedLimit := speedLimitKH(feature.Properties["speed_limit_kmh"])
+		if speedLimit == 0 {
+			speedLimit = speedLimitKH(feature.Properties["maxspeed"])
+		}
+		oneway := isOneway(feature.Properties["oneway"])
+
+		var lines [][][]float64
+		switch feature.Geometry.Type {
+		case "LineString":
+			var line [][]float64
+			err = json.Unmarshal(feature.Geometry.Coordinates, &line)
+			lines = [][][]float64{line}
+		case "MultiLineString":
+			err = json.Unmarshal(feature.Geometry.Coordinates, &lines)
+		case "Point":
+			var point []float64
+			if err = json.Unmarshal(feature.Geometry.Coordinates, &point); err == nil && len(point) >= 2 {
+				waypoints = append(waypoints, [2]float64{point[1], point[0]})
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: feature %d: %v", path, i, err)
+		}
+
+		for _, line := range lines {
+			points := make([][2]float64, 0, len(line))
+			for _, coordinate := range line {
+				if len(coordinate) >= 2 {
+					points = append(points, [2]float64{coordinate[1], coordinate[0]}) // GeoJSON is lon, lat
+				}
+			}
+			network.addRoad(name, points, speedLimit, oneway)
+		}
+	}
+
+	for _, point := range waypoints {
+		if node, ok := network.nearestNode(point[0], point[1]); ok {
+			network.waypoints = append(network.waypoints, node)
+		}
+	}
+	return network, nil
+}
+
+// drivableHighways are the OSM highway values of roads vehicles drive on
+var drivableHighways = map[string]bool{
+	"motorway": true, "trunk": true, "primary": true, "secondary": true, "tertiary": true,
+	"unclassified": true, "residential": true, "living_street": true, "service": true,
+	"motorway_link": true, "trunk_link": true, "primary_link": true, "secondary_link": true, "tertiary_link": true,
+}
+
+// osmFile is the part of an OSM XML extract roads are read from
+type osmFile struct {
+	Nodes []struct {
+		ID  int64   `xml:"id,attr"`
+		Lat float64 `xml:"lat,attr"`
+		Lon float64 `xml:"lon,attr"`
+	} `xml:"node"`
+	Ways []struct {
+		Refs []struct {
+			Ref int64 `xml:"ref,attr"`
+		} `xml:"nd"`
+		Tags []struct {
+			Key   string `xml:"k,attr"`
+			Value string `xml:"v,attr"`
+		} `xml:"tag"`
+	} `xml:"way"`
+}
+
+// loadOSM reads the drivable ways of an OSM XML extract
+func loadOSM(path string) (*roadNetwork, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file osmFile
+	if err := xml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	coordinates := make(map[int64][2]float64, len(file.Nodes))
+	for _, node := range file.Nodes {
+		coordinates[node.ID] = [2]float64{node.Lat, node.Lon}
+	}
+
+	network := newRoadNetwork()
+	for _, way := range file.Ways {
+		tags := make(map[string]string, len(way.Tags))
+		for _, tag := range way.Tags {
+			tags[tag.Key] = tag.Value
+		}
+		if !drivableHighways[tags["highway"]] {
+			continue
+		}
+
+		points := make([][2]float64, 0, len(way.Refs))
+		for _, ref := range way.Refs {
+			if point, ok := coordinates[ref.Ref]; ok {
+				points = append(points, point)
+			}
+		}
+		if tags["oneway"] == "-1" {
+			for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+				points[i], points[j] = points[j], points[i]
+			}
+		}
+		oneway := isOneway(tags["oneway"]) || tags["oneway"] == "-1" || tags["junction"] == "roundabout"
+		network.addRoad(tags["name"], points, speedLimitKH(tags["maxspeed"]), oneway)
+	}
+	return network, nil
+}
+
+// maxspeedPattern reads OSM maxspeed values such as "50" and "30 mph"
+var maxspeedPattern = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)\s*(mph|km/h|kmh)?\s*$`)
+
+// speedLimitKH reads a speed limit in km/h, 0 when there is none
+func speedLimitKH(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		match := maxspeedPattern.FindStringSubmatch(v)
+		if match == nil {
+			return 0
+		}
+		limit, _ := strconv.ParseFloat(match[1], 64)
+		if match[2] == "mph" {
+			limit *= 1.609344
+		}
+		return limit
+	}
+	return 0
+}
+
+func isOneway(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "yes" || v == "true" || v == "1"
+	}
+	return false
+}
+
+// nearestNode returns the node with outgoing edges closest to a coordinate
+func (n *roadNetwork) nearestNode(lat, lon float64) (int, bool) {
+	nearest, best := -1, math.Inf(1)
+	for id, node := range n.nodes {
+		if len(node.out) == 0 {
+			continue
+		}
+		if d := distanceMeters(lat, lon, node.lat, node.lon); d < best {
+			nearest, best = id, d
+		}
+	}
+	return nearest, nearest >= 0
+}
+
+// distanceMeters is the distance between two nearby coordinates
+func distanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	dy := (lat2 - lat1) * metersPerDegree
+	dx := (lon2 - lon1) * metersPerDegree * math.Cos((lat1+lat2)/2*math.Pi/180)
+	return math.Hypot(dx, dy)
+}
+
+// bearing is the heading from one coordinate to another, in degrees clockwise from north
+func bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	dy := lat2 - lat1
+	dx := (lon2 - lon1) * math.Cos((lat1+lat2)/2*math.Pi/180)
+	return math.Mod(math.Atan2(dx, dy)*180/math.Pi+360, 360)
+}
+
+// headingDifference is the angle between two headings, 0 to 180 degrees
+func headingDifference(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
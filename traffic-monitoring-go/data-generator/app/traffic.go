@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"traffic-monitoring-go/app/eventschema"
+)
+
+// Driving behavior of simulated vehicles, within the bounds of the SIEM's
+// kinematic anomaly detector so their BSMs make a clean baseline
+const (
+	trafficAccel        = 2.0   // m/s², pulling away
+	trafficDecel        = 3.0   // m/s², planned braking for turns, signals and vehicles ahead
+	trafficMaxDecel     = 7.0   // m/s², when a signal or vehicle ahead leaves no room
+	trafficTurnSpeed    = 2.5   // m/s, below the detector's min_turn_speed_mps so turns do not count as yaw
+	trafficTurnAngle    = 30.0  // degrees between edges above which vehicles slow for the turn
+	trafficStopGap      = 5.0   // meters short of a signalized node vehicles stop at
+	trafficFollowGap    = 8.0   // meters kept behind the vehicle ahead
+	trafficLookahead    = 250.0 // meters, beyond the braking distance from motorway speeds
+	trafficSignalRange  = 30.0  // meters between a declared intersection and the node it controls
+	trafficApproachSpan = 45.0  // degrees between an approach heading and the edge entering on it
+	trafficGNSSErrorM   = 1.0
+)
+
+// simulatedVehicle drives routes between waypoints of the road network
+type simulatedVehicle struct {
+	id       string
+	sourceIP string
+	radio    string
+	pace     float64 // share of the speed limit the driver keeps
+	route    []int   // edges ahead, the first being driven
+	offset   float64 // meters along route[0]
+	speed    float64 // m/s
+	node     int     // where the vehicle waits when it has no route
+	role     string  // eventschema.RoleEmergency for vehicles requesting signal priority
+	request  *vehicleRequest
+	requests int // sent so far, numbering the next
+}
+
+// signalizedNode is a declared intersection controlling the traffic entering a node
+type signalizedNode struct {
+	intersection eventschema.Intersection
+	states       map[int]string            // by signal group, at the current step
+	requests     map[string]*signalRequest // signal requests held, by requester ID
+	changed      bool                      // a request came or went since the last SSM
+	statusSent   time.Time
+}
+
+// trafficSimulation moves vehicles along a road network and sends their BSMs
+type trafficSimulation struct {
+	network  *roadNetwork
+	vehicles []*simulatedVehicle
+	signals  map[int]*signalizedNode // by node
+}
+
+// runTraffic sends, every bsmInterval, a BSM for each of trafficVehicles
+// vehicles driving the road network of roadNetworkFile: routes between
+// waypoints at up to the speed limits, slowing for turns and the vehicle
+// ahead and stopping at the red signals of the intersections declared in the
+// SIEM, which are pulled again every intersectionRefresh. The first
+// trafficEmergencyVehicles are emergency vehicles requesting priority from
+// those intersections in SRMs, which they answer in SSMs. The attacks of
+// injection are forged into the messages.
+func runTraffic() {
+	network, err := loadRoadNetwork(roadNetworkFile)
+	if err != nil {
+		log.Printf("Error loading road network, traffic simulation disabled: %v", err)
+		return
+	}
+	log.Printf("Simulating %d vehicles on %d road segments between %d waypoints", trafficVehicles, len(network.edges), len(network.waypoints))
+
+	simulation := newTrafficSimulation(network, trafficVehicles, trafficEmergencyVehicles)
+	if intersections, ok := fetchIntersections(); ok {
+		simulation.setIntersections(intersections)
+	}
+	injector := newAttackInjector(injection)
+
+	stepTicker := time.NewTicker(bsmInterval)
+	refreshTicker := time.NewTicker(intersectionRefresh)
+	defer stepTicker.Stop()
+	defer refreshTicker.Stop()
+
+	for {
+		select {
+		case <-refreshTicker.C:
+			if intersections, ok := fetchIntersections(); ok {
+				simulation.setIntersections(intersections)
+			}
+		case now := <-stepTicker.C:
+			simulation.step(now, bsmInterval.Seconds())
+			for _, vehicle := range simulation.vehicles {
+				for _, event := range injector.inject(vehicle, simulation.bsmEvent(vehicle, now), now) {
+					sendEvent(event)
+				}
+			}
+			for _, event := range injector.cloneEvents(simulation, now) {
+				sendEvent(event)
+			}
+			for _, event := range simulation.requestEvents(now) {
+				sendEvent(event)
+			}
+			for _, event := range injector.preemptionEvents(simulation, now) {
+				sendEvent(event)
+			}
+			for _, event := range simulation.statusEvents(now) {
+				sendEvent(event)
+			}
+		}
+	}
+}
+
+// newTrafficSimulation places vehicles along routes between random
+// waypoints, the first emergency of them emergency vehicles
+func newTrafficSimulation(network *roadNetwork, count, emergency int) *trafficSimulation {
+	s := &trafficSimulation{network: network, signals: make(map[int]*signalizedNode)}
+	radios := []string{eventschema.RadioDSRC, eventschema.RadioCV2X}
+	for i := 0; i < count; i++ {
+		vehicle := &simulatedVehicle{
+			id:       fmt.Sprintf("TRF%03d", i+1),
+			sourceIP: fmt.Sprintf("192.168.100.%d", i%254+1),
+			radio:    radios[i%len(radios)],
+			pace:     0.85 + rand.Float64()*0.2,
+			node:     network.waypoints[rand.Intn(len(network.waypoints))],
+		}
+		if i < emergency {
+			vehicle.id = fmt.Sprintf("EMV%03d", i+1)
+			vehicle.role = eventschema.RoleEmergency
+		}
+		s.plan(vehicle)
+		if len(vehicle.route) > 0 {
+			vehicle.offset = rand.Float64() * network.edges[vehicle.route[0]].length
+		}
+		s.vehicles = append(s.vehicles, vehicle)
+	}
+	return s
+}
+
+// setIntersections attaches each declared intersection to the nearest node
+// of the network within trafficSignalRange, keeping the signal requests of
+// the intersections still declared
+func (s *trafficSimulation) setIntersections(intersections []eventschema.Intersection) {
+	signals := make(map[int]*signalizedNode)
+	for _, in := range intersections {
+		node, ok := s.network.nearestNode(in.Latitude, in.Longitude)
+		if !ok {
+			continue
+		}
+		n := s.network.nodes[node]
+		if distanceMeters(in.Latitude, in.Longitude, n.lat, n.lon) <= trafficSignalRange {
+			signal := &signalizedNode{intersection: in}
+			if previous, ok := s.signals[node]; ok && previous.intersection.IntersectionID == in.IntersectionID {
+				signal.requests, signal.statusSent = previous.requests, previous.statusSent
+			}
+			signals[node] = signal
+		}
+	}
+	s.signals = signals
+}
+
+// plan extends the route of a vehicle to random waypoints while it has less
+// than two edges ahead, so the turn at the end of the one it drives is known
+func (s *trafficSimulation) plan(vehicle *simulatedVehicle) {
+	for attempt := 0; len(vehicle.route) < 2 && attempt < 10; attempt++ {
+		from := vehicle.node
+		if len(vehicle.route) > 0 {
+			from = s.network.edges[vehicle.route[len(vehicle.route)-1]].to
+		}
+		to := s.network.waypoints[rand.Intn(len(s.network.waypoints))]
+		vehicle.route = append(vehicle.route, s.network.route(from, to)...)
+	}
+}
+
+// step advances every vehicle by seconds
+func (s *trafficSimulation) step(now time.Time, seconds float64) {
+	for _, signal := range s.signals {
+		signal.states = make(map[int]string)
+		for _, state := range signal.intersection.SignalStates(now) {
+			signal.states[state.SignalGroup] = state.State
+		}
+	}
+
+	// decide every speed before moving anyone, so followers see where leaders were
+	speeds := make([]float64, len(s.vehicles))
+	for i, vehicle := range s.vehicles {
+		target, room := s.targetSpeed(vehicle, seconds)
+		switch {
+		case target > vehicle.speed:
+			speeds[i] = math.Min(target, vehicle.speed+trafficAccel*seconds)
+		default:
+			speeds[i] = math.Max(target, vehicle.speed-trafficMaxDecel*seconds)
+		}
+		// a whole step at that speed would overrun a stop line or the vehicle ahead
+		speeds[i] = math.Max(math.Min(speeds[i], math.Max(room, 0)/seconds), vehicle.speed-trafficMaxDecel*seconds)
+	}
+
+	for i, vehicle := range s.vehicles {
+		vehicle.speed = speeds[i]
+		s.advance(vehicle, vehicle.speed*seconds)
+	}
+}
+
+// targetSpeed is the speed a vehicle aims for: its pace of the speed limit,
+// bounded by what lets it brake in time for the turns, lower speed limits,
+// signals and vehicles ahead. room is how far it may go before a stop line or
+// the vehicle ahead.
+func (s *trafficSimulation) targetSpeed(vehicle *simulatedVehicle, seconds float64) (target, room float64) {
+	if len(vehicle.route) == 0 {
+		return 0, 0
+	}
+	edges := s.network.edges
+	target, room = edges[vehicle.route[0]].speedLimit*vehicle.pace, math.Inf(1)
+	brakeFor := func(speed, distance float64) {
+		target = math.Min(target, brakingSpeed(speed, distance, seconds))
+	}
+
+	distance := edges[vehicle.route[0]].length - vehicle.offset
+	for k := 0; k < len(vehicle.route) && distance < trafficLookahead; k++ {
+		edge := edges[vehicle.route[k]]
+		if s.mustStop(vehicle, edge, distance, seconds) {
+			brakeFor(0, distance-trafficStopGap)
+			room = distance - trafficStopGap
+			break
+		}
+		if k+1 < len(vehicle.route) {
+			next := edges[vehicle.route[k+1]]
+			if headingDifference(edge.heading, next.heading) > trafficTurnAngle {
+				brakeFor(trafficTurnSpeed, distance)
+			}
+			if next.speedLimit < edge.speedLimit {
+				brakeFor(next.speedLimit*vehicle.pace, distance)
+			}
+			distance += next.length
+		}
+	}
+
+	if leader, gap, ok := s.leader(vehicle); ok {
+		brakeFor(leader.speed, gap-trafficFollowGap)
+		room = math.Min(room, gap-trafficFollowGap/2) // leaders only move forward
+	}
+	return target, room
+}
+
+// mustStop reports whether a vehicle distance meters short of the end of an
+// edge stops there: the signal of its approach is red, or yellow while it can
+// still stop comfortably. A vehicle that went on through the yellow and can
+// no longer stop clears the intersection, as does one granted priority.
+func (s *trafficSimulation) mustStop(vehicle *simulatedVehicle, edge roadEdge, distance, seconds float64) bool {
+	signal, ok := s.signals[edge.to]
+	if !ok || s.granted(vehicle, edge.to) {
+		return false
+	}
+	approach, ok := signal.approachOf(edge)
+	if !ok {
+		return false
+	}
+	switch signal.states[approach.SignalGroup] {
+	case eventschema.SignalRed:
+		return vehicle.speed*vehicle.speed/(2*trafficMaxDecel) < distance
+	case eventschema.SignalYellow:
+		// a step of slack keeps a vehicle already braking for the yellow from changing its mind
+		return vehicle.speed <= brakingSpeed(0, distance-trafficStopGap, seconds)+trafficDecel*seconds
+	}
+	return false
+}
+
+// approachOf returns the approach of an intersection an edge enters it on
+func (signal *signalizedNode) approachOf(edge roadEdge) (eventschema.Approach, bool) {
+	for _, approach := range signal.intersection.Approaches {
+		if headingDifference(approach.Heading, edge.heading) <= trafficApproachSpan {
+			return approach, true
+		}
+	}
+	return eventschema.Approach{}, false
+}
+
+// brakingSpeed is the fastest speed u from which, after a step of seconds at
+// u, braking at trafficDecel still gets down to speed within distance:
+// u = -a·t + √((a·t)² + v² + 2·a·d)
+func brakingSpeed(speed, distance, seconds float64) float64 {
+	at := trafficDecel * seconds
+	return -at + math.Sqrt(at*at+speed*speed+2*trafficDecel*math.Max(distance, 0))
+}
+
+// leader returns the nearest vehicle ahead on the edge a vehicle drives or
+// the next one of its route, and the distance to it
+func (s *trafficSimulation) leader(vehicle *simulatedVehicle) (*simulatedVehicle, float64, bool) {
+	var leader *simulatedVehicle
+	best := math.Inf(1)
+	for _, other := range s.vehicles {
+		if other == vehicle || len(other.route) == 0 {
+			continue
+		}
+		gap := math.Inf(1)
+		switch {
+		case other.route[0] == vehicle.route[0] && other.offset > vehicle.offset:
+			gap = other.offset - vehicle.offset
+		case len(vehicle.route) > 1 && other.route[0] == vehicle.route[1]:
+			gap = s.network.edges[vehicle.route[0]].length - vehicle.offset + other.offset
+		}
+		if gap < best {
+			leader, best = other, gap
+		}
+	}
+	return leader, best, leader != nil
+}
+
+// advance moves a vehicle meters along its route
+func (s *trafficSimulation) advance(vehicle *simulatedVehicle, meters float64) {
+	vehicle.offset += meters
+	for len(vehicle.route) > 0 && vehicle.offset >= s.network.edges[vehicle.route[0]].length {
+		vehicle.offset -= s.network.edges[vehicle.route[0]].length
+		vehicle.node = s.network.edges[vehicle.route[0]].to
+		vehicle.route = vehicle.route[1:]
+		s.plan(vehicle)
+	}
+	if len(vehicle.route) == 0 {
+		// no waypoint could be reached from here; wait for one
+		vehicle.offset, vehicle.speed = 0, 0
+		s.plan(vehicle)
+	}
+}
+
+// bsmEvent is the BSM a vehicle broadcasts at its current position, with GNSS error
+func (s *trafficSimulation) bsmEvent(vehicle *simulatedVehicle, now time.Time) Event {
+	var lat, lon, heading float64
+	if len(vehicle.route) > 0 {
+		lat, lon = s.network.position(vehicle.route[0], vehicle.offset)
+		heading = s.network.edges[vehicle.route[0]].heading
+	} else {
+		node := s.network.nodes[vehicle.node]
+		lat, lon = node.lat, node.lon
+	}
+	lat += rand.NormFloat64() * trafficGNSSErrorM / metersPerDegree
+	lon += rand.NormFloat64() * trafficGNSSErrorM / (metersPerDegree * math.Cos(lat*math.Pi/180))
+
+	return Event{
+		SourceName: "v2x",
+		SourceType: "v2x",
+		Timestamp:  now,
+		Severity:   SeverityInfo,
+		Category:   CategoryV2X,
+		Message:    fmt.Sprintf("V2X %s message from vehicle %s", eventschema.MessageBasicSafety, vehicle.id),
+		Details: eventschema.V2XDetails{
+			NetworkDetails: eventschema.NetworkDetails{SourceIP: vehicle.sourceIP},
+			VehicleID:      vehicle.id,
+			MessageType:    eventschema.MessageBasicSafety,
+			Radio:          vehicle.radio,
+			Location:       &eventschema.Location{Lat: lat, Lon: lon},
+			Speed:          eventschema.Float(math.Round(vehicle.speed*3.6*10) / 10),
+			Heading:        eventschema.Float(math.Round(heading*10) / 10),
+		},
+	}
+}
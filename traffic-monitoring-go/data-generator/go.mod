@@ -7,3 +7,7 @@ toolchain go1.22.3
 require github.com/google/uuid v1.6.0
 
 require github.com/brianvoe/gofakeit/v6 v6.28.0
+
+require traffic-monitoring-go v0.0.0
+
+replace traffic-monitoring-go => ../
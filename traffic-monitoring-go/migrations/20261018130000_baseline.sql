@@ -0,0 +1,997 @@
+-- +goose Up
+-- The schema as it was when these migrations replaced GORM AutoMigrate. Every
+-- statement is idempotent, so databases that AutoMigrate set up adopt it as
+-- they are; the migrations written before it are folded in and kept in archive/.
+-- The tables of the original schema (users, stations, sensors,
+-- traffic_measurements, user_events, log_sources, security_events, rules and
+-- alerts) already exist there, so the columns added to them since are added
+-- here before the indexes that use them.
+
+CREATE TABLE IF NOT EXISTS "users" (
+	"id" bigserial,
+	"email" text NOT NULL,
+	"hashed_password" text NOT NULL,
+	"role" VARCHAR(20),
+	"max_sessions" bigint NOT NULL DEFAULT 0,
+	"organization_id" bigint,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_users_email" UNIQUE ("email")
+);
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "max_sessions" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "organization_id" bigint;
+CREATE INDEX IF NOT EXISTS "idx_users_organization_id" ON "users" ("organization_id");
+
+CREATE TABLE IF NOT EXISTS "stations" (
+	"id" bigserial,
+	"code" text NOT NULL,
+	"name" text,
+	"city" text,
+	"latitude" decimal,
+	"longitude" decimal,
+	"date_of_installation" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_stations_code" UNIQUE ("code")
+);
+
+CREATE TABLE IF NOT EXISTS "sensors" (
+	"id" bigserial,
+	"sensor_id" text NOT NULL,
+	"station_id" bigint NOT NULL,
+	"measurement_type" text,
+	"status" text,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_sensors_sensor_id" UNIQUE ("sensor_id")
+);
+
+CREATE TABLE IF NOT EXISTS "traffic_measurements" (
+	"id" bigserial,
+	"sensor_id" bigint NOT NULL,
+	"timestamp" timestamptz NOT NULL,
+	"speed" decimal,
+	"vehicle_count" bigint,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "user_events" (
+	"id" bigserial,
+	"date" timestamptz NOT NULL,
+	"city" text NOT NULL,
+	"event_type" text NOT NULL,
+	"description" text,
+	"expected_congestion_level" text,
+	"station_id" bigint,
+	PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "log_sources" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"type" text NOT NULL,
+	"description" text,
+	"enabled" boolean NOT NULL DEFAULT true,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "security_events" (
+	"id" bigserial,
+	"timestamp" timestamptz NOT NULL,
+	"source_ip" text,
+	"source_port" bigint,
+	"destination_ip" text,
+	"destination_port" bigint,
+	"protocol" text,
+	"action" text,
+	"status" text,
+	"user_id" bigint,
+	"device_id" text,
+	"log_source_id" bigint,
+	"severity" text NOT NULL,
+	"category" text NOT NULL,
+	"message" text NOT NULL,
+	"raw_data" text,
+	"trust_score" decimal,
+	"organization_id" bigint,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+ALTER TABLE "security_events" ADD COLUMN IF NOT EXISTS "trust_score" decimal;
+ALTER TABLE "security_events" ADD COLUMN IF NOT EXISTS "organization_id" bigint;
+CREATE INDEX IF NOT EXISTS "idx_security_events_organization_id" ON "security_events" ("organization_id");
+CREATE INDEX IF NOT EXISTS "idx_security_events_timestamp" ON "security_events" ("timestamp");
+
+CREATE TABLE IF NOT EXISTS "rules" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"description" text,
+	"condition" text NOT NULL,
+	"severity" text NOT NULL,
+	"category" text NOT NULL,
+	"status" text NOT NULL,
+	"scope" text,
+	"techniques" jsonb,
+	"v2x_threats" jsonb,
+	"created_by" bigint,
+	"organization_id" bigint,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_rules_name" UNIQUE ("name")
+);
+ALTER TABLE "rules" ADD COLUMN IF NOT EXISTS "scope" text;
+ALTER TABLE "rules" ADD COLUMN IF NOT EXISTS "techniques" jsonb;
+ALTER TABLE "rules" ADD COLUMN IF NOT EXISTS "v2x_threats" jsonb;
+ALTER TABLE "rules" ADD COLUMN IF NOT EXISTS "organization_id" bigint;
+CREATE INDEX IF NOT EXISTS "idx_rules_organization_id" ON "rules" ("organization_id");
+
+CREATE TABLE IF NOT EXISTS "alerts" (
+	"id" bigserial,
+	"rule_id" bigint,
+	"security_event_id" bigint,
+	"timestamp" timestamptz NOT NULL,
+	"severity" text NOT NULL,
+	"status" text NOT NULL,
+	"assigned_to" bigint,
+	"resolution" text,
+	"latitude" decimal,
+	"longitude" decimal,
+	"nearest_rsu" text,
+	"rsu_distance_m" decimal,
+	"road_name" text,
+	"road_segment" text,
+	"road_distance_m" decimal,
+	"techniques" jsonb,
+	"v2x_threats" jsonb,
+	"late_evaluated" boolean NOT NULL DEFAULT false,
+	"evaluated_at" timestamptz,
+	"incident_id" bigint,
+	"organization_id" bigint,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "latitude" decimal;
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "longitude" decimal;
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "nearest_rsu" text;
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "rsu_distance_m" decimal;
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "road_name" text;
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "road_segment" text;
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "road_distance_m" decimal;
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "techniques" jsonb;
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "v2x_threats" jsonb;
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "late_evaluated" boolean NOT NULL DEFAULT false;
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "evaluated_at" timestamptz;
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "incident_id" bigint;
+ALTER TABLE "alerts" ADD COLUMN IF NOT EXISTS "organization_id" bigint;
+CREATE INDEX IF NOT EXISTS "idx_alerts_incident_id" ON "alerts" ("incident_id");
+CREATE INDEX IF NOT EXISTS "idx_alerts_late_evaluated" ON "alerts" ("late_evaluated");
+CREATE INDEX IF NOT EXISTS "idx_alerts_organization_id" ON "alerts" ("organization_id");
+CREATE INDEX IF NOT EXISTS "idx_alerts_timestamp" ON "alerts" ("timestamp");
+
+CREATE TABLE IF NOT EXISTS "hunt_queries" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"description" text,
+	"category" text,
+	"query" text NOT NULL,
+	"parameters" text,
+	"columns" text,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_hunt_queries_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "transform_rules" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"description" text,
+	"source_name" text,
+	"match_field" text,
+	"match_value" text,
+	"mappings" text,
+	"priority" bigint NOT NULL DEFAULT 0,
+	"enabled" boolean NOT NULL DEFAULT true,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_transform_rules_name" UNIQUE ("name")
+);
+CREATE INDEX IF NOT EXISTS "idx_transform_rules_source_name" ON "transform_rules" ("source_name");
+
+CREATE TABLE IF NOT EXISTS "collector_listeners" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"protocol" text NOT NULL,
+	"port" bigint NOT NULL,
+	"parser" text NOT NULL,
+	"enabled" boolean NOT NULL DEFAULT true,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_collector_listeners_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "v2x_kpis" (
+	"id" bigserial,
+	"interval_start" timestamptz NOT NULL,
+	"interval_end" timestamptz NOT NULL,
+	"entity_type" text NOT NULL,
+	"entity_id" text NOT NULL,
+	"message_count" bigint,
+	"pir_mean_ms" decimal,
+	"pirp95_ms" decimal,
+	"info_age_mean_ms" decimal,
+	"info_age_p95_ms" decimal,
+	"neighbor_density" decimal,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_v2x_kpis_entity_id" ON "v2x_kpis" ("entity_id");
+CREATE INDEX IF NOT EXISTS "idx_v2x_kpis_entity_type" ON "v2x_kpis" ("entity_type");
+CREATE INDEX IF NOT EXISTS "idx_v2x_kpis_interval_start" ON "v2x_kpis" ("interval_start");
+
+CREATE TABLE IF NOT EXISTS "rsus" (
+	"id" bigserial,
+	"code" text NOT NULL,
+	"name" text,
+	"latitude" decimal NOT NULL,
+	"longitude" decimal NOT NULL,
+	"status" text,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_rsus_code" UNIQUE ("code")
+);
+
+CREATE TABLE IF NOT EXISTS "road_segments" (
+	"id" bigserial,
+	"segment_id" text,
+	"name" text,
+	"ref" text,
+	"geometry" text,
+	"min_lat" decimal,
+	"max_lat" decimal,
+	"min_lon" decimal,
+	"max_lon" decimal,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_road_segments_min_lat" ON "road_segments" ("min_lat");
+CREATE INDEX IF NOT EXISTS "idx_road_segments_min_lon" ON "road_segments" ("min_lon");
+CREATE INDEX IF NOT EXISTS "idx_road_segments_segment_id" ON "road_segments" ("segment_id");
+
+CREATE TABLE IF NOT EXISTS "event_sinks" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"type" text NOT NULL,
+	"config" text,
+	"queue_size" bigint NOT NULL DEFAULT 1000,
+	"enabled" boolean NOT NULL DEFAULT true,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_event_sinks_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "routing_rules" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"description" text,
+	"categories" text,
+	"severities" text,
+	"sinks" text,
+	"enabled" boolean NOT NULL DEFAULT true,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_routing_rules_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "alert_outbox" (
+	"id" bigserial,
+	"alert_id" bigint NOT NULL,
+	"operation" text NOT NULL,
+	"payload" jsonb NOT NULL,
+	"attempts" bigint NOT NULL DEFAULT 0,
+	"last_error" text,
+	"published_at" timestamptz,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_alert_outbox_alert_id" ON "alert_outbox" ("alert_id");
+CREATE INDEX IF NOT EXISTS "idx_alert_outbox_created_at" ON "alert_outbox" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_alert_outbox_published_at" ON "alert_outbox" ("published_at");
+
+CREATE TABLE IF NOT EXISTS "source_mutes" (
+	"id" bigserial,
+	"source_type" text NOT NULL,
+	"source_id" text NOT NULL,
+	"message_type" text,
+	"reason" text NOT NULL,
+	"created_by" text,
+	"expires_at" timestamptz,
+	"resolved_at" timestamptz,
+	"suppressed_count" bigint NOT NULL DEFAULT 0,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_source_mutes_expires_at" ON "source_mutes" ("expires_at");
+CREATE INDEX IF NOT EXISTS "idx_source_mutes_source" ON "source_mutes" ("source_type","source_id");
+
+CREATE TABLE IF NOT EXISTS "edge_checkpoints" (
+	"id" bigserial,
+	"node_id" text NOT NULL,
+	"segment" bigint NOT NULL,
+	"offset" bigint NOT NULL,
+	"events_received" bigint NOT NULL DEFAULT 0,
+	"last_batch_at" timestamptz,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_edge_checkpoints_node_id" UNIQUE ("node_id")
+);
+
+CREATE TABLE IF NOT EXISTS "vehicle_links" (
+	"id" bigserial,
+	"dsrc_id" text NOT NULL,
+	"cv2_x_id" text NOT NULL,
+	"matched_samples" bigint,
+	"median_distance_m" decimal,
+	"inconsistent_samples" bigint,
+	"inconsistent" boolean NOT NULL DEFAULT false,
+	"inconsistency_reason" text,
+	"last_inconsistent_at" timestamptz,
+	"first_seen" timestamptz,
+	"last_seen" timestamptz,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_vehicle_links_cv2_x_id" ON "vehicle_links" ("cv2_x_id");
+CREATE INDEX IF NOT EXISTS "idx_vehicle_links_inconsistent" ON "vehicle_links" ("inconsistent");
+CREATE INDEX IF NOT EXISTS "idx_vehicle_links_last_seen" ON "vehicle_links" ("last_seen");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_vehicle_links_pair" ON "vehicle_links" ("dsrc_id","cv2_x_id");
+
+CREATE TABLE IF NOT EXISTS "severity_mappings" (
+	"id" bigserial,
+	"log_source_id" bigint NOT NULL,
+	"source_value" text NOT NULL,
+	"severity" text NOT NULL,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_severity_mappings_source_value" ON "severity_mappings" ("log_source_id","source_value");
+
+CREATE TABLE IF NOT EXISTS "dashboard_layouts" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"user_id" bigint,
+	"role" VARCHAR(20),
+	"widgets" text,
+	"default_time_range" text,
+	"default_filters" text,
+	"is_default" boolean NOT NULL DEFAULT false,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_dashboard_layouts_role" ON "dashboard_layouts" ("role");
+CREATE INDEX IF NOT EXISTS "idx_dashboard_layouts_user_id" ON "dashboard_layouts" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "denm_verifications" (
+	"id" bigserial,
+	"alert_id" bigint NOT NULL,
+	"security_event_id" bigint NOT NULL,
+	"sender_id" text,
+	"message_type" text,
+	"radius_m" decimal,
+	"latitude" decimal,
+	"longitude" decimal,
+	"inside_vehicles" bigint,
+	"inside_measured" bigint,
+	"inside_slowed" bigint,
+	"inside_mean_speed_change" decimal,
+	"outside_vehicles" bigint,
+	"outside_measured" bigint,
+	"outside_slowed" bigint,
+	"outside_mean_speed_change" decimal,
+	"effectiveness" decimal,
+	"suspicious" boolean NOT NULL DEFAULT false,
+	"suspicious_reason" text,
+	"window_start" timestamptz,
+	"window_end" timestamptz,
+	"verified_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_denm_verifications_suspicious" ON "denm_verifications" ("suspicious");
+CREATE INDEX IF NOT EXISTS "idx_denm_verifications_verified_at" ON "denm_verifications" ("verified_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_denm_verifications_alert_id" ON "denm_verifications" ("alert_id");
+
+CREATE TABLE IF NOT EXISTS "trend_rules" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"description" text,
+	"dimension" VARCHAR(30) NOT NULL,
+	"key" text NOT NULL,
+	"period" VARCHAR(10) NOT NULL,
+	"min_ratio" decimal NOT NULL,
+	"min_count" bigint NOT NULL,
+	"severity" text NOT NULL,
+	"enabled" boolean NOT NULL DEFAULT true,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_trend_rules_name" ON "trend_rules" ("name");
+
+CREATE TABLE IF NOT EXISTS "trend_alerts" (
+	"id" bigserial,
+	"trend_rule_id" bigint NOT NULL,
+	"rule_name" text,
+	"dimension" text,
+	"key" text,
+	"period" text,
+	"window_start" timestamptz,
+	"window_end" timestamptz,
+	"current" bigint,
+	"previous" bigint,
+	"ratio" decimal,
+	"severity" text,
+	"message" text,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_trend_alerts_trend_rule_id" ON "trend_alerts" ("trend_rule_id");
+CREATE INDEX IF NOT EXISTS "idx_trend_alerts_window_end" ON "trend_alerts" ("window_end");
+
+CREATE TABLE IF NOT EXISTS "vendor_patterns" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"vendor" text NOT NULL,
+	"description" text,
+	"source_name" text,
+	"pattern" text NOT NULL,
+	"radio" text,
+	"severity" text,
+	"priority" bigint NOT NULL DEFAULT 0,
+	"enabled" boolean NOT NULL DEFAULT true,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_vendor_patterns_name" UNIQUE ("name")
+);
+CREATE INDEX IF NOT EXISTS "idx_vendor_patterns_vendor" ON "vendor_patterns" ("vendor");
+
+CREATE TABLE IF NOT EXISTS "certificate_revocation_lists" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"issuer" text,
+	"source_url" text,
+	"issued_at" timestamptz,
+	"next_update" timestamptz,
+	"entries" bigint NOT NULL DEFAULT 0,
+	"fetched_at" timestamptz,
+	"last_error" text,
+	"enabled" boolean NOT NULL DEFAULT true,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_certificate_revocation_lists_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "revoked_certificates" (
+	"id" bigserial,
+	"crl_id" bigint NOT NULL,
+	"certificate_id" text NOT NULL,
+	"revoked_at" timestamptz,
+	"reason" text,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_revoked_certificates_certificate_id" ON "revoked_certificates" ("certificate_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_revoked_certificates_crl_certificate" ON "revoked_certificates" ("crl_id","certificate_id");
+
+CREATE TABLE IF NOT EXISTS "misbehavior_reports" (
+	"id" bigserial,
+	"report_id" text NOT NULL,
+	"source_id" text NOT NULL,
+	"window_start" timestamptz NOT NULL,
+	"window_end" timestamptz NOT NULL,
+	"anomaly_count" bigint NOT NULL,
+	"anomaly_types" jsonb,
+	"document" jsonb NOT NULL,
+	"status" text NOT NULL,
+	"attempts" bigint NOT NULL DEFAULT 0,
+	"last_error" text,
+	"sent_at" timestamptz,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_misbehavior_reports_report_id" UNIQUE ("report_id")
+);
+CREATE INDEX IF NOT EXISTS "idx_misbehavior_reports_created_at" ON "misbehavior_reports" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_misbehavior_reports_status" ON "misbehavior_reports" ("status");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_misbehavior_reports_source_window" ON "misbehavior_reports" ("source_id","window_start");
+
+CREATE TABLE IF NOT EXISTS "v2x_threats" (
+	"id" bigserial,
+	"code" text NOT NULL,
+	"name" text NOT NULL,
+	"description" text,
+	"anomaly_types" jsonb,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_v2x_threats_code" UNIQUE ("code")
+);
+
+CREATE TABLE IF NOT EXISTS "anomaly_detector_configs" (
+	"id" bigserial,
+	"detector" text NOT NULL,
+	"enabled" boolean NOT NULL DEFAULT true,
+	"severity" text,
+	"params" jsonb,
+	"updated_by" text,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_anomaly_detector_configs_detector" UNIQUE ("detector")
+);
+
+CREATE TABLE IF NOT EXISTS "user_sessions" (
+	"id" bigserial,
+	"token_id" text NOT NULL,
+	"user_id" bigint NOT NULL,
+	"email" text,
+	"client_ip" text,
+	"user_agent" text,
+	"issued_at" timestamptz NOT NULL,
+	"expires_at" timestamptz NOT NULL,
+	"revoked_at" timestamptz,
+	"revoked_by" text,
+	"revoke_reason" text,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_user_sessions_token_id" UNIQUE ("token_id")
+);
+CREATE INDEX IF NOT EXISTS "idx_user_sessions_expires_at" ON "user_sessions" ("expires_at");
+CREATE INDEX IF NOT EXISTS "idx_user_sessions_revoked_at" ON "user_sessions" ("revoked_at");
+CREATE INDEX IF NOT EXISTS "idx_user_sessions_user_id" ON "user_sessions" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "geofences" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"description" text,
+	"kind" text NOT NULL DEFAULT 'zone',
+	"shape" text NOT NULL,
+	"polygon" text,
+	"center_lat" decimal,
+	"center_lon" decimal,
+	"radius_m" decimal,
+	"enabled" boolean NOT NULL,
+	"min_lat" decimal,
+	"max_lat" decimal,
+	"min_lon" decimal,
+	"max_lon" decimal,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_geofences_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "fleet_operators" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"description" text,
+	"endpoint_url" text NOT NULL,
+	"secret" text NOT NULL,
+	"vehicle_prefixes" jsonb,
+	"enabled" boolean NOT NULL,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_fleet_operators_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "oem_notifications" (
+	"id" bigserial,
+	"notification_id" text NOT NULL,
+	"alert_id" bigint NOT NULL,
+	"operator_id" bigint NOT NULL,
+	"pseudonym" text NOT NULL,
+	"certificate_id" text,
+	"recommended_action" text NOT NULL,
+	"payload" jsonb NOT NULL,
+	"status" text NOT NULL,
+	"attempts" bigint NOT NULL DEFAULT 0,
+	"last_error" text,
+	"sent_at" timestamptz,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_oem_notifications_notification_id" UNIQUE ("notification_id")
+);
+CREATE INDEX IF NOT EXISTS "idx_oem_notifications_created_at" ON "oem_notifications" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_oem_notifications_pseudonym" ON "oem_notifications" ("pseudonym");
+CREATE INDEX IF NOT EXISTS "idx_oem_notifications_status" ON "oem_notifications" ("status");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_oem_notifications_alert_operator" ON "oem_notifications" ("alert_id","operator_id");
+
+CREATE TABLE IF NOT EXISTS "alert_reviews" (
+	"id" bigserial,
+	"alert_id" bigint NOT NULL,
+	"from_status" text NOT NULL,
+	"status" text NOT NULL,
+	"resolution" text,
+	"state" text NOT NULL,
+	"requested_by_id" bigint NOT NULL,
+	"requested_by" text NOT NULL,
+	"requested_at" timestamptz NOT NULL,
+	"reviewed_by_id" bigint,
+	"reviewed_by" text,
+	"reviewed_at" timestamptz,
+	"reviewer_comment" text,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_alert_reviews_alert_id" ON "alert_reviews" ("alert_id");
+CREATE INDEX IF NOT EXISTS "idx_alert_reviews_state" ON "alert_reviews" ("state");
+
+CREATE TABLE IF NOT EXISTS "regulatory_templates" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"jurisdiction" text NOT NULL,
+	"sections" jsonb,
+	"corridors" jsonb,
+	"formats" jsonb,
+	"headers" jsonb,
+	"delimiter" text NOT NULL DEFAULT ',',
+	"timezone" text NOT NULL DEFAULT 'UTC',
+	"enabled" boolean NOT NULL,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_regulatory_templates_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "regulatory_reports" (
+	"id" bigserial,
+	"template_id" bigint NOT NULL,
+	"period" text NOT NULL,
+	"period_start" timestamptz NOT NULL,
+	"period_end" timestamptz NOT NULL,
+	"filename" text NOT NULL,
+	"size" bigint NOT NULL,
+	"archive" bytea NOT NULL,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_regulatory_reports_created_at" ON "regulatory_reports" ("created_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_regulatory_reports_template_period" ON "regulatory_reports" ("template_id","period");
+
+CREATE TABLE IF NOT EXISTS "parse_error_counts" (
+	"id" bigserial,
+	"bucket_start" timestamptz NOT NULL,
+	"collector" text NOT NULL,
+	"source_address" text NOT NULL,
+	"message_type" text NOT NULL,
+	"reason" text NOT NULL,
+	"count" bigint NOT NULL DEFAULT 0,
+	"last_error" text,
+	"last_seen" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_parse_error_counts_key" ON "parse_error_counts" ("bucket_start","collector","source_address","message_type","reason");
+
+CREATE TABLE IF NOT EXISTS "parse_source_counts" (
+	"id" bigserial,
+	"bucket_start" timestamptz NOT NULL,
+	"collector" text NOT NULL,
+	"source_address" text NOT NULL,
+	"messages" bigint NOT NULL DEFAULT 0,
+	"failures" bigint NOT NULL DEFAULT 0,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_parse_source_counts_key" ON "parse_source_counts" ("bucket_start","collector","source_address");
+
+CREATE TABLE IF NOT EXISTS "retention_policies" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"target" text NOT NULL,
+	"category" text,
+	"index_family" text,
+	"action" text NOT NULL,
+	"max_age_days" bigint NOT NULL,
+	"enabled" boolean NOT NULL,
+	"last_run_at" timestamptz,
+	"last_purged" bigint,
+	"last_error" text,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_retention_policies_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "security_event_rollups" (
+	"id" bigserial,
+	"day" timestamptz NOT NULL,
+	"log_source_id" bigint NOT NULL,
+	"category" text NOT NULL,
+	"severity" text NOT NULL,
+	"count" bigint NOT NULL,
+	PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_security_event_rollups_key" ON "security_event_rollups" ("day","log_source_id","category","severity");
+
+CREATE TABLE IF NOT EXISTS "synthetic_intersections" (
+	"id" bigserial,
+	"intersection_id" bigint NOT NULL,
+	"name" text NOT NULL,
+	"description" text,
+	"latitude" decimal NOT NULL,
+	"longitude" decimal NOT NULL,
+	"approaches" text,
+	"timing_plans" text,
+	"enabled" boolean NOT NULL,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_synthetic_intersections_intersection_id" UNIQUE ("intersection_id"),
+	CONSTRAINT "uni_synthetic_intersections_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "registered_vehicles" (
+	"id" bigserial,
+	"pseudonym" text NOT NULL,
+	"first_seen" timestamptz NOT NULL,
+	"last_seen" timestamptz NOT NULL,
+	"last_latitude" decimal,
+	"last_longitude" decimal,
+	"trust_score" decimal NOT NULL DEFAULT 100,
+	"trust_updated_at" timestamptz,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_registered_vehicles_pseudonym" UNIQUE ("pseudonym")
+);
+CREATE INDEX IF NOT EXISTS "idx_registered_vehicles_last_seen" ON "registered_vehicles" ("last_seen");
+CREATE INDEX IF NOT EXISTS "idx_registered_vehicles_trust_score" ON "registered_vehicles" ("trust_score");
+
+CREATE TABLE IF NOT EXISTS "vehicle_identifiers" (
+	"id" bigserial,
+	"vehicle_id" bigint NOT NULL,
+	"kind" text NOT NULL,
+	"value" text NOT NULL,
+	"radio" text,
+	"linked_by" text NOT NULL,
+	"first_seen" timestamptz NOT NULL,
+	"last_seen" timestamptz NOT NULL,
+	"last_latitude" decimal,
+	"last_longitude" decimal,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_vehicle_identifiers_last_seen" ON "vehicle_identifiers" ("last_seen");
+CREATE INDEX IF NOT EXISTS "idx_vehicle_identifiers_vehicle_id" ON "vehicle_identifiers" ("vehicle_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_vehicle_identifiers_value" ON "vehicle_identifiers" ("kind","value");
+
+CREATE TABLE IF NOT EXISTS "source_trust_scores" (
+	"id" bigserial,
+	"source_id" text NOT NULL,
+	"score" decimal NOT NULL,
+	"anomalies" jsonb,
+	"inconsistent_links" bigint NOT NULL DEFAULT 0,
+	"misbehavior_reports" bigint NOT NULL DEFAULT 0,
+	"window_start" timestamptz NOT NULL,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_source_trust_scores_source_id" UNIQUE ("source_id")
+);
+CREATE INDEX IF NOT EXISTS "idx_source_trust_scores_score" ON "source_trust_scores" ("score");
+
+CREATE TABLE IF NOT EXISTS "mqtt_brokers" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"url" text NOT NULL,
+	"client_id" text,
+	"username" text,
+	"password" text,
+	"ca_cert" text,
+	"client_cert" text,
+	"client_key" text,
+	"insecure_skip_verify" boolean NOT NULL DEFAULT false,
+	"keep_alive_seconds" bigint NOT NULL DEFAULT 60,
+	"topics" jsonb,
+	"enabled" boolean NOT NULL DEFAULT true,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_mqtt_brokers_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "incidents" (
+	"id" bigserial,
+	"title" text NOT NULL,
+	"description" text,
+	"status" text NOT NULL,
+	"severity" text NOT NULL,
+	"owner_id" bigint,
+	"correlation_key" text,
+	"alert_count" bigint NOT NULL DEFAULT 0,
+	"first_seen" timestamptz,
+	"last_seen" timestamptz,
+	"created_by" text NOT NULL,
+	"closed_at" timestamptz,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_incidents_correlation_key" ON "incidents" ("correlation_key");
+CREATE INDEX IF NOT EXISTS "idx_incidents_last_seen" ON "incidents" ("last_seen");
+CREATE INDEX IF NOT EXISTS "idx_incidents_owner_id" ON "incidents" ("owner_id");
+CREATE INDEX IF NOT EXISTS "idx_incidents_status" ON "incidents" ("status");
+
+CREATE TABLE IF NOT EXISTS "incident_entries" (
+	"id" bigserial,
+	"incident_id" bigint NOT NULL,
+	"kind" text NOT NULL,
+	"actor" text NOT NULL,
+	"message" text,
+	"alert_id" bigint,
+	"security_event_id" bigint,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_incident_entries_created_at" ON "incident_entries" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_incident_entries_incident_id" ON "incident_entries" ("incident_id");
+CREATE INDEX IF NOT EXISTS "idx_incident_entries_security_event_id" ON "incident_entries" ("security_event_id");
+
+CREATE TABLE IF NOT EXISTS "response_actions" (
+	"id" bigserial,
+	"rule_id" bigint NOT NULL,
+	"name" text NOT NULL,
+	"type" text NOT NULL,
+	"config" jsonb,
+	"enabled" boolean NOT NULL,
+	"dry_run" boolean NOT NULL DEFAULT false,
+	"created_by" text,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_response_actions_rule_id" ON "response_actions" ("rule_id");
+
+CREATE TABLE IF NOT EXISTS "response_executions" (
+	"id" bigserial,
+	"action_id" bigint NOT NULL,
+	"rule_id" bigint NOT NULL,
+	"alert_id" bigint NOT NULL,
+	"type" text NOT NULL,
+	"status" text NOT NULL,
+	"dry_run" boolean NOT NULL DEFAULT false,
+	"triggered_by" text NOT NULL,
+	"target" text,
+	"output" text,
+	"error" text,
+	"attempts" bigint NOT NULL DEFAULT 0,
+	"executed_at" timestamptz,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_response_executions_action_id" ON "response_executions" ("action_id");
+CREATE INDEX IF NOT EXISTS "idx_response_executions_alert_id" ON "response_executions" ("alert_id");
+CREATE INDEX IF NOT EXISTS "idx_response_executions_created_at" ON "response_executions" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_response_executions_rule_id" ON "response_executions" ("rule_id");
+CREATE INDEX IF NOT EXISTS "idx_response_executions_status" ON "response_executions" ("status");
+
+CREATE TABLE IF NOT EXISTS "ip_blocklist" (
+	"id" bigserial,
+	"ip" text NOT NULL,
+	"reason" text NOT NULL,
+	"rule_id" bigint,
+	"alert_id" bigint,
+	"action_id" bigint,
+	"expires_at" timestamptz,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_ip_blocklist_ip" UNIQUE ("ip")
+);
+CREATE INDEX IF NOT EXISTS "idx_ip_blocklist_expires_at" ON "ip_blocklist" ("expires_at");
+
+CREATE TABLE IF NOT EXISTS "untrusted_vehicles" (
+	"id" bigserial,
+	"source_id" text NOT NULL,
+	"registered_vehicle_id" bigint,
+	"reason" text NOT NULL,
+	"rule_id" bigint,
+	"alert_id" bigint,
+	"action_id" bigint,
+	"expires_at" timestamptz,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_untrusted_vehicles_source_id" UNIQUE ("source_id")
+);
+CREATE INDEX IF NOT EXISTS "idx_untrusted_vehicles_expires_at" ON "untrusted_vehicles" ("expires_at");
+CREATE INDEX IF NOT EXISTS "idx_untrusted_vehicles_registered_vehicle_id" ON "untrusted_vehicles" ("registered_vehicle_id");
+
+CREATE TABLE IF NOT EXISTS "report_templates" (
+	"id" bigserial,
+	"name" text NOT NULL,
+	"title" text,
+	"schedule" text NOT NULL,
+	"sections" jsonb,
+	"top_n" bigint NOT NULL DEFAULT 10,
+	"formats" jsonb,
+	"channels" jsonb,
+	"timezone" text NOT NULL DEFAULT 'UTC',
+	"html_template" text,
+	"enabled" boolean NOT NULL,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_report_templates_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "reports" (
+	"id" bigserial,
+	"template_id" bigint NOT NULL,
+	"period" text NOT NULL,
+	"period_start" timestamptz NOT NULL,
+	"period_end" timestamptz NOT NULL,
+	"filename" text NOT NULL,
+	"html" bytea,
+	"pdf" bytea,
+	"html_size" bigint NOT NULL DEFAULT 0,
+	"pdf_size" bigint NOT NULL DEFAULT 0,
+	"delivered_to" jsonb,
+	"delivered_at" timestamptz,
+	"delivery_error" text,
+	"created_at" timestamptz,
+	PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_reports_created_at" ON "reports" ("created_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_reports_template_period" ON "reports" ("template_id","period");
+
+CREATE TABLE IF NOT EXISTS "organizations" (
+	"id" bigserial,
+	"slug" text NOT NULL,
+	"name" text NOT NULL,
+	"enabled" boolean NOT NULL,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_organizations_slug" UNIQUE ("slug")
+);
+
+CREATE TABLE IF NOT EXISTS "api_keys" (
+	"id" bigserial,
+	"log_source_id" bigint NOT NULL,
+	"name" text,
+	"prefix" text NOT NULL,
+	"key_hash" text NOT NULL,
+	"organization_id" bigint,
+	"rate_limit" decimal,
+	"burst" bigint,
+	"expires_at" timestamptz,
+	"replaced_by_id" bigint,
+	"revoked_at" timestamptz,
+	"revoked_by" text,
+	"created_by" text,
+	"created_at" timestamptz,
+	"updated_at" timestamptz,
+	PRIMARY KEY ("id"),
+	CONSTRAINT "uni_api_keys_key_hash" UNIQUE ("key_hash")
+);
+CREATE INDEX IF NOT EXISTS "idx_api_keys_log_source_id" ON "api_keys" ("log_source_id");
+CREATE INDEX IF NOT EXISTS "idx_api_keys_organization_id" ON "api_keys" ("organization_id");
+CREATE INDEX IF NOT EXISTS "idx_api_keys_revoked_at" ON "api_keys" ("revoked_at");
+
+-- Folded in from archive/20261017120000_add_forensic_window_indexes.sql and
+-- archive/20261017130000_add_alert_late_evaluation.sql
+CREATE INDEX IF NOT EXISTS "idx_security_events_timestamp_id" ON "security_events" ("timestamp", "id");
+CREATE INDEX IF NOT EXISTS "idx_alerts_timestamp_id" ON "alerts" ("timestamp", "id");
+CREATE INDEX IF NOT EXISTS "idx_alerts_rule_event" ON "alerts" ("rule_id", "security_event_id");
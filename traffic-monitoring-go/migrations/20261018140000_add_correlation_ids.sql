@@ -0,0 +1,13 @@
+-- +goose Up
+-- The correlation ID of the request or collector message an event was ingested
+-- from, carried on to its alerts, to follow them through the logs
+ALTER TABLE security_events ADD COLUMN IF NOT EXISTS correlation_id TEXT;
+CREATE INDEX IF NOT EXISTS idx_security_events_correlation_id ON security_events (correlation_id);
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS correlation_id TEXT;
+CREATE INDEX IF NOT EXISTS idx_alerts_correlation_id ON alerts (correlation_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_alerts_correlation_id;
+ALTER TABLE alerts DROP COLUMN IF EXISTS correlation_id;
+DROP INDEX IF EXISTS idx_security_events_correlation_id;
+ALTER TABLE security_events DROP COLUMN IF EXISTS correlation_id;
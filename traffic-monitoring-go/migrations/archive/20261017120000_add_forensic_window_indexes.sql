@@ -0,0 +1,8 @@
+-- +goose Up
+-- Forensic window queries scan a narrow time range ordered by (timestamp, id)
+CREATE INDEX IF NOT EXISTS idx_security_events_timestamp_id ON security_events(timestamp, id);
+CREATE INDEX IF NOT EXISTS idx_alerts_timestamp_id ON alerts(timestamp, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_alerts_timestamp_id;
+DROP INDEX IF EXISTS idx_security_events_timestamp_id;
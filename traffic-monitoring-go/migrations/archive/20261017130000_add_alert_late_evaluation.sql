@@ -0,0 +1,12 @@
+-- +goose Up
+-- Catch-up evaluation flags the alerts it raises and looks up existing alerts by (rule_id, security_event_id)
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS late_evaluated BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS evaluated_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_alerts_late_evaluated ON alerts(late_evaluated);
+CREATE INDEX IF NOT EXISTS idx_alerts_rule_event ON alerts(rule_id, security_event_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_alerts_rule_event;
+DROP INDEX IF EXISTS idx_alerts_late_evaluated;
+ALTER TABLE alerts DROP COLUMN IF EXISTS evaluated_at;
+ALTER TABLE alerts DROP COLUMN IF EXISTS late_evaluated;
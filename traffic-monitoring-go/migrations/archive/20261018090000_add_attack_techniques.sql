@@ -0,0 +1,8 @@
+-- +goose Up
+-- MITRE ATT&CK technique IDs tagged on rules and copied onto the alerts they raise
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS techniques JSONB;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS techniques JSONB;
+
+-- +goose Down
+ALTER TABLE alerts DROP COLUMN IF EXISTS techniques;
+ALTER TABLE rules DROP COLUMN IF EXISTS techniques;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- V2X threat taxonomy codes tagged on rules and copied onto the alerts they raise
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS v2x_threats JSONB;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS v2x_threats JSONB;
+
+-- +goose Down
+ALTER TABLE alerts DROP COLUMN IF EXISTS v2x_threats;
+ALTER TABLE rules DROP COLUMN IF EXISTS v2x_threats;
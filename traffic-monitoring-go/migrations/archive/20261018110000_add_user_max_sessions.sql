@@ -0,0 +1,6 @@
+-- +goose Up
+-- Per-user override of the concurrent session limit
+ALTER TABLE users ADD COLUMN IF NOT EXISTS max_sessions INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS max_sessions;
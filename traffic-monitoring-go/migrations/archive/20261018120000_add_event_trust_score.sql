@@ -0,0 +1,6 @@
+-- +goose Up
+-- Trust score of the V2X source of an event when it arrived, for rules and searches
+ALTER TABLE security_events ADD COLUMN IF NOT EXISTS trust_score DOUBLE PRECISION;
+
+-- +goose Down
+ALTER TABLE security_events DROP COLUMN IF EXISTS trust_score;
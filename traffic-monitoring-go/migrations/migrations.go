@@ -0,0 +1,28 @@
+// Package migrations holds the versioned schema migrations of the SIEM
+// database, applied in version order by database.Migrator and the migrate
+// command. Each file is named <version>_<name>.sql, the version being the UTC
+// time it was written (YYYYMMDDHHMMSS), and is annotated like goose's:
+//
+//	-- +goose Up
+//	ALTER TABLE alerts ADD COLUMN escalated BOOLEAN NOT NULL DEFAULT FALSE;
+//
+//	-- +goose Down
+//	ALTER TABLE alerts DROP COLUMN escalated;
+//
+// Statements end with a semicolon at the end of a line; statements holding
+// semicolons of their own, such as function bodies, go between
+// -- +goose StatementBegin and -- +goose StatementEnd. A migration runs in one
+// transaction unless it is marked -- +goose NO TRANSACTION, as CREATE INDEX
+// CONCURRENTLY needs, and cannot be rolled back without a Down section.
+//
+// The baseline is the schema as it was when migrations replaced GORM
+// AutoMigrate; the migrations written before it are folded into it and kept
+// in archive/ for reference only.
+package migrations
+
+import "embed"
+
+// Files are the migrations, embedded in the binaries that apply them
+//
+//go:embed *.sql
+var Files embed.FS
@@ -37,6 +37,34 @@ for i in {1..30}; do
   sleep 1
 done
 
+# Start the contract tests' PostgreSQL, its data directory on a tmpfs
+echo "Starting contract PostgreSQL container..."
+docker run --rm -d \
+  --name siem-contract-db \
+  --network $NETWORK_NAME \
+  --tmpfs /var/lib/postgresql/data \
+  -e POSTGRES_USER=test_user \
+  -e POSTGRES_PASSWORD=test_pass \
+  -e POSTGRES_DB=contract_db \
+  postgres:15 \
+  -c fsync=off -c synchronous_commit=off -c full_page_writes=off
+
+echo "Waiting for contract PostgreSQL to be ready..."
+for i in {1..30}; do
+  if docker exec siem-contract-db pg_isready -U test_user -d contract_db; then
+    echo "Contract PostgreSQL is ready"
+    break
+  fi
+
+  if [ $i -eq 30 ]; then
+    echo "Error: contract PostgreSQL not ready after 30 seconds"
+    exit 1
+  fi
+
+  echo "Waiting for contract PostgreSQL to be ready... ${i}/30"
+  sleep 1
+done
+
 # Start Elasticsearch container
 echo "Starting Elasticsearch container..."
 docker run --rm -d \
@@ -73,14 +101,15 @@ docker run --rm \
   --name siem-integration-tests \
   --network $NETWORK_NAME \
   -e DSN="host=siem-test-db user=test_user password=test_pass dbname=test_db port=5432 sslmode=disable TimeZone=UTC" \
+  -e CONTRACT_DSN="host=siem-contract-db user=test_user password=test_pass dbname=contract_db port=5432 sslmode=disable TimeZone=UTC" \
   -e ELASTICSEARCH_URL="http://siem-test-es:9200" \
   -e GO_ENV=test \
   siem-test-app \
-  go test -v ./tests/integration/...
+  go test -v ./tests/integration/... ./tests/contract/...
 
 # Cleanup
 echo "Cleaning up..."
-docker stop siem-test-db siem-test-es
+docker stop siem-test-db siem-contract-db siem-test-es
 
 # Remove the network
 docker network rm $NETWORK_NAME || true
@@ -0,0 +1,381 @@
+// Package contract checks that the payloads of the data generator and the
+// intersection simulator match the ingest OpenAPI document
+// (app/eventschema/openapi.json) and that the SIEM stores and indexes them.
+// It runs the generator's CONTRACT_MODE against the API served in-process,
+// with a fake Elasticsearch and a database of its own, a throwaway PostgreSQL
+// that the harness migrates itself. The tests are skipped when that database
+// cannot be reached.
+package contract
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+	"traffic-monitoring-go/app/eventschema"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/routes"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/elasticsearch"
+)
+
+// Test configuration
+const (
+	ContractDSN     = "host=siem-contract-db user=test_user password=test_pass dbname=contract_db port=5432 sslmode=disable TimeZone=UTC"
+	TestIngestToken = "contract-test-token"
+	GeneratorDir    = "../../data-generator"
+)
+
+// getContractDB returns a connection to the contract database, named by
+// CONTRACT_DSN, with the migrations applied, or skips the test when it cannot
+// be reached. It is not the integration tests' database but a throwaway
+// PostgreSQL whose data directory is a tmpfs (see
+// scripts/run-integration-tests.sh), so nothing it keeps outlives the run.
+func getContractDB(t testing.TB) *gorm.DB {
+	dsn := os.Getenv("CONTRACT_DSN")
+	if dsn == "" {
+		dsn = ContractDSN
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Skipf("Contract database not available, skipping test: %v", err)
+	}
+
+	migrator, err := database.NewMigrator(db)
+	require.NoError(t, err, "Failed to load migrations")
+	_, err = migrator.Up(0)
+	require.NoError(t, err, "Failed to migrate the contract database")
+
+	return db
+}
+
+// fakeElasticsearch is an in-memory Elasticsearch that answers the calls of
+// elasticsearch.Service and keeps the documents indexed through it
+type fakeElasticsearch struct {
+	mu   sync.Mutex
+	docs map[string]map[string]interface{} // by index and ID, "index/id"
+}
+
+func (es *fakeElasticsearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if r.Method == http.MethodPost && parts[len(parts)-1] == "_bulk" {
+		es.bulk(w, r, strings.Join(parts[:len(parts)-1], "/"))
+		return
+	}
+	if r.Method == http.MethodPut && len(parts) == 3 && parts[1] == "_doc" {
+		var doc map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		es.mu.Lock()
+		es.docs[parts[0]+"/"+parts[2]] = doc
+		es.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"result":"created"}`))
+		return
+	}
+	// the connection check, templates and index existence checks all succeed
+	w.Write([]byte(`{}`))
+}
+
+// bulk answers a _bulk request, storing the document of every index and
+// create action; defaultIndex is the index named in the path, if any
+func (es *fakeElasticsearch) bulk(w http.ResponseWriter, r *http.Request, defaultIndex string) {
+	type action struct {
+		Index string `json:"_index"`
+		ID    string `json:"_id"`
+	}
+	var items []map[string]interface{}
+
+	decoder := json.NewDecoder(r.Body)
+	for decoder.More() {
+		var line map[string]action
+		if err := decoder.Decode(&line); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for op, target := range line {
+			if op != "index" && op != "create" {
+				http.Error(w, "unsupported bulk action "+op, http.StatusBadRequest)
+				return
+			}
+			var doc map[string]interface{}
+			if err := decoder.Decode(&doc); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if target.Index == "" {
+				target.Index = defaultIndex
+			}
+			es.mu.Lock()
+			es.docs[target.Index+"/"+target.ID] = doc
+			es.mu.Unlock()
+			items = append(items, map[string]interface{}{
+				op: map[string]interface{}{"_index": target.Index, "_id": target.ID, "status": http.StatusCreated},
+			})
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": false, "items": items})
+}
+
+// document returns the document indexed under an ID in an index whose name
+// starts with prefix
+func (es *fakeElasticsearch) document(prefix string, id uint) (map[string]interface{}, bool) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	for key, doc := range es.docs {
+		index, docID, _ := strings.Cut(key, "/")
+		if strings.HasPrefix(index, prefix) && docID == strconv.FormatUint(uint64(id), 10) {
+			return doc, true
+		}
+	}
+	return nil, false
+}
+
+// ingestExchange is a POST /ingest request and the API's answer
+type ingestExchange struct {
+	body     []byte
+	status   int
+	response []byte
+}
+
+// ingestRecorder passes requests to the API, keeping the ingest exchanges
+type ingestRecorder struct {
+	handler   http.Handler
+	mu        sync.Mutex
+	exchanges []ingestExchange
+}
+
+func (rec *ingestRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || strings.TrimSuffix(r.URL.Path, "/") != "/ingest" {
+		rec.handler.ServeHTTP(w, r)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	response := httptest.NewRecorder()
+	rec.handler.ServeHTTP(response, r)
+
+	for key, values := range response.Header() {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(response.Code)
+	w.Write(response.Body.Bytes())
+
+	// the redirect to /ingest/ is followed with the same body
+	if response.Code >= 300 && response.Code < 400 {
+		return
+	}
+	rec.mu.Lock()
+	rec.exchanges = append(rec.exchanges, ingestExchange{body: body, status: response.Code, response: response.Body.Bytes()})
+	rec.mu.Unlock()
+}
+
+// goCommand returns the go tool building the generator
+func goCommand() string {
+	if path, err := exec.LookPath("go"); err == nil {
+		return path
+	}
+	return filepath.Join(runtime.GOROOT(), "bin", "go")
+}
+
+// TestGeneratorContract runs the generator's contract mode, which sends one
+// payload of every type its encoders and the intersection simulator build,
+// and checks each payload against the OpenAPI document and the rows and
+// documents the SIEM made of it. Every payload type the document declares
+// has to be sent.
+func TestGeneratorContract(t *testing.T) {
+	db := getContractDB(t)
+	spec := loadSpec(t)
+	payloadTypes := spec.payloadTypes(t)
+
+	// the simulator broadcasts SPaT and MAP for the declared intersections
+	now := time.Now()
+	intersection := models.SyntheticIntersection{
+		IntersectionID: 1 + int(now.UnixNano()%65535),
+		Name:           fmt.Sprintf("Contract Test Intersection %d", now.UnixNano()),
+		Latitude:       37.7793,
+		Longitude:      -122.4193,
+		Approaches: []eventschema.Approach{
+			{ID: 1, Name: "northbound", Heading: 0, Lanes: 2, SignalGroup: 2},
+			{ID: 2, Name: "eastbound", Heading: 90, Lanes: 2, SignalGroup: 4},
+		},
+		TimingPlans: []eventschema.TimingPlan{{
+			Name:         "fixed",
+			CycleSeconds: 60,
+			Phases: []eventschema.PhaseTiming{
+				{SignalGroup: 2, StartSeconds: 0, GreenSeconds: 25, YellowSeconds: 4},
+				{SignalGroup: 4, StartSeconds: 30, GreenSeconds: 25, YellowSeconds: 4},
+			},
+		}},
+		Enabled: true,
+	}
+	require.NoError(t, db.Create(&intersection).Error, "Failed to declare the test intersection")
+	defer db.Delete(&intersection)
+
+	// the API in-process, indexing into the fake Elasticsearch through
+	// the _bulk API like in production
+	es := &fakeElasticsearch{docs: map[string]map[string]interface{}{}}
+	esServer := httptest.NewServer(es)
+	defer esServer.Close()
+	esService := elasticsearch.NewService()
+	esService.Client = &elasticsearch.ESClient{
+		URL:        esServer.URL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	require.NoError(t, esService.Initialize(), "Failed to initialize Elasticsearch service")
+	t.Setenv("ES_BULK_FLUSH_MS", "50")
+	esService.StartBulk()
+
+	// the payloads name many log sources, more than the key of one could send
+	t.Setenv("INGEST_API_TOKEN", TestIngestToken)
+	t.Setenv("INGEST_REQUIRE_API_KEYS", "false")
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	routes.RegisterRoutes(router, db, esService)
+	recorder := &ingestRecorder{handler: router}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	// the generator, built from source like in its image
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, goCommand(), "run", "./app")
+	cmd.Dir = GeneratorDir
+	cmd.Env = append(os.Environ(),
+		"SIEM_API_URL="+server.URL,
+		"INGEST_API_TOKEN="+TestIngestToken,
+		"CONTRACT_MODE=true",
+	)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, esService.Close(10*time.Second), "Failed to flush the bulk indexing buffer")
+
+	var eventIDs []uint
+	defer func() {
+		if len(eventIDs) > 0 {
+			db.Exec("DELETE FROM alerts WHERE security_event_id IN ?", eventIDs)
+			db.Exec("DELETE FROM security_events WHERE id IN ?", eventIDs)
+		}
+	}()
+
+	seen := map[string]int{}
+	for _, exchange := range recorder.exchanges {
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(exchange.body, &body), "Generator sent invalid JSON: %s", exchange.body)
+
+		matched, problems := spec.classify(payloadTypes, body)
+		if !assert.Len(t, matched, 1, "Payload should match exactly one payload type: %s\n%s", exchange.body, strings.Join(problems, "\n")) {
+			continue
+		}
+		payloadType := matched[0]
+		seen[payloadType]++
+
+		if !assert.Equal(t, http.StatusOK, exchange.status, "%s payload rejected: %s", payloadType, exchange.response) {
+			continue
+		}
+		var response struct {
+			EventID  uint     `json:"event_id"`
+			Warnings []string `json:"warnings"`
+		}
+		require.NoError(t, json.Unmarshal(exchange.response, &response), "Failed to decode ingest response")
+		assert.Empty(t, response.Warnings, "%s payload indexed with warnings", payloadType)
+		eventIDs = append(eventIDs, response.EventID)
+
+		checkArtifacts(t, db, es, payloadType, body, exchange.body, response.EventID)
+	}
+
+	require.NoError(t, err, "Generator contract run failed:\n%s", output)
+	for _, payloadType := range payloadTypes {
+		assert.NotZero(t, seen[payloadType], "The generator sent no %s payload", payloadType)
+	}
+}
+
+// checkArtifacts checks the stored event, its alerts and their Elasticsearch
+// documents against the payload they were made of
+func checkArtifacts(t *testing.T, db *gorm.DB, es *fakeElasticsearch, payloadType string, body map[string]interface{}, raw []byte, eventID uint) {
+	var event models.SecurityEvent
+	if !assert.NoError(t, db.Preload("LogSource").First(&event, eventID).Error, "%s payload: event %d not stored", payloadType, eventID) {
+		return
+	}
+
+	timestamp, _ := time.Parse(time.RFC3339Nano, body["timestamp"].(string))
+	assert.Equal(t, body["source_name"], event.LogSource.Name, "%s payload: log source", payloadType)
+	assert.WithinDuration(t, timestamp, event.Timestamp, time.Millisecond, "%s payload: timestamp", payloadType)
+	assert.Equal(t, body["severity"], string(event.Severity), "%s payload: severity", payloadType)
+	assert.Equal(t, body["category"], string(event.Category), "%s payload: category", payloadType)
+	assert.Equal(t, body["message"], event.Message, "%s payload: message", payloadType)
+	assert.JSONEq(t, string(raw), event.RawData, "%s payload: raw data", payloadType)
+
+	// connection fields are copied onto the event
+	details := body["details"].(map[string]interface{})
+	copied := map[string]string{
+		"source_ip":      event.SourceIP,
+		"destination_ip": event.DestinationIP,
+		"protocol":       event.Protocol,
+		"action":         event.Action,
+		"status":         event.Status,
+	}
+	for field, stored := range copied {
+		if value, ok := details[field]; ok {
+			assert.Equal(t, value, stored, "%s payload: %s", payloadType, field)
+		}
+	}
+	for field, stored := range map[string]*int{"source_port": event.SourcePort, "destination_port": event.DestinationPort} {
+		if value, ok := details[field]; ok && assert.NotNil(t, stored, "%s payload: %s", payloadType, field) {
+			assert.Equal(t, value, float64(*stored), "%s payload: %s", payloadType, field)
+		}
+	}
+
+	// vehicles and V2X messages are readable as observations
+	if vehicleID, ok := details["vehicle_id"]; ok {
+		obs, ok := siem.ParseV2XObservation(&event, event.LogSource.Name)
+		if assert.True(t, ok, "%s payload: not parsed as a V2X observation", payloadType) {
+			assert.Equal(t, vehicleID, obs.VehicleID, "%s payload: vehicle ID", payloadType)
+			if messageType, ok := details["message_type"]; ok {
+				assert.Equal(t, messageType, obs.MessageType, "%s payload: message type", payloadType)
+			}
+			_, located := details["location"]
+			assert.Equal(t, located, obs.HasLocation, "%s payload: location", payloadType)
+		}
+	}
+
+	doc, ok := es.document("security-events-", eventID)
+	if assert.True(t, ok, "%s payload: event %d not indexed", payloadType, eventID) {
+		assert.Equal(t, string(event.Category), doc["category"], "%s payload: indexed category", payloadType)
+		assert.Equal(t, string(event.Severity), doc["severity"], "%s payload: indexed severity", payloadType)
+		assert.Equal(t, event.Message, doc["message"], "%s payload: indexed message", payloadType)
+		if _, located := details["location"]; located {
+			assert.Contains(t, doc, "geohash", "%s payload: indexed location", payloadType)
+		}
+	}
+
+	var alerts []models.Alert
+	assert.NoError(t, db.Where("security_event_id = ?", eventID).Find(&alerts).Error)
+	for _, alert := range alerts {
+		_, ok := es.document("security-alerts-", alert.ID)
+		assert.True(t, ok, "%s payload: alert %d not indexed", payloadType, alert.ID)
+	}
+}
@@ -0,0 +1,232 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"traffic-monitoring-go/app/eventschema"
+)
+
+// openAPISpec is the part of the ingest OpenAPI document the contract checks
+type openAPISpec struct {
+	Paths map[string]map[string]struct {
+		RequestBody struct {
+			Content map[string]struct {
+				Schema schema `json:"schema"`
+			} `json:"content"`
+		} `json:"requestBody"`
+	} `json:"paths"`
+	Components struct {
+		Schemas map[string]schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// schema is a JSON schema object of the document
+type schema map[string]interface{}
+
+// knownKeywords are the schema keywords validate understands; a document
+// using others fails the contract rather than going unchecked
+var knownKeywords = map[string]bool{
+	"$ref": true, "allOf": true, "oneOf": true, "type": true, "enum": true,
+	"required": true, "properties": true, "additionalProperties": true,
+	"items": true, "minItems": true, "minLength": true, "minimum": true,
+	"maximum": true, "pattern": true, "format": true, "description": true,
+}
+
+// loadSpec parses the embedded ingest OpenAPI document
+func loadSpec(t *testing.T) *openAPISpec {
+	var spec openAPISpec
+	require.NoError(t, json.Unmarshal(eventschema.OpenAPI, &spec), "Failed to parse the ingest OpenAPI document")
+	return &spec
+}
+
+// payloadTypes are the names of the schemas the ingest request body is one of
+func (s *openAPISpec) payloadTypes(t *testing.T) []string {
+	body, ok := s.Paths["/ingest"]["post"].RequestBody.Content["application/json"]
+	require.True(t, ok, "The OpenAPI document has no JSON request body for POST /ingest")
+
+	branches, _ := body.Schema["oneOf"].([]interface{})
+	require.NotEmpty(t, branches, "The POST /ingest request body declares no payload types")
+	names := make([]string, 0, len(branches))
+	for _, branch := range branches {
+		ref, _ := branch.(map[string]interface{})["$ref"].(string)
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		require.Contains(t, s.Components.Schemas, name, "Unknown payload type %q", ref)
+		names = append(names, name)
+	}
+	return names
+}
+
+// classify returns the payload types a body validates against, or the
+// problems with the closest one when it matches none
+func (s *openAPISpec) classify(payloadTypes []string, body interface{}) ([]string, []string) {
+	var matched, closest []string
+	for _, name := range payloadTypes {
+		problems := s.validate(s.Components.Schemas[name], body, "$")
+		if len(problems) == 0 {
+			matched = append(matched, name)
+		} else if closest == nil || len(problems) < len(closest) {
+			closest = append([]string{"closest payload type " + name + ":"}, problems...)
+		}
+	}
+	if len(matched) > 0 {
+		return matched, nil
+	}
+	return nil, closest
+}
+
+// validate returns the ways value breaks a schema, each prefixed by its path
+func (s *openAPISpec) validate(sch schema, value interface{}, path string) []string {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	keywords := make([]string, 0, len(sch))
+	for keyword := range sch {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	for _, keyword := range keywords {
+		if !knownKeywords[keyword] {
+			fail("unsupported schema keyword %q", keyword)
+		}
+	}
+
+	if ref, ok := sch["$ref"].(string); ok {
+		target, ok := s.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+		if !ok {
+			fail("unknown reference %q", ref)
+			return problems
+		}
+		problems = append(problems, s.validate(target, value, path)...)
+	}
+	if all, ok := sch["allOf"].([]interface{}); ok {
+		for _, part := range all {
+			problems = append(problems, s.validate(schema(part.(map[string]interface{})), value, path)...)
+		}
+	}
+	if one, ok := sch["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, part := range one {
+			if len(s.validate(schema(part.(map[string]interface{})), value, path)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			fail("matches %d of the oneOf schemas instead of one", matches)
+		}
+	}
+
+	if typ, ok := sch["type"].(string); ok && !hasType(value, typ) {
+		fail("expected %s, got %s", typ, describe(value))
+		return problems
+	}
+	if enum, ok := sch["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if allowed == value {
+				found = true
+			}
+		}
+		if !found {
+			fail("%s is not one of %v", describe(value), enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := sch["properties"].(map[string]interface{})
+		if required, ok := sch["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					fail("missing required property %q", name)
+				}
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, declared := properties[name].(map[string]interface{})
+			if declared {
+				problems = append(problems, s.validate(schema(property), v[name], path+"."+name)...)
+			} else if additional, ok := sch["additionalProperties"].(bool); ok && !additional {
+				fail("undeclared property %q", name)
+			}
+		}
+
+	case []interface{}:
+		if minItems, ok := sch["minItems"].(float64); ok && float64(len(v)) < minItems {
+			fail("has %d items, fewer than %v", len(v), minItems)
+		}
+		if items, ok := sch["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, s.validate(schema(items), item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+
+	case string:
+		if minLength, ok := sch["minLength"].(float64); ok && float64(len(v)) < minLength {
+			fail("%q is shorter than %v", v, minLength)
+		}
+		if pattern, ok := sch["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(v) {
+			fail("%q does not match %s", v, pattern)
+		}
+		switch sch["format"] {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				fail("%q is not an RFC 3339 date-time", v)
+			}
+		case "ipv4":
+			if ip := net.ParseIP(v); ip == nil || ip.To4() == nil {
+				fail("%q is not an IPv4 address", v)
+			}
+		}
+
+	case float64:
+		if minimum, ok := sch["minimum"].(float64); ok && v < minimum {
+			fail("%v is less than %v", v, minimum)
+		}
+		if maximum, ok := sch["maximum"].(float64); ok && v > maximum {
+			fail("%v is greater than %v", v, maximum)
+		}
+	}
+	return problems
+}
+
+// hasType reports whether a decoded JSON value is of a schema type
+func hasType(value interface{}, typ string) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return typ == "object"
+	case []interface{}:
+		return typ == "array"
+	case string:
+		return typ == "string"
+	case bool:
+		return typ == "boolean"
+	case float64:
+		return typ == "number" || (typ == "integer" && v == math.Trunc(v))
+	}
+	return false
+}
+
+// describe names a decoded JSON value in problems
+func describe(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
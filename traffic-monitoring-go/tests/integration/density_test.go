@@ -0,0 +1,81 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"traffic-monitoring-go/app/handlers"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/elasticsearch"
+)
+
+// TestDensityAnomaliesMatchDatabase checks that the anomaly findings of
+// ingested V2X messages are indexed next to the messages, so the density map
+// counts the same messages and anomalies from Elasticsearch as from the
+// database fallback
+func TestDensityAnomaliesMatchDatabase(t *testing.T) {
+	db := getTestDB(t)
+	esService := getElasticsearchService(t)
+	gin.SetMode(gin.TestMode)
+	handler := handlers.NewIngestionHandler(db, esService)
+
+	vehicleID := fmt.Sprintf("DENSITY-%d", time.Now().UnixNano())
+	defer db.Exec("DELETE FROM alerts WHERE security_event_id IN (SELECT id FROM security_events WHERE raw_data LIKE ?)", "%"+vehicleID+"%")
+	defer db.Exec("DELETE FROM security_events WHERE raw_data LIKE ?", "%"+vehicleID+"%")
+
+	// 5 km in one second: the second message raises a position jump
+	start := time.Now().UTC().Truncate(time.Second)
+	for i, location := range []string{"-60.0000,-150.0000", "-60.0450,-150.0000"} {
+		body, err := json.Marshal(siem.RawEvent{
+			SourceName: "Density Test Source",
+			SourceType: string(models.SourceTypeApplication),
+			Timestamp:  start.Add(time.Duration(i) * time.Second),
+			Severity:   string(models.SeverityLow),
+			Category:   string(models.CategoryV2X),
+			Message:    "BSM received",
+			Details: map[string]interface{}{
+				"vehicle_id":   vehicleID,
+				"message_type": "BSM",
+				"location":     location,
+			},
+		})
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(body))
+		handler.IngestEvent(c)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	resp, err := http.Post(esService.Client.URL+"/security-events-*/_refresh", "application/json", nil)
+	require.NoError(t, err, "Failed to refresh Elasticsearch indices")
+	resp.Body.Close()
+
+	density := siem.EventDensity{
+		Box:       elasticsearch.BoundingBox{North: -59, South: -61, East: -149, West: -151},
+		From:      start,
+		To:        start.Add(time.Minute),
+		Precision: 5,
+	}
+	fromES, err := siem.NewEventSearcher(db, esService).Density(density)
+	require.NoError(t, err)
+	require.Equal(t, siem.SearchBackendElasticsearch, fromES.Backend, fromES.FallbackReason)
+
+	fromDB, err := siem.NewEventSearcher(db, nil).Density(density)
+	require.NoError(t, err)
+	require.Equal(t, siem.SearchBackendPostgres, fromDB.Backend)
+
+	require.Equal(t, 2, fromDB.Messages, "Expected both messages in the database")
+	require.Greater(t, fromDB.Anomalies, 0, "Expected the position jump in the database")
+	require.Equal(t, fromDB.Messages, fromES.Messages, "Messages differ between Elasticsearch and the database")
+	require.Equal(t, fromDB.Anomalies, fromES.Anomalies, "Anomalies differ between Elasticsearch and the database")
+}
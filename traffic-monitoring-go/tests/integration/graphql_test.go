@@ -0,0 +1,110 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"traffic-monitoring-go/app/handlers"
+	"traffic-monitoring-go/app/middleware"
+	"traffic-monitoring-go/app/models"
+)
+
+// TestGraphQLTenantScoping checks that callers acting for an organization
+// read only its events through /graphql, and admins without one read all
+func TestGraphQLTenantScoping(t *testing.T) {
+	db := getTestDB(t)
+	gin.SetMode(gin.TestMode)
+	t.Setenv("ADMIN_API_TOKEN", "graphql-test-admin-token")
+
+	router := gin.New()
+	router.Use(middleware.Authenticate(db), middleware.TenantRoutes("/graphql"))
+	router.POST("/graphql", handlers.NewGraphQLHandler(db).Query)
+
+	marker := fmt.Sprintf("graphql-%d", time.Now().UnixNano())
+	source := models.LogSource{Name: "GraphQL Test Source", Type: models.SourceTypeSystem, Enabled: true}
+	require.NoError(t, db.Where(models.LogSource{Name: source.Name}).FirstOrCreate(&source).Error)
+
+	eventIDs := map[string]uint{}
+	for _, slug := range []string{"north", "south"} {
+		org := models.Organization{Slug: marker + "-" + slug, Name: slug, Enabled: true}
+		require.NoError(t, db.Create(&org).Error)
+		event := models.SecurityEvent{
+			Timestamp:      time.Now().UTC(),
+			SourceIP:       marker,
+			LogSourceID:    source.ID,
+			Severity:       models.SeverityLow,
+			Category:       models.CategoryNetwork,
+			Message:        "event of " + slug,
+			OrganizationID: &org.ID,
+		}
+		require.NoError(t, db.Create(&event).Error)
+		eventIDs[slug] = event.ID
+	}
+	defer db.Exec("DELETE FROM security_events WHERE source_ip = ?", marker)
+	defer db.Exec("DELETE FROM organizations WHERE slug LIKE ?", marker+"-%")
+
+	query := func(organization, query string) map[string]interface{} {
+		body, err := json.Marshal(map[string]string{"query": query})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Admin-Token", "graphql-test-admin-token")
+		if organization != "" {
+			req.Header.Set(middleware.OrganizationHeader, marker+"-"+organization)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp struct {
+			Data   map[string]interface{} `json:"data"`
+			Errors []interface{}          `json:"errors"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Empty(t, resp.Errors)
+		return resp.Data
+	}
+	messages := func(data map[string]interface{}) []string {
+		var messages []string
+		for _, item := range data["events"].(map[string]interface{})["items"].([]interface{}) {
+			messages = append(messages, item.(map[string]interface{})["message"].(string))
+		}
+		return messages
+	}
+	list := fmt.Sprintf(`{ events(source_ip: %q) { items { message } } }`, marker)
+	lookup := func(slug string) string {
+		return fmt.Sprintf(`{ event(id: %d) { message } }`, eventIDs[slug])
+	}
+
+	tests := []struct {
+		name         string
+		organization string
+		messages     []string
+		visible      map[string]bool
+	}{
+		{"north sees its own events", "north", []string{"event of north"}, map[string]bool{"north": true}},
+		{"south sees its own events", "south", []string{"event of south"}, map[string]bool{"south": true}},
+		{"no organization sees every event", "", []string{"event of south", "event of north"}, map[string]bool{"north": true, "south": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ElementsMatch(t, tt.messages, messages(query(tt.organization, list)))
+			for slug := range eventIDs {
+				event := query(tt.organization, lookup(slug))["event"]
+				if tt.visible[slug] {
+					assert.NotNil(t, event, "event of %s", slug)
+				} else {
+					assert.Nil(t, event, "event of %s", slug)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// TestIncidentAlertChangesReachOutbox checks that adding an alert to an
+// incident and removing it are recorded in the alert outbox
+func TestIncidentAlertChangesReachOutbox(t *testing.T) {
+	db := getTestDB(t)
+	marker := fmt.Sprintf("incident-outbox-%d", time.Now().UnixNano())
+
+	source := models.LogSource{Name: "Incident Outbox Source", Type: models.SourceTypeSystem, Enabled: true}
+	require.NoError(t, db.Where(models.LogSource{Name: source.Name}).FirstOrCreate(&source).Error)
+	event := models.SecurityEvent{Timestamp: time.Now().UTC(), SourceIP: marker, LogSourceID: source.ID,
+		Severity: models.SeverityHigh, Category: models.CategoryNetwork, Message: marker}
+	require.NoError(t, db.Create(&event).Error)
+	rule := models.Rule{Name: marker, Condition: "severity = high", Severity: models.SeverityHigh,
+		Category: models.CategoryNetwork, Status: models.RuleStatusEnabled}
+	require.NoError(t, db.Create(&rule).Error)
+	alert := models.Alert{RuleID: rule.ID, SecurityEventID: event.ID, Timestamp: time.Now().UTC(),
+		Severity: models.SeverityHigh, Status: models.AlertStatusOpen}
+	require.NoError(t, db.Create(&alert).Error)
+
+	var incident models.Incident
+	defer func() {
+		db.Exec("DELETE FROM alert_outbox WHERE alert_id = ?", alert.ID)
+		db.Exec("DELETE FROM incident_entries WHERE incident_id = ?", incident.ID)
+		db.Exec("DELETE FROM alerts WHERE id = ?", alert.ID)
+		db.Exec("DELETE FROM incidents WHERE id = ?", incident.ID)
+		db.Exec("DELETE FROM rules WHERE id = ?", rule.ID)
+		db.Exec("DELETE FROM security_events WHERE id = ?", event.ID)
+	}()
+
+	// lastChange returns the incident ID in the latest outbox snapshot of the alert
+	lastChange := func() (models.AlertChangeOperation, interface{}) {
+		var change models.AlertChange
+		require.NoError(t, db.Where("alert_id = ?", alert.ID).Order("id DESC").First(&change).Error)
+		var snapshot map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(change.Payload), &snapshot))
+		return change.Operation, snapshot["incident_id"]
+	}
+
+	service := siem.NewIncidentService(db)
+	incident = models.Incident{Title: marker}
+	require.NoError(t, service.Create(&incident, []uint{alert.ID}, "tester"))
+	operation, incidentID := lastChange()
+	assert.Equal(t, models.AlertChangeUpdated, operation)
+	assert.Equal(t, float64(incident.ID), incidentID)
+
+	require.NoError(t, service.RemoveAlert(&incident, alert.ID, "tester"))
+	operation, incidentID = lastChange()
+	assert.Equal(t, models.AlertChangeUpdated, operation)
+	assert.Nil(t, incidentID)
+
+	assert.ErrorIs(t, service.RemoveAlert(&incident, alert.ID, "tester"), siem.ErrAlertNotInIncident)
+}
@@ -0,0 +1,169 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// benchmarkEvent returns a raw event from the named source
+func benchmarkEvent(sourceName string, n int64) []byte {
+	eventJSON, _ := json.Marshal(siem.RawEvent{
+		SourceName: sourceName,
+		SourceType: string(models.SourceTypeSystem),
+		Timestamp:  time.Now(),
+		Severity:   string(models.SeverityLow),
+		Category:   string(models.CategoryNetwork),
+		Message:    fmt.Sprintf("Benchmark event %d", n),
+		Details: map[string]interface{}{
+			"source_ip": "10.0.0.1",
+			"protocol":  "tcp",
+		},
+	})
+	return eventJSON
+}
+
+// TestConcurrentIngestCreatesSourceOnce checks that workers seeing a new source
+// at the same time auto-create a single log source
+func TestConcurrentIngestCreatesSourceOnce(t *testing.T) {
+	db := getTestDB(t)
+	sourceName := fmt.Sprintf("Concurrent Source %d", time.Now().UnixNano())
+	defer db.Exec("DELETE FROM security_events WHERE log_source_id IN (SELECT id FROM log_sources WHERE name = ?)", sourceName)
+	defer db.Exec("DELETE FROM log_sources WHERE name = ?", sourceName)
+
+	ingester := siem.NewEventIngester(db)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(n int64) {
+			defer wg.Done()
+			_, err := ingester.Ingest(context.Background(), benchmarkEvent(sourceName, n))
+			errs <- err
+		}(int64(i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err, "Failed to ingest event")
+	}
+
+	var sources int64
+	require.NoError(t, db.Model(&models.LogSource{}).Where("name = ?", sourceName).Count(&sources).Error)
+	require.Equal(t, int64(1), sources, "Expected one auto-created log source")
+}
+
+// TestIngestCancelledContext checks that a cancelled context stores nothing
+func TestIngestCancelledContext(t *testing.T) {
+	db := getTestDB(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := siem.NewEventIngester(db).Ingest(ctx, benchmarkEvent("Cancelled Source", 0))
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+// TestIngestDeviceID checks that the device ID is read from details.device_id,
+// and from the misspelt devide_id older senders still use
+func TestIngestDeviceID(t *testing.T) {
+	db := getTestDB(t)
+	sourceName := fmt.Sprintf("Device Source %d", time.Now().UnixNano())
+	defer db.Exec("DELETE FROM security_events WHERE log_source_id IN (SELECT id FROM log_sources WHERE name = ?)", sourceName)
+	defer db.Exec("DELETE FROM log_sources WHERE name = ?", sourceName)
+
+	tests := []struct {
+		name     string
+		details  map[string]interface{}
+		deviceID string
+	}{
+		{"device_id", map[string]interface{}{"device_id": "obu-1"}, "obu-1"},
+		{"misspelt devide_id", map[string]interface{}{"devide_id": "obu-2"}, "obu-2"},
+		{"device_id wins over devide_id", map[string]interface{}{"device_id": "obu-3", "devide_id": "obu-4"}, "obu-3"},
+		{"no device", map[string]interface{}{"source_ip": "10.0.0.1"}, ""},
+	}
+
+	ingester := siem.NewEventIngester(db)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventJSON, err := json.Marshal(siem.RawEvent{
+				SourceName: sourceName,
+				SourceType: string(models.SourceTypeSystem),
+				Timestamp:  time.Now(),
+				Severity:   string(models.SeverityLow),
+				Category:   string(models.CategoryNetwork),
+				Message:    "Device event",
+				Details:    tt.details,
+			})
+			require.NoError(t, err)
+
+			result, err := ingester.Ingest(context.Background(), eventJSON)
+			require.NoError(t, err, "Failed to ingest event")
+			require.Len(t, result.Events(), 1)
+
+			var stored models.SecurityEvent
+			require.NoError(t, db.First(&stored, result.Events()[0].ID).Error)
+			require.Equal(t, tt.deviceID, stored.DeviceID)
+		})
+	}
+}
+
+// BenchmarkIngest measures storing events one at a time
+func BenchmarkIngest(b *testing.B) {
+	ingester := siem.NewEventIngester(getTestDB(b))
+	ingester.EvaluateRules = true
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ingester.Ingest(context.Background(), benchmarkEvent("Benchmark Source", int64(i))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkIngestParallel measures one ingester shared by concurrent workers,
+// as the HTTP handler and the collectors use it
+func BenchmarkIngestParallel(b *testing.B) {
+	ingester := siem.NewEventIngester(getTestDB(b))
+	ingester.EvaluateRules = true
+
+	var n int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := atomic.AddInt64(&n, 1)
+			if _, err := ingester.Ingest(context.Background(), benchmarkEvent("Benchmark Source", i)); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkIngestParallelNewSources measures concurrent workers that keep
+// seeing new sources, which serializes on the log source creation lock
+func BenchmarkIngestParallelNewSources(b *testing.B) {
+	ingester := siem.NewEventIngester(getTestDB(b))
+
+	var n int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := atomic.AddInt64(&n, 1)
+			source := fmt.Sprintf("Benchmark Source %d", i%64)
+			if _, err := ingester.Ingest(context.Background(), benchmarkEvent(source, i)); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package integration
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/database"
+)
+
+// autoMigratedSchema is the schema GORM AutoMigrate made of the models before
+// the versioned migrations replaced it
+const autoMigratedSchema = `
+CREATE TABLE users (id bigserial PRIMARY KEY, email text NOT NULL UNIQUE, hashed_password text NOT NULL, role VARCHAR(20));
+CREATE TABLE stations (id bigserial PRIMARY KEY, code text NOT NULL UNIQUE, name text, city text, latitude decimal, longitude decimal, date_of_installation timestamptz);
+CREATE TABLE sensors (id bigserial PRIMARY KEY, sensor_id text NOT NULL UNIQUE, station_id bigint NOT NULL REFERENCES stations(id), measurement_type text, status text);
+CREATE TABLE traffic_measurements (id bigserial PRIMARY KEY, sensor_id bigint NOT NULL REFERENCES sensors(id) ON DELETE CASCADE, timestamp timestamptz NOT NULL, speed decimal, vehicle_count bigint, created_at timestamptz);
+CREATE TABLE user_events (id bigserial PRIMARY KEY, date timestamptz NOT NULL, city text NOT NULL, event_type text NOT NULL, description text, expected_congestion_level text, station_id bigint REFERENCES stations(id));
+CREATE TABLE log_sources (id bigserial PRIMARY KEY, name text NOT NULL, type text NOT NULL, description text, enabled boolean NOT NULL DEFAULT true, created_at timestamptz, updated_at timestamptz);
+CREATE TABLE security_events (id bigserial PRIMARY KEY, timestamp timestamptz NOT NULL, source_ip text, source_port bigint, destination_ip text, destination_port bigint, protocol text, action text, status text, user_id bigint REFERENCES users(id), device_id text, log_source_id bigint REFERENCES log_sources(id), severity text NOT NULL, category text NOT NULL, message text NOT NULL, raw_data text, created_at timestamptz);
+CREATE INDEX idx_security_events_timestamp ON security_events (timestamp);
+CREATE TABLE rules (id bigserial PRIMARY KEY, name text NOT NULL UNIQUE, description text, condition text NOT NULL, severity text NOT NULL, category text NOT NULL, status text NOT NULL, created_by bigint, created_at timestamptz, updated_at timestamptz);
+CREATE TABLE alerts (id bigserial PRIMARY KEY, rule_id bigint REFERENCES rules(id), security_event_id bigint REFERENCES security_events(id), timestamp timestamptz NOT NULL, severity text NOT NULL, status text NOT NULL, assigned_to bigint REFERENCES users(id), resolution text, created_at timestamptz, updated_at timestamptz);
+`
+
+// TestMigrateAutoMigratedDatabase checks that the migrations upgrade a
+// database AutoMigrate set up, keeping its rows
+func TestMigrateAutoMigratedDatabase(t *testing.T) {
+	db := getTestDB(t)
+	schema := fmt.Sprintf("upgrade_%d", time.Now().UnixNano())
+	require.NoError(t, db.Exec("CREATE SCHEMA "+schema).Error)
+	defer db.Exec("DROP SCHEMA " + schema + " CASCADE")
+
+	old, err := gorm.Open(postgres.Open(testDSN()+" search_path="+schema), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to the upgrade schema")
+	if sqlDB, err := old.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	require.NoError(t, old.Exec(autoMigratedSchema).Error, "Failed to create the AutoMigrate schema")
+	require.NoError(t, old.Exec(`
+INSERT INTO users (email, hashed_password, role) VALUES ('upgrade@example.com', 'x', 'admin');
+INSERT INTO log_sources (name, type) VALUES ('Upgrade Source', 'system');
+INSERT INTO security_events (timestamp, log_source_id, severity, category, message) VALUES (now(), 1, 'high', 'network', 'before the upgrade');
+INSERT INTO rules (name, condition, severity, category, status) VALUES ('Upgrade Rule', 'severity = high', 'high', 'network', 'enabled');
+INSERT INTO alerts (rule_id, security_event_id, timestamp, severity, status) VALUES (1, 1, now(), 'high', 'open');
+`).Error)
+
+	migrator, err := database.NewMigrator(old)
+	require.NoError(t, err, "Failed to load migrations")
+	applied, err := migrator.Up(0)
+	require.NoError(t, err, "Failed to migrate the AutoMigrate schema")
+	assert.Len(t, applied, len(migrator.Migrations))
+	require.NoError(t, migrator.Check())
+
+	// the columns added since are there, with their defaults on the old rows
+	for table, columns := range map[string][]string{
+		"users":           {"max_sessions", "organization_id"},
+		"security_events": {"trust_score", "organization_id", "correlation_id"},
+		"rules":           {"scope", "techniques", "v2x_threats", "organization_id"},
+		"alerts":          {"late_evaluated", "evaluated_at", "incident_id", "organization_id", "correlation_id"},
+	} {
+		for _, column := range columns {
+			var found int64
+			require.NoError(t, old.Raw("SELECT count(*) FROM information_schema.columns WHERE table_schema = ? AND table_name = ? AND column_name = ?", schema, table, column).Scan(&found).Error)
+			assert.Equal(t, int64(1), found, "%s.%s", table, column)
+		}
+	}
+	var lateEvaluated bool
+	require.NoError(t, old.Raw("SELECT late_evaluated FROM alerts").Scan(&lateEvaluated).Error)
+	assert.False(t, lateEvaluated)
+	var message string
+	require.NoError(t, old.Raw("SELECT message FROM security_events").Scan(&message).Error)
+	assert.Equal(t, "before the upgrade", message)
+}
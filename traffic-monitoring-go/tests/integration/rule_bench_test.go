@@ -0,0 +1,144 @@
+package integration
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"traffic-monitoring-go/app/models"
+	"traffic-monitoring-go/app/siem"
+)
+
+// targetEventsPerCore is the rule evaluation throughput one core must sustain
+const targetEventsPerCore = 10000
+
+// benchmarkRuleSource scopes the benchmark rules to a log source no other
+// test stores events under, so they raise no alerts elsewhere
+const benchmarkRuleSource = math.MaxUint32
+
+// benchmarkConditions are typical detection conditions; the benchmark event
+// gets past the first clause of most without matching any
+var benchmarkConditions = []string{
+	`severity = high AND source_ip startswith 192.168.`,
+	`details.speed > 200 AND details.vehicle_id exists`,
+	`message matches ^(failed|denied) login for .* from 10\.`,
+	`protocol = tcp AND destination_port between 8000 and 8999`,
+	`raw_data.details.message_type = BSM AND trust_score < 20`,
+	`NOT (action = deny OR action = drop) AND status = blocked`,
+	`details.heading >= 360 OR details.latitude > 90`,
+	`category = network AND protocol in (icmp, gre, sctp)`,
+	`message contains brute force OR message endswith from 203.0.113.7`,
+	`details.speed > 120 AND details.speed <= 200 AND severity = critical`,
+}
+
+// seedBenchmarkRules creates n enabled rules for the benchmark event's source
+// and returns a function removing them
+func seedBenchmarkRules(b *testing.B, db *gorm.DB, n int) func() {
+	prefix := fmt.Sprintf("Benchmark Rule %d", time.Now().UnixNano())
+	for i := 0; i < n; i++ {
+		rule := models.Rule{
+			Name:      fmt.Sprintf("%s-%d", prefix, i),
+			Condition: benchmarkConditions[i%len(benchmarkConditions)],
+			Severity:  models.SeverityHigh,
+			Category:  models.CategoryNetwork,
+			Status:    models.RuleStatusEnabled,
+			Scope:     models.RuleScope{LogSourceIDs: []uint{benchmarkRuleSource}},
+		}
+		require.NoError(b, db.Create(&rule).Error, "Failed to create rule")
+	}
+	siem.InvalidateRuleIndex()
+
+	return func() {
+		db.Exec("DELETE FROM rules WHERE name LIKE ?", prefix+"-%")
+		siem.InvalidateRuleIndex()
+	}
+}
+
+// benchmarkRuleEvent returns an event that the benchmark rules evaluate in full
+func benchmarkRuleEvent() *models.SecurityEvent {
+	port := 443
+	trust := 85.0
+	return &models.SecurityEvent{
+		ID:              1,
+		LogSourceID:     benchmarkRuleSource,
+		Timestamp:       time.Now(),
+		Severity:        models.SeverityHigh,
+		Category:        models.CategoryNetwork,
+		SourceIP:        "10.0.0.1",
+		DestinationIP:   "10.0.0.2",
+		DestinationPort: &port,
+		Protocol:        "tcp",
+		Action:          "allow",
+		Status:          "ok",
+		Message:         "connection accepted from 10.0.0.1",
+		TrustScore:      &trust,
+		RawData:         `{"message_type":"BSM","details":{"vehicle_id":"V-1","speed":80.5,"heading":90,"latitude":40.1,"longitude":-8.6,"message_type":"BSM"}}`,
+	}
+}
+
+// reportEventsPerCore reports the events evaluated per second on each of
+// cores, and notes when that misses the target
+func reportEventsPerCore(b *testing.B, elapsed time.Duration, cores int) {
+	perCore := float64(b.N) / elapsed.Seconds() / float64(cores)
+	b.ReportMetric(perCore, "events/s/core")
+	if perCore < targetEventsPerCore {
+		b.Logf("%.0f events/s per core, below the target of %d", perCore, targetEventsPerCore)
+	}
+}
+
+// BenchmarkRuleEvaluation measures evaluating 50 rules against each event on
+// one core, with the conditions compiled once as the rule index loads
+func BenchmarkRuleEvaluation(b *testing.B) {
+	db := getTestDB(b)
+	defer seedBenchmarkRules(b, db, 50)()
+
+	engine := siem.NewEnhancedRuleEngine(db)
+	event := benchmarkRuleEvent()
+	if _, err := engine.Evaluate(event); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	started := time.Now()
+	for i := 0; i < b.N; i++ {
+		alerts, err := engine.Evaluate(event)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(alerts) > 0 {
+			b.Fatalf("Expected no alerts, got %d", len(alerts))
+		}
+	}
+	b.StopTimer()
+	reportEventsPerCore(b, time.Since(started), 1)
+}
+
+// BenchmarkRuleEvaluationParallel measures the same rules evaluated by
+// concurrent workers sharing the rule index
+func BenchmarkRuleEvaluationParallel(b *testing.B) {
+	db := getTestDB(b)
+	defer seedBenchmarkRules(b, db, 50)()
+
+	engine := siem.NewEnhancedRuleEngine(db)
+	if _, err := engine.Evaluate(benchmarkRuleEvent()); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	started := time.Now()
+	b.RunParallel(func(pb *testing.PB) {
+		event := benchmarkRuleEvent()
+		for pb.Next() {
+			if _, err := engine.Evaluate(event); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+	b.StopTimer()
+	reportEventsPerCore(b, time.Since(started), runtime.GOMAXPROCS(0))
+}
@@ -2,6 +2,7 @@ package integration
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -13,8 +14,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"traffic-monitoring-go/app/auth"
 	"traffic-monitoring-go/app/models"
 	"traffic-monitoring-go/app/siem"
+	"traffic-monitoring-go/app/siem/clock"
 	"traffic-monitoring-go/app/siem/elasticsearch"
 )
 
@@ -32,21 +35,24 @@ func getSIEMClient() *http.Client {
 	}
 }
 
-// getTestDB returns a test database connection
-func getTestDB(t *testing.T) *gorm.DB {
-	dsn := os.Getenv("DSN")
-	if dsn == "" {
-		dsn = TestDSN
+// testDSN returns the DSN of the test database
+func testDSN() string {
+	if dsn := os.Getenv("DSN"); dsn != "" {
+		return dsn
 	}
+	return TestDSN
+}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// getTestDB returns a test database connection
+func getTestDB(t testing.TB) *gorm.DB {
+	db, err := gorm.Open(postgres.Open(testDSN()), &gorm.Config{})
 	require.NoError(t, err, "Failed to connect to test database")
 	
 	return db
 }
 
 // getElasticsearchService returns a test Elasticsearch service
-func getElasticsearchService(t *testing.T) *elasticsearch.Service {
+func getElasticsearchService(t testing.TB) *elasticsearch.Service {
 	esURL := os.Getenv("ELASTICSEARCH_URL")
 	if esURL == "" {
 		esURL = TestElasticsearch
@@ -195,7 +201,7 @@ func TestSecurityEventProcessing(t *testing.T) {
 	require.NoError(t, err, "Failed to marshal event")
 	
 	// Process the event
-	err = eventIngester.IngestEvent(eventJSON)
+	err = eventIngester.IngestEvent(context.Background(), eventJSON)
 	require.NoError(t, err, "Failed to ingest event")
 	
 	// Verify the event was created
@@ -244,6 +250,20 @@ func TestSecurityEventProcessing(t *testing.T) {
 	assert.Greater(t, len(events), 0, "No events returned from Elasticsearch")
 }
 
+// issueTestAPIKey stores an API key of the log source with name, creating the
+// source when needed, and returns the key; it is removed when t ends
+func issueTestAPIKey(t *testing.T, db *gorm.DB, name string) string {
+	source := models.LogSource{Name: name, Type: models.SourceTypeSystem, Enabled: true}
+	require.NoError(t, db.Where("name = ?", name).FirstOrCreate(&source).Error, "Failed to create log source")
+
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	require.NoError(t, err, "Failed to generate API key")
+	apiKey := models.APIKey{LogSourceID: source.ID, Name: "integration test", Prefix: prefix, KeyHash: hash, CreatedBy: "integration test"}
+	require.NoError(t, db.Create(&apiKey).Error, "Failed to store API key")
+	t.Cleanup(func() { db.Delete(&apiKey) })
+	return key
+}
+
 // TestEventIngestionAPI tests the event ingestion API
 func TestEventIngestionAPI(t *testing.T) {
 	// Skip if no API server is running
@@ -281,11 +301,12 @@ func TestEventIngestionAPI(t *testing.T) {
 	
 	// Send to API
 	client := getSIEMClient()
-	resp, err := client.Post(
-		fmt.Sprintf("%s/ingest", APIBaseURL),
-		"application/json",
-		bytes.NewBuffer(eventJSON),
-	)
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/ingest", APIBaseURL), bytes.NewBuffer(eventJSON))
+	require.NoError(t, err, "Failed to create request")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", issueTestAPIKey(t, getTestDB(t), rawEvent.SourceName))
+
+	resp, err := client.Do(req)
 	require.NoError(t, err, "Failed to send request")
 	defer resp.Body.Close()
 	
@@ -300,3 +321,120 @@ func TestEventIngestionAPI(t *testing.T) {
 	// Verify event was created
 	assert.Contains(t, result, "event_id", "Response missing event_id")
 }
+
+// TestDashboardSummaries checks the summary counts over a seeded dataset
+func TestDashboardSummaries(t *testing.T) {
+	// Initialize database
+	db := getTestDB(t)
+	
+	// Clean up existing data
+	db.Exec("DELETE FROM alerts")
+	db.Exec("DELETE FROM security_events")
+	db.Exec("DELETE FROM rules")
+	db.Exec("DELETE FROM log_sources")
+	
+	now := time.Now().UTC()
+	logSource := models.LogSource{Name: "Dashboard Source", Type: models.SourceTypeSystem, Enabled: true}
+	require.NoError(t, db.Create(&logSource).Error, "Failed to create log source")
+	
+	user := models.User{Email: "dashboard@example.com", HashedPassword: "test", Role: models.AdminRole}
+	require.NoError(t, db.Where("email = ?", user.Email).FirstOrCreate(&user).Error, "Failed to create user")
+	
+	rule := models.Rule{
+		Name:      "Dashboard Rule",
+		Condition: "severity = critical",
+		Severity:  models.SeverityCritical,
+		Category:  models.CategorySystem,
+		Status:    models.RuleStatusEnabled,
+		CreatedBy: user.ID,
+	}
+	require.NoError(t, db.Create(&rule).Error, "Failed to create rule")
+	
+	// events in the last 30 days by severity, and two older ones outside the range
+	severities := map[models.EventSeverity]int{
+		models.SeverityCritical: 3,
+		models.SeverityHigh:     2,
+		models.SeverityMedium:   1,
+		models.SeverityLow:      4,
+		models.SeverityInfo:     1,
+	}
+	var events []models.SecurityEvent
+	for severity, count := range severities {
+		for i := 0; i < count; i++ {
+			events = append(events, models.SecurityEvent{
+				Timestamp:   now.Add(-time.Duration(i+1) * time.Hour),
+				LogSourceID: logSource.ID,
+				Severity:    severity,
+				Category:    models.CategorySystem,
+				Message:     fmt.Sprintf("Dashboard %s event %d", severity, i),
+			})
+		}
+	}
+	for i := 0; i < 2; i++ {
+		events = append(events, models.SecurityEvent{
+			Timestamp:   now.AddDate(0, 0, -40),
+			LogSourceID: logSource.ID,
+			Severity:    models.SeverityCritical,
+			Category:    models.CategorySystem,
+			Message:     fmt.Sprintf("Old dashboard event %d", i),
+		})
+	}
+	require.NoError(t, db.Create(&events).Error, "Failed to create events")
+	
+	// alerts by status and severity, and one older alert outside the range
+	alertSpecs := []struct {
+		status    models.AlertStatus
+		severity  models.EventSeverity
+		timestamp time.Time
+	}{
+		{models.AlertStatusOpen, models.SeverityCritical, now},
+		{models.AlertStatusOpen, models.SeverityHigh, now},
+		{models.AlertStatusOpen, models.SeverityLow, now},
+		{models.AlertStatusInProgress, models.SeverityCritical, now},
+		{models.AlertStatusClosed, models.SeverityMedium, now},
+		{models.AlertStatusClosed, models.SeverityMedium, now},
+		{models.AlertStatusFalsePositive, models.SeverityLow, now},
+		{models.AlertStatusOpen, models.SeverityCritical, now.AddDate(0, 0, -40)},
+	}
+	for i, spec := range alertSpecs {
+		alert := models.Alert{
+			RuleID:          rule.ID,
+			SecurityEventID: events[i].ID,
+			Timestamp:       spec.timestamp,
+			Severity:        spec.severity,
+			Status:          spec.status,
+		}
+		require.NoError(t, db.Create(&alert).Error, "Failed to create alert")
+	}
+	
+	service := &siem.DashboardService{DB: db, Clock: clock.NewFakeClock(now)}
+	
+	lastMonth := siem.DashboardTimeWindow("last_30_days", now)
+	eventSummary, err := service.GetEventSummary(lastMonth)
+	require.NoError(t, err, "Failed to summarize events")
+	assert.Equal(t, siem.EventCountSummary{Total: 11, Critical: 3, High: 2, Medium: 1, Low: 4, Info: 1}, *eventSummary)
+	
+	allEvents, err := service.GetEventSummary(siem.TimeWindow{})
+	require.NoError(t, err, "Failed to summarize all events")
+	assert.Equal(t, int64(13), allEvents.Total)
+	assert.Equal(t, int64(5), allEvents.Critical)
+	
+	// a custom window holding only the two older events
+	oldEvents, err := service.GetEventSummary(siem.TimeWindow{From: now.AddDate(0, 0, -41), To: now.AddDate(0, 0, -39)})
+	require.NoError(t, err, "Failed to summarize older events")
+	assert.Equal(t, siem.EventCountSummary{Total: 2, Critical: 2}, *oldEvents)
+	
+	alertSummary, err := service.GetAlertSummary(lastMonth)
+	require.NoError(t, err, "Failed to summarize alerts")
+	assert.Equal(t, siem.AlertSummary{
+		Total:         7,
+		Open:          3,
+		InProgress:    1,
+		Closed:        2,
+		FalsePositive: 1,
+		Critical:      2,
+		High:          1,
+		Medium:        2,
+		Low:           2,
+	}, *alertSummary)
+}
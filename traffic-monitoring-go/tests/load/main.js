@@ -84,6 +84,9 @@ export default function() {
       'Content-Type': 'application/json',
     },
   };
+  if (__ENV.API_KEY) {
+    params.headers['X-API-Key'] = __ENV.API_KEY;
+  }
   
   // Send event to ingestion endpoint
   const startTime = new Date();